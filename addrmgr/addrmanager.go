@@ -6,13 +6,17 @@
 package addrmgr
 
 import (
+	"bytes"
 	"container/list"
 	crand "crypto/rand" // for seeding
+	"crypto/sha256"
 	"encoding/base32"
 	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"math/rand"
 	"net"
 	"os"
@@ -25,6 +29,7 @@ import (
 
 	"github.com/bitgo/prova/chaincfg/chainhash"
 	"github.com/bitgo/prova/wire"
+	"golang.org/x/crypto/sha3"
 )
 
 // AddrManager provides a concurrency safe address manager for caching potential
@@ -58,7 +63,9 @@ type serializedKnownAddress struct {
 	// no refcount or tried, that is available from context.
 }
 
-type serializedAddrManager struct {
+// serializedAddrManagerV1 is the version 1 peers file, which is a single JSON
+// object holding all of the state.  It is only read to migrate it forward.
+type serializedAddrManagerV1 struct {
 	Version      int
 	Key          [32]byte
 	Addresses    []*serializedKnownAddress
@@ -66,6 +73,22 @@ type serializedAddrManager struct {
 	TriedBuckets [triedBucketCount][]string
 }
 
+// serializedHeader is the first line of the peers file.  The sections follow
+// it, one per line, so a damaged or truncated section does not prevent the
+// others from being read.
+type serializedHeader struct {
+	Version int
+	Key     [32]byte
+}
+
+// serializedSection is a line of the peers file holding one part of the state
+// along with the hex encoded sha256 checksum of its data.
+type serializedSection struct {
+	Name     string
+	Checksum string
+	Data     json.RawMessage
+}
+
 type localAddress struct {
 	na    *wire.NetAddress
 	score AddressPriority
@@ -155,7 +178,21 @@ const (
 	getAddrPercent = 23
 
 	// serialisationVersion is the current version of the on-disk format.
-	serialisationVersion = 1
+	serialisationVersion = 2
+
+	// backupSuffix is appended to the path of the peers file to name the
+	// copy of the previous version of the file, which is loaded when the
+	// current one can not be.
+	backupSuffix = ".bak"
+)
+
+// Names of the sections of the peers file.  The addresses section is required,
+// while the addresses in a missing new or tried buckets section are placed
+// into new buckets again.
+const (
+	sectionAddresses    = "addresses"
+	sectionNewBuckets   = "new"
+	sectionTriedBuckets = "tried"
 )
 
 // updateAddress is a helper function to either update an address already known
@@ -354,19 +391,15 @@ out:
 }
 
 // savePeers saves all the known addresses to a file so they can be read back
-// in at next run.
+// in at next run.  The file is replaced atomically and the previous version is
+// kept as a backup.
 func (a *AddrManager) savePeers() {
 	a.mtx.Lock()
 	defer a.mtx.Unlock()
 
-	// First we make a serialisable datastructure so we can encode it to
+	// First we make serialisable datastructures so we can encode them to
 	// json.
-	sam := new(serializedAddrManager)
-	sam.Version = serialisationVersion
-	copy(sam.Key[:], a.key[:])
-
-	sam.Addresses = make([]*serializedKnownAddress, len(a.addrIndex))
-	i := 0
+	addrs := make([]*serializedKnownAddress, 0, len(a.addrIndex))
 	for k, v := range a.addrIndex {
 		ska := new(serializedKnownAddress)
 		ska.Addr = k
@@ -377,88 +410,272 @@ func (a *AddrManager) savePeers() {
 		ska.LastSuccess = v.lastsuccess.Unix()
 		// Tried and refs are implicit in the rest of the structure
 		// and will be worked out from context on unserialisation.
-		sam.Addresses[i] = ska
-		i++
+		addrs = append(addrs, ska)
 	}
+	newBuckets := make([][]string, len(a.addrNew))
 	for i := range a.addrNew {
-		sam.NewBuckets[i] = make([]string, len(a.addrNew[i]))
-		j := 0
+		newBuckets[i] = make([]string, 0, len(a.addrNew[i]))
 		for k := range a.addrNew[i] {
-			sam.NewBuckets[i][j] = k
-			j++
+			newBuckets[i] = append(newBuckets[i], k)
 		}
 	}
+	triedBuckets := make([][]string, len(a.addrTried))
 	for i := range a.addrTried {
-		sam.TriedBuckets[i] = make([]string, a.addrTried[i].Len())
-		j := 0
+		triedBuckets[i] = make([]string, 0, a.addrTried[i].Len())
 		for e := a.addrTried[i].Front(); e != nil; e = e.Next() {
 			ka := e.Value.(*KnownAddress)
-			sam.TriedBuckets[i][j] = NetAddressKey(ka.na)
-			j++
+			triedBuckets[i] = append(triedBuckets[i],
+				NetAddressKey(ka.na))
 		}
 	}
 
-	w, err := os.Create(a.peersFile)
-	if err != nil {
-		log.Errorf("Error opening file %s: %v", a.peersFile, err)
-		return
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	err := enc.Encode(&serializedHeader{
+		Version: serialisationVersion,
+		Key:     a.key,
+	})
+	sections := []struct {
+		name string
+		data interface{}
+	}{
+		{sectionAddresses, addrs},
+		{sectionNewBuckets, newBuckets},
+		{sectionTriedBuckets, triedBuckets},
 	}
-	enc := json.NewEncoder(w)
-	defer w.Close()
-	if err := enc.Encode(&sam); err != nil {
+	for _, section := range sections {
+		if err != nil {
+			break
+		}
+		var data []byte
+		data, err = json.Marshal(section.data)
+		if err != nil {
+			break
+		}
+		checksum := sha256.Sum256(data)
+		err = enc.Encode(&serializedSection{
+			Name:     section.name,
+			Checksum: hex.EncodeToString(checksum[:]),
+			Data:     data,
+		})
+	}
+	if err != nil {
 		log.Errorf("Failed to encode file %s: %v", a.peersFile, err)
 		return
 	}
+
+	if err := writeFileAtomic(a.peersFile, buf.Bytes()); err != nil {
+		log.Errorf("Failed to write file %s: %v", a.peersFile, err)
+	}
 }
 
-// loadPeers loads the known address from the saved file.  If empty, missing, or
-// malformed file, just don't load anything and start fresh
+// writeFileAtomic replaces the file at the passed path with data without ever
+// leaving it incomplete.  The data is written to a temporary file which is
+// renamed over the file once it is synced to disk, and the replaced file is
+// kept as a backup.
+func writeFileAtomic(path string, data []byte) error {
+	tmpFile := path + ".new"
+	f, err := os.Create(tmpFile)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(path, path+backupSuffix)
+		if os.IsNotExist(err) {
+			err = nil
+		}
+	}
+	if err == nil {
+		err = os.Rename(tmpFile, path)
+	}
+	if err != nil {
+		os.Remove(tmpFile)
+	}
+	return err
+}
+
+// loadPeers loads the known addresses from the saved file.  When the file can
+// not be loaded its backup is loaded instead, and when neither can be loaded
+// the address manager starts fresh without any addresses.
+//
+// A file which was not loaded completely is removed, so the next save does
+// not replace the backup with it.
 func (a *AddrManager) loadPeers() {
 	a.mtx.Lock()
 	defer a.mtx.Unlock()
 
-	err := a.deserializePeers(a.peersFile)
-	if err != nil {
-		log.Errorf("Failed to parse file %s: %v", a.peersFile, err)
-		// if it is invalid we nuke the old one unconditionally.
-		err = os.Remove(a.peersFile)
+	found := false
+	for _, path := range []string{a.peersFile, a.peersFile + backupSuffix} {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			continue
+		}
+		found = true
+
+		damaged, err := a.deserializePeers(path)
 		if err != nil {
-			log.Warnf("Failed to remove corrupt peers file %s: %v",
-				a.peersFile, err)
+			log.Warnf("Failed to load peers file %s: %v", path, err)
+			a.reset()
+			a.removeDamagedPeersFile(path)
+			continue
+		}
+		if len(damaged) != 0 {
+			log.Warnf("Loaded peers file %s without its damaged "+
+				"%s sections", path, strings.Join(damaged, " and "))
+			a.removeDamagedPeersFile(path)
 		}
-		a.reset()
+		log.Infof("Loaded %d addresses from file '%s'",
+			a.numAddresses(), path)
 		return
 	}
-	log.Infof("Loaded %d addresses from file '%s'", a.numAddresses(), a.peersFile)
+	if found {
+		log.Warnf("Starting with an empty address book")
+	}
 }
 
-func (a *AddrManager) deserializePeers(filePath string) error {
-
-	_, err := os.Stat(filePath)
-	if os.IsNotExist(err) {
-		return nil
+// removeDamagedPeersFile removes the passed peers file when it is the current
+// one rather than its backup.
+func (a *AddrManager) removeDamagedPeersFile(path string) {
+	if path != a.peersFile {
+		return
+	}
+	if err := os.Remove(path); err != nil {
+		log.Warnf("Failed to remove damaged peers file %s: %v", path,
+			err)
 	}
-	r, err := os.Open(filePath)
+}
+
+// deserializePeers loads the state from the peers file at the passed path and
+// returns the names of the sections which were damaged and left out.  Older
+// versions of the file are migrated forward.  An error is returned when
+// nothing could be loaded, in which case the state must be reset.
+func (a *AddrManager) deserializePeers(filePath string) ([]string, error) {
+	data, err := ioutil.ReadFile(filePath)
 	if err != nil {
-		return fmt.Errorf("%s error opening file: %v", filePath, err)
+		return nil, fmt.Errorf("%s error opening file: %v", filePath, err)
 	}
-	defer r.Close()
 
-	var sam serializedAddrManager
-	dec := json.NewDecoder(r)
-	err = dec.Decode(&sam)
+	// Every version starts with a JSON object holding the version on the
+	// first line.
+	lines := bytes.Split(data, []byte{'\n'})
+	var version struct{ Version int }
+	if err := json.Unmarshal(lines[0], &version); err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", filePath, err)
+	}
+	switch version.Version {
+	case 1:
+		log.Infof("Migrating peers file %s from version 1", filePath)
+		return nil, a.deserializePeersV1(lines[0])
+
+	case serialisationVersion:
+		return a.deserializeSections(lines)
+	}
+	return nil, fmt.Errorf("unknown version %v in serialized "+
+		"addrmanager", version.Version)
+}
+
+// deserializeSections loads the state from the lines of a version 2 peers
+// file.  The sections whose checksum does not match are treated as missing.
+func (a *AddrManager) deserializeSections(lines [][]byte) ([]string, error) {
+	var header serializedHeader
+	if err := json.Unmarshal(lines[0], &header); err != nil {
+		return nil, fmt.Errorf("malformed header: %v", err)
+	}
+
+	sections := make(map[string]json.RawMessage)
+	for _, line := range lines[1:] {
+		var section serializedSection
+		if err := json.Unmarshal(line, &section); err != nil {
+			continue
+		}
+		checksum := sha256.Sum256(section.Data)
+		if section.Checksum != hex.EncodeToString(checksum[:]) {
+			log.Debugf("Checksum mismatch for section %s",
+				section.Name)
+			continue
+		}
+		sections[section.Name] = section.Data
+	}
+
+	var addrs []*serializedKnownAddress
+	data, ok := sections[sectionAddresses]
+	if !ok {
+		return nil, fmt.Errorf("%s section is damaged", sectionAddresses)
+	}
+	if err := json.Unmarshal(data, &addrs); err != nil {
+		return nil, fmt.Errorf("malformed %s section: %v",
+			sectionAddresses, err)
+	}
+	a.key = header.Key
+	if err := a.deserializeAddresses(addrs); err != nil {
+		return nil, err
+	}
+
+	// Load the buckets and place the addresses of a damaged section into
+	// new buckets again.
+	var damaged []string
+	var newBuckets, triedBuckets [][]string
+	err := a.decodeBuckets(sections, sectionNewBuckets, newBucketCount,
+		&newBuckets)
+	if err == nil {
+		a.deserializeNewBuckets(newBuckets)
+	} else {
+		log.Debugf("Discarding %s section: %v", sectionNewBuckets, err)
+		damaged = append(damaged, sectionNewBuckets)
+	}
+	err = a.decodeBuckets(sections, sectionTriedBuckets, triedBucketCount,
+		&triedBuckets)
+	if err == nil {
+		err = a.deserializeTriedBuckets(triedBuckets)
+	}
 	if err != nil {
-		return fmt.Errorf("error reading %s: %v", filePath, err)
+		log.Debugf("Discarding %s section: %v", sectionTriedBuckets, err)
+		damaged = append(damaged, sectionTriedBuckets)
 	}
+	if len(damaged) != 0 {
+		a.rebucketUnplaced()
+	}
+	return damaged, nil
+}
 
-	if sam.Version != serialisationVersion {
-		return fmt.Errorf("unknown version %v in serialized "+
-			"addrmanager", sam.Version)
+// decodeBuckets decodes the buckets held by the named section into buckets
+// and ensures there are no more of them than count and they only contain
+// known addresses.
+func (a *AddrManager) decodeBuckets(sections map[string]json.RawMessage, name string, count int, buckets *[][]string) error {
+	data, ok := sections[name]
+	if !ok {
+		return fmt.Errorf("section is missing or its checksum does " +
+			"not match")
 	}
-	copy(a.key[:], sam.Key[:])
+	if err := json.Unmarshal(data, buckets); err != nil {
+		return err
+	}
+	if len(*buckets) > count {
+		return fmt.Errorf("%d buckets, want at most %d", len(*buckets),
+			count)
+	}
+	for _, bucket := range *buckets {
+		for _, key := range bucket {
+			if _, ok := a.addrIndex[key]; !ok {
+				return fmt.Errorf("bucket contains %s but none "+
+					"in address list", key)
+			}
+		}
+	}
+	return nil
+}
 
-	for _, v := range sam.Addresses {
+// deserializeAddresses adds the passed addresses to the address index.
+func (a *AddrManager) deserializeAddresses(addrs []*serializedKnownAddress) error {
+	for _, v := range addrs {
 		ka := new(KnownAddress)
+		var err error
 		ka.na, err = a.DeserializeNetAddress(v.Addr)
 		if err != nil {
 			return fmt.Errorf("failed to deserialize netaddress "+
@@ -474,6 +691,80 @@ func (a *AddrManager) deserializePeers(filePath string) error {
 		ka.lastsuccess = time.Unix(v.LastSuccess, 0)
 		a.addrIndex[NetAddressKey(ka.na)] = ka
 	}
+	return nil
+}
+
+// deserializeNewBuckets places the addresses in the passed new buckets.  The
+// addresses must be known.
+func (a *AddrManager) deserializeNewBuckets(buckets [][]string) {
+	for i := range buckets {
+		for _, val := range buckets[i] {
+			ka := a.addrIndex[val]
+			if ka.refs == 0 {
+				a.nNew++
+			}
+			ka.refs++
+			a.addrNew[i][val] = ka
+		}
+	}
+}
+
+// deserializeTriedBuckets places the addresses in the passed tried buckets.
+// The addresses must be known.  Nothing is placed when an address is already
+// in a new or tried bucket.
+func (a *AddrManager) deserializeTriedBuckets(buckets [][]string) error {
+	seen := make(map[string]struct{})
+	for i := range buckets {
+		for _, val := range buckets[i] {
+			_, dup := seen[val]
+			if dup || a.addrIndex[val].refs > 0 {
+				return fmt.Errorf("address %s after "+
+					"serialisation which is both new and "+
+					"tried", val)
+			}
+			seen[val] = struct{}{}
+		}
+	}
+	for i := range buckets {
+		for _, val := range buckets[i] {
+			ka := a.addrIndex[val]
+			ka.tried = true
+			a.nTried++
+			a.addrTried[i].PushBack(ka)
+		}
+	}
+	return nil
+}
+
+// rebucketUnplaced places the known addresses which are in neither a new nor a
+// tried bucket into the new bucket they belong to, dropping the ones which do
+// not fit.
+func (a *AddrManager) rebucketUnplaced() {
+	for k, ka := range a.addrIndex {
+		if ka.refs > 0 || ka.tried {
+			continue
+		}
+		bucket := a.getNewBucket(ka.na, ka.srcAddr)
+		if len(a.addrNew[bucket]) >= newBucketSize {
+			delete(a.addrIndex, k)
+			continue
+		}
+		ka.refs = 1
+		a.nNew++
+		a.addrNew[bucket][k] = ka
+	}
+}
+
+// deserializePeersV1 loads the state from a version 1 peers file.
+func (a *AddrManager) deserializePeersV1(data []byte) error {
+	var sam serializedAddrManagerV1
+	if err := json.Unmarshal(data, &sam); err != nil {
+		return err
+	}
+	copy(a.key[:], sam.Key[:])
+	if err := a.deserializeAddresses(sam.Addresses); err != nil {
+		return err
+	}
 
 	for i := range sam.NewBuckets {
 		for _, val := range sam.NewBuckets[i] {
@@ -671,6 +962,8 @@ func (a *AddrManager) AddressCache() []*wire.NetAddress {
 func (a *AddrManager) reset() {
 
 	a.addrIndex = make(map[string]*KnownAddress)
+	a.nNew = 0
+	a.nTried = 0
 
 	// fill key with bytes from a good random source.
 	io.ReadFull(crand.Reader, a.key[:])
@@ -682,10 +975,73 @@ func (a *AddrManager) reset() {
 	}
 }
 
+const (
+	// torV3Version is the version byte of Tor v3 onion addresses.
+	torV3Version = 0x03
+
+	// torV3HostLen is the length of a Tor v3 onion address, which is the
+	// base32 encoding of the public key, a checksum and the version.
+	torV3HostLen = 56 + len(".onion")
+
+	// i2pSuffix is the suffix of I2P addresses, which are the unpadded
+	// base32 encoding of the hash of the destination.
+	i2pSuffix = ".b32.i2p"
+
+	// i2pHostLen is the length of an I2P address.
+	i2pHostLen = 52 + len(i2pSuffix)
+)
+
+// unpaddedBase32 is the base32 encoding without padding used by Tor v3 onion
+// addresses and I2P addresses.
+var unpaddedBase32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// torV3Checksum returns the checksum of the Tor v3 onion address with the
+// passed public key.
+func torV3Checksum(pubKey []byte) []byte {
+	h := sha3.New256()
+	h.Write([]byte(".onion checksum"))
+	h.Write(pubKey)
+	h.Write([]byte{torV3Version})
+	return h.Sum(nil)[:2]
+}
+
+// decodeTorV3 returns the public key of the passed Tor v3 onion address
+// without the ".onion" suffix.
+func decodeTorV3(host string) ([]byte, error) {
+	data, err := unpaddedBase32.DecodeString(strings.ToUpper(host))
+	if err != nil {
+		return nil, err
+	}
+	pubKey, checksum, version := data[:32], data[32:34], data[34]
+	if version != torV3Version {
+		return nil, fmt.Errorf("unsupported onion address version %d",
+			version)
+	}
+	if string(checksum) != string(torV3Checksum(pubKey)) {
+		return nil, fmt.Errorf("invalid onion address checksum")
+	}
+	return pubKey, nil
+}
+
 // HostToNetAddress returns a netaddress given a host address. If the address is
-// a tor .onion address this will be taken care of. else if the host is not an
-// IP address it will be resolved (via tor if required).
+// a tor .onion or I2P .b32.i2p address this will be taken care of. else if the
+// host is not an IP address it will be resolved (via tor if required).
 func (a *AddrManager) HostToNetAddress(host string, port uint16, services wire.ServiceFlag) (*wire.NetAddress, error) {
+	if len(host) == torV3HostLen && strings.HasSuffix(host, ".onion") {
+		pubKey, err := decodeTorV3(host[:56])
+		if err != nil {
+			return nil, err
+		}
+		return wire.NewNetAddressV2(wire.NetIDTorV3, pubKey, port, services)
+	}
+	if len(host) == i2pHostLen && strings.HasSuffix(host, i2pSuffix) {
+		data, err := unpaddedBase32.DecodeString(strings.ToUpper(host[:52]))
+		if err != nil {
+			return nil, err
+		}
+		return wire.NewNetAddressV2(wire.NetIDI2P, data, port, services)
+	}
+
 	// tor address is 16 char base32 + ".onion"
 	var ip net.IP
 	if len(host) == 22 && host[16:] == ".onion" {
@@ -715,8 +1071,21 @@ func (a *AddrManager) HostToNetAddress(host string, port uint16, services wire.S
 
 // ipString returns a string for the ip from the provided NetAddress. If the
 // ip is in the range used for tor addresses then it will be transformed into
-// the relevant .onion address.
+// the relevant .onion address.  Tor v3 and I2P addresses are transformed into
+// their .onion and .b32.i2p addresses.
 func ipString(na *wire.NetAddress) string {
+	if IsTorV3(na) {
+		data := make([]byte, 0, 35)
+		data = append(data, na.Addr...)
+		data = append(data, torV3Checksum(na.Addr)...)
+		data = append(data, torV3Version)
+		return strings.ToLower(unpaddedBase32.EncodeToString(data)) + ".onion"
+	}
+	if IsI2P(na) {
+		return strings.ToLower(unpaddedBase32.EncodeToString(na.Addr)) +
+			i2pSuffix
+	}
+
 	if IsOnionCatTor(na) {
 		// We know now that na.IP is long enogh.
 		base32 := base32.StdEncoding.EncodeToString(na.IP[6:])
@@ -805,6 +1174,88 @@ func (a *AddrManager) GetAddress() *KnownAddress {
 	}
 }
 
+// AddressCandidates is a snapshot of the known addresses outside of a set of
+// network groups, which is taken once by CandidatesExcluding so repeatedly
+// picking an address from it does not scan all of the known addresses again.
+// Addresses which are removed from the address manager afterwards may still be
+// picked.
+type AddressCandidates struct {
+	a      *AddrManager
+	groups int
+	tried  []*KnownAddress
+	fresh  []*KnownAddress
+}
+
+// CandidatesExcluding returns the known addresses which are not in any of the
+// passed network groups, as returned by GroupKey.  This is used to diversify
+// the outbound connections across network groups.
+func (a *AddrManager) CandidatesExcluding(groups map[string]struct{}) *AddressCandidates {
+	// Protect concurrent access.
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	c := &AddressCandidates{a: a, groups: len(groups)}
+	for _, ka := range a.addrIndex {
+		if _, ok := groups[GroupKey(ka.na)]; ok {
+			continue
+		}
+		if ka.tried {
+			c.tried = append(c.tried, ka)
+		} else {
+			c.fresh = append(c.fresh, ka)
+		}
+	}
+	return c
+}
+
+// GetAddress returns a single candidate address with the same preference for
+// tried addresses and for addresses with a higher chance as the GetAddress
+// method of the address manager.  It returns nil when there are no candidates
+// so the caller can relax the constraint the candidates were selected by.
+func (c *AddressCandidates) GetAddress() *KnownAddress {
+	if len(c.tried) == 0 && len(c.fresh) == 0 {
+		return nil
+	}
+
+	// Protect concurrent access to the random source and the attempts of
+	// the addresses.
+	a := c.a
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	// Use a 50% chance for choosing between tried and new entries just
+	// like GetAddress.
+	candidates := c.fresh
+	if len(c.tried) > 0 && (len(c.fresh) == 0 || a.rand.Intn(2) == 0) {
+		candidates = c.tried
+	}
+	large := 1 << 30
+	factor := 1.0
+	for {
+		ka := candidates[a.rand.Intn(len(candidates))]
+		randval := a.rand.Intn(large)
+		if float64(randval) < (factor * ka.chance() * float64(large)) {
+			log.Tracef("Selected %v outside of %d excluded groups",
+				NetAddressKey(ka.na), c.groups)
+			return ka
+		}
+		factor *= 1.2
+	}
+}
+
+// GetAddressExcluding returns a single address like GetAddress, except that
+// addresses in any of the passed network groups, as returned by GroupKey, are
+// never picked.  It returns nil when every known address is in one of the
+// groups.  Passing no groups is equivalent to calling GetAddress.  Callers
+// which pick several addresses should use CandidatesExcluding instead, which
+// only selects the candidates once.
+func (a *AddrManager) GetAddressExcluding(groups map[string]struct{}) *KnownAddress {
+	if len(groups) == 0 {
+		return a.GetAddress()
+	}
+	return a.CandidatesExcluding(groups).GetAddress()
+}
+
 func (a *AddrManager) find(addr *wire.NetAddress) *KnownAddress {
 	return a.addrIndex[NetAddressKey(addr)]
 }
@@ -963,6 +1414,14 @@ func (a *AddrManager) AddLocalAddress(na *wire.NetAddress, priority AddressPrior
 	return nil
 }
 
+// RemoveLocalAddress removes na from the list of known local addresses to
+// advertise, such as when a mapped external address is no longer valid.
+func (a *AddrManager) RemoveLocalAddress(na *wire.NetAddress) {
+	a.lamtx.Lock()
+	delete(a.localAddresses, NetAddressKey(na))
+	a.lamtx.Unlock()
+}
+
 // getReachabilityFrom returns the relative reachability of the provided local
 // address to the provided remote address.
 func getReachabilityFrom(localAddr, remoteAddr *wire.NetAddress) int {
@@ -980,8 +1439,16 @@ func getReachabilityFrom(localAddr, remoteAddr *wire.NetAddress) int {
 		return Unreachable
 	}
 
-	if IsOnionCatTor(remoteAddr) {
-		if IsOnionCatTor(localAddr) {
+	// I2P addresses are only reachable from within I2P.
+	if IsI2P(remoteAddr) {
+		if IsI2P(localAddr) {
+			return Private
+		}
+		return Unreachable
+	}
+
+	if IsOnion(remoteAddr) {
+		if IsOnion(localAddr) {
 			return Private
 		}
 
@@ -1061,15 +1528,16 @@ func (a *AddrManager) GetBestLocalAddress(remoteAddr *wire.NetAddress) *wire.Net
 		}
 	}
 	if bestAddress != nil {
-		log.Debugf("Suggesting address %s:%d for %s:%d", bestAddress.IP,
-			bestAddress.Port, remoteAddr.IP, remoteAddr.Port)
+		log.Debugf("Suggesting address %s for %s",
+			NetAddressKey(bestAddress), NetAddressKey(remoteAddr))
 	} else {
-		log.Debugf("No worthy address for %s:%d", remoteAddr.IP,
-			remoteAddr.Port)
+		log.Debugf("No worthy address for %s", NetAddressKey(remoteAddr))
 
 		// Send something unroutable if nothing suitable.
 		var ip net.IP
-		if !IsIPv4(remoteAddr) && !IsOnionCatTor(remoteAddr) {
+		if remoteAddr.IsLegacy() && !IsIPv4(remoteAddr) &&
+			!IsOnionCatTor(remoteAddr) {
+
 			ip = net.IPv6zero
 		} else {
 			ip = net.IPv4zero
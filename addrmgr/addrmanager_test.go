@@ -6,10 +6,15 @@
 package addrmgr_test
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"net"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -209,6 +214,27 @@ func TestAddLocalAddress(t *testing.T) {
 	}
 }
 
+func TestRemoveLocalAddress(t *testing.T) {
+	amgr := addrmgr.New("testremovelocaladdress", nil)
+	remote := wire.NetAddress{IP: net.ParseIP("204.124.8.100")}
+	local := wire.NetAddress{IP: net.ParseIP("204.124.1.1"), Port: 8333}
+	if err := amgr.AddLocalAddress(&local, addrmgr.UpnpPrio); err != nil {
+		t.Fatalf("AddLocalAddress: unexpected error %v", err)
+	}
+	if got := amgr.GetBestLocalAddress(&remote); !got.IP.Equal(local.IP) {
+		t.Fatalf("GetBestLocalAddress: got %v, want %v", got.IP,
+			local.IP)
+	}
+
+	amgr.RemoveLocalAddress(&local)
+	if got := amgr.GetBestLocalAddress(&remote); got.IP.Equal(local.IP) {
+		t.Fatalf("GetBestLocalAddress: got removed address %v", got.IP)
+	}
+
+	// Removing an unknown address is a no-op.
+	amgr.RemoveLocalAddress(&local)
+}
+
 func TestAttempt(t *testing.T) {
 	n := addrmgr.New("testattempt", lookupFunc)
 
@@ -352,6 +378,109 @@ func TestGetAddress(t *testing.T) {
 	}
 }
 
+func TestGetAddressExcluding(t *testing.T) {
+	n := addrmgr.New("testgetaddressexcluding", lookupFunc)
+	if rv := n.GetAddressExcluding(map[string]struct{}{"54.1.0.0": {}}); rv != nil {
+		t.Errorf("GetAddressExcluding failed: got: %v want: %v\n", rv, nil)
+	}
+
+	// Seed the address manager with a large cluster of addresses from a
+	// single /16 along with a few addresses from other IPv4 and IPv6
+	// network groups.
+	src := wire.NewNetAddressIPPort(net.ParseIP("173.144.173.111"), 8333, 0)
+	var addrs []*wire.NetAddress
+	for i := 0; i < 200; i++ {
+		ip := net.IPv4(54, 1, byte(i/16), byte(i%16+1))
+		addrs = append(addrs, wire.NewNetAddressIPPort(ip, 8333, 0))
+	}
+	for _, ip := range []string{"60.1.1.1", "61.1.1.1", "62.1.1.1",
+		"62.1.2.2", "2600:1000::1", "2600:1001::1", "2600:1001::2"} {
+
+		addrs = append(addrs, wire.NewNetAddressIPPort(net.ParseIP(ip),
+			8333, 0))
+	}
+	n.AddAddresses(addrs, src)
+
+	// Move some addresses to the tried table so both tables are used.
+	n.Good(addrs[0])
+	n.Good(addrs[200])
+
+	wantGroups := map[string]struct{}{
+		"54.1.0.0": {}, "60.1.0.0": {}, "61.1.0.0": {}, "62.1.0.0": {},
+		"2600:1000::": {}, "2600:1001::": {},
+	}
+	for run := 0; run < 20; run++ {
+		// Ensure every pick comes from a group which was not picked
+		// before until the groups are exhausted.
+		excluded := make(map[string]struct{})
+		for i := 0; i < len(wantGroups); i++ {
+			ka := n.GetAddressExcluding(excluded)
+			if ka == nil {
+				t.Fatalf("run %d: no address after %d groups", run,
+					len(excluded))
+			}
+			group := addrmgr.GroupKey(ka.NetAddress())
+			if _, ok := excluded[group]; ok {
+				t.Fatalf("run %d: got %v from excluded group %s",
+					run, ka.NetAddress().IP, group)
+			}
+			excluded[group] = struct{}{}
+		}
+		if !reflect.DeepEqual(excluded, wantGroups) {
+			t.Fatalf("run %d: got groups %v, want %v", run, excluded,
+				wantGroups)
+		}
+		if rv := n.GetAddressExcluding(excluded); rv != nil {
+			t.Fatalf("run %d: got %v with all groups excluded", run,
+				rv.NetAddress().IP)
+		}
+	}
+
+	// No excluded groups behave like GetAddress.
+	if rv := n.GetAddressExcluding(nil); rv == nil {
+		t.Fatalf("GetAddressExcluding(nil): got nil")
+	}
+}
+
+func TestCandidatesExcluding(t *testing.T) {
+	n := addrmgr.New("testcandidatesexcluding", lookupFunc)
+	excluded := map[string]struct{}{"54.1.0.0": {}}
+	if rv := n.CandidatesExcluding(excluded).GetAddress(); rv != nil {
+		t.Errorf("GetAddress on empty candidates: got %v want nil", rv)
+	}
+
+	src := wire.NewNetAddressIPPort(net.ParseIP("173.144.173.111"), 8333, 0)
+	var addrs []*wire.NetAddress
+	for _, ip := range []string{"54.1.1.1", "54.1.2.2", "60.1.1.1",
+		"61.1.1.1"} {
+
+		addrs = append(addrs, wire.NewNetAddressIPPort(net.ParseIP(ip),
+			8333, 0))
+	}
+	n.AddAddresses(addrs, src)
+	n.Good(addrs[2])
+
+	// Every pick from the candidates is outside of the excluded group, and
+	// addresses added after the candidates were selected are not picked.
+	candidates := n.CandidatesExcluding(excluded)
+	late := wire.NewNetAddressIPPort(net.ParseIP("62.1.1.1"), 8333, 0)
+	n.AddAddress(late, src)
+	for i := 0; i < 100; i++ {
+		ka := candidates.GetAddress()
+		if ka == nil {
+			t.Fatalf("pick %d: got nil", i)
+		}
+		ip := ka.NetAddress().IP
+		if addrmgr.GroupKey(ka.NetAddress()) == "54.1.0.0" {
+			t.Fatalf("pick %d: got %v from excluded group", i, ip)
+		}
+		if ip.Equal(late.IP) {
+			t.Fatalf("pick %d: got address added after the "+
+				"candidates were selected", i)
+		}
+	}
+}
+
 func TestGetBestLocalAddress(t *testing.T) {
 	localAddrs := []wire.NetAddress{
 		{IP: net.ParseIP("192.168.0.100")},
@@ -471,3 +600,305 @@ func TestNetAddressKey(t *testing.T) {
 	}
 
 }
+
+// TestAddrV2Addresses ensures Tor v3 and I2P addresses, which can only be
+// relayed with addrv2 messages, round trip through the string keys the address
+// manager serializes addresses with.
+func TestAddrV2Addresses(t *testing.T) {
+	tests := []struct {
+		name     string
+		host     string
+		netID    wire.NetworkID
+		groupKey string
+	}{
+		{
+			name:     "tor v3",
+			host:     "pg6mmjiyjmcrsslvykfwnntlaru7p5svn6y2ymmju6nubxndf4pscryd.onion",
+			netID:    wire.NetIDTorV3,
+			groupKey: "torv3:7",
+		},
+		{
+			name:     "i2p",
+			host:     "ukeu3k5oycgaauneqgtnvselmt4yemvoilkln7jpvamvfx7dnkdq.b32.i2p",
+			netID:    wire.NetIDI2P,
+			groupKey: "i2p:10",
+		},
+		{
+			name:     "tor v2",
+			host:     "aaaaaaaaaaaaaqai.onion",
+			netID:    wire.NetIDTorV2,
+			groupKey: "tor:0",
+		},
+	}
+
+	for _, test := range tests {
+		n := addrmgr.New("testaddrv2", lookupFunc)
+		na, err := n.HostToNetAddress(test.host, 8333, wire.SFNodeNetwork)
+		if err != nil {
+			t.Errorf("%s: HostToNetAddress: unexpected error %v",
+				test.name, err)
+			continue
+		}
+		if got := na.NetworkID(); got != test.netID {
+			t.Errorf("%s: wrong network id - got %v, want %v",
+				test.name, got, test.netID)
+		}
+		if !addrmgr.IsRoutable(na) {
+			t.Errorf("%s: address is not routable", test.name)
+		}
+		if key := addrmgr.GroupKey(na); key != test.groupKey {
+			t.Errorf("%s: unexpected group key - got '%s', want '%s'",
+				test.name, key, test.groupKey)
+		}
+
+		key := addrmgr.NetAddressKey(na)
+		if want := test.host + ":8333"; key != want {
+			t.Errorf("%s: NetAddressKey - got %s, want %s", test.name,
+				key, want)
+		}
+		decoded, err := n.DeserializeNetAddress(key)
+		if err != nil {
+			t.Errorf("%s: DeserializeNetAddress: unexpected error %v",
+				test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(decoded.IP, na.IP) ||
+			decoded.NetID != na.NetID ||
+			!reflect.DeepEqual(decoded.Addr, na.Addr) ||
+			decoded.Port != na.Port {
+
+			t.Errorf("%s: DeserializeNetAddress - got %v, want %v",
+				test.name, decoded, na)
+		}
+
+		// The address manager must accept the address.
+		n.AddAddress(na, na)
+		if ka := n.GetAddress(); ka == nil ||
+			addrmgr.NetAddressKey(ka.NetAddress()) != key {
+
+			t.Errorf("%s: address not added to address manager",
+				test.name)
+		}
+	}
+
+	// Tor v3 addresses with an invalid checksum are rejected.
+	n := addrmgr.New("testaddrv2", lookupFunc)
+	_, err := n.HostToNetAddress("pg6mmjiyjmcrsslvykfwnntlaru7p5svn6y2ymmju"+
+		"6nubxndf4pscrya.onion", 8333, wire.SFNodeNetwork)
+	if err == nil {
+		t.Errorf("HostToNetAddress: invalid onion checksum accepted")
+	}
+}
+
+// peersV1Fixture is a peers file written by the version 1 format with one new
+// and one tried address.
+const peersV1Fixture = `{"Version":1,"Addresses":[` +
+	`{"Addr":"173.194.115.66:8333","Src":"173.144.173.111:8333",` +
+	`"Attempts":1,"TimeStamp":1500000000,"LastAttempt":1500000000,` +
+	`"LastSuccess":0},` +
+	`{"Addr":"204.124.1.1:8333","Src":"173.144.173.111:8333",` +
+	`"Attempts":0,"TimeStamp":1500000000,"LastAttempt":1500000000,` +
+	`"LastSuccess":1500000000}],` +
+	`"NewBuckets":[["173.194.115.66:8333"]],` +
+	`"TriedBuckets":[[],["204.124.1.1:8333"]]}` + "\n"
+
+// savePeersFixture saves the state of an address manager with 20 addresses,
+// 3 of which are tried, to the peers file in the passed directory and returns
+// the contents of the file.
+func savePeersFixture(t *testing.T, dir string) []byte {
+	n := addrmgr.New(dir, nil)
+	n.Start()
+	src := wire.NewNetAddressIPPort(net.ParseIP("173.144.173.111"), 8333, 0)
+	var addrs []*wire.NetAddress
+	for i := 0; i < 20; i++ {
+		ip := net.IPv4(54, byte(i), 1, 1)
+		addrs = append(addrs, wire.NewNetAddressIPPort(ip, 8333, 0))
+	}
+	n.AddAddresses(addrs, src)
+	for _, na := range addrs[:3] {
+		n.Good(na)
+	}
+	if err := n.Stop(); err != nil {
+		t.Fatalf("Stop: unexpected error %v", err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "peers.json"))
+	if err != nil {
+		t.Fatalf("ReadFile: unexpected error %v", err)
+	}
+	return data
+}
+
+// TestPeersFileRecovery ensures the address manager state is written with
+// a version and checksums, and that damaged, truncated and old peers files
+// are recovered, migrated or replaced by their backup without failing.
+func TestPeersFileRecovery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "peersfile")
+	if err != nil {
+		t.Fatalf("TempDir: unexpected error %v", err)
+	}
+	defer os.RemoveAll(dir)
+	good := savePeersFixture(t, dir)
+	lines := bytes.Split(good, []byte("\n"))
+	if len(lines) != 5 || !bytes.HasPrefix(lines[0],
+		[]byte(`{"Version":2,`)) {
+
+		t.Fatalf("unexpected peers file format:\n%s", good)
+	}
+
+	// damage returns the good file with the checksum of the passed line
+	// changed.
+	damage := func(line int) []byte {
+		damaged := make([][]byte, len(lines))
+		copy(damaged, lines)
+		damaged[line] = bytes.Replace(lines[line],
+			[]byte(`"Checksum":"`), []byte(`"Checksum":"00`), 1)
+		return bytes.Join(damaged, []byte("\n"))
+	}
+	triedStart := bytes.Index(good, lines[3])
+
+	tests := []struct {
+		name   string
+		file   []byte
+		backup []byte
+		nNew   int
+		nTried int
+		kept   bool
+	}{
+		{
+			name:   "intact",
+			file:   good,
+			nNew:   17,
+			nTried: 3,
+			kept:   true,
+		},
+		{
+			name:   "truncated tried buckets",
+			file:   good[:triedStart+40],
+			nNew:   20,
+			nTried: 0,
+		},
+		{
+			name:   "truncated after addresses",
+			file:   good[:triedStart-20],
+			nNew:   20,
+			nTried: 0,
+		},
+		{
+			name:   "new buckets checksum mismatch",
+			file:   damage(2),
+			nNew:   17,
+			nTried: 3,
+		},
+		{
+			name:   "tried buckets checksum mismatch",
+			file:   damage(3),
+			nNew:   20,
+			nTried: 0,
+		},
+		{
+			name: "addresses checksum mismatch",
+			file: damage(1),
+		},
+		{
+			name:   "addresses checksum mismatch with backup",
+			file:   damage(1),
+			backup: good,
+			nNew:   17,
+			nTried: 3,
+		},
+		{
+			name:   "truncated header with backup",
+			file:   good[:10],
+			backup: good,
+			nNew:   17,
+			nTried: 3,
+		},
+		{
+			name:   "missing with backup",
+			backup: good,
+			nNew:   17,
+			nTried: 3,
+		},
+		{
+			name: "empty",
+			file: []byte{},
+		},
+		{
+			name: "unknown version",
+			file: []byte(`{"Version":3}` + "\n"),
+		},
+		{
+			name:   "version 1",
+			file:   []byte(peersV1Fixture),
+			nNew:   1,
+			nTried: 1,
+			kept:   true,
+		},
+	}
+
+	for _, test := range tests {
+		testDir := filepath.Join(dir, strings.Replace(test.name, " ",
+			"_", -1))
+		if err := os.Mkdir(testDir, 0700); err != nil {
+			t.Fatalf("Mkdir: unexpected error %v", err)
+		}
+		peersFile := filepath.Join(testDir, "peers.json")
+		if test.file != nil {
+			err := ioutil.WriteFile(peersFile, test.file, 0600)
+			if err != nil {
+				t.Fatalf("WriteFile: unexpected error %v", err)
+			}
+		}
+		if test.backup != nil {
+			err := ioutil.WriteFile(peersFile+".bak", test.backup,
+				0600)
+			if err != nil {
+				t.Fatalf("WriteFile: unexpected error %v", err)
+			}
+		}
+
+		n := addrmgr.New(testDir, nil)
+		n.Start()
+		nNew, nTried := addrmgr.TstAddrManagerCounts(n)
+		if nNew != test.nNew || nTried != test.nTried {
+			t.Errorf("%s: got %d new and %d tried addresses, want "+
+				"%d and %d", test.name, nNew, nTried, test.nNew,
+				test.nTried)
+		}
+		if got := n.NumAddresses(); got != test.nNew+test.nTried {
+			t.Errorf("%s: got %d addresses, want %d", test.name, got,
+				test.nNew+test.nTried)
+		}
+
+		// Ensure the address manager remains functional.
+		if err := n.AddAddressByIP(someIP + ":8333"); err != nil {
+			t.Errorf("%s: AddAddressByIP: unexpected error %v",
+				test.name, err)
+		}
+		if err := n.Stop(); err != nil {
+			t.Fatalf("%s: Stop: unexpected error %v", test.name, err)
+		}
+
+		// The state is saved in the current version and the replaced
+		// file is only kept as the backup when it was loaded
+		// completely, so a damaged file never replaces a backup.
+		data, err := ioutil.ReadFile(peersFile)
+		if err != nil {
+			t.Fatalf("%s: ReadFile: unexpected error %v", test.name,
+				err)
+		}
+		if !bytes.HasPrefix(data, []byte(`{"Version":2,`)) {
+			t.Errorf("%s: peers file not saved in version 2",
+				test.name)
+		}
+		backup, _ := ioutil.ReadFile(peersFile + ".bak")
+		wantBackup := test.backup
+		if test.kept {
+			wantBackup = test.file
+		}
+		if !bytes.Equal(backup, wantBackup) {
+			t.Errorf("%s: got backup %q, want %q", test.name, backup,
+				wantBackup)
+		}
+	}
+}
@@ -24,3 +24,11 @@ func TstNewKnownAddress(na *wire.NetAddress, attempts int,
 	return &KnownAddress{na: na, attempts: attempts, lastattempt: lastattempt,
 		lastsuccess: lastsuccess, tried: tried, refs: refs}
 }
+
+// TstAddrManagerCounts returns the number of addresses in the new and tried
+// buckets of the address manager.
+func TstAddrManagerCounts(a *AddrManager) (nNew, nTried int) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	return a.nNew, a.nTried
+}
@@ -118,6 +118,24 @@ func IsOnionCatTor(na *wire.NetAddress) bool {
 	return onionCatNet.Contains(na.IP)
 }
 
+// IsTorV3 returns whether or not the passed address is a Tor v3 onion
+// address, which can only be relayed with addrv2 messages.
+func IsTorV3(na *wire.NetAddress) bool {
+	return na.NetID == wire.NetIDTorV3 && len(na.Addr) == 32
+}
+
+// IsOnion returns whether or not the passed address is a Tor onion address,
+// either encoded in the OnionCat range or a Tor v3 address.
+func IsOnion(na *wire.NetAddress) bool {
+	return IsOnionCatTor(na) || IsTorV3(na)
+}
+
+// IsI2P returns whether or not the passed address is an I2P address, which can
+// only be relayed with addrv2 messages.
+func IsI2P(na *wire.NetAddress) bool {
+	return na.NetID == wire.NetIDI2P && len(na.Addr) == 32
+}
+
 // IsRFC1918 returns whether or not the passed address is part of the IPv4
 // private network address space as defined by RFC1918 (10.0.0.0/8,
 // 172.16.0.0/12, or 192.168.0.0/16).
@@ -213,7 +231,12 @@ func IsRFC6598(na *wire.NetAddress) bool {
 // considered invalid under the following circumstances:
 // IPv4: It is either a zero or all bits set address.
 // IPv6: It is either a zero or RFC3849 documentation address.
+// Other networks: It is not a Tor v3 or I2P address.
 func IsValid(na *wire.NetAddress) bool {
+	if !na.IsLegacy() {
+		return IsTorV3(na) || IsI2P(na)
+	}
+
 	// IsUnspecified returns if address is 0, so only all bits set, and
 	// RFC3849 need to be explicitly checked.
 	return na.IP != nil && !(na.IP.IsUnspecified() ||
@@ -233,8 +256,9 @@ func IsRoutable(na *wire.NetAddress) bool {
 // GroupKey returns a string representing the network group an address is part
 // of.  This is the /16 for IPv4, the /32 (/36 for he.net) for IPv6, the string
 // "local" for a local address, the string "tor:key" where key is the /4 of the
-// onion address for tor address, and the string "unroutable" for an unroutable
-// address.
+// onion address for tor address, the strings "torv3:key" and "i2p:key" where
+// key is the /4 of the address for Tor v3 and I2P addresses, and the string
+// "unroutable" for an unroutable address.
 func GroupKey(na *wire.NetAddress) string {
 	if IsLocal(na) {
 		return "local"
@@ -242,6 +266,12 @@ func GroupKey(na *wire.NetAddress) string {
 	if !IsRoutable(na) {
 		return "unroutable"
 	}
+	if IsTorV3(na) {
+		return fmt.Sprintf("torv3:%d", na.Addr[0]>>4)
+	}
+	if IsI2P(na) {
+		return fmt.Sprintf("i2p:%d", na.Addr[0]>>4)
+	}
 	if IsIPv4(na) {
 		return na.IP.Mask(net.CIDRMask(16, 32)).String()
 	}
@@ -201,3 +201,37 @@ func TestGroupKey(t *testing.T) {
 		}
 	}
 }
+
+// TestIsOnion ensures both OnionCat encoded and Tor v3 addresses are detected
+// as onion addresses.
+func TestIsOnion(t *testing.T) {
+	torV3, err := wire.NewNetAddressV2(wire.NetIDTorV3, make([]byte, 32),
+		8333, wire.SFNodeNetwork)
+	if err != nil {
+		t.Fatalf("NewNetAddressV2: unexpected error: %v", err)
+	}
+	i2p, err := wire.NewNetAddressV2(wire.NetIDI2P, make([]byte, 32), 8333,
+		wire.SFNodeNetwork)
+	if err != nil {
+		t.Fatalf("NewNetAddressV2: unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		na   *wire.NetAddress
+		want bool
+	}{
+		{"onioncat", wire.NewNetAddressIPPort(net.ParseIP("fd87:d87e:eb43::1"),
+			8333, wire.SFNodeNetwork), true},
+		{"torv3", torV3, true},
+		{"i2p", i2p, false},
+		{"ipv4", wire.NewNetAddressIPPort(net.ParseIP("12.1.2.3"), 8333,
+			wire.SFNodeNetwork), false},
+	}
+	for _, test := range tests {
+		if got := addrmgr.IsOnion(test.na); got != test.want {
+			t.Errorf("IsOnion %s: got %v want %v", test.name, got,
+				test.want)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/bitgo/prova/addrmgr"
+)
+
+const (
+	// anchorsFilename is the name of the file in the data directory the
+	// anchors are persisted to on shutdown.
+	anchorsFilename = "anchors.json"
+
+	// anchorsVersion is the version of the serialized anchors.
+	anchorsVersion = 1
+
+	// maxAnchors is the maximum number of outbound peers which are
+	// persisted as anchors.
+	maxAnchors = 2
+)
+
+// serializedAnchors is the persisted form of the anchors.
+type serializedAnchors struct {
+	Version int      `json:"version"`
+	Addrs   []string `json:"addrs"`
+}
+
+// selectAnchors returns the addresses of up to maxAnchors outbound peers which
+// completed the version handshake and have been connected the longest.  The
+// anchors are selected from distinct network groups.  Persistent peers are not
+// selected since they are connected on startup anyways.
+func selectAnchors(state *peerState) []string {
+	peers := make([]*serverPeer, 0, len(state.outboundPeers))
+	for _, sp := range state.outboundPeers {
+		if sp.Connected() && sp.VerAckReceived() {
+			peers = append(peers, sp)
+		}
+	}
+	sort.Slice(peers, func(i, j int) bool {
+		return peers[i].TimeConnected().Before(peers[j].TimeConnected())
+	})
+
+	var anchors []string
+	groups := make(map[string]struct{})
+	for _, sp := range peers {
+		if len(anchors) == maxAnchors {
+			break
+		}
+		group := addrmgr.GroupKey(sp.NA())
+		if _, ok := groups[group]; ok {
+			continue
+		}
+		groups[group] = struct{}{}
+		anchors = append(anchors, addrmgr.NetAddressKey(sp.NA()))
+	}
+	return anchors
+}
+
+// saveAnchors persists the addresses of the long-lived outbound peers of the
+// passed state so they are connected first on the next startup.  Connecting to
+// peers which were known to be good before makes it harder for an attacker to
+// take over all outbound connections of a restarted node.  It is invoked from
+// the peerHandler goroutine on shutdown.
+func (s *server) saveAnchors(state *peerState) {
+	anchors := serializedAnchors{
+		Version: anchorsVersion,
+		Addrs:   selectAnchors(state),
+	}
+	if len(anchors.Addrs) == 0 {
+		return
+	}
+
+	anchorsFile := filepath.Join(cfg.DataDir, anchorsFilename)
+	f, err := os.Create(anchorsFile)
+	if err != nil {
+		srvrLog.Errorf("Error opening file %s: %v", anchorsFile, err)
+		return
+	}
+	err = json.NewEncoder(f).Encode(&anchors)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		srvrLog.Errorf("Failed to write file %s: %v", anchorsFile, err)
+		os.Remove(anchorsFile)
+		return
+	}
+	srvrLog.Debugf("Saved %d anchors to file '%s'", len(anchors.Addrs),
+		anchorsFile)
+}
+
+// loadAnchors returns the addresses of the anchors persisted to the passed file
+// on the last shutdown and removes the file, so the anchors are only used once
+// and stale anchors are not used after an unclean shutdown.
+func loadAnchors(anchorsFile string) ([]string, error) {
+	f, err := os.Open(anchorsFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(anchorsFile)
+	defer f.Close()
+
+	var anchors serializedAnchors
+	if err := json.NewDecoder(f).Decode(&anchors); err != nil {
+		return nil, err
+	}
+	if anchors.Version != anchorsVersion {
+		return nil, fmt.Errorf("unknown version %d", anchors.Version)
+	}
+	return anchors.Addrs, nil
+}
+
+// anchorAddrs returns the network addresses of the passed anchors which can
+// still be dialed.  Anchors which are banned or can not be dialed with the
+// configured proxies are skipped.
+func (s *server) anchorAddrs(anchors []string) []net.Addr {
+	var addrs []net.Addr
+	for _, anchor := range anchors {
+		host, portStr, err := net.SplitHostPort(anchor)
+		if err != nil {
+			continue
+		}
+		port, err := strconv.ParseUint(portStr, 10, 16)
+		if err != nil {
+			continue
+		}
+		na, err := s.addrManager.HostToNetAddress(host, uint16(port), 0)
+		if err != nil || !btcdCanDial(na) {
+			continue
+		}
+		if _, banned := s.banManager.IsBanned(na.IP); banned {
+			continue
+		}
+		addr, err := addrStringToNetAddr(anchor)
+		if err != nil {
+			continue
+		}
+		addrs = append(addrs, addr)
+	}
+	return addrs
+}
@@ -0,0 +1,170 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bitgo/prova/addrmgr"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/connmgr"
+	"github.com/bitgo/prova/peer"
+)
+
+// newAnchorTestPeer returns an outbound server peer of the passed server which
+// is connected to the passed address.  The version handshake is completed when
+// requested.
+func newAnchorTestPeer(t *testing.T, s *server, addr string, handshake bool) *serverPeer {
+	sp := newServerPeer(s, false)
+	p, err := peer.NewOutboundPeer(&peer.Config{
+		ChainParams: &chaincfg.RegressionNetParams,
+	}, addr)
+	if err != nil {
+		t.Fatalf("NewOutboundPeer: unexpected error: %v", err)
+	}
+	sp.Peer = p
+	if !handshake {
+		r, w := io.Pipe()
+		sp.AssociateConnection(&pipeConn{Reader: r, Writer: w,
+			laddr: "10.0.0.1:18444", raddr: addr})
+		return sp
+	}
+
+	// The peers are connected through a link which alters the nonce of
+	// their version messages, since they would otherwise detect a
+	// connection to themselves.
+	remote := peer.NewInboundPeer(&peer.Config{
+		ChainParams: &chaincfg.RegressionNetParams,
+	})
+	outConn, outLink := newPipeConns()
+	inLink, inConn := newPipeConns()
+	go forwardMessages(outLink, inLink)
+	go forwardMessages(inLink, outLink)
+	sp.AssociateConnection(outConn)
+	remote.AssociateConnection(inConn)
+	deadline := time.Now().Add(5 * time.Second)
+	for !sp.VerAckReceived() {
+		if time.Now().After(deadline) {
+			t.Fatalf("handshake with %s timed out", addr)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return sp
+}
+
+// TestAnchors ensures the long-lived outbound peers from distinct network groups
+// are persisted on shutdown, that they are dialed before any other outbound
+// connection once the node restarts, and that the anchors file is consumed.
+func TestAnchors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "anchors")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	origCfg := cfg
+	cfg = &config{DataDir: dir, MaxPeers: defaultMaxPeers}
+	defer func() { cfg = origCfg }()
+	anchorsFile := filepath.Join(dir, anchorsFilename)
+
+	// Connect to peers in the order of the addresses.  The oldest peer
+	// never completes the handshake and the second one shares the network
+	// group of the first anchor, so neither of them is an anchor.
+	s := &server{banManager: connmgr.NewBanManager("")}
+	state := &peerState{
+		inboundPeers:    make(map[int32]*serverPeer),
+		outboundPeers:   make(map[int32]*serverPeer),
+		persistentPeers: make(map[int32]*serverPeer),
+		outboundGroups:  make(map[string]int),
+	}
+	addrs := []string{"12.0.0.1:18444", "12.1.0.1:18444",
+		"12.1.0.2:18444", "12.2.0.1:18444", "12.3.0.1:18444"}
+	var peers []*serverPeer
+	for i, addr := range addrs {
+		sp := newAnchorTestPeer(t, s, addr, i != 0)
+		state.outboundPeers[int32(i+1)] = sp
+		peers = append(peers, sp)
+		time.Sleep(10 * time.Millisecond)
+	}
+	defer func() {
+		for _, sp := range peers {
+			sp.Disconnect()
+		}
+	}()
+	s.saveAnchors(state)
+
+	// Restart the node, which loads the anchors and removes the file.
+	s = &server{
+		addrManager: addrmgr.New(dir, nil),
+		banManager:  connmgr.NewBanManager(""),
+	}
+	savedAnchors, err := loadAnchors(anchorsFile)
+	if err != nil {
+		t.Fatalf("loadAnchors: unexpected error: %v", err)
+	}
+	wantAnchors := []string{"12.1.0.1:18444", "12.2.0.1:18444"}
+	if !reflect.DeepEqual(savedAnchors, wantAnchors) {
+		t.Fatalf("got anchors %v, want %v", savedAnchors, wantAnchors)
+	}
+	if _, err := os.Stat(anchorsFile); !os.IsNotExist(err) {
+		t.Fatalf("anchors file was not removed: %v", err)
+	}
+	if savedAnchors, err := loadAnchors(anchorsFile); err != nil ||
+		len(savedAnchors) != 0 {
+
+		t.Fatalf("anchors loaded again: %v (err %v)", savedAnchors, err)
+	}
+
+	// The anchors are dialed before any other outbound connection.
+	var mtx sync.Mutex
+	var dialed []string
+	connected := make(chan struct{})
+	cmgr, err := connmgr.New(&connmgr.Config{
+		TargetOutbound: 4,
+		Dial: func(addr net.Addr) (net.Conn, error) {
+			mtx.Lock()
+			dialed = append(dialed, addr.String())
+			mtx.Unlock()
+			r, w := io.Pipe()
+			return &pipeConn{Reader: r, Writer: w,
+				laddr: "10.0.0.1:18444", raddr: addr.String()}, nil
+		},
+		GetNewAddress: func() (net.Addr, error) {
+			return addrStringToNetAddr("12.4.0.1:18444")
+		},
+		OnConnection: func(*connmgr.ConnReq, net.Conn) {
+			connected <- struct{}{}
+		},
+		Anchors: s.anchorAddrs(savedAnchors),
+	})
+	if err != nil {
+		t.Fatalf("unable to create connection manager: %v", err)
+	}
+	cmgr.Start()
+	defer cmgr.Stop()
+	for i := 0; i < 4; i++ {
+		select {
+		case <-connected:
+		case <-time.After(time.Second):
+			t.Fatal("outbound connections were not made")
+		}
+	}
+	mtx.Lock()
+	defer mtx.Unlock()
+	firstDialed := append([]string(nil), dialed[:len(wantAnchors)]...)
+	sort.Strings(firstDialed)
+	if !reflect.DeepEqual(firstDialed, wantAnchors) {
+		t.Fatalf("dialed %v first, want the anchors %v", dialed,
+			wantAnchors)
+	}
+}
@@ -81,7 +81,8 @@ func (b *BlockChain) maybeAcceptBlock(block *provautil.Block, flags BehaviorFlag
 	// inventory to other peers.
 	if !dryRun {
 		b.chainLock.Unlock()
-		b.sendNotification(NTBlockAccepted, block)
+		b.sendNotification(&Notification{Type: NTBlockAccepted,
+			Block: block})
 		b.chainLock.Lock()
 	}
 
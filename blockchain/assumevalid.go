@@ -0,0 +1,146 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"fmt"
+
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/wire"
+)
+
+// AssumeValid returns the hash of the block which is assumed to be valid along
+// with all of its ancestors.  It returns nil when the optimization is disabled.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) AssumeValid() *chainhash.Hash {
+	return b.assumeValid
+}
+
+// dbFetchMainChainHashes uses an existing database transaction to fetch the
+// hashes of all blocks in the main chain up to and including the block with
+// the passed hash and height, indexed by height.  It returns nil when the
+// block is not in the main chain at the passed height.
+func dbFetchMainChainHashes(dbTx database.Tx, hash *chainhash.Hash, height uint32) ([]chainhash.Hash, error) {
+	if !dbMainChainHasBlock(dbTx, hash) {
+		return nil, nil
+	}
+	mainHeight, err := dbFetchHeightByHash(dbTx, hash)
+	if err != nil {
+		return nil, err
+	}
+	if mainHeight != height {
+		return nil, nil
+	}
+
+	hashes := make([]chainhash.Hash, height+1, height+1+wire.MaxBlockHeadersPerMsg)
+	for h := uint32(0); h <= height; h++ {
+		blockHash, err := dbFetchHashByHeight(dbTx, h)
+		if err != nil {
+			return nil, err
+		}
+		hashes[h] = *blockHash
+	}
+	return hashes, nil
+}
+
+// ProcessAssumeValidHeaders extends the header chain used to verify the
+// assumed valid block with the passed headers, which must be in order.  The
+// first header must either connect to a block in the main chain or to a header
+// which was previously processed, in which case any processed headers after
+// that one are replaced.
+//
+// Script validation is only skipped once the assumed valid block has been
+// found on the header chain, and then only for the blocks on that chain up to
+// and including it.  The return value indicates whether the assumed valid
+// block has been found, so callers know when to stop requesting headers.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ProcessAssumeValidHeaders(headers []*wire.BlockHeader) (bool, error) {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	if b.assumeValid == nil || b.assumeValidFound || len(headers) == 0 {
+		return b.assumeValidFound, nil
+	}
+
+	// Determine where the headers connect.  Reuse the existing header
+	// chain when possible and fall back to the main chain otherwise.
+	first := headers[0]
+	if first.Height == 0 {
+		str := fmt.Sprintf("block header %v claims to be the genesis "+
+			"block", first.BlockHash())
+		return false, ruleError(ErrDisconnectedHeaders, str)
+	}
+	parentHeight := first.Height - 1
+	hashes := b.assumeValidHashes
+	if uint32(len(hashes)) <= parentHeight ||
+		hashes[parentHeight] != first.PrevBlock {
+
+		err := b.db.View(func(dbTx database.Tx) error {
+			var err error
+			hashes, err = dbFetchMainChainHashes(dbTx,
+				&first.PrevBlock, parentHeight)
+			return err
+		})
+		if err != nil {
+			return false, err
+		}
+		if hashes == nil {
+			str := fmt.Sprintf("block header %v at height %d does "+
+				"not connect to a known block", first.BlockHash(),
+				first.Height)
+			return false, ruleError(ErrDisconnectedHeaders, str)
+		}
+	}
+	hashes = hashes[:parentHeight+1]
+
+	// Extend the header chain with each of the headers while ensuring they
+	// are sane and link together.  The headers processed before any
+	// failure are kept since they are still valid.
+	for _, header := range headers {
+		height := uint32(len(hashes))
+		if header.PrevBlock != hashes[height-1] || header.Height != height {
+			b.assumeValidHashes = hashes
+			str := fmt.Sprintf("block header %v at height %d does "+
+				"not connect to the previous header %v at "+
+				"height %d", header.BlockHash(), header.Height,
+				hashes[height-1], height-1)
+			return false, ruleError(ErrDisconnectedHeaders, str)
+		}
+		err := checkBlockHeaderSanity(header, b.chainParams.PowLimit,
+			b.timeSource, BFNone)
+		if err != nil {
+			b.assumeValidHashes = hashes
+			return false, err
+		}
+
+		hash := header.BlockHash()
+		hashes = append(hashes, hash)
+		if hash == *b.assumeValid {
+			b.assumeValidFound = true
+			log.Infof("Found assumed valid block %v at height %d on "+
+				"the header chain -- skipping script validation "+
+				"for it and its ancestors", hash, height)
+			break
+		}
+	}
+	b.assumeValidHashes = hashes
+
+	return b.assumeValidFound, nil
+}
+
+// isAssumedValid returns whether the passed block node is the assumed valid
+// block or one of its ancestors on the header chain which has been verified to
+// lead to it.
+//
+// This function MUST be called with the chain lock held (for reads).
+func (b *BlockChain) isAssumedValid(node *blockNode) bool {
+	if !b.assumeValidFound || node.height >= uint32(len(b.assumeValidHashes)) {
+		return false
+	}
+	return b.assumeValidHashes[node.height] == *node.hash
+}
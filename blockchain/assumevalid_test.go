@@ -0,0 +1,207 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain_test
+
+import (
+	"testing"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/blockchain/fullblocktests"
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/wire"
+)
+
+// assumeValidTestBlocks returns a chain of blocks extending the regression test
+// genesis block along with the index of the first block which contains a
+// transaction with a signature script.  The chain contains at least one block
+// after that one.
+func assumeValidTestBlocks(t *testing.T) ([]*wire.MsgBlock, int) {
+	tests, err := fullblocktests.Generate(false)
+	if err != nil {
+		t.Fatalf("failed to generate tests: %v", err)
+	}
+
+	var blocks []*wire.MsgBlock
+	signedIdx := -1
+	tip := chaincfg.RegressionNetParams.GenesisBlock.BlockHash()
+	for _, testInstances := range tests {
+		for _, item := range testInstances {
+			accepted, ok := item.(fullblocktests.AcceptedBlock)
+			if !ok || accepted.Block.Header.PrevBlock != tip {
+				continue
+			}
+
+			block := accepted.Block
+			blocks = append(blocks, block)
+			tip = block.BlockHash()
+			if signedIdx != -1 {
+				return blocks, signedIdx
+			}
+			if len(block.Transactions) > 1 &&
+				len(block.Transactions[1].TxIn[0].SignatureScript) > 0 {
+
+				signedIdx = len(blocks) - 1
+			}
+		}
+	}
+
+	t.Fatalf("unable to find a block with a signed transaction")
+	return nil, 0
+}
+
+// assumeValidPrivKey is the validate key used to sign the blocks generated by
+// the fullblocktests package.
+var assumeValidPrivKey, _ = btcec.PrivKeyFromBytes(btcec.S256(), []byte{
+	0x40, 0x15, 0x28, 0x9a, 0x22, 0x86, 0x58, 0x04, 0x75, 0x20,
+	0xf0, 0xd0, 0xab, 0xe7, 0xad, 0x49, 0xab, 0xc7, 0x7f, 0x6b,
+	0xe0, 0xbe, 0x63, 0xb3, 0x6b, 0x94, 0xb8, 0x3c, 0x2d, 0x1f,
+	0xd9, 0x77,
+})
+
+// resignBlock updates the merkle root of the passed block, signs its header
+// with the validate key used by the fullblocktests package, and solves it.
+func resignBlock(t *testing.T, block *wire.MsgBlock) {
+	txns := make([]*provautil.Tx, 0, len(block.Transactions))
+	for _, tx := range block.Transactions {
+		txns = append(txns, provautil.NewTx(tx))
+	}
+	merkles := blockchain.BuildMerkleTreeStore(txns)
+	block.Header.MerkleRoot = *merkles[len(merkles)-1]
+	if err := block.Header.Sign(assumeValidPrivKey); err != nil {
+		t.Fatalf("failed to sign block header: %v", err)
+	}
+
+	target := blockchain.CompactToBig(block.Header.Bits)
+	for nonce := uint64(0); ; nonce++ {
+		block.Header.Nonce = nonce
+		hash := block.Header.BlockHash()
+		if blockchain.HashToBig(&hash).Cmp(target) <= 0 {
+			return
+		}
+	}
+}
+
+// TestAssumeValid ensures script validation is only skipped for the assumed
+// valid block and its ancestors once it has been found on the header chain.
+func TestAssumeValid(t *testing.T) {
+	blocks, signedIdx := assumeValidTestBlocks(t)
+
+	// Replace the block with the signed transaction with a copy that has
+	// an invalid signature script of the same size, and its child with a
+	// copy that builds on it.
+	signedBlock := blocks[signedIdx]
+	invalidBlock := *signedBlock
+	invalidBlock.Transactions = make([]*wire.MsgTx, len(signedBlock.Transactions))
+	copy(invalidBlock.Transactions, signedBlock.Transactions)
+	invalidTx := signedBlock.Transactions[1].Copy()
+	sigScript := invalidTx.TxIn[0].SignatureScript
+	sigScript[len(sigScript)/2] ^= 0x01
+	invalidBlock.Transactions[1] = invalidTx
+	resignBlock(t, &invalidBlock)
+	childBlock := *blocks[signedIdx+1]
+	childBlock.Header.PrevBlock = invalidBlock.BlockHash()
+	resignBlock(t, &childBlock)
+
+	headers := make([]*wire.BlockHeader, 0, signedIdx+2)
+	for _, block := range blocks[:signedIdx] {
+		headers = append(headers, &block.Header)
+	}
+	headers = append(headers, &invalidBlock.Header, &childBlock.Header)
+
+	tests := []struct {
+		name        string
+		assumeValid chainhash.Hash
+		found       bool
+		valid       bool
+	}{
+		{
+			name:        "invalid block below assumed valid block",
+			assumeValid: childBlock.BlockHash(),
+			found:       true,
+			valid:       true,
+		},
+		{
+			name:        "invalid block is assumed valid block",
+			assumeValid: invalidBlock.BlockHash(),
+			found:       true,
+			valid:       true,
+		},
+		{
+			name:        "invalid block above assumed valid block",
+			assumeValid: blocks[signedIdx-1].BlockHash(),
+			found:       true,
+			valid:       false,
+		},
+		{
+			name:        "assumed valid block not on header chain",
+			assumeValid: chainhash.Hash{0x01},
+			found:       false,
+			valid:       false,
+		},
+	}
+
+	for _, test := range tests {
+		assumeValid := test.assumeValid
+		chain, teardownFunc, err := chainSetupWithConfig("assumevalid",
+			&chaincfg.RegressionNetParams, blockchain.Config{
+				AssumeValid: &assumeValid,
+			})
+		if err != nil {
+			t.Fatalf("%s: failed to setup chain instance: %v",
+				test.name, err)
+		}
+
+		// Ensure headers which do not connect to a known block are
+		// rejected.
+		_, err = chain.ProcessAssumeValidHeaders(headers[1:])
+		rerr, ok := err.(blockchain.RuleError)
+		if !ok || rerr.ErrorCode != blockchain.ErrDisconnectedHeaders {
+			teardownFunc()
+			t.Fatalf("%s: did not receive expected disconnected "+
+				"headers error - got %v", test.name, err)
+		}
+
+		found, err := chain.ProcessAssumeValidHeaders(headers)
+		if err != nil {
+			teardownFunc()
+			t.Fatalf("%s: unexpected error processing headers: %v",
+				test.name, err)
+		}
+		if found != test.found {
+			teardownFunc()
+			t.Fatalf("%s: unexpected found flag - got %v, want %v",
+				test.name, found, test.found)
+		}
+
+		for _, block := range blocks[:signedIdx] {
+			_, _, err := chain.ProcessBlock(provautil.NewBlock(block),
+				blockchain.BFNone)
+			if err != nil {
+				teardownFunc()
+				t.Fatalf("%s: unexpected error processing block "+
+					"%v: %v", test.name, block.BlockHash(), err)
+			}
+		}
+
+		_, _, err = chain.ProcessBlock(provautil.NewBlock(&invalidBlock),
+			blockchain.BFNone)
+		teardownFunc()
+		if test.valid {
+			if err != nil {
+				t.Fatalf("%s: unexpected error processing invalid "+
+					"block: %v", test.name, err)
+			}
+			continue
+		}
+		rerr, ok = err.(blockchain.RuleError)
+		if !ok || rerr.ErrorCode != blockchain.ErrScriptValidation {
+			t.Fatalf("%s: did not receive expected script "+
+				"validation error - got %v", test.name, err)
+		}
+	}
+}
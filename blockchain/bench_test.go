@@ -6,10 +6,18 @@
 package blockchain_test
 
 import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
 	"testing"
 
 	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/database"
 	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/txscript"
+	"github.com/bitgo/prova/wire"
 )
 
 // BenchmarkIsCoinBase performs a simple benchmark against the IsCoinBase
@@ -31,3 +39,105 @@ func BenchmarkIsCoinBaseTx(b *testing.B) {
 		blockchain.IsCoinBaseTx(tx)
 	}
 }
+
+// BenchmarkSyncUtxoBatch benchmarks syncing the blocks generated by the
+// fullblocktests package into a fresh database when the utxo set changes are
+// written for every block compared to when they are written in batches.
+func BenchmarkSyncUtxoBatch(b *testing.B) {
+	blocks := linearTestBlocks(b)
+	for _, batchSize := range []uint32{1, 100} {
+		b.Run(fmt.Sprintf("batch %d", batchSize), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				dir, err := ioutil.TempDir("", "syncutxobatch")
+				if err != nil {
+					b.Fatalf("unable to create temp dir: %v", err)
+				}
+				db, err := database.Create("ffldb", dir, blockDataNet)
+				if err != nil {
+					os.RemoveAll(dir)
+					b.Fatalf("unable to create database: %v", err)
+				}
+				chain := newUtxoBatchTestChain(b, db, blocks,
+					batchSize)
+				b.StartTimer()
+
+				processTestBlocks(b, "sync", chain, blocks)
+
+				b.StopTimer()
+				db.Close()
+				os.RemoveAll(dir)
+				b.StartTimer()
+			}
+		})
+	}
+}
+
+// BenchmarkRecentValidateKeys benchmarks fetching the validate keys of the
+// proof of work averaging window ending at the best block, which the rate
+// limiting rules need on every block connect and template build, from the
+// validate key window compared to deserializing the headers of the window from
+// the database.
+func BenchmarkRecentValidateKeys(b *testing.B) {
+	blocks := linearTestBlocks(b)
+	dir, err := ioutil.TempDir("", "recentvalidatekeys")
+	if err != nil {
+		b.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := database.Create("ffldb", dir, blockDataNet)
+	if err != nil {
+		b.Fatalf("unable to create database: %v", err)
+	}
+	defer db.Close()
+	params := chaincfg.RegressionNetParams
+	chain, err := blockchain.New(&blockchain.Config{
+		DB:          db,
+		ChainParams: &params,
+		TimeSource:  blockchain.NewMedianTime(),
+		SigCache:    txscript.NewSigCache(1000),
+	})
+	if err != nil {
+		b.Fatalf("failed to create chain instance: %v", err)
+	}
+	processTestBlocks(b, "recent validate keys", chain, blocks)
+	best := chain.BestSnapshot()
+	window := params.PowAveragingWindow
+
+	b.Run("window", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, err := chain.RecentValidateKeys(best.Hash, window)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("headers", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			err := db.View(func(dbTx database.Tx) error {
+				hash := *best.Hash
+				keys := make([]wire.BlockValidatingPubKey, 0, window)
+				for len(keys) < window {
+					serialized, err := dbTx.FetchBlockHeader(&hash)
+					if err != nil {
+						return err
+					}
+					var header wire.BlockHeader
+					err = header.Deserialize(bytes.NewReader(serialized))
+					if err != nil {
+						return err
+					}
+					keys = append(keys, header.ValidatingPubKey)
+					if header.Height == 0 {
+						break
+					}
+					hash = header.PrevBlock
+				}
+				return nil
+			})
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,275 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/wire"
+)
+
+const (
+	// blockFileExportBatchSize is the number of blocks which are read from
+	// the database within a single database transaction when exporting
+	// blocks.
+	blockFileExportBatchSize = 500
+
+	// blockFileProgressInterval is the minimum interval between progress
+	// messages logged while exporting or importing blocks.
+	blockFileProgressInterval = 10 * time.Second
+)
+
+// -----------------------------------------------------------------------------
+// A block file is a flat file of serialized blocks which is used to move a
+// chain between environments without syncing it from peers.  It is the same
+// format the addblock utility reads, so files can be imported by either.
+//
+// The serialized format is a sequence of records, one per block, ordered by
+// height:
+//
+//   <net><block length><serialized block>
+//
+//   Field              Type              Size
+//   net                wire.BitcoinNet   4 bytes
+//   block length       uint32            4 bytes
+//   serialized block   []byte            block length
+//
+// Both integers are little endian.
+// -----------------------------------------------------------------------------
+
+// BlockImportStats describes the outcome of importing blocks from a block file
+// with ImportBlocks.
+type BlockImportStats struct {
+	// Processed is the number of blocks read from the file.
+	Processed int64
+
+	// Imported is the number of blocks which were connected to the main
+	// chain.  The remaining processed blocks were already known.
+	Imported int64
+}
+
+// blockFileProgress periodically logs the progress of exporting or importing
+// blocks.
+type blockFileProgress struct {
+	action      string
+	numBlocks   int64
+	numTxns     int64
+	lastLogTime time.Time
+}
+
+// logBlock accounts for the block with the passed header and number of
+// transactions and logs the progress when enough time passed since the last
+// message.
+func (p *blockFileProgress) logBlock(header *wire.BlockHeader, numTxns int) {
+	p.numBlocks++
+	p.numTxns += int64(numTxns)
+
+	now := time.Now()
+	duration := now.Sub(p.lastLogTime)
+	if duration < blockFileProgressInterval {
+		return
+	}
+
+	// Truncate the duration to 10s of milliseconds.
+	durationMillis := int64(duration / time.Millisecond)
+	tDuration := 10 * time.Millisecond * time.Duration(durationMillis/10)
+	log.Infof("%s %d blocks in the last %s (%d transactions, height %d, "+
+		"%s)", p.action, p.numBlocks, tDuration, p.numTxns,
+		header.Height, header.Timestamp)
+	p.numBlocks = 0
+	p.numTxns = 0
+	p.lastLogTime = now
+}
+
+// writeBlockRecord writes the passed serialized block as a block file record
+// for the passed network.
+func writeBlockRecord(w io.Writer, net wire.BitcoinNet, serializedBlock []byte) error {
+	var header [8]byte
+	binary.LittleEndian.PutUint32(header[0:4], uint32(net))
+	binary.LittleEndian.PutUint32(header[4:8], uint32(len(serializedBlock)))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(serializedBlock)
+	return err
+}
+
+// readBlockRecord reads the next block file record, which must belong to the
+// passed network, and returns its serialized block.  Nil is returned without
+// an error once the end of the file is reached at a record boundary.
+func readBlockRecord(r io.Reader, net wire.BitcoinNet) ([]byte, error) {
+	var header [8]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.EOF {
+			return nil, nil
+		}
+		return nil, err
+	}
+	recordNet := wire.BitcoinNet(binary.LittleEndian.Uint32(header[0:4]))
+	if recordNet != net {
+		return nil, fmt.Errorf("block file belongs to network %v "+
+			"instead of %v", recordNet, net)
+	}
+	blockLen := binary.LittleEndian.Uint32(header[4:8])
+	if blockLen > wire.MaxBlockPayload {
+		return nil, fmt.Errorf("block payload of %d bytes is larger "+
+			"than the max allowed %d bytes", blockLen,
+			wire.MaxBlockPayload)
+	}
+	serializedBlock := make([]byte, blockLen)
+	if _, err := io.ReadFull(r, serializedBlock); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return serializedBlock, nil
+}
+
+// ExportBlocks writes the blocks of the main chain from fromHeight through
+// toHeight, inclusive, to the passed writer in the block file format.  The
+// blocks are read from the database in batches, so the passed writer should
+// be buffered when it is backed by a file.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ExportBlocks(w io.Writer, fromHeight, toHeight uint32) error {
+	best := b.BestSnapshot()
+	if fromHeight > toHeight {
+		return fmt.Errorf("export range start %d is above its end %d",
+			fromHeight, toHeight)
+	}
+	if toHeight > best.Height {
+		return fmt.Errorf("export range end %d is above the best "+
+			"height %d", toHeight, best.Height)
+	}
+
+	progress := blockFileProgress{action: "Exported", lastLogTime: time.Now()}
+	for height := uint64(fromHeight); height <= uint64(toHeight); {
+		// Read the next batch of blocks within a single database
+		// transaction.
+		batchEnd := height + blockFileExportBatchSize - 1
+		if batchEnd > uint64(toHeight) {
+			batchEnd = uint64(toHeight)
+		}
+		var blocks [][]byte
+		err := b.db.View(func(dbTx database.Tx) error {
+			for h := height; h <= batchEnd; h++ {
+				hash, err := dbFetchHashByHeight(dbTx, uint32(h))
+				if err != nil {
+					return err
+				}
+				blockBytes, err := dbTx.FetchBlock(hash)
+				if err != nil {
+					return err
+				}
+				blocks = append(blocks, blockBytes)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, blockBytes := range blocks {
+			err := writeBlockRecord(w, b.chainParams.Net, blockBytes)
+			if err != nil {
+				return err
+			}
+
+			// Only the header and the number of transactions are
+			// needed to report the progress.
+			var header wire.BlockHeader
+			r := bytes.NewReader(blockBytes)
+			if err := header.Deserialize(r); err != nil {
+				return err
+			}
+			numTxns, err := wire.ReadVarInt(r, 0)
+			if err != nil {
+				return err
+			}
+			progress.logBlock(&header, int(numTxns))
+		}
+		height = batchEnd + 1
+	}
+
+	return nil
+}
+
+// ImportBlocks reads blocks in the block file format from the passed reader
+// and connects them to the main chain with full validation.  Blocks which are
+// already known are skipped, so a file may be imported again or overlap with
+// the chain, but every other block must extend the main chain.  The statistics
+// of the blocks read until the import stopped are returned along with any
+// error.
+//
+// Importing does not involve any peers and writes the utxo set modifications
+// in batches when the chain is configured with a utxo batch size.  The pending
+// modifications are written once the import stopped.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ImportBlocks(r io.Reader) (*BlockImportStats, error) {
+	stats := &BlockImportStats{}
+	err := b.importBlocks(r, stats)
+	if flushErr := b.FlushUtxoBatch(); err == nil {
+		err = flushErr
+	}
+	return stats, err
+}
+
+// importBlocks imports the blocks from the passed reader and accounts for them
+// in the passed statistics.  See ImportBlocks for details.
+func (b *BlockChain) importBlocks(r io.Reader, stats *BlockImportStats) error {
+	progress := blockFileProgress{action: "Imported", lastLogTime: time.Now()}
+	for {
+		serializedBlock, err := readBlockRecord(r, b.chainParams.Net)
+		if err != nil {
+			return err
+		}
+		if serializedBlock == nil {
+			return nil
+		}
+		block, err := provautil.NewBlockFromBytes(serializedBlock)
+		if err != nil {
+			return err
+		}
+		stats.Processed++
+
+		// Skip blocks which are already known.
+		blockHash := block.Hash()
+		exists, err := b.HaveBlock(blockHash)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+
+		// Don't bother processing blocks which don't extend the main
+		// chain since they would only end up as orphans or side chain
+		// blocks.
+		prevHash := &block.MsgBlock().Header.PrevBlock
+		if !prevHash.IsEqual(b.BestSnapshot().Hash) {
+			return fmt.Errorf("block %v of the block file does not "+
+				"extend the main chain", blockHash)
+		}
+		isMainChain, isOrphan, err := b.ProcessBlock(block, BFNone)
+		if err != nil {
+			return err
+		}
+		if isOrphan || !isMainChain {
+			return fmt.Errorf("block %v of the block file was not "+
+				"connected to the main chain", blockHash)
+		}
+		stats.Imported++
+		progress.logBlock(&block.MsgBlock().Header,
+			len(block.MsgBlock().Transactions))
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/chaincfg"
+)
+
+// TestBlockFile ensures the blocks exported from one chain can be imported into
+// a fresh chain, which then ends up with the same chain state, that already
+// known blocks are skipped, and that invalid block files are rejected.
+//
+// The regression test network is used in place of the simulation test network
+// since the blocks generated by the fullblocktests package are the only ones
+// which can be validated without a miner.
+func TestBlockFile(t *testing.T) {
+	blocks := linearTestBlocks(t)
+	if len(blocks) < 4 {
+		t.Fatalf("not enough test blocks - got %d", len(blocks))
+	}
+	tipHeight := uint32(len(blocks))
+
+	// Export all blocks including the genesis block.
+	chain, teardownFunc, err := chainSetup("blockfileexport",
+		&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+	processTestBlocks(t, "export", chain, blocks)
+	var blockFile bytes.Buffer
+	if err := chain.ExportBlocks(&blockFile, 0, tipHeight); err != nil {
+		t.Fatalf("ExportBlocks: unexpected error: %v", err)
+	}
+
+	// Ensure invalid ranges are rejected.
+	if err := chain.ExportBlocks(&bytes.Buffer{}, 2, 1); err == nil {
+		t.Fatalf("ExportBlocks: did not receive expected error when " +
+			"the range start is above its end")
+	}
+	err = chain.ExportBlocks(&bytes.Buffer{}, 0, tipHeight+1)
+	if err == nil {
+		t.Fatalf("ExportBlocks: did not receive expected error when " +
+			"the range end is above the best height")
+	}
+
+	// Import the blocks into a fresh chain which writes the utxo set in
+	// batches and ensure it matches the exporting chain.
+	importChain, teardown, err := chainSetupWithConfig("blockfileimport",
+		&chaincfg.RegressionNetParams,
+		blockchain.Config{UtxoBatchSize: 3})
+	if err != nil {
+		t.Fatalf("failed to setup chain instance: %v", err)
+	}
+	defer teardown()
+	stats, err := importChain.ImportBlocks(bytes.NewReader(blockFile.Bytes()))
+	if err != nil {
+		t.Fatalf("ImportBlocks: unexpected error: %v", err)
+	}
+	wantStats := blockchain.BlockImportStats{
+		Processed: int64(len(blocks) + 1),
+		Imported:  int64(len(blocks)),
+	}
+	if *stats != wantStats {
+		t.Fatalf("ImportBlocks: unexpected stats - got %+v, want %+v",
+			*stats, wantStats)
+	}
+	if !reflect.DeepEqual(importChain.BestSnapshot(), chain.BestSnapshot()) {
+		t.Fatalf("mismatched best state after import - got %+v, want %+v",
+			importChain.BestSnapshot(), chain.BestSnapshot())
+	}
+	if !reflect.DeepEqual(importChain.UtxoSetStats(), chain.UtxoSetStats()) {
+		t.Fatalf("mismatched utxo set stats after import - got %+v, "+
+			"want %+v", importChain.UtxoSetStats(), chain.UtxoSetStats())
+	}
+	calcStats, err := importChain.CalcUtxoSetStats()
+	if err != nil {
+		t.Fatalf("CalcUtxoSetStats: unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(calcStats, chain.UtxoSetStats()) {
+		t.Fatalf("mismatched calculated utxo set stats after import - "+
+			"got %+v, want %+v", calcStats, chain.UtxoSetStats())
+	}
+
+	// Ensure importing the same blocks again skips all of them.
+	stats, err = importChain.ImportBlocks(bytes.NewReader(blockFile.Bytes()))
+	if err != nil {
+		t.Fatalf("ImportBlocks: unexpected error on reimport: %v", err)
+	}
+	wantStats.Imported = 0
+	if *stats != wantStats {
+		t.Fatalf("ImportBlocks: unexpected stats on reimport - got %+v, "+
+			"want %+v", *stats, wantStats)
+	}
+
+	// Export partial ranges and ensure importing them only succeeds once
+	// the blocks they build on are known.
+	midHeight := tipHeight / 2
+	var head, tail bytes.Buffer
+	if err := chain.ExportBlocks(&head, 0, midHeight); err != nil {
+		t.Fatalf("ExportBlocks: unexpected error: %v", err)
+	}
+	if err := chain.ExportBlocks(&tail, midHeight+1, tipHeight); err != nil {
+		t.Fatalf("ExportBlocks: unexpected error: %v", err)
+	}
+	rangeChain, teardownRange, err := chainSetup("blockfilerange",
+		&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("failed to setup chain instance: %v", err)
+	}
+	defer teardownRange()
+	_, err = rangeChain.ImportBlocks(bytes.NewReader(tail.Bytes()))
+	if err == nil {
+		t.Fatalf("ImportBlocks: did not receive expected error when " +
+			"the blocks do not extend the main chain")
+	}
+	for _, data := range [][]byte{head.Bytes(), tail.Bytes()} {
+		_, err := rangeChain.ImportBlocks(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("ImportBlocks: unexpected error: %v", err)
+		}
+	}
+	if !reflect.DeepEqual(rangeChain.BestSnapshot(), chain.BestSnapshot()) {
+		t.Fatalf("mismatched best state after range import - got %+v, "+
+			"want %+v", rangeChain.BestSnapshot(), chain.BestSnapshot())
+	}
+
+	// Ensure invalid block files are rejected.
+	wrongNet := append([]byte(nil), blockFile.Bytes()...)
+	wrongNet[0] ^= 0x01
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{
+			name: "wrong network",
+			data: wrongNet,
+		},
+		{
+			name: "truncated",
+			data: blockFile.Bytes()[:blockFile.Len()-1],
+		},
+	}
+	for _, test := range tests {
+		invalidChain, teardown, err := chainSetup("blockfileinvalid",
+			&chaincfg.RegressionNetParams)
+		if err != nil {
+			t.Fatalf("%s: failed to setup chain instance: %v",
+				test.name, err)
+		}
+		_, err = invalidChain.ImportBlocks(bytes.NewReader(test.data))
+		teardown()
+		if err == nil {
+			t.Fatalf("%s: did not receive expected error", test.name)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/provautil"
+)
+
+// BlockStats houses aggregate fee and size statistics about the transactions
+// in a block.  Fee rates are expressed in atoms per kilobyte and only take the
+// non-coinbase transactions into account.
+type BlockStats struct {
+	Hash          chainhash.Hash
+	Height        uint32
+	TotalFee      int64
+	FeePerKB      int64
+	MinFeeRate    int64
+	MedianFeeRate int64
+	MaxFeeRate    int64
+	NumTxns       uint32
+	NumInputs     uint32
+	NumOutputs    uint32
+	TotalSize     uint32
+}
+
+// CalcBlockStats calculates the statistics for the passed block.  The provided
+// view must contain an entry for every output the transactions in the block
+// spend, regardless of whether or not those outputs have since been marked
+// spent.  This is the case for the view that is passed to the index manager
+// when a block is connected, as well as for views obtained from
+// FetchSpendJournalView.
+func CalcBlockStats(block *provautil.Block, view *UtxoViewpoint) (*BlockStats, error) {
+	transactions := block.Transactions()
+	stats := &BlockStats{
+		Hash:      *block.Hash(),
+		Height:    block.Height(),
+		NumTxns:   uint32(len(transactions)),
+		TotalSize: uint32(block.MsgBlock().SerializeSize()),
+	}
+
+	var txnsSize int64
+	feeRates := make([]int64, 0, len(transactions))
+	for txIdx, tx := range transactions {
+		msgTx := tx.MsgTx()
+		stats.NumOutputs += uint32(len(msgTx.TxOut))
+
+		// Coinbase transactions don't have any inputs and thus don't
+		// pay any fees.
+		if txIdx == 0 {
+			continue
+		}
+		stats.NumInputs += uint32(len(msgTx.TxIn))
+
+		var totalIn int64
+		for _, txIn := range msgTx.TxIn {
+			originHash := &txIn.PreviousOutPoint.Hash
+			entry := view.LookupEntry(originHash)
+			if entry == nil {
+				return nil, AssertError(fmt.Sprintf("view "+
+					"missing input %v", txIn.PreviousOutPoint))
+			}
+			originIndex := txIn.PreviousOutPoint.Index
+			totalIn += entry.AmountByIndex(originIndex)
+		}
+
+		var totalOut int64
+		for _, txOut := range msgTx.TxOut {
+			totalOut += txOut.Value
+		}
+
+		// Admin issue transactions are allowed to create more output
+		// value than they spend, so they never pay a fee.
+		fee := totalIn - totalOut
+		if fee < 0 {
+			fee = 0
+		}
+		txSize := int64(msgTx.SerializeSizeCached())
+		stats.TotalFee += fee
+		txnsSize += txSize
+		feeRates = append(feeRates, fee*1000/txSize)
+	}
+
+	// There is nothing more to calculate for blocks that only contain a
+	// coinbase.
+	if len(feeRates) == 0 {
+		return stats, nil
+	}
+
+	sort.Sort(int64Sorter(feeRates))
+	stats.FeePerKB = stats.TotalFee * 1000 / txnsSize
+	stats.MinFeeRate = feeRates[0]
+	stats.MaxFeeRate = feeRates[len(feeRates)-1]
+	mid := len(feeRates) / 2
+	if len(feeRates)%2 == 0 {
+		stats.MedianFeeRate = (feeRates[mid-1] + feeRates[mid]) / 2
+	} else {
+		stats.MedianFeeRate = feeRates[mid]
+	}
+
+	return stats, nil
+}
+
+// spendJournalView decodes the passed serialized spend journal entry for the
+// provided block into a view that contains an entry for every output the
+// transactions in the block spend.  All of the outputs in the returned view are
+// marked spent.
+func spendJournalView(serialized []byte, block *provautil.Block) (*UtxoViewpoint, error) {
+	// The spend journal only serializes the containing transaction version
+	// along with the final spend of a transaction, so seed the view with
+	// placeholder entries for every referenced transaction.  The version
+	// does not affect the way the amounts are encoded, so the placeholders
+	// only serve to satisfy the decoder when the final spend happened in a
+	// later block.
+	placeholders := NewUtxoViewpoint()
+	blockTxns := block.MsgBlock().Transactions[1:]
+	for _, tx := range blockTxns {
+		for _, txIn := range tx.TxIn {
+			originHash := txIn.PreviousOutPoint.Hash
+			if _, ok := placeholders.entries[originHash]; !ok {
+				placeholders.entries[originHash] =
+					newUtxoEntry(tx.Version, false, 0)
+			}
+		}
+	}
+	stxos, err := deserializeSpendJournalEntry(serialized, blockTxns,
+		placeholders)
+	if err != nil {
+		return nil, err
+	}
+
+	// Populate a new view with the spent outputs in the same order they
+	// are spent by the block.
+	view := NewUtxoViewpoint()
+	var stxoIdx int
+	for _, tx := range blockTxns {
+		for _, txIn := range tx.TxIn {
+			stxo := &stxos[stxoIdx]
+			stxoIdx++
+
+			originHash := txIn.PreviousOutPoint.Hash
+			entry := view.entries[originHash]
+			if entry == nil {
+				entry = newUtxoEntry(stxo.version,
+					stxo.isCoinBase, stxo.height)
+				view.entries[originHash] = entry
+			}
+			entry.sparseOutputs[txIn.PreviousOutPoint.Index] = &utxoOutput{
+				spent:      true,
+				compressed: stxo.compressed,
+				amount:     stxo.amount,
+				pkScript:   stxo.pkScript,
+			}
+		}
+	}
+	view.SetBestHash(block.Hash())
+
+	return view, nil
+}
+
+// FetchSpendJournalView uses an existing database transaction to load the
+// spend journal entry for the passed main chain block and returns a view that
+// contains an entry for every output the transactions in the block spend.  It
+// allows the outputs spent by historical blocks to be recovered after they have
+// been removed from the utxo set.
+func FetchSpendJournalView(dbTx database.Tx, block *provautil.Block) (*UtxoViewpoint, error) {
+	spendBucket := dbTx.Metadata().Bucket(spendJournalBucketName)
+	serialized := spendBucket.Get(block.Hash()[:])
+	view, err := spendJournalView(serialized, block)
+	if err != nil {
+		// Ensure any deserialization errors are returned as database
+		// corruption errors.
+		if isDeserializeErr(err) {
+			return nil, database.Error{
+				ErrorCode: database.ErrCorruption,
+				Description: fmt.Sprintf("corrupt spend "+
+					"information for %v: %v", block.Hash(),
+					err),
+			}
+		}
+
+		return nil, err
+	}
+
+	return view, nil
+}
+
+// BlockStats returns the statistics for the block with the given hash in the
+// main chain.  The values of the outputs spent by the block are recovered from
+// the spend journal.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) BlockStats(hash *chainhash.Hash) (*BlockStats, error) {
+	var stats *BlockStats
+	err := b.db.View(func(dbTx database.Tx) error {
+		block, err := dbFetchBlockByHash(dbTx, hash)
+		if err != nil {
+			return err
+		}
+
+		view, err := FetchSpendJournalView(dbTx, block)
+		if err != nil {
+			return err
+		}
+
+		stats, err = CalcBlockStats(block, view)
+		return err
+	})
+	return stats, err
+}
@@ -0,0 +1,116 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/wire"
+)
+
+// spendTx returns a transaction which spends the provided output of the passed
+// transaction to a single output with the given value.
+func spendTx(origin *wire.MsgTx, index uint32, value int64) *wire.MsgTx {
+	originHash := origin.TxHash()
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&originHash, index),
+		[]byte{0x51}))
+	tx.AddTxOut(wire.NewTxOut(value, []byte{0x51}))
+	return tx
+}
+
+// TestCalcBlockStats ensures the statistics calculated for a hand-built block
+// are accurate and that recovering the spent outputs from the spend journal
+// produces the same statistics as the view used when connecting the block.
+func TestCalcBlockStats(t *testing.T) {
+	// Create a funding transaction with three outputs, only two of which
+	// are spent by the block, so the spend journal does not encode the
+	// version for those spends.
+	funding := wire.NewMsgTx(wire.TxVersion)
+	funding.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: wire.MaxPrevOutIndex},
+		[]byte{0x51}))
+	funding.AddTxOut(wire.NewTxOut(100000, []byte{0x51}))
+	funding.AddTxOut(wire.NewTxOut(50000, []byte{0x51}))
+	funding.AddTxOut(wire.NewTxOut(25000, []byte{0x51}))
+
+	coinbase := wire.NewMsgTx(wire.TxVersion)
+	coinbase.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: wire.MaxPrevOutIndex},
+		[]byte{0x52}))
+	coinbase.AddTxOut(wire.NewTxOut(5000, []byte{0x51}))
+	tx1 := spendTx(funding, 0, 90000)
+	tx2 := spendTx(funding, 1, 49000)
+	tx3 := spendTx(tx1, 0, 89500)
+
+	msgBlock := wire.NewMsgBlock(&wire.BlockHeader{Height: 2})
+	for _, tx := range []*wire.MsgTx{coinbase, tx1, tx2, tx3} {
+		msgBlock.AddTransaction(tx)
+	}
+	block := provautil.NewBlock(msgBlock)
+
+	// Connect the block to a view containing the funding transaction while
+	// recording the spent outputs like the chain does when connecting a
+	// block.
+	view := NewUtxoViewpoint()
+	view.AddTxOuts(provautil.NewTx(funding), 1)
+	var stxos []spentTxOut
+	if err := view.connectTransactions(block, &stxos); err != nil {
+		t.Fatalf("connectTransactions: unexpected error: %v", err)
+	}
+	stats, err := CalcBlockStats(block, view)
+	if err != nil {
+		t.Fatalf("CalcBlockStats: unexpected error: %v", err)
+	}
+
+	fees := []int64{10000, 1000, 500}
+	txnsSize := int64(tx1.SerializeSize() + tx2.SerializeSize() +
+		tx3.SerializeSize())
+	rates := []int64{
+		fees[2] * 1000 / int64(tx3.SerializeSize()),
+		fees[1] * 1000 / int64(tx2.SerializeSize()),
+		fees[0] * 1000 / int64(tx1.SerializeSize()),
+	}
+	want := &BlockStats{
+		Hash:          *block.Hash(),
+		Height:        2,
+		TotalFee:      11500,
+		FeePerKB:      11500 * 1000 / txnsSize,
+		MinFeeRate:    rates[0],
+		MedianFeeRate: rates[1],
+		MaxFeeRate:    rates[2],
+		NumTxns:       4,
+		NumInputs:     3,
+		NumOutputs:    4,
+		TotalSize:     uint32(msgBlock.SerializeSize()),
+	}
+	if !reflect.DeepEqual(stats, want) {
+		t.Fatalf("CalcBlockStats: mismatched stats - got %+v, want %+v",
+			stats, want)
+	}
+
+	// Ensure the statistics calculated from the spend journal match the
+	// ones calculated from the live view.
+	journalView, err := spendJournalView(serializeSpendJournalEntry(stxos),
+		block)
+	if err != nil {
+		t.Fatalf("spendJournalView: unexpected error: %v", err)
+	}
+	stats, err = CalcBlockStats(block, journalView)
+	if err != nil {
+		t.Fatalf("CalcBlockStats: unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(stats, want) {
+		t.Fatalf("CalcBlockStats (spend journal): mismatched stats - "+
+			"got %+v, want %+v", stats, want)
+	}
+
+	// Ensure a view that is missing an input is rejected.
+	_, err = CalcBlockStats(block, NewUtxoViewpoint())
+	if _, ok := err.(AssertError); !ok {
+		t.Fatalf("CalcBlockStats: did not receive expected assert "+
+			"error with empty view - got %v", err)
+	}
+}
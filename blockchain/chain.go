@@ -12,6 +12,7 @@ import (
 	"github.com/bitgo/prova/chaincfg"
 	"github.com/bitgo/prova/chaincfg/chainhash"
 	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/metrics"
 	"github.com/bitgo/prova/provautil"
 	"github.com/bitgo/prova/txscript"
 	"github.com/bitgo/prova/wire"
@@ -25,8 +26,45 @@ const (
 	// maxOrphanBlocks is the maximum number of orphan blocks that can be
 	// queued.
 	maxOrphanBlocks = 1000
+
+	// maxOrphanBlockBytes is the maximum total serialized size of the
+	// orphan blocks that can be queued.
+	maxOrphanBlockBytes = 20 * wire.MaxBlockPayload
+
+	// orphanExpiration is how long orphan blocks are queued before they
+	// are discarded in case their parents never arrive.
+	orphanExpiration = time.Hour
 )
 
+// blockStatus is a bit field representing the validation state of a block
+// node.
+type blockStatus byte
+
+const (
+	// statusValid indicates that the block has been fully validated,
+	// which is the case once it has been connected to the main chain.
+	statusValid blockStatus = 1 << iota
+
+	// statusValidateFailed indicates that the block failed validation when
+	// it was connected.
+	statusValidateFailed
+
+	// statusInvalidAncestor indicates that one of the ancestors of the
+	// block failed validation, thus the block is also invalid.
+	statusInvalidAncestor
+
+	// statusNone indicates that the block has no validation state flags
+	// set, which is the case for side chain blocks that have not been
+	// connected yet.
+	statusNone blockStatus = 0
+)
+
+// KnownInvalid returns whether the block is known to be invalid, either
+// because it failed validation itself or because one of its ancestors did.
+func (status blockStatus) KnownInvalid() bool {
+	return status&(statusValidateFailed|statusInvalidAncestor) != 0
+}
+
 // blockNode represents a block within the block chain and is primarily used to
 // aid in selecting the best chain to be the main chain.  The main chain is
 // stored into the block database.
@@ -74,6 +112,10 @@ type blockNode struct {
 
 	// Generator identity to check rate limiting against.
 	validatingPubKey wire.BlockValidatingPubKey
+
+	// status is a bitfield representing the validation state of the block.
+	// It is only accessed with the chain lock held.
+	status blockStatus
 }
 
 // newBlockNode returns a new block node for the given block header.  It is
@@ -119,11 +161,23 @@ func (node *blockNode) Header() wire.BlockHeader {
 	}
 }
 
+// hasMoreWork returns whether the chain ending at the node has more cumulative
+// work than the chain ending at the passed node.  Ties are not considered more
+// work so the chain which was seen first is kept.
+//
+// This function is safe for concurrent access.
+func (node *blockNode) hasMoreWork(other *blockNode) bool {
+	// No lock is needed because the work sum is only updated when the node
+	// is inserted into the chain.
+	return node.workSum.Cmp(other.workSum) > 0
+}
+
 // orphanBlock represents a block that we don't yet have the parent for.  It
 // is a normal block plus an expiration time to prevent caching the orphan
 // forever.
 type orphanBlock struct {
 	block      *provautil.Block
+	size       int
 	expiration time.Time
 }
 
@@ -208,6 +262,41 @@ func newBestState(node *blockNode, blockSize, numTxns, totalTxns uint64,
 	}
 }
 
+// reorgDepthBuckets are the upper bounds of the buckets of the histogram of
+// the number of blocks disconnected by reorganizations.
+var reorgDepthBuckets = []float64{1, 2, 3, 5, 10, 25, 50, 100}
+
+// chainMetrics houses the metrics of the block chain.  They are all nil, and
+// discard their updates, when the chain has no metrics registry.
+type chainMetrics struct {
+	height       *metrics.Gauge
+	connected    *metrics.Counter
+	disconnected *metrics.Counter
+	validation   *metrics.Histogram
+	reorgDepth   *metrics.Histogram
+}
+
+// newChainMetrics registers the metrics of the block chain with the passed
+// registry.
+func newChainMetrics(registry *metrics.Registry) chainMetrics {
+	return chainMetrics{
+		height: registry.NewGauge("prova_chain_height",
+			"Height of the best chain."),
+		connected: registry.NewCounter("prova_chain_blocks_connected_total",
+			"Number of blocks connected to the best chain."),
+		disconnected: registry.NewCounter(
+			"prova_chain_blocks_disconnected_total",
+			"Number of blocks disconnected from the best chain."),
+		validation: registry.NewHistogram(
+			"prova_chain_block_validation_seconds",
+			"Time taken to validate and connect blocks which "+
+				"extend the best chain.", metrics.DurationBuckets),
+		reorgDepth: registry.NewHistogram("prova_chain_reorg_depth",
+			"Number of blocks disconnected by reorganizations.",
+			reorgDepthBuckets),
+	}
+}
+
 // BlockChain provides functions for working with the bitcoin block chain.
 // It includes functionality such as rejecting duplicate blocks, ensuring blocks
 // follow all rules, orphan handling, checkpoint handling, and best chain
@@ -222,9 +311,16 @@ type BlockChain struct {
 	chainParams         *chaincfg.Params
 	timeSource          MedianTimeSource
 	notifications       NotificationCallback
+	notifier            *Notifier
 	sigCache            *txscript.SigCache
 	hashCache           *txscript.HashCache
 	indexManager        IndexManager
+	scriptWorkers       int
+	assumeValid         *chainhash.Hash
+	utxoSnapshots       []chaincfg.UtxoSnapshot
+	maxReorgDepth       uint32
+	utxoBatchSize       int
+	metrics             chainMetrics
 
 	// The following fields are calculated based upon the provided chain
 	// parameters.  They are also set when the instance is created and
@@ -248,12 +344,27 @@ type BlockChain struct {
 	// runtime.  They are protected by the chain lock.
 	noVerify bool
 
+	// These fields track the header chain which leads to the assumed valid
+	// block.  They are protected by the chain lock.
+	//
+	// assumeValidHashes houses the hashes of the headers processed via
+	// ProcessAssumeValidHeaders indexed by height and assumeValidFound
+	// indicates whether the assumed valid block is the last one of them.
+	assumeValidHashes []chainhash.Hash
+	assumeValidFound  bool
+
 	// These fields are related to the memory block index.  They are
 	// protected by the chain lock.
 	bestNode *blockNode
 	index    map[chainhash.Hash]*blockNode
 	depNodes map[chainhash.Hash][]*blockNode
 
+	// These fields hold the validate keys which signed the most recent
+	// blocks of the best chain and of the most recently checked side chain
+	// tip.  They are protected by the chain lock.
+	bestKeyWindow *validateKeyWindow
+	sideKeyWindow *validateKeyWindow
+
 	// These fields are related to the admin state of the chain. They are
 	// protected by the chain lock.
 
@@ -272,10 +383,10 @@ type BlockChain struct {
 
 	// These fields are related to handling of orphan blocks.  They are
 	// protected by a combination of the chain lock and the orphan lock.
-	orphanLock   sync.RWMutex
-	orphans      map[chainhash.Hash]*orphanBlock
-	prevOrphans  map[chainhash.Hash][]*orphanBlock
-	oldestOrphan *orphanBlock
+	orphanLock  sync.RWMutex
+	orphans     map[chainhash.Hash]*orphanBlock
+	prevOrphans map[chainhash.Hash][]*orphanBlock
+	orphanBytes int
 
 	// These fields are related to checkpoint handling.  They are protected
 	// by the chain lock.
@@ -295,6 +406,25 @@ type BlockChain struct {
 	// chain state can be quickly reconstructed on load.
 	stateLock     sync.RWMutex
 	stateSnapshot *BestState
+
+	// utxoSetState houses the incrementally updated statistics about the
+	// utxo set as of the best block.  It is replaced along with the state
+	// snapshot and is protected by the state lock.
+	utxoSetState *utxoSetState
+
+	// utxoBatch houses the utxo set modifications of the most recently
+	// connected blocks which have not been written to the database yet.
+	// It is protected by the chain lock.
+	utxoBatch *utxoBatch
+
+	// versionTally houses the block versions the state of the version
+	// rollouts is tallied from along with the cached upgrade status of the
+	// best chain.  It is maintained as blocks are connected and
+	// disconnected under the chain lock, while the cached status is also
+	// protected by the upgrade status lock, which must be acquired before
+	// the chain lock.
+	upgradeStatusLock sync.Mutex
+	versionTally      *versionTally
 }
 
 // DisableVerify provides a mechanism to disable transaction script validation
@@ -346,6 +476,28 @@ func (b *BlockChain) IsKnownOrphan(hash *chainhash.Hash) bool {
 	return exists
 }
 
+// IsKnownInvalid returns whether the block represented by the passed hash is
+// known to be invalid, either because it failed validation itself or because
+// one of its ancestors did.  Blocks which were invalidated manually are known
+// to be invalid even when they are not loaded in memory.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) IsKnownInvalid(hash *chainhash.Hash) (bool, error) {
+	b.chainLock.RLock()
+	defer b.chainLock.RUnlock()
+
+	if node, ok := b.index[*hash]; ok {
+		return node.status.KnownInvalid(), nil
+	}
+
+	var invalid bool
+	err := b.db.View(func(dbTx database.Tx) error {
+		invalid = dbIsInvalidBlock(dbTx, hash)
+		return nil
+	})
+	return invalid, err
+}
+
 // GetOrphanRoot returns the head of the chain for the provided hash from the
 // map of orphan blocks.
 //
@@ -382,6 +534,7 @@ func (b *BlockChain) removeOrphanBlock(orphan *orphanBlock) {
 	// Remove the orphan block from the orphan pool.
 	orphanHash := orphan.block.Hash()
 	delete(b.orphans, *orphanHash)
+	b.orphanBytes -= orphan.size
 
 	// Remove the reference from the previous orphan index too.  An indexing
 	// for loop is intentionally used over a range here as range does not
@@ -407,32 +560,40 @@ func (b *BlockChain) removeOrphanBlock(orphan *orphanBlock) {
 	}
 }
 
+// oldestOrphanBlock returns the orphan block which was received first, which is
+// the one which expires first.  The orphan pool must not be empty.
+func (b *BlockChain) oldestOrphanBlock() *orphanBlock {
+	var oldest *orphanBlock
+	for _, oBlock := range b.orphans {
+		if oldest == nil || oBlock.expiration.Before(oldest.expiration) {
+			oldest = oBlock
+		}
+	}
+	return oldest
+}
+
 // addOrphanBlock adds the passed block (which is already determined to be
 // an orphan prior calling this function) to the orphan pool.  It lazily cleans
 // up any expired blocks so a separate cleanup poller doesn't need to be run.
-// It also imposes a maximum limit on the number of outstanding orphan
-// blocks and will remove the oldest received orphan block if the limit is
-// exceeded.
+// It also imposes a maximum limit on the number and the total size of the
+// outstanding orphan blocks and will remove the oldest received orphan blocks
+// until the new one fits within the limits.
 func (b *BlockChain) addOrphanBlock(block *provautil.Block) {
 	// Remove expired orphan blocks.
+	now := time.Now()
 	for _, oBlock := range b.orphans {
-		if time.Now().After(oBlock.expiration) {
+		if now.After(oBlock.expiration) {
 			b.removeOrphanBlock(oBlock)
-			continue
-		}
-
-		// Update the oldest orphan block pointer so it can be discarded
-		// in case the orphan pool fills up.
-		if b.oldestOrphan == nil || oBlock.expiration.Before(b.oldestOrphan.expiration) {
-			b.oldestOrphan = oBlock
 		}
 	}
 
-	// Limit orphan blocks to prevent memory exhaustion.
-	if len(b.orphans)+1 > maxOrphanBlocks {
-		// Remove the oldest orphan to make room for the new one.
-		b.removeOrphanBlock(b.oldestOrphan)
-		b.oldestOrphan = nil
+	// Limit orphan blocks to prevent memory exhaustion by removing the
+	// oldest orphans to make room for the new one.
+	size := block.MsgBlock().SerializeSize()
+	for len(b.orphans) > 0 && (len(b.orphans)+1 > maxOrphanBlocks ||
+		b.orphanBytes+size > maxOrphanBlockBytes) {
+
+		b.removeOrphanBlock(b.oldestOrphanBlock())
 	}
 
 	// Protect concurrent access.  This is intentionally done here instead
@@ -443,12 +604,13 @@ func (b *BlockChain) addOrphanBlock(block *provautil.Block) {
 
 	// Insert the block into the orphan map with an expiration time
 	// 1 hour from now.
-	expiration := time.Now().Add(time.Hour)
 	oBlock := &orphanBlock{
 		block:      block,
-		expiration: expiration,
+		size:       size,
+		expiration: now.Add(orphanExpiration),
 	}
 	b.orphans[*block.Hash()] = oBlock
+	b.orphanBytes += size
 
 	// Add to previous hash lookup index for faster dependency lookups.
 	prevHash := &block.MsgBlock().Header.PrevBlock
@@ -471,9 +633,14 @@ func (b *BlockChain) loadBlockNode(dbTx database.Tx, hash *chainhash.Hash) (*blo
 		return nil, err
 	}
 
-	// Create the new block node for the block and set the work.
+	// Create the new block node for the block and set the work.  Blocks
+	// which were invalidated manually remain invalid.
 	node := newBlockNode(blockHeader, hash)
 	node.inMainChain = true
+	node.status = statusValid
+	if dbIsInvalidBlock(dbTx, hash) {
+		node.status = statusValidateFailed
+	}
 
 	// Add the node to the chain.
 	// There are a few possibilities here:
@@ -491,6 +658,9 @@ func (b *BlockChain) loadBlockNode(dbTx database.Tx, hash *chainhash.Hash) (*blo
 		node.workSum = node.workSum.Add(parentNode.workSum, node.workSum)
 		parentNode.children = append(parentNode.children, node)
 		node.parent = parentNode
+		if parentNode.status.KnownInvalid() {
+			node.status |= statusInvalidAncestor
+		}
 
 	} else if childNodes, ok := b.depNodes[*hash]; ok {
 		// Case 2 -- This node is the parent of one or more nodes.
@@ -727,6 +897,11 @@ type SequenceLock struct {
 // referenced within a transaction have reached sufficient maturity allowing
 // the candidate transaction to be included in a block.
 //
+// The lock is calculated for inclusion in the block after the current best
+// block.  Sequence locks only apply once BIP0068 is active as defined by the
+// CSV deployment of the chain parameters, unless the mempool flag is set, in
+// which case they are enforced as policy regardless.
+//
 // This function is safe for concurrent access.
 func (b *BlockChain) CalcSequenceLock(tx *provautil.Tx, utxoView *UtxoViewpoint,
 	mempool bool) (*SequenceLock, error) {
@@ -734,15 +909,16 @@ func (b *BlockChain) CalcSequenceLock(tx *provautil.Tx, utxoView *UtxoViewpoint,
 	b.chainLock.Lock()
 	defer b.chainLock.Unlock()
 
-	return b.calcSequenceLock(tx, utxoView, mempool)
+	return b.calcSequenceLock(b.bestNode, tx, utxoView, mempool)
 }
 
-// calcSequenceLock computes the relative lock-times for the passed
-// transaction. See the exported version, CalcSequenceLock for further details.
+// calcSequenceLock computes the relative lock-times for the passed transaction
+// when included in the block after the passed node. See the exported version,
+// CalcSequenceLock for further details.
 //
 // This function MUST be called with the chain state lock held (for writes).
-func (b *BlockChain) calcSequenceLock(tx *provautil.Tx, utxoView *UtxoViewpoint,
-	mempool bool) (*SequenceLock, error) {
+func (b *BlockChain) calcSequenceLock(node *blockNode, tx *provautil.Tx,
+	utxoView *UtxoViewpoint, mempool bool) (*SequenceLock, error) {
 
 	mTx := tx.MsgTx()
 
@@ -758,16 +934,13 @@ func (b *BlockChain) calcSequenceLock(tx *provautil.Tx, utxoView *UtxoViewpoint,
 	// sequence locks don't apply to coinbase transactions Therefore, we
 	// return sequence lock values of -1 indicating that this transaction
 	// can be included within a block at any given height or time.
-	// TODO(roasbeef): check version bits state or pass as param
-	// * true should be replaced with a version bits state check
-	sequenceLockActive := mTx.Version >= 2 && (mempool || true)
+	nextHeight := node.height + 1
+	csvActive := b.isDeploymentActive(chaincfg.DeploymentCSV, nextHeight)
+	sequenceLockActive := mTx.Version >= 2 && (mempool || csvActive)
 	if !sequenceLockActive || IsCoinBase(tx) {
 		return sequenceLock, nil
 	}
 
-	// Grab the next height to use for inputs present in the mempool.
-	nextHeight := b.BestSnapshot().Height + 1
-
 	for txInIndex, txIn := range mTx.TxIn {
 		utxo := utxoView.LookupEntry(&txIn.PreviousOutPoint.Hash)
 		if utxo == nil {
@@ -804,8 +977,8 @@ func (b *BlockChain) calcSequenceLock(tx *provautil.Tx, utxoView *UtxoViewpoint,
 			// compute the past median time for the block prior to
 			// the one which included this referenced output.
 			// TODO: caching should be added to keep this speedy
-			inputDepth := uint32(b.bestNode.height-inputHeight) + 1
-			blockNode, err := b.relativeNode(b.bestNode, inputDepth)
+			inputDepth := nextHeight - inputHeight
+			blockNode, err := b.relativeNode(node, inputDepth)
 			if err != nil {
 				return sequenceLock, err
 			}
@@ -967,6 +1140,23 @@ func (b *BlockChain) connectBlock(node *blockNode, block *provautil.Block, utxoV
 	blockSize := uint64(block.MsgBlock().SerializeSize())
 	state := newBestState(node, blockSize, numTxns, curTotalTxns+numTxns,
 		medianTime)
+
+	// Generate the new utxo set statistics in the same manner.
+	b.stateLock.RLock()
+	utxoSetState := b.utxoSetState.clone()
+	b.stateLock.RUnlock()
+	err = utxoSetState.applyBlock(block, stxos, true)
+	if err != nil {
+		return err
+	}
+
+	// The utxo set modifications of the block are accumulated along with
+	// those of the previously connected blocks while the chain is syncing
+	// and written once the batch is full, so outputs which are created and
+	// spent within the batch are never written to the database.
+	writeUtxos := b.utxoBatch.numBlocks+1 >= b.utxoBatchSize ||
+		b.isCurrent(node)
+
 	// Atomically insert info into the database.
 	err = b.db.Update(func(dbTx database.Tx) error {
 		// Update best block state.
@@ -982,12 +1172,17 @@ func (b *BlockChain) connectBlock(node *blockNode, block *provautil.Block, utxoV
 			return err
 		}
 
-		// Update the utxo set using the state of the utxo view.  This
-		// entails removing all of the utxos spent and adding the new
-		// ones created by the block.
-		err = dbPutUtxoView(dbTx, utxoView)
-		if err != nil {
-			return err
+		// Update the utxo set using the state of the utxo view along
+		// with the pending modifications of the previous blocks when
+		// the batch is written.  This entails removing all of the
+		// utxos spent and adding the new ones created by the blocks.
+		// The utxo set statistics are updated along with it.
+		if writeUtxos {
+			err = dbPutUtxoBatch(dbTx, b.utxoBatch, utxoView,
+				utxoSetState, node.hash, node.height)
+			if err != nil {
+				return err
+			}
 		}
 
 		// Update the admin key set using the state of the key view.
@@ -997,6 +1192,16 @@ func (b *BlockChain) connectBlock(node *blockNode, block *provautil.Block, utxoV
 			return err
 		}
 
+		// Store the states of the version rollouts as of the parent of
+		// the block, which the version tally ends at until the block
+		// is added to it below.
+		if t := b.versionTally; t != nil && t.tipHash == *prevHash {
+			err = dbPutVersionTally(dbTx, t, prevHash, node.height-1)
+			if err != nil {
+				return err
+			}
+		}
+
 		// Update the transaction spend journal by adding a record for
 		// the block that contains all txos spent by it.
 		err = dbPutSpendJournalEntry(dbTx, block.Hash(), stxos)
@@ -1020,18 +1225,37 @@ func (b *BlockChain) connectBlock(node *blockNode, block *provautil.Block, utxoV
 		return err
 	}
 
+	// Either clear the pending utxo set modifications now that they have
+	// been committed to the database or add those of the block to them.
+	if writeUtxos {
+		b.utxoBatch.reset()
+	} else {
+		b.utxoBatch.add(utxoView)
+	}
+
 	// Prune fully spent entries and mark all entries in the view unmodified
 	// now that the modifications have been committed to the database.
 	utxoView.commit()
 
 	// Add the new node to the memory main chain indices for faster
-	// lookups.
+	// lookups.  Blocks are fully validated once they are connected.
 	node.inMainChain = true
+	node.status |= statusValid
 	b.index[*node.hash] = node
 	b.depNodes[*prevHash] = append(b.depNodes[*prevHash], node)
 
 	// This node is now the end of the best chain.
 	b.bestNode = node
+	b.metrics.height.Set(int64(node.height))
+	b.metrics.connected.Inc()
+	if b.bestKeyWindow.tip != nil &&
+		b.bestKeyWindow.tip.hash.IsEqual(prevHash) {
+
+		b.bestKeyWindow.push(node)
+	}
+	if err := b.pushVersionTally(node); err != nil {
+		return err
+	}
 
 	// This is now the admin state of the best chain.
 	b.stateLock.Lock()
@@ -1049,23 +1273,25 @@ func (b *BlockChain) connectBlock(node *blockNode, block *provautil.Block, utxoV
 	// comments on the state variable for more details.
 	b.stateLock.Lock()
 	b.stateSnapshot = state
+	b.utxoSetState = utxoSetState
 	b.stateLock.Unlock()
 
 	// Notify the caller that the block was connected to the main chain.
 	// The caller would typically want to react with actions such as
 	// updating wallets.
 	b.chainLock.Unlock()
-	b.sendNotification(NTBlockConnected, block)
+	b.sendNotification(&Notification{Type: NTBlockConnected, Block: block})
 	b.chainLock.Lock()
 
 	return nil
 }
 
 // disconnectBlock handles disconnecting the passed node/block from the end of
-// the main (best) chain.
+// the main (best) chain.  The passed spent txouts are the txos spent by the
+// block as loaded from the spend journal.
 //
 // This function MUST be called with the chain state lock held (for writes).
-func (b *BlockChain) disconnectBlock(node *blockNode, block *provautil.Block, utxoView *UtxoViewpoint, keyView *KeyViewpoint) error {
+func (b *BlockChain) disconnectBlock(node *blockNode, block *provautil.Block, utxoView *UtxoViewpoint, keyView *KeyViewpoint, stxos []spentTxOut) error {
 	// Make sure the node being disconnected is the end of the best chain.
 	if !node.hash.IsEqual(b.bestNode.hash) {
 		return AssertError("disconnectBlock must be called with the " +
@@ -1109,6 +1335,15 @@ func (b *BlockChain) disconnectBlock(node *blockNode, block *provautil.Block, ut
 	state := newBestState(prevNode, blockSize, numTxns, newTotalTxns,
 		medianTime)
 
+	// Generate the new utxo set statistics in the same manner.
+	b.stateLock.RLock()
+	utxoSetState := b.utxoSetState.clone()
+	b.stateLock.RUnlock()
+	err = utxoSetState.applyBlock(block, stxos, false)
+	if err != nil {
+		return err
+	}
+
 	err = b.db.Update(func(dbTx database.Tx) error {
 		// Update best block state.
 		err := dbPutBestState(dbTx, state, node.workSum)
@@ -1123,6 +1358,17 @@ func (b *BlockChain) disconnectBlock(node *blockNode, block *provautil.Block, ut
 			return err
 		}
 
+		// Store the states of the version rollouts as of the parent of
+		// the block, which the version tally ends at once the block is
+		// removed from it below.
+		if t := b.versionTally; t != nil && t.tipHash == *node.hash {
+			err = dbPutVersionTally(dbTx, t, prevNode.hash,
+				prevNode.height)
+			if err != nil {
+				return err
+			}
+		}
+
 		// Remove the block hash and height from the block index which
 		// tracks the main chain.
 		err = dbRemoveBlockIndex(dbTx, block.Hash(), node.height)
@@ -1130,10 +1376,13 @@ func (b *BlockChain) disconnectBlock(node *blockNode, block *provautil.Block, ut
 			return err
 		}
 
-		// Update the utxo set using the state of the utxo view.  This
-		// entails restoring all of the utxos spent and removing the new
-		// ones created by the block.
-		err = dbPutUtxoView(dbTx, utxoView)
+		// Update the utxo set using the state of the utxo view along
+		// with any pending modifications of the previously connected
+		// blocks.  This entails restoring all of the utxos spent and
+		// removing the new ones created by the block.  The utxo set
+		// statistics are updated along with it.
+		err = dbPutUtxoBatch(dbTx, b.utxoBatch, utxoView, utxoSetState,
+			prevNode.hash, prevNode.height)
 		if err != nil {
 			return err
 		}
@@ -1163,6 +1412,7 @@ func (b *BlockChain) disconnectBlock(node *blockNode, block *provautil.Block, ut
 
 	// Prune fully spent entries and mark all entries in the view unmodified
 	// now that the modifications have been committed to the database.
+	b.utxoBatch.reset()
 	utxoView.commit()
 
 	// Mark block as being in a side chain.
@@ -1170,6 +1420,23 @@ func (b *BlockChain) disconnectBlock(node *blockNode, block *provautil.Block, ut
 
 	// This node's parent is now the end of the best chain.
 	b.bestNode = node.parent
+	b.metrics.height.Set(int64(node.parent.height))
+	b.metrics.disconnected.Inc()
+	if b.bestKeyWindow.tip != nil && b.bestKeyWindow.tip.hash.IsEqual(node.hash) {
+		b.bestKeyWindow.pop(node.parent)
+	}
+	if err := b.popVersionTally(node); err != nil {
+		return err
+	}
+
+	// This is now the admin state of the best chain.
+	b.stateLock.Lock()
+	b.threadTips = keyView.ThreadTips()
+	b.totalSupply = keyView.TotalSupply()
+	b.lastKeyID = keyView.LastKeyID()
+	b.adminKeySets = keyView.Keys()
+	b.aspKeyIdMap = keyView.KeyIDs()
+	b.stateLock.Unlock()
 
 	// Update the state for the best block.  Notice how this replaces the
 	// entire struct instead of updating the existing one.  This effectively
@@ -1178,13 +1445,15 @@ func (b *BlockChain) disconnectBlock(node *blockNode, block *provautil.Block, ut
 	// comments on the state variable for more details.
 	b.stateLock.Lock()
 	b.stateSnapshot = state
+	b.utxoSetState = utxoSetState
 	b.stateLock.Unlock()
 
 	// Notify the caller that the block was disconnected from the main
 	// chain.  The caller would typically want to react with actions such as
 	// updating wallets.
 	b.chainLock.Unlock()
-	b.sendNotification(NTBlockDisconnected, block)
+	b.sendNotification(&Notification{Type: NTBlockDisconnected,
+		Block: block})
 	b.chainLock.Lock()
 
 	return nil
@@ -1214,6 +1483,17 @@ func countSpentOutputs(block *provautil.Block) int {
 //
 // This function MUST be called with the chain state lock held (for writes).
 func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List, flags BehaviorFlags) error {
+	// Refuse to reorganize to a branch which is already known to be
+	// invalid before doing any of the work to disconnect the blocks.
+	for e := attachNodes.Front(); e != nil; e = e.Next() {
+		n := e.Value.(*blockNode)
+		if n.status.KnownInvalid() {
+			str := fmt.Sprintf("block %v is part of a branch which "+
+				"contains an invalid block", n.hash)
+			return ruleError(ErrInvalidAncestorBlock, str)
+		}
+	}
+
 	// All of the blocks to detach and related spend journal entries needed
 	// to unspend transaction outputs in the blocks being disconnected must
 	// be loaded from the database during the reorg check phase below and
@@ -1232,12 +1512,7 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List, flags
 	// Disconnecting all of the blocks back to the point of the fork also
 	// entails reverting all admin operations that have happened in these
 	// blocks.
-	keyView := NewKeyViewpoint()
-	keyView.SetThreadTips(b.threadTips)
-	keyView.SetLastKeyID(b.lastKeyID)
-	keyView.SetTotalSupply(b.totalSupply)
-	keyView.SetKeys(b.adminKeySets)
-	keyView.SetKeyIDs(b.aspKeyIdMap)
+	keyView := b.tipKeyView()
 	for e := detachNodes.Front(); e != nil; e = e.Next() {
 		n := e.Value.(*blockNode)
 		var block *provautil.Block
@@ -1252,7 +1527,7 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List, flags
 
 		// Load all of the utxos referenced by the block that aren't
 		// already in the view.
-		err = utxoView.fetchInputUtxos(b.db, block)
+		err = utxoView.fetchInputUtxos(b.db, b.utxoBatch, block)
 		if err != nil {
 			return err
 		}
@@ -1326,6 +1601,11 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List, flags
 		// not needed.
 		err = b.checkConnectBlock(n, block, utxoView, keyView, nil)
 		if err != nil {
+			// Remember blocks which break the rules so the branch
+			// is reported as invalid.
+			if _, ok := err.(RuleError); ok && flags&BFDryRun != BFDryRun {
+				b.markBlockInvalid(n)
+			}
 			return err
 		}
 	}
@@ -1344,6 +1624,15 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List, flags
 	utxoView = NewUtxoViewpoint()
 	utxoView.SetBestHash(b.bestNode.hash)
 
+	// Notify the caller of the reorganization as a whole once all of the
+	// individual blocks have been disconnected and connected and the chain
+	// state reflects the new best chain.  The blocks which did leave and
+	// join the main chain are still reported when a failure stops the
+	// reorganization part way, so the caller is never left waiting for it
+	// to complete.
+	detached, attached := list.New(), list.New()
+	defer b.notifyReorganization(detached, attached)
+
 	// Disconnect blocks from the main chain.
 	for i, e := 0, detachNodes.Front(); e != nil; i, e = i+1, e.Next() {
 		n := e.Value.(*blockNode)
@@ -1351,7 +1640,7 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List, flags
 
 		// Load all of the utxos referenced by the block that aren't
 		// already in the view.
-		err := utxoView.fetchInputUtxos(b.db, block)
+		err := utxoView.fetchInputUtxos(b.db, b.utxoBatch, block)
 		if err != nil {
 			return err
 		}
@@ -1364,10 +1653,12 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List, flags
 		}
 
 		// Update the database and chain state.
-		err = b.disconnectBlock(n, block, utxoView, keyView)
+		err = b.disconnectBlock(n, block, utxoView, keyView,
+			detachSpentTxOuts[i])
 		if err != nil {
 			return err
 		}
+		detached.PushBack(n)
 	}
 
 	// Connect the new best chain blocks.
@@ -1377,7 +1668,7 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List, flags
 
 		// Load all of the utxos referenced by the block that aren't
 		// already in the view.
-		err := utxoView.fetchInputUtxos(b.db, block)
+		err := utxoView.fetchInputUtxos(b.db, b.utxoBatch, block)
 		if err != nil {
 			return err
 		}
@@ -1398,24 +1689,90 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List, flags
 		if err != nil {
 			return err
 		}
+		attached.PushBack(n)
 	}
 
 	// Log the point where the chain forked.
-	firstAttachNode := attachNodes.Front().Value.(*blockNode)
-	forkNode, err := b.getPrevNodeFromNode(firstAttachNode)
-	if err == nil {
-		log.Infof("REORGANIZE: Chain forks at %v", forkNode.hash)
-	}
+	lastDetachNode := detachNodes.Back().Value.(*blockNode)
+	log.Infof("REORGANIZE: Chain forks at %v", lastDetachNode.parentHash)
 
 	// Log the old and new best chain heads.
 	firstDetachNode := detachNodes.Front().Value.(*blockNode)
 	lastAttachNode := attachNodes.Back().Value.(*blockNode)
 	log.Infof("REORGANIZE: Old best chain head was %v", firstDetachNode.hash)
 	log.Infof("REORGANIZE: New best chain head is %v", lastAttachNode.hash)
+	b.metrics.reorgDepth.Observe(float64(detachNodes.Len()))
 
 	return nil
 }
 
+// notifyReorganization notifies the caller that the nodes in the passed detach
+// list were disconnected from the main chain and the ones in the attach list
+// were then connected to it, unless no node was disconnected.  The lists must
+// be in the order used by reorganizeChain.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) notifyReorganization(detachNodes, attachNodes *list.List) {
+	if detachNodes.Len() == 0 {
+		return
+	}
+	reorgData := newReorganizationData(detachNodes, attachNodes)
+	b.chainLock.Unlock()
+	b.sendNotification(&Notification{Type: NTReorganization,
+		Reorganization: reorgData})
+	b.chainLock.Lock()
+}
+
+// checkReorgDepth ensures the reorganization described by the passed lists of
+// nodes to detach from and attach to the main chain, as returned by
+// getReorganizeNodes, does not disconnect more blocks than the maximum
+// reorganization depth.  A side chain which contains a checkpoint always wins
+// since the checkpoints are verified before the blocks are accepted.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) checkReorgDepth(detachNodes, attachNodes *list.List) error {
+	depth := uint32(detachNodes.Len())
+	if b.maxReorgDepth == 0 || depth <= b.maxReorgDepth {
+		return nil
+	}
+
+	for e := attachNodes.Front(); e != nil; e = e.Next() {
+		n := e.Value.(*blockNode)
+		if _, ok := b.checkpointsByHeight[n.height]; ok {
+			return nil
+		}
+	}
+
+	str := fmt.Sprintf("reorganization would disconnect %d blocks from "+
+		"the main chain which exceeds the maximum reorganization "+
+		"depth of %d", depth, b.maxReorgDepth)
+	return ruleError(ErrReorgTooDeep, str)
+}
+
+// FinalizedHeight returns the height of the most recent block of the main chain
+// which can no longer be disconnected by a reorganization.  That is the latest
+// known checkpoint or the block buried under the maximum reorganization depth,
+// whichever is higher.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) FinalizedHeight() (uint32, error) {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	var height uint32
+	if b.maxReorgDepth != 0 && b.bestNode.height > b.maxReorgDepth {
+		height = b.bestNode.height - b.maxReorgDepth
+	}
+	checkpointBlock, err := b.findPreviousCheckpoint()
+	if err != nil {
+		return 0, err
+	}
+	if checkpointBlock != nil && checkpointBlock.Height() > height {
+		height = checkpointBlock.Height()
+	}
+	return height, nil
+}
+
 // connectBestChain handles connecting the passed block to the chain while
 // respecting proper chain selection according to the chain with the most
 // proof of work.  In the typical case, the new block simply extends the main
@@ -1440,6 +1797,8 @@ func (b *BlockChain) connectBestChain(node *blockNode, block *provautil.Block, f
 	// We are extending the main (best) chain with a new block.  This is the
 	// most common case.
 	if node.parentHash.IsEqual(b.bestNode.hash) {
+		start := time.Now()
+
 		// Perform several checks to verify the block can be connected
 		// to the main chain without violating any rules and without
 		// actually connecting the block.
@@ -1450,16 +1809,22 @@ func (b *BlockChain) connectBestChain(node *blockNode, block *provautil.Block, f
 		// The block can only be connected if:
 		// - it is mined by an active validate key.
 		// - all keyIDs used for outputs are provisioned.
-		keyView := NewKeyViewpoint()
-		keyView.SetThreadTips(b.threadTips)
-		keyView.SetLastKeyID(b.lastKeyID)
-		keyView.SetTotalSupply(b.totalSupply)
-		keyView.SetKeys(b.adminKeySets)
-		keyView.SetKeyIDs(b.aspKeyIdMap)
+		keyView := b.tipKeyView()
 		stxos := make([]spentTxOut, 0, countSpentOutputs(block))
 		if !fastAdd {
 			err := b.checkConnectBlock(node, block, utxoView, keyView, &stxos)
 			if err != nil {
+				// Keep blocks which break the rules in the index
+				// so their branch is reported as invalid.
+				if _, ok := err.(RuleError); ok && !dryRun {
+					node.inMainChain = false
+					b.index[*node.hash] = node
+					if node.parent != nil {
+						node.parent.children = append(
+							node.parent.children, node)
+					}
+					b.markBlockInvalid(node)
+				}
 				return false, err
 			}
 		}
@@ -1474,7 +1839,7 @@ func (b *BlockChain) connectBestChain(node *blockNode, block *provautil.Block, f
 		// utxos, spend them, and add the new utxos being created by
 		// this block.
 		if fastAdd {
-			err := utxoView.fetchInputUtxos(b.db, block)
+			err := utxoView.fetchInputUtxos(b.db, b.utxoBatch, block)
 			if err != nil {
 				return false, err
 			}
@@ -1495,6 +1860,7 @@ func (b *BlockChain) connectBestChain(node *blockNode, block *provautil.Block, f
 		if node.parent != nil {
 			node.parent.children = append(node.parent.children, node)
 		}
+		b.metrics.validation.ObserveDuration(time.Since(start))
 
 		return true, nil
 	}
@@ -1508,9 +1874,13 @@ func (b *BlockChain) connectBestChain(node *blockNode, block *provautil.Block, f
 	// index for future processing.
 	b.index[*node.hash] = node
 
-	// Connect the parent node to this node.
+	// Connect the parent node to this node.  Blocks which extend a branch
+	// that is known to be invalid are invalid as well.
 	node.inMainChain = false
 	node.parent.children = append(node.parent.children, node)
+	if node.parent.status.KnownInvalid() {
+		node.status |= statusInvalidAncestor
+	}
 
 	// Disconnect it from the parent node when the function returns when
 	// running in dry run mode.
@@ -1524,9 +1894,18 @@ func (b *BlockChain) connectBestChain(node *blockNode, block *provautil.Block, f
 		}()
 	}
 
+	// Reject blocks which extend a branch that is known to be invalid
+	// regardless of how much work the branch has.  The block is kept in the
+	// index so the branch is reported as invalid.
+	if node.status.KnownInvalid() {
+		str := fmt.Sprintf("block %v extends a branch which contains "+
+			"an invalid block", node.hash)
+		return false, ruleError(ErrInvalidAncestorBlock, str)
+	}
+
 	// We're extending (or creating) a side chain, but the cumulative
 	// work for this new side chain is not enough to make it the new chain.
-	if node.workSum.Cmp(b.bestNode.workSum) <= 0 {
+	if !node.hasMoreWork(b.bestNode) {
 		// Skip Logging info when the dry run flag is set.
 		if dryRun {
 			return false, nil
@@ -1563,6 +1942,16 @@ func (b *BlockChain) connectBestChain(node *blockNode, block *provautil.Block, f
 	// common ancenstor (the point where the chain forked).
 	detachNodes, attachNodes := b.getReorganizeNodes(node)
 
+	// Refuse to reorganize the chain when it would disconnect more blocks
+	// than allowed.
+	if err := b.checkReorgDepth(detachNodes, attachNodes); err != nil {
+		if !dryRun {
+			log.Errorf("REORGANIZE REFUSED: Block %v: %v", node.hash,
+				err)
+		}
+		return false, err
+	}
+
 	// Reorganize the chain.
 	if !dryRun {
 		log.Infof("REORGANIZE: Block %v is causing a reorganize.",
@@ -1587,10 +1976,18 @@ func (b *BlockChain) IsCurrent() bool {
 	b.chainLock.RLock()
 	defer b.chainLock.RUnlock()
 
+	return b.isCurrent(b.bestNode)
+}
+
+// isCurrent returns whether or not the chain believes it is current when the
+// passed node is the best node.  See the IsCurrent documentation for details.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) isCurrent(bestNode *blockNode) bool {
 	// Not current if the latest main (best) chain height is before the
 	// latest known good checkpoint (when checkpoints are enabled).
 	checkpoint := b.LatestCheckpoint()
-	if checkpoint != nil && b.bestNode.height < checkpoint.Height {
+	if checkpoint != nil && bestNode.height < checkpoint.Height {
 		return false
 	}
 
@@ -1600,7 +1997,7 @@ func (b *BlockChain) IsCurrent() bool {
 	// The chain appears to be current if none of the checks reported
 	// otherwise.
 	minus24Hours := b.timeSource.AdjustedTime().Add(-24 * time.Hour).Unix()
-	return b.bestNode.timestamp >= minus24Hours
+	return bestNode.timestamp >= minus24Hours
 }
 
 // BestSnapshot returns information about the current best chain block and
@@ -1615,6 +2012,69 @@ func (b *BlockChain) BestSnapshot() *BestState {
 	return snapshot
 }
 
+// ChainWork returns the total amount of work in the chain up to and including
+// the block identified by the passed hash.  The block must either be part of
+// the main chain or a side chain block which is currently held in memory.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ChainWork(hash *chainhash.Hash) (*big.Int, error) {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	node, err := b.lookupNode(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	// Return a copy so the caller can't modify the work sum of the node.
+	return new(big.Int).Set(node.workSum), nil
+}
+
+// BlockMedianTime returns the median time of the few blocks prior to, and
+// including, the block identified by the passed hash.  The block must either
+// be part of the main chain or a side chain block which is currently held in
+// memory.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) BlockMedianTime(hash *chainhash.Hash) (time.Time, error) {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	node, err := b.lookupNode(hash)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return b.calcPastMedianTime(node)
+}
+
+// lookupNode returns the block node of the block identified by the passed
+// hash.  Main chain blocks which have been pruned from memory are dynamically
+// loaded relative to the best node so their work sums are reconstructed on the
+// way back.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) lookupNode(hash *chainhash.Hash) (*blockNode, error) {
+	if node, ok := b.index[*hash]; ok {
+		return node, nil
+	}
+
+	var height uint32
+	err := b.db.View(func(dbTx database.Tx) error {
+		var err error
+		height, err = dbFetchHeightByHash(dbTx, hash)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if height > b.bestNode.height {
+		str := fmt.Sprintf("block %s is not in the main chain", hash)
+		return nil, errNotInMainChain(str)
+	}
+
+	return b.relativeNode(b.bestNode, b.bestNode.height-height)
+}
+
 // ThreadTips returns information about the best chain block's unspent admin
 // transaction outputs.  These outputs are not consensus critical for the
 // chain, they are redundant to the checked utxos in the utxoview.
@@ -1730,10 +2190,22 @@ type Config struct {
 	// Notification and NotificationType for details on the types and
 	// contents of notifications.
 	//
+	// The callback is invoked synchronously, so block processing waits for
+	// it to return.  It is meant for the owner of the chain which must
+	// update its state, such as the memory pool, before the next block is
+	// processed.  Other consumers should subscribe to the Notifier instead.
+	//
 	// This field can be nil if the caller is not interested in receiving
 	// notifications.
 	Notifications NotificationCallback
 
+	// Notifier defines the notifier to which notifications will be sent
+	// after the callback returned.  It delivers them asynchronously to its
+	// subscribers.
+	//
+	// This field can be nil if there are no subscribers to notify.
+	Notifier *Notifier
+
 	// SigCache defines a signature cache to use when when validating
 	// signatures.  This is typically most useful when individual
 	// transactions are already being validated prior to their inclusion in
@@ -1759,6 +2231,53 @@ type Config struct {
 	// This field can be nil if the caller does not wish to make use of an
 	// index manager.
 	IndexManager IndexManager
+
+	// ScriptWorkers defines the maximum number of goroutines used to
+	// validate the input scripts of a block while connecting it.
+	//
+	// This field can be zero to use the current value of GOMAXPROCS.
+	ScriptWorkers int
+
+	// AssumeValid defines the hash of a block which is assumed to be valid
+	// along with all of its ancestors.  Script validation is skipped for
+	// those blocks once the block has been found on a header chain via
+	// ProcessAssumeValidHeaders.  All other validation, including the
+	// accounting of the unspent transaction outputs, is still performed.
+	//
+	// This field can be nil to always validate scripts.
+	AssumeValid *chainhash.Hash
+
+	// UtxoSnapshots defines the known good snapshots of the unspent
+	// transaction output set.  Snapshots imported via ImportUtxoSnapshot
+	// must match one of them.
+	//
+	// This field can be nil if the caller does not wish to import
+	// snapshots.
+	UtxoSnapshots []chaincfg.UtxoSnapshot
+
+	// MaxReorgDepth defines the maximum number of blocks a reorganization
+	// may disconnect from the main chain.  Side chains which would require
+	// a deeper reorganization are refused even when they have more work,
+	// unless they contain a checkpoint.  Invalidating blocks with
+	// InvalidateBlock is subject to the same limit, so recovering from a
+	// refused reorganization requires restarting with a larger depth.
+	//
+	// This field can be zero to allow reorganizations of any depth.
+	MaxReorgDepth uint32
+
+	// UtxoBatchSize defines the maximum number of blocks whose utxo set
+	// modifications are accumulated in memory and written to the database
+	// together while the chain is not current.  The blocks of a batch
+	// which was not written yet are applied to the utxo set again when the
+	// chain is loaded.
+	//
+	// This field can be zero or one to write the modifications of every
+	// block as it is connected.
+	UtxoBatchSize uint32
+
+	// Metrics defines the optional registry the chain registers its
+	// metrics with.  This can be nil if metrics are not needed.
+	Metrics *metrics.Registry
 }
 
 // New returns a BlockChain instance using the provided configuration details.
@@ -1798,9 +2317,16 @@ func New(config *Config) (*BlockChain, error) {
 		chainParams:         config.ChainParams,
 		timeSource:          config.TimeSource,
 		notifications:       config.Notifications,
+		notifier:            config.Notifier,
 		sigCache:            config.SigCache,
 		hashCache:           config.HashCache,
 		indexManager:        config.IndexManager,
+		scriptWorkers:       config.ScriptWorkers,
+		assumeValid:         config.AssumeValid,
+		utxoSnapshots:       config.UtxoSnapshots,
+		maxReorgDepth:       config.MaxReorgDepth,
+		utxoBatchSize:       int(config.UtxoBatchSize),
+		metrics:             newChainMetrics(config.Metrics),
 		blocksPerRetarget:   int32(config.ChainParams.PowAveragingWindow),
 		minMemoryNodes:      int32(config.ChainParams.PowAveragingWindow),
 		bestNode:            nil,
@@ -1811,8 +2337,11 @@ func New(config *Config) (*BlockChain, error) {
 		aspKeyIdMap:         make(map[btcec.KeyID]*btcec.PublicKey),
 		index:               make(map[chainhash.Hash]*blockNode),
 		depNodes:            make(map[chainhash.Hash][]*blockNode),
+		bestKeyWindow:       newValidateKeyWindow(validateKeyWindowSize(config.ChainParams)),
+		sideKeyWindow:       newValidateKeyWindow(validateKeyWindowSize(config.ChainParams)),
 		orphans:             make(map[chainhash.Hash]*orphanBlock),
 		prevOrphans:         make(map[chainhash.Hash][]*orphanBlock),
+		utxoBatch:           newUtxoBatch(),
 	}
 
 	// Initialize the chain state from the passed database.  When the db
@@ -1830,9 +2359,19 @@ func New(config *Config) (*BlockChain, error) {
 		}
 	}
 
+	b.metrics.height.Set(int64(b.bestNode.height))
+
 	log.Infof("Chain state (height %d, hash %v, totaltx %d, work %v)",
 		b.bestNode.height, b.bestNode.hash, b.stateSnapshot.TotalTxns,
 		b.bestNode.workSum)
+	if b.assumeValid != nil {
+		log.Infof("Assuming block %v and its ancestors are valid once "+
+			"it is found on the header chain", b.assumeValid)
+	}
+	if b.maxReorgDepth != 0 {
+		log.Infof("Refusing reorganizations deeper than %d blocks",
+			b.maxReorgDepth)
+	}
 
 	return &b, nil
 }
@@ -6,11 +6,16 @@
 package blockchain_test
 
 import (
+	"math"
+	"sort"
+	"testing"
+	"time"
+
 	"github.com/bitgo/prova/blockchain"
 	"github.com/bitgo/prova/chaincfg"
 	"github.com/bitgo/prova/chaincfg/chainhash"
 	"github.com/bitgo/prova/provautil"
-	"testing"
+	"github.com/bitgo/prova/wire"
 )
 
 // TestHaveBlock tests the HaveBlock API to ensure proper functionality.
@@ -107,3 +112,340 @@ func TestHaveBlock(t *testing.T) {
 		}
 	}
 }
+
+// TestMalformedOrphan ensures blocks whose parents are unknown are rejected
+// right away instead of being added to the orphan pool when they are malformed.
+func TestMalformedOrphan(t *testing.T) {
+	chain, teardownFunc, err := chainSetup("malformedorphan",
+		&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	msgBlock := SomeBlock
+	msgBlock.Header.MerkleRoot = chainhash.Hash{}
+	block := provautil.NewBlock(&msgBlock)
+	_, isOrphan, err := chain.ProcessBlock(block, blockchain.BFNone)
+	if _, ok := err.(blockchain.RuleError); !ok {
+		t.Fatalf("ProcessBlock: got error %v, want rule error", err)
+	}
+	if isOrphan || chain.IsKnownOrphan(block.Hash()) {
+		t.Fatal("ProcessBlock: malformed block added as an orphan")
+	}
+
+	// The well-formed block is added to the orphan pool.
+	block = provautil.NewBlock(&SomeBlock)
+	_, isOrphan, err = chain.ProcessBlock(block, blockchain.BFNone)
+	if err != nil {
+		t.Fatalf("ProcessBlock: unexpected error: %v", err)
+	}
+	if !isOrphan || !chain.IsKnownOrphan(block.Hash()) {
+		t.Fatal("ProcessBlock: block not added as an orphan")
+	}
+}
+
+// TestChainWork tests the ChainWork API to ensure proper functionality.
+func TestChainWork(t *testing.T) {
+	chain, teardownFunc, err := chainSetup("chainwork",
+		&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	// The work of the chain at the genesis block is the work of the
+	// genesis block itself.
+	genesis := chaincfg.MainNetParams.GenesisBlock
+	work, err := chain.ChainWork(chaincfg.MainNetParams.GenesisHash)
+	if err != nil {
+		t.Fatalf("ChainWork: unexpected error: %v", err)
+	}
+	want := blockchain.CalcWork(genesis.Header.Bits)
+	if work.Cmp(want) != 0 {
+		t.Fatalf("ChainWork: unexpected work -- got %v, want %v", work,
+			want)
+	}
+
+	// The returned value must be a copy.
+	work.SetInt64(0)
+	work, err = chain.ChainWork(chaincfg.MainNetParams.GenesisHash)
+	if err != nil {
+		t.Fatalf("ChainWork: unexpected error: %v", err)
+	}
+	if work.Cmp(want) != 0 {
+		t.Fatalf("ChainWork: work was modified through returned value")
+	}
+
+	// Unknown blocks must return an error.
+	if _, err := chain.ChainWork(&chainhash.Hash{0x01}); err == nil {
+		t.Fatalf("ChainWork: expected error for unknown block")
+	}
+}
+
+// testMedianTime returns the past median time of the block at the passed height
+// of the chain formed by the regression test genesis block and the passed
+// blocks.
+func testMedianTime(blocks []*wire.MsgBlock, height uint32) time.Time {
+	timestamps := make([]int64, 0, 11)
+	for h := int64(height); h >= 0 && h > int64(height)-11; h-- {
+		header := &chaincfg.RegressionNetParams.GenesisBlock.Header
+		if h > 0 {
+			header = &blocks[h-1].Header
+		}
+		timestamps = append(timestamps, header.Timestamp.Unix())
+	}
+	sort.Slice(timestamps, func(i, j int) bool {
+		return timestamps[i] < timestamps[j]
+	})
+	return time.Unix(timestamps[len(timestamps)/2], 0)
+}
+
+// TestCalcSequenceLock ensures the relative lock-times calculated for height
+// and time based sequence locks, as well as disabled ones, are correct for both
+// confirmed and unconfirmed inputs, and that they are only calculated once the
+// CSV deployment is active unless they are requested for the mempool.
+func TestCalcSequenceLock(t *testing.T) {
+	blocks := linearTestBlocks(t)
+	const tipHeight = 20
+	if len(blocks) < tipHeight {
+		t.Fatalf("not enough test blocks - got %d", len(blocks))
+	}
+
+	// Create a chain where the CSV deployment becomes active with the
+	// block after the next one.
+	params := chaincfg.RegressionNetParams
+	params.Deployments[chaincfg.DeploymentCSV].ActivationHeight = tipHeight + 2
+	chain, teardownFunc, err := chainSetup("calcsequencelock", &params)
+	if err != nil {
+		t.Fatalf("failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+	processTestBlocks(t, "calcsequencelock", chain, blocks[:tipHeight])
+
+	// Create a view with an output confirmed at a known height and one
+	// which is still unconfirmed in the mempool.
+	const confirmedHeight = 10
+	newOriginTx := func(value int64) *provautil.Tx {
+		tx := wire.NewMsgTx(wire.TxVersion)
+		tx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: wire.MaxPrevOutIndex},
+			nil))
+		tx.AddTxOut(wire.NewTxOut(value, []byte{0x51}))
+		return provautil.NewTx(tx)
+	}
+	confirmedTx := newOriginTx(1000)
+	unconfirmedTx := newOriginTx(2000)
+	view := blockchain.NewUtxoViewpoint()
+	view.AddTxOuts(confirmedTx, confirmedHeight)
+	view.AddTxOuts(unconfirmedTx, 0x7fffffff)
+
+	confirmedMedianTime := testMedianTime(blocks, confirmedHeight-1).Unix()
+	bestMedianTime := chain.BestSnapshot().MedianTime.Unix()
+	noLock := blockchain.SequenceLock{Seconds: -1, BlockHeight: -1}
+	tests := []struct {
+		name        string
+		version     int32
+		sequence    uint32
+		unconfirmed bool
+		want        blockchain.SequenceLock
+	}{
+		{
+			name:     "version 1 transaction",
+			version:  1,
+			sequence: blockchain.LockTimeToSequence(false, 3),
+			want:     noLock,
+		},
+		{
+			name: "disabled relative lock-time",
+			sequence: wire.SequenceLockTimeDisabled |
+				blockchain.LockTimeToSequence(false, 3),
+			version: 2,
+			want:    noLock,
+		},
+		{
+			name:     "height based lock",
+			version:  2,
+			sequence: blockchain.LockTimeToSequence(false, 3),
+			want: blockchain.SequenceLock{
+				Seconds:     -1,
+				BlockHeight: confirmedHeight + 2,
+			},
+		},
+		{
+			name:     "time based lock",
+			version:  2,
+			sequence: blockchain.LockTimeToSequence(true, 1024),
+			want: blockchain.SequenceLock{
+				Seconds:     confirmedMedianTime + 1023,
+				BlockHeight: -1,
+			},
+		},
+		{
+			name:        "unconfirmed height based lock",
+			version:     2,
+			sequence:    blockchain.LockTimeToSequence(false, 3),
+			unconfirmed: true,
+			want: blockchain.SequenceLock{
+				Seconds:     -1,
+				BlockHeight: tipHeight + 3,
+			},
+		},
+		{
+			name:        "unconfirmed time based lock",
+			version:     2,
+			sequence:    blockchain.LockTimeToSequence(true, 1024),
+			unconfirmed: true,
+			want: blockchain.SequenceLock{
+				Seconds:     bestMedianTime + 1023,
+				BlockHeight: -1,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		origin := confirmedTx
+		if test.unconfirmed {
+			origin = unconfirmedTx
+		}
+		msgTx := wire.NewMsgTx(test.version)
+		msgTx.AddTxIn(&wire.TxIn{
+			PreviousOutPoint: wire.OutPoint{Hash: *origin.Hash()},
+			Sequence:         test.sequence,
+		})
+		msgTx.AddTxOut(wire.NewTxOut(900, []byte{0x51}))
+		tx := provautil.NewTx(msgTx)
+
+		// The deployment is not active for the next block yet, so the
+		// lock only applies to the mempool.
+		lock, err := chain.CalcSequenceLock(tx, view, false)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+		if *lock != noLock {
+			t.Fatalf("%s: unexpected lock before activation - got "+
+				"%+v, want %+v", test.name, *lock, noLock)
+		}
+		lock, err = chain.CalcSequenceLock(tx, view, true)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+		if *lock != test.want {
+			t.Fatalf("%s: mismatched lock - got %+v, want %+v",
+				test.name, *lock, test.want)
+		}
+	}
+
+	// Ensure the lock is calculated for blocks once the deployment is
+	// active for the next block.
+	processTestBlocks(t, "calcsequencelock", chain,
+		blocks[tipHeight:tipHeight+1])
+	msgTx := wire.NewMsgTx(2)
+	msgTx.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Hash: *confirmedTx.Hash()},
+		Sequence:         blockchain.LockTimeToSequence(false, 3),
+	})
+	msgTx.AddTxOut(wire.NewTxOut(900, []byte{0x51}))
+	lock, err := chain.CalcSequenceLock(provautil.NewTx(msgTx), view, false)
+	if err != nil {
+		t.Fatalf("unexpected error after activation: %v", err)
+	}
+	want := blockchain.SequenceLock{Seconds: -1, BlockHeight: confirmedHeight + 2}
+	if *lock != want {
+		t.Fatalf("mismatched lock after activation - got %+v, want %+v",
+			*lock, want)
+	}
+}
+
+// testCSVActivation ensures a block where the transaction with a signature
+// script of the test chain is modified by the passed function is only rejected
+// as containing an unfinalized transaction once the CSV deployment is active.
+// Scripts are not validated, so the signature does not need to be updated.
+func testCSVActivation(t *testing.T, dbName string, modify func(tx *wire.MsgTx, header *wire.BlockHeader)) {
+	blocks, signedIdx := assumeValidTestBlocks(t)
+
+	signedBlock := blocks[signedIdx]
+	lockedBlock := *signedBlock
+	lockedBlock.Transactions = make([]*wire.MsgTx, len(signedBlock.Transactions))
+	copy(lockedBlock.Transactions, signedBlock.Transactions)
+	lockedTx := signedBlock.Transactions[1].Copy()
+	modify(lockedTx, &lockedBlock.Header)
+	lockedBlock.Transactions[1] = lockedTx
+	resignBlock(t, &lockedBlock)
+	height := lockedBlock.Header.Height
+
+	tests := []struct {
+		name             string
+		activationHeight uint32
+		valid            bool
+	}{
+		{
+			name:             "not scheduled",
+			activationHeight: math.MaxUint32,
+			valid:            true,
+		},
+		{
+			name:             "active after block",
+			activationHeight: height + 1,
+			valid:            true,
+		},
+		{
+			name:             "active at block",
+			activationHeight: height,
+			valid:            false,
+		},
+		{
+			name:             "active before block",
+			activationHeight: 1,
+			valid:            false,
+		},
+	}
+
+	for _, test := range tests {
+		params := chaincfg.RegressionNetParams
+		params.Deployments[chaincfg.DeploymentCSV].ActivationHeight =
+			test.activationHeight
+		chain, teardownFunc, err := chainSetup(dbName, &params)
+		if err != nil {
+			t.Fatalf("%s: failed to setup chain instance: %v",
+				test.name, err)
+		}
+		chain.DisableVerify(true)
+		for _, block := range blocks[:signedIdx] {
+			_, _, err := chain.ProcessBlock(provautil.NewBlock(block),
+				blockchain.BFNone)
+			if err != nil {
+				teardownFunc()
+				t.Fatalf("%s: unexpected error processing block "+
+					"%v: %v", test.name, block.BlockHash(), err)
+			}
+		}
+
+		_, _, err = chain.ProcessBlock(provautil.NewBlock(&lockedBlock),
+			blockchain.BFNone)
+		teardownFunc()
+		if test.valid {
+			if err != nil {
+				t.Fatalf("%s: unexpected error processing block "+
+					"with locked transaction: %v", test.name, err)
+			}
+			continue
+		}
+		rerr, ok := err.(blockchain.RuleError)
+		if !ok || rerr.ErrorCode != blockchain.ErrUnfinalizedTx {
+			t.Fatalf("%s: did not receive expected unfinalized "+
+				"transaction error - got %v", test.name, err)
+		}
+	}
+}
+
+// TestSequenceLockActivation ensures blocks containing transactions whose
+// sequence locks are not met are only rejected once the CSV deployment is
+// active.
+func TestSequenceLockActivation(t *testing.T) {
+	testCSVActivation(t, "sequencelockactivation",
+		func(tx *wire.MsgTx, header *wire.BlockHeader) {
+			tx.Version = 2
+			tx.TxIn[0].Sequence = blockchain.LockTimeToSequence(false,
+				1000)
+		})
+}
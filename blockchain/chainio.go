@@ -10,6 +10,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/chaincfg"
 	"github.com/bitgo/prova/chaincfg/chainhash"
 	"github.com/bitgo/prova/database"
 	"github.com/bitgo/prova/provautil"
@@ -40,10 +41,28 @@ var (
 	// unspent transaction output set.
 	utxoSetBucketName = []byte("utxoset")
 
+	// utxoSetStateKeyName is the name of the db key used to store the
+	// incrementally updated utxo set statistics.
+	utxoSetStateKeyName = []byte("utxosetstate")
+
+	// utxoSnapshotBaseKeyName is the name of the db key used to store the
+	// hash and height of the block the chain state was imported from via
+	// a utxo set snapshot.
+	utxoSnapshotBaseKeyName = []byte("utxosnapshotbase")
+
+	// versionTallyKeyName is the name of the db key used to store the
+	// states of the version rollouts along with the block they were
+	// tallied up to.
+	versionTallyKeyName = []byte("versiontally")
+
 	// keySetBucketName is the name of the db bucket used to house the
 	// admin key sets.
 	keySetBucketName = []byte("keyset")
 
+	// invalidBlocksBucketName is the name of the db bucket used to house
+	// the hashes of the blocks which were invalidated manually.
+	invalidBlocksBucketName = []byte("invalidblocks")
+
 	// byteOrder is the preferred byte order used for serializing numeric
 	// fields for storage in the database.
 	byteOrder = binary.LittleEndian
@@ -816,50 +835,6 @@ func dbFetchUtxoEntry(dbTx database.Tx, hash *chainhash.Hash) (*UtxoEntry, error
 	return entry, nil
 }
 
-// dbPutUtxoView uses an existing database transaction to update the utxo set
-// in the database based on the provided utxo view contents and state.  In
-// particular, only the entries that have been marked as modified are written
-// to the database.
-func dbPutUtxoView(dbTx database.Tx, view *UtxoViewpoint) error {
-	utxoBucket := dbTx.Metadata().Bucket(utxoSetBucketName)
-	for txHashIter, entry := range view.entries {
-		// No need to update the database if the entry was not modified.
-		if entry == nil || !entry.modified {
-			continue
-		}
-
-		// Serialize the utxo entry without any entries that have been
-		// spent.
-		serialized, err := serializeUtxoEntry(entry)
-		if err != nil {
-			return err
-		}
-
-		// Make a copy of the hash because the iterator changes on each
-		// loop iteration and thus slicing it directly would cause the
-		// data to change out from under the put/delete funcs below.
-		txHash := txHashIter
-
-		// Remove the utxo entry if it is now fully spent.
-		if serialized == nil {
-			if err := utxoBucket.Delete(txHash[:]); err != nil {
-				return err
-			}
-
-			continue
-		}
-
-		// At this point the utxo entry is not fully spent, so store its
-		// serialization in the database.
-		err = utxoBucket.Put(txHash[:], serialized)
-		if err != nil {
-			return err
-		}
-	}
-
-	return nil
-}
-
 // -----------------------------------------------------------------------------
 // The block index consists of two buckets with an entry for every block in the
 // main chain.  One bucket is for the hash to height mapping and the other is
@@ -1267,6 +1242,50 @@ func dbPutBestState(dbTx database.Tx, snapshot *BestState, workSum *big.Int) err
 	return dbTx.Metadata().Put(chainStateKeyName, serializedData)
 }
 
+// genesisKeyView returns a new key viewpoint holding the admin state after the
+// passed genesis block of the passed network.  The admin thread tips are the
+// outputs of the genesis coinbase and the last key id is the highest key id of
+// the initial ASP keys.
+func genesisKeyView(genesisBlock *provautil.Block, params *chaincfg.Params) *KeyViewpoint {
+	coinbaseHash := genesisBlock.Transactions()[0].Hash()
+	keyView := NewKeyViewpoint()
+	keyView.SetKeys(params.AdminKeySets)
+	keyView.SetKeyIDs(params.ASPKeyIdMap)
+	keyView.SetThreadTips(map[provautil.ThreadID]*wire.OutPoint{
+		provautil.RootThread:      wire.NewOutPoint(coinbaseHash, 0),
+		provautil.ProvisionThread: wire.NewOutPoint(coinbaseHash, 1),
+		provautil.IssueThread:     wire.NewOutPoint(coinbaseHash, 2),
+	})
+
+	// Set the last key id to the highest key id in the asp key map.
+	var lastKeyID btcec.KeyID
+	for keyID := range params.ASPKeyIdMap {
+		if keyID > lastKeyID {
+			lastKeyID = keyID
+		}
+	}
+	keyView.SetLastKeyID(lastKeyID)
+	return keyView
+}
+
+// genesisUtxoSet returns a utxo view holding the utxos of the passed genesis
+// block along with the utxo set statistics after it.
+//
+// !!! NOTICE:
+// Unlike in Bitcoin, the genesis coinbase outputs are added to the utxo set
+// since they are the initial admin thread tips, so they are spendable.
+func genesisUtxoSet(genesisBlock *provautil.Block) (*UtxoViewpoint, *utxoSetState, error) {
+	utxoView := NewUtxoViewpoint()
+	utxoView.SetBestHash(genesisBlock.Hash())
+	utxoView.connectTransaction(genesisBlock.Transactions()[0], 0, nil)
+
+	state := newUtxoSetState()
+	if err := state.applyBlock(genesisBlock, nil, true); err != nil {
+		return nil, nil, err
+	}
+	return utxoView, state, nil
+}
+
 // createChainState initializes both the database and the chain state to the
 // genesis block.  This includes creating the necessary buckets and inserting
 // the genesis block, so it must only be called on an uninitialized database.
@@ -1276,6 +1295,7 @@ func (b *BlockChain) createChainState() error {
 	header := &genesisBlock.MsgBlock().Header
 	node := newBlockNode(header, genesisBlock.Hash())
 	node.inMainChain = true
+	node.status = statusValid
 	b.bestNode = node
 
 	// Add the new node to the index which is used for faster lookups.
@@ -1288,36 +1308,22 @@ func (b *BlockChain) createChainState() error {
 	b.stateSnapshot = newBestState(b.bestNode, blockSize, numTxns, numTxns,
 		time.Unix(b.bestNode.timestamp, 0))
 
-	b.adminKeySets = b.chainParams.AdminKeySets
-	b.aspKeyIdMap = b.chainParams.ASPKeyIdMap
-
-	// Initiate the utxo set with the admin thread tips from the genesis
-	// coinbase.
-	// !!! NOTICE:
-	// Unlike in Bitcoin, the genesis coinbase outputs will be spendable
-	// because of these lines of code.
-	utxoView := NewUtxoViewpoint()
-	utxoView.SetBestHash(genesisBlock.Hash())
-	var stxos *[]spentTxOut
-	utxoView.connectTransaction(genesisBlock.Transactions()[0], 0, stxos)
-
-	// Initiate admin thread tips
-	b.threadTips[provautil.RootThread] = wire.NewOutPoint(genesisBlock.Transactions()[0].Hash(), 0)
-	b.threadTips[provautil.ProvisionThread] = wire.NewOutPoint(genesisBlock.Transactions()[0].Hash(), 1)
-	b.threadTips[provautil.IssueThread] = wire.NewOutPoint(genesisBlock.Transactions()[0].Hash(), 2)
-
-	// Set the last key id to the highest key id in the wsp key map.
-	var lastKeyID btcec.KeyID
-	for keyID := range b.aspKeyIdMap {
-		if keyID > lastKeyID {
-			lastKeyID = keyID
-		}
+	// Initialize the admin state and the utxo set along with its
+	// statistics with the admin thread tips from the genesis coinbase.
+	keyView := genesisKeyView(genesisBlock, b.chainParams)
+	b.adminKeySets = keyView.Keys()
+	b.aspKeyIdMap = keyView.KeyIDs()
+	b.threadTips = keyView.ThreadTips()
+	b.lastKeyID = keyView.LastKeyID()
+	utxoView, utxoSetState, err := genesisUtxoSet(genesisBlock)
+	if err != nil {
+		return err
 	}
-	b.lastKeyID = btcec.KeyID(lastKeyID)
+	b.utxoSetState = utxoSetState
 
 	// Create the initial the database chain state including creating the
 	// necessary index buckets and inserting the genesis block.
-	err := b.db.Update(func(dbTx database.Tx) error {
+	err = b.db.Update(func(dbTx database.Tx) error {
 		// Create the bucket that houses the chain block hash to height
 		// index.
 		meta := dbTx.Metadata()
@@ -1344,8 +1350,17 @@ func (b *BlockChain) createChainState() error {
 		if err != nil {
 			return err
 		}
-		// Add the utxos of the genesis block (admin thread tips) to db.
-		err = dbPutUtxoView(dbTx, utxoView)
+		// Add the utxos of the genesis block (admin thread tips) to db
+		// along with their statistics.
+		err = dbPutUtxoBatch(dbTx, newUtxoBatch(), utxoView,
+			b.utxoSetState, b.bestNode.hash, b.bestNode.height)
+		if err != nil {
+			return err
+		}
+
+		// Store the current chain version since the chain state is
+		// created in the latest format.
+		err = dbPutChainVersion(dbTx, currentChainVersion)
 		if err != nil {
 			return err
 		}
@@ -1379,9 +1394,23 @@ func (b *BlockChain) createChainState() error {
 // database.  When the db does not yet contain any chain state, both it and the
 // chain state are initialized to the genesis block.
 func (b *BlockChain) initChainState() error {
+	// Migrate the chain state in the database to the current version
+	// before it is loaded.  This also refuses to load a chain state which
+	// was written by newer software.
+	err := runMigrations(b.db, chainMigrations, migrationBatchSize)
+	if err != nil {
+		return err
+	}
+
+	// Roll the chain state back to the last stored block when the data of
+	// the best blocks was lost.
+	if err := b.rollBackToStoredBlock(); err != nil {
+		return err
+	}
+
 	// Attempt to load the chain state from the database.
 	var isStateInitialized bool
-	err := b.db.View(func(dbTx database.Tx) error {
+	err = b.db.View(func(dbTx database.Tx) error {
 		// Fetch the stored chain state from the database metadata.
 		// When it doesn't exist, it means the database hasn't been
 		// initialized for use with chain yet, so break out now to allow
@@ -1425,6 +1454,7 @@ func (b *BlockChain) initChainState() error {
 		header.Height = uint32(state.height)
 		node := newBlockNode(header, &state.hash)
 		node.inMainChain = true
+		node.status = statusValid
 		node.workSum = state.workSum
 		b.bestNode = node
 
@@ -1459,14 +1489,186 @@ func (b *BlockChain) initChainState() error {
 		return err
 	}
 
-	// There is nothing more to do if the chain state was initialized.
+	// Bring the utxo set up to date with the best block, load its
+	// statistics and tally the versions of the blocks if the chain state
+	// was initialized as there is nothing more to do.
 	if isStateInitialized {
-		return nil
+		if err := b.replayUtxoSet(); err != nil {
+			return err
+		}
+		if err := b.initUtxoSetState(); err != nil {
+			return err
+		}
+		return b.initVersionTally()
 	}
 
 	// At this point the database has not already been initialized, so
 	// initialize both it and the chain state to the genesis block.
-	return b.createChainState()
+	if err := b.createChainState(); err != nil {
+		return err
+	}
+	return b.initVersionTally()
+}
+
+// dbFetchLastStoredBlock uses an existing database transaction to find the last
+// block of the main chain up to the passed height whose data is still stored.
+// The database removes the most recently stored blocks when it detects their
+// block data was lost.
+func dbFetchLastStoredBlock(dbTx database.Tx, height uint32) (*chainhash.Hash, uint32, error) {
+	for {
+		hash, err := dbFetchHashByHeight(dbTx, height)
+		if err != nil {
+			return nil, 0, err
+		}
+		hasBlock, err := dbTx.HasBlock(hash)
+		if err != nil {
+			return nil, 0, err
+		}
+		if hasBlock || height == 0 {
+			return hash, height, nil
+		}
+		height--
+	}
+}
+
+// rollBackToStoredBlock rolls the chain state back to the last block of the
+// main chain whose data is still stored when the data of the best blocks was
+// lost.  Disconnecting a block requires its data, so the admin state is rebuilt
+// by connecting the stored blocks from the genesis block again instead, and the
+// utxo set is reset to the genesis block so it is brought up to date by
+// replaying the stored blocks once the chain state is loaded.  The missing
+// blocks are then downloaded again like any other block.
+func (b *BlockChain) rollBackToStoredBlock() error {
+	var state bestChainState
+	var hash *chainhash.Hash
+	var height uint32
+	err := b.db.View(func(dbTx database.Tx) error {
+		serializedData := dbTx.Metadata().Get(chainStateKeyName)
+		if serializedData == nil {
+			return nil
+		}
+		var err error
+		state, err = deserializeBestChainState(serializedData)
+		if err != nil {
+			return err
+		}
+		hasBlock, err := dbTx.HasBlock(&state.hash)
+		if err != nil || hasBlock {
+			return err
+		}
+		hash, height, err = dbFetchLastStoredBlock(dbTx, state.height)
+		return err
+	})
+	if err != nil || hash == nil {
+		return err
+	}
+
+	log.Warnf("The data of the main chain blocks after height %d up to "+
+		"the best block %v (height %d) is missing from the database -- "+
+		"rolling the chain state back to block %v", height, state.hash,
+		state.height, hash)
+
+	// Rebuild the admin state, the work sum and the number of transactions
+	// of the chain up to the last stored block.
+	genesisBlock := provautil.NewBlock(b.chainParams.GenesisBlock)
+	keyView := genesisKeyView(genesisBlock, b.chainParams)
+	workSum := CalcWork(genesisBlock.MsgBlock().Header.Bits)
+	totalTxns := uint64(len(genesisBlock.Transactions()))
+	for blockHeight := uint32(1); blockHeight <= height; blockHeight++ {
+		var block *provautil.Block
+		err := b.db.View(func(dbTx database.Tx) error {
+			var err error
+			block, err = dbFetchBlockByHeight(dbTx, blockHeight)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		keyView.connectTransactions(block)
+		workSum.Add(workSum, CalcWork(block.MsgBlock().Header.Bits))
+		totalTxns += uint64(len(block.Transactions()))
+	}
+
+	// Remove the utxo set.  Removing all of its entries in a single
+	// database transaction would use a massive amount of memory, so a
+	// maximum number of entries is removed at a time.
+	for numDeleted := migrationBatchSize; numDeleted == migrationBatchSize; {
+		numDeleted = 0
+		err := b.db.Update(func(dbTx database.Tx) error {
+			cursor := dbTx.Metadata().Bucket(utxoSetBucketName).Cursor()
+			for ok := cursor.First(); ok && numDeleted <
+				migrationBatchSize; ok = cursor.Next() {
+
+				if err := cursor.Delete(); err != nil {
+					return err
+				}
+				numDeleted++
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	utxoView, utxoSetState, err := genesisUtxoSet(genesisBlock)
+	if err != nil {
+		return err
+	}
+	return b.db.Update(func(dbTx database.Tx) error {
+		// Reset the utxo set to the utxos of the genesis block.
+		err := dbPutUtxoBatch(dbTx, newUtxoBatch(), utxoView,
+			utxoSetState, genesisBlock.Hash(), 0)
+		if err != nil {
+			return err
+		}
+
+		// Remove the missing blocks from the main chain.
+		for blockHeight := height + 1; blockHeight <= state.height; blockHeight++ {
+			blockHash, err := dbFetchHashByHeight(dbTx, blockHeight)
+			if err != nil {
+				return err
+			}
+			err = dbRemoveBlockIndex(dbTx, blockHash, blockHeight)
+			if err != nil {
+				return err
+			}
+			err = dbRemoveSpendJournalEntry(dbTx, blockHash)
+			if err != nil {
+				return err
+			}
+		}
+
+		// Store the chain state of the last stored block.
+		err = dbPutBestState(dbTx, &BestState{Hash: hash, Height: height,
+			TotalTxns: totalTxns}, workSum)
+		if err != nil {
+			return err
+		}
+		return dbPutKeySet(dbTx, keyView.Keys(), keyView.KeyIDs(),
+			keyView.ThreadTips(), keyView.LastKeyID(),
+			keyView.TotalSupply())
+	})
+}
+
+// dbPutInvalidBlock uses an existing database transaction to record the block
+// with the passed hash as invalidated manually.  The bucket is created on
+// demand since it is only needed once a block is invalidated.
+func dbPutInvalidBlock(dbTx database.Tx, hash *chainhash.Hash) error {
+	bucket, err := dbTx.Metadata().CreateBucketIfNotExists(
+		invalidBlocksBucketName)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(hash[:], []byte{})
+}
+
+// dbIsInvalidBlock uses an existing database transaction to determine whether
+// the block with the passed hash was invalidated manually.
+func dbIsInvalidBlock(dbTx database.Tx, hash *chainhash.Hash) bool {
+	bucket := dbTx.Metadata().Bucket(invalidBlocksBucketName)
+	return bucket != nil && bucket.Get(hash[:]) != nil
 }
 
 // dbFetchHeaderByHash uses an existing database transaction to retrieve the
@@ -9,11 +9,15 @@ import (
 	"bytes"
 	"errors"
 	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/chaincfg"
 	"github.com/bitgo/prova/chaincfg/chainhash"
 	"github.com/bitgo/prova/database"
+	_ "github.com/bitgo/prova/database/ffldb"
 	"github.com/bitgo/prova/provautil"
 	"github.com/bitgo/prova/wire"
+	"io/ioutil"
 	"math/big"
+	"os"
 	"reflect"
 	"testing"
 )
@@ -1100,6 +1104,78 @@ func TestKeySetSerialization(t *testing.T) {
 	}
 }
 
+// TestVersionTallySerialization ensures the states of the version rollouts
+// survive a round trip through their serialization, leave out the transitions
+// after the block they are stored for, and that corrupt data is rejected.
+func TestVersionTallySerialization(t *testing.T) {
+	t.Parallel()
+
+	// Enforce the first two rollouts and then fall back, which results in
+	// transitions to enforced, active and enforced again for them.
+	params := &chaincfg.SimNetParams
+	tally := newVersionTally(params)
+	var hash chainhash.Hash
+	for height := uint32(0); height < 127; height++ {
+		version := uint32(3)
+		if height == 0 || height > 100 {
+			version = 1
+		}
+		hash = chainhash.Hash{byte(height), byte(height >> 8)}
+		tally.push(&hash, height, version, params)
+	}
+	if n := len(tally.rollouts[0].transitions); n != 3 {
+		t.Fatalf("got %d transitions, want 3", n)
+	}
+
+	stored, err := deserializeVersionTally(serializeVersionTally(tally,
+		&hash, tally.tipHeight))
+	if err != nil {
+		t.Fatalf("deserializeVersionTally: unexpected error: %v", err)
+	}
+	if stored.tipHash != hash || stored.tipHeight != tally.tipHeight ||
+		stored.partial {
+
+		t.Fatalf("deserializeVersionTally: got tip %v (height %d, "+
+			"partial %v), want %v (height %d)", stored.tipHash,
+			stored.tipHeight, stored.partial, hash, tally.tipHeight)
+	}
+	for i := range tally.rollouts {
+		want := tally.rollouts[i].transitions
+		if len(want) == 0 {
+			want = []rolloutTransition{}
+		}
+		if !reflect.DeepEqual(stored.rollouts[i], want) {
+			t.Fatalf("deserializeVersionTally: rollout %d: got "+
+				"transitions %v, want %v", i, stored.rollouts[i],
+				want)
+		}
+	}
+
+	// The last transition is the one of the block after the tip, so it is
+	// left out of the states as of the parent of the tip.
+	parentHash := chainhash.Hash{0x01}
+	serialized := serializeVersionTally(tally, &parentHash,
+		tally.tipHeight-1)
+	stored, err = deserializeVersionTally(serialized)
+	if err != nil {
+		t.Fatalf("deserializeVersionTally: unexpected error: %v", err)
+	}
+	want := tally.rollouts[0].transitions[:2]
+	if stored.tipHash != parentHash || stored.tipHeight != tally.tipHeight-1 ||
+		!reflect.DeepEqual(stored.rollouts[0], want) {
+
+		t.Fatalf("deserializeVersionTally: got %+v, want transitions %v "+
+			"as of the parent", stored, want)
+	}
+
+	// Ensure truncated data is rejected.
+	_, err = deserializeVersionTally(serialized[:len(serialized)-1])
+	if err == nil {
+		t.Fatalf("deserializeVersionTally: did not receive expected " +
+			"error for truncated data")
+	}
+}
+
 // TestBestChainStateDeserializeErrors performs negative tests against
 // deserializing the chain state to ensure error paths work as expected.
 func TestBestChainStateDeserializeErrors(t *testing.T) {
@@ -1148,3 +1224,65 @@ func TestBestChainStateDeserializeErrors(t *testing.T) {
 		}
 	}
 }
+
+// TestFetchLastStoredBlock ensures the last main chain block which is still
+// stored is found when the best blocks were removed from the database.
+func TestFetchLastStoredBlock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkbestblockstored")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	params := chaincfg.RegressionNetParams
+	db, err := database.Create("ffldb", dir, params.Net)
+	if err != nil {
+		t.Fatalf("unable to create database: %v", err)
+	}
+	defer db.Close()
+
+	// Store the genesis block along with a main chain of two more blocks
+	// which are not stored.
+	genesis := provautil.NewBlock(params.GenesisBlock)
+	hashes := []chainhash.Hash{*genesis.Hash(), {0x01}, {0x02}}
+	err = db.Update(func(dbTx database.Tx) error {
+		meta := dbTx.Metadata()
+		if _, err := meta.CreateBucket(hashIndexBucketName); err != nil {
+			return err
+		}
+		if _, err := meta.CreateBucket(heightIndexBucketName); err != nil {
+			return err
+		}
+		for height := range hashes {
+			err := dbPutBlockIndex(dbTx, &hashes[height],
+				uint32(height))
+			if err != nil {
+				return err
+			}
+		}
+		return dbTx.StoreBlock(genesis)
+	})
+	if err != nil {
+		t.Fatalf("unable to create test chain: %v", err)
+	}
+
+	err = db.View(func(dbTx database.Tx) error {
+		for height := range hashes {
+			hash, storedHeight, err := dbFetchLastStoredBlock(dbTx,
+				uint32(height))
+			if err != nil {
+				t.Fatalf("dbFetchLastStoredBlock: unexpected "+
+					"error at height %d: %v", height, err)
+			}
+			if storedHeight != 0 || !hash.IsEqual(genesis.Hash()) {
+				t.Fatalf("dbFetchLastStoredBlock: got block %v "+
+					"(height %d) from height %d, want the "+
+					"genesis block", hash, storedHeight, height)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("View: unexpected error: %v", err)
+	}
+}
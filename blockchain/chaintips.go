@@ -0,0 +1,154 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"sort"
+
+	"github.com/bitgo/prova/chaincfg/chainhash"
+)
+
+// ChainTipStatus describes the validation state of the branch ending at a
+// chain tip.
+type ChainTipStatus int
+
+const (
+	// ChainTipActive is the status of the tip of the main chain.
+	ChainTipActive ChainTipStatus = iota
+
+	// ChainTipValidFork is the status of a side chain tip which has been
+	// fully validated, which is the case when it was part of the main
+	// chain before a reorganization.
+	ChainTipValidFork
+
+	// ChainTipValidHeaders is the status of a side chain tip which has
+	// been accepted but not fully validated since it never had enough work
+	// to become part of the main chain.
+	ChainTipValidHeaders
+
+	// ChainTipInvalid is the status of a side chain tip which contains a
+	// block that failed validation.
+	ChainTipInvalid
+)
+
+// chainTipStatusStrings is a map of chain tip statuses back to their constant
+// names for pretty printing.
+var chainTipStatusStrings = map[ChainTipStatus]string{
+	ChainTipActive:       "active",
+	ChainTipValidFork:    "valid-fork",
+	ChainTipValidHeaders: "valid-headers",
+	ChainTipInvalid:      "invalid",
+}
+
+// String returns the ChainTipStatus as a human-readable name.
+func (status ChainTipStatus) String() string {
+	if s, ok := chainTipStatusStrings[status]; ok {
+		return s
+	}
+	return "unknown"
+}
+
+// ChainTip describes the tip of a branch of the block index.
+type ChainTip struct {
+	Hash      chainhash.Hash
+	Height    uint32
+	BranchLen uint32
+	Status    ChainTipStatus
+}
+
+// markBlockInvalid marks the passed node as having failed validation and all
+// of its descendants in the memory block index as having an invalid ancestor.
+//
+// This function MUST be called with the chain lock held (for writes).
+func (b *BlockChain) markBlockInvalid(node *blockNode) {
+	node.status |= statusValidateFailed
+	descendants := append([]*blockNode(nil), node.children...)
+	for len(descendants) > 0 {
+		child := descendants[len(descendants)-1]
+		descendants = descendants[:len(descendants)-1]
+		child.status |= statusInvalidAncestor
+		descendants = append(descendants, child.children...)
+	}
+}
+
+// chainTip describes the branch ending at the passed tip node by walking back
+// to the block where it forks from the main chain.
+//
+// This function MUST be called with the chain lock held (for writes).
+func (b *BlockChain) chainTip(tip *blockNode) (ChainTip, error) {
+	chainTip := ChainTip{
+		Hash:   *tip.hash,
+		Height: tip.height,
+		Status: ChainTipActive,
+	}
+	if tip == b.bestNode {
+		return chainTip, nil
+	}
+
+	invalid := false
+	fork := tip
+	for fork != nil && !fork.inMainChain {
+		invalid = invalid || fork.status.KnownInvalid()
+
+		var err error
+		fork, err = b.getPrevNodeFromNode(fork)
+		if err != nil {
+			return ChainTip{}, err
+		}
+	}
+	if fork != nil {
+		chainTip.BranchLen = tip.height - fork.height
+	} else {
+		chainTip.BranchLen = tip.height + 1
+	}
+
+	switch {
+	case invalid:
+		chainTip.Status = ChainTipInvalid
+	case tip.status&statusValid != 0:
+		chainTip.Status = ChainTipValidFork
+	default:
+		chainTip.Status = ChainTipValidHeaders
+	}
+	return chainTip, nil
+}
+
+// ChainTips returns the tips of all branches in the memory block index along
+// with the length of each branch from the main chain and its validation
+// status.  The tip of the main chain is included with a branch length of zero.
+// The tips are ordered by descending height.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ChainTips() ([]ChainTip, error) {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	// A node is a tip when no other node in the index extends it.  The
+	// best node is always a tip since it may only be extended by blocks
+	// which are known to be invalid, such as after it was invalidated.
+	parents := make(map[chainhash.Hash]struct{}, len(b.index))
+	for _, node := range b.index {
+		parents[*node.parentHash] = struct{}{}
+	}
+
+	var tips []ChainTip
+	for hash, node := range b.index {
+		if _, ok := parents[hash]; ok && node != b.bestNode {
+			continue
+		}
+		tip, err := b.chainTip(node)
+		if err != nil {
+			return nil, err
+		}
+		tips = append(tips, tip)
+	}
+	sort.Slice(tips, func(i, j int) bool {
+		if tips[i].Height != tips[j].Height {
+			return tips[i].Height > tips[j].Height
+		}
+		return tips[i].Status < tips[j].Status
+	})
+	return tips, nil
+}
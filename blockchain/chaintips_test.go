@@ -0,0 +1,98 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestChainTips ensures the tips of all branches in the block index are
+// reported with their branch lengths and statuses.
+func TestChainTips(t *testing.T) {
+	b := newKeyWindowTestChain(6)
+	mainNodes := make([]*blockNode, 6)
+	for node := b.bestNode; node != nil; node = node.parent {
+		node.inMainChain = true
+		node.status = statusValid
+		mainNodes[node.height] = node
+	}
+
+	// addBranch extends the passed node with a branch of the passed length
+	// whose blocks are linked to their parents.
+	addBranch := func(parent *blockNode, length int, tag byte) []*blockNode {
+		var nodes []*blockNode
+		for i := 0; i < length; i++ {
+			node := addKeyWindowTestNode(b, parent, tag)
+			parent.children = append(parent.children, node)
+			nodes = append(nodes, node)
+			parent = node
+		}
+		return nodes
+	}
+
+	// A stale branch which never had enough work to be connected.
+	stale := addBranch(mainNodes[3], 2, 0xa0)
+
+	// A branch which was part of the main chain before a reorganization.
+	fork := addBranch(mainNodes[4], 1, 0xb0)
+	fork[0].status = statusValid
+
+	// A branch whose first block failed validation during a
+	// reorganization.
+	invalid := addBranch(mainNodes[2], 2, 0xc0)
+	b.markBlockInvalid(invalid[0])
+	if invalid[1].status != statusInvalidAncestor {
+		t.Fatalf("descendant of an invalid block has status %v, want "+
+			"%v", invalid[1].status, statusInvalidAncestor)
+	}
+
+	tips, err := b.ChainTips()
+	if err != nil {
+		t.Fatalf("ChainTips: unexpected error: %v", err)
+	}
+	want := []ChainTip{
+		{
+			Hash:   *mainNodes[5].hash,
+			Height: 5,
+			Status: ChainTipActive,
+		},
+		{
+			Hash:      *fork[0].hash,
+			Height:    5,
+			BranchLen: 1,
+			Status:    ChainTipValidFork,
+		},
+		{
+			Hash:      *stale[1].hash,
+			Height:    5,
+			BranchLen: 2,
+			Status:    ChainTipValidHeaders,
+		},
+		{
+			Hash:      *invalid[1].hash,
+			Height:    4,
+			BranchLen: 2,
+			Status:    ChainTipInvalid,
+		},
+	}
+	if !reflect.DeepEqual(tips, want) {
+		t.Fatalf("mismatched chain tips - got %+v, want %+v", tips, want)
+	}
+
+	// Blocks which extend an invalid branch are reported as invalid even
+	// when they were added before the branch was marked.
+	extension := addKeyWindowTestNode(b, invalid[1], 0xc1)
+	tips, err = b.ChainTips()
+	if err != nil {
+		t.Fatalf("ChainTips: unexpected error: %v", err)
+	}
+	last := tips[len(tips)-1]
+	if last.Hash != *extension.hash || last.BranchLen != 3 ||
+		last.Status != ChainTipInvalid {
+
+		t.Fatalf("unexpected tip for extended invalid branch: %+v", last)
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/wire"
+)
+
+// buildWorkBranch extends the passed parent node with one node for each of
+// the passed difficulty bits and returns the tip of the new branch.  The work
+// sums are accumulated the same way they are when blocks are accepted.
+func buildWorkBranch(parent *blockNode, bits ...uint32) *blockNode {
+	tip := parent
+	for _, b := range bits {
+		header := wire.BlockHeader{
+			PrevBlock: *tip.hash,
+			Bits:      b,
+			Height:    tip.height + 1,
+		}
+		hash := header.BlockHash()
+		node := newBlockNode(&header, &hash)
+		node.workSum.Add(tip.workSum, node.workSum)
+		node.parent = tip
+		tip.children = append(tip.children, node)
+		tip = node
+	}
+	return tip
+}
+
+// TestHasMoreWork ensures the best chain comparison selects the chain with
+// the most cumulative work rather than the longest chain.
+func TestHasMoreWork(t *testing.T) {
+	// The easy bits correspond to the mainnet proof of work limit of
+	// 2^243 - 1 while the hard bits require a target 256 times lower.
+	const easyBits = 0x1f07ffff
+	const hardBits = 0x1e07ffff
+
+	genesisHeader := wire.BlockHeader{Bits: easyBits}
+	genesisHash := chainhash.Hash{}
+	genesis := newBlockNode(&genesisHeader, &genesisHash)
+
+	// genesis -> 1 -> 2 -> 3 -> 4 (easy)
+	//        \-> 1a -> 2a (hard)
+	longTip := buildWorkBranch(genesis, easyBits, easyBits, easyBits,
+		easyBits)
+	heavyTip := buildWorkBranch(genesis, hardBits, hardBits)
+
+	if heavyTip.height >= longTip.height {
+		t.Fatalf("test setup: heavy branch height %d is not lower than "+
+			"long branch height %d", heavyTip.height, longTip.height)
+	}
+	if !heavyTip.hasMoreWork(longTip) {
+		t.Fatalf("lower branch with more work (%v) was not selected "+
+			"over longer branch (%v)", heavyTip.workSum,
+			longTip.workSum)
+	}
+	if longTip.hasMoreWork(heavyTip) {
+		t.Fatalf("longer branch with less work (%v) was selected "+
+			"over heavier branch (%v)", longTip.workSum,
+			heavyTip.workSum)
+	}
+
+	// Equal work must not be considered more work so the first seen chain
+	// is kept.
+	twinTip := buildWorkBranch(genesis, easyBits, easyBits, easyBits,
+		easyBits)
+	if twinTip.hasMoreWork(longTip) || longTip.hasMoreWork(twinTip) {
+		t.Fatalf("branches with equal work (%v) compared as unequal",
+			longTip.workSum)
+	}
+
+	// The accumulated work must match the sum of the individual work
+	// values computed from the compact bits.
+	want := new(big.Int).Mul(CalcWork(hardBits), big.NewInt(2))
+	want.Add(want, CalcWork(easyBits))
+	if heavyTip.workSum.Cmp(want) != 0 {
+		t.Fatalf("unexpected work sum -- got %v, want %v",
+			heavyTip.workSum, want)
+	}
+}
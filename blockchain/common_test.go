@@ -61,6 +61,14 @@ func isSupportedDbType(dbType string) bool {
 // block already inserted.  In addition to the new chain instance, it returns
 // a teardown function the caller should invoke when done testing to clean up.
 func chainSetup(dbName string, params *chaincfg.Params) (*blockchain.BlockChain, func(), error) {
+	return chainSetupWithConfig(dbName, params, blockchain.Config{})
+}
+
+// chainSetupWithConfig is identical to chainSetup except the chain instance is
+// created with the optional settings of the passed configuration.  The
+// database, chain parameters, time source, and signature cache are always
+// provided by the setup.
+func chainSetupWithConfig(dbName string, params *chaincfg.Params, config blockchain.Config) (*blockchain.BlockChain, func(), error) {
 	if !isSupportedDbType(testDbType) {
 		return nil, nil, fmt.Errorf("unsupported db type %v", testDbType)
 	}
@@ -105,7 +113,10 @@ func chainSetup(dbName string, params *chaincfg.Params) (*blockchain.BlockChain,
 		teardown = func() {
 			db.Close()
 			os.RemoveAll(dbPath)
-			os.RemoveAll(testDbRoot)
+
+			// Only remove the root directory once it is empty so
+			// tests can use multiple databases at the same time.
+			os.Remove(testDbRoot)
 		}
 	}
 
@@ -114,13 +125,11 @@ func chainSetup(dbName string, params *chaincfg.Params) (*blockchain.BlockChain,
 	paramsCopy := *params
 
 	// Create the main chain instance.
-	chain, err := blockchain.New(&blockchain.Config{
-		DB:          db,
-		ChainParams: &paramsCopy,
-		Checkpoints: nil,
-		TimeSource:  blockchain.NewMedianTime(),
-		SigCache:    txscript.NewSigCache(1000),
-	})
+	config.DB = db
+	config.ChainParams = &paramsCopy
+	config.TimeSource = blockchain.NewMedianTime()
+	config.SigCache = txscript.NewSigCache(1000)
+	chain, err := blockchain.New(&config)
 	if err != nil {
 		teardown()
 		err := fmt.Errorf("failed to create chain instance: %v", err)
@@ -0,0 +1,660 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/wire"
+)
+
+// DeploymentState describes the state of a rule change rolled out by block
+// version for the block after the best block.
+type DeploymentState byte
+
+// These constants define the states of rule changes rolled out by block
+// version.  Consensus deployments are not signaled by blocks since they are
+// activated at a height set by the chain parameters, so they are only either
+// active or not.
+const (
+	// DeploymentDefined indicates the rule change is known, but not
+	// enforced.
+	DeploymentDefined DeploymentState = iota
+
+	// DeploymentEnforced indicates enough of the recent blocks have the
+	// version of a version rollout that new blocks which have the version
+	// must follow its rules, while blocks with older versions are still
+	// accepted.
+	DeploymentEnforced
+
+	// DeploymentActive indicates the rule change applies to all new blocks.
+	DeploymentActive
+)
+
+// deploymentStateStrings is a map of deployment states back to their constant
+// names for pretty printing.
+var deploymentStateStrings = map[DeploymentState]string{
+	DeploymentDefined:  "defined",
+	DeploymentEnforced: "enforced",
+	DeploymentActive:   "active",
+}
+
+// String returns the DeploymentState as a human-readable name.
+func (s DeploymentState) String() string {
+	if str, ok := deploymentStateStrings[s]; ok {
+		return str
+	}
+	return fmt.Sprintf("Unknown DeploymentState (%d)", byte(s))
+}
+
+// deploymentNames houses the names the consensus deployments are reported
+// under.
+var deploymentNames = [chaincfg.DefinedDeployments]string{
+	chaincfg.DeploymentCSV:            "csv",
+	chaincfg.DeploymentStrictEncoding: "strictenc",
+	chaincfg.DeploymentCLTV:           "cltv",
+}
+
+// versionRollout describes a rule change which is enforced once the majority
+// of the recent blocks have at least its block version.  These predate the
+// consensus deployments scheduled by height.
+type versionRollout struct {
+	name    string
+	version uint32
+}
+
+// versionRollouts houses the rule changes rolled out by block version in the
+// order their versions were introduced.
+var versionRollouts = [...]versionRollout{
+	{name: "bip34", version: 2},
+	{name: "bip66", version: 3},
+	{name: "bip65", version: 4},
+}
+
+// DeploymentStatus describes the state of a consensus deployment.  Deployments
+// are activated at the height set by the chain parameters rather than signaled
+// by blocks, so there is nothing to report besides whether the height has been
+// reached.
+type DeploymentStatus struct {
+	Name string
+
+	// ActivationHeight is the height of the first block the rule change
+	// is enforced for.  It is math.MaxUint32 when the rule change is not
+	// scheduled.
+	ActivationHeight uint32
+
+	// Active indicates whether the rule change is enforced for the block
+	// after the best block.
+	Active bool
+
+	// ActivationTime is the timestamp of the block at the activation
+	// height.  It is the zero time when the block is not part of the main
+	// chain yet or its header is not available.
+	ActivationTime time.Time
+}
+
+// VersionRolloutStatus describes the state of a rule change which is enforced
+// once the majority of the recent blocks have at least its block version.
+type VersionRolloutStatus struct {
+	Name    string
+	Version uint32
+
+	// State is the state of the rule change for the block after the best
+	// block.
+	State DeploymentState
+
+	// Since is the height of the first block of the current state and
+	// SinceTime is the timestamp of that block.  When the headers of the
+	// early blocks are not available, such as after bootstrapping the
+	// chain from a utxo set snapshot, Since is the first block the state
+	// could be determined for.
+	Since     uint32
+	SinceTime time.Time
+
+	// Signaling is the number of blocks with at least the version among
+	// the Window blocks ending at the best block.  The rule change is
+	// enforced once it reaches EnforceThreshold and active once it
+	// reaches RejectThreshold.
+	Signaling        uint32
+	Window           uint32
+	EnforceThreshold uint32
+	RejectThreshold  uint32
+}
+
+// UpgradeStatus houses the state of the consensus rule changes as of the best
+// block.
+type UpgradeStatus struct {
+	Hash            chainhash.Hash
+	Height          uint32
+	Deployments     []DeploymentStatus
+	VersionRollouts []VersionRolloutStatus
+}
+
+// rolloutTransition describes a change of the state of a version rollout at
+// the block with the since height.
+type rolloutTransition struct {
+	state DeploymentState
+	since uint32
+}
+
+// rolloutTally tracks the state of a version rollout while the blocks of the
+// main chain are pushed to and popped from a version tally.  The transitions
+// are kept so the state the rollout was in before a block can be restored when
+// the block is disconnected.  There are only a handful of them since the state
+// only changes when the majority of the window changes.
+type rolloutTally struct {
+	found       uint32
+	transitions []rolloutTransition
+}
+
+// state returns the current state of the rollout and the height of the first
+// block of that state.
+func (r *rolloutTally) state() (DeploymentState, uint32) {
+	if len(r.transitions) == 0 {
+		return DeploymentDefined, 0
+	}
+	last := r.transitions[len(r.transitions)-1]
+	return last.state, last.since
+}
+
+// versionTally houses the versions of the most recent blocks of the main chain
+// ending at a tip in a ring buffer along with the state of the version
+// rollouts.  It is maintained as blocks are connected and disconnected, so the
+// upgrade status never requires scanning the chain.
+type versionTally struct {
+	tipHash   chainhash.Hash
+	tipHeight uint32
+	versions  []uint32
+	next      int
+	count     int
+	rollouts  [len(versionRollouts)]rolloutTally
+
+	// partial indicates the tally does not start at the genesis block,
+	// so the states can only be determined once the window is filled.
+	partial bool
+
+	// status caches the upgrade status for the tip.
+	status *UpgradeStatus
+}
+
+// newVersionTally returns an empty version tally for the passed chain
+// parameters.
+func newVersionTally(params *chaincfg.Params) *versionTally {
+	return &versionTally{
+		versions: make([]uint32, params.BlockUpgradeNumToCheck),
+	}
+}
+
+// updateStates updates the state of the version rollouts for the block after
+// the tip.
+func (t *versionTally) updateStates(params *chaincfg.Params) {
+	if t.partial && t.count < len(t.versions) {
+		return
+	}
+	for i := range t.rollouts {
+		rollout := &t.rollouts[i]
+		state := DeploymentDefined
+		switch {
+		case uint64(rollout.found) >= params.BlockRejectNumRequired:
+			state = DeploymentActive
+		case uint64(rollout.found) >= params.BlockEnforceNumRequired:
+			state = DeploymentEnforced
+		}
+		if current, _ := rollout.state(); state != current {
+			rollout.transitions = append(rollout.transitions,
+				rolloutTransition{state: state, since: t.tipHeight + 1})
+		}
+	}
+}
+
+// countVersion adds the passed block version to the signaling counts of the rollouts
+// or removes it from them.
+func (t *versionTally) countVersion(version uint32, add bool) {
+	for i := range t.rollouts {
+		if version < versionRollouts[i].version {
+			continue
+		}
+		if add {
+			t.rollouts[i].found++
+		} else {
+			t.rollouts[i].found--
+		}
+	}
+}
+
+// push extends the tally with the block with the passed hash, height and
+// version, which must be the child of the current tip, and updates the state
+// of the version rollouts for the block after it.
+func (t *versionTally) push(hash *chainhash.Hash, height, version uint32, params *chaincfg.Params) {
+	if len(t.versions) == 0 {
+		return
+	}
+	if t.count == len(t.versions) {
+		t.countVersion(t.versions[t.next], false)
+	} else {
+		t.count++
+	}
+	t.versions[t.next] = version
+	t.next = (t.next + 1) % len(t.versions)
+	t.countVersion(version, true)
+	t.tipHash = *hash
+	t.tipHeight = height
+	t.status = nil
+	t.updateStates(params)
+}
+
+// pop removes the tip from the tally, which then ends at its parent with the
+// passed hash, and restores the state of the version rollouts for the block
+// after the parent.  The version of the block which enters the window again,
+// as reported by restoredHeight, must be passed when there is one and nil
+// otherwise.
+func (t *versionTally) pop(parentHash *chainhash.Hash, restored *uint32) {
+	if len(t.versions) == 0 {
+		return
+	}
+	t.next = (t.next - 1 + len(t.versions)) % len(t.versions)
+	t.countVersion(t.versions[t.next], false)
+	if restored != nil {
+		// The slot of the popped block is the one before the oldest
+		// block, so it receives the restored version.
+		t.versions[t.next] = *restored
+		t.countVersion(*restored, true)
+	} else {
+		t.count--
+	}
+
+	for i := range t.rollouts {
+		rollout := &t.rollouts[i]
+		n := len(rollout.transitions)
+		if n > 0 && rollout.transitions[n-1].since == t.tipHeight+1 {
+			rollout.transitions = rollout.transitions[:n-1]
+		}
+	}
+	t.tipHash = *parentHash
+	t.tipHeight--
+	t.status = nil
+}
+
+// restoredHeight returns the height of the block which enters the window
+// again when the tip is popped from the tally and whether there is one.
+func (t *versionTally) restoredHeight() (uint32, bool) {
+	window := uint32(len(t.versions))
+	if t.count != len(t.versions) || t.tipHeight < window {
+		return 0, false
+	}
+	return t.tipHeight - window, true
+}
+
+// dbFetchBlockTime uses an existing database transaction to retrieve the
+// timestamp of the main chain block at the passed height.  The zero time is
+// returned when the chain does not contain a block at the height yet or its
+// header is not available.
+func dbFetchBlockTime(dbTx database.Tx, height uint32) time.Time {
+	header, err := dbFetchHeaderByHeight(dbTx, height)
+	if err != nil {
+		return time.Time{}
+	}
+	return header.Timestamp
+}
+
+// -----------------------------------------------------------------------------
+// The states of the version rollouts are stored in the database under a single
+// key along with the main chain block they were tallied up to, so loading the
+// chain only requires the headers of the blocks in the window rather than those
+// of the entire chain.  The stored states consist of the following fields:
+//
+//   Field              Type            Size
+//   tip hash           chainhash.Hash  32 bytes
+//   tip height         uint32          4 bytes
+//   partial            bool            1 byte
+//   num rollouts       uint8           1 byte
+//   rollouts           [num rollouts]
+//     num transitions  uint32          4 bytes
+//     transitions      [num transitions]
+//       state          uint8           1 byte
+//       since          uint32          4 bytes
+// -----------------------------------------------------------------------------
+
+// storedVersionTally houses the states of the version rollouts as loaded from
+// the database.
+type storedVersionTally struct {
+	tipHash   chainhash.Hash
+	tipHeight uint32
+	partial   bool
+	rollouts  [len(versionRollouts)][]rolloutTransition
+}
+
+// serializeVersionTally returns the serialization of the states of the version
+// rollouts of the passed tally as of the block with the passed hash and height,
+// which must either be the tip of the tally or its parent.  The transitions of
+// the block after it are left out.
+func serializeVersionTally(t *versionTally, tipHash *chainhash.Hash, tipHeight uint32) []byte {
+	size := chainhash.HashSize + 4 + 1 + 1
+	for i := range t.rollouts {
+		size += 4 + 5*len(t.rollouts[i].transitions)
+	}
+	serialized := make([]byte, size)
+	copy(serialized, tipHash[:])
+	offset := chainhash.HashSize
+	byteOrder.PutUint32(serialized[offset:], tipHeight)
+	offset += 4
+	if t.partial {
+		serialized[offset] = 1
+	}
+	serialized[offset+1] = uint8(len(t.rollouts))
+	offset += 2
+	for i := range t.rollouts {
+		countOffset := offset
+		offset += 4
+		var count uint32
+		for _, transition := range t.rollouts[i].transitions {
+			if transition.since > tipHeight+1 {
+				continue
+			}
+			serialized[offset] = uint8(transition.state)
+			byteOrder.PutUint32(serialized[offset+1:], transition.since)
+			offset += 5
+			count++
+		}
+		byteOrder.PutUint32(serialized[countOffset:], count)
+	}
+	return serialized[:offset]
+}
+
+// deserializeVersionTally decodes the passed serialized states of the version
+// rollouts.  It returns nil when they were stored for a different number of
+// version rollouts.
+func deserializeVersionTally(serialized []byte) (*storedVersionTally, error) {
+	corrupt := database.Error{
+		ErrorCode:   database.ErrCorruption,
+		Description: "corrupt version tally",
+	}
+	if len(serialized) < chainhash.HashSize+4+1+1 {
+		return nil, corrupt
+	}
+
+	var stored storedVersionTally
+	copy(stored.tipHash[:], serialized)
+	offset := chainhash.HashSize
+	stored.tipHeight = byteOrder.Uint32(serialized[offset:])
+	offset += 4
+	stored.partial = serialized[offset] != 0
+	if int(serialized[offset+1]) != len(stored.rollouts) {
+		return nil, nil
+	}
+	offset += 2
+	for i := range stored.rollouts {
+		if len(serialized[offset:]) < 4 {
+			return nil, corrupt
+		}
+		count := byteOrder.Uint32(serialized[offset:])
+		offset += 4
+		if uint64(len(serialized[offset:])) < 5*uint64(count) {
+			return nil, corrupt
+		}
+		transitions := make([]rolloutTransition, 0, count)
+		for j := uint32(0); j < count; j++ {
+			transitions = append(transitions, rolloutTransition{
+				state: DeploymentState(serialized[offset]),
+				since: byteOrder.Uint32(serialized[offset+1:]),
+			})
+			offset += 5
+		}
+		stored.rollouts[i] = transitions
+	}
+	if offset != len(serialized) {
+		return nil, corrupt
+	}
+	return &stored, nil
+}
+
+// dbPutVersionTally uses an existing database transaction to store the states
+// of the version rollouts of the passed tally as of the block with the passed
+// hash and height, which must either be the tip of the tally or its parent.
+func dbPutVersionTally(dbTx database.Tx, t *versionTally, tipHash *chainhash.Hash, tipHeight uint32) error {
+	serialized := serializeVersionTally(t, tipHash, tipHeight)
+	return dbTx.Metadata().Put(versionTallyKeyName, serialized)
+}
+
+// dbFetchVersionTally uses an existing database transaction to load the states
+// of the version rollouts.  When they have not been stored yet, nil is returned
+// for both the states and the error.
+func dbFetchVersionTally(dbTx database.Tx) (*storedVersionTally, error) {
+	serialized := dbTx.Metadata().Get(versionTallyKeyName)
+	if serialized == nil {
+		return nil, nil
+	}
+
+	return deserializeVersionTally(serialized)
+}
+
+// restoreVersionTally returns a version tally for the main chain ending at the
+// passed tip from the states of the version rollouts stored in the database.
+// Only the headers of the blocks in the window ending at the block the states
+// were stored for and of the blocks which follow it are read.  It returns nil
+// when no usable states are stored, such as when the block they were stored
+// for is no longer part of the main chain.
+func (b *BlockChain) restoreVersionTally(dbTx database.Tx, tip *blockNode) (*versionTally, error) {
+	stored, err := dbFetchVersionTally(dbTx)
+	if err != nil || stored == nil || stored.tipHeight > tip.height {
+		return nil, err
+	}
+	hash, err := dbFetchHashByHeight(dbTx, stored.tipHeight)
+	if err != nil || *hash != stored.tipHash {
+		return nil, nil
+	}
+
+	// Load the versions of the blocks in the window ending at the block
+	// the states were stored for.  A tally which starts at the genesis
+	// block requires all of their headers.
+	t := newVersionTally(b.chainParams)
+	var versions []uint32
+	for height := stored.tipHeight; len(versions) < len(t.versions); height-- {
+		header, err := dbFetchHeaderByHeight(dbTx, height)
+		if err != nil {
+			if !stored.partial {
+				return nil, nil
+			}
+			break
+		}
+		versions = append(versions, header.Version)
+		if height == 0 {
+			break
+		}
+	}
+	for i := len(versions) - 1; i >= 0; i-- {
+		t.versions[t.count] = versions[i]
+		t.countVersion(versions[i], true)
+		t.count++
+	}
+	if len(t.versions) != 0 {
+		t.next = t.count % len(t.versions)
+	}
+	t.tipHash = stored.tipHash
+	t.tipHeight = stored.tipHeight
+	t.partial = stored.partial
+	for i := range t.rollouts {
+		t.rollouts[i].transitions = stored.rollouts[i]
+	}
+
+	// Catch up with the blocks connected after the states were stored.
+	for height := stored.tipHeight + 1; height <= tip.height; height++ {
+		header, err := dbFetchHeaderByHeight(dbTx, height)
+		if err != nil {
+			return nil, nil
+		}
+		hash := header.BlockHash()
+		t.push(&hash, height, header.Version, b.chainParams)
+	}
+	return t, nil
+}
+
+// buildVersionTally returns a version tally for the main chain ending at the
+// passed tip.  It starts at the genesis block or, when the headers of the
+// early blocks are not available, at the first block of the longest run of
+// available headers ending at the tip.
+func (b *BlockChain) buildVersionTally(dbTx database.Tx, tip *blockNode) (*versionTally, error) {
+	var headers []*wire.BlockHeader
+	height := tip.height
+	for {
+		header, err := dbFetchHeaderByHeight(dbTx, height)
+		if err != nil {
+			if height == tip.height {
+				return nil, err
+			}
+			height++
+			break
+		}
+		headers = append(headers, header)
+		if height == 0 {
+			break
+		}
+		height--
+	}
+
+	t := newVersionTally(b.chainParams)
+	t.partial = height > 0
+	for i := len(headers) - 1; i >= 0; i-- {
+		hash := headers[i].BlockHash()
+		t.push(&hash, height, headers[i].Version, b.chainParams)
+		height++
+	}
+	return t, nil
+}
+
+// initVersionTally tallies the versions of the main chain blocks ending at the
+// best block.  The tally is restored from the states of the version rollouts
+// stored in the database when possible, so the chain is only scanned when they
+// were not stored yet or are no longer usable.  The tally is maintained as
+// blocks are connected and disconnected afterwards.
+//
+// This function MUST be called with the chain lock held (for writes).
+func (b *BlockChain) initVersionTally() error {
+	return b.db.View(func(dbTx database.Tx) error {
+		t, err := b.restoreVersionTally(dbTx, b.bestNode)
+		if err != nil {
+			return err
+		}
+		if t == nil {
+			t, err = b.buildVersionTally(dbTx, b.bestNode)
+			if err != nil {
+				return err
+			}
+		}
+		b.versionTally = t
+		return nil
+	})
+}
+
+// pushVersionTally extends the version tally with the passed node, which was
+// just connected to the end of the main chain.
+//
+// This function MUST be called with the chain lock held (for writes).
+func (b *BlockChain) pushVersionTally(node *blockNode) error {
+	t := b.versionTally
+	if t == nil || t.tipHash != *node.parentHash {
+		return b.initVersionTally()
+	}
+	t.push(node.hash, node.height, node.version, b.chainParams)
+	return nil
+}
+
+// popVersionTally removes the passed node, which was just disconnected from
+// the end of the main chain, from the version tally.  The version of the block
+// which enters the window again is loaded from the database.  The tally is
+// only rebuilt when its header is not available, which is only the case when
+// disconnecting the early blocks of a chain imported from a utxo snapshot.
+//
+// This function MUST be called with the chain lock held (for writes).
+func (b *BlockChain) popVersionTally(node *blockNode) error {
+	t := b.versionTally
+	if t == nil || t.tipHash != *node.hash {
+		return b.initVersionTally()
+	}
+
+	var restored *uint32
+	if height, ok := t.restoredHeight(); ok {
+		err := b.db.View(func(dbTx database.Tx) error {
+			header, err := dbFetchHeaderByHeight(dbTx, height)
+			if err != nil {
+				return err
+			}
+			restored = &header.Version
+			return nil
+		})
+		if err != nil {
+			return b.initVersionTally()
+		}
+	} else if t.partial {
+		return b.initVersionTally()
+	}
+	t.pop(node.parentHash, restored)
+	return nil
+}
+
+// UpgradeStatus returns the state of the consensus deployments and of the rule
+// changes rolled out by block version for the block after the best block.
+// The versions the rollouts are tallied from are maintained as blocks are
+// connected and disconnected and the status is cached for the best block.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) UpgradeStatus() (*UpgradeStatus, error) {
+	b.upgradeStatusLock.Lock()
+	defer b.upgradeStatusLock.Unlock()
+	b.chainLock.RLock()
+	defer b.chainLock.RUnlock()
+
+	t := b.versionTally
+	if t.status != nil {
+		return t.status, nil
+	}
+
+	status := &UpgradeStatus{
+		Hash:   t.tipHash,
+		Height: t.tipHeight,
+	}
+	err := b.db.View(func(dbTx database.Tx) error {
+		for id, name := range deploymentNames {
+			d := DeploymentStatus{
+				Name:             name,
+				ActivationHeight: b.chainParams.Deployments[id].ActivationHeight,
+			}
+			d.Active = t.tipHeight+1 >= d.ActivationHeight
+			if d.ActivationHeight != math.MaxUint32 {
+				d.ActivationTime = dbFetchBlockTime(dbTx,
+					d.ActivationHeight)
+			}
+			status.Deployments = append(status.Deployments, d)
+		}
+
+		for i, rollout := range versionRollouts {
+			state, since := t.rollouts[i].state()
+			r := VersionRolloutStatus{
+				Name:             rollout.name,
+				Version:          rollout.version,
+				State:            state,
+				Since:            since,
+				SinceTime:        dbFetchBlockTime(dbTx, since),
+				Signaling:        t.rollouts[i].found,
+				Window:           uint32(len(t.versions)),
+				EnforceThreshold: uint32(b.chainParams.BlockEnforceNumRequired),
+				RejectThreshold:  uint32(b.chainParams.BlockRejectNumRequired),
+			}
+			status.VersionRollouts = append(status.VersionRollouts, r)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	t.status = status
+	return status, nil
+}
@@ -0,0 +1,297 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain_test
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/txscript"
+)
+
+// TestDeploymentStateStringer tests the stringized output for the
+// DeploymentState type.
+func TestDeploymentStateStringer(t *testing.T) {
+	tests := []struct {
+		in   blockchain.DeploymentState
+		want string
+	}{
+		{blockchain.DeploymentDefined, "defined"},
+		{blockchain.DeploymentEnforced, "enforced"},
+		{blockchain.DeploymentActive, "active"},
+		{0xff, "Unknown DeploymentState (255)"},
+	}
+
+	for i, test := range tests {
+		if got := test.in.String(); got != test.want {
+			t.Errorf("String #%d\n got: %s want: %s", i, got, test.want)
+		}
+	}
+}
+
+// TestUpgradeStatus ensures the upgrade status reports a deployment as active
+// once the chain reaches the block before its activation height along with the
+// timestamp of the activation block once it is connected, an unscheduled
+// deployment as inactive, and the version rollouts along with the number of
+// signaling blocks.  It also ensures the status is cached for the best block
+// and that the status maintained as blocks are connected matches the one of a
+// chain which tallies the blocks when it is loaded.
+//
+// The regression test network is used in place of the simulation test network
+// since the blocks generated by the fullblocktests package are the only ones
+// which can be validated without a miner.
+func TestUpgradeStatus(t *testing.T) {
+	blocks := linearTestBlocks(t)
+	const activationHeight = 10
+	if len(blocks) < activationHeight+2 {
+		t.Fatalf("not enough test blocks - got %d", len(blocks))
+	}
+
+	params := chaincfg.RegressionNetParams
+	params.Deployments[chaincfg.DeploymentCSV].ActivationHeight = activationHeight
+	params.Deployments[chaincfg.DeploymentStrictEncoding].ActivationHeight =
+		math.MaxUint32
+	chain, teardownFunc, err := chainSetup("upgradestatus", &params)
+	if err != nil {
+		t.Fatalf("failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	genesisTime := params.GenesisBlock.Header.Timestamp
+	tests := []struct {
+		name          string
+		height        uint32
+		csvActive     bool
+		csvTime       time.Time
+		wantSignaling uint32
+	}{
+		{
+			name:          "genesis",
+			height:        0,
+			wantSignaling: 1,
+		},
+		{
+			name:          "two blocks before activation",
+			height:        activationHeight - 2,
+			wantSignaling: 1,
+		},
+		{
+			name:          "block before activation",
+			height:        activationHeight - 1,
+			csvActive:     true,
+			wantSignaling: 1,
+		},
+		{
+			name:          "after activation",
+			height:        activationHeight + 2,
+			csvActive:     true,
+			csvTime:       blocks[activationHeight-1].Header.Timestamp,
+			wantSignaling: 1,
+		},
+	}
+
+	var status *blockchain.UpgradeStatus
+	var processed uint32
+	for _, test := range tests {
+		processTestBlocks(t, test.name, chain,
+			blocks[processed:test.height])
+		processed = test.height
+		status, err = chain.UpgradeStatus()
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+		best := chain.BestSnapshot()
+		if status.Hash != *best.Hash || status.Height != test.height {
+			t.Fatalf("%s: status for block %v (height %d), want %v "+
+				"(height %d)", test.name, status.Hash,
+				status.Height, best.Hash, test.height)
+		}
+
+		wantDeployments := []blockchain.DeploymentStatus{
+			{
+				Name:             "csv",
+				ActivationHeight: activationHeight,
+				Active:           test.csvActive,
+				ActivationTime:   test.csvTime,
+			},
+			{
+				Name:             "strictenc",
+				ActivationHeight: math.MaxUint32,
+			},
+			{
+				Name:           "cltv",
+				Active:         true,
+				ActivationTime: genesisTime,
+			},
+		}
+		if !reflect.DeepEqual(status.Deployments, wantDeployments) {
+			t.Errorf("%s: got deployments %+v, want %+v", test.name,
+				status.Deployments, wantDeployments)
+		}
+
+		// The blocks generated by the fullblocktests package are
+		// version 1, so only the genesis block signals the rollouts.
+		for i, version := range []uint32{2, 3, 4} {
+			got := status.VersionRollouts[i]
+			if got.Version != version ||
+				got.State != blockchain.DeploymentDefined ||
+				got.Since != 0 || !got.SinceTime.Equal(genesisTime) ||
+				got.Signaling != test.wantSignaling ||
+				uint64(got.Window) != params.BlockUpgradeNumToCheck ||
+				uint64(got.EnforceThreshold) != params.BlockEnforceNumRequired ||
+				uint64(got.RejectThreshold) != params.BlockRejectNumRequired {
+
+				t.Errorf("%s: unexpected version rollout %+v",
+					test.name, got)
+			}
+		}
+
+		if cached, _ := chain.UpgradeStatus(); cached != status {
+			t.Errorf("%s: status was not cached", test.name)
+		}
+	}
+
+	// A chain loaded from a database which already contains the blocks
+	// restores the tally from the states stored along with them, which
+	// must yield the same status as the one maintained as the blocks were
+	// connected.
+	dir, err := ioutil.TempDir("", "upgradestatus")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := database.Create("ffldb", dir, blockDataNet)
+	if err != nil {
+		t.Fatalf("unable to create database: %v", err)
+	}
+	defer db.Close()
+	newChain := func() *blockchain.BlockChain {
+		chain, err := blockchain.New(&blockchain.Config{
+			DB:          db,
+			ChainParams: &params,
+			TimeSource:  blockchain.NewMedianTime(),
+			SigCache:    txscript.NewSigCache(1000),
+		})
+		if err != nil {
+			t.Fatalf("failed to create chain instance: %v", err)
+		}
+		return chain
+	}
+	processTestBlocks(t, "loaded", newChain(), blocks[:activationHeight+2])
+	loadedStatus, err := newChain().UpgradeStatus()
+	if err != nil {
+		t.Fatalf("loaded: unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(loadedStatus, status) {
+		t.Errorf("loaded: got status %+v, want %+v", loadedStatus, status)
+	}
+}
+
+// TestVersionRolloutStates ensures the version rollouts are enforced and then
+// active once enough of the most recent blocks have at least their version and
+// fall back once the blocks with older versions push them out of the window.
+func TestVersionRolloutStates(t *testing.T) {
+	params := &chaincfg.SimNetParams
+	versions := func(runs ...uint32) []uint32 {
+		// The runs are pairs of a block version and a number of
+		// blocks following the version 1 genesis block.
+		result := []uint32{1}
+		for i := 0; i < len(runs); i += 2 {
+			for j := uint32(0); j < runs[i+1]; j++ {
+				result = append(result, runs[i])
+			}
+		}
+		return result
+	}
+
+	defined := blockchain.DeploymentDefined
+	enforced := blockchain.DeploymentEnforced
+	active := blockchain.DeploymentActive
+	tests := []struct {
+		name       string
+		versions   []uint32
+		wantStates []blockchain.DeploymentState
+		wantSince  []uint32
+	}{
+		{
+			name:       "below enforce threshold",
+			versions:   versions(3, 50),
+			wantStates: []blockchain.DeploymentState{defined, defined, defined},
+			wantSince:  []uint32{0, 0, 0},
+		},
+		{
+			name:       "enforce threshold",
+			versions:   versions(3, 51),
+			wantStates: []blockchain.DeploymentState{enforced, enforced, defined},
+			wantSince:  []uint32{52, 52, 0},
+		},
+		{
+			name:       "reject threshold",
+			versions:   versions(3, 75),
+			wantStates: []blockchain.DeploymentState{active, active, defined},
+			wantSince:  []uint32{76, 76, 0},
+		},
+		{
+			name:       "newer version counts",
+			versions:   versions(2, 60, 4, 20),
+			wantStates: []blockchain.DeploymentState{active, defined, defined},
+			wantSince:  []uint32{76, 0, 0},
+		},
+		{
+			name:       "older versions push out",
+			versions:   versions(3, 100, 1, 25),
+			wantStates: []blockchain.DeploymentState{active, active, defined},
+			wantSince:  []uint32{76, 76, 0},
+		},
+		{
+			name:       "below reject threshold",
+			versions:   versions(3, 100, 1, 26),
+			wantStates: []blockchain.DeploymentState{enforced, enforced, defined},
+			wantSince:  []uint32{127, 127, 0},
+		},
+	}
+
+	// Disconnecting blocks must restore the states, including those which
+	// changed while the blocks were connected, and the blocks which enter
+	// the window again.
+	var disconnected []uint32
+	for _, version := range []uint32{4, 1, 4} {
+		for i := 0; i < 80; i++ {
+			disconnected = append(disconnected, version)
+		}
+	}
+
+	for _, test := range tests {
+		states, since := blockchain.TstVersionRolloutStates(params,
+			test.versions, 0)
+		if !reflect.DeepEqual(states, test.wantStates) ||
+			!reflect.DeepEqual(since, test.wantSince) {
+
+			t.Errorf("%s: got states %v since %v, want %v since %v",
+				test.name, states, since, test.wantStates,
+				test.wantSince)
+		}
+
+		versions := append(append([]uint32(nil), test.versions...),
+			disconnected...)
+		states, since = blockchain.TstVersionRolloutStates(params,
+			versions, len(disconnected))
+		if !reflect.DeepEqual(states, test.wantStates) ||
+			!reflect.DeepEqual(since, test.wantSince) {
+
+			t.Errorf("%s: got states %v since %v after "+
+				"disconnecting blocks, want %v since %v",
+				test.name, states, since, test.wantStates,
+				test.wantSince)
+		}
+	}
+}
@@ -7,9 +7,11 @@
 package blockchain
 
 import (
-	"github.com/bitgo/prova/chaincfg/chainhash"
 	"math/big"
 	"time"
+
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
 )
 
 var (
@@ -162,91 +164,137 @@ func (b *BlockChain) calcEasiestDifficulty(bits uint32, duration time.Duration)
 	return b.chainParams.PowLimitBits
 }
 
-// calcNextRequiredDifficulty calculates the required difficulty for the block
-// after the passed previous block node based on the difficulty retarget rules.
-// This function differs from the exported CalcNextRequiredDifficulty in that
-// the exported version uses the current best chain as the previous block node
-// while this function accepts any block node.
+// DifficultyWindow describes the averaging window of the difficulty adjustment
+// for the block after the end of a chain.
+type DifficultyWindow struct {
+	// Blocks is the number of blocks the difficulty is averaged over.  It
+	// is less than the PowAveragingWindow of the chain parameters while the
+	// chain is too short to fill the window.
+	Blocks int
+
+	// ActualTimespan is the time between the past median times of the
+	// blocks at the start and the end of the window.  It is zero while the
+	// window is not filled.
+	ActualTimespan time.Duration
+
+	// TargetTimespan is the time the blocks of the window are expected to
+	// take per the chain parameters.
+	TargetTimespan time.Duration
+
+	// NextBits is the required difficulty of the next block in compact
+	// form.
+	NextBits uint32
+}
+
+// CalcWindowDifficulty calculates the required difficulty for the block after
+// an averaging window of blocks with the passed difficulty bits whose first and
+// last blocks have the passed past median times.  The target difficulty is the
+// average target of the window scaled by the ratio of the actual timespan of
+// the window, dampened and limited per the chain parameters, to its target
+// timespan.  The median times must be used to prevent time-warp attacks.
+func CalcWindowDifficulty(params *chaincfg.Params, firstMedianTime, lastMedianTime time.Time, windowBits []uint32) uint32 {
+	if len(windowBits) == 0 {
+		return params.PowLimitBits
+	}
+
+	avgDifficulty := big.NewInt(0)
+	for _, bits := range windowBits {
+		avgDifficulty.Add(avgDifficulty, CompactToBig(bits))
+	}
+	avgDifficulty.Div(avgDifficulty, big.NewInt(int64(len(windowBits))))
+
+	// Limit adjustment step
+	timespan := lastMedianTime.Sub(firstMedianTime)
+
+	// Limit the amount of adjustment that can occur to the previous
+	// difficulty.
+	timespan = params.AveragingWindowTimespan() +
+		(timespan-params.AveragingWindowTimespan())/4
+	if timespan < params.MinActualTimespan() {
+		timespan = params.MinActualTimespan()
+	} else if timespan > params.MaxActualTimespan() {
+		timespan = params.MaxActualTimespan()
+	}
+
+	// Calculate new target difficulty as:
+	//  averageDifficulty / averagingWindowTimespan * timespan
+	// The result uses integer division which means it will be slightly
+	// rounded down.
+	avgWindowTimespan := big.NewInt(int64(params.AveragingWindowTimespan() / time.Millisecond))
+	avgDifficulty.Div(avgDifficulty, avgWindowTimespan)
+	avgDifficulty.Mul(avgDifficulty, big.NewInt(int64(timespan/time.Millisecond)))
+
+	// Limit new value to the proof of work limit.
+	if avgDifficulty.Cmp(params.PowLimit) > 0 {
+		avgDifficulty.Set(params.PowLimit)
+	}
+
+	return BigToCompact(avgDifficulty)
+}
+
+// calcDifficultyWindow returns the averaging window of the difficulty
+// adjustment for the block after the passed previous block node.
 //
 // This function MUST be called with the chain state lock held (for writes).
-func (b *BlockChain) calcNextRequiredDifficulty(lastNode *blockNode) (uint32, error) {
+func (b *BlockChain) calcDifficultyWindow(lastNode *blockNode) (*DifficultyWindow, error) {
+	window := &DifficultyWindow{
+		TargetTimespan: b.chainParams.AveragingWindowTimespan(),
+		NextBits:       b.chainParams.PowLimitBits,
+	}
+
 	// Genesis block.
 	if lastNode == nil {
-		return b.chainParams.PowLimitBits, nil
+		return window, nil
 	}
 
-	// Find the first node in the averaging interval, sum the total bits
+	// Find the first node in the averaging interval, collecting the bits
 	// to use when averaging the difficulty over the interval.
 	firstNode := lastNode
-	avgDifficulty := big.NewInt(0)
+	windowBits := make([]uint32, 0, b.chainParams.PowAveragingWindow)
 	var err error
 	for i := 0; firstNode != nil && i < b.chainParams.PowAveragingWindow; i++ {
-		avgDifficulty.Add(avgDifficulty, CompactToBig(firstNode.bits))
+		windowBits = append(windowBits, firstNode.bits)
 
 		firstNode, err = b.getPrevNodeFromNode(firstNode)
-
 		if err != nil {
-			return 0, err
+			return nil, err
 		}
 	}
+	window.Blocks = len(windowBits)
 
 	// Exit early when there are not enough nodes to fill the window.
 	if firstNode == nil {
-		return b.chainParams.PowLimitBits, nil
+		return window, nil
 	}
 
-	avgDifficulty.Div(avgDifficulty, big.NewInt(int64(b.chainParams.PowAveragingWindow)))
-
-	var medianFirstNodeTime time.Time
-
-	medianFirstNodeTime, err = b.calcPastMedianTime(firstNode)
-
+	medianFirstNodeTime, err := b.calcPastMedianTime(firstNode)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-
-	var medianLastNodeTime time.Time
-
-	medianLastNodeTime, err = b.calcPastMedianTime(lastNode)
-
+	medianLastNodeTime, err := b.calcPastMedianTime(lastNode)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	return b.nextRequiredDifficulty(medianFirstNodeTime, medianLastNodeTime, avgDifficulty), nil
+	window.ActualTimespan = medianLastNodeTime.Sub(medianFirstNodeTime)
+	window.NextBits = CalcWindowDifficulty(b.chainParams,
+		medianFirstNodeTime, medianLastNodeTime, windowBits)
+	return window, nil
 }
 
-// nextRequiredDifficulty calculates the required difficulty for the block
-// after the passed previous block node based on a moving difficulty window.
-func (b *BlockChain) nextRequiredDifficulty(firstNodeTime time.Time, lastNodeTime time.Time, avgDifficulty *big.Int) uint32 {
-	// Limit adjustment step
-	// Make sure to use medians to prevent time-warp attacks
-	timespan := time.Duration(lastNodeTime.UnixNano() - firstNodeTime.UnixNano())
-
-	// Limit the amount of adjustment that can occur to the previous
-	// difficulty.
-	timespan = b.chainParams.AveragingWindowTimespan() +
-		(timespan-b.chainParams.AveragingWindowTimespan())/4
-	if timespan < b.chainParams.MinActualTimespan() {
-		timespan = b.chainParams.MinActualTimespan()
-	} else if timespan > b.chainParams.MaxActualTimespan() {
-		timespan = b.chainParams.MaxActualTimespan()
-	}
-
-	// Calculate new target difficulty as:
-	//  averageDifficulty / averagingWindowTimespan * timespan
-	// The result uses integer division which means it will be slightly
-	// rounded down.
-	avgWindowTimespan := big.NewInt(int64(b.chainParams.AveragingWindowTimespan() / time.Millisecond))
-	avgDifficulty.Div(avgDifficulty, avgWindowTimespan)
-	avgDifficulty.Mul(avgDifficulty, big.NewInt(int64(timespan/time.Millisecond)))
-
-	// Limit new value to the proof of work limit.
-	if avgDifficulty.Cmp(b.chainParams.PowLimit) > 0 {
-		avgDifficulty.Set(b.chainParams.PowLimit)
+// calcNextRequiredDifficulty calculates the required difficulty for the block
+// after the passed previous block node based on the difficulty retarget rules.
+// This function differs from the exported CalcNextRequiredDifficulty in that
+// the exported version uses the current best chain as the previous block node
+// while this function accepts any block node.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) calcNextRequiredDifficulty(lastNode *blockNode) (uint32, error) {
+	window, err := b.calcDifficultyWindow(lastNode)
+	if err != nil {
+		return 0, err
 	}
-
-	return BigToCompact(avgDifficulty)
+	return window.NextBits, nil
 }
 
 // CalcNextRequiredDifficulty calculates the required difficulty for the block
@@ -260,3 +308,15 @@ func (b *BlockChain) CalcNextRequiredDifficulty() (uint32, error) {
 	b.chainLock.Unlock()
 	return difficulty, err
 }
+
+// CalcDifficultyWindow returns the averaging window of the difficulty
+// adjustment for the block after the end of the current best chain, including
+// the required difficulty of that block.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) CalcDifficultyWindow() (*DifficultyWindow, error) {
+	b.chainLock.Lock()
+	window, err := b.calcDifficultyWindow(b.bestNode)
+	b.chainLock.Unlock()
+	return window, err
+}
@@ -8,8 +8,10 @@ package blockchain_test
 import (
 	"math/big"
 	"testing"
+	"time"
 
 	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/chaincfg"
 )
 
 func TestBigToCompact(t *testing.T) {
@@ -70,3 +72,71 @@ func TestCalcWork(t *testing.T) {
 		}
 	}
 }
+
+// TestCalcWindowDifficulty ensures the required difficulty after averaging
+// windows of synthetic headers is dampened and limited per the main network
+// parameters.
+func TestCalcWindowDifficulty(t *testing.T) {
+	params := &chaincfg.MainNetParams
+	windowBits := func(bits ...uint32) []uint32 {
+		window := make([]uint32, 0, params.PowAveragingWindow)
+		for len(window) < params.PowAveragingWindow {
+			window = append(window, bits...)
+		}
+		return window[:params.PowAveragingWindow]
+	}
+	firstTime := time.Unix(1500000000, 0)
+	tests := []struct {
+		name     string
+		timespan time.Duration
+		bits     []uint32
+		want     uint32
+	}{
+		{
+			name:     "empty window",
+			timespan: params.AveragingWindowTimespan(),
+			bits:     nil,
+			want:     params.PowLimitBits,
+		},
+		{
+			name:     "on target",
+			timespan: params.AveragingWindowTimespan(),
+			bits:     windowBits(0x1d00ffff),
+			want:     0x1d00fffe,
+		},
+		{
+			name:     "too fast",
+			timespan: 0,
+			bits:     windowBits(0x1d00ffff),
+			want:     0x1d00d709,
+		},
+		{
+			name:     "too slow",
+			timespan: time.Hour * 24,
+			bits:     windowBits(0x1d00ffff),
+			want:     0x1d0151ea,
+		},
+		{
+			name:     "mixed bits",
+			timespan: time.Second * 5000,
+			bits: append(windowBits(0x1d00ffff)[:15],
+				windowBits(0x1c7fffff)[:16]...),
+			want: 0x1d00c181,
+		},
+		{
+			name:     "pow limit",
+			timespan: time.Hour * 24,
+			bits:     windowBits(params.PowLimitBits),
+			want:     params.PowLimitBits,
+		},
+	}
+
+	for _, test := range tests {
+		got := blockchain.CalcWindowDifficulty(params, firstTime,
+			firstTime.Add(test.timespan), test.bits)
+		if got != test.want {
+			t.Errorf("%s: unexpected bits - got %08x, want %08x",
+				test.name, got, test.want)
+		}
+	}
+}
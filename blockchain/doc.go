@@ -25,7 +25,10 @@ Since this package does not deal with other bitcoin specifics such as network
 communication or wallets, it provides a notification system which gives the
 caller a high level of flexibility in how they want to react to certain events
 such as orphan blocks which need their parents requested and newly connected
-main chain blocks which might result in wallet updates.
+main chain blocks which might result in wallet updates.  Besides a
+synchronous callback, notifications are delivered to the subscribers of a
+Notifier through buffered per-subscriber queues, so slow subscribers never
+hold up block processing.
 
 Bitcoin Chain Processing Overview
 
@@ -219,6 +219,24 @@ const (
 	// ErrFeeTooHigh indicates a transaction fee exceeds the limit for
 	// fee paid.
 	ErrFeeTooHigh
+
+	// ErrDisconnectedHeaders indicates a series of block headers does not
+	// form a chain which connects to a known block.
+	ErrDisconnectedHeaders
+
+	// ErrReorgTooDeep indicates a side chain with more work than the main
+	// chain would require a reorganization which disconnects more blocks
+	// than the maximum allowed reorganization depth.
+	ErrReorgTooDeep
+
+	// ErrPrevBlockNotBest indicates a block template does not build on
+	// the current tip of the main chain.
+	ErrPrevBlockNotBest
+
+	// ErrInvalidAncestorBlock indicates a block extends a branch which
+	// contains a block that is known to be invalid, either because it
+	// failed validation or because it was invalidated manually.
+	ErrInvalidAncestorBlock
 )
 
 // Map of ErrorCode values back to their constant names for pretty printing.
@@ -269,6 +287,10 @@ var errorCodeStrings = map[ErrorCode]string{
 	ErrInvalidAdminTx:       "ErrInvalidAdminTx",
 	ErrInvalidAdminOp:       "ErrInvalidAdminOp",
 	ErrFeeTooHigh:           "ErrFeeTooHigh",
+	ErrDisconnectedHeaders:  "ErrDisconnectedHeaders",
+	ErrReorgTooDeep:         "ErrReorgTooDeep",
+	ErrPrevBlockNotBest:     "ErrPrevBlockNotBest",
+	ErrInvalidAncestorBlock: "ErrInvalidAncestorBlock",
 }
 
 // String returns the ErrorCode as a human-readable name.
@@ -60,6 +60,10 @@ func TestErrorCodeStringer(t *testing.T) {
 		{blockchain.ErrInconsistentBlkSize, "ErrInconsistentBlkSize"},
 		{blockchain.ErrInvalidValidateKey, "ErrInvalidValidateKey"},
 		{blockchain.ErrFeeTooHigh, "ErrFeeTooHigh"},
+		{blockchain.ErrDisconnectedHeaders, "ErrDisconnectedHeaders"},
+		{blockchain.ErrReorgTooDeep, "ErrReorgTooDeep"},
+		{blockchain.ErrPrevBlockNotBest, "ErrPrevBlockNotBest"},
+		{blockchain.ErrInvalidAncestorBlock, "ErrInvalidAncestorBlock"},
 		{0xffff, "Unknown ErrorCode (65535)"},
 	}
 
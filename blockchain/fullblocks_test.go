@@ -15,6 +15,7 @@ import (
 	"github.com/bitgo/prova/chaincfg/chainhash"
 	"github.com/bitgo/prova/provautil"
 	"github.com/bitgo/prova/wire"
+	"reflect"
 	"testing"
 )
 
@@ -36,6 +37,21 @@ func TestFullBlocks(t *testing.T) {
 	}
 	defer teardownFunc()
 
+	// testUtxoSetStats ensures the incrementally maintained utxo set
+	// statistics match the ones calculated by scanning the utxo set.
+	testUtxoSetStats := func(name string) {
+		stats := chain.UtxoSetStats()
+		wantStats, err := chain.CalcUtxoSetStats()
+		if err != nil {
+			t.Fatalf("block %q: unexpected error calculating utxo "+
+				"set stats: %v", name, err)
+		}
+		if !reflect.DeepEqual(stats, wantStats) {
+			t.Fatalf("block %q: mismatched utxo set stats -- got "+
+				"%+v, want %+v", name, stats, wantStats)
+		}
+	}
+
 	// testAcceptedBlock attempts to process the block in the provided test
 	// instance and ensures that it was accepted according to the flags
 	// specified in the test.
@@ -68,6 +84,8 @@ func TestFullBlocks(t *testing.T) {
 				item.IsOrphan)
 		}
 
+		testUtxoSetStats(item.Name)
+
 		// Check Thread Tips
 		if chain.ThreadTips()[provautil.RootThread].String() != item.ThreadTips[provautil.RootThread].String() {
 			t.Fatalf("block %q (hash %s, height %d) should "+
@@ -224,6 +242,7 @@ func TestFullBlocks(t *testing.T) {
 				item.Name, block.Hash(), blockHeight, best.Hash,
 				best.Height)
 		}
+		testUtxoSetStats(item.Name)
 	}
 
 	for testNum, test := range tests {
@@ -510,6 +510,66 @@ func createSpendTx(spend *spendableOut, fee provautil.Amount) *wire.MsgTx {
 	return spendTx
 }
 
+// timeLockScript returns a script which locks the passed Prova script with the
+// passed lock checked by the passed opcode, which is either
+// OP_CHECKLOCKTIMEVERIFY or OP_CHECKSEQUENCEVERIFY.
+func timeLockScript(lock int64, lockOp byte, provaScript []byte) []byte {
+	script, err := txscript.NewScriptBuilder().AddInt64(lock).
+		AddOp(lockOp).AddOp(txscript.OP_DROP).AddOps(provaScript).Script()
+	if err != nil {
+		panic(err)
+	}
+	return script
+}
+
+// createTimeLockTx creates a transaction that spends from the provided
+// spendable output to an output with the passed lock checked by the passed
+// opcode, which is either OP_CHECKLOCKTIMEVERIFY or OP_CHECKSEQUENCEVERIFY.
+func createTimeLockTx(spend *spendableOut, lockOp byte, lock uint32) *wire.MsgTx {
+	spendTx := wire.NewMsgTx(1)
+	spendTx.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: spend.prevOut,
+		Sequence:         wire.MaxTxInSequenceNum,
+		SignatureScript:  nil,
+	})
+
+	provaScript, _ := txscript.PayToAddrScript(makeAddr(nil, nil))
+	spendTx.AddTxOut(wire.NewTxOut(int64(spend.amount),
+		timeLockScript(int64(lock), lockOp, provaScript)))
+
+	sigScript, _ := txscript.SignTxOutput(&chaincfg.RegressionNetParams, spendTx,
+		0, int64(spend.amount), spend.pkScript, txscript.SigHashAll, txscript.KeyClosure(lookupKey), nil)
+	spendTx.TxIn[0].SignatureScript = sigScript
+
+	return spendTx
+}
+
+// createTimeLockSpendTx creates a transaction with the passed version and lock
+// time that spends the time-locked output at the passed index of the provided
+// transaction with the passed input sequence number.
+func createTimeLockSpendTx(lockTx *wire.MsgTx, txOutIndex uint32, version int32, lockTime, sequence uint32) *wire.MsgTx {
+	txOut := lockTx.TxOut[txOutIndex]
+	spendTx := wire.NewMsgTx(version)
+	spendTx.LockTime = lockTime
+	spendTx.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{
+			Hash:  lockTx.TxHash(),
+			Index: txOutIndex,
+		},
+		Sequence:        sequence,
+		SignatureScript: nil,
+	})
+
+	scriptPkScript, _ := txscript.PayToAddrScript(makeAddr(nil, nil))
+	spendTx.AddTxOut(wire.NewTxOut(txOut.Value, scriptPkScript))
+
+	sigScript, _ := txscript.SignTxOutput(&chaincfg.RegressionNetParams, spendTx,
+		0, txOut.Value, txOut.PkScript, txscript.SigHashAll, txscript.KeyClosure(lookupKey), nil)
+	spendTx.TxIn[0].SignatureScript = sigScript
+
+	return spendTx
+}
+
 // createAdminTx creates an admin tx.
 func createAdminTx(spend *spendableOut, threadID provautil.ThreadID, op byte, pubKey *btcec.PublicKey) *wire.MsgTx {
 	spendTx := wire.NewMsgTx(1)
@@ -1157,5 +1217,70 @@ func Generate(includeLargeReorg bool) (tests [][]TestInstance, err error) {
 	g.nextBlock("b31", outs[12], changeCoinbaseValue(1))
 	rejected(blockchain.ErrBadCoinbaseValue)
 
+	// ---------------------------------------------------------------------
+	// Time lock tests.
+	// ---------------------------------------------------------------------
+
+	// Create an output which can only be spent in a block after the next
+	// one.  The CLTV deployment is always active on the regression test
+	// network, so the output is accepted.
+	//
+	//   ... -> b27(11) -> b32(12)
+	g.setTip("b27")
+	lockHeight := g.tipHeight + 2
+	cltvTx := createTimeLockTx(outs[12], txscript.OP_CHECKLOCKTIMEVERIFY,
+		lockHeight)
+	g.nextBlock("b32", nil, additionalTx(cltvTx))
+	accepted()
+
+	// Create an output which can only be spent once it has two
+	// confirmations.
+	//
+	//   ... -> b32(12) -> b33(13)
+	timeLockTx := createTimeLockTx(outs[13], txscript.OP_CHECKSEQUENCEVERIFY, 2)
+	g.nextBlock("b33", nil, additionalTx(timeLockTx))
+	accepted()
+
+	// Attempt to spend the output in the next block, which is too early
+	// for both the relative lock time of the transaction and the one the
+	// output is locked by.
+	//
+	//   ... -> b33(13) -> b34
+	//                 \-> b35
+	g.nextBlock("b34", nil, additionalTx(createTimeLockSpendTx(timeLockTx,
+		0, 2, 0, 2)))
+	rejected(blockchain.ErrUnfinalizedTx)
+
+	g.setTip("b33")
+	g.nextBlock("b35", nil, additionalTx(createTimeLockSpendTx(timeLockTx,
+		0, 2, 0, 1)))
+	rejected(blockchain.ErrScriptValidation)
+
+	// Spend the output once it has two confirmations.
+	//
+	//   ... -> b33(13) -> b36(14) -> b37(15)
+	g.setTip("b33")
+	g.nextBlock("b36", nil)
+	accepted()
+
+	g.nextBlock("b37", nil, additionalTx(createTimeLockSpendTx(timeLockTx,
+		0, 2, 0, 2)))
+	accepted()
+
+	// Attempt to spend the output locked by a lock time with a transaction
+	// whose lock time is before the lock height, then spend it with one
+	// whose lock time is the lock height.
+	//
+	//   ... -> b37(15) -> b39(16)
+	//                 \-> b38
+	g.nextBlock("b38", nil, additionalTx(createTimeLockSpendTx(cltvTx,
+		0, 1, lockHeight-1, wire.MaxTxInSequenceNum-1)))
+	rejected(blockchain.ErrScriptValidation)
+
+	g.setTip("b37")
+	g.nextBlock("b39", nil, additionalTx(createTimeLockSpendTx(cltvTx,
+		0, 1, lockHeight, wire.MaxTxInSequenceNum-1)))
+	accepted()
+
 	return tests, nil
 }
@@ -40,17 +40,17 @@ const (
 	// levelOffset is the offset in the level key which identifes the level.
 	levelOffset = levelKeySize - 1
 
-	// addrKeyTypePubKeyHash is the address type in an address key which
-	// represents both a pay-to-pubkey-hash and a pay-to-pubkey address.
-	// This is done because both are identical for the purposes of the
-	// address index.
-	addrKeyTypePubKeyHash = 0
-
-	// addrKeyTypeScriptHash is the address type in an address key which
-	// represents a pay-to-script-hash address.  This is necessary because
-	// the hash of a pubkey address might be the same as that of a script
-	// hash.
-	addrKeyTypeScriptHash = 1
+	// addrIndexVersion is the version of the format of the address index
+	// entries.  Version 2 keys Prova addresses by the hash of the script
+	// paying to them instead of their public key hash.
+	addrIndexVersion = 2
+
+	// addrKeyTypeProvaScript is the address type in an address key which
+	// represents a standard Prova (aztec) address.  The hash of the key is
+	// the hash160 of the public key script paying to the address rather
+	// than the public key hash alone, since addresses which share a public
+	// key hash but differ in their key ids are distinct.
+	addrKeyTypeProvaScript = 2
 
 	// Size of a transaction entry.  It consists of 4 bytes block id + 4
 	// bytes offset + 4 bytes length.
@@ -108,7 +108,7 @@ var (
 //
 //   Field           Type      Size
 //   addr type       uint8     1 byte
-//   addr hash       hash160   20 bytes
+//   addr hash       hash160   20 bytes (of the public key script)
 //   level           uint8     1 byte
 //   -----
 //   Total: 22 bytes
@@ -569,9 +569,17 @@ func dbRemoveAddrIndexEntries(bucket internalBucket, addrKey [addrKeySize]byte,
 func addrToKey(addr provautil.Address) ([addrKeySize]byte, error) {
 	switch addr := addr.(type) {
 	case *provautil.AddressProva:
+		// Key the address by the script paying to it so the key ids
+		// are part of the key.  The script is always rebuilt from the
+		// address, so the key is the same whether it was extracted
+		// from a transaction or decoded from its string encoding.
+		pkScript, err := txscript.PayToProvaAddrScript(addr)
+		if err != nil {
+			return [addrKeySize]byte{}, err
+		}
 		var result [addrKeySize]byte
-		result[0] = addrKeyTypePubKeyHash
-		copy(result[1:], addr.ScriptAddress()[:])
+		result[0] = addrKeyTypeProvaScript
+		copy(result[1:], provautil.Hash160(pkScript))
 		return result, nil
 	}
 
@@ -626,6 +634,17 @@ func (idx *AddrIndex) NeedsInputs() bool {
 	return true
 }
 
+// Ensure the AddrIndex type implements the Versioner interface.
+var _ Versioner = (*AddrIndex)(nil)
+
+// Version returns the version of the format of the address index entries, so
+// an index built with an older format is rebuilt.
+//
+// This implements the Versioner interface.
+func (idx *AddrIndex) Version() uint32 {
+	return addrIndexVersion
+}
+
 // Init is only provided to satisfy the Indexer interface as there is nothing to
 // initialize for this index.
 //
@@ -999,6 +1018,12 @@ func NewAddrIndex(db database.DB, chainParams *chaincfg.Params) *AddrIndex {
 	}
 }
 
+// AddrIndexExists returns whether or not the address index has previously been
+// built in the provided database.
+func AddrIndexExists(db database.DB) (bool, error) {
+	return indexExists(db, addrIndexKey)
+}
+
 // DropAddrIndex drops the address index from the provided database if it
 // exists.
 func DropAddrIndex(db database.DB) error {
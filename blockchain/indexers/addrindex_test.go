@@ -8,8 +8,21 @@ package indexers
 import (
 	"bytes"
 	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"reflect"
 	"testing"
 
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/blockchain/fullblocktests"
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+	_ "github.com/bitgo/prova/database/ffldb"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/txscript"
 	"github.com/bitgo/prova/wire"
 )
 
@@ -275,3 +288,428 @@ nextTest:
 		}
 	}
 }
+
+// TestAddrToKey ensures Prova addresses are keyed by the script paying to them
+// so addresses which only differ in their key ids do not share a key.
+func TestAddrToKey(t *testing.T) {
+	t.Parallel()
+
+	params := &chaincfg.RegressionNetParams
+	pkHash := bytes.Repeat([]byte{0x01}, 20)
+	addr1, err := provautil.NewAddressProva(pkHash,
+		[]btcec.KeyID{1, 2}, params)
+	if err != nil {
+		t.Fatalf("NewAddressProva: unexpected error: %v", err)
+	}
+	addr2, err := provautil.NewAddressProva(pkHash,
+		[]btcec.KeyID{1, 3}, params)
+	if err != nil {
+		t.Fatalf("NewAddressProva: unexpected error: %v", err)
+	}
+
+	key1, err := addrToKey(addr1)
+	if err != nil {
+		t.Fatalf("addrToKey: unexpected error: %v", err)
+	}
+	key2, err := addrToKey(addr2)
+	if err != nil {
+		t.Fatalf("addrToKey: unexpected error: %v", err)
+	}
+	if key1 == key2 {
+		t.Fatalf("addrToKey: addresses with different key ids share "+
+			"key %x", key1)
+	}
+
+	// The key must be the same for the decoded string encoding of the
+	// address and the address extracted from the script paying to it.
+	decoded, err := provautil.DecodeAddress(addr1.EncodeAddress(), params)
+	if err != nil {
+		t.Fatalf("DecodeAddress: unexpected error: %v", err)
+	}
+	pkScript, err := txscript.PayToAddrScript(addr1)
+	if err != nil {
+		t.Fatalf("PayToAddrScript: unexpected error: %v", err)
+	}
+	_, addrs, _, err := txscript.ExtractPkScriptAddrs(pkScript, params)
+	if err != nil || len(addrs) != 1 {
+		t.Fatalf("ExtractPkScriptAddrs: unexpected result %v (err %v)",
+			addrs, err)
+	}
+	for _, addr := range []provautil.Address{decoded, addrs[0]} {
+		key, err := addrToKey(addr)
+		if err != nil {
+			t.Fatalf("addrToKey: unexpected error: %v", err)
+		}
+		if key != key1 {
+			t.Fatalf("addrToKey: mismatched key for %v - got %x, "+
+				"want %x", addr, key, key1)
+		}
+	}
+}
+
+// testChain houses a chain instance backed by a database in a temporary
+// directory along with the blocks processed into it.
+type testChain struct {
+	params *chaincfg.Params
+	db     database.DB
+	chain  *blockchain.BlockChain
+
+	// blocks houses every block processed into the chain regardless of
+	// whether or not it ended up in the main chain.
+	blocks []*wire.MsgBlock
+}
+
+// newTestChain returns a chain instance for the regression test network
+// backed by a new database in the passed directory.
+func newTestChain(t *testing.T, dir string, indexManager blockchain.IndexManager) *testChain {
+	params := &chaincfg.RegressionNetParams
+	db, err := database.Create("ffldb", dir, params.Net)
+	if err != nil {
+		t.Fatalf("unable to create database: %v", err)
+	}
+	tc := &testChain{params: params, db: db}
+	tc.chain = tc.newChain(t, indexManager)
+	return tc
+}
+
+// newChain returns a new chain instance which uses the database of the test
+// chain along with the passed index manager.
+func (tc *testChain) newChain(t *testing.T, indexManager blockchain.IndexManager) *blockchain.BlockChain {
+	config := blockchain.Config{
+		DB:          tc.db,
+		ChainParams: tc.params,
+		TimeSource:  blockchain.NewMedianTime(),
+		SigCache:    txscript.NewSigCache(1000),
+	}
+	if indexManager != nil {
+		config.IndexManager = indexManager
+	}
+	chain, err := blockchain.New(&config)
+	if err != nil {
+		t.Fatalf("unable to create chain: %v", err)
+	}
+	return chain
+}
+
+// processFullBlocks processes all of the blocks generated by the fullblocktests
+// package, which include several chain reorganizations, into the test chain.
+func (tc *testChain) processFullBlocks(t *testing.T, tests [][]fullblocktests.TestInstance) {
+	process := func(name string, msgBlock *wire.MsgBlock, height uint32, mustAccept bool) {
+		block := provautil.NewBlock(msgBlock)
+		block.SetHeight(height)
+		_, _, err := tc.chain.ProcessBlock(block, blockchain.BFNone)
+		if err != nil {
+			if mustAccept {
+				t.Fatalf("block %q should have been accepted: %v",
+					name, err)
+			}
+			return
+		}
+		tc.blocks = append(tc.blocks, msgBlock)
+	}
+
+	for _, test := range tests {
+		for _, item := range test {
+			switch item := item.(type) {
+			case fullblocktests.AcceptedBlock:
+				process(item.Name, item.Block, item.Height, true)
+			case fullblocktests.RejectedBlock:
+				process(item.Name, item.Block, item.Height, false)
+			case fullblocktests.OrphanOrRejectedBlock:
+				process(item.Name, item.Block, item.Height, false)
+			}
+		}
+	}
+}
+
+// pkScriptAddrs returns the encoded addresses the passed public key script pays
+// to.
+func pkScriptAddrs(pkScript []byte, params *chaincfg.Params) []string {
+	_, addrs, _, _ := txscript.ExtractPkScriptAddrs(pkScript, params)
+	encoded := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		encoded = append(encoded, addr.EncodeAddress())
+	}
+	return encoded
+}
+
+// expectedAddrTxns returns the hashes of the transactions in the main chain of
+// the test chain which involve each address, in the order they appear in the
+// chain.  It also returns every address involved in any processed block so
+// addresses that only appear in blocks which were reorganized away can be
+// checked as well.
+func (tc *testChain) expectedAddrTxns(t *testing.T) (map[string][]chainhash.Hash, []string) {
+	seenAddrs := make(map[string]struct{})
+	var allAddrs []string
+	addAddrs := func(addrs []string) {
+		for _, addr := range addrs {
+			if _, ok := seenAddrs[addr]; !ok {
+				seenAddrs[addr] = struct{}{}
+				allAddrs = append(allAddrs, addr)
+			}
+		}
+	}
+	for _, block := range tc.blocks {
+		for _, tx := range block.Transactions {
+			for _, txOut := range tx.TxOut {
+				addAddrs(pkScriptAddrs(txOut.PkScript, tc.params))
+			}
+		}
+	}
+
+	expected := make(map[string][]chainhash.Hash)
+	mainTxns := make(map[chainhash.Hash]*wire.MsgTx)
+	best := tc.chain.BestSnapshot()
+	for height := uint32(0); height <= best.Height; height++ {
+		block, err := tc.chain.BlockByHeight(height)
+		if err != nil {
+			t.Fatalf("BlockByHeight: unexpected error: %v", err)
+		}
+		for _, tx := range block.Transactions() {
+			mainTxns[*tx.Hash()] = tx.MsgTx()
+		}
+		for txIdx, tx := range block.Transactions() {
+			var addrs []string
+			if txIdx != 0 {
+				for _, txIn := range tx.MsgTx().TxIn {
+					origin := &txIn.PreviousOutPoint
+					originTx, ok := mainTxns[origin.Hash]
+					if !ok {
+						continue
+					}
+					pkScript := originTx.TxOut[origin.Index].PkScript
+					addrs = append(addrs, pkScriptAddrs(pkScript,
+						tc.params)...)
+				}
+			}
+			for _, txOut := range tx.MsgTx().TxOut {
+				addrs = append(addrs, pkScriptAddrs(txOut.PkScript,
+					tc.params)...)
+			}
+
+			// Each transaction is only listed once per address.
+			for _, addr := range addrs {
+				txns := expected[addr]
+				if len(txns) > 0 && txns[len(txns)-1] == *tx.Hash() {
+					continue
+				}
+				expected[addr] = append(txns, *tx.Hash())
+			}
+		}
+	}
+
+	return expected, allAddrs
+}
+
+// checkAddrIndex ensures the passed address index returns exactly the
+// transactions of the main chain of the test chain for every address involved
+// in any processed block, both in order and in reverse order.
+func (tc *testChain) checkAddrIndex(t *testing.T, idx *AddrIndex) {
+	// fetchTxns queries the address index for the passed address and
+	// returns the hashes of the resulting transactions.
+	fetchTxns := func(addr provautil.Address, numToSkip, numRequested uint32, reverse bool) []chainhash.Hash {
+		var hashes []chainhash.Hash
+		err := tc.db.View(func(dbTx database.Tx) error {
+			regions, _, err := idx.TxRegionsForAddress(dbTx, addr,
+				numToSkip, numRequested, reverse)
+			if err != nil {
+				return err
+			}
+			serializedTxns, err := dbTx.FetchBlockRegions(regions)
+			if err != nil {
+				return err
+			}
+			for _, serializedTx := range serializedTxns {
+				var msgTx wire.MsgTx
+				err := msgTx.Deserialize(bytes.NewReader(serializedTx))
+				if err != nil {
+					return err
+				}
+				hashes = append(hashes, msgTx.TxHash())
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unable to fetch transactions for %v: %v", addr,
+				err)
+		}
+		return hashes
+	}
+
+	expected, allAddrs := tc.expectedAddrTxns(t)
+	if len(expected) == 0 {
+		t.Fatal("no addresses involved in the main chain")
+	}
+	for _, encoded := range allAddrs {
+		addr, err := provautil.DecodeAddress(encoded, tc.params)
+		if err != nil {
+			t.Fatalf("DecodeAddress: unexpected error: %v", err)
+		}
+
+		want := expected[encoded]
+		got := fetchTxns(addr, 0, math.MaxUint32, false)
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("mismatched transactions for %v - got %v, "+
+				"want %v", addr, got, want)
+		}
+
+		var wantReversed []chainhash.Hash
+		for i := len(want) - 1; i >= 0; i-- {
+			wantReversed = append(wantReversed, want[i])
+		}
+		got = fetchTxns(addr, 0, math.MaxUint32, true)
+		if !reflect.DeepEqual(got, wantReversed) {
+			t.Fatalf("mismatched reversed transactions for %v - "+
+				"got %v, want %v", addr, got, wantReversed)
+		}
+
+		// Ensure paging through the reversed transactions works as
+		// expected.
+		if len(want) > 2 {
+			got = fetchTxns(addr, 1, 2, true)
+			if !reflect.DeepEqual(got, wantReversed[1:3]) {
+				t.Fatalf("mismatched paged transactions for "+
+					"%v - got %v, want %v", addr, got,
+					wantReversed[1:3])
+			}
+		}
+	}
+}
+
+// TestAddrIndexReorg ensures the address index only contains the transactions
+// of the main chain after processing blocks which cause the chain to be
+// reorganized several times.
+func TestAddrIndexReorg(t *testing.T) {
+	tests, err := fullblocktests.Generate(false)
+	if err != nil {
+		t.Fatalf("failed to generate tests: %v", err)
+	}
+
+	dir, err := ioutil.TempDir("", "addrindexreorg")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	params := &chaincfg.RegressionNetParams
+	db, err := database.Create("ffldb", dir, params.Net)
+	if err != nil {
+		t.Fatalf("unable to create database: %v", err)
+	}
+	defer db.Close()
+	addrIndex := NewAddrIndex(db, params)
+	indexManager := NewManager(db, []Indexer{NewTxIndex(db), addrIndex})
+	tc := &testChain{params: params, db: db}
+	tc.chain = tc.newChain(t, indexManager)
+
+	tc.processFullBlocks(t, tests)
+	tc.checkAddrIndex(t, addrIndex)
+}
+
+// TestAddrIndexBackfill ensures enabling the address index on an existing
+// chain catches it up to the current best chain and that the built index is
+// detected.
+func TestAddrIndexBackfill(t *testing.T) {
+	tests, err := fullblocktests.Generate(false)
+	if err != nil {
+		t.Fatalf("failed to generate tests: %v", err)
+	}
+
+	dir, err := ioutil.TempDir("", "addrindexbackfill")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Build the chain without any indexes.
+	tc := newTestChain(t, dir, nil)
+	defer tc.db.Close()
+	tc.processFullBlocks(t, tests)
+	exists, err := AddrIndexExists(tc.db)
+	if err != nil || exists {
+		t.Fatalf("AddrIndexExists: unexpected result %v (err %v) "+
+			"before building the index", exists, err)
+	}
+
+	// Load the chain again with the address index enabled, which catches
+	// the index up to the current best chain.
+	addrIndex := NewAddrIndex(tc.db, tc.params)
+	indexManager := NewManager(tc.db, []Indexer{NewTxIndex(tc.db),
+		addrIndex})
+	tc.chain = tc.newChain(t, indexManager)
+	tc.checkAddrIndex(t, addrIndex)
+
+	exists, err = AddrIndexExists(tc.db)
+	if err != nil || !exists {
+		t.Fatalf("AddrIndexExists: unexpected result %v (err %v) "+
+			"after building the index", exists, err)
+	}
+
+	// The index is no longer detected once it has been dropped.
+	if err := DropAddrIndex(tc.db); err != nil {
+		t.Fatalf("DropAddrIndex: unexpected error: %v", err)
+	}
+	exists, err = AddrIndexExists(tc.db)
+	if err != nil || exists {
+		t.Fatalf("AddrIndexExists: unexpected result %v (err %v) "+
+			"after dropping the index", exists, err)
+	}
+}
+
+// TestAddrIndexOutdated ensures an address index which was built before the
+// version of its format was recorded is dropped and rebuilt on load.
+func TestAddrIndexOutdated(t *testing.T) {
+	tests, err := fullblocktests.Generate(false)
+	if err != nil {
+		t.Fatalf("failed to generate tests: %v", err)
+	}
+
+	dir, err := ioutil.TempDir("", "addrindexoutdated")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tc := newTestChain(t, dir, nil)
+	defer tc.db.Close()
+	tc.processFullBlocks(t, tests)
+	tc.chain = tc.newChain(t, NewManager(tc.db, []Indexer{
+		NewTxIndex(tc.db), NewAddrIndex(tc.db, tc.params)}))
+
+	// Turn the index into one of the first version by removing its
+	// recorded version and adding an entry keyed by a public key hash.
+	var staleKey [addrKeySize]byte
+	staleKey[1] = 0x01
+	err = tc.db.Update(func(dbTx database.Tx) error {
+		meta := dbTx.Metadata()
+		err := meta.Bucket(indexTipsBucketName).Delete(
+			indexVersionKey(addrIndexKey))
+		if err != nil {
+			return err
+		}
+		return meta.Bucket(addrIndexKey).Put(staleKey[:], []byte{0})
+	})
+	if err != nil {
+		t.Fatalf("unable to downgrade the address index: %v", err)
+	}
+
+	// Loading the chain again rebuilds the index with the current format.
+	addrIndex := NewAddrIndex(tc.db, tc.params)
+	tc.chain = tc.newChain(t, NewManager(tc.db, []Indexer{
+		NewTxIndex(tc.db), addrIndex}))
+	tc.checkAddrIndex(t, addrIndex)
+	err = tc.db.View(func(dbTx database.Tx) error {
+		if dbTx.Metadata().Bucket(addrIndexKey).Get(staleKey[:]) != nil {
+			t.Error("stale address index entry was not removed")
+		}
+		version := dbFetchIndexerVersion(dbTx, addrIndexKey)
+		if version != addrIndexVersion {
+			t.Errorf("got address index version %d, want %d",
+				version, addrIndexVersion)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to check the address index: %v", err)
+	}
+}
@@ -0,0 +1,228 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"fmt"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/provautil"
+)
+
+const (
+	// blockStatsIndexName is the human-readable name for the index.
+	blockStatsIndexName = "block statistics index"
+
+	// blockStatsEntrySize is the size of a serialized block statistics
+	// index entry.
+	blockStatsEntrySize = 4 + 5*8 + 4*4
+)
+
+var (
+	// blockStatsIndexKey is the key of the block statistics index and the
+	// db bucket used to house it.
+	blockStatsIndexKey = []byte("blockstatsidx")
+)
+
+// -----------------------------------------------------------------------------
+// The block statistics index consists of an entry for every block in the main
+// chain which houses the fee and size statistics of the block.  The statistics
+// are calculated as blocks are connected using the view of the outputs the
+// block spends.  When the index is built for an existing chain, the values of
+// the spent outputs are recovered from the spend journal instead, so the index
+// does not depend on the transaction index.
+//
+// The serialized format for keys and values in the block statistics bucket is:
+//
+//   <hash> = <height><total fee><fee per kb><min rate><median rate><max rate>
+//            <num txns><num inputs><num outputs><total size>
+//
+//   Field           Type              Size
+//   hash            chainhash.Hash    32 bytes
+//   height          uint32            4 bytes
+//   total fee       int64             8 bytes
+//   fee per kb      int64             8 bytes
+//   min rate        int64             8 bytes
+//   median rate     int64             8 bytes
+//   max rate        int64             8 bytes
+//   num txns        uint32            4 bytes
+//   num inputs      uint32            4 bytes
+//   num outputs     uint32            4 bytes
+//   total size      uint32            4 bytes
+//   -----
+//   Total: 92 bytes
+// -----------------------------------------------------------------------------
+
+// serializeBlockStats returns the passed block statistics serialized according
+// to the format described above.
+func serializeBlockStats(stats *blockchain.BlockStats) []byte {
+	serialized := make([]byte, blockStatsEntrySize)
+	byteOrder.PutUint32(serialized[0:4], stats.Height)
+	byteOrder.PutUint64(serialized[4:12], uint64(stats.TotalFee))
+	byteOrder.PutUint64(serialized[12:20], uint64(stats.FeePerKB))
+	byteOrder.PutUint64(serialized[20:28], uint64(stats.MinFeeRate))
+	byteOrder.PutUint64(serialized[28:36], uint64(stats.MedianFeeRate))
+	byteOrder.PutUint64(serialized[36:44], uint64(stats.MaxFeeRate))
+	byteOrder.PutUint32(serialized[44:48], stats.NumTxns)
+	byteOrder.PutUint32(serialized[48:52], stats.NumInputs)
+	byteOrder.PutUint32(serialized[52:56], stats.NumOutputs)
+	byteOrder.PutUint32(serialized[56:60], stats.TotalSize)
+	return serialized
+}
+
+// deserializeBlockStats decodes the passed serialized block statistics for the
+// block with the provided hash.
+func deserializeBlockStats(hash *chainhash.Hash, serialized []byte) (*blockchain.BlockStats, error) {
+	if len(serialized) < blockStatsEntrySize {
+		return nil, errDeserialize("unexpected end of data")
+	}
+
+	return &blockchain.BlockStats{
+		Hash:          *hash,
+		Height:        byteOrder.Uint32(serialized[0:4]),
+		TotalFee:      int64(byteOrder.Uint64(serialized[4:12])),
+		FeePerKB:      int64(byteOrder.Uint64(serialized[12:20])),
+		MinFeeRate:    int64(byteOrder.Uint64(serialized[20:28])),
+		MedianFeeRate: int64(byteOrder.Uint64(serialized[28:36])),
+		MaxFeeRate:    int64(byteOrder.Uint64(serialized[36:44])),
+		NumTxns:       byteOrder.Uint32(serialized[44:48]),
+		NumInputs:     byteOrder.Uint32(serialized[48:52]),
+		NumOutputs:    byteOrder.Uint32(serialized[52:56]),
+		TotalSize:     byteOrder.Uint32(serialized[56:60]),
+	}, nil
+}
+
+// dbFetchBlockStats uses an existing database transaction to fetch the block
+// statistics for the provided block hash.  When there is no entry for the
+// provided hash, nil will be returned for the both the statistics and the
+// error.
+func dbFetchBlockStats(dbTx database.Tx, hash *chainhash.Hash) (*blockchain.BlockStats, error) {
+	bucket := dbTx.Metadata().Bucket(blockStatsIndexKey)
+	serialized := bucket.Get(hash[:])
+	if len(serialized) == 0 {
+		return nil, nil
+	}
+
+	stats, err := deserializeBlockStats(hash, serialized)
+	if err != nil {
+		return nil, database.Error{
+			ErrorCode: database.ErrCorruption,
+			Description: fmt.Sprintf("corrupt block statistics "+
+				"index entry for %s: %v", hash, err),
+		}
+	}
+
+	return stats, nil
+}
+
+// BlockStatsIndex implements an index of the fee and size statistics of every
+// block in the main chain.
+type BlockStatsIndex struct {
+	db database.DB
+}
+
+// Ensure the BlockStatsIndex type implements the Indexer interface.
+var _ Indexer = (*BlockStatsIndex)(nil)
+
+// Init is only provided to satisfy the Indexer interface as there is nothing to
+// initialize for this index.
+//
+// This is part of the Indexer interface.
+func (idx *BlockStatsIndex) Init() error {
+	// Nothing to do.
+	return nil
+}
+
+// Key returns the database key to use for the index as a byte slice.
+//
+// This is part of the Indexer interface.
+func (idx *BlockStatsIndex) Key() []byte {
+	return blockStatsIndexKey
+}
+
+// Name returns the human-readable name of the index.
+//
+// This is part of the Indexer interface.
+func (idx *BlockStatsIndex) Name() string {
+	return blockStatsIndexName
+}
+
+// Create is invoked when the indexer manager determines the index needs
+// to be created for the first time.  It creates the bucket for the block
+// statistics index.
+//
+// This is part of the Indexer interface.
+func (idx *BlockStatsIndex) Create(dbTx database.Tx) error {
+	_, err := dbTx.Metadata().CreateBucket(blockStatsIndexKey)
+	return err
+}
+
+// ConnectBlock is invoked by the index manager when a new block has been
+// connected to the main chain.  This indexer calculates and stores the
+// statistics for the passed block.  When no view is provided, which is the case
+// when the index is being caught up, the spent outputs are loaded from the
+// spend journal.
+//
+// This is part of the Indexer interface.
+func (idx *BlockStatsIndex) ConnectBlock(dbTx database.Tx, block *provautil.Block, view *blockchain.UtxoViewpoint) error {
+	if view == nil {
+		var err error
+		view, err = blockchain.FetchSpendJournalView(dbTx, block)
+		if err != nil {
+			return err
+		}
+	}
+
+	stats, err := blockchain.CalcBlockStats(block, view)
+	if err != nil {
+		return err
+	}
+
+	bucket := dbTx.Metadata().Bucket(blockStatsIndexKey)
+	return bucket.Put(block.Hash()[:], serializeBlockStats(stats))
+}
+
+// DisconnectBlock is invoked by the index manager when a block has been
+// disconnected from the main chain.  This indexer removes the statistics for
+// the passed block.
+//
+// This is part of the Indexer interface.
+func (idx *BlockStatsIndex) DisconnectBlock(dbTx database.Tx, block *provautil.Block, view *blockchain.UtxoViewpoint) error {
+	bucket := dbTx.Metadata().Bucket(blockStatsIndexKey)
+	return bucket.Delete(block.Hash()[:])
+}
+
+// BlockStats returns the statistics for the provided block hash from the block
+// statistics index.  When there is no entry for the provided hash, nil will be
+// returned for the both the statistics and the error.
+//
+// This function is safe for concurrent access.
+func (idx *BlockStatsIndex) BlockStats(hash *chainhash.Hash) (*blockchain.BlockStats, error) {
+	var stats *blockchain.BlockStats
+	err := idx.db.View(func(dbTx database.Tx) error {
+		var err error
+		stats, err = dbFetchBlockStats(dbTx, hash)
+		return err
+	})
+	return stats, err
+}
+
+// NewBlockStatsIndex returns a new instance of an indexer that is used to
+// maintain the fee and size statistics of every block in the main chain.
+//
+// It implements the Indexer interface which plugs into the IndexManager that in
+// turn is used by the blockchain package.  This allows the index to be
+// seamlessly maintained along with the chain.
+func NewBlockStatsIndex(db database.DB) *BlockStatsIndex {
+	return &BlockStatsIndex{db: db}
+}
+
+// DropBlockStatsIndex drops the block statistics index from the provided
+// database if it exists.
+func DropBlockStatsIndex(db database.DB) error {
+	return dropIndex(db, blockStatsIndexKey, blockStatsIndexName)
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+)
+
+// TestBlockStatsSerialization ensures serializing and deserializing block
+// statistics index entries works as expected.
+func TestBlockStatsSerialization(t *testing.T) {
+	t.Parallel()
+
+	hash := chainhash.Hash{0x01, 0x02, 0x03}
+	stats := &blockchain.BlockStats{
+		Hash:          hash,
+		Height:        12345,
+		TotalFee:      11500,
+		FeePerKB:      45000,
+		MinFeeRate:    5000,
+		MedianFeeRate: 11000,
+		MaxFeeRate:    120000,
+		NumTxns:       4,
+		NumInputs:     3,
+		NumOutputs:    6,
+		TotalSize:     1024,
+	}
+
+	serialized := serializeBlockStats(stats)
+	if len(serialized) != blockStatsEntrySize {
+		t.Fatalf("serializeBlockStats: unexpected size - got %d, "+
+			"want %d", len(serialized), blockStatsEntrySize)
+	}
+
+	gotStats, err := deserializeBlockStats(&hash, serialized)
+	if err != nil {
+		t.Fatalf("deserializeBlockStats: unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(gotStats, stats) {
+		t.Fatalf("deserializeBlockStats: mismatched stats - got %+v, "+
+			"want %+v", gotStats, stats)
+	}
+
+	// Ensure truncated entries are rejected.
+	_, err = deserializeBlockStats(&hash, serialized[:blockStatsEntrySize-1])
+	if !isDeserializeErr(err) {
+		t.Fatalf("deserializeBlockStats: did not receive expected "+
+			"deserialize error for truncated entry - got %v", err)
+	}
+}
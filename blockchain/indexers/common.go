@@ -28,6 +28,22 @@ type NeedsInputser interface {
 	NeedsInputs() bool
 }
 
+// HeadersOnlyer provides a generic interface for an indexer to specify that it
+// only requires the headers of the blocks it indexes.  While such an indexer is
+// being caught up, it is passed blocks which only consist of the header loaded
+// from the database rather than the full blocks.
+type HeadersOnlyer interface {
+	HeadersOnly() bool
+}
+
+// Versioner provides a generic interface for an indexer to specify the version
+// of the format of its entries.  Indexers which don't implement it are at
+// version 1.  An existing index which was built with an older version is
+// dropped and rebuilt by the index manager.
+type Versioner interface {
+	Version() uint32
+}
+
 // Indexer provides a generic interface for an indexer that is managed by an
 // index manager such as the Manager type provided by this package.
 type Indexer interface {
@@ -143,6 +143,98 @@ func indexDropKey(idxKey []byte) []byte {
 	return dropKey
 }
 
+// indexVersionKey returns the key for an index which houses the version of the
+// format of its entries.
+func indexVersionKey(idxKey []byte) []byte {
+	versionKey := make([]byte, len(idxKey)+1)
+	versionKey[0] = 'v'
+	copy(versionKey[1:], idxKey)
+	return versionKey
+}
+
+// dbPutIndexerVersion uses an existing database transaction to record the
+// version of the format of the entries of the given index.
+func dbPutIndexerVersion(dbTx database.Tx, idxKey []byte, version uint32) error {
+	serialized := make([]byte, 4)
+	byteOrder.PutUint32(serialized, version)
+
+	indexesBucket := dbTx.Metadata().Bucket(indexTipsBucketName)
+	return indexesBucket.Put(indexVersionKey(idxKey), serialized)
+}
+
+// dbFetchIndexerVersion uses an existing database transaction to retrieve the
+// version of the format of the entries of the provided index.  Indexes which
+// were created before their version was recorded are at version 1.
+func dbFetchIndexerVersion(dbTx database.Tx, idxKey []byte) uint32 {
+	indexesBucket := dbTx.Metadata().Bucket(indexTipsBucketName)
+	serialized := indexesBucket.Get(indexVersionKey(idxKey))
+	if len(serialized) < 4 {
+		return 1
+	}
+	return byteOrder.Uint32(serialized)
+}
+
+// maybeDropStaleIndexes drops each of the enabled indexes which was built with
+// an older version of the format of its entries, or whose tip is a block that
+// is no longer stored because its data was lost, so it is rebuilt from scratch
+// when the indexes are created and caught up.  An index tip which is not
+// stored can't be disconnected since that requires the data of the block.
+func (m *Manager) maybeDropStaleIndexes() error {
+	dropReasons := make([]string, len(m.enabledIndexes))
+	err := m.db.View(func(dbTx database.Tx) error {
+		// None of the indexes exist if the index tips bucket hasn't
+		// been created yet.
+		indexesBucket := dbTx.Metadata().Bucket(indexTipsBucketName)
+		if indexesBucket == nil {
+			return nil
+		}
+
+		for i, indexer := range m.enabledIndexes {
+			idxKey := indexer.Key()
+			if indexesBucket.Get(idxKey) == nil {
+				continue
+			}
+			version := dbFetchIndexerVersion(dbTx, idxKey)
+			if version < indexVersion(indexer) {
+				dropReasons[i] = "The format of the %s changed"
+				continue
+			}
+
+			hash, _, err := dbFetchIndexerTip(dbTx, idxKey)
+			if err != nil {
+				return err
+			}
+			hasBlock, err := dbTx.HasBlock(hash)
+			if err != nil {
+				return err
+			}
+			if !hasBlock {
+				dropReasons[i] = "The tip of the %s is no longer " +
+					"stored"
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for i, indexer := range m.enabledIndexes {
+		if dropReasons[i] == "" {
+			continue
+		}
+
+		log.Infof(dropReasons[i]+", so it will be rebuilt",
+			indexer.Name())
+		err := dropIndex(m.db, indexer.Key(), indexer.Name())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // maybeFinishDrops determines if each of the enabled indexes are in the middle
 // of being dropped and finishes dropping them when the are.  This is necessary
 // because dropping and index has to be done in several atomic steps rather than
@@ -213,6 +305,12 @@ func (m *Manager) maybeCreateIndexes(dbTx database.Tx) error {
 		if err != nil {
 			return err
 		}
+
+		// Record the version of the format the index is built with.
+		err = dbPutIndexerVersion(dbTx, idxKey, indexVersion(indexer))
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -237,6 +335,12 @@ func (m *Manager) Init(chain *blockchain.BlockChain) error {
 		return err
 	}
 
+	// Drop the indexes which were built with an older format or whose tip
+	// is no longer stored so they are rebuilt.
+	if err := m.maybeDropStaleIndexes(); err != nil {
+		return err
+	}
+
 	// Create the initial state for the indexes as needed.
 	err := m.db.Update(func(dbTx database.Tx) error {
 		// Create the bucket for the current tips as needed.
@@ -391,8 +495,21 @@ func (m *Manager) Init(chain *blockchain.BlockChain) error {
 		bestHeight)
 	for height := lowestHeight + 1; height <= bestHeight; height++ {
 		// Load the block for the height since it is required to index
-		// it.
-		block, err := chain.BlockByHeight(uint32(height))
+		// it.  Only the header is loaded when all of the indexes which
+		// need to be updated with the block only require the header.
+		headersOnly := true
+		for i, indexer := range m.enabledIndexes {
+			if indexerHeights[i] < height && !indexHeadersOnly(indexer) {
+				headersOnly = false
+				break
+			}
+		}
+		var block *provautil.Block
+		if headersOnly {
+			block, err = m.fetchHeaderBlock(chain, uint32(height))
+		} else {
+			block, err = chain.BlockByHeight(uint32(height))
+		}
 		if err != nil {
 			return err
 		}
@@ -445,6 +562,51 @@ func indexNeedsInputs(index Indexer) bool {
 	return false
 }
 
+// indexVersion returns the version of the format of the entries of the index.
+func indexVersion(index Indexer) uint32 {
+	if idx, ok := index.(Versioner); ok {
+		return idx.Version()
+	}
+
+	return 1
+}
+
+// indexHeadersOnly returns whether or not the index only needs the headers of
+// the blocks being indexed.
+func indexHeadersOnly(index Indexer) bool {
+	if idx, ok := index.(HeadersOnlyer); ok {
+		return idx.HeadersOnly()
+	}
+
+	return false
+}
+
+// fetchHeaderBlock loads the header of the main chain block at the passed
+// height from the database and returns it as a block without any transactions
+// for the indexes which only require the headers.
+func (m *Manager) fetchHeaderBlock(chain *blockchain.BlockChain, height uint32) (*provautil.Block, error) {
+	hash, err := chain.BlockHashByHeight(height)
+	if err != nil {
+		return nil, err
+	}
+
+	var msgBlock wire.MsgBlock
+	err = m.db.View(func(dbTx database.Tx) error {
+		headerBytes, err := dbTx.FetchBlockHeader(hash)
+		if err != nil {
+			return err
+		}
+		return msgBlock.Header.Deserialize(bytes.NewReader(headerBytes))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	block := provautil.NewBlock(&msgBlock)
+	block.SetHeight(height)
+	return block, nil
+}
+
 // dbFetchTx looks up the passed transaction hash in the transaction index and
 // loads it from the database.
 func dbFetchTx(dbTx database.Tx, hash *chainhash.Hash) (*wire.MsgTx, error) {
@@ -551,6 +713,18 @@ func NewManager(db database.DB, enabledIndexes []Indexer) *Manager {
 	}
 }
 
+// indexExists returns whether or not the index identified by the passed key has
+// been created in the provided database.
+func indexExists(db database.DB, idxKey []byte) (bool, error) {
+	var exists bool
+	err := db.View(func(dbTx database.Tx) error {
+		indexesBucket := dbTx.Metadata().Bucket(indexTipsBucketName)
+		exists = indexesBucket != nil && indexesBucket.Get(idxKey) != nil
+		return nil
+	})
+	return exists, err
+}
+
 // dropIndex drops the passed index from the database.  Since indexes can be
 // massive, it deletes the index in multiple database transactions in order to
 // keep memory usage to reasonable levels.  It also marks the drop in progress
@@ -558,14 +732,7 @@ func NewManager(db database.DB, enabledIndexes []Indexer) *Manager {
 // index can be used again.
 func dropIndex(db database.DB, idxKey []byte, idxName string) error {
 	// Nothing to do if the index doesn't already exist.
-	var needsDelete bool
-	err := db.View(func(dbTx database.Tx) error {
-		indexesBucket := dbTx.Metadata().Bucket(indexTipsBucketName)
-		if indexesBucket != nil && indexesBucket.Get(idxKey) != nil {
-			needsDelete = true
-		}
-		return nil
-	})
+	needsDelete, err := indexExists(db, idxKey)
 	if err != nil {
 		return err
 	}
@@ -627,14 +794,18 @@ func dropIndex(db database.DB, idxKey []byte, idxName string) error {
 		}
 	}
 
-	// Remove the index tip, index bucket, and in-progress drop flag now
-	// that all index entries have been removed.
+	// Remove the index tip, index version, index bucket, and in-progress
+	// drop flag now that all index entries have been removed.
 	err = db.Update(func(dbTx database.Tx) error {
 		meta := dbTx.Metadata()
 		indexesBucket := meta.Bucket(indexTipsBucketName)
 		if err := indexesBucket.Delete(idxKey); err != nil {
 			return err
 		}
+		err := indexesBucket.Delete(indexVersionKey(idxKey))
+		if err != nil {
+			return err
+		}
 
 		if err := meta.DeleteBucket(idxKey); err != nil {
 			return err
@@ -0,0 +1,234 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/wire"
+)
+
+const (
+	// sigKeyIDIndexName is the human-readable name for the index.
+	sigKeyIDIndexName = "sig key id index"
+
+	// SigKeyIDSize is the size of a sig key id, which is the hash160 of the
+	// validating public key which signed a block.
+	SigKeyIDSize = 20
+
+	// sigKeyIDKeySize is the size of a key in the sig key id index.  It
+	// consists of the sig key id + 4 bytes for the block height.
+	sigKeyIDKeySize = SigKeyIDSize + 4
+)
+
+var (
+	// sigKeyIDIndexKey is the key of the sig key id index and the db bucket
+	// used to house it.
+	sigKeyIDIndexKey = []byte("sigkeyididx")
+
+	// errInvalidSigKeyID is an error that is used to signal a sig key id
+	// of the wrong size has been used.
+	errInvalidSigKeyID = errors.New("sig key id must be 20 bytes")
+)
+
+// -----------------------------------------------------------------------------
+// The sig key id index consists of an entry for every block in the main chain
+// which maps the sig key id of the validating public key which signed the block
+// along with the height of the block to the hash of the block.  The height is
+// stored big endian, unlike the other numeric fields of the indexes, so the
+// entries of each sig key id are ordered by height which allows a range of
+// heights to be fetched with a cursor.
+//
+// Since the index only requires the block headers, only the headers are loaded
+// from the database when the index is built for an existing chain.
+//
+// The serialized format for keys and values in the sig key id bucket is:
+//
+//   <sig key id><height> = <hash>
+//
+//   Field           Type              Size
+//   sig key id      hash160           20 bytes
+//   height          uint32            4 bytes (big endian)
+//   hash            chainhash.Hash    32 bytes
+//   -----
+//   Total: 56 bytes
+// -----------------------------------------------------------------------------
+
+// SigKeyID returns the sig key id of the passed validating public key, which is
+// the hash160 of the key.
+func SigKeyID(pubKey wire.BlockValidatingPubKey) [SigKeyIDSize]byte {
+	var keyID [SigKeyIDSize]byte
+	copy(keyID[:], provautil.Hash160(pubKey[:]))
+	return keyID
+}
+
+// sigKeyIDIndexEntryKey returns the key of the entry in the sig key id index
+// for the block with the passed sig key id and height.
+func sigKeyIDIndexEntryKey(keyID []byte, height uint32) []byte {
+	key := make([]byte, sigKeyIDKeySize)
+	copy(key, keyID)
+	binary.BigEndian.PutUint32(key[SigKeyIDSize:], height)
+	return key
+}
+
+// SigKeyBlock identifies a main chain block signed by a validating public key.
+type SigKeyBlock struct {
+	Height uint32
+	Hash   chainhash.Hash
+}
+
+// dbFetchBlocksBySigKeyID uses an existing database transaction to fetch up to
+// limit blocks signed by the passed sig key id starting at the provided height
+// ordered by height.
+func dbFetchBlocksBySigKeyID(dbTx database.Tx, keyID []byte, startHeight uint32, limit int) ([]SigKeyBlock, error) {
+	var blocks []SigKeyBlock
+	cursor := dbTx.Metadata().Bucket(sigKeyIDIndexKey).Cursor()
+	seek := sigKeyIDIndexEntryKey(keyID, startHeight)
+	for ok := cursor.Seek(seek); ok && len(blocks) < limit; ok = cursor.Next() {
+		key := cursor.Key()
+		if len(key) != sigKeyIDKeySize ||
+			!bytes.Equal(key[:SigKeyIDSize], keyID) {
+
+			break
+		}
+
+		height := binary.BigEndian.Uint32(key[SigKeyIDSize:])
+		value := cursor.Value()
+		if len(value) != chainhash.HashSize {
+			return nil, database.Error{
+				ErrorCode: database.ErrCorruption,
+				Description: fmt.Sprintf("corrupt sig key id "+
+					"index entry for %x at height %d",
+					keyID, height),
+			}
+		}
+		block := SigKeyBlock{Height: height}
+		copy(block.Hash[:], value)
+		blocks = append(blocks, block)
+	}
+	return blocks, nil
+}
+
+// SigKeyIDIndex implements an index of the blocks in the main chain by the sig
+// key id of the validating public key which signed them.
+type SigKeyIDIndex struct {
+	db database.DB
+}
+
+// Ensure the SigKeyIDIndex type implements the Indexer interface.
+var _ Indexer = (*SigKeyIDIndex)(nil)
+
+// Ensure the SigKeyIDIndex type implements the HeadersOnlyer interface.
+var _ HeadersOnlyer = (*SigKeyIDIndex)(nil)
+
+// HeadersOnly signals that the index only requires the block headers in order
+// to properly create the index.
+//
+// This implements the HeadersOnlyer interface.
+func (idx *SigKeyIDIndex) HeadersOnly() bool {
+	return true
+}
+
+// Init is only provided to satisfy the Indexer interface as there is nothing to
+// initialize for this index.
+//
+// This is part of the Indexer interface.
+func (idx *SigKeyIDIndex) Init() error {
+	// Nothing to do.
+	return nil
+}
+
+// Key returns the database key to use for the index as a byte slice.
+//
+// This is part of the Indexer interface.
+func (idx *SigKeyIDIndex) Key() []byte {
+	return sigKeyIDIndexKey
+}
+
+// Name returns the human-readable name of the index.
+//
+// This is part of the Indexer interface.
+func (idx *SigKeyIDIndex) Name() string {
+	return sigKeyIDIndexName
+}
+
+// Create is invoked when the indexer manager determines the index needs
+// to be created for the first time.  It creates the bucket for the sig key id
+// index.
+//
+// This is part of the Indexer interface.
+func (idx *SigKeyIDIndex) Create(dbTx database.Tx) error {
+	_, err := dbTx.Metadata().CreateBucket(sigKeyIDIndexKey)
+	return err
+}
+
+// ConnectBlock is invoked by the index manager when a new block has been
+// connected to the main chain.  This indexer adds an entry for the sig key id
+// which signed the passed block.
+//
+// This is part of the Indexer interface.
+func (idx *SigKeyIDIndex) ConnectBlock(dbTx database.Tx, block *provautil.Block, view *blockchain.UtxoViewpoint) error {
+	header := &block.MsgBlock().Header
+	keyID := SigKeyID(header.ValidatingPubKey)
+	bucket := dbTx.Metadata().Bucket(sigKeyIDIndexKey)
+	return bucket.Put(sigKeyIDIndexEntryKey(keyID[:], header.Height),
+		block.Hash()[:])
+}
+
+// DisconnectBlock is invoked by the index manager when a block has been
+// disconnected from the main chain.  This indexer removes the entry for the
+// passed block.
+//
+// This is part of the Indexer interface.
+func (idx *SigKeyIDIndex) DisconnectBlock(dbTx database.Tx, block *provautil.Block, view *blockchain.UtxoViewpoint) error {
+	header := &block.MsgBlock().Header
+	keyID := SigKeyID(header.ValidatingPubKey)
+	bucket := dbTx.Metadata().Bucket(sigKeyIDIndexKey)
+	return bucket.Delete(sigKeyIDIndexEntryKey(keyID[:], header.Height))
+}
+
+// BlocksBySigKeyID returns up to limit main chain blocks signed by the
+// validating public key with the passed sig key id, starting at the provided
+// height and ordered by height.
+//
+// This function is safe for concurrent access.
+func (idx *SigKeyIDIndex) BlocksBySigKeyID(keyID []byte, startHeight uint32, limit int) ([]SigKeyBlock, error) {
+	if len(keyID) != SigKeyIDSize {
+		return nil, errInvalidSigKeyID
+	}
+
+	var blocks []SigKeyBlock
+	err := idx.db.View(func(dbTx database.Tx) error {
+		var err error
+		blocks, err = dbFetchBlocksBySigKeyID(dbTx, keyID, startHeight,
+			limit)
+		return err
+	})
+	return blocks, err
+}
+
+// NewSigKeyIDIndex returns a new instance of an indexer that is used to map
+// the sig key ids of the validating public keys to the main chain blocks they
+// signed.
+//
+// It implements the Indexer interface which plugs into the IndexManager that in
+// turn is used by the blockchain package.  This allows the index to be
+// seamlessly maintained along with the chain.
+func NewSigKeyIDIndex(db database.DB) *SigKeyIDIndex {
+	return &SigKeyIDIndex{db: db}
+}
+
+// DropSigKeyIDIndex drops the sig key id index from the provided database if
+// it exists.
+func DropSigKeyIDIndex(db database.DB) error {
+	return dropIndex(db, sigKeyIDIndexKey, sigKeyIDIndexName)
+}
@@ -0,0 +1,209 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/bitgo/prova/blockchain/fullblocktests"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/wire"
+)
+
+// checkSigKeyIDIndex ensures the passed sig key id index returns exactly the
+// main chain blocks of the test chain signed by each of the keys which signed
+// any of the processed blocks, so blocks which were reorganized away are not
+// included.
+func (tc *testChain) checkSigKeyIDIndex(t *testing.T, idx *SigKeyIDIndex) {
+	expected := make(map[[SigKeyIDSize]byte][]SigKeyBlock)
+	best := tc.chain.BestSnapshot()
+	for height := uint32(0); height <= best.Height; height++ {
+		block, err := tc.chain.BlockByHeight(height)
+		if err != nil {
+			t.Fatalf("BlockByHeight: unexpected error: %v", err)
+		}
+		keyID := SigKeyID(block.MsgBlock().Header.ValidatingPubKey)
+		expected[keyID] = append(expected[keyID], SigKeyBlock{
+			Height: height,
+			Hash:   *block.Hash(),
+		})
+	}
+
+	for _, block := range tc.blocks {
+		keyID := SigKeyID(block.Header.ValidatingPubKey)
+		want := expected[keyID]
+		got, err := idx.BlocksBySigKeyID(keyID[:], 0, math.MaxInt32)
+		if err != nil {
+			t.Fatalf("BlocksBySigKeyID: unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("mismatched blocks for sig key id %x - got %v, "+
+				"want %v", keyID, got, want)
+		}
+
+		// Ensure a range starting after the first block is returned
+		// as expected.
+		if len(want) > 2 {
+			got, err = idx.BlocksBySigKeyID(keyID[:],
+				want[0].Height+1, 2)
+			if err != nil {
+				t.Fatalf("BlocksBySigKeyID: unexpected error: %v",
+					err)
+			}
+			if !reflect.DeepEqual(got, want[1:3]) {
+				t.Fatalf("mismatched block range for sig key id "+
+					"%x - got %v, want %v", keyID, got,
+					want[1:3])
+			}
+		}
+	}
+}
+
+// TestSigKeyIDIndex ensures the sig key id index only contains the main chain
+// blocks after processing blocks which cause the chain to be reorganized
+// several times, and that it is built from the headers of an existing chain
+// when it is enabled.
+func TestSigKeyIDIndex(t *testing.T) {
+	tests, err := fullblocktests.Generate(false)
+	if err != nil {
+		t.Fatalf("failed to generate tests: %v", err)
+	}
+
+	dir, err := ioutil.TempDir("", "sigkeyidindex")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tc := newTestChain(t, dir, nil)
+	defer tc.db.Close()
+	sigKeyIDIndex := NewSigKeyIDIndex(tc.db)
+	tc.chain = tc.newChain(t, NewManager(tc.db,
+		[]Indexer{sigKeyIDIndex}))
+	tc.processFullBlocks(t, tests)
+	tc.checkSigKeyIDIndex(t, sigKeyIDIndex)
+
+	// Drop the index and ensure it is built again from the headers in the
+	// database.
+	if err := DropSigKeyIDIndex(tc.db); err != nil {
+		t.Fatalf("DropSigKeyIDIndex: unexpected error: %v", err)
+	}
+	sigKeyIDIndex = NewSigKeyIDIndex(tc.db)
+	tc.chain = tc.newChain(t, NewManager(tc.db,
+		[]Indexer{sigKeyIDIndex}))
+	tc.checkSigKeyIDIndex(t, sigKeyIDIndex)
+
+	// Ensure invalid sig key ids are rejected.
+	_, err = sigKeyIDIndex.BlocksBySigKeyID(make([]byte, SigKeyIDSize-1),
+		0, 1)
+	if err != errInvalidSigKeyID {
+		t.Fatalf("BlocksBySigKeyID: unexpected error for short sig key "+
+			"id - got %v, want %v", err, errInvalidSigKeyID)
+	}
+}
+
+// TestSigKeyIDIndexReorg ensures disconnecting blocks signed by one key and
+// connecting blocks signed by another key at the same heights removes the
+// detached blocks from the index.
+func TestSigKeyIDIndexReorg(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sigkeyidindexreorg")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := database.Create("ffldb", dir,
+		chaincfg.RegressionNetParams.Net)
+	if err != nil {
+		t.Fatalf("unable to create database: %v", err)
+	}
+	defer db.Close()
+	idx := NewSigKeyIDIndex(db)
+	if err := db.Update(idx.Create); err != nil {
+		t.Fatalf("Create: unexpected error: %v", err)
+	}
+
+	// makeBlock returns a block at the passed height which builds on the
+	// passed block and is signed by the passed key.
+	makeBlock := func(prev *provautil.Block, height uint32, pubKey byte) *provautil.Block {
+		var prevHash chainhash.Hash
+		if prev != nil {
+			prevHash = *prev.Hash()
+		}
+		header := wire.BlockHeader{PrevBlock: prevHash, Height: height}
+		header.ValidatingPubKey[0] = 0x02
+		header.ValidatingPubKey[1] = pubKey
+		block := provautil.NewBlock(&wire.MsgBlock{Header: header})
+		block.SetHeight(height)
+		return block
+	}
+	update := func(connect bool, blocks ...*provautil.Block) {
+		err := db.Update(func(dbTx database.Tx) error {
+			for _, block := range blocks {
+				var err error
+				if connect {
+					err = idx.ConnectBlock(dbTx, block, nil)
+				} else {
+					err = idx.DisconnectBlock(dbTx, block, nil)
+				}
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unable to update index: %v", err)
+		}
+	}
+
+	// Connect a chain signed by the first key, then reorganize the last
+	// two blocks away in favor of three blocks signed by the second key.
+	a1 := makeBlock(nil, 1, 0x01)
+	a2 := makeBlock(a1, 2, 0x01)
+	a3 := makeBlock(a2, 3, 0x01)
+	update(true, a1, a2, a3)
+	update(false, a3, a2)
+	b2 := makeBlock(a1, 2, 0x02)
+	b3 := makeBlock(b2, 3, 0x02)
+	b4 := makeBlock(b3, 4, 0x02)
+	update(true, b2, b3, b4)
+
+	tests := []struct {
+		name  string
+		block *provautil.Block
+		want  []SigKeyBlock
+	}{
+		{
+			name:  "first key",
+			block: a1,
+			want:  []SigKeyBlock{{1, *a1.Hash()}},
+		},
+		{
+			name:  "second key",
+			block: b2,
+			want: []SigKeyBlock{{2, *b2.Hash()}, {3, *b3.Hash()},
+				{4, *b4.Hash()}},
+		},
+	}
+	for _, test := range tests {
+		keyID := SigKeyID(test.block.MsgBlock().Header.ValidatingPubKey)
+		got, err := idx.BlocksBySigKeyID(keyID[:], 0, math.MaxInt32)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Fatalf("%s: mismatched blocks - got %v, want %v",
+				test.name, got, test.want)
+		}
+	}
+}
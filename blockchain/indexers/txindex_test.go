@@ -0,0 +1,129 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package indexers
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/bitgo/prova/blockchain/fullblocktests"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+)
+
+// checkTxIndex ensures the passed transaction index is caught up to the main
+// chain of the test chain and maps every transaction in it to the main chain
+// block which contains it, while transactions which only appear in blocks that
+// were reorganized away are not indexed at all.
+func (tc *testChain) checkTxIndex(t *testing.T, idx *TxIndex) {
+	best := tc.chain.BestSnapshot()
+	err := tc.db.View(func(dbTx database.Tx) error {
+		hash, height, err := dbFetchIndexerTip(dbTx, idx.Key())
+		if err != nil {
+			return err
+		}
+		if *hash != *best.Hash || height != int32(best.Height) {
+			t.Fatalf("mismatched index tip - got %v (height %d), "+
+				"want %v (height %d)", hash, height, best.Hash,
+				best.Height)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to fetch index tip: %v", err)
+	}
+
+	mainTxns := make(map[chainhash.Hash]chainhash.Hash)
+	for height := uint32(0); height <= best.Height; height++ {
+		block, err := tc.chain.BlockByHeight(height)
+		if err != nil {
+			t.Fatalf("BlockByHeight: unexpected error: %v", err)
+		}
+		for _, tx := range block.Transactions() {
+			mainTxns[*tx.Hash()] = *block.Hash()
+		}
+	}
+
+	for _, block := range tc.blocks {
+		for _, tx := range block.Transactions {
+			txHash := tx.TxHash()
+			region, err := idx.TxBlockRegion(&txHash)
+			if err != nil {
+				t.Fatalf("TxBlockRegion: unexpected error: %v",
+					err)
+			}
+
+			blockHash, ok := mainTxns[txHash]
+			if !ok {
+				if region != nil {
+					t.Fatalf("transaction %v which is not in "+
+						"the main chain is indexed in block "+
+						"%v", txHash, region.Hash)
+				}
+				continue
+			}
+			if region == nil {
+				t.Fatalf("transaction %v in block %v is not "+
+					"indexed", txHash, blockHash)
+			}
+			if *region.Hash != blockHash {
+				t.Fatalf("transaction %v indexed in block %v, "+
+					"want %v", txHash, region.Hash, blockHash)
+			}
+		}
+	}
+}
+
+// TestTxIndexCatchUp ensures the transaction index catches up when it is
+// enabled again after the chain advanced by 100 blocks while it was disabled,
+// remains consistent with the main chain while it is reorganized, and can be
+// rebuilt from the blocks in the database after it is dropped.
+func TestTxIndexCatchUp(t *testing.T) {
+	tests, err := fullblocktests.Generate(false)
+	if err != nil {
+		t.Fatalf("failed to generate tests: %v", err)
+	}
+
+	dir, err := ioutil.TempDir("", "txindexcatchup")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Create the chain with the index enabled so the genesis block is
+	// indexed.
+	tc := newTestChain(t, dir, nil)
+	defer tc.db.Close()
+	txIndex := NewTxIndex(tc.db)
+	tc.chain = tc.newChain(t, NewManager(tc.db, []Indexer{txIndex}))
+	tc.checkTxIndex(t, txIndex)
+
+	// Disable the index while the first 100 blocks are processed.
+	tc.chain = tc.newChain(t, nil)
+	tc.processFullBlocks(t, tests[:1])
+	if best := tc.chain.BestSnapshot(); best.Height != 100 {
+		t.Fatalf("unexpected best height %d with the index disabled",
+			best.Height)
+	}
+
+	// Enable the index again, which catches it up to the main chain, and
+	// process the remaining blocks which reorganize the chain several
+	// times.
+	txIndex = NewTxIndex(tc.db)
+	tc.chain = tc.newChain(t, NewManager(tc.db, []Indexer{txIndex}))
+	tc.checkTxIndex(t, txIndex)
+	tc.processFullBlocks(t, tests[1:])
+	tc.checkTxIndex(t, txIndex)
+
+	// Drop the index and ensure it is rebuilt from the blocks in the
+	// database.
+	if err := DropTxIndex(tc.db); err != nil {
+		t.Fatalf("DropTxIndex: unexpected error: %v", err)
+	}
+	txIndex = NewTxIndex(tc.db)
+	tc.chain = tc.newChain(t, NewManager(tc.db, []Indexer{txIndex}))
+	tc.checkTxIndex(t, txIndex)
+}
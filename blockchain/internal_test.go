@@ -15,6 +15,12 @@ package blockchain
 
 import (
 	"sort"
+
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/txscript"
 )
 
 // TstSetCoinbaseMaturity makes the ability to set the coinbase maturity
@@ -35,6 +41,57 @@ func TstSetMaxMedianTimeEntries(val int) {
 	maxMedianTimeEntries = val
 }
 
+// TstBlockScriptFlags makes the script flags the internal blockScriptFlags
+// function returns for a version 1 block at the passed height of a chain with
+// the passed parameters available to the test package.
+func TstBlockScriptFlags(params *chaincfg.Params, height uint32) txscript.ScriptFlags {
+	b := &BlockChain{chainParams: params}
+	var prevNode *blockNode
+	if height > 0 {
+		prevNode = &blockNode{height: height - 1, version: 1}
+	}
+	return b.blockScriptFlags(&blockNode{height: height, version: 1},
+		prevNode)
+}
+
+// TstVerificationFlagsForBlock makes the VerificationFlagsForBlock function
+// available to the test package for the block at the passed height.
+func TstVerificationFlagsForBlock(params *chaincfg.Params, height uint32) txscript.ScriptFlags {
+	var prevNode *blockNode
+	if height > 0 {
+		prevNode = &blockNode{height: height - 1}
+	}
+	return VerificationFlagsForBlock(prevNode, params)
+}
+
+// TstVersionRolloutStates pushes blocks with the passed versions, starting at
+// the genesis block, to a version tally for the passed parameters, then pops
+// the passed number of blocks from it and returns the resulting state and
+// since height of each version rollout.
+func TstVersionRolloutStates(params *chaincfg.Params, versions []uint32, numPops int) ([]DeploymentState, []uint32) {
+	hash := func(height uint32) *chainhash.Hash {
+		return &chainhash.Hash{byte(height), byte(height >> 8)}
+	}
+	t := newVersionTally(params)
+	for height, version := range versions {
+		t.push(hash(uint32(height)), uint32(height), version, params)
+	}
+	for i := 0; i < numPops; i++ {
+		var restored *uint32
+		if height, ok := t.restoredHeight(); ok {
+			restored = &versions[height]
+		}
+		t.pop(hash(t.tipHeight-1), restored)
+	}
+
+	states := make([]DeploymentState, len(t.rollouts))
+	since := make([]uint32, len(t.rollouts))
+	for i := range t.rollouts {
+		states[i], since[i] = t.rollouts[i].state()
+	}
+	return states, since
+}
+
 // TstCheckBlockScripts makes the internal checkBlockScripts function available
 // to the test package.
 var TstCheckBlockScripts = checkBlockScripts
@@ -42,3 +99,83 @@ var TstCheckBlockScripts = checkBlockScripts
 // TstDeserializeUtxoEntry makes the internal deserializeUtxoEntry function
 // available to the test package.
 var TstDeserializeUtxoEntry = deserializeUtxoEntry
+
+// TstSetMainChainHash overwrites the hash the height index of the database
+// maps the passed main chain height to in order to simulate corruption.
+func (b *BlockChain) TstSetMainChainHash(height uint32, hash *chainhash.Hash) error {
+	return b.db.Update(func(dbTx database.Tx) error {
+		var serializedHeight [4]byte
+		byteOrder.PutUint32(serializedHeight[:], height)
+		heightIndex := dbTx.Metadata().Bucket(heightIndexBucketName)
+		return heightIndex.Put(serializedHeight[:], hash[:])
+	})
+}
+
+// TstRemoveUtxoEntry removes the unspent outputs of the transaction with the
+// passed hash from the utxo set in the database in order to simulate
+// corruption.
+func (b *BlockChain) TstRemoveUtxoEntry(txHash *chainhash.Hash) error {
+	return b.db.Update(func(dbTx database.Tx) error {
+		utxoBucket := dbTx.Metadata().Bucket(utxoSetBucketName)
+		return utxoBucket.Delete(txHash[:])
+	})
+}
+
+// TstTruncateSpendJournal truncates the spend journal entry of the best block
+// in the database in order to simulate corruption.
+func (b *BlockChain) TstTruncateSpendJournal() error {
+	return b.db.Update(func(dbTx database.Tx) error {
+		spendBucket := dbTx.Metadata().Bucket(spendJournalBucketName)
+		serialized := spendBucket.Get(b.bestNode.hash[:])
+		if len(serialized) == 0 {
+			return AssertError("best block does not spend any outputs")
+		}
+		return spendBucket.Put(b.bestNode.hash[:],
+			serialized[:len(serialized)/2])
+	})
+}
+
+// TstModifySpentAmount replaces the amount of the largest output spent by the
+// best block in its spend journal entry in the database with the one returned
+// by the passed function in order to simulate corruption.
+func (b *BlockChain) TstModifySpentAmount(modify func(amount int64) int64) error {
+	var block *provautil.Block
+	err := b.db.View(func(dbTx database.Tx) error {
+		var err error
+		block, err = dbFetchBlockByHash(dbTx, b.bestNode.hash)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	view := NewUtxoViewpoint()
+	if err := view.fetchInputUtxos(b.db, b.utxoBatch, block); err != nil {
+		return err
+	}
+
+	return b.db.Update(func(dbTx database.Tx) error {
+		stxos, err := dbFetchSpendJournalEntry(dbTx, block, view)
+		if err != nil {
+			return err
+		}
+		if len(stxos) == 0 {
+			return AssertError("best block does not spend any outputs")
+		}
+		var largest *spentTxOut
+		for i := range stxos {
+			stxo := &stxos[i]
+			if stxo.compressed {
+				stxo.amount = int64(decompressTxOutAmount(
+					uint64(stxo.amount)))
+				stxo.pkScript = decompressScript(stxo.pkScript,
+					stxo.version)
+				stxo.compressed = false
+			}
+			if largest == nil || stxo.amount > largest.amount {
+				largest = stxo
+			}
+		}
+		largest.amount = modify(largest.amount)
+		return dbPutSpendJournalEntry(dbTx, block.Hash(), stxos)
+	})
+}
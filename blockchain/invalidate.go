@@ -0,0 +1,194 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"container/list"
+	"errors"
+
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/provautil"
+)
+
+// disconnectNodes disconnects the nodes in the passed list, which must be in
+// the order returned by getReorganizeNodes, from the end of the main chain
+// without attaching any other blocks.  The caller is notified of the blocks
+// which were disconnected as a reorganization which attached none, even when a
+// failure stops it part way.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) disconnectNodes(detachNodes *list.List) error {
+	detached := list.New()
+	defer b.notifyReorganization(detached, list.New())
+
+	utxoView := NewUtxoViewpoint()
+	utxoView.SetBestHash(b.bestNode.hash)
+	keyView := b.tipKeyView()
+	for e := detachNodes.Front(); e != nil; e = e.Next() {
+		n := e.Value.(*blockNode)
+		var block *provautil.Block
+		err := b.db.View(func(dbTx database.Tx) error {
+			var err error
+			block, err = dbFetchBlockByHash(dbTx, n.hash)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		// Load all of the utxos referenced by the block that aren't
+		// already in the view along with the spent txos for the block
+		// from the spend journal.
+		err = utxoView.fetchInputUtxos(b.db, b.utxoBatch, block)
+		if err != nil {
+			return err
+		}
+		var stxos []spentTxOut
+		err = b.db.View(func(dbTx database.Tx) error {
+			stxos, err = dbFetchSpendJournalEntry(dbTx, block, utxoView)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		// Update the views to unspend all of the spent txos, remove the
+		// utxos created by the block, and revert its admin operations.
+		err = utxoView.disconnectTransactions(block, stxos)
+		if err != nil {
+			return err
+		}
+		err = keyView.disconnectTransactions(block)
+		if err != nil {
+			return err
+		}
+
+		// Update the database and chain state.
+		err = b.disconnectBlock(n, block, utxoView, keyView, stxos)
+		if err != nil {
+			return err
+		}
+		detached.PushBack(n)
+	}
+	return nil
+}
+
+// bestValidTip returns the tip of the side chain in the memory block index
+// with the most work which is not known to be invalid, or nil when no side
+// chain has more work than the passed main chain node.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) bestValidTip(mainNode *blockNode) *blockNode {
+	best := mainNode
+	for _, node := range b.index {
+		if node.inMainChain || node.status.KnownInvalid() {
+			continue
+		}
+		if node.hasMoreWork(best) {
+			best = node
+		}
+	}
+	if best == mainNode {
+		return nil
+	}
+	return best
+}
+
+// InvalidateBlock marks the block with the passed hash, which must either be
+// part of the main chain or in the memory block index, as invalid along with
+// all of its descendants.  When the block is part of the main chain, the chain
+// is reorganized to the valid side chain with the most work if it has more
+// work than the parent of the block, or the block is disconnected along with
+// all of the blocks which follow it otherwise.  Side chain blocks which fail
+// validation while reorganizing are marked invalid and the next best side
+// chain is tried.  Neither may disconnect more blocks than the maximum
+// reorganization depth allows, in which case an error is returned and the
+// block is left untouched.
+//
+// Blocks which extend the invalidated block are rejected from then on.  The
+// block is recorded in the database, so it remains invalid once the chain is
+// reloaded.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) InvalidateBlock(hash *chainhash.Hash) error {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	if hash.IsEqual(b.chainParams.GenesisHash) {
+		return errors.New("the genesis block can not be invalidated")
+	}
+	node, err := b.lookupNode(hash)
+	if err != nil {
+		return err
+	}
+	var parent *blockNode
+	var detachNodes *list.List
+	if node.inMainChain {
+		parent, err = b.getPrevNodeFromNode(node)
+		if err != nil {
+			return err
+		}
+		detachNodes, _ = b.getReorganizeNodes(parent)
+		err = b.checkReorgDepth(detachNodes, list.New())
+		if err != nil {
+			return err
+		}
+	}
+
+	// Remember the state of the block and its descendants so it can be
+	// restored when switching to a side chain is refused.
+	prevStatus := map[*blockNode]blockStatus{node: node.status}
+	for descendants := node.children; len(descendants) > 0; {
+		child := descendants[len(descendants)-1]
+		descendants = descendants[:len(descendants)-1]
+		prevStatus[child] = child.status
+		descendants = append(descendants, child.children...)
+	}
+	b.markBlockInvalid(node)
+	if node.inMainChain {
+		// Switch to the valid side chain with the most work, if any.
+		// Blocks which break the rules are marked invalid by
+		// reorganizeChain, so the next best side chain is tried until
+		// one is connected.
+		switched := false
+		for tip := b.bestValidTip(parent); tip != nil; tip = b.bestValidTip(parent) {
+			detach, attach := b.getReorganizeNodes(tip)
+			if err := b.checkReorgDepth(detach, attach); err != nil {
+				for n, status := range prevStatus {
+					n.status = status
+				}
+				return err
+			}
+			err := b.reorganizeChain(detach, attach, BFNone)
+			if _, ok := err.(RuleError); ok && tip.status.KnownInvalid() {
+				log.Infof("INVALIDATE: Side chain %v is invalid: %v",
+					tip.hash, err)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			switched = true
+			break
+		}
+
+		// There is no valid side chain to switch to, so disconnect the
+		// block along with all of the blocks which follow it in the main
+		// chain.
+		if !switched {
+			if err := b.disconnectNodes(detachNodes); err != nil {
+				return err
+			}
+			log.Infof("INVALIDATE: Block %v (height %d) and %d blocks "+
+				"which follow it were disconnected", node.hash,
+				node.height, detachNodes.Len()-1)
+		}
+	}
+
+	return b.db.Update(func(dbTx database.Tx) error {
+		return dbPutInvalidBlock(dbTx, node.hash)
+	})
+}
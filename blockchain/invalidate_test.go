@@ -0,0 +1,312 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain_test
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/blockchain/fullblocktests"
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/txscript"
+	"github.com/bitgo/prova/wire"
+)
+
+// invalidateTestBlocks returns the blocks generated by the fullblocktests
+// package up to b9 by name along with the order they are accepted in.  The
+// generated chain extends b5 with b6 on the main chain and with b7 on a side
+// chain, which b8 and b9 then extend.
+func invalidateTestBlocks(t *testing.T) ([]string, map[string]fullblocktests.AcceptedBlock) {
+	tests, err := fullblocktests.Generate(false)
+	if err != nil {
+		t.Fatalf("failed to generate tests: %v", err)
+	}
+
+	var order []string
+	blocks := make(map[string]fullblocktests.AcceptedBlock)
+	for _, testInstances := range tests {
+		for _, item := range testInstances {
+			accepted, ok := item.(fullblocktests.AcceptedBlock)
+			if !ok {
+				continue
+			}
+			order = append(order, accepted.Name)
+			blocks[accepted.Name] = accepted
+		}
+		if _, ok := blocks["b9"]; ok {
+			break
+		}
+	}
+	return order, blocks
+}
+
+// TestInvalidateBlock ensures invalidating a main chain block disconnects it,
+// restores the admin state of its parent, and switches to a valid side chain
+// with more work, that invalidating a block without a valid alternative leaves
+// the chain at its parent, and that blocks which extend an invalidated branch
+// are rejected and reported as invalid chain tips.
+func TestInvalidateBlock(t *testing.T) {
+	order, blocks := invalidateTestBlocks(t)
+
+	notifier := blockchain.NewNotifier(blockchain.DefaultNotificationQueueSize)
+	ntfns, cancel := notifier.Subscribe(blockchain.NTReorganization)
+	defer cancel()
+	chain, teardownFunc, err := chainSetupWithConfig("invalidateblock",
+		&chaincfg.RegressionNetParams,
+		blockchain.Config{Notifier: notifier})
+	if err != nil {
+		t.Fatalf("failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	process := func(name string) error {
+		_, _, err := chain.ProcessBlock(provautil.NewBlock(
+			blocks[name].Block), blockchain.BFNone)
+		return err
+	}
+	for _, name := range order {
+		if err := process(name); err != nil {
+			t.Fatalf("block %q should have been accepted: %v", name,
+				err)
+		}
+		if name == "b7" {
+			break
+		}
+	}
+	// assertTip ensures the named block is the best block and the admin
+	// state of the chain matches the one expected after the block with
+	// the passed state name.  The state expected after a side chain block
+	// is the one of the main chain at the time it was accepted.
+	assertTip := func(name, stateName string) {
+		want := blocks[stateName]
+		best := chain.BestSnapshot()
+		if *best.Hash != blocks[name].Block.BlockHash() {
+			t.Fatalf("best block is %v (height %d), want %q",
+				best.Hash, best.Height, name)
+		}
+		if chain.TotalSupply() != want.TotalSupply {
+			t.Fatalf("tip %q: got total supply %d, want %d", name,
+				chain.TotalSupply(), want.TotalSupply)
+		}
+		for _, keySetType := range []btcec.KeySetType{btcec.RootKeySet,
+			btcec.ProvisionKeySet, btcec.IssueKeySet,
+			btcec.ValidateKeySet} {
+
+			got := chain.AdminKeySets()[keySetType]
+			if !want.AdminKeySets[keySetType].Equal(got) {
+				t.Fatalf("tip %q: got admin keys %v for key set "+
+					"%v, want %v", name, got, keySetType,
+					want.AdminKeySets[keySetType])
+			}
+		}
+	}
+	assertTip("b6", "b6")
+
+	// Invalidating b6 disconnects it and switches to the b7 side chain,
+	// which has more work than b5.
+	b6Hash := blocks["b6"].Block.BlockHash()
+	if err := chain.InvalidateBlock(&b6Hash); err != nil {
+		t.Fatalf("InvalidateBlock(b6): unexpected error: %v", err)
+	}
+	assertTip("b7", "b5")
+	if err := process("b8"); err != nil {
+		t.Fatalf("block \"b8\" should have been accepted: %v", err)
+	}
+	assertTip("b8", "b8")
+
+	// Invalidating b7 disconnects it along with b8, and there is no valid
+	// side chain left to switch to.  The disconnected blocks are reported
+	// as a reorganization which attached none.
+	for len(ntfns) > 0 {
+		<-ntfns
+	}
+	b7Hash := blocks["b7"].Block.BlockHash()
+	if err := chain.InvalidateBlock(&b7Hash); err != nil {
+		t.Fatalf("InvalidateBlock(b7): unexpected error: %v", err)
+	}
+	assertTip("b5", "b5")
+	if len(ntfns) != 1 {
+		t.Fatalf("InvalidateBlock(b7): got %d reorganization "+
+			"notifications, want 1", len(ntfns))
+	}
+	data := (<-ntfns).Reorganization
+	wantDetached := []chainhash.Hash{blocks["b8"].Block.BlockHash(), b7Hash}
+	if data.ForkHash != blocks["b5"].Block.BlockHash() ||
+		!reflect.DeepEqual(data.DetachedHashes, wantDetached) ||
+		len(data.AttachedHashes) != 0 {
+
+		t.Fatalf("InvalidateBlock(b7): unexpected reorganization %+v",
+			data)
+	}
+
+	// The invalidated blocks and their descendants are known to be
+	// invalid, while the blocks of the main chain are not.
+	for name, want := range map[string]bool{"b5": false, "b6": true,
+		"b7": true, "b8": true} {
+
+		hash := blocks[name].Block.BlockHash()
+		invalid, err := chain.IsKnownInvalid(&hash)
+		if err != nil {
+			t.Fatalf("IsKnownInvalid(%s): unexpected error: %v",
+				name, err)
+		}
+		if invalid != want {
+			t.Fatalf("IsKnownInvalid(%s): got %v, want %v", name,
+				invalid, want)
+		}
+	}
+
+	// Blocks which extend an invalidated branch are rejected.
+	err = process("b9")
+	rerr, ok := err.(blockchain.RuleError)
+	if !ok || rerr.ErrorCode != blockchain.ErrInvalidAncestorBlock {
+		t.Fatalf("block \"b9\" extending an invalidated branch: got "+
+			"error %v, want %v", err, blockchain.ErrInvalidAncestorBlock)
+	}
+	assertTip("b5", "b5")
+
+	// Both invalidated branches are reported as invalid tips.
+	tips, err := chain.ChainTips()
+	if err != nil {
+		t.Fatalf("ChainTips: unexpected error: %v", err)
+	}
+	wantTips := map[string]uint32{"b5": 0, "b6": 1, "b9": 3}
+	if len(tips) != len(wantTips) {
+		t.Fatalf("got %d chain tips, want %d: %+v", len(tips),
+			len(wantTips), tips)
+	}
+	for _, tip := range tips {
+		var name string
+		for n := range wantTips {
+			if blocks[n].Block.BlockHash() == tip.Hash {
+				name = n
+			}
+		}
+		wantStatus := blockchain.ChainTipInvalid
+		if name == "b5" {
+			wantStatus = blockchain.ChainTipActive
+		}
+		if name == "" || tip.BranchLen != wantTips[name] ||
+			tip.Status != wantStatus {
+
+			t.Errorf("unexpected chain tip %+v", tip)
+		}
+	}
+
+	// The genesis block can not be invalidated.
+	genesisHash := chaincfg.RegressionNetParams.GenesisHash
+	if err := chain.InvalidateBlock(genesisHash); err == nil {
+		t.Errorf("InvalidateBlock(genesis): did not receive an error")
+	}
+}
+
+// TestInvalidateBlockPersisted ensures invalidating a block is refused when it
+// would disconnect more blocks than the maximum reorganization depth, and that
+// invalidated blocks remain invalid once the chain is reloaded.
+func TestInvalidateBlockPersisted(t *testing.T) {
+	order, blocks := invalidateTestBlocks(t)
+
+	dir, err := ioutil.TempDir("", "invalidateblockpersisted")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := database.Create("ffldb", dir, blockDataNet)
+	if err != nil {
+		t.Fatalf("unable to create database: %v", err)
+	}
+	defer db.Close()
+	params := chaincfg.RegressionNetParams
+	newChain := func(maxReorgDepth uint32) *blockchain.BlockChain {
+		chain, err := blockchain.New(&blockchain.Config{
+			DB:            db,
+			ChainParams:   &params,
+			TimeSource:    blockchain.NewMedianTime(),
+			SigCache:      txscript.NewSigCache(1000),
+			MaxReorgDepth: maxReorgDepth,
+		})
+		if err != nil {
+			t.Fatalf("failed to create chain instance: %v", err)
+		}
+		return chain
+	}
+	process := func(chain *blockchain.BlockChain, block *wire.MsgBlock) error {
+		_, _, err := chain.ProcessBlock(provautil.NewBlock(block),
+			blockchain.BFNone)
+		return err
+	}
+	assertTip := func(chain *blockchain.BlockChain, name string) {
+		best := chain.BestSnapshot()
+		if *best.Hash != blocks[name].Block.BlockHash() {
+			t.Fatalf("best block is %v (height %d), want %q",
+				best.Hash, best.Height, name)
+		}
+	}
+
+	// Invalidating b7 while b8 is the tip would disconnect two blocks,
+	// which exceeds the maximum reorganization depth, so the chain is left
+	// untouched and b9 still extends it.
+	chain := newChain(1)
+	for _, name := range order {
+		if err := process(chain, blocks[name].Block); err != nil {
+			t.Fatalf("block %q should have been accepted: %v", name,
+				err)
+		}
+		if name == "b8" {
+			break
+		}
+	}
+	b7Hash := blocks["b7"].Block.BlockHash()
+	err = chain.InvalidateBlock(&b7Hash)
+	rerr, ok := err.(blockchain.RuleError)
+	if !ok || rerr.ErrorCode != blockchain.ErrReorgTooDeep {
+		t.Fatalf("InvalidateBlock(b7): got error %v, want %v", err,
+			blockchain.ErrReorgTooDeep)
+	}
+	assertTip(chain, "b8")
+	if err := process(chain, blocks["b9"].Block); err != nil {
+		t.Fatalf("block \"b9\" should have been accepted: %v", err)
+	}
+	assertTip(chain, "b9")
+
+	// Without a limit, invalidating b7 disconnects it along with the
+	// blocks which follow it.  The b6 side chain is not in the block index
+	// of a reloaded chain, so the chain is left at b5.
+	chain = newChain(0)
+	if err := chain.InvalidateBlock(&b7Hash); err != nil {
+		t.Fatalf("InvalidateBlock(b7): unexpected error: %v", err)
+	}
+	assertTip(chain, "b5")
+
+	// A reloaded chain rejects a new block which extends b7.
+	b8 := *blocks["b8"].Block
+	b8.Header.Timestamp = b8.Header.Timestamp.Add(time.Second)
+	resignBlock(t, &b8)
+	chain = newChain(0)
+	err = process(chain, &b8)
+	rerr, ok = err.(blockchain.RuleError)
+	if !ok || rerr.ErrorCode != blockchain.ErrInvalidAncestorBlock {
+		t.Fatalf("block extending b7 after reloading: got error %v, "+
+			"want %v", err, blockchain.ErrInvalidAncestorBlock)
+	}
+	assertTip(chain, "b5")
+
+	// The invalidated block is still known to be invalid once the chain
+	// is reloaded.
+	chain = newChain(0)
+	invalid, err := chain.IsKnownInvalid(&b7Hash)
+	if err != nil || !invalid {
+		t.Fatalf("IsKnownInvalid(b7) after reloading: got %v (error "+
+			"%v), want true", invalid, err)
+	}
+}
@@ -124,9 +124,11 @@ func (view *KeyViewpoint) ProcessAdminOuts(tx *provautil.Tx, blockHeight uint32)
 			for i := 0; i < len(adminOutputs); i++ {
 				// if this output pk script is a NullDataTy, then,
 				// according to previous validation, it must be
-				// admin operation (destruction)
+				// admin operation (destruction).  Admin operations
+				// are null data scripts with a class of their own.
 				scriptType := txscript.TypeOfScript(adminOutputs[i])
-				if scriptType == txscript.NullDataTy {
+				if scriptType == txscript.NullDataTy ||
+					scriptType == txscript.ProvaAdminOpTy {
 					view.totalSupply -= uint64(tx.MsgTx().TxOut[i+1].Value)
 				}
 			}
@@ -208,9 +210,11 @@ func (view *KeyViewpoint) disconnectTransactions(block *provautil.Block) error {
 					for i := 0; i < len(adminOutputs); i++ {
 						// if this output pk script is a NullDataTy, then,
 						// according to previous validation, it must be
-						// admin operation (destruction)
+						// admin operation (destruction).  Admin operations
+						// are null data scripts with a class of their own.
 						scriptType := txscript.TypeOfScript(adminOutputs[i])
-						if scriptType == txscript.NullDataTy {
+						if scriptType == txscript.NullDataTy ||
+							scriptType == txscript.ProvaAdminOpTy {
 							view.totalSupply += uint64(tx.MsgTx().TxOut[i+1].Value)
 						}
 					}
@@ -258,3 +262,17 @@ func NewKeyViewpoint() *KeyViewpoint {
 		aspKeyIdMap:  make(map[btcec.KeyID]*btcec.PublicKey),
 	}
 }
+
+// tipKeyView returns a new key viewpoint holding the admin state of the end of
+// the main chain.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) tipKeyView() *KeyViewpoint {
+	keyView := NewKeyViewpoint()
+	keyView.SetThreadTips(b.threadTips)
+	keyView.SetLastKeyID(b.lastKeyID)
+	keyView.SetTotalSupply(b.totalSupply)
+	keyView.SetKeys(b.adminKeySets)
+	keyView.SetKeyIDs(b.aspKeyIdMap)
+	return keyView
+}
@@ -0,0 +1,185 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"fmt"
+
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/wire"
+)
+
+// validateKeyWindow houses the validate keys which signed the most recent
+// blocks of the chain ending at a tip in a ring buffer.  It allows the rate
+// limiting rules to be checked without walking back through the block nodes,
+// which requires loading them from the database once they have been pruned
+// from memory.
+type validateKeyWindow struct {
+	tip   *blockNode
+	keys  []wire.BlockValidatingPubKey
+	next  int
+	count int
+}
+
+// newValidateKeyWindow returns an empty validate key window which holds up to
+// the passed number of keys.
+func newValidateKeyWindow(size int) *validateKeyWindow {
+	return &validateKeyWindow{
+		keys: make([]wire.BlockValidatingPubKey, size),
+	}
+}
+
+// reset empties the window.
+func (w *validateKeyWindow) reset() {
+	w.tip = nil
+	w.next = 0
+	w.count = 0
+}
+
+// push extends the window with the passed node, which must be a child of the
+// current tip, evicting the oldest key when the window is full.
+func (w *validateKeyWindow) push(node *blockNode) {
+	w.keys[w.next] = node.validatingPubKey
+	w.next = (w.next + 1) % len(w.keys)
+	if w.count < len(w.keys) {
+		w.count++
+	}
+	w.tip = node
+}
+
+// pop removes the current tip from the window, which then ends at the passed
+// parent node.
+func (w *validateKeyWindow) pop(parent *blockNode) {
+	if w.count == 0 {
+		w.reset()
+		return
+	}
+	w.next = (w.next - 1 + len(w.keys)) % len(w.keys)
+	w.count--
+	w.tip = parent
+}
+
+// recent returns up to the passed number of keys ending at the tip of the
+// window with the newest key first.  The second return value is false when the
+// window does not contain enough keys to satisfy the request.
+func (w *validateKeyWindow) recent(n int) ([]wire.BlockValidatingPubKey, bool) {
+	if w.tip == nil || n > len(w.keys) {
+		return nil, false
+	}
+
+	// The window is only allowed to contain fewer keys than requested
+	// when it covers the entire chain.
+	if w.count < n {
+		if uint32(w.count) != w.tip.height+1 {
+			return nil, false
+		}
+		n = w.count
+	}
+
+	keys := make([]wire.BlockValidatingPubKey, n)
+	for i := range keys {
+		keys[i] = w.keys[(w.next-1-i+2*len(w.keys))%len(w.keys)]
+	}
+	return keys, true
+}
+
+// validateKeyWindowSize returns the number of keys held by the validate key
+// windows of a chain with the passed parameters, which is the larger of the
+// proof of work averaging window the share rule counts keys over and the number
+// of trailing blocks a single key is permitted to sign.
+func validateKeyWindowSize(params *chaincfg.Params) int {
+	if params.ChainWindowMaxBlocks > params.PowAveragingWindow {
+		return params.ChainWindowMaxBlocks
+	}
+	return params.PowAveragingWindow
+}
+
+// rebuildValidateKeyWindow fills the passed window with the validate keys of
+// the passed node and its ancestors.  When the window already ends at the
+// parent of the node, it is extended with the node instead.
+//
+// This function MUST be called with the chain lock held (for writes).
+func (b *BlockChain) rebuildValidateKeyWindow(w *validateKeyWindow, node *blockNode) error {
+	if w.tip != nil && w.tip.hash.IsEqual(node.parentHash) {
+		w.push(node)
+		return nil
+	}
+
+	// Collect the nodes from newest to oldest and push them to the window
+	// from oldest to newest.
+	nodes := make([]*blockNode, 0, len(w.keys))
+	for iterNode := node; iterNode != nil && len(nodes) < len(w.keys); {
+		nodes = append(nodes, iterNode)
+
+		var err error
+		iterNode, err = b.getPrevNodeFromNode(iterNode)
+		if err != nil {
+			return err
+		}
+	}
+	w.reset()
+	for i := len(nodes) - 1; i >= 0; i-- {
+		w.push(nodes[i])
+	}
+	return nil
+}
+
+// recentValidateKeys returns the validate keys which signed the passed node and
+// up to n-1 of its ancestors with the newest key first.  Fewer keys are only
+// returned when the chain ending at the node is shorter than n.
+//
+// The keys for the best chain are maintained as blocks are connected and
+// disconnected, while the keys for side chain tips are reconstructed lazily
+// and cached for the most recently requested one.
+//
+// This function MUST be called with the chain lock held (for writes).
+func (b *BlockChain) recentValidateKeys(node *blockNode, n int) ([]wire.BlockValidatingPubKey, error) {
+	if size := validateKeyWindowSize(b.chainParams); n > size {
+		return nil, fmt.Errorf("unable to fetch %d recent validate keys "+
+			"when the window only holds %d", n, size)
+	}
+
+	window := b.sideKeyWindow
+	if node.hash.IsEqual(b.bestNode.hash) {
+		window = b.bestKeyWindow
+	}
+	if window.tip == nil || !window.tip.hash.IsEqual(node.hash) {
+		if err := b.rebuildValidateKeyWindow(window, node); err != nil {
+			return nil, err
+		}
+	}
+	keys, ok := window.recent(n)
+	if !ok {
+		// The best chain window lost keys when blocks were
+		// disconnected, so rebuild it from scratch.
+		window.reset()
+		if err := b.rebuildValidateKeyWindow(window, node); err != nil {
+			return nil, err
+		}
+		keys, _ = window.recent(n)
+	}
+	return keys, nil
+}
+
+// RecentValidateKeys returns the validate keys which signed the block with the
+// passed hash and up to n-1 of its ancestors with the newest key first.  Fewer
+// keys are only returned when the chain ending at the block is shorter than n,
+// which may not exceed the larger of the proof of work averaging window and
+// the maximum number of blocks a single key may sign within it.  The block must
+// be a chain tip or one of the recent blocks in the memory block index.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) RecentValidateKeys(tipHash *chainhash.Hash, n int) ([]wire.BlockValidatingPubKey, error) {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	node, ok := b.index[*tipHash]
+	if !ok {
+		return nil, fmt.Errorf("block %v is not a known chain tip or "+
+			"recent block", tipHash)
+	}
+	return b.recentValidateKeys(node, n)
+}
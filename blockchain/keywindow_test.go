@@ -0,0 +1,207 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/wire"
+)
+
+// newKeyWindowTestChain returns a chain instance with an in-memory main chain
+// of the passed length where the validate key of each block is derived from its
+// height.
+func newKeyWindowTestChain(length int) *BlockChain {
+	params := chaincfg.RegressionNetParams
+	b := &BlockChain{
+		chainParams:   &params,
+		index:         make(map[chainhash.Hash]*blockNode),
+		depNodes:      make(map[chainhash.Hash][]*blockNode),
+		bestKeyWindow: newValidateKeyWindow(validateKeyWindowSize(&params)),
+		sideKeyWindow: newValidateKeyWindow(validateKeyWindowSize(&params)),
+	}
+	var parent *blockNode
+	for height := 0; height < length; height++ {
+		b.bestNode = addKeyWindowTestNode(b, parent, byte(height))
+		parent = b.bestNode
+	}
+	return b
+}
+
+// addKeyWindowTestNode adds a node which extends the passed parent and was
+// signed by a validate key derived from the passed tag to the memory block
+// index of the passed chain.
+func addKeyWindowTestNode(b *BlockChain, parent *blockNode, tag byte) *blockNode {
+	header := wire.BlockHeader{Height: 0}
+	if parent != nil {
+		header.PrevBlock = *parent.hash
+		header.Height = parent.height + 1
+	}
+	header.ValidatingPubKey[0] = tag
+	header.ValidatingPubKey[1] = byte(header.Height)
+	hash := header.BlockHash()
+	node := newBlockNode(&header, &hash)
+	node.parent = parent
+	b.index[hash] = node
+	return node
+}
+
+// walkValidateKeys returns the validate keys of the passed node and up to n-1
+// of its ancestors by walking the parents.
+func walkValidateKeys(node *blockNode, n int) []wire.BlockValidatingPubKey {
+	var keys []wire.BlockValidatingPubKey
+	for ; node != nil && len(keys) < n; node = node.parent {
+		keys = append(keys, node.validatingPubKey)
+	}
+	return keys
+}
+
+// TestRecentValidateKeys ensures the validate key windows return the same keys
+// as walking the block nodes for the best chain as blocks are connected and
+// disconnected, for side chain tips, and for chains shorter than the window.
+func TestRecentValidateKeys(t *testing.T) {
+	b := newKeyWindowTestChain(5)
+	window := validateKeyWindowSize(b.chainParams)
+
+	// checkKeys ensures the keys for the passed node match the ones
+	// obtained by walking the nodes.
+	checkKeys := func(name string, node *blockNode, n int) {
+		keys, err := b.recentValidateKeys(node, n)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if want := walkValidateKeys(node, n); !reflect.DeepEqual(keys, want) {
+			t.Fatalf("%s: mismatched keys - got %x, want %x", name,
+				keys, want)
+		}
+	}
+
+	// The chain is shorter than the window.
+	checkKeys("short chain", b.bestNode, window)
+	checkKeys("short chain subset", b.bestNode, 3)
+
+	// Extend the best chain past the window like connecting blocks does.
+	for i := 0; i < 2*window; i++ {
+		node := addKeyWindowTestNode(b, b.bestNode, 0)
+		b.bestNode = node
+		b.bestKeyWindow.push(node)
+		checkKeys("connected", b.bestNode, window)
+	}
+
+	// Disconnect a few blocks like reorganizing does.
+	for i := 0; i < 3; i++ {
+		b.bestNode = b.bestNode.parent
+		b.bestKeyWindow.pop(b.bestNode)
+	}
+	checkKeys("disconnected", b.bestNode, window)
+	checkKeys("disconnected subset", b.bestNode, window/2)
+
+	// Build a side chain from the fork point and ensure its keys are
+	// reconstructed while the best chain keys remain intact.
+	sideTip := b.bestNode.parent
+	for i := 0; i < 4; i++ {
+		sideTip = addKeyWindowTestNode(b, sideTip, 0xff)
+		checkKeys("side chain", sideTip, window)
+	}
+	checkKeys("best chain after side chain", b.bestNode, window)
+
+	// Ensure requesting more keys than the window holds fails.
+	if _, err := b.recentValidateKeys(b.bestNode, window+1); err == nil {
+		t.Fatalf("did not receive expected error when requesting more " +
+			"keys than the window holds")
+	}
+
+	// Ensure the exported function works for known and unknown blocks.
+	keys, err := b.RecentValidateKeys(sideTip.hash, 2)
+	if err != nil {
+		t.Fatalf("RecentValidateKeys: unexpected error: %v", err)
+	}
+	if want := walkValidateKeys(sideTip, 2); !reflect.DeepEqual(keys, want) {
+		t.Fatalf("RecentValidateKeys: mismatched keys - got %x, want %x", keys,
+			want)
+	}
+	if _, err := b.RecentValidateKeys(&chainhash.Hash{0x01}, 2); err == nil {
+		t.Fatalf("RecentValidateKeys: did not receive expected error for an " +
+			"unknown block")
+	}
+}
+
+// TestValidateKeyWindowSize ensures the validate key windows hold enough keys
+// for both the proof of work averaging window and the trailing blocks a single
+// key is permitted to sign, whichever is larger.
+func TestValidateKeyWindowSize(t *testing.T) {
+	tests := []struct {
+		window    int
+		maxBlocks int
+		want      int
+	}{
+		{window: 31, maxBlocks: 3, want: 31},
+		{window: 31, maxBlocks: 0, want: 31},
+		{window: 5, maxBlocks: 8, want: 8},
+	}
+
+	for i, test := range tests {
+		params := chaincfg.RegressionNetParams
+		params.PowAveragingWindow = test.window
+		params.ChainWindowMaxBlocks = test.maxBlocks
+		if got := validateKeyWindowSize(&params); got != test.want {
+			t.Errorf("validateKeyWindowSize #%d: got %d, want %d", i,
+				got, test.want)
+		}
+	}
+
+	// A window sized by the trailing blocks serves requests beyond the
+	// averaging window.
+	b := newKeyWindowTestChain(0)
+	b.chainParams.PowAveragingWindow = 5
+	b.chainParams.ChainWindowMaxBlocks = 8
+	b.bestKeyWindow = newValidateKeyWindow(validateKeyWindowSize(b.chainParams))
+	b.sideKeyWindow = newValidateKeyWindow(validateKeyWindowSize(b.chainParams))
+	var parent *blockNode
+	for height := 0; height < 12; height++ {
+		b.bestNode = addKeyWindowTestNode(b, parent, byte(height))
+		parent = b.bestNode
+	}
+	keys, err := b.recentValidateKeys(b.bestNode, 8)
+	if err != nil {
+		t.Fatalf("recentValidateKeys: unexpected error: %v", err)
+	}
+	if want := walkValidateKeys(b.bestNode, 8); !reflect.DeepEqual(keys, want) {
+		t.Fatalf("recentValidateKeys: mismatched keys - got %x, want %x",
+			keys, want)
+	}
+}
+
+// BenchmarkValidateKeyRateLimited benchmarks checking the rate limiting rules
+// for a block extending the best chain, which is done on every block connect,
+// with and without the validate key window being maintained.
+func BenchmarkValidateKeyRateLimited(b *testing.B) {
+	chain := newKeyWindowTestChain(100)
+	chain.chainParams.ChainWindowMaxBlocks = 3
+	node := addKeyWindowTestNode(chain, chain.bestNode, 0)
+
+	b.Run("window", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, err := chain.isValidateKeyRateLimited(node,
+				node.validatingPubKey, false)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("rebuild", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			chain.bestKeyWindow.reset()
+			_, err := chain.isValidateKeyRateLimited(node,
+				node.validatingPubKey, false)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -14,8 +14,9 @@ import (
 
 const (
 	// maxAllowedOffsetSeconds is the maximum number of seconds in either
-	// direction that local clock will be adjusted.  When the median time
-	// of the network is outside of this range, no offset will be applied.
+	// direction that local clock will be adjusted by the median time sources
+	// returned by NewMedianTime.  When the median time of the network is
+	// outside of this range, the offset is clamped to it.
 	maxAllowedOffsetSecs = 70 * 60 // 1 hour 10 minutes
 
 	// similarTimeSecs is the number of seconds in either direction from the
@@ -77,6 +78,8 @@ func (s int64Sorter) Less(i, j int) bool {
 // used in the consensus code.
 type medianTime struct {
 	mtx                sync.Mutex
+	now                func() time.Time
+	maxOffsetSecs      int64
 	knownIDs           map[string]struct{}
 	offsets            []int64
 	offsetSecs         int64
@@ -96,7 +99,7 @@ func (m *medianTime) AdjustedTime() time.Time {
 	defer m.mtx.Unlock()
 
 	// Limit the adjusted time to 1 second precision.
-	now := time.Unix(time.Now().Unix(), 0)
+	now := time.Unix(m.now().Unix(), 0)
 	return now.Add(time.Duration(m.offsetSecs) * time.Second)
 }
 
@@ -119,7 +122,7 @@ func (m *medianTime) AddTimeSample(sourceID string, timeVal time.Time) {
 	// of offsets while respecting the maximum number of allowed entries by
 	// replacing the oldest entry with the new entry once the maximum number
 	// of entries is reached.
-	now := time.Unix(time.Now().Unix(), 0)
+	now := time.Unix(m.now().Unix(), 0)
 	offsetSecs := int64(timeVal.Sub(now).Seconds())
 	numOffsets := len(m.offsets)
 	if numOffsets == maxMedianTimeEntries && maxMedianTimeEntries > 0 {
@@ -160,13 +163,16 @@ func (m *medianTime) AddTimeSample(sourceID string, timeVal time.Time) {
 
 	// Set the new offset when the median offset is within the allowed
 	// offset range.
-	if math.Abs(float64(median)) < maxAllowedOffsetSecs {
+	if math.Abs(float64(median)) < float64(m.maxOffsetSecs) {
 		m.offsetSecs = median
 	} else {
 		// The median offset of all added time data is larger than the
-		// maximum allowed offset, so don't use an offset.  This
-		// effectively limits how far the local clock can be skewed.
-		m.offsetSecs = 0
+		// maximum allowed offset, so clamp the offset to it.  This
+		// limits how far the local clock can be skewed.
+		m.offsetSecs = m.maxOffsetSecs
+		if median < 0 {
+			m.offsetSecs = -m.maxOffsetSecs
+		}
 
 		if !m.invalidTimeChecked {
 			m.invalidTimeChecked = true
@@ -183,9 +189,12 @@ func (m *medianTime) AddTimeSample(sourceID string, timeVal time.Time) {
 
 			// Warn if none of the time samples are close.
 			if !remoteHasCloseTime {
-				log.Warnf("Please check your date and time " +
-					"are correct!  Prova will not work " +
-					"properly with an invalid time")
+				log.Warnf("Please check your date and time "+
+					"are correct!  The local clock is off "+
+					"by %v from the median of the clocks "+
+					"of peers.  Prova will not work "+
+					"properly with an invalid time",
+					time.Duration(median)*time.Second)
 			}
 		}
 	}
@@ -211,9 +220,23 @@ func (m *medianTime) Offset() time.Duration {
 // rules necessary for proper time handling in the chain consensus rules and
 // expects the time samples to be added from the timestamp field of the version
 // message received from remote peers that successfully connect and negotiate.
+//
+// The local clock is adjusted by at most 70 minutes.  See NewMedianTimeSource
+// to use another limit.
 func NewMedianTime() MedianTimeSource {
+	return NewMedianTimeSource(maxAllowedOffsetSecs*time.Second, time.Now)
+}
+
+// NewMedianTimeSource returns a new instance of concurrency-safe implementation
+// of the MedianTimeSource interface like NewMedianTime, except the local clock
+// is adjusted by at most the passed maximum offset, which is typically the
+// MaxTimeOffset of the chain parameters, and is read from the passed function.
+// Tests may pass a manual clock in place of time.Now.
+func NewMedianTimeSource(maxOffset time.Duration, now func() time.Time) MedianTimeSource {
 	return &medianTime{
-		knownIDs: make(map[string]struct{}),
-		offsets:  make([]int64, 0, maxMedianTimeEntries),
+		now:           now,
+		maxOffsetSecs: int64(maxOffset / time.Second),
+		knownIDs:      make(map[string]struct{}),
+		offsets:       make([]int64, 0, maxMedianTimeEntries),
 	}
 }
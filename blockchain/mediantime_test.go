@@ -6,7 +6,9 @@
 package blockchain_test
 
 import (
+	"bytes"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -45,14 +47,14 @@ func TestMedianTime(t *testing.T) {
 		{in: []int64{-67, 67, -50, 24, 63, 17, 58, -14, 5, -32, -52, 45, 4}, wantOffset: 17},
 
 		// Offsets that are too far away from the local time should
-		// be ignored.
-		{in: []int64{-4201, 4202, -4203, 4204, -4205}, wantOffset: 0},
+		// be clamped to the max allowed adjustment.
+		{in: []int64{-4201, 4202, -4203, 4204, -4205}, wantOffset: -4200},
 
 		// Excerise the condition where the median offset is greater
 		// than the max allowed adjustment, but there is at least one
 		// sample that is close enough to the current time to avoid
 		// triggering a warning about an invalid local clock.
-		{in: []int64{4201, 4202, 4203, 4204, -299}, wantOffset: 0},
+		{in: []int64{4201, 4202, 4203, 4204, -299}, wantOffset: 4200},
 	}
 
 	// Modify the max number of allowed median time entries for these tests.
@@ -105,3 +107,77 @@ func TestMedianTime(t *testing.T) {
 		}
 	}
 }
+
+// TestMedianTimeSource ensures the median time offset computed from skewed
+// samples against a manual clock is clamped to the maximum offset, and the
+// local clock is only reported as wrong when none of the samples are close to
+// it.
+func TestMedianTimeSource(t *testing.T) {
+	const maxOffset = 10 * time.Minute
+	tests := []struct {
+		name       string
+		in         []time.Duration
+		wantOffset time.Duration
+		wantWarned bool
+	}{
+		{
+			name: "within max offset",
+			in: []time.Duration{-3 * time.Minute, 2 * time.Minute,
+				9 * time.Minute, time.Second, 4 * time.Minute},
+			wantOffset: 2 * time.Minute,
+		},
+		{
+			name: "clamped ahead",
+			in: []time.Duration{time.Hour, 2 * time.Hour, -time.Hour,
+				3 * time.Hour, 11 * time.Minute},
+			wantOffset: maxOffset,
+			wantWarned: true,
+		},
+		{
+			name: "clamped behind",
+			in: []time.Duration{-time.Hour, -2 * time.Hour, time.Hour,
+				-3 * time.Hour, -11 * time.Minute},
+			wantOffset: -maxOffset,
+			wantWarned: true,
+		},
+		{
+			name: "clamped with close sample",
+			in: []time.Duration{time.Hour, 2 * time.Hour, 3 * time.Hour,
+				4 * time.Hour, -4 * time.Minute},
+			wantOffset: maxOffset,
+		},
+	}
+
+	// The warning about the local clock is detected in the log output.
+	var logBuf bytes.Buffer
+	if err := blockchain.SetLogWriter(&logBuf, "warn"); err != nil {
+		t.Fatalf("SetLogWriter: unexpected error: %v", err)
+	}
+	defer blockchain.DisableLog()
+
+	now := time.Unix(1500000000, 0)
+	clock := func() time.Time { return now }
+	for _, test := range tests {
+		logBuf.Reset()
+		source := blockchain.NewMedianTimeSource(maxOffset, clock)
+		for i, offset := range test.in {
+			source.AddTimeSample(strconv.Itoa(i), now.Add(offset))
+		}
+
+		if offset := source.Offset(); offset != test.wantOffset {
+			t.Errorf("%s: got offset %v, want %v", test.name,
+				offset, test.wantOffset)
+		}
+		want := now.Add(test.wantOffset)
+		if adjusted := source.AdjustedTime(); !adjusted.Equal(want) {
+			t.Errorf("%s: got adjusted time %v, want %v", test.name,
+				adjusted, want)
+		}
+		warned := strings.Contains(logBuf.String(),
+			"Please check your date and time")
+		if warned != test.wantWarned {
+			t.Errorf("%s: got clock warning %v, want %v", test.name,
+				warned, test.wantWarned)
+		}
+	}
+}
@@ -6,7 +6,11 @@
 package blockchain
 
 import (
+	"container/list"
 	"fmt"
+
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/provautil"
 )
 
 // NotificationType represents the type of a notification message.
@@ -30,6 +34,31 @@ const (
 	// NTBlockDisconnected indicates the associated block was disconnected
 	// from the main chain.
 	NTBlockDisconnected
+
+	// NTReorganization indicates the main chain was reorganized.  It is
+	// sent once per reorganization after all of the associated
+	// NTBlockDisconnected and NTBlockConnected notifications and after the
+	// chain state reflects the new main chain.  Invalidating a block
+	// without a valid side chain to switch to sends it as well, with no
+	// attached blocks.
+	NTReorganization
+
+	// NTTxAcceptedVerbose indicates the associated transaction was
+	// accepted into the memory pool.  It is not sent by the block chain
+	// itself but by the owner of the memory pool through a Notifier.
+	NTTxAcceptedVerbose
+
+	// NTTxResurrected indicates the associated transaction of a block
+	// disconnected during a reorganization was added back to the memory
+	// pool.  Like NTTxAcceptedVerbose, it is sent by the owner of the
+	// memory pool.
+	NTTxResurrected
+
+	// NTTxReorgConflicted indicates the associated transaction of a block
+	// disconnected during a reorganization was not added back to the
+	// memory pool since it conflicts with the new main chain.  Like
+	// NTTxAcceptedVerbose, it is sent by the owner of the memory pool.
+	NTTxReorgConflicted
 )
 
 // notificationTypeStrings is a map of notification types back to their constant
@@ -38,6 +67,10 @@ var notificationTypeStrings = map[NotificationType]string{
 	NTBlockAccepted:     "NTBlockAccepted",
 	NTBlockConnected:    "NTBlockConnected",
 	NTBlockDisconnected: "NTBlockDisconnected",
+	NTReorganization:    "NTReorganization",
+	NTTxAcceptedVerbose: "NTTxAcceptedVerbose",
+	NTTxResurrected:     "NTTxResurrected",
+	NTTxReorgConflicted: "NTTxReorgConflicted",
 }
 
 // String returns the NotificationType in human-readable form.
@@ -48,27 +81,74 @@ func (n NotificationType) String() string {
 	return fmt.Sprintf("Unknown Notification Type (%d)", int(n))
 }
 
-// Notification defines notification that is sent to the caller via the callback
-// function provided during the call to New and consists of a notification type
-// as well as associated data that depends on the type as follows:
-// 	- NTBlockAccepted:     *provautil.Block
-// 	- NTBlockConnected:    *provautil.Block
-// 	- NTBlockDisconnected: *provautil.Block
+// Notification defines a notification that is sent to the callback function
+// and the Notifier provided during the call to New.  It consists of a
+// notification type along with the associated data that depends on the type as
+// follows:
+// 	- NTBlockAccepted:     Block
+// 	- NTBlockConnected:    Block
+// 	- NTBlockDisconnected: Block
+// 	- NTReorganization:    Reorganization
+// 	- NTTxAcceptedVerbose: Tx
+// 	- NTTxResurrected:     Tx
+// 	- NTTxReorgConflicted: Tx
 type Notification struct {
-	Type NotificationType
-	Data interface{}
+	Type           NotificationType
+	Block          *provautil.Block
+	Reorganization *ReorganizationData
+	Tx             *provautil.Tx
+}
+
+// ReorganizationData is the data sent with an NTReorganization notification.
+// It describes the blocks which left and joined the main chain during a
+// single reorganization.
+type ReorganizationData struct {
+	// ForkHash and ForkHeight identify the common ancestor of the old and
+	// new main chains.
+	ForkHash   chainhash.Hash
+	ForkHeight uint32
+
+	// DetachedHashes are the hashes of the blocks disconnected from the
+	// main chain ordered from the old tip back to the fork point.
+	DetachedHashes []chainhash.Hash
+
+	// AttachedHashes are the hashes of the blocks connected to the main
+	// chain ordered from the fork point up to the new tip.  It is empty
+	// when blocks were only disconnected, such as when invalidating a
+	// block without a valid side chain to switch to.
+	AttachedHashes []chainhash.Hash
 }
 
-// sendNotification sends a notification with the passed type and data if the
-// caller requested notifications by providing a callback function in the call
-// to New.
-func (b *BlockChain) sendNotification(typ NotificationType, data interface{}) {
-	// Ignore it if the caller didn't request notifications.
-	if b.notifications == nil {
-		return
+// newReorganizationData returns the notification data for a reorganization
+// which detached the nodes in detachNodes and then attached the nodes in
+// attachNodes.  The lists must be in the order used by reorganizeChain and the
+// detach list must not be empty.
+func newReorganizationData(detachNodes, attachNodes *list.List) *ReorganizationData {
+	lastDetachNode := detachNodes.Back().Value.(*blockNode)
+	data := &ReorganizationData{
+		ForkHash:       *lastDetachNode.parentHash,
+		ForkHeight:     lastDetachNode.height - 1,
+		DetachedHashes: make([]chainhash.Hash, 0, detachNodes.Len()),
+		AttachedHashes: make([]chainhash.Hash, 0, attachNodes.Len()),
+	}
+	for e := detachNodes.Front(); e != nil; e = e.Next() {
+		n := e.Value.(*blockNode)
+		data.DetachedHashes = append(data.DetachedHashes, *n.hash)
+	}
+	for e := attachNodes.Front(); e != nil; e = e.Next() {
+		n := e.Value.(*blockNode)
+		data.AttachedHashes = append(data.AttachedHashes, *n.hash)
 	}
+	return data
+}
 
-	// Generate and send the notification.
-	n := Notification{Type: typ, Data: data}
-	b.notifications(&n)
+// sendNotification sends the passed notification to the callback function and
+// then to the subscribers of the Notifier provided in the call to New, if any.
+func (b *BlockChain) sendNotification(n *Notification) {
+	if b.notifications != nil {
+		b.notifications(n)
+	}
+	if b.notifier != nil {
+		b.notifier.Notify(n)
+	}
 }
@@ -0,0 +1,100 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/wire"
+)
+
+// TestReorganizationData ensures the reorganization notification data built
+// for a 3-block reorganization reports the fork point and lists the detached
+// blocks tip-first and the attached blocks fork-first.
+func TestReorganizationData(t *testing.T) {
+	params := &chaincfg.SimNetParams
+	bits := params.PowLimitBits
+	genesisHeader := params.GenesisBlock.Header
+	genesis := newBlockNode(&genesisHeader, params.GenesisHash)
+	genesis.inMainChain = true
+
+	// Build the following chain where the main chain ends at b4 and the
+	// side chain ending at b5a causes a reorganize which detaches b4, b3
+	// and b2.
+	//
+	//   genesis -> b1 -> b2 -> b3 -> b4
+	//                \-> b2a -> b3a -> b4a -> b5a
+	fork := buildWorkBranch(genesis, bits)
+	fork.inMainChain = true
+	var mainNodes []*blockNode
+	tip := fork
+	for i := 0; i < 3; i++ {
+		tip = buildWorkBranch(tip, bits)
+		tip.inMainChain = true
+		mainNodes = append(mainNodes, tip)
+	}
+	var sideNodes []*blockNode
+	tip = fork
+	for i := 0; i < 4; i++ {
+		// Use a different nonce so the side chain blocks have
+		// different hashes than the main chain blocks.
+		header := wire.BlockHeader{
+			PrevBlock: *tip.hash,
+			Bits:      bits,
+			Height:    tip.height + 1,
+			Nonce:     1,
+		}
+		hash := header.BlockHash()
+		node := newBlockNode(&header, &hash)
+		node.workSum.Add(tip.workSum, node.workSum)
+		node.parent = tip
+		tip.children = append(tip.children, node)
+		tip = node
+		sideNodes = append(sideNodes, tip)
+	}
+
+	chain := BlockChain{bestNode: mainNodes[len(mainNodes)-1]}
+	detachNodes, attachNodes := chain.getReorganizeNodes(tip)
+	data := newReorganizationData(detachNodes, attachNodes)
+
+	if data.ForkHash != *fork.hash {
+		t.Fatalf("unexpected fork hash -- got %v, want %v",
+			data.ForkHash, fork.hash)
+	}
+	if data.ForkHeight != fork.height {
+		t.Fatalf("unexpected fork height -- got %d, want %d",
+			data.ForkHeight, fork.height)
+	}
+
+	// The detached blocks must be ordered from the old tip back towards
+	// the fork point.
+	wantDetached := []chainhash.Hash{*mainNodes[2].hash,
+		*mainNodes[1].hash, *mainNodes[0].hash}
+	if len(data.DetachedHashes) != len(wantDetached) {
+		t.Fatalf("unexpected number of detached blocks -- got %d, "+
+			"want %d", len(data.DetachedHashes), len(wantDetached))
+	}
+	for i, hash := range data.DetachedHashes {
+		if hash != wantDetached[i] {
+			t.Errorf("detached block #%d -- got %v, want %v", i,
+				hash, wantDetached[i])
+		}
+	}
+
+	// The attached blocks must be ordered from the fork point up to the
+	// new tip.
+	if len(data.AttachedHashes) != len(sideNodes) {
+		t.Fatalf("unexpected number of attached blocks -- got %d, "+
+			"want %d", len(data.AttachedHashes), len(sideNodes))
+	}
+	for i, hash := range data.AttachedHashes {
+		if hash != *sideNodes[i].hash {
+			t.Errorf("attached block #%d -- got %v, want %v", i,
+				hash, sideNodes[i].hash)
+		}
+	}
+}
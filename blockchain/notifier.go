@@ -0,0 +1,114 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"sync"
+)
+
+// DefaultNotificationQueueSize is the default number of notifications queued
+// for each subscriber of a Notifier.
+const DefaultNotificationQueueSize = 1000
+
+// subscription houses the queue of a subscriber to a Notifier along with the
+// notification types it is interested in.
+type subscription struct {
+	types map[NotificationType]struct{}
+	queue chan Notification
+}
+
+// Notifier delivers notifications to any number of subscribers without
+// blocking the sender.  Each subscriber has its own buffered queue, so a slow
+// subscriber does not delay the delivery to the others.  Notifications are
+// delivered to every subscriber in the order they were sent.
+//
+// A subscriber which does not keep up and whose queue overflows is dropped:
+// its channel is closed after the notifications queued so far.  Since it misses
+// the notifications that follow, a subscriber which sees its channel closed
+// without cancelling the subscription must resubscribe and resynchronize with
+// the current state of the chain.
+type Notifier struct {
+	mtx         sync.Mutex
+	queueSize   int
+	nextID      uint64
+	subscribers map[uint64]*subscription
+}
+
+// NewNotifier returns a new notifier which queues up to the passed number of
+// notifications for each subscriber.
+func NewNotifier(queueSize int) *Notifier {
+	return &Notifier{
+		queueSize:   queueSize,
+		subscribers: make(map[uint64]*subscription),
+	}
+}
+
+// Subscribe returns a channel on which the notifications of the passed types
+// are delivered along with a function which cancels the subscription and closes
+// the channel.  Notifications of all types are delivered when no types are
+// passed.  See Notifier for the behavior when the subscriber does not keep up.
+//
+// This function is safe for concurrent access.
+func (n *Notifier) Subscribe(types ...NotificationType) (<-chan Notification, func()) {
+	sub := &subscription{queue: make(chan Notification, n.queueSize)}
+	if len(types) > 0 {
+		sub.types = make(map[NotificationType]struct{}, len(types))
+		for _, typ := range types {
+			sub.types[typ] = struct{}{}
+		}
+	}
+
+	n.mtx.Lock()
+	id := n.nextID
+	n.nextID++
+	n.subscribers[id] = sub
+	n.mtx.Unlock()
+
+	cancel := func() {
+		n.mtx.Lock()
+		n.unsubscribe(id)
+		n.mtx.Unlock()
+	}
+	return sub.queue, cancel
+}
+
+// unsubscribe removes the subscriber with the passed id and closes its
+// channel.  Subscribers which were already removed are ignored.
+//
+// This function MUST be called with the notifier lock held (for writes).
+func (n *Notifier) unsubscribe(id uint64) {
+	sub, ok := n.subscribers[id]
+	if !ok {
+		return
+	}
+	delete(n.subscribers, id)
+	close(sub.queue)
+}
+
+// Notify queues the passed notification for delivery to the subscribers of its
+// type.  It never blocks.
+//
+// This function is safe for concurrent access.
+func (n *Notifier) Notify(notification *Notification) {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+
+	for id, sub := range n.subscribers {
+		if sub.types != nil {
+			if _, ok := sub.types[notification.Type]; !ok {
+				continue
+			}
+		}
+
+		select {
+		case sub.queue <- *notification:
+		default:
+			log.Warnf("Dropping notification subscriber which did "+
+				"not keep up with %d queued notifications",
+				n.queueSize)
+			n.unsubscribe(id)
+		}
+	}
+}
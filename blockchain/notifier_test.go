@@ -0,0 +1,79 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/wire"
+)
+
+// TestNotifierStuckSubscriber ensures a subscriber which does not read its
+// notifications neither blocks the sender nor delays the other subscribers,
+// and is dropped once its queue overflows.
+func TestNotifierStuckSubscriber(t *testing.T) {
+	const queueSize = 3
+	n := NewNotifier(queueSize)
+	stuck, cancelStuck := n.Subscribe()
+	defer cancelStuck()
+	active, cancelActive := n.Subscribe(NTBlockConnected)
+	txns, cancelTxns := n.Subscribe(NTTxAcceptedVerbose)
+
+	blocks := make([]*provautil.Block, 2*queueSize)
+	for i := range blocks {
+		blocks[i] = provautil.NewBlock(&wire.MsgBlock{
+			Header: wire.BlockHeader{Nonce: uint64(i)},
+		})
+	}
+	notify := func(block *provautil.Block) {
+		done := make(chan struct{})
+		go func() {
+			n.Notify(&Notification{Type: NTBlockConnected,
+				Block: block})
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("Notify: blocked by a stuck subscriber")
+		}
+	}
+
+	for i, block := range blocks {
+		notify(block)
+		got := <-active
+		if got.Type != NTBlockConnected || got.Block != block {
+			t.Fatalf("active subscriber: got notification %v for "+
+				"block %v, want block #%d", got.Type, got.Block, i)
+		}
+	}
+
+	// The stuck subscriber receives the notifications queued before its
+	// queue overflowed followed by the close of its channel.
+	for i := 0; i < queueSize; i++ {
+		got, ok := <-stuck
+		if !ok || got.Block != blocks[i] {
+			t.Fatalf("stuck subscriber: notification #%d missing", i)
+		}
+	}
+	if _, ok := <-stuck; ok {
+		t.Fatalf("stuck subscriber: channel not closed on overflow")
+	}
+
+	// Subscribers only receive the types they subscribed to and their
+	// channels are closed when cancelled.
+	if len(txns) != 0 {
+		t.Fatalf("got %d notifications of unsubscribed types", len(txns))
+	}
+	cancelTxns()
+	cancelTxns()
+	if _, ok := <-txns; ok {
+		t.Fatalf("channel not closed on cancel")
+	}
+	cancelActive()
+	notify(blocks[0])
+}
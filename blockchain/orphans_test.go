@@ -0,0 +1,112 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/wire"
+)
+
+// newOrphanPool returns a chain instance with an empty orphan pool.
+func newOrphanPool() *BlockChain {
+	return &BlockChain{
+		orphans:     make(map[chainhash.Hash]*orphanBlock),
+		prevOrphans: make(map[chainhash.Hash][]*orphanBlock),
+	}
+}
+
+// orphanTestBlock returns a block with a parent made up from the passed nonce
+// which pays to the passed public key script.
+func orphanTestBlock(nonce uint64, pkScript []byte) *provautil.Block {
+	var prevHash chainhash.Hash
+	byteOrder.PutUint64(prevHash[:], nonce)
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxOut(wire.NewTxOut(0, pkScript))
+	return provautil.NewBlock(&wire.MsgBlock{
+		Header: wire.BlockHeader{
+			PrevBlock: prevHash,
+			Nonce:     nonce,
+		},
+		Transactions: []*wire.MsgTx{tx},
+	})
+}
+
+// checkOrphanPool ensures the orphan pool houses exactly the passed blocks and
+// its indexes and total size are consistent with them.
+func checkOrphanPool(t *testing.T, b *BlockChain, want []*provautil.Block) {
+	if len(b.orphans) != len(want) {
+		t.Fatalf("got %d orphans, want %d", len(b.orphans), len(want))
+	}
+	var size int
+	for _, block := range want {
+		if !b.IsKnownOrphan(block.Hash()) {
+			t.Fatalf("orphan %v not in the pool", block.Hash())
+		}
+		prevHash := block.MsgBlock().Header.PrevBlock
+		if len(b.prevOrphans[prevHash]) != 1 {
+			t.Fatalf("orphan %v not indexed by its parent",
+				block.Hash())
+		}
+		size += block.MsgBlock().SerializeSize()
+	}
+	if len(b.prevOrphans) != len(want) {
+		t.Fatalf("got %d parents indexed, want %d", len(b.prevOrphans),
+			len(want))
+	}
+	if b.orphanBytes != size {
+		t.Fatalf("got %d orphan bytes, want %d", b.orphanBytes, size)
+	}
+}
+
+// TestOrphanPoolLimits ensures the oldest orphans are evicted once the orphan
+// pool exceeds either the maximum number of orphans or their maximum total
+// size.
+func TestOrphanPoolLimits(t *testing.T) {
+	// Fill the pool up to the maximum number of orphans and ensure the
+	// next orphan evicts the oldest.
+	b := newOrphanPool()
+	blocks := make([]*provautil.Block, maxOrphanBlocks+1)
+	for i := range blocks {
+		blocks[i] = orphanTestBlock(uint64(i), nil)
+		b.addOrphanBlock(blocks[i])
+	}
+	checkOrphanPool(t, b, blocks[1:])
+
+	// Ensure orphans which together exceed the maximum total size evict
+	// the oldest orphans until the new one fits.
+	b = newOrphanPool()
+	pkScript := make([]byte, maxOrphanBlockBytes/4)
+	blocks = make([]*provautil.Block, 5)
+	for i := range blocks {
+		blocks[i] = orphanTestBlock(uint64(i), pkScript)
+		b.addOrphanBlock(blocks[i])
+	}
+	checkOrphanPool(t, b, blocks[2:])
+	if b.orphanBytes > maxOrphanBlockBytes {
+		t.Fatalf("got %d orphan bytes, want at most %d", b.orphanBytes,
+			maxOrphanBlockBytes)
+	}
+
+	// Ensure processed orphans no longer count against the limits.
+	b.removeOrphanBlock(b.orphans[*blocks[3].Hash()])
+	checkOrphanPool(t, b, []*provautil.Block{blocks[2], blocks[4]})
+}
+
+// TestOrphanPoolExpiration ensures expired orphans are removed from the orphan
+// pool when new orphans are added.
+func TestOrphanPoolExpiration(t *testing.T) {
+	b := newOrphanPool()
+	expired := orphanTestBlock(0, nil)
+	b.addOrphanBlock(expired)
+	b.orphans[*expired.Hash()].expiration = time.Now().Add(-time.Second)
+
+	blocks := []*provautil.Block{orphanTestBlock(1, nil)}
+	b.addOrphanBlock(blocks[0])
+	checkOrphanPool(t, b, blocks)
+}
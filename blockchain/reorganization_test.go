@@ -11,11 +11,15 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 
 	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/blockchain/fullblocktests"
 	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/metrics"
 	"github.com/bitgo/prova/provautil"
 	"github.com/bitgo/prova/wire"
 )
@@ -132,3 +136,240 @@ func loadBlocks(filename string) (blocks []*provautil.Block, err error) {
 
 	return
 }
+
+// TestMaxReorgDepth ensures reorganizations which disconnect up to the maximum
+// reorganization depth are performed while deeper ones are refused.  The
+// blocks generated by the fullblocktests package up to b27 contain
+// reorganizations which disconnect one and two blocks, the last of which is
+// caused by b27.
+func TestMaxReorgDepth(t *testing.T) {
+	tests, err := fullblocktests.Generate(false)
+	if err != nil {
+		t.Fatalf("failed to generate tests: %v", err)
+	}
+	var blocks []fullblocktests.AcceptedBlock
+	for _, testInstances := range tests {
+		for _, item := range testInstances {
+			accepted, ok := item.(fullblocktests.AcceptedBlock)
+			if !ok || len(blocks) > 0 &&
+				blocks[len(blocks)-1].Name == "b27" {
+
+				continue
+			}
+			blocks = append(blocks, accepted)
+		}
+	}
+	deepReorgBlock := blocks[len(blocks)-1]
+	if deepReorgBlock.Name != "b27" {
+		t.Fatalf("test block b27 not found")
+	}
+
+	for _, maxReorgDepth := range []uint32{1, 2} {
+		chain, teardownFunc, err := chainSetupWithConfig("maxreorgdepth",
+			&chaincfg.RegressionNetParams,
+			blockchain.Config{MaxReorgDepth: maxReorgDepth})
+		if err != nil {
+			t.Fatalf("failed to setup chain instance: %v", err)
+		}
+
+		// All blocks other than b27 only require reorganizations
+		// which disconnect a single block.
+		for _, item := range blocks[:len(blocks)-1] {
+			isMainChain, _, err := chain.ProcessBlock(
+				provautil.NewBlock(item.Block), blockchain.BFNone)
+			if err != nil {
+				teardownFunc()
+				t.Fatalf("max depth %d: block %q should have "+
+					"been accepted: %v", maxReorgDepth,
+					item.Name, err)
+			}
+			if isMainChain != item.IsMainChain {
+				teardownFunc()
+				t.Fatalf("max depth %d: block %q unexpected main "+
+					"chain flag -- got %v, want %v",
+					maxReorgDepth, item.Name, isMainChain,
+					item.IsMainChain)
+			}
+		}
+		prevBest := chain.BestSnapshot()
+
+		isMainChain, _, err := chain.ProcessBlock(
+			provautil.NewBlock(deepReorgBlock.Block), blockchain.BFNone)
+		best := chain.BestSnapshot()
+		finalizedHeight, finalizedErr := chain.FinalizedHeight()
+		teardownFunc()
+		if finalizedErr != nil {
+			t.Fatalf("max depth %d: FinalizedHeight: unexpected "+
+				"error: %v", maxReorgDepth, finalizedErr)
+		}
+		if want := best.Height - maxReorgDepth; finalizedHeight != want {
+			t.Fatalf("max depth %d: unexpected finalized height -- "+
+				"got %d, want %d", maxReorgDepth, finalizedHeight,
+				want)
+		}
+
+		// The reorganization caused by b27 disconnects two blocks, so
+		// it must be refused when only one is allowed.
+		if maxReorgDepth < 2 {
+			rerr, ok := err.(blockchain.RuleError)
+			if !ok || rerr.ErrorCode != blockchain.ErrReorgTooDeep {
+				t.Fatalf("max depth %d: block %q did not receive "+
+					"expected error -- got %v, want %v",
+					maxReorgDepth, deepReorgBlock.Name, err,
+					blockchain.ErrReorgTooDeep)
+			}
+			if *best.Hash != *prevBest.Hash {
+				t.Fatalf("max depth %d: best block changed to %v "+
+					"after refused reorganization",
+					maxReorgDepth, best.Hash)
+			}
+			continue
+		}
+		if err != nil || !isMainChain {
+			t.Fatalf("max depth %d: block %q should have caused a "+
+				"reorganization -- main chain %v, err %v",
+				maxReorgDepth, deepReorgBlock.Name, isMainChain,
+				err)
+		}
+		if *best.Hash != deepReorgBlock.Block.BlockHash() {
+			t.Fatalf("max depth %d: unexpected best block -- got %v, "+
+				"want %v", maxReorgDepth, best.Hash,
+				deepReorgBlock.Block.BlockHash())
+		}
+	}
+}
+
+// TestReorganizationNotifications ensures the subscribers of the notifier
+// receive the notifications in the order the blocks were connected and
+// disconnected, with the reorganizations reported after the blocks they
+// detached and attached.  It also ensures the metrics of the chain track the
+// same blocks and reorganizations.
+func TestReorganizationNotifications(t *testing.T) {
+	tests, err := fullblocktests.Generate(false)
+	if err != nil {
+		t.Fatalf("failed to generate tests: %v", err)
+	}
+	var blocks []fullblocktests.AcceptedBlock
+	for _, testInstances := range tests {
+		for _, item := range testInstances {
+			accepted, ok := item.(fullblocktests.AcceptedBlock)
+			if !ok || len(blocks) > 0 &&
+				blocks[len(blocks)-1].Name == "b27" {
+
+				continue
+			}
+			blocks = append(blocks, accepted)
+		}
+	}
+
+	notifier := blockchain.NewNotifier(blockchain.DefaultNotificationQueueSize)
+	ntfns, cancel := notifier.Subscribe(blockchain.NTBlockConnected,
+		blockchain.NTBlockDisconnected, blockchain.NTReorganization)
+	defer cancel()
+	registry := metrics.NewRegistry()
+	chain, teardownFunc, err := chainSetupWithConfig("reorgntfns",
+		&chaincfg.RegressionNetParams,
+		blockchain.Config{Notifier: notifier, Metrics: registry})
+	if err != nil {
+		t.Fatalf("failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	tip := *chain.BestSnapshot().Hash
+	for _, item := range blocks {
+		_, _, err := chain.ProcessBlock(provautil.NewBlock(item.Block),
+			blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("block %q should have been accepted: %v",
+				item.Name, err)
+		}
+	}
+
+	// Replay the notifications on top of the initial best block.  Every
+	// block must be connected on top of the current tip and only the tip
+	// may be disconnected.
+	var detached, attached []chainhash.Hash
+	numReorgs, numConnected, numDisconnected := 0, 0, 0
+	for len(ntfns) > 0 {
+		n := <-ntfns
+		switch n.Type {
+		case blockchain.NTBlockConnected:
+			header := n.Block.MsgBlock().Header
+			if header.PrevBlock != tip {
+				t.Fatalf("block %v connected on top of %v, want %v",
+					n.Block.Hash(), header.PrevBlock, tip)
+			}
+			tip = *n.Block.Hash()
+			attached = append(attached, tip)
+			numConnected++
+
+		case blockchain.NTBlockDisconnected:
+			if *n.Block.Hash() != tip {
+				t.Fatalf("block %v disconnected, want tip %v",
+					n.Block.Hash(), tip)
+			}
+			tip = n.Block.MsgBlock().Header.PrevBlock
+			numDisconnected++
+
+			// A reorganization starts, so only the blocks
+			// connected from here on are attached by it.
+			if len(detached) == 0 {
+				attached = attached[:0]
+			}
+			detached = append(detached, *n.Block.Hash())
+
+		case blockchain.NTReorganization:
+			numReorgs++
+			data := n.Reorganization
+			if len(detached) == 0 ||
+				!reflect.DeepEqual(data.DetachedHashes, detached) {
+
+				t.Fatalf("reorganization detached %v, want %v",
+					data.DetachedHashes, detached)
+			}
+			if !reflect.DeepEqual(data.AttachedHashes, attached) {
+				t.Fatalf("reorganization attached %v, want %v",
+					data.AttachedHashes, attached)
+			}
+			detached = detached[:0]
+			attached = attached[:0]
+
+		default:
+			t.Fatalf("unexpected notification %v", n.Type)
+		}
+	}
+
+	if numReorgs == 0 || len(detached) > 0 {
+		t.Fatalf("%d reorganization notifications received, %d "+
+			"disconnected blocks unreported", numReorgs,
+			len(detached))
+	}
+	best := chain.BestSnapshot()
+	if *best.Hash != tip {
+		t.Fatalf("notifications end at %v, want best block %v", tip,
+			best.Hash)
+	}
+
+	samples := make(map[string]metrics.Sample)
+	for _, sample := range registry.Snapshot() {
+		samples[sample.Name] = sample
+	}
+	wantValues := map[string]int{
+		"prova_chain_height":                    int(best.Height),
+		"prova_chain_blocks_connected_total":    numConnected,
+		"prova_chain_blocks_disconnected_total": numDisconnected,
+	}
+	for name, want := range wantValues {
+		if got := samples[name].Value; got != float64(want) {
+			t.Errorf("metric %s: got %v, want %d", name, got, want)
+		}
+	}
+	if got := samples["prova_chain_reorg_depth"].Count; got != uint64(numReorgs) {
+		t.Errorf("metric prova_chain_reorg_depth: got count %d, want %d",
+			got, numReorgs)
+	}
+	if samples["prova_chain_block_validation_seconds"].Count == 0 {
+		t.Error("metric prova_chain_block_validation_seconds: no " +
+			"validations observed")
+	}
+}
@@ -7,11 +7,14 @@ package blockchain
 
 import (
 	"fmt"
+	"github.com/bitgo/prova/btcec"
 	"github.com/bitgo/prova/provautil"
 	"github.com/bitgo/prova/txscript"
 	"github.com/bitgo/prova/wire"
 	"math"
 	"runtime"
+	"sync"
+	"sync/atomic"
 )
 
 // txValidateItem holds a transaction along with which input to validate.
@@ -22,231 +25,216 @@ type txValidateItem struct {
 	sigHashes *txscript.TxSigHashes // sighashes, as introduced with BIP0143, to be re-used with other inputs
 }
 
-// txValidator provides a type which asynchronously validates transaction
-// inputs.  It provides several channels for communication and a processing
-// function that is intended to be in run multiple goroutines.
+// txValidator provides a type which concurrently validates transaction inputs
+// using a bounded pool of worker goroutines.
 type txValidator struct {
-	validateChan chan *txValidateItem
-	quitChan     chan struct{}
-	resultChan   chan error
-	utxoView     *UtxoViewpoint
-	keyView      *KeyViewpoint
-	flags        txscript.ScriptFlags
-	sigCache     *txscript.SigCache
-	hashCache    *txscript.HashCache
+	utxoView   *UtxoViewpoint
+	keyView    *KeyViewpoint
+	flags      txscript.ScriptFlags
+	sigCache   *txscript.SigCache
+	hashCache  *txscript.HashCache
+	numWorkers int
 }
 
-// sendResult sends the result of a script pair validation on the internal
-// result channel while respecting the quit channel.  The allows orderly
-// shutdown when the validation process is aborted early due to a validation
-// error in one of the other goroutines.
-func (v *txValidator) sendResult(result error) {
-	select {
-	case v.resultChan <- result:
-	case <-v.quitChan:
+// validateItem validates the script pair referenced by the passed validation
+// item and returns a rule error which identifies the transaction input when it
+// fails.  It is safe to call concurrently from multiple goroutines.
+func (v *txValidator) validateItem(txVI *txValidateItem) error {
+	// Ensure the referenced input transaction is available.
+	txIn := txVI.txIn
+	originTxHash := &txIn.PreviousOutPoint.Hash
+	originTxIndex := txIn.PreviousOutPoint.Index
+	txEntry := v.utxoView.LookupEntry(originTxHash)
+	if txEntry == nil {
+		str := fmt.Sprintf("unable to find input "+
+			"transaction %v referenced from "+
+			"transaction %v", originTxHash,
+			txVI.tx.Hash())
+		return ruleError(ErrMissingTx, str)
 	}
-}
-
-// validateHandler consumes items to validate from the internal validate channel
-// and returns the result of the validation on the internal result channel. It
-// must be run as a goroutine.
-func (v *txValidator) validateHandler() {
-out:
-	for {
-		select {
-		case txVI := <-v.validateChan:
-			// Ensure the referenced input transaction is available.
-			txIn := txVI.txIn
-			originTxHash := &txIn.PreviousOutPoint.Hash
-			originTxIndex := txIn.PreviousOutPoint.Index
-			txEntry := v.utxoView.LookupEntry(originTxHash)
-			if txEntry == nil {
-				str := fmt.Sprintf("unable to find input "+
-					"transaction %v referenced from "+
-					"transaction %v", originTxHash,
-					txVI.tx.Hash())
-				err := ruleError(ErrMissingTx, str)
-				v.sendResult(err)
-				break out
-			}
-
-			// Ensure the referenced input transaction public key
-			// script is available.
-			pkScript := txEntry.PkScriptByIndex(originTxIndex)
-			if pkScript == nil {
-				str := fmt.Sprintf("unable to find unspent "+
-					"output %v script referenced from "+
-					"transaction %s:%d",
-					txIn.PreviousOutPoint, txVI.tx.Hash(),
-					txVI.txInIndex)
-				err := ruleError(ErrBadTxInput, str)
-				v.sendResult(err)
-				break out
-			}
-
-			// Before passing the script to the VM, we check whether it is an Prova script.
-			pops, err := txscript.ParseScript(pkScript)
-			if err != nil {
-				str := fmt.Sprintf("failed to parse script %s: %v", originTxHash, err)
-				err := ruleError(ErrScriptMalformed, str)
-				v.sendResult(err)
-				break out
-			}
-			// If script is Prova script, we replace all keyIDs with pubKeyHashes.
-			scriptType := txscript.TypeOfScript(pops)
-			if scriptType == txscript.ProvaTy || scriptType == txscript.GeneralProvaTy {
-				keyIDs, err := txscript.ExtractKeyIDs(pops)
-				if err != nil {
-					str := fmt.Sprintf("failed to extract keyIDs %s: %v", originTxHash, err)
-					err := ruleError(ErrScriptMalformed, str)
-					v.sendResult(err)
-					break out
-				}
-				keyIdMap := v.keyView.LookupKeyIDs(keyIDs)
-				err = txscript.ReplaceKeyIDs(pops, keyIdMap)
-				if err != nil {
-					str := fmt.Sprintf("failed to replace keyIDs %v, %v in %s", keyIDs[0], keyIDs[1], originTxHash)
-					err := ruleError(ErrScriptMalformed, str)
-					v.sendResult(err)
-					break out
-				}
-				pkScript, err = txscript.UnparseScript(pops)
-				if err != nil {
-					str := fmt.Sprintf("failed to unparse script %s: %v", originTxHash, err)
-					err := ruleError(ErrScriptMalformed, str)
-					v.sendResult(err)
-					break out
-				}
-			}
 
-			// If script is Prova admin script, we replace the threadID with pubKeyHashes.
-			if txscript.TypeOfScript(pops) == txscript.ProvaAdminTy {
-				threadID, err := txscript.ExtractThreadID(pops)
-				if err != nil {
-					str := fmt.Sprintf("failed to extract threadID %s: %v", originTxHash, err)
-					err := ruleError(ErrScriptMalformed, str)
-					v.sendResult(err)
-					break out
-				}
-				keyHashes := v.keyView.GetAdminKeyHashes(threadID)
-				pkScript, err = txscript.ThreadPkScript(keyHashes)
-				if err != nil {
-					str := fmt.Sprintf("failed to replace threadID %s: %v", originTxHash, err)
-					err := ruleError(ErrScriptMalformed, str)
-					v.sendResult(err)
-					break out
-				}
-			}
+	// Ensure the referenced input transaction public key
+	// script is available.
+	pkScript := txEntry.PkScriptByIndex(originTxIndex)
+	if pkScript == nil {
+		str := fmt.Sprintf("unable to find unspent "+
+			"output %v script referenced from "+
+			"transaction %s:%d",
+			txIn.PreviousOutPoint, txVI.tx.Hash(),
+			txVI.txInIndex)
+		return ruleError(ErrBadTxInput, str)
+	}
 
-			// Create a new script engine for the script pair.
-			sigScript := txIn.SignatureScript
-			inputAmount := txEntry.AmountByIndex(originTxIndex)
-			vm, err := txscript.NewEngine(pkScript, txVI.tx.MsgTx(),
-				txVI.txInIndex, v.flags, v.sigCache, txVI.sigHashes, inputAmount)
-			if err != nil {
-				str := fmt.Sprintf("failed to parse input "+
-					"%s:%d which references output %s:%d - "+
-					"%v (input script bytes %x, prev output "+
-					"script bytes %x)", txVI.tx.Hash(),
-					txVI.txInIndex, originTxHash,
-					originTxIndex, err, sigScript, pkScript)
-				err := ruleError(ErrScriptMalformed, str)
-				v.sendResult(err)
-				break out
-			}
+	// Before passing the script to the VM, we check whether it is an Prova script.
+	pops, err := txscript.ParseScript(pkScript)
+	if err != nil {
+		str := fmt.Sprintf("failed to parse output %v script "+
+			"referenced from input %s:%d: %v", txIn.PreviousOutPoint,
+			txVI.tx.Hash(), txVI.txInIndex, err)
+		return ruleError(ErrScriptMalformed, str)
+	}
+	// If script is Prova script, we replace all keyIDs with pubKeyHashes.
+	scriptType := txscript.TypeOfScript(pops)
+	if scriptType == txscript.ProvaTy || scriptType == txscript.GeneralProvaTy ||
+		scriptType == txscript.ProvaTimeLockTy {
+		keyIDs, err := txscript.ExtractKeyIDs(pops)
+		if err != nil {
+			str := fmt.Sprintf("failed to extract keyIDs from output "+
+				"%v referenced from input %s:%d: %v",
+				txIn.PreviousOutPoint, txVI.tx.Hash(),
+				txVI.txInIndex, err)
+			return ruleError(ErrScriptMalformed, str)
+		}
+		keyIdMap := v.keyView.LookupKeyIDs(keyIDs)
+		err = txscript.ReplaceKeyIDs(pops, keyIdMap)
+		if err != nil {
+			str := fmt.Sprintf("failed to replace keyIDs %v, %v in "+
+				"output %v referenced from input %s:%d", keyIDs[0],
+				keyIDs[1], txIn.PreviousOutPoint, txVI.tx.Hash(),
+				txVI.txInIndex)
+			return ruleError(ErrScriptMalformed, str)
+		}
+		pkScript, err = txscript.UnparseScript(pops)
+		if err != nil {
+			str := fmt.Sprintf("failed to unparse output %v script "+
+				"referenced from input %s:%d: %v",
+				txIn.PreviousOutPoint, txVI.tx.Hash(),
+				txVI.txInIndex, err)
+			return ruleError(ErrScriptMalformed, str)
+		}
+	}
 
-			// Execute the script pair.
-			if err := vm.Execute(); err != nil {
-				str := fmt.Sprintf("failed to validate input "+
-					"%s:%d which references output %s:%d - "+
-					"%v (input script bytes %x, prev output "+
-					"script bytes %x)", txVI.tx.Hash(),
-					txVI.txInIndex, originTxHash,
-					originTxIndex, err, sigScript, pkScript)
-				err := ruleError(ErrScriptValidation, str)
-				v.sendResult(err)
-				break out
-			}
+	// If script is Prova admin script, we replace the threadID with pubKeyHashes.
+	if txscript.TypeOfScript(pops) == txscript.ProvaAdminTy {
+		threadID, err := txscript.ExtractThreadID(pops)
+		if err != nil {
+			str := fmt.Sprintf("failed to extract threadID from "+
+				"output %v referenced from input %s:%d: %v",
+				txIn.PreviousOutPoint, txVI.tx.Hash(),
+				txVI.txInIndex, err)
+			return ruleError(ErrScriptMalformed, str)
+		}
+		keyHashes := v.keyView.GetAdminKeyHashes(threadID)
+		pkScript, err = txscript.ThreadPkScript(keyHashes)
+		if err != nil {
+			str := fmt.Sprintf("failed to replace threadID in output "+
+				"%v referenced from input %s:%d: %v",
+				txIn.PreviousOutPoint, txVI.tx.Hash(),
+				txVI.txInIndex, err)
+			return ruleError(ErrScriptMalformed, str)
+		}
+	}
 
-			// Validation succeeded.
-			v.sendResult(nil)
+	// Create a new script engine for the script pair.
+	sigScript := txIn.SignatureScript
+	inputAmount := txEntry.AmountByIndex(originTxIndex)
+	vm, err := txscript.NewEngine(pkScript, txVI.tx.MsgTx(),
+		txVI.txInIndex, v.flags, v.sigCache, txVI.sigHashes, inputAmount)
+	if err != nil {
+		str := fmt.Sprintf("failed to parse input "+
+			"%s:%d which references output %s:%d - "+
+			"%v (input script bytes %x, prev output "+
+			"script bytes %x)", txVI.tx.Hash(),
+			txVI.txInIndex, originTxHash,
+			originTxIndex, err, sigScript, pkScript)
+		return ruleError(ErrScriptMalformed, str)
+	}
 
-		case <-v.quitChan:
-			break out
-		}
+	// Execute the script pair.
+	if err := vm.Execute(); err != nil {
+		str := fmt.Sprintf("failed to validate input "+
+			"%s:%d which references output %s:%d - "+
+			"%v (input script bytes %x, prev output "+
+			"script bytes %x)", txVI.tx.Hash(),
+			txVI.txInIndex, originTxHash,
+			originTxIndex, err, sigScript, pkScript)
+		return ruleError(ErrScriptValidation, str)
 	}
+
+	return nil
 }
 
 // Validate validates the scripts for all of the passed transaction inputs using
 // multiple goroutines.
+//
+// The workers claim items in order and stop claiming new ones as soon as any
+// item fails validation, so processing is aborted early.  However, since all
+// items before a failing item are always validated, the returned error is
+// deterministically the one for the first failing item in the passed slice
+// regardless of the order in which the workers finish.
 func (v *txValidator) Validate(items []*txValidateItem) error {
 	if len(items) == 0 {
 		return nil
 	}
 
-	// Limit the number of goroutines to do script validation based on the
-	// number of processor cores.  This help ensure the system stays
-	// reasonably responsive under heavy load.
-	maxGoRoutines := runtime.NumCPU() * 3
-	if maxGoRoutines <= 0 {
-		maxGoRoutines = 1
-	}
-	if maxGoRoutines > len(items) {
-		maxGoRoutines = len(items)
+	// Limit the number of goroutines to do script validation.  This helps
+	// ensure the system stays reasonably responsive under heavy load.
+	numWorkers := v.numWorkers
+	if numWorkers <= 0 {
+		numWorkers = runtime.GOMAXPROCS(0)
 	}
-
-	// Start up validation handlers that are used to asynchronously
-	// validate each transaction input.
-	for i := 0; i < maxGoRoutines; i++ {
-		go v.validateHandler()
+	if numWorkers > len(items) {
+		numWorkers = len(items)
 	}
 
-	// Validate each of the inputs.  The quit channel is closed when any
-	// errors occur so all processing goroutines exit regardless of which
-	// input had the validation error.
-	numInputs := len(items)
-	currentItem := 0
-	processedItems := 0
-	for processedItems < numInputs {
-		// Only send items while there are still items that need to
-		// be processed.  The select statement will never select a nil
-		// channel.
-		var validateChan chan *txValidateItem
-		var item *txValidateItem
-		if currentItem < numInputs {
-			validateChan = v.validateChan
-			item = items[currentItem]
-		}
+	// nextItem is the index of the most recently claimed item and failIdx
+	// is the index of the first item known to have failed validation, or
+	// the number of items when there have been no failures.  Both are
+	// only accessed atomically.
+	nextItem := int64(-1)
+	failIdx := int64(len(items))
+	errs := make([]error, len(items))
+
+	var wg sync.WaitGroup
+	wg.Add(numWorkers)
+	for i := 0; i < numWorkers; i++ {
+		go func() {
+			defer wg.Done()
+			for {
+				idx := atomic.AddInt64(&nextItem, 1)
+				if idx >= atomic.LoadInt64(&failIdx) {
+					return
+				}
 
-		select {
-		case validateChan <- item:
-			currentItem++
+				err := v.validateItem(items[idx])
+				if err == nil {
+					continue
+				}
 
-		case err := <-v.resultChan:
-			processedItems++
-			if err != nil {
-				close(v.quitChan)
-				return err
+				// Record the error and lower the failure index when
+				// this item precedes any other known failure.
+				errs[idx] = err
+				for {
+					cur := atomic.LoadInt64(&failIdx)
+					if idx >= cur || atomic.CompareAndSwapInt64(
+						&failIdx, cur, idx) {
+						break
+					}
+				}
 			}
-		}
+		}()
 	}
+	wg.Wait()
 
-	close(v.quitChan)
+	if failIdx < int64(len(items)) {
+		return errs[failIdx]
+	}
 	return nil
 }
 
 // newTxValidator returns a new instance of txValidator to be used for
 // validating transaction scripts asynchronously.
-func newTxValidator(utxoView *UtxoViewpoint, keyView *KeyViewpoint, flags txscript.ScriptFlags, sigCache *txscript.SigCache, hashCache *txscript.HashCache) *txValidator {
+//
+// The number of worker goroutines is limited to the passed value.  A value of
+// zero or less uses the current value of GOMAXPROCS.
+func newTxValidator(utxoView *UtxoViewpoint, keyView *KeyViewpoint, flags txscript.ScriptFlags, sigCache *txscript.SigCache, hashCache *txscript.HashCache, numWorkers int) *txValidator {
 	return &txValidator{
-		validateChan: make(chan *txValidateItem),
-		quitChan:     make(chan struct{}),
-		resultChan:   make(chan error),
-		utxoView:     utxoView,
-		keyView:      keyView,
-		sigCache:     sigCache,
-		hashCache:    hashCache,
-		flags:        flags,
+		utxoView:   utxoView,
+		keyView:    keyView,
+		sigCache:   sigCache,
+		hashCache:  hashCache,
+		flags:      flags,
+		numWorkers: numWorkers,
 	}
 }
 
@@ -287,13 +275,57 @@ func ValidateTransactionScripts(tx *provautil.Tx, utxoView *UtxoViewpoint, keyVi
 	}
 
 	// Validate all of the inputs.
-	validator := newTxValidator(utxoView, keyView, flags, sigCache, hashCache)
+	validator := newTxValidator(utxoView, keyView, flags, sigCache, hashCache, 0)
 	return validator.Validate(txValItems)
 }
 
+// ValidateThreadSignatures validates the signatures the first input of the
+// passed admin transaction provides for the passed admin thread against the
+// passed admin key sets.  Unlike ValidateTransactionScripts, the spent thread
+// output does not need to be known, which allows checking the authorization of
+// admin transactions before they are connected to the chain.
+func ValidateThreadSignatures(tx *provautil.Tx, threadID provautil.ThreadID, keySets map[btcec.KeySetType]btcec.PublicKeySet, flags txscript.ScriptFlags, sigCache *txscript.SigCache) error {
+	msgTx := tx.MsgTx()
+	if len(msgTx.TxIn) == 0 {
+		str := fmt.Sprintf("admin transaction %v has no inputs",
+			tx.Hash())
+		return ruleError(ErrNoTxInputs, str)
+	}
+
+	keyView := NewKeyViewpoint()
+	keyView.SetKeys(keySets)
+	pkScript, err := txscript.ThreadPkScript(keyView.GetAdminKeyHashes(threadID))
+	if err != nil {
+		str := fmt.Sprintf("failed to create script for thread %d of "+
+			"transaction %v: %v", threadID, tx.Hash(), err)
+		return ruleError(ErrScriptMalformed, str)
+	}
+
+	// Thread outputs never carry value, so the amount of the input is zero.
+	sigScript := msgTx.TxIn[0].SignatureScript
+	vm, err := txscript.NewEngine(pkScript, msgTx, 0, flags, sigCache,
+		nil, 0)
+	if err != nil {
+		str := fmt.Sprintf("failed to parse input %s:0 - %v (input "+
+			"script bytes %x, thread script bytes %x)", tx.Hash(),
+			err, sigScript, pkScript)
+		return ruleError(ErrScriptMalformed, str)
+	}
+	if err := vm.Execute(); err != nil {
+		str := fmt.Sprintf("failed to validate input %s:0 - %v (input "+
+			"script bytes %x, thread script bytes %x)", tx.Hash(),
+			err, sigScript, pkScript)
+		return ruleError(ErrScriptValidation, str)
+	}
+
+	return nil
+}
+
 // checkBlockScripts executes and validates the scripts for all transactions in
-// the passed block using multiple goroutines.
-func checkBlockScripts(block *provautil.Block, utxoView *UtxoViewpoint, keyView *KeyViewpoint, scriptFlags txscript.ScriptFlags, sigCache *txscript.SigCache, hashCache *txscript.HashCache) error {
+// the passed block using up to the passed number of goroutines.  A value of
+// zero or less uses the current value of GOMAXPROCS.  When more than one input
+// fails validation, the error for the first one in block order is returned.
+func checkBlockScripts(block *provautil.Block, utxoView *UtxoViewpoint, keyView *KeyViewpoint, scriptFlags txscript.ScriptFlags, sigCache *txscript.SigCache, hashCache *txscript.HashCache, numWorkers int) error {
 	// Collect all of the transaction inputs and required information for
 	// validation for all transactions in the block into a single slice.
 	numInputs := 0
@@ -336,6 +368,7 @@ func checkBlockScripts(block *provautil.Block, utxoView *UtxoViewpoint, keyView
 	}
 
 	// Validate all of the inputs.
-	validator := newTxValidator(utxoView, keyView, scriptFlags, sigCache, hashCache)
+	validator := newTxValidator(utxoView, keyView, scriptFlags, sigCache,
+		hashCache, numWorkers)
 	return validator.Validate(txValItems)
 }
@@ -8,10 +8,14 @@ package blockchain_test
 import (
 	"fmt"
 	"runtime"
+	"strings"
 	"testing"
 
 	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/provautil"
 	"github.com/bitgo/prova/txscript"
+	"github.com/bitgo/prova/wire"
 )
 
 // TestCheckBlockScripts ensures that validating the all of the scripts in a
@@ -46,9 +50,132 @@ func CheckBlockScripts(t *testing.T) {
 
 	scriptFlags := txscript.ScriptBip16
 	err = blockchain.TstCheckBlockScripts(blocks[0], utxoView, nil, scriptFlags,
-		nil, nil)
+		nil, nil, 0)
 	if err != nil {
 		t.Errorf("Transaction script validation failed: %v\n", err)
 		return
 	}
 }
+
+// signedScriptsBlock returns a block with the provided number of transactions,
+// each of which spends the provided number of pay-to-pubkey outputs with
+// valid signatures, along with a view that contains the spent outputs.  The
+// block does not contain a coinbase since only the scripts are of interest.
+func signedScriptsBlock(tb testing.TB, numTxns, numInputs int) (*provautil.Block, *blockchain.UtxoViewpoint) {
+	privKey, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		tb.Fatalf("NewPrivateKey: unexpected error: %v", err)
+	}
+	pkScript, err := txscript.NewScriptBuilder().
+		AddData(privKey.PubKey().SerializeCompressed()).
+		AddOp(txscript.OP_CHECKSIG).Script()
+	if err != nil {
+		tb.Fatalf("failed to build pkScript: %v", err)
+	}
+
+	funding := wire.NewMsgTx(wire.TxVersion)
+	funding.AddTxIn(wire.NewTxIn(&wire.OutPoint{Index: wire.MaxPrevOutIndex},
+		nil))
+	for i := 0; i < numTxns*numInputs; i++ {
+		funding.AddTxOut(wire.NewTxOut(1000, pkScript))
+	}
+	fundingHash := funding.TxHash()
+
+	msgBlock := wire.NewMsgBlock(&wire.BlockHeader{Height: 2})
+	for i := 0; i < numTxns; i++ {
+		tx := wire.NewMsgTx(wire.TxVersion)
+		for j := 0; j < numInputs; j++ {
+			prevOut := wire.NewOutPoint(&fundingHash,
+				uint32(i*numInputs+j))
+			tx.AddTxIn(wire.NewTxIn(prevOut, nil))
+		}
+		tx.AddTxOut(wire.NewTxOut(int64(numInputs)*1000, pkScript))
+		for j := range tx.TxIn {
+			sig, err := txscript.RawTxInSignature(tx, j, pkScript,
+				txscript.SigHashAll, privKey)
+			if err != nil {
+				tb.Fatalf("RawTxInSignature: unexpected error: %v",
+					err)
+			}
+			sigScript, err := txscript.NewScriptBuilder().AddData(sig).
+				Script()
+			if err != nil {
+				tb.Fatalf("failed to build sigScript: %v", err)
+			}
+			tx.TxIn[j].SignatureScript = sigScript
+		}
+		msgBlock.AddTransaction(tx)
+	}
+
+	view := blockchain.NewUtxoViewpoint()
+	view.AddTxOuts(provautil.NewTx(funding), 1)
+	return provautil.NewBlock(msgBlock), view
+}
+
+// TestCheckBlockScriptsFirstError ensures that validating the scripts of a
+// block succeeds for valid scripts and that the error reported for a block with
+// multiple invalid inputs is always the one for the first invalid input in
+// block order, regardless of the number of workers.
+func TestCheckBlockScriptsFirstError(t *testing.T) {
+	t.Parallel()
+
+	block, view := signedScriptsBlock(t, 8, 4)
+	scriptFlags := txscript.ScriptBip16
+	for _, numWorkers := range []int{0, 1, 2, 4, 32} {
+		err := blockchain.TstCheckBlockScripts(block, view, nil,
+			scriptFlags, nil, nil, numWorkers)
+		if err != nil {
+			t.Fatalf("checkBlockScripts (%d workers): unexpected "+
+				"error: %v", numWorkers, err)
+		}
+	}
+
+	// Invalidate two inputs of later transactions first and then one of
+	// an earlier transaction so the first invalid input in block order is
+	// not the first one that was modified.
+	block, view = signedScriptsBlock(t, 8, 4)
+	msgBlock := block.MsgBlock()
+	for _, in := range []struct{ tx, in int }{{6, 0}, {5, 3}, {2, 1}} {
+		txIn := msgBlock.Transactions[in.tx].TxIn[in.in]
+		txIn.SignatureScript = []byte{txscript.OP_FALSE}
+	}
+	block = provautil.NewBlock(msgBlock)
+	wantStr := fmt.Sprintf("%s:%d ", msgBlock.Transactions[2].TxHash(), 1)
+	for _, numWorkers := range []int{0, 1, 2, 4, 32} {
+		for i := 0; i < 10; i++ {
+			err := blockchain.TstCheckBlockScripts(block, view, nil,
+				scriptFlags, nil, nil, numWorkers)
+			rerr, ok := err.(blockchain.RuleError)
+			if !ok || rerr.ErrorCode != blockchain.ErrScriptValidation {
+				t.Fatalf("checkBlockScripts (%d workers): did "+
+					"not receive expected script validation "+
+					"error - got %v", numWorkers, err)
+			}
+			if !strings.Contains(rerr.Description, wantStr) {
+				t.Fatalf("checkBlockScripts (%d workers): error "+
+					"does not identify the first invalid input "+
+					"%q - got %v", numWorkers, wantStr, err)
+			}
+		}
+	}
+}
+
+// BenchmarkCheckBlockScripts benchmarks validating the scripts of a block full
+// of signatures with varying numbers of workers.  The signature cache is not
+// used so every signature is verified on each iteration.
+func BenchmarkCheckBlockScripts(b *testing.B) {
+	block, view := signedScriptsBlock(b, 100, 10)
+	scriptFlags := txscript.ScriptBip16
+	for _, numWorkers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", numWorkers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				err := blockchain.TstCheckBlockScripts(block, view,
+					nil, scriptFlags, nil, nil, numWorkers)
+				if err != nil {
+					b.Fatalf("checkBlockScripts: unexpected "+
+						"error: %v", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"time"
+)
+
+// syncedBlockIntervals is the number of target block intervals the timestamp
+// of the best block may lag behind the current time while the chain is still
+// considered fully synced.
+const syncedBlockIntervals = 2
+
+// SyncStatus houses information about how far the chain has been synced.
+type SyncStatus struct {
+	// BlocksHeight is the height of the best block which has been
+	// verified and connected to the main chain.
+	BlocksHeight uint32
+
+	// HeadersHeight is the height of the best known header.  It is the
+	// same as BlocksHeight when no headers beyond the best block are
+	// known.
+	HeadersHeight uint32
+
+	// VerificationProgress is an estimate of the fraction of the chain
+	// which has been verified in the range [0, 1].
+	VerificationProgress float64
+}
+
+// verificationProgress returns an estimate of the fraction of the chain which
+// has been verified given the height and timestamp of the best block, the
+// current time, and the target time per block.  The number of blocks still to
+// be verified is estimated by the number of target block intervals the best
+// block lags behind the current time.  The chain is considered fully verified
+// when the best block is within a couple of target block intervals of the
+// current time.
+func verificationProgress(height uint32, tipTime, now time.Time, targetTimePerBlock time.Duration) float64 {
+	lag := now.Sub(tipTime)
+	if targetTimePerBlock <= 0 || lag <= syncedBlockIntervals*targetTimePerBlock {
+		return 1
+	}
+
+	remaining := float64(lag) / float64(targetTimePerBlock)
+	progress := float64(height) / (float64(height) + remaining)
+	if progress < 0 {
+		return 0
+	}
+	if progress > 1 {
+		return 1
+	}
+	return progress
+}
+
+// SyncStatus returns information about how far the chain has been synced
+// based on the best block, the best known header, and the current network
+// adjusted time.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) SyncStatus() *SyncStatus {
+	b.chainLock.RLock()
+	defer b.chainLock.RUnlock()
+
+	headersHeight := b.bestNode.height
+	if n := uint32(len(b.assumeValidHashes)); n > headersHeight+1 {
+		headersHeight = n - 1
+	}
+
+	return &SyncStatus{
+		BlocksHeight:  b.bestNode.height,
+		HeadersHeight: headersHeight,
+		VerificationProgress: verificationProgress(b.bestNode.height,
+			time.Unix(b.bestNode.timestamp, 0),
+			b.timeSource.AdjustedTime(),
+			b.chainParams.TargetTimePerBlock),
+	}
+}
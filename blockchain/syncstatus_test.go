@@ -0,0 +1,113 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bitgo/prova/chaincfg/chainhash"
+)
+
+// fixedTimeSource provides an implementation of the MedianTimeSource interface
+// which always returns the same adjusted time.
+type fixedTimeSource struct {
+	now time.Time
+}
+
+// AdjustedTime returns the fixed time of the time source.
+func (s *fixedTimeSource) AdjustedTime() time.Time {
+	return s.now
+}
+
+// AddTimeSample ignores the passed time sample.
+func (s *fixedTimeSource) AddTimeSample(id string, timeVal time.Time) {}
+
+// Offset always returns zero.
+func (s *fixedTimeSource) Offset() time.Duration {
+	return 0
+}
+
+// TestSyncStatus ensures the sync status reports the expected heights and
+// verification progress for a fresh chain, a chain which is in the middle of
+// syncing, and a fully synced chain.
+func TestSyncStatus(t *testing.T) {
+	b := newKeyWindowTestChain(101)
+	interval := b.chainParams.TargetTimePerBlock
+	tipTime := time.Unix(1500000000, 0)
+	b.bestNode.timestamp = tipTime.Unix()
+	genesis := b.bestNode
+	for genesis.parent != nil {
+		genesis = genesis.parent
+	}
+	genesis.timestamp = tipTime.Add(-100 * interval).Unix()
+
+	tests := []struct {
+		name         string
+		bestNode     *blockNode
+		now          time.Time
+		wantProgress float64
+	}{
+		{
+			name:         "fresh chain",
+			bestNode:     genesis,
+			now:          tipTime,
+			wantProgress: 0,
+		},
+		{
+			name:         "mid sync",
+			bestNode:     b.bestNode,
+			now:          tipTime.Add(100 * interval),
+			wantProgress: 0.5,
+		},
+		{
+			name:         "lagging more than two intervals",
+			bestNode:     b.bestNode,
+			now:          tipTime.Add(2*interval + time.Second),
+			wantProgress: 100 / (100 + float64(2*interval+time.Second)/float64(interval)),
+		},
+		{
+			name:         "synced within two intervals",
+			bestNode:     b.bestNode,
+			now:          tipTime.Add(2 * interval),
+			wantProgress: 1,
+		},
+		{
+			name:         "tip ahead of clock",
+			bestNode:     b.bestNode,
+			now:          tipTime.Add(-time.Hour),
+			wantProgress: 1,
+		},
+	}
+
+	bestNode := b.bestNode
+	for _, test := range tests {
+		b.bestNode = test.bestNode
+		b.timeSource = &fixedTimeSource{now: test.now}
+		status := b.SyncStatus()
+		if status.BlocksHeight != test.bestNode.height ||
+			status.HeadersHeight != test.bestNode.height {
+
+			t.Fatalf("%s: unexpected heights -- got blocks %d, "+
+				"headers %d, want %d", test.name,
+				status.BlocksHeight, status.HeadersHeight,
+				test.bestNode.height)
+		}
+		if status.VerificationProgress != test.wantProgress {
+			t.Fatalf("%s: unexpected verification progress -- got "+
+				"%v, want %v", test.name,
+				status.VerificationProgress, test.wantProgress)
+		}
+	}
+
+	// Ensure the headers height reflects the known header chain when it
+	// extends beyond the best block.
+	b.bestNode = bestNode
+	b.assumeValidHashes = make([]chainhash.Hash, 151)
+	if status := b.SyncStatus(); status.HeadersHeight != 150 {
+		t.Fatalf("unexpected headers height -- got %d, want 150",
+			status.HeadersHeight)
+	}
+}
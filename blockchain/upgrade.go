@@ -0,0 +1,299 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+)
+
+const (
+	// currentChainVersion is the current version of the chain state stored
+	// in the database.  It must be the version of the last migration in
+	// chainMigrations.
+	currentChainVersion = 2
+
+	// migrationBatchSize is the maximum number of items a migration
+	// processes in a single database transaction.
+	migrationBatchSize = 50000
+)
+
+var (
+	// chainVersionKeyName is the name of the db key used to store the
+	// version of the chain state.
+	chainVersionKeyName = []byte("chainversion")
+
+	// migrationProgressKeyName is the name of the db key used to store the
+	// progress of the migration that is underway so it can be resumed when
+	// it is interrupted.
+	migrationProgressKeyName = []byte("migrationprogress")
+)
+
+// migrationFunc migrates the next batch of up to limit items using the passed
+// database transaction.  The progress returned by the previous batch, which is
+// nil for the first batch, is passed, and the progress to resume from is
+// returned along with the number of migrated items.  A nil progress signals
+// the migration is complete.
+//
+// Migrations must be idempotent since a migration is run again from the start
+// when the chain version is not updated, for instance when the database is
+// restored from a backup taken while the migration was underway.
+type migrationFunc func(dbTx database.Tx, progress []byte, limit int) ([]byte, int, error)
+
+// migration describes a migration of the chain state to the next version.
+type migration struct {
+	version     uint32
+	description string
+	migrate     migrationFunc
+}
+
+// chainMigrations houses the migrations of the chain state in the order they
+// are applied.  The version of each migration is one more than the version of
+// the previous one.
+var chainMigrations = []migration{
+	{
+		version:     1,
+		description: "calculate the utxo set statistics",
+		migrate:     migrateUtxoSetState,
+	},
+	{
+		version:     2,
+		description: "track the block the utxo set was written for",
+		migrate:     migrateUtxoSetTip,
+	},
+}
+
+// -----------------------------------------------------------------------------
+// The chain version is stored as a uint32 under the chain version key.
+// Databases that were created before the version was stored do not contain the
+// key and are version 0.
+//
+// The progress of the migration that is underway is stored under the migration
+// progress key in the following format:
+//
+//   <version><progress>
+//
+//   Field           Type      Size
+//   version         uint32    4 bytes
+//   progress        []byte    variable
+// -----------------------------------------------------------------------------
+
+// dbPutChainVersion uses an existing database transaction to store the version
+// of the chain state.
+func dbPutChainVersion(dbTx database.Tx, version uint32) error {
+	var serialized [4]byte
+	byteOrder.PutUint32(serialized[:], version)
+	return dbTx.Metadata().Put(chainVersionKeyName, serialized[:])
+}
+
+// dbFetchChainVersion uses an existing database transaction to fetch the
+// version of the chain state.
+func dbFetchChainVersion(dbTx database.Tx) (uint32, error) {
+	serialized := dbTx.Metadata().Get(chainVersionKeyName)
+	if serialized == nil {
+		return 0, nil
+	}
+	if len(serialized) != 4 {
+		return 0, database.Error{
+			ErrorCode:   database.ErrCorruption,
+			Description: "corrupt chain version",
+		}
+	}
+	return byteOrder.Uint32(serialized), nil
+}
+
+// dbFetchMigrationProgress uses an existing database transaction to fetch the
+// progress of the migration to the passed version.  Nil is returned when the
+// migration has not been started yet.
+func dbFetchMigrationProgress(dbTx database.Tx, version uint32) ([]byte, error) {
+	serialized := dbTx.Metadata().Get(migrationProgressKeyName)
+	if serialized == nil {
+		return nil, nil
+	}
+	if len(serialized) < 4 || byteOrder.Uint32(serialized) != version {
+		return nil, database.Error{
+			ErrorCode: database.ErrCorruption,
+			Description: fmt.Sprintf("corrupt progress of the "+
+				"migration to chain version %d", version),
+		}
+	}
+	return serialized[4:], nil
+}
+
+// dbPutMigrationProgress uses an existing database transaction to store the
+// progress of the migration to the passed version.
+func dbPutMigrationProgress(dbTx database.Tx, version uint32, progress []byte) error {
+	serialized := make([]byte, 4+len(progress))
+	byteOrder.PutUint32(serialized, version)
+	copy(serialized[4:], progress)
+	return dbTx.Metadata().Put(migrationProgressKeyName, serialized)
+}
+
+// runMigrations applies the passed migrations which are newer than the version
+// of the chain state in the database in order.  Each migration is performed in
+// batches of up to limit items.  Every batch is migrated in its own database
+// transaction along with recording the progress, so an interrupted migration
+// is resumed from the last completed batch the next time.
+//
+// An error is returned when the chain state was written by newer software,
+// which is determined by the version of the last passed migration, since it
+// can't be interpreted correctly.
+func runMigrations(db database.DB, migrations []migration, limit int) error {
+	var version uint32
+	var isStateInitialized bool
+	err := db.View(func(dbTx database.Tx) error {
+		isStateInitialized = dbTx.Metadata().Get(chainStateKeyName) != nil
+		var err error
+		version, err = dbFetchChainVersion(dbTx)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	// There is nothing to migrate when the database does not contain a
+	// chain state yet.
+	if !isStateInitialized {
+		return nil
+	}
+
+	var latestVersion uint32
+	if len(migrations) > 0 {
+		latestVersion = migrations[len(migrations)-1].version
+	}
+	if version > latestVersion {
+		return fmt.Errorf("the chain database version %d is newer than "+
+			"the latest version %d supported by this software",
+			version, latestVersion)
+	}
+
+	for _, m := range migrations {
+		if m.version <= version {
+			continue
+		}
+
+		log.Infof("Migrating the chain database to version %d: %s",
+			m.version, m.description)
+		var migrated int
+		for done := false; !done; {
+			err := db.Update(func(dbTx database.Tx) error {
+				progress, err := dbFetchMigrationProgress(dbTx,
+					m.version)
+				if err != nil {
+					return err
+				}
+				if progress != nil && migrated == 0 {
+					log.Infof("Resuming the interrupted " +
+						"migration")
+				}
+
+				progress, n, err := m.migrate(dbTx, progress, limit)
+				if err != nil {
+					return err
+				}
+				migrated += n
+
+				if progress != nil {
+					return dbPutMigrationProgress(dbTx,
+						m.version, progress)
+				}
+				done = true
+				err = dbTx.Metadata().Delete(migrationProgressKeyName)
+				if err != nil {
+					return err
+				}
+				return dbPutChainVersion(dbTx, m.version)
+			})
+			if err != nil {
+				return fmt.Errorf("failed to migrate the chain "+
+					"database to version %d: %v", m.version, err)
+			}
+			if !done {
+				log.Infof("Migrated %d items", migrated)
+			}
+		}
+		log.Infof("Migrated the chain database to version %d",
+			m.version)
+	}
+
+	return nil
+}
+
+// migrateUtxoSetState calculates the utxo set statistics of databases that were
+// created before they were tracked by scanning the utxo set.  The progress
+// consists of the hash of the last scanned utxo entry followed by the
+// serialized statistics of all entries scanned so far.
+//
+// This is the migration to chain version 1.
+func migrateUtxoSetState(dbTx database.Tx, progress []byte, limit int) ([]byte, int, error) {
+	meta := dbTx.Metadata()
+	state := newUtxoSetState()
+	var lastHash []byte
+	if progress == nil {
+		// There is nothing to do when the statistics are already
+		// tracked.
+		if meta.Get(utxoSetStateKeyName) != nil {
+			return nil, 0, nil
+		}
+	} else {
+		if len(progress) != chainhash.HashSize+utxoSetStateSize {
+			return nil, 0, database.Error{
+				ErrorCode:   database.ErrCorruption,
+				Description: "corrupt utxo set statistics progress",
+			}
+		}
+		lastHash = progress[:chainhash.HashSize]
+		var err error
+		state, err = deserializeUtxoSetState(progress[chainhash.HashSize:])
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	// Resume after the last scanned utxo entry.
+	cursor := meta.Bucket(utxoSetBucketName).Cursor()
+	ok := cursor.First()
+	if lastHash != nil {
+		ok = cursor.Seek(lastHash)
+		if ok && bytes.Equal(cursor.Key(), lastHash) {
+			ok = cursor.Next()
+		}
+	}
+
+	var txHash chainhash.Hash
+	var scanned int
+	for ; ok && scanned < limit; ok = cursor.Next() {
+		entry, err := deserializeUtxoEntry(cursor.Value())
+		if err != nil {
+			return nil, 0, err
+		}
+		copy(txHash[:], cursor.Key())
+		state.addEntry(&txHash, entry)
+		scanned++
+	}
+
+	// Store the statistics once the entire utxo set has been scanned.
+	if !ok {
+		return nil, scanned, dbPutUtxoSetState(dbTx, state)
+	}
+
+	progress = make([]byte, chainhash.HashSize, chainhash.HashSize+
+		utxoSetStateSize)
+	copy(progress, txHash[:])
+	return append(progress, serializeUtxoSetState(state)...), scanned, nil
+}
+
+// migrateUtxoSetTip does not modify the chain state since the utxo set of
+// databases without a utxo set tip matches the best block.  The version is
+// bumped because the utxo set of newer databases may lag behind the best block,
+// which older software does not account for.
+//
+// This is the migration to chain version 2.
+func migrateUtxoSetTip(dbTx database.Tx, progress []byte, limit int) ([]byte, int, error) {
+	return nil, 0, nil
+}
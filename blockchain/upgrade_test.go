@@ -0,0 +1,322 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+	_ "github.com/bitgo/prova/database/ffldb"
+)
+
+// createMigrationTestDB returns a new database in the passed directory which
+// contains a chain state that was created before the chain version was stored.
+// Its utxo set consists of the passed number of entries with two unspent
+// outputs each and the utxo set statistics are not tracked.  The statistics of
+// the utxo set are returned along with the database.
+func createMigrationTestDB(t *testing.T, dir string, numEntries int) (database.DB, *utxoSetState) {
+	db, err := database.Create("ffldb", dir, chaincfg.RegressionNetParams.Net)
+	if err != nil {
+		t.Fatalf("unable to create database: %v", err)
+	}
+
+	expected := newUtxoSetState()
+	err = db.Update(func(dbTx database.Tx) error {
+		meta := dbTx.Metadata()
+		if err := meta.Put(chainStateKeyName, []byte{0x01}); err != nil {
+			return err
+		}
+		bucket, err := meta.CreateBucket(utxoSetBucketName)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < numEntries; i++ {
+			txHash := chainhash.HashH([]byte{byte(i), byte(i >> 8)})
+			entry := newUtxoEntry(1, false, uint32(i))
+			for index := uint32(0); index < 2; index++ {
+				output := &utxoOutput{
+					amount:   int64(i*10) + int64(index) + 1,
+					pkScript: []byte{0x51, byte(index)},
+				}
+				entry.sparseOutputs[index] = output
+				expected.addOutput(&txHash, index, output.amount,
+					output.pkScript)
+			}
+			serialized, err := serializeUtxoEntry(entry)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put(txHash[:], serialized); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		t.Fatalf("unable to create test chain state: %v", err)
+	}
+	return db, expected
+}
+
+// checkMigrated ensures the chain state in the passed database is the current
+// version, no migration is underway and the stored utxo set statistics match
+// the expected ones.
+func checkMigrated(t *testing.T, db database.DB, expected *utxoSetState) {
+	err := db.View(func(dbTx database.Tx) error {
+		version, err := dbFetchChainVersion(dbTx)
+		if err != nil {
+			return err
+		}
+		if version != currentChainVersion {
+			t.Fatalf("unexpected chain version %d, want %d", version,
+				currentChainVersion)
+		}
+		if dbTx.Metadata().Get(migrationProgressKeyName) != nil {
+			t.Fatal("migration progress was not removed")
+		}
+		state, err := dbFetchUtxoSetState(dbTx)
+		if err != nil {
+			return err
+		}
+		if state == nil || !bytes.Equal(serializeUtxoSetState(state),
+			serializeUtxoSetState(expected)) {
+
+			t.Fatalf("mismatched utxo set statistics - got %+v, "+
+				"want %+v", state, expected)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to check migrated chain state: %v", err)
+	}
+}
+
+// TestChainMigrations ensures the migrations are ordered by consecutive
+// versions ending with the current chain version.
+func TestChainMigrations(t *testing.T) {
+	for i, m := range chainMigrations {
+		if m.version != uint32(i+1) {
+			t.Fatalf("migration %d (%s) has version %d", i,
+				m.description, m.version)
+		}
+	}
+	last := chainMigrations[len(chainMigrations)-1]
+	if last.version != currentChainVersion {
+		t.Fatalf("last migration version %d is not the current chain "+
+			"version %d", last.version, currentChainVersion)
+	}
+}
+
+// TestMigrateUtxoSetState ensures the utxo set statistics of a chain state that
+// was created before they were tracked are calculated in batches, that an
+// interrupted migration is resumed, and that running the migration again does
+// not change the result.
+func TestMigrateUtxoSetState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "migrateutxosetstate")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, expected := createMigrationTestDB(t, dir, 25)
+	defer db.Close()
+
+	// Interrupt the migration in the third batch and ensure the progress
+	// of the first two batches is recorded without updating the version.
+	errInterrupted := errors.New("interrupted")
+	var batches int
+	interrupted := []migration{{
+		version:     1,
+		description: "interrupted",
+		migrate: func(dbTx database.Tx, progress []byte, limit int) ([]byte, int, error) {
+			batches++
+			if batches == 3 {
+				return nil, 0, errInterrupted
+			}
+			return migrateUtxoSetState(dbTx, progress, limit)
+		},
+	}}
+	if err := runMigrations(db, interrupted, 4); err == nil {
+		t.Fatal("runMigrations: did not return the migration error")
+	}
+	err = db.View(func(dbTx database.Tx) error {
+		version, err := dbFetchChainVersion(dbTx)
+		if err != nil {
+			return err
+		}
+		if version != 0 {
+			t.Fatalf("chain version %d updated by the interrupted "+
+				"migration", version)
+		}
+		progress, err := dbFetchMigrationProgress(dbTx, 1)
+		if err != nil {
+			return err
+		}
+		if len(progress) != chainhash.HashSize+utxoSetStateSize {
+			t.Fatalf("unexpected migration progress %x", progress)
+		}
+		if dbTx.Metadata().Get(utxoSetStateKeyName) != nil {
+			t.Fatal("utxo set statistics stored by the interrupted " +
+				"migration")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to check interrupted migration: %v", err)
+	}
+
+	// Resume the migration and ensure the statistics match the entire
+	// utxo set.
+	if err := runMigrations(db, chainMigrations, 4); err != nil {
+		t.Fatalf("runMigrations: unexpected error: %v", err)
+	}
+	checkMigrated(t, db, expected)
+
+	// Ensure running the migrations again when the chain is already
+	// current, or when the version was lost, does not change anything.
+	if err := runMigrations(db, chainMigrations, 4); err != nil {
+		t.Fatalf("runMigrations: unexpected error: %v", err)
+	}
+	checkMigrated(t, db, expected)
+	err = db.Update(func(dbTx database.Tx) error {
+		return dbTx.Metadata().Delete(chainVersionKeyName)
+	})
+	if err != nil {
+		t.Fatalf("unable to delete chain version: %v", err)
+	}
+	if err := runMigrations(db, chainMigrations, 4); err != nil {
+		t.Fatalf("runMigrations: unexpected error: %v", err)
+	}
+	checkMigrated(t, db, expected)
+
+	// Ensure the statistics are calculated again in a single batch once
+	// they are removed.
+	err = db.Update(func(dbTx database.Tx) error {
+		if err := dbTx.Metadata().Delete(utxoSetStateKeyName); err != nil {
+			return err
+		}
+		return dbTx.Metadata().Delete(chainVersionKeyName)
+	})
+	if err != nil {
+		t.Fatalf("unable to delete utxo set statistics: %v", err)
+	}
+	if err := runMigrations(db, chainMigrations, migrationBatchSize); err != nil {
+		t.Fatalf("runMigrations: unexpected error: %v", err)
+	}
+	checkMigrated(t, db, expected)
+}
+
+// TestNewerChainVersion ensures a chain state written by newer software is
+// refused, while a database without a chain state is left untouched.
+func TestNewerChainVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "newerchainversion")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := database.Create("ffldb", dir, chaincfg.RegressionNetParams.Net)
+	if err != nil {
+		t.Fatalf("unable to create database: %v", err)
+	}
+	defer db.Close()
+
+	if err := runMigrations(db, chainMigrations, 4); err != nil {
+		t.Fatalf("runMigrations: unexpected error: %v", err)
+	}
+	err = db.View(func(dbTx database.Tx) error {
+		if dbTx.Metadata().Get(chainVersionKeyName) != nil {
+			t.Fatal("chain version stored without a chain state")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to check chain version: %v", err)
+	}
+
+	err = db.Update(func(dbTx database.Tx) error {
+		err := dbTx.Metadata().Put(chainStateKeyName, []byte{0x01})
+		if err != nil {
+			return err
+		}
+		return dbPutChainVersion(dbTx, currentChainVersion+1)
+	})
+	if err != nil {
+		t.Fatalf("unable to store chain version: %v", err)
+	}
+	if err := runMigrations(db, chainMigrations, 4); err == nil {
+		t.Fatal("runMigrations: did not refuse newer chain version")
+	}
+}
+
+// TestNewMigratesChainState ensures a new chain state is created with the
+// current chain version and a chain state that was created before the utxo set
+// statistics were tracked is migrated when the chain is loaded.
+func TestNewMigratesChainState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "newmigrateschainstate")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	params := chaincfg.RegressionNetParams
+	db, err := database.Create("ffldb", dir, params.Net)
+	if err != nil {
+		t.Fatalf("unable to create database: %v", err)
+	}
+	defer db.Close()
+	config := &Config{
+		DB:          db,
+		ChainParams: &params,
+		TimeSource:  NewMedianTime(),
+	}
+	chain, err := New(config)
+	if err != nil {
+		t.Fatalf("New: unexpected error: %v", err)
+	}
+	expected := chain.utxoSetState
+	checkMigrated(t, db, expected)
+
+	// Remove the chain version and utxo set statistics to mimic a chain
+	// state created by older software and ensure it is migrated.
+	err = db.Update(func(dbTx database.Tx) error {
+		if err := dbTx.Metadata().Delete(utxoSetStateKeyName); err != nil {
+			return err
+		}
+		return dbTx.Metadata().Delete(chainVersionKeyName)
+	})
+	if err != nil {
+		t.Fatalf("unable to delete chain version: %v", err)
+	}
+	chain, err = New(config)
+	if err != nil {
+		t.Fatalf("New: unexpected error: %v", err)
+	}
+	checkMigrated(t, db, expected)
+	if !bytes.Equal(serializeUtxoSetState(chain.utxoSetState),
+		serializeUtxoSetState(expected)) {
+
+		t.Fatal("mismatched utxo set statistics of migrated chain")
+	}
+
+	// Ensure the chain refuses to load a chain state written by newer
+	// software.
+	err = db.Update(func(dbTx database.Tx) error {
+		return dbPutChainVersion(dbTx, currentChainVersion+1)
+	})
+	if err != nil {
+		t.Fatalf("unable to store chain version: %v", err)
+	}
+	if _, err := New(config); err == nil {
+		t.Fatal("New: did not refuse newer chain version")
+	}
+}
@@ -0,0 +1,347 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/provautil"
+)
+
+var (
+	// utxoSetTipKeyName is the name of the db key used to store the hash
+	// and height of the block the utxo set and its statistics were last
+	// written for.
+	utxoSetTipKeyName = []byte("utxosettip")
+)
+
+// utxoBatch houses the utxo set modifications of connected blocks which have
+// not been written to the database yet.  Accumulating the modifications of
+// several blocks while the chain is syncing means outputs which are created and
+// spent within the batch never reach the database and the remaining ones are
+// written in a single pass in the order of their keys.
+type utxoBatch struct {
+	// entries houses the modified utxo entries keyed by the hash of their
+	// transaction.  A nil entry means the transaction is fully spent and
+	// must be removed from the utxo set.
+	entries map[chainhash.Hash]*UtxoEntry
+
+	// numBlocks is the number of blocks whose modifications are part of the
+	// batch.
+	numBlocks int
+}
+
+// newUtxoBatch returns a new empty utxo batch.
+func newUtxoBatch() *utxoBatch {
+	return &utxoBatch{entries: make(map[chainhash.Hash]*UtxoEntry)}
+}
+
+// cloneUnspent returns a copy of the passed utxo entry which only contains its
+// unspent outputs, or nil when all of them are spent.
+func cloneUnspent(entry *UtxoEntry) *UtxoEntry {
+	if entry == nil || entry.IsFullySpent() {
+		return nil
+	}
+
+	clone := newUtxoEntry(entry.version, entry.isCoinBase, entry.blockHeight)
+	for outputIndex, output := range entry.sparseOutputs {
+		if output.spent {
+			continue
+		}
+		clone.sparseOutputs[outputIndex] = &utxoOutput{
+			compressed: output.compressed,
+			amount:     output.amount,
+			pkScript:   output.pkScript,
+		}
+	}
+	return clone
+}
+
+// add adds the modified entries of the passed view, which contains the
+// modifications of a connected block, to the batch.
+func (batch *utxoBatch) add(view *UtxoViewpoint) {
+	for txHash, entry := range view.entries {
+		if entry == nil || !entry.modified {
+			continue
+		}
+		batch.entries[txHash] = cloneUnspent(entry)
+	}
+	batch.numBlocks++
+}
+
+// lookup returns a copy of the entry for the passed transaction hash and
+// whether or not the batch contains it.  The returned entry is nil when the
+// transaction is fully spent.
+//
+// This function is safe to call on a nil batch.
+func (batch *utxoBatch) lookup(txHash *chainhash.Hash) (*UtxoEntry, bool) {
+	if batch == nil {
+		return nil, false
+	}
+	entry, ok := batch.entries[*txHash]
+	if !ok {
+		return nil, false
+	}
+	return entry.Clone(), true
+}
+
+// reset removes all modifications from the batch once they have been written
+// to the database.
+func (batch *utxoBatch) reset() {
+	batch.entries = make(map[chainhash.Hash]*UtxoEntry)
+	batch.numBlocks = 0
+}
+
+// dbPutUtxoBatch uses an existing database transaction to update the utxo set
+// with the modifications in the passed batch along with the modified entries of
+// the passed view, which take precedence.  The entries are written in the order
+// of their keys.  The passed utxo set statistics and the block the utxo set is
+// now consistent with are stored along with them.
+func dbPutUtxoBatch(dbTx database.Tx, batch *utxoBatch, view *UtxoViewpoint, state *utxoSetState, tipHash *chainhash.Hash, tipHeight uint32) error {
+	entries := make(map[chainhash.Hash]*UtxoEntry, len(batch.entries))
+	for txHash, entry := range batch.entries {
+		entries[txHash] = entry
+	}
+	for txHash, entry := range view.entries {
+		if entry == nil || !entry.modified {
+			continue
+		}
+		entries[txHash] = entry
+	}
+
+	hashes := make([]chainhash.Hash, 0, len(entries))
+	for txHash := range entries {
+		hashes = append(hashes, txHash)
+	}
+	sort.Slice(hashes, func(i, j int) bool {
+		return bytes.Compare(hashes[i][:], hashes[j][:]) < 0
+	})
+
+	utxoBucket := dbTx.Metadata().Bucket(utxoSetBucketName)
+	for i := range hashes {
+		txHash := &hashes[i]
+
+		// Remove the utxo entry if it is now fully spent, otherwise
+		// store the serialization of its unspent outputs.
+		entry := entries[*txHash]
+		if entry == nil {
+			if err := utxoBucket.Delete(txHash[:]); err != nil {
+				return err
+			}
+			continue
+		}
+		serialized, err := serializeUtxoEntry(entry)
+		if err != nil {
+			return err
+		}
+		if serialized == nil {
+			err = utxoBucket.Delete(txHash[:])
+		} else {
+			err = utxoBucket.Put(txHash[:], serialized)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := dbPutUtxoSetState(dbTx, state); err != nil {
+		return err
+	}
+	return dbPutUtxoSetTip(dbTx, tipHash, tipHeight)
+}
+
+// -----------------------------------------------------------------------------
+// The utxo set tip is the block the utxo set and its statistics were last
+// written for.  It lags behind the best block when the modifications of the most
+// recently connected blocks were not written yet, and the utxo set is brought
+// up to date by connecting those blocks again when the chain is loaded.
+// Databases without the key have a utxo set that matches the best block.
+//
+// The serialized format is:
+//
+//   <block hash><block height>
+//
+//   Field          Type             Size
+//   block hash     chainhash.Hash   chainhash.HashSize
+//   block height   uint32           4 bytes
+// -----------------------------------------------------------------------------
+
+// dbPutUtxoSetTip uses an existing database transaction to store the block the
+// utxo set was written for.
+func dbPutUtxoSetTip(dbTx database.Tx, hash *chainhash.Hash, height uint32) error {
+	var serialized [chainhash.HashSize + 4]byte
+	copy(serialized[:], hash[:])
+	byteOrder.PutUint32(serialized[chainhash.HashSize:], height)
+	return dbTx.Metadata().Put(utxoSetTipKeyName, serialized[:])
+}
+
+// dbFetchUtxoSetTip uses an existing database transaction to fetch the block
+// the utxo set was written for.  A nil hash is returned when it is not stored.
+func dbFetchUtxoSetTip(dbTx database.Tx) (*chainhash.Hash, uint32, error) {
+	serialized := dbTx.Metadata().Get(utxoSetTipKeyName)
+	if serialized == nil {
+		return nil, 0, nil
+	}
+	if len(serialized) != chainhash.HashSize+4 {
+		return nil, 0, database.Error{
+			ErrorCode:   database.ErrCorruption,
+			Description: "corrupt utxo set tip",
+		}
+	}
+
+	var hash chainhash.Hash
+	copy(hash[:], serialized[:chainhash.HashSize])
+	return &hash, byteOrder.Uint32(serialized[chainhash.HashSize:]), nil
+}
+
+// replayUtxoSet brings the utxo set and its statistics up to date with the best
+// block by connecting the main chain blocks after the block they were last
+// written for again.  This is necessary when the process exited before the
+// modifications of the most recently connected blocks were written, and after
+// the chain state was rolled back, which resets the utxo set to the genesis
+// block.
+func (b *BlockChain) replayUtxoSet() error {
+	var tipHash *chainhash.Hash
+	var tipHeight, bestHeight uint32
+	var bestHash chainhash.Hash
+	var state *utxoSetState
+	err := b.db.View(func(dbTx database.Tx) error {
+		var err error
+		tipHash, tipHeight, err = dbFetchUtxoSetTip(dbTx)
+		if err != nil || tipHash == nil {
+			return err
+		}
+		best, err := deserializeBestChainState(dbTx.Metadata().Get(
+			chainStateKeyName))
+		if err != nil {
+			return err
+		}
+		bestHash, bestHeight = best.hash, best.height
+		if tipHash.IsEqual(&bestHash) {
+			return nil
+		}
+
+		// Ensure the utxo set tip is a main chain block before the best
+		// block.
+		if tipHeight >= bestHeight {
+			return AssertError(fmt.Sprintf("utxo set tip %v (height "+
+				"%d) is not before the best block %v (height %d)",
+				tipHash, tipHeight, bestHash, bestHeight))
+		}
+		hash, err := dbFetchHashByHeight(dbTx, tipHeight)
+		if err != nil {
+			return err
+		}
+		if !hash.IsEqual(tipHash) {
+			return AssertError(fmt.Sprintf("utxo set tip %v (height "+
+				"%d) is not in the main chain", tipHash,
+				tipHeight))
+		}
+
+		state, err = dbFetchUtxoSetState(dbTx)
+		if err != nil {
+			return err
+		}
+		if state == nil {
+			return AssertError("utxo set state is missing from " +
+				"the database")
+		}
+		return nil
+	})
+	if err != nil || state == nil {
+		return err
+	}
+
+	log.Infof("Updating the utxo set from block %v (height %d) to the "+
+		"best block %v (height %d)", tipHash, tipHeight, bestHash,
+		bestHeight)
+
+	view := NewUtxoViewpoint()
+	for height := tipHeight + 1; height <= bestHeight; height++ {
+		var block *provautil.Block
+		err := b.db.View(func(dbTx database.Tx) error {
+			var err error
+			block, err = dbFetchBlockByHeight(dbTx, height)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := view.fetchInputUtxos(b.db, nil, block); err != nil {
+			return err
+		}
+		var stxos []spentTxOut
+		if err := view.connectTransactions(block, &stxos); err != nil {
+			return err
+		}
+		if err := state.applyBlock(block, stxos, true); err != nil {
+			return err
+		}
+
+		// Write the modifications periodically when many blocks are
+		// replayed, such as after the chain state was rolled back, so
+		// the utxo set is not held in memory and the replay resumes
+		// from there when it is interrupted.
+		if len(view.entries) >= migrationBatchSize && height < bestHeight {
+			err := b.db.Update(func(dbTx database.Tx) error {
+				return dbPutUtxoBatch(dbTx, newUtxoBatch(), view,
+					state, block.Hash(), height)
+			})
+			if err != nil {
+				return err
+			}
+			view = NewUtxoViewpoint()
+		}
+	}
+
+	return b.db.Update(func(dbTx database.Tx) error {
+		return dbPutUtxoBatch(dbTx, newUtxoBatch(), view, state,
+			&bestHash, bestHeight)
+	})
+}
+
+// flushUtxoBatch writes the pending utxo set modifications along with the utxo
+// set statistics to the database.
+//
+// This function MUST be called with the chain lock held (for writes).
+func (b *BlockChain) flushUtxoBatch() error {
+	if b.utxoBatch.numBlocks == 0 {
+		return nil
+	}
+
+	b.stateLock.RLock()
+	state := b.utxoSetState
+	b.stateLock.RUnlock()
+
+	best := b.bestNode
+	err := b.db.Update(func(dbTx database.Tx) error {
+		return dbPutUtxoBatch(dbTx, b.utxoBatch, NewUtxoViewpoint(),
+			state, best.hash, best.height)
+	})
+	if err != nil {
+		return err
+	}
+
+	b.utxoBatch.reset()
+	return nil
+}
+
+// FlushUtxoBatch writes the utxo set modifications of the connected blocks
+// which are still pending to the database.  It should be called before the
+// database is closed so the blocks don't have to be connected again the next
+// time the chain is loaded.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) FlushUtxoBatch() error {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	return b.flushUtxoBatch()
+}
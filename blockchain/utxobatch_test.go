@@ -0,0 +1,250 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain_test
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/txscript"
+	"github.com/bitgo/prova/wire"
+)
+
+// newUtxoBatchTestChain returns a chain instance backed by the passed database
+// which writes the utxo set changes of up to the passed number of blocks
+// together.  The last of the passed blocks is added as a checkpoint so the
+// chain is not current, and thus batches the changes, until it is connected.
+func newUtxoBatchTestChain(tb testing.TB, db database.DB, blocks []*wire.MsgBlock, batchSize uint32) *blockchain.BlockChain {
+	params := chaincfg.RegressionNetParams
+	lastHash := blocks[len(blocks)-1].BlockHash()
+	chain, err := blockchain.New(&blockchain.Config{
+		DB:          db,
+		ChainParams: &params,
+		Checkpoints: []chaincfg.Checkpoint{{
+			Height: uint32(len(blocks)),
+			Hash:   &lastHash,
+		}},
+		TimeSource:    blockchain.NewMedianTime(),
+		SigCache:      txscript.NewSigCache(1000),
+		UtxoBatchSize: batchSize,
+	})
+	if err != nil {
+		tb.Fatalf("failed to create chain instance: %v", err)
+	}
+	return chain
+}
+
+// TestUtxoBatchCrash ensures the utxo set of a chain which batches the utxo set
+// changes of several blocks is brought up to date when the chain is loaded
+// again after the process exited between batches, so it matches the utxo set
+// of a chain which wrote the changes of every block.
+func TestUtxoBatchCrash(t *testing.T) {
+	const batchSize = 4
+	blocks := linearTestBlocks(t)
+	if len(blocks) < 2*batchSize {
+		t.Fatalf("not enough test blocks - got %d", len(blocks))
+	}
+
+	// Record the utxo set statistics after every block of a chain which
+	// writes the utxo set changes of every block.
+	refChain, teardownFunc, err := chainSetup("utxobatchref",
+		&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+	wantStats := []*blockchain.UtxoSetStats{refChain.UtxoSetStats()}
+	for i := range blocks {
+		processTestBlocks(t, "reference", refChain, blocks[i:i+1])
+		wantStats = append(wantStats, refChain.UtxoSetStats())
+	}
+
+	// checkStats ensures both the incrementally maintained utxo set
+	// statistics of the chain and the ones calculated by scanning the utxo
+	// set match the reference chain after the passed number of blocks.
+	checkStats := func(name string, chain *blockchain.BlockChain, numBlocks int) {
+		if stats := chain.UtxoSetStats(); !reflect.DeepEqual(stats,
+			wantStats[numBlocks]) {
+
+			t.Fatalf("%s: mismatched utxo set stats -- got %+v, "+
+				"want %+v", name, stats, wantStats[numBlocks])
+		}
+		stats, err := chain.CalcUtxoSetStats()
+		if err != nil {
+			t.Fatalf("%s: unexpected error calculating utxo set "+
+				"stats: %v", name, err)
+		}
+		if !reflect.DeepEqual(stats, wantStats[numBlocks]) {
+			t.Fatalf("%s: mismatched calculated utxo set stats -- "+
+				"got %+v, want %+v", name, stats,
+				wantStats[numBlocks])
+		}
+	}
+
+	// Exit after connecting a number of blocks which leaves a partial
+	// batch, a full batch, and changes which were written by the block
+	// that makes the chain current.
+	for _, numBlocks := range []int{1, batchSize - 1, batchSize,
+		batchSize + 1, 2*batchSize + 1, len(blocks)} {
+
+		name := fmt.Sprintf("exit after %d blocks", numBlocks)
+		dir, err := ioutil.TempDir("", "utxobatchcrash")
+		if err != nil {
+			t.Fatalf("unable to create temp dir: %v", err)
+		}
+		defer os.RemoveAll(dir)
+		db, err := database.Create("ffldb", dir, blockDataNet)
+		if err != nil {
+			t.Fatalf("%s: unable to create database: %v", name, err)
+		}
+
+		// Close the database without writing the pending utxo set
+		// changes to mimic the process being killed.
+		chain := newUtxoBatchTestChain(t, db, blocks, batchSize)
+		processTestBlocks(t, name, chain, blocks[:numBlocks])
+		var tipHeight uint32
+		err = db.View(func(dbTx database.Tx) error {
+			tip := dbTx.Metadata().Get([]byte("utxosettip"))
+			if len(tip) == 36 {
+				tipHeight = binary.LittleEndian.Uint32(tip[32:])
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("%s: unable to fetch utxo set tip: %v", name,
+				err)
+		}
+		wantTipHeight := uint32(numBlocks / batchSize * batchSize)
+		if numBlocks == len(blocks) {
+			wantTipHeight = uint32(numBlocks)
+		}
+		if tipHeight != wantTipHeight {
+			t.Fatalf("%s: utxo set written for height %d, want %d",
+				name, tipHeight, wantTipHeight)
+		}
+		db.Close()
+
+		// Ensure the utxo set is up to date once the chain is loaded
+		// again and that it continues to accept blocks.
+		db, err = database.Open("ffldb", dir, blockDataNet)
+		if err != nil {
+			t.Fatalf("%s: unable to open database: %v", name, err)
+		}
+		chain = newUtxoBatchTestChain(t, db, blocks, batchSize)
+		checkStats(name, chain, numBlocks)
+		processTestBlocks(t, name, chain, blocks[numBlocks:])
+		checkStats(name, chain, len(blocks))
+		db.Close()
+	}
+}
+
+// TestRollBackMissingBlocks ensures a chain whose best blocks are no longer
+// stored in the database, as happens when the database detects their block
+// data was lost, is rolled back to the last stored block when it is loaded, so
+// it ends up with the chain state of that block and accepts the missing blocks
+// again.
+func TestRollBackMissingBlocks(t *testing.T) {
+	const batchSize = 4
+	const numMissing = 2
+	blocks := linearTestBlocks(t)
+	if len(blocks) < 2*batchSize {
+		t.Fatalf("not enough test blocks - got %d", len(blocks))
+	}
+	numStored := len(blocks) - numMissing
+
+	// chainState houses the parts of the chain state which are compared.
+	type chainState struct {
+		best         *blockchain.BestState
+		stats        *blockchain.UtxoSetStats
+		totalSupply  uint64
+		lastKeyID    btcec.KeyID
+		threadTips   map[provautil.ThreadID]*wire.OutPoint
+		adminKeySets map[btcec.KeySetType]btcec.PublicKeySet
+		keyIDs       btcec.KeyIdMap
+	}
+	stateOf := func(chain *blockchain.BlockChain) chainState {
+		return chainState{
+			best:         chain.BestSnapshot(),
+			stats:        chain.UtxoSetStats(),
+			totalSupply:  chain.TotalSupply(),
+			lastKeyID:    chain.LastKeyID(),
+			threadTips:   chain.ThreadTips(),
+			adminKeySets: chain.AdminKeySets(),
+			keyIDs:       chain.KeyIDs(),
+		}
+	}
+
+	// Record the chain state after the last block which remains stored
+	// and after all of the blocks.
+	refChain, teardownFunc, err := chainSetup("rollbackref",
+		&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+	processTestBlocks(t, "reference", refChain, blocks[:numStored])
+	wantStored := stateOf(refChain)
+	processTestBlocks(t, "reference", refChain, blocks[numStored:])
+	wantAll := stateOf(refChain)
+
+	dir, err := ioutil.TempDir("", "rollbackmissingblocks")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := database.Create("ffldb", dir, blockDataNet)
+	if err != nil {
+		t.Fatalf("unable to create database: %v", err)
+	}
+	defer db.Close()
+	chain := newUtxoBatchTestChain(t, db, blocks, batchSize)
+	processTestBlocks(t, "initial", chain, blocks)
+
+	// Remove the last blocks from the block index of the database the
+	// same way the database does when their block data was lost.
+	err = db.Update(func(dbTx database.Tx) error {
+		blockIdx := dbTx.Metadata().Bucket([]byte("ffldb-blockidx"))
+		for _, block := range blocks[numStored:] {
+			hash := block.BlockHash()
+			if err := blockIdx.Delete(hash[:]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to remove blocks: %v", err)
+	}
+
+	// Ensure the chain is rolled back to the last stored block once it is
+	// loaded again, and that it accepts the missing blocks again.
+	chain = newUtxoBatchTestChain(t, db, blocks, batchSize)
+	if got := stateOf(chain); !reflect.DeepEqual(got, wantStored) {
+		t.Fatalf("mismatched chain state after rolling back -- got "+
+			"%+v, want %+v", got, wantStored)
+	}
+	stats, err := chain.CalcUtxoSetStats()
+	if err != nil {
+		t.Fatalf("CalcUtxoSetStats: unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(stats, wantStored.stats) {
+		t.Fatalf("mismatched calculated utxo set stats after rolling "+
+			"back -- got %+v, want %+v", stats, wantStored.stats)
+	}
+	processTestBlocks(t, "after rolling back", chain, blocks[numStored:])
+	if got := stateOf(chain); !reflect.DeepEqual(got, wantAll) {
+		t.Fatalf("mismatched chain state after reconnecting the "+
+			"missing blocks -- got %+v, want %+v", got, wantAll)
+	}
+}
@@ -0,0 +1,398 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"crypto/sha256"
+	"math/big"
+
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/txscript"
+)
+
+const (
+	// muHashElementSize is the size in bytes of the elements of the
+	// multiplicative group the utxo set commitment operates in.
+	muHashElementSize = 384
+
+	// utxoSetStateSize is the size of a serialized utxo set state.
+	utxoSetStateSize = 8 + 8 + 8 + 2*muHashElementSize
+)
+
+var (
+	// muHashPrime is the prime modulus of the multiplicative group the utxo
+	// set commitment operates in.  It is 2^3072 - 1103717, the same
+	// modulus used by MuHash3072.
+	muHashPrime = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 3072),
+		big.NewInt(1103717))
+)
+
+// muHash is a rolling hash over a multiset of byte strings.  Each item is
+// mapped to an element of the multiplicative group of integers modulo a 3072
+// bit prime and the hash of the set is the product of all of its elements.
+// Since multiplication is commutative, items may be added and removed in any
+// order and the resulting hash only depends on the final contents of the set.
+//
+// Removals are accumulated in a separate denominator so that the expensive
+// modular inverse only needs to be computed when the hash is finalized.
+type muHash struct {
+	numerator   *big.Int
+	denominator *big.Int
+}
+
+// newMuHash returns a rolling hash of the empty set.
+func newMuHash() *muHash {
+	return &muHash{
+		numerator:   big.NewInt(1),
+		denominator: big.NewInt(1),
+	}
+}
+
+// muHashElement maps the passed data to an element of the group by expanding
+// its hash to the size of the modulus.
+func muHashElement(data []byte) *big.Int {
+	seed := sha256.Sum256(data)
+	var expanded [muHashElementSize]byte
+	var block [sha256.Size + 1]byte
+	copy(block[:], seed[:])
+	for i := 0; i < muHashElementSize/sha256.Size; i++ {
+		block[sha256.Size] = byte(i)
+		digest := sha256.Sum256(block[:])
+		copy(expanded[i*sha256.Size:], digest[:])
+	}
+
+	element := new(big.Int).SetBytes(expanded[:])
+	return element.Mod(element, muHashPrime)
+}
+
+// add adds the passed data to the set.
+func (h *muHash) add(data []byte) {
+	h.numerator.Mul(h.numerator, muHashElement(data))
+	h.numerator.Mod(h.numerator, muHashPrime)
+}
+
+// remove removes the passed data from the set.
+func (h *muHash) remove(data []byte) {
+	h.denominator.Mul(h.denominator, muHashElement(data))
+	h.denominator.Mod(h.denominator, muHashPrime)
+}
+
+// clone returns a deep copy of the rolling hash.
+func (h *muHash) clone() *muHash {
+	return &muHash{
+		numerator:   new(big.Int).Set(h.numerator),
+		denominator: new(big.Int).Set(h.denominator),
+	}
+}
+
+// finalize returns the hash of the current contents of the set.
+func (h *muHash) finalize() chainhash.Hash {
+	result := new(big.Int).ModInverse(h.denominator, muHashPrime)
+	result.Mul(result, h.numerator)
+	result.Mod(result, muHashPrime)
+
+	var serialized [muHashElementSize]byte
+	putMuHashElement(serialized[:], result)
+	return chainhash.Hash(sha256.Sum256(serialized[:]))
+}
+
+// putMuHashElement serializes the passed element into the target byte slice
+// as a big-endian number padded to the size of the modulus.
+func putMuHashElement(target []byte, element *big.Int) {
+	elementBytes := element.Bytes()
+	for i := range target[:muHashElementSize-len(elementBytes)] {
+		target[i] = 0
+	}
+	copy(target[muHashElementSize-len(elementBytes):], elementBytes)
+}
+
+// UtxoSetStats houses statistics about the unspent transaction output set as
+// of a given block in the main chain.  The commitment is a hash over the
+// outpoint, amount and public key script of every unspent output and only
+// depends on the contents of the set.
+type UtxoSetStats struct {
+	Hash           chainhash.Hash // The hash of the block.
+	Height         uint32         // The height of the block.
+	NumUtxos       uint64         // The number of unspent outputs.
+	TotalAmount    int64          // The total amount of all unspent outputs.
+	SerializedSize uint64         // The size of the compressed outputs.
+	Commitment     chainhash.Hash // The rolling hash of the set.
+}
+
+// utxoSetState houses the incrementally updated counters and rolling hash of
+// the utxo set.  It is updated as blocks are connected and disconnected and is
+// stored in the database along with the best chain state.
+type utxoSetState struct {
+	numUtxos       uint64
+	totalAmount    int64
+	serializedSize uint64
+	hash           *muHash
+}
+
+// newUtxoSetState returns the state of an empty utxo set.
+func newUtxoSetState() *utxoSetState {
+	return &utxoSetState{hash: newMuHash()}
+}
+
+// clone returns a deep copy of the utxo set state.
+func (s *utxoSetState) clone() *utxoSetState {
+	return &utxoSetState{
+		numUtxos:       s.numUtxos,
+		totalAmount:    s.totalAmount,
+		serializedSize: s.serializedSize,
+		hash:           s.hash.clone(),
+	}
+}
+
+// utxoSetItem returns the serialization of the passed unspent output which is
+// committed to by the rolling hash.
+func utxoSetItem(txHash *chainhash.Hash, index uint32, amount int64, pkScript []byte) []byte {
+	item := make([]byte, chainhash.HashSize+4+8+len(pkScript))
+	copy(item, txHash[:])
+	byteOrder.PutUint32(item[chainhash.HashSize:], index)
+	byteOrder.PutUint64(item[chainhash.HashSize+4:], uint64(amount))
+	copy(item[chainhash.HashSize+12:], pkScript)
+	return item
+}
+
+// addOutput adds the passed unspent output to the state.
+func (s *utxoSetState) addOutput(txHash *chainhash.Hash, index uint32, amount int64, pkScript []byte) {
+	s.numUtxos++
+	s.totalAmount += amount
+	s.serializedSize += uint64(compressedTxOutSize(uint64(amount),
+		pkScript, 0, false))
+	s.hash.add(utxoSetItem(txHash, index, amount, pkScript))
+}
+
+// addEntry adds all of the unspent outputs of the passed utxo entry for the
+// transaction with the provided hash to the state.
+func (s *utxoSetState) addEntry(txHash *chainhash.Hash, entry *UtxoEntry) {
+	for index := range entry.sparseOutputs {
+		s.addOutput(txHash, index, entry.AmountByIndex(index),
+			entry.PkScriptByIndex(index))
+	}
+}
+
+// removeOutput removes the passed unspent output from the state.
+func (s *utxoSetState) removeOutput(txHash *chainhash.Hash, index uint32, amount int64, pkScript []byte) {
+	s.numUtxos--
+	s.totalAmount -= amount
+	s.serializedSize -= uint64(compressedTxOutSize(uint64(amount),
+		pkScript, 0, false))
+	s.hash.remove(utxoSetItem(txHash, index, amount, pkScript))
+}
+
+// stxoAmountAndScript returns the decompressed amount and public key script of
+// the passed spent txout.
+func stxoAmountAndScript(stxo *spentTxOut) (int64, []byte) {
+	if !stxo.compressed {
+		return stxo.amount, stxo.pkScript
+	}
+
+	amount := int64(decompressTxOutAmount(uint64(stxo.amount)))
+	return amount, decompressScript(stxo.pkScript, stxo.version)
+}
+
+// applyBlock updates the state for the outputs the passed block creates and
+// the outputs it spends according to the provided spent txouts.  When connect
+// is false, the changes are reverted instead.  Outputs that are created and
+// spent within the block cancel out, so it does not matter that they never
+// appear in the utxo set.
+func (s *utxoSetState) applyBlock(block *provautil.Block, stxos []spentTxOut, connect bool) error {
+	if len(stxos) != countSpentOutputs(block) {
+		return AssertError("utxo set state updated with bad spent " +
+			"transaction out information")
+	}
+
+	add, remove := s.addOutput, s.removeOutput
+	if !connect {
+		add, remove = remove, add
+	}
+
+	var stxoIdx int
+	for txIdx, tx := range block.Transactions() {
+		if txIdx != 0 {
+			for _, txIn := range tx.MsgTx().TxIn {
+				stxo := &stxos[stxoIdx]
+				stxoIdx++
+
+				prevOut := &txIn.PreviousOutPoint
+				amount, pkScript := stxoAmountAndScript(stxo)
+				remove(&prevOut.Hash, prevOut.Index, amount,
+					pkScript)
+			}
+		}
+
+		for txOutIdx, txOut := range tx.MsgTx().TxOut {
+			if txscript.IsUnspendable(txOut.PkScript) {
+				continue
+			}
+			add(tx.Hash(), uint32(txOutIdx), txOut.Value,
+				txOut.PkScript)
+		}
+	}
+
+	return nil
+}
+
+// -----------------------------------------------------------------------------
+// The utxo set state is stored in the database under a single key and consists
+// of the following fields:
+//
+//   Field             Type     Size
+//   num utxos         uint64   8 bytes
+//   total amount      int64    8 bytes
+//   serialized size   uint64   8 bytes
+//   numerator         big.Int  384 bytes
+//   denominator       big.Int  384 bytes
+//   -----
+//   Total: 792 bytes
+// -----------------------------------------------------------------------------
+
+// serializeUtxoSetState returns the serialization of the passed utxo set state.
+func serializeUtxoSetState(s *utxoSetState) []byte {
+	serialized := make([]byte, utxoSetStateSize)
+	byteOrder.PutUint64(serialized[0:8], s.numUtxos)
+	byteOrder.PutUint64(serialized[8:16], uint64(s.totalAmount))
+	byteOrder.PutUint64(serialized[16:24], s.serializedSize)
+	putMuHashElement(serialized[24:], s.hash.numerator)
+	putMuHashElement(serialized[24+muHashElementSize:], s.hash.denominator)
+	return serialized
+}
+
+// deserializeUtxoSetState decodes the passed serialized utxo set state.
+func deserializeUtxoSetState(serialized []byte) (*utxoSetState, error) {
+	if len(serialized) != utxoSetStateSize {
+		return nil, database.Error{
+			ErrorCode:   database.ErrCorruption,
+			Description: "corrupt utxo set state",
+		}
+	}
+
+	offset := 24 + muHashElementSize
+	return &utxoSetState{
+		numUtxos:       byteOrder.Uint64(serialized[0:8]),
+		totalAmount:    int64(byteOrder.Uint64(serialized[8:16])),
+		serializedSize: byteOrder.Uint64(serialized[16:24]),
+		hash: &muHash{
+			numerator:   new(big.Int).SetBytes(serialized[24:offset]),
+			denominator: new(big.Int).SetBytes(serialized[offset:]),
+		},
+	}, nil
+}
+
+// dbPutUtxoSetState uses an existing database transaction to store the passed
+// utxo set state.
+func dbPutUtxoSetState(dbTx database.Tx, s *utxoSetState) error {
+	return dbTx.Metadata().Put(utxoSetStateKeyName, serializeUtxoSetState(s))
+}
+
+// dbFetchUtxoSetState uses an existing database transaction to load the utxo
+// set state.  When the state has not been stored yet, nil is returned for both
+// the state and the error.
+func dbFetchUtxoSetState(dbTx database.Tx) (*utxoSetState, error) {
+	serialized := dbTx.Metadata().Get(utxoSetStateKeyName)
+	if serialized == nil {
+		return nil, nil
+	}
+
+	return deserializeUtxoSetState(serialized)
+}
+
+// dbCalcUtxoSetState uses an existing database transaction to calculate the
+// utxo set state from scratch by scanning the entire utxo set.
+func dbCalcUtxoSetState(dbTx database.Tx) (*utxoSetState, error) {
+	state := newUtxoSetState()
+	cursor := dbTx.Metadata().Bucket(utxoSetBucketName).Cursor()
+	for ok := cursor.First(); ok; ok = cursor.Next() {
+		entry, err := deserializeUtxoEntry(cursor.Value())
+		if err != nil {
+			return nil, err
+		}
+
+		var txHash chainhash.Hash
+		copy(txHash[:], cursor.Key())
+		state.addEntry(&txHash, entry)
+	}
+
+	return state, nil
+}
+
+// initUtxoSetState loads the utxo set state from the database.  Databases that
+// were created before the state was tracked are migrated to include it before
+// it is loaded.
+func (b *BlockChain) initUtxoSetState() error {
+	return b.db.View(func(dbTx database.Tx) error {
+		state, err := dbFetchUtxoSetState(dbTx)
+		if err != nil {
+			return err
+		}
+		if state == nil {
+			return AssertError("utxo set state is missing from " +
+				"the database")
+		}
+
+		b.utxoSetState = state
+		return nil
+	})
+}
+
+// newUtxoSetStats returns the statistics for the passed utxo set state as of
+// the provided best state.
+func newUtxoSetStats(snapshot *BestState, state *utxoSetState) *UtxoSetStats {
+	return &UtxoSetStats{
+		Hash:           *snapshot.Hash,
+		Height:         snapshot.Height,
+		NumUtxos:       state.numUtxos,
+		TotalAmount:    state.totalAmount,
+		SerializedSize: state.serializedSize,
+		Commitment:     state.hash.finalize(),
+	}
+}
+
+// UtxoSetStats returns statistics about the utxo set as of the current best
+// block.  The statistics are maintained incrementally as blocks are connected
+// and disconnected, so this does not need to access the database.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) UtxoSetStats() *UtxoSetStats {
+	b.stateLock.RLock()
+	snapshot := b.stateSnapshot
+	state := b.utxoSetState
+	b.stateLock.RUnlock()
+
+	return newUtxoSetStats(snapshot, state)
+}
+
+// CalcUtxoSetStats calculates statistics about the utxo set as of the current
+// best block by scanning the entire utxo set.  It is considerably slower than
+// UtxoSetStats and is intended to cross-check the incrementally maintained
+// statistics.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) CalcUtxoSetStats() (*UtxoSetStats, error) {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	// Write the pending utxo set modifications so the utxo set in the
+	// database is the one at the best block.
+	if err := b.flushUtxoBatch(); err != nil {
+		return nil, err
+	}
+
+	var state *utxoSetState
+	err := b.db.View(func(dbTx database.Tx) error {
+		var err error
+		state, err = dbCalcUtxoSetState(dbTx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return newUtxoSetStats(b.BestSnapshot(), state), nil
+}
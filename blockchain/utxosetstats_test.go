@@ -0,0 +1,98 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bitgo/prova/chaincfg/chainhash"
+)
+
+// TestMuHash ensures the rolling hash only depends on the contents of the set
+// and not the order in which items are added and removed.
+func TestMuHash(t *testing.T) {
+	t.Parallel()
+
+	items := [][]byte{[]byte("a"), []byte("b"), []byte("c")}
+
+	forward := newMuHash()
+	for _, item := range items {
+		forward.add(item)
+	}
+	backward := newMuHash()
+	for i := len(items) - 1; i >= 0; i-- {
+		backward.add(items[i])
+	}
+	if forward.finalize() != backward.finalize() {
+		t.Fatalf("hash depends on insertion order")
+	}
+
+	// Ensure adding and then removing an item restores the prior hash
+	// and that removing an item before it is added works as well.
+	want := forward.finalize()
+	forward.add([]byte("d"))
+	if forward.finalize() == want {
+		t.Fatalf("hash did not change after adding an item")
+	}
+	forward.remove([]byte("d"))
+	if got := forward.finalize(); got != want {
+		t.Fatalf("hash mismatch after removal -- got %v, want %v", got,
+			want)
+	}
+	backward.remove([]byte("d"))
+	backward.add([]byte("d"))
+	if got := backward.finalize(); got != want {
+		t.Fatalf("hash mismatch after early removal -- got %v, want %v",
+			got, want)
+	}
+
+	// Ensure the empty set hashes the same regardless of history.
+	empty := newMuHash()
+	for _, item := range items {
+		empty.add(item)
+		empty.remove(item)
+	}
+	if empty.finalize() != newMuHash().finalize() {
+		t.Fatalf("hash of emptied set does not match the empty set")
+	}
+}
+
+// TestUtxoSetStateSerialization ensures serializing and deserializing the utxo
+// set state works as expected and preserves the rolling hash.
+func TestUtxoSetStateSerialization(t *testing.T) {
+	t.Parallel()
+
+	state := newUtxoSetState()
+	txHash := chainhash.Hash{0x01}
+	state.addOutput(&txHash, 0, 5000, []byte{0x51})
+	state.addOutput(&txHash, 1, 7000, []byte{0x52, 0x53})
+	state.removeOutput(&txHash, 0, 5000, []byte{0x51})
+
+	serialized := serializeUtxoSetState(state)
+	gotState, err := deserializeUtxoSetState(serialized)
+	if err != nil {
+		t.Fatalf("deserializeUtxoSetState: unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(gotState, state) {
+		t.Fatalf("deserializeUtxoSetState: mismatched state -- got %+v, "+
+			"want %+v", gotState, state)
+	}
+	if gotState.hash.finalize() != state.hash.finalize() {
+		t.Fatalf("deserializeUtxoSetState: mismatched hash")
+	}
+	if gotState.numUtxos != 1 || gotState.totalAmount != 7000 {
+		t.Fatalf("deserializeUtxoSetState: unexpected counters -- got "+
+			"%d utxos with amount %d", gotState.numUtxos,
+			gotState.totalAmount)
+	}
+
+	// Ensure truncated data is rejected.
+	_, err = deserializeUtxoSetState(serialized[:len(serialized)-1])
+	if err == nil {
+		t.Fatalf("deserializeUtxoSetState: did not receive expected " +
+			"error for truncated data")
+	}
+}
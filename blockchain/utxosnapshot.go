@@ -0,0 +1,578 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/wire"
+)
+
+const (
+	// utxoSnapshotVersion is the current version of the utxo set snapshot
+	// format.
+	utxoSnapshotVersion = 2
+
+	// maxUtxoSnapshotWorkSumSize is the maximum allowed size of the
+	// serialized work sum in a utxo set snapshot.
+	maxUtxoSnapshotWorkSumSize = 64
+)
+
+// -----------------------------------------------------------------------------
+// A utxo set snapshot contains everything needed to initialize a fresh chain
+// state at the snapshot base block and continue syncing from there.  Along
+// with the unspent transaction output set and the admin state, it contains the
+// hashes of all blocks up to the base block and the most recent blocks, which
+// are needed to validate the blocks that follow it.
+//
+// The serialized format is:
+//
+//   <version><net><base hash><base height><total txns><work sum>
+//   <admin state><num hashes><hashes><num blocks><blocks>
+//   <num utxo entries><utxo entries><commitment><checksum>
+//
+//   Field              Type              Size
+//   version            uint32            4 bytes
+//   net                wire.BitcoinNet   4 bytes
+//   base hash          chainhash.Hash    chainhash.HashSize
+//   base height        uint32            4 bytes
+//   total txns         uint64            8 bytes
+//   work sum           []byte            variable (VarBytes)
+//   admin state        []byte            variable (VarBytes)
+//   num hashes         VLQ               variable (VarInt)
+//   hashes             []chainhash.Hash  num hashes * chainhash.HashSize
+//   num blocks         VLQ               variable (VarInt)
+//   blocks             [][]byte          variable (VarBytes each)
+//   num utxo entries   VLQ               variable (VarInt)
+//   utxo entries       []entry           variable
+//   commitment         chainhash.Hash    chainhash.HashSize
+//   checksum           chainhash.Hash    chainhash.HashSize
+//
+// The admin state is serialized as described for the key set bucket and each
+// utxo entry consists of the transaction hash followed by the entry serialized
+// as described for the utxo set bucket as VarBytes.  The hashes are indexed by
+// height starting from the genesis block and the blocks are the most recent
+// ones up to and including the base block.
+//
+// The commitment is the double sha256 of the sha256 of all fields up to and
+// including the hashes followed by the rolling hash of the utxo set.  It thus
+// covers the admin state and block hashes along with the utxo set, and the
+// blocks are checked against the committed hashes.  The checksum is the sha256
+// of everything before it.
+// -----------------------------------------------------------------------------
+
+// utxoSnapshotBase identifies the block a chain state was imported from.
+type utxoSnapshotBase struct {
+	hash   chainhash.Hash
+	height uint32
+}
+
+// serializeUtxoSnapshotBase returns the serialization of the passed snapshot
+// base, which is the block hash followed by the block height.
+func serializeUtxoSnapshotBase(base *utxoSnapshotBase) []byte {
+	serialized := make([]byte, chainhash.HashSize+4)
+	copy(serialized, base.hash[:])
+	byteOrder.PutUint32(serialized[chainhash.HashSize:], base.height)
+	return serialized
+}
+
+// deserializeUtxoSnapshotBase decodes the passed serialized snapshot base.
+func deserializeUtxoSnapshotBase(serialized []byte) (*utxoSnapshotBase, error) {
+	if len(serialized) < chainhash.HashSize+4 {
+		return nil, database.Error{
+			ErrorCode:   database.ErrCorruption,
+			Description: "corrupt utxo snapshot base",
+		}
+	}
+
+	var base utxoSnapshotBase
+	copy(base.hash[:], serialized[:chainhash.HashSize])
+	base.height = byteOrder.Uint32(serialized[chainhash.HashSize:])
+	return &base, nil
+}
+
+// utxoSnapshotNumBlocks returns the number of most recent blocks included in a
+// utxo set snapshot.  They are needed to calculate the difficulty, median time,
+// version majority, and validate key rate limits of the blocks that follow the
+// snapshot base block.
+func utxoSnapshotNumBlocks(params *chaincfg.Params) uint32 {
+	return uint32(params.BlockUpgradeNumToCheck) +
+		uint32(params.PowAveragingWindow) + medianTimeBlocks
+}
+
+// calcUtxoSnapshotCommitment returns the commitment of a utxo set snapshot given
+// the sha256 of its fields up to and including the block hashes and the rolling
+// hash of its utxo set.
+func calcUtxoSnapshotCommitment(fieldsHash []byte, utxoSetHash *chainhash.Hash) chainhash.Hash {
+	return chainhash.DoubleHashH(append(fieldsHash, utxoSetHash[:]...))
+}
+
+// utxoSnapshotCommitment returns the expected commitment of a snapshot with the
+// passed base block from the known good snapshots the chain was configured
+// with.  It returns nil when there is no such snapshot.
+func (b *BlockChain) utxoSnapshotCommitment(base *utxoSnapshotBase) *chainhash.Hash {
+	for i := range b.utxoSnapshots {
+		snapshot := &b.utxoSnapshots[i]
+		if snapshot.Height == base.height &&
+			snapshot.Hash.IsEqual(&base.hash) {
+
+			return snapshot.Commitment
+		}
+	}
+	return nil
+}
+
+// dbWriteUtxoSnapshot uses an existing database transaction to write a utxo set
+// snapshot at the current best block, excluding the checksum, to the passed
+// writer.  It returns the commitment of the snapshot.
+//
+// This function MUST be called with the chain lock held (for writes) and the
+// pending utxo set modifications written.
+func (b *BlockChain) dbWriteUtxoSnapshot(dbTx database.Tx, w io.Writer) (*chainhash.Hash, error) {
+	b.stateLock.RLock()
+	snapshot := b.stateSnapshot
+	state := b.utxoSetState
+	b.stateLock.RUnlock()
+
+	// The fields up to and including the block hashes are also written
+	// to the hasher of the commitment.
+	fieldsHasher := sha256.New()
+	cw := io.MultiWriter(w, fieldsHasher)
+
+	best := b.bestNode
+	fields := []interface{}{uint32(utxoSnapshotVersion),
+		uint32(b.chainParams.Net), *best.hash, best.height,
+		snapshot.TotalTxns}
+	for _, field := range fields {
+		if err := binary.Write(cw, byteOrder, field); err != nil {
+			return nil, err
+		}
+	}
+	err := wire.WriteVarBytes(cw, 0, best.workSum.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	adminState := serializeKeySet(b.adminKeySets, b.aspKeyIdMap,
+		b.threadTips, b.lastKeyID, b.totalSupply)
+	if err := wire.WriteVarBytes(cw, 0, adminState); err != nil {
+		return nil, err
+	}
+
+	// Write the hashes of all blocks in the main chain.
+	if err := wire.WriteVarInt(cw, 0, uint64(best.height)+1); err != nil {
+		return nil, err
+	}
+	hashes := make([]chainhash.Hash, best.height+1)
+	for height := uint32(0); height <= best.height; height++ {
+		hash, err := dbFetchHashByHeight(dbTx, height)
+		if err != nil {
+			return nil, err
+		}
+		hashes[height] = *hash
+		if _, err := cw.Write(hash[:]); err != nil {
+			return nil, err
+		}
+	}
+
+	// Write the most recent blocks.  The genesis block is never included
+	// since every chain already contains it.
+	numBlocks := utxoSnapshotNumBlocks(b.chainParams)
+	if numBlocks > best.height {
+		numBlocks = best.height
+	}
+	if err := wire.WriteVarInt(w, 0, uint64(numBlocks)); err != nil {
+		return nil, err
+	}
+	for height := best.height + 1 - numBlocks; height <= best.height; height++ {
+		blockBytes, err := dbTx.FetchBlock(&hashes[height])
+		if err != nil {
+			return nil, err
+		}
+		if err := wire.WriteVarBytes(w, 0, blockBytes); err != nil {
+			return nil, err
+		}
+	}
+
+	// Write the utxo set entries along with the commitment to the
+	// snapshot.
+	var numEntries uint64
+	cursor := dbTx.Metadata().Bucket(utxoSetBucketName).Cursor()
+	for ok := cursor.First(); ok; ok = cursor.Next() {
+		numEntries++
+	}
+	if err := wire.WriteVarInt(w, 0, numEntries); err != nil {
+		return nil, err
+	}
+	for ok := cursor.First(); ok; ok = cursor.Next() {
+		if _, err := w.Write(cursor.Key()); err != nil {
+			return nil, err
+		}
+		if err := wire.WriteVarBytes(w, 0, cursor.Value()); err != nil {
+			return nil, err
+		}
+	}
+	utxoSetHash := state.hash.finalize()
+	commitment := calcUtxoSnapshotCommitment(fieldsHasher.Sum(nil),
+		&utxoSetHash)
+	if _, err := w.Write(commitment[:]); err != nil {
+		return nil, err
+	}
+	return &commitment, nil
+}
+
+// ExportUtxoSnapshot writes a snapshot of the unspent transaction output set at
+// the block with the passed hash to the passed writer.  The snapshot can be
+// used to initialize the chain state of a fresh node via ImportUtxoSnapshot.
+// Since the utxo set is only available at the current best block, the passed
+// hash must be the hash of the current best block.  It returns the commitment
+// of the snapshot, which identifies it as a known good snapshot.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ExportUtxoSnapshot(w io.Writer, atHash chainhash.Hash) (*chainhash.Hash, error) {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	if !b.bestNode.hash.IsEqual(&atHash) {
+		return nil, fmt.Errorf("unable to export utxo snapshot at block %v "+
+			"since it is not the current best block %v", atHash,
+			b.bestNode.hash)
+	}
+
+	// Write the pending utxo set modifications so the utxo set in the
+	// database is the one at the best block.
+	if err := b.flushUtxoBatch(); err != nil {
+		return nil, err
+	}
+
+	var commitment *chainhash.Hash
+	hasher := sha256.New()
+	err := b.db.View(func(dbTx database.Tx) error {
+		var err error
+		commitment, err = b.dbWriteUtxoSnapshot(dbTx,
+			io.MultiWriter(w, hasher))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := w.Write(hasher.Sum(nil)); err != nil {
+		return nil, err
+	}
+	return commitment, nil
+}
+
+// dbImportUtxoSnapshot uses an existing database transaction to replace the
+// chain state with the one from the utxo set snapshot read from the passed
+// reader, excluding the checksum.  It returns the snapshot base block along
+// with the utxo set statistics of the snapshot.
+//
+// This function MUST be called with the chain lock held (for writes).
+func (b *BlockChain) dbImportUtxoSnapshot(dbTx database.Tx, r io.Reader) (*utxoSnapshotBase, *utxoSetState, error) {
+	// The fields up to and including the block hashes are also read into
+	// the hasher of the commitment.
+	fieldsHasher := sha256.New()
+	cr := io.TeeReader(r, fieldsHasher)
+
+	var version, net uint32
+	var base utxoSnapshotBase
+	var totalTxns uint64
+	fields := []interface{}{&version, &net, &base.hash, &base.height,
+		&totalTxns}
+	for _, field := range fields {
+		if err := binary.Read(cr, byteOrder, field); err != nil {
+			return nil, nil, err
+		}
+	}
+	if version != utxoSnapshotVersion {
+		return nil, nil, fmt.Errorf("unsupported utxo snapshot "+
+			"version %d", version)
+	}
+	if wire.BitcoinNet(net) != b.chainParams.Net {
+		return nil, nil, fmt.Errorf("utxo snapshot is for network %v "+
+			"instead of %v", wire.BitcoinNet(net), b.chainParams.Net)
+	}
+	expected := b.utxoSnapshotCommitment(&base)
+	if expected == nil {
+		return nil, nil, fmt.Errorf("no known commitment for utxo "+
+			"snapshot at block %v (height %d)", base.hash,
+			base.height)
+	}
+
+	workSumBytes, err := wire.ReadVarBytes(cr, 0,
+		maxUtxoSnapshotWorkSumSize, "work sum")
+	if err != nil {
+		return nil, nil, err
+	}
+	adminState, err := wire.ReadVarBytes(cr, 0, wire.MaxBlockPayload,
+		"admin state")
+	if err != nil {
+		return nil, nil, err
+	}
+	adminKeySets, aspKeyIdMap, threadTips, lastKeyID, totalSupply, err :=
+		deserializeKeySet(adminState)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Read the hashes of all blocks in the main chain and add them to the
+	// block index.
+	numHashes, err := wire.ReadVarInt(cr, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	if numHashes != uint64(base.height)+1 {
+		return nil, nil, fmt.Errorf("utxo snapshot contains %d block "+
+			"hashes instead of %d", numHashes, uint64(base.height)+1)
+	}
+	hashes := make([]chainhash.Hash, numHashes)
+	for height := range hashes {
+		if _, err := io.ReadFull(cr, hashes[height][:]); err != nil {
+			return nil, nil, err
+		}
+	}
+	if hashes[0] != *b.bestNode.hash {
+		return nil, nil, fmt.Errorf("utxo snapshot genesis block %v "+
+			"does not match %v", hashes[0], b.bestNode.hash)
+	}
+	if hashes[base.height] != base.hash {
+		return nil, nil, fmt.Errorf("utxo snapshot block hashes do "+
+			"not end at the base block %v", base.hash)
+	}
+	for height := uint32(1); height <= base.height; height++ {
+		err := dbPutBlockIndex(dbTx, &hashes[height], height)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Read the most recent blocks and store them.
+	numBlocks, err := wire.ReadVarInt(r, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	wantBlocks := utxoSnapshotNumBlocks(b.chainParams)
+	if wantBlocks > base.height {
+		wantBlocks = base.height
+	}
+	if numBlocks < uint64(wantBlocks) || numBlocks > uint64(base.height) {
+		return nil, nil, fmt.Errorf("utxo snapshot contains %d blocks "+
+			"instead of %d", numBlocks, wantBlocks)
+	}
+	firstHeight := base.height + 1 - uint32(numBlocks)
+	for height := firstHeight; height <= base.height; height++ {
+		blockBytes, err := wire.ReadVarBytes(r, 0, wire.MaxBlockPayload,
+			"block")
+		if err != nil {
+			return nil, nil, err
+		}
+		block, err := provautil.NewBlockFromBytes(blockBytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		if *block.Hash() != hashes[height] {
+			return nil, nil, fmt.Errorf("utxo snapshot block %v "+
+				"does not match the block hash %v at height %d",
+				block.Hash(), hashes[height], height)
+		}
+		if err := dbTx.StoreBlock(block); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Replace the utxo set with the entries in the snapshot while
+	// calculating the statistics for them.
+	bucket := dbTx.Metadata().Bucket(utxoSetBucketName)
+	var existingKeys [][]byte
+	cursor := bucket.Cursor()
+	for ok := cursor.First(); ok; ok = cursor.Next() {
+		existingKeys = append(existingKeys, append([]byte(nil),
+			cursor.Key()...))
+	}
+	for _, key := range existingKeys {
+		if err := bucket.Delete(key); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	numEntries, err := wire.ReadVarInt(r, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	state := newUtxoSetState()
+	for i := uint64(0); i < numEntries; i++ {
+		var txHash chainhash.Hash
+		if _, err := io.ReadFull(r, txHash[:]); err != nil {
+			return nil, nil, err
+		}
+		serialized, err := wire.ReadVarBytes(r, 0, wire.MaxBlockPayload,
+			"utxo entry")
+		if err != nil {
+			return nil, nil, err
+		}
+		entry, err := deserializeUtxoEntry(serialized)
+		if err != nil {
+			return nil, nil, err
+		}
+		for index := range entry.sparseOutputs {
+			state.addOutput(&txHash, index,
+				entry.AmountByIndex(index),
+				entry.PkScriptByIndex(index))
+		}
+		if err := bucket.Put(txHash[:], serialized); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Ensure the snapshot matches both the commitment in it and the
+	// expected one.  Since the commitment covers the admin state and
+	// block hashes along with the utxo set, none of them can be altered.
+	var commitment chainhash.Hash
+	if _, err := io.ReadFull(r, commitment[:]); err != nil {
+		return nil, nil, err
+	}
+	utxoSetHash := state.hash.finalize()
+	calculated := calcUtxoSnapshotCommitment(fieldsHasher.Sum(nil),
+		&utxoSetHash)
+	if calculated != commitment {
+		return nil, nil, fmt.Errorf("utxo snapshot commitment %v does "+
+			"not match the calculated commitment %v", commitment,
+			calculated)
+	}
+	if calculated != *expected {
+		return nil, nil, fmt.Errorf("utxo snapshot commitment %v does "+
+			"not match the expected commitment %v", calculated,
+			expected)
+	}
+
+	// Store the chain state for the snapshot base block.
+	if err := dbPutUtxoSetState(dbTx, state); err != nil {
+		return nil, nil, err
+	}
+	bestState := &BestState{
+		Hash:      &base.hash,
+		Height:    base.height,
+		TotalTxns: totalTxns,
+	}
+	err = dbPutBestState(dbTx, bestState, new(big.Int).SetBytes(workSumBytes))
+	if err != nil {
+		return nil, nil, err
+	}
+	err = dbPutKeySet(dbTx, adminKeySets, aspKeyIdMap, threadTips,
+		lastKeyID, totalSupply)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = dbTx.Metadata().Put(utxoSnapshotBaseKeyName,
+		serializeUtxoSnapshotBase(&base))
+	if err != nil {
+		return nil, nil, err
+	}
+	err = dbPutUtxoSetTip(dbTx, &base.hash, base.height)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &base, state, nil
+}
+
+// ImportUtxoSnapshot initializes the chain state from the utxo set snapshot
+// read from the passed reader, which was created via ExportUtxoSnapshot, and
+// records the snapshot base block.  The chain then continues from the base
+// block as if it had been synced normally.
+//
+// The commitment of the snapshot must match the one for the base block in the
+// known good snapshots the chain was configured with, and the chain must only
+// contain the genesis block.  Since the blocks before the most recent ones are
+// not available, the chain can not be reorganized to before the base block and
+// optional indexes are not supported.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ImportUtxoSnapshot(r io.Reader) error {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	if b.bestNode.height != 0 {
+		return fmt.Errorf("utxo snapshots can only be imported into a " +
+			"chain which only contains the genesis block")
+	}
+	if b.indexManager != nil {
+		return fmt.Errorf("utxo snapshots can not be imported when " +
+			"optional indexes are enabled")
+	}
+
+	// Import the snapshot and verify the checksum before committing it.
+	var base *utxoSnapshotBase
+	var state *utxoSetState
+	hasher := sha256.New()
+	err := b.db.Update(func(dbTx database.Tx) error {
+		var err error
+		base, state, err = b.dbImportUtxoSnapshot(dbTx,
+			io.TeeReader(r, hasher))
+		if err != nil {
+			return err
+		}
+
+		var checksum [sha256.Size]byte
+		if _, err := io.ReadFull(r, checksum[:]); err != nil {
+			return err
+		}
+		if !bytes.Equal(checksum[:], hasher.Sum(nil)) {
+			return fmt.Errorf("utxo snapshot checksum mismatch")
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Reload the chain state from the database.
+	b.index = make(map[chainhash.Hash]*blockNode)
+	b.depNodes = make(map[chainhash.Hash][]*blockNode)
+	b.bestKeyWindow.reset()
+	b.sideKeyWindow.reset()
+	b.stateLock.Lock()
+	err = b.initChainState()
+	b.stateLock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Imported utxo snapshot at block %v (height %d) with %d "+
+		"unspent outputs", base.hash, base.height, state.numUtxos)
+	return nil
+}
+
+// UtxoSnapshotBase returns the hash and height of the block the chain state
+// was imported from via ImportUtxoSnapshot.  The returned hash is nil when the
+// chain state was not imported from a snapshot.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) UtxoSnapshotBase() (*chainhash.Hash, uint32, error) {
+	var base *utxoSnapshotBase
+	err := b.db.View(func(dbTx database.Tx) error {
+		serialized := dbTx.Metadata().Get(utxoSnapshotBaseKeyName)
+		if serialized == nil {
+			return nil
+		}
+
+		var err error
+		base, err = deserializeUtxoSnapshotBase(serialized)
+		return err
+	})
+	if err != nil || base == nil {
+		return nil, 0, err
+	}
+	return &base.hash, base.height, nil
+}
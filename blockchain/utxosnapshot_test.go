@@ -0,0 +1,244 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"reflect"
+	"testing"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/blockchain/fullblocktests"
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/wire"
+)
+
+// linearTestBlocks returns the longest chain of accepted blocks generated by
+// the fullblocktests package which extends the regression test genesis block
+// without any reorganizations.
+func linearTestBlocks(t testing.TB) []*wire.MsgBlock {
+	tests, err := fullblocktests.Generate(false)
+	if err != nil {
+		t.Fatalf("failed to generate tests: %v", err)
+	}
+
+	var blocks []*wire.MsgBlock
+	tip := chaincfg.RegressionNetParams.GenesisBlock.BlockHash()
+	for _, testInstances := range tests {
+		for _, item := range testInstances {
+			accepted, ok := item.(fullblocktests.AcceptedBlock)
+			if !ok || accepted.Block.Header.PrevBlock != tip {
+				continue
+			}
+			blocks = append(blocks, accepted.Block)
+			tip = accepted.Block.BlockHash()
+		}
+	}
+	return blocks
+}
+
+// processTestBlocks processes the passed blocks in order and fails the test
+// when any of them are not accepted to the main chain.
+func processTestBlocks(t testing.TB, name string, chain *blockchain.BlockChain, blocks []*wire.MsgBlock) {
+	for _, block := range blocks {
+		isMainChain, _, err := chain.ProcessBlock(provautil.NewBlock(block),
+			blockchain.BFNone)
+		if err != nil {
+			t.Fatalf("%s: unexpected error processing block %v: %v",
+				name, block.BlockHash(), err)
+		}
+		if !isMainChain {
+			t.Fatalf("%s: block %v was not accepted to the main chain",
+				name, block.BlockHash())
+		}
+	}
+}
+
+// TestUtxoSnapshot ensures a utxo set snapshot exported from one chain can be
+// imported into a fresh chain, which then continues to accept blocks and ends
+// up with the same chain state, and that invalid snapshots are rejected.
+//
+// The regression test network is used in place of the simulation test network
+// since the blocks generated by the fullblocktests package are the only ones
+// which can be validated without a miner.
+func TestUtxoSnapshot(t *testing.T) {
+	blocks := linearTestBlocks(t)
+	if len(blocks) < 4 {
+		t.Fatalf("not enough test blocks - got %d", len(blocks))
+	}
+	baseIdx := len(blocks) / 2
+	baseHash := blocks[baseIdx].BlockHash()
+
+	// Export a snapshot at the base block.
+	chain, teardownFunc, err := chainSetup("utxosnapshotexport",
+		&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+	processTestBlocks(t, "export", chain, blocks[:baseIdx+1])
+	var snapshot bytes.Buffer
+	commitment, err := chain.ExportUtxoSnapshot(&snapshot, baseHash)
+	if err != nil {
+		t.Fatalf("ExportUtxoSnapshot: unexpected error: %v", err)
+	}
+	utxoSnapshots := []chaincfg.UtxoSnapshot{{
+		Height:     uint32(baseIdx + 1),
+		Hash:       &baseHash,
+		Commitment: commitment,
+	}}
+
+	// Ensure exporting at a block other than the best block fails.
+	genesisHash := chaincfg.RegressionNetParams.GenesisBlock.BlockHash()
+	_, err = chain.ExportUtxoSnapshot(&bytes.Buffer{}, genesisHash)
+	if err == nil {
+		t.Fatalf("ExportUtxoSnapshot: did not receive expected error " +
+			"when exporting below the best block")
+	}
+
+	// Ensure invalid snapshots are rejected.
+	corrupt := append([]byte(nil), snapshot.Bytes()...)
+	corrupt[len(corrupt)-1] ^= 0x01
+
+	// Alter the total supply in the admin state, which follows the
+	// fixed-size fields and the work sum, and fix up the checksum so only
+	// the commitment catches it.
+	tampered := append([]byte(nil), snapshot.Bytes()...)
+	const fixedFieldsSize = 4 + 4 + chainhash.HashSize + 4 + 8
+	r := bytes.NewReader(tampered[fixedFieldsSize:])
+	if _, err := wire.ReadVarBytes(r, 0, 64, "work sum"); err != nil {
+		t.Fatalf("unable to read work sum: %v", err)
+	}
+	if _, err := wire.ReadVarInt(r, 0); err != nil {
+		t.Fatalf("unable to read admin state size: %v", err)
+	}
+	totalSupplyOffset := len(tampered) - r.Len() + 3*(chainhash.HashSize+4) +
+		btcec.KeyIDSize
+	tampered[totalSupplyOffset] ^= 0x01
+	checksum := sha256.Sum256(tampered[:len(tampered)-sha256.Size])
+	copy(tampered[len(tampered)-sha256.Size:], checksum[:])
+	wrongCommitment := []chaincfg.UtxoSnapshot{{
+		Height:     uint32(baseIdx + 1),
+		Hash:       &baseHash,
+		Commitment: &chainhash.Hash{0x01},
+	}}
+	tests := []struct {
+		name      string
+		snapshots []chaincfg.UtxoSnapshot
+		data      []byte
+	}{
+		{
+			name:      "no known commitment",
+			snapshots: nil,
+			data:      snapshot.Bytes(),
+		},
+		{
+			name:      "wrong commitment",
+			snapshots: wrongCommitment,
+			data:      snapshot.Bytes(),
+		},
+		{
+			name:      "bad checksum",
+			snapshots: utxoSnapshots,
+			data:      corrupt,
+		},
+		{
+			name:      "tampered admin state",
+			snapshots: utxoSnapshots,
+			data:      tampered,
+		},
+		{
+			name:      "truncated",
+			snapshots: utxoSnapshots,
+			data:      snapshot.Bytes()[:snapshot.Len()/2],
+		},
+	}
+	for _, test := range tests {
+		importChain, teardown, err := chainSetupWithConfig(
+			"utxosnapshotinvalid", &chaincfg.RegressionNetParams,
+			blockchain.Config{UtxoSnapshots: test.snapshots})
+		if err != nil {
+			t.Fatalf("%s: failed to setup chain instance: %v",
+				test.name, err)
+		}
+		err = importChain.ImportUtxoSnapshot(bytes.NewReader(test.data))
+		best := importChain.BestSnapshot()
+		teardown()
+		if err == nil {
+			t.Fatalf("%s: did not receive expected error", test.name)
+		}
+		if best.Height != 0 {
+			t.Fatalf("%s: chain state changed after failed import - "+
+				"height %d", test.name, best.Height)
+		}
+	}
+
+	// Import the snapshot into a fresh chain and ensure it matches the
+	// exporting chain.
+	importChain, teardown, err := chainSetupWithConfig("utxosnapshotimport",
+		&chaincfg.RegressionNetParams,
+		blockchain.Config{UtxoSnapshots: utxoSnapshots})
+	if err != nil {
+		t.Fatalf("failed to setup chain instance: %v", err)
+	}
+	defer teardown()
+	err = importChain.ImportUtxoSnapshot(bytes.NewReader(snapshot.Bytes()))
+	if err != nil {
+		t.Fatalf("ImportUtxoSnapshot: unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(importChain.BestSnapshot(), chain.BestSnapshot()) {
+		t.Fatalf("mismatched best state after import - got %+v, want %+v",
+			importChain.BestSnapshot(), chain.BestSnapshot())
+	}
+	baseHashGot, baseHeight, err := importChain.UtxoSnapshotBase()
+	if err != nil {
+		t.Fatalf("UtxoSnapshotBase: unexpected error: %v", err)
+	}
+	if baseHashGot == nil || *baseHashGot != baseHash ||
+		baseHeight != uint32(baseIdx+1) {
+
+		t.Fatalf("UtxoSnapshotBase: unexpected base - got %v (height "+
+			"%d), want %v (height %d)", baseHashGot, baseHeight,
+			baseHash, baseIdx+1)
+	}
+	if hash, _, _ := chain.UtxoSnapshotBase(); hash != nil {
+		t.Fatalf("UtxoSnapshotBase: unexpected base %v for a chain "+
+			"which was not imported", hash)
+	}
+
+	// Ensure a snapshot can not be imported over an existing chain state.
+	err = importChain.ImportUtxoSnapshot(bytes.NewReader(snapshot.Bytes()))
+	if err == nil {
+		t.Fatalf("ImportUtxoSnapshot: did not receive expected error " +
+			"when importing into a non-fresh chain")
+	}
+
+	// Extend both chains and ensure they end up with the same tip and utxo
+	// set.
+	processTestBlocks(t, "export", chain, blocks[baseIdx+1:])
+	processTestBlocks(t, "import", importChain, blocks[baseIdx+1:])
+	if !reflect.DeepEqual(importChain.BestSnapshot(), chain.BestSnapshot()) {
+		t.Fatalf("mismatched best state after extending - got %+v, "+
+			"want %+v", importChain.BestSnapshot(),
+			chain.BestSnapshot())
+	}
+	stats := importChain.UtxoSetStats()
+	if !reflect.DeepEqual(stats, chain.UtxoSetStats()) {
+		t.Fatalf("mismatched utxo set stats - got %+v, want %+v", stats,
+			chain.UtxoSetStats())
+	}
+	calcStats, err := importChain.CalcUtxoSetStats()
+	if err != nil {
+		t.Fatalf("CalcUtxoSetStats: unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(calcStats, stats) {
+		t.Fatalf("mismatched calculated utxo set stats - got %+v, "+
+			"want %+v", calcStats, stats)
+	}
+}
@@ -459,12 +459,13 @@ func (view *UtxoViewpoint) commit() {
 
 // fetchUtxosMain fetches unspent transaction output data about the provided
 // set of transactions from the point of view of the end of the main chain at
-// the time of the call.
+// the time of the call.  The pending modifications in the passed batch, which
+// may be nil, take precedence over the utxo set in the database.
 //
 // Upon completion of this function, the view will contain an entry for each
 // requested transaction.  Fully spent transactions, or those which otherwise
 // don't exist, will result in a nil entry in the view.
-func (view *UtxoViewpoint) fetchUtxosMain(db database.DB, txSet map[chainhash.Hash]struct{}) error {
+func (view *UtxoViewpoint) fetchUtxosMain(db database.DB, batch *utxoBatch, txSet map[chainhash.Hash]struct{}) error {
 	// Nothing to do if there are no requested hashes.
 	if len(txSet) == 0 {
 		return nil
@@ -481,6 +482,10 @@ func (view *UtxoViewpoint) fetchUtxosMain(db database.DB, txSet map[chainhash.Ha
 	return db.View(func(dbTx database.Tx) error {
 		for hash := range txSet {
 			hashCopy := hash
+			if entry, ok := batch.lookup(&hashCopy); ok {
+				view.entries[hash] = entry
+				continue
+			}
 			entry, err := dbFetchUtxoEntry(dbTx, &hashCopy)
 			if err != nil {
 				return err
@@ -496,7 +501,7 @@ func (view *UtxoViewpoint) fetchUtxosMain(db database.DB, txSet map[chainhash.Ha
 // fetchUtxos loads utxo details about provided set of transaction hashes into
 // the view from the database as needed unless they already exist in the view in
 // which case they are ignored.
-func (view *UtxoViewpoint) fetchUtxos(db database.DB, txSet map[chainhash.Hash]struct{}) error {
+func (view *UtxoViewpoint) fetchUtxos(db database.DB, batch *utxoBatch, txSet map[chainhash.Hash]struct{}) error {
 	// Nothing to do if there are no requested hashes.
 	if len(txSet) == 0 {
 		return nil
@@ -514,14 +519,14 @@ func (view *UtxoViewpoint) fetchUtxos(db database.DB, txSet map[chainhash.Hash]s
 	}
 
 	// Request the input utxos from the database.
-	return view.fetchUtxosMain(db, txNeededSet)
+	return view.fetchUtxosMain(db, batch, txNeededSet)
 }
 
 // fetchInputUtxos loads utxo details about the input transactions referenced
 // by the transactions in the given block into the view from the database as
 // needed.  In particular, referenced entries that are earlier in the block are
 // added to the view and entries that are already in the view are not modified.
-func (view *UtxoViewpoint) fetchInputUtxos(db database.DB, block *provautil.Block) error {
+func (view *UtxoViewpoint) fetchInputUtxos(db database.DB, batch *utxoBatch, block *provautil.Block) error {
 	// Build a map of in-flight transactions because some of the inputs in
 	// this block could be referencing other transactions earlier in this
 	// block which are not yet in the chain.
@@ -568,7 +573,7 @@ func (view *UtxoViewpoint) fetchInputUtxos(db database.DB, block *provautil.Bloc
 	}
 
 	// Request the input utxos from the database.
-	return view.fetchUtxosMain(db, txNeededSet)
+	return view.fetchUtxosMain(db, batch, txNeededSet)
 }
 
 // NewUtxoViewpoint returns a new empty unspent transaction output view.
@@ -603,7 +608,7 @@ func (b *BlockChain) FetchUtxoView(tx *provautil.Tx) (*UtxoViewpoint, error) {
 	// Request the utxos from the point of view of the end of the main
 	// chain.
 	view := NewUtxoViewpoint()
-	err := view.fetchUtxosMain(b.db, txNeededSet)
+	err := view.fetchUtxosMain(b.db, b.utxoBatch, txNeededSet)
 	return view, err
 }
 
@@ -621,6 +626,10 @@ func (b *BlockChain) FetchUtxoEntry(txHash *chainhash.Hash) (*UtxoEntry, error)
 	b.chainLock.RLock()
 	defer b.chainLock.RUnlock()
 
+	if entry, ok := b.utxoBatch.lookup(txHash); ok {
+		return entry, nil
+	}
+
 	var entry *UtxoEntry
 	err := b.db.View(func(dbTx database.Tx) error {
 		var err error
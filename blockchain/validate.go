@@ -17,6 +17,7 @@ import (
 	"github.com/bitgo/prova/provautil"
 	"github.com/bitgo/prova/txscript"
 	"github.com/bitgo/prova/wire"
+	"github.com/btcsuite/btclog"
 )
 
 const (
@@ -123,6 +124,33 @@ func SequenceLockActive(sequenceLock *SequenceLock, blockHeight int32,
 	return true
 }
 
+// isDeploymentActive returns whether the consensus rule change with the passed
+// deployment ID is enforced for a block at the passed height.
+func (b *BlockChain) isDeploymentActive(deploymentID int, height uint32) bool {
+	return height >= b.chainParams.Deployments[deploymentID].ActivationHeight
+}
+
+// LockTimeEvalTime returns the time the time based lock times of transactions
+// are evaluated against for inclusion in the block after the current best block
+// when that block has the passed timestamp.  Once BIP0113 is active for the
+// block as defined by the CSV deployment of the chain parameters, this is the
+// past median time of the current best block regardless of the timestamp.
+// Before that, it is the timestamp, which is raised to one second after the
+// past median time since the block is otherwise rejected, exactly like block
+// validation evaluates them against the timestamp of the block.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) LockTimeEvalTime(blockTime time.Time) time.Time {
+	best := b.BestSnapshot()
+	if b.isDeploymentActive(chaincfg.DeploymentCSV, best.Height+1) {
+		return best.MedianTime
+	}
+	if minTime := best.MedianTime.Add(time.Second); blockTime.Before(minTime) {
+		return minTime
+	}
+	return blockTime
+}
+
 // IsFinalizedTransaction determines whether or not a transaction is finalized.
 func IsFinalizedTransaction(tx *provautil.Tx, blockHeight uint32, blockTime time.Time) bool {
 	msgTx := tx.MsgTx()
@@ -158,6 +186,24 @@ func IsFinalizedTransaction(tx *provautil.Tx, blockHeight uint32, blockTime time
 	return true
 }
 
+// CheckTimeLockOutputs ensures the passed transaction only creates time-locked
+// outputs whose locks are enforced by the passed script flags.  Until the
+// script flag of a lock opcode is enforced for all new blocks, the opcode does
+// not check the lock, so such outputs could be spent right away.
+func CheckTimeLockOutputs(tx *provautil.Tx, enforcedFlags txscript.ScriptFlags) error {
+	for txOutIndex, txOut := range tx.MsgTx().TxOut {
+		lockFlag := txscript.TimeLockScriptFlag(txOut.PkScript)
+		if lockFlag&^enforcedFlags != 0 {
+			str := fmt.Sprintf("transaction %v output %d is "+
+				"time-locked before the script flag %#x which "+
+				"enforces the lock is active", tx.Hash(),
+				txOutIndex, lockFlag)
+			return ruleError(ErrInvalidTx, str)
+		}
+	}
+	return nil
+}
+
 // CalcBlockSubsidy returns the subsidy amount a block at the provided height
 // should have. This is mainly used for determining how much the coinbase for
 // newly generated blocks awards as well as validating the coinbase for blocks
@@ -196,7 +242,7 @@ func CheckTransactionSanity(tx *provautil.Tx) error {
 
 	// A transaction must not exceed the maximum allowed block payload when
 	// serialized.
-	serializedTxSize := tx.MsgTx().SerializeSize()
+	serializedTxSize := tx.SerializeSize()
 	if serializedTxSize > wire.MaxBlockPayload {
 		str := fmt.Sprintf("serialized transaction is too big - got "+
 			"%d, max %d", serializedTxSize, wire.MaxBlockPayload)
@@ -267,7 +313,10 @@ func CheckTransactionSanity(tx *provautil.Tx) error {
 				// If issuance/destruction tx, any non-nulldata outputs must be valid Prova scripts
 				if txOutIndex > 0 {
 					isDestruction := len(msgTx.TxIn) > 1
-					if scriptClass == txscript.NullDataTy {
+					// Admin operations are null data scripts with
+					// a class of their own.
+					if scriptClass == txscript.NullDataTy ||
+						scriptClass == txscript.ProvaAdminOpTy {
 						if !isDestruction {
 							str := fmt.Sprintf("issue transaction %v tries to destroy funds", tx.Hash)
 							return ruleError(ErrInvalidAdminTx, str)
@@ -815,15 +864,33 @@ func (b *BlockChain) checkBlockContext(block *provautil.Block, prevNode *blockNo
 		// previous block.
 		blockHeight := prevNode.height + 1
 
-		// Ensure all transactions in the block are finalized.
+		// Once BIP0113 is active, the lock times of transactions are
+		// evaluated against the past median time of the previous block
+		// instead of the block timestamp, which can be skewed by the
+		// validator.
+		blockTime := header.Timestamp
+		if b.isDeploymentActive(chaincfg.DeploymentCSV, blockHeight) {
+			blockTime, err = b.calcPastMedianTime(prevNode)
+			if err != nil {
+				return err
+			}
+		}
+
+		// Ensure all transactions in the block are finalized and only
+		// create time-locked outputs whose locks are enforced.
+		timeLockFlags := b.timeLockFlags(blockHeight)
 		for _, tx := range block.Transactions() {
-			if !IsFinalizedTransaction(tx, blockHeight,
-				header.Timestamp) {
+			if !IsFinalizedTransaction(tx, blockHeight, blockTime) {
 
 				str := fmt.Sprintf("block contains unfinalized "+
 					"transaction %v", tx.Hash())
 				return ruleError(ErrUnfinalizedTx, str)
 			}
+
+			err := CheckTimeLockOutputs(tx, timeLockFlags)
+			if err != nil {
+				return err
+			}
 		}
 	}
 
@@ -847,7 +914,7 @@ func (b *BlockChain) checkBIP0030(node *blockNode, block *provautil.Block, view
 	for _, tx := range block.Transactions() {
 		fetchSet[*tx.Hash()] = struct{}{}
 	}
-	err := view.fetchUtxos(b.db, fetchSet)
+	err := view.fetchUtxos(b.db, b.utxoBatch, fetchSet)
 	if err != nil {
 		return err
 	}
@@ -1079,8 +1146,12 @@ func CheckTransactionOutputs(tx *provautil.Tx, keyView *KeyViewpoint, chainParam
 			if err != nil {
 				return ruleError(ErrInvalidTx, fmt.Sprintf("%v", err))
 			}
+			// Admin operations are null data scripts with a class
+			// of their own.
 			scriptClass := txscript.TypeOfScript(output)
-			if txOut.Value == 0 && scriptClass == txscript.NullDataTy {
+			isNullData := scriptClass == txscript.NullDataTy ||
+				scriptClass == txscript.ProvaAdminOpTy
+			if txOut.Value == 0 && isNullData {
 				if !hasNullDataOutput {
 					hasNullDataOutput = true
 				} else {
@@ -1132,6 +1203,12 @@ func CheckTransactionOutputs(tx *provautil.Tx, keyView *KeyViewpoint, chainParam
 			// TODO(prova): check pubKey collisions
 			if isAddOp {
 				lastKeyId++
+				if !keyID.IsValid() {
+					str := fmt.Sprintf("keyID %v added in transaction %v "+
+						"is reserved. Operation rejected.", keyID,
+						tx.Hash())
+					return ruleError(ErrInvalidAdminOp, str)
+				}
 				if keyView.aspKeyIdMap[keyID] != nil {
 					str := fmt.Sprintf("keyID %v added in transaction %v "+
 						"exists already in admin set. Operation "+
@@ -1216,30 +1293,188 @@ func (b *BlockChain) isValidateKeyRateLimited(node *blockNode, validatePubKey wi
 		return false, nil
 	}
 	// Get the previous block validate keys to check rate limiting rules.
-	iterNode := node
-	prevPubKeys := []wire.BlockValidatingPubKey{}
+	// When checking against prospective inclusion of the key, the key of
+	// the node is passed separately since it is inclusive in the previous
+	// keys to check, so only the keys of its ancestors are needed.
 	window := b.chainParams.PowAveragingWindow
 	maxBlocks := b.chainParams.ChainWindowMaxBlocks
 	lastValidatePubKey := node.validatingPubKey
+	var prevPubKeys []wire.BlockValidatingPubKey
 	if prospectiveInclusion {
-		// When checking against prospective inclusion of the key,
-		// the pubkey is inclusive in the previous keys to check.
-		window -= 1
-	}
-	for i := 0; iterNode != nil && i < window; i++ {
-		var err error
-		iterNode, err = b.getPrevNodeFromNode(iterNode)
+		keys, err := b.recentValidateKeys(node, window)
+		if err != nil {
+			return false, err
+		}
+		prevPubKeys = keys[1:]
+	} else {
+		prevNode, err := b.getPrevNodeFromNode(node)
 		if err != nil {
 			log.Errorf("getPrevNodeFromNode: %v", err)
 			return false, err
 		}
-		if iterNode != nil {
-			prevPubKeys = append(prevPubKeys, iterNode.validatingPubKey)
+		if prevNode != nil {
+			prevPubKeys, err = b.recentValidateKeys(prevNode, window)
+			if err != nil {
+				return false, err
+			}
 		}
 	}
 	return IsGenerationShareRateLimited(validatePubKey, prevPubKeys, maxBlocks, prospectiveInclusion, lastValidatePubKey), nil
 }
 
+// blockScriptFlags returns the script flags which must be enforced when
+// validating the transaction scripts of the block represented by the passed
+// node given the node of the block before it.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) blockScriptFlags(node, prevNode *blockNode) txscript.ScriptFlags {
+	// Blocks created after the BIP0016 activation time need to have the
+	// pay-to-script-hash checks enabled.
+	var scriptFlags txscript.ScriptFlags
+	if node.timestamp >= txscript.Bip16Activation.Unix() {
+		scriptFlags |= txscript.ScriptBip16
+	}
+
+	// Enforce DER signatures for block versions 3+ once the majority of the
+	// network has upgraded to the enforcement threshold.  This is part of
+	// BIP0066.
+	if node.version >= 3 && b.isMajorityVersion(3, prevNode,
+		b.chainParams.BlockEnforceNumRequired) {
+
+		scriptFlags |= txscript.ScriptVerifyDERSignatures
+	}
+
+	// Enforce the flags of the consensus deployments which are active for
+	// the block.
+	scriptFlags |= VerificationFlagsForBlock(prevNode, b.chainParams)
+
+	return scriptFlags
+}
+
+// timeLockFlags returns the script flags of the time lock opcodes which are
+// enforced for the block at the passed height and for all blocks after it.
+// CHECKLOCKTIMEVERIFY is enforced once the CLTV deployment is active and
+// CHECKSEQUENCEVERIFY once the CSV deployment is active.
+func (b *BlockChain) timeLockFlags(height uint32) txscript.ScriptFlags {
+	var scriptFlags txscript.ScriptFlags
+	if b.isDeploymentActive(chaincfg.DeploymentCLTV, height) {
+		scriptFlags |= txscript.ScriptVerifyCheckLockTimeVerify
+	}
+	if b.isDeploymentActive(chaincfg.DeploymentCSV, height) {
+		scriptFlags |= txscript.ScriptVerifyCheckSequenceVerify
+	}
+	return scriptFlags
+}
+
+// TimeLockFlags returns the script flags of the time lock opcodes which are
+// enforced for the block after the current best block and for all blocks after
+// it.  Transactions must not create time-locked outputs whose lock opcodes are
+// not enforced yet.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) TimeLockFlags() txscript.ScriptFlags {
+	b.chainLock.RLock()
+	defer b.chainLock.RUnlock()
+	return b.timeLockFlags(b.bestNode.height + 1)
+}
+
+// deploymentScriptFlags houses the script flags each consensus deployment
+// enforces once it is active.
+var deploymentScriptFlags = [chaincfg.DefinedDeployments]txscript.ScriptFlags{
+	// CHECKSEQUENCEVERIFY is enforced along with the relative lock-times
+	// it checks.  This is part of BIP0112.
+	chaincfg.DeploymentCSV: txscript.ScriptVerifyCheckSequenceVerify,
+
+	// Canonical signature and public key encodings.
+	chaincfg.DeploymentStrictEncoding: txscript.StrictEncodingVerifyFlags,
+
+	// CHECKLOCKTIMEVERIFY is enforced along with the outputs locked by it.
+	// This is part of BIP0065.
+	chaincfg.DeploymentCLTV: txscript.ScriptVerifyCheckLockTimeVerify,
+}
+
+// nextBlockHeight returns the height of the block after the passed node, which
+// is nil for the genesis block.
+func nextBlockHeight(prevNode *blockNode) uint32 {
+	if prevNode == nil {
+		return 0
+	}
+	return prevNode.height + 1
+}
+
+// VerificationFlagsForBlock returns the script flags enforced by the consensus
+// deployments of the passed chain parameters which are active for the block
+// after the passed node.  Blocks are additionally subject to the flags of the
+// rule changes which predate the deployments.
+//
+// Since deployments are never deactivated, the flags for the block after the
+// current best block are the most restrictive consensus flags a transaction
+// accepted now may be mined under, so policy should always include them.  See
+// NextBlockVerificationFlags.
+func VerificationFlagsForBlock(prevNode *blockNode, params *chaincfg.Params) txscript.ScriptFlags {
+	height := nextBlockHeight(prevNode)
+	var scriptFlags txscript.ScriptFlags
+	for id, flags := range deploymentScriptFlags {
+		if height >= params.Deployments[id].ActivationHeight {
+			scriptFlags |= flags
+		}
+	}
+	return scriptFlags
+}
+
+// NextBlockVerificationFlags returns the script flags enforced by the consensus
+// deployments which are active for the block after the current best block.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) NextBlockVerificationFlags() txscript.ScriptFlags {
+	b.chainLock.RLock()
+	defer b.chainLock.RUnlock()
+	return VerificationFlagsForBlock(b.bestNode, b.chainParams)
+}
+
+// withheldScriptFlags returns the script flags of the consensus deployments of
+// the passed chain parameters which are scheduled, but not yet active for the
+// block after the passed node.
+func withheldScriptFlags(prevNode *blockNode, params *chaincfg.Params) txscript.ScriptFlags {
+	height := nextBlockHeight(prevNode)
+	var scriptFlags txscript.ScriptFlags
+	for id, flags := range deploymentScriptFlags {
+		activationHeight := params.Deployments[id].ActivationHeight
+		if height < activationHeight && activationHeight != math.MaxUint32 {
+			scriptFlags |= flags
+		}
+	}
+	return scriptFlags
+}
+
+// logWithheldScriptFlags logs when the transaction scripts of the passed block,
+// which is represented by the passed node given the node of the block before
+// it, would be invalid if the flags of the scheduled deployments which are not
+// yet active for the block were enforced, although they are valid under the
+// passed script flags.  Such blocks are only valid because those flags are
+// withheld.
+//
+// Since this verifies the scripts of the block a second time, it is only done
+// when debug logging is enabled.
+func (b *BlockChain) logWithheldScriptFlags(node, prevNode *blockNode, block *provautil.Block, utxoView *UtxoViewpoint, keyView *KeyViewpoint, scriptFlags txscript.ScriptFlags) {
+	if log.Level() > btclog.DebugLvl {
+		return
+	}
+	withheld := withheldScriptFlags(prevNode, b.chainParams)
+	if withheld&^scriptFlags == 0 {
+		return
+	}
+
+	err := checkBlockScripts(block, utxoView, keyView,
+		scriptFlags|withheld, nil, nil, b.scriptWorkers)
+	if err != nil {
+		log.Debugf("Block %v (height %d) is only valid because the "+
+			"script flags %#x of deployments which are not yet "+
+			"active are withheld: %v", node.hash, node.height,
+			withheld&^scriptFlags, err)
+	}
+}
+
 // checkConnectBlock performs several checks to confirm connecting the passed
 // block to the chain represented by the passed view does not violate any rules.
 // In addition, the passed view is updated to spend all of the referenced
@@ -1291,7 +1526,7 @@ func (b *BlockChain) checkConnectBlock(node *blockNode, block *provautil.Block,
 	//
 	// These utxo entries are needed for verification of things such as
 	// transaction inputs, counting pay-to-script-hashes, and scripts.
-	err = utxoView.fetchInputUtxos(b.db, block)
+	err = utxoView.fetchInputUtxos(b.db, b.utxoBatch, block)
 	if err != nil {
 		return err
 	}
@@ -1338,6 +1573,29 @@ func (b *BlockChain) checkConnectBlock(node *blockNode, block *provautil.Block,
 		}
 	}
 
+	// Get the previous block node.  This function is used over simply
+	// accessing node.parent directly as it will dynamically create previous
+	// block nodes as needed.  This helps allow only the pieces of the chain
+	// that are needed to remain in memory.
+	prevNode, err := b.getPrevNodeFromNode(node)
+	if err != nil {
+		log.Errorf("getPrevNodeFromNode: %v", err)
+		return err
+	}
+
+	// The relative lock-times of the inputs of all transactions in the
+	// block must be met once BIP0068 is active.  Their time based locks
+	// are compared against the past median time of the previous block.
+	enforceSequenceLocks := b.isDeploymentActive(chaincfg.DeploymentCSV,
+		node.height)
+	var medianTime time.Time
+	if enforceSequenceLocks {
+		medianTime, err = b.calcPastMedianTime(prevNode)
+		if err != nil {
+			return err
+		}
+	}
+
 	// Perform several checks on the inputs for each transaction.  Also
 	// accumulate the total fees.  This could technically be combined with
 	// the loop above instead of running another loop over the transactions,
@@ -1353,6 +1611,24 @@ func (b *BlockChain) checkConnectBlock(node *blockNode, block *provautil.Block,
 			return err
 		}
 
+		// The sequence locks must be checked before the transaction is
+		// connected since its inputs are needed.
+		if enforceSequenceLocks {
+			sequenceLock, err := b.calcSequenceLock(prevNode, tx,
+				utxoView, false)
+			if err != nil {
+				return err
+			}
+			if !SequenceLockActive(sequenceLock, int32(node.height),
+				medianTime) {
+
+				str := fmt.Sprintf("block contains transaction %v "+
+					"whose input sequence locks are not met",
+					tx.Hash())
+				return ruleError(ErrUnfinalizedTx, str)
+			}
+		}
+
 		// Sum the total fees and ensure we don't overflow the
 		// accumulator.
 		lastTotalFees := totalFees
@@ -1412,35 +1688,25 @@ func (b *BlockChain) checkConnectBlock(node *blockNode, block *provautil.Block,
 		runScripts = false
 	}
 
-	// Get the previous block node.  This function is used over simply
-	// accessing node.parent directly as it will dynamically create previous
-	// block nodes as needed.  This helps allow only the pieces of the chain
-	// that are needed to remain in memory.
-	prevNode, err := b.getPrevNodeFromNode(node)
-	if err != nil {
-		log.Errorf("getPrevNodeFromNode: %v", err)
-		return err
-	}
-
-	// Blocks created after the BIP0016 activation time need to have the
-	// pay-to-script-hash checks enabled.
-	var scriptFlags txscript.ScriptFlags
-	if enforceBIP0016 {
-		scriptFlags |= txscript.ScriptBip16
+	// Similarly, don't run scripts for the assumed valid block and its
+	// ancestors once it has been found on the header chain.
+	if runScripts && b.isAssumedValid(node) {
+		log.Debugf("Skipping script validation for block %v (height "+
+			"%d) assumed valid by block %v", node.hash, node.height,
+			b.assumeValid)
+		runScripts = false
+		if node.hash.IsEqual(b.assumeValid) {
+			log.Infof("Reached assumed valid block %v (height %d) "+
+				"-- validating scripts for all subsequent "+
+				"blocks", node.hash, node.height)
+		}
 	}
 
-	// Enforce DER signatures for block versions 3+ once the majority of the
-	// network has upgraded to the enforcement threshold.  This is part of
-	// BIP0066.
-	blockHeader := &block.MsgBlock().Header
-	if blockHeader.Version >= 3 && b.isMajorityVersion(3, prevNode,
-		b.chainParams.BlockEnforceNumRequired) {
-
-		scriptFlags |= txscript.ScriptVerifyDERSignatures
-	}
+	scriptFlags := b.blockScriptFlags(node, prevNode)
 
 	// Check that the validate key used to sign the block is represented in
 	// the current admin keyset state.
+	blockHeader := &block.MsgBlock().Header
 	validateKeySet := keyView.Keys()[btcec.ValidateKeySet]
 	pubKey, err := btcec.ParsePubKey(blockHeader.ValidatingPubKey[:], btcec.S256())
 	if err != nil {
@@ -1451,15 +1717,6 @@ func (b *BlockChain) checkConnectBlock(node *blockNode, block *provautil.Block,
 		return ruleError(ErrInvalidValidateKey, str)
 	}
 
-	// Enforce CHECKLOCKTIMEVERIFY for block versions 4+ once the majority
-	// of the network has upgraded to the enforcement threshold.  This is
-	// part of BIP0065.
-	if blockHeader.Version >= 4 && b.isMajorityVersion(4, prevNode,
-		b.chainParams.BlockEnforceNumRequired) {
-
-		scriptFlags |= txscript.ScriptVerifyCheckLockTimeVerify
-	}
-
 	// Check to see if there is a validate key rate limit breach.
 	isRateLimited, err := b.isValidateKeyRateLimited(node, blockHeader.ValidatingPubKey, false)
 	if err != nil {
@@ -1475,10 +1732,13 @@ func (b *BlockChain) checkConnectBlock(node *blockNode, block *provautil.Block,
 	// expensive ECDSA signature check scripts.  Doing this last helps
 	// prevent CPU exhaustion attacks.
 	if runScripts {
-		err := checkBlockScripts(block, utxoView, keyView, scriptFlags, b.sigCache, b.hashCache)
+		err := checkBlockScripts(block, utxoView, keyView, scriptFlags,
+			b.sigCache, b.hashCache, b.scriptWorkers)
 		if err != nil {
 			return err
 		}
+		b.logWithheldScriptFlags(node, prevNode, block, utxoView,
+			keyView, scriptFlags)
 	}
 
 	// Update the best hash for utxoView to include this block since all of its
@@ -1517,11 +1777,52 @@ func (b *BlockChain) CheckConnectBlock(block *provautil.Block) error {
 	// state of the chain. The block can only be connected if:
 	// - it is mined by an active validate key.
 	// - all keyIDs used for outputs are provisioned.
-	keyView := NewKeyViewpoint()
-	keyView.SetThreadTips(b.threadTips)
-	keyView.SetLastKeyID(b.lastKeyID)
-	keyView.SetTotalSupply(b.totalSupply)
-	keyView.SetKeys(b.adminKeySets)
-	keyView.SetKeyIDs(b.aspKeyIdMap)
+	keyView := b.tipKeyView()
+	return b.checkConnectBlock(newNode, block, utxoView, keyView, nil)
+}
+
+// CheckConnectBlockTemplate fully validates that connecting the passed block
+// to the main chain does not violate any consensus rules, aside from the
+// proof-of-work requirement.  The block must build on the current tip of the
+// main chain.  Unlike processing the block with the BFDryRun flag, the block is
+// never stored in the database, so it is suitable for checking block proposals
+// which have not been solved.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) CheckConnectBlockTemplate(block *provautil.Block) error {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	// Skip the proof of work check as this is just a block template.
+	flags := BFNoPoWCheck
+
+	// This only checks whether the block can be connected to the tip of
+	// the current chain.
+	tip := b.bestNode
+	header := &block.MsgBlock().Header
+	if !tip.hash.IsEqual(&header.PrevBlock) {
+		str := fmt.Sprintf("previous block must be the current chain tip "+
+			"%v, instead got %v", tip.hash, header.PrevBlock)
+		return ruleError(ErrPrevBlockNotBest, str)
+	}
+
+	err := checkBlockSanity(block, b.chainParams.PowLimit, b.timeSource,
+		flags)
+	if err != nil {
+		return err
+	}
+	if err := b.checkBlockContext(block, tip, flags); err != nil {
+		return err
+	}
+
+	newNode := newBlockNode(header, block.Hash())
+	newNode.parent = tip
+	newNode.workSum.Add(tip.workSum, newNode.workSum)
+
+	// Leave the spent txouts entry nil in the state since the information
+	// is not needed and thus extra work can be avoided.
+	utxoView := NewUtxoViewpoint()
+	utxoView.SetBestHash(tip.hash)
+	keyView := b.tipKeyView()
 	return b.checkConnectBlock(newNode, block, utxoView, keyView, nil)
 }
@@ -15,6 +15,7 @@ import (
 	"github.com/bitgo/prova/provautil"
 	"github.com/bitgo/prova/txscript"
 	"github.com/bitgo/prova/wire"
+	"math"
 	"testing"
 	"time"
 )
@@ -77,6 +78,281 @@ func TestSequenceLocksActive(t *testing.T) {
 	}
 }
 
+// TestLockTimeMedianTimeActivation ensures a block containing a transaction
+// whose lock time is before the block timestamp but not before the past median
+// time is only rejected once BIP0113 is active via the CSV deployment.
+func TestLockTimeMedianTimeActivation(t *testing.T) {
+	testCSVActivation(t, "locktimemediantimeactivation",
+		func(tx *wire.MsgTx, header *wire.BlockHeader) {
+			tx.LockTime = uint32(header.Timestamp.Unix()) - 1
+			tx.TxIn[0].Sequence = wire.MaxTxInSequenceNum - 1
+		})
+}
+
+// TestStrictEncodingActivation ensures the script flags of blocks only include
+// the strict encoding checks once the strict encoding deployment is active.
+func TestStrictEncodingActivation(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+	params.Deployments[chaincfg.DeploymentStrictEncoding].ActivationHeight = 10
+
+	tests := []struct {
+		height uint32
+		strict bool
+	}{
+		{0, false},
+		{9, false},
+		{10, true},
+		{11, true},
+	}
+	for _, test := range tests {
+		flags := blockchain.TstBlockScriptFlags(&params, test.height)
+		strict := flags&txscript.StrictEncodingVerifyFlags ==
+			txscript.StrictEncodingVerifyFlags
+		if strict != test.strict {
+			t.Errorf("height %d: strict encoding flags got %v, want %v",
+				test.height, strict, test.strict)
+		}
+		if !strict && flags&txscript.StrictEncodingVerifyFlags != 0 {
+			t.Errorf("height %d: unexpected partial strict encoding "+
+				"flags %v", test.height, flags)
+		}
+	}
+}
+
+// TestCheckSequenceVerifyActivation ensures the script flags of blocks only
+// enforce OP_CHECKSEQUENCEVERIFY once the CSV deployment is active.
+func TestCheckSequenceVerifyActivation(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+	params.Deployments[chaincfg.DeploymentCSV].ActivationHeight = 10
+
+	tests := []struct {
+		height uint32
+		csv    bool
+	}{
+		{0, false},
+		{9, false},
+		{10, true},
+		{11, true},
+	}
+	for _, test := range tests {
+		flags := blockchain.TstBlockScriptFlags(&params, test.height)
+		csv := flags&txscript.ScriptVerifyCheckSequenceVerify != 0
+		if csv != test.csv {
+			t.Errorf("height %d: check sequence verify flag got %v, "+
+				"want %v", test.height, csv, test.csv)
+		}
+	}
+}
+
+// TestCheckLockTimeVerifyActivation ensures the script flags of blocks only
+// enforce OP_CHECKLOCKTIMEVERIFY once the CLTV deployment is active, regardless
+// of the block version.
+func TestCheckLockTimeVerifyActivation(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+	params.Deployments[chaincfg.DeploymentCLTV].ActivationHeight = 10
+
+	tests := []struct {
+		height uint32
+		cltv   bool
+	}{
+		{0, false},
+		{9, false},
+		{10, true},
+		{11, true},
+	}
+	for _, test := range tests {
+		flags := blockchain.TstBlockScriptFlags(&params, test.height)
+		cltv := flags&txscript.ScriptVerifyCheckLockTimeVerify != 0
+		if cltv != test.cltv {
+			t.Errorf("height %d: check lock time verify flag got %v, "+
+				"want %v", test.height, cltv, test.cltv)
+		}
+	}
+}
+
+// TestTimeLockFlags ensures the time lock opcodes are only reported as enforced
+// for the block after the best block once their deployments are active, and
+// that time-locked outputs are only accepted once their locks are enforced.
+func TestTimeLockFlags(t *testing.T) {
+	cltv := txscript.ScriptVerifyCheckLockTimeVerify
+	csv := txscript.ScriptVerifyCheckSequenceVerify
+	tests := []struct {
+		name       string
+		cltvHeight uint32
+		csvHeight  uint32
+		want       txscript.ScriptFlags
+	}{
+		{"none active", 2, math.MaxUint32, 0},
+		{"cltv active", 1, math.MaxUint32, cltv},
+		{"csv active", math.MaxUint32, 1, csv},
+		{"both active", 0, 0, cltv | csv},
+	}
+
+	payAddr, err := provautil.NewAddressProva(make([]byte, 20),
+		[]btcec.KeyID{1, 2}, &chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("unable to create address: %v", err)
+	}
+	provaScript, err := txscript.PayToAddrScript(payAddr)
+	if err != nil {
+		t.Fatalf("unable to create script: %v", err)
+	}
+	lockScript := func(lockOp byte) []byte {
+		script, err := txscript.NewScriptBuilder().AddInt64(10).
+			AddOp(lockOp).AddOp(txscript.OP_DROP).AddOps(provaScript).
+			Script()
+		if err != nil {
+			t.Fatalf("unable to create time lock script: %v", err)
+		}
+		return script
+	}
+	outputs := map[txscript.ScriptFlags][]byte{
+		cltv: lockScript(txscript.OP_CHECKLOCKTIMEVERIFY),
+		csv:  lockScript(txscript.OP_CHECKSEQUENCEVERIFY),
+	}
+
+	for _, test := range tests {
+		params := chaincfg.RegressionNetParams
+		params.Deployments[chaincfg.DeploymentCLTV].ActivationHeight =
+			test.cltvHeight
+		params.Deployments[chaincfg.DeploymentCSV].ActivationHeight =
+			test.csvHeight
+		chain, teardownFunc, err := chainSetup("timelockflags", &params)
+		if err != nil {
+			t.Fatalf("%s: failed to setup chain instance: %v",
+				test.name, err)
+		}
+		got := chain.TimeLockFlags()
+		teardownFunc()
+		if got != test.want {
+			t.Errorf("%s: got flags %#x, want %#x", test.name, got,
+				test.want)
+		}
+
+		for flag, pkScript := range outputs {
+			tx := wire.NewMsgTx(wire.TxVersion)
+			tx.AddTxOut(wire.NewTxOut(1, pkScript))
+			err := blockchain.CheckTimeLockOutputs(provautil.NewTx(tx),
+				got)
+			if accepted := err == nil; accepted != (got&flag != 0) {
+				t.Errorf("%s: output locked by flag %#x: got "+
+					"error %v", test.name, flag, err)
+			}
+		}
+	}
+}
+
+// TestVerificationFlagsForBlock ensures the script flags of the consensus
+// deployments are enforced from their activation heights on, both on their own
+// and as part of the script flags of blocks.
+func TestVerificationFlagsForBlock(t *testing.T) {
+	params := chaincfg.RegressionNetParams
+	params.Deployments[chaincfg.DeploymentCSV].ActivationHeight = 10
+	params.Deployments[chaincfg.DeploymentStrictEncoding].ActivationHeight = 20
+	params.Deployments[chaincfg.DeploymentCLTV].ActivationHeight = 30
+
+	csv := txscript.ScriptVerifyCheckSequenceVerify
+	strict := txscript.StrictEncodingVerifyFlags
+	cltv := txscript.ScriptVerifyCheckLockTimeVerify
+	tests := []struct {
+		height uint32
+		want   txscript.ScriptFlags
+	}{
+		{0, 0},
+		{9, 0},
+		{10, csv},
+		{11, csv},
+		{19, csv},
+		{20, csv | strict},
+		{21, csv | strict},
+		{30, csv | strict | cltv},
+	}
+	for _, test := range tests {
+		got := blockchain.TstVerificationFlagsForBlock(&params, test.height)
+		if got != test.want {
+			t.Errorf("height %d: got flags %#x, want %#x",
+				test.height, got, test.want)
+		}
+		blockFlags := blockchain.TstBlockScriptFlags(&params, test.height)
+		if blockFlags&(csv|strict|cltv) != test.want {
+			t.Errorf("height %d: got block flags %#x, want "+
+				"deployment flags %#x", test.height, blockFlags,
+				test.want)
+		}
+	}
+
+	// Deployments which are not yet scheduled never enforce their flags.
+	params.Deployments[chaincfg.DeploymentCSV].ActivationHeight = math.MaxUint32
+	got := blockchain.TstVerificationFlagsForBlock(&params, math.MaxUint32-1)
+	if got != strict|cltv {
+		t.Errorf("unscheduled deployment: got flags %#x, want %#x", got,
+			strict|cltv)
+	}
+
+	// The flags for the block after the best block of a chain only include
+	// the deployments which are active for it.
+	params.Deployments[chaincfg.DeploymentCSV].ActivationHeight = 1
+	params.Deployments[chaincfg.DeploymentStrictEncoding].ActivationHeight = 2
+	params.Deployments[chaincfg.DeploymentCLTV].ActivationHeight = 1
+	chain, teardownFunc, err := chainSetup("verificationflags", &params)
+	if err != nil {
+		t.Fatalf("failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+	if got := chain.NextBlockVerificationFlags(); got != csv|cltv {
+		t.Errorf("next block: got flags %#x, want %#x", got, csv|cltv)
+	}
+}
+
+// TestLockTimeEvalTime ensures lock times are evaluated against the timestamp
+// of the next block, which can not be before the past median time, until the
+// CSV deployment activates BIP0113 and against the past median time afterwards.
+func TestLockTimeEvalTime(t *testing.T) {
+	tests := []struct {
+		name             string
+		activationHeight uint32
+		blockTime        func(mtp time.Time) time.Time
+		want             func(mtp time.Time) time.Time
+	}{
+		{
+			name:             "inactive after median time",
+			activationHeight: math.MaxUint32,
+			blockTime:        func(mtp time.Time) time.Time { return mtp.Add(time.Hour) },
+			want:             func(mtp time.Time) time.Time { return mtp.Add(time.Hour) },
+		},
+		{
+			name:             "inactive before median time",
+			activationHeight: math.MaxUint32,
+			blockTime:        func(mtp time.Time) time.Time { return mtp.Add(-time.Hour) },
+			want:             func(mtp time.Time) time.Time { return mtp.Add(time.Second) },
+		},
+		{
+			name:             "active",
+			activationHeight: 1,
+			blockTime:        func(mtp time.Time) time.Time { return mtp.Add(time.Hour) },
+			want:             func(mtp time.Time) time.Time { return mtp },
+		},
+	}
+
+	for _, test := range tests {
+		params := chaincfg.RegressionNetParams
+		params.Deployments[chaincfg.DeploymentCSV].ActivationHeight =
+			test.activationHeight
+		chain, teardownFunc, err := chainSetup("locktimeevaltime", &params)
+		if err != nil {
+			t.Fatalf("%s: failed to setup chain instance: %v",
+				test.name, err)
+		}
+		mtp := chain.BestSnapshot().MedianTime
+		got := chain.LockTimeEvalTime(test.blockTime(mtp))
+		teardownFunc()
+		if want := test.want(mtp); !got.Equal(want) {
+			t.Errorf("%s: got evaluation time %v, want %v", test.name,
+				got, want)
+		}
+	}
+}
+
 // TestCheckConnectBlock tests the CheckConnectBlock function to ensure it
 // fails.
 func TestCheckConnectBlock(t *testing.T) {
@@ -97,6 +373,25 @@ func TestCheckConnectBlock(t *testing.T) {
 	}
 }
 
+// TestCheckConnectBlockTemplate ensures block templates which do not build on
+// the current tip of the main chain are rejected.
+func TestCheckConnectBlockTemplate(t *testing.T) {
+	chain, teardownFunc, err := chainSetup("checkconnectblocktemplate",
+		&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownFunc()
+
+	genesisBlock := chaincfg.MainNetParams.GenesisBlock
+	err = chain.CheckConnectBlockTemplate(provautil.NewBlock(genesisBlock))
+	rerr, ok := err.(blockchain.RuleError)
+	if !ok || rerr.ErrorCode != blockchain.ErrPrevBlockNotBest {
+		t.Errorf("CheckConnectBlockTemplate: wrong error - got %v, want "+
+			"%v", err, blockchain.ErrPrevBlockNotBest)
+	}
+}
+
 // TestCheckBlockSanity tests the CheckBlockSanity function to ensure it works
 // as expected.
 func TestCheckBlockSanity(t *testing.T) {
@@ -527,6 +822,14 @@ func TestCheckTransactionOutputs(t *testing.T) {
 		Value:    0,
 		PkScript: adminOpAsp2PkScript,
 	}
+	// Create admin op to add the first reserved key ID.
+	(btcec.MaxKeyID + 1).ToAddressFormat(data[1+btcec.PubKeyBytesLenCompressed:])
+	reservedOpAspPkScript, _ := txscript.NewScriptBuilder().AddOp(txscript.OP_RETURN).
+		AddData(data).Script()
+	reservedOpAspTxOut := wire.TxOut{
+		Value:    0,
+		PkScript: reservedOpAspPkScript,
+	}
 	// dummy asp script
 	data = make([]byte, 1+btcec.PubKeyBytesLenCompressed+btcec.KeyIDSize)
 	data[0] = txscript.AdminOpASPKeyAdd
@@ -731,6 +1034,18 @@ func TestCheckTransactionOutputs(t *testing.T) {
 			isValid:   false,
 			code:      blockchain.ErrInvalidTx,
 		},
+		{
+			name: "provision reserved keyID.",
+			tx: wire.MsgTx{
+				Version:  1,
+				TxIn:     []*wire.TxIn{&dummyTxIn},
+				TxOut:    []*wire.TxOut{&rootTxOut, &reservedOpAspTxOut},
+				LockTime: 0,
+			},
+			lastKeyID: btcec.MaxKeyID,
+			isValid:   false,
+			code:      blockchain.ErrInvalidAdminOp,
+		},
 		{
 			name: "provision keyID 2 times in same tx.",
 			tx: wire.MsgTx{
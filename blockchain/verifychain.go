@@ -0,0 +1,288 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/provautil"
+)
+
+const (
+	// MaxVerifyChainLevel is the most thorough level of checks performed
+	// by VerifyChain.  Higher levels are clamped to it.
+	MaxVerifyChainLevel = 4
+
+	// verifyChainLogInterval is the minimum amount of time between the
+	// progress messages logged by VerifyChain.
+	verifyChainLogInterval = 10 * time.Second
+)
+
+// verifyChainError returns a database corruption error for a failed chain
+// verification check of the block at the passed height.
+func verifyChainError(height uint32, format string, args ...interface{}) error {
+	return database.Error{
+		ErrorCode: database.ErrCorruption,
+		Description: fmt.Sprintf("verify chain failed at height %d: %s",
+			height, fmt.Sprintf(format, args...)),
+	}
+}
+
+// VerifyChain audits the integrity of the most recent depth blocks of the main
+// chain and the chain state derived from them.  The checks are cumulative and
+// the level selects how thorough they are:
+//
+//   - Level 0 loads each block from the database.
+//   - Level 1 performs the context-free sanity checks on each block and
+//     ensures the blocks link to each other at the expected heights.
+//   - Level 2 loads the spend journal entry of each block and uses it to
+//     disconnect the blocks from a throwaway utxo view.
+//   - Level 3 reconnects the blocks to the throwaway view while checking the
+//     transaction inputs and outputs, and ensures the resulting view and
+//     admin state match the current chain state.
+//   - Level 4 additionally runs the transaction scripts of each block while
+//     reconnecting them.
+//
+// A depth of zero or one that exceeds the height of the best block checks the
+// entire chain except the genesis block.  The chain lock is held while
+// verifying, so processing blocks is paused until it is finished and the
+// verification works against a consistent view of the chain.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) VerifyChain(level, depth int) error {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	if level < 0 {
+		level = 0
+	}
+	if level > MaxVerifyChainLevel {
+		level = MaxVerifyChainLevel
+	}
+	bestNode := b.bestNode
+	numBlocks := bestNode.height
+	if depth > 0 && uint32(depth) < numBlocks {
+		numBlocks = uint32(depth)
+	}
+	log.Infof("Verifying %d blocks of the chain at level %d", numBlocks,
+		level)
+
+	// Walk the main chain backwards from the best block.  The blocks are
+	// kept when they need to be reconnected later.
+	utxoView := NewUtxoViewpoint()
+	utxoView.SetBestHash(bestNode.hash)
+	keyView := b.tipKeyView()
+	var blocks []*provautil.Block
+	if level >= 3 {
+		blocks = make([]*provautil.Block, 0, numBlocks)
+	}
+	txSet := make(map[chainhash.Hash]struct{})
+	expectedHash := bestNode.hash
+	lastLog := time.Now()
+	for i := uint32(0); i < numBlocks; i++ {
+		height := bestNode.height - i
+
+		// Level 0 just loads the block.
+		var block *provautil.Block
+		err := b.db.View(func(dbTx database.Tx) error {
+			var err error
+			block, err = dbFetchBlockByHeight(dbTx, height)
+			return err
+		})
+		if err != nil {
+			return verifyChainError(height, "unable to load block: %v",
+				err)
+		}
+
+		// Level 1 performs the context-free sanity checks and ensures
+		// the block is the one referenced by its successor.
+		if level >= 1 {
+			if block.MsgBlock().Header.Height != height {
+				return verifyChainError(height, "block %v has "+
+					"height %d", block.Hash(),
+					block.MsgBlock().Header.Height)
+			}
+			if !block.Hash().IsEqual(expectedHash) {
+				return verifyChainError(height, "block %v does "+
+					"not match the expected block %v",
+					block.Hash(), expectedHash)
+			}
+			err := CheckBlockSanity(block, b.chainParams.PowLimit,
+				b.timeSource)
+			if err != nil {
+				return verifyChainError(height, "block %v "+
+					"failed sanity checks: %v",
+					block.Hash(), err)
+			}
+			expectedHash = &block.MsgBlock().Header.PrevBlock
+		}
+
+		// Level 2 disconnects the block from the throwaway view using
+		// its spend journal entry.
+		if level >= 2 {
+			err := utxoView.fetchInputUtxos(b.db, b.utxoBatch, block)
+			if err != nil {
+				return err
+			}
+			var stxos []spentTxOut
+			err = b.db.View(func(dbTx database.Tx) error {
+				var err error
+				stxos, err = dbFetchSpendJournalEntry(dbTx,
+					block, utxoView)
+				return err
+			})
+			if err != nil {
+				return verifyChainError(height, "unable to load "+
+					"spend journal entry for block %v: %v",
+					block.Hash(), err)
+			}
+			err = utxoView.disconnectTransactions(block, stxos)
+			if err != nil {
+				return verifyChainError(height, "unable to "+
+					"disconnect block %v: %v", block.Hash(),
+					err)
+			}
+			err = keyView.disconnectTransactions(block)
+			if err != nil {
+				return verifyChainError(height, "unable to "+
+					"disconnect admin state for block %v: %v",
+					block.Hash(), err)
+			}
+			for _, tx := range block.Transactions() {
+				txSet[*tx.Hash()] = struct{}{}
+			}
+		}
+
+		if level >= 3 {
+			blocks = append(blocks, block)
+		}
+
+		if time.Since(lastLog) >= verifyChainLogInterval {
+			log.Infof("Verified %d of %d blocks (height %d)", i+1,
+				numBlocks, height)
+			lastLog = time.Now()
+		}
+	}
+
+	// Level 3 reconnects the blocks in order to the throwaway view and
+	// level 4 runs their scripts along the way.
+	if level >= 3 {
+		node := bestNode
+		nodes := make([]*blockNode, len(blocks)+1)
+		for i := range nodes {
+			nodes[i] = node
+			if i == len(blocks) {
+				break
+			}
+			var err error
+			node, err = b.getPrevNodeFromNode(node)
+			if err != nil {
+				return err
+			}
+		}
+		for i := len(blocks) - 1; i >= 0; i-- {
+			block := blocks[i]
+			height := block.Height()
+			var stxos []spentTxOut
+			for _, tx := range block.Transactions() {
+				_, err := CheckTransactionInputs(tx, height,
+					utxoView, b.chainParams)
+				if err != nil {
+					return verifyChainError(height, "block "+
+						"%v has invalid inputs: %v",
+						block.Hash(), err)
+				}
+				err = CheckTransactionOutputs(tx, keyView,
+					b.chainParams)
+				if err != nil {
+					return verifyChainError(height, "block "+
+						"%v has invalid outputs: %v",
+						block.Hash(), err)
+				}
+				err = utxoView.connectTransaction(tx, height, &stxos)
+				if err != nil {
+					return verifyChainError(height, "unable "+
+						"to reconnect block %v: %v",
+						block.Hash(), err)
+				}
+				keyView.connectTransaction(tx, height)
+			}
+			if level >= 4 {
+				scriptFlags := b.blockScriptFlags(nodes[i],
+					nodes[i+1])
+				err := checkBlockScripts(block, utxoView, keyView,
+					scriptFlags, nil, nil, b.scriptWorkers)
+				if err != nil {
+					return verifyChainError(height, "block "+
+						"%v has invalid scripts: %v",
+						block.Hash(), err)
+				}
+			}
+			utxoView.SetBestHash(block.Hash())
+		}
+
+		if err := b.verifyReconnectedState(utxoView, keyView, txSet); err != nil {
+			return verifyChainError(bestNode.height, "%v", err)
+		}
+	}
+
+	log.Infof("Chain verification of %d blocks at level %d completed "+
+		"successfully", numBlocks, level)
+	return nil
+}
+
+// verifyReconnectedState ensures the passed views, which were obtained by
+// disconnecting and reconnecting recent blocks of the main chain, match the
+// current chain state for the transactions in the passed set and their
+// outputs.
+//
+// This function MUST be called with the chain lock held (for reads).
+func (b *BlockChain) verifyReconnectedState(utxoView *UtxoViewpoint, keyView *KeyViewpoint, txSet map[chainhash.Hash]struct{}) error {
+	dbView := NewUtxoViewpoint()
+	if err := dbView.fetchUtxosMain(b.db, b.utxoBatch, txSet); err != nil {
+		return err
+	}
+	for txHash := range txSet {
+		entry := utxoView.LookupEntry(&txHash)
+		dbEntry := dbView.LookupEntry(&txHash)
+		if entry == nil || entry.IsFullySpent() {
+			if dbEntry != nil && !dbEntry.IsFullySpent() {
+				return fmt.Errorf("utxo set contains outputs "+
+					"of %v which are spent by the blocks",
+					txHash)
+			}
+			continue
+		}
+		if dbEntry == nil {
+			return fmt.Errorf("utxo set is missing outputs of %v",
+				txHash)
+		}
+		for idx := range entry.sparseOutputs {
+			if entry.IsOutputSpent(idx) != dbEntry.IsOutputSpent(idx) ||
+				entry.AmountByIndex(idx) != dbEntry.AmountByIndex(idx) ||
+				!bytes.Equal(entry.PkScriptByIndex(idx),
+					dbEntry.PkScriptByIndex(idx)) {
+
+				return fmt.Errorf("utxo set output %v:%d does "+
+					"not match the blocks", txHash, idx)
+			}
+		}
+	}
+
+	if keyView.TotalSupply() != b.totalSupply {
+		return fmt.Errorf("total supply of %d does not match the "+
+			"blocks which result in %d", b.totalSupply,
+			keyView.TotalSupply())
+	}
+	if !reflect.DeepEqual(keyView.ThreadTips(), b.threadTips) {
+		return fmt.Errorf("admin thread tips do not match the blocks")
+	}
+	return nil
+}
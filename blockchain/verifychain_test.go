@@ -0,0 +1,134 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain_test
+
+import (
+	"testing"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+)
+
+// TestVerifyChain ensures VerifyChain accepts an intact chain at every level
+// and that each kind of corruption of the chain state is detected by the level
+// which is expected to detect it and all higher levels, but not by the lower
+// ones.
+func TestVerifyChain(t *testing.T) {
+	// Use the blocks up to the last one which spends outputs, so the best
+	// block has a spend journal entry which can be corrupted.
+	blocks := linearTestBlocks(t)
+	for len(blocks) > 0 && len(blocks[len(blocks)-1].Transactions) < 2 {
+		blocks = blocks[:len(blocks)-1]
+	}
+	if len(blocks) < 2 {
+		t.Fatalf("not enough test blocks - got %d", len(blocks))
+	}
+	bestHeight := uint32(len(blocks))
+	genesisHash := chaincfg.RegressionNetParams.GenesisBlock.BlockHash()
+	bestTxns := blocks[len(blocks)-1].Transactions
+	lastTxHash := bestTxns[len(bestTxns)-1].TxHash()
+
+	tests := []struct {
+		name        string
+		corrupt     func(chain *blockchain.BlockChain) error
+		depth       int
+		detectLevel int
+	}{
+		{
+			name: "intact chain",
+			corrupt: func(chain *blockchain.BlockChain) error {
+				return nil
+			},
+			depth:       10,
+			detectLevel: blockchain.MaxVerifyChainLevel + 1,
+		},
+		{
+			name: "missing block",
+			corrupt: func(chain *blockchain.BlockChain) error {
+				return chain.TstSetMainChainHash(bestHeight-1,
+					&chainhash.Hash{0x01})
+			},
+			depth:       10,
+			detectLevel: 0,
+		},
+		{
+			name: "wrong block at height",
+			corrupt: func(chain *blockchain.BlockChain) error {
+				return chain.TstSetMainChainHash(bestHeight-1,
+					&genesisHash)
+			},
+			depth:       10,
+			detectLevel: 1,
+		},
+		{
+			name: "truncated spend journal",
+			corrupt: func(chain *blockchain.BlockChain) error {
+				return chain.TstTruncateSpendJournal()
+			},
+			depth:       10,
+			detectLevel: 2,
+		},
+		{
+			name: "missing utxo",
+			corrupt: func(chain *blockchain.BlockChain) error {
+				return chain.TstRemoveUtxoEntry(&lastTxHash)
+			},
+			depth:       10,
+			detectLevel: 3,
+		},
+		{
+			// The spent output must be created before the verified
+			// blocks, otherwise reconnecting them recreates it.
+			name: "spent amount not signed",
+			corrupt: func(chain *blockchain.BlockChain) error {
+				return chain.TstModifySpentAmount(func(amount int64) int64 {
+					return amount + 1
+				})
+			},
+			depth:       1,
+			detectLevel: 4,
+		},
+	}
+
+	for _, test := range tests {
+		chain, teardownFunc, err := chainSetup("verifychain",
+			&chaincfg.RegressionNetParams)
+		if err != nil {
+			t.Fatalf("%s: failed to setup chain instance: %v",
+				test.name, err)
+		}
+		processTestBlocks(t, test.name, chain, blocks)
+		if err := test.corrupt(chain); err != nil {
+			teardownFunc()
+			t.Fatalf("%s: failed to corrupt chain: %v", test.name, err)
+		}
+
+		for level := 0; level <= blockchain.MaxVerifyChainLevel; level++ {
+			err := chain.VerifyChain(level, test.depth)
+			if level < test.detectLevel && err != nil {
+				teardownFunc()
+				t.Fatalf("%s: unexpected error at level %d: %v",
+					test.name, level, err)
+			}
+			if level >= test.detectLevel && err == nil {
+				teardownFunc()
+				t.Fatalf("%s: corruption not detected at level %d",
+					test.name, level)
+			}
+		}
+
+		// Ensure the intact chain also verifies in its entirety.
+		if test.detectLevel > blockchain.MaxVerifyChainLevel {
+			err := chain.VerifyChain(blockchain.MaxVerifyChainLevel, 0)
+			if err != nil {
+				teardownFunc()
+				t.Fatalf("%s: unexpected error verifying the entire "+
+					"chain: %v", test.name, err)
+			}
+		}
+		teardownFunc()
+	}
+}
@@ -7,12 +7,14 @@ package main
 
 import (
 	"container/list"
+	"fmt"
 	"net"
 	"os"
 	"path/filepath"
 	"sort"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/bitgo/prova/blockchain"
 	"github.com/bitgo/prova/chaincfg"
@@ -57,6 +59,20 @@ type blockMsg struct {
 	peer  *serverPeer
 }
 
+// cmpctBlockMsg packages a bitcoin cmpctblock message and the peer it came
+// from together so the block handler has access to that information.
+type cmpctBlockMsg struct {
+	cmpctBlock *wire.MsgCmpctBlock
+	peer       *serverPeer
+}
+
+// blockTxnMsg packages a bitcoin blocktxn message and the peer it came from
+// together so the block handler has access to that information.
+type blockTxnMsg struct {
+	blockTxn *wire.MsgBlockTxn
+	peer     *serverPeer
+}
+
 // invMsg packages a bitcoin inv message and the peer it came from together
 // so the block handler has access to that information.
 type invMsg struct {
@@ -64,6 +80,13 @@ type invMsg struct {
 	peer *serverPeer
 }
 
+// headersMsg packages a bitcoin headers message and the peer it came from
+// together so the block handler has access to that information.
+type headersMsg struct {
+	headers *wire.MsgHeaders
+	peer    *serverPeer
+}
+
 // donePeerMsg signifies a newly disconnected peer to the block handler.
 type donePeerMsg struct {
 	peer *serverPeer
@@ -130,13 +153,42 @@ type blockManager struct {
 	msgChan         chan interface{}
 	wg              sync.WaitGroup
 	quit            chan struct{}
+
+	// assumeValidFound indicates whether the assumed valid block has been
+	// found on the header chain of a sync peer.
+	assumeValidFound bool
+
+	// assumeValidRequested indicates whether headers leading to the
+	// assumed valid block were requested from the sync peer, so the next
+	// headers message from it is the response rather than an announcement.
+	assumeValidRequested bool
+
+	// reassignedBlocks houses the blocks which were requested from the
+	// new sync peer after the previous sync peer stalled, so the copy of
+	// them which arrives last is discarded.
+	reassignedBlocks map[chainhash.Hash]struct{}
+
+	// stallTimeout is the duration after which the sync peer is
+	// considered stalled.
+	stallTimeout time.Duration
+
+	// reorgBlocks houses the blocks disconnected by the reorganization in
+	// progress, from the old tip back to the fork point, and reorgMined
+	// the transactions of the blocks it connected so far.  The
+	// transactions of the disconnected blocks which the new chain did not
+	// mine are added back to the memory pool once the reorganization
+	// completes.  They are only accessed from the block chain
+	// notifications, which are sent by the block handler.
+	reorgBlocks []*provautil.Block
+	reorgMined  map[chainhash.Hash]struct{}
 }
 
 // startSync will choose the best peer among the available candidate peers to
 // download/sync the blockchain from.  When syncing is already running, it
 // simply returns.  It also examines the candidates for any which are no longer
-// candidates and removes them as needed.
-func (b *blockManager) startSync(peers *list.List) {
+// candidates and removes them as needed.  The passed excluded peer, if any, is
+// not chosen.
+func (b *blockManager) startSync(peers *list.List, excluded *serverPeer) {
 	// Return now if we're already syncing.
 	if b.syncPeer != nil {
 		return
@@ -159,10 +211,15 @@ func (b *blockManager) startSync(peers *list.List) {
 			peers.Remove(e)
 			continue
 		}
+		if sp == excluded {
+			continue
+		}
 
-		// TODO(davec): Use a better algorithm to choose the best peer.
-		// For now, just pick the first available candidate.
-		bestPeer = sp
+		// Prefer the peers which did not stall and deliver blocks the
+		// fastest.
+		if betterSyncPeer(sp, bestPeer) {
+			bestPeer = sp
+		}
 	}
 
 	// Start syncing from the best peer if one was selected.
@@ -183,11 +240,32 @@ func (b *blockManager) startSync(peers *list.List) {
 			bestPeer.LastBlock(), bestPeer.Addr())
 		bestPeer.PushGetBlocksMsg(locator, &zeroHash)
 		b.syncPeer = bestPeer
+
+		// Request the headers which lead to the assumed valid block,
+		// if any, so script validation can be skipped for the blocks
+		// before it.
+		b.requestAssumeValidHeaders(bestPeer, locator)
 	} else {
 		bmgrLog.Warnf("No sync peer candidates available")
 	}
 }
 
+// requestAssumeValidHeaders requests the headers which lead from the passed
+// locator to the assumed valid block from the passed peer.  Nothing is
+// requested when there is no assumed valid block or it has already been found
+// on the header chain.
+func (b *blockManager) requestAssumeValidHeaders(sp *serverPeer, locator blockchain.BlockLocator) {
+	assumeValid := b.chain.AssumeValid()
+	if assumeValid == nil || b.assumeValidFound {
+		return
+	}
+
+	bmgrLog.Debugf("Requesting headers to assumed valid block %v from "+
+		"peer %v", assumeValid, sp.Addr())
+	sp.PushGetHeadersMsg(locator, assumeValid)
+	b.assumeValidRequested = true
+}
+
 // isSyncCandidate returns whether or not the peer is a candidate to consider
 // syncing from.
 func (b *blockManager) isSyncCandidate(sp *serverPeer) bool {
@@ -236,7 +314,7 @@ func (b *blockManager) handleNewPeerMsg(peers *list.List, sp *serverPeer) {
 	peers.PushBack(sp)
 
 	// Start syncing by choosing the best candidate if needed.
-	b.startSync(peers)
+	b.startSync(peers, nil)
 }
 
 // handleDonePeerMsg deals with peers that have signalled they are done.  It
@@ -272,7 +350,8 @@ func (b *blockManager) handleDonePeerMsg(peers *list.List, sp *serverPeer) {
 	// sync peer.
 	if b.syncPeer != nil && b.syncPeer == sp {
 		b.syncPeer = nil
-		b.startSync(peers)
+		b.assumeValidRequested = false
+		b.startSync(peers, nil)
 	}
 }
 
@@ -290,18 +369,23 @@ func (b *blockManager) handleTxMsg(tmsg *txMsg) {
 
 	// Ignore transactions that we have already rejected.  Do not
 	// send a reject message here because if the transaction was already
-	// rejected, the transaction was unsolicited.
-	if _, exists := b.rejectedTxns[*txHash]; exists {
+	// rejected, the transaction was unsolicited.  Peers with relay policy
+	// exemptions are the exception, since the transaction may have been
+	// rejected by the policy they are exempt from.
+	_, rejected := b.rejectedTxns[*txHash]
+	if rejected && tmsg.peer.exemptions == 0 {
 		bmgrLog.Debugf("Ignoring unsolicited previously rejected "+
 			"transaction %v from %s", txHash, tmsg.peer)
 		return
 	}
 
 	// Process the transaction to include validation, insertion in the
-	// memory pool, orphan handling, etc.
+	// memory pool, orphan handling, etc.  The relay policy checks the peer
+	// is exempt from are skipped.
 	allowOrphans := cfg.MaxOrphanTxs > 0
 	acceptedTxs, err := b.server.txMemPool.ProcessTransaction(tmsg.tx,
-		allowOrphans, true, mempool.Tag(tmsg.peer.ID()))
+		allowOrphans, true, mempool.Tag(tmsg.peer.ID()),
+		tmsg.peer.exemptions)
 
 	// Remove transaction from request maps. Either the mempool/chain
 	// already knows about it and as such we shouldn't have any more
@@ -336,6 +420,11 @@ func (b *blockManager) handleTxMsg(tmsg *txMsg) {
 		return
 	}
 
+	// Remember when the peer last relayed a new transaction.
+	if len(acceptedTxs) > 0 {
+		atomic.StoreInt64(&tmsg.peer.lastTxTime, time.Now().Unix())
+	}
+
 	b.server.AnnounceNewTransactions(acceptedTxs)
 }
 
@@ -360,11 +449,31 @@ func (b *blockManager) current() bool {
 	return true
 }
 
+// isInvalidBlockErr returns whether the passed rule error proves the rejected
+// block violates the consensus rules.  Blocks are also rejected when they are
+// already known, are too far in the future for the local clock, belong to a
+// side chain which would require a reorganization deeper than allowed, or
+// extend a branch which may have been invalidated manually, none of which
+// means the peer which sent them misbehaved.
+func isInvalidBlockErr(ruleErr blockchain.RuleError) bool {
+	switch ruleErr.ErrorCode {
+	case blockchain.ErrDuplicateBlock, blockchain.ErrTimeTooNew,
+		blockchain.ErrReorgTooDeep, blockchain.ErrPrevBlockNotBest,
+		blockchain.ErrInvalidAncestorBlock:
+		return false
+	}
+	return true
+}
+
 // handleBlockMsg handles block messages from all peers.
 func (b *blockManager) handleBlockMsg(bmsg *blockMsg) {
-	// If we didn't ask for this block then the peer is misbehaving.
+	// If we didn't ask for this block then the peer is misbehaving.  Blocks
+	// which were requested from the peer before it stalled as the sync peer
+	// may still arrive late.
 	blockHash := bmsg.block.Hash()
-	if _, exists := bmsg.peer.requestedBlocks[*blockHash]; !exists {
+	_, requested := bmsg.peer.requestedBlocks[*blockHash]
+	_, stalled := bmsg.peer.stalledBlocks[*blockHash]
+	if !requested && !stalled {
 		// The regression test intentionally sends some blocks twice
 		// to test duplicate block insertion fails.  Don't disconnect
 		// the peer or ignore the block when we're in regression test
@@ -383,9 +492,27 @@ func (b *blockManager) handleBlockMsg(bmsg *blockMsg) {
 	// Remove block from request maps. Either chain will know about it and
 	// so we shouldn't have any more instances of trying to fetch it, or we
 	// will fail the insert and thus we'll retry next time we get an inv.
+	if requested {
+		bmsg.peer.throughput.update(bmsg.block.MsgBlock().SerializeSize(),
+			time.Now())
+	}
 	delete(bmsg.peer.requestedBlocks, *blockHash)
+	delete(bmsg.peer.stalledBlocks, *blockHash)
 	delete(b.requestedBlocks, *blockHash)
 
+	// A block which was requested from both the stalled sync peer and the
+	// new one is discarded without penalizing the peer when the other copy
+	// arrived first.
+	if _, exists := b.reassignedBlocks[*blockHash]; exists {
+		haveBlock, err := b.chain.HaveBlock(blockHash)
+		if err == nil && haveBlock {
+			bmgrLog.Debugf("Discarding late copy of block %v from %s",
+				blockHash, bmsg.peer)
+			delete(b.reassignedBlocks, *blockHash)
+			return
+		}
+	}
+
 	// Process the block to include validation, best chain selection, orphan
 	// handling, etc.
 	_, isOrphan, err := b.chain.ProcessBlock(bmsg.block, behaviorFlags)
@@ -394,9 +521,19 @@ func (b *blockManager) handleBlockMsg(bmsg *blockMsg) {
 		// rejected as opposed to something actually going wrong, so log
 		// it as such.  Otherwise, something really did go wrong, so log
 		// it as an actual error.
-		if _, ok := err.(blockchain.RuleError); ok {
+		if ruleErr, ok := err.(blockchain.RuleError); ok {
 			bmgrLog.Infof("Rejected block %v from %s: %v", blockHash,
 				bmsg.peer, err)
+
+			// Penalize the peer for sending a block which violates
+			// the consensus rules.  The regression test
+			// intentionally sends invalid blocks.
+			if isInvalidBlockErr(ruleErr) && !cfg.RegressionTest {
+
+				bmsg.peer.addBanScore(banScore(offenseInvalidBlock),
+					0, fmt.Sprintf("invalid block %v: %v",
+						blockHash, err))
+			}
 		} else {
 			bmgrLog.Errorf("Failed to process block %v: %v",
 				blockHash, err)
@@ -414,6 +551,12 @@ func (b *blockManager) handleBlockMsg(bmsg *blockMsg) {
 		return
 	}
 
+	// Remember when the peer last relayed a new block, which protects it
+	// from inbound eviction.
+	if !isOrphan {
+		atomic.StoreInt64(&bmsg.peer.lastBlockTime, time.Now().Unix())
+	}
+
 	// Meta-data about the new block this peer is reporting. We use this
 	// below to update this peer's lastest block height and the heights of
 	// other peers based on their last announced block hash. This allows us
@@ -480,6 +623,99 @@ func (b *blockManager) handleBlockMsg(bmsg *blockMsg) {
 	}
 }
 
+// requestFullBlock requests the passed block from the peer as a full block.
+// It is used when a compact block of it can not be reconstructed.  The block
+// remains requested from the peer, so the full block is accepted.
+func (b *blockManager) requestFullBlock(sp *serverPeer, hash *chainhash.Hash) {
+	sp.partialBlock = nil
+	gdmsg := wire.NewMsgGetData()
+	gdmsg.AddInvVect(wire.NewInvVect(wire.InvTypeBlock, hash))
+	sp.QueueMessage(gdmsg, nil)
+}
+
+// processPartialBlock processes the block reconstructed from a compact block
+// once no transactions are missing.  The full block is requested instead when
+// the reconstructed block does not match its header.
+func (b *blockManager) processPartialBlock(sp *serverPeer, pb *partialBlock) {
+	block, err := pb.block()
+	if err != nil {
+		bmgrLog.Debugf("Requesting full block %v from %s: %v", pb.hash,
+			sp, err)
+		b.requestFullBlock(sp, &pb.hash)
+		return
+	}
+	b.handleBlockMsg(&blockMsg{block: block, peer: sp})
+}
+
+// handleCmpctBlockMsg handles cmpctblock messages from all peers.  The block
+// is reconstructed from the transactions of the memory pool and processed the
+// same way as full blocks.  Transactions which are not in the memory pool are
+// requested with a getblocktxn message, and the full block is requested when
+// short IDs collide.
+func (b *blockManager) handleCmpctBlockMsg(cmsg *cmpctBlockMsg) {
+	// Only compact blocks which were requested are accepted since
+	// compact blocks are not requested in high-bandwidth mode.
+	sp := cmsg.peer
+	blockHash := cmsg.cmpctBlock.Header.BlockHash()
+	if _, exists := sp.requestedBlocks[blockHash]; !exists {
+		bmgrLog.Warnf("Got unrequested compact block %v from %s -- "+
+			"disconnecting", blockHash, sp.Addr())
+		sp.Disconnect()
+		return
+	}
+
+	txDescs := b.server.txMemPool.TxDescs()
+	txns := make([]*provautil.Tx, 0, len(txDescs))
+	for _, txD := range txDescs {
+		txns = append(txns, txD.Tx)
+	}
+	pb, err := newPartialBlock(cmsg.cmpctBlock, txns)
+	if err == errShortIDCollision {
+		bmgrLog.Debugf("Requesting full block %v from %s: %v",
+			blockHash, sp, err)
+		b.requestFullBlock(sp, &blockHash)
+		return
+	}
+	if err != nil {
+		bmgrLog.Warnf("Invalid compact block %v from %s: %v -- "+
+			"disconnecting", blockHash, sp.Addr(), err)
+		sp.Disconnect()
+		return
+	}
+
+	if len(pb.missing) != 0 {
+		bmgrLog.Debugf("Requesting %d missing transactions of compact "+
+			"block %v from %s", len(pb.missing), blockHash, sp)
+		sp.partialBlock = pb
+		sp.QueueMessage(pb.getBlockTxn(), nil)
+		return
+	}
+	b.processPartialBlock(sp, pb)
+}
+
+// handleBlockTxnMsg handles blocktxn messages from all peers.  The
+// transactions complete the partial block previously reconstructed from a
+// compact block sent by the same peer, which is then processed.
+func (b *blockManager) handleBlockTxnMsg(bmsg *blockTxnMsg) {
+	sp := bmsg.peer
+	pb := sp.partialBlock
+	if pb == nil || !pb.hash.IsEqual(&bmsg.blockTxn.BlockHash) {
+		bmgrLog.Warnf("Got unrequested block transactions for %v from "+
+			"%s -- disconnecting", bmsg.blockTxn.BlockHash, sp.Addr())
+		sp.Disconnect()
+		return
+	}
+	sp.partialBlock = nil
+
+	if err := pb.fillMissing(bmsg.blockTxn); err != nil {
+		bmgrLog.Debugf("Requesting full block %v from %s: %v", pb.hash,
+			sp, err)
+		b.requestFullBlock(sp, &pb.hash)
+		return
+	}
+	b.processPartialBlock(sp, pb)
+}
+
 // haveInventory returns whether or not the inventory represented by the passed
 // inventory vector is known.  This includes checking all of the various places
 // inventory can be when it is in different states such as blocks that are part
@@ -513,6 +749,72 @@ func (b *blockManager) haveInventory(invVect *wire.InvVect) (bool, error) {
 	return true, nil
 }
 
+// handleHeadersMsg handles headers messages from all peers.  The headers
+// requested from the sync peer are used to find the assumed valid block on its
+// header chain.  All other headers messages announce new blocks.
+func (b *blockManager) handleHeadersMsg(hmsg *headersMsg) {
+	if hmsg.peer != b.syncPeer || !b.assumeValidRequested {
+		b.handleHeadersAnnouncement(hmsg)
+		return
+	}
+	b.assumeValidRequested = false
+	if b.assumeValidFound {
+		return
+	}
+
+	headers := hmsg.headers.Headers
+	found, err := b.chain.ProcessAssumeValidHeaders(headers)
+	if err != nil {
+		bmgrLog.Warnf("Rejected headers from peer %v: %v -- script "+
+			"validation will not be skipped", hmsg.peer, err)
+		return
+	}
+	b.assumeValidFound = found
+	if found {
+		return
+	}
+
+	// Request the next batch of headers when the message was full since
+	// the peer likely has more of them.  Otherwise, the peer's header
+	// chain does not include the assumed valid block.
+	if len(headers) < wire.MaxBlockHeadersPerMsg {
+		bmgrLog.Infof("Assumed valid block %v is not on the header "+
+			"chain of peer %v -- validating all scripts",
+			b.chain.AssumeValid(), hmsg.peer)
+		return
+	}
+	lastHash := headers[len(headers)-1].BlockHash()
+	locator := blockchain.BlockLocator([]*chainhash.Hash{&lastHash})
+	b.requestAssumeValidHeaders(hmsg.peer, locator)
+}
+
+// handleHeadersAnnouncement handles headers messages which announce new blocks
+// from peers which were asked to announce blocks with headers.  The announced
+// blocks are requested the same way as blocks announced with inv messages.
+func (b *blockManager) handleHeadersAnnouncement(hmsg *headersMsg) {
+	headers := hmsg.headers.Headers
+	if len(headers) == 0 {
+		return
+	}
+
+	// Ensure the headers connect to each other.
+	inv := wire.NewMsgInvSizeHint(uint(len(headers)))
+	prevHash := headers[0].PrevBlock
+	for _, header := range headers {
+		if header.PrevBlock != prevHash {
+			bmgrLog.Debugf("Received headers announcement from peer "+
+				"%v which do not connect -- disconnecting",
+				hmsg.peer)
+			hmsg.peer.Disconnect()
+			return
+		}
+		hash := header.BlockHash()
+		inv.AddInvVect(wire.NewInvVect(wire.InvTypeBlock, &hash))
+		prevHash = hash
+	}
+	b.handleInvMsg(&invMsg{inv: inv, peer: hmsg.peer})
+}
+
 // handleInvMsg handles inv messages from all peers.
 // We examine the inventory advertised by the remote peer and act accordingly.
 func (b *blockManager) handleInvMsg(imsg *invMsg) {
@@ -535,6 +837,9 @@ func (b *blockManager) handleInvMsg(imsg *invMsg) {
 	if lastBlock != -1 && (imsg.peer != b.syncPeer || b.current()) {
 		imsg.peer.UpdateLastAnnouncedBlock(&invVects[lastBlock].Hash)
 	}
+	if lastBlock != -1 {
+		imsg.peer.setKnownBlock(&invVects[lastBlock].Hash)
+	}
 
 	// Ignore invs from peers that aren't the sync if we are not current.
 	// Helps prevent fetching a mass of orphans when there are
@@ -643,11 +948,20 @@ func (b *blockManager) handleInvMsg(imsg *invMsg) {
 		switch iv.Type {
 		case wire.InvTypeBlock:
 			// Request the block if there is not already a pending
-			// request.
+			// request.  Once the chain is current, new blocks are
+			// requested as compact blocks from peers which support
+			// them since most of their transactions are typically
+			// already in the memory pool.
 			if _, exists := b.requestedBlocks[iv.Hash]; !exists {
 				b.requestedBlocks[iv.Hash] = struct{}{}
 				b.limitMap(b.requestedBlocks, maxRequestedBlocks)
-				imsg.peer.requestedBlocks[iv.Hash] = struct{}{}
+				now := time.Now()
+				if len(imsg.peer.requestedBlocks) == 0 {
+					imsg.peer.throughput.start(now)
+				}
+				imsg.peer.requestedBlocks[iv.Hash] = now
+				iv = wire.NewInvVect(imsg.peer.blockRequestType(
+					b.current()), &iv.Hash)
 				gdmsg.AddInvVect(iv)
 				numRequested++
 			}
@@ -700,6 +1014,8 @@ func (b *blockManager) limitMap(m map[chainhash.Hash]struct{}, limit int) {
 // the fetching should proceed.
 func (b *blockManager) blockHandler() {
 	candidatePeers := list.New()
+	stallTicker := time.NewTicker(b.stallTimeout / 2)
+	defer stallTicker.Stop()
 out:
 	for {
 		select {
@@ -716,9 +1032,20 @@ out:
 				b.handleBlockMsg(msg)
 				msg.peer.blockProcessed <- struct{}{}
 
+			case *cmpctBlockMsg:
+				b.handleCmpctBlockMsg(msg)
+				msg.peer.blockProcessed <- struct{}{}
+
+			case *blockTxnMsg:
+				b.handleBlockTxnMsg(msg)
+				msg.peer.blockProcessed <- struct{}{}
+
 			case *invMsg:
 				b.handleInvMsg(msg)
 
+			case *headersMsg:
+				b.handleHeadersMsg(msg)
+
 			case *donePeerMsg:
 				b.handleDonePeerMsg(candidatePeers, msg.peer)
 
@@ -760,6 +1087,10 @@ out:
 					"handler: %T", msg)
 			}
 
+		// Rotate the sync peer when it stalled.
+		case <-stallTicker.C:
+			b.handleStallCheck(candidatePeers, time.Now())
+
 		case <-b.quit:
 			break out
 		}
@@ -782,11 +1113,7 @@ func (b *blockManager) handleNotifyMsg(notification *blockchain.Notification) {
 			return
 		}
 
-		block, ok := notification.Data.(*provautil.Block)
-		if !ok {
-			bmgrLog.Warnf("Chain accepted notification is not a block.")
-			break
-		}
+		block := notification.Block
 
 		// Generate the inventory vector and relay it.
 		iv := wire.NewInvVect(wire.InvTypeBlock, block.Hash())
@@ -794,11 +1121,7 @@ func (b *blockManager) handleNotifyMsg(notification *blockchain.Notification) {
 
 	// A block has been connected to the main block chain.
 	case blockchain.NTBlockConnected:
-		block, ok := notification.Data.(*provautil.Block)
-		if !ok {
-			bmgrLog.Warnf("Chain connected notification is not a block.")
-			break
-		}
+		block := notification.Block
 
 		// Remove all of the transactions (except the coinbase) in the
 		// connected block from the transaction pool.  Secondly, remove any
@@ -815,45 +1138,86 @@ func (b *blockManager) handleNotifyMsg(notification *blockchain.Notification) {
 			b.server.AnnounceNewTransactions(acceptedTxs)
 		}
 
-		if r := b.server.rpcServer; r != nil {
-			// Now that this block is in the blockchain we can mark
-			// all the transactions (except the coinbase) as no
-			// longer needing rebroadcasting.
+		// Register the block with the fee estimator so the
+		// transactions it confirms are accounted for.
+		b.server.feeEstimator.RegisterBlock(block)
+
+		// Transactions of the blocks disconnected by the reorganization
+		// in progress which this block mines are not added back to the
+		// memory pool.
+		if b.reorgMined != nil {
 			for _, tx := range block.Transactions()[1:] {
-				iv := wire.NewInvVect(wire.InvTypeTx, tx.Hash())
-				b.server.RemoveRebroadcastInventory(iv)
+				b.reorgMined[*tx.Hash()] = struct{}{}
 			}
-
-			// Notify registered websocket clients of incoming block.
-			r.ntfnMgr.NotifyBlockConnected(block)
 		}
 
 	// A block has been disconnected from the main block chain.
 	case blockchain.NTBlockDisconnected:
-		block, ok := notification.Data.(*provautil.Block)
-		if !ok {
-			bmgrLog.Warnf("Chain disconnected notification is not a block.")
-			break
+		block := notification.Block
+
+		// Roll the block back from the fee estimator before its
+		// transactions are reinserted, so they are tracked from the
+		// height they were originally observed at.  Failing to do so
+		// leaves the confirmations of the block in the estimates, which
+		// skews them until the affected transactions age out.
+		if err := b.server.feeEstimator.Rollback(block.Hash()); err != nil {
+			bmgrLog.Warnf("Unable to roll back fee estimator: %v", err)
 		}
 
-		// Reinsert all of the transactions (except the coinbase) into
-		// the transaction pool.
-		for _, tx := range block.Transactions()[1:] {
-			_, _, err := b.server.txMemPool.MaybeAcceptTransaction(tx,
-				false, false)
-			if err != nil {
-				// Remove the transaction and all transactions
-				// that depend on it if it wasn't accepted into
-				// the transaction pool.
-				b.server.txMemPool.RemoveTransaction(tx, true)
-			}
+		// Hold the transactions (except the coinbase) back until the
+		// reorganization completes, so they are checked against the
+		// new chain before being added back to the transaction pool.
+		// The chain follows every disconnected block with a
+		// reorganization notification, including when a block is
+		// invalidated, which releases them and clears the buffers.
+		b.reorgBlocks = append(b.reorgBlocks, block)
+		if b.reorgMined == nil {
+			b.reorgMined = make(map[chainhash.Hash]struct{})
 		}
 
-		// Notify registered websocket clients.
-		if r := b.server.rpcServer; r != nil {
-			r.ntfnMgr.NotifyBlockDisconnected(block)
+	// The main chain was reorganized.
+	case blockchain.NTReorganization:
+		b.resurrectReorgTxns()
+	}
+}
+
+// resurrectReorgTxns adds the transactions of the blocks disconnected by the
+// completed reorganization which the new chain did not mine back to the
+// transaction pool, and notifies the subscribers about the ones which were
+// resurrected and the ones which conflict with the new chain.
+func (b *blockManager) resurrectReorgTxns() {
+	// Pass the transactions in the order they were mined in, starting with
+	// the block closest to the fork point.
+	var txns []*provautil.Tx
+	for i := len(b.reorgBlocks) - 1; i >= 0; i-- {
+		for _, tx := range b.reorgBlocks[i].Transactions()[1:] {
+			if _, ok := b.reorgMined[*tx.Hash()]; !ok {
+				txns = append(txns, tx)
+			}
 		}
 	}
+	b.reorgBlocks = nil
+	b.reorgMined = nil
+
+	resurrected, conflicted := b.server.txMemPool.ResurrectTransactions(
+		txns, cfg.reorgExemptions)
+	for _, txD := range resurrected {
+		b.server.notifier.Notify(&blockchain.Notification{
+			Type: blockchain.NTTxResurrected,
+			Tx:   txD.Tx,
+		})
+	}
+	for _, tx := range conflicted {
+		b.server.notifier.Notify(&blockchain.Notification{
+			Type: blockchain.NTTxReorgConflicted,
+			Tx:   tx,
+		})
+	}
+	if len(txns) > 0 {
+		bmgrLog.Infof("Resurrected %d of the %d transactions of the "+
+			"disconnected blocks, %d conflict with the new chain",
+			len(resurrected), len(txns), len(conflicted))
+	}
 }
 
 // NewPeer informs the block manager of a newly active peer.
@@ -888,6 +1252,30 @@ func (b *blockManager) QueueBlock(block *provautil.Block, sp *serverPeer) {
 	b.msgChan <- &blockMsg{block: block, peer: sp}
 }
 
+// QueueCmpctBlock adds the passed cmpctblock message and peer to the block
+// handling queue.
+func (b *blockManager) QueueCmpctBlock(msg *wire.MsgCmpctBlock, sp *serverPeer) {
+	// Don't accept more blocks if we're shutting down.
+	if atomic.LoadInt32(&b.shutdown) != 0 {
+		sp.blockProcessed <- struct{}{}
+		return
+	}
+
+	b.msgChan <- &cmpctBlockMsg{cmpctBlock: msg, peer: sp}
+}
+
+// QueueBlockTxn adds the passed blocktxn message and peer to the block
+// handling queue.
+func (b *blockManager) QueueBlockTxn(msg *wire.MsgBlockTxn, sp *serverPeer) {
+	// Don't accept more blocks if we're shutting down.
+	if atomic.LoadInt32(&b.shutdown) != 0 {
+		sp.blockProcessed <- struct{}{}
+		return
+	}
+
+	b.msgChan <- &blockTxnMsg{blockTxn: msg, peer: sp}
+}
+
 // QueueInv adds the passed inv message and peer to the block handling queue.
 func (b *blockManager) QueueInv(inv *wire.MsgInv, sp *serverPeer) {
 	// No channel handling here because peers do not need to block on inv
@@ -899,6 +1287,18 @@ func (b *blockManager) QueueInv(inv *wire.MsgInv, sp *serverPeer) {
 	b.msgChan <- &invMsg{inv: inv, peer: sp}
 }
 
+// QueueHeaders adds the passed headers message and peer to the block handling
+// queue.
+func (b *blockManager) QueueHeaders(headers *wire.MsgHeaders, sp *serverPeer) {
+	// No channel handling here because peers do not need to block on
+	// headers messages.
+	if atomic.LoadInt32(&b.shutdown) != 0 {
+		return
+	}
+
+	b.msgChan <- &headersMsg{headers: headers, peer: sp}
+}
+
 // DonePeer informs the blockmanager that a peer has disconnected.
 func (b *blockManager) DonePeer(sp *serverPeer) {
 	// Ignore if we are shutting down.
@@ -1028,13 +1428,15 @@ func mergeCheckpoints(defaultCheckpoints, additional []chaincfg.Checkpoint) []ch
 // Use Start to begin processing asynchronous block and inv updates.
 func newBlockManager(s *server, indexManager blockchain.IndexManager) (*blockManager, error) {
 	bm := blockManager{
-		server:          s,
-		rejectedTxns:    make(map[chainhash.Hash]struct{}),
-		requestedTxns:   make(map[chainhash.Hash]struct{}),
-		requestedBlocks: make(map[chainhash.Hash]struct{}),
-		progressLogger:  newBlockProgressLogger("Processed", bmgrLog),
-		msgChan:         make(chan interface{}, cfg.MaxPeers*3),
-		quit:            make(chan struct{}),
+		server:           s,
+		rejectedTxns:     make(map[chainhash.Hash]struct{}),
+		requestedTxns:    make(map[chainhash.Hash]struct{}),
+		requestedBlocks:  make(map[chainhash.Hash]struct{}),
+		reassignedBlocks: make(map[chainhash.Hash]struct{}),
+		progressLogger:   newBlockProgressLogger("Processed", bmgrLog),
+		msgChan:          make(chan interface{}, cfg.MaxPeers*3),
+		quit:             make(chan struct{}),
+		stallTimeout:     blockStallTimeout,
 	}
 
 	// Merge given checkpoints with the default ones unless they are disabled.
@@ -1049,8 +1451,15 @@ func newBlockManager(s *server, indexManager blockchain.IndexManager) (*blockMan
 		Checkpoints:   checkpoints,
 		TimeSource:    s.timeSource,
 		Notifications: bm.handleNotifyMsg,
+		Notifier:      s.notifier,
 		SigCache:      s.sigCache,
 		IndexManager:  indexManager,
+		ScriptWorkers: cfg.ScriptWorkers,
+		AssumeValid:   cfg.assumeValid,
+		UtxoSnapshots: cfg.utxoSnapshots,
+		MaxReorgDepth: cfg.maxReorgDepth,
+		UtxoBatchSize: cfg.UtxoBatchSize,
+		Metrics:       s.metrics,
 	})
 	if err != nil {
 		return nil, err
@@ -1060,10 +1469,10 @@ func newBlockManager(s *server, indexManager blockchain.IndexManager) (*blockMan
 }
 
 // removeRegressionDB removes the existing regression test database if running
-// in regression test mode and it already exists.
+// in regression test mode and it already exists, unless it is to be kept.
 func removeRegressionDB(dbPath string) error {
 	// Don't do anything if not in regression test mode.
-	if !cfg.RegressionTest {
+	if !cfg.RegressionTest || cfg.KeepRegTestDB {
 		return nil
 	}
 
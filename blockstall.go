@@ -0,0 +1,161 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"container/list"
+	"sort"
+	"time"
+
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/wire"
+)
+
+const (
+	// blockStallTimeout is the duration after which the sync peer is
+	// considered stalled when a block requested from it is still
+	// outstanding and it did not deliver any block in the meantime.
+	blockStallTimeout = 30 * time.Second
+
+	// throughputWeight is the weight of the latest sample in the moving
+	// average of the rate at which a peer delivers requested blocks.
+	throughputWeight = 0.2
+)
+
+// blockThroughput tracks the moving average of the rate at which a peer
+// delivers the blocks requested from it.  It is only accessed by the block
+// handler.
+type blockThroughput struct {
+	// rate is the moving average of the delivery rate in bytes per second.
+	rate float64
+
+	// lastRecv is when the peer last delivered a requested block, or when
+	// blocks were requested from it while none were outstanding, whichever
+	// is later.
+	lastRecv time.Time
+}
+
+// start restarts the measurement when blocks are requested from a peer which
+// has no outstanding requests, so the time the peer was idle does not count
+// against it.
+func (t *blockThroughput) start(now time.Time) {
+	t.lastRecv = now
+}
+
+// update adds a sample for a block of the passed size which was delivered at
+// the passed time.
+func (t *blockThroughput) update(size int, now time.Time) {
+	elapsed := now.Sub(t.lastRecv).Seconds()
+	t.lastRecv = now
+	if elapsed <= 0 {
+		return
+	}
+	sample := float64(size) / elapsed
+	if t.rate == 0 {
+		t.rate = sample
+		return
+	}
+	t.rate = throughputWeight*sample + (1-throughputWeight)*t.rate
+}
+
+// betterSyncPeer returns whether or not the passed candidate is preferred over
+// the passed best sync peer so far.  Peers which stalled fewer times are
+// preferred, followed by the ones which delivered blocks faster.  Later
+// candidates are preferred when there is no difference.
+func betterSyncPeer(candidate, best *serverPeer) bool {
+	if best == nil {
+		return true
+	}
+	if candidate.syncStalls != best.syncStalls {
+		return candidate.syncStalls < best.syncStalls
+	}
+	return candidate.throughput.rate >= best.throughput.rate
+}
+
+// handleStallCheck rotates the sync peer when it stalled, so a single slow
+// peer can't hold up the download of the chain.  The sync peer stalled when a
+// block requested from it timed out and it did not deliver any block since,
+// while another candidate announced blocks newer than the best chain.
+//
+// The stalled peer is deprioritized and the blocks which are outstanding from
+// it are requested from the new sync peer, which is never the stalled peer even
+// when it remains the preferred candidate.  The stalled blocks may still
+// arrive late from the stalled peer, in which case they are accepted, and the
+// copy which arrives last is discarded without penalizing either peer.  It is
+// invoked from the blockHandler goroutine.
+func (b *blockManager) handleStallCheck(peers *list.List, now time.Time) {
+	sp := b.syncPeer
+	if sp == nil || len(sp.requestedBlocks) == 0 {
+		return
+	}
+	if now.Sub(sp.throughput.lastRecv) < b.stallTimeout {
+		return
+	}
+	stalled := make([]chainhash.Hash, 0, len(sp.requestedBlocks))
+	timedOut := false
+	for hash, requested := range sp.requestedBlocks {
+		if now.Sub(requested) >= b.stallTimeout {
+			timedOut = true
+		}
+		stalled = append(stalled, hash)
+	}
+	if !timedOut {
+		return
+	}
+	sort.Slice(stalled, func(i, j int) bool {
+		return sp.requestedBlocks[stalled[i]].Before(
+			sp.requestedBlocks[stalled[j]])
+	})
+
+	// Keep the sync peer when no other candidate has newer blocks.
+	best := b.chain.BestSnapshot()
+	alternative := false
+	for e := peers.Front(); e != nil; e = e.Next() {
+		other := e.Value.(*serverPeer)
+		if other != sp && other.LastBlock() > best.Height {
+			alternative = true
+			break
+		}
+	}
+	if !alternative {
+		return
+	}
+
+	bmgrLog.Infof("Sync peer %s stalled with %d outstanding blocks -- "+
+		"switching sync peer", sp, len(stalled))
+
+	// The outstanding blocks are no longer requested from the stalled peer
+	// so they are requested from the new sync peer, but are still accepted
+	// from it when they arrive late.
+	sp.syncStalls++
+	for _, hash := range stalled {
+		delete(sp.requestedBlocks, hash)
+		sp.stalledBlocks[hash] = struct{}{}
+		b.reassignedBlocks[hash] = struct{}{}
+		b.limitMap(b.reassignedBlocks, maxRequestedBlocks)
+	}
+	b.syncPeer = nil
+	b.assumeValidRequested = false
+	b.startSync(peers, sp)
+	newPeer := b.syncPeer
+	if newPeer == nil {
+		return
+	}
+
+	// Request the stalled blocks from the new sync peer in the order they
+	// were requested from the stalled peer.
+	if len(newPeer.requestedBlocks) == 0 {
+		newPeer.throughput.start(now)
+	}
+	gdmsg := wire.NewMsgGetDataSizeHint(uint(len(stalled)))
+	for i := range stalled {
+		hash := &stalled[i]
+		b.requestedBlocks[*hash] = struct{}{}
+		b.limitMap(b.requestedBlocks, maxRequestedBlocks)
+		newPeer.requestedBlocks[*hash] = now
+		gdmsg.AddInvVect(wire.NewInvVect(wire.InvTypeBlock, hash))
+	}
+	newPeer.QueueMessage(gdmsg, nil)
+}
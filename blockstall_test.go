@@ -0,0 +1,311 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/blockchain/fullblocktests"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/connmgr"
+	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/peer"
+	"github.com/bitgo/prova/txscript"
+	"github.com/bitgo/prova/wire"
+)
+
+// stallTestBlocks returns a chain of blocks which extends the genesis block of
+// the regression test network.
+func stallTestBlocks(t *testing.T) []*wire.MsgBlock {
+	tests, err := fullblocktests.Generate(false)
+	if err != nil {
+		t.Fatalf("failed to generate tests: %v", err)
+	}
+
+	var blocks []*wire.MsgBlock
+	tip := chaincfg.RegressionNetParams.GenesisBlock.BlockHash()
+	for _, testInstances := range tests {
+		for _, item := range testInstances {
+			accepted, ok := item.(fullblocktests.AcceptedBlock)
+			if !ok || accepted.Block.Header.PrevBlock != tip {
+				continue
+			}
+			blocks = append(blocks, accepted.Block)
+			tip = accepted.Block.BlockHash()
+		}
+	}
+	return blocks
+}
+
+// stallTestRemote is a remote peer which serves a chain of blocks.  A throttled
+// remote does not answer block requests until it is released.
+type stallTestRemote struct {
+	*peer.Peer
+	blocks    []*wire.MsgBlock
+	throttled bool
+	pong      chan struct{}
+
+	mtx       sync.Mutex
+	requested []*wire.InvVect
+}
+
+// newStallTestRemote returns a remote peer which serves the passed blocks.
+func newStallTestRemote(blocks []*wire.MsgBlock, throttled bool) *stallTestRemote {
+	r := &stallTestRemote{
+		blocks:    blocks,
+		throttled: throttled,
+		pong:      make(chan struct{}, 1),
+	}
+	r.Peer = peer.NewInboundPeer(&peer.Config{
+		NewestBlock: func() (*chainhash.Hash, uint32, error) {
+			tip := blocks[len(blocks)-1]
+			hash := tip.BlockHash()
+			return &hash, tip.Header.Height, nil
+		},
+		Listeners: peer.MessageListeners{
+			OnGetBlocks: r.onGetBlocks,
+			OnGetData:   r.onGetData,
+			OnPong: func(*peer.Peer, *wire.MsgPong) {
+				r.pong <- struct{}{}
+			},
+		},
+		ChainParams: &chaincfg.RegressionNetParams,
+		Services:    wire.SFNodeNetwork,
+	})
+	return r
+}
+
+// onGetBlocks announces the blocks after the first known block of the locator.
+func (r *stallTestRemote) onGetBlocks(_ *peer.Peer, msg *wire.MsgGetBlocks) {
+	start := len(r.blocks)
+	for _, hash := range msg.BlockLocatorHashes {
+		if *hash == chaincfg.RegressionNetParams.GenesisBlock.BlockHash() {
+			start = 0
+			break
+		}
+		for i, block := range r.blocks {
+			if block.BlockHash() == *hash {
+				start = i + 1
+				break
+			}
+		}
+		if start != len(r.blocks) {
+			break
+		}
+	}
+	inv := wire.NewMsgInv()
+	for _, block := range r.blocks[start:] {
+		hash := block.BlockHash()
+		inv.AddInvVect(wire.NewInvVect(wire.InvTypeBlock, &hash))
+	}
+	if len(inv.InvList) > 0 {
+		r.QueueMessage(inv, nil)
+	}
+}
+
+// onGetData serves the requested blocks unless the remote is throttled, in
+// which case the requests are recorded until the remote is released.
+func (r *stallTestRemote) onGetData(_ *peer.Peer, msg *wire.MsgGetData) {
+	if r.throttled {
+		r.mtx.Lock()
+		r.requested = append(r.requested, msg.InvList...)
+		r.mtx.Unlock()
+		return
+	}
+	r.serve(msg.InvList)
+}
+
+// serve sends the requested blocks.
+func (r *stallTestRemote) serve(invList []*wire.InvVect) {
+	for _, iv := range invList {
+		for _, block := range r.blocks {
+			if block.BlockHash() == iv.Hash {
+				r.QueueMessage(block, nil)
+			}
+		}
+	}
+}
+
+// release serves the recorded block requests of a throttled remote and waits
+// until the local peer processed them.
+func (r *stallTestRemote) release(t *testing.T) {
+	r.mtx.Lock()
+	requested := r.requested
+	r.requested = nil
+	r.mtx.Unlock()
+	r.serve(requested)
+
+	// The local peer answers the ping once it processed the blocks since
+	// it processes the messages of a peer in order.
+	r.QueueMessage(wire.NewMsgPing(1), nil)
+	select {
+	case <-r.pong:
+	case <-time.After(5 * time.Second):
+		t.Fatal("late blocks were not processed")
+	}
+}
+
+// connectStallTestPeer returns a local server peer of the passed server which is
+// connected to the passed remote and registered with the block manager.
+func connectStallTestPeer(t *testing.T, s *server, remote *stallTestRemote, addr string) *serverPeer {
+	sp := newServerPeer(s, false)
+	var err error
+	sp.Peer, err = peer.NewOutboundPeer(&peer.Config{
+		Listeners: peer.MessageListeners{
+			OnInv:   sp.OnInv,
+			OnBlock: sp.OnBlock,
+		},
+		ChainParams: &chaincfg.RegressionNetParams,
+	}, addr)
+	if err != nil {
+		t.Fatalf("unable to create outbound peer: %v", err)
+	}
+
+	// The peers are connected through a link which alters the nonce of
+	// their version messages, since they would otherwise detect a
+	// connection to themselves.
+	outConn, outLink := newPipeConns()
+	inLink, inConn := newPipeConns()
+	go forwardMessages(outLink, inLink)
+	go forwardMessages(inLink, outLink)
+	sp.AssociateConnection(outConn)
+	remote.AssociateConnection(inConn)
+	deadline := time.Now().Add(5 * time.Second)
+	for !sp.VerAckReceived() || !remote.VerAckReceived() {
+		if time.Now().After(deadline) {
+			t.Fatalf("handshake with %s timed out", addr)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	s.blockManager.NewPeer(sp)
+	return sp
+}
+
+// TestSyncPeerStall ensures the download of the chain completes when the sync
+// peer stalls, by requesting the outstanding blocks from another peer, and that
+// the blocks which arrive late from the stalled peer are discarded without
+// penalizing either peer.  The other peer is used even when it stalled more
+// often before, so the stalled peer remains the preferred candidate.
+func TestSyncPeerStall(t *testing.T) {
+	for _, priorStalls := range []int{0, 2} {
+		testSyncPeerStall(t, priorStalls)
+	}
+}
+
+// testSyncPeerStall runs the sync peer stall test with a peer which does not
+// stall and previously stalled the passed number of times.
+func testSyncPeerStall(t *testing.T, priorStalls int) {
+	blocks := stallTestBlocks(t)
+	if len(blocks) < 4 {
+		t.Fatalf("not enough test blocks - got %d", len(blocks))
+	}
+
+	origCfg := cfg
+	cfg = &config{MaxPeers: defaultMaxPeers}
+	defer func() { cfg = origCfg }()
+
+	dir, err := ioutil.TempDir("", "blockstall")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := database.Create("ffldb", dir, wire.RegNet)
+	if err != nil {
+		t.Fatalf("unable to create database: %v", err)
+	}
+	defer db.Close()
+	params := chaincfg.RegressionNetParams
+	chain, err := blockchain.New(&blockchain.Config{
+		DB:          db,
+		ChainParams: &params,
+		TimeSource:  blockchain.NewMedianTime(),
+		SigCache:    txscript.NewSigCache(1000),
+	})
+	if err != nil {
+		t.Fatalf("failed to create chain instance: %v", err)
+	}
+
+	s := &server{
+		chainParams:       &params,
+		banManager:        connmgr.NewBanManager(""),
+		validatorKeys:     newValidatorKeyCache(),
+		peerHeightsUpdate: make(chan updatePeerHeightsMsg, len(blocks)),
+	}
+	s.blockManager = &blockManager{
+		server:           s,
+		chain:            chain,
+		rejectedTxns:     make(map[chainhash.Hash]struct{}),
+		requestedTxns:    make(map[chainhash.Hash]struct{}),
+		requestedBlocks:  make(map[chainhash.Hash]struct{}),
+		reassignedBlocks: make(map[chainhash.Hash]struct{}),
+		progressLogger:   newBlockProgressLogger("Processed", bmgrLog),
+		msgChan:          make(chan interface{}, cfg.MaxPeers*3),
+		quit:             make(chan struct{}),
+		stallTimeout:     200 * time.Millisecond,
+	}
+	s.blockManager.Start()
+	defer s.blockManager.Stop()
+
+	// The throttled peer connects first and becomes the sync peer.
+	throttledRemote := newStallTestRemote(blocks, true)
+	throttled := connectStallTestPeer(t, s, throttledRemote, "12.1.0.1:18444")
+	defer throttled.Disconnect()
+	if syncPeer := s.blockManager.SyncPeer(); syncPeer != throttled {
+		t.Fatalf("sync peer is %v, want the throttled peer", syncPeer)
+	}
+	goodRemote := newStallTestRemote(blocks, false)
+	good := connectStallTestPeer(t, s, goodRemote, "12.2.0.1:18444")
+	good.syncStalls = priorStalls
+	defer good.Disconnect()
+
+	// The download completes from the other peer once the sync peer
+	// stalled.
+	wantHeight := blocks[len(blocks)-1].Header.Height
+	deadline := time.Now().Add(10 * time.Second)
+	for chain.BestSnapshot().Height != wantHeight {
+		if time.Now().After(deadline) {
+			t.Fatalf("sync stopped at height %d, want %d",
+				chain.BestSnapshot().Height, wantHeight)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if syncPeer := s.blockManager.SyncPeer(); syncPeer != good {
+		t.Fatalf("sync peer is %v, want the peer which did not stall",
+			syncPeer)
+	}
+
+	// The blocks which arrive late from the stalled peer are discarded
+	// without disconnecting or penalizing either peer.
+	throttledRemote.release(t)
+	if s.blockManager.SyncPeer() != good {
+		t.Fatal("sync peer changed after the late blocks arrived")
+	}
+	if len(throttled.stalledBlocks) != 0 {
+		t.Fatalf("%d stalled blocks are still outstanding",
+			len(throttled.stalledBlocks))
+	}
+	if len(s.blockManager.reassignedBlocks) != 0 {
+		t.Fatalf("%d late blocks were not discarded",
+			len(s.blockManager.reassignedBlocks))
+	}
+	if throttled.syncStalls != 1 || good.syncStalls != priorStalls {
+		t.Fatalf("got %d and %d stalls, want 1 and %d",
+			throttled.syncStalls, good.syncStalls, priorStalls)
+	}
+	for _, sp := range []*serverPeer{throttled, good} {
+		if !sp.Connected() {
+			t.Fatalf("peer %s was disconnected", sp)
+		}
+		if score := s.banManager.Score(sp.host()); score != 0 {
+			t.Fatalf("peer %s has ban score %d", sp, score)
+		}
+	}
+}
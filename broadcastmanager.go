@@ -0,0 +1,429 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/mempool"
+	"github.com/bitgo/prova/metrics"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/wire"
+)
+
+const (
+	// rebroadcastInitialDelay is the delay after which a local transaction
+	// which did not make it into a block yet is announced again for the
+	// first time.  The delay doubles with every announcement.
+	rebroadcastInitialDelay = 5 * time.Minute
+
+	// rebroadcastMaxDelay is the maximum delay between two announcements
+	// of a local transaction.
+	rebroadcastMaxDelay = 2 * time.Hour
+
+	// rebroadcastCheckInterval is the interval at which the broadcast
+	// manager looks for local transactions which are due to be announced
+	// again.
+	rebroadcastCheckInterval = 30 * time.Second
+
+	// rebroadcastMinConfs is the number of confirmations a mined local
+	// transaction needs before it is no longer tracked.  Until then, it is
+	// announced again when a reorganization disconnects the block which
+	// mined it.
+	rebroadcastMinConfs = 6
+)
+
+// inventoryRelayer relays inventory to a single peer.  It is implemented by
+// serverPeer.
+type inventoryRelayer interface {
+	relayInventory(msg relayMsg)
+}
+
+// pendingBroadcast houses a local transaction which is announced to peers
+// until it is mined along with the schedule of its announcements.
+type pendingBroadcast struct {
+	txDesc        *mempool.TxDesc
+	added         time.Time
+	lastAnnounced time.Time
+	nextAnnounce  time.Time
+	announcements uint32
+
+	// minedBlock and minedHeight identify the main chain block which mined
+	// the transaction, if any.  disconnected is set once that block is
+	// disconnected until the reorganization which disconnected it
+	// completes.
+	minedBlock   *chainhash.Hash
+	minedHeight  uint32
+	disconnected bool
+}
+
+// isAnnounced returns whether the transaction is announced to peers, which is
+// the case unless it is mined or its block was just disconnected.
+func (p *pendingBroadcast) isAnnounced() bool {
+	return p.minedBlock == nil && !p.disconnected
+}
+
+// schedule records an announcement of the transaction at the passed time and
+// schedules the next one with exponential backoff.  The delay is randomized,
+// so the announcements don't reveal when the transaction was submitted.
+func (p *pendingBroadcast) schedule(now time.Time) {
+	p.lastAnnounced = now
+	p.announcements++
+
+	delay := rebroadcastMaxDelay
+	if shift := p.announcements - 1; shift < 16 {
+		if backoff := rebroadcastInitialDelay << shift; backoff < delay {
+			delay = backoff
+		}
+	}
+	jitter := time.Duration(randomUint16Number(1000)) * delay / 2000
+	p.nextAnnounce = now.Add(delay/2 + jitter)
+}
+
+// broadcastManagerConfig houses the functions and notifications the broadcast
+// manager needs from the rest of the server.
+type broadcastManagerConfig struct {
+	// RelayInventory relays the passed inventory to all connected peers.
+	RelayInventory func(iv *wire.InvVect, data interface{})
+
+	// IsTransactionInPool returns whether the transaction with the passed
+	// hash is in the main pool of the memory pool.
+	IsTransactionInPool func(hash *chainhash.Hash) bool
+
+	// Notifier delivers the notifications of the transactions which were
+	// mined or which conflict with a reorganized chain.
+	Notifier *blockchain.Notifier
+
+	// Metrics is the registry the metrics of the broadcast manager are
+	// registered with.  It may be nil.
+	Metrics *metrics.Registry
+}
+
+// Messages sent to the handler of the broadcast manager.
+type (
+	// addBroadcastMsg adds a transaction to the pending set.
+	addBroadcastMsg struct {
+		txDesc *mempool.TxDesc
+	}
+
+	// broadcastPeerMsg announces the pending set to a new peer.
+	broadcastPeerMsg struct {
+		peer inventoryRelayer
+	}
+
+	// getPendingBroadcastsMsg requests a snapshot of the pending set.
+	getPendingBroadcastsMsg struct {
+		reply chan []pendingBroadcast
+	}
+)
+
+// broadcastManager tracks the transactions which were submitted locally, such
+// as via the RPC server, and keeps announcing them until they are mined.  The
+// transactions are announced to every peer which connects and periodically to
+// all peers with exponential backoff, since peers which were connected when a
+// transaction was submitted may have restarted or otherwise lost track of it.
+// They are dropped once they conflict with the chain or once they are no
+// longer in the memory pool, such as when they were evicted.  Mined
+// transactions are no longer announced, but tracked until they have
+// rebroadcastMinConfs confirmations, so they are announced again when a
+// reorganization disconnects their block before then.
+type broadcastManager struct {
+	started  int32
+	shutdown int32
+	cfg      broadcastManagerConfig
+	msgChan  chan interface{}
+	quit     chan struct{}
+	wg       sync.WaitGroup
+
+	// pending houses the transactions which are announced until they are
+	// mined keyed by their hash.  It is only accessed by the handler.
+	pending map[chainhash.Hash]*pendingBroadcast
+
+	pendingTxs    *metrics.Gauge
+	announcements *metrics.Counter
+}
+
+// newBroadcastManager returns a new broadcast manager with the passed
+// configuration.  Use Start to begin processing.
+func newBroadcastManager(cfg *broadcastManagerConfig) *broadcastManager {
+	return &broadcastManager{
+		cfg:     *cfg,
+		msgChan: make(chan interface{}),
+		quit:    make(chan struct{}),
+		pending: make(map[chainhash.Hash]*pendingBroadcast),
+		pendingTxs: cfg.Metrics.NewGauge(
+			"prova_broadcast_pending_transactions",
+			"Local transactions announced until they are mined."),
+		announcements: cfg.Metrics.NewCounter(
+			"prova_broadcast_announcements_total",
+			"Repeated announcements of pending local transactions."),
+	}
+}
+
+// Start begins the processing of the broadcast manager.
+func (m *broadcastManager) Start() {
+	if atomic.AddInt32(&m.started, 1) != 1 {
+		return
+	}
+
+	m.wg.Add(1)
+	go m.handler()
+}
+
+// Stop stops the broadcast manager and waits for its handler to finish.
+func (m *broadcastManager) Stop() {
+	if atomic.AddInt32(&m.shutdown, 1) != 1 {
+		return
+	}
+
+	close(m.quit)
+	m.wg.Wait()
+}
+
+// send delivers the passed message to the handler unless the broadcast
+// manager is shutting down.
+func (m *broadcastManager) send(msg interface{}) {
+	select {
+	case m.msgChan <- msg:
+	case <-m.quit:
+	}
+}
+
+// Add tracks the passed transaction, which was submitted locally and already
+// announced to the connected peers, until it is mined.
+//
+// This function is safe for concurrent access.
+func (m *broadcastManager) Add(txDesc *mempool.TxDesc) {
+	m.send(addBroadcastMsg{txDesc: txDesc})
+}
+
+// PeerConnected announces the pending transactions to the passed peer, which
+// just completed its handshake.
+//
+// This function is safe for concurrent access.
+func (m *broadcastManager) PeerConnected(peer inventoryRelayer) {
+	m.send(broadcastPeerMsg{peer: peer})
+}
+
+// Pending returns the transactions which are announced until they are mined
+// ordered by the time they were added.
+//
+// This function is safe for concurrent access.
+func (m *broadcastManager) Pending() []pendingBroadcast {
+	reply := make(chan []pendingBroadcast, 1)
+	select {
+	case m.msgChan <- getPendingBroadcastsMsg{reply: reply}:
+		return <-reply
+	case <-m.quit:
+		return nil
+	}
+}
+
+// handler processes the messages of the broadcast manager, the notifications
+// of connected and disconnected blocks and of conflicted transactions, and the
+// periodic announcements.  A
+// subscription which is dropped for not keeping up is renewed.  The mined
+// transactions whose notifications were dropped are no longer in the memory
+// pool, so they are removed by the next periodic check anyways.  It must be
+// run as a goroutine.
+func (m *broadcastManager) handler() {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(rebroadcastCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		ntfns, cancel := m.cfg.Notifier.Subscribe(
+			blockchain.NTBlockConnected,
+			blockchain.NTBlockDisconnected,
+			blockchain.NTReorganization,
+			blockchain.NTTxReorgConflicted)
+	out:
+		for {
+			select {
+			case msg := <-m.msgChan:
+				m.handleMsg(msg, time.Now())
+
+			case n, ok := <-ntfns:
+				if !ok {
+					srvrLog.Warnf("Broadcast manager " +
+						"notifications were dropped -- " +
+						"resubscribing")
+					break out
+				}
+				switch n.Type {
+				case blockchain.NTBlockConnected:
+					m.handleBlockConnected(n.Block)
+				case blockchain.NTBlockDisconnected:
+					m.handleBlockDisconnected(n.Block)
+				case blockchain.NTReorganization:
+					m.handleReorganization(time.Now())
+				case blockchain.NTTxReorgConflicted:
+					m.remove(n.Tx.Hash(), "conflicted")
+				}
+
+			case <-ticker.C:
+				m.handleRebroadcast(time.Now())
+
+			case <-m.quit:
+				cancel()
+				return
+			}
+		}
+	}
+}
+
+// handleMsg processes the passed message sent to the handler at the passed
+// time.
+func (m *broadcastManager) handleMsg(msg interface{}, now time.Time) {
+	switch msg := msg.(type) {
+	case addBroadcastMsg:
+		hash := *msg.txDesc.Tx.Hash()
+		if _, ok := m.pending[hash]; ok {
+			return
+		}
+		p := &pendingBroadcast{txDesc: msg.txDesc, added: now}
+		p.schedule(now)
+		m.pending[hash] = p
+		m.pendingTxs.Set(int64(len(m.pending)))
+
+	case broadcastPeerMsg:
+		for hash, p := range m.pending {
+			if !p.isAnnounced() {
+				continue
+			}
+			if !m.cfg.IsTransactionInPool(&hash) {
+				m.remove(&hash, "no longer in the memory pool")
+				continue
+			}
+			iv := wire.NewInvVect(wire.InvTypeTx, &hash)
+			msg.peer.relayInventory(relayMsg{invVect: iv, data: p.txDesc})
+		}
+
+	case getPendingBroadcastsMsg:
+		pending := make([]pendingBroadcast, 0, len(m.pending))
+		for _, p := range m.pending {
+			if p.isAnnounced() {
+				pending = append(pending, *p)
+			}
+		}
+		sort.Slice(pending, func(i, j int) bool {
+			if !pending[i].added.Equal(pending[j].added) {
+				return pending[i].added.Before(pending[j].added)
+			}
+			return pending[i].txDesc.Tx.Hash().String() <
+				pending[j].txDesc.Tx.Hash().String()
+		})
+		msg.reply <- pending
+	}
+}
+
+// remove stops tracking the transaction with the passed hash for the passed
+// reason, if it is tracked.
+func (m *broadcastManager) remove(hash *chainhash.Hash, reason string) {
+	if _, ok := m.pending[*hash]; !ok {
+		return
+	}
+	delete(m.pending, *hash)
+	m.pendingTxs.Set(int64(len(m.pending)))
+	srvrLog.Debugf("Stopped announcing local transaction %v: %s", hash,
+		reason)
+}
+
+// handleBlockConnected records the pending transactions which are mined by the
+// passed block, removes the ones which conflict with it by spending the same
+// outputs as one of its transactions, and removes the mined ones which have
+// rebroadcastMinConfs confirmations.
+func (m *broadcastManager) handleBlockConnected(block *provautil.Block) {
+	if len(m.pending) == 0 {
+		return
+	}
+
+	height := block.Height()
+	spent := make(map[wire.OutPoint]struct{})
+	for _, tx := range block.Transactions()[1:] {
+		if p, ok := m.pending[*tx.Hash()]; ok {
+			p.minedBlock = block.Hash()
+			p.minedHeight = height
+			p.disconnected = false
+		}
+		for _, txIn := range tx.MsgTx().TxIn {
+			spent[txIn.PreviousOutPoint] = struct{}{}
+		}
+	}
+	for hash, p := range m.pending {
+		if p.minedBlock != nil {
+			if height-p.minedHeight+1 >= rebroadcastMinConfs {
+				m.remove(&hash, "mined")
+			}
+			continue
+		}
+		for _, txIn := range p.txDesc.Tx.MsgTx().TxIn {
+			if _, ok := spent[txIn.PreviousOutPoint]; ok {
+				m.remove(&hash, "double spent by block "+
+					block.Hash().String())
+				break
+			}
+		}
+	}
+}
+
+// handleBlockDisconnected stops announcing the pending transactions which
+// were mined by the passed block until the reorganization which disconnected
+// it completes, since they are only added back to the memory pool then.
+func (m *broadcastManager) handleBlockDisconnected(block *provautil.Block) {
+	for _, tx := range block.Transactions()[1:] {
+		p, ok := m.pending[*tx.Hash()]
+		if !ok || p.minedBlock == nil || !p.minedBlock.IsEqual(block.Hash()) {
+			continue
+		}
+		p.minedBlock = nil
+		p.disconnected = true
+	}
+}
+
+// handleReorganization schedules the pending transactions whose blocks were
+// disconnected by the completed reorganization, and which the new chain did
+// not mine, to be announced again from scratch at the passed time.  The ones
+// which were not added back to the memory pool are dropped then.
+func (m *broadcastManager) handleReorganization(now time.Time) {
+	for _, p := range m.pending {
+		if !p.disconnected {
+			continue
+		}
+		p.disconnected = false
+		p.announcements = 0
+		p.nextAnnounce = now
+	}
+}
+
+// handleRebroadcast announces the pending transactions which are due at the
+// passed time to all peers again and drops the ones which are no longer in the
+// memory pool, such as when they were evicted.  Mined transactions are left
+// alone.
+func (m *broadcastManager) handleRebroadcast(now time.Time) {
+	for hash, p := range m.pending {
+		if !p.isAnnounced() {
+			continue
+		}
+		if !m.cfg.IsTransactionInPool(&hash) {
+			m.remove(&hash, "no longer in the memory pool")
+			continue
+		}
+		if now.Before(p.nextAnnounce) {
+			continue
+		}
+
+		iv := wire.NewInvVect(wire.InvTypeTx, &hash)
+		m.cfg.RelayInventory(iv, p.txDesc)
+		p.schedule(now)
+		m.announcements.Inc()
+	}
+}
@@ -0,0 +1,288 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/mempool"
+	"github.com/bitgo/prova/mining"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/wire"
+)
+
+// newBroadcastTestTxDesc returns a mempool transaction descriptor for a
+// transaction which spends the passed output of a fake transaction.
+func newBroadcastTestTxDesc(index uint32, amount int64) *mempool.TxDesc {
+	msgTx := wire.NewMsgTx(1)
+	prevOut := wire.NewOutPoint(&chainhash.Hash{0x01}, index)
+	msgTx.AddTxIn(wire.NewTxIn(prevOut, nil))
+	msgTx.AddTxOut(wire.NewTxOut(amount, nil))
+	return &mempool.TxDesc{
+		TxDesc: mining.TxDesc{
+			Tx:       provautil.NewTx(msgTx),
+			FeePerKB: 1000,
+		},
+	}
+}
+
+// broadcastTestManager returns a broadcast manager which is not started and
+// treats the transactions of the passed set as the ones in the memory pool,
+// along with the inventory it relayed to all peers.
+func broadcastTestManager(inPool map[chainhash.Hash]bool) (*broadcastManager, *[]wire.InvVect) {
+	var relayed []wire.InvVect
+	m := newBroadcastManager(&broadcastManagerConfig{
+		RelayInventory: func(iv *wire.InvVect, data interface{}) {
+			relayed = append(relayed, *iv)
+		},
+		IsTransactionInPool: func(hash *chainhash.Hash) bool {
+			return inPool[*hash]
+		},
+		Notifier: blockchain.NewNotifier(1),
+	})
+	return m, &relayed
+}
+
+// TestBroadcastBackoff ensures pending local transactions are announced again
+// with exponential backoff and are dropped once they are no longer in the
+// memory pool.
+func TestBroadcastBackoff(t *testing.T) {
+	txD := newBroadcastTestTxDesc(0, 1000)
+	inPool := map[chainhash.Hash]bool{*txD.Tx.Hash(): true}
+	m, relayed := broadcastTestManager(inPool)
+
+	now := time.Unix(1500000000, 0)
+	m.handleMsg(addBroadcastMsg{txDesc: txD}, now)
+	m.handleMsg(addBroadcastMsg{txDesc: txD}, now.Add(time.Minute))
+	p := m.pending[*txD.Tx.Hash()]
+	if p == nil || len(m.pending) != 1 {
+		t.Fatalf("transaction is not pending once: %v", m.pending)
+	}
+	if !p.added.Equal(now) || p.announcements != 1 {
+		t.Fatalf("unexpected pending transaction %+v", p)
+	}
+
+	// Each announcement doubles the delay until the next one, which is
+	// randomized between half of it and all of it, up to the maximum.
+	delay := rebroadcastInitialDelay
+	for i := 0; i < 8; i++ {
+		last := p.lastAnnounced
+		if p.nextAnnounce.Before(last.Add(delay/2)) ||
+			p.nextAnnounce.After(last.Add(delay)) {
+
+			t.Fatalf("announcement %d: next announcement after %v, "+
+				"want between %v and %v", i,
+				p.nextAnnounce.Sub(last), delay/2, delay)
+		}
+
+		m.handleRebroadcast(p.nextAnnounce.Add(-time.Second))
+		if len(*relayed) != i {
+			t.Fatalf("announcement %d: announced early", i)
+		}
+		m.handleRebroadcast(p.nextAnnounce)
+		if len(*relayed) != i+1 || (*relayed)[i].Hash != *txD.Tx.Hash() {
+			t.Fatalf("announcement %d: not announced: %v", i,
+				*relayed)
+		}
+		if p.announcements != uint32(i+2) {
+			t.Fatalf("announcement %d: got %d announcements", i,
+				p.announcements)
+		}
+
+		delay *= 2
+		if delay > rebroadcastMaxDelay {
+			delay = rebroadcastMaxDelay
+		}
+	}
+
+	// The transaction is dropped once it leaves the memory pool, such as
+	// when it was evicted.
+	delete(inPool, *txD.Tx.Hash())
+	m.handleRebroadcast(p.nextAnnounce)
+	if len(m.pending) != 0 || len(*relayed) != 8 {
+		t.Fatalf("evicted transaction is still announced")
+	}
+}
+
+// broadcastTestBlock returns a block at the passed height which mines the
+// passed transactions after a coinbase.
+func broadcastTestBlock(height uint32, txns ...*mempool.TxDesc) *provautil.Block {
+	coinbase := wire.NewMsgTx(1)
+	coinbase.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{},
+		wire.MaxPrevOutIndex), nil))
+	msgBlock := &wire.MsgBlock{
+		Header:       wire.BlockHeader{Height: height},
+		Transactions: []*wire.MsgTx{coinbase},
+	}
+	for _, txD := range txns {
+		msgBlock.Transactions = append(msgBlock.Transactions,
+			txD.Tx.MsgTx())
+	}
+	return provautil.NewBlock(msgBlock)
+}
+
+// TestBroadcastBlockConnected ensures pending local transactions are no longer
+// announced once they are mined, are dropped once they have enough
+// confirmations, and are dropped once double spent by a block.
+func TestBroadcastBlockConnected(t *testing.T) {
+	mined := newBroadcastTestTxDesc(0, 1000)
+	conflicted := newBroadcastTestTxDesc(1, 1000)
+	unrelated := newBroadcastTestTxDesc(2, 1000)
+	m, relayed := broadcastTestManager(map[chainhash.Hash]bool{
+		*unrelated.Tx.Hash(): true,
+	})
+	now := time.Now()
+	for _, txD := range []*mempool.TxDesc{mined, conflicted, unrelated} {
+		m.handleMsg(addBroadcastMsg{txDesc: txD}, now)
+	}
+
+	// The block mines the first transaction and a double spend of the
+	// second one.
+	doubleSpend := newBroadcastTestTxDesc(1, 500)
+	m.handleBlockConnected(broadcastTestBlock(100, mined, doubleSpend))
+	if len(m.pending) != 2 || m.pending[*mined.Tx.Hash()] == nil ||
+		m.pending[*unrelated.Tx.Hash()] == nil {
+
+		t.Fatalf("unexpected pending transactions %v", m.pending)
+	}
+
+	// The mined transaction is neither announced nor dropped for leaving
+	// the memory pool until it has enough confirmations.
+	for height := uint32(101); height < 100+rebroadcastMinConfs-1; height++ {
+		m.handleBlockConnected(broadcastTestBlock(height))
+	}
+	m.handleRebroadcast(now.Add(rebroadcastMaxDelay))
+	if len(m.pending) != 2 || len(*relayed) != 1 ||
+		(*relayed)[0].Hash != *unrelated.Tx.Hash() {
+
+		t.Fatalf("unexpected pending transactions %v, announced %v",
+			m.pending, *relayed)
+	}
+	m.handleBlockConnected(broadcastTestBlock(100 + rebroadcastMinConfs - 1))
+	if len(m.pending) != 1 || m.pending[*unrelated.Tx.Hash()] == nil {
+		t.Fatalf("unexpected pending transactions %v", m.pending)
+	}
+}
+
+// TestBroadcastReorganization ensures a mined local transaction is announced
+// again from scratch once a reorganization disconnects its block, unless the
+// new chain mines it as well.
+func TestBroadcastReorganization(t *testing.T) {
+	resurrected := newBroadcastTestTxDesc(0, 1000)
+	remined := newBroadcastTestTxDesc(1, 1000)
+	inPool := make(map[chainhash.Hash]bool)
+	m, relayed := broadcastTestManager(inPool)
+	now := time.Now()
+	for _, txD := range []*mempool.TxDesc{resurrected, remined} {
+		m.handleMsg(addBroadcastMsg{txDesc: txD}, now)
+	}
+	block := broadcastTestBlock(100, resurrected, remined)
+	m.handleBlockConnected(block)
+
+	// The transactions are not dropped while the reorganization is in
+	// progress even though they are not back in the memory pool yet.
+	m.handleBlockDisconnected(block)
+	m.handleRebroadcast(now.Add(rebroadcastMaxDelay))
+	if len(m.pending) != 2 || len(*relayed) != 0 {
+		t.Fatalf("unexpected pending transactions %v, announced %v",
+			m.pending, *relayed)
+	}
+
+	// The new chain mines one of the transactions, and the other one is
+	// added back to the memory pool and announced again right away.
+	m.handleBlockConnected(broadcastTestBlock(100, remined))
+	inPool[*resurrected.Tx.Hash()] = true
+	later := now.Add(time.Hour)
+	m.handleReorganization(later)
+	p := m.pending[*resurrected.Tx.Hash()]
+	if p == nil || p.announcements != 0 || !p.nextAnnounce.Equal(later) {
+		t.Fatalf("unexpected pending transaction %+v", p)
+	}
+	m.handleRebroadcast(later)
+	if len(m.pending) != 2 || len(*relayed) != 1 ||
+		(*relayed)[0].Hash != *resurrected.Tx.Hash() {
+
+		t.Fatalf("unexpected pending transactions %v, announced %v",
+			m.pending, *relayed)
+	}
+	if p.announcements != 1 {
+		t.Fatalf("got %d announcements, want 1", p.announcements)
+	}
+}
+
+// TestBroadcastManager ensures the broadcast manager tracks the transactions
+// added to it, reports them as pending and drops them when a reorganization
+// makes them conflict with the chain.
+func TestBroadcastManager(t *testing.T) {
+	first := newBroadcastTestTxDesc(0, 1000)
+	second := newBroadcastTestTxDesc(1, 1000)
+	m, _ := broadcastTestManager(nil)
+	m.Start()
+	defer m.Stop()
+
+	m.Add(first)
+	m.Add(second)
+	pending := m.Pending()
+	if len(pending) != 2 || pending[0].txDesc != first ||
+		pending[1].txDesc != second {
+
+		t.Fatalf("unexpected pending transactions %+v", pending)
+	}
+
+	m.cfg.Notifier.Notify(&blockchain.Notification{
+		Type: blockchain.NTTxReorgConflicted,
+		Tx:   first.Tx,
+	})
+	deadline := time.Now().Add(5 * time.Second)
+	for len(m.Pending()) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("conflicted transaction is still pending")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if pending := m.Pending(); pending[0].txDesc != second {
+		t.Fatalf("unexpected pending transactions %+v", pending)
+	}
+}
+
+// TestBroadcastNewPeer ensures a local transaction which was submitted while
+// no peers were connected is announced to a peer once it connects.
+func TestBroadcastNewPeer(t *testing.T) {
+	txD := newBroadcastTestTxDesc(0, 1000)
+	s := &server{
+		txMemPool: mempool.New(&mempool.Config{
+			Policy: mempool.Policy{MinRelayTxFee: 1000},
+		}),
+	}
+	s.broadcastManager, _ = broadcastTestManager(
+		map[chainhash.Hash]bool{*txD.Tx.Hash(): true})
+	s.broadcastManager.Start()
+	s.broadcastManager.Add(txD)
+
+	h, err := connectFeeFilterHarness(s, wire.FeeFilterVersion)
+	if err != nil {
+		t.Fatalf("unable to create harness: %v", err)
+	}
+	defer h.disconnect()
+
+	deadline := time.After(20 * time.Second)
+	for {
+		select {
+		case msg := <-h.invMessages:
+			for _, iv := range msg.InvList {
+				if iv.Type == wire.InvTypeTx &&
+					iv.Hash.IsEqual(txD.Tx.Hash()) {
+
+					return
+				}
+			}
+		case <-deadline:
+			t.Fatal("transaction was not announced to the new peer")
+		}
+	}
+}
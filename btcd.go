@@ -6,6 +6,7 @@
 package main
 
 import (
+	"bufio"
 	"fmt"
 	"net"
 	"net/http"
@@ -15,8 +16,11 @@ import (
 	"runtime/debug"
 	"runtime/pprof"
 
+	"github.com/bitgo/prova/blockchain"
 	"github.com/bitgo/prova/blockchain/indexers"
+	"github.com/bitgo/prova/database"
 	"github.com/bitgo/prova/limits"
+	"github.com/bitgo/prova/txscript"
 )
 
 var (
@@ -32,7 +36,7 @@ var winServiceMain func() (bool, error)
 // optional serverChan parameter is mainly used by the service code to be
 // notified with the server once it is setup so it can gracefully stop it when
 // requested from the service control manager.
-func btcdMain(serverChan chan<- *server) error {
+func btcdMain(serverChan chan<- *server) (err error) {
 	// Load configuration and parse command line.  This function also
 	// initializes logging and configures it accordingly.
 	tcfg, _, err := loadConfig()
@@ -80,23 +84,49 @@ func btcdMain(serverChan chan<- *server) error {
 		return nil
 	}
 
+	// Run the shutdown steps registered by the subsystems on the way out,
+	// no matter how this function returns.
+	shutdown := newShutdownCoordinator(cfg.ShutdownTimeout)
+	defer func() {
+		if shutdownErr := shutdown.Shutdown(); shutdownErr != nil {
+			btcdLog.Errorf("%v", shutdownErr)
+			if err == nil {
+				err = shutdownErr
+			}
+		}
+	}()
+
 	// Load the block database.
 	db, err := loadBlockDB()
 	if err != nil {
 		btcdLog.Errorf("%v", err)
 		return err
 	}
-	defer func() {
-		// Ensure the database is sync'd and closed on shutdown.
-		btcdLog.Infof("Gracefully shutting down the database...")
-		db.Close()
-	}()
+
+	// Ensure the database is sync'd and closed on shutdown.
+	shutdown.Register("database", shutdownCloseDB, db.Close)
 
 	// Return now if an interrupt signal was triggered.
 	if interruptRequested(interruptedChan) {
 		return nil
 	}
 
+	// Verify all of the block data if requested.
+	if cfg.CheckBlocks {
+		btcdLog.Info("Verifying the block data in the database")
+		err := db.CheckBlocks(interruptedChan)
+		if dbErr, ok := err.(database.Error); ok &&
+			dbErr.ErrorCode == database.ErrInterrupted {
+
+			return nil
+		}
+		if err != nil {
+			btcdLog.Errorf("%v", err)
+			return err
+		}
+		btcdLog.Info("Block data verified")
+	}
+
 	// Drop indexes and exit if requested.
 	//
 	// NOTE: The order is important here because dropping the tx index also
@@ -117,6 +147,86 @@ func btcdMain(serverChan chan<- *server) error {
 
 		return nil
 	}
+	if cfg.DropBlockStatsIndex {
+		if err := indexers.DropBlockStatsIndex(db); err != nil {
+			btcdLog.Errorf("%v", err)
+			return err
+		}
+
+		return nil
+	}
+	if cfg.DropSigKeyIDIndex {
+		if err := indexers.DropSigKeyIDIndex(db); err != nil {
+			btcdLog.Errorf("%v", err)
+			return err
+		}
+
+		return nil
+	}
+
+	// Drop the transaction index when it is to be rebuilt.  The index
+	// manager then recreates it from the blocks already in the database
+	// when the chain is loaded, so there is no need to resync the chain.
+	//
+	// NOTE: This also drops the address index since it relies on the
+	// transaction index, so it is rebuilt as well when it is enabled.
+	if cfg.ReindexTxIndex {
+		if err := indexers.DropTxIndex(db); err != nil {
+			btcdLog.Errorf("%v", err)
+			return err
+		}
+	}
+
+	// Refuse to run without the address index when it has previously been
+	// built since it would otherwise silently fall behind the chain.
+	if !cfg.AddrIndex {
+		exists, err := indexers.AddrIndexExists(db)
+		if err != nil {
+			btcdLog.Errorf("%v", err)
+			return err
+		}
+		if exists {
+			err := fmt.Errorf("the address index was previously " +
+				"built -- either enable it with --addrindex or " +
+				"remove it with --dropaddrindex")
+			btcdLog.Errorf("%v", err)
+			return err
+		}
+	}
+
+	// Export or import a utxo set snapshot if requested.
+	if cfg.ExportUtxoSnapshot != "" {
+		err := exportUtxoSnapshot(db, cfg.ExportUtxoSnapshot)
+		if err != nil {
+			btcdLog.Errorf("%v", err)
+			return err
+		}
+
+		return nil
+	}
+	if cfg.ImportUtxoSnapshot != "" {
+		err := importUtxoSnapshot(db, cfg.ImportUtxoSnapshot)
+		if err != nil {
+			btcdLog.Errorf("%v", err)
+			return err
+		}
+	}
+
+	// Export or import blocks if requested.
+	if cfg.DumpBlocks != "" {
+		if err := dumpBlocks(db, cfg.DumpBlocks); err != nil {
+			btcdLog.Errorf("%v", err)
+			return err
+		}
+
+		return nil
+	}
+	if len(cfg.LoadBlocks) > 0 {
+		if err := loadBlocks(db, cfg.LoadBlocks); err != nil {
+			btcdLog.Errorf("%v", err)
+			return err
+		}
+	}
 
 	// Create server and start it.
 	server, err := newServer(cfg.Listeners, db, activeNetParams.Params)
@@ -126,12 +236,7 @@ func btcdMain(serverChan chan<- *server) error {
 			cfg.Listeners, err)
 		return err
 	}
-	defer func() {
-		btcdLog.Infof("Gracefully shutting down the server...")
-		server.Stop()
-		server.WaitForShutdown()
-		srvrLog.Infof("Server shutdown complete")
-	}()
+	server.registerShutdown(shutdown)
 	server.Start()
 	if serverChan != nil {
 		serverChan <- server
@@ -144,6 +249,142 @@ func btcdMain(serverChan chan<- *server) error {
 	return nil
 }
 
+// exportUtxoSnapshot writes a snapshot of the utxo set at the current best
+// block of the chain in the passed database to the file at the passed path.
+func exportUtxoSnapshot(db database.DB, path string) error {
+	chain, err := blockchain.New(&blockchain.Config{
+		DB:          db,
+		ChainParams: activeNetParams.Params,
+		TimeSource:  blockchain.NewMedianTime(),
+	})
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	best := chain.BestSnapshot()
+	commitment, err := chain.ExportUtxoSnapshot(w, *best.Hash)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	btcdLog.Infof("Exported utxo snapshot at block %v (height %d) with "+
+		"commitment %v to %s", best.Hash, best.Height, commitment, path)
+	return nil
+}
+
+// importUtxoSnapshot initializes the chain state in the passed database from
+// the utxo set snapshot in the file at the passed path.
+func importUtxoSnapshot(db database.DB, path string) error {
+	chain, err := blockchain.New(&blockchain.Config{
+		DB:            db,
+		ChainParams:   activeNetParams.Params,
+		TimeSource:    blockchain.NewMedianTime(),
+		UtxoSnapshots: cfg.utxoSnapshots,
+	})
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	btcdLog.Infof("Importing utxo snapshot from %s", path)
+	return chain.ImportUtxoSnapshot(bufio.NewReader(f))
+}
+
+// dumpBlocks writes the blocks of the main chain in the passed database to the
+// file at the passed path.
+func dumpBlocks(db database.DB, path string) error {
+	chain, err := blockchain.New(&blockchain.Config{
+		DB:          db,
+		ChainParams: activeNetParams.Params,
+		TimeSource:  blockchain.NewMedianTime(),
+	})
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	best := chain.BestSnapshot()
+	btcdLog.Infof("Exporting %d blocks to %s", best.Height+1, path)
+	if err := chain.ExportBlocks(w, 0, best.Height); err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	btcdLog.Infof("Exported blocks through block %v (height %d) to %s",
+		best.Hash, best.Height, path)
+	return nil
+}
+
+// loadBlocks imports the blocks from the files at the passed paths into the
+// chain in the passed database.  The optional indexes catch up with the
+// imported blocks once the server starts.
+func loadBlocks(db database.DB, paths []string) error {
+	checkpoints := mergeCheckpoints(activeNetParams.Checkpoints,
+		cfg.addCheckpoints)
+	chain, err := blockchain.New(&blockchain.Config{
+		DB:            db,
+		ChainParams:   activeNetParams.Params,
+		Checkpoints:   checkpoints,
+		TimeSource:    blockchain.NewMedianTime(),
+		SigCache:      txscript.NewSigCache(cfg.SigCacheMaxSize),
+		ScriptWorkers: cfg.ScriptWorkers,
+		AssumeValid:   cfg.assumeValid,
+		UtxoSnapshots: cfg.utxoSnapshots,
+		MaxReorgDepth: cfg.maxReorgDepth,
+		UtxoBatchSize: cfg.UtxoBatchSize,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+
+		btcdLog.Infof("Importing blocks from %s", path)
+		stats, err := chain.ImportBlocks(bufio.NewReader(f))
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("unable to import blocks from %s: %v",
+				path, err)
+		}
+		btcdLog.Infof("Imported %d blocks from %s (%d already known)",
+			stats.Imported, path, stats.Processed-stats.Imported)
+	}
+	return nil
+}
+
 func main() {
 	// Use all processor cores.
 	runtime.GOMAXPROCS(runtime.NumCPU())
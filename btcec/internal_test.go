@@ -71,11 +71,6 @@ func NewFieldVal() *fieldVal {
 	return new(fieldVal)
 }
 
-// TstNonceRFC6979 makes the nonceRFC6979 function available to the test package.
-func TstNonceRFC6979(privkey *big.Int, hash []byte) *big.Int {
-	return nonceRFC6979(privkey, hash)
-}
-
 // TstRemovePKCSPadding makes the internal removePKCSPadding function available
 // to the test package.
 func TstRemovePKCSPadding(src []byte) ([]byte, error) {
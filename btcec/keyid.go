@@ -6,15 +6,44 @@ package btcec
 
 import (
 	"encoding/binary"
+	"math"
+	"strconv"
 )
 
+// KeyIDSize is the size in bytes of a key id in addresses and admin
+// operations, where it is serialized as a 4-byte little-endian integer.
 const KeyIDSize = 4
 
+const (
+	// ReservedKeyID is never assigned to an ASP key.  It denotes the
+	// absence of a key id, such as for the key of a Prova script which is
+	// given by its key hash.
+	ReservedKeyID KeyID = 0
+
+	// MaxKeyID is the largest key id which can be assigned to an ASP key.
+	// Key ids are embedded in scripts as script numbers, which are signed
+	// 32-bit integers, so all larger key ids are reserved.
+	MaxKeyID KeyID = math.MaxInt32
+)
+
 // KeyID is an identifying number of ASP keys in Prova. These are used to
 // shorten the byte space requirements of scriptPubKeys and addresses.
 type KeyID uint32
 
+// IsValid returns whether the key id can be assigned to an ASP key, which is
+// the case when it lies within the range [1, MaxKeyID].  Key ids outside that
+// range are reserved.
+func (id KeyID) IsValid() bool {
+	return id != ReservedKeyID && id <= MaxKeyID
+}
+
+// String returns the key id as a decimal number.
+func (id KeyID) String() string {
+	return strconv.FormatUint(uint64(id), 10)
+}
+
 // ToAddressFormat encodes a key id in a format suitable for a Prova address.
+// The same format is used for key ids pushed by admin operations.
 func (id KeyID) ToAddressFormat(buf []byte) {
 	binary.LittleEndian.PutUint32(buf, uint32(id))
 }
@@ -57,3 +57,43 @@ func TestKeyIDFromAddressBuffer(t *testing.T) {
 			"equal to %v", keyId2, keyId2FromBytes)
 	}
 }
+
+// TestKeyIDIsValid tests the valid and reserved key id ranges.
+func TestKeyIDIsValid(t *testing.T) {
+	tests := []struct {
+		keyID btcec.KeyID
+		valid bool
+	}{
+		{btcec.ReservedKeyID, false},
+		{1, true},
+		{65536, true},
+		{btcec.MaxKeyID - 1, true},
+		{btcec.MaxKeyID, true},
+		{btcec.MaxKeyID + 1, false},
+		{0xffffffff, false},
+	}
+	for _, test := range tests {
+		if got := test.keyID.IsValid(); got != test.valid {
+			t.Fatalf("IsValid(%d): got %v, want %v", uint32(test.keyID),
+				got, test.valid)
+		}
+	}
+}
+
+// TestKeyIDString tests the string representation of key ids.
+func TestKeyIDString(t *testing.T) {
+	tests := []struct {
+		keyID btcec.KeyID
+		want  string
+	}{
+		{btcec.ReservedKeyID, "0"},
+		{65536, "65536"},
+		{btcec.MaxKeyID, "2147483647"},
+		{0xffffffff, "4294967295"},
+	}
+	for _, test := range tests {
+		if got := test.keyID.String(); got != test.want {
+			t.Fatalf("String: got %q, want %q", got, test.want)
+		}
+	}
+}
@@ -82,6 +82,16 @@ func (sig *Signature) Verify(hash []byte, pubKey *PublicKey) bool {
 	return ecdsa.Verify(pubKey.ToECDSA(), hash, sig.R, sig.S)
 }
 
+// IsCanonical returns whether the signature is canonical, which means its S
+// value is at most half the curve order as required by BIP0062.  Canonical
+// signatures have exactly one strict DER serialization which is produced by
+// Serialize unchanged, while the S value of any other signature is replaced by
+// its complement when serializing it.  The R and S values are expected to be
+// in the range [1, N-1] as enforced when parsing a signature.
+func (sig *Signature) IsCanonical() bool {
+	return sig.S.Cmp(halforder) <= 0
+}
+
 // IsEqual compares this Signature instance to the one passed, returning true
 // if both Signatures are equivalent. A signature is equivalent to another, if
 // they both have the same scalar value for R and S.
@@ -422,7 +432,7 @@ func signRFC6979(privateKey *PrivateKey, hash []byte) (*Signature, error) {
 
 	privkey := privateKey.ToECDSA()
 	N := order
-	k := nonceRFC6979(privkey.D, hash)
+	k := NonceRFC6979(privkey.D, hash, nil, nil)
 	inv := new(big.Int).ModInverse(k, N)
 	r, _ := privkey.Curve.ScalarBaseMult(k.Bytes())
 	if r.Cmp(N) == 1 {
@@ -448,11 +458,40 @@ func signRFC6979(privateKey *PrivateKey, hash []byte) (*Signature, error) {
 	return &Signature{R: r, S: s}, nil
 }
 
-// nonceRFC6979 generates an ECDSA nonce (`k`) deterministically according to RFC 6979.
-// It takes a 32-byte hash as an input and returns 32-byte nonce to be used in ECDSA algorithm.
-func nonceRFC6979(privkey *big.Int, hash []byte) *big.Int {
+// SignCanonical generates a deterministic ECDSA signature of the provided hash
+// using the passed private key.  The nonce is generated according to RFC 6979
+// and the signature is guaranteed to be canonical, that is its S value is at
+// most half the curve order, so it serializes to the unique low-S strict DER
+// encoding which is also produced by other RFC 6979 implementations such as
+// libsecp256k1.
+func SignCanonical(privKey *PrivateKey, hash []byte) (*Signature, error) {
+	sig, err := signRFC6979(privKey, hash)
+	if err != nil {
+		return nil, err
+	}
+	if sig.R.Cmp(order) >= 0 || sig.S.Cmp(order) >= 0 || !sig.IsCanonical() {
+		return nil, errors.New("calculated signature is not canonical")
+	}
+	return sig, nil
+}
+
+// NonceRFC6979 generates an ECDSA nonce (`k`) for the secp256k1 curve
+// deterministically according to RFC 6979.  It takes a 32-byte hash as an
+// input and returns 32-byte nonce to be used in ECDSA algorithm.
+//
+// The extra and version parameters are optional additional data as described
+// in section 3.6 of RFC 6979.  When present, they are appended to the private
+// key and hash in that order, which matches the 32-byte extra entropy and
+// 16-byte algorithm identifier of the libsecp256k1 nonce function.  Passing
+// nil for both generates the plain RFC 6979 nonce used by PrivateKey.Sign.
+func NonceRFC6979(privkey *big.Int, hash []byte, extra []byte, version []byte) *big.Int {
+	return nonceRFC6979(S256(), privkey, hash, extra, version)
+}
+
+// nonceRFC6979 generates an ECDSA nonce for the passed curve according to RFC
+// 6979 using SHA-256 as the hash function.  See NonceRFC6979 for details.
+func nonceRFC6979(curve elliptic.Curve, privkey *big.Int, hash []byte, extra []byte, version []byte) *big.Int {
 
-	curve := S256()
 	q := curve.Params().N
 	x := privkey
 	alg := sha256.New
@@ -461,6 +500,8 @@ func nonceRFC6979(privkey *big.Int, hash []byte) *big.Int {
 	holen := alg().Size()
 	rolen := (qlen + 7) >> 3
 	bx := append(int2octets(x, rolen), bits2octets(hash, curve, rolen)...)
+	bx = append(bx, extra...)
+	bx = append(bx, version...)
 
 	// Step B
 	v := bytes.Repeat(oneInitializer, holen)
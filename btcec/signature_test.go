@@ -7,6 +7,7 @@ package btcec
 
 import (
 	"bytes"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
@@ -561,7 +562,7 @@ func TestRFC6979(t *testing.T) {
 		hash := sha256.Sum256([]byte(test.msg))
 
 		// Ensure deterministically generated nonce is the expected value.
-		gotNonce := nonceRFC6979(privKey.D, hash[:]).Bytes()
+		gotNonce := NonceRFC6979(privKey.D, hash[:], nil, nil).Bytes()
 		wantNonce := decodeHex(test.nonce)
 		if !bytes.Equal(gotNonce, wantNonce) {
 			t.Errorf("NonceRFC6979 #%d (%s): Nonce is incorrect: "+
@@ -585,6 +586,163 @@ func TestRFC6979(t *testing.T) {
 				wantSigBytes)
 			continue
 		}
+
+		// Ensure the canonical signature is the same one and is
+		// serialized unchanged.
+		canonicalSig, err := SignCanonical(privKey, hash[:])
+		if err != nil {
+			t.Errorf("SignCanonical #%d (%s): unexpected error: %v",
+				i, test.msg, err)
+			continue
+		}
+		if !canonicalSig.IsCanonical() {
+			t.Errorf("SignCanonical #%d (%s): signature is not "+
+				"canonical", i, test.msg)
+			continue
+		}
+		if !canonicalSig.IsEqual(gotSig) {
+			t.Errorf("SignCanonical #%d (%s): mismatched signature: "+
+				"%x (expected %x)", i, test.msg,
+				canonicalSig.Serialize(), wantSigBytes)
+			continue
+		}
+		parsedSig, err := ParseDERSignature(wantSigBytes, S256())
+		if err != nil {
+			t.Errorf("ParseDERSignature #%d (%s): unexpected error: "+
+				"%v", i, test.msg, err)
+			continue
+		}
+		if !parsedSig.IsEqual(canonicalSig) {
+			t.Errorf("SignCanonical #%d (%s): signature does not "+
+				"round trip through its serialization", i, test.msg)
+			continue
+		}
+	}
+}
+
+// TestNonceRFC6979Vectors ensures the nonce generation matches the test
+// vectors of RFC 6979 for the P-256 curve with SHA-256 and, for the secp256k1
+// curve, nonces generated with additional data as done by libsecp256k1.
+func TestNonceRFC6979Vectors(t *testing.T) {
+	// Test vectors from RFC 6979 appendix A.2.5.
+	rfcKey := fromHex("c9afa9d845ba75166b5c215767b1d6934e50c3db36e89b127b8a622b120f6721")
+	rfcTests := []struct {
+		msg   string
+		nonce string
+		r     string
+	}{
+		{
+			"sample",
+			"a6e3c57dd01abe90086538398355dd4c3b17aa873382b0f24d6129493d8aad60",
+			"efd48b2aacb6a8fd1140dd9cd45e81d69d2c877b56aaf991c34d0ea84eaf3716",
+		},
+		{
+			"test",
+			"d16b6ae827f17175e040871a1c7ec3500192c4c92677336ec2537acaee0008e0",
+			"f1abb023518351cd71d881567b1ea663ed3efcf6c5132b354f28d3b0b7d38367",
+		},
+	}
+	curve := elliptic.P256()
+	for i, test := range rfcTests {
+		hash := sha256.Sum256([]byte(test.msg))
+		gotNonce := nonceRFC6979(curve, rfcKey, hash[:], nil, nil)
+		if gotNonce.Cmp(fromHex(test.nonce)) != 0 {
+			t.Errorf("nonceRFC6979 #%d (%s): nonce is incorrect: "+
+				"%x (expected %s)", i, test.msg, gotNonce,
+				test.nonce)
+			continue
+		}
+		gotR, _ := curve.ScalarBaseMult(gotNonce.Bytes())
+		gotR.Mod(gotR, curve.Params().N)
+		if gotR.Cmp(fromHex(test.r)) != 0 {
+			t.Errorf("nonceRFC6979 #%d (%s): R is incorrect: %x "+
+				"(expected %s)", i, test.msg, gotR, test.r)
+			continue
+		}
+	}
+
+	// Nonces with additional data, which are appended to the private key
+	// and hash in the order extra data and version.
+	key := fromHex("cca9fbcc1b41e5a95d369eaa6ddcff73b61a4efaa279cfc6567e8daa39cbaf50")
+	hash := sha256.Sum256([]byte("sample"))
+	extra := sha256.Sum256([]byte("extra entropy"))
+	version := []byte("ECDSA+SHA256\x00\x00\x00\x00")
+	tests := []struct {
+		name    string
+		extra   []byte
+		version []byte
+		nonce   string
+	}{
+		{
+			"no additional data",
+			nil,
+			nil,
+			"2df40ca70e639d89528a6b670d9d48d9165fdc0febc0974056bdce192b8e16a3",
+		},
+		{
+			"extra data",
+			extra[:],
+			nil,
+			"1a3b8963e291936c2f797196682e032963a24689cea3c39f3adbb3573236380d",
+		},
+		{
+			"version",
+			nil,
+			version,
+			"111e1b6b19fe815e98ecaf24ce9270021a1d553be526444c7373c6c4e99c466e",
+		},
+		{
+			"extra data and version",
+			extra[:],
+			version,
+			"5fcdf1795de2982282f73f828697ead2380971bc7e2a4fd01f15571335300e00",
+		},
+	}
+	for _, test := range tests {
+		gotNonce := NonceRFC6979(key, hash[:], test.extra, test.version)
+		if gotNonce.Cmp(fromHex(test.nonce)) != 0 {
+			t.Errorf("NonceRFC6979 (%s): nonce is incorrect: %x "+
+				"(expected %s)", test.name, gotNonce, test.nonce)
+		}
+	}
+}
+
+// TestSignatureIsCanonical ensures signatures are only reported as canonical
+// when their S value is at most half the curve order and that non-canonical
+// signatures serialize to their canonical form.
+func TestSignatureIsCanonical(t *testing.T) {
+	// High S signature previously produced by another implementation.
+	highS, err := ParseSignature(decodeHex("30450220090ebfb3690a0ff115bb"+
+		"1b38b8b323a667b7653454f1bccb06d4bbdca42c2079022100ec95778b51"+
+		"e7071cb1205f8bde9af6592fc978b0452dafe599481c46d6b2e479"), S256())
+	if err != nil {
+		t.Fatalf("ParseSignature: unexpected error: %v", err)
+	}
+	if highS.IsCanonical() {
+		t.Fatalf("IsCanonical: high S signature reported as canonical")
+	}
+
+	lowS, err := ParseDERSignature(highS.Serialize(), S256())
+	if err != nil {
+		t.Fatalf("ParseDERSignature: unexpected error: %v", err)
+	}
+	if !lowS.IsCanonical() {
+		t.Fatalf("IsCanonical: serialized signature is not canonical")
+	}
+	wantS := new(big.Int).Sub(S256().N, highS.S)
+	if lowS.R.Cmp(highS.R) != 0 || lowS.S.Cmp(wantS) != 0 {
+		t.Fatalf("Serialize: unexpected canonical signature %x",
+			highS.Serialize())
+	}
+
+	// S values of exactly half the order are canonical.
+	halfOrder := &Signature{R: big.NewInt(1), S: new(big.Int).Set(halforder)}
+	if !halfOrder.IsCanonical() {
+		t.Fatalf("IsCanonical: half order S reported as non canonical")
+	}
+	halfOrder.S.Add(halfOrder.S, one)
+	if halfOrder.IsCanonical() {
+		t.Fatalf("IsCanonical: half order + 1 S reported as canonical")
 	}
 }
 
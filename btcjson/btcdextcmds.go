@@ -44,6 +44,23 @@ func NewNodeCmd(subCmd NodeSubCmd, target string, connectSubCmd *string) *NodeCm
 	}
 }
 
+// CompactDBCmd defines the compactdb JSON-RPC command.  This command is not a
+// standard Bitcoin command.  It is an extension for btcd.
+type CompactDBCmd struct {
+	Bucket *string
+}
+
+// NewCompactDBCmd returns a new instance which can be used to issue a compactdb
+// JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewCompactDBCmd(bucket *string) *CompactDBCmd {
+	return &CompactDBCmd{
+		Bucket: bucket,
+	}
+}
+
 // DebugLevelCmd defines the debuglevel JSON-RPC command.  This command is not a
 // standard Bitcoin command.  It is an extension for btcd.
 type DebugLevelCmd struct {
@@ -72,6 +89,41 @@ func NewGenerateCmd(numBlocks uint32) *GenerateCmd {
 	}
 }
 
+// GenerateBlockCmd defines the generateblock JSON-RPC command.
+type GenerateBlockCmd struct {
+	Address      string
+	Transactions []string
+}
+
+// NewGenerateBlockCmd returns a new instance which can be used to issue a
+// generateblock JSON-RPC command.
+func NewGenerateBlockCmd(address string, transactions []string) *GenerateBlockCmd {
+	return &GenerateBlockCmd{
+		Address:      address,
+		Transactions: transactions,
+	}
+}
+
+// GenerateToAddressCmd defines the generatetoaddress JSON-RPC command.
+type GenerateToAddressCmd struct {
+	NumBlocks uint32
+	Address   string
+	MaxTries  *uint64 `jsonrpcdefault:"1000000"`
+}
+
+// NewGenerateToAddressCmd returns a new instance which can be used to issue a
+// generatetoaddress JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewGenerateToAddressCmd(numBlocks uint32, address string, maxTries *uint64) *GenerateToAddressCmd {
+	return &GenerateToAddressCmd{
+		NumBlocks: numBlocks,
+		Address:   address,
+		MaxTries:  maxTries,
+	}
+}
+
 // GetBestBlockCmd defines the getbestblock JSON-RPC command.
 type GetBestBlockCmd struct{}
 
@@ -90,6 +142,16 @@ func NewGetCurrentNetCmd() *GetCurrentNetCmd {
 	return &GetCurrentNetCmd{}
 }
 
+// GetDBStatsCmd defines the getdbstats JSON-RPC command.  This command is not a
+// standard Bitcoin command.  It is an extension for btcd.
+type GetDBStatsCmd struct{}
+
+// NewGetDBStatsCmd returns a new instance which can be used to issue a
+// getdbstats JSON-RPC command.
+func NewGetDBStatsCmd() *GetDBStatsCmd {
+	return &GetDBStatsCmd{}
+}
+
 // GetHeadersCmd defines the getheaders JSON-RPC command.
 //
 // NOTE: This is a btcsuite extension ported from
@@ -115,10 +177,14 @@ func init() {
 	// No special flags for commands in this file.
 	flags := UsageFlag(0)
 
+	MustRegisterCmd("compactdb", (*CompactDBCmd)(nil), flags)
 	MustRegisterCmd("debuglevel", (*DebugLevelCmd)(nil), flags)
 	MustRegisterCmd("node", (*NodeCmd)(nil), flags)
 	MustRegisterCmd("generate", (*GenerateCmd)(nil), flags)
+	MustRegisterCmd("generateblock", (*GenerateBlockCmd)(nil), flags)
+	MustRegisterCmd("generatetoaddress", (*GenerateToAddressCmd)(nil), flags)
 	MustRegisterCmd("getbestblock", (*GetBestBlockCmd)(nil), flags)
 	MustRegisterCmd("getcurrentnet", (*GetCurrentNetCmd)(nil), flags)
+	MustRegisterCmd("getdbstats", (*GetDBStatsCmd)(nil), flags)
 	MustRegisterCmd("getheaders", (*GetHeadersCmd)(nil), flags)
 }
@@ -30,6 +30,30 @@ func TestBtcdExtCmds(t *testing.T) {
 		marshalled   string
 		unmarshalled interface{}
 	}{
+		{
+			name: "compactdb",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("compactdb")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewCompactDBCmd(nil)
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"compactdb","params":[],"id":1}`,
+			unmarshalled: &btcjson.CompactDBCmd{},
+		},
+		{
+			name: "compactdb optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("compactdb", "txbyhashidx")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewCompactDBCmd(btcjson.String("txbyhashidx"))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"compactdb","params":["txbyhashidx"],"id":1}`,
+			unmarshalled: &btcjson.CompactDBCmd{
+				Bucket: btcjson.String("txbyhashidx"),
+			},
+		},
 		{
 			name: "debuglevel",
 			newCmd: func() (interface{}, error) {
@@ -114,6 +138,53 @@ func TestBtcdExtCmds(t *testing.T) {
 				NumBlocks: 1,
 			},
 		},
+		{
+			name: "generateblock",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("generateblock", "addr",
+					[]string{"txid"})
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGenerateBlockCmd("addr",
+					[]string{"txid"})
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"generateblock","params":["addr",["txid"]],"id":1}`,
+			unmarshalled: &btcjson.GenerateBlockCmd{
+				Address:      "addr",
+				Transactions: []string{"txid"},
+			},
+		},
+		{
+			name: "generatetoaddress",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("generatetoaddress", 2, "addr")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGenerateToAddressCmd(2, "addr", nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"generatetoaddress","params":[2,"addr"],"id":1}`,
+			unmarshalled: &btcjson.GenerateToAddressCmd{
+				NumBlocks: 2,
+				Address:   "addr",
+				MaxTries:  btcjson.Uint64(1000000),
+			},
+		},
+		{
+			name: "generatetoaddress optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("generatetoaddress", 2, "addr", 500)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGenerateToAddressCmd(2, "addr",
+					btcjson.Uint64(500))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"generatetoaddress","params":[2,"addr",500],"id":1}`,
+			unmarshalled: &btcjson.GenerateToAddressCmd{
+				NumBlocks: 2,
+				Address:   "addr",
+				MaxTries:  btcjson.Uint64(500),
+			},
+		},
 		{
 			name: "getbestblock",
 			newCmd: func() (interface{}, error) {
@@ -136,6 +207,17 @@ func TestBtcdExtCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"getcurrentnet","params":[],"id":1}`,
 			unmarshalled: &btcjson.GetCurrentNetCmd{},
 		},
+		{
+			name: "getdbstats",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getdbstats")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetDBStatsCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getdbstats","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetDBStatsCmd{},
+		},
 		{
 			name: "getheaders",
 			newCmd: func() (interface{}, error) {
@@ -45,6 +45,15 @@ func NewAddNodeCmd(addr string, subCmd AddNodeSubCmd) *AddNodeCmd {
 	}
 }
 
+// ClearBannedCmd defines the clearbanned JSON-RPC command.
+type ClearBannedCmd struct{}
+
+// NewClearBannedCmd returns a new instance which can be used to issue a
+// clearbanned JSON-RPC command.
+func NewClearBannedCmd() *ClearBannedCmd {
+	return &ClearBannedCmd{}
+}
+
 // TransactionInput represents the inputs to a transaction.  Specifically a
 // transaction hash and output number pair.
 type TransactionInput struct {
@@ -57,6 +66,7 @@ type CreateRawTransactionCmd struct {
 	Inputs   []TransactionInput
 	Amounts  map[string]float64 `jsonrpcusage:"{\"address\":amount,...}"` // In RMG
 	LockTime *int64
+	Verbose  *bool
 }
 
 // NewCreateRawTransactionCmd returns a new instance which can be used to issue
@@ -64,12 +74,13 @@ type CreateRawTransactionCmd struct {
 //
 // Amounts are in RMG.
 func NewCreateRawTransactionCmd(inputs []TransactionInput, amounts map[string]float64,
-	lockTime *int64) *CreateRawTransactionCmd {
+	lockTime *int64, verbose *bool) *CreateRawTransactionCmd {
 
 	return &CreateRawTransactionCmd{
 		Inputs:   inputs,
 		Amounts:  amounts,
 		LockTime: lockTime,
+		Verbose:  verbose,
 	}
 }
 
@@ -99,6 +110,73 @@ func NewDecodeScriptCmd(hexScript string) *DecodeScriptCmd {
 	}
 }
 
+// EstimateSmartFeeMode defines the estimation modes which may be passed to the
+// estimatesmartfee JSON-RPC command.
+type EstimateSmartFeeMode string
+
+const (
+	// EstimateModeEconomical requests an estimate which is only based on
+	// the fee rates most transactions confirmed with recently and may
+	// therefore confirm later than requested.
+	EstimateModeEconomical EstimateSmartFeeMode = "ECONOMICAL"
+
+	// EstimateModeConservative requests an estimate which is very likely
+	// to confirm within the requested number of blocks.
+	EstimateModeConservative EstimateSmartFeeMode = "CONSERVATIVE"
+)
+
+// EstimateSmartFeeCmd defines the estimatesmartfee JSON-RPC command.
+type EstimateSmartFeeCmd struct {
+	ConfTarget   int64
+	EstimateMode *string `jsonrpcdefault:"\"CONSERVATIVE\""`
+}
+
+// NewEstimateSmartFeeCmd returns a new instance which can be used to issue a
+// estimatesmartfee JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewEstimateSmartFeeCmd(confTarget int64, estimateMode *string) *EstimateSmartFeeCmd {
+	return &EstimateSmartFeeCmd{
+		ConfTarget:   confTarget,
+		EstimateMode: estimateMode,
+	}
+}
+
+// FundRawTransactionUtxo identifies an unspent transaction output which may
+// be spent to fund a transaction.
+type FundRawTransactionUtxo struct {
+	Txid string `json:"txid"`
+	Vout uint32 `json:"vout"`
+}
+
+// FundRawTransactionOpts houses the options of the fundrawtransaction JSON-RPC
+// command.  The transaction is funded with the passed unspent outputs and the
+// unspent outputs paying to the passed addresses.  The fee rate is in RMG/kB
+// and takes precedence over the confirmation target.
+type FundRawTransactionOpts struct {
+	ChangeAddress string                   `json:"changeaddress"`
+	Utxos         []FundRawTransactionUtxo `json:"utxos,omitempty"`
+	Addresses     []string                 `json:"addresses,omitempty"`
+	FeeRate       *float64                 `json:"feerate,omitempty"`
+	ConfTarget    *int64                   `json:"conftarget,omitempty"`
+}
+
+// FundRawTransactionCmd defines the fundrawtransaction JSON-RPC command.
+type FundRawTransactionCmd struct {
+	HexTx   string
+	Options FundRawTransactionOpts
+}
+
+// NewFundRawTransactionCmd returns a new instance which can be used to issue a
+// fundrawtransaction JSON-RPC command.
+func NewFundRawTransactionCmd(hexTx string, options FundRawTransactionOpts) *FundRawTransactionCmd {
+	return &FundRawTransactionCmd{
+		HexTx:   hexTx,
+		Options: options,
+	}
+}
+
 // GetAddedNodeInfoCmd defines the getaddednodeinfo JSON-RPC command.
 type GetAddedNodeInfoCmd struct {
 	DNS  bool
@@ -135,22 +213,79 @@ func NewGetBestBlockHashCmd() *GetBestBlockHashCmd {
 	return &GetBestBlockHashCmd{}
 }
 
+// GetBlockVerbosity defines the verbosity levels which may be passed to the
+// getblock JSON-RPC command.  For compatibility with the former verbose flag,
+// the JSON booleans false and true are accepted as levels 0 and 1.
+type GetBlockVerbosity int
+
+const (
+	// GetBlockVerbosityHex requests the serialized block as a hex-encoded
+	// string.
+	GetBlockVerbosityHex GetBlockVerbosity = 0
+
+	// GetBlockVerbosityTxIDs requests a JSON object describing the block
+	// which lists the ids of its transactions.
+	GetBlockVerbosityTxIDs GetBlockVerbosity = 1
+
+	// GetBlockVerbosityTxs requests a JSON object describing the block
+	// which inlines its decoded transactions.
+	GetBlockVerbosityTxs GetBlockVerbosity = 2
+)
+
+// UnmarshalJSON unmarshals a verbosity level from either a number or one of
+// the JSON booleans false and true.
+func (v *GetBlockVerbosity) UnmarshalJSON(data []byte) error {
+	var verbose bool
+	if err := json.Unmarshal(data, &verbose); err == nil {
+		*v = GetBlockVerbosityHex
+		if verbose {
+			*v = GetBlockVerbosityTxIDs
+		}
+		return nil
+	}
+
+	var level int
+	if err := json.Unmarshal(data, &level); err != nil {
+		return err
+	}
+	*v = GetBlockVerbosity(level)
+	return nil
+}
+
 // GetBlockCmd defines the getblock JSON-RPC command.
 type GetBlockCmd struct {
 	Hash      string
-	Verbose   *bool `jsonrpcdefault:"true"`
-	VerboseTx *bool `jsonrpcdefault:"false"`
+	Verbosity *GetBlockVerbosity `jsonrpcdefault:"1"`
+	VerboseTx *bool              `jsonrpcdefault:"false"`
 }
 
 // NewGetBlockCmd returns a new instance which can be used to issue a getblock
-// JSON-RPC command.
+// JSON-RPC command.  The verbose flag selects the verbosity levels 0 and 1.
+// Use NewGetBlockVerbosityCmd to request other levels.
 //
 // The parameters which are pointers indicate they are optional.  Passing nil
 // for optional parameters will use the default value.
 func NewGetBlockCmd(hash string, verbose, verboseTx *bool) *GetBlockCmd {
+	var verbosity *GetBlockVerbosity
+	if verbose != nil {
+		level := GetBlockVerbosityHex
+		if *verbose {
+			level = GetBlockVerbosityTxIDs
+		}
+		verbosity = &level
+	}
+	return NewGetBlockVerbosityCmd(hash, verbosity, verboseTx)
+}
+
+// NewGetBlockVerbosityCmd returns a new instance which can be used to issue a
+// getblock JSON-RPC command with the passed verbosity level.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewGetBlockVerbosityCmd(hash string, verbosity *GetBlockVerbosity, verboseTx *bool) *GetBlockCmd {
 	return &GetBlockCmd{
 		Hash:      hash,
-		Verbose:   verbose,
+		Verbosity: verbosity,
 		VerboseTx: verboseTx,
 	}
 }
@@ -201,6 +336,24 @@ func NewGetBlockHeaderCmd(hash string, verbose *bool) *GetBlockHeaderCmd {
 	}
 }
 
+// GetBlockStatsCmd defines the getblockstats JSON-RPC command.
+type GetBlockStatsCmd struct {
+	Hash  string
+	Stats *[]string
+}
+
+// NewGetBlockStatsCmd returns a new instance which can be used to issue a
+// getblockstats JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewGetBlockStatsCmd(hash string, stats *[]string) *GetBlockStatsCmd {
+	return &GetBlockStatsCmd{
+		Hash:  hash,
+		Stats: stats,
+	}
+}
+
 // TemplateRequest is a request object as defined in BIP22
 // (https://en.bitcoin.it/wiki/BIP_0022), it is optionally provided as an
 // pointer argument to GetBlockTemplateCmd.
@@ -324,6 +477,15 @@ func NewGetDifficultyCmd() *GetDifficultyCmd {
 	return &GetDifficultyCmd{}
 }
 
+// GetFinalizedHeightCmd defines the getfinalizedheight JSON-RPC command.
+type GetFinalizedHeightCmd struct{}
+
+// NewGetFinalizedHeightCmd returns a new instance which can be used to issue a
+// getfinalizedheight JSON-RPC command.
+func NewGetFinalizedHeightCmd() *GetFinalizedHeightCmd {
+	return &GetFinalizedHeightCmd{}
+}
+
 // GetGenerateCmd defines the getgenerate JSON-RPC command.
 type GetGenerateCmd struct{}
 
@@ -351,6 +513,15 @@ func NewGetInfoCmd() *GetInfoCmd {
 	return &GetInfoCmd{}
 }
 
+// GetMemoryInfoCmd defines the getmemoryinfo JSON-RPC command.
+type GetMemoryInfoCmd struct{}
+
+// NewGetMemoryInfoCmd returns a new instance which can be used to issue a
+// getmemoryinfo JSON-RPC command.
+func NewGetMemoryInfoCmd() *GetMemoryInfoCmd {
+	return &GetMemoryInfoCmd{}
+}
+
 // GetMempoolEntryCmd defines the getmempoolentry JSON-RPC command.
 type GetMempoolEntryCmd struct {
 	TxID string
@@ -373,6 +544,15 @@ func NewGetMempoolInfoCmd() *GetMempoolInfoCmd {
 	return &GetMempoolInfoCmd{}
 }
 
+// GetMetricsCmd defines the getmetrics JSON-RPC command.
+type GetMetricsCmd struct{}
+
+// NewGetMetricsCmd returns a new instance which can be used to issue a
+// getmetrics JSON-RPC command.
+func NewGetMetricsCmd() *GetMetricsCmd {
+	return &GetMetricsCmd{}
+}
+
 // GetMiningInfoCmd defines the getmininginfo JSON-RPC command.
 type GetMiningInfoCmd struct{}
 
@@ -402,7 +582,7 @@ func NewGetNetTotalsCmd() *GetNetTotalsCmd {
 
 // GetNetworkHashPSCmd defines the getnetworkhashps JSON-RPC command.
 type GetNetworkHashPSCmd struct {
-	Blocks *int `jsonrpcdefault:"120"`
+	Blocks *int `jsonrpcdefault:"-1"`
 	Height *int `jsonrpcdefault:"-1"`
 }
 
@@ -427,6 +607,15 @@ func NewGetPeerInfoCmd() *GetPeerInfoCmd {
 	return &GetPeerInfoCmd{}
 }
 
+// GetPendingBroadcastsCmd defines the getpendingbroadcasts JSON-RPC command.
+type GetPendingBroadcastsCmd struct{}
+
+// NewGetPendingBroadcastsCmd returns a new instance which can be used to issue
+// a getpendingbroadcasts JSON-RPC command.
+func NewGetPendingBroadcastsCmd() *GetPendingBroadcastsCmd {
+	return &GetPendingBroadcastsCmd{}
+}
+
 // GetRawMempoolCmd defines the getmempool JSON-RPC command.
 type GetRawMempoolCmd struct {
 	Verbose *bool `jsonrpcdefault:"false"`
@@ -464,6 +653,15 @@ func NewGetRawTransactionCmd(txHash string, verbose *int) *GetRawTransactionCmd
 	}
 }
 
+// GetRPCInfoCmd defines the getrpcinfo JSON-RPC command.
+type GetRPCInfoCmd struct{}
+
+// NewGetRPCInfoCmd returns a new instance which can be used to issue a
+// getrpcinfo JSON-RPC command.
+func NewGetRPCInfoCmd() *GetRPCInfoCmd {
+	return &GetRPCInfoCmd{}
+}
+
 // GetTxOutCmd defines the gettxout JSON-RPC command.
 type GetTxOutCmd struct {
 	Txid           string
@@ -511,6 +709,22 @@ func NewGetTxOutSetInfoCmd() *GetTxOutSetInfoCmd {
 	return &GetTxOutSetInfoCmd{}
 }
 
+// GetValidatorInfoCmd defines the getvalidatorinfo JSON-RPC command.
+type GetValidatorInfoCmd struct {
+	Lookback *int
+}
+
+// NewGetValidatorInfoCmd returns a new instance which can be used to issue a
+// getvalidatorinfo JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewGetValidatorInfoCmd(lookback *int) *GetValidatorInfoCmd {
+	return &GetValidatorInfoCmd{
+		Lookback: lookback,
+	}
+}
+
 // GetWorkCmd defines the getwork JSON-RPC command.
 type GetWorkCmd struct {
 	Data *string
@@ -556,6 +770,15 @@ func NewInvalidateBlockCmd(blockHash string) *InvalidateBlockCmd {
 	}
 }
 
+// ListBannedCmd defines the listbanned JSON-RPC command.
+type ListBannedCmd struct{}
+
+// NewListBannedCmd returns a new instance which can be used to issue a
+// listbanned JSON-RPC command.
+func NewListBannedCmd() *ListBannedCmd {
+	return &ListBannedCmd{}
+}
+
 // PingCmd defines the ping JSON-RPC command.
 type PingCmd struct{}
 
@@ -578,6 +801,21 @@ func NewPreciousBlockCmd(blockHash string) *PreciousBlockCmd {
 	}
 }
 
+// PrioritiseTransactionCmd defines the prioritisetransaction JSON-RPC command.
+type PrioritiseTransactionCmd struct {
+	TxID     string
+	FeeDelta int64
+}
+
+// NewPrioritiseTransactionCmd returns a new instance which can be used to issue
+// a prioritisetransaction JSON-RPC command.
+func NewPrioritiseTransactionCmd(txID string, feeDelta int64) *PrioritiseTransactionCmd {
+	return &PrioritiseTransactionCmd{
+		TxID:     txID,
+		FeeDelta: feeDelta,
+	}
+}
+
 // ReconsiderBlockCmd defines the reconsiderblock JSON-RPC command.
 type ReconsiderBlockCmd struct {
 	BlockHash string
@@ -598,13 +836,14 @@ type GetAddressTxIdsCmd struct {
 
 // SearchRawTransactionsCmd defines the searchrawtransactions JSON-RPC command.
 type SearchRawTransactionsCmd struct {
-	Address     string
-	Verbose     *int  `jsonrpcdefault:"1"`
-	Skip        *int  `jsonrpcdefault:"0"`
-	Count       *int  `jsonrpcdefault:"100"`
-	VinExtra    *int  `jsonrpcdefault:"0"`
-	Reverse     *bool `jsonrpcdefault:"false"`
-	FilterAddrs *[]string
+	Address        string
+	Verbose        *int  `jsonrpcdefault:"1"`
+	Skip           *int  `jsonrpcdefault:"0"`
+	Count          *int  `jsonrpcdefault:"100"`
+	VinExtra       *int  `jsonrpcdefault:"0"`
+	Reverse        *bool `jsonrpcdefault:"false"`
+	FilterAddrs    *[]string
+	IncludeMempool *bool `jsonrpcdefault:"true"`
 }
 
 // NewSearchRawTransactionsCmd returns a new instance which can be used to issue a
@@ -612,15 +851,16 @@ type SearchRawTransactionsCmd struct {
 //
 // The parameters which are pointers indicate they are optional.  Passing nil
 // for optional parameters will use the default value.
-func NewSearchRawTransactionsCmd(address string, verbose, skip, count *int, vinExtra *int, reverse *bool, filterAddrs *[]string) *SearchRawTransactionsCmd {
+func NewSearchRawTransactionsCmd(address string, verbose, skip, count *int, vinExtra *int, reverse *bool, filterAddrs *[]string, includeMempool *bool) *SearchRawTransactionsCmd {
 	return &SearchRawTransactionsCmd{
-		Address:     address,
-		Verbose:     verbose,
-		Skip:        skip,
-		Count:       count,
-		VinExtra:    vinExtra,
-		Reverse:     reverse,
-		FilterAddrs: filterAddrs,
+		Address:        address,
+		Verbose:        verbose,
+		Skip:           skip,
+		Count:          count,
+		VinExtra:       vinExtra,
+		Reverse:        reverse,
+		FilterAddrs:    filterAddrs,
+		IncludeMempool: includeMempool,
 	}
 }
 
@@ -642,6 +882,42 @@ func NewSendRawTransactionCmd(hexTx string, allowHighFees *bool) *SendRawTransac
 	}
 }
 
+// SetBanSubCmd defines the type used in the setban JSON-RPC command for the
+// sub command field.
+type SetBanSubCmd string
+
+const (
+	// SBAdd indicates the specified IP address or network should be
+	// banned.
+	SBAdd SetBanSubCmd = "add"
+
+	// SBRemove indicates the ban of the specified IP address or network
+	// should be lifted.
+	SBRemove SetBanSubCmd = "remove"
+)
+
+// SetBanCmd defines the setban JSON-RPC command.
+type SetBanCmd struct {
+	SubNet   string
+	SubCmd   SetBanSubCmd `jsonrpcusage:"\"add|remove\""`
+	BanTime  *int64       `jsonrpcdefault:"0"`
+	Absolute *bool        `jsonrpcdefault:"false"`
+}
+
+// NewSetBanCmd returns a new instance which can be used to issue a setban
+// JSON-RPC command.
+//
+// The parameters which are pointers indicate they are optional.  Passing nil
+// for optional parameters will use the default value.
+func NewSetBanCmd(subNet string, subCmd SetBanSubCmd, banTime *int64, absolute *bool) *SetBanCmd {
+	return &SetBanCmd{
+		SubNet:   subNet,
+		SubCmd:   subCmd,
+		BanTime:  banTime,
+		Absolute: absolute,
+	}
+}
+
 // SetGenerateCmd defines the setgenerate JSON-RPC command.
 type SetGenerateCmd struct {
 	Generate     bool
@@ -694,6 +970,15 @@ func NewSubmitBlockCmd(hexBlock string, options *SubmitBlockOptions) *SubmitBloc
 	}
 }
 
+// UptimeCmd defines the uptime JSON-RPC command.
+type UptimeCmd struct{}
+
+// NewUptimeCmd returns a new instance which can be used to issue an uptime
+// JSON-RPC command.
+func NewUptimeCmd() *UptimeCmd {
+	return &UptimeCmd{}
+}
+
 // ValidateAddressCmd defines the validateaddress JSON-RPC command.
 type ValidateAddressCmd struct {
 	Address string
@@ -760,9 +1045,12 @@ func init() {
 	flags := UsageFlag(0)
 
 	MustRegisterCmd("addnode", (*AddNodeCmd)(nil), flags)
+	MustRegisterCmd("clearbanned", (*ClearBannedCmd)(nil), flags)
 	MustRegisterCmd("createrawtransaction", (*CreateRawTransactionCmd)(nil), flags)
 	MustRegisterCmd("decoderawtransaction", (*DecodeRawTransactionCmd)(nil), flags)
 	MustRegisterCmd("decodescript", (*DecodeScriptCmd)(nil), flags)
+	MustRegisterCmd("estimatesmartfee", (*EstimateSmartFeeCmd)(nil), flags)
+	MustRegisterCmd("fundrawtransaction", (*FundRawTransactionCmd)(nil), flags)
 	MustRegisterCmd("getaddresstxids", (*GetAddressTxIdsCmd)(nil), flags)
 	MustRegisterCmd("getaddednodeinfo", (*GetAddedNodeInfoCmd)(nil), flags)
 	MustRegisterCmd("getadmininfo", (*GetAdminInfoCmd)(nil), flags)
@@ -772,36 +1060,47 @@ func init() {
 	MustRegisterCmd("getblockcount", (*GetBlockCountCmd)(nil), flags)
 	MustRegisterCmd("getblockhash", (*GetBlockHashCmd)(nil), flags)
 	MustRegisterCmd("getblockheader", (*GetBlockHeaderCmd)(nil), flags)
+	MustRegisterCmd("getblockstats", (*GetBlockStatsCmd)(nil), flags)
 	MustRegisterCmd("getblocktemplate", (*GetBlockTemplateCmd)(nil), flags)
 	MustRegisterCmd("getchaintips", (*GetChainTipsCmd)(nil), flags)
 	MustRegisterCmd("getconnectioncount", (*GetConnectionCountCmd)(nil), flags)
 	MustRegisterCmd("getdifficulty", (*GetDifficultyCmd)(nil), flags)
+	MustRegisterCmd("getfinalizedheight", (*GetFinalizedHeightCmd)(nil), flags)
 	MustRegisterCmd("getgenerate", (*GetGenerateCmd)(nil), flags)
 	MustRegisterCmd("gethashespersec", (*GetHashesPerSecCmd)(nil), flags)
 	MustRegisterCmd("getinfo", (*GetInfoCmd)(nil), flags)
+	MustRegisterCmd("getmemoryinfo", (*GetMemoryInfoCmd)(nil), flags)
 	MustRegisterCmd("getmempoolentry", (*GetMempoolEntryCmd)(nil), flags)
 	MustRegisterCmd("getmempoolinfo", (*GetMempoolInfoCmd)(nil), flags)
+	MustRegisterCmd("getmetrics", (*GetMetricsCmd)(nil), flags)
 	MustRegisterCmd("getmininginfo", (*GetMiningInfoCmd)(nil), flags)
 	MustRegisterCmd("getnetworkinfo", (*GetNetworkInfoCmd)(nil), flags)
 	MustRegisterCmd("getnettotals", (*GetNetTotalsCmd)(nil), flags)
 	MustRegisterCmd("getnetworkhashps", (*GetNetworkHashPSCmd)(nil), flags)
 	MustRegisterCmd("getpeerinfo", (*GetPeerInfoCmd)(nil), flags)
+	MustRegisterCmd("getpendingbroadcasts", (*GetPendingBroadcastsCmd)(nil), flags)
 	MustRegisterCmd("getrawmempool", (*GetRawMempoolCmd)(nil), flags)
 	MustRegisterCmd("getrawtransaction", (*GetRawTransactionCmd)(nil), flags)
+	MustRegisterCmd("getrpcinfo", (*GetRPCInfoCmd)(nil), flags)
 	MustRegisterCmd("gettxout", (*GetTxOutCmd)(nil), flags)
 	MustRegisterCmd("gettxoutproof", (*GetTxOutProofCmd)(nil), flags)
 	MustRegisterCmd("gettxoutsetinfo", (*GetTxOutSetInfoCmd)(nil), flags)
+	MustRegisterCmd("getvalidatorinfo", (*GetValidatorInfoCmd)(nil), flags)
 	MustRegisterCmd("getwork", (*GetWorkCmd)(nil), flags)
 	MustRegisterCmd("help", (*HelpCmd)(nil), flags)
 	MustRegisterCmd("invalidateblock", (*InvalidateBlockCmd)(nil), flags)
+	MustRegisterCmd("listbanned", (*ListBannedCmd)(nil), flags)
 	MustRegisterCmd("ping", (*PingCmd)(nil), flags)
 	MustRegisterCmd("preciousblock", (*PreciousBlockCmd)(nil), flags)
+	MustRegisterCmd("prioritisetransaction", (*PrioritiseTransactionCmd)(nil), flags)
 	MustRegisterCmd("reconsiderblock", (*ReconsiderBlockCmd)(nil), flags)
 	MustRegisterCmd("searchrawtransactions", (*SearchRawTransactionsCmd)(nil), flags)
 	MustRegisterCmd("sendrawtransaction", (*SendRawTransactionCmd)(nil), flags)
+	MustRegisterCmd("setban", (*SetBanCmd)(nil), flags)
 	MustRegisterCmd("setgenerate", (*SetGenerateCmd)(nil), flags)
 	MustRegisterCmd("stop", (*StopCmd)(nil), flags)
 	MustRegisterCmd("submitblock", (*SubmitBlockCmd)(nil), flags)
+	MustRegisterCmd("uptime", (*UptimeCmd)(nil), flags)
 	MustRegisterCmd("validateaddress", (*ValidateAddressCmd)(nil), flags)
 	MustRegisterCmd("verifychain", (*VerifyChainCmd)(nil), flags)
 	MustRegisterCmd("verifymessage", (*VerifyMessageCmd)(nil), flags)
@@ -41,6 +41,17 @@ func TestChainSvrCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"addnode","params":["127.0.0.1","remove"],"id":1}`,
 			unmarshalled: &btcjson.AddNodeCmd{Addr: "127.0.0.1", SubCmd: btcjson.ANRemove},
 		},
+		{
+			name: "clearbanned",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("clearbanned")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewClearBannedCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"clearbanned","params":[],"id":1}`,
+			unmarshalled: &btcjson.ClearBannedCmd{},
+		},
 		{
 			name: "createrawtransaction",
 			newCmd: func() (interface{}, error) {
@@ -52,7 +63,7 @@ func TestChainSvrCmds(t *testing.T) {
 					{Txid: "123", Vout: 1},
 				}
 				amounts := map[string]float64{"456": .0123}
-				return btcjson.NewCreateRawTransactionCmd(txInputs, amounts, nil)
+				return btcjson.NewCreateRawTransactionCmd(txInputs, amounts, nil, nil)
 			},
 			marshalled: `{"jsonrpc":"1.0","method":"createrawtransaction","params":[[{"txid":"123","vout":1}],{"456":0.0123}],"id":1}`,
 			unmarshalled: &btcjson.CreateRawTransactionCmd{
@@ -71,7 +82,7 @@ func TestChainSvrCmds(t *testing.T) {
 					{Txid: "123", Vout: 1},
 				}
 				amounts := map[string]float64{"456": .0123}
-				return btcjson.NewCreateRawTransactionCmd(txInputs, amounts, btcjson.Int64(12312333333))
+				return btcjson.NewCreateRawTransactionCmd(txInputs, amounts, btcjson.Int64(12312333333), nil)
 			},
 			marshalled: `{"jsonrpc":"1.0","method":"createrawtransaction","params":[[{"txid":"123","vout":1}],{"456":0.0123},12312333333],"id":1}`,
 			unmarshalled: &btcjson.CreateRawTransactionCmd{
@@ -80,6 +91,28 @@ func TestChainSvrCmds(t *testing.T) {
 				LockTime: btcjson.Int64(12312333333),
 			},
 		},
+		{
+			name: "createrawtransaction verbose",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("createrawtransaction", `[{"txid":"123","vout":1}]`,
+					`{"456":0.0123}`, int64(0), true)
+			},
+			staticCmd: func() interface{} {
+				txInputs := []btcjson.TransactionInput{
+					{Txid: "123", Vout: 1},
+				}
+				amounts := map[string]float64{"456": .0123}
+				return btcjson.NewCreateRawTransactionCmd(txInputs, amounts,
+					btcjson.Int64(0), btcjson.Bool(true))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"createrawtransaction","params":[[{"txid":"123","vout":1}],{"456":0.0123},0,true],"id":1}`,
+			unmarshalled: &btcjson.CreateRawTransactionCmd{
+				Inputs:   []btcjson.TransactionInput{{Txid: "123", Vout: 1}},
+				Amounts:  map[string]float64{"456": .0123},
+				LockTime: btcjson.Int64(0),
+				Verbose:  btcjson.Bool(true),
+			},
+		},
 		{
 			name: "decoderawtransaction",
 			newCmd: func() (interface{}, error) {
@@ -102,6 +135,65 @@ func TestChainSvrCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"decodescript","params":["00"],"id":1}`,
 			unmarshalled: &btcjson.DecodeScriptCmd{HexScript: "00"},
 		},
+		{
+			name: "estimatesmartfee",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("estimatesmartfee", 6)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewEstimateSmartFeeCmd(6, nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"estimatesmartfee","params":[6],"id":1}`,
+			unmarshalled: &btcjson.EstimateSmartFeeCmd{
+				ConfTarget:   6,
+				EstimateMode: btcjson.String("CONSERVATIVE"),
+			},
+		},
+		{
+			name: "estimatesmartfee optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("estimatesmartfee", 2, "ECONOMICAL")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewEstimateSmartFeeCmd(2,
+					btcjson.String("ECONOMICAL"))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"estimatesmartfee","params":[2,"ECONOMICAL"],"id":1}`,
+			unmarshalled: &btcjson.EstimateSmartFeeCmd{
+				ConfTarget:   2,
+				EstimateMode: btcjson.String("ECONOMICAL"),
+			},
+		},
+		{
+			name: "fundrawtransaction",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("fundrawtransaction", "0100",
+					`{"changeaddress":"123","utxos":[{"txid":"456","vout":1}],"addresses":["789"],"feerate":0.0001}`)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewFundRawTransactionCmd("0100",
+					btcjson.FundRawTransactionOpts{
+						ChangeAddress: "123",
+						Utxos: []btcjson.FundRawTransactionUtxo{
+							{Txid: "456", Vout: 1},
+						},
+						Addresses: []string{"789"},
+						FeeRate:   btcjson.Float64(0.0001),
+					})
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"fundrawtransaction","params":["0100",{"changeaddress":"123","utxos":[{"txid":"456","vout":1}],"addresses":["789"],"feerate":0.0001}],"id":1}`,
+			unmarshalled: &btcjson.FundRawTransactionCmd{
+				HexTx: "0100",
+				Options: btcjson.FundRawTransactionOpts{
+					ChangeAddress: "123",
+					Utxos: []btcjson.FundRawTransactionUtxo{
+						{Txid: "456", Vout: 1},
+					},
+					Addresses: []string{"789"},
+					FeeRate:   btcjson.Float64(0.0001),
+				},
+			},
+		},
 		{
 			name: "getaddednodeinfo",
 			newCmd: func() (interface{}, error) {
@@ -160,7 +252,7 @@ func TestChainSvrCmds(t *testing.T) {
 			marshalled: `{"jsonrpc":"1.0","method":"getblock","params":["123"],"id":1}`,
 			unmarshalled: &btcjson.GetBlockCmd{
 				Hash:      "123",
-				Verbose:   btcjson.Bool(true),
+				Verbosity: getBlockVerbosity(btcjson.GetBlockVerbosityTxIDs),
 				VerboseTx: btcjson.Bool(false),
 			},
 		},
@@ -170,34 +262,65 @@ func TestChainSvrCmds(t *testing.T) {
 				// Intentionally use a source param that is
 				// more pointers than the destination to
 				// exercise that path.
-				verbosePtr := btcjson.Bool(true)
-				return btcjson.NewCmd("getblock", "123", &verbosePtr)
+				verbosityPtr := btcjson.Int(1)
+				return btcjson.NewCmd("getblock", "123", &verbosityPtr)
 			},
 			staticCmd: func() interface{} {
 				return btcjson.NewGetBlockCmd("123", btcjson.Bool(true), nil)
 			},
-			marshalled: `{"jsonrpc":"1.0","method":"getblock","params":["123",true],"id":1}`,
+			marshalled: `{"jsonrpc":"1.0","method":"getblock","params":["123",1],"id":1}`,
 			unmarshalled: &btcjson.GetBlockCmd{
 				Hash:      "123",
-				Verbose:   btcjson.Bool(true),
+				Verbosity: getBlockVerbosity(btcjson.GetBlockVerbosityTxIDs),
 				VerboseTx: btcjson.Bool(false),
 			},
 		},
 		{
 			name: "getblock required optional2",
 			newCmd: func() (interface{}, error) {
-				return btcjson.NewCmd("getblock", "123", true, true)
+				return btcjson.NewCmd("getblock", "123", 1, true)
 			},
 			staticCmd: func() interface{} {
 				return btcjson.NewGetBlockCmd("123", btcjson.Bool(true), btcjson.Bool(true))
 			},
-			marshalled: `{"jsonrpc":"1.0","method":"getblock","params":["123",true,true],"id":1}`,
+			marshalled: `{"jsonrpc":"1.0","method":"getblock","params":["123",1,true],"id":1}`,
 			unmarshalled: &btcjson.GetBlockCmd{
 				Hash:      "123",
-				Verbose:   btcjson.Bool(true),
+				Verbosity: getBlockVerbosity(btcjson.GetBlockVerbosityTxIDs),
 				VerboseTx: btcjson.Bool(true),
 			},
 		},
+		{
+			name: "getblock verbosity 2",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getblock", "123", 2)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetBlockVerbosityCmd("123",
+					getBlockVerbosity(btcjson.GetBlockVerbosityTxs), nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getblock","params":["123",2],"id":1}`,
+			unmarshalled: &btcjson.GetBlockCmd{
+				Hash:      "123",
+				Verbosity: getBlockVerbosity(btcjson.GetBlockVerbosityTxs),
+				VerboseTx: btcjson.Bool(false),
+			},
+		},
+		{
+			name: "getblock hex",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getblock", "123", 0)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetBlockCmd("123", btcjson.Bool(false), nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getblock","params":["123",0],"id":1}`,
+			unmarshalled: &btcjson.GetBlockCmd{
+				Hash:      "123",
+				Verbosity: getBlockVerbosity(btcjson.GetBlockVerbosityHex),
+				VerboseTx: btcjson.Bool(false),
+			},
+		},
 		{
 			name: "getblockchaininfo",
 			newCmd: func() (interface{}, error) {
@@ -245,6 +368,34 @@ func TestChainSvrCmds(t *testing.T) {
 				Verbose: btcjson.Bool(true),
 			},
 		},
+		{
+			name: "getblockstats",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getblockstats", "123")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetBlockStatsCmd("123", nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getblockstats","params":["123"],"id":1}`,
+			unmarshalled: &btcjson.GetBlockStatsCmd{
+				Hash:  "123",
+				Stats: nil,
+			},
+		},
+		{
+			name: "getblockstats optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getblockstats", "123", []string{"totalfee", "txs"})
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetBlockStatsCmd("123", &[]string{"totalfee", "txs"})
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getblockstats","params":["123",["totalfee","txs"]],"id":1}`,
+			unmarshalled: &btcjson.GetBlockStatsCmd{
+				Hash:  "123",
+				Stats: &[]string{"totalfee", "txs"},
+			},
+		},
 		{
 			name: "getblocktemplate",
 			newCmd: func() (interface{}, error) {
@@ -361,6 +512,17 @@ func TestChainSvrCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"getdifficulty","params":[],"id":1}`,
 			unmarshalled: &btcjson.GetDifficultyCmd{},
 		},
+		{
+			name: "getfinalizedheight",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getfinalizedheight")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetFinalizedHeightCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getfinalizedheight","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetFinalizedHeightCmd{},
+		},
 		{
 			name: "getgenerate",
 			newCmd: func() (interface{}, error) {
@@ -394,6 +556,17 @@ func TestChainSvrCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"getinfo","params":[],"id":1}`,
 			unmarshalled: &btcjson.GetInfoCmd{},
 		},
+		{
+			name: "getmemoryinfo",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getmemoryinfo")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetMemoryInfoCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getmemoryinfo","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetMemoryInfoCmd{},
+		},
 		{
 			name: "getmempoolentry",
 			newCmd: func() (interface{}, error) {
@@ -418,6 +591,17 @@ func TestChainSvrCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"getmempoolinfo","params":[],"id":1}`,
 			unmarshalled: &btcjson.GetMempoolInfoCmd{},
 		},
+		{
+			name: "getmetrics",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getmetrics")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetMetricsCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getmetrics","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetMetricsCmd{},
+		},
 		{
 			name: "getmininginfo",
 			newCmd: func() (interface{}, error) {
@@ -461,7 +645,7 @@ func TestChainSvrCmds(t *testing.T) {
 			},
 			marshalled: `{"jsonrpc":"1.0","method":"getnetworkhashps","params":[],"id":1}`,
 			unmarshalled: &btcjson.GetNetworkHashPSCmd{
-				Blocks: btcjson.Int(120),
+				Blocks: btcjson.Int(-1),
 				Height: btcjson.Int(-1),
 			},
 		},
@@ -504,6 +688,17 @@ func TestChainSvrCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"getpeerinfo","params":[],"id":1}`,
 			unmarshalled: &btcjson.GetPeerInfoCmd{},
 		},
+		{
+			name: "getpendingbroadcasts",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getpendingbroadcasts")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetPendingBroadcastsCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getpendingbroadcasts","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetPendingBroadcastsCmd{},
+		},
 		{
 			name: "getrawmempool",
 			newCmd: func() (interface{}, error) {
@@ -558,6 +753,17 @@ func TestChainSvrCmds(t *testing.T) {
 				Verbose: btcjson.Int(1),
 			},
 		},
+		{
+			name: "getrpcinfo",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getrpcinfo")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetRPCInfoCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getrpcinfo","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetRPCInfoCmd{},
+		},
 		{
 			name: "gettxout",
 			newCmd: func() (interface{}, error) {
@@ -629,6 +835,30 @@ func TestChainSvrCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"gettxoutsetinfo","params":[],"id":1}`,
 			unmarshalled: &btcjson.GetTxOutSetInfoCmd{},
 		},
+		{
+			name: "getvalidatorinfo",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getvalidatorinfo")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetValidatorInfoCmd(nil)
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"getvalidatorinfo","params":[],"id":1}`,
+			unmarshalled: &btcjson.GetValidatorInfoCmd{},
+		},
+		{
+			name: "getvalidatorinfo optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("getvalidatorinfo", 10000)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewGetValidatorInfoCmd(btcjson.Int(10000))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"getvalidatorinfo","params":[10000],"id":1}`,
+			unmarshalled: &btcjson.GetValidatorInfoCmd{
+				Lookback: btcjson.Int(10000),
+			},
+		},
 		{
 			name: "getwork",
 			newCmd: func() (interface{}, error) {
@@ -694,6 +924,17 @@ func TestChainSvrCmds(t *testing.T) {
 				BlockHash: "123",
 			},
 		},
+		{
+			name: "listbanned",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("listbanned")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewListBannedCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"listbanned","params":[],"id":1}`,
+			unmarshalled: &btcjson.ListBannedCmd{},
+		},
 		{
 			name: "ping",
 			newCmd: func() (interface{}, error) {
@@ -718,6 +959,20 @@ func TestChainSvrCmds(t *testing.T) {
 				BlockHash: "0123",
 			},
 		},
+		{
+			name: "prioritisetransaction",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("prioritisetransaction", "123", -1000)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewPrioritiseTransactionCmd("123", -1000)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"prioritisetransaction","params":["123",-1000],"id":1}`,
+			unmarshalled: &btcjson.PrioritiseTransactionCmd{
+				TxID:     "123",
+				FeeDelta: -1000,
+			},
+		},
 		{
 			name: "reconsiderblock",
 			newCmd: func() (interface{}, error) {
@@ -737,17 +992,18 @@ func TestChainSvrCmds(t *testing.T) {
 				return btcjson.NewCmd("searchrawtransactions", "1Address")
 			},
 			staticCmd: func() interface{} {
-				return btcjson.NewSearchRawTransactionsCmd("1Address", nil, nil, nil, nil, nil, nil)
+				return btcjson.NewSearchRawTransactionsCmd("1Address", nil, nil, nil, nil, nil, nil, nil)
 			},
 			marshalled: `{"jsonrpc":"1.0","method":"searchrawtransactions","params":["1Address"],"id":1}`,
 			unmarshalled: &btcjson.SearchRawTransactionsCmd{
-				Address:     "1Address",
-				Verbose:     btcjson.Int(1),
-				Skip:        btcjson.Int(0),
-				Count:       btcjson.Int(100),
-				VinExtra:    btcjson.Int(0),
-				Reverse:     btcjson.Bool(false),
-				FilterAddrs: nil,
+				Address:        "1Address",
+				Verbose:        btcjson.Int(1),
+				Skip:           btcjson.Int(0),
+				Count:          btcjson.Int(100),
+				VinExtra:       btcjson.Int(0),
+				Reverse:        btcjson.Bool(false),
+				FilterAddrs:    nil,
+				IncludeMempool: btcjson.Bool(true),
 			},
 		},
 		{
@@ -757,17 +1013,18 @@ func TestChainSvrCmds(t *testing.T) {
 			},
 			staticCmd: func() interface{} {
 				return btcjson.NewSearchRawTransactionsCmd("1Address",
-					btcjson.Int(0), nil, nil, nil, nil, nil)
+					btcjson.Int(0), nil, nil, nil, nil, nil, nil)
 			},
 			marshalled: `{"jsonrpc":"1.0","method":"searchrawtransactions","params":["1Address",0],"id":1}`,
 			unmarshalled: &btcjson.SearchRawTransactionsCmd{
-				Address:     "1Address",
-				Verbose:     btcjson.Int(0),
-				Skip:        btcjson.Int(0),
-				Count:       btcjson.Int(100),
-				VinExtra:    btcjson.Int(0),
-				Reverse:     btcjson.Bool(false),
-				FilterAddrs: nil,
+				Address:        "1Address",
+				Verbose:        btcjson.Int(0),
+				Skip:           btcjson.Int(0),
+				Count:          btcjson.Int(100),
+				VinExtra:       btcjson.Int(0),
+				Reverse:        btcjson.Bool(false),
+				FilterAddrs:    nil,
+				IncludeMempool: btcjson.Bool(true),
 			},
 		},
 		{
@@ -777,17 +1034,18 @@ func TestChainSvrCmds(t *testing.T) {
 			},
 			staticCmd: func() interface{} {
 				return btcjson.NewSearchRawTransactionsCmd("1Address",
-					btcjson.Int(0), btcjson.Int(5), nil, nil, nil, nil)
+					btcjson.Int(0), btcjson.Int(5), nil, nil, nil, nil, nil)
 			},
 			marshalled: `{"jsonrpc":"1.0","method":"searchrawtransactions","params":["1Address",0,5],"id":1}`,
 			unmarshalled: &btcjson.SearchRawTransactionsCmd{
-				Address:     "1Address",
-				Verbose:     btcjson.Int(0),
-				Skip:        btcjson.Int(5),
-				Count:       btcjson.Int(100),
-				VinExtra:    btcjson.Int(0),
-				Reverse:     btcjson.Bool(false),
-				FilterAddrs: nil,
+				Address:        "1Address",
+				Verbose:        btcjson.Int(0),
+				Skip:           btcjson.Int(5),
+				Count:          btcjson.Int(100),
+				VinExtra:       btcjson.Int(0),
+				Reverse:        btcjson.Bool(false),
+				FilterAddrs:    nil,
+				IncludeMempool: btcjson.Bool(true),
 			},
 		},
 		{
@@ -797,17 +1055,18 @@ func TestChainSvrCmds(t *testing.T) {
 			},
 			staticCmd: func() interface{} {
 				return btcjson.NewSearchRawTransactionsCmd("1Address",
-					btcjson.Int(0), btcjson.Int(5), btcjson.Int(10), nil, nil, nil)
+					btcjson.Int(0), btcjson.Int(5), btcjson.Int(10), nil, nil, nil, nil)
 			},
 			marshalled: `{"jsonrpc":"1.0","method":"searchrawtransactions","params":["1Address",0,5,10],"id":1}`,
 			unmarshalled: &btcjson.SearchRawTransactionsCmd{
-				Address:     "1Address",
-				Verbose:     btcjson.Int(0),
-				Skip:        btcjson.Int(5),
-				Count:       btcjson.Int(10),
-				VinExtra:    btcjson.Int(0),
-				Reverse:     btcjson.Bool(false),
-				FilterAddrs: nil,
+				Address:        "1Address",
+				Verbose:        btcjson.Int(0),
+				Skip:           btcjson.Int(5),
+				Count:          btcjson.Int(10),
+				VinExtra:       btcjson.Int(0),
+				Reverse:        btcjson.Bool(false),
+				FilterAddrs:    nil,
+				IncludeMempool: btcjson.Bool(true),
 			},
 		},
 		{
@@ -817,17 +1076,18 @@ func TestChainSvrCmds(t *testing.T) {
 			},
 			staticCmd: func() interface{} {
 				return btcjson.NewSearchRawTransactionsCmd("1Address",
-					btcjson.Int(0), btcjson.Int(5), btcjson.Int(10), btcjson.Int(1), nil, nil)
+					btcjson.Int(0), btcjson.Int(5), btcjson.Int(10), btcjson.Int(1), nil, nil, nil)
 			},
 			marshalled: `{"jsonrpc":"1.0","method":"searchrawtransactions","params":["1Address",0,5,10,1],"id":1}`,
 			unmarshalled: &btcjson.SearchRawTransactionsCmd{
-				Address:     "1Address",
-				Verbose:     btcjson.Int(0),
-				Skip:        btcjson.Int(5),
-				Count:       btcjson.Int(10),
-				VinExtra:    btcjson.Int(1),
-				Reverse:     btcjson.Bool(false),
-				FilterAddrs: nil,
+				Address:        "1Address",
+				Verbose:        btcjson.Int(0),
+				Skip:           btcjson.Int(5),
+				Count:          btcjson.Int(10),
+				VinExtra:       btcjson.Int(1),
+				Reverse:        btcjson.Bool(false),
+				FilterAddrs:    nil,
+				IncludeMempool: btcjson.Bool(true),
 			},
 		},
 		{
@@ -837,17 +1097,18 @@ func TestChainSvrCmds(t *testing.T) {
 			},
 			staticCmd: func() interface{} {
 				return btcjson.NewSearchRawTransactionsCmd("1Address",
-					btcjson.Int(0), btcjson.Int(5), btcjson.Int(10), btcjson.Int(1), btcjson.Bool(true), nil)
+					btcjson.Int(0), btcjson.Int(5), btcjson.Int(10), btcjson.Int(1), btcjson.Bool(true), nil, nil)
 			},
 			marshalled: `{"jsonrpc":"1.0","method":"searchrawtransactions","params":["1Address",0,5,10,1,true],"id":1}`,
 			unmarshalled: &btcjson.SearchRawTransactionsCmd{
-				Address:     "1Address",
-				Verbose:     btcjson.Int(0),
-				Skip:        btcjson.Int(5),
-				Count:       btcjson.Int(10),
-				VinExtra:    btcjson.Int(1),
-				Reverse:     btcjson.Bool(true),
-				FilterAddrs: nil,
+				Address:        "1Address",
+				Verbose:        btcjson.Int(0),
+				Skip:           btcjson.Int(5),
+				Count:          btcjson.Int(10),
+				VinExtra:       btcjson.Int(1),
+				Reverse:        btcjson.Bool(true),
+				FilterAddrs:    nil,
+				IncludeMempool: btcjson.Bool(true),
 			},
 		},
 		{
@@ -857,17 +1118,39 @@ func TestChainSvrCmds(t *testing.T) {
 			},
 			staticCmd: func() interface{} {
 				return btcjson.NewSearchRawTransactionsCmd("1Address",
-					btcjson.Int(0), btcjson.Int(5), btcjson.Int(10), btcjson.Int(1), btcjson.Bool(true), &[]string{"1Address"})
+					btcjson.Int(0), btcjson.Int(5), btcjson.Int(10), btcjson.Int(1), btcjson.Bool(true), &[]string{"1Address"}, nil)
 			},
 			marshalled: `{"jsonrpc":"1.0","method":"searchrawtransactions","params":["1Address",0,5,10,1,true,["1Address"]],"id":1}`,
 			unmarshalled: &btcjson.SearchRawTransactionsCmd{
-				Address:     "1Address",
-				Verbose:     btcjson.Int(0),
-				Skip:        btcjson.Int(5),
-				Count:       btcjson.Int(10),
-				VinExtra:    btcjson.Int(1),
-				Reverse:     btcjson.Bool(true),
-				FilterAddrs: &[]string{"1Address"},
+				Address:        "1Address",
+				Verbose:        btcjson.Int(0),
+				Skip:           btcjson.Int(5),
+				Count:          btcjson.Int(10),
+				VinExtra:       btcjson.Int(1),
+				Reverse:        btcjson.Bool(true),
+				FilterAddrs:    &[]string{"1Address"},
+				IncludeMempool: btcjson.Bool(true),
+			},
+		},
+		{
+			name: "searchrawtransactions",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("searchrawtransactions", "1Address", 0, 5, 10, 1, true, []string{"1Address"}, false)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewSearchRawTransactionsCmd("1Address",
+					btcjson.Int(0), btcjson.Int(5), btcjson.Int(10), btcjson.Int(1), btcjson.Bool(true), &[]string{"1Address"}, btcjson.Bool(false))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"searchrawtransactions","params":["1Address",0,5,10,1,true,["1Address"],false],"id":1}`,
+			unmarshalled: &btcjson.SearchRawTransactionsCmd{
+				Address:        "1Address",
+				Verbose:        btcjson.Int(0),
+				Skip:           btcjson.Int(5),
+				Count:          btcjson.Int(10),
+				VinExtra:       btcjson.Int(1),
+				Reverse:        btcjson.Bool(true),
+				FilterAddrs:    &[]string{"1Address"},
+				IncludeMempool: btcjson.Bool(false),
 			},
 		},
 		{
@@ -898,6 +1181,39 @@ func TestChainSvrCmds(t *testing.T) {
 				AllowHighFees: btcjson.Bool(false),
 			},
 		},
+		{
+			name: "setban",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("setban", "10.0.0.0/8", btcjson.SBAdd)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewSetBanCmd("10.0.0.0/8", btcjson.SBAdd, nil, nil)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"setban","params":["10.0.0.0/8","add"],"id":1}`,
+			unmarshalled: &btcjson.SetBanCmd{
+				SubNet:   "10.0.0.0/8",
+				SubCmd:   btcjson.SBAdd,
+				BanTime:  btcjson.Int64(0),
+				Absolute: btcjson.Bool(false),
+			},
+		},
+		{
+			name: "setban optional",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("setban", "10.0.0.1", btcjson.SBAdd, 1500000000, true)
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewSetBanCmd("10.0.0.1", btcjson.SBAdd,
+					btcjson.Int64(1500000000), btcjson.Bool(true))
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"setban","params":["10.0.0.1","add",1500000000,true],"id":1}`,
+			unmarshalled: &btcjson.SetBanCmd{
+				SubNet:   "10.0.0.1",
+				SubCmd:   btcjson.SBAdd,
+				BanTime:  btcjson.Int64(1500000000),
+				Absolute: btcjson.Bool(true),
+			},
+		},
 		{
 			name: "setgenerate",
 			newCmd: func() (interface{}, error) {
@@ -970,6 +1286,17 @@ func TestChainSvrCmds(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "uptime",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("uptime")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewUptimeCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"uptime","params":[],"id":1}`,
+			unmarshalled: &btcjson.UptimeCmd{},
+		},
 		{
 			name: "validateaddress",
 			newCmd: func() (interface{}, error) {
@@ -1174,3 +1501,87 @@ func TestChainSvrCmdErrors(t *testing.T) {
 		}
 	}
 }
+
+// getBlockVerbosity returns a pointer to the passed getblock verbosity level.
+func getBlockVerbosity(v btcjson.GetBlockVerbosity) *btcjson.GetBlockVerbosity {
+	return &v
+}
+
+// TestGetBlockVerbosityCompat ensures the getblock verbosity level accepts the
+// booleans of the former verbose flag as levels 0 and 1.
+func TestGetBlockVerbosityCompat(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		params    string
+		verbosity btcjson.GetBlockVerbosity
+	}{
+		{params: `["123",false]`, verbosity: btcjson.GetBlockVerbosityHex},
+		{params: `["123",true]`, verbosity: btcjson.GetBlockVerbosityTxIDs},
+		{params: `["123",0]`, verbosity: btcjson.GetBlockVerbosityHex},
+		{params: `["123",2]`, verbosity: btcjson.GetBlockVerbosityTxs},
+	}
+	for _, test := range tests {
+		data := `{"jsonrpc":"1.0","method":"getblock","params":` +
+			test.params + `,"id":1}`
+		var request btcjson.Request
+		if err := json.Unmarshal([]byte(data), &request); err != nil {
+			t.Errorf("%s: unexpected error: %v", test.params, err)
+			continue
+		}
+		cmd, err := btcjson.UnmarshalCmd(&request)
+		if err != nil {
+			t.Errorf("%s: UnmarshalCmd: unexpected error: %v",
+				test.params, err)
+			continue
+		}
+		verbosity := cmd.(*btcjson.GetBlockCmd).Verbosity
+		if verbosity == nil || *verbosity != test.verbosity {
+			t.Errorf("%s: got verbosity %v, want %v", test.params,
+				verbosity, test.verbosity)
+		}
+	}
+
+	request := btcjson.Request{
+		Jsonrpc: "1.0",
+		Method:  "getblock",
+		Params:  []json.RawMessage{[]byte(`"123"`), []byte(`"2"`)},
+	}
+	if _, err := btcjson.UnmarshalCmd(&request); err == nil {
+		t.Error("UnmarshalCmd: accepted string verbosity")
+	}
+
+	// Commands created with NewCmd, such as from command line arguments,
+	// accept the booleans and their string forms as well.
+	newCmdTests := []struct {
+		arg       interface{}
+		verbosity btcjson.GetBlockVerbosity
+	}{
+		{arg: false, verbosity: btcjson.GetBlockVerbosityHex},
+		{arg: true, verbosity: btcjson.GetBlockVerbosityTxIDs},
+		{arg: btcjson.Bool(true), verbosity: btcjson.GetBlockVerbosityTxIDs},
+		{arg: "false", verbosity: btcjson.GetBlockVerbosityHex},
+		{arg: "true", verbosity: btcjson.GetBlockVerbosityTxIDs},
+		{arg: "2", verbosity: btcjson.GetBlockVerbosityTxs},
+		{arg: 0, verbosity: btcjson.GetBlockVerbosityHex},
+	}
+	for _, test := range newCmdTests {
+		cmd, err := btcjson.NewCmd("getblock", "123", test.arg)
+		if err != nil {
+			t.Errorf("NewCmd(%v): unexpected error: %v", test.arg, err)
+			continue
+		}
+		verbosity := cmd.(*btcjson.GetBlockCmd).Verbosity
+		if verbosity == nil || *verbosity != test.verbosity {
+			t.Errorf("NewCmd(%v): got verbosity %v, want %v",
+				test.arg, verbosity, test.verbosity)
+		}
+	}
+	_, err := btcjson.NewCmd("getblock", "123", "verbose")
+	if jerr, ok := err.(btcjson.Error); !ok ||
+		jerr.ErrorCode != btcjson.ErrInvalidType {
+
+		t.Errorf("NewCmd: got error %v for an invalid verbosity, "+
+			"want %v", err, btcjson.ErrInvalidType)
+	}
+}
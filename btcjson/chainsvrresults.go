@@ -12,26 +12,45 @@ import "encoding/json"
 // returns a hex-encoded string.
 type GetBlockHeaderVerboseResult struct {
 	Hash             string  `json:"hash"`
-	Confirmations    uint64  `json:"confirmations"`
+	Confirmations    int64   `json:"confirmations"`
 	Height           int32   `json:"height"`
 	Version          uint32  `json:"version"`
 	MerkleRoot       string  `json:"merkleroot"`
 	Time             int64   `json:"time"`
+	MedianTime       int64   `json:"mediantime"`
 	Nonce            uint64  `json:"nonce"`
 	Bits             string  `json:"bits"`
 	Difficulty       float64 `json:"difficulty"`
+	ChainWork        string  `json:"chainwork"`
 	PreviousHash     string  `json:"previousblockhash,omitempty"`
 	NextHash         string  `json:"nextblockhash,omitempty"`
 	ValidatingPubKey string  `json:"validatingpubkey"`
+	SigKeyID         string  `json:"sigkeyid"`
 	Signature        string  `json:"signature,omitempty"`
 }
 
+// GetBlockStatsResult models the data from the getblockstats command.  Fields
+// that were not selected by the stats parameter are omitted.
+type GetBlockStatsResult struct {
+	Hash          *string `json:"blockhash,omitempty"`
+	Height        *int32  `json:"height,omitempty"`
+	TotalFee      *int64  `json:"totalfee,omitempty"`
+	FeePerKB      *int64  `json:"feeperkb,omitempty"`
+	MinFeeRate    *int64  `json:"minfeerate,omitempty"`
+	MedianFeeRate *int64  `json:"medianfeerate,omitempty"`
+	MaxFeeRate    *int64  `json:"maxfeerate,omitempty"`
+	Txs           *uint32 `json:"txs,omitempty"`
+	Ins           *uint32 `json:"ins,omitempty"`
+	Outs          *uint32 `json:"outs,omitempty"`
+	TotalSize     *uint32 `json:"totalsize,omitempty"`
+}
+
 // GetBlockVerboseResult models the data from the getblock command when the
-// verbose flag is set.  When the verbose flag is not set, getblock returns a
+// verbosity level is 1.  When the verbosity level is 0, getblock returns a
 // hex-encoded string.
 type GetBlockVerboseResult struct {
 	Hash             string        `json:"hash"`
-	Confirmations    uint64        `json:"confirmations"`
+	Confirmations    int64         `json:"confirmations"`
 	Size             int32         `json:"size"`
 	Height           int64         `json:"height"`
 	Version          uint32        `json:"version"`
@@ -39,12 +58,39 @@ type GetBlockVerboseResult struct {
 	Tx               []string      `json:"tx,omitempty"`
 	RawTx            []TxRawResult `json:"rawtx,omitempty"`
 	Time             int64         `json:"time"`
+	MedianTime       int64         `json:"mediantime"`
+	Nonce            uint64        `json:"nonce"`
+	Bits             string        `json:"bits"`
+	Difficulty       float64       `json:"difficulty"`
+	ChainWork        string        `json:"chainwork"`
+	PreviousHash     string        `json:"previousblockhash"`
+	NextHash         string        `json:"nextblockhash,omitempty"`
+	ValidatingPubKey string        `json:"validatingpubkey"`
+	SigKeyID         string        `json:"sigkeyid"`
+	Signature        string        `json:"signature,omitempty"`
+}
+
+// GetBlockVerboseTxResult models the data from the getblock command when the
+// verbosity level is 2.  It is identical to GetBlockVerboseResult except that
+// the decoded transactions are inlined in place of their ids.
+type GetBlockVerboseTxResult struct {
+	Hash             string        `json:"hash"`
+	Confirmations    int64         `json:"confirmations"`
+	Size             int32         `json:"size"`
+	Height           int64         `json:"height"`
+	Version          uint32        `json:"version"`
+	MerkleRoot       string        `json:"merkleroot"`
+	Tx               []TxRawResult `json:"tx"`
+	Time             int64         `json:"time"`
+	MedianTime       int64         `json:"mediantime"`
 	Nonce            uint64        `json:"nonce"`
 	Bits             string        `json:"bits"`
 	Difficulty       float64       `json:"difficulty"`
+	ChainWork        string        `json:"chainwork"`
 	PreviousHash     string        `json:"previousblockhash"`
 	NextHash         string        `json:"nextblockhash,omitempty"`
 	ValidatingPubKey string        `json:"validatingpubkey"`
+	SigKeyID         string        `json:"sigkeyid"`
 	Signature        string        `json:"signature,omitempty"`
 }
 
@@ -55,13 +101,48 @@ type CreateMultiSigResult struct {
 	RedeemScript string `json:"redeemScript"`
 }
 
+// CreateRawTransactionResult models the data returned from the
+// createrawtransaction command when verbose is set.
+type CreateRawTransactionResult struct {
+	Hex string  `json:"hex"`
+	Fee float64 `json:"fee"`
+}
+
 // DecodeScriptResult models the data returned from the decodescript command.
 type DecodeScriptResult struct {
 	Asm       string   `json:"asm"`
 	ReqSigs   int32    `json:"reqSigs,omitempty"`
 	Type      string   `json:"type"`
+	KeyIDs    []uint32 `json:"keyIDs,omitempty"`
+	Thread    string   `json:"thread,omitempty"`
+	AdminOp   string   `json:"adminOp,omitempty"`
 	Addresses []string `json:"addresses,omitempty"`
-	P2sh      string   `json:"p2sh"`
+	P2sh      string   `json:"p2sh,omitempty"`
+}
+
+// EstimateSmartFeeResult models the data returned from the estimatesmartfee
+// command.  The fee rates are in RMG/kB.  FeeRate is omitted and Errors is
+// populated when there is not enough data to produce an estimate.
+type EstimateSmartFeeResult struct {
+	FeeRate       *float64 `json:"feerate,omitempty"`
+	MempoolMinFee float64  `json:"mempoolminfee"`
+	Errors        []string `json:"errors,omitempty"`
+	Blocks        int64    `json:"blocks"`
+}
+
+// FundRawTransactionResult models the data returned from the
+// fundrawtransaction command.  The change position is -1 when no change
+// output was added.
+type FundRawTransactionResult struct {
+	Hex       string  `json:"hex"`
+	Fee       float64 `json:"fee"`
+	FeeRate   float64 `json:"feerate"`
+	ChangePos int     `json:"changepos"`
+}
+
+// GenerateBlockResult models the data returned from the generateblock command.
+type GenerateBlockResult struct {
+	Hash string `json:"hash"`
 }
 
 // GetAddedNodeInfoResultAddr models the data of the addresses portion of the
@@ -75,6 +156,8 @@ type GetAddedNodeInfoResultAddr struct {
 type GetAddedNodeInfoResult struct {
 	AddedNode string                        `json:"addednode"`
 	Connected *bool                         `json:"connected,omitempty"`
+	ConnState string                        `json:"connstate"`
+	Retries   uint32                        `json:"retries"`
 	Addresses *[]GetAddedNodeInfoResultAddr `json:"addresses,omitempty"`
 }
 
@@ -106,16 +189,94 @@ type GetAdminInfoResult struct {
 	ASPKeys       []ASPKeyIdResult  `json:"aspkeys,omitempty"`
 }
 
+// ValidatorInfoResult models the data of a single validate key returned from
+// the getvalidatorinfo command.
+type ValidatorInfoResult struct {
+	PubKey          string   `json:"pubkey"`
+	WindowBlocks    int      `json:"windowblocks"`
+	TrailingBlocks  int      `json:"trailingblocks"`
+	CanSign         bool     `json:"cansign"`
+	RecentHeights   []uint32 `json:"recentheights"`
+	LookbackHeights []uint32 `json:"lookbackheights,omitempty"`
+}
+
+// GetValidatorInfoResult models the data returned from the getvalidatorinfo
+// command.
+type GetValidatorInfoResult struct {
+	Hash       string                `json:"hash"`
+	Height     uint32                `json:"height"`
+	WindowSize int                   `json:"windowsize"`
+	MaxBlocks  int                   `json:"maxblocks"`
+	Lookback   int                   `json:"lookback,omitempty"`
+	Validators []ValidatorInfoResult `json:"validators"`
+}
+
+// ValidatorAdminResult models the data returned from the provisionvalidator
+// and revokevalidator commands.
+type ValidatorAdminResult struct {
+	TxID         string   `json:"txid"`
+	Hex          string   `json:"hex,omitempty"`
+	Complete     bool     `json:"complete"`
+	ValidateKeys []string `json:"validatekeys"`
+}
+
+// GetChainTipsResult models the data of a single branch tip returned from the
+// getchaintips command.
+type GetChainTipsResult struct {
+	Height    uint32 `json:"height"`
+	Hash      string `json:"hash"`
+	BranchLen uint32 `json:"branchlen"`
+	Status    string `json:"status"`
+}
+
 // GetBlockChainInfoResult models the data returned from the getblockchaininfo
 // command.
 type GetBlockChainInfoResult struct {
-	Chain                string  `json:"chain"`
-	Blocks               int32   `json:"blocks"`
-	Headers              int32   `json:"headers"`
-	BestBlockHash        string  `json:"bestblockhash"`
-	Difficulty           float64 `json:"difficulty"`
-	VerificationProgress float64 `json:"verificationprogress"`
-	ChainWork            string  `json:"chainwork"`
+	Chain                string                 `json:"chain"`
+	Blocks               int32                  `json:"blocks"`
+	Headers              int32                  `json:"headers"`
+	BestBlockHash        string                 `json:"bestblockhash"`
+	Difficulty           float64                `json:"difficulty"`
+	VerificationProgress float64                `json:"verificationprogress"`
+	ChainWork            string                 `json:"chainwork"`
+	Window               DifficultyWindowResult `json:"window"`
+	Deployments          []DeploymentResult     `json:"deployments"`
+	VersionRollouts      []VersionRolloutResult `json:"versionrollouts"`
+}
+
+// DeploymentResult models the state of a consensus deployment activated by
+// height returned by the getblockchaininfo command.  The activation height is
+// omitted when the deployment is not scheduled.
+type DeploymentResult struct {
+	ID               string  `json:"id"`
+	Active           bool    `json:"active"`
+	ActivationHeight *uint32 `json:"activationheight,omitempty"`
+	ActivationTime   int64   `json:"activationtime"`
+}
+
+// VersionRolloutResult models the state of a rule change rolled out by block
+// version returned by the getblockchaininfo command.
+type VersionRolloutResult struct {
+	ID               string `json:"id"`
+	Version          uint32 `json:"version"`
+	Status           string `json:"status"`
+	Since            uint32 `json:"since"`
+	SinceTime        int64  `json:"sincetime"`
+	Signaling        uint32 `json:"signaling"`
+	Window           uint32 `json:"window"`
+	EnforceThreshold uint32 `json:"enforcethreshold"`
+	RejectThreshold  uint32 `json:"rejectthreshold"`
+}
+
+// DifficultyWindowResult models the averaging window of the difficulty
+// adjustment returned by the getblockchaininfo and getmininginfo commands.
+// The timespans are in seconds.
+type DifficultyWindowResult struct {
+	Blocks         int32   `json:"blocks"`
+	ActualTimespan int64   `json:"actualtimespan"`
+	TargetTimespan int64   `json:"targettimespan"`
+	NextBits       string  `json:"nextbits"`
+	NextDifficulty float64 `json:"nextdifficulty"`
 }
 
 // GetBlockTemplateResultTx models the transactions field of the
@@ -175,27 +336,53 @@ type GetBlockTemplateResult struct {
 // GetMempoolEntryResult models the data returned from the getmempoolentry
 // command.
 type GetMempoolEntryResult struct {
-	Size             int32    `json:"size"`
-	Fee              float64  `json:"fee"`
-	ModifiedFee      float64  `json:"modifiedfee"`
-	Time             int64    `json:"time"`
-	Height           int64    `json:"height"`
-	StartingPriority float64  `json:"startingpriority"`
-	CurrentPriority  float64  `json:"currentpriority"`
-	DescendantCount  int64    `json:"descendantcount"`
-	DescendantSize   int64    `json:"descendantsize"`
-	DescendantFees   float64  `json:"descendantfees"`
-	AncestorCount    int64    `json:"ancestorcount"`
-	AncestorSize     int64    `json:"ancestorsize"`
-	AncestorFees     float64  `json:"ancestorfees"`
-	Depends          []string `json:"depends"`
+	Size              int32    `json:"size"`
+	Fee               float64  `json:"fee"`
+	ModifiedFee       float64  `json:"modifiedfee"`
+	FeeRate           float64  `json:"feerate"`
+	Time              int64    `json:"time"`
+	Height            int64    `json:"height"`
+	StartingPriority  float64  `json:"startingpriority"`
+	CurrentPriority   float64  `json:"currentpriority"`
+	DescendantCount   int64    `json:"descendantcount"`
+	DescendantSize    int64    `json:"descendantsize"`
+	DescendantFees    float64  `json:"descendantfees"`
+	AncestorCount     int64    `json:"ancestorcount"`
+	AncestorSize      int64    `json:"ancestorsize"`
+	AncestorFees      float64  `json:"ancestorfees"`
+	Depends           []string `json:"depends"`
+	SpentBy           []string `json:"spentby"`
+	BIP125Replaceable bool     `json:"bip125-replaceable"`
 }
 
 // GetMempoolInfoResult models the data returned from the getmempoolinfo
 // command.
 type GetMempoolInfoResult struct {
-	Size  int64 `json:"size"`
-	Bytes int64 `json:"bytes"`
+	Size          int64   `json:"size"`
+	Bytes         int64   `json:"bytes"`
+	MempoolMinFee float64 `json:"mempoolminfee"`
+	MinRelayTxFee float64 `json:"minrelaytxfee"`
+}
+
+// MetricBucketResult models a bucket of a histogram returned by the getmetrics
+// command.  The upper bound is formatted as in the Prometheus text format, so
+// the last bucket has the upper bound "+Inf".
+type MetricBucketResult struct {
+	UpperBound string `json:"le"`
+	Count      uint64 `json:"count"`
+}
+
+// GetMetricsResult models a metric returned by the getmetrics command.
+// Counters and gauges have a value, while histograms have a count, a sum and
+// cumulative buckets.
+type GetMetricsResult struct {
+	Name    string               `json:"name"`
+	Type    string               `json:"type"`
+	Help    string               `json:"help"`
+	Value   *float64             `json:"value,omitempty"`
+	Count   *uint64              `json:"count,omitempty"`
+	Sum     *float64             `json:"sum,omitempty"`
+	Buckets []MetricBucketResult `json:"buckets,omitempty"`
 }
 
 // GetNetworkInfoResult models the data returned from the getnetworkinfo
@@ -210,42 +397,95 @@ type GetNetworkInfoResult struct {
 	LocalAddresses  []LocalAddressesResult `json:"localaddresses"`
 }
 
+// MsgTrafficResult models the number of messages of a command and their total
+// size in bytes, which are returned from the getpeerinfo and getnettotals
+// commands.
+type MsgTrafficResult struct {
+	Count uint64 `json:"count"`
+	Bytes uint64 `json:"bytes"`
+}
+
 // GetPeerInfoResult models the data returned from the getpeerinfo command.
 type GetPeerInfoResult struct {
-	ID             int32   `json:"id"`
-	Addr           string  `json:"addr"`
-	AddrLocal      string  `json:"addrlocal,omitempty"`
-	Services       string  `json:"services"`
-	RelayTxes      bool    `json:"relaytxes"`
-	LastSend       int64   `json:"lastsend"`
-	LastRecv       int64   `json:"lastrecv"`
-	BytesSent      uint64  `json:"bytessent"`
-	BytesRecv      uint64  `json:"bytesrecv"`
-	ConnTime       int64   `json:"conntime"`
-	TimeOffset     int64   `json:"timeoffset"`
-	PingTime       float64 `json:"pingtime"`
-	PingWait       float64 `json:"pingwait,omitempty"`
-	Version        uint32  `json:"version"`
-	SubVer         string  `json:"subver"`
-	Inbound        bool    `json:"inbound"`
-	StartingHeight uint32  `json:"startingheight"`
-	CurrentHeight  uint32  `json:"currentheight,omitempty"`
-	BanScore       int32   `json:"banscore"`
-	FeeFilter      int64   `json:"feefilter"`
-	SyncNode       bool    `json:"syncnode"`
+	ID             int32    `json:"id"`
+	Addr           string   `json:"addr"`
+	AddrLocal      string   `json:"addrlocal,omitempty"`
+	Services       string   `json:"services"`
+	RelayTxes      bool     `json:"relaytxes"`
+	LastSend       int64    `json:"lastsend"`
+	LastRecv       int64    `json:"lastrecv"`
+	BytesSent      uint64   `json:"bytessent"`
+	BytesRecv      uint64   `json:"bytesrecv"`
+	ConnTime       int64    `json:"conntime"`
+	TimeOffset     int64    `json:"timeoffset"`
+	PingTime       float64  `json:"pingtime"`
+	PingWait       float64  `json:"pingwait,omitempty"`
+	MinPing        float64  `json:"minping"`
+	AvgPing        float64  `json:"avgping"`
+	Version        uint32   `json:"version"`
+	SubVer         string   `json:"subver"`
+	Inbound        bool     `json:"inbound"`
+	NetworkGroup   string   `json:"networkgroup"`
+	StartingHeight uint32   `json:"startingheight"`
+	CurrentHeight  uint32   `json:"currentheight,omitempty"`
+	BanScore       int32    `json:"banscore"`
+	FeeFilter      int64    `json:"feefilter"`
+	Capabilities   []string `json:"capabilities"`
+	SyncNode       bool     `json:"syncnode"`
+	LastBlock      int64    `json:"lastblock"`
+	LastTx         int64    `json:"lasttransaction"`
+
+	BlocksAnnounced uint64 `json:"blocksannounced"`
+	TxsAnnounced    uint64 `json:"txsannounced"`
+	KnownInvSkipped uint64 `json:"knowninvskipped"`
+
+	SentPerMsg map[string]MsgTrafficResult `json:"sentpermsg"`
+	RecvPerMsg map[string]MsgTrafficResult `json:"recvpermsg"`
+}
+
+// GetPendingBroadcastsResult models a transaction returned by the
+// getpendingbroadcasts command.  The times are in seconds since 1 Jan 1970
+// GMT.
+type GetPendingBroadcastsResult struct {
+	TxID          string `json:"txid"`
+	Added         int64  `json:"added"`
+	LastAnnounced int64  `json:"lastannounced"`
+	NextAnnounce  int64  `json:"nextannounce"`
+	Announcements uint32 `json:"announcements"`
+}
+
+// ListBannedResult models the data returned from the listbanned command.
+type ListBannedResult struct {
+	Address     string `json:"address"`
+	BannedUntil int64  `json:"banned_until"`
+	BanCreated  int64  `json:"ban_created"`
+	BanReason   string `json:"ban_reason"`
 }
 
 // GetRawMempoolVerboseResult models the data returned from the getrawmempool
 // command when the verbose flag is set.  When the verbose flag is not set,
 // getrawmempool returns an array of transaction hashes.
+//
+// The fields are kept identical to GetMempoolEntryResult so each entry can be
+// converted from the result of getmempoolentry.
 type GetRawMempoolVerboseResult struct {
-	Size             int32    `json:"size"`
-	Fee              float64  `json:"fee"`
-	Time             int64    `json:"time"`
-	Height           int64    `json:"height"`
-	StartingPriority float64  `json:"startingpriority"`
-	CurrentPriority  float64  `json:"currentpriority"`
-	Depends          []string `json:"depends"`
+	Size              int32    `json:"size"`
+	Fee               float64  `json:"fee"`
+	ModifiedFee       float64  `json:"modifiedfee"`
+	FeeRate           float64  `json:"feerate"`
+	Time              int64    `json:"time"`
+	Height            int64    `json:"height"`
+	StartingPriority  float64  `json:"startingpriority"`
+	CurrentPriority   float64  `json:"currentpriority"`
+	DescendantCount   int64    `json:"descendantcount"`
+	DescendantSize    int64    `json:"descendantsize"`
+	DescendantFees    float64  `json:"descendantfees"`
+	AncestorCount     int64    `json:"ancestorcount"`
+	AncestorSize      int64    `json:"ancestorsize"`
+	AncestorFees      float64  `json:"ancestorfees"`
+	Depends           []string `json:"depends"`
+	SpentBy           []string `json:"spentby"`
+	BIP125Replaceable bool     `json:"bip125-replaceable"`
 }
 
 // ScriptPubKeyResult models the scriptPubKey data of a tx script.  It is
@@ -255,6 +495,8 @@ type ScriptPubKeyResult struct {
 	Hex       string   `json:"hex,omitempty"`
 	ReqSigs   int32    `json:"reqSigs,omitempty"`
 	Type      string   `json:"type"`
+	KeyIDs    []uint32 `json:"keyIDs,omitempty"`
+	Thread    string   `json:"thread,omitempty"`
 	AdminOp   string   `json:"adminOp,omitempty"`
 	Addresses []string `json:"addresses,omitempty"`
 }
@@ -269,11 +511,59 @@ type GetTxOutResult struct {
 	Coinbase      bool               `json:"coinbase"`
 }
 
+// GetTxOutSetInfoResult models the data from the gettxoutsetinfo command.
+type GetTxOutSetInfoResult struct {
+	Height          int32   `json:"height"`
+	BestBlock       string  `json:"bestblock"`
+	TxOuts          uint64  `json:"txouts"`
+	BytesSerialized uint64  `json:"bytes_serialized"`
+	HashSerialized  string  `json:"hash_serialized"`
+	TotalAmount     float64 `json:"total_amount"`
+}
+
+// DBBucketStatsResult models the storage used by a top-level database bucket in
+// the getdbstats command.
+type DBBucketStatsResult struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+// GetDBStatsResult models the data from the getdbstats command.
+type GetDBStatsResult struct {
+	Buckets        []DBBucketStatsResult `json:"buckets"`
+	MetadataFiles  int                   `json:"metadatafiles"`
+	MetadataSize   int64                 `json:"metadatasize"`
+	LevelFiles     []int                 `json:"levelfiles"`
+	ObsoleteFiles  int                   `json:"obsoletefiles"`
+	ObsoleteSize   int64                 `json:"obsoletesize"`
+	BlockFiles     int                   `json:"blockfiles"`
+	BlockFilesSize int64                 `json:"blockfilessize"`
+}
+
+// CompactDBResult models the data from the compactdb command.
+type CompactDBResult struct {
+	Bucket     string  `json:"bucket,omitempty"`
+	SizeBefore int64   `json:"sizebefore"`
+	SizeAfter  int64   `json:"sizeafter"`
+	Seconds    float64 `json:"seconds"`
+}
+
+// GetFinalizedHeightResult models the data from the getfinalizedheight
+// command.
+type GetFinalizedHeightResult struct {
+	Height int32  `json:"height"`
+	Hash   string `json:"hash"`
+}
+
 // GetNetTotalsResult models the data returned from the getnettotals command.
 type GetNetTotalsResult struct {
-	TotalBytesRecv uint64 `json:"totalbytesrecv"`
-	TotalBytesSent uint64 `json:"totalbytessent"`
-	TimeMillis     int64  `json:"timemillis"`
+	TotalBytesRecv   uint64 `json:"totalbytesrecv"`
+	TotalBytesSent   uint64 `json:"totalbytessent"`
+	TimeMillis       int64  `json:"timemillis"`
+	InboundEvictions uint64 `json:"inboundevictions"`
+
+	SentPerMsg map[string]MsgTrafficResult `json:"sentpermsg"`
+	RecvPerMsg map[string]MsgTrafficResult `json:"recvpermsg"`
 }
 
 // ScriptSig models a signature script.  It is defined separately since it only
@@ -385,19 +675,35 @@ type Vout struct {
 	ScriptPubKey ScriptPubKeyResult `json:"scriptPubKey"`
 }
 
+// GetMemoryInfoResult models the data from the getmemoryinfo command.
+type GetMemoryInfoResult struct {
+	HeapAlloc    uint64 `json:"heapalloc"`
+	HeapInUse    uint64 `json:"heapinuse"`
+	HeapIdle     uint64 `json:"heapidle"`
+	HeapReleased uint64 `json:"heapreleased"`
+	HeapObjects  uint64 `json:"heapobjects"`
+	Sys          uint64 `json:"sys"`
+	NumGC        uint32 `json:"numgc"`
+	GCPauseTotal int64  `json:"gcpausetotal"`
+	GCPauseLast  int64  `json:"gcpauselast"`
+	LastGC       int64  `json:"lastgc"`
+	Goroutines   int    `json:"goroutines"`
+}
+
 // GetMiningInfoResult models the data from the getmininginfo command.
 type GetMiningInfoResult struct {
-	Blocks           int64   `json:"blocks"`
-	CurrentBlockSize uint64  `json:"currentblocksize"`
-	CurrentBlockTx   uint64  `json:"currentblocktx"`
-	Difficulty       float64 `json:"difficulty"`
-	Errors           string  `json:"errors"`
-	Generate         bool    `json:"generate"`
-	GenProcLimit     int32   `json:"genproclimit"`
-	HashesPerSec     int64   `json:"hashespersec"`
-	NetworkHashPS    int64   `json:"networkhashps"`
-	PooledTx         uint64  `json:"pooledtx"`
-	TestNet          bool    `json:"testnet"`
+	Blocks           int64                  `json:"blocks"`
+	CurrentBlockSize uint64                 `json:"currentblocksize"`
+	CurrentBlockTx   uint64                 `json:"currentblocktx"`
+	Difficulty       float64                `json:"difficulty"`
+	Errors           string                 `json:"errors"`
+	Generate         bool                   `json:"generate"`
+	GenProcLimit     int32                  `json:"genproclimit"`
+	HashesPerSec     int64                  `json:"hashespersec"`
+	NetworkHashPS    int64                  `json:"networkhashps"`
+	PooledTx         uint64                 `json:"pooledtx"`
+	TestNet          bool                   `json:"testnet"`
+	Window           DifficultyWindowResult `json:"window"`
 }
 
 // GetWorkResult models the data from the getwork command.
@@ -438,6 +744,18 @@ type NetworksResult struct {
 	Proxy     string `json:"proxy"`
 }
 
+// RPCCommandResult models the data of a command which is being executed by
+// the RPC server in the getrpcinfo command.
+type RPCCommandResult struct {
+	Method   string `json:"method"`
+	Duration int64  `json:"duration"`
+}
+
+// GetRPCInfoResult models the data from the getrpcinfo command.
+type GetRPCInfoResult struct {
+	ActiveCommands []RPCCommandResult `json:"active_commands"`
+}
+
 // TxRawResult models the data from the getrawtransaction command.
 type TxRawResult struct {
 	Hex           string `json:"hex"`
@@ -479,6 +797,10 @@ type TxRawDecodeResult struct {
 // ValidateAddressChainResult models the data returned by the chain server
 // validateaddress command.
 type ValidateAddressChainResult struct {
-	IsValid bool   `json:"isvalid"`
-	Address string `json:"address,omitempty"`
+	IsValid       bool     `json:"isvalid"`
+	Address       string   `json:"address,omitempty"`
+	Type          string   `json:"type,omitempty"`
+	KeyIDs        []uint32 `json:"keyids,omitempty"`
+	ScriptPubKey  string   `json:"scriptpubkey,omitempty"`
+	IsForOtherNet bool     `json:"isforothernet,omitempty"`
 }
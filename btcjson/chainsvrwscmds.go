@@ -41,6 +41,44 @@ func NewStopNotifyBlocksCmd() *StopNotifyBlocksCmd {
 	return &StopNotifyBlocksCmd{}
 }
 
+// NotifyValidatorSetCmd defines the notifyvalidatorset JSON-RPC command.
+type NotifyValidatorSetCmd struct{}
+
+// NewNotifyValidatorSetCmd returns a new instance which can be used to issue a
+// notifyvalidatorset JSON-RPC command.
+func NewNotifyValidatorSetCmd() *NotifyValidatorSetCmd {
+	return &NotifyValidatorSetCmd{}
+}
+
+// StopNotifyValidatorSetCmd defines the stopnotifyvalidatorset JSON-RPC
+// command.
+type StopNotifyValidatorSetCmd struct{}
+
+// NewStopNotifyValidatorSetCmd returns a new instance which can be used to
+// issue a stopnotifyvalidatorset JSON-RPC command.
+func NewStopNotifyValidatorSetCmd() *StopNotifyValidatorSetCmd {
+	return &StopNotifyValidatorSetCmd{}
+}
+
+// NotifyAdminThreadsCmd defines the notifyadminthreads JSON-RPC command.
+type NotifyAdminThreadsCmd struct{}
+
+// NewNotifyAdminThreadsCmd returns a new instance which can be used to issue a
+// notifyadminthreads JSON-RPC command.
+func NewNotifyAdminThreadsCmd() *NotifyAdminThreadsCmd {
+	return &NotifyAdminThreadsCmd{}
+}
+
+// StopNotifyAdminThreadsCmd defines the stopnotifyadminthreads JSON-RPC
+// command.
+type StopNotifyAdminThreadsCmd struct{}
+
+// NewStopNotifyAdminThreadsCmd returns a new instance which can be used to
+// issue a stopnotifyadminthreads JSON-RPC command.
+func NewStopNotifyAdminThreadsCmd() *StopNotifyAdminThreadsCmd {
+	return &StopNotifyAdminThreadsCmd{}
+}
+
 // NotifyNewTransactionsCmd defines the notifynewtransactions JSON-RPC command.
 type NotifyNewTransactionsCmd struct {
 	Verbose *bool `jsonrpcdefault:"false"`
@@ -227,15 +265,19 @@ func init() {
 
 	MustRegisterCmd("authenticate", (*AuthenticateCmd)(nil), flags)
 	MustRegisterCmd("loadtxfilter", (*LoadTxFilterCmd)(nil), flags)
+	MustRegisterCmd("notifyadminthreads", (*NotifyAdminThreadsCmd)(nil), flags)
 	MustRegisterCmd("notifyblocks", (*NotifyBlocksCmd)(nil), flags)
 	MustRegisterCmd("notifynewtransactions", (*NotifyNewTransactionsCmd)(nil), flags)
 	MustRegisterCmd("notifyreceived", (*NotifyReceivedCmd)(nil), flags)
 	MustRegisterCmd("notifyspent", (*NotifySpentCmd)(nil), flags)
+	MustRegisterCmd("notifyvalidatorset", (*NotifyValidatorSetCmd)(nil), flags)
 	MustRegisterCmd("session", (*SessionCmd)(nil), flags)
+	MustRegisterCmd("stopnotifyadminthreads", (*StopNotifyAdminThreadsCmd)(nil), flags)
 	MustRegisterCmd("stopnotifyblocks", (*StopNotifyBlocksCmd)(nil), flags)
 	MustRegisterCmd("stopnotifynewtransactions", (*StopNotifyNewTransactionsCmd)(nil), flags)
 	MustRegisterCmd("stopnotifyspent", (*StopNotifySpentCmd)(nil), flags)
 	MustRegisterCmd("stopnotifyreceived", (*StopNotifyReceivedCmd)(nil), flags)
+	MustRegisterCmd("stopnotifyvalidatorset", (*StopNotifyValidatorSetCmd)(nil), flags)
 	MustRegisterCmd("rescan", (*RescanCmd)(nil), flags)
 	MustRegisterCmd("rescanblocks", (*RescanBlocksCmd)(nil), flags)
 }
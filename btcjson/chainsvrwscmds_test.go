@@ -63,6 +63,50 @@ func TestChainSvrWsCmds(t *testing.T) {
 			marshalled:   `{"jsonrpc":"1.0","method":"stopnotifyblocks","params":[],"id":1}`,
 			unmarshalled: &btcjson.StopNotifyBlocksCmd{},
 		},
+		{
+			name: "notifyvalidatorset",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("notifyvalidatorset")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewNotifyValidatorSetCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"notifyvalidatorset","params":[],"id":1}`,
+			unmarshalled: &btcjson.NotifyValidatorSetCmd{},
+		},
+		{
+			name: "stopnotifyvalidatorset",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("stopnotifyvalidatorset")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewStopNotifyValidatorSetCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"stopnotifyvalidatorset","params":[],"id":1}`,
+			unmarshalled: &btcjson.StopNotifyValidatorSetCmd{},
+		},
+		{
+			name: "notifyadminthreads",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("notifyadminthreads")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewNotifyAdminThreadsCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"notifyadminthreads","params":[],"id":1}`,
+			unmarshalled: &btcjson.NotifyAdminThreadsCmd{},
+		},
+		{
+			name: "stopnotifyadminthreads",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("stopnotifyadminthreads")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewStopNotifyAdminThreadsCmd()
+			},
+			marshalled:   `{"jsonrpc":"1.0","method":"stopnotifyadminthreads","params":[],"id":1}`,
+			unmarshalled: &btcjson.StopNotifyAdminThreadsCmd{},
+		},
 		{
 			name: "notifynewtransactions",
 			newCmd: func() (interface{}, error) {
@@ -31,6 +31,23 @@ const (
 	// disconnected.
 	FilteredBlockDisconnectedNtfnMethod = "filteredblockdisconnected"
 
+	// ReorganizationNtfnMethod is the method used for notifications from the
+	// chain server that the main chain has been reorganized.  It is sent
+	// once per reorganization after the individual block connected and
+	// disconnected notifications.
+	ReorganizationNtfnMethod = "reorganization"
+
+	// ValidatorSetChangedNtfnMethod is the method used for notifications
+	// from the chain server that a validate key was added to or revoked
+	// from the validator set by a block connected to or disconnected from
+	// the main chain.
+	ValidatorSetChangedNtfnMethod = "validatorsetchanged"
+
+	// AdminThreadTipNtfnMethod is the method used for notifications from
+	// the chain server that the tip of an admin thread moved due to a block
+	// connected to or disconnected from the main chain.
+	AdminThreadTipNtfnMethod = "adminthreadtip"
+
 	// RecvTxNtfnMethod is the legacy, deprecated method used for
 	// notifications from the chain server that a transaction which pays to
 	// a registered address has been processed.
@@ -75,6 +92,24 @@ const (
 	// from the chain server that inform a client that a transaction that
 	// matches the loaded filter was accepted by the mempool.
 	RelevantTxAcceptedNtfnMethod = "relevanttxaccepted"
+
+	// ReorgTxNtfnMethod is the method used for notifications from the
+	// chain server that a transaction of a block disconnected by a
+	// reorganization was either added back to the mempool or dropped since
+	// it conflicts with the new main chain.
+	ReorgTxNtfnMethod = "reorgtx"
+)
+
+// The reasons a reorgtx notification is sent for.
+const (
+	// ReorgTxResurrected is the reason sent when the transaction was added
+	// back to the mempool.
+	ReorgTxResurrected = "resurrected"
+
+	// ReorgTxConflicted is the reason sent when the transaction was not
+	// added back to the mempool since it conflicts with the new main
+	// chain.
+	ReorgTxConflicted = "conflicted"
 )
 
 // BlockConnectedNtfn defines the blockconnected JSON-RPC notification.
@@ -153,6 +188,27 @@ func NewFilteredBlockDisconnectedNtfn(height int32, header string) *FilteredBloc
 	}
 }
 
+// ReorganizationNtfn defines the reorganization JSON-RPC notification.  The
+// detached hashes are ordered from the old tip back to the fork point and the
+// attached hashes are ordered from the fork point up to the new tip.
+type ReorganizationNtfn struct {
+	ForkHash       string
+	ForkHeight     int32
+	DetachedHashes []string
+	AttachedHashes []string
+}
+
+// NewReorganizationNtfn returns a new instance which can be used to issue a
+// reorganization JSON-RPC notification.
+func NewReorganizationNtfn(forkHash string, forkHeight int32, detachedHashes, attachedHashes []string) *ReorganizationNtfn {
+	return &ReorganizationNtfn{
+		ForkHash:       forkHash,
+		ForkHeight:     forkHeight,
+		DetachedHashes: detachedHashes,
+		AttachedHashes: attachedHashes,
+	}
+}
+
 // BlockDetails describes details of a tx in a block.
 type BlockDetails struct {
 	Height int32  `json:"height"`
@@ -161,6 +217,78 @@ type BlockDetails struct {
 	Time   int64  `json:"time"`
 }
 
+// ValidatorSetChangedNtfn defines the validatorsetchanged JSON-RPC
+// notification.  The operation is the one carried by the admin transaction,
+// so a disconnected block undoes it.  Validate keys are identified by the
+// hex-encoded hash160 of their compressed public key.
+type ValidatorSetChangedNtfn struct {
+	Operation string
+	KeyID     string
+	PubKey    string
+	TxID      string
+	BlockHash string
+	Height    int32
+	Connected bool
+}
+
+// NewValidatorSetChangedNtfn returns a new instance which can be used to issue
+// a validatorsetchanged JSON-RPC notification.
+func NewValidatorSetChangedNtfn(operation, keyID, pubKey, txID, blockHash string,
+	height int32, connected bool) *ValidatorSetChangedNtfn {
+
+	return &ValidatorSetChangedNtfn{
+		Operation: operation,
+		KeyID:     keyID,
+		PubKey:    pubKey,
+		TxID:      txID,
+		BlockHash: blockHash,
+		Height:    height,
+		Connected: connected,
+	}
+}
+
+// AdminKeyOp describes a single key operation of an admin transaction.  The
+// key ID is only set for ASP keys.
+type AdminKeyOp struct {
+	Operation string `json:"operation"`
+	KeySet    string `json:"keyset"`
+	PubKey    string `json:"pubkey"`
+	KeyID     uint32 `json:"keyid,omitempty"`
+}
+
+// AdminThreadTipNtfn defines the adminthreadtip JSON-RPC notification.  The
+// tip is the outpoint the thread continues from after the admin transaction
+// was connected or disconnected, and the key operations are those carried by
+// the transaction.
+type AdminThreadTipNtfn struct {
+	ThreadID  uint32
+	Thread    string
+	Tip       string
+	TxID      string
+	Ops       []AdminKeyOp
+	BlockHash string
+	Height    int32
+	Connected bool
+}
+
+// NewAdminThreadTipNtfn returns a new instance which can be used to issue an
+// adminthreadtip JSON-RPC notification.
+func NewAdminThreadTipNtfn(threadID uint32, thread, tip, txID string,
+	ops []AdminKeyOp, blockHash string, height int32,
+	connected bool) *AdminThreadTipNtfn {
+
+	return &AdminThreadTipNtfn{
+		ThreadID:  threadID,
+		Thread:    thread,
+		Tip:       tip,
+		TxID:      txID,
+		Ops:       ops,
+		BlockHash: blockHash,
+		Height:    height,
+		Connected: connected,
+	}
+}
+
 // RecvTxNtfn defines the recvtx JSON-RPC notification.
 //
 // NOTE: Deprecated. Use RelevantTxAcceptedNtfn and FilteredBlockConnectedNtfn
@@ -285,6 +413,22 @@ func NewRelevantTxAcceptedNtfn(txHex string) *RelevantTxAcceptedNtfn {
 	return &RelevantTxAcceptedNtfn{Transaction: txHex}
 }
 
+// ReorgTxNtfn defines the reorgtx JSON-RPC notification.  The reason is either
+// ReorgTxResurrected or ReorgTxConflicted.
+type ReorgTxNtfn struct {
+	TxID   string
+	Reason string
+}
+
+// NewReorgTxNtfn returns a new instance which can be used to issue a reorgtx
+// JSON-RPC notification.
+func NewReorgTxNtfn(txHash string, reason string) *ReorgTxNtfn {
+	return &ReorgTxNtfn{
+		TxID:   txHash,
+		Reason: reason,
+	}
+}
+
 func init() {
 	// The commands in this file are only usable by websockets and are
 	// notifications.
@@ -294,6 +438,9 @@ func init() {
 	MustRegisterCmd(BlockDisconnectedNtfnMethod, (*BlockDisconnectedNtfn)(nil), flags)
 	MustRegisterCmd(FilteredBlockConnectedNtfnMethod, (*FilteredBlockConnectedNtfn)(nil), flags)
 	MustRegisterCmd(FilteredBlockDisconnectedNtfnMethod, (*FilteredBlockDisconnectedNtfn)(nil), flags)
+	MustRegisterCmd(ReorganizationNtfnMethod, (*ReorganizationNtfn)(nil), flags)
+	MustRegisterCmd(ValidatorSetChangedNtfnMethod, (*ValidatorSetChangedNtfn)(nil), flags)
+	MustRegisterCmd(AdminThreadTipNtfnMethod, (*AdminThreadTipNtfn)(nil), flags)
 	MustRegisterCmd(RecvTxNtfnMethod, (*RecvTxNtfn)(nil), flags)
 	MustRegisterCmd(RedeemingTxNtfnMethod, (*RedeemingTxNtfn)(nil), flags)
 	MustRegisterCmd(RescanFinishedNtfnMethod, (*RescanFinishedNtfn)(nil), flags)
@@ -301,4 +448,5 @@ func init() {
 	MustRegisterCmd(TxAcceptedNtfnMethod, (*TxAcceptedNtfn)(nil), flags)
 	MustRegisterCmd(TxAcceptedVerboseNtfnMethod, (*TxAcceptedVerboseNtfn)(nil), flags)
 	MustRegisterCmd(RelevantTxAcceptedNtfnMethod, (*RelevantTxAcceptedNtfn)(nil), flags)
+	MustRegisterCmd(ReorgTxNtfnMethod, (*ReorgTxNtfn)(nil), flags)
 }
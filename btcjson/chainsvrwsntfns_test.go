@@ -88,6 +88,72 @@ func TestChainSvrWsNtfns(t *testing.T) {
 				Header: "header",
 			},
 		},
+		{
+			name: "reorganization",
+			newNtfn: func() (interface{}, error) {
+				return btcjson.NewCmd("reorganization", "123", 100000, []string{"3", "2"}, []string{"2a", "3a", "4a"})
+			},
+			staticNtfn: func() interface{} {
+				return btcjson.NewReorganizationNtfn("123", 100000, []string{"3", "2"}, []string{"2a", "3a", "4a"})
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"reorganization","params":["123",100000,["3","2"],["2a","3a","4a"]],"id":null}`,
+			unmarshalled: &btcjson.ReorganizationNtfn{
+				ForkHash:       "123",
+				ForkHeight:     100000,
+				DetachedHashes: []string{"3", "2"},
+				AttachedHashes: []string{"2a", "3a", "4a"},
+			},
+		},
+		{
+			name: "validatorsetchanged",
+			newNtfn: func() (interface{}, error) {
+				return btcjson.NewCmd("validatorsetchanged", "ADD_KEY", "0a1b", "02ab", "123", "456", 100000, true)
+			},
+			staticNtfn: func() interface{} {
+				return btcjson.NewValidatorSetChangedNtfn("ADD_KEY", "0a1b", "02ab", "123", "456", 100000, true)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"validatorsetchanged","params":["ADD_KEY","0a1b","02ab","123","456",100000,true],"id":null}`,
+			unmarshalled: &btcjson.ValidatorSetChangedNtfn{
+				Operation: "ADD_KEY",
+				KeyID:     "0a1b",
+				PubKey:    "02ab",
+				TxID:      "123",
+				BlockHash: "456",
+				Height:    100000,
+				Connected: true,
+			},
+		},
+		{
+			name: "adminthreadtip",
+			newNtfn: func() (interface{}, error) {
+				return btcjson.NewCmd("adminthreadtip", 1, "provision", "123:0", "123", `[{"operation":"REVOKE_KEY","keyset":"ASP","pubkey":"02ab","keyid":7}]`, "456", 100000, false)
+			},
+			staticNtfn: func() interface{} {
+				ops := []btcjson.AdminKeyOp{{
+					Operation: "REVOKE_KEY",
+					KeySet:    "ASP",
+					PubKey:    "02ab",
+					KeyID:     7,
+				}}
+				return btcjson.NewAdminThreadTipNtfn(1, "provision", "123:0", "123", ops, "456", 100000, false)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"adminthreadtip","params":[1,"provision","123:0","123",[{"operation":"REVOKE_KEY","keyset":"ASP","pubkey":"02ab","keyid":7}],"456",100000,false],"id":null}`,
+			unmarshalled: &btcjson.AdminThreadTipNtfn{
+				ThreadID: 1,
+				Thread:   "provision",
+				Tip:      "123:0",
+				TxID:     "123",
+				Ops: []btcjson.AdminKeyOp{{
+					Operation: "REVOKE_KEY",
+					KeySet:    "ASP",
+					PubKey:    "02ab",
+					KeyID:     7,
+				}},
+				BlockHash: "456",
+				Height:    100000,
+				Connected: false,
+			},
+		},
 		{
 			name: "recvtx",
 			newNtfn: func() (interface{}, error) {
@@ -225,6 +291,21 @@ func TestChainSvrWsNtfns(t *testing.T) {
 				Transaction: "001122",
 			},
 		},
+		{
+			name: "reorgtx",
+			newNtfn: func() (interface{}, error) {
+				return btcjson.NewCmd("reorgtx", "123", "conflicted")
+			},
+			staticNtfn: func() interface{} {
+				return btcjson.NewReorgTxNtfn("123",
+					btcjson.ReorgTxConflicted)
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"reorgtx","params":["123","conflicted"],"id":null}`,
+			unmarshalled: &btcjson.ReorgTxNtfn{
+				TxID:   "123",
+				Reason: "conflicted",
+			},
+		},
 	}
 
 	t.Logf("Running %d tests", len(tests))
@@ -229,15 +229,62 @@ func baseType(arg reflect.Type) (reflect.Type, int) {
 	return arg, numIndirects
 }
 
+// jsonUnmarshalerType is the reflect type of the json.Unmarshaler interface.
+var jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// assignJSONField assigns the passed boolean or string source value to the
+// destination field, whose base type implements json.Unmarshaler, by
+// unmarshaling the JSON encoding of the boolean or the string itself.
+func assignJSONField(paramNum int, fieldName string, dest reflect.Value, src reflect.Value, destBaseType reflect.Type, destIndirects int) error {
+	for src.Kind() == reflect.Ptr {
+		src = src.Elem()
+	}
+	var data []byte
+	if src.Kind() == reflect.String {
+		data = []byte(src.String())
+	} else {
+		data = []byte(strconv.FormatBool(src.Bool()))
+	}
+
+	concreteVal := reflect.New(destBaseType)
+	err := json.Unmarshal(data, concreteVal.Interface())
+	if err != nil {
+		str := fmt.Sprintf("parameter #%d '%s' must be valid JSON "+
+			"which unmarshals to a %v", paramNum, fieldName,
+			destBaseType)
+		return makeError(ErrInvalidType, str)
+	}
+
+	for i := 0; i < destIndirects; i++ {
+		dest.Set(reflect.New(dest.Type().Elem()))
+		dest = dest.Elem()
+	}
+	dest.Set(concreteVal.Elem())
+	return nil
+}
+
 // assignField is the main workhorse for the NewCmd function which handles
 // assigning the provided source value to the destination field.  It supports
 // direct type assignments, indirection, conversion of numeric types, and
 // unmarshaling of strings into arrays, slices, structs, and maps via
 // json.Unmarshal.
 func assignField(paramNum int, fieldName string, dest reflect.Value, src reflect.Value) error {
-	// Just error now when the types have no chance of being compatible.
+	// Types which unmarshal themselves from several JSON types, such as
+	// the getblock verbosity level which also accepts booleans, are
+	// assigned booleans and strings through their JSON encoding.
 	destBaseType, destIndirects := baseType(dest.Type())
 	srcBaseType, srcIndirects := baseType(src.Type())
+	if destBaseType.Kind() != reflect.Struct &&
+		reflect.PtrTo(destBaseType).Implements(jsonUnmarshalerType) {
+
+		switch srcBaseType.Kind() {
+		case reflect.Bool, reflect.String:
+			return assignJSONField(paramNum, fieldName, dest, src,
+				destBaseType, destIndirects)
+		}
+	}
+
+	// Just error now when the types have no chance of being compatible.
 	if !typesMaybeCompatible(destBaseType, srcBaseType) {
 		str := fmt.Sprintf("parameter #%d '%s' must be type %v (got "+
 			"%v)", paramNum, fieldName, destBaseType, srcBaseType)
@@ -509,6 +556,9 @@ func assignField(paramNum int, fieldName string, dest reflect.Value, src reflect
 //   - Conversion from string to arrays, slices, structs, and maps by treating
 //     the string as marshalled JSON and calling json.Unmarshal into the
 //     destination field
+//   - Conversion from boolean or string to any other type which implements
+//     json.Unmarshaler by calling json.Unmarshal with the boolean encoded as
+//     JSON or the string treated as marshalled JSON
 func NewCmd(method string, args ...interface{}) (interface{}, error) {
 	// Look up details about the provided method.  Any methods that aren't
 	// registered are an error.
@@ -46,7 +46,9 @@ const (
 const (
 	ErrRPCClientNotConnected      RPCErrorCode = -9
 	ErrRPCClientInInitialDownload RPCErrorCode = -10
+	ErrRPCClientNodeAlreadyAdded  RPCErrorCode = -23
 	ErrRPCClientNodeNotAdded      RPCErrorCode = -24
+	ErrRPCClientInvalidIPOrSubnet RPCErrorCode = -30
 )
 
 // Wallet JSON errors
@@ -83,3 +85,12 @@ const (
 	ErrRPCNoWallet      RPCErrorCode = -1
 	ErrRPCUnimplemented RPCErrorCode = -1
 )
+
+// Errors that are specific to prova.
+const (
+	ErrRPCNotAdminKeyHolder    RPCErrorCode = -100
+	ErrRPCThreadTipUnknown     RPCErrorCode = -101
+	ErrRPCValidatorKeyActive   RPCErrorCode = -102
+	ErrRPCValidatorKeyInactive RPCErrorCode = -103
+	ErrRPCRateLimited          RPCErrorCode = -104
+)
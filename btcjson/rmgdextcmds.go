@@ -24,9 +24,43 @@ func NewSetValidateKeysCmd(privKeys []string) *SetValidateKeysCmd {
 	}
 }
 
+// ProvisionValidatorCmd defines the provisionvalidator JSON-RPC command.
+// This command is not a standard command, it is an extension for operating
+// prova.
+type ProvisionValidatorCmd struct {
+	PubKey string
+}
+
+// NewProvisionValidatorCmd returns a new ProvisionValidatorCmd which can
+// be used to issue a provisionvalidator JSON-RPC command.  This command is
+// not a standard command. It is an extension for prova.
+func NewProvisionValidatorCmd(pubKey string) *ProvisionValidatorCmd {
+	return &ProvisionValidatorCmd{
+		PubKey: pubKey,
+	}
+}
+
+// RevokeValidatorCmd defines the revokevalidator JSON-RPC command.
+// This command is not a standard command, it is an extension for operating
+// prova.
+type RevokeValidatorCmd struct {
+	PubKey string
+}
+
+// NewRevokeValidatorCmd returns a new RevokeValidatorCmd which can
+// be used to issue a revokevalidator JSON-RPC command.  This command is
+// not a standard command. It is an extension for prova.
+func NewRevokeValidatorCmd(pubKey string) *RevokeValidatorCmd {
+	return &RevokeValidatorCmd{
+		PubKey: pubKey,
+	}
+}
+
 func init() {
 	// No special flags for commands in this file.
 	flags := UsageFlag(0)
 
 	MustRegisterCmd("setvalidatekeys", (*SetValidateKeysCmd)(nil), flags)
+	MustRegisterCmd("provisionvalidator", (*ProvisionValidatorCmd)(nil), flags)
+	MustRegisterCmd("revokevalidator", (*RevokeValidatorCmd)(nil), flags)
 }
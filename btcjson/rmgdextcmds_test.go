@@ -43,6 +43,32 @@ func TestRmgdExtCmds(t *testing.T) {
 				PrivKeys: []string{"1234"},
 			},
 		},
+		{
+			name: "provisionvalidator",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("provisionvalidator", "02ab")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewProvisionValidatorCmd("02ab")
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"provisionvalidator","params":["02ab"],"id":1}`,
+			unmarshalled: &btcjson.ProvisionValidatorCmd{
+				PubKey: "02ab",
+			},
+		},
+		{
+			name: "revokevalidator",
+			newCmd: func() (interface{}, error) {
+				return btcjson.NewCmd("revokevalidator", "02ab")
+			},
+			staticCmd: func() interface{} {
+				return btcjson.NewRevokeValidatorCmd("02ab")
+			},
+			marshalled: `{"jsonrpc":"1.0","method":"revokevalidator","params":["02ab"],"id":1}`,
+			unmarshalled: &btcjson.RevokeValidatorCmd{
+				PubKey: "02ab",
+			},
+		},
 	}
 
 	t.Logf("Running %d tests", len(tests))
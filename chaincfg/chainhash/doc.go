@@ -2,4 +2,26 @@
 //
 // This package provides a generic hash type and associated functions that
 // allows the specific hash algorithm to be abstracted.
+//
+// Byte Order
+//
+// A Hash stores its bytes in the order they are produced by the hash function,
+// which is also the order they are serialized in wire messages.  Since hashes
+// are compared as little-endian numbers against the proof-of-work target, this
+// is referred to as the little-endian representation and is returned by
+// StringLE.
+//
+// Humans, and therefore the RPC and REST interfaces, display hashes in the
+// byte-reversed big-endian representation returned by String and StringBE.
+// This applies to block hashes, transaction ids, the previousblockhash and
+// target of getblocktemplate, and the hashes in REST resource paths.  The
+// following summarizes the representation of common fields:
+//
+//  wire block header prev block and merkle root: little-endian (raw bytes)
+//  wire outpoint hash and inventory vector hash: little-endian (raw bytes)
+//  RPC/REST block hash, txid, previousblockhash: big-endian (StringBE)
+//  RPC getblocktemplate target:                  big-endian (StringBE)
+//
+// Use NewHashFromStrBE and NewHashFromStrLE to parse the respective
+// representations, and ReversedCopy to convert between them.
 package chainhash
@@ -0,0 +1,87 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package chainhash
+
+import (
+	"crypto/sha256"
+	"encoding"
+	"hash"
+)
+
+// DoubleHasher calculates hash(hash(b)) for many inputs which share a common
+// prefix, such as serialized data which only differs in a trailing nonce.  The
+// sha256 state after absorbing the prefix (the midstate) is saved once by
+// WriteMidstate, so every following SumWithSuffix only needs to hash the
+// suffix instead of the full input.
+//
+// NOTE: Block headers are identified by PowHashH rather than a double sha256,
+// so this does not apply to proof-of-work hashing.
+//
+// A DoubleHasher is not safe for concurrent use.
+type DoubleHasher struct {
+	h        hash.Hash
+	midstate []byte
+	prefix   []byte
+	first    [sha256.Size]byte
+}
+
+// NewDoubleHasher returns a new DoubleHasher with an empty midstate.
+func NewDoubleHasher() *DoubleHasher {
+	d := &DoubleHasher{h: sha256.New()}
+	d.WriteMidstate(nil)
+	return d
+}
+
+// WriteMidstate resets the hasher and saves the sha256 state after absorbing
+// prefix.  Only whole 64-byte blocks of the prefix are compressed ahead of
+// time, so prefixes which are a multiple of sha256.BlockSize long give the
+// largest saving.  When the state of the digest can not be saved, a copy of
+// the prefix is kept instead and hashed again by every SumWithSuffix.
+func (d *DoubleHasher) WriteMidstate(prefix []byte) {
+	d.h.Reset()
+	d.h.Write(prefix)
+	d.midstate, d.prefix = nil, nil
+
+	if m, ok := d.h.(encoding.BinaryMarshaler); ok {
+		midstate, err := m.MarshalBinary()
+		if err == nil {
+			d.midstate = midstate
+			return
+		}
+	}
+	d.prefix = append([]byte{}, prefix...)
+}
+
+// SumWithSuffix returns hash(hash(prefix || suffix)), where prefix is the data
+// last passed to WriteMidstate.  The midstate is left untouched, so it may be
+// called repeatedly with different suffixes.
+func (d *DoubleHasher) SumWithSuffix(suffix []byte) Hash {
+	restored := false
+	if u, ok := d.h.(encoding.BinaryUnmarshaler); ok && d.midstate != nil {
+		restored = u.UnmarshalBinary(d.midstate) == nil
+	}
+	if !restored {
+		d.h.Reset()
+		d.h.Write(d.prefix)
+	}
+	d.h.Write(suffix)
+	return Hash(sha256.Sum256(d.h.Sum(d.first[:0])))
+}
+
+// HashBlockHeaders calculates hash(hash(b)) for each of the passed serialized
+// headers and returns the results in the same order.  It produces the same
+// hashes as calling DoubleHashH on every header, but reuses a single hasher and
+// intermediate buffer for the whole batch.
+func HashBlockHeaders(headers [][]byte) []Hash {
+	hashes := make([]Hash, len(headers))
+	h := sha256.New()
+	var first [sha256.Size]byte
+	for i, header := range headers {
+		h.Reset()
+		h.Write(header)
+		hashes[i] = Hash(sha256.Sum256(h.Sum(first[:0])))
+	}
+	return hashes
+}
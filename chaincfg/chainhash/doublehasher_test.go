@@ -0,0 +1,153 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package chainhash
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"hash"
+	"testing"
+)
+
+// testHeader returns an 80-byte bitcoin-style header with deterministic
+// contents.  The last 16 bytes hold the merkle root tail, time, bits and nonce
+// and are the only part which does not fit the first sha256 block.
+func testHeader() []byte {
+	header := make([]byte, 80)
+	for i := range header {
+		header[i] = byte(i * 7)
+	}
+	return header
+}
+
+// opaqueHash hides the methods of the wrapped digest besides the ones of
+// hash.Hash, so its state can not be saved.
+type opaqueHash struct {
+	hash.Hash
+}
+
+// TestDoubleHasher ensures the midstate based double hash produces the same
+// results as DoubleHashH for a variety of prefix and suffix splits.
+func TestDoubleHasher(t *testing.T) {
+	testDoubleHasher(t, NewDoubleHasher())
+}
+
+// TestDoubleHasherNoMidstate ensures a hasher whose digest state can not be
+// saved falls back to hashing the whole input and produces the same results.
+func TestDoubleHasherNoMidstate(t *testing.T) {
+	d := &DoubleHasher{h: opaqueHash{sha256.New()}}
+	d.WriteMidstate(nil)
+	testDoubleHasher(t, d)
+}
+
+// testDoubleHasher compares the results of the passed hasher to DoubleHashH.
+func testDoubleHasher(t *testing.T, d *DoubleHasher) {
+	data := make([]byte, 300)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	if got, want := d.SumWithSuffix(nil), DoubleHashH(nil); got != want {
+		t.Fatalf("empty SumWithSuffix: got %v, want %v", got, want)
+	}
+
+	for _, size := range []int{0, 1, 55, 56, 63, 64, 65, 80, 128, 300} {
+		for split := 0; split <= size; split++ {
+			d.WriteMidstate(data[:split])
+			want := DoubleHashH(data[:size])
+			if got := d.SumWithSuffix(data[split:size]); got != want {
+				t.Fatalf("SumWithSuffix(size %d, split %d): got "+
+					"%v, want %v", size, split, got, want)
+			}
+
+			// Ensure the midstate is not consumed by a sum.
+			if got := d.SumWithSuffix(data[split:size]); got != want {
+				t.Fatalf("repeated SumWithSuffix(size %d, split "+
+					"%d): got %v, want %v", size, split, got,
+					want)
+			}
+		}
+	}
+
+	// Ensure a changing nonce hashes the same as the full header.
+	header := testHeader()
+	d.WriteMidstate(header[:64])
+	for nonce := uint32(0); nonce < 100; nonce++ {
+		binary.LittleEndian.PutUint32(header[76:], nonce)
+		want := DoubleHashH(header)
+		if got := d.SumWithSuffix(header[64:]); got != want {
+			t.Fatalf("nonce %d: got %v, want %v", nonce, got, want)
+		}
+	}
+}
+
+// TestHashBlockHeaders ensures the batch helper produces the same results as
+// DoubleHashH for every header in order.
+func TestHashBlockHeaders(t *testing.T) {
+	if hashes := HashBlockHeaders(nil); len(hashes) != 0 {
+		t.Fatalf("HashBlockHeaders(nil): got %d hashes, want 0",
+			len(hashes))
+	}
+
+	headers := make([][]byte, 20)
+	for i := range headers {
+		header := testHeader()
+		binary.LittleEndian.PutUint32(header[76:], uint32(i))
+		headers[i] = header
+	}
+	headers = append(headers, []byte{}, []byte("abc"))
+
+	hashes := HashBlockHeaders(headers)
+	if len(hashes) != len(headers) {
+		t.Fatalf("HashBlockHeaders: got %d hashes, want %d",
+			len(hashes), len(headers))
+	}
+	for i, header := range headers {
+		if want := DoubleHashH(header); hashes[i] != want {
+			t.Fatalf("HashBlockHeaders #%d: got %v, want %v", i,
+				hashes[i], want)
+		}
+	}
+}
+
+// BenchmarkDoubleHashBNonce benchmarks hashing a full 80-byte header with
+// DoubleHashB for every nonce.
+func BenchmarkDoubleHashBNonce(b *testing.B) {
+	header := testHeader()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		binary.LittleEndian.PutUint32(header[76:], uint32(i))
+		DoubleHashB(header)
+	}
+}
+
+// BenchmarkDoubleHasherNonce benchmarks hashing an 80-byte header for every
+// nonce from a midstate of its first sha256 block.
+func BenchmarkDoubleHasherNonce(b *testing.B) {
+	header := testHeader()
+	d := NewDoubleHasher()
+	d.WriteMidstate(header[:64])
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		binary.LittleEndian.PutUint32(header[76:], uint32(i))
+		d.SumWithSuffix(header[64:])
+	}
+}
+
+// BenchmarkHashBlockHeaders benchmarks hashing a batch of 2000 80-byte
+// headers, which is the maximum number of headers in a headers message.
+func BenchmarkHashBlockHeaders(b *testing.B) {
+	headers := make([][]byte, 2000)
+	for i := range headers {
+		headers[i] = testHeader()
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		HashBlockHeaders(headers)
+	}
+}
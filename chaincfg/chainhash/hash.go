@@ -26,12 +26,36 @@ var ErrHashStrSize = fmt.Errorf("max hash string length is %v bytes", MaxHashStr
 type Hash [HashSize]byte
 
 // String returns the Hash as the hexadecimal string of the byte-reversed
-// hash.
+// hash.  It is the same as StringBE.
 func (hash Hash) String() string {
+	return hash.StringBE()
+}
+
+// StringBE returns the Hash as the hexadecimal string of the byte-reversed
+// hash, which reads as the big-endian encoding of the hash interpreted as a
+// number.  This is the representation used by the RPC and REST interfaces for
+// block hashes, transaction ids, previous block hashes and targets, and the
+// one expected by NewHashFromStr and NewHashFromStrBE.
+func (hash Hash) StringBE() string {
+	reversed := hash.ReversedCopy()
+	return hex.EncodeToString(reversed[:])
+}
+
+// StringLE returns the Hash as the hexadecimal string of its bytes in the
+// order they are stored, which is the little-endian order used when a hash is
+// serialized in wire messages, such as the previous block and merkle root of a
+// block header or the hash of an outpoint.
+func (hash Hash) StringLE() string {
+	return hex.EncodeToString(hash[:])
+}
+
+// ReversedCopy returns a copy of the hash with the order of its bytes
+// reversed.  The hash itself is not modified.
+func (hash Hash) ReversedCopy() Hash {
 	for i := 0; i < HashSize/2; i++ {
 		hash[i], hash[HashSize-1-i] = hash[HashSize-1-i], hash[i]
 	}
-	return hex.EncodeToString(hash[:])
+	return hash
 }
 
 // CloneBytes returns a copy of the bytes which represent the hash as a byte
@@ -93,6 +117,33 @@ func NewHashFromStr(hash string) (*Hash, error) {
 	return ret, nil
 }
 
+// NewHashFromStrBE creates a Hash from the byte-reversed hexadecimal string
+// returned by StringBE.  Unlike NewHashFromStr, the string must be exactly
+// MaxHashStringSize characters long.
+func NewHashFromStrBE(hash string) (*Hash, error) {
+	ret, err := NewHashFromStrLE(hash)
+	if err != nil {
+		return nil, err
+	}
+	*ret = ret.ReversedCopy()
+	return ret, nil
+}
+
+// NewHashFromStrLE creates a Hash from the hexadecimal string of its bytes in
+// the order they are stored, as returned by StringLE.  The string must be
+// exactly MaxHashStringSize characters long.
+func NewHashFromStrLE(hash string) (*Hash, error) {
+	if len(hash) != MaxHashStringSize {
+		return nil, fmt.Errorf("invalid hash string length of %v, "+
+			"want %v", len(hash), MaxHashStringSize)
+	}
+	var ret Hash
+	if _, err := hex.Decode(ret[:], []byte(hash)); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
 // Decode decodes the byte-reversed hexadecimal string encoding of a Hash to a
 // destination.
 func Decode(dst *Hash, src string) error {
@@ -0,0 +1,91 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package chainhash
+
+import (
+	"encoding/hex"
+	"fmt"
+)
+
+// Hash160Size of array used to store hash160 hashes.  See Hash160.
+const Hash160Size = 20
+
+// Hash160 is used to identify public keys and scripts in scripts and
+// addresses.  It typically represents the ripemd160(sha256(b)) of data, such
+// as a serialized public key.
+//
+// Unlike Hash, a Hash160 is not byte-reversed in its string representation,
+// which matches how it appears in scripts.
+type Hash160 [Hash160Size]byte
+
+// String returns the Hash160 as a hexadecimal string.
+func (hash Hash160) String() string {
+	return hex.EncodeToString(hash[:])
+}
+
+// CloneBytes returns a copy of the bytes which represent the hash as a byte
+// slice.
+//
+// NOTE: It is generally cheaper to just slice the hash directly thereby reusing
+// the same bytes rather than calling this method.
+func (hash *Hash160) CloneBytes() []byte {
+	newHash := make([]byte, Hash160Size)
+	copy(newHash, hash[:])
+
+	return newHash
+}
+
+// SetBytes sets the bytes which represent the hash.  An error is returned if
+// the number of bytes passed in is not Hash160Size.
+func (hash *Hash160) SetBytes(newHash []byte) error {
+	nhlen := len(newHash)
+	if nhlen != Hash160Size {
+		return fmt.Errorf("invalid hash160 length of %v, want %v",
+			nhlen, Hash160Size)
+	}
+	copy(hash[:], newHash)
+
+	return nil
+}
+
+// IsEqual returns true if target is the same as hash.
+func (hash *Hash160) IsEqual(target *Hash160) bool {
+	if hash == nil && target == nil {
+		return true
+	}
+	if hash == nil || target == nil {
+		return false
+	}
+	return *hash == *target
+}
+
+// NewHash160FromBytes returns a new Hash160 from a byte slice.  An error is
+// returned if the number of bytes passed in is not Hash160Size.
+//
+// This is the conversion to use for code which still passes hash160 hashes
+// around as byte slices.
+func NewHash160FromBytes(newHash []byte) (*Hash160, error) {
+	var h Hash160
+	err := h.SetBytes(newHash)
+	if err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+// NewHash160FromStr creates a Hash160 from the hexadecimal string returned by
+// String.  An error is returned if the string does not encode exactly
+// Hash160Size bytes.
+func NewHash160FromStr(hash string) (*Hash160, error) {
+	if len(hash) != Hash160Size*2 {
+		return nil, fmt.Errorf("invalid hash160 string length of %v, "+
+			"want %v", len(hash), Hash160Size*2)
+	}
+	var h Hash160
+	if _, err := hex.Decode(h[:], []byte(hash)); err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
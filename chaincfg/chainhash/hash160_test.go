@@ -0,0 +1,101 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package chainhash
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestHash160 tests the Hash160 API.
+func TestHash160(t *testing.T) {
+	buf := []byte{
+		0x11, 0x9b, 0x09, 0x8e, 0x2e, 0x98, 0x0a, 0x22,
+		0x9e, 0x13, 0x9a, 0x9e, 0xd0, 0x1a, 0x46, 0x9e,
+		0x51, 0x8e, 0x6f, 0x26,
+	}
+	hash, err := NewHash160FromBytes(buf)
+	if err != nil {
+		t.Fatalf("NewHash160FromBytes: unexpected error %v", err)
+	}
+
+	// Ensure contents match and are not shared with the passed bytes.
+	if !bytes.Equal(hash[:], buf) {
+		t.Fatalf("NewHash160FromBytes: hash contents mismatch - got: "+
+			"%v, want: %v", hash[:], buf)
+	}
+	clone := hash.CloneBytes()
+	clone[0] ^= 0xff
+	if hash[0] != buf[0] {
+		t.Fatalf("CloneBytes: modifying the clone modified the hash")
+	}
+
+	// Ensure setting different bytes is reflected by IsEqual.
+	other := new(Hash160)
+	if hash.IsEqual(other) {
+		t.Fatalf("IsEqual: hash contents should not match - got: %v, "+
+			"want: %v", hash, other)
+	}
+	if err := other.SetBytes(hash.CloneBytes()); err != nil {
+		t.Fatalf("SetBytes: unexpected error %v", err)
+	}
+	if !hash.IsEqual(other) {
+		t.Fatalf("IsEqual: hash contents mismatch - got: %v, want: %v",
+			other, hash)
+	}
+
+	// Ensure nil hashes are handled properly.
+	if !(*Hash160)(nil).IsEqual(nil) {
+		t.Fatal("IsEqual: nil hashes should match")
+	}
+	if hash.IsEqual(nil) {
+		t.Fatal("IsEqual: non-nil hash matches nil hash")
+	}
+
+	// Ensure invalid sizes are rejected.
+	for _, size := range []int{0, Hash160Size - 1, Hash160Size + 1, HashSize} {
+		if err := other.SetBytes(make([]byte, size)); err == nil {
+			t.Fatalf("SetBytes: did not receive expected error for "+
+				"size %d", size)
+		}
+		if _, err := NewHash160FromBytes(make([]byte, size)); err == nil {
+			t.Fatalf("NewHash160FromBytes: did not receive "+
+				"expected error for size %d", size)
+		}
+	}
+}
+
+// TestHash160String tests the string round trip of Hash160 hashes.
+func TestHash160String(t *testing.T) {
+	tests := []struct {
+		in    string
+		valid bool
+	}{
+		{"119b098e2e980a229e139a9ed01a469e518e6f26", true},
+		{"0000000000000000000000000000000000000000", true},
+		{"ffffffffffffffffffffffffffffffffffffffff", true},
+		// Upper case characters are decoded, but not round tripped.
+		{"119B098E2E980A229E139A9ED01A469E518E6F26", false},
+		// Leading zeros are not stripped like for Hash.
+		{"9b098e2e980a229e139a9ed01a469e518e6f26", false},
+		{"119b098e2e980a229e139a9ed01a469e518e6f2600", false},
+		{"", false},
+		{"119b098e2e980a229e139a9ed01a469e518e6fzz", false},
+	}
+	for _, test := range tests {
+		hash, err := NewHash160FromStr(test.in)
+		if err != nil {
+			if test.valid {
+				t.Fatalf("NewHash160FromStr(%q): unexpected error "+
+					"%v", test.in, err)
+			}
+			continue
+		}
+		if got := hash.String(); (got == test.in) != test.valid {
+			t.Fatalf("String: unexpected round trip of %q - got %q",
+				test.in, got)
+		}
+	}
+}
@@ -110,6 +110,74 @@ func TestHashString(t *testing.T) {
 	}
 }
 
+// TestHashByteOrder ensures the explicit little-endian and big-endian string
+// representations of the genesis hash have the expected byte order and round
+// trip through their parse functions.
+func TestHashByteOrder(t *testing.T) {
+	wantBE := "000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f"
+	wantLE := "6fe28c0ab6f1b372c1a6a246ae63f74f931e8365e15a089c68d6190000000000"
+
+	hash := mainNetGenesisHash
+	if got := hash.StringBE(); got != wantBE {
+		t.Errorf("StringBE: got %v, want %v", got, wantBE)
+	}
+	if got := hash.String(); got != wantBE {
+		t.Errorf("String: got %v, want %v", got, wantBE)
+	}
+	if got := hash.StringLE(); got != wantLE {
+		t.Errorf("StringLE: got %v, want %v", got, wantLE)
+	}
+
+	// Ensure the reversed copy swaps the representations and leaves the
+	// original untouched.
+	reversed := hash.ReversedCopy()
+	if got := reversed.StringLE(); got != wantBE {
+		t.Errorf("ReversedCopy StringLE: got %v, want %v", got, wantBE)
+	}
+	if got := reversed.StringBE(); got != wantLE {
+		t.Errorf("ReversedCopy StringBE: got %v, want %v", got, wantLE)
+	}
+	if hash != mainNetGenesisHash {
+		t.Errorf("ReversedCopy modified the original hash")
+	}
+	if back := reversed.ReversedCopy(); back != hash {
+		t.Errorf("ReversedCopy twice: got %v, want %v", back, hash)
+	}
+
+	// Ensure each representation parses back to the genesis hash.
+	fromBE, err := NewHashFromStrBE(wantBE)
+	if err != nil {
+		t.Fatalf("NewHashFromStrBE: unexpected error: %v", err)
+	}
+	if *fromBE != hash {
+		t.Errorf("NewHashFromStrBE: got %v, want %v", fromBE, hash)
+	}
+	fromLE, err := NewHashFromStrLE(wantLE)
+	if err != nil {
+		t.Fatalf("NewHashFromStrLE: unexpected error: %v", err)
+	}
+	if *fromLE != hash {
+		t.Errorf("NewHashFromStrLE: got %v, want %v", fromLE, hash)
+	}
+
+	// Ensure strings of the wrong length or with invalid characters are
+	// rejected rather than padded.
+	invalid := []string{
+		"",
+		"19d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f",
+		wantBE + "00",
+		"g00000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f",
+	}
+	for _, str := range invalid {
+		if _, err := NewHashFromStrBE(str); err == nil {
+			t.Errorf("NewHashFromStrBE(%q): unexpected success", str)
+		}
+		if _, err := NewHashFromStrLE(str); err == nil {
+			t.Errorf("NewHashFromStrLE(%q): unexpected success", str)
+		}
+	}
+}
+
 // TestNewHashFromStr executes tests against the NewHashFromStr function.
 func TestNewHashFromStr(t *testing.T) {
 	tests := []struct {
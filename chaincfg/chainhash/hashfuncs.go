@@ -8,6 +8,8 @@ package chainhash
 
 import (
 	"crypto/sha256"
+
+	"github.com/btcsuite/golangcrypto/ripemd160"
 	"golang.org/x/crypto/sha3"
 )
 
@@ -47,3 +49,14 @@ func PowHashB(b []byte) []byte {
 func PowHashH(b []byte) Hash {
 	return Hash(sha3.Sum256(b))
 }
+
+// Hash160Sum calculates ripemd160(sha256(b)) and returns the resulting bytes as
+// a Hash160.
+func Hash160Sum(b []byte) Hash160 {
+	first := sha256.Sum256(b)
+	hasher := ripemd160.New()
+	hasher.Write(first[:])
+	var hash Hash160
+	copy(hash[:], hasher.Sum(nil))
+	return hash
+}
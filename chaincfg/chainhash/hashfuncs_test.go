@@ -6,6 +6,7 @@
 package chainhash
 
 import (
+	"encoding/hex"
 	"fmt"
 	"testing"
 )
@@ -199,3 +200,40 @@ func TestPoWHashFuncs(t *testing.T) {
 		}
 	}
 }
+
+// TestHash160Sum ensures the hash function which performs
+// ripemd160(sha256(b)) works as expected.
+func TestHash160Sum(t *testing.T) {
+	tests := []struct {
+		out string
+		in  string
+	}{
+		{"b472a266d0bd89c13706a4132ccfb16f7c3b9fcb", ""},
+		{"994355199e516ff76c4fa4aab39337b9d84cf12b", "a"},
+		{"bb1be98c142444d7a56aa3981c3942a978e4dc33", "abc"},
+		{"c0f5356420849b03a32ddfa5f9204f41392bad94", "message digest"},
+		{"c286a1af0947f58d1ad787385b1c2c4a976f9e71", "abcdefghijklmnopqrstuvwxyz"},
+	}
+	for _, test := range tests {
+		hash := Hash160Sum([]byte(test.in))
+		if h := hash.String(); h != test.out {
+			t.Errorf("Hash160Sum(%q) = %s, want %s", test.in, h,
+				test.out)
+			continue
+		}
+	}
+
+	// Ensure the hash of the uncompressed public key of the well-known
+	// pay-to-pubkey-hash address 12c6DSiU4Rq3P4ZxziKxzrPJxhEP3nMUnb is the
+	// expected value.
+	pubKey, err := hex.DecodeString("0496b538e853519c726a2c91e61ec11600ae" +
+		"1390813a627c66fb8be7947be63c52da7589379515d4e0a604f8141781e6" +
+		"2294721166bf621e73a82cbf2342c858ee")
+	if err != nil {
+		t.Fatalf("DecodeString: unexpected error %v", err)
+	}
+	want := "119b098e2e980a229e139a9ed01a469e518e6f26"
+	if h := Hash160Sum(pubKey).String(); h != want {
+		t.Fatalf("Hash160Sum(pubkey) = %s, want %s", h, want)
+	}
+}
@@ -53,6 +53,56 @@ type Checkpoint struct {
 	Hash   *chainhash.Hash
 }
 
+// UtxoSnapshot identifies a known good snapshot of the unspent transaction
+// output set at the block with the given height and hash.  Commitment covers
+// the rolling hash of the set along with the admin state and block hashes of
+// the snapshot, which is used to verify imported snapshots.
+type UtxoSnapshot struct {
+	Height     uint32
+	Hash       *chainhash.Hash
+	Commitment *chainhash.Hash
+}
+
+// ConsensusDeployment defines details related to a specific consensus rule
+// change which is enforced for all blocks starting at a predetermined height.
+// Since the validators of the network are known, rule changes are scheduled by
+// agreeing on the height instead of signaling them with block versions.
+type ConsensusDeployment struct {
+	// ActivationHeight is the height of the first block the rule change
+	// is enforced for.  A value of math.MaxUint32 means the rule change is
+	// not scheduled yet.
+	ActivationHeight uint32
+}
+
+// Constants that define the deployment offset in the deployments field of the
+// parameters for each deployment.  This is useful to be able to get the details
+// of a specific deployment by name.
+const (
+	// DeploymentCSV defines the rule change deployment ID for the relative
+	// lock-time rules defined by BIP0068, the CHECKSEQUENCEVERIFY opcode
+	// defined by BIP0112 and the evaluation of lock times against the past
+	// median time defined by BIP0113.
+	DeploymentCSV = iota
+
+	// DeploymentStrictEncoding defines the rule change deployment ID for
+	// requiring the signatures and public keys of transaction scripts to
+	// use their canonical encodings, which are strict DER signatures with
+	// low S values and strictly encoded public keys.  It removes the
+	// malleability of signatures from the consensus rules.
+	DeploymentStrictEncoding
+
+	// DeploymentCLTV defines the rule change deployment ID for the
+	// CHECKLOCKTIMEVERIFY opcode defined by BIP0065 along with the
+	// outputs locked by it.
+	DeploymentCLTV
+
+	// NOTE: DefinedDeployments must always come last since it is used to
+	// determine how many defined deployments there currently are.
+
+	// DefinedDeployments is the number of currently defined deployments.
+	DefinedDeployments
+)
+
 // DNSSeed identifies a DNS seed.
 type DNSSeed struct {
 	// Host defines the hostname of the seed.
@@ -118,6 +168,28 @@ type Params struct {
 	// Checkpoints ordered from oldest to newest.
 	Checkpoints []Checkpoint
 
+	// AssumeValid is the hash of a block which is assumed to be valid along
+	// with all of its ancestors, so script validation can be skipped for
+	// them during the initial download of the chain.  It is nil when there
+	// is no such block for the network.
+	AssumeValid *chainhash.Hash
+
+	// UtxoSnapshots are the known good snapshots of the unspent
+	// transaction output set ordered from oldest to newest.
+	UtxoSnapshots []UtxoSnapshot
+
+	// MaxReorgDepth is the maximum number of blocks a reorganization of the
+	// chain may disconnect, which bounds how deep a block needs to be
+	// buried before it is final.  A side chain which would require a deeper
+	// reorganization is refused even when it has more work.  It is zero
+	// when there is no limit for the network.
+	MaxReorgDepth uint32
+
+	// MaxTimeOffset is the maximum amount the local clock is adjusted by
+	// the median offset of the clocks reported by peers.  Median offsets
+	// beyond it are clamped to it.
+	MaxTimeOffset time.Duration
+
 	// Enforce current block version once network has
 	// upgraded.  This is part of BIP0034.
 	BlockEnforceNumRequired uint64
@@ -129,6 +201,10 @@ type Params struct {
 	// The number of nodes to check.  This is part of BIP0034.
 	BlockUpgradeNumToCheck uint64
 
+	// Deployments define the specific consensus rule changes to be
+	// enforced starting at their activation heights.
+	Deployments [DefinedDeployments]ConsensusDeployment
+
 	// Mempool parameters
 	RelayNonStdTxs bool
 
@@ -292,6 +368,18 @@ var MainNetParams = Params{
 	// Checkpoints ordered from oldest to newest.
 	Checkpoints: []Checkpoint{},
 
+	// Block assumed to be valid along with its ancestors.
+	AssumeValid: nil,
+
+	// Known good utxo set snapshots ordered from oldest to newest.
+	UtxoSnapshots: nil,
+
+	// Maximum depth of a reorganization, 0 disables the limit.
+	MaxReorgDepth: 0,
+
+	// Maximum adjustment of the local clock by the clocks of peers.
+	MaxTimeOffset: 70 * time.Minute,
+
 	// Enforce current block version once majority of the network has
 	// upgraded.
 	// 75% (750 / 1000)
@@ -302,6 +390,19 @@ var MainNetParams = Params{
 	BlockRejectNumRequired:  950,
 	BlockUpgradeNumToCheck:  1000,
 
+	// Consensus rule change deployments.
+	Deployments: [DefinedDeployments]ConsensusDeployment{
+		DeploymentCSV: {
+			ActivationHeight: math.MaxUint32, // Not yet scheduled
+		},
+		DeploymentStrictEncoding: {
+			ActivationHeight: math.MaxUint32, // Not yet scheduled
+		},
+		DeploymentCLTV: {
+			ActivationHeight: math.MaxUint32, // Not yet scheduled
+		},
+	},
+
 	// Mempool parameters
 	RelayNonStdTxs: false,
 
@@ -394,6 +495,21 @@ var RegressionNetParams = Params{
 	TargetTimePerBlock:       time.Minute, // 1 minute
 	GenerateSupported:        true,
 
+	// Checkpoints ordered from oldest to newest.
+	Checkpoints: nil,
+
+	// Block assumed to be valid along with its ancestors.
+	AssumeValid: nil,
+
+	// Known good utxo set snapshots ordered from oldest to newest.
+	UtxoSnapshots: nil,
+
+	// Maximum depth of a reorganization, 0 disables the limit.
+	MaxReorgDepth: 0,
+
+	// Maximum adjustment of the local clock by the clocks of peers.
+	MaxTimeOffset: 70 * time.Minute,
+
 	// Enforce current block version once majority of the network has
 	// upgraded.
 	// 75% (750 / 1000)
@@ -404,6 +520,19 @@ var RegressionNetParams = Params{
 	BlockRejectNumRequired:  950,
 	BlockUpgradeNumToCheck:  1000,
 
+	// Consensus rule change deployments.
+	Deployments: [DefinedDeployments]ConsensusDeployment{
+		DeploymentCSV: {
+			ActivationHeight: 0, // Always active
+		},
+		DeploymentStrictEncoding: {
+			ActivationHeight: 0, // Always active
+		},
+		DeploymentCLTV: {
+			ActivationHeight: 0, // Always active
+		},
+	},
+
 	// Mempool parameters
 	RelayNonStdTxs: false,
 
@@ -517,6 +646,18 @@ var TestNetParams = Params{
 	// Checkpoints ordered from oldest to newest.
 	Checkpoints: []Checkpoint{},
 
+	// Block assumed to be valid along with its ancestors.
+	AssumeValid: nil,
+
+	// Known good utxo set snapshots ordered from oldest to newest.
+	UtxoSnapshots: nil,
+
+	// Maximum depth of a reorganization, 0 disables the limit.
+	MaxReorgDepth: 0,
+
+	// Maximum adjustment of the local clock by the clocks of peers.
+	MaxTimeOffset: 70 * time.Minute,
+
 	// Enforce current block version once majority of the network has
 	// upgraded.
 	// 51% (51 / 100)
@@ -527,6 +668,19 @@ var TestNetParams = Params{
 	BlockRejectNumRequired:  75,
 	BlockUpgradeNumToCheck:  100,
 
+	// Consensus rule change deployments.
+	Deployments: [DefinedDeployments]ConsensusDeployment{
+		DeploymentCSV: {
+			ActivationHeight: math.MaxUint32, // Not yet scheduled
+		},
+		DeploymentStrictEncoding: {
+			ActivationHeight: math.MaxUint32, // Not yet scheduled
+		},
+		DeploymentCLTV: {
+			ActivationHeight: math.MaxUint32, // Not yet scheduled
+		},
+	},
+
 	// Mempool parameters
 	RelayNonStdTxs: false,
 
@@ -584,6 +738,18 @@ var SimNetParams = Params{
 	// Checkpoints ordered from oldest to newest.
 	Checkpoints: nil,
 
+	// Block assumed to be valid along with its ancestors.
+	AssumeValid: nil,
+
+	// Known good utxo set snapshots ordered from oldest to newest.
+	UtxoSnapshots: nil,
+
+	// Maximum depth of a reorganization, 0 disables the limit.
+	MaxReorgDepth: 0,
+
+	// Maximum adjustment of the local clock by the clocks of peers.
+	MaxTimeOffset: 70 * time.Minute,
+
 	// Enforce current block version once majority of the network has
 	// upgraded.
 	// 51% (51 / 100)
@@ -594,10 +760,24 @@ var SimNetParams = Params{
 	BlockRejectNumRequired:  75,
 	BlockUpgradeNumToCheck:  100,
 
+	// Consensus rule change deployments.
+	Deployments: [DefinedDeployments]ConsensusDeployment{
+		DeploymentCSV: {
+			ActivationHeight: 0, // Always active
+		},
+		DeploymentStrictEncoding: {
+			ActivationHeight: 0, // Always active
+		},
+		DeploymentCLTV: {
+			ActivationHeight: 0, // Always active
+		},
+	},
+
 	// Mempool parameters
 	RelayNonStdTxs: false,
 
 	// Address encoding magics
+	ProvaAddrID:  0xa9, // starts with s
 	PrivateKeyID: 0x64, // starts with 4 (uncompressed) or F (compressed)
 
 	// BIP32 hierarchical deterministic extended key magics
@@ -642,6 +822,8 @@ var (
 	scriptHashAddrIDs = make(map[byte]struct{})
 	provaAddrIDs      = make(map[byte]struct{})
 	hdPrivToPubKeyIDs = make(map[[4]byte][]byte)
+	hdPubToPrivKeyIDs = make(map[[4]byte][]byte)
+	hdKeyIDNets       = make(map[[4]byte]*Params)
 )
 
 // String returns the hostname of the DNS seed in human-readable form.
@@ -652,7 +834,8 @@ func (d DNSSeed) String() string {
 // Register registers the network parameters for a Bitcoin network.  This may
 // error with ErrDuplicateNet if the network is already registered (either
 // due to a previous Register call, or the network being one of the default
-// networks).
+// networks).  The name of the network is also registered with the wire package
+// so the network is printed by name.
 //
 // Network parameters should be registered into this package by a main package
 // as early as possible.  Then, library packages may lookup networks or network
@@ -667,6 +850,13 @@ func Register(params *Params) error {
 		provaAddrIDs[params.ProvaAddrID] = struct{}{}
 	}
 	hdPrivToPubKeyIDs[params.HDPrivateKeyID] = params.HDPublicKeyID[:]
+	hdPubToPrivKeyIDs[params.HDPublicKeyID] = params.HDPrivateKeyID[:]
+	for _, id := range [][4]byte{params.HDPrivateKeyID, params.HDPublicKeyID} {
+		if _, ok := hdKeyIDNets[id]; !ok {
+			hdKeyIDNets[id] = params
+		}
+	}
+	wire.RegisterNetName(params.Net, params.Name)
 	return nil
 }
 
@@ -726,6 +916,44 @@ func HDPrivateKeyToPublicKeyID(id []byte) ([]byte, error) {
 	return pubBytes, nil
 }
 
+// HDPublicKeyToPrivateKeyID accepts a public hierarchical deterministic
+// extended key id and returns the associated private key id.  When the provided
+// id is not registered, the ErrUnknownHDKeyID error will be returned.
+func HDPublicKeyToPrivateKeyID(id []byte) ([]byte, error) {
+	if len(id) != 4 {
+		return nil, ErrUnknownHDKeyID
+	}
+
+	var key [4]byte
+	copy(key[:], id)
+	privBytes, ok := hdPubToPrivKeyIDs[key]
+	if !ok {
+		return nil, ErrUnknownHDKeyID
+	}
+
+	return privBytes, nil
+}
+
+// HDKeyIDToParams accepts a private or public hierarchical deterministic
+// extended key id and returns the parameters of the network it belongs to.
+// Networks may share their ids, such as testnet and regtest, in which case the
+// network registered first is returned.  When the provided id is not
+// registered, the ErrUnknownHDKeyID error will be returned.
+func HDKeyIDToParams(id []byte) (*Params, error) {
+	if len(id) != 4 {
+		return nil, ErrUnknownHDKeyID
+	}
+
+	var key [4]byte
+	copy(key[:], id)
+	params, ok := hdKeyIDNets[key]
+	if !ok {
+		return nil, ErrUnknownHDKeyID
+	}
+
+	return params, nil
+}
+
 // newHashFromStr converts the passed big-endian hex string into a
 // chainhash.Hash.  It only differs from the one available in chainhash in that
 // it panics on an error since it will only (and must only) be called with
@@ -217,6 +217,49 @@ func TestRegister(t *testing.T) {
 				t.Errorf("%s: HD magic %d private and public mismatch: got %v expected %v ",
 					test.name, i, pubKey, magTest.want[:])
 			}
+			params, err := HDKeyIDToParams(magTest.priv)
+			if err != magTest.err {
+				t.Errorf("%s: HD magic %d network lookup mismatched error: got %v expected %v ",
+					test.name, i, err, magTest.err)
+			}
+			if magTest.err != nil {
+				continue
+			}
+			if !bytes.Equal(params.HDPrivateKeyID[:], magTest.priv) {
+				t.Errorf("%s: HD magic %d network mismatch: got %v",
+					test.name, i, params.Name)
+			}
+			privKey, err := HDPublicKeyToPrivateKeyID(magTest.want)
+			if err != nil || !bytes.Equal(privKey, magTest.priv) {
+				t.Errorf("%s: HD magic %d public and private mismatch: got %v expected %v (err %v)",
+					test.name, i, privKey, magTest.priv, err)
+			}
+			if pubParams, err := HDKeyIDToParams(magTest.want); err != nil || pubParams != params {
+				t.Errorf("%s: HD magic %d public network mismatch: expected %v (err %v)",
+					test.name, i, params.Name, err)
+			}
 		}
 	}
+
+	// Networks which share their HD key ids, such as testnet and regtest,
+	// are resolved to the network registered first.
+	params, err := HDKeyIDToParams(RegressionNetParams.HDPublicKeyID[:])
+	if err != nil || params != &TestNetParams {
+		t.Errorf("regtest HD key id not resolved to %v (err %v)",
+			TestNetParams.Name, err)
+	}
+	if _, err := HDPublicKeyToPrivateKeyID([]byte{0xff}); err != ErrUnknownHDKeyID {
+		t.Errorf("HDPublicKeyToPrivateKeyID: got error %v, want %v", err,
+			ErrUnknownHDKeyID)
+	}
+
+	// Ensure the registered network is printed by name by the wire package
+	// while the default networks keep their names.
+	if got := mockNetParams.Net.String(); got != mockNetParams.Name {
+		t.Errorf("registered network printed as %q, want %q", got,
+			mockNetParams.Name)
+	}
+	if got := MainNetParams.Net.String(); got != "MainNet" {
+		t.Errorf("mainnet printed as %q, want %q", got, "MainNet")
+	}
 }
@@ -0,0 +1,184 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/wire"
+)
+
+var (
+	// errShortIDCollision indicates a compact block could not be
+	// reconstructed because a short transaction ID matches more than one
+	// transaction.  The full block has to be requested instead.
+	errShortIDCollision = errors.New("short transaction id collision")
+
+	// errCmpctBlockMismatch indicates the transactions a compact block was
+	// reconstructed from do not commit to the merkle root of its header.
+	// The full block has to be requested instead.
+	errCmpctBlockMismatch = errors.New("reconstructed block does not " +
+		"match its merkle root")
+)
+
+// newCmpctBlock returns a compact block for the passed block using the passed
+// nonce to derive the short transaction IDs from.  The coinbase is always
+// prefilled since the receiver can not know about it yet.
+func newCmpctBlock(block *provautil.Block, nonce uint64) *wire.MsgCmpctBlock {
+	msgBlock := block.MsgBlock()
+	msg := wire.NewMsgCmpctBlock(&msgBlock.Header, nonce)
+	k0, k1 := msg.ShortIDKeys()
+	for i, tx := range block.Transactions() {
+		if i == 0 {
+			msg.AddPrefilledTx(0, tx.MsgTx())
+			continue
+		}
+		msg.AddShortID(wire.ShortTxID(k0, k1, tx.HashWithSig()))
+	}
+	return msg
+}
+
+// partialBlock houses a block which is being reconstructed from a compact
+// block.  The transactions which could not be found are nil and their indexes
+// are listed in missing in increasing order.
+type partialBlock struct {
+	header  wire.BlockHeader
+	hash    chainhash.Hash
+	txns    []*wire.MsgTx
+	missing []uint32
+}
+
+// newPartialBlock reconstructs as much of the block described by the passed
+// compact block as possible from its prefilled transactions and the passed
+// transactions, which are typically those of the memory pool.
+//
+// errShortIDCollision is returned when two transactions of the compact block
+// share a short ID or a short ID matches more than one of the passed
+// transactions, since it is not possible to tell which transaction belongs to
+// the block in that case.
+func newPartialBlock(msg *wire.MsgCmpctBlock, txns []*provautil.Tx) (*partialBlock, error) {
+	numTxns := msg.TxCount()
+	if numTxns == 0 {
+		return nil, fmt.Errorf("compact block has no transactions")
+	}
+
+	pb := &partialBlock{
+		header: msg.Header,
+		hash:   msg.Header.BlockHash(),
+		txns:   make([]*wire.MsgTx, numTxns),
+	}
+	for _, ptx := range msg.PrefilledTxns {
+		if int(ptx.Index) >= numTxns {
+			return nil, fmt.Errorf("prefilled transaction index %d "+
+				"out of range for %d transactions", ptx.Index,
+				numTxns)
+		}
+		pb.txns[ptx.Index] = ptx.Tx
+	}
+
+	// Map the short IDs to the remaining indexes in order.
+	shortIDs := make(map[uint64]uint32, len(msg.ShortIDs))
+	index := uint32(0)
+	for _, id := range msg.ShortIDs {
+		for pb.txns[index] != nil {
+			index++
+		}
+		if _, exists := shortIDs[id]; exists {
+			return nil, errShortIDCollision
+		}
+		shortIDs[id] = index
+		index++
+	}
+
+	k0, k1 := msg.ShortIDKeys()
+	for _, tx := range txns {
+		index, ok := shortIDs[wire.ShortTxID(k0, k1, tx.HashWithSig())]
+		if !ok {
+			continue
+		}
+		if pb.txns[index] != nil {
+			return nil, errShortIDCollision
+		}
+		pb.txns[index] = tx.MsgTx()
+	}
+
+	for i, tx := range pb.txns {
+		if tx == nil {
+			pb.missing = append(pb.missing, uint32(i))
+		}
+	}
+	return pb, nil
+}
+
+// getBlockTxn returns a getblocktxn message requesting the missing
+// transactions of the partial block.
+func (pb *partialBlock) getBlockTxn() *wire.MsgGetBlockTxn {
+	msg := wire.NewMsgGetBlockTxn(&pb.hash)
+	for _, index := range pb.missing {
+		msg.AddIndex(index)
+	}
+	return msg
+}
+
+// fillMissing fills the missing transactions of the partial block with the
+// transactions of the passed blocktxn message, which must provide all of
+// them in order.
+func (pb *partialBlock) fillMissing(msg *wire.MsgBlockTxn) error {
+	if !msg.BlockHash.IsEqual(&pb.hash) {
+		return fmt.Errorf("blocktxn for block %v does not match block %v",
+			msg.BlockHash, pb.hash)
+	}
+	if len(msg.Transactions) != len(pb.missing) {
+		return fmt.Errorf("blocktxn provides %d transactions, %d are "+
+			"missing", len(msg.Transactions), len(pb.missing))
+	}
+	for i, index := range pb.missing {
+		pb.txns[index] = msg.Transactions[i]
+	}
+	pb.missing = nil
+	return nil
+}
+
+// block returns the reconstructed block once no transactions are missing.
+// errCmpctBlockMismatch is returned when the transactions do not commit to
+// the merkle root of the header, which happens when a short ID matched the
+// wrong transaction.
+func (pb *partialBlock) block() (*provautil.Block, error) {
+	if len(pb.missing) != 0 {
+		return nil, fmt.Errorf("block %v is missing %d transactions",
+			pb.hash, len(pb.missing))
+	}
+
+	msgBlock := &wire.MsgBlock{
+		Header:       pb.header,
+		Transactions: pb.txns,
+	}
+	block := provautil.NewBlock(msgBlock)
+	merkles := blockchain.BuildMerkleTreeStore(block.Transactions())
+	if !pb.header.MerkleRoot.IsEqual(merkles[len(merkles)-1]) {
+		return nil, errCmpctBlockMismatch
+	}
+	return block, nil
+}
+
+// blockTxnResponse returns a blocktxn message with the transactions of the
+// passed block requested by the passed getblocktxn message.  An error is
+// returned when a requested index is out of range.
+func blockTxnResponse(block *provautil.Block, msg *wire.MsgGetBlockTxn) (*wire.MsgBlockTxn, error) {
+	txns := block.MsgBlock().Transactions
+	resp := wire.NewMsgBlockTxn(&msg.BlockHash)
+	for _, index := range msg.Indexes {
+		if int(index) >= len(txns) {
+			return nil, fmt.Errorf("transaction index %d out of "+
+				"range for %d transactions", index, len(txns))
+		}
+		resp.AddTransaction(txns[index])
+	}
+	return resp, nil
+}
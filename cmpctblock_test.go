@@ -0,0 +1,197 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/wire"
+)
+
+// newCmpctTestBlock returns a block with a coinbase and the passed number of
+// further transactions which spend distinct outputs.
+func newCmpctTestBlock(numTxns int) *provautil.Block {
+	coinbase := wire.NewMsgTx(1)
+	coinbase.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{},
+		wire.MaxPrevOutIndex), []byte{0x51}))
+	coinbase.AddTxOut(wire.NewTxOut(5000000000, []byte{0x51}))
+	txns := []*provautil.Tx{provautil.NewTx(coinbase)}
+	for i := 0; i < numTxns; i++ {
+		tx := wire.NewMsgTx(1)
+		tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{byte(i + 1)},
+			0), []byte{0x01, byte(i)}))
+		tx.AddTxOut(wire.NewTxOut(int64(1000*(i+1)), []byte{0x51}))
+		txns = append(txns, provautil.NewTx(tx))
+	}
+
+	merkles := blockchain.BuildMerkleTreeStore(txns)
+	genesisHash := chaincfg.RegressionNetParams.GenesisBlock.BlockHash()
+	msgBlock := &wire.MsgBlock{
+		Header: *wire.NewBlockHeader(&genesisHash,
+			merkles[len(merkles)-1], 0x207fffff, 1),
+	}
+	for _, tx := range txns {
+		msgBlock.AddTransaction(tx.MsgTx())
+	}
+	return provautil.NewBlock(msgBlock)
+}
+
+// relayMessage encodes the passed message to the wire format and decodes it
+// again as the remote node would receive it.
+func relayMessage(t *testing.T, msg wire.Message) wire.Message {
+	var buf bytes.Buffer
+	net := chaincfg.SimNetParams.Net
+	if err := wire.WriteMessage(&buf, msg, wire.ProtocolVersion, net); err != nil {
+		t.Fatalf("unable to encode %s message: %v", msg.Command(), err)
+	}
+	received, _, err := wire.ReadMessage(&buf, wire.ProtocolVersion, net)
+	if err != nil {
+		t.Fatalf("unable to decode %s message: %v", msg.Command(), err)
+	}
+	return received
+}
+
+// TestCmpctBlockRelay ensures a block propagates between two nodes via compact
+// block relay when the receiving node misses one of its transactions, which
+// is then fetched with a getblocktxn message.
+func TestCmpctBlockRelay(t *testing.T) {
+	block := newCmpctTestBlock(5)
+	txns := block.Transactions()
+
+	// The receiving node knows about all transactions except the coinbase,
+	// which is prefilled, and the deliberately missing one.
+	const missingIndex = 3
+	var pool []*provautil.Tx
+	for i := len(txns) - 1; i > 0; i-- {
+		if i != missingIndex {
+			pool = append(pool, txns[i])
+		}
+	}
+
+	// The sending node announces the block as a compact block.
+	msg := relayMessage(t, newCmpctBlock(block, 0x0123456789abcdef))
+	cmpctBlock, ok := msg.(*wire.MsgCmpctBlock)
+	if !ok {
+		t.Fatalf("unexpected message type %T", msg)
+	}
+	if len(cmpctBlock.PrefilledTxns) != 1 ||
+		cmpctBlock.PrefilledTxns[0].Index != 0 {
+
+		t.Fatalf("coinbase not prefilled: %v", cmpctBlock.PrefilledTxns)
+	}
+
+	// The receiving node reconstructs what it can and requests the missing
+	// transaction.
+	pb, err := newPartialBlock(cmpctBlock, pool)
+	if err != nil {
+		t.Fatalf("newPartialBlock: unexpected error %v", err)
+	}
+	if len(pb.missing) != 1 || pb.missing[0] != missingIndex {
+		t.Fatalf("unexpected missing transactions - got %v, want [%d]",
+			pb.missing, missingIndex)
+	}
+	if _, err := pb.block(); err == nil {
+		t.Fatalf("block: incomplete block accepted")
+	}
+	msg = relayMessage(t, pb.getBlockTxn())
+	getBlockTxn, ok := msg.(*wire.MsgGetBlockTxn)
+	if !ok {
+		t.Fatalf("unexpected message type %T", msg)
+	}
+
+	// The sending node responds with the requested transaction.
+	resp, err := blockTxnResponse(block, getBlockTxn)
+	if err != nil {
+		t.Fatalf("blockTxnResponse: unexpected error %v", err)
+	}
+	msg = relayMessage(t, resp)
+	blockTxn, ok := msg.(*wire.MsgBlockTxn)
+	if !ok {
+		t.Fatalf("unexpected message type %T", msg)
+	}
+
+	// The receiving node completes the block, which must be identical to
+	// the one sent.
+	if err := pb.fillMissing(blockTxn); err != nil {
+		t.Fatalf("fillMissing: unexpected error %v", err)
+	}
+	reconstructed, err := pb.block()
+	if err != nil {
+		t.Fatalf("block: unexpected error %v", err)
+	}
+	var want, got bytes.Buffer
+	block.MsgBlock().Serialize(&want)
+	reconstructed.MsgBlock().Serialize(&got)
+	if !bytes.Equal(got.Bytes(), want.Bytes()) {
+		t.Fatalf("reconstructed block %v does not match block %v",
+			reconstructed.Hash(), block.Hash())
+	}
+
+	// Ensure requesting transactions beyond the end of the block fails.
+	getBlockTxn.Indexes = []uint32{uint32(len(txns))}
+	if _, err := blockTxnResponse(block, getBlockTxn); err == nil {
+		t.Fatalf("blockTxnResponse: out of range index accepted")
+	}
+}
+
+// TestCmpctBlockFallback ensures reconstruction of a compact block fails with
+// the errors which make the receiving node request the full block instead.
+func TestCmpctBlockFallback(t *testing.T) {
+	block := newCmpctTestBlock(4)
+	txns := block.Transactions()
+
+	// Colliding short IDs within the compact block can not be resolved.
+	cmpctBlock := newCmpctBlock(block, 1)
+	cmpctBlock.ShortIDs[1] = cmpctBlock.ShortIDs[0]
+	if _, err := newPartialBlock(cmpctBlock, txns); err != errShortIDCollision {
+		t.Fatalf("duplicate short ids: got %v, want %v", err,
+			errShortIDCollision)
+	}
+
+	// A short ID matching more than one known transaction can not be
+	// resolved either.
+	cmpctBlock = newCmpctBlock(block, 1)
+	pool := append([]*provautil.Tx{provautil.NewTx(txns[1].MsgTx())}, txns...)
+	if _, err := newPartialBlock(cmpctBlock, pool); err != errShortIDCollision {
+		t.Fatalf("ambiguous short id: got %v, want %v", err,
+			errShortIDCollision)
+	}
+
+	// A short ID which matches the wrong transaction results in a block
+	// which does not match its merkle root.
+	cmpctBlock = newCmpctBlock(block, 1)
+	k0, k1 := cmpctBlock.ShortIDKeys()
+	other := newCmpctTestBlock(5).Transactions()[5]
+	cmpctBlock.ShortIDs[1] = wire.ShortTxID(k0, k1, other.HashWithSig())
+	pb, err := newPartialBlock(cmpctBlock, append(txns, other))
+	if err != nil {
+		t.Fatalf("newPartialBlock: unexpected error %v", err)
+	}
+	if _, err := pb.block(); err != errCmpctBlockMismatch {
+		t.Fatalf("wrong transaction: got %v, want %v", err,
+			errCmpctBlockMismatch)
+	}
+
+	// A blocktxn message which does not provide all missing transactions
+	// can not complete the block.
+	cmpctBlock = newCmpctBlock(block, 1)
+	pb, err = newPartialBlock(cmpctBlock, nil)
+	if err != nil {
+		t.Fatalf("newPartialBlock: unexpected error %v", err)
+	}
+	if len(pb.missing) != len(txns)-1 {
+		t.Fatalf("unexpected missing transactions - got %v", pb.missing)
+	}
+	blockTxn := wire.NewMsgBlockTxn(block.Hash())
+	blockTxn.AddTransaction(txns[1].MsgTx())
+	if err := pb.fillMissing(blockTxn); err == nil {
+		t.Fatalf("fillMissing: incomplete blocktxn accepted")
+	}
+}
@@ -23,11 +23,14 @@ import (
 	"strings"
 	"time"
 
+	"github.com/bitgo/prova/addrmgr"
+	"github.com/bitgo/prova/btcec"
 	"github.com/bitgo/prova/chaincfg"
 	"github.com/bitgo/prova/chaincfg/chainhash"
 	"github.com/bitgo/prova/connmgr"
 	"github.com/bitgo/prova/database"
 	_ "github.com/bitgo/prova/database/ffldb"
+	"github.com/bitgo/prova/debuglevel"
 	"github.com/bitgo/prova/mempool"
 	"github.com/bitgo/prova/provautil"
 	"github.com/bitgo/prova/wire"
@@ -57,10 +60,15 @@ const (
 	defaultGenerate              = false
 	defaultMaxOrphanTransactions = 100
 	defaultMaxOrphanTxSize       = mempool.MaxStandardTxSize
+	defaultMaxMempool            = 300
 	defaultSigCacheMaxSize       = 100000
+	defaultUtxoBatchSize         = 100
+	defaultShutdownTimeout       = time.Minute * 5
 	sampleConfigFilename         = "sample-prova.conf"
 	defaultTxIndex               = false
 	defaultAddrIndex             = false
+	defaultBlockStatsIndex       = false
+	defaultSigKeyIDIndex         = false
 	defaultUseOnlySyncPeerInv    = false
 )
 
@@ -103,12 +111,18 @@ type config struct {
 	DisableBanning       bool          `long:"nobanning" description:"Disable banning of misbehaving peers"`
 	BanDuration          time.Duration `long:"banduration" description:"How long to ban misbehaving peers.  Valid time units are {s, m, h}.  Minimum 1 second"`
 	BanThreshold         uint32        `long:"banthreshold" description:"Maximum allowed ban score before disconnecting and banning misbehaving peers."`
+	BanScores            []string      `long:"banscore" description:"Override the ban score of a kind of misbehavior as <offense>=<score>.  Offenses with persistent scores: protocol, malformedmsg, invalidblock, useragent.  Offenses with decaying scores: mempool, getdata, inv (for messages of the maximum size), validatorkey"`
+	MessageLimits        []string      `long:"msglimit" description:"Override a limit of the number of elements of peer messages as <limit>=<count> for private networks.  Limits: headers (2000), inv (50000), addr (1000) -- The size of block messages always matches the block size limit of the chain"`
+	AgentBlacklist       []string      `long:"agentblacklist" description:"Disconnect peers whose user agent contains the passed substring (eg. /Prova:0.1.0/)"`
+	UserAgentComments    []string      `long:"uacomment" description:"Comment to add to the user agent -- See BIP 14 for more information."`
+	Whitelists           []string      `long:"whitelist" description:"Add an IP network or IP that will not be banned, optionally prefixed with the relay policy checks its transactions are exempt from as <exemptions>@<ip>.  Exemptions: relayfee, nonstandard, ratelimit, all (eg. 192.168.1.0/24, ::1 or relayfee,nonstandard@10.0.0.0/8)"`
 	RPCUser              string        `short:"u" long:"rpcuser" description:"Username for RPC connections"`
 	RPCPass              string        `short:"P" long:"rpcpass" default-mask:"-" description:"Password for RPC connections"`
 	RPCHash              string        `long:"rpchash" description:"SHA2 of auth credentials (may be specified instead of user/pass)"`
 	RPCLimitUser         string        `long:"rpclimituser" description:"Username for limited RPC connections"`
 	RPCLimitPass         string        `long:"rpclimitpass" default-mask:"-" description:"Password for limited RPC connections"`
 	RPCLimitHash         string        `long:"rpclimithash" description:"SHA2 of auth credentials for limited RPC user (may be specified instead of user/pass)"`
+	RPCAuth              []string      `long:"rpcauth" description:"Add an RPC user which may only execute the granted commands, optionally limited to a number of commands per second, as <user>:<password>:<commands>[:<rate>].  Commands is a comma separated list of commands and command categories: read, wallet, mining, admin (eg. dashboard:secret:read or pool:secret:mining,getblockcount:10)"`
 	RPCListeners         []string      `long:"rpclisten" description:"Add an interface/port to listen for RPC connections (default port: 8334, testnet: 18334)"`
 	RPCCert              string        `long:"rpccert" description:"File containing the certificate file"`
 	RPCKey               string        `long:"rpckey" description:"File containing the certificate key"`
@@ -116,8 +130,10 @@ type config struct {
 	RPCMaxWebsockets     int           `long:"rpcmaxwebsockets" description:"Max number of RPC websocket connections"`
 	RPCMaxConcurrentReqs int           `long:"rpcmaxconcurrentreqs" description:"Max number of concurrent RPC requests that may be processed concurrently"`
 	RPCQuirks            bool          `long:"rpcquirks" description:"Mirror some JSON-RPC quirks of Bitcoin Core -- NOTE: Discouraged unless interoperability issues need to be worked around"`
-	DisableRPC           bool          `long:"norpc" description:"Disable built-in RPC server -- NOTE: The RPC server is disabled by default if no rpcuser/rpcpass or rpclimituser/rpclimitpass is specified"`
+	DisableRPC           bool          `long:"norpc" description:"Disable built-in RPC server -- NOTE: The RPC server is disabled by default if no rpcuser/rpcpass, rpclimituser/rpclimitpass or rpcauth is specified"`
 	DisableTLS           bool          `long:"notls" description:"Disable TLS for the RPC server -- NOTE: This is only allowed if the RPC server is bound to localhost"`
+	RESTListeners        []string      `long:"restlisten" description:"Add an interface/port to listen for unauthenticated REST requests (default port: 8335, testnet: 18335) -- NOTE: The REST server is disabled unless an interface is specified"`
+	MetricsListeners     []string      `long:"metricslisten" description:"Add an interface/port to serve metrics in the Prometheus text format over unauthenticated HTTP (default port: 8336, testnet: 18336) -- NOTE: The metrics server is disabled unless an interface is specified"`
 	DisableDNSSeed       bool          `long:"nodnsseed" description:"Disable DNS seeding for peers"`
 	ExternalIPs          []string      `long:"externalip" description:"Add an ip to the list of local addresses we claim to listen on to peers"`
 	Proxy                string        `long:"proxy" description:"Connect via SOCKS5 proxy (eg. 127.0.0.1:9050)"`
@@ -128,41 +144,81 @@ type config struct {
 	OnionProxyPass       string        `long:"onionpass" default-mask:"-" description:"Password for onion proxy server"`
 	NoOnion              bool          `long:"noonion" description:"Disable connecting to tor hidden services"`
 	TorIsolation         bool          `long:"torisolation" description:"Enable Tor stream isolation by randomizing user credentials for each connection."`
+	ProxyOnly            bool          `long:"proxyonly" description:"Refuse connections and DNS lookups which do not go through the --proxy or --onion proxy and do not advertise discovered local addresses"`
 	TestNet              bool          `long:"testnet" description:"Use the test network"`
 	RegressionTest       bool          `long:"regtest" description:"Use the regression test network"`
+	KeepRegTestDB        bool          `long:"keepregtestdb" description:"Keep the existing regression test database on start up instead of removing it, for example to test restarts"`
 	SimNet               bool          `long:"simnet" description:"Use the simulation test network"`
 	AddCheckpoints       []string      `long:"addcheckpoint" description:"Add a custom checkpoint.  Format: '<height>:<hash>'"`
+	AssumeValid          string        `long:"assumevalid" description:"Hash of a block assumed to be valid along with its ancestors which skips their script validation -- Defaults to the built-in block for the network, 0 disables"`
+	AddUtxoSnapshots     []string      `long:"addutxosnapshot" description:"Add a known good utxo set snapshot which may be imported.  Format: '<height>:<hash>:<commitment>'"`
+	ExportUtxoSnapshot   string        `long:"exportutxosnapshot" description:"Writes a snapshot of the utxo set at the current best block to the given file on start up and then exits."`
+	ImportUtxoSnapshot   string        `long:"importutxosnapshot" description:"Initializes a fresh chain state from the utxo set snapshot in the given file on start up and then syncs from its base block.  The snapshot must be built-in for the network or added with --addutxosnapshot."`
+	DumpBlocks           string        `long:"dumpblocks" description:"Writes the blocks of the main chain to the given file on start up and then exits.  The file can be imported with --loadblock or the addblock utility."`
+	LoadBlocks           []string      `long:"loadblock" description:"Imports the blocks from the given file, written by --dumpblocks, with full validation on start up.  May be specified multiple times."`
+	MaxReorgDepth        string        `long:"maxreorgdepth" description:"Maximum number of blocks a reorganization may disconnect from the main chain, deeper ones are refused even when the side chain has more work -- Defaults to the value for the network, 0 disables"`
 	DbType               string        `long:"dbtype" description:"Database backend to use for the Block Chain"`
+	UtxoBatchSize        uint32        `long:"utxobatchsize" description:"Maximum number of blocks whose utxo set changes are kept in memory and written together while the chain is syncing -- 0 or 1 writes them for every block"`
+	CheckBlocks          bool          `long:"checkblocks" description:"Verifies all of the block data in the database on start up and repairs the block files when the most recently stored blocks are not fully stored"`
+	ShutdownTimeout      time.Duration `long:"shutdowntimeout" description:"How long to wait for a graceful shutdown to complete before exiting without closing the database.  Valid time units are {s, m, h}.  Minimum 1 second"`
 	Profile              string        `long:"profile" description:"Enable HTTP profiling on given port -- NOTE port must be between 1024 and 65536"`
 	CPUProfile           string        `long:"cpuprofile" description:"Write CPU profile to the specified file"`
 	DebugLevel           string        `short:"d" long:"debuglevel" description:"Logging level for all subsystems {trace, debug, info, warn, error, critical} -- You may also specify <subsystem>=<level>,<subsystem2>=<level>,... to set the log level for individual subsystems -- Use show to list available subsystems"`
 	Upnp                 bool          `long:"upnp" description:"Use UPnP to map our listening port outside of NAT"`
+	NATPMP               bool          `long:"natpmp" description:"Use NAT-PMP to map our listening port outside of NAT when UPnP is not enabled or not available"`
 	UseOnlySyncPeerInv   bool          `long:"useonlysyncpeerinv" description:"Use only sync peer inv messages to reduce orphan fetching"`
 	MinRelayTxFee        float64       `long:"minrelaytxfee" description:"The minimum transaction fee in RMG/kB to be considered a non-zero fee."`
 	FreeTxRelayLimit     float64       `long:"limitfreerelay" description:"Limit relay of transactions with no transaction fee to the given amount in thousands of bytes per minute"`
 	RelayPriority        bool          `long:"relaypriority" description:"Require free or low-fee transactions to have high priority for relaying"`
+	NoStrictEncoding     bool          `long:"nostrictencoding" description:"Relay and mine transactions with non-canonical signature or public key encodings, such as high-S signatures, until the strict encoding deployment is active"`
 	MaxOrphanTxs         int           `long:"maxorphantx" description:"Max number of orphan transactions to keep in memory"`
+	MaxMempool           uint32        `long:"maxmempool" description:"Maximum size in megabytes of the transactions kept in the memory pool -- Transactions paying the lowest fee rates are evicted first -- 0 disables the limit"`
+	ReorgExempt          string        `long:"reorgexempt" description:"Comma separated list of the relay policy checks the transactions of blocks disconnected by a reorganization are exempt from when they are added back to the memory pool.  Exemptions: relayfee, nonstandard, ratelimit, all"`
 	Generate             bool          `long:"generate" description:"Generate (mine) blocks using the CPU"`
 	MiningAddrs          []string      `long:"miningaddr" description:"Add the specified payment address to the list of addresses to use for generated blocks -- At least one address is required if the generate option is set"`
 	BlockMinSize         uint32        `long:"blockminsize" description:"Mininum block size in bytes to be used when creating a block"`
 	BlockMaxSize         uint32        `long:"blockmaxsize" description:"Maximum block size in bytes to be used when creating a block"`
 	BlockPrioritySize    uint32        `long:"blockprioritysize" description:"Size in bytes for high-priority/low-fee transactions when creating a block"`
+	TemplateFeeDelta     float64       `long:"templatefeedelta" description:"Increase in RMG of the fees of new memory pool transactions which makes getblocktemplate long poll clients receive a new template right away -- 0 only regenerates templates periodically"`
 	NoPeerBloomFilters   bool          `long:"nopeerbloomfilters" description:"Disable bloom filtering support"`
 	SigCacheMaxSize      uint          `long:"sigcachemaxsize" description:"The maximum number of entries in the signature verification cache"`
+	ScriptWorkers        int           `long:"scriptworkers" description:"The maximum number of goroutines used to validate block scripts -- 0 uses the number of usable CPUs"`
 	BlocksOnly           bool          `long:"blocksonly" description:"Do not accept transactions from remote peers."`
 	TxIndex              bool          `long:"txindex" description:"Maintain a full hash-based transaction index which makes all transactions available via the getrawtransaction RPC"`
 	DropTxIndex          bool          `long:"droptxindex" description:"Deletes the hash-based transaction index from the database on start up and then exits."`
+	ReindexTxIndex       bool          `long:"reindextxindex" description:"Rebuilds the hash-based transaction index, along with the address index when it is enabled, from the blocks in the database on start up -- implies --txindex"`
 	AddrIndex            bool          `long:"addrindex" description:"Maintain a full address-based transaction index which makes the searchrawtransactions RPC available"`
 	DropAddrIndex        bool          `long:"dropaddrindex" description:"Deletes the address-based transaction index from the database on start up and then exits."`
+	BlockStatsIndex      bool          `long:"blockstatsindex" description:"Maintain an index of per-block fee and size statistics which speeds up the getblockstats RPC"`
+	DropBlockStatsIndex  bool          `long:"dropblockstatsindex" description:"Deletes the block statistics index from the database on start up and then exits."`
+	SigKeyIDIndex        bool          `long:"sigkeyidindex" description:"Maintain an index of the blocks signed by each validate key which makes the lookback option of the getvalidatorinfo RPC available"`
+	DropSigKeyIDIndex    bool          `long:"dropsigkeyidindex" description:"Deletes the sig key id index from the database on start up and then exits."`
 	RelayNonStd          bool          `long:"relaynonstd" description:"Relay non-standard transactions regardless of the default settings for the active network."`
 	RejectNonStd         bool          `long:"rejectnonstd" description:"Reject non-standard transactions regardless of the default settings for the active network."`
 	EnableExternalRPC    bool          `long:"enableexternalrpc" description:"Allow external listening of the RPC API. This also requires that TLS is not disabled."`
+	AdminKeyFile         string        `long:"adminkeyfile" description:"File containing the hex-encoded private keys, one per line, of the provision keys used to sign the transactions of the provisionvalidator and revokevalidator RPCs"`
 	lookup               func(string) ([]net.IP, error)
 	oniondial            func(string, string, time.Duration) (net.Conn, error)
 	dial                 func(string, string, time.Duration) (net.Conn, error)
 	addCheckpoints       []chaincfg.Checkpoint
+	assumeValid          *chainhash.Hash
+	utxoSnapshots        []chaincfg.UtxoSnapshot
+	maxReorgDepth        uint32
 	miningAddrs          []provautil.Address
 	minRelayTxFee        provautil.Amount
+	templateFeeDelta     provautil.Amount
+	reorgExemptions      mempool.PolicyExemptions
+	adminKeys            []*btcec.PrivateKey
+	banScores            map[string]uint32
+	whitelists           []whitelist
+	rpcUsers             []*rpcUser
+}
+
+// whitelist is a network whose peers are never banned, and whose transactions
+// are exempt from the relay policy checks in exemptions.
+type whitelist struct {
+	ipnet      *net.IPNet
+	exemptions mempool.PolicyExemptions
 }
 
 // serviceOptions defines the configuration options for the daemon as a service on
@@ -185,25 +241,6 @@ func cleanAndExpandPath(path string) string {
 	return filepath.Clean(os.ExpandEnv(path))
 }
 
-// validLogLevel returns whether or not logLevel is a valid debug log level.
-func validLogLevel(logLevel string) bool {
-	switch logLevel {
-	case "trace":
-		fallthrough
-	case "debug":
-		fallthrough
-	case "info":
-		fallthrough
-	case "warn":
-		fallthrough
-	case "error":
-		fallthrough
-	case "critical":
-		return true
-	}
-	return false
-}
-
 // supportedSubsystems returns a sorted slice of the supported subsystems for
 // logging purposes.
 func supportedSubsystems() []string {
@@ -220,52 +257,14 @@ func supportedSubsystems() []string {
 
 // parseAndSetDebugLevels attempts to parse the specified debug level and set
 // the levels accordingly.  An appropriate error is returned if anything is
-// invalid.
+// invalid, in which case none of the levels are changed.
 func parseAndSetDebugLevels(debugLevel string) error {
-	// When the specified string doesn't have any delimters, treat it as
-	// the log level for all subsystems.
-	if !strings.Contains(debugLevel, ",") && !strings.Contains(debugLevel, "=") {
-		// Validate debug log level.
-		if !validLogLevel(debugLevel) {
-			str := "The specified debug level [%v] is invalid"
-			return fmt.Errorf(str, debugLevel)
-		}
-
-		// Change the logging level for all subsystems.
-		setLogLevels(debugLevel)
-
-		return nil
-	}
-
-	// Split the specified string into subsystem/level pairs while detecting
-	// issues and update the log levels accordingly.
-	for _, logLevelPair := range strings.Split(debugLevel, ",") {
-		if !strings.Contains(logLevelPair, "=") {
-			str := "The specified debug level contains an invalid " +
-				"subsystem/level pair [%v]"
-			return fmt.Errorf(str, logLevelPair)
-		}
-
-		// Extract the specified subsystem and log level.
-		fields := strings.Split(logLevelPair, "=")
-		subsysID, logLevel := fields[0], fields[1]
-
-		// Validate subsystem.
-		if _, exists := subsystemLoggers[subsysID]; !exists {
-			str := "The specified subsystem [%v] is invalid -- " +
-				"supported subsytems %v"
-			return fmt.Errorf(str, subsysID, supportedSubsystems())
-		}
-
-		// Validate log level.
-		if !validLogLevel(logLevel) {
-			str := "The specified debug level [%v] is invalid"
-			return fmt.Errorf(str, logLevel)
-		}
-
-		setLogLevel(subsysID, logLevel)
+	levels, err := debuglevel.Parse(debugLevel, supportedSubsystems())
+	if err != nil {
+		return err
 	}
 
+	setSubsystemLogLevels(levels)
 	return nil
 }
 
@@ -314,6 +313,64 @@ func normalizeAddresses(addrs []string, defaultPort string) []string {
 	return removeDuplicateAddresses(addrs)
 }
 
+// validateUserAgentComments returns an error if any of the passed user agent
+// comments includes a character which is not printable ASCII or is reserved by
+// BIP0014 to separate the parts of a user agent, or if the comments make the
+// advertised user agent exceed the maximum length.
+func validateUserAgentComments(comments []string) error {
+	for _, comment := range comments {
+		for _, c := range comment {
+			if c < ' ' || c > '~' || strings.ContainsRune("/:();", c) {
+				return fmt.Errorf("The uacomment option '%s' "+
+					"contains the invalid character %q -- "+
+					"comments must be printable ASCII without "+
+					"any of '/', ':', '(', ')' or ';'", comment, c)
+			}
+		}
+	}
+
+	msg := wire.MsgVersion{UserAgent: wire.DefaultUserAgent}
+	err := msg.AddUserAgent(userAgentName, userAgentVersion, comments...)
+	if err != nil {
+		return fmt.Errorf("The uacomment options are too long: %v", err)
+	}
+	return nil
+}
+
+// parseMessageLimits returns the limits enforced when encoding and decoding
+// peer messages with the passed msglimit overrides of the form <limit>=<count>
+// applied to the defaults.  The block payload can not be overridden since it
+// must match the block size limit enforced by the consensus rules, which is
+// wire.MaxBlockPayload, so peers are able to relay any valid block.
+func parseMessageLimits(overrides []string) (wire.MessageLimits, error) {
+	limits := wire.DefaultMessageLimits()
+	for _, override := range overrides {
+		parts := strings.SplitN(override, "=", 2)
+		var count uint64
+		var err error
+		if len(parts) == 2 {
+			count, err = strconv.ParseUint(parts[1], 10, 32)
+		}
+		if len(parts) != 2 || err != nil {
+			return limits, fmt.Errorf("The msglimit option '%s' is "+
+				"not of the form <limit>=<count>", override)
+		}
+		switch parts[0] {
+		case "headers":
+			limits.MaxBlockHeadersPerMsg = uint32(count)
+		case "inv":
+			limits.MaxInvPerMsg = uint32(count)
+		case "addr":
+			limits.MaxAddrPerMsg = uint32(count)
+		default:
+			return limits, fmt.Errorf("The msglimit option '%s' "+
+				"refers to the unknown limit '%s'", override,
+				parts[0])
+		}
+	}
+	return limits, nil
+}
+
 // newCheckpointFromStr parses checkpoints in the '<height>:<hash>' format.
 func newCheckpointFromStr(checkpoint string) (chaincfg.Checkpoint, error) {
 	parts := strings.Split(checkpoint, ":")
@@ -362,6 +419,94 @@ func parseCheckpoints(checkpointStrings []string) ([]chaincfg.Checkpoint, error)
 	return checkpoints, nil
 }
 
+// newUtxoSnapshotFromStr parses utxo set snapshots in the
+// '<height>:<hash>:<commitment>' format.
+func newUtxoSnapshotFromStr(snapshot string) (chaincfg.UtxoSnapshot, error) {
+	parts := strings.Split(snapshot, ":")
+	if len(parts) != 3 {
+		return chaincfg.UtxoSnapshot{}, fmt.Errorf("unable to parse "+
+			"utxo snapshot %q -- use the syntax "+
+			"<height>:<hash>:<commitment>", snapshot)
+	}
+
+	height, err := strconv.ParseInt(parts[0], 10, 32)
+	if err != nil {
+		return chaincfg.UtxoSnapshot{}, fmt.Errorf("unable to parse "+
+			"utxo snapshot %q due to malformed height", snapshot)
+	}
+
+	hash, err := chainhash.NewHashFromStr(parts[1])
+	if err != nil || len(parts[1]) == 0 {
+		return chaincfg.UtxoSnapshot{}, fmt.Errorf("unable to parse "+
+			"utxo snapshot %q due to malformed hash", snapshot)
+	}
+
+	commitment, err := chainhash.NewHashFromStr(parts[2])
+	if err != nil || len(parts[2]) == 0 {
+		return chaincfg.UtxoSnapshot{}, fmt.Errorf("unable to parse "+
+			"utxo snapshot %q due to malformed commitment", snapshot)
+	}
+
+	return chaincfg.UtxoSnapshot{
+		Height:     uint32(height),
+		Hash:       hash,
+		Commitment: commitment,
+	}, nil
+}
+
+// parseUtxoSnapshots checks the utxo set snapshot strings for valid syntax
+// ('<height>:<hash>:<commitment>') and parses them to chaincfg.UtxoSnapshot
+// instances.
+func parseUtxoSnapshots(snapshotStrings []string) ([]chaincfg.UtxoSnapshot, error) {
+	if len(snapshotStrings) == 0 {
+		return nil, nil
+	}
+	snapshots := make([]chaincfg.UtxoSnapshot, len(snapshotStrings))
+	for i, snapshotString := range snapshotStrings {
+		snapshot, err := newUtxoSnapshotFromStr(snapshotString)
+		if err != nil {
+			return nil, err
+		}
+		snapshots[i] = snapshot
+	}
+	return snapshots, nil
+}
+
+// loadAdminKeys reads the hex-encoded private keys, one per line, from the
+// passed admin key file.  Empty lines and lines starting with a semicolon are
+// ignored.
+func loadAdminKeys(path string) ([]*btcec.PrivateKey, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var keys []*btcec.PrivateKey
+	scanner := bufio.NewScanner(f)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		// The key is not included in the error since it is secret.
+		keyBytes, err := hex.DecodeString(line)
+		if err != nil || len(keyBytes) != btcec.PrivKeyBytesLen {
+			str := "line %d of admin key file %s is not a " +
+				"hex-encoded %d byte private key"
+			return nil, fmt.Errorf(str, lineNum, path,
+				btcec.PrivKeyBytesLen)
+		}
+		privKey, _ := btcec.PrivKeyFromBytes(btcec.S256(), keyBytes)
+		keys = append(keys, privKey)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
 // filesExists reports whether the named file or directory exists.
 func fileExists(name string) bool {
 	if _, err := os.Stat(name); err != nil {
@@ -415,10 +560,15 @@ func loadConfig() (*config, []string, error) {
 		BlockMaxSize:         defaultBlockMaxSize,
 		BlockPrioritySize:    mempool.DefaultBlockPrioritySize,
 		MaxOrphanTxs:         defaultMaxOrphanTransactions,
+		MaxMempool:           defaultMaxMempool,
 		SigCacheMaxSize:      defaultSigCacheMaxSize,
+		UtxoBatchSize:        defaultUtxoBatchSize,
+		ShutdownTimeout:      defaultShutdownTimeout,
 		Generate:             defaultGenerate,
 		TxIndex:              defaultTxIndex,
 		AddrIndex:            defaultAddrIndex,
+		BlockStatsIndex:      defaultBlockStatsIndex,
+		SigKeyIDIndex:        defaultSigKeyIDIndex,
 		UseOnlySyncPeerInv:   defaultUseOnlySyncPeerInv,
 	}
 
@@ -573,12 +723,12 @@ func loadConfig() (*config, []string, error) {
 	// means each individual piece of serialized data does not have to
 	// worry about changing names per network and such.
 	cfg.DataDir = cleanAndExpandPath(cfg.DataDir)
-	cfg.DataDir = filepath.Join(cfg.DataDir, activeNetParams.Name)
+	cfg.DataDir = provautil.NetworkDataDir(cfg.DataDir, activeNetParams.Params)
 
 	// Append the network type to the log directory so it is "namespaced"
 	// per network in the same fashion as the data directory.
 	cfg.LogDir = cleanAndExpandPath(cfg.LogDir)
-	cfg.LogDir = filepath.Join(cfg.LogDir, activeNetParams.Name)
+	cfg.LogDir = provautil.NetworkDataDir(cfg.LogDir, activeNetParams.Params)
 
 	// Special show command to list supported subsystems and exit.
 	if cfg.DebugLevel == "show" {
@@ -620,6 +770,15 @@ func loadConfig() (*config, []string, error) {
 		}
 	}
 
+	// Don't allow shutdown timeouts that are too short.
+	if cfg.ShutdownTimeout < time.Second {
+		str := "%s: The shutdowntimeout option may not be less than 1s -- parsed [%v]"
+		err := fmt.Errorf(str, funcName, cfg.ShutdownTimeout)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Don't allow ban durations that are too short.
 	if cfg.BanDuration < time.Second {
 		str := "%s: The banduration option may not be less than 1s -- parsed [%v]"
@@ -629,6 +788,87 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// Validate and save the ban score overrides.
+	cfg.banScores = make(map[string]uint32, len(cfg.BanScores))
+	for _, banScore := range cfg.BanScores {
+		parts := strings.SplitN(banScore, "=", 2)
+		var score uint64
+		var err error
+		if len(parts) == 2 {
+			score, err = strconv.ParseUint(parts[1], 10, 32)
+		}
+		if len(parts) != 2 || err != nil {
+			str := "%s: The banscore option '%s' is not of the form " +
+				"<offense>=<score>"
+			err := fmt.Errorf(str, funcName, banScore)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		if _, ok := defaultBanScores[parts[0]]; !ok {
+			str := "%s: The banscore option '%s' refers to the unknown " +
+				"offense '%s'"
+			err := fmt.Errorf(str, funcName, banScore, parts[0])
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		cfg.banScores[parts[0]] = uint32(score)
+	}
+
+	// Validate and apply the message limit overrides.  They must be applied
+	// before any peers are connected.
+	messageLimits, err := parseMessageLimits(cfg.MessageLimits)
+	if err == nil {
+		err = wire.SetMessageLimits(messageLimits)
+	}
+	if err != nil {
+		err := fmt.Errorf("%s: %v", funcName, err)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Validate the user agent comments.
+	if err := validateUserAgentComments(cfg.UserAgentComments); err != nil {
+		err := fmt.Errorf("%s: %v", funcName, err)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Validate and save any whitelisted networks and IPs along with their
+	// relay policy exemptions.
+	cfg.whitelists = make([]whitelist, 0, len(cfg.Whitelists))
+	for _, value := range cfg.Whitelists {
+		var exemptions mempool.PolicyExemptions
+		addr := value
+		if i := strings.LastIndex(value, "@"); i != -1 {
+			exemptions, err = mempool.ParsePolicyExemptions(value[:i])
+			if err != nil {
+				str := "%s: The whitelist value of '%s' is " +
+					"invalid: %v"
+				err = fmt.Errorf(str, funcName, value, err)
+				fmt.Fprintln(os.Stderr, err)
+				fmt.Fprintln(os.Stderr, usageMessage)
+				return nil, nil, err
+			}
+			addr = value[i+1:]
+		}
+		ipnet, err := connmgr.ParseSubnet(addr)
+		if err != nil {
+			str := "%s: The whitelist value of '%s' is invalid"
+			err = fmt.Errorf(str, funcName, value)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		cfg.whitelists = append(cfg.whitelists, whitelist{
+			ipnet:      ipnet,
+			exemptions: exemptions,
+		})
+	}
+
 	// --addPeer and --connect do not mix.
 	if len(cfg.AddPeers) > 0 && len(cfg.ConnectPeers) > 0 {
 		str := "%s: the --addpeer and --connect options can not be " +
@@ -639,8 +879,9 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
-	// --proxy or --connect without --listen disables listening.
-	if (cfg.Proxy != "" || len(cfg.ConnectPeers) > 0) &&
+	// --proxy, --proxyonly or --connect without --listen disables
+	// listening.
+	if (cfg.Proxy != "" || cfg.ProxyOnly || len(cfg.ConnectPeers) > 0) &&
 		len(cfg.Listeners) == 0 {
 		cfg.DisableListen = true
 	}
@@ -695,9 +936,41 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// Validate and save any RPC users along with the commands they were
+	// granted.  User names must be unique, including the admin and limited
+	// users.
+	userNames := make(map[string]struct{})
+	for _, name := range []string{cfg.RPCUser, cfg.RPCLimitUser} {
+		if name != "" {
+			userNames[name] = struct{}{}
+		}
+	}
+	cfg.rpcUsers = make([]*rpcUser, 0, len(cfg.RPCAuth))
+	for _, value := range cfg.RPCAuth {
+		user, err := parseRPCAuth(value)
+		if err != nil {
+			str := "%s: The rpcauth value of '%s' is invalid: %v"
+			err = fmt.Errorf(str, funcName, value, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		if _, ok := userNames[user.name]; ok {
+			str := "%s: The rpcauth user '%s' is specified more " +
+				"than once"
+			err = fmt.Errorf(str, funcName, user.name)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		userNames[user.name] = struct{}{}
+		cfg.rpcUsers = append(cfg.rpcUsers, user)
+	}
+
 	// The RPC server is disabled if no hash or (username+password) is provided.
 	if (cfg.RPCHash == "" && (cfg.RPCUser == "" || cfg.RPCPass == "")) &&
-		(cfg.RPCLimitHash == "" && (cfg.RPCLimitUser == "" || cfg.RPCLimitPass == "")) {
+		(cfg.RPCLimitHash == "" && (cfg.RPCLimitUser == "" || cfg.RPCLimitPass == "")) &&
+		len(cfg.rpcUsers) == 0 {
 		cfg.DisableRPC = true
 	}
 
@@ -724,6 +997,19 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// Validate the templatefeedelta.
+	cfg.templateFeeDelta, err = provautil.NewAmount(cfg.TemplateFeeDelta)
+	if err != nil || cfg.templateFeeDelta < 0 {
+		if err == nil {
+			err = errors.New("must not be negative")
+		}
+		str := "%s: invalid templatefeedelta: %v"
+		err := fmt.Errorf(str, funcName, err)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Limit the max block size to a sane value.
 	if cfg.BlockMaxSize < blockMaxSizeMin || cfg.BlockMaxSize >
 		blockMaxSizeMax {
@@ -747,6 +1033,30 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// Parse the relay policy exemptions of the transactions of disconnected
+	// blocks.
+	if cfg.ReorgExempt != "" {
+		cfg.reorgExemptions, err = mempool.ParsePolicyExemptions(
+			cfg.ReorgExempt)
+		if err != nil {
+			str := "%s: The reorgexempt option is invalid: %v"
+			err := fmt.Errorf(str, funcName, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	}
+
+	// Don't allow a negative number of script validation workers.
+	if cfg.ScriptWorkers < 0 {
+		str := "%s: The scriptworkers option may not be less than 0 " +
+			"-- parsed [%d]"
+		err := fmt.Errorf(str, funcName, cfg.ScriptWorkers)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Limit the block priority and minimum block sizes to max block size.
 	cfg.BlockPrioritySize = minUint32(cfg.BlockPrioritySize, cfg.BlockMaxSize)
 	cfg.BlockMinSize = minUint32(cfg.BlockMinSize, cfg.BlockMaxSize)
@@ -761,6 +1071,21 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// --reindextxindex and --droptxindex do not mix.
+	if cfg.ReindexTxIndex && cfg.DropTxIndex {
+		err := fmt.Errorf("%s: the --reindextxindex and --droptxindex "+
+			"options may not be activated at the same time",
+			funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Rebuilding the transaction index requires it to be enabled.
+	if cfg.ReindexTxIndex {
+		cfg.TxIndex = true
+	}
+
 	// --addrindex and --dropaddrindex do not mix.
 	if cfg.AddrIndex && cfg.DropAddrIndex {
 		err := fmt.Errorf("%s: the --addrindex and --dropaddrindex "+
@@ -783,6 +1108,26 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// --blockstatsindex and --dropblockstatsindex do not mix.
+	if cfg.BlockStatsIndex && cfg.DropBlockStatsIndex {
+		err := fmt.Errorf("%s: the --blockstatsindex and "+
+			"--dropblockstatsindex options may not be activated at "+
+			"the same time", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// --sigkeyidindex and --dropsigkeyidindex do not mix.
+	if cfg.SigKeyIDIndex && cfg.DropSigKeyIDIndex {
+		err := fmt.Errorf("%s: the --sigkeyidindex and "+
+			"--dropsigkeyidindex options may not be activated at "+
+			"the same time", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	// Check mining addresses are valid and saved parsed versions.
 	cfg.miningAddrs = make([]provautil.Address, 0, len(cfg.MiningAddrs))
 	for _, strAddr := range cfg.MiningAddrs {
@@ -804,6 +1149,19 @@ func loadConfig() (*config, []string, error) {
 		cfg.miningAddrs = append(cfg.miningAddrs, addr)
 	}
 
+	// Load the admin keys from the admin key file, so they are not exposed
+	// on the command line.
+	if cfg.AdminKeyFile != "" {
+		cfg.AdminKeyFile = cleanAndExpandPath(cfg.AdminKeyFile)
+		cfg.adminKeys, err = loadAdminKeys(cfg.AdminKeyFile)
+		if err != nil {
+			err := fmt.Errorf("%s: %v", funcName, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	}
+
 	// Ensure there is at least one mining address when the generate flag is
 	// set.
 	if cfg.Generate && len(cfg.MiningAddrs) == 0 {
@@ -825,6 +1183,16 @@ func loadConfig() (*config, []string, error) {
 	cfg.RPCListeners = normalizeAddresses(cfg.RPCListeners,
 		activeNetParams.rpcPort)
 
+	// Add default port to all rest listener addresses if needed and remove
+	// duplicate addresses.
+	cfg.RESTListeners = normalizeAddresses(cfg.RESTListeners,
+		activeNetParams.restPort)
+
+	// Add default port to all metrics listener addresses if needed and
+	// remove duplicate addresses.
+	cfg.MetricsListeners = normalizeAddresses(cfg.MetricsListeners,
+		activeNetParams.metricsPort)
+
 	// RPC listening on external interfaces is only allowed when explicitly
 	// enabled and TLS is required.
 	if !cfg.EnableExternalRPC || (!cfg.DisableRPC && cfg.DisableTLS) {
@@ -889,6 +1257,105 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
+	// Check the utxo set snapshots for syntax errors and add them to the
+	// built-in ones for the network.
+	addUtxoSnapshots, err := parseUtxoSnapshots(cfg.AddUtxoSnapshots)
+	if err != nil {
+		str := "%s: Error parsing utxo snapshots: %v"
+		err := fmt.Errorf(str, funcName, err)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+	cfg.utxoSnapshots = append(cfg.utxoSnapshots,
+		activeNetParams.UtxoSnapshots...)
+	cfg.utxoSnapshots = append(cfg.utxoSnapshots, addUtxoSnapshots...)
+
+	// --importutxosnapshot and --exportutxosnapshot do not mix.
+	if cfg.ImportUtxoSnapshot != "" && cfg.ExportUtxoSnapshot != "" {
+		err := fmt.Errorf("%s: the --importutxosnapshot and "+
+			"--exportutxosnapshot options may not be activated at "+
+			"the same time", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	if cfg.ImportUtxoSnapshot != "" {
+		cfg.ImportUtxoSnapshot = cleanAndExpandPath(cfg.ImportUtxoSnapshot)
+	}
+	if cfg.ExportUtxoSnapshot != "" {
+		cfg.ExportUtxoSnapshot = cleanAndExpandPath(cfg.ExportUtxoSnapshot)
+	}
+
+	// --dumpblocks exits before anything would be imported, so it does not
+	// mix with --loadblock or --importutxosnapshot.
+	if cfg.DumpBlocks != "" &&
+		(len(cfg.LoadBlocks) > 0 || cfg.ImportUtxoSnapshot != "") {
+
+		err := fmt.Errorf("%s: the --dumpblocks option may not be "+
+			"activated at the same time as the --loadblock or "+
+			"--importutxosnapshot options", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	if cfg.DumpBlocks != "" {
+		cfg.DumpBlocks = cleanAndExpandPath(cfg.DumpBlocks)
+	}
+	for i, path := range cfg.LoadBlocks {
+		cfg.LoadBlocks[i] = cleanAndExpandPath(path)
+	}
+
+	// Utxo set snapshots can not be imported with optional indexes since
+	// the blocks before the snapshot base block are not available.
+	if cfg.ImportUtxoSnapshot != "" &&
+		(cfg.TxIndex || cfg.AddrIndex || cfg.BlockStatsIndex ||
+			cfg.SigKeyIDIndex) {
+
+		err := fmt.Errorf("%s: the --importutxosnapshot option may not "+
+			"be activated at the same time as the --txindex, "+
+			"--addrindex, --blockstatsindex, or --sigkeyidindex "+
+			"options", funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
+	// Use the built-in assumed valid block for the network unless it is
+	// overridden or disabled.
+	switch cfg.AssumeValid {
+	case "":
+		cfg.assumeValid = activeNetParams.AssumeValid
+	case "0":
+		cfg.assumeValid = nil
+	default:
+		cfg.assumeValid, err = chainhash.NewHashFromStr(cfg.AssumeValid)
+		if err != nil {
+			str := "%s: Error parsing assumevalid hash: %v"
+			err := fmt.Errorf(str, funcName, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+	}
+
+	// Use the maximum reorganization depth for the network unless it is
+	// overridden.
+	cfg.maxReorgDepth = activeNetParams.MaxReorgDepth
+	if cfg.MaxReorgDepth != "" {
+		depth, err := strconv.ParseUint(cfg.MaxReorgDepth, 10, 32)
+		if err != nil {
+			str := "%s: Error parsing maxreorgdepth: %v"
+			err := fmt.Errorf(str, funcName, err)
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintln(os.Stderr, usageMessage)
+			return nil, nil, err
+		}
+		cfg.maxReorgDepth = uint32(depth)
+	}
+
 	// Tor stream isolation requires either proxy or onion proxy to be set.
 	if cfg.TorIsolation && cfg.Proxy == "" && cfg.OnionProxy == "" {
 		str := "%s: Tor stream isolation requires either proxy or " +
@@ -899,14 +1366,16 @@ func loadConfig() (*config, []string, error) {
 		return nil, nil, err
 	}
 
-	// Setup dial and DNS resolution (lookup) functions depending on the
-	// specified options.  The default is to use the standard
-	// net.DialTimeout function as well as the system DNS resolver.  When a
-	// proxy is specified, the dial function is set to the proxy specific
-	// dial function and the lookup is set to use tor (unless --noonion is
-	// specified in which case the system DNS resolver is used).
-	cfg.dial = net.DialTimeout
-	cfg.lookup = net.LookupIP
+	// Proxy-only mode requires a proxy.
+	if cfg.ProxyOnly && cfg.Proxy == "" && cfg.OnionProxy == "" {
+		str := "%s: proxy-only mode requires either proxy or " +
+			"onionproxy to be set"
+		err := fmt.Errorf(str, funcName)
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintln(os.Stderr, usageMessage)
+		return nil, nil, err
+	}
+
 	if cfg.Proxy != "" {
 		_, _, err := net.SplitHostPort(cfg.Proxy)
 		if err != nil {
@@ -916,43 +1385,7 @@ func loadConfig() (*config, []string, error) {
 			fmt.Fprintln(os.Stderr, usageMessage)
 			return nil, nil, err
 		}
-
-		// Tor isolation flag means proxy credentials will be overridden
-		// unless there is also an onion proxy configured in which case
-		// that one will be overridden.
-		torIsolation := false
-		if cfg.TorIsolation && cfg.OnionProxy == "" &&
-			(cfg.ProxyUser != "" || cfg.ProxyPass != "") {
-
-			torIsolation = true
-			fmt.Fprintln(os.Stderr, "Tor isolation set -- "+
-				"overriding specified proxy user credentials")
-		}
-
-		proxy := &socks.Proxy{
-			Addr:         cfg.Proxy,
-			Username:     cfg.ProxyUser,
-			Password:     cfg.ProxyPass,
-			TorIsolation: torIsolation,
-		}
-		cfg.dial = proxy.DialTimeout
-
-		// Treat the proxy as tor and perform DNS resolution through it
-		// unless the --noonion flag is set or there is an
-		// onion-specific proxy configured.
-		if !cfg.NoOnion && cfg.OnionProxy == "" {
-			cfg.lookup = func(host string) ([]net.IP, error) {
-				return connmgr.TorLookupIP(host, cfg.Proxy)
-			}
-		}
 	}
-
-	// Setup onion address dial function depending on the specified options.
-	// The default is to use the same dial function selected above.  However,
-	// when an onion-specific proxy is specified, the onion address dial
-	// function is set to use the onion-specific proxy while leaving the
-	// normal dial function as selected above.  This allows .onion address
-	// traffic to be routed through a different proxy than normal traffic.
 	if cfg.OnionProxy != "" {
 		_, _, err := net.SplitHostPort(cfg.OnionProxy)
 		if err != nil {
@@ -962,46 +1395,10 @@ func loadConfig() (*config, []string, error) {
 			fmt.Fprintln(os.Stderr, usageMessage)
 			return nil, nil, err
 		}
-
-		// Tor isolation flag means onion proxy credentials will be
-		// overridden.
-		if cfg.TorIsolation &&
-			(cfg.OnionProxyUser != "" || cfg.OnionProxyPass != "") {
-			fmt.Fprintln(os.Stderr, "Tor isolation set -- "+
-				"overriding specified onionproxy user "+
-				"credentials ")
-		}
-
-		cfg.oniondial = func(network, addr string, timeout time.Duration) (net.Conn, error) {
-			proxy := &socks.Proxy{
-				Addr:         cfg.OnionProxy,
-				Username:     cfg.OnionProxyUser,
-				Password:     cfg.OnionProxyPass,
-				TorIsolation: cfg.TorIsolation,
-			}
-			return proxy.DialTimeout(network, addr, timeout)
-		}
-
-		// When configured in bridge mode (both --onion and --proxy are
-		// configured), it means that the proxy configured by --proxy is
-		// not a tor proxy, so override the DNS resolution to use the
-		// onion-specific proxy.
-		if cfg.Proxy != "" {
-			cfg.lookup = func(host string) ([]net.IP, error) {
-				return connmgr.TorLookupIP(host, cfg.OnionProxy)
-			}
-		}
-	} else {
-		cfg.oniondial = cfg.dial
 	}
 
-	// Specifying --noonion means the onion address dial function results in
-	// an error.
-	if cfg.NoOnion {
-		cfg.oniondial = func(a, b string, t time.Duration) (net.Conn, error) {
-			return nil, errors.New("tor has been disabled")
-		}
-	}
+	// Setup the dial and DNS resolution functions.
+	setupDialers(&cfg)
 
 	// Warn about missing config file only after all other configuration is
 	// done.  This prevents the warning on help messages and invalid
@@ -1087,6 +1484,131 @@ func createDefaultConfigFile(destinationPath string) error {
 	return nil
 }
 
+// setupDialers sets up the dial and DNS resolution (lookup) functions of the
+// passed configuration depending on its proxy options, which must have been
+// validated already.  The default is to use the standard net.DialTimeout
+// function as well as the system DNS resolver.  When a proxy is specified, the
+// dial function is set to the proxy specific dial function and the lookup is
+// set to use tor (unless --noonion is specified in which case the system DNS
+// resolver is used).
+//
+// DNS seeding is disabled when proxying unless the lookups go through tor since
+// the seed lookups would otherwise leak to the system DNS resolver.  In
+// proxy-only mode, connections and lookups which would not go through a proxy
+// are refused.
+func setupDialers(cfg *config) {
+	cfg.dial = net.DialTimeout
+	cfg.lookup = net.LookupIP
+	torLookup := false
+	if cfg.Proxy != "" {
+		// Tor isolation flag means proxy credentials will be overridden
+		// unless there is also an onion proxy configured in which case
+		// that one will be overridden.
+		torIsolation := cfg.TorIsolation && cfg.OnionProxy == ""
+		if torIsolation && (cfg.ProxyUser != "" || cfg.ProxyPass != "") {
+			fmt.Fprintln(os.Stderr, "Tor isolation set -- "+
+				"overriding specified proxy user credentials")
+		}
+
+		proxy := &socks.Proxy{
+			Addr:         cfg.Proxy,
+			Username:     cfg.ProxyUser,
+			Password:     cfg.ProxyPass,
+			TorIsolation: torIsolation,
+		}
+		cfg.dial = proxy.DialTimeout
+
+		// Treat the proxy as tor and perform DNS resolution through it
+		// unless the --noonion flag is set or there is an
+		// onion-specific proxy configured.
+		if !cfg.NoOnion && cfg.OnionProxy == "" {
+			torLookup = true
+			cfg.lookup = func(host string) ([]net.IP, error) {
+				return connmgr.TorLookupIP(host, cfg.Proxy)
+			}
+		}
+	}
+
+	// Setup onion address dial function depending on the specified options.
+	// The default is to use the same dial function selected above when it
+	// goes through a proxy.  However, when an onion-specific proxy is
+	// specified, the onion address dial function is set to use the
+	// onion-specific proxy while leaving the normal dial function as
+	// selected above.  This allows .onion address traffic to be routed
+	// through a different proxy than normal traffic.
+	switch {
+	case cfg.OnionProxy != "":
+		// Tor isolation flag means onion proxy credentials will be
+		// overridden.
+		if cfg.TorIsolation &&
+			(cfg.OnionProxyUser != "" || cfg.OnionProxyPass != "") {
+			fmt.Fprintln(os.Stderr, "Tor isolation set -- "+
+				"overriding specified onionproxy user "+
+				"credentials ")
+		}
+
+		cfg.oniondial = func(network, addr string, timeout time.Duration) (net.Conn, error) {
+			proxy := &socks.Proxy{
+				Addr:         cfg.OnionProxy,
+				Username:     cfg.OnionProxyUser,
+				Password:     cfg.OnionProxyPass,
+				TorIsolation: cfg.TorIsolation,
+			}
+			return proxy.DialTimeout(network, addr, timeout)
+		}
+
+		// When configured in bridge mode (both --onion and --proxy are
+		// configured), it means that the proxy configured by --proxy is
+		// not a tor proxy, so override the DNS resolution to use the
+		// onion-specific proxy.
+		if cfg.Proxy != "" {
+			torLookup = true
+			cfg.lookup = func(host string) ([]net.IP, error) {
+				return connmgr.TorLookupIP(host, cfg.OnionProxy)
+			}
+		}
+
+	case cfg.Proxy != "":
+		cfg.oniondial = cfg.dial
+
+	default:
+		// Onion addresses can only be reached through a proxy, and
+		// dialing them directly would leak them to the system DNS
+		// resolver.
+		cfg.oniondial = func(network, addr string, timeout time.Duration) (net.Conn, error) {
+			return nil, errors.New("tor requires a proxy")
+		}
+	}
+
+	// Specifying --noonion means the onion address dial function results in
+	// an error.
+	if cfg.NoOnion {
+		cfg.oniondial = func(a, b string, t time.Duration) (net.Conn, error) {
+			return nil, errors.New("tor has been disabled")
+		}
+	}
+
+	// Refuse the direct connections and the lookups outside of tor in
+	// proxy-only mode.
+	if cfg.ProxyOnly {
+		if cfg.Proxy == "" {
+			cfg.dial = func(network, addr string, timeout time.Duration) (net.Conn, error) {
+				return nil, fmt.Errorf("refusing to connect to %s "+
+					"without a proxy in proxy-only mode", addr)
+			}
+		}
+		if !torLookup {
+			cfg.lookup = func(host string) ([]net.IP, error) {
+				return nil, fmt.Errorf("refusing to resolve %s "+
+					"without tor in proxy-only mode", host)
+			}
+		}
+	}
+	if (cfg.Proxy != "" || cfg.ProxyOnly) && !torLookup {
+		cfg.DisableDNSSeed = true
+	}
+}
+
 // btcdDial connects to the address on the named network using the appropriate
 // dial function depending on the address and configuration options.  For
 // example, .onion addresses will be dialed using the onion specific proxy if
@@ -1114,3 +1636,17 @@ func btcdLookup(host string) ([]net.IP, error) {
 
 	return cfg.lookup(host)
 }
+
+// btcdCanDial returns whether or not the passed address can be dialed with the
+// configured proxies.  For example, onion addresses can't be dialed when tor is
+// disabled or no proxy is configured, and only onion addresses can be dialed in
+// proxy-only mode without --proxy.
+func btcdCanDial(na *wire.NetAddress) bool {
+	switch {
+	case addrmgr.IsI2P(na):
+		return false
+	case addrmgr.IsOnion(na):
+		return !cfg.NoOnion && (cfg.Proxy != "" || cfg.OnionProxy != "")
+	}
+	return !cfg.ProxyOnly || cfg.Proxy != ""
+}
@@ -1,12 +1,21 @@
 package main
 
 import (
+	"bytes"
+	"encoding/hex"
+	"io"
 	"io/ioutil"
+	"net"
 	"os"
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+
+	"github.com/bitgo/prova/wire"
 )
 
 var (
@@ -70,3 +79,400 @@ func TestCreateDefaultConfigFile(t *testing.T) {
 		t.Error("Could not find rpcpass in generated default config file.")
 	}
 }
+
+// socksRequest describes a request received by a SOCKS5 proxy stub.
+type socksRequest struct {
+	cmd  byte
+	dest string
+	user string
+}
+
+// socksStub is a minimal in-process SOCKS5 proxy which records the requests it
+// receives.  It accepts connect requests without connecting anywhere and
+// resolves every host to 10.1.2.3 for tor resolve requests.
+type socksStub struct {
+	listener net.Listener
+	mtx      sync.Mutex
+	requests []socksRequest
+}
+
+// newSocksStub returns a SOCKS5 proxy stub which listens on the loopback
+// interface.
+func newSocksStub(t *testing.T) *socksStub {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	stub := &socksStub{listener: listener}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go stub.handleConn(conn)
+		}
+	}()
+	return stub
+}
+
+// handleConn handles the SOCKS5 negotiation of the passed connection and
+// records its request.
+func (s *socksStub) handleConn(conn net.Conn) {
+	defer conn.Close()
+
+	// Prefer username/password authentication, which carries the stream
+	// isolation credentials, when it is offered.
+	var header [2]byte
+	if _, err := io.ReadFull(conn, header[:]); err != nil {
+		return
+	}
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return
+	}
+	var user string
+	if bytes.IndexByte(methods, 2) != -1 {
+		conn.Write([]byte{5, 2})
+		var auth [2]byte
+		if _, err := io.ReadFull(conn, auth[:]); err != nil {
+			return
+		}
+		username := make([]byte, auth[1])
+		if _, err := io.ReadFull(conn, username); err != nil {
+			return
+		}
+		var passLen [1]byte
+		if _, err := io.ReadFull(conn, passLen[:]); err != nil {
+			return
+		}
+		if _, err := io.ReadFull(conn, make([]byte, passLen[0])); err != nil {
+			return
+		}
+		user = string(username)
+		conn.Write([]byte{1, 0})
+	} else {
+		conn.Write([]byte{5, 0})
+	}
+
+	// Only domain name destinations are used by the dialers.
+	var req [5]byte
+	if _, err := io.ReadFull(conn, req[:]); err != nil || req[3] != 3 {
+		return
+	}
+	dest := make([]byte, int(req[4])+2)
+	if _, err := io.ReadFull(conn, dest); err != nil {
+		return
+	}
+	port := int(dest[len(dest)-2])<<8 | int(dest[len(dest)-1])
+	s.mtx.Lock()
+	s.requests = append(s.requests, socksRequest{
+		cmd:  req[1],
+		dest: net.JoinHostPort(string(dest[:len(dest)-2]), strconv.Itoa(port)),
+		user: user,
+	})
+	s.mtx.Unlock()
+
+	conn.Write([]byte{5, 0, 0, 1, 10, 1, 2, 3, 0, 0})
+	io.Copy(ioutil.Discard, conn)
+}
+
+// takeRequests returns the requests received since the last call.
+func (s *socksStub) takeRequests() []socksRequest {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	requests := s.requests
+	s.requests = nil
+	return requests
+}
+
+// TestSetupDialers ensures connections and DNS lookups go through the
+// configured proxies, that each connection uses its own credentials with tor
+// stream isolation, and that connections and lookups which would not go through
+// a proxy are refused in proxy-only mode.
+func TestSetupDialers(t *testing.T) {
+	origCfg := cfg
+	defer func() { cfg = origCfg }()
+
+	proxy := newSocksStub(t)
+	defer proxy.listener.Close()
+	onionProxy := newSocksStub(t)
+	defer onionProxy.listener.Close()
+
+	const onionHost = "3g2upl4pq6kufc4m.onion"
+	ipAddr := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 18333}
+	onion := &onionAddr{addr: onionHost + ":18333"}
+
+	// dial dials the passed address and returns whether it succeeded.
+	dial := func(addr net.Addr) bool {
+		conn, err := btcdDial(addr)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	}
+
+	// checkRequests ensures the passed proxy received requests for exactly
+	// the passed destinations.
+	checkRequests := func(name string, stub *socksStub, cmd byte, dests ...string) []socksRequest {
+		requests := stub.takeRequests()
+		if len(requests) != len(dests) {
+			t.Fatalf("%s: got requests %+v, want destinations %v",
+				name, requests, dests)
+		}
+		for i, req := range requests {
+			if req.cmd != cmd || req.dest != dests[i] {
+				t.Fatalf("%s: got request %+v, want command %d "+
+					"to %s", name, req, cmd, dests[i])
+			}
+		}
+		return requests
+	}
+
+	// All connections and lookups go through the proxy and every
+	// connection uses its own credentials with stream isolation.
+	cfg = &config{Proxy: proxy.listener.Addr().String(), TorIsolation: true}
+	setupDialers(cfg)
+	if !dial(ipAddr) || !dial(ipAddr) || !dial(onion) {
+		t.Fatal("proxy: dial failed")
+	}
+	requests := checkRequests("proxy", proxy, 1, "10.0.0.1:18333",
+		"10.0.0.1:18333", onion.addr)
+	if requests[0].user == "" || requests[0].user == requests[1].user {
+		t.Fatalf("proxy: connections are not isolated: %+v", requests)
+	}
+	ips, err := btcdLookup("seed.example.com")
+	if err != nil || len(ips) != 1 || !ips[0].Equal(net.ParseIP("10.1.2.3")) {
+		t.Fatalf("proxy: unexpected lookup result %v (err %v)", ips, err)
+	}
+	checkRequests("proxy lookup", proxy, 0xf0, "seed.example.com:0")
+	if cfg.DisableDNSSeed {
+		t.Fatal("proxy: DNS seeding disabled with lookups through tor")
+	}
+
+	// DNS seeding is disabled when the lookups do not go through tor.
+	cfg = &config{Proxy: proxy.listener.Addr().String(), NoOnion: true}
+	setupDialers(cfg)
+	if !cfg.DisableDNSSeed {
+		t.Fatal("noonion: DNS seeding is not disabled")
+	}
+	if dial(onion) {
+		t.Fatal("noonion: dialed onion address")
+	}
+
+	// Onion addresses go through the onion proxy and other addresses
+	// through the proxy in bridge mode.
+	cfg = &config{
+		Proxy:      proxy.listener.Addr().String(),
+		OnionProxy: onionProxy.listener.Addr().String(),
+	}
+	setupDialers(cfg)
+	if !dial(ipAddr) || !dial(onion) {
+		t.Fatal("bridge: dial failed")
+	}
+	checkRequests("bridge", proxy, 1, "10.0.0.1:18333")
+	checkRequests("bridge", onionProxy, 1, onion.addr)
+
+	// Onion addresses can't be dialed without a proxy.
+	cfg = &config{}
+	setupDialers(cfg)
+	if dial(onion) {
+		t.Fatal("no proxy: dialed onion address")
+	}
+
+	// Only onion addresses can be dialed in proxy-only mode with just an
+	// onion proxy, and lookups are refused.
+	cfg = &config{
+		OnionProxy: onionProxy.listener.Addr().String(),
+		ProxyOnly:  true,
+	}
+	setupDialers(cfg)
+	if !dial(onion) {
+		t.Fatal("proxy-only: onion dial failed")
+	}
+	if dial(ipAddr) {
+		t.Fatal("proxy-only: dialed address directly")
+	}
+	if _, err := btcdLookup("seed.example.com"); err == nil {
+		t.Fatal("proxy-only: lookup was not refused")
+	}
+	if !cfg.DisableDNSSeed {
+		t.Fatal("proxy-only: DNS seeding is not disabled")
+	}
+	checkRequests("proxy-only", onionProxy, 1, onion.addr)
+	checkRequests("proxy-only", proxy, 0)
+
+	// Only the addresses which can be dialed are selected.
+	torV3, err := wire.NewNetAddressV2(wire.NetIDTorV3, make([]byte, 32),
+		18333, wire.SFNodeNetwork)
+	if err != nil {
+		t.Fatalf("NewNetAddressV2: unexpected error: %v", err)
+	}
+	ipv4 := wire.NewNetAddressIPPort(net.ParseIP("10.0.0.1"), 18333,
+		wire.SFNodeNetwork)
+	if !btcdCanDial(torV3) || btcdCanDial(ipv4) {
+		t.Fatal("proxy-only: unexpected dialable addresses")
+	}
+	cfg = &config{}
+	setupDialers(cfg)
+	if btcdCanDial(torV3) || !btcdCanDial(ipv4) {
+		t.Fatal("no proxy: unexpected dialable addresses")
+	}
+}
+
+// TestValidateUserAgentComments ensures user agent comments are limited to the
+// characters allowed by BIP0014 and to the maximum user agent length.
+func TestValidateUserAgentComments(t *testing.T) {
+	tests := []struct {
+		name     string
+		comments []string
+		valid    bool
+	}{
+		{"none", nil, true},
+		{"simple", []string{"datacenter-1", "build 7@eu.west"}, true},
+		{"empty", []string{""}, true},
+		{"slash", []string{"a/b"}, false},
+		{"colon", []string{"a:b"}, false},
+		{"open paren", []string{"a(b"}, false},
+		{"close paren", []string{"a)b"}, false},
+		{"semicolon", []string{"a;b"}, false},
+		{"control", []string{"a\nb"}, false},
+		{"non-ascii", []string{"caf\u00e9"}, false},
+		{"too long", []string{strings.Repeat("a", wire.MaxUserAgentLen)}, false},
+	}
+	for _, test := range tests {
+		err := validateUserAgentComments(test.comments)
+		if (err == nil) != test.valid {
+			t.Errorf("%s: got error %v, want valid %v", test.name,
+				err, test.valid)
+		}
+	}
+}
+
+// TestParseMessageLimits ensures the msglimit options override the intended
+// message limits and malformed options are rejected.
+func TestParseMessageLimits(t *testing.T) {
+	defaults := wire.DefaultMessageLimits()
+	tests := []struct {
+		name      string
+		overrides []string
+		want      wire.MessageLimits
+		valid     bool
+	}{
+		{
+			name:  "defaults",
+			want:  defaults,
+			valid: true,
+		},
+		{
+			name:      "all limits",
+			overrides: []string{"headers=4000", "inv=100000", "addr=10"},
+			want: wire.MessageLimits{
+				MaxBlockHeadersPerMsg: 4000,
+				MaxInvPerMsg:          100000,
+				MaxAddrPerMsg:         10,
+				MaxBlockPayload:       wire.MaxBlockPayload,
+			},
+			valid: true,
+		},
+		{
+			name:      "block payload",
+			overrides: []string{"block=5000000"},
+		},
+		{
+			name:      "missing count",
+			overrides: []string{"inv"},
+		},
+		{
+			name:      "negative count",
+			overrides: []string{"inv=-1"},
+		},
+		{
+			name:      "count overflow",
+			overrides: []string{"inv=4294967296"},
+		},
+	}
+	for _, test := range tests {
+		limits, err := parseMessageLimits(test.overrides)
+		if (err == nil) != test.valid {
+			t.Errorf("%s: got error %v, want valid %v", test.name,
+				err, test.valid)
+			continue
+		}
+		if test.valid && limits != test.want {
+			t.Errorf("%s: got limits %+v, want %+v", test.name,
+				limits, test.want)
+		}
+	}
+}
+
+func TestLoadAdminKeys(t *testing.T) {
+	dir, err := ioutil.TempDir("", "adminkeys")
+	if err != nil {
+		t.Fatalf("Failed creating a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	key1 := strings.Repeat("01", 32)
+	key2 := strings.Repeat("ab", 32)
+	tests := []struct {
+		name     string
+		contents string
+		want     []string
+		valid    bool
+	}{
+		{
+			name:     "keys with comments and empty lines",
+			contents: "; provision keys\n" + key1 + "\n\n  " + key2 + "  \n",
+			want:     []string{key1, key2},
+			valid:    true,
+		},
+		{
+			name:     "no keys",
+			contents: "; none\n",
+			valid:    true,
+		},
+		{
+			name:     "not hex",
+			contents: key1 + "\nzz\n",
+		},
+		{
+			name:     "short key",
+			contents: key1[:62] + "\n",
+		},
+	}
+	for i, test := range tests {
+		path := filepath.Join(dir, strconv.Itoa(i))
+		err := ioutil.WriteFile(path, []byte(test.contents), 0600)
+		if err != nil {
+			t.Fatalf("Failed writing the admin key file: %v", err)
+		}
+		keys, err := loadAdminKeys(path)
+		if (err == nil) != test.valid {
+			t.Errorf("%s: got error %v, want valid %v", test.name,
+				err, test.valid)
+			continue
+		}
+		if err != nil && strings.Contains(err.Error(), key1) {
+			t.Errorf("%s: error %q contains a private key",
+				test.name, err)
+		}
+		if len(keys) != len(test.want) {
+			t.Errorf("%s: got %d keys, want %d", test.name,
+				len(keys), len(test.want))
+			continue
+		}
+		for j, key := range keys {
+			got := hex.EncodeToString(key.Serialize())
+			if got != test.want[j] {
+				t.Errorf("%s: got key #%d %s, want %s", test.name,
+					j+1, got, test.want[j])
+			}
+		}
+	}
+
+	if _, err := loadAdminKeys(filepath.Join(dir, "missing")); err == nil {
+		t.Errorf("Loading a missing admin key file did not fail")
+	}
+}
@@ -0,0 +1,366 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package connmgr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// banListVersion is the version of the serialized ban list.
+	banListVersion = 1
+
+	// maxBanScores is the number of addresses whose ban scores are tracked
+	// before the ones which decayed to zero are forgotten.
+	maxBanScores = 1000
+)
+
+var (
+	// ErrAlreadyBanned is returned when banning a network which is already
+	// banned.
+	ErrAlreadyBanned = errors.New("network is already banned")
+
+	// ErrNotBanned is returned when unbanning a network which is not
+	// banned.
+	ErrNotBanned = errors.New("network is not banned")
+)
+
+// ParseSubnet parses the passed IP address or network in CIDR notation.  A
+// single IP address is returned as a network which only contains the address.
+func ParseSubnet(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, subnet, err := net.ParseCIDR(s)
+		return subnet, err
+	}
+
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address or network %q", s)
+	}
+	bits := 8 * net.IPv6len
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+		bits = 8 * net.IPv4len
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+// Ban describes a banned network.
+type Ban struct {
+	Subnet  *net.IPNet
+	Created time.Time
+	Until   time.Time
+	Reason  string
+}
+
+// serializedBan is the persisted form of a ban.
+type serializedBan struct {
+	Subnet  string `json:"subnet"`
+	Created int64  `json:"created"`
+	Until   int64  `json:"until"`
+	Reason  string `json:"reason"`
+}
+
+// serializedBanList is the persisted form of the bans of a ban manager.
+type serializedBanList struct {
+	Version int             `json:"version"`
+	Bans    []serializedBan `json:"bans"`
+}
+
+// BanManager tracks the ban scores of peer addresses across connections along
+// with the banned networks.  The bans are timed and persisted to a file so they
+// survive restarts.
+//
+// Deciding when a peer is banned is left to the caller, which typically bans
+// the address of a peer once its score exceeds a threshold.
+type BanManager struct {
+	mtx     sync.Mutex
+	banFile string
+	scores  map[string]*DynamicBanScore
+	bans    map[string]*Ban
+}
+
+// NewBanManager returns a new ban manager which persists the bans to the passed
+// file and loads the bans which did not expire yet from it.  The bans are not
+// persisted when the file is empty.
+func NewBanManager(banFile string) *BanManager {
+	bm := &BanManager{
+		banFile: banFile,
+		scores:  make(map[string]*DynamicBanScore),
+		bans:    make(map[string]*Ban),
+	}
+	if banFile == "" {
+		return bm
+	}
+
+	// Start without bans when the file is malformed.  It is replaced the
+	// next time the bans change.
+	if err := bm.load(time.Now()); err != nil {
+		log.Errorf("Failed to load bans from %s: %v", banFile, err)
+		bm.bans = make(map[string]*Ban)
+		return bm
+	}
+	if len(bm.bans) > 0 {
+		log.Infof("Loaded %d bans from file '%s'", len(bm.bans), banFile)
+	}
+	return bm
+}
+
+// load loads the bans which are still active at the passed time from the ban
+// file.
+func (bm *BanManager) load(now time.Time) error {
+	f, err := os.Open(bm.banFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var banList serializedBanList
+	if err := json.NewDecoder(f).Decode(&banList); err != nil {
+		return err
+	}
+	if banList.Version != banListVersion {
+		return fmt.Errorf("unknown version %d", banList.Version)
+	}
+	for _, sb := range banList.Bans {
+		subnet, err := ParseSubnet(sb.Subnet)
+		if err != nil {
+			return err
+		}
+		ban := &Ban{
+			Subnet:  subnet,
+			Created: time.Unix(sb.Created, 0),
+			Until:   time.Unix(sb.Until, 0),
+			Reason:  sb.Reason,
+		}
+		if ban.Until.After(now) {
+			bm.bans[subnet.String()] = ban
+		}
+	}
+	return nil
+}
+
+// save persists the bans which are still active at the passed time to the ban
+// file.  The file is replaced atomically so it is never left incomplete.
+//
+// This function MUST be called with the ban manager lock held.
+func (bm *BanManager) save(now time.Time) {
+	if bm.banFile == "" {
+		return
+	}
+
+	banList := serializedBanList{Version: banListVersion}
+	for _, ban := range bm.activeBans(now) {
+		banList.Bans = append(banList.Bans, serializedBan{
+			Subnet:  ban.Subnet.String(),
+			Created: ban.Created.Unix(),
+			Until:   ban.Until.Unix(),
+			Reason:  ban.Reason,
+		})
+	}
+
+	tmpFile := bm.banFile + ".new"
+	f, err := os.Create(tmpFile)
+	if err != nil {
+		log.Errorf("Error opening file %s: %v", tmpFile, err)
+		return
+	}
+	err = json.NewEncoder(f).Encode(&banList)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpFile, bm.banFile)
+	}
+	if err != nil {
+		log.Errorf("Failed to write file %s: %v", bm.banFile, err)
+		os.Remove(tmpFile)
+	}
+}
+
+// activeBans returns the bans which are still active at the passed time sorted
+// by their networks.
+//
+// This function MUST be called with the ban manager lock held.
+func (bm *BanManager) activeBans(now time.Time) []Ban {
+	bans := make([]Ban, 0, len(bm.bans))
+	for _, ban := range bm.bans {
+		if ban.Until.After(now) {
+			bans = append(bans, *ban)
+		}
+	}
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].Subnet.String() < bans[j].Subnet.String()
+	})
+	return bans
+}
+
+// addScore increases the ban score of the passed host as if it happened at the
+// passed time.  See AddScore.
+func (bm *BanManager) addScore(host string, persistent, transient uint32, now time.Time) uint32 {
+	bm.mtx.Lock()
+	defer bm.mtx.Unlock()
+
+	// Forget the hosts whose scores decayed to zero once too many are
+	// tracked.
+	if len(bm.scores) >= maxBanScores {
+		for h, score := range bm.scores {
+			if score.int(now) == 0 {
+				delete(bm.scores, h)
+			}
+		}
+	}
+
+	score, ok := bm.scores[host]
+	if !ok {
+		score = &DynamicBanScore{}
+		bm.scores[host] = score
+	}
+	return score.increase(persistent, transient, now)
+}
+
+// AddScore increases the persistent and decaying ban score of the passed host
+// by the passed values and returns the resulting score.  The score of a host
+// accumulates across all connections from and to it.
+//
+// This function is safe for concurrent access.
+func (bm *BanManager) AddScore(host string, persistent, transient uint32) uint32 {
+	return bm.addScore(host, persistent, transient, time.Now())
+}
+
+// score returns the ban score of the passed host at the passed time.
+func (bm *BanManager) score(host string, now time.Time) uint32 {
+	bm.mtx.Lock()
+	defer bm.mtx.Unlock()
+
+	score, ok := bm.scores[host]
+	if !ok {
+		return 0
+	}
+	return score.int(now)
+}
+
+// Score returns the current ban score of the passed host.
+//
+// This function is safe for concurrent access.
+func (bm *BanManager) Score(host string) uint32 {
+	return bm.score(host, time.Now())
+}
+
+// ResetScore forgets the ban score of the passed host, typically once it has
+// been banned.
+//
+// This function is safe for concurrent access.
+func (bm *BanManager) ResetScore(host string) {
+	bm.mtx.Lock()
+	delete(bm.scores, host)
+	bm.mtx.Unlock()
+}
+
+// ban bans the passed network until the passed time as of the passed time.
+// See Ban.
+func (bm *BanManager) ban(subnet *net.IPNet, until time.Time, reason string, now time.Time) error {
+	bm.mtx.Lock()
+	defer bm.mtx.Unlock()
+
+	key := subnet.String()
+	if ban, ok := bm.bans[key]; ok && ban.Until.After(now) {
+		return ErrAlreadyBanned
+	}
+	bm.bans[key] = &Ban{
+		Subnet:  subnet,
+		Created: now,
+		Until:   until,
+		Reason:  reason,
+	}
+	bm.save(now)
+	return nil
+}
+
+// Ban bans the addresses of the passed network until the passed time for the
+// passed reason.  ErrAlreadyBanned is returned when the network is already
+// banned.
+//
+// This function is safe for concurrent access.
+func (bm *BanManager) Ban(subnet *net.IPNet, until time.Time, reason string) error {
+	return bm.ban(subnet, until, reason, time.Now())
+}
+
+// Unban lifts the ban of the passed network.  ErrNotBanned is returned when the
+// network is not banned.  Bans of networks which contain or are contained in
+// the passed network are not affected.
+//
+// This function is safe for concurrent access.
+func (bm *BanManager) Unban(subnet *net.IPNet) error {
+	bm.mtx.Lock()
+	defer bm.mtx.Unlock()
+
+	now := time.Now()
+	key := subnet.String()
+	ban, ok := bm.bans[key]
+	if !ok || !ban.Until.After(now) {
+		return ErrNotBanned
+	}
+	delete(bm.bans, key)
+	bm.save(now)
+	return nil
+}
+
+// ClearBans lifts all bans.
+//
+// This function is safe for concurrent access.
+func (bm *BanManager) ClearBans() {
+	bm.mtx.Lock()
+	defer bm.mtx.Unlock()
+
+	bm.bans = make(map[string]*Ban)
+	bm.save(time.Now())
+}
+
+// isBanned returns when the ban of the passed IP address ends and whether or
+// not it is banned at the passed time.  See IsBanned.
+func (bm *BanManager) isBanned(ip net.IP, now time.Time) (time.Time, bool) {
+	bm.mtx.Lock()
+	defer bm.mtx.Unlock()
+
+	var until time.Time
+	for _, ban := range bm.bans {
+		if ban.Until.After(now) && ban.Until.After(until) &&
+			ban.Subnet.Contains(ip) {
+
+			until = ban.Until
+		}
+	}
+	return until, !until.IsZero()
+}
+
+// IsBanned returns whether or not the passed IP address is part of a banned
+// network along with when the last of the bans which apply to it ends.
+//
+// This function is safe for concurrent access.
+func (bm *BanManager) IsBanned(ip net.IP) (time.Time, bool) {
+	return bm.isBanned(ip, time.Now())
+}
+
+// Bans returns the active bans sorted by their networks.
+//
+// This function is safe for concurrent access.
+func (bm *BanManager) Bans() []Ban {
+	bm.mtx.Lock()
+	defer bm.mtx.Unlock()
+
+	return bm.activeBans(time.Now())
+}
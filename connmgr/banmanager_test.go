@@ -0,0 +1,219 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package connmgr
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// mustParseSubnet parses the passed IP address or network and panics on error.
+func mustParseSubnet(s string) *net.IPNet {
+	subnet, err := ParseSubnet(s)
+	if err != nil {
+		panic(err)
+	}
+	return subnet
+}
+
+// TestParseSubnet ensures IP addresses and networks are parsed into the
+// expected networks.
+func TestParseSubnet(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"10.0.0.1", "10.0.0.1/32"},
+		{"10.0.0.1/8", "10.0.0.0/8"},
+		{"::ffff:10.0.0.1", "10.0.0.1/32"},
+		{"fe80::1", "fe80::1/128"},
+		{"fe80::1/64", "fe80::/64"},
+	}
+	for _, test := range tests {
+		subnet, err := ParseSubnet(test.in)
+		if err != nil {
+			t.Errorf("ParseSubnet(%q): unexpected error: %v", test.in,
+				err)
+			continue
+		}
+		if subnet.String() != test.want {
+			t.Errorf("ParseSubnet(%q): got %v, want %v", test.in,
+				subnet, test.want)
+		}
+	}
+
+	for _, in := range []string{"", "10.0.0", "10.0.0.1/33", "host"} {
+		if _, err := ParseSubnet(in); err == nil {
+			t.Errorf("ParseSubnet(%q): did not return an error", in)
+		}
+	}
+}
+
+// TestBanManagerScore ensures the ban scores of hosts accumulate independently
+// and the decaying part decays while the persistent part does not.
+func TestBanManagerScore(t *testing.T) {
+	bm := NewBanManager("")
+	base := time.Unix(1500000000, 0)
+
+	// The score of a host accumulates, such as across several connections,
+	// until it is reset.
+	if score := bm.addScore("10.0.0.1", 10, 0, base); score != 10 {
+		t.Fatalf("score is %d, want 10", score)
+	}
+	if score := bm.addScore("10.0.0.1", 20, 50, base); score != 80 {
+		t.Fatalf("score is %d, want 80", score)
+	}
+	if score := bm.score("10.0.0.2", base); score != 0 {
+		t.Fatalf("score of another host is %d, want 0", score)
+	}
+
+	// Only the decaying part decays.
+	if score := bm.score("10.0.0.1", base.Add(Halflife*time.Second)); score != 55 {
+		t.Fatalf("score after a half-life is %d, want 55", score)
+	}
+	if score := bm.score("10.0.0.1", base.Add(time.Hour)); score != 30 {
+		t.Fatalf("score after an hour is %d, want 30", score)
+	}
+
+	bm.ResetScore("10.0.0.1")
+	if score := bm.score("10.0.0.1", base); score != 0 {
+		t.Fatalf("score after reset is %d, want 0", score)
+	}
+}
+
+// TestBanManagerBans ensures the addresses of banned networks are banned until
+// the bans expire or are lifted.
+func TestBanManagerBans(t *testing.T) {
+	bm := NewBanManager("")
+	base := time.Now()
+	hostUntil := base.Add(time.Hour)
+	subnetUntil := base.Add(2 * time.Hour)
+	if err := bm.ban(mustParseSubnet("10.0.0.1"), hostUntil, "host", base); err != nil {
+		t.Fatalf("ban: unexpected error: %v", err)
+	}
+	if err := bm.ban(mustParseSubnet("10.1.0.0/16"), subnetUntil, "subnet", base); err != nil {
+		t.Fatalf("ban: unexpected error: %v", err)
+	}
+	err := bm.ban(mustParseSubnet("10.0.0.1"), hostUntil, "host", base)
+	if err != ErrAlreadyBanned {
+		t.Fatalf("ban: got error %v, want %v", err, ErrAlreadyBanned)
+	}
+
+	tests := []struct {
+		ip     string
+		at     time.Time
+		banned bool
+		until  time.Time
+	}{
+		{"10.0.0.1", base, true, hostUntil},
+		{"10.0.0.2", base, false, time.Time{}},
+		{"10.1.2.3", base, true, subnetUntil},
+		{"10.2.0.1", base, false, time.Time{}},
+		{"10.0.0.1", hostUntil, false, time.Time{}},
+		{"10.1.2.3", hostUntil, true, subnetUntil},
+		{"10.1.2.3", subnetUntil, false, time.Time{}},
+	}
+	for _, test := range tests {
+		until, banned := bm.isBanned(net.ParseIP(test.ip), test.at)
+		if banned != test.banned || !until.Equal(test.until) {
+			t.Errorf("isBanned(%s) at %v: got %v until %v, want %v "+
+				"until %v", test.ip, test.at, banned, until,
+				test.banned, test.until)
+		}
+	}
+
+	// The bans are listed in the order of their networks.
+	bans := bm.Bans()
+	if len(bans) != 2 || bans[0].Reason != "host" ||
+		bans[1].Reason != "subnet" {
+
+		t.Fatalf("unexpected bans %+v", bans)
+	}
+
+	// Lifting the ban of a network only affects that network.
+	if err := bm.Unban(mustParseSubnet("10.1.2.3")); err != ErrNotBanned {
+		t.Fatalf("Unban: got error %v, want %v", err, ErrNotBanned)
+	}
+	if err := bm.Unban(mustParseSubnet("10.1.0.0/16")); err != nil {
+		t.Fatalf("Unban: unexpected error: %v", err)
+	}
+	if _, banned := bm.IsBanned(net.ParseIP("10.1.2.3")); banned {
+		t.Fatal("address of unbanned network is still banned")
+	}
+	if _, banned := bm.IsBanned(net.ParseIP("10.0.0.1")); !banned {
+		t.Fatal("address is no longer banned")
+	}
+
+	bm.ClearBans()
+	if bans := bm.Bans(); len(bans) != 0 {
+		t.Fatalf("unexpected bans after clearing them %+v", bans)
+	}
+}
+
+// TestBanManagerPersist ensures the active bans are loaded again by a new ban
+// manager using the same file and that a malformed file is ignored.
+func TestBanManagerPersist(t *testing.T) {
+	dir, err := ioutil.TempDir("", "banmanager")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	banFile := filepath.Join(dir, "banlist.json")
+
+	bm := NewBanManager(banFile)
+	now := time.Now()
+	until := now.Add(time.Hour).Truncate(time.Second)
+	if err := bm.Ban(mustParseSubnet("fe80::/64"), until, "manual"); err != nil {
+		t.Fatalf("Ban: unexpected error: %v", err)
+	}
+	expired := now.Add(-time.Hour)
+	if err := bm.ban(mustParseSubnet("10.0.0.1"), now.Add(time.Minute), "expiring", expired); err != nil {
+		t.Fatalf("ban: unexpected error: %v", err)
+	}
+
+	// The active bans are loaded again, and only the ban which did not
+	// expire yet is loaded once the other one expired.
+	bm = NewBanManager(banFile)
+	bans := bm.Bans()
+	if len(bans) != 2 {
+		t.Fatalf("got %d bans, want 2", len(bans))
+	}
+	if _, banned := bm.isBanned(net.ParseIP("fe80::1"), now); !banned {
+		t.Fatal("persisted ban was not loaded")
+	}
+	bm = NewBanManager(banFile)
+	bm.bans = make(map[string]*Ban)
+	if err := bm.load(now.Add(30 * time.Minute)); err != nil {
+		t.Fatalf("load: unexpected error: %v", err)
+	}
+	if len(bm.bans) != 1 {
+		t.Fatalf("got %d bans, want the unexpired one", len(bm.bans))
+	}
+	for _, ban := range bm.bans {
+		if ban.Subnet.String() != "fe80::/64" || !ban.Until.Equal(until) ||
+			ban.Reason != "manual" {
+
+			t.Fatalf("unexpected loaded ban %+v", ban)
+		}
+	}
+
+	// Lifting all bans is persisted as well.
+	bm.ClearBans()
+	if bans := NewBanManager(banFile).Bans(); len(bans) != 0 {
+		t.Fatalf("unexpected bans after clearing them %+v", bans)
+	}
+
+	// A malformed file is ignored.
+	if err := ioutil.WriteFile(banFile, []byte("{"), 0600); err != nil {
+		t.Fatalf("unable to write ban file: %v", err)
+	}
+	if bans := NewBanManager(banFile).Bans(); len(bans) != 0 {
+		t.Fatalf("unexpected bans from malformed file %+v", bans)
+	}
+}
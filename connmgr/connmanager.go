@@ -40,19 +40,44 @@ var (
 // ConnState represents the state of the requested connection.
 type ConnState uint8
 
-// ConnState can be either pending, established, disconnected or failed.  When
-// a new connection is requested, it is attempted and categorized as
-// established or failed depending on the connection result.  An established
-// connection which was disconnected is categorized as disconnected.
+// ConnState can be either pending, established, disconnected, failed or
+// canceled.  When a new connection is requested, it is attempted and
+// categorized as established or failed depending on the connection result.  An
+// established connection which was disconnected is categorized as
+// disconnected.  A request which was removed before it was established is
+// categorized as canceled.
 const (
 	ConnPending ConnState = iota
 	ConnEstablished
 	ConnDisconnected
 	ConnFailed
+	ConnCanceled
 )
 
+// connStateStrings is a map of connection states back to their constant names
+// for pretty printing.
+var connStateStrings = map[ConnState]string{
+	ConnPending:      "pending",
+	ConnEstablished:  "established",
+	ConnDisconnected: "disconnected",
+	ConnFailed:       "failed",
+	ConnCanceled:     "canceled",
+}
+
+// String returns the ConnState in human-readable form.
+func (s ConnState) String() string {
+	if str, ok := connStateStrings[s]; ok {
+		return str
+	}
+	return fmt.Sprintf("Unknown ConnState (%d)", uint8(s))
+}
+
 // ConnReq is the connection request to a network address. If permanent, the
 // connection will be retried on disconnection.
+//
+// Requests made via Connect, both permanent and non-permanent ones, do not
+// count toward the target number of outbound connections, which only applies
+// to the connections the manager makes automatically.
 type ConnReq struct {
 	// The following variables must only be used atomically.
 	id uint64
@@ -60,6 +85,10 @@ type ConnReq struct {
 	Addr      net.Addr
 	Permanent bool
 
+	// automatic is set for the requests the connection manager makes to
+	// maintain the target number of outbound connections.
+	automatic bool
+
 	conn       net.Conn
 	state      ConnState
 	stateMtx   sync.RWMutex
@@ -86,6 +115,12 @@ func (c *ConnReq) State() ConnState {
 	return state
 }
 
+// RetryCount returns the number of failed attempts to connect to the address of
+// a permanent connection request since it was last connected.
+func (c *ConnReq) RetryCount() uint32 {
+	return atomic.LoadUint32(&c.retryCount)
+}
+
 // String returns a human-readable string for the connection request.
 func (c *ConnReq) String() string {
 	if c.Addr.String() == "" {
@@ -139,20 +174,38 @@ type Config struct {
 	// to.  If nil, no new connections will be made automatically.
 	GetNewAddress func() (net.Addr, error)
 
+	// Anchors are the addresses of outbound peers from a previous run which
+	// are dialed before any other automatic connection is made.  They take
+	// up to TargetOutbound of the automatic connections and are replaced
+	// with new addresses when they fail or disconnect.  This field will not
+	// have any effect if the GetNewAddress field is not also specified.
+	Anchors []net.Addr
+
 	// Dial connects to the address on the named network. It cannot be nil.
 	Dial func(net.Addr) (net.Conn, error)
 }
 
+// registerPending is used to register a pending connection attempt so it can
+// be canceled via Remove before it is established.  Whether or not the attempt
+// was registered is sent on the done channel.
+type registerPending struct {
+	c    *ConnReq
+	done chan bool
+}
+
 // handleConnected is used to queue a successful connection.
 type handleConnected struct {
 	c    *ConnReq
 	conn net.Conn
 }
 
-// handleDisconnected is used to remove a connection.
+// handleDisconnected is used to remove a connection.  The connection request
+// is set when it is removed via RemoveReq, so it is canceled even when it was
+// not registered yet.
 type handleDisconnected struct {
 	id    uint64
 	retry bool
+	c     *ConnReq
 }
 
 // handleFailed is used to remove a pending connection.
@@ -185,8 +238,8 @@ func (cm *ConnManager) handleFailedConn(c *ConnReq) {
 		return
 	}
 	if c.Permanent {
-		c.retryCount++
-		d := time.Duration(c.retryCount) * cm.cfg.RetryDuration
+		retryCount := atomic.AddUint32(&c.retryCount, 1)
+		d := time.Duration(retryCount) * cm.cfg.RetryDuration
 		if d > maxRetryDuration {
 			d = maxRetryDuration
 		}
@@ -194,7 +247,7 @@ func (cm *ConnManager) handleFailedConn(c *ConnReq) {
 		time.AfterFunc(d, func() {
 			cm.Connect(c)
 		})
-	} else if cm.cfg.GetNewAddress != nil {
+	} else if c.automatic && cm.cfg.GetNewAddress != nil {
 		cm.failedAttempts++
 		if cm.failedAttempts >= maxFailedAttempts {
 			log.Debugf("Max failed connection attempts reached: [%d] "+
@@ -214,22 +267,57 @@ func (cm *ConnManager) handleFailedConn(c *ConnReq) {
 //
 // The connection handler makes sure that we maintain a pool of active outbound
 // connections so that we remain connected to the network.  Connection requests
-// are processed and mapped by their assigned ids.
+// are processed and mapped by their assigned ids.  Only the automatic
+// connections count toward the target number of outbound connections, so
+// permanent and other requested connections never take their place.
 func (cm *ConnManager) connHandler() {
+	// pending holds the requests which are being attempted or waiting to
+	// be retried, and conns holds the established connections.
+	pending := make(map[uint64]*ConnReq)
 	conns := make(map[uint64]*ConnReq, cm.cfg.TargetOutbound)
+	numAutomatic := func() uint32 {
+		var n uint32
+		for _, connReq := range conns {
+			if connReq.automatic {
+				n++
+			}
+		}
+		return n
+	}
 out:
 	for {
 		select {
 		case req := <-cm.requests:
 			switch msg := req.(type) {
 
+			case registerPending:
+				// Refuse a request which was removed before it
+				// was registered.
+				if msg.c.State() == ConnCanceled {
+					msg.done <- false
+					continue
+				}
+				msg.c.updateState(ConnPending)
+				pending[msg.c.id] = msg.c
+				msg.done <- true
+
 			case handleConnected:
 				connReq := msg.c
+				if _, ok := pending[connReq.id]; !ok {
+					if msg.conn != nil {
+						msg.conn.Close()
+					}
+					log.Debugf("Ignoring connection for canceled "+
+						"request %v", connReq)
+					continue
+				}
+				delete(pending, connReq.id)
+
 				connReq.updateState(ConnEstablished)
 				connReq.conn = msg.conn
 				conns[connReq.id] = connReq
 				log.Debugf("Connected to %v", connReq)
-				connReq.retryCount = 0
+				atomic.StoreUint32(&connReq.retryCount, 0)
 				cm.failedAttempts = 0
 
 				if cm.cfg.OnConnection != nil {
@@ -237,27 +325,68 @@ out:
 				}
 
 			case handleDisconnected:
-				if connReq, ok := conns[msg.id]; ok {
-					connReq.updateState(ConnDisconnected)
-					if connReq.conn != nil {
-						connReq.conn.Close()
+				connReq, ok := conns[msg.id]
+				if !ok {
+					// Cancel a pending request which is
+					// removed so a later successful
+					// connection or failure is ignored.
+					connReq, ok = pending[msg.id]
+					if ok && !msg.retry {
+						connReq.updateState(ConnCanceled)
+						log.Debugf("Canceled %v", connReq)
+						delete(pending, msg.id)
+					} else if !ok && msg.c != nil {
+						// The request is not registered
+						// yet, so it is refused once it
+						// is.
+						msg.c.updateState(ConnCanceled)
+						log.Debugf("Canceled %v", msg.c)
+					} else if !ok {
+						log.Errorf("Unknown connection: %d",
+							msg.id)
 					}
-					log.Debugf("Disconnected from %v", connReq)
-					delete(conns, msg.id)
+					continue
+				}
 
-					if cm.cfg.OnDisconnection != nil {
-						go cm.cfg.OnDisconnection(connReq)
-					}
+				connReq.updateState(ConnDisconnected)
+				if connReq.conn != nil {
+					connReq.conn.Close()
+				}
+				log.Debugf("Disconnected from %v", connReq)
+				delete(conns, msg.id)
 
-					if uint32(len(conns)) < cm.cfg.TargetOutbound && msg.retry {
-						cm.handleFailedConn(connReq)
-					}
-				} else {
-					log.Errorf("Unknown connection: %d", msg.id)
+				if cm.cfg.OnDisconnection != nil {
+					go cm.cfg.OnDisconnection(connReq)
+				}
+
+				if !msg.retry {
+					continue
+				}
+
+				// Permanent connections are always retried
+				// while automatic ones are replaced when there
+				// are not enough of them.  The request is
+				// pending again so the result of the retry is
+				// not ignored.
+				if connReq.Permanent {
+					pending[msg.id] = connReq
+					cm.handleFailedConn(connReq)
+				} else if connReq.automatic &&
+					numAutomatic() < cm.cfg.TargetOutbound {
+
+					cm.handleFailedConn(connReq)
 				}
 
 			case handleFailed:
 				connReq := msg.c
+				if _, ok := pending[connReq.id]; !ok {
+					log.Debugf("Ignoring failed connection for "+
+						"canceled request %v", connReq)
+					continue
+				}
+				if !connReq.Permanent {
+					delete(pending, connReq.id)
+				}
 				connReq.updateState(ConnFailed)
 				log.Debugf("Failed to connect: %v", msg.err)
 				cm.handleFailedConn(connReq)
@@ -282,12 +411,18 @@ func (cm *ConnManager) NewConnReq() {
 		return
 	}
 
-	c := &ConnReq{}
+	c := &ConnReq{automatic: true}
 	atomic.StoreUint64(&c.id, atomic.AddUint64(&cm.connReqCount, 1))
+	if !cm.register(c) {
+		return
+	}
 
 	addr, err := cm.cfg.GetNewAddress()
 	if err != nil {
-		cm.requests <- handleFailed{c, err}
+		select {
+		case cm.requests <- handleFailed{c, err}:
+		case <-cm.quit:
+		}
 		return
 	}
 
@@ -296,14 +431,36 @@ func (cm *ConnManager) NewConnReq() {
 	cm.Connect(c)
 }
 
+// register registers the passed connection request as pending.  It returns
+// false when the request was removed via RemoveReq before it is registered or
+// the connection manager is stopped.
+func (cm *ConnManager) register(c *ConnReq) bool {
+	done := make(chan bool, 1)
+	select {
+	case cm.requests <- registerPending{c, done}:
+	case <-cm.quit:
+		return false
+	}
+	select {
+	case registered := <-done:
+		return registered
+	case <-cm.quit:
+		return false
+	}
+}
+
 // Connect assigns an id and dials a connection to the address of the
-// connection request.
+// connection request.  New requests are registered as pending first so they
+// can be canceled via Remove while they are attempted or retried.
 func (cm *ConnManager) Connect(c *ConnReq) {
 	if atomic.LoadInt32(&cm.stop) != 0 {
 		return
 	}
 	if atomic.LoadUint64(&c.id) == 0 {
 		atomic.StoreUint64(&c.id, atomic.AddUint64(&cm.connReqCount, 1))
+		if !cm.register(c) {
+			return
+		}
 	}
 	log.Debugf("Attempting to connect to %v", c)
 	conn, err := cm.cfg.Dial(c.Addr)
@@ -321,16 +478,29 @@ func (cm *ConnManager) Disconnect(id uint64) {
 	if atomic.LoadInt32(&cm.stop) != 0 {
 		return
 	}
-	cm.requests <- handleDisconnected{id, true}
+	cm.requests <- handleDisconnected{id, true, nil}
 }
 
-// Remove removes the connection corresponding to the given connection
-// id from known connections.
+// Remove removes the connection corresponding to the given connection id from
+// known connections without retrying it.  A pending connection request is
+// canceled, so it is not retried and a connection which is established later
+// is closed.
 func (cm *ConnManager) Remove(id uint64) {
 	if atomic.LoadInt32(&cm.stop) != 0 {
 		return
 	}
-	cm.requests <- handleDisconnected{id, false}
+	cm.requests <- handleDisconnected{id, false, nil}
+}
+
+// RemoveReq removes the passed connection request from known connections
+// without retrying it like Remove.  Unlike Remove, it also cancels a request
+// which is passed to Connect concurrently and thus might not have been assigned
+// an id yet, so it is never attempted.
+func (cm *ConnManager) RemoveReq(c *ConnReq) {
+	if atomic.LoadInt32(&cm.stop) != 0 {
+		return
+	}
+	cm.requests <- handleDisconnected{c.ID(), false, c}
 }
 
 // listenHandler accepts incoming connections on a given listener.  It must be
@@ -373,7 +543,33 @@ func (cm *ConnManager) Start() {
 		}
 	}
 
-	for i := atomic.LoadUint64(&cm.connReqCount); i < uint64(cm.cfg.TargetOutbound); i++ {
+	go cm.connectAutomatic()
+}
+
+// connectAutomatic makes the automatic connections up to the target number of
+// outbound connections.  The anchors are dialed first and the remaining
+// connections are only requested once all of them have been attempted, so the
+// anchors are not crowded out by new addresses.  It must be run as a goroutine.
+func (cm *ConnManager) connectAutomatic() {
+	var anchors []net.Addr
+	if cm.cfg.GetNewAddress != nil {
+		anchors = cm.cfg.Anchors
+		if uint32(len(anchors)) > cm.cfg.TargetOutbound {
+			anchors = anchors[:cm.cfg.TargetOutbound]
+		}
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(len(anchors))
+	for _, addr := range anchors {
+		go func(addr net.Addr) {
+			cm.Connect(&ConnReq{Addr: addr, automatic: true})
+			wg.Done()
+		}(addr)
+	}
+	wg.Wait()
+
+	for i := uint32(len(anchors)); i < cm.cfg.TargetOutbound; i++ {
 		go cm.NewConnReq()
 	}
 }
@@ -9,6 +9,7 @@ import (
 	"errors"
 	"io"
 	"net"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -310,6 +311,309 @@ func TestRetryPermanent(t *testing.T) {
 	cmgr.Stop()
 }
 
+// TestPermanentOutsideTarget tests that permanent connections do not count
+// toward the target number of outbound connections.
+//
+// We make a permanent connection request before starting the connection
+// manager and wait for it along with the target number of automatic
+// connections.  The automatic connections are replaced when the permanent one
+// is disconnected, so no new automatic connection must be made.
+func TestPermanentOutsideTarget(t *testing.T) {
+	targetOutbound := uint32(2)
+	connected := make(chan *ConnReq)
+	disconnected := make(chan *ConnReq)
+	cmgr, err := New(&Config{
+		RetryDuration:  time.Millisecond,
+		TargetOutbound: targetOutbound,
+		Dial:           mockDialer,
+		GetNewAddress: func() (net.Addr, error) {
+			return &net.TCPAddr{
+				IP:   net.ParseIP("127.0.0.1"),
+				Port: 18555,
+			}, nil
+		},
+		OnConnection: func(c *ConnReq, conn net.Conn) {
+			connected <- c
+		},
+		OnDisconnection: func(c *ConnReq) {
+			disconnected <- c
+		},
+	})
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+
+	cr := &ConnReq{
+		Addr: &net.TCPAddr{
+			IP:   net.ParseIP("127.0.0.2"),
+			Port: 18555,
+		},
+		Permanent: true,
+	}
+	go cmgr.Connect(cr)
+	cmgr.Start()
+	var numAutomatic uint32
+	for i := uint32(0); i < targetOutbound+1; i++ {
+		if c := <-connected; c != cr {
+			numAutomatic++
+		}
+	}
+	if numAutomatic != targetOutbound {
+		t.Fatalf("permanent outside target: got %d automatic "+
+			"connections, want %d", numAutomatic, targetOutbound)
+	}
+
+	// Disconnect the permanent connection and ensure only it is
+	// reconnected.
+	cmgr.Disconnect(cr.ID())
+	<-disconnected
+	if c := <-connected; c != cr {
+		t.Fatalf("permanent outside target: got unexpected connection "+
+			"- %v", c)
+	}
+	select {
+	case c := <-connected:
+		t.Fatalf("permanent outside target: got unexpected connection "+
+			"- %v", c)
+	case <-time.After(10 * time.Millisecond):
+	}
+	cmgr.Stop()
+}
+
+// TestAnchors tests that the anchors are dialed before any other automatic
+// connection is made, that they count toward the target number of outbound
+// connections, and that an anchor which can not be dialed is replaced.
+func TestAnchors(t *testing.T) {
+	targetOutbound := uint32(3)
+	goodAnchor := &net.TCPAddr{IP: net.ParseIP("127.0.0.2"), Port: 18555}
+	badAnchor := &net.TCPAddr{IP: net.ParseIP("127.0.0.3"), Port: 18555}
+	newAddr := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 18555}
+
+	// The bad anchor only fails once the good anchor has been dialed, since
+	// a new address is dialed in place of the bad anchor right away.
+	var mtx sync.Mutex
+	var dialed []string
+	goodDialed := make(chan struct{})
+	connected := make(chan *ConnReq)
+	cmgr, err := New(&Config{
+		TargetOutbound: targetOutbound,
+		Dial: func(addr net.Addr) (net.Conn, error) {
+			if addr.String() == badAnchor.String() {
+				<-goodDialed
+			}
+			mtx.Lock()
+			dialed = append(dialed, addr.String())
+			mtx.Unlock()
+			switch addr.String() {
+			case goodAnchor.String():
+				close(goodDialed)
+			case badAnchor.String():
+				return nil, errors.New("anchor unreachable")
+			}
+			return mockDialer(addr)
+		},
+		GetNewAddress: func() (net.Addr, error) {
+			return newAddr, nil
+		},
+		OnConnection: func(c *ConnReq, conn net.Conn) {
+			connected <- c
+		},
+		Anchors: []net.Addr{goodAnchor, badAnchor},
+	})
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	cmgr.Start()
+	var numAnchors uint32
+	for i := uint32(0); i < targetOutbound; i++ {
+		if c := <-connected; c.Addr.String() == goodAnchor.String() {
+			numAnchors++
+		}
+	}
+	if numAnchors != 1 {
+		t.Fatalf("anchors: got %d anchor connections, want 1", numAnchors)
+	}
+	select {
+	case c := <-connected:
+		t.Fatalf("anchors: got unexpected connection - %v", c.Addr)
+	case <-time.After(10 * time.Millisecond):
+	}
+	cmgr.Stop()
+
+	// Both anchors are dialed before any new address.
+	mtx.Lock()
+	defer mtx.Unlock()
+	if len(dialed) != int(targetOutbound)+1 {
+		t.Fatalf("anchors: got %d dials, want %d", len(dialed),
+			targetOutbound+1)
+	}
+	for _, addr := range dialed[:2] {
+		if addr == newAddr.String() {
+			t.Fatalf("anchors: new address dialed before the "+
+				"anchors: %v", dialed)
+		}
+	}
+}
+
+// TestRemovePending tests that a permanent connection request which is removed
+// while it is retried is canceled.
+//
+// We make a permanent connection request to an address which can not be
+// dialed, remove it after it failed, and ensure it is not dialed again.
+func TestRemovePending(t *testing.T) {
+	var dials uint32
+	failed := make(chan struct{}, 10)
+	errDialer := func(addr net.Addr) (net.Conn, error) {
+		atomic.AddUint32(&dials, 1)
+		failed <- struct{}{}
+		return nil, errors.New("network down")
+	}
+	cmgr, err := New(&Config{
+		RetryDuration: time.Millisecond,
+		Dial:          errDialer,
+	})
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	cmgr.Start()
+
+	cr := &ConnReq{
+		Addr: &net.TCPAddr{
+			IP:   net.ParseIP("127.0.0.1"),
+			Port: 18555,
+		},
+		Permanent: true,
+	}
+	go cmgr.Connect(cr)
+	<-failed
+	<-failed
+	cmgr.Remove(cr.ID())
+
+	// Allow a dial which was already underway to finish.
+	time.Sleep(10 * time.Millisecond)
+	wantDials := atomic.LoadUint32(&dials)
+	time.Sleep(10 * time.Millisecond)
+	if gotDials := atomic.LoadUint32(&dials); gotDials != wantDials {
+		t.Fatalf("remove pending: got %d dials after removal, want %d",
+			gotDials, wantDials)
+	}
+	if gotState := cr.State(); gotState != ConnCanceled {
+		t.Fatalf("remove pending: want state %v, got state %v",
+			ConnCanceled, gotState)
+	}
+	cmgr.Stop()
+}
+
+// TestRemoveReqBeforeConnect tests that a connection request which is removed
+// via RemoveReq before Connect registered it is never dialed.
+//
+// We remove a permanent connection request before passing it to Connect and
+// ensure it is canceled without being dialed.
+func TestRemoveReqBeforeConnect(t *testing.T) {
+	var dials uint32
+	dialer := func(addr net.Addr) (net.Conn, error) {
+		atomic.AddUint32(&dials, 1)
+		return nil, errors.New("network down")
+	}
+	cmgr, err := New(&Config{
+		RetryDuration: time.Millisecond,
+		Dial:          dialer,
+	})
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	cmgr.Start()
+
+	cr := &ConnReq{
+		Addr: &net.TCPAddr{
+			IP:   net.ParseIP("127.0.0.1"),
+			Port: 18555,
+		},
+		Permanent: true,
+	}
+	cmgr.RemoveReq(cr)
+	cmgr.Connect(cr)
+
+	time.Sleep(10 * time.Millisecond)
+	if gotDials := atomic.LoadUint32(&dials); gotDials != 0 {
+		t.Fatalf("remove before connect: got %d dials, want 0",
+			gotDials)
+	}
+	if gotState := cr.State(); gotState != ConnCanceled {
+		t.Fatalf("remove before connect: want state %v, got state %v",
+			ConnCanceled, gotState)
+	}
+	cmgr.Stop()
+}
+
+// TestOneTry tests that non-permanent connection requests are neither retried
+// nor replaced by automatic connections.
+//
+// We make a connection request which fails and one which is established and
+// disconnected, and ensure only the target number of automatic connections is
+// made.
+func TestOneTry(t *testing.T) {
+	failAddr := &net.TCPAddr{IP: net.ParseIP("127.0.0.3"), Port: 18555}
+	var failDials uint32
+	dialer := func(addr net.Addr) (net.Conn, error) {
+		if addr == failAddr {
+			atomic.AddUint32(&failDials, 1)
+			return nil, errors.New("unreachable")
+		}
+		return mockDialer(addr)
+	}
+	connected := make(chan *ConnReq)
+	disconnected := make(chan *ConnReq)
+	cmgr, err := New(&Config{
+		RetryDuration:  time.Millisecond,
+		TargetOutbound: 1,
+		Dial:           dialer,
+		GetNewAddress: func() (net.Addr, error) {
+			return &net.TCPAddr{
+				IP:   net.ParseIP("127.0.0.1"),
+				Port: 18555,
+			}, nil
+		},
+		OnConnection: func(c *ConnReq, conn net.Conn) {
+			connected <- c
+		},
+		OnDisconnection: func(c *ConnReq) {
+			disconnected <- c
+		},
+	})
+	if err != nil {
+		t.Fatalf("New error: %v", err)
+	}
+	cmgr.Start()
+	<-connected
+
+	cmgr.Connect(&ConnReq{Addr: failAddr})
+
+	cr := &ConnReq{
+		Addr: &net.TCPAddr{
+			IP:   net.ParseIP("127.0.0.2"),
+			Port: 18555,
+		},
+	}
+	go cmgr.Connect(cr)
+	if c := <-connected; c != cr {
+		t.Fatalf("onetry: got unexpected connection - %v", c)
+	}
+	cmgr.Disconnect(cr.ID())
+	<-disconnected
+
+	select {
+	case c := <-connected:
+		t.Fatalf("onetry: got unexpected connection - %v", c)
+	case <-time.After(10 * time.Millisecond):
+	}
+	if gotDials := atomic.LoadUint32(&failDials); gotDials != 1 {
+		t.Fatalf("onetry: got %d dials of the failed request, want 1",
+			gotDials)
+	}
+	cmgr.Stop()
+}
+
 // TestMaxRetryDuration tests the maximum retry duration.
 //
 // We have a timed dialer which initially returns err but after RetryDuration
@@ -97,7 +97,7 @@ func setupGlobalConfig() error {
 	// All data is specific to a network, so namespacing the data directory
 	// means each individual piece of serialized data does not have to
 	// worry about changing names per network and such.
-	cfg.DataDir = filepath.Join(cfg.DataDir, activeNetParams.Name)
+	cfg.DataDir = provautil.NetworkDataDir(cfg.DataDir, activeNetParams)
 
 	return nil
 }
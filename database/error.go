@@ -51,6 +51,10 @@ const (
 	// means the database is corrupt.
 	ErrCorruption
 
+	// ErrInterrupted indicates a long-running database operation, such as
+	// a compaction, was interrupted before it completed.
+	ErrInterrupted
+
 	// ****************************************
 	// Errors related to database transactions.
 	// ****************************************
@@ -142,6 +146,7 @@ var errorCodeStrings = map[ErrorCode]string{
 	ErrDbAlreadyOpen:      "ErrDbAlreadyOpen",
 	ErrInvalid:            "ErrInvalid",
 	ErrCorruption:         "ErrCorruption",
+	ErrInterrupted:        "ErrInterrupted",
 	ErrTxClosed:           "ErrTxClosed",
 	ErrTxNotWritable:      "ErrTxNotWritable",
 	ErrBucketNotFound:     "ErrBucketNotFound",
@@ -26,6 +26,7 @@ func TestErrorCodeStringer(t *testing.T) {
 		{database.ErrDbAlreadyOpen, "ErrDbAlreadyOpen"},
 		{database.ErrInvalid, "ErrInvalid"},
 		{database.ErrCorruption, "ErrCorruption"},
+		{database.ErrInterrupted, "ErrInterrupted"},
 		{database.ErrTxClosed, "ErrTxClosed"},
 		{database.ErrTxNotWritable, "ErrTxNotWritable"},
 		{database.ErrBucketNotFound, "ErrBucketNotFound"},
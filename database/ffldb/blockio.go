@@ -9,6 +9,7 @@
 package ffldb
 
 import (
+	"bufio"
 	"container/list"
 	"encoding/binary"
 	"fmt"
@@ -57,6 +58,11 @@ const (
 	//  [4:8]  File offset (4 bytes)
 	//  [8:12] Block length (4 bytes)
 	blockLocSize = 12
+
+	// checkBlocksMarkerName is the name of the file in the database
+	// directory which is created when corrupt block data is read so all of
+	// the block files are verified the next time the database is opened.
+	checkBlocksMarkerName = "checkblocks"
 )
 
 var (
@@ -519,6 +525,7 @@ func (s *blockStore) readBlock(hash *chainhash.Hash, loc blockLocation) ([]byte,
 	n, err := blockFile.file.ReadAt(serializedData, int64(loc.fileOffset))
 	blockFile.RUnlock()
 	if err != nil {
+		s.scheduleBlockCheck()
 		str := fmt.Sprintf("failed to read block %s from file %d, "+
 			"offset %d: %v", hash, loc.blockFileNum, loc.fileOffset,
 			err)
@@ -532,6 +539,7 @@ func (s *blockStore) readBlock(hash *chainhash.Hash, loc blockLocation) ([]byte,
 	serializedChecksum := binary.BigEndian.Uint32(serializedData[n-4:])
 	calculatedChecksum := crc32.Checksum(serializedData[:n-4], castagnoli)
 	if serializedChecksum != calculatedChecksum {
+		s.scheduleBlockCheck()
 		str := fmt.Sprintf("block data for block %s checksum "+
 			"does not match - got %x, want %x", hash,
 			calculatedChecksum, serializedChecksum)
@@ -579,6 +587,7 @@ func (s *blockStore) readBlockRegion(loc blockLocation, offset, numBytes uint32)
 	_, err = blockFile.file.ReadAt(serializedData, int64(readOffset))
 	blockFile.RUnlock()
 	if err != nil {
+		s.scheduleBlockCheck()
 		str := fmt.Sprintf("failed to read region from block file %d, "+
 			"offset %d, len %d: %v", loc.blockFileNum, readOffset,
 			numBytes, err)
@@ -738,6 +747,102 @@ func scanBlockFiles(dbPath string) (int, uint32) {
 	return lastFile, fileLen
 }
 
+// scanBlockRecords reads the block records in the flat file with the passed
+// number which end at or before the passed offset and verifies their network,
+// length, and checksum.  The locations of the valid records are added to the
+// passed map and the offset just after the last valid record is returned.
+//
+// The scan stops at the first record which is incomplete or fails to verify
+// since the length of the record, and therefore where the next one starts,
+// can't be trusted.  A missing file does not contain any records.
+func (s *blockStore) scanBlockRecords(fileNum, limit uint32, records map[blockLocation]struct{}, interrupt <-chan struct{}) (uint32, error) {
+	filePath := blockFilePath(s.basePath, fileNum)
+	file, err := os.Open(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		str := fmt.Sprintf("failed to open file %q: %v", filePath, err)
+		return 0, makeDbErr(database.ErrDriverSpecific, str, err)
+	}
+	defer file.Close()
+
+	// The format of each record is:
+	//   <network><block length><serialized block><checksum>
+	r := bufio.NewReaderSize(file, 1<<20)
+	var offset uint32
+	var record []byte
+	for {
+		select {
+		case <-interrupt:
+			return 0, makeDbErr(database.ErrInterrupted,
+				"block check interrupted", nil)
+		default:
+		}
+
+		var header [8]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return offset, nil
+			}
+			str := fmt.Sprintf("failed to read file %d, offset %d: %v",
+				fileNum, offset, err)
+			return 0, makeDbErr(database.ErrDriverSpecific, str, err)
+		}
+		if byteOrder.Uint32(header[0:4]) != uint32(s.network) {
+			return offset, nil
+		}
+		recordLen := uint64(byteOrder.Uint32(header[4:8])) + 12
+		if uint64(offset)+recordLen > uint64(limit) {
+			return offset, nil
+		}
+
+		if uint64(cap(record)) < recordLen {
+			record = make([]byte, recordLen)
+		}
+		record = record[:recordLen]
+		copy(record, header[:])
+		if _, err := io.ReadFull(r, record[8:]); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return offset, nil
+			}
+			str := fmt.Sprintf("failed to read file %d, offset %d: %v",
+				fileNum, offset, err)
+			return 0, makeDbErr(database.ErrDriverSpecific, str, err)
+		}
+		serializedChecksum := binary.BigEndian.Uint32(record[recordLen-4:])
+		calculatedChecksum := crc32.Checksum(record[:recordLen-4], castagnoli)
+		if serializedChecksum != calculatedChecksum {
+			return offset, nil
+		}
+
+		records[blockLocation{
+			blockFileNum: fileNum,
+			fileOffset:   offset,
+			blockLen:     uint32(recordLen),
+		}] = struct{}{}
+		offset += uint32(recordLen)
+	}
+}
+
+// scheduleBlockCheck creates the marker file which causes all of the block
+// files to be verified the next time the database is opened.  It is called when
+// block data fails to be read or does not match its checksum.
+func (s *blockStore) scheduleBlockCheck() {
+	markerPath := filepath.Join(s.basePath, checkBlocksMarkerName)
+	if fileExists(markerPath) {
+		return
+	}
+	_ = log.Warnf("Failed to read block data -- the block files will be " +
+		"verified the next time the database is opened")
+	file, err := os.Create(markerPath)
+	if err != nil {
+		_ = log.Warnf("Failed to create %q: %v", markerPath, err)
+		return
+	}
+	file.Close()
+}
+
 // newBlockStore returns a new block store with the current block file number
 // and offset set and all fields initialized.
 func newBlockStore(basePath string, network wire.BitcoinNet) *blockStore {
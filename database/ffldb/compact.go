@@ -0,0 +1,312 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package ffldb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bitgo/prova/database"
+	"github.com/btcsuite/goleveldb/leveldb/util"
+)
+
+// bucketNode describes a bucket in the bucket index.
+type bucketNode struct {
+	name []byte
+	id   [4]byte
+}
+
+// fetchBucketTree returns the child buckets of all buckets in the bucket index
+// of the passed snapshot keyed by the ID of their parent bucket.
+func fetchBucketTree(snapshot *dbCacheSnapshot) (map[[4]byte][]bucketNode, error) {
+	tree := make(map[[4]byte][]bucketNode)
+	iter := snapshot.NewIterator(util.BytesPrefix(bucketIndexPrefix))
+	defer iter.Release()
+	for ok := iter.First(); ok; ok = iter.Next() {
+		// The current bucket ID counter shares the prefix of the bucket
+		// index, so skip it.
+		key := iter.Key()
+		if bytes.Equal(key, curBucketIDKeyName) {
+			continue
+		}
+
+		// The serialized bucket index key format is:
+		//   <bucketindexprefix><parentbucketid><bucketname>
+		prefixLen := len(bucketIndexPrefix) + 4
+		value := iter.Value()
+		if len(key) <= prefixLen || len(value) != 4 {
+			str := fmt.Sprintf("corrupt bucket index entry %x", key)
+			return nil, makeDbErr(database.ErrCorruption, str, nil)
+		}
+		var parentID [4]byte
+		copy(parentID[:], key[len(bucketIndexPrefix):prefixLen])
+		node := bucketNode{name: make([]byte, len(key)-prefixLen)}
+		copy(node.name, key[prefixLen:])
+		copy(node.id[:], value)
+		tree[parentID] = append(tree[parentID], node)
+	}
+	if err := iter.Error(); err != nil {
+		return nil, convertErr("failed to iterate bucket index", err)
+	}
+	return tree, nil
+}
+
+// bucketIDRange returns the range of keys of the bucket with the passed ID,
+// which are all prefixed with the ID.
+func bucketIDRange(id [4]byte) util.Range {
+	r := util.Range{Start: id[:]}
+	if next := binary.BigEndian.Uint32(id[:]) + 1; next != 0 {
+		r.Limit = make([]byte, 4)
+		binary.BigEndian.PutUint32(r.Limit, next)
+	}
+	return r
+}
+
+// bucketRanges returns the key ranges of the bucket with the passed ID along
+// with the key ranges of all of its nested buckets.
+func bucketRanges(tree map[[4]byte][]bucketNode, id [4]byte) []util.Range {
+	ranges := []util.Range{bucketIDRange(id)}
+	for _, child := range tree[id] {
+		ranges = append(ranges, bucketRanges(tree, child.id)...)
+	}
+	return ranges
+}
+
+// rangesByStart implements sort.Interface to sort key ranges by their start
+// keys.
+type rangesByStart []util.Range
+
+func (s rangesByStart) Len() int           { return len(s) }
+func (s rangesByStart) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s rangesByStart) Less(i, j int) bool { return bytes.Compare(s[i].Start, s[j].Start) < 0 }
+
+// tableFileNum returns the file number of the passed leveldb table file name
+// and whether or not the name is a table file.
+func tableFileNum(name string) (uint64, bool) {
+	ext := filepath.Ext(name)
+	if ext != ".ldb" && ext != ".sst" {
+		return 0, false
+	}
+	num, err := strconv.ParseUint(strings.TrimSuffix(name, ext), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return num, true
+}
+
+// metadataStats populates the metadata file statistics of the passed stats from
+// the live tables of the underlying leveldb database and the table files in the
+// metadata directory.
+func (db *db) metadataStats(stats *database.Stats) error {
+	// The sstables property lists the live tables of every level as
+	// follows:
+	//   --- level <level> ---
+	//   <filenum>:<size>[<minkey> .. <maxkey>]
+	sstables, err := db.cache.ldb.GetProperty("leveldb.sstables")
+	if err != nil {
+		return convertErr("failed to fetch leveldb tables", err)
+	}
+	liveFiles := make(map[uint64]struct{})
+	scanner := bufio.NewScanner(strings.NewReader(sstables))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "---") {
+			stats.LevelFiles = append(stats.LevelFiles, 0)
+			continue
+		}
+		var num uint64
+		var size int64
+		_, err := fmt.Sscanf(line, "%d:%d[", &num, &size)
+		if err != nil || len(stats.LevelFiles) == 0 {
+			continue
+		}
+		liveFiles[num] = struct{}{}
+		stats.LevelFiles[len(stats.LevelFiles)-1]++
+		stats.MetadataFiles++
+		stats.MetadataSize += size
+	}
+
+	// Any table files in the metadata directory which are not live are
+	// obsolete.
+	metadataDbPath := filepath.Join(db.store.basePath, metadataDbName)
+	files, err := ioutil.ReadDir(metadataDbPath)
+	if err != nil {
+		str := fmt.Sprintf("failed to read metadata directory %q",
+			metadataDbPath)
+		return makeDbErr(database.ErrDriverSpecific, str, err)
+	}
+	for _, file := range files {
+		num, ok := tableFileNum(file.Name())
+		if !ok {
+			continue
+		}
+		if _, ok := liveFiles[num]; !ok {
+			stats.ObsoleteFiles++
+			stats.ObsoleteSize += file.Size()
+		}
+	}
+	return nil
+}
+
+// Stats returns statistics about the storage used by the database.  The bucket
+// sizes are approximated from the metadata files, so data which has not been
+// flushed from the cache yet is not included.
+//
+// This function is part of the database.DB interface implementation.
+func (db *db) Stats() (*database.Stats, error) {
+	// Start a read-only transaction which prevents the database from being
+	// closed while the statistics are gathered.
+	tx, err := db.begin(false)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var stats database.Stats
+	tree, err := fetchBucketTree(tx.snapshot)
+	if err != nil {
+		return nil, err
+	}
+	for _, node := range tree[metadataBucketID] {
+		sizes, err := db.cache.ldb.SizeOf(bucketRanges(tree, node.id))
+		if err != nil {
+			str := fmt.Sprintf("failed to fetch size of bucket %q",
+				node.name)
+			return nil, convertErr(str, err)
+		}
+		stats.Buckets = append(stats.Buckets, database.BucketStats{
+			Name: node.name,
+			Size: sizes.Sum(),
+		})
+	}
+
+	if err := db.metadataStats(&stats); err != nil {
+		return nil, err
+	}
+
+	for fileNum := uint32(0); ; fileNum++ {
+		fi, err := os.Stat(blockFilePath(db.store.basePath, fileNum))
+		if err != nil {
+			break
+		}
+		stats.BlockFiles++
+		stats.BlockFilesSize += fi.Size()
+	}
+
+	return &stats, nil
+}
+
+// compactRanges returns the key ranges to compact one after the other in order
+// to compact the top-level metadata bucket with the passed name along with all
+// of its nested buckets, or the entire metadata when the name is nil.
+func (db *db) compactRanges(bucket []byte) ([]util.Range, error) {
+	tx, err := db.begin(false)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	tree, err := fetchBucketTree(tx.snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	if bucket != nil {
+		for _, node := range tree[metadataBucketID] {
+			if bytes.Equal(node.name, bucket) {
+				return bucketRanges(tree, node.id), nil
+			}
+		}
+		str := fmt.Sprintf("bucket %q does not exist", bucket)
+		return nil, makeDbErr(database.ErrBucketNotFound, str, nil)
+	}
+
+	// Split the entire key space at the boundaries of the buckets so the
+	// data of deleted buckets and the bucket index are compacted as well.
+	bucketIDRanges := bucketRanges(tree, metadataBucketID)
+	sort.Sort(rangesByStart(bucketIDRanges))
+	var ranges []util.Range
+	var start []byte
+	for _, r := range bucketIDRanges {
+		if r.Limit == nil || bytes.Compare(r.Limit, start) <= 0 {
+			continue
+		}
+		ranges = append(ranges, util.Range{Start: start, Limit: r.Limit})
+		start = r.Limit
+	}
+	ranges = append(ranges, util.Range{Start: start})
+	return ranges, nil
+}
+
+// flushCache flushes the database cache to the underlying leveldb database
+// while holding the write lock in the same way a write transaction does to
+// ensure no transactions are committed to the cache while it is flushed.
+func (db *db) flushCache() error {
+	db.writeLock.Lock()
+	defer db.writeLock.Unlock()
+	db.closeLock.RLock()
+	defer db.closeLock.RUnlock()
+	if db.closed {
+		return makeDbErr(database.ErrDbNotOpen, errDbNotOpenStr, nil)
+	}
+	return db.cache.flush()
+}
+
+// Compact compacts the storage used by the metadata to reclaim the space used
+// by deleted and overwritten data.  The entire metadata is compacted when the
+// bucket is nil, otherwise only the data of the top-level metadata bucket with
+// the given name and all of its nested buckets is compacted.
+//
+// The database cache is flushed first so the data deleted and overwritten by
+// the cached transactions is reclaimed as well.  The compaction is then
+// performed one bucket at a time while the database remains usable, and it is
+// aborted between buckets when the interrupt channel is closed or the database
+// is closed.
+//
+// This function is part of the database.DB interface implementation.
+func (db *db) Compact(bucket []byte, interrupt <-chan struct{}) error {
+	ranges, err := db.compactRanges(bucket)
+	if err != nil {
+		return err
+	}
+
+	if err := db.flushCache(); err != nil {
+		return err
+	}
+
+	for _, r := range ranges {
+		select {
+		case <-interrupt:
+			return makeDbErr(database.ErrInterrupted,
+				"compaction interrupted", nil)
+		default:
+		}
+
+		// Prevent the database from being closed while the range is
+		// compacted.
+		db.closeLock.RLock()
+		if db.closed {
+			db.closeLock.RUnlock()
+			return makeDbErr(database.ErrDbNotOpen, errDbNotOpenStr,
+				nil)
+		}
+		log.Debugf("Compacting metadata range %x - %x", r.Start, r.Limit)
+		err := db.cache.ldb.CompactRange(r)
+		db.closeLock.RUnlock()
+		if err != nil {
+			return convertErr("failed to compact metadata", err)
+		}
+	}
+
+	return nil
+}
@@ -2080,6 +2080,13 @@ func openDB(dbPath string, network wire.BitcoinNet, create bool) (database.DB, e
 	pdb := &db{store: store, cache: cache}
 
 	// Perform any reconciliation needed between the block and metadata as
-	// well as database initialization, if needed.
-	return reconcileDB(pdb, create)
+	// well as database initialization, if needed.  The database is closed
+	// when that fails so it can be opened again once the cause is
+	// resolved.
+	rdb, err := reconcileDB(pdb, create)
+	if err != nil {
+		_ = pdb.Close()
+		return nil, err
+	}
+	return rdb, nil
 }
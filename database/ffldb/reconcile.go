@@ -8,7 +8,11 @@ package ffldb
 import (
 	"fmt"
 	"hash/crc32"
+	"math"
+	"os"
+	"path/filepath"
 
+	"github.com/bitgo/prova/chaincfg/chainhash"
 	"github.com/bitgo/prova/database"
 )
 
@@ -95,24 +99,179 @@ func reconcileDB(pdb *db, create bool) (database.DB, error) {
 		log.Infof("Database sync complete")
 	}
 
-	// When the write cursor position found by scanning the block files on
-	// disk is BEFORE the position the metadata believes to be true, return
-	// a corruption error.  Since sync is called after each block is written
-	// and before the metadata is updated, this should only happen in the
-	// case of missing, deleted, or truncated block files, which generally
-	// is not an easily recoverable scenario.  In the future, it might be
-	// possible to rescan and rebuild the metadata from the block files,
-	// however, that would need to happen with coordination from a higher
-	// layer since it could invalidate other metadata.
-	if wc.curFileNum < curFileNum || (wc.curFileNum == curFileNum &&
-		wc.curOffset < curOffset) {
-
-		str := fmt.Sprintf("metadata claims file %d, offset %d, but "+
-			"block data is at file %d, offset %d", curFileNum,
-			curOffset, wc.curFileNum, wc.curOffset)
-		_ = log.Warnf("***Database corruption detected***: %v", str)
-		return nil, makeDbErr(database.ErrCorruption, str, nil)
+	// Verify the block records at the end of the most recent block file to
+	// detect block data which was lost after the metadata referring to it
+	// was written, which is repaired by rolling the block index back to the
+	// last fully stored block.  All of the block files are verified when
+	// corrupt block data was read since the database was last opened.
+	deep := fileExists(filepath.Join(pdb.store.basePath,
+		checkBlocksMarkerName))
+	if deep {
+		log.Info("Verifying the block files since corrupt block data " +
+			"was read previously")
+	}
+	if err := pdb.checkBlocks(deep, nil); err != nil {
+		return nil, err
 	}
 
 	return pdb, nil
 }
+
+// checkBlocks verifies the block records of the most recent block file, or of
+// all block files when the deep flag is set, and cross-checks the block index
+// against them.  A write transaction is held while the block files are scanned
+// so no blocks are stored in the mean time.
+//
+// Block data can be lost after the metadata which refers to it was written, for
+// instance when the system loses power before the written block data reaches
+// the disk.  In that case the most recent block file is truncated to the end of
+// the last fully stored block, the block index entries of the blocks which are
+// not fully stored are removed, and the write cursor is moved back so the
+// blocks can be stored again.  Corrupt blocks in older block files can't be
+// repaired that way, so ErrCorruption is returned for them instead.
+func (db *db) checkBlocks(deep bool, interrupt <-chan struct{}) error {
+	tx, err := db.begin(true)
+	if err != nil {
+		return err
+	}
+	writeRow := tx.metaBucket.Get(writeLocKeyName)
+	if writeRow == nil {
+		tx.Rollback()
+		str := "write cursor does not exist"
+		return makeDbErr(database.ErrCorruption, str, nil)
+	}
+	metaFileNum, metaOffset, err := deserializeWriteRow(writeRow)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	wc := db.store.writeCursor
+	wc.RLock()
+	lastFileNum, lastOffset := wc.curFileNum, wc.curOffset
+	wc.RUnlock()
+
+	firstFileNum := lastFileNum
+	if deep {
+		firstFileNum = 0
+	}
+	records := make(map[blockLocation]struct{})
+	var validOffset uint32
+	for fileNum := firstFileNum; fileNum <= lastFileNum; fileNum++ {
+		limit := uint32(math.MaxUint32)
+		if fileNum == lastFileNum {
+			limit = lastOffset
+		}
+		validOffset, err = db.store.scanBlockRecords(fileNum, limit,
+			records, interrupt)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	// There is nothing to repair when all of the block data the metadata
+	// refers to is stored in full.  Otherwise, the block index needs to be
+	// cross-checked as well.
+	isTruncated := validOffset < lastOffset || lastFileNum < metaFileNum ||
+		(lastFileNum == metaFileNum && lastOffset < metaOffset)
+	if !isTruncated && !deep {
+		return tx.Rollback()
+	}
+
+	// Find the blocks which are not fully stored.  Those in the most recent
+	// block file, or after it, are removed while any others are corrupt.
+	var removed []chainhash.Hash
+	var numCorrupt int
+	var firstCorrupt string
+	err = tx.blockIdxBucket.ForEach(func(k, v []byte) error {
+		loc := deserializeBlockLoc(v)
+		if loc.blockFileNum < firstFileNum {
+			return nil
+		}
+		if _, ok := records[loc]; ok {
+			return nil
+		}
+
+		var hash chainhash.Hash
+		copy(hash[:], k)
+		if loc.blockFileNum < lastFileNum {
+			if numCorrupt == 0 {
+				firstCorrupt = fmt.Sprintf("block %s in file %d, "+
+					"offset %d", hash, loc.blockFileNum,
+					loc.fileOffset)
+			}
+			numCorrupt++
+			return nil
+		}
+		removed = append(removed, hash)
+		return nil
+	})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if numCorrupt > 0 {
+		tx.Rollback()
+		str := fmt.Sprintf("%d blocks stored before file %d are corrupt "+
+			"starting with %s", numCorrupt, lastFileNum, firstCorrupt)
+		_ = log.Warnf("***Database corruption detected***: %v", str)
+		return makeDbErr(database.ErrCorruption, str, nil)
+	}
+
+	if isTruncated || len(removed) > 0 {
+		_ = log.Warnf("***Database corruption detected***: metadata "+
+			"claims file %d, offset %d, but the block data is only "+
+			"intact up to file %d, offset %d", metaFileNum, metaOffset,
+			lastFileNum, validOffset)
+		log.Infof("Removing %d blocks which are not fully stored - "+
+			"Repairing...", len(removed))
+		db.store.handleRollback(lastFileNum, validOffset)
+		for i := range removed {
+			err := tx.blockIdxBucket.Delete(removed[i][:])
+			if err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+
+		// Commit the repair, which also stores the updated write
+		// cursor, and flush it right away to ensure the metadata does
+		// not refer to the removed blocks once new blocks are stored
+		// in their place.
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		if err := db.flushCache(); err != nil {
+			return err
+		}
+		log.Infof("Database repair complete")
+	} else if err := tx.Rollback(); err != nil {
+		return err
+	}
+
+	// All of the block files were verified, so remove the marker which
+	// requests it.
+	if deep {
+		markerPath := filepath.Join(db.store.basePath,
+			checkBlocksMarkerName)
+		if err := os.Remove(markerPath); err != nil && !os.IsNotExist(err) {
+			str := fmt.Sprintf("failed to remove %q", markerPath)
+			return makeDbErr(database.ErrDriverSpecific, str, err)
+		}
+	}
+	return nil
+}
+
+// CheckBlocks verifies the network, length, and checksum of every block record
+// in the block files and cross-checks the block index against them.  The
+// database is repaired when the most recently stored blocks are not fully
+// stored, while ErrCorruption is returned when older blocks are corrupt.
+//
+// No blocks can be stored while the block files are verified.  The check is
+// aborted with ErrInterrupted when the interrupt channel is closed.
+//
+// This function is part of the database.DB interface implementation.
+func (db *db) CheckBlocks(interrupt <-chan struct{}) error {
+	return db.checkBlocks(true, interrupt)
+}
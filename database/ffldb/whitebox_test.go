@@ -705,3 +705,462 @@ func TestFailureScenarios(t *testing.T) {
 	// Test various corruption scenarios.
 	testCorruption(tc)
 }
+
+// bucketSize returns the size of the top-level bucket with the passed name in
+// the passed stats.
+func bucketSize(stats *database.Stats, name string) (int64, bool) {
+	for _, bucket := range stats.Buckets {
+		if string(bucket.Name) == name {
+			return bucket.Size, true
+		}
+	}
+	return 0, false
+}
+
+// TestCompact ensures the storage statistics reflect the data in the database
+// and compacting the database after deleting and overwriting a lot of data
+// reduces its size without losing any of the remaining data.
+func TestCompact(t *testing.T) {
+	// Create a new database to run tests against.
+	dbPath := filepath.Join(os.TempDir(), "ffldb-compact")
+	_ = os.RemoveAll(dbPath)
+	idb, err := database.Create(dbType, dbPath, blockDataNet)
+	if err != nil {
+		t.Fatalf("Failed to create test database (%s) %v", dbType, err)
+	}
+	defer os.RemoveAll(dbPath)
+	defer idb.Close()
+
+	// Store a block so there is a block file.
+	block := provautil.NewBlock(chaincfg.MainNetParams.GenesisBlock)
+	err = idb.Update(func(tx database.Tx) error {
+		return tx.StoreBlock(block)
+	})
+	if err != nil {
+		t.Fatalf("StoreBlock: unexpected error: %v", err)
+	}
+
+	// Create churn by overwriting the values of a bucket several times and
+	// then deleting them while the values of another bucket are kept.  The
+	// database cache is flushed after every round so the churn reaches the
+	// underlying leveldb database.
+	const numKeys = 2000
+	value := make([]byte, 1024)
+	for round := 0; round < 3; round++ {
+		err := idb.Update(func(tx database.Tx) error {
+			churn, err := tx.Metadata().CreateBucketIfNotExists(
+				[]byte("churn"))
+			if err != nil {
+				return err
+			}
+			nested, err := churn.CreateBucketIfNotExists([]byte("nested"))
+			if err != nil {
+				return err
+			}
+			for i := uint32(0); i < numKeys; i++ {
+				var key [4]byte
+				binary.BigEndian.PutUint32(key[:], i)
+				value[0] = byte(round)
+				if err := churn.Put(key[:], value); err != nil {
+					return err
+				}
+				if err := nested.Put(key[:], value); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Update: unexpected error: %v", err)
+		}
+		pdb := idb.(*db)
+		pdb.writeLock.Lock()
+		err = pdb.cache.flush()
+		pdb.writeLock.Unlock()
+		if err != nil {
+			t.Fatalf("flush: unexpected error: %v", err)
+		}
+	}
+	err = idb.Update(func(tx database.Tx) error {
+		keep, err := tx.Metadata().CreateBucket([]byte("keep"))
+		if err != nil {
+			return err
+		}
+		if err := keep.Put([]byte("key"), []byte("value")); err != nil {
+			return err
+		}
+		churn := tx.Metadata().Bucket([]byte("churn"))
+		nested := churn.Bucket([]byte("nested"))
+		for i := uint32(0); i < numKeys; i++ {
+			var key [4]byte
+			binary.BigEndian.PutUint32(key[:], i)
+			if err := churn.Delete(key[:]); err != nil {
+				return err
+			}
+			if err := nested.Delete(key[:]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Update: unexpected error: %v", err)
+	}
+
+	before, err := idb.Stats()
+	if err != nil {
+		t.Fatalf("Stats: unexpected error: %v", err)
+	}
+	churnBefore, ok := bucketSize(before, "churn")
+	if !ok {
+		t.Fatalf("Stats: missing churn bucket in %v", before.Buckets)
+	}
+	if _, ok := bucketSize(before, "keep"); !ok {
+		t.Fatalf("Stats: missing keep bucket in %v", before.Buckets)
+	}
+	if churnBefore < numKeys*int64(len(value)) {
+		t.Fatalf("Stats: unexpected churn bucket size %d before "+
+			"compaction", churnBefore)
+	}
+	if before.MetadataFiles == 0 || before.MetadataSize < churnBefore {
+		t.Fatalf("Stats: unexpected metadata files %d with size %d",
+			before.MetadataFiles, before.MetadataSize)
+	}
+	if before.BlockFiles != 1 || before.BlockFilesSize == 0 {
+		t.Fatalf("Stats: unexpected block files %d with size %d",
+			before.BlockFiles, before.BlockFilesSize)
+	}
+
+	// Ensure compacting an unknown bucket fails and an interrupted
+	// compaction is aborted.
+	err = idb.Compact([]byte("unknown"), nil)
+	if !checkDbError(t, "Compact unknown", err, database.ErrBucketNotFound) {
+		return
+	}
+	interrupt := make(chan struct{})
+	close(interrupt)
+	err = idb.Compact(nil, interrupt)
+	if !checkDbError(t, "Compact interrupted", err, database.ErrInterrupted) {
+		return
+	}
+
+	// Compact only the churn bucket followed by the entire database and
+	// ensure the size is reduced each time.
+	if err := idb.Compact([]byte("churn"), nil); err != nil {
+		t.Fatalf("Compact: unexpected error: %v", err)
+	}
+	afterBucket, err := idb.Stats()
+	if err != nil {
+		t.Fatalf("Stats: unexpected error: %v", err)
+	}
+	churnAfter, _ := bucketSize(afterBucket, "churn")
+	if churnAfter >= churnBefore/10 {
+		t.Fatalf("Compact: churn bucket size %d not reduced from %d",
+			churnAfter, churnBefore)
+	}
+	if afterBucket.MetadataSize >= before.MetadataSize {
+		t.Fatalf("Compact: metadata size %d not reduced from %d",
+			afterBucket.MetadataSize, before.MetadataSize)
+	}
+	if err := idb.Compact(nil, nil); err != nil {
+		t.Fatalf("Compact: unexpected error: %v", err)
+	}
+	after, err := idb.Stats()
+	if err != nil {
+		t.Fatalf("Stats: unexpected error: %v", err)
+	}
+	if after.MetadataSize > afterBucket.MetadataSize {
+		t.Fatalf("Compact: metadata size %d grew from %d",
+			after.MetadataSize, afterBucket.MetadataSize)
+	}
+
+	// Ensure the remaining data is intact.
+	err = idb.View(func(tx database.Tx) error {
+		got := tx.Metadata().Bucket([]byte("keep")).Get([]byte("key"))
+		if string(got) != "value" {
+			t.Fatalf("Get: unexpected value %q", got)
+		}
+		churn := tx.Metadata().Bucket([]byte("churn"))
+		if churn.Get([]byte{0, 0, 0, 0}) != nil {
+			t.Fatal("Get: deleted key still exists")
+		}
+		_, err := tx.FetchBlock(block.Hash())
+		return err
+	})
+	if err != nil {
+		t.Fatalf("View: unexpected error: %v", err)
+	}
+
+	// Ensure compacting a closed database fails.
+	if err := idb.Close(); err != nil {
+		t.Fatalf("Close: unexpected error: %v", err)
+	}
+	err = idb.Compact(nil, nil)
+	checkDbError(t, "Compact closed", err, database.ErrDbNotOpen)
+	_, err = idb.Stats()
+	checkDbError(t, "Stats closed", err, database.ErrDbNotOpen)
+}
+
+// repairTestBlocks returns the passed number of distinct blocks for the block
+// file repair tests along with the offset just after the record of each block
+// when they are stored one after the other in the same block file.
+func repairTestBlocks(t *testing.T, numBlocks int) ([]*provautil.Block, []uint32) {
+	blocks := make([]*provautil.Block, 0, numBlocks)
+	ends := make([]uint32, 0, numBlocks)
+	var offset uint32
+	for i := 0; i < numBlocks; i++ {
+		msgBlock := *chaincfg.MainNetParams.GenesisBlock
+		msgBlock.Header.Nonce = uint64(i)
+		block := provautil.NewBlock(&msgBlock)
+		blockBytes, err := block.Bytes()
+		if err != nil {
+			t.Fatalf("Bytes: unexpected error: %v", err)
+		}
+		offset += uint32(len(blockBytes)) + 12
+		blocks = append(blocks, block)
+		ends = append(ends, offset)
+	}
+	return blocks, ends
+}
+
+// storeRepairTestBlocks stores each of the passed blocks in its own transaction.
+func storeRepairTestBlocks(t *testing.T, idb database.DB, blocks []*provautil.Block) {
+	for _, block := range blocks {
+		err := idb.Update(func(tx database.Tx) error {
+			return tx.StoreBlock(block)
+		})
+		if err != nil {
+			t.Fatalf("StoreBlock: unexpected error: %v", err)
+		}
+	}
+}
+
+// checkRepairTestBlocks ensures exactly the first numStored of the passed
+// blocks are stored in the database and can be fetched.
+func checkRepairTestBlocks(t *testing.T, testName string, idb database.DB, blocks []*provautil.Block, numStored int) {
+	err := idb.View(func(tx database.Tx) error {
+		for i, block := range blocks {
+			hasBlock, err := tx.HasBlock(block.Hash())
+			if err != nil {
+				return err
+			}
+			if hasBlock != (i < numStored) {
+				t.Fatalf("%s: unexpected HasBlock %v for block %d",
+					testName, hasBlock, i)
+			}
+			if !hasBlock {
+				continue
+			}
+			if _, err := tx.FetchBlock(block.Hash()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("%s: unexpected error: %v", testName, err)
+	}
+}
+
+// TestBlockFileRepair ensures the database automatically recovers when the
+// most recent block file was truncated or its trailing block records were lost
+// after the metadata referring to them was written, by removing the blocks
+// which are no longer fully stored so they can be stored again.
+func TestBlockFileRepair(t *testing.T) {
+	const numBlocks = 4
+	blocks, ends := repairTestBlocks(t, numBlocks)
+
+	tests := []struct {
+		name      string
+		truncate  uint32 // Offset to truncate the block file to
+		zero      uint32 // Offset to zero the block file from
+		numStored int    // Blocks which remain stored after the repair
+	}{
+		{name: "entire file", truncate: 0, numStored: 0},
+		{name: "record header", truncate: ends[1] + 3, numStored: 2},
+		{name: "block data", truncate: ends[1] + 100, numStored: 2},
+		{name: "checksum", truncate: ends[3] - 2, numStored: 3},
+		{name: "record boundary", truncate: ends[2], numStored: 3},
+		{name: "first block", truncate: ends[0] - 1, numStored: 0},
+		{name: "zeroed records", truncate: ends[3], zero: ends[0] + 10,
+			numStored: 1},
+	}
+
+	dbPath := filepath.Join(os.TempDir(), "ffldb-blockfilerepair")
+	defer os.RemoveAll(dbPath)
+	for _, test := range tests {
+		_ = os.RemoveAll(dbPath)
+		idb, err := database.Create(dbType, dbPath, blockDataNet)
+		if err != nil {
+			t.Fatalf("%s: failed to create test database: %v",
+				test.name, err)
+		}
+		storeRepairTestBlocks(t, idb, blocks)
+		if err := idb.Close(); err != nil {
+			t.Fatalf("%s: Close: unexpected error: %v", test.name, err)
+		}
+
+		// Lose the trailing block data while the metadata still
+		// refers to it.
+		filePath := blockFilePath(dbPath, 0)
+		file, err := os.OpenFile(filePath, os.O_RDWR, 0)
+		if err != nil {
+			t.Fatalf("%s: unable to open block file: %v", test.name,
+				err)
+		}
+		if test.zero != 0 {
+			zeroes := make([]byte, test.truncate-test.zero)
+			_, err = file.WriteAt(zeroes, int64(test.zero))
+		}
+		if err == nil {
+			err = file.Truncate(int64(test.truncate))
+		}
+		file.Close()
+		if err != nil {
+			t.Fatalf("%s: unable to modify block file: %v",
+				test.name, err)
+		}
+
+		// Ensure the database is repaired when it is opened by
+		// removing the blocks which are no longer fully stored and
+		// truncating the block file to the last fully stored block.
+		idb, err = database.Open(dbType, dbPath, blockDataNet)
+		if err != nil {
+			t.Fatalf("%s: Open: unexpected error: %v", test.name, err)
+		}
+		checkRepairTestBlocks(t, test.name, idb, blocks, test.numStored)
+		var wantSize uint32
+		if test.numStored > 0 {
+			wantSize = ends[test.numStored-1]
+		}
+		fi, err := os.Stat(filePath)
+		if err != nil {
+			t.Fatalf("%s: unable to stat block file: %v", test.name,
+				err)
+		}
+		if fi.Size() != int64(wantSize) {
+			t.Fatalf("%s: unexpected block file size %d, want %d",
+				test.name, fi.Size(), wantSize)
+		}
+
+		// Ensure the removed blocks can be stored again and all of the
+		// blocks are intact after reopening the database.
+		storeRepairTestBlocks(t, idb, blocks[test.numStored:])
+		if err := idb.Close(); err != nil {
+			t.Fatalf("%s: Close: unexpected error: %v", test.name, err)
+		}
+		idb, err = database.Open(dbType, dbPath, blockDataNet)
+		if err != nil {
+			t.Fatalf("%s: Open: unexpected error: %v", test.name, err)
+		}
+		checkRepairTestBlocks(t, test.name, idb, blocks, numBlocks)
+		if err := idb.Close(); err != nil {
+			t.Fatalf("%s: Close: unexpected error: %v", test.name, err)
+		}
+	}
+}
+
+// TestCheckBlocks ensures corrupt blocks in older block files, which are not
+// verified when the database is opened, are detected by a full check, and that
+// reading corrupt block data causes the full check to be performed the next
+// time the database is opened.
+func TestCheckBlocks(t *testing.T) {
+	const numBlocks = 3
+	blocks, ends := repairTestBlocks(t, numBlocks)
+
+	dbPath := filepath.Join(os.TempDir(), "ffldb-checkblocks")
+	_ = os.RemoveAll(dbPath)
+	defer os.RemoveAll(dbPath)
+	idb, err := database.Create(dbType, dbPath, blockDataNet)
+	if err != nil {
+		t.Fatalf("Failed to create test database (%s) %v", dbType, err)
+	}
+
+	// Store every block in its own block file.
+	idb.(*db).store.maxBlockFileSize = ends[0]
+	storeRepairTestBlocks(t, idb, blocks)
+	if err := idb.CheckBlocks(nil); err != nil {
+		t.Fatalf("CheckBlocks: unexpected error: %v", err)
+	}
+	interrupt := make(chan struct{})
+	close(interrupt)
+	err = idb.CheckBlocks(interrupt)
+	if !checkDbError(t, "CheckBlocks interrupted", err,
+		database.ErrInterrupted) {
+
+		return
+	}
+	if err := idb.Close(); err != nil {
+		t.Fatalf("Close: unexpected error: %v", err)
+	}
+
+	// Corrupt the first block and ensure the database still opens since
+	// only the most recent block file is verified.
+	filePath := blockFilePath(dbPath, 0)
+	flipByte := func() {
+		file, err := os.OpenFile(filePath, os.O_RDWR, 0)
+		if err != nil {
+			t.Fatalf("unable to open block file: %v", err)
+		}
+		defer file.Close()
+		var b [1]byte
+		if _, err := file.ReadAt(b[:], 20); err != nil {
+			t.Fatalf("unable to read block file: %v", err)
+		}
+		b[0] ^= 0xff
+		if _, err := file.WriteAt(b[:], 20); err != nil {
+			t.Fatalf("unable to modify block file: %v", err)
+		}
+	}
+	flipByte()
+	idb, err = database.Open(dbType, dbPath, blockDataNet)
+	if err != nil {
+		t.Fatalf("Open: unexpected error: %v", err)
+	}
+
+	// Ensure a full check detects the corrupt block without repairing it
+	// since the blocks after it would have to be removed as well.
+	err = idb.CheckBlocks(nil)
+	if !checkDbError(t, "CheckBlocks corrupt", err, database.ErrCorruption) {
+		idb.Close()
+		return
+	}
+	markerPath := filepath.Join(dbPath, checkBlocksMarkerName)
+	if fileExists(markerPath) {
+		t.Fatal("CheckBlocks: unexpected full check marker")
+	}
+
+	// Ensure reading the corrupt block fails and causes a full check when
+	// the database is opened again.
+	err = idb.View(func(tx database.Tx) error {
+		_, err := tx.FetchBlock(blocks[0].Hash())
+		return err
+	})
+	if !checkDbError(t, "FetchBlock corrupt", err, database.ErrCorruption) {
+		idb.Close()
+		return
+	}
+	if !fileExists(markerPath) {
+		t.Fatal("FetchBlock: full check marker not created")
+	}
+	if err := idb.Close(); err != nil {
+		t.Fatalf("Close: unexpected error: %v", err)
+	}
+	_, err = database.Open(dbType, dbPath, blockDataNet)
+	if !checkDbError(t, "Open corrupt", err, database.ErrCorruption) {
+		return
+	}
+
+	// Ensure the database opens again once the block is no longer corrupt
+	// and the full check marker is removed.
+	flipByte()
+	idb, err = database.Open(dbType, dbPath, blockDataNet)
+	if err != nil {
+		t.Fatalf("Open: unexpected error: %v", err)
+	}
+	defer idb.Close()
+	if fileExists(markerPath) {
+		t.Fatal("Open: full check marker not removed")
+	}
+	checkRepairTestBlocks(t, "Open repaired", idb, blocks, numBlocks)
+}
@@ -409,6 +409,47 @@ type Tx interface {
 	Rollback() error
 }
 
+// BucketStats houses the approximate storage used by a top-level metadata
+// bucket.
+type BucketStats struct {
+	// Name is the name of the bucket.
+	Name []byte
+
+	// Size is the approximate number of bytes used on disk by the keys of
+	// the bucket and all of its nested buckets.  Data which has not been
+	// written to persistent storage yet is not included.
+	Size int64
+}
+
+// Stats houses statistics about the storage used by a database.  The exact
+// meaning of the metadata related fields depends on the specific backend
+// driver, so they should only be used as an indication of the storage used.
+type Stats struct {
+	// Buckets houses the approximate storage used by each top-level
+	// metadata bucket.
+	Buckets []BucketStats
+
+	// MetadataFiles and MetadataSize are the number and total size of the
+	// files which house the metadata.
+	MetadataFiles int
+	MetadataSize  int64
+
+	// LevelFiles is the number of metadata files at each level of the
+	// backend storage for drivers which store the metadata in levels.
+	LevelFiles []int
+
+	// ObsoleteFiles and ObsoleteSize are the number and total size of the
+	// metadata files which are no longer referenced and are waiting to be
+	// removed.
+	ObsoleteFiles int
+	ObsoleteSize  int64
+
+	// BlockFiles and BlockFilesSize are the number and total size of the
+	// files which house the blocks.
+	BlockFiles     int
+	BlockFilesSize int64
+}
+
 // DB provides a generic interface that is used to store bitcoin blocks and
 // related metadata.  This interface is intended to be agnostic to the actual
 // mechanism used for backend data storage.  The RegisterDriver function can be
@@ -460,6 +501,31 @@ type DB interface {
 	// user-supplied function will result in a panic.
 	Update(fn func(tx Tx) error) error
 
+	// Stats returns statistics about the storage used by the database.
+	Stats() (*Stats, error)
+
+	// Compact compacts the storage used by the metadata to reclaim the
+	// space used by deleted and overwritten data.  The entire metadata is
+	// compacted when the bucket is nil, otherwise only the data of the
+	// top-level metadata bucket with the given name and all of its nested
+	// buckets is compacted.
+	//
+	// The database remains usable while it is compacted.  The compaction
+	// is performed in steps and is aborted with ErrInterrupted when the
+	// interrupt channel is closed or with ErrDbNotOpen when the database
+	// is closed before it completes.
+	Compact(bucket []byte, interrupt <-chan struct{}) error
+
+	// CheckBlocks verifies all of the stored block data and cross-checks
+	// the block index against it.  The most recently stored blocks which
+	// are found to not be fully stored are removed so they can be stored
+	// again, while ErrCorruption is returned when older blocks are
+	// corrupt.
+	//
+	// No blocks can be stored while the check is underway.  The check is
+	// aborted with ErrInterrupted when the interrupt channel is closed.
+	CheckBlocks(interrupt <-chan struct{}) error
+
 	// Close cleanly shuts down the database and syncs all data.  It will
 	// block until all database transactions have been finalized (rolled
 	// back or committed).
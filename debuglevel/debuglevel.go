@@ -0,0 +1,96 @@
+// Copyright (c) 2013-2016 The btcsuite developers
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Package debuglevel parses the debug level specifications which set the
+// logging levels of the subsystems of a node, such as the ones passed via the
+// --debuglevel option and the debuglevel RPC.
+//
+// A specification is either a single level, which applies to all subsystems,
+// or a comma-separated list of <subsystem>=<level> pairs.
+package debuglevel
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ValidLevel returns whether or not the passed level is a valid debug log
+// level.
+func ValidLevel(level string) bool {
+	switch level {
+	case "trace":
+		fallthrough
+	case "debug":
+		fallthrough
+	case "info":
+		fallthrough
+	case "warn":
+		fallthrough
+	case "error":
+		fallthrough
+	case "critical":
+		return true
+	}
+	return false
+}
+
+// Parse parses the passed debug level specification into a map of subsystem
+// identifiers to the log levels which are to be set for them.  The passed
+// subsystems are the supported subsystem identifiers, sorted for display.  An
+// appropriate error is returned if anything is invalid.
+func Parse(spec string, subsystems []string) (map[string]string, error) {
+	// When the specified string doesn't have any delimters, treat it as
+	// the log level for all subsystems.
+	if !strings.Contains(spec, ",") && !strings.Contains(spec, "=") {
+		// Validate debug log level.
+		if !ValidLevel(spec) {
+			str := "The specified debug level [%v] is invalid"
+			return nil, fmt.Errorf(str, spec)
+		}
+
+		levels := make(map[string]string, len(subsystems))
+		for _, subsysID := range subsystems {
+			levels[subsysID] = spec
+		}
+		return levels, nil
+	}
+
+	supported := make(map[string]struct{}, len(subsystems))
+	for _, subsysID := range subsystems {
+		supported[subsysID] = struct{}{}
+	}
+
+	// Split the specified string into subsystem/level pairs while detecting
+	// issues.
+	levels := make(map[string]string)
+	for _, logLevelPair := range strings.Split(spec, ",") {
+		if !strings.Contains(logLevelPair, "=") {
+			str := "The specified debug level contains an invalid " +
+				"subsystem/level pair [%v]"
+			return nil, fmt.Errorf(str, logLevelPair)
+		}
+
+		// Extract the specified subsystem and log level.
+		fields := strings.Split(logLevelPair, "=")
+		subsysID, logLevel := fields[0], fields[1]
+
+		// Validate subsystem.
+		if _, exists := supported[subsysID]; !exists {
+			str := "The specified subsystem [%v] is invalid -- " +
+				"supported subsytems %v"
+			return nil, fmt.Errorf(str, subsysID, subsystems)
+		}
+
+		// Validate log level.
+		if !ValidLevel(logLevel) {
+			str := "The specified debug level [%v] is invalid"
+			return nil, fmt.Errorf(str, logLevel)
+		}
+
+		levels[subsysID] = logLevel
+	}
+
+	return levels, nil
+}
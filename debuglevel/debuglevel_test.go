@@ -0,0 +1,66 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package debuglevel_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bitgo/prova/debuglevel"
+)
+
+// TestParse ensures debug level specifications are parsed into the levels of
+// the supported subsystems and that invalid specifications are rejected.
+func TestParse(t *testing.T) {
+	subsystems := []string{"PEER", "RPCS", "SRVR"}
+	tests := []struct {
+		name  string
+		spec  string
+		want  map[string]string
+		valid bool
+	}{
+		{
+			name: "level for all subsystems",
+			spec: "debug",
+			want: map[string]string{"PEER": "debug", "RPCS": "debug",
+				"SRVR": "debug"},
+			valid: true,
+		},
+		{
+			name:  "subsystem levels",
+			spec:  "RPCS=trace,SRVR=warn",
+			want:  map[string]string{"RPCS": "trace", "SRVR": "warn"},
+			valid: true,
+		},
+		{
+			name: "invalid level for all subsystems",
+			spec: "verbose",
+		},
+		{
+			name: "pair without level",
+			spec: "RPCS=trace,SRVR",
+		},
+		{
+			name: "unsupported subsystem",
+			spec: "RPCS=trace,XXXX=info",
+		},
+		{
+			name: "invalid subsystem level",
+			spec: "RPCS=trace,SRVR=verbose",
+		},
+	}
+
+	for _, test := range tests {
+		levels, err := debuglevel.Parse(test.spec, subsystems)
+		if (err == nil) != test.valid {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if test.valid && !reflect.DeepEqual(levels, test.want) {
+			t.Errorf("%s: got levels %v, want %v", test.name, levels,
+				test.want)
+		}
+	}
+}
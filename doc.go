@@ -40,10 +40,38 @@ Application Options:
                             banning misbehaving peers.
       --banduration=        How long to ban misbehaving peers.  Valid time units
                             are {s, m, h}.  Minimum 1 second (24h0m0s)
+      --banscore=           Override the ban score of a kind of misbehavior as
+                            <offense>=<score>.  Offenses with persistent scores:
+                            protocol, malformedmsg, invalidblock, useragent.
+                            Offenses with decaying scores: mempool, getdata, inv
+                            (for messages of the maximum size), validatorkey
+      --msglimit=           Override a limit of the number of elements of peer
+                            messages as <limit>=<count> for private networks.
+                            Limits: headers (2000), inv (50000), addr (1000) --
+                            The size of block messages always matches the block
+                            size limit of the chain
+      --agentblacklist=     Disconnect peers whose user agent contains the
+                            passed substring (eg. /Prova:0.1.0/)
+      --uacomment=          Comment to add to the user agent -- See BIP 14 for
+                            more information.
+      --whitelist=          Add an IP network or IP that will not be banned,
+                            optionally prefixed with the relay policy checks
+                            its transactions are exempt from as
+                            <exemptions>@<ip>.  Exemptions: relayfee,
+                            nonstandard, ratelimit, all (eg. 192.168.1.0/24,
+                            ::1 or relayfee,nonstandard@10.0.0.0/8)
   -u, --rpcuser=            Username for RPC connections
   -P, --rpcpass=            Password for RPC connections
       --rpclimituser=       Username for limited RPC connections
       --rpclimitpass=       Password for limited RPC connections
+      --rpcauth=            Add an RPC user which may only execute the granted
+                            commands, optionally limited to a number of
+                            commands per second, as
+                            <user>:<password>:<commands>[:<rate>].  Commands
+                            is a comma separated list of commands and command
+                            categories: read, wallet, mining, admin (eg.
+                            dashboard:secret:read or
+                            pool:secret:mining,getblockcount:10)
       --rpclisten=          Add an interface/port to listen for RPC connections
                             (default port: 8334, testnet: 18334)
       --rpccert=            File containing the certificate file
@@ -55,10 +83,19 @@ Application Options:
                             Discouraged unless interoperability issues need to
                             be worked around
       --norpc               Disable built-in RPC server -- NOTE: The RPC server
-                            is disabled by default if no rpcuser/rpcpass or
-                            rpclimituser/rpclimitpass is specified
+                            is disabled by default if no rpcuser/rpcpass,
+                            rpclimituser/rpclimitpass or rpcauth is specified
       --notls               Disable TLS for the RPC server -- NOTE: This is only
                             allowed if the RPC server is bound to localhost
+      --restlisten=         Add an interface/port to listen for unauthenticated
+                            REST requests (default port: 8335, testnet: 18335)
+                            -- NOTE: The REST server is disabled unless an
+                            interface is specified
+      --metricslisten=      Add an interface/port to serve metrics in the
+                            Prometheus text format over unauthenticated HTTP
+                            (default port: 8336, testnet: 18336) -- NOTE: The
+                            metrics server is disabled unless an interface is
+                            specified
       --nodnsseed           Disable DNS seeding for peers
       --externalip=         Add an ip to the list of local addresses we claim to
                             listen on to peers
@@ -72,13 +109,53 @@ Application Options:
       --noonion             Disable connecting to tor hidden services
       --torisolation        Enable Tor stream isolation by randomizing user
                             credentials for each connection.
+      --proxyonly           Refuse connections and DNS lookups which do not go
+                            through the --proxy or --onion proxy and do not
+                            advertise discovered local addresses
       --testnet             Use the test network
       --regtest             Use the regression test network
+      --keepregtestdb       Keep the existing regression test database on start
+                            up instead of removing it, for example to test
+                            restarts
       --simnet              Use the simulation test network
       --addcheckpoint=      Add a custom checkpoint.  Format: '<height>:<hash>'
+      --assumevalid=        Hash of a block assumed to be valid along with its
+                            ancestors which skips their script validation --
+                            Defaults to the built-in block for the network, 0
+                            disables
+      --addutxosnapshot=    Add a known good utxo set snapshot which may be
+                            imported.  Format: '<height>:<hash>:<commitment>'
+      --exportutxosnapshot= Writes a snapshot of the utxo set at the current
+                            best block to the given file on start up and then
+                            exits.
+      --importutxosnapshot= Initializes a fresh chain state from the utxo set
+                            snapshot in the given file on start up and then
+                            syncs from its base block.  The snapshot must be
+                            built-in for the network or added with
+                            --addutxosnapshot.
+      --dumpblocks=         Writes the blocks of the main chain to the given
+                            file on start up and then exits.  The file can be
+                            imported with --loadblock or the addblock utility.
+      --loadblock=          Imports the blocks from the given file, written by
+                            --dumpblocks, with full validation on start up.
+                            May be specified multiple times.
+      --maxreorgdepth=      Maximum number of blocks a reorganization may
+                            disconnect from the main chain, deeper ones are
+                            refused even when the side chain has more work --
+                            Defaults to the value for the network, 0 disables
       --nocheckpoints       Disable built-in checkpoints.  Don't do this unless
                             you know what you're doing.
       --dbtype=             Database backend to use for the Block Chain (ffldb)
+      --utxobatchsize=      Maximum number of blocks whose utxo set changes are
+                            kept in memory and written together while the chain
+                            is syncing -- 0 or 1 writes them for every block
+                            (100)
+      --checkblocks         Verifies all of the block data in the database on
+                            start up and repairs the block files when the most
+                            recently stored blocks are not fully stored
+      --shutdowntimeout=    How long to wait for a graceful shutdown to complete
+                            before exiting without closing the database.  Valid
+                            time units are {s, m, h}.  Minimum 1 second (5m0s)
       --profile=            Enable HTTP profiling on given port -- NOTE port
                             must be between 1024 and 65536
       --cpuprofile=         Write CPU profile to the specified file
@@ -88,6 +165,8 @@ Application Options:
                             the log level for individual subsystems -- Use show
                             to list available subsystems (info)
       --upnp                Use UPnP to map our listening port outside of NAT
+      --natpmp              Use NAT-PMP to map our listening port outside of NAT
+                            when UPnP is not enabled or not available
       --minrelaytxfee=      The minimum transaction fee in RMG/kB to be
                             considered a non-zero fee.
       --limitfreerelay=     Limit relay of transactions with no transaction fee
@@ -95,8 +174,21 @@ Application Options:
                             minute (15)
       --relaypriority       Require free or low-fee transactions to have
                             high priority for relaying
+      --nostrictencoding    Relay and mine transactions with non-canonical
+                            signature or public key encodings, such as high-S
+                            signatures, until the strict encoding deployment
+                            is active
       --maxorphantx=        Max number of orphan transactions to keep in memory
                             (100)
+      --maxmempool=         Maximum size in megabytes of the transactions kept
+                            in the memory pool -- Transactions paying the
+                            lowest fee rates are evicted first -- 0 disables
+                            the limit (300)
+      --reorgexempt=        Comma separated list of the relay policy checks the
+                            transactions of blocks disconnected by a
+                            reorganization are exempt from when they are added
+                            back to the memory pool.  Exemptions: relayfee,
+                            nonstandard, ratelimit, all
       --generate            Generate (mine) blocks using the CPU
       --miningaddr=         Add the specified payment address to the list of
                             addresses to use for generated blocks -- At least
@@ -108,15 +200,25 @@ Application Options:
                             a block (750000)
       --blockprioritysize=  Size in bytes for high-priority/low-fee transactions
                             when creating a block (50000)
+      --templatefeedelta=   Increase in RMG of the fees of new memory pool
+                            transactions which makes getblocktemplate long poll
+                            clients receive a new template right away -- 0 only
+                            regenerates templates periodically
       --nopeerbloomfilters  Disable bloom filtering support.
       --sigcachemaxsize=    The maximum number of entries in the signature
                             verification cache.
+      --scriptworkers=      The maximum number of goroutines used to validate
+                            block scripts -- 0 uses the number of usable CPUs
       --blocksonly          Do not accept transactions from remote peers.
       --relaynonstd         Relay non-standard transactions regardless of the
                             default settings for the active network.
       --rejectnonstd        Reject non-standard transactions regardless of the
                             default settings for the active network.
       --enableexternalrpc   Enable RPC listening on external interfaces.
+      --adminkeyfile=       File containing the hex-encoded private keys, one
+                            per line, of the provision keys used to sign the
+                            transactions of the provisionvalidator and
+                            revokevalidator RPCs
 
 Help Options:
   -h, --help           Show this help message
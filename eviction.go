@@ -0,0 +1,202 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/bitgo/prova/addrmgr"
+)
+
+const (
+	// evictProtectGroups is the number of inbound peers from distinct
+	// network groups which are protected from eviction.
+	evictProtectGroups = 4
+
+	// evictProtectPing is the number of inbound peers with the lowest ping
+	// times which are protected from eviction.
+	evictProtectPing = 8
+
+	// evictProtectBlocks is the number of inbound peers which most recently
+	// relayed a new block and are protected from eviction.
+	evictProtectBlocks = 4
+)
+
+// evictionCandidate describes an inbound peer which may be evicted to make
+// room for a new inbound peer.
+type evictionCandidate struct {
+	id            int32
+	sp            *serverPeer
+	timeConnected time.Time
+	pingMicros    int64
+	lastBlockTime int64
+	group         string
+	groupHash     uint64
+}
+
+// evictionGroupHash returns the hash of the passed network group keyed by the
+// passed salt.  Keying the hash prevents an attacker from predicting which
+// network groups are protected from eviction.
+func evictionGroupHash(salt uint64, group string) uint64 {
+	var key [8]byte
+	binary.LittleEndian.PutUint64(key[:], salt)
+	h := fnv.New64a()
+	h.Write(key[:])
+	h.Write([]byte(group))
+	return h.Sum64()
+}
+
+// newEvictionCandidate returns an eviction candidate describing the passed
+// inbound peer which is tracked with the passed id.
+func newEvictionCandidate(id int32, sp *serverPeer, salt uint64) *evictionCandidate {
+	group := addrmgr.GroupKey(sp.NA())
+	return &evictionCandidate{
+		id:            id,
+		sp:            sp,
+		timeConnected: sp.TimeConnected(),
+		pingMicros:    sp.LastPingMicros(),
+		lastBlockTime: atomic.LoadInt64(&sp.lastBlockTime),
+		group:         group,
+		groupHash:     evictionGroupHash(salt, group),
+	}
+}
+
+// selectEvictionVictim returns the candidate to evict to make room for a new
+// inbound peer, or nil when all candidates are protected.
+//
+// The peers which are hard for an attacker to imitate are protected: peers
+// from a few distinct network groups, the peers with the lowest ping times,
+// the peers which most recently relayed new blocks, and half of the remaining
+// peers which have been connected the longest.  The youngest peer from the
+// network group with the most remaining peers is evicted, so an attacker
+// occupying the inbound slots from few network groups evicts its own peers.
+func selectEvictionVictim(candidates []*evictionCandidate) *evictionCandidate {
+	remaining := make([]*evictionCandidate, len(candidates))
+	copy(remaining, candidates)
+
+	// protect removes up to the passed number of the remaining candidates
+	// in the order defined by the passed less function for which the
+	// passed filter returns true.
+	protect := func(n int, less func(a, b *evictionCandidate) bool, filter func(c *evictionCandidate) bool) {
+		sort.SliceStable(remaining, func(i, j int) bool {
+			return less(remaining[i], remaining[j])
+		})
+		kept := remaining[:0]
+		for _, c := range remaining {
+			if n > 0 && filter(c) {
+				n--
+				continue
+			}
+			kept = append(kept, c)
+		}
+		remaining = kept
+	}
+	all := func(c *evictionCandidate) bool { return true }
+
+	// Protect the longest connected peer of distinct network groups in the
+	// order of their keyed group hashes.
+	protectedGroups := make(map[string]struct{})
+	protect(evictProtectGroups, func(a, b *evictionCandidate) bool {
+		if a.groupHash != b.groupHash {
+			return a.groupHash < b.groupHash
+		}
+		return a.timeConnected.Before(b.timeConnected)
+	}, func(c *evictionCandidate) bool {
+		if _, ok := protectedGroups[c.group]; ok {
+			return false
+		}
+		protectedGroups[c.group] = struct{}{}
+		return true
+	})
+
+	// Protect the peers with the lowest ping times.  Peers which did not
+	// answer a ping yet are not protected.
+	protect(evictProtectPing, func(a, b *evictionCandidate) bool {
+		return a.pingMicros < b.pingMicros
+	}, func(c *evictionCandidate) bool {
+		return c.pingMicros > 0
+	})
+
+	// Protect the peers which most recently relayed new blocks.
+	protect(evictProtectBlocks, func(a, b *evictionCandidate) bool {
+		return a.lastBlockTime > b.lastBlockTime
+	}, func(c *evictionCandidate) bool {
+		return c.lastBlockTime > 0
+	})
+
+	// Protect half of the remaining peers which have been connected the
+	// longest.
+	protect(len(remaining)/2, func(a, b *evictionCandidate) bool {
+		return a.timeConnected.Before(b.timeConnected)
+	}, all)
+
+	if len(remaining) == 0 {
+		return nil
+	}
+
+	// Evict the youngest peer of the network group with the most remaining
+	// peers.  Ties are broken in favor of the group with the youngest peer.
+	groups := make(map[string][]*evictionCandidate)
+	for _, c := range remaining {
+		groups[c.group] = append(groups[c.group], c)
+	}
+	var victimGroup []*evictionCandidate
+	var victim *evictionCandidate
+	for _, group := range groups {
+		youngest := group[0]
+		for _, c := range group[1:] {
+			if c.timeConnected.After(youngest.timeConnected) {
+				youngest = c
+			}
+		}
+		if len(group) > len(victimGroup) || (len(group) ==
+			len(victimGroup) && youngest.timeConnected.After(
+			victim.timeConnected)) {
+
+			victimGroup = group
+			victim = youngest
+		}
+	}
+	return victim
+}
+
+// evictInboundPeer disconnects an inbound peer selected by the eviction policy
+// to make room for a new inbound peer and returns whether or not a peer was
+// evicted.  Whitelisted peers are never evicted.  It is invoked from the
+// peerHandler goroutine.
+func (s *server) evictInboundPeer(state *peerState) bool {
+	candidates := make([]*evictionCandidate, 0, len(state.inboundPeers))
+	for id, sp := range state.inboundPeers {
+		if sp.isWhitelisted {
+			continue
+		}
+		candidates = append(candidates, newEvictionCandidate(id, sp,
+			s.evictionSalt))
+	}
+	victim := selectEvictionVictim(candidates)
+	if victim == nil {
+		return false
+	}
+
+	// The evicted peer is removed right away to free its slot.
+	delete(state.inboundPeers, victim.id)
+	atomic.AddUint64(&s.evictedPeers, 1)
+	srvrLog.Infof("Evicting inbound peer %s to make room for a new "+
+		"inbound peer", victim.sp)
+	victim.sp.Disconnect()
+	return true
+}
+
+// InboundEvictions returns the number of inbound peers which have been evicted
+// to make room for new inbound peers since the server started.
+//
+// This function is safe for concurrent access.
+func (s *server) InboundEvictions() uint64 {
+	return atomic.LoadUint64(&s.evictedPeers)
+}
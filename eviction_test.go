@@ -0,0 +1,156 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/connmgr"
+	"github.com/bitgo/prova/peer"
+)
+
+// TestSelectEvictionVictim ensures the eviction policy protects the peers which
+// are hard to imitate and evicts the worst of the remaining peers.
+func TestSelectEvictionVictim(t *testing.T) {
+	base := time.Unix(1500000000, 0)
+
+	// A full inbound set of well-behaved peers from distinct network groups
+	// which answered pings and relayed blocks, along with a single peer
+	// which connected last, never answered a ping and never relayed a
+	// block.
+	var candidates []*evictionCandidate
+	for i := 0; i < 30; i++ {
+		c := &evictionCandidate{
+			id:            int32(i),
+			timeConnected: base.Add(time.Duration(i) * time.Minute),
+			pingMicros:    int64(1000 + i),
+			group:         fmt.Sprintf("group%d", i),
+			groupHash:     uint64(i),
+		}
+		if i%3 == 0 {
+			c.lastBlockTime = base.Unix() + int64(i)
+		}
+		candidates = append(candidates, c)
+	}
+	worst := &evictionCandidate{
+		id:            30,
+		timeConnected: base.Add(time.Hour),
+		group:         "worst",
+		groupHash:     ^uint64(0),
+	}
+	candidates = append(candidates, worst)
+	if victim := selectEvictionVictim(candidates); victim != worst {
+		t.Fatalf("evicted %+v, want the worst peer", victim)
+	}
+
+	// An attacker occupying many slots from a single network group evicts
+	// its own youngest peer even when a younger peer from another group
+	// remains.
+	candidates = candidates[:30]
+	var youngestAttacker *evictionCandidate
+	for i := 0; i < 10; i++ {
+		youngestAttacker = &evictionCandidate{
+			id:            int32(100 + i),
+			timeConnected: base.Add(time.Hour + time.Duration(i)*time.Second),
+			group:         "attacker",
+			groupHash:     ^uint64(0),
+		}
+		candidates = append(candidates, youngestAttacker)
+	}
+	candidates = append(candidates, &evictionCandidate{
+		id:            200,
+		timeConnected: base.Add(2 * time.Hour),
+		group:         "lone",
+		groupHash:     ^uint64(0) - 1,
+	})
+	if victim := selectEvictionVictim(candidates); victim != youngestAttacker {
+		t.Fatalf("evicted %+v, want the youngest attacker peer", victim)
+	}
+
+	// No peer is evicted when all of them are protected.
+	if victim := selectEvictionVictim(candidates[:evictProtectGroups]); victim != nil {
+		t.Fatalf("evicted protected peer %+v", victim)
+	}
+	if victim := selectEvictionVictim(nil); victim != nil {
+		t.Fatalf("evicted %+v without candidates", victim)
+	}
+}
+
+// newEvictionTestPeer returns an inbound server peer of the passed server which
+// is connected from the passed address.
+func newEvictionTestPeer(s *server, addr string, whitelisted bool) *serverPeer {
+	sp := newServerPeer(s, false)
+	sp.isWhitelisted = whitelisted
+	sp.Peer = peer.NewInboundPeer(&peer.Config{
+		ChainParams: &chaincfg.RegressionNetParams,
+	})
+	r, w := io.Pipe()
+	sp.AssociateConnection(&pipeConn{Reader: r, Writer: w,
+		laddr: "12.0.0.1:18333", raddr: addr})
+	return sp
+}
+
+// TestEvictInboundPeer ensures a new inbound peer evicts the worst inbound
+// peer when all slots are taken, that whitelisted peers are never evicted and
+// that the evictions are counted.
+func TestEvictInboundPeer(t *testing.T) {
+	origCfg := cfg
+	cfg = &config{MaxPeers: 3}
+	defer func() { cfg = origCfg }()
+
+	s := &server{banManager: connmgr.NewBanManager("")}
+	state := &peerState{
+		inboundPeers:    make(map[int32]*serverPeer),
+		outboundPeers:   make(map[int32]*serverPeer),
+		persistentPeers: make(map[int32]*serverPeer),
+		outboundGroups:  make(map[string]int),
+	}
+
+	// Fill the slots with a whitelisted peer, a peer which relayed a block
+	// and a younger peer from the same network group which did not.  The
+	// peers never negotiate a version, which assigns their ids, so they
+	// are keyed by the order they connected in instead.
+	whitelisted := newEvictionTestPeer(s, "12.1.0.1:18333", true)
+	relayer := newEvictionTestPeer(s, "12.2.0.1:18333", false)
+	relayer.lastBlockTime = time.Now().Unix()
+	time.Sleep(10 * time.Millisecond)
+	idle := newEvictionTestPeer(s, "12.2.0.2:18333", false)
+	for i, sp := range []*serverPeer{whitelisted, relayer, idle} {
+		state.inboundPeers[int32(i+1)] = sp
+	}
+
+	sp := newEvictionTestPeer(s, "12.3.0.1:18333", false)
+	if !s.handleAddPeerMsg(state, sp) {
+		t.Fatal("new inbound peer was refused")
+	}
+	waitForDisconnect(t, idle)
+	if _, ok := state.inboundPeers[3]; ok {
+		t.Fatal("evicted peer was not removed")
+	}
+	if state.inboundPeers[1] != whitelisted || state.inboundPeers[2] != relayer {
+		t.Fatal("unexpected peer evicted")
+	}
+	if evictions := s.InboundEvictions(); evictions != 1 {
+		t.Fatalf("got %d evictions, want 1", evictions)
+	}
+
+	// No peer is evicted when all other peers are whitelisted.
+	state.inboundPeers = map[int32]*serverPeer{1: whitelisted}
+	cfg.MaxPeers = 1
+	sp = newEvictionTestPeer(s, "12.4.0.1:18333", false)
+	if s.handleAddPeerMsg(state, sp) {
+		t.Fatal("new inbound peer was accepted without a free slot")
+	}
+	if state.inboundPeers[1] != whitelisted {
+		t.Fatal("whitelisted peer was evicted")
+	}
+	if evictions := s.InboundEvictions(); evictions != 1 {
+		t.Fatalf("got %d evictions, want 1", evictions)
+	}
+}
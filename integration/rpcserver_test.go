@@ -10,13 +10,26 @@ package integration
 
 import (
 	"bytes"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"os"
+	"reflect"
 	"runtime/debug"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/btcjson"
 	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/provautil"
 	"github.com/bitgo/prova/rpctest"
+	"github.com/bitgo/prova/txscript"
+	"github.com/bitgo/prova/wire"
 )
 
 func testGetBestBlock(r *rpctest.Harness, t *testing.T) {
@@ -95,10 +108,608 @@ func testGetBlockHash(r *rpctest.Harness, t *testing.T) {
 	}
 }
 
+// getBlockTemplate acts as a miner requesting a block template or submitting
+// a block proposal via the getblocktemplate RPC, and unmarshals the raw reply
+// into result.
+func getBlockTemplate(r *rpctest.Harness, request *btcjson.TemplateRequest,
+	result interface{}) error {
+
+	param, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	reply, err := r.Node.RawRequest("getblocktemplate",
+		[]json.RawMessage{param})
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(reply, result)
+}
+
+func testGetBlockTemplateLongPoll(r *rpctest.Harness, t *testing.T) {
+	request := &btcjson.TemplateRequest{
+		Capabilities: []string{"longpoll", "coinbasevalue"},
+	}
+	var template btcjson.GetBlockTemplateResult
+	if err := getBlockTemplate(r, request, &template); err != nil {
+		t.Fatalf("Call to `getblocktemplate` failed: %v", err)
+	}
+	if template.LongPollID == "" {
+		t.Fatalf("Block template does not include a long poll ID")
+	}
+	capabilities := make(map[string]bool)
+	for _, capability := range template.Capabilities {
+		capabilities[capability] = true
+	}
+	if !capabilities["longpoll"] || !capabilities["proposal"] {
+		t.Fatalf("Block template capabilities %v do not include "+
+			"longpoll and proposal", template.Capabilities)
+	}
+
+	// Long poll for the template in the background the way a miner does
+	// while it works on the current template.
+	type longPollReply struct {
+		template btcjson.GetBlockTemplateResult
+		err      error
+	}
+	replies := make(chan longPollReply, 1)
+	go func() {
+		var reply longPollReply
+		request := &btcjson.TemplateRequest{
+			Capabilities: []string{"longpoll", "coinbasevalue"},
+			LongPollID:   template.LongPollID,
+		}
+		reply.err = getBlockTemplate(r, request, &reply.template)
+		replies <- reply
+	}()
+
+	// The long poll must not return while the template is current.
+	select {
+	case reply := <-replies:
+		t.Fatalf("Long poll returned for a current template: %v",
+			reply.err)
+	case <-time.After(time.Second * 2):
+	}
+
+	// Connecting a new block makes the template stale, so the long poll
+	// must return a template which builds on the new block and tells the
+	// miner to stop working on the old one.
+	generatedBlockHashes, err := r.Node.Generate(1)
+	if err != nil {
+		t.Fatalf("Unable to generate block: %v", err)
+	}
+	var reply longPollReply
+	select {
+	case reply = <-replies:
+	case <-time.After(time.Second * 30):
+		t.Fatalf("Long poll did not return after a new block")
+	}
+	if reply.err != nil {
+		t.Fatalf("Long poll `getblocktemplate` failed: %v", reply.err)
+	}
+	newTemplate := reply.template
+	if newTemplate.PreviousHash != generatedBlockHashes[0].String() {
+		t.Fatalf("Long poll template builds on %v, wanted %v",
+			newTemplate.PreviousHash, generatedBlockHashes[0])
+	}
+	if newTemplate.SubmitOld == nil || *newTemplate.SubmitOld {
+		t.Fatalf("Long poll template allows submitting work on the " +
+			"stale template")
+	}
+	if newTemplate.LongPollID == template.LongPollID {
+		t.Fatalf("Long poll template reuses the stale long poll ID %v",
+			template.LongPollID)
+	}
+}
+
+// getBestBlock returns the tip of the main chain of the node as a prova block,
+// along with its serialization.
+func getBestBlock(r *rpctest.Harness) (*wire.MsgBlock, string, error) {
+	bestHash, _, err := r.Node.GetBestBlock()
+	if err != nil {
+		return nil, "", err
+	}
+	msgBlock, err := r.Node.GetBlock(bestHash)
+	if err != nil {
+		return nil, "", err
+	}
+	var buf bytes.Buffer
+	if err := msgBlock.Serialize(&buf); err != nil {
+		return nil, "", err
+	}
+	return msgBlock, hex.EncodeToString(buf.Bytes()), nil
+}
+
+func testGetBlockTemplateProposal(r *rpctest.Harness, t *testing.T) {
+	// Propose the current tip of the chain, which does not build on the
+	// tip itself and thus must be rejected.
+	_, blockHex, err := getBestBlock(r)
+	if err != nil {
+		t.Fatalf("Unable to get best block: %v", err)
+	}
+
+	request := &btcjson.TemplateRequest{
+		Mode: "proposal",
+		Data: blockHex,
+	}
+	var reason *string
+	if err := getBlockTemplate(r, request, &reason); err != nil {
+		t.Fatalf("Call to `getblocktemplate` failed: %v", err)
+	}
+	if reason == nil || *reason != "bad-prevblk" {
+		t.Fatalf("Unexpected proposal reply %v, wanted bad-prevblk",
+			reason)
+	}
+
+	// Proposals which are not a serialized block are not processed at all.
+	request.Data = "00"
+	if err := getBlockTemplate(r, request, &reason); err == nil {
+		t.Fatalf("Proposal of an invalid block was not rejected")
+	}
+}
+
+// submitBlock submits the passed block via the submitblock RPC and returns the
+// reason the block was not accepted to the main chain, if any.
+func submitBlock(r *rpctest.Harness, msgBlock *wire.MsgBlock) (*string, error) {
+	var buf bytes.Buffer
+	if err := msgBlock.Serialize(&buf); err != nil {
+		return nil, err
+	}
+	hexParam, err := json.Marshal(hex.EncodeToString(buf.Bytes()))
+	if err != nil {
+		return nil, err
+	}
+	reply, err := r.Node.RawRequest("submitblock",
+		[]json.RawMessage{hexParam})
+	if err != nil {
+		return nil, err
+	}
+	var reason *string
+	if err := json.Unmarshal(reply, &reason); err != nil {
+		return nil, err
+	}
+	return reason, nil
+}
+
+// solveHeader finds a nonce for the passed header which satisfies its target
+// difficulty.  This is quick for the regression test network since its proof
+// of work limit accepts about one in sixteen block hashes.
+func solveHeader(header *wire.BlockHeader) {
+	target := blockchain.CompactToBig(header.Bits)
+	for header.Nonce = 0; ; header.Nonce++ {
+		hash := header.BlockHash()
+		if blockchain.HashToBig(&hash).Cmp(target) <= 0 {
+			return
+		}
+	}
+}
+
+func testSubmitBlock(r *rpctest.Harness, t *testing.T) {
+	bestBlock, _, err := getBestBlock(r)
+	if err != nil {
+		t.Fatalf("Unable to get best block: %v", err)
+	}
+	bestHash := bestBlock.BlockHash()
+	chainInfo, err := r.Node.GetBlockChainInfo()
+	if err != nil {
+		t.Fatalf("Unable to get chain info: %v", err)
+	}
+	nextBits, err := strconv.ParseUint(chainInfo.Window.NextBits, 16, 32)
+	if err != nil {
+		t.Fatalf("Invalid next bits %q: %v", chainInfo.Window.NextBits,
+			err)
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(header *wire.BlockHeader)
+		want   string
+	}{
+		{
+			// The tip of the chain is already known.
+			name:   "duplicate",
+			mutate: func(header *wire.BlockHeader) {},
+			want:   "duplicate",
+		},
+		{
+			// A block whose parent is unknown is accepted as an
+			// orphan, so it is not part of the main chain.
+			name: "orphan",
+			mutate: func(header *wire.BlockHeader) {
+				header.PrevBlock = chainhash.Hash{0x01}
+				solveHeader(header)
+			},
+			want: "inconclusive",
+		},
+		{
+			// A block whose hash exceeds its target difficulty.
+			name: "bad proof of work",
+			mutate: func(header *wire.BlockHeader) {
+				header.Bits = 0x03000001
+			},
+			want: "high-hash",
+		},
+		{
+			// A block extending the tip which is not signed by its
+			// validating key.
+			name: "bad validator signature",
+			mutate: func(header *wire.BlockHeader) {
+				header.PrevBlock = bestHash
+				header.Height++
+				header.Bits = uint32(nextBits)
+				header.Timestamp = header.Timestamp.Add(time.Second)
+				solveHeader(header)
+			},
+			want: "bad-block-signature",
+		},
+	}
+
+	for _, test := range tests {
+		msgBlock := *bestBlock
+		test.mutate(&msgBlock.Header)
+		reason, err := submitBlock(r, &msgBlock)
+		if err != nil {
+			t.Fatalf("%s: call to `submitblock` failed: %v",
+				test.name, err)
+		}
+		if reason == nil || *reason != test.want {
+			t.Fatalf("%s: unexpected `submitblock` reply %v, "+
+				"wanted %v", test.name, reason, test.want)
+		}
+	}
+
+	// Resubmitting the orphan must report it as a known block which is not
+	// part of the main chain.
+	orphanBlock := *bestBlock
+	orphanBlock.Header.PrevBlock = chainhash.Hash{0x01}
+	solveHeader(&orphanBlock.Header)
+	reason, err := submitBlock(r, &orphanBlock)
+	if err != nil {
+		t.Fatalf("Call to `submitblock` failed: %v", err)
+	}
+	if reason == nil || *reason != "duplicate-inconclusive" {
+		t.Fatalf("Unexpected `submitblock` reply %v for a known "+
+			"orphan, wanted duplicate-inconclusive", reason)
+	}
+}
+
+func testGetValidatorInfo(r *rpctest.Harness, t *testing.T) {
+	if _, err := r.Node.Generate(1); err != nil {
+		t.Fatalf("Unable to generate block: %v", err)
+	}
+	bestBlock, _, err := getBestBlock(r)
+	if err != nil {
+		t.Fatalf("Unable to fetch best block: %v", err)
+	}
+
+	info, err := r.Node.GetValidatorInfo()
+	if err != nil {
+		t.Fatalf("Call to `getvalidatorinfo` failed: %v", err)
+	}
+
+	header := &bestBlock.Header
+	if info.Hash != header.BlockHash().String() ||
+		info.Height != header.Height {
+		t.Fatalf("Validator info is for block %v (height %d), wanted "+
+			"best block %v (height %d)", info.Hash, info.Height,
+			header.BlockHash(), header.Height)
+	}
+	if info.WindowSize != r.ActiveNet.PowAveragingWindow ||
+		info.MaxBlocks != r.ActiveNet.ChainWindowMaxBlocks {
+		t.Fatalf("Unexpected window size %d and max blocks %d",
+			info.WindowSize, info.MaxBlocks)
+	}
+
+	// Every block of the window is signed by an active key, no key
+	// exceeds its share where the network limits it, and the signer of the best block reports it as
+	// its most recent one.
+	windowBlocks := 0
+	canSign := false
+	bestSignerFound := false
+	for _, validator := range info.Validators {
+		windowBlocks += validator.WindowBlocks
+		canSign = canSign || validator.CanSign
+		if (info.MaxBlocks > 0 &&
+			validator.WindowBlocks > info.MaxBlocks) ||
+			validator.TrailingBlocks > validator.WindowBlocks ||
+			len(validator.RecentHeights) != validator.WindowBlocks {
+			t.Fatalf("Inconsistent validator info %+v", validator)
+		}
+		if validator.PubKey == header.ValidatingPubKey.String() {
+			bestSignerFound = true
+			if validator.RecentHeights[0] != header.Height {
+				t.Fatalf("Signer of the best block reports height "+
+					"%d, wanted %d", validator.RecentHeights[0],
+					header.Height)
+			}
+		}
+	}
+	if windowBlocks != info.WindowSize {
+		t.Fatalf("Active keys signed %d blocks of the window, wanted %d",
+			windowBlocks, info.WindowSize)
+	}
+	if !bestSignerFound {
+		t.Fatalf("Signer %v of the best block is not an active key",
+			header.ValidatingPubKey)
+	}
+	if !canSign {
+		t.Fatalf("No active key may sign the next block")
+	}
+
+	// A lookback covering the whole chain is served from the sig key id
+	// index and includes the blocks of the averaging window.
+	lookback, err := json.Marshal(header.Height + 1)
+	if err != nil {
+		t.Fatalf("Unable to marshal lookback: %v", err)
+	}
+	reply, err := r.Node.RawRequest("getvalidatorinfo",
+		[]json.RawMessage{lookback})
+	if err != nil {
+		t.Fatalf("Call to `getvalidatorinfo` failed: %v", err)
+	}
+	var lookbackInfo btcjson.GetValidatorInfoResult
+	if err := json.Unmarshal(reply, &lookbackInfo); err != nil {
+		t.Fatalf("Unable to unmarshal `getvalidatorinfo` reply: %v", err)
+	}
+	if lookbackInfo.Lookback != int(header.Height+1) {
+		t.Fatalf("Unexpected lookback %d, wanted %d",
+			lookbackInfo.Lookback, header.Height+1)
+	}
+	for i, validator := range lookbackInfo.Validators {
+		recent := info.Validators[i].RecentHeights
+		if len(recent) == 0 {
+			continue
+		}
+		if len(validator.LookbackHeights) < len(recent) ||
+			!reflect.DeepEqual(validator.LookbackHeights[:len(recent)],
+				recent) {
+			t.Fatalf("Lookback heights %v of %v do not start with "+
+				"the window heights %v", validator.LookbackHeights,
+				validator.PubKey, recent)
+		}
+	}
+}
+
+// isRPCError returns whether the passed error returned by the RPC client is a
+// JSON-RPC error with the passed code.
+func isRPCError(err error, code btcjson.RPCErrorCode) bool {
+	return err != nil && strings.HasPrefix(err.Error(),
+		fmt.Sprintf("%d:", code))
+}
+
+func testGenerateToAddress(r *rpctest.Harness, t *testing.T) {
+	addr, err := r.NewAddress()
+	if err != nil {
+		t.Fatalf("Unable to create address: %v", err)
+	}
+	addrScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		t.Fatalf("Unable to create pkscript to address: %v", err)
+	}
+
+	// The block subsidy of the regression test network is zero, so add a
+	// transaction paying a fee to the memory pool for the first coinbase
+	// to have a value.
+	output := wire.NewTxOut(5e6, addrScript)
+	if _, err := r.SendOutputs([]*wire.TxOut{output}, 10); err != nil {
+		t.Fatalf("Unable to send transaction: %v", err)
+	}
+
+	numBlocksParam, err := json.Marshal(2)
+	if err != nil {
+		t.Fatalf("Unable to marshal params: %v", err)
+	}
+	addrParam, err := json.Marshal(addr.EncodeAddress())
+	if err != nil {
+		t.Fatalf("Unable to marshal params: %v", err)
+	}
+	reply, err := r.Node.RawRequest("generatetoaddress",
+		[]json.RawMessage{numBlocksParam, addrParam})
+	if err != nil {
+		t.Fatalf("Call to `generatetoaddress` failed: %v", err)
+	}
+	var blockHashes []string
+	if err := json.Unmarshal(reply, &blockHashes); err != nil {
+		t.Fatalf("Unable to unmarshal `generatetoaddress` reply: %v",
+			err)
+	}
+	if len(blockHashes) != 2 {
+		t.Fatalf("Generated %d blocks, wanted 2", len(blockHashes))
+	}
+
+	// The coinbase of every generated block must pay the address, except
+	// for coinbases without value which are provably unspendable.
+	for i, hashStr := range blockHashes {
+		hash, err := chainhash.NewHashFromStr(hashStr)
+		if err != nil {
+			t.Fatalf("Invalid block hash %q: %v", hashStr, err)
+		}
+		block, err := r.Node.GetBlock(hash)
+		if err != nil {
+			t.Fatalf("Unable to fetch block %v: %v", hash, err)
+		}
+		coinbaseOut := block.Transactions[0].TxOut[0]
+		if i > 0 && coinbaseOut.Value == 0 {
+			continue
+		}
+		pkScript := coinbaseOut.PkScript
+		if !bytes.Equal(pkScript, addrScript) {
+			t.Fatalf("Coinbase of block %v pays script %x, wanted "+
+				"%x", hash, pkScript, addrScript)
+		}
+	}
+
+	// Addresses of other networks must be rejected.
+	mainAddr, err := provautil.NewAddressProva(addr.ScriptAddress(),
+		[]btcec.KeyID{1, 2}, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("Unable to create mainnet address: %v", err)
+	}
+	addrParam, err = json.Marshal(mainAddr.EncodeAddress())
+	if err != nil {
+		t.Fatalf("Unable to marshal params: %v", err)
+	}
+	_, err = r.Node.RawRequest("generatetoaddress",
+		[]json.RawMessage{numBlocksParam, addrParam})
+	if !isRPCError(err, btcjson.ErrRPCInvalidAddressOrKey) {
+		t.Fatalf("Unexpected `generatetoaddress` error for a mainnet "+
+			"address: %v", err)
+	}
+}
+
+func testGenerateBlock(r *rpctest.Harness, t *testing.T) {
+	addr, err := r.NewAddress()
+	if err != nil {
+		t.Fatalf("Unable to create address: %v", err)
+	}
+	addrScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		t.Fatalf("Unable to create pkscript to address: %v", err)
+	}
+
+	// Add two unrelated transactions to the memory pool, only the second
+	// of which is mined.
+	var txHashes []*chainhash.Hash
+	for i := 0; i < 2; i++ {
+		output := wire.NewTxOut(5e6, addrScript)
+		txHash, err := r.SendOutputs([]*wire.TxOut{output}, 10)
+		if err != nil {
+			t.Fatalf("Unable to send transaction: %v", err)
+		}
+		txHashes = append(txHashes, txHash)
+	}
+
+	addrParam, err := json.Marshal(addr.EncodeAddress())
+	if err != nil {
+		t.Fatalf("Unable to marshal params: %v", err)
+	}
+	txidsParam, err := json.Marshal([]string{txHashes[1].String()})
+	if err != nil {
+		t.Fatalf("Unable to marshal params: %v", err)
+	}
+	reply, err := r.Node.RawRequest("generateblock",
+		[]json.RawMessage{addrParam, txidsParam})
+	if err != nil {
+		t.Fatalf("Call to `generateblock` failed: %v", err)
+	}
+	var result btcjson.GenerateBlockResult
+	if err := json.Unmarshal(reply, &result); err != nil {
+		t.Fatalf("Unable to unmarshal `generateblock` reply: %v", err)
+	}
+
+	hash, err := chainhash.NewHashFromStr(result.Hash)
+	if err != nil {
+		t.Fatalf("Invalid block hash %q: %v", result.Hash, err)
+	}
+	block, err := r.Node.GetBlock(hash)
+	if err != nil {
+		t.Fatalf("Unable to fetch block %v: %v", hash, err)
+	}
+	if len(block.Transactions) != 2 {
+		t.Fatalf("Generated block has %d transactions, wanted 2",
+			len(block.Transactions))
+	}
+	if !bytes.Equal(block.Transactions[0].TxOut[0].PkScript, addrScript) {
+		t.Fatalf("Coinbase of block %v does not pay %v", hash, addr)
+	}
+	if block.Transactions[1].TxHash() != *txHashes[1] {
+		t.Fatalf("Generated block contains transaction %v, wanted %v",
+			block.Transactions[1].TxHash(), txHashes[1])
+	}
+
+	// Transactions which are no longer in the memory pool must be
+	// rejected.
+	_, err = r.Node.RawRequest("generateblock",
+		[]json.RawMessage{addrParam, txidsParam})
+	if !isRPCError(err, btcjson.ErrRPCNoTxInfo) {
+		t.Fatalf("Unexpected `generateblock` error for a mined "+
+			"transaction: %v", err)
+	}
+
+	// Mine the remaining transaction so later tests start with an empty
+	// memory pool.
+	if _, err := r.Node.Generate(1); err != nil {
+		t.Fatalf("Unable to generate block: %v", err)
+	}
+}
+
+// testAdminNotificationRegistration ensures the websocket commands which
+// register for validator set and admin thread notifications are accepted.
+// The harness does not hold the provision keys needed to drive provisioning
+// transactions, so the notification payloads are covered by the unit tests of
+// the notification manager.
+func testAdminNotificationRegistration(r *rpctest.Harness, t *testing.T) {
+	methods := []string{"notifyvalidatorset", "notifyadminthreads",
+		"stopnotifyvalidatorset", "stopnotifyadminthreads"}
+	for _, method := range methods {
+		if _, err := r.Node.WebsocketRequest(method, nil); err != nil {
+			t.Fatalf("Call to `%s` failed: %v", method, err)
+		}
+	}
+}
+
+// testTxOutProof ensures a proof created for the coinbase of the best block
+// verifies and yields the coinbase, and that no proof is created for a
+// transaction which is not in the block.
+func testTxOutProof(r *rpctest.Harness, t *testing.T) {
+	msgBlock, _, err := getBestBlock(r)
+	if err != nil {
+		t.Fatalf("Unable to fetch best block: %v", err)
+	}
+	blockHash := msgBlock.BlockHash().String()
+	coinbaseID := msgBlock.Transactions[0].TxHash().String()
+
+	txIDsParam, err := json.Marshal([]string{coinbaseID})
+	if err != nil {
+		t.Fatalf("Unable to marshal txids: %v", err)
+	}
+	blockHashParam, err := json.Marshal(blockHash)
+	if err != nil {
+		t.Fatalf("Unable to marshal block hash: %v", err)
+	}
+	reply, err := r.Node.RawRequest("gettxoutproof",
+		[]json.RawMessage{txIDsParam, blockHashParam})
+	if err != nil {
+		t.Fatalf("Call to `gettxoutproof` failed: %v", err)
+	}
+
+	reply, err = r.Node.RawRequest("verifytxoutproof",
+		[]json.RawMessage{reply})
+	if err != nil {
+		t.Fatalf("Call to `verifytxoutproof` failed: %v", err)
+	}
+	var txIDs []string
+	if err := json.Unmarshal(reply, &txIDs); err != nil {
+		t.Fatalf("Unable to unmarshal proven txids: %v", err)
+	}
+	if len(txIDs) != 1 || txIDs[0] != coinbaseID {
+		t.Fatalf("Proof yields txids %v, want [%v]", txIDs, coinbaseID)
+	}
+
+	var missingHash chainhash.Hash
+	txIDsParam, err = json.Marshal([]string{missingHash.String()})
+	if err != nil {
+		t.Fatalf("Unable to marshal txids: %v", err)
+	}
+	_, err = r.Node.RawRequest("gettxoutproof",
+		[]json.RawMessage{txIDsParam, blockHashParam})
+	if !isRPCError(err, btcjson.ErrRPCInvalidAddressOrKey) {
+		t.Fatalf("Unexpected error for missing transaction: %v", err)
+	}
+}
+
 var rpcTestCases = []rpctest.HarnessTestCase{
 	testGetBestBlock,
 	testGetBlockCount,
 	testGetBlockHash,
+	testGetBlockTemplateLongPoll,
+	testGetBlockTemplateProposal,
+	testSubmitBlock,
+	testGetValidatorInfo,
+	testGenerateToAddress,
+	testGenerateBlock,
+	testAdminNotificationRegistration,
+	testTxOutProof,
 }
 
 var primaryHarness *rpctest.Harness
@@ -109,15 +720,15 @@ func TestMain(m *testing.M) {
 	// In order to properly test scenarios on as if we were on mainnet,
 	// ensure that non-standard transactions aren't accepted into the
 	// mempool or relayed.
-	btcdCfg := []string{"--rejectnonstd"}
-	primaryHarness, err = rpctest.New(&chaincfg.SimNetParams, nil, btcdCfg)
+	primaryHarness, err = rpctest.NewHarness(&chaincfg.RegressionNetParams,
+		rpctest.WithExtraArgs("--rejectnonstd"))
 	if err != nil {
 		fmt.Println("unable to create primary harness: ", err)
 		os.Exit(1)
 	}
 
-	// Initialize the primary mining node with a chain of length 125,
-	// providing 25 mature coinbases to allow spending from for testing
+	// Initialize the primary mining node with a chain of length 101, whose
+	// last block issues 25 outputs to allow spending from for testing
 	// purposes.
 	if err := primaryHarness.SetUp(true, 25); err != nil {
 		fmt.Println("unable to setup test chain: ", err)
@@ -149,7 +760,7 @@ func TestRpcServer(t *testing.T) {
 	defer func() {
 		// If one of the integration tests caused a panic within the main
 		// goroutine, then tear down all the harnesses in order to avoid
-		// any leaked btcd processes.
+		// any leaked prova processes.
 		if r := recover(); r != nil {
 			fmt.Println("recovering from test panic: ", r)
 			if err := rpctest.TearDownAll(); err != nil {
@@ -8,6 +8,7 @@ package main
 import (
 	"fmt"
 	"os"
+	"sync"
 
 	"github.com/bitgo/prova/addrmgr"
 	"github.com/bitgo/prova/blockchain"
@@ -191,6 +192,37 @@ func setLogLevels(logLevel string) {
 	}
 }
 
+// logLevelsMtx serializes changes to the subsystem logging levels so the
+// levels requested together, such as by a debuglevel RPC, are applied as a
+// whole.
+var logLevelsMtx sync.Mutex
+
+// setSubsystemLogLevels sets the logging levels in the passed map of subsystem
+// identifiers to levels together.  Invalid subsystems are ignored.
+func setSubsystemLogLevels(levels map[string]string) {
+	logLevelsMtx.Lock()
+	defer logLevelsMtx.Unlock()
+
+	for subsystemID, logLevel := range levels {
+		setLogLevel(subsystemID, logLevel)
+	}
+}
+
+// subsystemLogLevels returns the current logging level of each subsystem in
+// the form <subsystem>=<level>, sorted by subsystem.
+func subsystemLogLevels() []string {
+	logLevelsMtx.Lock()
+	defer logLevelsMtx.Unlock()
+
+	subsystems := supportedSubsystems()
+	levels := make([]string, 0, len(subsystems))
+	for _, subsystemID := range subsystems {
+		level := subsystemLoggers[subsystemID].Level()
+		levels = append(levels, subsystemID+"="+level.String())
+	}
+	return levels
+}
+
 // directionString is a helper function that returns a string that represents
 // the direction of a connection (inbound or outbound).
 func directionString(inbound bool) string {
@@ -0,0 +1,111 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/bitgo/prova/btcjson"
+	"github.com/btcsuite/btclog"
+)
+
+// TestHandleDebugLevel ensures the debuglevel handler changes the subsystem
+// log levels at runtime, which is reflected in subsequent log output, and that
+// level specs with any invalid part do not change any levels.
+func TestHandleDebugLevel(t *testing.T) {
+	var rpcsBuf, srvrBuf bytes.Buffer
+	rpcsLogger, err := btclog.NewLoggerFromWriter(&rpcsBuf, btclog.InfoLvl)
+	if err != nil {
+		t.Fatalf("NewLoggerFromWriter: unexpected error: %v", err)
+	}
+	srvrLogger, err := btclog.NewLoggerFromWriter(&srvrBuf, btclog.InfoLvl)
+	if err != nil {
+		t.Fatalf("NewLoggerFromWriter: unexpected error: %v", err)
+	}
+	origRPCS, origSRVR := rpcsLog, srvrLog
+	useLogger("RPCS", rpcsLogger)
+	useLogger("SRVR", srvrLogger)
+	defer func() {
+		useLogger("RPCS", origRPCS)
+		useLogger("SRVR", origSRVR)
+	}()
+
+	// Ensure trace messages are not emitted at the initial level.
+	rpcsLog.Tracef("before debuglevel")
+	if rpcsBuf.Len() != 0 {
+		t.Fatalf("unexpected trace output before changing the level: %q",
+			rpcsBuf.String())
+	}
+
+	// Flip the subsystem to trace and ensure trace messages are emitted.
+	cmd := btcjson.NewDebugLevelCmd("RPCS=trace")
+	result, err := handleDebugLevel(nil, cmd, nil)
+	if err != nil {
+		t.Fatalf("handleDebugLevel: unexpected error: %v", err)
+	}
+	if result != "Done." {
+		t.Fatalf("handleDebugLevel: unexpected result %v", result)
+	}
+	rpcsLog.Tracef("after debuglevel")
+	if !strings.Contains(rpcsBuf.String(), "after debuglevel") {
+		t.Fatalf("trace message was not emitted after changing the "+
+			"level - got %q", rpcsBuf.String())
+	}
+
+	// Ensure level specs with an invalid part are rejected without
+	// changing any levels.
+	tests := []struct {
+		name      string
+		levelSpec string
+	}{
+		{
+			name:      "invalid subsystem",
+			levelSpec: "SRVR=debug,BOGUS=trace,RPCS=info",
+		},
+		{
+			name:      "invalid level",
+			levelSpec: "SRVR=debug,RPCS=bogus",
+		},
+		{
+			name:      "missing level",
+			levelSpec: "SRVR=debug,RPCS",
+		},
+		{
+			name:      "invalid global level",
+			levelSpec: "bogus",
+		},
+	}
+	for _, test := range tests {
+		cmd := btcjson.NewDebugLevelCmd(test.levelSpec)
+		_, err := handleDebugLevel(nil, cmd, nil)
+		rpcErr, ok := err.(*btcjson.RPCError)
+		if !ok || rpcErr.Code != btcjson.ErrRPCInvalidParams.Code {
+			t.Fatalf("%s: unexpected error - got %v, want invalid "+
+				"params", test.name, err)
+		}
+		if rpcsLog.Level() != btclog.TraceLvl {
+			t.Fatalf("%s: RPCS level changed to %v", test.name,
+				rpcsLog.Level())
+		}
+		if srvrLog.Level() != btclog.InfoLvl {
+			t.Fatalf("%s: SRVR level changed to %v", test.name,
+				srvrLog.Level())
+		}
+	}
+
+	// Ensure show lists the current levels.
+	result, err = handleDebugLevel(nil, btcjson.NewDebugLevelCmd("show"), nil)
+	if err != nil {
+		t.Fatalf("handleDebugLevel: unexpected error: %v", err)
+	}
+	for _, want := range []string{"RPCS=trace", "SRVR=info"} {
+		if !strings.Contains(result.(string), want) {
+			t.Fatalf("show result %q does not contain %q", result,
+				want)
+		}
+	}
+}
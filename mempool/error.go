@@ -110,6 +110,16 @@ func extractRejectCode(err error) (wire.RejectCode, bool) {
 	return wire.RejectInvalid, false
 }
 
+// isChainDoubleSpend returns whether the passed error was returned for a
+// transaction which spends an output the main chain already spent.
+func isChainDoubleSpend(err error) bool {
+	if rerr, ok := err.(RuleError); ok {
+		err = rerr.Err
+	}
+	cerr, ok := err.(blockchain.RuleError)
+	return ok && cerr.ErrorCode == blockchain.ErrDoubleSpend
+}
+
 // ErrToRejectErr examines the underlying type of the error and returns a reject
 // code and string appropriate to be sent in a wire.MsgReject message.
 func ErrToRejectErr(err error) (wire.RejectCode, string) {
@@ -0,0 +1,283 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/provautil"
+)
+
+const (
+	// MaxEstimateFeeTarget is the maximum number of blocks to confirm a
+	// fee rate can be estimated for.  Transactions which take longer to be
+	// confirmed are accounted for as if they took this many blocks.
+	MaxEstimateFeeTarget = 25
+
+	// DefaultEstimateFeeMaxRollback is the default number of most recently
+	// registered blocks which can be rolled back from the fee estimator
+	// when they are disconnected from the main chain.
+	DefaultEstimateFeeMaxRollback = 2
+
+	// DefaultEstimateFeeMinRegisteredBlocks is the default number of blocks
+	// which must have been registered with the fee estimator before it
+	// returns any estimates.
+	DefaultEstimateFeeMinRegisteredBlocks = 3
+
+	// estimateFeeBinSize is the number of confirmed transactions retained
+	// for each number of blocks to confirm.  Older transactions are
+	// discarded first.
+	estimateFeeBinSize = 100
+
+	// estimateFeeMinSamples is the minimum number of confirmed transactions
+	// paying at least a fee rate which are needed before that fee rate is
+	// returned as an estimate.
+	estimateFeeMinSamples = 10
+
+	// economicalSuccessRate and conservativeSuccessRate are the fractions
+	// of the confirmed transactions paying at least the estimated fee rate
+	// which must have been confirmed within the target.
+	economicalSuccessRate   = 0.6
+	conservativeSuccessRate = 0.95
+)
+
+// ErrInsufficientFeeData is returned by EstimateFee when not enough blocks or
+// transactions have been observed to estimate the requested fee rate.
+var ErrInsufficientFeeData = errors.New("insufficient data to estimate the " +
+	"fee rate")
+
+// observedTransaction tracks a transaction from the point it is accepted to
+// the memory pool until it is confirmed.
+type observedTransaction struct {
+	hash     chainhash.Hash
+	feeRate  provautil.Amount // atoms per kB
+	observed uint32           // best height when the tx was accepted
+	mined    uint32           // height of the confirming block, if any
+}
+
+// confirmBin returns the index of the bin the transaction is accounted in,
+// which is the number of blocks it took to be confirmed less one.
+func (o *observedTransaction) confirmBin() int {
+	if o.mined <= o.observed+1 {
+		return 0
+	}
+	bin := int(o.mined - o.observed - 1)
+	if bin >= MaxEstimateFeeTarget {
+		bin = MaxEstimateFeeTarget - 1
+	}
+	return bin
+}
+
+// registeredBlock records the observed transactions confirmed by a block so
+// they can be restored when the block is rolled back.
+type registeredBlock struct {
+	hash         chainhash.Hash
+	transactions []*observedTransaction
+}
+
+// FeeEstimator estimates the fee rate transactions must pay to be confirmed
+// within a number of blocks.  It observes the fee rates of the transactions
+// accepted to the memory pool and records how many blocks each of them took to
+// be confirmed once the blocks confirming them are registered.
+type FeeEstimator struct {
+	mtx sync.RWMutex
+
+	maxRollback         uint32
+	minRegisteredBlocks uint32
+	numBlocksRegistered uint32
+	lastKnownHeight     uint32
+
+	observed map[chainhash.Hash]*observedTransaction
+	bin      [MaxEstimateFeeTarget][]*observedTransaction
+	dropped  []*registeredBlock
+}
+
+// NewFeeEstimator returns a fee estimator which allows the passed number of
+// most recently registered blocks to be rolled back and which does not return
+// estimates before the passed number of blocks have been registered.
+func NewFeeEstimator(maxRollback, minRegisteredBlocks uint32) *FeeEstimator {
+	return &FeeEstimator{
+		maxRollback:         maxRollback,
+		minRegisteredBlocks: minRegisteredBlocks,
+		observed:            make(map[chainhash.Hash]*observedTransaction),
+	}
+}
+
+// ObserveTransaction starts tracking the passed transaction which was just
+// accepted to the memory pool.
+//
+// This function is safe for concurrent access.
+func (ef *FeeEstimator) ObserveTransaction(t *TxDesc) {
+	ef.mtx.Lock()
+	defer ef.mtx.Unlock()
+
+	hash := *t.Tx.Hash()
+	if _, ok := ef.observed[hash]; ok {
+		return
+	}
+	ef.observed[hash] = &observedTransaction{
+		hash:     hash,
+		feeRate:  provautil.Amount(t.FeePerKB),
+		observed: t.Height,
+	}
+}
+
+// RegisterBlock records the number of blocks the observed transactions which
+// are confirmed by the passed block took to be confirmed.
+//
+// This function is safe for concurrent access.
+func (ef *FeeEstimator) RegisterBlock(block *provautil.Block) {
+	ef.mtx.Lock()
+	defer ef.mtx.Unlock()
+
+	height := block.Height()
+	registered := &registeredBlock{hash: *block.Hash()}
+	for _, tx := range block.Transactions() {
+		o, ok := ef.observed[*tx.Hash()]
+		if !ok {
+			continue
+		}
+		delete(ef.observed, o.hash)
+		o.mined = height
+
+		bin := o.confirmBin()
+		ef.bin[bin] = append(ef.bin[bin], o)
+		if len(ef.bin[bin]) > estimateFeeBinSize {
+			ef.bin[bin] = ef.bin[bin][1:]
+		}
+		registered.transactions = append(registered.transactions, o)
+	}
+
+	// Stop tracking transactions which stayed unconfirmed for longer than
+	// any target, since they were most likely evicted or double spent.
+	for hash, o := range ef.observed {
+		if o.observed+MaxEstimateFeeTarget < height {
+			delete(ef.observed, hash)
+		}
+	}
+
+	ef.numBlocksRegistered++
+	ef.lastKnownHeight = height
+	if ef.maxRollback == 0 {
+		return
+	}
+	if uint32(len(ef.dropped)) == ef.maxRollback {
+		ef.dropped = ef.dropped[1:]
+	}
+	ef.dropped = append(ef.dropped, registered)
+}
+
+// Rollback unregisters the passed block, which must be the most recently
+// registered one, and resumes tracking the transactions it confirmed as
+// unconfirmed.  It is used when the block is disconnected from the main chain.
+//
+// This function is safe for concurrent access.
+func (ef *FeeEstimator) Rollback(hash *chainhash.Hash) error {
+	ef.mtx.Lock()
+	defer ef.mtx.Unlock()
+
+	n := len(ef.dropped)
+	if n == 0 || ef.dropped[n-1].hash != *hash {
+		return fmt.Errorf("block %v is not among the %d most recently "+
+			"registered blocks", hash, ef.maxRollback)
+	}
+	registered := ef.dropped[n-1]
+	ef.dropped = ef.dropped[:n-1]
+
+	for _, o := range registered.transactions {
+		bin := o.confirmBin()
+		for i, binTx := range ef.bin[bin] {
+			if binTx == o {
+				ef.bin[bin] = append(ef.bin[bin][:i:i],
+					ef.bin[bin][i+1:]...)
+				break
+			}
+		}
+		o.mined = 0
+		ef.observed[o.hash] = o
+	}
+
+	ef.numBlocksRegistered--
+	ef.lastKnownHeight--
+	return nil
+}
+
+// EstimateFee returns the lowest fee rate in atoms per kB at which enough of
+// the recently confirmed transactions paying at least that rate were confirmed
+// within the passed number of blocks.  The conservative flag raises the share
+// of those transactions which must have been confirmed in time.  The number of
+// blocks spanned by the transactions the estimate is based on is returned as
+// well.  ErrInsufficientFeeData is returned when not enough data has been
+// observed.
+//
+// This function is safe for concurrent access.
+func (ef *FeeEstimator) EstimateFee(numBlocks uint32, conservative bool) (provautil.Amount, uint32, error) {
+	if numBlocks == 0 || numBlocks > MaxEstimateFeeTarget {
+		return 0, 0, fmt.Errorf("confirmation target %d is out of "+
+			"range [1, %d]", numBlocks, MaxEstimateFeeTarget)
+	}
+
+	ef.mtx.RLock()
+	defer ef.mtx.RUnlock()
+
+	if ef.numBlocksRegistered < ef.minRegisteredBlocks {
+		return 0, 0, ErrInsufficientFeeData
+	}
+
+	var confirmed []*observedTransaction
+	for _, bin := range ef.bin {
+		confirmed = append(confirmed, bin...)
+	}
+	sort.Slice(confirmed, func(i, j int) bool {
+		return confirmed[i].feeRate > confirmed[j].feeRate
+	})
+
+	successRate := economicalSuccessRate
+	if conservative {
+		successRate = conservativeSuccessRate
+	}
+
+	// Walk the confirmed transactions from the highest fee rate down and
+	// keep lowering the estimate for as long as enough of the transactions
+	// paying at least the current fee rate were confirmed within the
+	// target.
+	var total, inTarget int
+	var feeRate provautil.Amount
+	var walkedOldest, oldestMined uint32
+	found := false
+	for i, o := range confirmed {
+		total++
+		if o.confirmBin() < int(numBlocks) {
+			inTarget++
+		}
+		if walkedOldest == 0 || o.mined < walkedOldest {
+			walkedOldest = o.mined
+		}
+
+		// Account for all transactions paying the same fee rate at
+		// once.
+		if i+1 < len(confirmed) && confirmed[i+1].feeRate == o.feeRate {
+			continue
+		}
+		if total < estimateFeeMinSamples {
+			continue
+		}
+		if float64(inTarget) < successRate*float64(total) {
+			break
+		}
+		feeRate = o.feeRate
+		oldestMined = walkedOldest
+		found = true
+	}
+	if !found {
+		return 0, 0, ErrInsufficientFeeData
+	}
+
+	return feeRate, ef.lastKnownHeight - oldestMined + 1, nil
+}
@@ -0,0 +1,230 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/bitgo/prova/mining"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/wire"
+)
+
+// replayFeeHistory registers a synthetic history of blocks at heights 1
+// through numBlocks with the passed fee estimator.  At every height three
+// transactions paying 10000, 5000 and 1000 atoms/kB are observed, which are
+// confirmed 1, 3 and 10 blocks later respectively.  The registered blocks are
+// returned.
+func replayFeeHistory(ef *FeeEstimator, numBlocks uint32) []*provautil.Block {
+	confirmDelays := map[uint32]int64{1: 10000, 3: 5000, 10: 1000}
+	pending := make(map[uint32][]*wire.MsgTx)
+	var blocks []*provautil.Block
+	var lockTime uint32
+	for height := uint32(1); height <= numBlocks; height++ {
+		msgBlock := wire.MsgBlock{Transactions: pending[height]}
+		block := provautil.NewBlock(&msgBlock)
+		block.SetHeight(height)
+		ef.RegisterBlock(block)
+		blocks = append(blocks, block)
+		delete(pending, height)
+
+		for delay, feePerKB := range confirmDelays {
+			lockTime++
+			msgTx := wire.NewMsgTx(wire.TxVersion)
+			msgTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{}, nil))
+			msgTx.LockTime = lockTime
+			ef.ObserveTransaction(&TxDesc{
+				TxDesc: mining.TxDesc{
+					Tx:       provautil.NewTx(msgTx),
+					Height:   height,
+					FeePerKB: feePerKB,
+				},
+			})
+			pending[height+delay] = append(pending[height+delay],
+				msgTx)
+		}
+	}
+	return blocks
+}
+
+// TestEstimateFee ensures the fee estimator returns the lowest fee rate which
+// enough transactions were confirmed within the target with for a replayed
+// history.
+func TestEstimateFee(t *testing.T) {
+	t.Parallel()
+
+	ef := NewFeeEstimator(DefaultEstimateFeeMaxRollback,
+		DefaultEstimateFeeMinRegisteredBlocks)
+
+	// No estimates are returned before enough blocks are registered.
+	replayFeeHistory(ef, DefaultEstimateFeeMinRegisteredBlocks-1)
+	if _, _, err := ef.EstimateFee(1, false); err != ErrInsufficientFeeData {
+		t.Fatalf("EstimateFee: unexpected error - got %v, want %v", err,
+			ErrInsufficientFeeData)
+	}
+
+	ef = NewFeeEstimator(DefaultEstimateFeeMaxRollback,
+		DefaultEstimateFeeMinRegisteredBlocks)
+	replayFeeHistory(ef, 30)
+
+	tests := []struct {
+		numBlocks    uint32
+		conservative bool
+		feeRate      provautil.Amount
+	}{
+		{numBlocks: 1, feeRate: 10000},
+		{numBlocks: 1, conservative: true, feeRate: 10000},
+		{numBlocks: 2, feeRate: 10000},
+		{numBlocks: 3, feeRate: 1000},
+		{numBlocks: 3, conservative: true, feeRate: 5000},
+		{numBlocks: 6, conservative: true, feeRate: 5000},
+		{numBlocks: 10, conservative: true, feeRate: 1000},
+		{numBlocks: MaxEstimateFeeTarget, feeRate: 1000},
+	}
+	for _, test := range tests {
+		feeRate, blocks, err := ef.EstimateFee(test.numBlocks,
+			test.conservative)
+		if err != nil {
+			t.Errorf("EstimateFee(%d, %v): unexpected error: %v",
+				test.numBlocks, test.conservative, err)
+			continue
+		}
+		if feeRate != test.feeRate {
+			t.Errorf("EstimateFee(%d, %v): got fee rate %v, want %v",
+				test.numBlocks, test.conservative, feeRate,
+				test.feeRate)
+		}
+
+		// The first transactions were confirmed at height 2.
+		if blocks != 29 {
+			t.Errorf("EstimateFee(%d, %v): got %d blocks, want 29",
+				test.numBlocks, test.conservative, blocks)
+		}
+	}
+
+	for _, numBlocks := range []uint32{0, MaxEstimateFeeTarget + 1} {
+		if _, _, err := ef.EstimateFee(numBlocks, false); err == nil {
+			t.Errorf("EstimateFee(%d): accepted target out of range",
+				numBlocks)
+		}
+	}
+}
+
+// TestEstimateFeeRollback ensures rolling back registered blocks restores the
+// transactions they confirmed as unconfirmed and is limited to the most
+// recently registered blocks.
+func TestEstimateFeeRollback(t *testing.T) {
+	t.Parallel()
+
+	ef := NewFeeEstimator(DefaultEstimateFeeMaxRollback,
+		DefaultEstimateFeeMinRegisteredBlocks)
+	blocks := replayFeeHistory(ef, 30)
+	numObserved := len(ef.observed)
+
+	// Only the most recently registered block can be rolled back.
+	if err := ef.Rollback(blocks[len(blocks)-2].Hash()); err == nil {
+		t.Fatal("Rollback: rolled back block which is not the most " +
+			"recently registered one")
+	}
+
+	last := blocks[len(blocks)-1]
+	if err := ef.Rollback(last.Hash()); err != nil {
+		t.Fatalf("Rollback: unexpected error: %v", err)
+	}
+	wantObserved := numObserved + len(last.Transactions())
+	if len(ef.observed) != wantObserved {
+		t.Fatalf("Rollback: got %d observed transactions, want %d",
+			len(ef.observed), wantObserved)
+	}
+	for _, tx := range last.Transactions() {
+		if _, ok := ef.observed[*tx.Hash()]; !ok {
+			t.Fatalf("Rollback: transaction %v not restored",
+				tx.Hash())
+		}
+	}
+	if ef.numBlocksRegistered != 29 || ef.lastKnownHeight != 29 {
+		t.Fatalf("Rollback: got %d registered blocks at height %d, "+
+			"want 29 at height 29", ef.numBlocksRegistered,
+			ef.lastKnownHeight)
+	}
+
+	// Registering the block again must produce the same estimates.
+	ef.RegisterBlock(last)
+	feeRate, _, err := ef.EstimateFee(3, true)
+	if err != nil || feeRate != 5000 {
+		t.Fatalf("EstimateFee: got %v (err %v) after registering the "+
+			"block again, want 5000", feeRate, err)
+	}
+}
+
+// TestEstimateFeeSaveRestore ensures a restored fee estimator returns the same
+// estimates as the saved one and can still roll back the blocks registered
+// before it was saved.
+func TestEstimateFeeSaveRestore(t *testing.T) {
+	t.Parallel()
+
+	ef := NewFeeEstimator(DefaultEstimateFeeMaxRollback,
+		DefaultEstimateFeeMinRegisteredBlocks)
+	blocks := replayFeeHistory(ef, 30)
+
+	var buf bytes.Buffer
+	if err := ef.Save(&buf); err != nil {
+		t.Fatalf("Save: unexpected error: %v", err)
+	}
+	saved := buf.Bytes()
+	restored, err := RestoreFeeEstimator(bytes.NewReader(saved))
+	if err != nil {
+		t.Fatalf("RestoreFeeEstimator: unexpected error: %v", err)
+	}
+	if restored.LastKnownHeight() != 30 ||
+		len(restored.observed) != len(ef.observed) {
+
+		t.Fatalf("RestoreFeeEstimator: got height %d with %d observed "+
+			"transactions, want 30 with %d",
+			restored.LastKnownHeight(), len(restored.observed),
+			len(ef.observed))
+	}
+	for numBlocks := uint32(1); numBlocks <= MaxEstimateFeeTarget; numBlocks++ {
+		for _, conservative := range []bool{false, true} {
+			wantFee, wantBlocks, wantErr := ef.EstimateFee(numBlocks,
+				conservative)
+			fee, blocks, err := restored.EstimateFee(numBlocks,
+				conservative)
+			if fee != wantFee || blocks != wantBlocks ||
+				err != wantErr {
+
+				t.Fatalf("EstimateFee(%d, %v): got %v, %d, %v, "+
+					"want %v, %d, %v", numBlocks,
+					conservative, fee, blocks, err, wantFee,
+					wantBlocks, wantErr)
+			}
+		}
+	}
+
+	// The confirmed transactions of the rolled back block must be removed
+	// from their bins, which requires them to be shared with the bins.
+	last := blocks[len(blocks)-1]
+	if err := ef.Rollback(last.Hash()); err != nil {
+		t.Fatalf("Rollback: unexpected error: %v", err)
+	}
+	if err := restored.Rollback(last.Hash()); err != nil {
+		t.Fatalf("Rollback: unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(restored.bin, ef.bin) ||
+		len(restored.observed) != len(ef.observed) {
+
+		t.Fatal("Rollback: restored estimator differs after rolling " +
+			"back")
+	}
+
+	for _, data := range [][]byte{saved[:len(saved)-1], {2, 0, 0, 0}} {
+		if _, err := RestoreFeeEstimator(bytes.NewReader(data)); err == nil {
+			t.Fatalf("RestoreFeeEstimator: accepted invalid data %x",
+				data)
+		}
+	}
+}
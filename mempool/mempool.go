@@ -6,6 +6,7 @@
 package mempool
 
 import (
+	"container/heap"
 	"container/list"
 	"fmt"
 	"math"
@@ -19,6 +20,7 @@ import (
 	"github.com/bitgo/prova/btcjson"
 	"github.com/bitgo/prova/chaincfg"
 	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/metrics"
 	"github.com/bitgo/prova/mining"
 	"github.com/bitgo/prova/provautil"
 	"github.com/bitgo/prova/txscript"
@@ -40,6 +42,16 @@ const (
 	// orphanExpireScanInterval is the minimum amount of time in between
 	// scans of the orphan pool to evict expired transactions.
 	orphanExpireScanInterval = time.Minute * 5
+
+	// minFeeRateIncrement is the fee rate in atoms/kB a transaction must
+	// pay on top of the fee rates of the transactions a full pool evicted
+	// in order to be accepted.
+	minFeeRateIncrement = 1000
+
+	// minFeeRateHalfLife is the time it takes the minimum fee rate a full
+	// pool raised after evicting transactions to decay by half.  It decays
+	// faster once the pool is no longer close to full.
+	minFeeRateHalfLife = time.Hour * 12
 )
 
 // Tag represents an identifier to use for tagging orphan transactions.  The
@@ -85,6 +97,21 @@ type Config struct {
 	// chain tip within the best chain.
 	MedianTimePast func() time.Time
 
+	// LockTimeEvalTime defines the function to use in order to access the
+	// time the time based lock times of transactions are evaluated against
+	// for inclusion in the next block.
+	LockTimeEvalTime func() time.Time
+
+	// TimeLockFlags defines the function to use in order to access the
+	// script flags of the time lock opcodes which are enforced for the
+	// next block and all blocks after it.
+	TimeLockFlags func() txscript.ScriptFlags
+
+	// VerificationFlags defines the function to use in order to access the
+	// script flags of the consensus deployments which are active for the
+	// next block.
+	VerificationFlags func() txscript.ScriptFlags
+
 	// CalcSequenceLock defines the function to use in order to generate
 	// the current sequence lock for the given transaction using the passed
 	// utxo view.
@@ -103,6 +130,15 @@ type Config struct {
 	// indexing the unconfirmed transactions in the memory pool.
 	// This can be nil if the address index is not enabled.
 	AddrIndex *indexers.AddrIndex
+
+	// FeeEstimator defines the optional fee estimator which observes the
+	// transactions accepted to the memory pool.  This can be nil if fee
+	// estimation is not needed.
+	FeeEstimator *FeeEstimator
+
+	// Metrics defines the optional registry the memory pool registers its
+	// metrics with.  This can be nil if metrics are not needed.
+	Metrics *metrics.Registry
 }
 
 // Policy houses the policy (configuration parameters) which is used to
@@ -117,6 +153,12 @@ type Policy struct {
 	// transactions that do not have enough priority to be relayed.
 	DisableRelayPriority bool
 
+	// DisableStrictEncoding defines whether to accept transactions with
+	// non-canonical signature or public key encodings, such as signatures
+	// with high S values, as long as the strict encoding deployment is not
+	// active.  Otherwise, they are rejected as non-standard.
+	DisableStrictEncoding bool
+
 	// AcceptNonStd defines whether to accept non-standard transactions. If
 	// true, non-standard transactions will be accepted into the mempool.
 	// Otherwise, all non-standard transactions will be rejected.
@@ -143,6 +185,13 @@ type Policy struct {
 	// MinRelayTxFee defines the minimum transaction fee in RMG/kB to be
 	// considered a non-zero fee.
 	MinRelayTxFee provautil.Amount
+
+	// MaxPoolSize is the maximum total serialized size in bytes of the
+	// transactions in the pool.  A new transaction which does not fit
+	// evicts the transactions paying the lowest fee rates, as long as they
+	// pay lower fee rates than it does.  A value of zero disables the
+	// limit.
+	MaxPoolSize int64
 }
 
 // TxDesc is a descriptor containing a transaction in the mempool along with
@@ -153,6 +202,66 @@ type TxDesc struct {
 	// StartingPriority is the priority of the transaction when it was added
 	// to the pool.
 	StartingPriority float64
+
+	// SequenceLock is the relative lock-time of the transaction calculated
+	// from its inputs when it was added to the pool.
+	SequenceLock *blockchain.SequenceLock
+}
+
+// feeRateItem is an entry of the fee rate index of the pool transactions.
+type feeRateItem struct {
+	txD      *TxDesc
+	feePerKB int64 // modified fee rate including the fee delta
+	index    int   // position in the heap
+}
+
+// feeRateHeap is the fee rate index of the pool transactions.  It is a min
+// heap ordered by the modified fee rate of the transactions, so the
+// transactions to evict when the pool is full are popped first, along with a
+// map from the hash of each transaction to its entry so the entries can be
+// removed and updated when the transactions leave the pool or are
+// prioritised.
+type feeRateHeap struct {
+	items  []*feeRateItem
+	byHash map[chainhash.Hash]*feeRateItem
+}
+
+// Len returns the number of items in the heap.  It is part of the
+// heap.Interface implementation.
+func (h *feeRateHeap) Len() int {
+	return len(h.items)
+}
+
+// Less returns whether the item with index i pays a lower fee rate than the
+// item with index j.  It is part of the heap.Interface implementation.
+func (h *feeRateHeap) Less(i, j int) bool {
+	return h.items[i].feePerKB < h.items[j].feePerKB
+}
+
+// Swap swaps the items at the passed indices in the heap.  It is part of the
+// heap.Interface implementation.
+func (h *feeRateHeap) Swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+	h.items[i].index = i
+	h.items[j].index = j
+}
+
+// Push pushes the passed item onto the heap.  It is part of the heap.Interface
+// implementation.
+func (h *feeRateHeap) Push(x interface{}) {
+	item := x.(*feeRateItem)
+	item.index = len(h.items)
+	h.items = append(h.items, item)
+}
+
+// Pop removes the item paying the lowest fee rate from the heap and returns
+// it.  It is part of the heap.Interface implementation.
+func (h *feeRateHeap) Pop() interface{} {
+	n := len(h.items)
+	item := h.items[n-1]
+	h.items[n-1] = nil
+	h.items = h.items[0 : n-1]
+	return item
 }
 
 // orphanTx is normal transaction that references an ancestor transaction
@@ -161,9 +270,39 @@ type TxDesc struct {
 type orphanTx struct {
 	tx         *provautil.Tx
 	tag        Tag
+	exemptions PolicyExemptions
 	expiration time.Time
 }
 
+// poolMetrics houses the metrics of the memory pool.  They are all nil, and
+// discard their updates, when the pool has no metrics registry.
+type poolMetrics struct {
+	txs     *metrics.Gauge
+	bytes   *metrics.Gauge
+	orphans *metrics.Gauge
+	added   *metrics.Counter
+	evicted *metrics.Counter
+}
+
+// newPoolMetrics registers the metrics of the memory pool with the passed
+// registry.
+func newPoolMetrics(registry *metrics.Registry) poolMetrics {
+	return poolMetrics{
+		txs: registry.NewGauge("prova_mempool_transactions",
+			"Number of transactions in the memory pool."),
+		bytes: registry.NewGauge("prova_mempool_bytes",
+			"Total serialized size of the transactions in the "+
+				"memory pool."),
+		orphans: registry.NewGauge("prova_mempool_orphans",
+			"Number of transactions in the orphan pool."),
+		added: registry.NewCounter("prova_mempool_added_total",
+			"Number of transactions added to the memory pool."),
+		evicted: registry.NewCounter("prova_mempool_evicted_total",
+			"Number of transactions evicted from the full memory "+
+				"pool."),
+	}
+}
+
 // TxPool is used as a source of transactions that need to be mined into blocks
 // and relayed to other peers.  It is safe for concurrent access from multiple
 // peers.
@@ -177,8 +316,18 @@ type TxPool struct {
 	orphans       map[chainhash.Hash]*orphanTx
 	orphansByPrev map[wire.OutPoint]map[chainhash.Hash]*provautil.Tx
 	outpoints     map[wire.OutPoint]*provautil.Tx
+	feeDeltas     map[chainhash.Hash]int64
+	feeRates      feeRateHeap
+	poolSize      int64   // total serialized size of the pool transactions.
 	pennyTotal    float64 // exponentially decaying total for penny spends.
 	lastPennyUnix int64   // unix time of last ``penny spend''
+	metrics       poolMetrics
+
+	// minFeeRate is the minimum fee rate in atoms/kB the pool raised after
+	// it had to evict transactions, as decayed at minFeeRateTime.  See
+	// minRelayFeeRate.
+	minFeeRate     float64
+	minFeeRateTime time.Time
 
 	// nextExpireScan is the time after which the orphan pool will be
 	// scanned in order to evict orphans.  This is NOT a hard deadline as
@@ -229,6 +378,7 @@ func (mp *TxPool) removeOrphan(tx *provautil.Tx, removeRedeemers bool) {
 
 	// Remove the transaction from the orphan pool.
 	delete(mp.orphans, *txHash)
+	mp.metrics.orphans.Set(int64(len(mp.orphans)))
 }
 
 // RemoveOrphan removes the passed orphan transaction from the orphan pool and
@@ -314,7 +464,7 @@ func (mp *TxPool) limitNumOrphans() error {
 // addOrphan adds an orphan transaction to the orphan pool.
 //
 // This function MUST be called with the mempool lock held (for writes).
-func (mp *TxPool) addOrphan(tx *provautil.Tx, tag Tag) {
+func (mp *TxPool) addOrphan(tx *provautil.Tx, tag Tag, exemptions PolicyExemptions) {
 	// Nothing to do if no orphans are allowed.
 	if mp.cfg.Policy.MaxOrphanTxs <= 0 {
 		return
@@ -328,6 +478,7 @@ func (mp *TxPool) addOrphan(tx *provautil.Tx, tag Tag) {
 	mp.orphans[*tx.Hash()] = &orphanTx{
 		tx:         tx,
 		tag:        tag,
+		exemptions: exemptions,
 		expiration: time.Now().Add(orphanTTL),
 	}
 	for _, txIn := range tx.MsgTx().TxIn {
@@ -337,6 +488,7 @@ func (mp *TxPool) addOrphan(tx *provautil.Tx, tag Tag) {
 		}
 		mp.orphansByPrev[txIn.PreviousOutPoint][*tx.Hash()] = tx
 	}
+	mp.metrics.orphans.Set(int64(len(mp.orphans)))
 
 	log.Debugf("Stored orphan transaction %v (total: %d)", tx.Hash(),
 		len(mp.orphans))
@@ -345,7 +497,7 @@ func (mp *TxPool) addOrphan(tx *provautil.Tx, tag Tag) {
 // maybeAddOrphan potentially adds an orphan to the orphan pool.
 //
 // This function MUST be called with the mempool lock held (for writes).
-func (mp *TxPool) maybeAddOrphan(tx *provautil.Tx, tag Tag) error {
+func (mp *TxPool) maybeAddOrphan(tx *provautil.Tx, tag Tag, exemptions PolicyExemptions) error {
 	// Ignore orphan transactions that are too large.  This helps avoid
 	// a memory exhaustion attack based on sending a lot of really large
 	// orphans.  In the case there is a valid transaction larger than this,
@@ -356,7 +508,7 @@ func (mp *TxPool) maybeAddOrphan(tx *provautil.Tx, tag Tag) error {
 	// also limited, so this equates to a maximum memory used of
 	// mp.cfg.Policy.MaxOrphanTxSize * mp.cfg.Policy.MaxOrphanTxs (which is ~5MB
 	// using the default values at the time this comment was written).
-	serializedLen := tx.MsgTx().SerializeSize()
+	serializedLen := tx.SerializeSize()
 	if serializedLen > mp.cfg.Policy.MaxOrphanTxSize {
 		str := fmt.Sprintf("orphan transaction size of %d bytes is "+
 			"larger than max allowed size of %d bytes",
@@ -365,7 +517,7 @@ func (mp *TxPool) maybeAddOrphan(tx *provautil.Tx, tag Tag) error {
 	}
 
 	// Add the orphan if the none of the above disqualified it.
-	mp.addOrphan(tx, tag)
+	mp.addOrphan(tx, tag, exemptions)
 
 	return nil
 }
@@ -486,6 +638,12 @@ func (mp *TxPool) removeTransaction(tx *provautil.Tx, removeRedeemers bool) {
 			delete(mp.outpoints, txIn.PreviousOutPoint)
 		}
 		delete(mp.pool, *txHash)
+		delete(mp.feeDeltas, *txHash)
+		heap.Remove(&mp.feeRates, mp.feeRates.byHash[*txHash].index)
+		delete(mp.feeRates.byHash, *txHash)
+		mp.poolSize -= int64(txDesc.Tx.SerializeSize())
+		mp.metrics.txs.Set(int64(len(mp.pool)))
+		mp.metrics.bytes.Set(mp.poolSize)
 		atomic.StoreInt64(&mp.lastUpdated, time.Now().Unix())
 	}
 }
@@ -529,7 +687,7 @@ func (mp *TxPool) RemoveDoubleSpends(tx *provautil.Tx) {
 // helper for maybeAcceptTransaction.
 //
 // This function MUST be called with the mempool lock held (for writes).
-func (mp *TxPool) addTransaction(utxoView *blockchain.UtxoViewpoint, tx *provautil.Tx, height uint32, fee int64) *TxDesc {
+func (mp *TxPool) addTransaction(utxoView *blockchain.UtxoViewpoint, tx *provautil.Tx, height uint32, fee int64, sequenceLock *blockchain.SequenceLock) *TxDesc {
 	// Add the transaction to the pool and mark the referenced outpoints
 	// as spent by the pool.
 	txD := &TxDesc{
@@ -538,11 +696,19 @@ func (mp *TxPool) addTransaction(utxoView *blockchain.UtxoViewpoint, tx *provaut
 			Added:    time.Now(),
 			Height:   height,
 			Fee:      fee,
-			FeePerKB: fee * 1000 / int64(tx.MsgTx().SerializeSize()),
+			FeePerKB: fee * 1000 / int64(tx.SerializeSize()),
 		},
 		StartingPriority: mining.CalcPriority(tx.MsgTx(), utxoView, height),
+		SequenceLock:     sequenceLock,
 	}
 	mp.pool[*tx.Hash()] = txD
+	item := &feeRateItem{txD: txD, feePerKB: mp.modifiedFeePerKB(txD)}
+	heap.Push(&mp.feeRates, item)
+	mp.feeRates.byHash[*tx.Hash()] = item
+	mp.poolSize += int64(tx.SerializeSize())
+	mp.metrics.txs.Set(int64(len(mp.pool)))
+	mp.metrics.bytes.Set(mp.poolSize)
+	mp.metrics.added.Inc()
 
 	for _, txIn := range tx.MsgTx().TxIn {
 		mp.outpoints[txIn.PreviousOutPoint] = tx
@@ -555,9 +721,202 @@ func (mp *TxPool) addTransaction(utxoView *blockchain.UtxoViewpoint, tx *provaut
 		mp.cfg.AddrIndex.AddUnconfirmedTx(tx, utxoView)
 	}
 
+	// Record the fee rate of the transaction for fee estimation if
+	// enabled.
+	if mp.cfg.FeeEstimator != nil {
+		mp.cfg.FeeEstimator.ObserveTransaction(txD)
+	}
+
 	return txD
 }
 
+// modifiedFeePerKB returns the fee rate of the passed pool transaction in
+// Atoms/kB including the fee delta it was prioritised by.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) modifiedFeePerKB(txD *TxDesc) int64 {
+	fee := txD.Fee + mp.feeDeltas[*txD.Tx.Hash()]
+	return fee * 1000 / int64(txD.Tx.SerializeSize())
+}
+
+// setFeeDelta sets the fee delta of the pool transaction with the passed hash
+// and updates its position in the fee rate index accordingly.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) setFeeDelta(txHash *chainhash.Hash, feeDelta int64) {
+	mp.feeDeltas[*txHash] = feeDelta
+	if feeDelta == 0 {
+		delete(mp.feeDeltas, *txHash)
+	}
+	item := mp.feeRates.byHash[*txHash]
+	item.feePerKB = mp.modifiedFeePerKB(item.txD)
+	heap.Fix(&mp.feeRates, item.index)
+}
+
+// poolAncestors returns the hashes of the transactions in the pool the passed
+// transaction, which is not in the pool itself, depends on directly or
+// through other transactions in the pool.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) poolAncestors(tx *provautil.Tx) map[chainhash.Hash]struct{} {
+	ancestors := make(map[chainhash.Hash]struct{})
+	queue := []*provautil.Tx{tx}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, txIn := range cur.MsgTx().TxIn {
+			parentHash := txIn.PreviousOutPoint.Hash
+			if _, ok := ancestors[parentHash]; ok {
+				continue
+			}
+			parent, exists := mp.pool[parentHash]
+			if !exists {
+				continue
+			}
+			ancestors[parentHash] = struct{}{}
+			queue = append(queue, parent.Tx)
+		}
+	}
+	return ancestors
+}
+
+// makeRoom evicts the transactions paying the lowest fee rates, along with the
+// transactions which redeem them, until a transaction of the passed size fits
+// into the pool without exceeding its maximum size.  Only transactions paying
+// a fee rate below the passed one are evicted.  The ones in keep are only
+// evicted after all of the others when evictKept is set, and never otherwise.
+// Since evicting a transaction also evicts the transactions which redeem it,
+// keep must contain the in-pool ancestors of every transaction in it when
+// evictKept is not set.  It returns whether the transaction fits, in which
+// case nothing is evicted unless that was necessary to make it fit.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) makeRoom(size, feePerKB int64, keep map[chainhash.Hash]struct{}, evictKept bool) bool {
+	maxSize := mp.cfg.Policy.MaxPoolSize
+	if maxSize == 0 || mp.poolSize+size <= maxSize {
+		return true
+	}
+
+	// Pop the transactions which may be evicted off the fee rate index in
+	// order of increasing fee rate until evicting them makes enough room,
+	// setting aside the ones to keep in case evicting all of the others
+	// does not.  Evicting a transaction also evicts the transactions which
+	// redeem it, which only makes more room.
+	var popped, evict, kept []*feeRateItem
+	var freed int64
+	for mp.feeRates.Len() > 0 && mp.poolSize+size-freed > maxSize {
+		item := heap.Pop(&mp.feeRates).(*feeRateItem)
+		popped = append(popped, item)
+		if item.feePerKB >= feePerKB {
+			break
+		}
+		if _, ok := keep[*item.txD.Tx.Hash()]; ok {
+			kept = append(kept, item)
+			continue
+		}
+		evict = append(evict, item)
+		freed += int64(item.txD.Tx.SerializeSize())
+	}
+	for _, item := range kept {
+		if !evictKept || mp.poolSize+size-freed <= maxSize {
+			break
+		}
+		evict = append(evict, item)
+		freed += int64(item.txD.Tx.SerializeSize())
+	}
+
+	// Restore the index before evicting anything, since removing the
+	// transactions removes them from the index.
+	for _, item := range popped {
+		heap.Push(&mp.feeRates, item)
+	}
+	if mp.poolSize+size-freed > maxSize {
+		return false
+	}
+	var numEvicted int
+	var maxEvictedFeePerKB int64
+	for _, item := range evict {
+		if mp.poolSize+size <= maxSize {
+			break
+		}
+		txD := item.txD
+		if _, exists := mp.pool[*txD.Tx.Hash()]; !exists {
+			continue
+		}
+		log.Debugf("Evicting transaction %v from the full memory pool",
+			txD.Tx.Hash())
+		mp.removeTransaction(txD.Tx, true)
+		mp.metrics.evicted.Inc()
+		numEvicted++
+		if item.feePerKB > maxEvictedFeePerKB {
+			maxEvictedFeePerKB = item.feePerKB
+		}
+	}
+
+	// Raise the minimum fee rate above the fee rates of the evicted
+	// transactions, so transactions which would be evicted right away are
+	// no longer accepted.
+	if numEvicted > 0 {
+		mp.raiseMinFeeRate(maxEvictedFeePerKB+minFeeRateIncrement,
+			time.Now())
+	}
+	return true
+}
+
+// decayMinFeeRate decays the minimum fee rate the pool raised after it had to
+// evict transactions up to the passed time.  The raised rate decays with a
+// half-life of minFeeRateHalfLife, four times faster when the pool is less than
+// half full, and stops applying once it has mostly decayed.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) decayMinFeeRate(now time.Time) {
+	elapsed := now.Sub(mp.minFeeRateTime)
+	if mp.minFeeRate == 0 || elapsed <= 0 {
+		return
+	}
+
+	halfLife := minFeeRateHalfLife
+	if mp.poolSize < mp.cfg.Policy.MaxPoolSize/2 {
+		halfLife /= 4
+	}
+	mp.minFeeRate *= math.Pow(0.5, float64(elapsed)/float64(halfLife))
+	mp.minFeeRateTime = now
+	if mp.minFeeRate < minFeeRateIncrement/2 {
+		mp.minFeeRate = 0
+	}
+}
+
+// raiseMinFeeRate raises the minimum fee rate a new transaction must pay to be
+// accepted into the pool to the passed fee rate in atoms/kB as of the passed
+// time unless it is already higher.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) raiseMinFeeRate(feePerKB int64, now time.Time) {
+	mp.decayMinFeeRate(now)
+	if float64(feePerKB) <= mp.minFeeRate {
+		return
+	}
+	mp.minFeeRate = float64(feePerKB)
+	mp.minFeeRateTime = now
+	log.Debugf("Raised the minimum fee rate of the full memory pool to %d "+
+		"Atoms/kB", feePerKB)
+}
+
+// minRelayFeeRate returns the minimum fee rate in atoms/kB a new transaction
+// must pay to be accepted into the pool as of the passed time.  It is the
+// configured minimum relay fee unless the pool raised it after it had to evict
+// transactions and it has not decayed below that yet.
+//
+// This function MUST be called with the mempool lock held (for writes).
+func (mp *TxPool) minRelayFeeRate(now time.Time) int64 {
+	mp.decayMinFeeRate(now)
+	staticRate := int64(mp.cfg.Policy.MinRelayTxFee)
+	if rate := int64(mp.minFeeRate); rate > staticRate {
+		return rate
+	}
+	return staticRate
+}
+
 // checkPoolDoubleSpend checks whether or not the passed transaction is
 // attempting to spend coins already spent by other transactions in the pool.
 // Note it does not check for double spends against transactions already in the
@@ -624,8 +983,11 @@ func (mp *TxPool) FetchTransaction(txHash *chainhash.Hash) (*provautil.Tx, error
 // MaybeAcceptTransaction.  See the comment for MaybeAcceptTransaction for
 // more details.
 //
+// The relay policy checks in the passed exemptions are skipped, while the
+// consensus rules are always enforced.
+//
 // This function MUST be called with the mempool lock held (for writes).
-func (mp *TxPool) maybeAcceptTransaction(tx *provautil.Tx, isNew, rateLimit bool, rejectDupOrphans bool) ([]*chainhash.Hash, *TxDesc, error) {
+func (mp *TxPool) maybeAcceptTransaction(tx *provautil.Tx, isNew, rateLimit bool, rejectDupOrphans bool, exemptions PolicyExemptions) ([]*chainhash.Hash, *TxDesc, error) {
 	txHash := tx.Hash()
 
 	// Don't accept the transaction if it already exists in the pool.  This
@@ -675,11 +1037,23 @@ func (mp *TxPool) maybeAcceptTransaction(tx *provautil.Tx, isNew, rateLimit bool
 
 	medianTimePast := mp.cfg.MedianTimePast()
 
+	// Don't accept time-locked outputs until their locks are enforced for
+	// the next block and all blocks after it.
+	err = blockchain.CheckTimeLockOutputs(tx, mp.cfg.TimeLockFlags())
+	if err != nil {
+		if cerr, ok := err.(blockchain.RuleError); ok {
+			return nil, nil, chainRuleError(cerr)
+		}
+		return nil, nil, err
+	}
+
 	// Don't allow non-standard transactions if the network parameters
-	// forbid their acceptance.
-	if !mp.cfg.Policy.AcceptNonStd {
+	// forbid their acceptance, unless the transaction is exempt.
+	acceptNonStd := mp.cfg.Policy.AcceptNonStd ||
+		exemptions&ExemptStandardness != 0
+	if !acceptNonStd {
 		err = checkTransactionStandard(tx, nextBlockHeight,
-			medianTimePast, mp.cfg.Policy.MinRelayTxFee,
+			mp.cfg.LockTimeEvalTime(), mp.cfg.Policy.MinRelayTxFee,
 			mp.cfg.Policy.MaxTxVersion)
 		if err != nil {
 			// Attempt to extract a reject code from the error so
@@ -792,8 +1166,8 @@ func (mp *TxPool) maybeAcceptTransaction(tx *provautil.Tx, isNew, rateLimit bool
 	}
 
 	// Don't allow transactions with non-standard inputs if the network
-	// parameters forbid their acceptance.
-	if !mp.cfg.Policy.AcceptNonStd {
+	// parameters forbid their acceptance, unless the transaction is exempt.
+	if !acceptNonStd {
 		err := checkInputsStandard(tx, utxoView)
 		if err != nil {
 			// Attempt to extract a reject code from the error so
@@ -844,22 +1218,45 @@ func (mp *TxPool) maybeAcceptTransaction(tx *provautil.Tx, isNew, rateLimit bool
 	// transactions to avoid fees rather than one single larger transaction
 	// which is more desirable.  Therefore, as long as the size of the
 	// transaction does not exceeed 1000 less than the reserved space for
-	// high-priority transactions, don't require a fee for it.
-	serializedSize := int64(tx.MsgTx().SerializeSize())
+	// high-priority transactions, don't require a fee for it.  Transactions
+	// which are exempt from the relay fee don't require one either.
+	serializedSize := int64(tx.SerializeSize())
+	minFeeRate := int64(mp.cfg.Policy.MinRelayTxFee)
+	if isNew {
+		minFeeRate = mp.minRelayFeeRate(time.Now())
+	}
 	minFee := calcMinRequiredTxRelayFee(serializedSize,
-		mp.cfg.Policy.MinRelayTxFee)
-	if serializedSize >= (DefaultBlockPrioritySize-1000) && txFee < minFee {
+		provautil.Amount(minFeeRate))
+	exemptFee := exemptions&ExemptRelayFee != 0
+	if !exemptFee && serializedSize >= (DefaultBlockPrioritySize-1000) &&
+		txFee < minFee {
+
 		str := fmt.Sprintf("transaction %v has %d fees which is under "+
 			"the required amount of %d", txHash, txFee,
 			minFee)
 		return nil, nil, txRuleError(wire.RejectInsufficientFee, str)
 	}
 
+	// A pool which had to evict transactions raises the minimum fee rate,
+	// and new transactions paying less are rejected regardless of their
+	// priority since they would be the first ones to be evicted.
+	if !exemptFee && minFeeRate > int64(mp.cfg.Policy.MinRelayTxFee) &&
+		txFee < minFee {
+
+		str := fmt.Sprintf("transaction %v has %d fees which is under "+
+			"the required amount of %d for the minimum fee rate of "+
+			"%d Atoms/kB of the full memory pool", txHash, txFee,
+			minFee, minFeeRate)
+		return nil, nil, txRuleError(wire.RejectInsufficientFee, str)
+	}
+
 	// Require that free transactions have sufficient priority to be mined
 	// in the next block.  Transactions which are being added back to the
 	// memory pool from blocks that have been disconnected during a reorg
-	// are exempted.
-	if isNew && !mp.cfg.Policy.DisableRelayPriority && txFee < minFee {
+	// are exempted, as are transactions exempt from the relay fee.
+	if isNew && !exemptFee && !mp.cfg.Policy.DisableRelayPriority &&
+		txFee < minFee {
+
 		currentPriority := mining.CalcPriority(tx.MsgTx(), utxoView,
 			nextBlockHeight)
 		if currentPriority <= mining.MinHighPriority {
@@ -871,8 +1268,9 @@ func (mp *TxPool) maybeAcceptTransaction(tx *provautil.Tx, isNew, rateLimit bool
 	}
 
 	// Free-to-relay transactions are rate limited here to prevent
-	// penny-flooding with tiny transactions as a form of attack.
-	if rateLimit && txFee < minFee {
+	// penny-flooding with tiny transactions as a form of attack, unless they
+	// are exempt.
+	if rateLimit && exemptions&ExemptRateLimit == 0 && txFee < minFee {
 		nowUnix := time.Now().Unix()
 		// Decay passed data with an exponentially decaying ~10 minute
 		// window - matches bitcoind handling.
@@ -895,9 +1293,12 @@ func (mp *TxPool) maybeAcceptTransaction(tx *provautil.Tx, isNew, rateLimit bool
 	}
 
 	// Verify crypto signatures for each input and reject the transaction if
-	// any don't verify.
+	// any don't verify.  The standard script flags include the consensus
+	// flags of the deployments which are active for the next block.
+	scriptFlags := mining.StandardScriptFlags(
+		mp.cfg.Policy.DisableStrictEncoding, mp.cfg.VerificationFlags())
 	err = blockchain.ValidateTransactionScripts(tx, utxoView, keyView,
-		txscript.StandardVerifyFlags, mp.cfg.SigCache, mp.cfg.HashCache)
+		scriptFlags, mp.cfg.SigCache, mp.cfg.HashCache)
 	if err != nil {
 		if cerr, ok := err.(blockchain.RuleError); ok {
 			return nil, nil, chainRuleError(cerr)
@@ -905,8 +1306,23 @@ func (mp *TxPool) maybeAcceptTransaction(tx *provautil.Tx, isNew, rateLimit bool
 		return nil, nil, err
 	}
 
+	// Evict the transactions paying lower fee rates when the pool is full,
+	// except for the ones the transaction depends on.  Transactions which
+	// are being added back to the memory pool from blocks that have been
+	// disconnected during a reorg are limited as a whole once they are all
+	// added instead.
+	feePerKB := (txFee + mp.feeDeltas[*txHash]) * 1000 / serializedSize
+	if isNew && !mp.makeRoom(serializedSize, feePerKB,
+		mp.poolAncestors(tx), false) {
+
+		str := fmt.Sprintf("transaction %v has a fee rate of %d Atoms/kB "+
+			"which is too low to get into the full memory pool",
+			txHash, feePerKB)
+		return nil, nil, txRuleError(wire.RejectInsufficientFee, str)
+	}
+
 	// Add to transaction pool.
-	txD := mp.addTransaction(utxoView, tx, bestHeight, txFee)
+	txD := mp.addTransaction(utxoView, tx, bestHeight, txFee, sequenceLock)
 
 	log.Debugf("Accepted transaction %v (pool size: %v)", txHash,
 		len(mp.pool))
@@ -924,16 +1340,101 @@ func (mp *TxPool) maybeAcceptTransaction(tx *provautil.Tx, isNew, rateLimit bool
 // parent is returned.  Use ProcessTransaction instead if new orphans should
 // be added to the orphan pool.
 //
+// Transactions which are not new are not limited by the maximum size of the
+// pool.  Use ResurrectTransactions to add the transactions of blocks which were
+// disconnected during a reorg back to the pool.
+//
 // This function is safe for concurrent access.
 func (mp *TxPool) MaybeAcceptTransaction(tx *provautil.Tx, isNew, rateLimit bool) ([]*chainhash.Hash, *TxDesc, error) {
 	// Protect concurrent access.
 	mp.mtx.Lock()
-	hashes, txD, err := mp.maybeAcceptTransaction(tx, isNew, rateLimit, true)
+	hashes, txD, err := mp.maybeAcceptTransaction(tx, isNew, rateLimit, true, 0)
 	mp.mtx.Unlock()
 
 	return hashes, txD, err
 }
 
+// ResurrectTransactions adds the transactions of the blocks which were
+// disconnected during a reorg back to the memory pool once the main chain
+// reflects the new chain.  The transactions must be passed in the order they
+// were mined in, so they follow the transactions they spend, and must not
+// include the transactions which the new chain confirmed.
+//
+// The transactions go through the same checks against the new chain as new
+// transactions, except for the relay policy checks in the passed exemptions and
+// the priority check.  Transactions which spend outputs the new chain or the
+// pool already spent, either directly or through the disconnected
+// transactions they spend, are returned as conflicted, and the pool
+// transactions which spend their outputs are removed.  Transactions which fail
+// any other check are dropped along with the pool transactions which spend
+// them.
+//
+// Since they were already mined once, the resurrected transactions take
+// precedence over the other pool transactions when the pool exceeds its
+// maximum size.  The pool only evicts resurrected transactions, starting with
+// the ones paying the lowest fee rates, once it has no other transactions
+// left to evict.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) ResurrectTransactions(txns []*provautil.Tx, exemptions PolicyExemptions) ([]*TxDesc, []*provautil.Tx) {
+	// Protect concurrent access.
+	mp.mtx.Lock()
+	defer mp.mtx.Unlock()
+
+	var conflicted []*provautil.Tx
+	accepted := make([]*TxDesc, 0, len(txns))
+	keep := make(map[chainhash.Hash]struct{}, len(txns))
+	for _, tx := range txns {
+		if mp.isTransactionInPool(tx.Hash()) {
+			continue
+		}
+
+		// Pool transactions are not part of a block, so a transaction
+		// obtained from a disconnected block is wrapped anew instead of
+		// changing the index it has in the block, which shares it.
+		if tx.Index() != provautil.TxIndexUnknown {
+			tx = provautil.NewTx(tx.MsgTx())
+		}
+
+		// A transaction which spends an output the pool or the new chain
+		// already spent conflicts with it.  So does a transaction with
+		// missing inputs, since the new chain spent them or they belong
+		// to disconnected transactions which conflict.  Neither it nor
+		// the pool transactions which spend it can be mined anymore.
+		if mp.checkPoolDoubleSpend(tx) == nil {
+			missingParents, txD, err := mp.maybeAcceptTransaction(tx,
+				false, false, true, exemptions)
+			switch {
+			case err != nil && !isChainDoubleSpend(err):
+				log.Debugf("Transaction %v of a disconnected block "+
+					"was rejected: %v", tx.Hash(), err)
+				mp.removeTransaction(tx, true)
+				continue
+
+			case err == nil && len(missingParents) == 0:
+				accepted = append(accepted, txD)
+				keep[*tx.Hash()] = struct{}{}
+				continue
+			}
+		}
+		log.Debugf("Transaction %v of a disconnected block conflicts "+
+			"with the new chain", tx.Hash())
+		mp.removeTransaction(tx, true)
+		conflicted = append(conflicted, tx)
+	}
+
+	// Limit the pool to its maximum size, evicting the other transactions
+	// before the resurrected ones.
+	mp.makeRoom(0, math.MaxInt64, keep, true)
+	resurrected := accepted[:0]
+	for _, txD := range accepted {
+		if _, exists := mp.pool[*txD.Tx.Hash()]; exists {
+			resurrected = append(resurrected, txD)
+		}
+	}
+	return resurrected, conflicted
+}
+
 // processOrphans is the internal function which implements the public
 // ProcessOrphans.  See the comment for ProcessOrphans for more details.
 //
@@ -968,10 +1469,12 @@ func (mp *TxPool) processOrphans(acceptedTx *provautil.Tx) []*TxDesc {
 				continue
 			}
 
-			// Potentially accept an orphan into the tx pool.
+			// Potentially accept an orphan into the tx pool with
+			// the exemptions of the peer which relayed it.
 			for _, tx := range orphans {
+				exemptions := mp.orphans[*tx.Hash()].exemptions
 				missing, txD, err := mp.maybeAcceptTransaction(
-					tx, true, true, false)
+					tx, true, true, false, exemptions)
 				if err != nil {
 					// The orphan is now invalid, so there
 					// is no way any other orphans which
@@ -1040,13 +1543,17 @@ func (mp *TxPool) ProcessOrphans(acceptedTx *provautil.Tx) []*TxDesc {
 // such as rejecting duplicate transactions, ensuring transactions follow all
 // rules, orphan transaction handling, and insertion into the memory pool.
 //
+// The relay policy checks in the passed exemptions are skipped for the
+// transaction, and for it once it is no longer an orphan, but the consensus
+// rules are always enforced.
+//
 // It returns a slice of transactions added to the mempool.  When the
 // error is nil, the list will include the passed transaction itself along
 // with any additional orphan transaactions that were added as a result of
 // the passed one being accepted.
 //
 // This function is safe for concurrent access.
-func (mp *TxPool) ProcessTransaction(tx *provautil.Tx, allowOrphan, rateLimit bool, tag Tag) ([]*TxDesc, error) {
+func (mp *TxPool) ProcessTransaction(tx *provautil.Tx, allowOrphan, rateLimit bool, tag Tag, exemptions PolicyExemptions) ([]*TxDesc, error) {
 	log.Tracef("Processing transaction %v", tx.Hash())
 
 	// Protect concurrent access.
@@ -1055,7 +1562,7 @@ func (mp *TxPool) ProcessTransaction(tx *provautil.Tx, allowOrphan, rateLimit bo
 
 	// Potentially accept the transaction to the memory pool.
 	missingParents, txD, err := mp.maybeAcceptTransaction(tx, true, rateLimit,
-		true)
+		true, exemptions)
 	if err != nil {
 		return nil, err
 	}
@@ -1095,7 +1602,7 @@ func (mp *TxPool) ProcessTransaction(tx *provautil.Tx, allowOrphan, rateLimit bo
 	}
 
 	// Potentially add the orphan transaction to the orphan pool.
-	err = mp.maybeAddOrphan(tx, tag)
+	err = mp.maybeAddOrphan(tx, tag, exemptions)
 	return nil, err
 }
 
@@ -1111,6 +1618,20 @@ func (mp *TxPool) Count() int {
 	return count
 }
 
+// MinRelayFeeRate returns the minimum fee rate in atoms/kB a transaction must
+// pay to be relayed by the pool.  It is announced to peers so they do not
+// relay transactions with lower fee rates to this node.  The rate rises above
+// the configured minimum relay fee when the pool has to evict transactions and
+// decays back to it over time.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) MinRelayFeeRate() int64 {
+	mp.mtx.Lock()
+	defer mp.mtx.Unlock()
+
+	return mp.minRelayFeeRate(time.Now())
+}
+
 // TxHashes returns a slice of hashes for all of the transactions in the memory
 // pool.
 //
@@ -1155,8 +1676,17 @@ func (mp *TxPool) MiningDescs() []*mining.TxDesc {
 	mp.mtx.RLock()
 	descs := make([]*mining.TxDesc, len(mp.pool))
 	i := 0
-	for _, desc := range mp.pool {
+	for hash, desc := range mp.pool {
 		descs[i] = &desc.TxDesc
+
+		// Hand out a copy of the descriptor with the fee delta applied
+		// via PrioritiseTransaction, so the descriptors in the pool are
+		// never modified after they were added.
+		if feeDelta, ok := mp.feeDeltas[hash]; ok {
+			descCopy := desc.TxDesc
+			descCopy.FeeDelta = feeDelta
+			descs[i] = &descCopy
+		}
 		i++
 	}
 	mp.mtx.RUnlock()
@@ -1164,8 +1694,218 @@ func (mp *TxPool) MiningDescs() []*mining.TxDesc {
 	return descs
 }
 
+// PrioritiseTransaction adds the passed fee delta in atoms to the fee delta of
+// the transaction with the passed hash.  The fee delta is only taken into
+// account when selecting transactions for new blocks, where a positive delta
+// makes the transaction more attractive and a negative delta which exceeds the
+// fee of the transaction excludes it, along with the transactions which depend
+// on it.  It does not change the actual fee of the transaction and is discarded
+// once the transaction is removed from the pool.  An error is returned when the
+// transaction is not in the main pool.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) PrioritiseTransaction(txHash *chainhash.Hash, feeDelta int64) error {
+	mp.mtx.Lock()
+	defer mp.mtx.Unlock()
+
+	if _, exists := mp.pool[*txHash]; !exists {
+		return fmt.Errorf("transaction %v is not in the pool", txHash)
+	}
+	mp.setFeeDelta(txHash, mp.feeDeltas[*txHash]+feeDelta)
+
+	// Mark the pool updated so block templates are regenerated with the
+	// new fee delta.
+	atomic.StoreInt64(&mp.lastUpdated, time.Now().Unix())
+	return nil
+}
+
+// txRelatives indexes the in-pool parents and children of pool entries as they
+// are looked up, so describing several entries from the same view of the pool
+// examines the inputs and outputs of each transaction only once.
+//
+// It MUST only be used while the mempool lock is held (for reads).
+type txRelatives struct {
+	mp       *TxPool
+	parents  map[*TxDesc][]*TxDesc
+	children map[*TxDesc][]*TxDesc
+}
+
+// newTxRelatives returns an empty index of the relatives of the entries of the
+// passed pool.
+func newTxRelatives(mp *TxPool) *txRelatives {
+	return &txRelatives{
+		mp:       mp,
+		parents:  make(map[*TxDesc][]*TxDesc),
+		children: make(map[*TxDesc][]*TxDesc),
+	}
+}
+
+// Parents returns the distinct in-pool transactions spent by the inputs of the
+// passed entry in the order of the inputs.
+func (r *txRelatives) Parents(desc *TxDesc) []*TxDesc {
+	if parents, ok := r.parents[desc]; ok {
+		return parents
+	}
+
+	var parents []*TxDesc
+	seen := make(map[*TxDesc]struct{})
+	for _, txIn := range desc.Tx.MsgTx().TxIn {
+		parent, exists := r.mp.pool[txIn.PreviousOutPoint.Hash]
+		if !exists {
+			continue
+		}
+		if _, ok := seen[parent]; ok {
+			continue
+		}
+		seen[parent] = struct{}{}
+		parents = append(parents, parent)
+	}
+	r.parents[desc] = parents
+	return parents
+}
+
+// Children returns the distinct in-pool transactions spending the outputs of
+// the passed entry in the order of the outputs.
+func (r *txRelatives) Children(desc *TxDesc) []*TxDesc {
+	if children, ok := r.children[desc]; ok {
+		return children
+	}
+
+	var children []*TxDesc
+	seen := make(map[*TxDesc]struct{})
+	prevOut := wire.OutPoint{Hash: *desc.Tx.Hash()}
+	for i := range desc.Tx.MsgTx().TxOut {
+		prevOut.Index = uint32(i)
+		spender, exists := r.mp.outpoints[prevOut]
+		if !exists {
+			continue
+		}
+		child, exists := r.mp.pool[*spender.Hash()]
+		if !exists {
+			continue
+		}
+		if _, ok := seen[child]; ok {
+			continue
+		}
+		seen[child] = struct{}{}
+		children = append(children, child)
+	}
+	r.children[desc] = children
+	return children
+}
+
+// mempoolEntry returns the btcjson result describing the passed pool entry,
+// including the aggregate size and fees of its in-pool ancestors and
+// descendants.  The counts and aggregates include the entry itself.
+//
+// This function MUST be called with the mempool lock held (for reads).
+func (mp *TxPool) mempoolEntry(desc *TxDesc, bestHeight uint32, relatives *txRelatives) *btcjson.GetMempoolEntryResult {
+	// Calculate the current priority based on the inputs to the
+	// transaction.  Use zero if one or more of the input transactions
+	// can't be found for some reason.
+	tx := desc.Tx
+	var currentPriority float64
+	utxos, err := mp.fetchInputUtxos(tx)
+	if err == nil {
+		currentPriority = mining.CalcPriority(tx.MsgTx(), utxos,
+			bestHeight+1)
+	}
+
+	entry := &btcjson.GetMempoolEntryResult{
+		Size:             int32(tx.SerializeSize()),
+		Fee:              provautil.Amount(desc.Fee).ToRMG(),
+		ModifiedFee:      provautil.Amount(desc.Fee + mp.feeDeltas[*tx.Hash()]).ToRMG(),
+		FeeRate:          provautil.Amount(desc.FeePerKB).ToRMG(),
+		Time:             desc.Added.Unix(),
+		Height:           int64(desc.Height),
+		StartingPriority: desc.StartingPriority,
+		CurrentPriority:  currentPriority,
+		Depends:          make([]string, 0),
+		SpentBy:          make([]string, 0),
+	}
+	for _, parent := range relatives.Parents(desc) {
+		entry.Depends = append(entry.Depends, parent.Tx.Hash().String())
+	}
+	for _, child := range relatives.Children(desc) {
+		entry.SpentBy = append(entry.SpentBy, child.Tx.Hash().String())
+	}
+
+	// Walk the in-pool ancestors of the transaction.  A transaction is
+	// replaceable when it, or any of its unconfirmed ancestors, signals
+	// opt-in replacement through a sequence number below the maximum less
+	// one.
+	var ancestorSize, ancestorFees int64
+	visited := map[*TxDesc]struct{}{desc: {}}
+	queue := []*TxDesc{desc}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		ancestorSize += int64(cur.Tx.SerializeSize())
+		ancestorFees += cur.Fee
+		entry.AncestorCount++
+
+		for _, txIn := range cur.Tx.MsgTx().TxIn {
+			if txIn.Sequence < wire.MaxTxInSequenceNum-1 {
+				entry.BIP125Replaceable = true
+			}
+		}
+		for _, parent := range relatives.Parents(cur) {
+			if _, ok := visited[parent]; ok {
+				continue
+			}
+			visited[parent] = struct{}{}
+			queue = append(queue, parent)
+		}
+	}
+	entry.AncestorSize = ancestorSize
+	entry.AncestorFees = provautil.Amount(ancestorFees).ToRMG()
+
+	// Walk the in-pool descendants of the transaction by following the
+	// spenders of each output.
+	var descendantSize, descendantFees int64
+	visited = map[*TxDesc]struct{}{desc: {}}
+	queue = []*TxDesc{desc}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		descendantSize += int64(cur.Tx.SerializeSize())
+		descendantFees += cur.Fee
+		entry.DescendantCount++
+
+		for _, child := range relatives.Children(cur) {
+			if _, ok := visited[child]; ok {
+				continue
+			}
+			visited[child] = struct{}{}
+			queue = append(queue, child)
+		}
+	}
+	entry.DescendantSize = descendantSize
+	entry.DescendantFees = provautil.Amount(descendantFees).ToRMG()
+
+	return entry
+}
+
+// MempoolEntry returns the entry for the passed transaction hash as a fully
+// populated btcjson result.  An error is returned when the transaction is not
+// in the main pool.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) MempoolEntry(txHash *chainhash.Hash) (*btcjson.GetMempoolEntryResult, error) {
+	mp.mtx.RLock()
+	defer mp.mtx.RUnlock()
+
+	desc, exists := mp.pool[*txHash]
+	if !exists {
+		return nil, fmt.Errorf("transaction is not in the pool")
+	}
+	return mp.mempoolEntry(desc, mp.cfg.BestHeight(), newTxRelatives(mp)), nil
+}
+
 // RawMempoolVerbose returns all of the entries in the mempool as a fully
-// populated btcjson result.
+// populated btcjson result.  All entries are described from the same view of
+// the pool, so the ancestor and descendant aggregates are consistent with each
+// other.
 //
 // This function is safe for concurrent access.
 func (mp *TxPool) RawMempoolVerbose() map[string]*btcjson.GetRawMempoolVerboseResult {
@@ -1176,36 +1916,13 @@ func (mp *TxPool) RawMempoolVerbose() map[string]*btcjson.GetRawMempoolVerboseRe
 		len(mp.pool))
 	bestHeight := mp.cfg.BestHeight()
 
-	for _, desc := range mp.pool {
-		// Calculate the current priority based on the inputs to
-		// the transaction.  Use zero if one or more of the
-		// input transactions can't be found for some reason.
-		tx := desc.Tx
-		var currentPriority float64
-		utxos, err := mp.fetchInputUtxos(tx)
-		if err == nil {
-			currentPriority = mining.CalcPriority(tx.MsgTx(), utxos,
-				bestHeight+1)
-		}
-
-		mpd := &btcjson.GetRawMempoolVerboseResult{
-			Size:             int32(tx.MsgTx().SerializeSize()),
-			Fee:              provautil.Amount(desc.Fee).ToRMG(),
-			Time:             desc.Added.Unix(),
-			Height:           int64(desc.Height),
-			StartingPriority: desc.StartingPriority,
-			CurrentPriority:  currentPriority,
-			Depends:          make([]string, 0),
-		}
-		for _, txIn := range tx.MsgTx().TxIn {
-			hash := &txIn.PreviousOutPoint.Hash
-			if mp.haveTransaction(hash) {
-				mpd.Depends = append(mpd.Depends,
-					hash.String())
-			}
-		}
-
-		result[tx.Hash().String()] = mpd
+	// The relatives of every entry are indexed once and shared by the
+	// entries which describe them.
+	relatives := newTxRelatives(mp)
+	for hash, desc := range mp.pool {
+		entry := btcjson.GetRawMempoolVerboseResult(*mp.mempoolEntry(desc,
+			bestHeight, relatives))
+		result[hash.String()] = &entry
 	}
 
 	return result
@@ -1229,5 +1946,10 @@ func New(cfg *Config) *TxPool {
 		orphansByPrev:  make(map[wire.OutPoint]map[chainhash.Hash]*provautil.Tx),
 		nextExpireScan: time.Now().Add(orphanExpireScanInterval),
 		outpoints:      make(map[wire.OutPoint]*provautil.Tx),
+		feeDeltas:      make(map[chainhash.Hash]int64),
+		metrics:        newPoolMetrics(cfg.Metrics),
+		feeRates: feeRateHeap{
+			byHash: make(map[chainhash.Hash]*feeRateItem),
+		},
 	}
 }
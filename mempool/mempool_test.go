@@ -6,11 +6,14 @@
 package mempool
 
 import (
+	"bytes"
 	"encoding/hex"
 	"github.com/bitgo/prova/blockchain"
 	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/btcjson"
 	"github.com/bitgo/prova/chaincfg"
 	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/metrics"
 	"github.com/bitgo/prova/provautil"
 	"github.com/bitgo/prova/txscript"
 	"github.com/bitgo/prova/wire"
@@ -29,6 +32,7 @@ type fakeChain struct {
 	utxos          *blockchain.UtxoViewpoint
 	currentHeight  uint32
 	medianTimePast time.Time
+	timeLockFlags  txscript.ScriptFlags
 }
 
 // FetchUtxoView loads utxo details about the input transactions referenced by
@@ -133,6 +137,32 @@ func (s *fakeChain) SetMedianTimePast(mtp time.Time) {
 	s.Unlock()
 }
 
+// TimeLockFlags returns the script flags of the time lock opcodes which are
+// enforced by the fake chain instance.
+func (s *fakeChain) TimeLockFlags() txscript.ScriptFlags {
+	s.RLock()
+	flags := s.timeLockFlags
+	s.RUnlock()
+	return flags
+}
+
+// SetTimeLockFlags sets the script flags of the time lock opcodes which are
+// enforced by the fake chain instance.
+func (s *fakeChain) SetTimeLockFlags(flags txscript.ScriptFlags) {
+	s.Lock()
+	s.timeLockFlags = flags
+	s.Unlock()
+}
+
+// VerificationFlags returns the script flags of the consensus deployments which
+// are active for the next block of the fake chain instance.  All of the
+// deployments are active on the regression test network the harness uses.
+func (s *fakeChain) VerificationFlags() txscript.ScriptFlags {
+	return txscript.ScriptVerifyCheckSequenceVerify |
+		txscript.StrictEncodingVerifyFlags |
+		txscript.ScriptVerifyCheckLockTimeVerify
+}
+
 // CalcSequenceLock returns the current sequence lock for the passed
 // transaction associated with the fake chain instance.
 func (s *fakeChain) CalcSequenceLock(tx *provautil.Tx,
@@ -256,6 +286,15 @@ func (p *poolHarness) CreateSignedTx(inputs []spendableOutput, numOutputs uint32
 		})
 	}
 
+	if err := p.signTx(tx, inputs); err != nil {
+		return nil, err
+	}
+	return provautil.NewTx(tx), nil
+}
+
+// signTx signs the inputs of the passed transaction, which spend the provided
+// outputs to the payment script associated with the harness.
+func (p *poolHarness) signTx(tx *wire.MsgTx, inputs []spendableOutput) error {
 	lookupKey := func(a provautil.Address) ([]txscript.PrivateKey, error) {
 		return []txscript.PrivateKey{
 			txscript.PrivateKey{p.privKey1, true},
@@ -268,12 +307,11 @@ func (p *poolHarness) CreateSignedTx(inputs []spendableOutput, numOutputs uint32
 		sigScript, err := txscript.SignTxOutput(p.chainParams, tx,
 			i, int64(inputs[i].amount), p.payScript, txscript.SigHashAll, txscript.KeyClosure(lookupKey), nil)
 		if err != nil {
-			return nil, err
+			return err
 		}
 		tx.TxIn[i].SignatureScript = sigScript
 	}
-
-	return provautil.NewTx(tx), nil
+	return nil
 }
 
 // CreateTxChain creates a chain of zero-fee transactions (each subsequent
@@ -375,20 +413,23 @@ func newPoolHarness(chainParams *chaincfg.Params) (*poolHarness, []spendableOutp
 				MinRelayTxFee:        1000, // 1 Atom per byte
 				MaxTxVersion:         1,
 			},
-			ChainParams:      chainParams,
-			FetchUtxoView:    chain.FetchUtxoView,
-			ThreadTips:       chain.ThreadTips,
-			LastKeyID:        chain.LastKeyID,
-			TotalSupply:      chain.TotalSupply,
-			GetKeyIDs:        chain.KeyIDs,
-			GetAdminKeySets:  chain.AdminKeySets,
-			BestHeight:       chain.BestHeight,
-			MedianTimePast:   chain.MedianTimePast,
-			CalcSequenceLock: chain.CalcSequenceLock,
-			SigCache:         nil,
-			HashCache:        txscript.NewHashCache(200),
-			TimeSource:       blockchain.NewMedianTime(),
-			AddrIndex:        nil,
+			ChainParams:       chainParams,
+			FetchUtxoView:     chain.FetchUtxoView,
+			ThreadTips:        chain.ThreadTips,
+			LastKeyID:         chain.LastKeyID,
+			TotalSupply:       chain.TotalSupply,
+			GetKeyIDs:         chain.KeyIDs,
+			GetAdminKeySets:   chain.AdminKeySets,
+			BestHeight:        chain.BestHeight,
+			MedianTimePast:    chain.MedianTimePast,
+			LockTimeEvalTime:  chain.MedianTimePast,
+			TimeLockFlags:     chain.TimeLockFlags,
+			VerificationFlags: chain.VerificationFlags,
+			CalcSequenceLock:  chain.CalcSequenceLock,
+			SigCache:          nil,
+			HashCache:         txscript.NewHashCache(200),
+			TimeSource:        blockchain.NewMedianTime(),
+			AddrIndex:         nil,
 		}),
 	}
 
@@ -477,7 +518,7 @@ func TestSimpleOrphanChain(t *testing.T) {
 	// none are evicted).
 	for _, tx := range chainedTxns[1 : maxOrphans+1] {
 		acceptedTxns, err := harness.txPool.ProcessTransaction(tx, true,
-			false, 0)
+			false, 0, 0)
 		if err != nil {
 			t.Fatalf("ProcessTransaction: failed to accept valid "+
 				"orphan %v", err)
@@ -500,7 +541,7 @@ func TestSimpleOrphanChain(t *testing.T) {
 	// to ensure it has no bearing on whether or not already existing
 	// orphans in the pool are linked.
 	acceptedTxns, err := harness.txPool.ProcessTransaction(chainedTxns[0],
-		false, false, 0)
+		false, false, 0, 0)
 	if err != nil {
 		t.Fatalf("ProcessTransaction: failed to accept valid "+
 			"orphan %v", err)
@@ -514,6 +555,13 @@ func TestSimpleOrphanChain(t *testing.T) {
 		// Ensure the transaction is no longer in the orphan pool, is
 		// now in the transaction pool, and is reported as available.
 		testPoolMembership(tc, txD.Tx, false, true)
+
+		// Ensure the sequence lock calculated on acceptance is
+		// reported.
+		if txD.SequenceLock == nil {
+			t.Fatalf("ProcessTransaction: no sequence lock reported "+
+				"for accepted transaction %v", txD.Tx.Hash())
+		}
 	}
 }
 
@@ -539,7 +587,7 @@ func TestOrphanReject(t *testing.T) {
 	// Ensure orphans are rejected when the allow orphans flag is not set.
 	for _, tx := range chainedTxns[1:] {
 		acceptedTxns, err := harness.txPool.ProcessTransaction(tx, false,
-			false, 0)
+			false, 0, 0)
 		if err == nil {
 			t.Fatalf("ProcessTransaction: did not fail on orphan "+
 				"%v when allow orphans flag is false", tx.Hash())
@@ -596,7 +644,7 @@ func TestOrphanEviction(t *testing.T) {
 	// all accepted.  This will cause an eviction.
 	for _, tx := range chainedTxns[1:] {
 		acceptedTxns, err := harness.txPool.ProcessTransaction(tx, true,
-			false, 0)
+			false, 0, 0)
 		if err != nil {
 			t.Fatalf("ProcessTransaction: failed to accept valid "+
 				"orphan %v", err)
@@ -660,7 +708,7 @@ func TestBasicOrphanRemoval(t *testing.T) {
 	// none are evicted).
 	for _, tx := range chainedTxns[1 : maxOrphans+1] {
 		acceptedTxns, err := harness.txPool.ProcessTransaction(tx, true,
-			false, 0)
+			false, 0, 0)
 		if err != nil {
 			t.Fatalf("ProcessTransaction: failed to accept valid "+
 				"orphan %v", err)
@@ -735,7 +783,7 @@ func TestOrphanChainRemoval(t *testing.T) {
 	// none are evicted).
 	for _, tx := range chainedTxns[1 : maxOrphans+1] {
 		acceptedTxns, err := harness.txPool.ProcessTransaction(tx, true,
-			false, 0)
+			false, 0, 0)
 		if err != nil {
 			t.Fatalf("ProcessTransaction: failed to accept valid "+
 				"orphan %v", err)
@@ -798,7 +846,7 @@ func TestMultiInputOrphanDoubleSpend(t *testing.T) {
 	// except the final one.
 	for _, tx := range chainedTxns[1:maxOrphans] {
 		acceptedTxns, err := harness.txPool.ProcessTransaction(tx, true,
-			false, 0)
+			false, 0, 0)
 		if err != nil {
 			t.Fatalf("ProcessTransaction: failed to accept valid "+
 				"orphan %v", err)
@@ -824,7 +872,7 @@ func TestMultiInputOrphanDoubleSpend(t *testing.T) {
 		t.Fatalf("unable to create signed tx: %v", err)
 	}
 	acceptedTxns, err := harness.txPool.ProcessTransaction(doubleSpendTx,
-		true, false, 0)
+		true, false, 0, 0)
 	if err != nil {
 		t.Fatalf("ProcessTransaction: failed to accept valid orphan %v",
 			err)
@@ -843,7 +891,7 @@ func TestMultiInputOrphanDoubleSpend(t *testing.T) {
 	// This will cause the shared output to become a concrete spend which
 	// will in turn must cause the double spending orphan to be removed.
 	acceptedTxns, err = harness.txPool.ProcessTransaction(chainedTxns[0],
-		false, false, 0)
+		false, false, 0, 0)
 	if err != nil {
 		t.Fatalf("ProcessTransaction: failed to accept valid tx %v", err)
 	}
@@ -862,3 +910,837 @@ func TestMultiInputOrphanDoubleSpend(t *testing.T) {
 	// was not moved to the transaction pool.
 	testPoolMembership(tc, doubleSpendTx, false, false)
 }
+
+// TestMempoolEntry ensures the ancestor and descendant details of pool entries
+// are reported for a parent and child pair and that an entry which is removed
+// after the pool was listed is no longer reported.
+func TestMempoolEntry(t *testing.T) {
+	t.Parallel()
+
+	harness, spendableOuts, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	tc := &testContext{t, harness}
+
+	chainedTxns, err := harness.CreateTxChain(spendableOuts[0], 2)
+	if err != nil {
+		t.Fatalf("unable to create transaction chain: %v", err)
+	}
+	for _, tx := range chainedTxns {
+		_, err := harness.txPool.ProcessTransaction(tx, false, false, 0, 0)
+		if err != nil {
+			t.Fatalf("ProcessTransaction: failed to accept valid "+
+				"tx %v", err)
+		}
+		testPoolMembership(tc, tx, false, true)
+	}
+	parent, child := chainedTxns[0], chainedTxns[1]
+	parentSize := int64(parent.MsgTx().SerializeSize())
+	childSize := int64(child.MsgTx().SerializeSize())
+
+	parentEntry, err := harness.txPool.MempoolEntry(parent.Hash())
+	if err != nil {
+		t.Fatalf("MempoolEntry: unexpected error for parent: %v", err)
+	}
+	if parentEntry.AncestorCount != 1 ||
+		parentEntry.AncestorSize != parentSize ||
+		parentEntry.DescendantCount != 2 ||
+		parentEntry.DescendantSize != parentSize+childSize {
+		t.Fatalf("MempoolEntry: unexpected parent package %+v",
+			parentEntry)
+	}
+	if len(parentEntry.Depends) != 0 ||
+		!reflect.DeepEqual(parentEntry.SpentBy,
+			[]string{child.Hash().String()}) {
+		t.Fatalf("MempoolEntry: unexpected parent relations %+v",
+			parentEntry)
+	}
+
+	childEntry, err := harness.txPool.MempoolEntry(child.Hash())
+	if err != nil {
+		t.Fatalf("MempoolEntry: unexpected error for child: %v", err)
+	}
+	if childEntry.AncestorCount != 2 ||
+		childEntry.AncestorSize != parentSize+childSize ||
+		childEntry.DescendantCount != 1 ||
+		childEntry.DescendantSize != childSize {
+		t.Fatalf("MempoolEntry: unexpected child package %+v",
+			childEntry)
+	}
+	if !reflect.DeepEqual(childEntry.Depends,
+		[]string{parent.Hash().String()}) ||
+		len(childEntry.SpentBy) != 0 {
+		t.Fatalf("MempoolEntry: unexpected child relations %+v",
+			childEntry)
+	}
+	if parentEntry.BIP125Replaceable || childEntry.BIP125Replaceable {
+		t.Fatal("MempoolEntry: final sequence numbers reported as " +
+			"replaceable")
+	}
+
+	// The verbose listing must describe each entry the same way.
+	verbose := harness.txPool.RawMempoolVerbose()
+	if len(verbose) != 2 {
+		t.Fatalf("RawMempoolVerbose: got %d entries, want 2",
+			len(verbose))
+	}
+	gotChild := btcjson.GetMempoolEntryResult(*verbose[child.Hash().String()])
+	if !reflect.DeepEqual(&gotChild, childEntry) {
+		t.Fatalf("RawMempoolVerbose: mismatched child entry - got %+v, "+
+			"want %+v", gotChild, childEntry)
+	}
+
+	// Remove the child after listing the pool and ensure looking it up
+	// fails while the parent no longer reports it as a descendant.
+	hashes := harness.txPool.TxHashes()
+	harness.txPool.RemoveTransaction(child, true)
+	for _, hash := range hashes {
+		entry, err := harness.txPool.MempoolEntry(hash)
+		if hash.IsEqual(child.Hash()) {
+			if err == nil {
+				t.Fatal("MempoolEntry: removed transaction " +
+					"still reported")
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("MempoolEntry: unexpected error: %v", err)
+		}
+		if entry.DescendantCount != 1 || len(entry.SpentBy) != 0 {
+			t.Fatalf("MempoolEntry: removed child still counted "+
+				"as descendant %+v", entry)
+		}
+	}
+}
+
+// TestPrioritiseTransaction ensures fee deltas are accumulated, only change the
+// fee handed out for mining and the modified fee of the entry, and are
+// discarded once the transaction leaves the pool.
+func TestPrioritiseTransaction(t *testing.T) {
+	t.Parallel()
+
+	harness, spendableOuts, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	tc := &testContext{t, harness}
+
+	tx, err := harness.CreateSignedTx(spendableOuts[:1], 1)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	_, err = harness.txPool.ProcessTransaction(tx, false, false, 0, 0)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: failed to accept valid tx %v", err)
+	}
+	testPoolMembership(tc, tx, false, true)
+	fee := harness.txPool.TxDescs()[0].Fee
+
+	// Transactions which are not in the pool can't be prioritised.
+	err = harness.txPool.PrioritiseTransaction(&chainhash.Hash{}, 1000)
+	if err == nil {
+		t.Fatal("PrioritiseTransaction: prioritised unknown transaction")
+	}
+
+	for _, feeDelta := range []int64{1000, 500} {
+		err := harness.txPool.PrioritiseTransaction(tx.Hash(), feeDelta)
+		if err != nil {
+			t.Fatalf("PrioritiseTransaction: unexpected error: %v",
+				err)
+		}
+	}
+	descs := harness.txPool.MiningDescs()
+	if len(descs) != 1 || descs[0].Fee != fee || descs[0].FeeDelta != 1500 {
+		t.Fatalf("MiningDescs: unexpected descriptors %+v", descs)
+	}
+	if poolDesc := harness.txPool.TxDescs()[0]; poolDesc.FeeDelta != 0 {
+		t.Fatalf("TxDescs: pool descriptor modified %+v", poolDesc)
+	}
+	entry, err := harness.txPool.MempoolEntry(tx.Hash())
+	if err != nil {
+		t.Fatalf("MempoolEntry: unexpected error: %v", err)
+	}
+	if entry.Fee != provautil.Amount(fee).ToRMG() ||
+		entry.ModifiedFee != provautil.Amount(fee+1500).ToRMG() {
+		t.Fatalf("MempoolEntry: unexpected fees %+v", entry)
+	}
+
+	// Once the transaction left the pool, its fee delta must not apply when
+	// it is accepted again.
+	harness.txPool.RemoveTransaction(tx, true)
+	_, err = harness.txPool.ProcessTransaction(tx, false, false, 0, 0)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: failed to accept valid tx %v", err)
+	}
+	descs = harness.txPool.MiningDescs()
+	if len(descs) != 1 || descs[0].FeeDelta != 0 {
+		t.Fatalf("MiningDescs: fee delta survived removal %+v", descs)
+	}
+}
+
+// TestPolicyExemptions ensures the relay policy checks a transaction is exempt
+// from are skipped, while the consensus rules are still enforced.
+func TestPolicyExemptions(t *testing.T) {
+	t.Parallel()
+
+	harness, spendableOuts, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	tc := &testContext{t, harness}
+
+	// Create a transaction with an unsupported version, which is not
+	// standard.
+	tx, err := harness.CreateSignedTx(spendableOuts[:1], 1)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	msgTx := tx.MsgTx()
+	msgTx.Version = 2
+	if err := harness.signTx(msgTx, spendableOuts[:1]); err != nil {
+		t.Fatalf("unable to sign transaction: %v", err)
+	}
+	tx = provautil.NewTx(msgTx)
+
+	// The transaction is rejected without exemptions and with exemptions
+	// which don't cover standardness.
+	for _, exemptions := range []PolicyExemptions{0, ExemptRelayFee |
+		ExemptRateLimit} {
+
+		_, err = harness.txPool.ProcessTransaction(tx, false, true, 0,
+			exemptions)
+		if err == nil {
+			t.Fatalf("ProcessTransaction: accepted non-standard "+
+				"transaction with exemptions %d", exemptions)
+		}
+		code, _ := extractRejectCode(err)
+		if code != wire.RejectNonstandard {
+			t.Fatalf("ProcessTransaction: unexpected error: %v", err)
+		}
+		testPoolMembership(tc, tx, false, false)
+	}
+
+	// A transaction which violates the consensus rules is rejected even
+	// though it is exempt from all relay policy checks.
+	invalid := tx.MsgTx().Copy()
+	invalid.TxOut[0].Value++
+	if err := harness.signTx(invalid, spendableOuts[:1]); err != nil {
+		t.Fatalf("unable to sign transaction: %v", err)
+	}
+	_, err = harness.txPool.ProcessTransaction(provautil.NewTx(invalid),
+		false, true, 0, ExemptAll)
+	if err == nil {
+		t.Fatal("ProcessTransaction: accepted transaction which spends " +
+			"more than its inputs")
+	}
+
+	// The non-standard transaction is accepted when it is exempt from the
+	// standardness checks.
+	_, err = harness.txPool.ProcessTransaction(tx, false, true, 0,
+		ExemptStandardness)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: failed to accept exempt "+
+			"transaction: %v", err)
+	}
+	testPoolMembership(tc, tx, false, true)
+}
+
+// TestSaveLoad ensures the transactions saved from the pool are accepted again
+// when they are loaded, even when a child precedes its parent, along with the
+// time they were added and their fee deltas.
+func TestSaveLoad(t *testing.T) {
+	t.Parallel()
+
+	harness, spendableOuts, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	tc := &testContext{t, harness}
+
+	chainedTxns, err := harness.CreateTxChain(spendableOuts[0], 3)
+	if err != nil {
+		t.Fatalf("unable to create transaction chain: %v", err)
+	}
+	for _, tx := range chainedTxns {
+		_, err := harness.txPool.ProcessTransaction(tx, false, false, 0,
+			0)
+		if err != nil {
+			t.Fatalf("ProcessTransaction: failed to accept valid "+
+				"tx %v", err)
+		}
+	}
+	err = harness.txPool.PrioritiseTransaction(chainedTxns[1].Hash(), 1000)
+	if err != nil {
+		t.Fatalf("PrioritiseTransaction: unexpected error: %v", err)
+	}
+
+	// Make the last transaction look like it was added before its parent,
+	// which happens when the parent is returned to the pool by a
+	// reorganization.
+	added := time.Unix(1502385451, 0)
+	harness.txPool.pool[*chainedTxns[0].Hash()].Added = added.Add(time.Second)
+	harness.txPool.pool[*chainedTxns[1].Hash()].Added = added.Add(2 * time.Second)
+	harness.txPool.pool[*chainedTxns[2].Hash()].Added = added
+
+	var buf bytes.Buffer
+	if err := harness.txPool.Save(&buf); err != nil {
+		t.Fatalf("Save: unexpected error: %v", err)
+	}
+	saved := buf.Bytes()
+
+	harness.txPool.RemoveTransaction(chainedTxns[0], true)
+	for _, tx := range chainedTxns {
+		testPoolMembership(tc, tx, false, false)
+	}
+
+	// Truncated data must be rejected without loading anything.
+	_, err = harness.txPool.Load(bytes.NewReader(saved[:len(saved)-1]))
+	if err == nil {
+		t.Fatal("Load: accepted truncated data")
+	}
+	if count := harness.txPool.Count(); count != 0 {
+		t.Fatalf("Load: loaded %d transactions from truncated data",
+			count)
+	}
+
+	accepted, err := harness.txPool.Load(bytes.NewReader(saved))
+	if err != nil {
+		t.Fatalf("Load: unexpected error: %v", err)
+	}
+	if accepted != len(chainedTxns) {
+		t.Fatalf("Load: got %d accepted transactions, want %d",
+			accepted, len(chainedTxns))
+	}
+	for i, tx := range chainedTxns {
+		testPoolMembership(tc, tx, false, true)
+		desc := harness.txPool.pool[*tx.Hash()]
+		want := added.Add(time.Duration(i+1) * time.Second)
+		if i == 2 {
+			want = added
+		}
+		if !desc.Added.Equal(want) {
+			t.Fatalf("Load: transaction %d added at %v, want %v", i,
+				desc.Added, want)
+		}
+	}
+	for _, desc := range harness.txPool.MiningDescs() {
+		want := int64(0)
+		if *desc.Tx.Hash() == *chainedTxns[1].Hash() {
+			want = 1000
+		}
+		if desc.FeeDelta != want {
+			t.Fatalf("Load: transaction %v has fee delta %d, want "+
+				"%d", desc.Tx.Hash(), desc.FeeDelta, want)
+		}
+	}
+
+	// Loading transactions which are already in the pool is harmless.
+	accepted, err = harness.txPool.Load(bytes.NewReader(saved))
+	if err != nil || accepted != len(chainedTxns) ||
+		harness.txPool.Count() != len(chainedTxns) {
+
+		t.Fatalf("Load: got %d accepted transactions (err %v) when "+
+			"loading again, want %d", accepted, err, len(chainedTxns))
+	}
+}
+
+// createFundingTx adds a transaction with the passed number of outputs paying
+// the payment script associated with the harness to the harness chain's utxo
+// set and returns its outputs.
+func (p *poolHarness) createFundingTx(numOutputs uint32) (*provautil.Tx, []spendableOutput) {
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	msgTx.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Index: numOutputs},
+		Sequence:         wire.MaxTxInSequenceNum,
+	})
+	for i := uint32(0); i < numOutputs; i++ {
+		msgTx.AddTxOut(wire.NewTxOut(1e8, p.payScript))
+	}
+	tx := provautil.NewTx(msgTx)
+	p.chain.utxos.AddTxOuts(tx, p.chain.BestHeight())
+
+	outputs := make([]spendableOutput, 0, numOutputs)
+	for i := uint32(0); i < numOutputs; i++ {
+		outputs = append(outputs, txOutToSpendableOut(tx, i))
+	}
+	return tx, outputs
+}
+
+// createFeeTx creates a new signed transaction which spends the provided output
+// to a single output paying the payment script associated with the harness,
+// leaving the passed fee.
+func (p *poolHarness) createFeeTx(input spendableOutput, fee int64) (*provautil.Tx, error) {
+	tx, err := p.CreateSignedTx([]spendableOutput{input}, 1)
+	if err != nil {
+		return nil, err
+	}
+	msgTx := tx.MsgTx()
+	msgTx.TxOut[0].Value -= fee
+	if err := p.signTx(msgTx, []spendableOutput{input}); err != nil {
+		return nil, err
+	}
+	return provautil.NewTx(msgTx), nil
+}
+
+// TestResurrectTransactions ensures the transactions of disconnected blocks
+// are added back to the pool unless they conflict with the new chain or the
+// pool, in which case the pool transactions which spend them are removed too.
+func TestResurrectTransactions(t *testing.T) {
+	t.Parallel()
+
+	harness, _, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	tc := &testContext{t, harness}
+	fundingTx, outputs := harness.createFundingTx(4)
+
+	// Create the transactions of the disconnected block: a chain which
+	// spends an output a pool transaction spends too, a transaction which
+	// spends an output the new chain spent, and a chain which does not
+	// conflict.
+	var txns []*provautil.Tx
+	for _, output := range outputs[:3] {
+		chainedTxns, err := harness.CreateTxChain(output, 2)
+		if err != nil {
+			t.Fatalf("unable to create transaction chain: %v", err)
+		}
+		txns = append(txns, chainedTxns...)
+	}
+	txns = append(txns[:3], txns[4:]...)
+	poolTx, err := harness.createFeeTx(outputs[0], 1000)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	_, err = harness.txPool.ProcessTransaction(poolTx, false, false, 0, 0)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: failed to accept valid tx %v", err)
+	}
+	harness.chain.utxos.LookupEntry(fundingTx.Hash()).SpendOutput(1)
+
+	resurrected, conflicted := harness.txPool.ResurrectTransactions(txns, 0)
+	if len(resurrected) != 2 || resurrected[0].Tx != txns[3] ||
+		resurrected[1].Tx != txns[4] {
+
+		t.Fatalf("ResurrectTransactions: unexpected resurrected "+
+			"transactions %+v", resurrected)
+	}
+	if !reflect.DeepEqual(conflicted, txns[:3]) {
+		t.Fatalf("ResurrectTransactions: got conflicted transactions "+
+			"%v, want %v", conflicted, txns[:3])
+	}
+	for i, tx := range txns {
+		testPoolMembership(tc, tx, false, i >= 3)
+	}
+	testPoolMembership(tc, poolTx, false, true)
+
+	// Resurrecting the transactions again is harmless.
+	resurrected, conflicted = harness.txPool.ResurrectTransactions(txns[3:], 0)
+	if len(resurrected) != 0 || len(conflicted) != 0 ||
+		harness.txPool.Count() != 3 {
+
+		t.Fatalf("ResurrectTransactions: unexpected result when "+
+			"resurrecting again: %v, %v", resurrected, conflicted)
+	}
+}
+
+// TestResurrectedTxIndex ensures the transactions of a disconnected block are
+// resurrected without an index in a block while the transactions of the block
+// keep theirs.
+func TestResurrectedTxIndex(t *testing.T) {
+	t.Parallel()
+
+	harness, outputs, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	coinbase, err := harness.CreateCoinbaseTx(1, 1)
+	if err != nil {
+		t.Fatalf("unable to create coinbase: %v", err)
+	}
+	chainedTxns, err := harness.CreateTxChain(outputs[0], 2)
+	if err != nil {
+		t.Fatalf("unable to create transaction chain: %v", err)
+	}
+	var msgBlock wire.MsgBlock
+	msgBlock.AddTransaction(coinbase.MsgTx())
+	for _, tx := range chainedTxns {
+		msgBlock.AddTransaction(tx.MsgTx())
+	}
+	block := provautil.NewBlock(&msgBlock)
+
+	txns := block.Transactions()[1:]
+	resurrected, _ := harness.txPool.ResurrectTransactions(txns, 0)
+	if len(resurrected) != len(txns) {
+		t.Fatalf("ResurrectTransactions: got %d resurrected "+
+			"transactions, want %d", len(resurrected), len(txns))
+	}
+	for i, txD := range resurrected {
+		if !txD.Tx.Hash().IsEqual(txns[i].Hash()) {
+			t.Fatalf("ResurrectTransactions: resurrected %v, want %v",
+				txD.Tx.Hash(), txns[i].Hash())
+		}
+		if txD.Tx.Index() != provautil.TxIndexUnknown {
+			t.Fatalf("ResurrectTransactions: index of resurrected "+
+				"transaction %v is %d", txD.Tx.Hash(),
+				txD.Tx.Index())
+		}
+		if txns[i].Index() != i+1 {
+			t.Fatalf("ResurrectTransactions: index of block "+
+				"transaction %v changed to %d", txns[i].Hash(),
+				txns[i].Index())
+		}
+	}
+}
+
+// TestMaxPoolSize ensures a full pool evicts the transactions paying the lowest
+// fee rates for new transactions paying higher ones, and keeps the resurrected
+// transactions over the other ones.
+func TestMaxPoolSize(t *testing.T) {
+	t.Parallel()
+
+	harness, _, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	tc := &testContext{t, harness}
+	_, outputs := harness.createFundingTx(5)
+
+	// All of the transactions have about the same size, so their fee rates
+	// follow their fees and the pool fits two of them.
+	var txns []*provautil.Tx
+	for i, fee := range []int64{1000, 3000, 2000, 500, 0} {
+		tx, err := harness.createFeeTx(outputs[i], fee)
+		if err != nil {
+			t.Fatalf("unable to create transaction: %v", err)
+		}
+		txns = append(txns, tx)
+	}
+	harness.txPool.cfg.Policy.MaxPoolSize = int64(5 * txns[0].SerializeSize() / 2)
+	harness.txPool.metrics = newPoolMetrics(metrics.NewRegistry())
+
+	for _, tx := range txns[:2] {
+		_, err := harness.txPool.ProcessTransaction(tx, false, false, 0, 0)
+		if err != nil {
+			t.Fatalf("ProcessTransaction: failed to accept valid "+
+				"tx %v", err)
+		}
+	}
+
+	// A transaction paying a higher fee rate evicts the one paying the
+	// lowest fee rate.
+	_, err = harness.txPool.ProcessTransaction(txns[2], false, false, 0, 0)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: failed to accept valid tx %v", err)
+	}
+	testPoolMembership(tc, txns[0], false, false)
+	testPoolMembership(tc, txns[1], false, true)
+	testPoolMembership(tc, txns[2], false, true)
+
+	// A transaction paying a lower fee rate than all of the pool
+	// transactions is rejected.
+	_, err = harness.txPool.ProcessTransaction(txns[3], false, false, 0, 0)
+	if code, _ := extractRejectCode(err); code != wire.RejectInsufficientFee {
+		t.Fatalf("ProcessTransaction: unexpected error: %v", err)
+	}
+	testPoolMembership(tc, txns[3], false, false)
+
+	// A resurrected transaction is kept over the pool transactions even
+	// though it pays no fee.
+	resurrected, _ := harness.txPool.ResurrectTransactions(txns[4:], 0)
+	if len(resurrected) != 1 {
+		t.Fatalf("ResurrectTransactions: got %d resurrected "+
+			"transactions, want 1", len(resurrected))
+	}
+	testPoolMembership(tc, txns[1], false, true)
+	testPoolMembership(tc, txns[2], false, false)
+	testPoolMembership(tc, txns[4], false, true)
+
+	// The metrics of the pool track the transactions which were added and
+	// evicted.
+	m := &harness.txPool.metrics
+	if m.txs.Value() != 2 || m.bytes.Value() != harness.txPool.poolSize ||
+		m.added.Value() != 4 || m.evicted.Value() != 2 {
+
+		t.Fatalf("unexpected metrics: %d transactions, %d bytes, %d "+
+			"added, %d evicted", m.txs.Value(), m.bytes.Value(),
+			m.added.Value(), m.evicted.Value())
+	}
+}
+
+// TestMinRelayFeeRate ensures a full pool which evicts transactions raises the
+// minimum fee rate above the fee rates of the evicted transactions, rejects new
+// transactions paying less even when it has room for them, and lets the raised
+// rate decay over time.
+func TestMinRelayFeeRate(t *testing.T) {
+	t.Parallel()
+
+	harness, _, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	tc := &testContext{t, harness}
+	_, outputs := harness.createFundingTx(4)
+
+	var txns []*provautil.Tx
+	for i, fee := range []int64{1000, 3000, 2000, 1050} {
+		tx, err := harness.createFeeTx(outputs[i], fee)
+		if err != nil {
+			t.Fatalf("unable to create transaction: %v", err)
+		}
+		txns = append(txns, tx)
+	}
+	harness.txPool.cfg.Policy.MaxPoolSize = int64(5 * txns[0].SerializeSize() / 2)
+	minRelayTxFee := int64(harness.txPool.cfg.Policy.MinRelayTxFee)
+	if rate := harness.txPool.MinRelayFeeRate(); rate != minRelayTxFee {
+		t.Fatalf("MinRelayFeeRate: got %d before evicting, want %d",
+			rate, minRelayTxFee)
+	}
+
+	for _, tx := range txns[:3] {
+		_, err := harness.txPool.ProcessTransaction(tx, false, false, 0, 0)
+		if err != nil {
+			t.Fatalf("ProcessTransaction: failed to accept valid "+
+				"tx %v", err)
+		}
+	}
+	testPoolMembership(tc, txns[0], false, false)
+
+	// Evicting the first transaction raises the minimum fee rate above its
+	// fee rate.
+	evictedRate := 1000 * 1000 / int64(txns[0].SerializeSize())
+	wantRate := evictedRate + minFeeRateIncrement
+	rate := harness.txPool.MinRelayFeeRate()
+	if rate <= evictedRate || rate > wantRate {
+		t.Fatalf("MinRelayFeeRate: got %d after evicting, want %d",
+			rate, wantRate)
+	}
+
+	// A transaction paying less than the raised rate is rejected although
+	// the pool has room for it.
+	harness.txPool.RemoveTransaction(txns[1], false)
+	_, err = harness.txPool.ProcessTransaction(txns[3], false, false, 0, 0)
+	if code, _ := extractRejectCode(err); code != wire.RejectInsufficientFee {
+		t.Fatalf("ProcessTransaction: unexpected error: %v", err)
+	}
+	testPoolMembership(tc, txns[3], false, false)
+
+	// The raised rate decays back to the minimum relay fee, after which the
+	// transaction is accepted.  Since the pool is less than half full, the
+	// rate decays four times faster.
+	harness.txPool.mtx.Lock()
+	rate = harness.txPool.minRelayFeeRate(time.Now().Add(minFeeRateHalfLife / 4))
+	harness.txPool.mtx.Unlock()
+	if rate > wantRate/2 || rate <= minRelayTxFee {
+		t.Fatalf("minRelayFeeRate: got %d after a half-life, want "+
+			"a decayed rate", rate)
+	}
+	harness.txPool.mtx.Lock()
+	rate = harness.txPool.minRelayFeeRate(time.Now().Add(10 * minFeeRateHalfLife))
+	harness.txPool.mtx.Unlock()
+	if rate != minRelayTxFee {
+		t.Fatalf("minRelayFeeRate: got %d after decaying, want %d",
+			rate, minRelayTxFee)
+	}
+	_, err = harness.txPool.ProcessTransaction(txns[3], false, false, 0, 0)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: failed to accept valid tx %v", err)
+	}
+	testPoolMembership(tc, txns[3], false, true)
+}
+
+// TestMaxPoolSizePrioritised ensures a full pool evicts transactions by their
+// fee rates including the fee deltas of prioritised transactions.
+func TestMaxPoolSizePrioritised(t *testing.T) {
+	t.Parallel()
+
+	harness, _, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	tc := &testContext{t, harness}
+	_, outputs := harness.createFundingTx(3)
+
+	var txns []*provautil.Tx
+	for i, fee := range []int64{1000, 3000, 4000} {
+		tx, err := harness.createFeeTx(outputs[i], fee)
+		if err != nil {
+			t.Fatalf("unable to create transaction: %v", err)
+		}
+		txns = append(txns, tx)
+	}
+	harness.txPool.cfg.Policy.MaxPoolSize = int64(5 * txns[0].SerializeSize() / 2)
+
+	for _, tx := range txns[:2] {
+		_, err := harness.txPool.ProcessTransaction(tx, false, false, 0, 0)
+		if err != nil {
+			t.Fatalf("ProcessTransaction: failed to accept valid "+
+				"tx %v", err)
+		}
+	}
+
+	// Prioritising the transaction paying the lowest fee makes the other
+	// pool transaction the one which is evicted.
+	err = harness.txPool.PrioritiseTransaction(txns[0].Hash(), 5000)
+	if err != nil {
+		t.Fatalf("PrioritiseTransaction: unexpected error: %v", err)
+	}
+	_, err = harness.txPool.ProcessTransaction(txns[2], false, false, 0, 0)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: failed to accept valid tx %v", err)
+	}
+	testPoolMembership(tc, txns[0], false, true)
+	testPoolMembership(tc, txns[1], false, false)
+	testPoolMembership(tc, txns[2], false, true)
+}
+
+// TestMaxPoolSizeKeepsParents ensures a transaction paying a high fee rate
+// never evicts the pool transactions it depends on to make room for itself.
+func TestMaxPoolSizeKeepsParents(t *testing.T) {
+	t.Parallel()
+
+	harness, _, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	tc := &testContext{t, harness}
+	_, outputs := harness.createFundingTx(2)
+
+	var txns []*provautil.Tx
+	for i, fee := range []int64{500, 3000} {
+		tx, err := harness.createFeeTx(outputs[i], fee)
+		if err != nil {
+			t.Fatalf("unable to create transaction: %v", err)
+		}
+		txns = append(txns, tx)
+	}
+	child, err := harness.createFeeTx(txOutToSpendableOut(txns[0], 0), 5000)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	harness.txPool.cfg.Policy.MaxPoolSize = int64(5 * txns[0].SerializeSize() / 2)
+
+	for _, tx := range txns {
+		_, err := harness.txPool.ProcessTransaction(tx, false, false, 0, 0)
+		if err != nil {
+			t.Fatalf("ProcessTransaction: failed to accept valid "+
+				"tx %v", err)
+		}
+	}
+
+	// The child of the transaction paying the lowest fee rate evicts the
+	// other pool transaction rather than its parent.
+	_, err = harness.txPool.ProcessTransaction(child, false, false, 0, 0)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: failed to accept valid tx %v", err)
+	}
+	testPoolMembership(tc, txns[0], false, true)
+	testPoolMembership(tc, txns[1], false, false)
+	testPoolMembership(tc, child, false, true)
+}
+
+// TestTimeLockOutputs ensures time-locked outputs are only accepted once their
+// locks are enforced and the ones locked by a lock time can only be spent by
+// transactions which are final past the lock height.
+func TestTimeLockOutputs(t *testing.T) {
+	t.Parallel()
+
+	harness, _, err := newPoolHarness(&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create test pool: %v", err)
+	}
+	tc := &testContext{t, harness}
+	_, outputs := harness.createFundingTx(1)
+
+	// Create a transaction which pays an output the harness can spend in a
+	// block after the lock height.
+	lockHeight := harness.chain.BestHeight() + 2
+	lockScript, err := txscript.NewScriptBuilder().
+		AddInt64(int64(lockHeight)).
+		AddOp(txscript.OP_CHECKLOCKTIMEVERIFY).AddOp(txscript.OP_DROP).
+		AddOps(harness.payScript).Script()
+	if err != nil {
+		t.Fatalf("unable to create time lock script: %v", err)
+	}
+	lockMsgTx := wire.NewMsgTx(wire.TxVersion)
+	lockMsgTx.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: outputs[0].outPoint,
+		Sequence:         wire.MaxTxInSequenceNum,
+	})
+	lockMsgTx.AddTxOut(wire.NewTxOut(int64(outputs[0].amount)-1000,
+		lockScript))
+	if err := harness.signTx(lockMsgTx, outputs); err != nil {
+		t.Fatalf("unable to sign transaction: %v", err)
+	}
+	lockTx := provautil.NewTx(lockMsgTx)
+
+	// The output is rejected until the lock is enforced.
+	_, err = harness.txPool.ProcessTransaction(lockTx, false, false, 0, 0)
+	if rerr, ok := err.(RuleError); !ok {
+		t.Fatalf("ProcessTransaction: accepted time-locked output "+
+			"before the lock is enforced: %v", err)
+	} else if cerr, ok := rerr.Err.(blockchain.RuleError); !ok ||
+		cerr.ErrorCode != blockchain.ErrInvalidTx {
+
+		t.Fatalf("ProcessTransaction: unexpected error %v", err)
+	}
+	testPoolMembership(tc, lockTx, false, false)
+
+	harness.chain.SetTimeLockFlags(txscript.ScriptVerifyCheckLockTimeVerify)
+	_, err = harness.txPool.ProcessTransaction(lockTx, false, false, 0, 0)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: failed to accept time-locked "+
+			"output: %v", err)
+	}
+	testPoolMembership(tc, lockTx, false, true)
+
+	// spendLockTx returns a transaction with the passed lock time which
+	// spends the time-locked output.
+	spendLockTx := func(lockTime uint32) *provautil.Tx {
+		msgTx := wire.NewMsgTx(wire.TxVersion)
+		msgTx.LockTime = lockTime
+		msgTx.AddTxIn(&wire.TxIn{
+			PreviousOutPoint: wire.OutPoint{Hash: *lockTx.Hash()},
+			Sequence:         wire.MaxTxInSequenceNum - 1,
+		})
+		msgTx.AddTxOut(wire.NewTxOut(lockMsgTx.TxOut[0].Value-1000,
+			harness.payScript))
+		lookupKey := func(a provautil.Address) ([]txscript.PrivateKey, error) {
+			return []txscript.PrivateKey{
+				{Key: harness.privKey1, Compressed: true},
+				{Key: harness.privKey2, Compressed: true},
+			}, nil
+		}
+		sigScript, err := txscript.SignTxOutput(harness.chainParams,
+			msgTx, 0, lockMsgTx.TxOut[0].Value, lockScript,
+			txscript.SigHashAll, txscript.KeyClosure(lookupKey), nil)
+		if err != nil {
+			t.Fatalf("unable to sign transaction: %v", err)
+		}
+		msgTx.TxIn[0].SignatureScript = sigScript
+		return provautil.NewTx(msgTx)
+	}
+
+	// A transaction which is not final in the next block and one whose lock
+	// time is before the lock height are both rejected.
+	for _, lockTime := range []uint32{lockHeight, lockHeight - 2} {
+		tx := spendLockTx(lockTime)
+		_, err := harness.txPool.ProcessTransaction(tx, false, false, 0, 0)
+		if err == nil {
+			t.Fatalf("ProcessTransaction: accepted spend of "+
+				"time-locked output with lock time %d", lockTime)
+		}
+		testPoolMembership(tc, tx, false, false)
+	}
+
+	// The output can be spent once the next block is past the lock height.
+	harness.chain.SetHeight(lockHeight)
+	tx := spendLockTx(lockHeight)
+	_, err = harness.txPool.ProcessTransaction(tx, false, false, 0, 0)
+	if err != nil {
+		t.Fatalf("ProcessTransaction: failed to accept spend of "+
+			"time-locked output: %v", err)
+	}
+	testPoolMembership(tc, tx, false, true)
+}
@@ -0,0 +1,352 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mempool
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/wire"
+)
+
+const (
+	// mempoolSaveVersion is the version of the serialized memory pool
+	// written by Save.
+	mempoolSaveVersion = 1
+
+	// feeEstimatorSaveVersion is the version of the serialized fee
+	// estimator written by Save.
+	feeEstimatorSaveVersion = 1
+
+	// maxSavedEntries is the maximum number of entries of any kind in a
+	// serialized memory pool or fee estimator.  It protects against
+	// allocating huge amounts of memory when reading corrupted data.
+	maxSavedEntries = 1000000
+)
+
+// readCount reads an entry count and ensures it does not exceed
+// maxSavedEntries.
+func readCount(r io.Reader) (uint32, error) {
+	var count uint32
+	if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
+		return 0, err
+	}
+	if count > maxSavedEntries {
+		return 0, fmt.Errorf("entry count %d exceeds the maximum of %d",
+			count, maxSavedEntries)
+	}
+	return count, nil
+}
+
+// Save writes the transactions in the main pool along with the time they were
+// added and their fee deltas to the passed writer so they can be reloaded with
+// Load, for example when the node is restarted.  The transactions are written
+// in the order they were added, so parents usually precede their children.
+// Orphans are not saved.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) Save(w io.Writer) error {
+	mp.mtx.RLock()
+	defer mp.mtx.RUnlock()
+
+	descs := make([]*TxDesc, 0, len(mp.pool))
+	for _, desc := range mp.pool {
+		descs = append(descs, desc)
+	}
+	sort.Slice(descs, func(i, j int) bool {
+		return descs[i].Added.Before(descs[j].Added)
+	})
+
+	header := []uint32{mempoolSaveVersion, uint32(len(descs))}
+	if err := binary.Write(w, binary.LittleEndian, header); err != nil {
+		return err
+	}
+	for _, desc := range descs {
+		added := desc.Added.Unix()
+		if err := binary.Write(w, binary.LittleEndian, added); err != nil {
+			return err
+		}
+		if err := desc.Tx.MsgTx().Serialize(w); err != nil {
+			return err
+		}
+	}
+
+	numDeltas := uint32(len(mp.feeDeltas))
+	if err := binary.Write(w, binary.LittleEndian, numDeltas); err != nil {
+		return err
+	}
+	for hash, delta := range mp.feeDeltas {
+		if _, err := w.Write(hash[:]); err != nil {
+			return err
+		}
+		if err := binary.Write(w, binary.LittleEndian, delta); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Load reads the transactions written by Save from the passed reader and
+// processes them as if they were just received, so transactions which have
+// been confirmed, double spent or no longer pass the policy in the meantime are
+// rejected.  The accepted transactions keep the time they were originally added
+// to the pool and their fee deltas.  The number of saved transactions which are
+// in the pool afterwards is returned.
+//
+// This function is safe for concurrent access.
+func (mp *TxPool) Load(r io.Reader) (int, error) {
+	var version uint32
+	if err := binary.Read(r, binary.LittleEndian, &version); err != nil {
+		return 0, err
+	}
+	if version != mempoolSaveVersion {
+		return 0, fmt.Errorf("unknown mempool version %d", version)
+	}
+	numTxns, err := readCount(r)
+	if err != nil {
+		return 0, err
+	}
+
+	// Read all transactions before processing any of them so a truncated
+	// file does not leave a partially loaded pool behind.
+	txns := make([]*provautil.Tx, 0, numTxns)
+	added := make([]int64, 0, numTxns)
+	for i := uint32(0); i < numTxns; i++ {
+		var addedUnix int64
+		err := binary.Read(r, binary.LittleEndian, &addedUnix)
+		if err != nil {
+			return 0, err
+		}
+		var msgTx wire.MsgTx
+		if err := msgTx.Deserialize(r); err != nil {
+			return 0, err
+		}
+		txns = append(txns, provautil.NewTx(&msgTx))
+		added = append(added, addedUnix)
+	}
+	numDeltas, err := readCount(r)
+	if err != nil {
+		return 0, err
+	}
+	deltas := make(map[chainhash.Hash]int64, numDeltas)
+	for i := uint32(0); i < numDeltas; i++ {
+		var hash chainhash.Hash
+		if _, err := io.ReadFull(r, hash[:]); err != nil {
+			return 0, err
+		}
+		var delta int64
+		if err := binary.Read(r, binary.LittleEndian, &delta); err != nil {
+			return 0, err
+		}
+		deltas[hash] = delta
+	}
+
+	// Orphans are allowed since a child may have been added before its
+	// parent when the parent was returned to the pool by a reorganization.
+	for _, tx := range txns {
+		_, err := mp.ProcessTransaction(tx, true, false, 0, 0)
+		if err != nil {
+			log.Debugf("Saved transaction %v rejected: %v", tx.Hash(),
+				err)
+		}
+	}
+
+	mp.mtx.Lock()
+	accepted := 0
+	for i, tx := range txns {
+		desc, ok := mp.pool[*tx.Hash()]
+		if !ok {
+			continue
+		}
+		desc.Added = time.Unix(added[i], 0)
+		accepted++
+	}
+	for hash, delta := range deltas {
+		if _, ok := mp.pool[hash]; ok {
+			mp.setFeeDelta(&hash, delta)
+		}
+	}
+	mp.mtx.Unlock()
+
+	// Orphans left over have a parent which was not restored.
+	for _, tx := range txns {
+		mp.RemoveOrphan(tx)
+	}
+	return accepted, nil
+}
+
+// writeObservedTransaction writes the passed observed transaction to w.
+func writeObservedTransaction(w io.Writer, o *observedTransaction) error {
+	if _, err := w.Write(o.hash[:]); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.LittleEndian, struct {
+		FeeRate  int64
+		Observed uint32
+		Mined    uint32
+	}{int64(o.feeRate), o.observed, o.mined})
+}
+
+// readObservedTransaction reads an observed transaction written by
+// writeObservedTransaction from r.  Transactions which were already read are
+// looked up in the passed map so every transaction is represented by a single
+// instance, which Rollback relies on.
+func readObservedTransaction(r io.Reader, read map[chainhash.Hash]*observedTransaction) (*observedTransaction, error) {
+	var o observedTransaction
+	if _, err := io.ReadFull(r, o.hash[:]); err != nil {
+		return nil, err
+	}
+	var fields struct {
+		FeeRate  int64
+		Observed uint32
+		Mined    uint32
+	}
+	if err := binary.Read(r, binary.LittleEndian, &fields); err != nil {
+		return nil, err
+	}
+	if existing, ok := read[o.hash]; ok {
+		return existing, nil
+	}
+	o.feeRate = provautil.Amount(fields.FeeRate)
+	o.observed = fields.Observed
+	o.mined = fields.Mined
+	read[o.hash] = &o
+	return &o, nil
+}
+
+// Save writes the state of the fee estimator to the passed writer so it can be
+// restored with RestoreFeeEstimator, for example when the node is restarted.
+//
+// This function is safe for concurrent access.
+func (ef *FeeEstimator) Save(w io.Writer) error {
+	ef.mtx.RLock()
+	defer ef.mtx.RUnlock()
+
+	header := []uint32{feeEstimatorSaveVersion, ef.maxRollback,
+		ef.minRegisteredBlocks, ef.numBlocksRegistered,
+		ef.lastKnownHeight}
+	if err := binary.Write(w, binary.LittleEndian, header); err != nil {
+		return err
+	}
+
+	writeTxns := func(txns []*observedTransaction) error {
+		count := uint32(len(txns))
+		if err := binary.Write(w, binary.LittleEndian, count); err != nil {
+			return err
+		}
+		for _, o := range txns {
+			if err := writeObservedTransaction(w, o); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	observed := make([]*observedTransaction, 0, len(ef.observed))
+	for _, o := range ef.observed {
+		observed = append(observed, o)
+	}
+	if err := writeTxns(observed); err != nil {
+		return err
+	}
+	for _, bin := range ef.bin {
+		if err := writeTxns(bin); err != nil {
+			return err
+		}
+	}
+
+	numDropped := uint32(len(ef.dropped))
+	if err := binary.Write(w, binary.LittleEndian, numDropped); err != nil {
+		return err
+	}
+	for _, registered := range ef.dropped {
+		if _, err := w.Write(registered.hash[:]); err != nil {
+			return err
+		}
+		if err := writeTxns(registered.transactions); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RestoreFeeEstimator returns a fee estimator with the state written by Save
+// read from the passed reader.
+func RestoreFeeEstimator(r io.Reader) (*FeeEstimator, error) {
+	var header [5]uint32
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return nil, err
+	}
+	if header[0] != feeEstimatorSaveVersion {
+		return nil, fmt.Errorf("unknown fee estimator version %d",
+			header[0])
+	}
+	ef := NewFeeEstimator(header[1], header[2])
+	ef.numBlocksRegistered = header[3]
+	ef.lastKnownHeight = header[4]
+
+	read := make(map[chainhash.Hash]*observedTransaction)
+	readTxns := func() ([]*observedTransaction, error) {
+		count, err := readCount(r)
+		if err != nil {
+			return nil, err
+		}
+		var txns []*observedTransaction
+		for i := uint32(0); i < count; i++ {
+			o, err := readObservedTransaction(r, read)
+			if err != nil {
+				return nil, err
+			}
+			txns = append(txns, o)
+		}
+		return txns, nil
+	}
+	observed, err := readTxns()
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range observed {
+		ef.observed[o.hash] = o
+	}
+	for i := range ef.bin {
+		if ef.bin[i], err = readTxns(); err != nil {
+			return nil, err
+		}
+	}
+
+	numDropped, err := readCount(r)
+	if err != nil {
+		return nil, err
+	}
+	if numDropped > ef.maxRollback {
+		return nil, fmt.Errorf("%d registered blocks exceed the maximum "+
+			"rollback of %d", numDropped, ef.maxRollback)
+	}
+	for i := uint32(0); i < numDropped; i++ {
+		var registered registeredBlock
+		if _, err := io.ReadFull(r, registered.hash[:]); err != nil {
+			return nil, err
+		}
+		if registered.transactions, err = readTxns(); err != nil {
+			return nil, err
+		}
+		ef.dropped = append(ef.dropped, &registered)
+	}
+	return ef, nil
+}
+
+// LastKnownHeight returns the height of the most recently registered block.
+//
+// This function is safe for concurrent access.
+func (ef *FeeEstimator) LastKnownHeight() uint32 {
+	ef.mtx.RLock()
+	defer ef.mtx.RUnlock()
+
+	return ef.lastKnownHeight
+}
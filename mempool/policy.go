@@ -7,6 +7,7 @@ package mempool
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/bitgo/prova/blockchain"
@@ -52,6 +53,50 @@ const (
 	DefaultMinRelayTxFee = provautil.Amount(0)
 )
 
+// PolicyExemptions is a set of relay policy checks which are skipped for a
+// transaction, typically because it was relayed by a trusted peer.  Consensus
+// rules are always enforced regardless of the exemptions.
+type PolicyExemptions uint8
+
+const (
+	// ExemptRelayFee skips the minimum relay fee and the priority checks.
+	ExemptRelayFee PolicyExemptions = 1 << iota
+
+	// ExemptStandardness skips the checks for standard transactions and
+	// standard inputs.
+	ExemptStandardness
+
+	// ExemptRateLimit skips the rate limiting of free transactions.
+	ExemptRateLimit
+
+	// ExemptAll skips all of the above relay policy checks.
+	ExemptAll = ExemptRelayFee | ExemptStandardness | ExemptRateLimit
+)
+
+// policyExemptionNames maps the names used to configure the relay policy
+// exemptions to the exemptions.
+var policyExemptionNames = map[string]PolicyExemptions{
+	"relayfee":    ExemptRelayFee,
+	"nonstandard": ExemptStandardness,
+	"ratelimit":   ExemptRateLimit,
+	"all":         ExemptAll,
+}
+
+// ParsePolicyExemptions parses a comma separated list of relay policy
+// exemption names, which are relayfee, nonstandard, ratelimit and all.
+func ParsePolicyExemptions(names string) (PolicyExemptions, error) {
+	var exemptions PolicyExemptions
+	for _, name := range strings.Split(names, ",") {
+		exemption, ok := policyExemptionNames[strings.TrimSpace(name)]
+		if !ok {
+			return 0, fmt.Errorf("unknown relay policy exemption %q",
+				name)
+		}
+		exemptions |= exemption
+	}
+	return exemptions, nil
+}
+
 // calcMinRequiredTxRelayFee returns the minimum transaction fee required for a
 // transaction with the passed serialized size to be accepted into the memory
 // pool and relayed.
@@ -105,6 +150,8 @@ func checkInputsStandard(tx *provautil.Tx, utxoView *blockchain.UtxoViewpoint) e
 		case txscript.ProvaTy:
 			fallthrough
 		case txscript.GeneralProvaTy:
+			fallthrough
+		case txscript.ProvaTimeLockTy:
 			break
 		case txscript.ProvaAdminTy:
 			sigPops, err := txscript.ParseScript(txIn.SignatureScript)
@@ -170,9 +217,17 @@ func checkPkScriptStandard(pkScript []byte, scriptClass txscript.ScriptClass) er
 		fallthrough
 	case txscript.GeneralProvaTy:
 		break
+	case txscript.ProvaTimeLockTy:
+		// Time-locked outputs are only accepted once their locks are
+		// enforced, which is checked along with the consensus rules.
+		break
 	case txscript.ProvaAdminTy:
 		// TODO(prova): apply validation rules here
 		break
+	case txscript.ProvaAdminOpTy:
+		// Admin operations are validated along with the admin thread
+		// of the transaction carrying them.
+		break
 	case txscript.NonStandardTy:
 		return txRuleError(wire.RejectNonstandard,
 			"non-standard script form")
@@ -251,6 +306,20 @@ func isDust(txOut *wire.TxOut, minRelayTxFee provautil.Amount) bool {
 	return txOut.Value*1000/(3*int64(totalSize)) < int64(minRelayTxFee)
 }
 
+// CheckTransactionFinal returns an error when the passed transaction is not
+// finalized for inclusion in a block at the passed height with its time based
+// lock time evaluated against the passed time.  The pool evaluates lock times
+// against the time returned by the LockTimeEvalTime function of its config, so
+// this allows callers such as wallets to predict whether a transaction will be
+// accepted at a given time.
+func CheckTransactionFinal(tx *provautil.Tx, height uint32, lockTimeEvalTime time.Time) error {
+	if !blockchain.IsFinalizedTransaction(tx, height, lockTimeEvalTime) {
+		return txRuleError(wire.RejectNonstandard,
+			"transaction is not finalized")
+	}
+	return nil
+}
+
 // checkTransactionStandard performs a series of checks on a transaction to
 // ensure it is a "standard" transaction.  A standard transaction is one that
 // conforms to several additional limiting cases over what is considered a
@@ -262,7 +331,7 @@ func isDust(txOut *wire.TxOut, minRelayTxFee provautil.Amount) bool {
 // validation code in CheckTransactionSanity() of validate.go
 // TODO(prova): extract functionality into admin tx validator.
 func checkTransactionStandard(tx *provautil.Tx, height uint32,
-	medianTimePast time.Time, minRelayTxFee provautil.Amount,
+	lockTimeEvalTime time.Time, minRelayTxFee provautil.Amount,
 	maxTxVersion int32) error {
 	// The transaction must be a currently supported version.
 	msgTx := tx.MsgTx()
@@ -275,9 +344,8 @@ func checkTransactionStandard(tx *provautil.Tx, height uint32,
 
 	// The transaction must be finalized to be standard and therefore
 	// considered for inclusion in a block.
-	if !blockchain.IsFinalizedTransaction(tx, height, medianTimePast) {
-		return txRuleError(wire.RejectNonstandard,
-			"transaction is not finalized")
+	if err := CheckTransactionFinal(tx, height, lockTimeEvalTime); err != nil {
+		return err
 	}
 
 	// Since extremely large transactions with a lot of inputs can cost
@@ -355,7 +423,8 @@ func checkTransactionStandard(tx *provautil.Tx, height uint32,
 		// Accumulate the number of outputs which only carry data.  For
 		// all other script types, ensure the output value is not
 		// "dust".
-		if scriptClass == txscript.NullDataTy {
+		if scriptClass == txscript.NullDataTy ||
+			scriptClass == txscript.ProvaAdminOpTy {
 			numNullDataOutputs++
 		} else if !tx.IsCoinbase() && !hasAdminOut && isDust(txOut, minRelayTxFee) {
 			str := fmt.Sprintf("transaction output %d: payment "+
@@ -132,6 +132,15 @@ func TestCheckPkScriptStandard(t *testing.T) {
 				AddOp(txscript.OP_3).AddOp(txscript.OP_CHECKSAFEMULTISIG),
 			true,
 		},
+		{
+			"time-locked 2 of pkHash, keyID1, keyID2",
+			txscript.NewScriptBuilder().AddInt64(500000).
+				AddOp(txscript.OP_CHECKLOCKTIMEVERIFY).AddOp(txscript.OP_DROP).
+				AddOp(txscript.OP_2).AddData(pubKeyHashes[0]).
+				AddInt64(int64(keyId1)).AddInt64(int64(keyId2)).
+				AddOp(txscript.OP_3).AddOp(txscript.OP_CHECKSAFEMULTISIG),
+			true,
+		},
 		{
 			"2 of pkHash, keyID1",
 			txscript.NewScriptBuilder().AddOp(txscript.OP_2).
@@ -281,6 +290,42 @@ func TestDust(t *testing.T) {
 	}
 }
 
+// TestCheckTransactionFinal ensures time based lock times are evaluated against
+// the explicitly passed time, so callers can predict when a transaction will be
+// accepted.
+func TestCheckTransactionFinal(t *testing.T) {
+	lockTime := time.Unix(1500000000, 0)
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Index: 1},
+		Sequence:         wire.MaxTxInSequenceNum - 1,
+	})
+	tx.AddTxOut(wire.NewTxOut(1000, []byte{0x51}))
+	tx.LockTime = uint32(lockTime.Unix())
+
+	tests := []struct {
+		name     string
+		evalTime time.Time
+		final    bool
+	}{
+		{"before lock time", lockTime.Add(-time.Second), false},
+		{"at lock time", lockTime, false},
+		{"after lock time", lockTime.Add(time.Second), true},
+	}
+	for _, test := range tests {
+		err := CheckTransactionFinal(provautil.NewTx(tx), 100, test.evalTime)
+		if test.final && err != nil {
+			t.Errorf("CheckTransactionFinal (%s): unexpected error: %v",
+				test.name, err)
+			continue
+		}
+		if !test.final && err == nil {
+			t.Errorf("CheckTransactionFinal (%s): did not receive "+
+				"expected error", test.name)
+		}
+	}
+}
+
 // TestCheckTransactionStandard tests the checkTransactionStandard API.
 func TestCheckTransactionStandard(t *testing.T) {
 	// Create some dummy, but otherwise standard, data for transactions.
@@ -947,3 +992,39 @@ func TestCheckAdminTransactionStandard(t *testing.T) {
 		}
 	}
 }
+
+// TestParsePolicyExemptions ensures lists of relay policy exemption names are
+// parsed as expected.
+func TestParsePolicyExemptions(t *testing.T) {
+	tests := []struct {
+		names      string
+		exemptions PolicyExemptions
+		valid      bool
+	}{
+		{"relayfee", ExemptRelayFee, true},
+		{"nonstandard,ratelimit", ExemptStandardness | ExemptRateLimit, true},
+		{"relayfee, nonstandard", ExemptRelayFee | ExemptStandardness, true},
+		{"all", ExemptAll, true},
+		{"relayfee,noban", 0, false},
+		{"", 0, false},
+	}
+	for _, test := range tests {
+		exemptions, err := ParsePolicyExemptions(test.names)
+		if !test.valid {
+			if err == nil {
+				t.Errorf("ParsePolicyExemptions(%q): did not "+
+					"receive expected error", test.names)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParsePolicyExemptions(%q): unexpected error: %v",
+				test.names, err)
+			continue
+		}
+		if exemptions != test.exemptions {
+			t.Errorf("ParsePolicyExemptions(%q): got %d, want %d",
+				test.names, exemptions, test.exemptions)
+		}
+	}
+}
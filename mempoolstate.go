@@ -0,0 +1,129 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+
+	"github.com/bitgo/prova/mempool"
+)
+
+const (
+	// mempoolFilename is the name of the file in the data directory the
+	// mempool is saved to on shutdown.
+	mempoolFilename = "mempool.dat"
+
+	// feeEstimatesFilename is the name of the file in the data directory
+	// the state of the fee estimator is saved to on shutdown.
+	feeEstimatesFilename = "fee_estimates.dat"
+)
+
+// writeFileAtomic writes the file at the passed path with the passed function.
+// The data is written to a temporary file first which then replaces the file,
+// so an interrupted write never leaves a truncated file behind.
+func writeFileAtomic(path string, write func(w io.Writer) error) error {
+	tmpFile := path + ".new"
+	f, err := os.Create(tmpFile)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	err = write(w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpFile, path)
+	}
+	if err != nil {
+		os.Remove(tmpFile)
+	}
+	return err
+}
+
+// saveMempool saves the transactions in the passed mempool to the file at the
+// passed path so they are restored on the next start.
+func saveMempool(txPool *mempool.TxPool, path string) error {
+	count := txPool.Count()
+	if err := writeFileAtomic(path, txPool.Save); err != nil {
+		return err
+	}
+	srvrLog.Infof("Saved %d mempool transactions to %s", count, path)
+	return nil
+}
+
+// loadMempool loads the transactions saved to the file at the passed path into
+// the passed mempool.  Failures are logged since the node works fine with an
+// empty mempool.
+func loadMempool(txPool *mempool.TxPool, path string) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		srvrLog.Errorf("Unable to open %s: %v", path, err)
+		return
+	}
+	defer f.Close()
+
+	accepted, err := txPool.Load(bufio.NewReader(f))
+	if err != nil {
+		srvrLog.Errorf("Unable to load the mempool from %s: %v", path,
+			err)
+		return
+	}
+	srvrLog.Infof("Loaded %d mempool transactions from %s", accepted, path)
+}
+
+// saveFeeEstimator saves the state of the passed fee estimator to the file at
+// the passed path so it is restored on the next start.
+func saveFeeEstimator(ef *mempool.FeeEstimator, path string) error {
+	return writeFileAtomic(path, ef.Save)
+}
+
+// loadFeeEstimator returns the fee estimator saved to the file at the passed
+// path.  A new fee estimator is returned when there is no usable saved one,
+// including when it was saved at a height above the passed best height of the
+// chain.
+func loadFeeEstimator(path string, bestHeight uint32) *mempool.FeeEstimator {
+	newFeeEstimator := func() *mempool.FeeEstimator {
+		return mempool.NewFeeEstimator(
+			mempool.DefaultEstimateFeeMaxRollback,
+			mempool.DefaultEstimateFeeMinRegisteredBlocks)
+	}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return newFeeEstimator()
+	}
+	if err != nil {
+		srvrLog.Errorf("Unable to open %s: %v", path, err)
+		return newFeeEstimator()
+	}
+	defer f.Close()
+
+	ef, err := mempool.RestoreFeeEstimator(bufio.NewReader(f))
+	if err != nil {
+		srvrLog.Errorf("Unable to restore the fee estimator from %s: %v",
+			path, err)
+		return newFeeEstimator()
+	}
+	if ef.LastKnownHeight() > bestHeight {
+		srvrLog.Warnf("Discarding the fee estimator saved at height %d "+
+			"above the best height %d", ef.LastKnownHeight(),
+			bestHeight)
+		return newFeeEstimator()
+	}
+	srvrLog.Debugf("Restored the fee estimator from %s", path)
+	return ef
+}
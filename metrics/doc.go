@@ -0,0 +1,29 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+/*
+Package metrics implements a lightweight registry of counters, gauges and
+histograms which describe the state of the subsystems of a node.
+
+Overview
+
+Operators want to observe values such as the size of the memory pool, the time
+it takes to build block templates and validate blocks, the number of connected
+peers and the depth of chain reorganizations without parsing logs.  Subsystems
+register their metrics with a Registry once, when they are created, and update
+them with atomic operations afterwards, so updating a metric on a hot path
+neither takes locks nor allocates.
+
+The methods of all metric types are safe to call on nil metrics, in which case
+they do nothing.  Likewise, registering a metric with a nil registry returns a
+nil metric.  This allows subsystems to be created without a registry, such as
+in tests, without checking whether metrics are enabled before each update.
+
+Exposition
+
+The registry writes the current values of its metrics in the Prometheus text
+exposition format, which is served by the optional metrics HTTP endpoint of the
+node, and provides snapshots of them, which are returned by the getmetrics RPC.
+*/
+package metrics
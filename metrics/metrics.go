@@ -0,0 +1,361 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Type identifies the type of a metric.
+type Type string
+
+// These constants define the types of metrics.
+const (
+	TypeCounter   Type = "counter"
+	TypeGauge     Type = "gauge"
+	TypeHistogram Type = "histogram"
+)
+
+// DurationBuckets are the upper bounds in seconds of the buckets of
+// histograms which observe the durations of operations taking from about a
+// millisecond to tens of seconds.
+var DurationBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25,
+	.5, 1, 2.5, 5, 10, 30}
+
+// validName matches the names which are valid in the Prometheus text
+// exposition format.
+var validName = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// helpEscaper escapes the characters which are not allowed verbatim in the
+// help text of a metric in the text exposition format.
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+// Counter is a metric whose value only increases, such as the number of
+// blocks connected since the node started.
+//
+// All methods are safe for concurrent access and do nothing on a nil Counter.
+type Counter struct {
+	value uint64 // Must be used atomically.
+}
+
+// Inc increments the counter by one.
+func (c *Counter) Inc() {
+	if c == nil {
+		return
+	}
+	atomic.AddUint64(&c.value, 1)
+}
+
+// Add increments the counter by the passed delta.
+func (c *Counter) Add(delta uint64) {
+	if c == nil {
+		return
+	}
+	atomic.AddUint64(&c.value, delta)
+}
+
+// Value returns the current value of the counter.
+func (c *Counter) Value() uint64 {
+	if c == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&c.value)
+}
+
+// Gauge is a metric whose value goes up and down, such as the number of
+// transactions in the memory pool.
+//
+// All methods are safe for concurrent access and do nothing on a nil Gauge.
+type Gauge struct {
+	value int64 // Must be used atomically.
+}
+
+// Set sets the gauge to the passed value.
+func (g *Gauge) Set(value int64) {
+	if g == nil {
+		return
+	}
+	atomic.StoreInt64(&g.value, value)
+}
+
+// Add adds the passed delta, which may be negative, to the gauge.
+func (g *Gauge) Add(delta int64) {
+	if g == nil {
+		return
+	}
+	atomic.AddInt64(&g.value, delta)
+}
+
+// Value returns the current value of the gauge.
+func (g *Gauge) Value() int64 {
+	if g == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&g.value)
+}
+
+// Histogram is a metric which counts observed values in buckets with fixed
+// upper bounds and tracks their sum, such as the durations of block
+// validations.
+//
+// All methods are safe for concurrent access and do nothing on a nil
+// Histogram.
+type Histogram struct {
+	// The following variables must only be used atomically.
+	sumBits uint64   // Bits of the float64 sum of the observed values.
+	counts  []uint64 // Observations per bucket with the +Inf bucket last.
+
+	upperBounds []float64
+}
+
+// Observe adds the passed value to the histogram.
+func (h *Histogram) Observe(value float64) {
+	if h == nil {
+		return
+	}
+
+	// Histograms have few buckets, so a linear search is as fast as a
+	// binary one.  Values which exceed all upper bounds are counted in the
+	// implicit +Inf bucket.
+	i := 0
+	for i < len(h.upperBounds) && value > h.upperBounds[i] {
+		i++
+	}
+	atomic.AddUint64(&h.counts[i], 1)
+
+	for {
+		oldBits := atomic.LoadUint64(&h.sumBits)
+		newBits := math.Float64bits(math.Float64frombits(oldBits) + value)
+		if atomic.CompareAndSwapUint64(&h.sumBits, oldBits, newBits) {
+			return
+		}
+	}
+}
+
+// ObserveDuration adds the passed duration in seconds to the histogram.
+func (h *Histogram) ObserveDuration(d time.Duration) {
+	h.Observe(d.Seconds())
+}
+
+// Count returns the number of values observed by the histogram.
+func (h *Histogram) Count() uint64 {
+	if h == nil {
+		return 0
+	}
+	var count uint64
+	for i := range h.counts {
+		count += atomic.LoadUint64(&h.counts[i])
+	}
+	return count
+}
+
+// Bucket is a bucket of a histogram in a snapshot.  Its count is cumulative,
+// so it includes the values counted by the buckets with lower upper bounds.
+type Bucket struct {
+	UpperBound float64
+	Count      uint64
+}
+
+// Sample is the value of a metric in a snapshot of a registry.  Counters and
+// gauges have a Value, while histograms have a Count, a Sum and Buckets, the
+// last of which has an infinite upper bound.
+type Sample struct {
+	Name    string
+	Help    string
+	Type    Type
+	Value   float64
+	Count   uint64
+	Sum     float64
+	Buckets []Bucket
+}
+
+// writeText writes the sample in the Prometheus text exposition format.
+func (s *Sample) writeText(buf *bytes.Buffer) {
+	fmt.Fprintf(buf, "# HELP %s %s\n", s.Name, helpEscaper.Replace(s.Help))
+	fmt.Fprintf(buf, "# TYPE %s %s\n", s.Name, s.Type)
+	if s.Type != TypeHistogram {
+		fmt.Fprintf(buf, "%s %s\n", s.Name, FormatFloat(s.Value))
+		return
+	}
+	for _, bucket := range s.Buckets {
+		fmt.Fprintf(buf, "%s_bucket{le=\"%s\"} %d\n", s.Name,
+			FormatFloat(bucket.UpperBound), bucket.Count)
+	}
+	fmt.Fprintf(buf, "%s_sum %s\n", s.Name, FormatFloat(s.Sum))
+	fmt.Fprintf(buf, "%s_count %d\n", s.Name, s.Count)
+}
+
+// FormatFloat returns the passed value formatted as in the Prometheus text
+// exposition format.
+func FormatFloat(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// registered is a metric of a registry along with its description.
+type registered struct {
+	name   string
+	help   string
+	metric interface{}
+}
+
+// sample returns the current value of the registered metric.
+func (m *registered) sample() Sample {
+	s := Sample{Name: m.name, Help: m.help}
+	switch metric := m.metric.(type) {
+	case *Counter:
+		s.Type = TypeCounter
+		s.Value = float64(metric.Value())
+
+	case *Gauge:
+		s.Type = TypeGauge
+		s.Value = float64(metric.Value())
+
+	case *Histogram:
+		s.Type = TypeHistogram
+		s.Buckets = make([]Bucket, len(metric.counts))
+		for i := range metric.counts {
+			s.Count += atomic.LoadUint64(&metric.counts[i])
+			s.Buckets[i].Count = s.Count
+			s.Buckets[i].UpperBound = math.Inf(1)
+			if i < len(metric.upperBounds) {
+				s.Buckets[i].UpperBound = metric.upperBounds[i]
+			}
+		}
+		s.Sum = math.Float64frombits(atomic.LoadUint64(&metric.sumBits))
+	}
+	return s
+}
+
+// Registry houses the metrics of the subsystems of a node.  Metrics are
+// registered once, when a subsystem is created, and are updated without
+// accessing the registry afterwards.
+//
+// A nil Registry is valid and returns nil metrics, which discard all updates.
+type Registry struct {
+	mtx     sync.Mutex
+	metrics map[string]*registered
+}
+
+// NewRegistry returns a new empty metrics registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		metrics: make(map[string]*registered),
+	}
+}
+
+// register adds the passed metric to the registry under the passed name.  It
+// panics when the name is invalid or already registered, since both are
+// programming errors.
+func (r *Registry) register(name, help string, metric interface{}) {
+	if !validName.MatchString(name) {
+		panic(fmt.Sprintf("metrics: invalid metric name %q", name))
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if _, exists := r.metrics[name]; exists {
+		panic(fmt.Sprintf("metrics: metric %q is already registered",
+			name))
+	}
+	r.metrics[name] = &registered{name: name, help: help, metric: metric}
+}
+
+// NewCounter registers and returns a new counter with the passed name and
+// help text.  It returns nil when the registry is nil.
+func (r *Registry) NewCounter(name, help string) *Counter {
+	if r == nil {
+		return nil
+	}
+	c := &Counter{}
+	r.register(name, help, c)
+	return c
+}
+
+// NewGauge registers and returns a new gauge with the passed name and help
+// text.  It returns nil when the registry is nil.
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	if r == nil {
+		return nil
+	}
+	g := &Gauge{}
+	r.register(name, help, g)
+	return g
+}
+
+// NewHistogram registers and returns a new histogram with the passed name,
+// help text and strictly increasing bucket upper bounds.  A bucket for the
+// values exceeding all upper bounds is added implicitly.  It returns nil when
+// the registry is nil.
+func (r *Registry) NewHistogram(name, help string, upperBounds []float64) *Histogram {
+	if r == nil {
+		return nil
+	}
+	for i, bound := range upperBounds {
+		if math.IsNaN(bound) || math.IsInf(bound, 0) ||
+			(i > 0 && bound <= upperBounds[i-1]) {
+
+			panic(fmt.Sprintf("metrics: invalid bucket upper bounds "+
+				"%v of histogram %q", upperBounds, name))
+		}
+	}
+	h := &Histogram{
+		counts:      make([]uint64, len(upperBounds)+1),
+		upperBounds: append([]float64(nil), upperBounds...),
+	}
+	r.register(name, help, h)
+	return h
+}
+
+// Snapshot returns the current values of all metrics of the registry sorted
+// by name.
+//
+// This function is safe for concurrent access.
+func (r *Registry) Snapshot() []Sample {
+	if r == nil {
+		return nil
+	}
+
+	r.mtx.Lock()
+	metrics := make([]*registered, 0, len(r.metrics))
+	for _, m := range r.metrics {
+		metrics = append(metrics, m)
+	}
+	r.mtx.Unlock()
+
+	sort.Slice(metrics, func(i, j int) bool {
+		return metrics[i].name < metrics[j].name
+	})
+	samples := make([]Sample, 0, len(metrics))
+	for _, m := range metrics {
+		samples = append(samples, m.sample())
+	}
+	return samples
+}
+
+// WriteText writes the current values of all metrics of the registry to the
+// passed writer in the Prometheus text exposition format.
+//
+// This function is safe for concurrent access.
+func (r *Registry) WriteText(w io.Writer) error {
+	var buf bytes.Buffer
+	for _, sample := range r.Snapshot() {
+		sample.writeText(&buf)
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
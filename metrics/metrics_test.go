@@ -0,0 +1,193 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package metrics_test
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bitgo/prova/metrics"
+)
+
+// TestMetrics ensures counters, gauges and histograms track their values and
+// are written in the Prometheus text exposition format.
+func TestMetrics(t *testing.T) {
+	r := metrics.NewRegistry()
+	gauge := r.NewGauge("test_gauge", "A gauge.")
+	counter := r.NewCounter("test_counter_total", "A counter\\with\nescapes.")
+	histogram := r.NewHistogram("test_seconds", "A histogram.",
+		[]float64{0.5, 1, 2})
+
+	counter.Inc()
+	counter.Add(2)
+	gauge.Set(10)
+	gauge.Add(-3)
+	histogram.Observe(0.25)
+	histogram.Observe(1)
+	histogram.ObserveDuration(1500 * time.Millisecond)
+	histogram.Observe(4)
+
+	if got := counter.Value(); got != 3 {
+		t.Errorf("counter: got %d, want 3", got)
+	}
+	if got := gauge.Value(); got != 7 {
+		t.Errorf("gauge: got %d, want 7", got)
+	}
+	if got := histogram.Count(); got != 4 {
+		t.Errorf("histogram: got count %d, want 4", got)
+	}
+
+	want := `# HELP test_counter_total A counter\\with\nescapes.
+# TYPE test_counter_total counter
+test_counter_total 3
+# HELP test_gauge A gauge.
+# TYPE test_gauge gauge
+test_gauge 7
+# HELP test_seconds A histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{le="0.5"} 1
+test_seconds_bucket{le="1"} 2
+test_seconds_bucket{le="2"} 3
+test_seconds_bucket{le="+Inf"} 4
+test_seconds_sum 6.75
+test_seconds_count 4
+`
+	var buf bytes.Buffer
+	if err := r.WriteText(&buf); err != nil {
+		t.Fatalf("WriteText: unexpected error: %v", err)
+	}
+	if buf.String() != want {
+		t.Errorf("WriteText: got\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	samples := r.Snapshot()
+	if len(samples) != 3 || samples[2].Type != metrics.TypeHistogram ||
+		len(samples[2].Buckets) != 4 || samples[2].Sum != 6.75 {
+
+		t.Errorf("Snapshot: unexpected samples %+v", samples)
+	}
+}
+
+// TestConcurrentUpdates ensures metrics don't lose updates which happen
+// concurrently.
+func TestConcurrentUpdates(t *testing.T) {
+	r := metrics.NewRegistry()
+	counter := r.NewCounter("counter", "")
+	gauge := r.NewGauge("gauge", "")
+	histogram := r.NewHistogram("histogram", "", metrics.DurationBuckets)
+
+	const numGoroutines, numUpdates = 8, 1000
+	var wg sync.WaitGroup
+	wg.Add(numGoroutines)
+	for i := 0; i < numGoroutines; i++ {
+		go func() {
+			for j := 0; j < numUpdates; j++ {
+				counter.Inc()
+				gauge.Add(1)
+				histogram.Observe(1)
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+
+	const total = numGoroutines * numUpdates
+	samples := r.Snapshot()
+	if counter.Value() != total || gauge.Value() != total ||
+		histogram.Count() != total || samples[2].Sum != total {
+
+		t.Errorf("lost updates: counter %d, gauge %d, histogram %d, "+
+			"sum %v, want %d", counter.Value(), gauge.Value(),
+			histogram.Count(), samples[2].Sum, total)
+	}
+}
+
+// TestNilMetrics ensures metrics of a nil registry discard their updates.
+func TestNilMetrics(t *testing.T) {
+	var r *metrics.Registry
+	counter := r.NewCounter("counter", "")
+	gauge := r.NewGauge("gauge", "")
+	histogram := r.NewHistogram("histogram", "", metrics.DurationBuckets)
+	if counter != nil || gauge != nil || histogram != nil {
+		t.Fatal("nil registry returned metrics")
+	}
+
+	counter.Inc()
+	counter.Add(1)
+	gauge.Set(1)
+	gauge.Add(1)
+	histogram.Observe(1)
+	histogram.ObserveDuration(time.Second)
+	if counter.Value() != 0 || gauge.Value() != 0 || histogram.Count() != 0 {
+		t.Error("nil metrics have values")
+	}
+	if samples := r.Snapshot(); len(samples) != 0 {
+		t.Errorf("nil registry has samples %v", samples)
+	}
+}
+
+// TestUpdatesDontAllocate ensures updating registered metrics doesn't
+// allocate, so they can be updated on hot paths.
+func TestUpdatesDontAllocate(t *testing.T) {
+	r := metrics.NewRegistry()
+	counter := r.NewCounter("counter", "")
+	gauge := r.NewGauge("gauge", "")
+	histogram := r.NewHistogram("histogram", "", metrics.DurationBuckets)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		counter.Inc()
+		counter.Add(2)
+		gauge.Set(3)
+		gauge.Add(-1)
+		histogram.Observe(0.02)
+		histogram.ObserveDuration(time.Minute)
+	})
+	if allocs != 0 {
+		t.Errorf("updates allocated %v times, want 0", allocs)
+	}
+}
+
+// TestInvalidRegistrations ensures invalid and duplicate registrations panic.
+func TestInvalidRegistrations(t *testing.T) {
+	tests := []struct {
+		name     string
+		register func(r *metrics.Registry)
+	}{
+		{
+			name: "invalid name",
+			register: func(r *metrics.Registry) {
+				r.NewCounter("1counter", "")
+			},
+		},
+		{
+			name: "duplicate name",
+			register: func(r *metrics.Registry) {
+				r.NewGauge("metric", "")
+			},
+		},
+		{
+			name: "unsorted bounds",
+			register: func(r *metrics.Registry) {
+				r.NewHistogram("histogram", "", []float64{2, 1})
+			},
+		},
+	}
+
+	for _, test := range tests {
+		r := metrics.NewRegistry()
+		r.NewCounter("metric", "")
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: registration did not panic",
+						test.name)
+				}
+			}()
+			test.register(r)
+		}()
+	}
+}
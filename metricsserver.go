@@ -0,0 +1,137 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bitgo/prova/metrics"
+)
+
+const (
+	// metricsTimeoutSeconds is the number of seconds a connection to the
+	// metrics server is allowed to take to read a request or write a
+	// response.
+	metricsTimeoutSeconds = 10
+
+	// metricsContentType is the content type of the Prometheus text
+	// exposition format the metrics are served in.
+	metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+// metricsServer serves the metrics of the subsystems of the server in the
+// Prometheus text exposition format over unauthenticated HTTP GET requests.
+type metricsServer struct {
+	started   int32
+	shutdown  int32
+	registry  *metrics.Registry
+	listeners []net.Listener
+	wg        sync.WaitGroup
+}
+
+// Start begins serving metrics on all of the listeners.
+func (s *metricsServer) Start() {
+	if atomic.AddInt32(&s.started, 1) != 1 {
+		return
+	}
+
+	rpcsLog.Trace("Starting metrics server")
+	metricsServeMux := http.NewServeMux()
+	metricsServeMux.HandleFunc("/metrics", s.handleRequest)
+	httpServer := &http.Server{
+		Handler:        metricsServeMux,
+		ReadTimeout:    time.Second * metricsTimeoutSeconds,
+		WriteTimeout:   time.Second * metricsTimeoutSeconds,
+		MaxHeaderBytes: 1 << 12,
+	}
+	for _, listener := range s.listeners {
+		s.wg.Add(1)
+		go func(listener net.Listener) {
+			rpcsLog.Infof("Metrics server listening on %s",
+				listener.Addr())
+			httpServer.Serve(listener)
+			rpcsLog.Tracef("Metrics listener done for %s",
+				listener.Addr())
+			s.wg.Done()
+		}(listener)
+	}
+}
+
+// Stop shuts down the metrics server by closing all of the listeners.
+func (s *metricsServer) Stop() error {
+	if atomic.AddInt32(&s.shutdown, 1) != 1 {
+		rpcsLog.Infof("Metrics server is already in the process of " +
+			"shutting down")
+		return nil
+	}
+	rpcsLog.Warnf("Metrics server shutting down")
+	for _, listener := range s.listeners {
+		err := listener.Close()
+		if err != nil {
+			rpcsLog.Errorf("Problem shutting down metrics server: %v",
+				err)
+			return err
+		}
+	}
+	s.wg.Wait()
+	rpcsLog.Infof("Metrics server shutdown complete")
+	return nil
+}
+
+// handleRequest responds to the passed request with the current values of all
+// metrics.
+func (s *metricsServer) handleRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "405 Method not allowed.",
+			http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", metricsContentType)
+	if err := s.registry.WriteText(w); err != nil {
+		rpcsLog.Debugf("Unable to write metrics response: %v", err)
+	}
+}
+
+// newMetricsServer returns a new instance of the metricsServer struct which
+// serves the metrics of the passed registry on the passed addresses.
+func newMetricsServer(listenAddrs []string, registry *metrics.Registry) (*metricsServer, error) {
+	ipv4ListenAddrs, ipv6ListenAddrs, _, err := parseListeners(listenAddrs)
+	if err != nil {
+		return nil, err
+	}
+	listeners := make([]net.Listener, 0,
+		len(ipv6ListenAddrs)+len(ipv4ListenAddrs))
+	for _, addr := range ipv4ListenAddrs {
+		listener, err := net.Listen("tcp4", addr)
+		if err != nil {
+			rpcsLog.Warnf("Can't listen on %s: %v", addr, err)
+			continue
+		}
+		listeners = append(listeners, listener)
+	}
+	for _, addr := range ipv6ListenAddrs {
+		listener, err := net.Listen("tcp6", addr)
+		if err != nil {
+			rpcsLog.Warnf("Can't listen on %s: %v", addr, err)
+			continue
+		}
+		listeners = append(listeners, listener)
+	}
+	if len(listeners) == 0 {
+		return nil, errors.New("metrics: No valid listen address")
+	}
+
+	return &metricsServer{
+		registry:  registry,
+		listeners: listeners,
+	}, nil
+}
@@ -0,0 +1,42 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bitgo/prova/metrics"
+)
+
+// TestMetricsServer ensures the metrics server serves the metrics of its
+// registry in the Prometheus text format and only to GET requests.
+func TestMetricsServer(t *testing.T) {
+	registry := metrics.NewRegistry()
+	registry.NewGauge("test_gauge", "A gauge.").Set(5)
+	s := &metricsServer{registry: registry}
+
+	w := httptest.NewRecorder()
+	s.handleRequest(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET: got status %d, want %d", w.Code, http.StatusOK)
+	}
+	if got := w.Header().Get("Content-Type"); got != metricsContentType {
+		t.Errorf("GET: got content type %q, want %q", got,
+			metricsContentType)
+	}
+	if body := w.Body.String(); !strings.Contains(body, "\ntest_gauge 5\n") {
+		t.Errorf("GET: metric missing from body:\n%s", body)
+	}
+
+	w = httptest.NewRecorder()
+	s.handleRequest(w, httptest.NewRequest(http.MethodPost, "/metrics", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: got status %d, want %d", w.Code,
+			http.StatusMethodNotAllowed)
+	}
+}
@@ -210,10 +210,12 @@ func (m *CPUMiner) submitBlock(block *provautil.Block) bool {
 //
 // This function will return early with false when conditions that trigger a
 // stale block such as a new block showing up or periodically when there are
-// new transactions and enough time has elapsed without finding a solution.
+// new transactions and enough time has elapsed without finding a solution.  It
+// also returns false once the nonces up to the passed last nonce have been
+// tried.  The number of nonces tried is returned as well.
 func (m *CPUMiner) solveBlock(msgBlock *wire.MsgBlock, blockHeight uint32,
-	ticker *time.Ticker, validateKey *btcec.PrivateKey,
-	quit chan struct{}) bool {
+	ticker *time.Ticker, validateKey *btcec.PrivateKey, lastNonce uint64,
+	quit chan struct{}) (bool, uint64) {
 
 	// Create some convenience variables.
 	header := &msgBlock.Header
@@ -227,10 +229,10 @@ func (m *CPUMiner) solveBlock(msgBlock *wire.MsgBlock, blockHeight uint32,
 	// Search through the entire nonce range for a solution while
 	// periodically checking for early quit and stale block
 	// conditions along with updates to the speed monitor.
-	for i := uint64(0); i <= maxNonce; i++ {
+	for i := uint64(0); i <= lastNonce; i++ {
 		select {
 		case <-quit:
-			return false
+			return false, i
 
 		case <-ticker.C:
 			m.updateHashes <- hashesCompleted
@@ -240,7 +242,7 @@ func (m *CPUMiner) solveBlock(msgBlock *wire.MsgBlock, blockHeight uint32,
 			// has changed.
 			best := m.g.BestSnapshot()
 			if !header.PrevBlock.IsEqual(best.Hash) {
-				return false
+				return false, i
 			}
 
 			// The current block is stale if the memory pool
@@ -250,7 +252,7 @@ func (m *CPUMiner) solveBlock(msgBlock *wire.MsgBlock, blockHeight uint32,
 			if lastTxUpdate != m.g.TxSource().LastUpdated() &&
 				time.Now().After(lastGenerated.Add(time.Minute)) {
 
-				return false
+				return false, i
 			}
 
 			m.g.UpdateBlockTime(msgBlock, validateKey)
@@ -269,11 +271,11 @@ func (m *CPUMiner) solveBlock(msgBlock *wire.MsgBlock, blockHeight uint32,
 		// than the target difficulty.  Yay!
 		if blockchain.HashToBig(&hash).Cmp(targetDifficulty) <= 0 {
 			m.updateHashes <- hashesCompleted
-			return true
+			return true, i + 1
 		}
 	}
 
-	return false
+	return false, lastNonce + 1
 }
 
 // generateBlocks is a worker that is controlled by the miningWorkerController.
@@ -346,32 +348,10 @@ out:
 		}
 
 		// Pick a validate key to use, absent rate-limited keys.
-		var nonRateLimitedValidateKeys []*btcec.PrivateKey
-		var validateKey *btcec.PrivateKey
-		var validateKeyErr error
-		for _, privKey := range m.validateKeys {
-			var validatePubKey wire.BlockValidatingPubKey
-			copy(validatePubKey[:wire.BlockValidatingPubKeySize], privKey.PubKey().SerializeCompressed()[:wire.BlockValidatingPubKeySize])
-			isRateLimited, validateKeyErr := m.cfg.IsValidateKeyRateLimited(validatePubKey)
-			if validateKeyErr != nil || isRateLimited {
-				continue
-			}
-			nonRateLimitedValidateKeys = append(nonRateLimitedValidateKeys, privKey)
-		}
-		if validateKeyErr != nil {
-			m.submitBlockLock.Unlock()
-			errStr := fmt.Sprintf("Failed checking validate key %v", validateKeyErr)
-			log.Errorf(errStr)
-			time.Sleep(time.Second)
-			continue
-		}
-		if keysCount := len(nonRateLimitedValidateKeys); keysCount > 0 {
-			// Choose a signing key at random.
-			validateKey = nonRateLimitedValidateKeys[rand.Intn(keysCount)]
-		} else {
+		validateKey, err := m.PickValidateKey()
+		if err != nil {
 			m.submitBlockLock.Unlock()
-			errStr := fmt.Sprintf("Block generation rate limited.")
-			log.Errorf(errStr)
+			log.Errorf(err.Error())
 			time.Sleep(5 * time.Second)
 			continue
 		}
@@ -393,7 +373,9 @@ out:
 		// with false when conditions that trigger a stale block, so
 		// a new block template can be generated.  When the return is
 		// true a solution was found, so submit the solved block.
-		if m.solveBlock(template.Block, curHeight+1, ticker, validateKey, quit) {
+		solved, _ := m.solveBlock(template.Block, curHeight+1, ticker,
+			validateKey, maxNonce, quit)
+		if solved {
 			block := provautil.NewBlock(template.Block)
 			m.submitBlock(block)
 		}
@@ -416,6 +398,32 @@ func (m *CPUMiner) detectInvalidValidateKey() *btcec.PublicKey {
 	return nil
 }
 
+// PickValidateKey returns a random validate key of the miner which is not rate
+// limited from signing the next block.
+//
+// This function is safe for concurrent access.
+func (m *CPUMiner) PickValidateKey() (*btcec.PrivateKey, error) {
+	var nonRateLimitedValidateKeys []*btcec.PrivateKey
+	for _, privKey := range m.ValidateKeys() {
+		var validatePubKey wire.BlockValidatingPubKey
+		copy(validatePubKey[:wire.BlockValidatingPubKeySize], privKey.PubKey().SerializeCompressed()[:wire.BlockValidatingPubKeySize])
+		isRateLimited, err := m.cfg.IsValidateKeyRateLimited(validatePubKey)
+		if err != nil {
+			return nil, fmt.Errorf("Failed checking validate key %v", err)
+		}
+		if isRateLimited {
+			continue
+		}
+		nonRateLimitedValidateKeys = append(nonRateLimitedValidateKeys, privKey)
+	}
+	if len(nonRateLimitedValidateKeys) == 0 {
+		return nil, errors.New("Block generation rate limited.")
+	}
+
+	// Choose a signing key at random.
+	return nonRateLimitedValidateKeys[rand.Intn(len(nonRateLimitedValidateKeys))], nil
+}
+
 // miningWorkerController launches the worker goroutines that are used to
 // generate block templates and solve them.  It also provides the ability to
 // dynamically adjust the number of running worker goroutines.
@@ -613,8 +621,56 @@ func (m *CPUMiner) ValidateKeys() []*btcec.PrivateKey {
 // contained in that it creates block templates and attempts to solve them while
 // detecting when it is performing stale work and reacting accordingly by
 // generating a new block template.  When a block is solved, it is submitted.
-// The function returns a list of the hashes of generated blocks.
+// Each block pays a random one of the configured mining addresses.  The
+// function returns a list of the hashes of generated blocks.
 func (m *CPUMiner) GenerateNBlocks(n uint32) ([]*chainhash.Hash, error) {
+	return m.generateNBlocks(m.g, n, nil, 0, nil)
+}
+
+// GenerateNBlocksToAddress generates the requested number of blocks paying
+// the passed address in the same way as GenerateNBlocks.  An error is returned
+// along with the hashes of the blocks generated so far when the blocks could
+// not be generated after trying the passed number of nonces overall, where zero
+// means no limit.
+func (m *CPUMiner) GenerateNBlocksToAddress(n uint32, payToAddr provautil.Address, maxTries uint64) ([]*chainhash.Hash, error) {
+	return m.generateNBlocks(m.g, n, payToAddr, maxTries, nil)
+}
+
+// GenerateBlock generates a single block paying the passed address which
+// contains exactly the transactions of the passed source.  An error is returned
+// when not all of the transactions can be included in the block or when no
+// block could be generated after trying the passed number of nonces, where zero
+// means no limit.
+func (m *CPUMiner) GenerateBlock(payToAddr provautil.Address, txSource mining.TxSource, maxTries uint64) (*chainhash.Hash, error) {
+	numTxns := len(txSource.MiningDescs())
+	checkTemplate := func(template *mining.BlockTemplate) error {
+		if len(template.Block.Transactions)-1 != numTxns {
+			return fmt.Errorf("only %d of the %d transactions can "+
+				"be included in the block",
+				len(template.Block.Transactions)-1, numTxns)
+		}
+		return nil
+	}
+	blockHashes, err := m.generateNBlocks(m.g.WithTxSource(txSource), 1,
+		payToAddr, maxTries, checkTemplate)
+	if err != nil {
+		return nil, err
+	}
+	return blockHashes[0], nil
+}
+
+// generateNBlocks generates the requested number of blocks from templates of
+// the passed generator which pay the passed address, or a random one of the
+// configured mining addresses when it is nil.  Each template is checked with
+// the passed function, if any, before it is solved.  An error is returned when
+// the blocks could not be generated after trying the passed number of nonces
+// overall, where zero means no limit.  Each attempt at a template counts as at
+// least one try.  The hashes of the blocks generated so far are returned along
+// with any error.
+func (m *CPUMiner) generateNBlocks(g *mining.BlkTmplGenerator, n uint32,
+	payToAddr provautil.Address, maxTries uint64,
+	checkTemplate func(*mining.BlockTemplate) error) ([]*chainhash.Hash, error) {
+
 	m.Lock()
 
 	// Respond with an error if server is already mining.
@@ -633,17 +689,26 @@ func (m *CPUMiner) GenerateNBlocks(n uint32) ([]*chainhash.Hash, error) {
 
 	m.Unlock()
 
+	defer func() {
+		m.Lock()
+		close(m.speedMonitorQuit)
+		m.wg.Wait()
+		m.started = false
+		m.discreteMining = false
+		m.Unlock()
+	}()
+
 	log.Tracef("Generating %d blocks", n)
 
-	i := uint32(0)
-	blockHashes := make([]*chainhash.Hash, n, n)
+	blockHashes := make([]*chainhash.Hash, 0, n)
 
 	// Start a ticker which is used to signal checks for stale work and
 	// updates to the speed monitor.
 	ticker := time.NewTicker(time.Second * hashUpdateSecs)
 	defer ticker.Stop()
 
-	for {
+	remainingTries := maxTries
+	for uint32(len(blockHashes)) < n {
 		// Read updateNumWorkers in case someone tries a `setgenerate` while
 		// we're generating. We can ignore it as the `generate` RPC call only
 		// uses 1 worker.
@@ -652,53 +717,83 @@ func (m *CPUMiner) GenerateNBlocks(n uint32) ([]*chainhash.Hash, error) {
 		default:
 		}
 
+		// Give up once the requested number of nonces have been tried.
+		lastNonce := maxNonce
+		if maxTries != 0 {
+			if remainingTries == 0 {
+				return blockHashes, fmt.Errorf("generated %d of "+
+					"%d blocks within %d tries",
+					len(blockHashes), n, maxTries)
+			}
+			lastNonce = remainingTries - 1
+		}
+
 		// Grab the lock used for block submission, since the current block will
 		// be changing and this would otherwise end up building a new block
 		// template on a block that is in the process of becoming stale.
 		m.submitBlockLock.Lock()
-		curHeight := m.g.BestSnapshot().Height
+		curHeight := g.BestSnapshot().Height
 
-		// Choose a payment address at random.
-		rand.Seed(time.Now().UnixNano())
-		payToAddr := m.cfg.MiningAddrs[rand.Intn(len(m.cfg.MiningAddrs))]
+		// Choose a payment address at random unless one was requested.
+		blockPayToAddr := payToAddr
+		if blockPayToAddr == nil {
+			rand.Seed(time.Now().UnixNano())
+			blockPayToAddr = m.cfg.MiningAddrs[rand.Intn(len(m.cfg.MiningAddrs))]
+		}
 
-		// Choose a validate key at random.
-		validateKeys := m.ValidateKeys()
-		validateKey := validateKeys[rand.Intn(len(validateKeys))]
+		// Choose a validate key at random, absent rate-limited keys.
+		validateKey, err := m.PickValidateKey()
+		if err != nil {
+			m.submitBlockLock.Unlock()
+			return blockHashes, err
+		}
 
 		// Create a new block template using the available transactions
-		// in the memory pool as a source of transactions to potentially
-		// include in the block.
-		template, err := m.g.NewBlockTemplate(payToAddr, validateKey)
+		// in the transaction source as a source of transactions to
+		// potentially include in the block.
+		template, err := g.NewBlockTemplate(blockPayToAddr, validateKey)
 		m.submitBlockLock.Unlock()
 		if err != nil {
 			errStr := fmt.Sprintf("Failed to create new block "+
 				"template: %v", err)
 			log.Errorf(errStr)
+
+			// Every iteration counts as at least one try, so the
+			// loop ends once they are exhausted even when no
+			// template can be created.
+			if maxTries != 0 {
+				remainingTries--
+			}
 			continue
 		}
+		if checkTemplate != nil {
+			if err := checkTemplate(template); err != nil {
+				return blockHashes, err
+			}
+		}
 
 		// Attempt to solve the block.  The function will exit early
 		// with false when conditions that trigger a stale block, so
 		// a new block template can be generated.  When the return is
 		// true a solution was found, so submit the solved block.
-		if m.solveBlock(template.Block, curHeight+1, ticker, validateKey, nil) {
+		solved, tries := m.solveBlock(template.Block, curHeight+1,
+			ticker, validateKey, lastNonce, nil)
+		if maxTries != 0 {
+			if tries == 0 {
+				tries = 1
+			}
+			remainingTries -= tries
+		}
+		if solved {
 			block := provautil.NewBlock(template.Block)
-			m.submitBlock(block)
-			blockHashes[i] = block.Hash()
-			i++
-			if i == n {
-				log.Tracef("Generated %d blocks", i)
-				m.Lock()
-				close(m.speedMonitorQuit)
-				m.wg.Wait()
-				m.started = false
-				m.discreteMining = false
-				m.Unlock()
-				return blockHashes, nil
+			if m.submitBlock(block) {
+				blockHashes = append(blockHashes, block.Hash())
 			}
 		}
 	}
+
+	log.Tracef("Generated %d blocks", len(blockHashes))
+	return blockHashes, nil
 }
 
 // New returns a new instance of a CPU miner for the provided configuration.
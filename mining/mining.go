@@ -15,6 +15,7 @@ import (
 	"github.com/bitgo/prova/btcec"
 	"github.com/bitgo/prova/chaincfg"
 	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/metrics"
 	"github.com/bitgo/prova/provautil"
 	"github.com/bitgo/prova/txscript"
 	"github.com/bitgo/prova/wire"
@@ -61,6 +62,11 @@ type TxDesc struct {
 
 	// FeePerKB is the fee the transaction pays in Satoshi per 1000 bytes.
 	FeePerKB int64
+
+	// FeeDelta is the amount in atoms added to the fee of the transaction
+	// when it is considered for inclusion in new blocks.  It does not
+	// change the fee the transaction actually pays.
+	FeeDelta int64
 }
 
 // TxSource represents a source of transactions to consider for inclusion in
@@ -92,6 +98,10 @@ type txPrioItem struct {
 	feePerKB int64
 	isAdmin  bool
 
+	// order is the position of the transaction in the block when the
+	// transactions are selected by a SelectionHook.
+	order int
+
 	// dependsOn holds a map of transaction hashes which this one depends
 	// on.  It will only be set when the transaction references other
 	// transactions in the source pool and hence must come after them in
@@ -115,6 +125,22 @@ func isAdmin(msgTx *wire.MsgTx) bool {
 	return false
 }
 
+// modifiedFeePerKB returns the fee per kilobyte the transaction of the passed
+// descriptor is scored with when it is considered for inclusion in new blocks,
+// which accounts for its fee delta, along with whether the transaction must be
+// excluded from new blocks since a negative fee delta exceeds its fee.
+func modifiedFeePerKB(txDesc *TxDesc) (int64, bool) {
+	if txDesc.FeeDelta == 0 {
+		return txDesc.FeePerKB, false
+	}
+	modifiedFee := txDesc.Fee + txDesc.FeeDelta
+	if modifiedFee < 0 {
+		return 0, true
+	}
+	txSize := txDesc.Tx.MsgTx().SerializeSizeCached()
+	return modifiedFee * 1000 / int64(txSize), false
+}
+
 // txPriorityQueueLessFunc describes a function that can be used as a compare
 // function for a transaction priority queue (txPriorityQueue).
 type txPriorityQueueLessFunc func(*txPriorityQueue, int, int) bool
@@ -238,7 +264,7 @@ type BlockTemplate struct {
 	SigOpCounts []int64
 
 	// Height is the height at which the block template connects to the main
-	// chain.
+	// chain.  It is the height committed to by the header of the block.
 	Height uint32
 
 	// ValidPayAddress indicates whether or not the template coinbase pays
@@ -246,6 +272,9 @@ type BlockTemplate struct {
 	// NewBlockTemplate for details on which this can be useful to generate
 	// templates without a coinbase payment address.
 	ValidPayAddress bool
+
+	// Stats houses statistics about the generation of the template.
+	Stats TemplateStats
 }
 
 // mergeUtxoView adds all of the entries in view to viewA.  The result is that
@@ -330,6 +359,17 @@ func createCoinbaseTx(params *chaincfg.Params, coinbaseScript []byte, nextBlockH
 	return provautil.NewTx(tx), nil
 }
 
+// coinbaseValue returns the value of a coinbase output paying the passed
+// subsidy plus the total fees of the transactions in the block.  An error is
+// returned when the sum can not be represented as an amount.
+func coinbaseValue(subsidy int64, totalFees provautil.Amount) (int64, error) {
+	value, err := provautil.Amount(subsidy).Add(totalFees)
+	if err != nil {
+		return 0, err
+	}
+	return int64(value), nil
+}
+
 // spendTransaction updates the passed view by marking the inputs to the passed
 // transaction as spent.  It also adds all outputs in the passed transaction
 // which are not provably unspendable as available unspent transaction outputs.
@@ -387,6 +427,14 @@ func medianAdjustedTime(chainState *blockchain.BestState, timeSource blockchain.
 	return newTimestamp
 }
 
+// templateMetrics houses the metrics of the block templates a generator
+// creates.  They are all nil, and discard their updates, unless the generator
+// was created with WithMetrics.
+type templateMetrics struct {
+	buildTime *metrics.Histogram
+	txs       *metrics.Gauge
+}
+
 // BlkTmplGenerator provides a type that can be used to generate block templates
 // based on a given mining policy and source of transactions to choose from.
 // It also houses additional state required in order to ensure the templates
@@ -402,6 +450,14 @@ type BlkTmplGenerator struct {
 	timeSource  blockchain.MedianTimeSource
 	sigCache    *txscript.SigCache
 	hashCache   *txscript.HashCache
+
+	// selectionHook decides which transactions are included in the block
+	// templates when it is set.  See WithSelectionHook.
+	selectionHook SelectionHook
+
+	// metrics tracks the block templates the generator creates.  See
+	// WithMetrics.
+	metrics templateMetrics
 }
 
 // NewBlkTmplGenerator returns a new block template generator for the given
@@ -439,9 +495,11 @@ func NewBlkTmplGenerator(policy *Policy, params *chaincfg.Params,
 // factors.  First, each transaction has a priority calculated based on its
 // value, age of inputs, and size.  Transactions which consist of larger
 // amounts, older inputs, and small sizes have the highest priority.  Second, a
-// fee per kilobyte is calculated for each transaction.  Transactions with a
-// higher fee per kilobyte are preferred.  Finally, the block generation related
-// policy settings are all taken into account.
+// fee per kilobyte is calculated for each transaction, which includes the fee
+// delta of the transaction.  Transactions with a higher fee per kilobyte are
+// preferred, while transactions whose negative fee delta exceeds their fee are
+// never included.  Finally, the block generation related policy settings are
+// all taken into account.
 //
 // Transactions which only spend outputs from other transactions already in the
 // block chain are immediately added to a priority queue which either
@@ -466,6 +524,14 @@ func NewBlkTmplGenerator(policy *Policy, params *chaincfg.Params,
 // policy setting, exceed the maximum allowed signature operations per block, or
 // otherwise cause the block to be invalid are skipped.
 //
+// When the generator has a SelectionHook, the transactions which may be
+// included are passed to it once they are gathered, and the transactions it
+// returns are included in the returned order instead, except transactions are
+// always placed after the transactions they depend on.  Only the block size,
+// signature operation and validity constraints above are enforced on them.
+// The selected transactions which are not included are reported in the
+// TemplateStats of the template.
+//
 // Given the above, a block generated by this function is of the following form:
 //
 //   -----------------------------------  --  --
@@ -489,6 +555,8 @@ func NewBlkTmplGenerator(policy *Policy, params *chaincfg.Params,
 //  |  <= policy.BlockMinSize)          |   |
 //   -----------------------------------  --
 func (g *BlkTmplGenerator) NewBlockTemplate(payToAddress provautil.Address, validateKey *btcec.PrivateKey) (*BlockTemplate, error) {
+	start := time.Now()
+
 	// Extend the most recently known best block.
 	best := g.chain.BestSnapshot()
 	prevHash := best.Hash
@@ -553,6 +621,25 @@ func (g *BlkTmplGenerator) NewBlockTemplate(payToAddress provautil.Address, vali
 	txFees = append(txFees, -1) // Updated once known
 	txSigOpCounts = append(txSigOpCounts, numCoinbaseSigOps)
 
+	// Keep track of the transactions which may be included in the block
+	// for the selection hook along with the transactions it selected which
+	// are not included.
+	var candidates []*TxDesc
+	var candidateItems map[chainhash.Hash]*txPrioItem
+	var dropped []DroppedTx
+	if g.selectionHook != nil {
+		candidateItems = make(map[chainhash.Hash]*txPrioItem,
+			len(sourceTxns))
+	}
+	drop := func(tx *provautil.Tx, reason string) {
+		if g.selectionHook != nil {
+			dropped = append(dropped, DroppedTx{
+				Hash:   *tx.Hash(),
+				Reason: reason,
+			})
+		}
+	}
+
 	log.Debugf("Considering %d transactions for inclusion to new block",
 		len(sourceTxns))
 
@@ -566,11 +653,22 @@ mempoolLoop:
 			continue
 		}
 		if !blockchain.IsFinalizedTransaction(tx, nextBlockHeight,
-			g.timeSource.AdjustedTime()) {
+			g.chain.LockTimeEvalTime(g.timeSource.AdjustedTime())) {
 			log.Tracef("Skipping non-finalized tx %s", tx.Hash())
 			continue
 		}
 
+		// Skip transactions which were deprioritised with a fee delta
+		// that exceeds their fee.  Transactions which depend on them
+		// are skipped as well since they are never added to the
+		// priority queue.
+		feePerKB, excluded := modifiedFeePerKB(txDesc)
+		if excluded {
+			log.Tracef("Skipping tx %s with fee delta %d", tx.Hash(),
+				txDesc.FeeDelta)
+			continue
+		}
+
 		// Fetch all of the utxos referenced by the this transaction.
 		// NOTE: This intentionally does not fetch inputs from the
 		// mempool since a transaction which depends on other
@@ -627,14 +725,19 @@ mempoolLoop:
 		prioItem.priority = CalcPriority(tx.MsgTx(), utxos,
 			nextBlockHeight)
 
-		// Calculate the fee in Atoms/kB.
-		prioItem.feePerKB = txDesc.FeePerKB
+		// Score the transaction with the fee in Atoms/kB including its
+		// fee delta, while the block only collects the actual fee.
+		prioItem.feePerKB = feePerKB
 		prioItem.fee = txDesc.Fee
 		prioItem.isAdmin = isAdmin(tx.MsgTx())
 
 		// Add the transaction to the priority queue to mark it ready
-		// for inclusion in the block unless it has dependencies.
-		if prioItem.dependsOn == nil {
+		// for inclusion in the block unless it has dependencies or the
+		// selection hook decides which transactions are included.
+		candidates = append(candidates, txDesc)
+		if g.selectionHook != nil {
+			candidateItems[*tx.Hash()] = prioItem
+		} else if prioItem.dependsOn == nil {
 			heap.Push(priorityQueue, prioItem)
 		}
 
@@ -644,15 +747,29 @@ mempoolLoop:
 		mergeUtxoView(blockUtxos, utxos)
 	}
 
+	// Let the selection hook decide which of the transactions are included
+	// and add them to the priority queue in the order they are included.
+	if g.selectionHook != nil {
+		var selected []*txPrioItem
+		selected, dropped = selectWithHook(g.selectionHook, *g.policy,
+			candidates, candidateItems)
+		priorityQueue.SetLessFunc(txPQByOrder)
+		for _, item := range selected {
+			heap.Push(priorityQueue, item)
+		}
+	}
+
 	log.Tracef("Priority queue len %d, dependers len %d",
 		priorityQueue.Len(), len(dependers))
 
 	// The starting block size is the size of the block header plus the max
 	// possible transaction count size, plus the size of the coinbase
 	// transaction.
-	blockSize := blockHeaderOverhead + uint32(coinbaseTx.MsgTx().SerializeSize())
+	blockSize := blockHeaderOverhead + uint32(coinbaseTx.SerializeSize())
 	blockSigOps := numCoinbaseSigOps
-	totalFees := int64(0)
+	totalFees := provautil.Amount(0)
+	scriptFlags := StandardScriptFlags(g.policy.DisableStrictEncoding,
+		g.chain.NextBlockVerificationFlags())
 
 	// Choose which transactions make it into the block.
 	for priorityQueue.Len() > 0 {
@@ -664,14 +781,26 @@ mempoolLoop:
 		// Grab the list of transactions which depend on this one (if any).
 		deps := dependers[*tx.Hash()]
 
+		// The transactions selected by the selection hook are all in
+		// the priority queue from the start, so skip the ones which
+		// depend on a transaction which was skipped.
+		if len(prioItem.dependsOn) > 0 {
+			log.Tracef("Skipping tx %s because it depends on a "+
+				"skipped tx", tx.Hash())
+			drop(tx, dropMissingDep)
+			logSkippedDeps(tx, deps)
+			continue
+		}
+
 		// Enforce maximum block size.  Also check for overflow.
-		txSize := uint32(tx.MsgTx().SerializeSize())
+		txSize := uint32(tx.MsgTx().SerializeSizeCached())
 		blockPlusTxSize := blockSize + txSize
 		if blockPlusTxSize < blockSize ||
 			blockPlusTxSize >= g.policy.BlockMaxSize {
 
 			log.Tracef("Skipping tx %s because it would exceed "+
 				"the max block size", tx.Hash())
+			drop(tx, dropBlockSize)
 			logSkippedDeps(tx, deps)
 			continue
 		}
@@ -683,6 +812,7 @@ mempoolLoop:
 			blockSigOps+numSigOps > blockchain.MaxSigOpsPerBlock {
 			log.Tracef("Skipping tx %s because it would "+
 				"exceed the maximum sigops per block", tx.Hash())
+			drop(tx, dropBlockSigOps)
 			logSkippedDeps(tx, deps)
 			continue
 		}
@@ -691,6 +821,7 @@ mempoolLoop:
 		if err != nil {
 			log.Tracef("Skipping tx %s due to error in "+
 				"CountP2SHSigOps: %v", tx.Hash(), err)
+			drop(tx, dropInvalidInputs)
 			logSkippedDeps(tx, deps)
 			continue
 		}
@@ -700,13 +831,14 @@ mempoolLoop:
 			log.Tracef("Skipping tx %s because it would "+
 				"exceed the maximum sigops per block (p2sh)",
 				tx.Hash())
+			drop(tx, dropBlockSigOps)
 			logSkippedDeps(tx, deps)
 			continue
 		}
 
 		// Skip free transactions once the block is larger than the
 		// minimum block size.
-		if sortedByFee &&
+		if g.selectionHook == nil && sortedByFee &&
 			prioItem.feePerKB < int64(g.policy.TxMinFreeFee) &&
 			blockPlusTxSize >= g.policy.BlockMinSize {
 
@@ -722,7 +854,7 @@ mempoolLoop:
 		// Prioritize by fee per kilobyte once the block is larger than
 		// the priority size or there are no more high-priority
 		// transactions.
-		if !sortedByFee && (blockPlusTxSize >= g.policy.BlockPrioritySize ||
+		if g.selectionHook == nil && !sortedByFee && (blockPlusTxSize >= g.policy.BlockPrioritySize ||
 			prioItem.priority <= MinHighPriority) {
 
 			log.Tracef("Switching to sort by fees per "+
@@ -755,6 +887,7 @@ mempoolLoop:
 		if err != nil {
 			log.Tracef("Skipping tx %s due to error in "+
 				"CheckTransactionInputs: %v", tx.Hash(), err)
+			drop(tx, dropInvalidInputs)
 			logSkippedDeps(tx, deps)
 			continue
 		}
@@ -764,15 +897,27 @@ mempoolLoop:
 		if err != nil {
 			log.Tracef("Skipping tx %s due to error in "+
 				"CheckTransactionOutputs: %v", tx.Hash(), err)
+			drop(tx, dropInvalidOutputs)
 			logSkippedDeps(tx, deps)
 			continue
 		}
 
 		err = blockchain.ValidateTransactionScripts(tx, blockUtxos, keyView,
-			txscript.StandardVerifyFlags, g.sigCache, g.hashCache)
+			scriptFlags, g.sigCache, g.hashCache)
 		if err != nil {
 			log.Tracef("Skipping tx %s due to error in "+
 				"ValidateTransactionScripts: %v", tx.Hash(), err)
+			drop(tx, dropInvalidScripts)
+			logSkippedDeps(tx, deps)
+			continue
+		}
+
+		// Skip the transaction when its fee can not be added to the
+		// total fees of the block.
+		newTotalFees, err := totalFees.Add(provautil.Amount(prioItem.fee))
+		if err != nil {
+			log.Tracef("Skipping tx %s since its fee of %d would "+
+				"overflow the total fees", tx.Hash(), prioItem.fee)
 			logSkippedDeps(tx, deps)
 			continue
 		}
@@ -789,7 +934,7 @@ mempoolLoop:
 		blockTxns = append(blockTxns, tx)
 		blockSize += txSize
 		blockSigOps += numSigOps
-		totalFees += prioItem.fee
+		totalFees = newTotalFees
 		txFees = append(txFees, prioItem.fee)
 		txSigOpCounts = append(txSigOpCounts, numSigOps)
 
@@ -798,12 +943,13 @@ mempoolLoop:
 
 		// Add transactions which depend on this one (and also do not
 		// have any other unsatisified dependencies) to the priority
-		// queue.
+		// queue.  The transactions selected by the selection hook are
+		// already in it.
 		for _, item := range deps {
 			// Add the transaction to the priority queue if there
 			// are no more dependencies after this one.
 			delete(item.dependsOn, *tx.Hash())
-			if len(item.dependsOn) == 0 {
+			if len(item.dependsOn) == 0 && g.selectionHook == nil {
 				heap.Push(priorityQueue, item)
 			}
 		}
@@ -811,25 +957,34 @@ mempoolLoop:
 
 	// Now that the actual transactions have been selected, update the
 	// block size for the real transaction count and coinbase value with
-	// the total fees accordingly.
+	// the total fees accordingly.  The hash and size of the coinbase
+	// transaction have already been memoized, so the changes are made to a
+	// copy which then replaces it in the block.
 	blockSize -= wire.MaxVarIntPayload -
 		uint32(wire.VarIntSerializeSize(uint64(len(blockTxns))))
-	coinbaseTx.MsgTx().TxOut[0].Value += totalFees
-	txFees[0] = -totalFees
+	coinbaseMsgTx := coinbaseTx.MsgTx().Copy()
+	cbValue, err := coinbaseValue(coinbaseMsgTx.TxOut[0].Value, totalFees)
+	if err != nil {
+		return nil, err
+	}
+	coinbaseMsgTx.TxOut[0].Value = cbValue
+	txFees[0] = -int64(totalFees)
 
 	// Coinbase transactions that pay out zero value can avoid making new
 	// UTXOs by spending to a nullDataTy.  The header block size must be
 	// updated accordingly.
-	if coinbaseTx.MsgTx().TxOut[0].Value == 0 {
-		cbScriptByteLen := len(coinbaseTx.MsgTx().TxOut[0].PkScript)
+	if coinbaseMsgTx.TxOut[0].Value == 0 {
+		cbScriptByteLen := len(coinbaseMsgTx.TxOut[0].PkScript)
 		nullScript, err := txscript.NewScriptBuilder().
 			AddOp(txscript.OP_RETURN).Script()
 		if err != nil {
 			return nil, err
 		}
 		blockSize -= uint32(cbScriptByteLen - len(nullScript))
-		coinbaseTx.MsgTx().TxOut[0].PkScript = nullScript
+		coinbaseMsgTx.TxOut[0].PkScript = nullScript
 	}
+	coinbaseTx = provautil.NewTx(coinbaseMsgTx)
+	blockTxns[0] = coinbaseTx
 
 	// Calculate the required difficulty for the block.  The timestamp
 	// is potentially adjusted to ensure it comes after the median time of
@@ -849,7 +1004,7 @@ mempoolLoop:
 		MerkleRoot: *merkles[len(merkles)-1],
 		Timestamp:  ts,
 		Bits:       reqDifficulty,
-		Height:     uint32(nextBlockHeight),
+		Height:     nextBlockHeight,
 		Size:       blockSize,
 	}
 
@@ -872,15 +1027,22 @@ mempoolLoop:
 
 	log.Debugf("Created new block template (%d transactions, %d in "+
 		"fees, %d signature operations, %d bytes, target difficulty "+
-		"%064x)", len(msgBlock.Transactions), totalFees, blockSigOps,
-		blockSize, blockchain.CompactToBig(msgBlock.Header.Bits))
+		"%064x)", len(msgBlock.Transactions), int64(totalFees),
+		blockSigOps, blockSize,
+		blockchain.CompactToBig(msgBlock.Header.Bits))
+	g.metrics.buildTime.ObserveDuration(time.Since(start))
+	g.metrics.txs.Set(int64(len(msgBlock.Transactions)))
 
 	return &BlockTemplate{
 		Block:           &msgBlock,
 		Fees:            txFees,
 		SigOpCounts:     txSigOpCounts,
-		Height:          nextBlockHeight,
+		Height:          block.Height(),
 		ValidPayAddress: payToAddress != nil,
+		Stats: TemplateStats{
+			Candidates: len(candidates),
+			Dropped:    dropped,
+		},
 	}, nil
 }
 
@@ -921,3 +1083,52 @@ func (g *BlkTmplGenerator) BestSnapshot() *blockchain.BestState {
 func (g *BlkTmplGenerator) TxSource() TxSource {
 	return g.txSource
 }
+
+// WithTxSource returns a block template generator which is identical to this
+// one except that it takes transactions from the passed source.
+//
+// This function is safe for concurrent access.
+func (g *BlkTmplGenerator) WithTxSource(txSource TxSource) *BlkTmplGenerator {
+	gen := *g
+	gen.txSource = txSource
+	return &gen
+}
+
+// WithSelectionHook returns a block template generator which is identical to
+// this one except that the passed hook decides which transactions are included
+// in the block templates.  A nil hook restores the default prioritization.  See
+// SelectionHook and NewBlockTemplate for details.
+//
+// This function is safe for concurrent access.
+func (g *BlkTmplGenerator) WithSelectionHook(hook SelectionHook) *BlkTmplGenerator {
+	gen := *g
+	gen.selectionHook = hook
+	return &gen
+}
+
+// WithMetrics returns a block template generator which is identical to this
+// one except that it tracks the block templates it generates with metrics
+// registered with the passed registry.  Since the metrics can only be
+// registered once, it must be called at most once per registry.
+//
+// This function is safe for concurrent access.
+func (g *BlkTmplGenerator) WithMetrics(registry *metrics.Registry) *BlkTmplGenerator {
+	gen := *g
+	gen.metrics = templateMetrics{
+		buildTime: registry.NewHistogram(
+			"prova_mining_template_build_seconds",
+			"Time taken to generate block templates.",
+			metrics.DurationBuckets),
+		txs: registry.NewGauge("prova_mining_template_transactions",
+			"Number of transactions in the last generated block "+
+				"template, including the coinbase."),
+	}
+	return &gen
+}
+
+// Policy returns the policy which is used to generate block templates.
+//
+// This function is safe for concurrent access.
+func (g *BlkTmplGenerator) Policy() *Policy {
+	return g.policy
+}
@@ -7,10 +7,16 @@ package mining
 
 import (
 	"container/heap"
+	"math"
 	"math/rand"
+	"reflect"
 	"testing"
 
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
 	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/wire"
 )
 
 // TestTxFeePrioHeap ensures the priority queue for transaction fees and
@@ -109,3 +115,264 @@ func TestTxFeePrioHeap(t *testing.T) {
 		highest = prioItem
 	}
 }
+
+// TestModifiedFeePerKB ensures transactions are scored with their fee deltas,
+// so a prioritised low-fee transaction is selected ahead of transactions which
+// pay higher fees, while a large negative fee delta excludes a transaction.
+func TestModifiedFeePerKB(t *testing.T) {
+	// newTxDesc returns a descriptor for a distinct transaction which pays
+	// the passed fee.
+	newTxDesc := func(i byte, fee int64) *TxDesc {
+		tx := wire.NewMsgTx(1)
+		prevOut := wire.NewOutPoint(&chainhash.Hash{i}, 0)
+		tx.AddTxIn(wire.NewTxIn(prevOut, nil))
+		tx.AddTxOut(wire.NewTxOut(1000, nil))
+		return &TxDesc{
+			Tx:       provautil.NewTx(tx),
+			Fee:      fee,
+			FeePerKB: fee * 1000 / int64(tx.SerializeSize()),
+		}
+	}
+	high := newTxDesc(1, 5000)
+	medium := newTxDesc(2, 3000)
+	low := newTxDesc(3, 100)
+
+	// selectionOrder returns the descriptors in the order they are popped
+	// from a priority queue sorted by fee.
+	selectionOrder := func(descs ...*TxDesc) []*TxDesc {
+		priorityQueue := newTxPriorityQueue(len(descs), true)
+		for _, txDesc := range descs {
+			feePerKB, excluded := modifiedFeePerKB(txDesc)
+			if excluded {
+				continue
+			}
+			heap.Push(priorityQueue, &txPrioItem{
+				tx:       txDesc.Tx,
+				fee:      txDesc.Fee,
+				feePerKB: feePerKB,
+			})
+		}
+		var order []*TxDesc
+		for priorityQueue.Len() > 0 {
+			prioItem := heap.Pop(priorityQueue).(*txPrioItem)
+			for _, txDesc := range descs {
+				if txDesc.Tx == prioItem.tx {
+					order = append(order, txDesc)
+				}
+			}
+		}
+		return order
+	}
+
+	tests := []struct {
+		name     string
+		feeDelta int64
+		want     []*TxDesc
+	}{
+		{
+			name: "no fee delta",
+			want: []*TxDesc{high, medium, low},
+		},
+		{
+			name:     "prioritised",
+			feeDelta: 10000,
+			want:     []*TxDesc{low, high, medium},
+		},
+		{
+			name:     "deprioritised below fee",
+			feeDelta: -100,
+			want:     []*TxDesc{high, medium, low},
+		},
+		{
+			name:     "deprioritised beyond fee",
+			feeDelta: -1000000,
+			want:     []*TxDesc{high, medium},
+		},
+	}
+	for _, test := range tests {
+		low.FeeDelta = test.feeDelta
+		got := selectionOrder(high, medium, low)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: mismatched selection order", test.name)
+		}
+
+		// The fee delta must never change the actual fee.
+		if low.Fee != 100 {
+			t.Errorf("%s: fee changed to %d", test.name, low.Fee)
+		}
+	}
+}
+
+// TestCoinbaseValue ensures the coinbase value of a block template pays the
+// subsidy plus the total fees and sums which can not be represented as an
+// amount are rejected.
+func TestCoinbaseValue(t *testing.T) {
+	subsidy := blockchain.CalcBlockSubsidy(1, &chaincfg.RegressionNetParams)
+
+	tests := []struct {
+		name    string
+		subsidy int64
+		fees    []int64
+		want    int64
+		wantErr error
+	}{
+		{
+			name:    "no fees",
+			subsidy: subsidy,
+			want:    subsidy,
+		},
+		{
+			name:    "subsidy and fees",
+			subsidy: subsidy,
+			fees:    []int64{1000, 2500, 0},
+			want:    subsidy + 3500,
+		},
+		{
+			name: "fees only",
+			fees: []int64{1000, 2500},
+			want: 3500,
+		},
+		{
+			name:    "overflow",
+			subsidy: math.MaxInt64 - 1000,
+			fees:    []int64{1000, 1},
+			wantErr: provautil.ErrAmountOverflow,
+		},
+	}
+	for _, test := range tests {
+		totalFees := provautil.Amount(0)
+		for _, fee := range test.fees {
+			newTotalFees, err := totalFees.Add(provautil.Amount(fee))
+			if err != nil {
+				t.Fatalf("%s: unexpected error summing fees: %v",
+					test.name, err)
+			}
+			totalFees = newTotalFees
+		}
+		got, err := coinbaseValue(test.subsidy, totalFees)
+		if err != test.wantErr {
+			t.Errorf("%s: unexpected error: got %v, want %v",
+				test.name, err, test.wantErr)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s: unexpected coinbase value: got %d, want %d",
+				test.name, got, test.want)
+		}
+	}
+}
+
+// TestSelectionHook ensures the transactions selected by a selection hook are
+// ordered as selected with every transaction following the transactions it
+// depends on, and selected transactions which can't be included are reported.
+func TestSelectionHook(t *testing.T) {
+	// newTxDesc returns a descriptor for a distinct transaction which
+	// spends the first output of the passed transaction, or an output of
+	// a transaction in the chain when it is nil.
+	newTxDesc := func(i byte, parent *TxDesc) *TxDesc {
+		prevHash := chainhash.Hash{i}
+		if parent != nil {
+			prevHash = *parent.Tx.Hash()
+		}
+		tx := wire.NewMsgTx(1)
+		tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&prevHash, 0), nil))
+		tx.AddTxOut(wire.NewTxOut(int64(i), nil))
+		return &TxDesc{Tx: provautil.NewTx(tx)}
+	}
+	parent := newTxDesc(1, nil)
+	child := newTxDesc(2, parent)
+	grandchild := newTxDesc(3, child)
+	independent := newTxDesc(4, nil)
+	other := newTxDesc(5, nil)
+	candidates := []*TxDesc{parent, child, grandchild, independent, other}
+
+	// newItems returns the priority items of the candidates with the
+	// dependencies between them set up.
+	newItems := func() map[chainhash.Hash]*txPrioItem {
+		items := make(map[chainhash.Hash]*txPrioItem)
+		for _, txDesc := range candidates {
+			item := &txPrioItem{tx: txDesc.Tx}
+			for _, txIn := range txDesc.Tx.MsgTx().TxIn {
+				prevHash := txIn.PreviousOutPoint.Hash
+				if _, ok := items[prevHash]; !ok {
+					continue
+				}
+				if item.dependsOn == nil {
+					item.dependsOn = make(map[chainhash.Hash]struct{})
+				}
+				item.dependsOn[prevHash] = struct{}{}
+			}
+			items[*txDesc.Tx.Hash()] = item
+		}
+		return items
+	}
+
+	policy := Policy{BlockMaxSize: 50000}
+	tests := []struct {
+		name    string
+		hook    SelectionHook
+		want    []*TxDesc
+		dropped []DroppedTx
+	}{
+		{
+			name: "reverse order",
+			hook: func(candidates []*TxDesc, policy Policy) []*TxDesc {
+				reversed := make([]*TxDesc, 0, len(candidates))
+				for i := len(candidates) - 1; i >= 0; i-- {
+					reversed = append(reversed, candidates[i])
+				}
+				return reversed
+			},
+			want: []*TxDesc{other, independent, parent, child,
+				grandchild},
+		},
+		{
+			name: "invalid dependency ordering",
+			hook: func(candidates []*TxDesc, policy Policy) []*TxDesc {
+				return []*TxDesc{grandchild, independent, child,
+					newTxDesc(6, nil), independent}
+			},
+			want: []*TxDesc{independent},
+			dropped: []DroppedTx{
+				{*newTxDesc(6, nil).Tx.Hash(), dropNotCandidate},
+				{*independent.Tx.Hash(), dropDuplicate},
+				{*child.Tx.Hash(), dropMissingDep},
+				{*grandchild.Tx.Hash(), dropMissingDep},
+			},
+		},
+	}
+	for _, test := range tests {
+		hook := func(hookCandidates []*TxDesc, hookPolicy Policy) []*TxDesc {
+			if !reflect.DeepEqual(hookCandidates, candidates) ||
+				hookPolicy != policy {
+
+				t.Errorf("%s: hook called with unexpected "+
+					"arguments", test.name)
+			}
+			return test.hook(hookCandidates, hookPolicy)
+		}
+		items, dropped := selectWithHook(hook, policy, candidates,
+			newItems())
+
+		var got []*TxDesc
+		for i, item := range items {
+			if item.order != i {
+				t.Errorf("%s: item #%d has order %d", test.name, i,
+					item.order)
+			}
+			for _, txDesc := range candidates {
+				if txDesc.Tx == item.tx {
+					got = append(got, txDesc)
+				}
+			}
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: unexpected order of %d selected "+
+				"transactions", test.name, len(got))
+		}
+		if !reflect.DeepEqual(dropped, test.dropped) {
+			t.Errorf("%s: got dropped transactions %v, want %v",
+				test.name, dropped, test.dropped)
+		}
+	}
+}
@@ -8,6 +8,7 @@ package mining
 import (
 	"github.com/bitgo/prova/blockchain"
 	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/txscript"
 	"github.com/bitgo/prova/wire"
 )
 
@@ -38,6 +39,36 @@ type Policy struct {
 	// required for a transaction to be treated as free for mining purposes
 	// (block template generation).
 	TxMinFreeFee provautil.Amount
+
+	// DisableStrictEncoding defines whether to include transactions with
+	// non-canonical signature or public key encodings, such as signatures
+	// with high S values, in block templates as long as the strict
+	// encoding deployment is not active.
+	DisableStrictEncoding bool
+
+	// TemplateFeeDelta is the minimum increase of the fees of the
+	// transactions added to the memory pool since the current block
+	// template was generated which makes the template stale, so clients
+	// long polling for block templates receive a new one right away
+	// instead of after the regeneration interval.  Zero disables the
+	// threshold.
+	TemplateFeeDelta provautil.Amount
+}
+
+// StandardScriptFlags returns the script flags transaction scripts must pass to
+// be accepted into the memory pool or block templates given the passed script
+// flags of the consensus deployments which are active for the next block, as
+// returned by BlockChain.NextBlockVerificationFlags.  These are
+// txscript.StandardVerifyFlags, without the strict encoding checks when
+// disableStrictEncoding is set.  The deployment flags are always included, so
+// the strict encoding checks are enforced regardless once the strict encoding
+// deployment is active.
+func StandardScriptFlags(disableStrictEncoding bool, deploymentFlags txscript.ScriptFlags) txscript.ScriptFlags {
+	flags := txscript.StandardVerifyFlags
+	if disableStrictEncoding {
+		flags &^= txscript.StrictEncodingVerifyFlags
+	}
+	return flags | deploymentFlags
 }
 
 // minInt is a helper function to return the minimum of two ints.  This avoids
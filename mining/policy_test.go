@@ -11,6 +11,7 @@ import (
 	"github.com/bitgo/prova/blockchain"
 	"github.com/bitgo/prova/chaincfg/chainhash"
 	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/txscript"
 	"github.com/bitgo/prova/wire"
 )
 
@@ -164,3 +165,32 @@ func TestCalcPriority(t *testing.T) {
 		}
 	}
 }
+
+// TestStandardScriptFlags ensures the strict encoding checks are only left out
+// of the standard script flags when disabled and the strict encoding
+// deployment is not yet active, and that the flags of the active deployments
+// are always included.
+func TestStandardScriptFlags(t *testing.T) {
+	strict := txscript.StrictEncodingVerifyFlags
+	csv := txscript.ScriptVerifyCheckSequenceVerify
+	lenient := txscript.StandardVerifyFlags &^ strict
+	tests := []struct {
+		name            string
+		disable         bool
+		deploymentFlags txscript.ScriptFlags
+		want            txscript.ScriptFlags
+	}{
+		{"strict before activation", false, 0, txscript.StandardVerifyFlags},
+		{"strict after activation", false, strict, txscript.StandardVerifyFlags},
+		{"disabled before activation", true, 0, lenient},
+		{"disabled after activation", true, strict, txscript.StandardVerifyFlags},
+		{"disabled with other deployments", true, csv, lenient | csv},
+	}
+
+	for _, test := range tests {
+		got := StandardScriptFlags(test.disable, test.deploymentFlags)
+		if got != test.want {
+			t.Errorf("%s: got flags %v, want %v", test.name, got, test.want)
+		}
+	}
+}
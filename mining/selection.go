@@ -0,0 +1,154 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package mining
+
+import (
+	"container/heap"
+
+	"github.com/bitgo/prova/chaincfg/chainhash"
+)
+
+// Reasons reported for the transactions selected by a SelectionHook which are
+// not included in a block template.
+const (
+	dropNotCandidate   = "not a candidate transaction"
+	dropDuplicate      = "selected more than once"
+	dropMissingDep     = "depends on a transaction which is not included"
+	dropBlockSize      = "exceeds the maximum block size"
+	dropBlockSigOps    = "exceeds the maximum signature operations per block"
+	dropInvalidInputs  = "invalid transaction inputs"
+	dropInvalidOutputs = "invalid transaction outputs"
+	dropInvalidScripts = "invalid transaction scripts"
+)
+
+// SelectionHook decides which of the candidate transactions are included in a
+// block template and in which order, in place of the prioritization described
+// on NewBlockTemplate.  The candidates are the transactions of the source pool
+// which may be included in the next block as far as they can tell without
+// knowing which other transactions are included.  The policy is the one the
+// block template generator was created with.
+//
+// The returned transactions must be a subset of the candidates.  The generator
+// moves transactions which are returned before transactions they depend on
+// after those, and only enforces the consensus constraints on the returned
+// transactions.  Transactions which violate them are dropped along with the
+// transactions which depend on them and reported in the TemplateStats of the
+// block template.
+type SelectionHook func(candidates []*TxDesc, policy Policy) []*TxDesc
+
+// DroppedTx describes a transaction selected by a SelectionHook which was not
+// included in a block template.
+type DroppedTx struct {
+	// Hash is the hash of the transaction.
+	Hash chainhash.Hash
+
+	// Reason describes why the transaction was not included.
+	Reason string
+}
+
+// TemplateStats houses statistics about the generation of a block template.
+type TemplateStats struct {
+	// Candidates is the number of transactions of the source pool which
+	// were considered for inclusion in the block template.
+	Candidates int
+
+	// Dropped holds the transactions selected by the SelectionHook of the
+	// generator which were not included in the block template.  It is
+	// always empty when the generator has no selection hook.
+	Dropped []DroppedTx
+}
+
+// txPQByOrder sorts a txPriorityQueue by the order assigned to the
+// transactions.
+func txPQByOrder(pq *txPriorityQueue, i, j int) bool {
+	return pq.items[i].order < pq.items[j].order
+}
+
+// selectWithHook passes the passed candidates to the selection hook and
+// returns the items of the selected transactions ordered as selected, except
+// transactions selected before transactions they depend on are moved after
+// them.  The passed items house the candidates keyed by their hashes.  Selected
+// transactions which are not candidates or depend on transactions which were
+// not selected are dropped and returned along with the reason.
+func selectWithHook(hook SelectionHook, policy Policy, candidates []*TxDesc,
+	items map[chainhash.Hash]*txPrioItem) ([]*txPrioItem, []DroppedTx) {
+
+	var dropped []DroppedTx
+	drop := func(hash *chainhash.Hash, reason string) {
+		log.Tracef("Dropping selected tx %s: %s", hash, reason)
+		dropped = append(dropped, DroppedTx{Hash: *hash, Reason: reason})
+	}
+
+	// Look up the items of the selected transactions.
+	selection := hook(candidates, policy)
+	selected := make(map[chainhash.Hash]*txPrioItem, len(selection))
+	ordered := make([]*txPrioItem, 0, len(selection))
+	for _, txDesc := range selection {
+		hash := txDesc.Tx.Hash()
+		item, ok := items[*hash]
+		if !ok {
+			drop(hash, dropNotCandidate)
+			continue
+		}
+		if _, ok := selected[*hash]; ok {
+			drop(hash, dropDuplicate)
+			continue
+		}
+		item.order = len(ordered)
+		selected[*hash] = item
+		ordered = append(ordered, item)
+	}
+
+	// Drop the transactions which depend on transactions which were not
+	// selected, along with the transactions which depend on those.
+	for dropping := true; dropping; {
+		dropping = false
+		for _, item := range ordered {
+			hash := *item.tx.Hash()
+			if _, ok := selected[hash]; !ok {
+				continue
+			}
+			for dep := range item.dependsOn {
+				if _, ok := selected[dep]; !ok {
+					delete(selected, hash)
+					drop(item.tx.Hash(), dropMissingDep)
+					dropping = true
+					break
+				}
+			}
+		}
+	}
+
+	// Order the remaining transactions as selected, but only once all of
+	// the transactions they depend on have been ordered.
+	pending := make(map[chainhash.Hash]int, len(selected))
+	dependers := make(map[chainhash.Hash][]*txPrioItem)
+	readyQueue := &txPriorityQueue{lessFunc: txPQByOrder}
+	for hash, item := range selected {
+		pending[hash] = len(item.dependsOn)
+		for dep := range item.dependsOn {
+			dependers[dep] = append(dependers[dep], item)
+		}
+		if len(item.dependsOn) == 0 {
+			heap.Push(readyQueue, item)
+		}
+	}
+	result := make([]*txPrioItem, 0, len(selected))
+	for readyQueue.Len() > 0 {
+		item := heap.Pop(readyQueue).(*txPrioItem)
+		result = append(result, item)
+		for _, depender := range dependers[*item.tx.Hash()] {
+			hash := *depender.tx.Hash()
+			pending[hash]--
+			if pending[hash] == 0 {
+				heap.Push(readyQueue, depender)
+			}
+		}
+	}
+	for i, item := range result {
+		item.order = i
+	}
+	return result, dropped
+}
@@ -0,0 +1,238 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// natpmpPort is the port NAT-PMP gateways listen on for requests.
+	natpmpPort = 5351
+
+	// natpmpVersion is the NAT-PMP protocol version.
+	natpmpVersion = 0
+
+	// natpmpInitialTimeout is the time to wait for the first response from
+	// the gateway.  It is doubled on every retransmission as described by
+	// RFC 6886.
+	natpmpInitialTimeout = 250 * time.Millisecond
+
+	// natpmpTries is the number of times a request is sent before giving
+	// up.  RFC 6886 suggests up to nine tries, but four are plenty on a
+	// local network and keep startup from stalling for over a minute when
+	// there is no gateway.
+	natpmpTries = 4
+)
+
+// NAT-PMP request opcodes.  The opcode of a response is the opcode of the
+// request plus natpmpResponseFlag.
+const (
+	natpmpOpExternalAddress = 0
+	natpmpOpMapUDP          = 1
+	natpmpOpMapTCP          = 2
+	natpmpResponseFlag      = 128
+)
+
+// natpmpResultCodes are the descriptions of the result codes defined by RFC
+// 6886.
+var natpmpResultCodes = map[uint16]string{
+	1: "unsupported version",
+	2: "not authorized or refused",
+	3: "network failure",
+	4: "out of resources",
+	5: "unsupported opcode",
+}
+
+// natPMP implements the NAT interface for a gateway which supports NAT-PMP as
+// described by RFC 6886.
+type natPMP struct {
+	gateway *net.UDPAddr
+
+	// timeout is the time to wait for the first response to a request.
+	timeout time.Duration
+}
+
+// newNATPMP returns a NAT-PMP client for the gateway at the passed address.
+func newNATPMP(gateway *net.UDPAddr) *natPMP {
+	return &natPMP{gateway: gateway, timeout: natpmpInitialTimeout}
+}
+
+// DiscoverNATPMP finds the default gateway of the local network and returns a
+// NAT for it if the gateway answers NAT-PMP requests.
+func DiscoverNATPMP() (NAT, error) {
+	gateway, err := defaultGateway()
+	if err != nil {
+		return nil, err
+	}
+	nat := newNATPMP(&net.UDPAddr{IP: gateway, Port: natpmpPort})
+	if _, err := nat.GetExternalAddress(); err != nil {
+		return nil, fmt.Errorf("gateway %s does not support NAT-PMP: %v",
+			gateway, err)
+	}
+	return nat, nil
+}
+
+// defaultGateway returns the IPv4 address of the default gateway from the
+// kernel routing table.  It is only supported on Linux.
+func defaultGateway() (net.IP, error) {
+	f, err := os.Open("/proc/net/route")
+	if err != nil {
+		return nil, errors.New("unable to read the routing table to " +
+			"find the default gateway")
+	}
+	defer f.Close()
+	return parseRouteTable(f)
+}
+
+// parseRouteTable returns the gateway of the default route in a routing table
+// formatted like /proc/net/route.  The destination and gateway columns are
+// IPv4 addresses in host byte order hex.
+func parseRouteTable(r io.Reader) (net.IP, error) {
+	scanner := bufio.NewScanner(r)
+
+	// Skip the header line.
+	scanner.Scan()
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || fields[1] != "00000000" {
+			continue
+		}
+		gw, err := strconv.ParseUint(fields[2], 16, 32)
+		if err != nil || gw == 0 {
+			continue
+		}
+		ip := make(net.IP, net.IPv4len)
+		binary.LittleEndian.PutUint32(ip, uint32(gw))
+		return ip, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, errors.New("no default gateway")
+}
+
+// request sends the passed request to the gateway and returns the response to
+// it, retransmitting the request with an exponentially increasing timeout
+// until a response is received.  The version, opcode and result code of the
+// response are checked and the response is guaranteed to be at least size
+// bytes.
+func (n *natPMP) request(msg []byte, size int) ([]byte, error) {
+	conn, err := net.DialUDP("udp4", nil, n.gateway)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	op := msg[1] + natpmpResponseFlag
+	buf := make([]byte, 16)
+	timeout := n.timeout
+	for i := 0; i < natpmpTries; i++ {
+		if _, err := conn.Write(msg); err != nil {
+			return nil, err
+		}
+		deadline := time.Now().Add(timeout)
+		timeout *= 2
+		if err := conn.SetReadDeadline(deadline); err != nil {
+			return nil, err
+		}
+		for {
+			nr, err := conn.Read(buf)
+			if err != nil {
+				if e, ok := err.(net.Error); ok && e.Timeout() {
+					break
+				}
+				return nil, err
+			}
+
+			// Ignore anything which is not a response to this
+			// request.
+			if nr < 4 || buf[0] != natpmpVersion || buf[1] != op {
+				continue
+			}
+			result := binary.BigEndian.Uint16(buf[2:4])
+			if result != 0 {
+				desc, ok := natpmpResultCodes[result]
+				if !ok {
+					desc = "result code " +
+						strconv.Itoa(int(result))
+				}
+				return nil, errors.New("NAT-PMP request " +
+					"failed: " + desc)
+			}
+			if nr < size {
+				return nil, errors.New("short NAT-PMP response")
+			}
+			return buf[:nr], nil
+		}
+	}
+	return nil, errors.New("no response from NAT-PMP gateway")
+}
+
+// GetExternalAddress implements the NAT interface by requesting the external
+// IPv4 address from the NAT-PMP gateway.
+func (n *natPMP) GetExternalAddress() (net.IP, error) {
+	response, err := n.request([]byte{natpmpVersion,
+		natpmpOpExternalAddress}, 12)
+	if err != nil {
+		return nil, err
+	}
+	ip := make(net.IP, net.IPv4len)
+	copy(ip, response[8:12])
+	return ip, nil
+}
+
+// mapPort sends a mapping request for the passed protocol and ports lasting
+// lifetime seconds, returning the external port granted by the gateway.
+func (n *natPMP) mapPort(protocol string, externalPort, internalPort, lifetime int) (int, error) {
+	var op byte
+	switch strings.ToLower(protocol) {
+	case "udp":
+		op = natpmpOpMapUDP
+	case "tcp":
+		op = natpmpOpMapTCP
+	default:
+		return 0, fmt.Errorf("unsupported protocol %q", protocol)
+	}
+
+	msg := make([]byte, 12)
+	msg[0] = natpmpVersion
+	msg[1] = op
+	binary.BigEndian.PutUint16(msg[4:6], uint16(internalPort))
+	binary.BigEndian.PutUint16(msg[6:8], uint16(externalPort))
+	binary.BigEndian.PutUint32(msg[8:12], uint32(lifetime))
+	response, err := n.request(msg, 16)
+	if err != nil {
+		return 0, err
+	}
+	if int(binary.BigEndian.Uint16(response[8:10])) != internalPort {
+		return 0, errors.New("NAT-PMP gateway mapped the wrong " +
+			"internal port")
+	}
+	return int(binary.BigEndian.Uint16(response[10:12])), nil
+}
+
+// AddPortMapping implements the NAT interface by requesting a mapping from the
+// NAT-PMP gateway.  The gateway may grant a different external port than the
+// requested one, which is returned.
+func (n *natPMP) AddPortMapping(protocol string, externalPort, internalPort int, description string, timeout int) (int, error) {
+	return n.mapPort(protocol, externalPort, internalPort, timeout)
+}
+
+// DeletePortMapping implements the NAT interface by requesting a mapping with
+// a zero lifetime, which removes the mapping of the internal port.
+func (n *natPMP) DeletePortMapping(protocol string, externalPort, internalPort int) error {
+	_, err := n.mapPort(protocol, 0, internalPort, 0)
+	return err
+}
@@ -0,0 +1,269 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mockNATPMPGateway is a NAT-PMP gateway listening on the loopback interface
+// which answers requests with the responses returned by its handler.  Requests
+// the handler returns nil for are dropped.
+type mockNATPMPGateway struct {
+	conn     *net.UDPConn
+	requests chan []byte
+}
+
+// newMockNATPMPGateway starts a mock gateway with the passed handler.
+func newMockNATPMPGateway(t *testing.T, handler func(req []byte) []byte) *mockNATPMPGateway {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("ListenUDP: unexpected error %v", err)
+	}
+	g := &mockNATPMPGateway{conn: conn, requests: make(chan []byte, 100)}
+	go func() {
+		buf := make([]byte, 64)
+		for {
+			n, addr, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			req := append([]byte(nil), buf[:n]...)
+			g.requests <- req
+			if resp := handler(req); resp != nil {
+				conn.WriteToUDP(resp, addr)
+			}
+		}
+	}()
+	return g
+}
+
+// client returns a NAT-PMP client for the mock gateway which retransmits
+// requests quickly.
+func (g *mockNATPMPGateway) client() *natPMP {
+	nat := newNATPMP(g.conn.LocalAddr().(*net.UDPAddr))
+	nat.timeout = 10 * time.Millisecond
+	return nat
+}
+
+// natpmpResponse returns a response to the passed request with the result code
+// and payload following the seconds since epoch field.
+func natpmpResponse(req []byte, result uint16, payload ...byte) []byte {
+	resp := make([]byte, 8, 8+len(payload))
+	resp[1] = req[1] + natpmpResponseFlag
+	binary.BigEndian.PutUint16(resp[2:4], result)
+	binary.BigEndian.PutUint32(resp[4:8], 1234)
+	return append(resp, payload...)
+}
+
+// natpmpGatewayHandler returns a handler for a gateway with the passed external
+// address which maps TCP ports to the internal port plus offset.  The first
+// drop requests are not answered.
+func natpmpGatewayHandler(external net.IP, offset uint16, drop int) func([]byte) []byte {
+	return func(req []byte) []byte {
+		if drop > 0 {
+			drop--
+			return nil
+		}
+		switch req[1] {
+		case natpmpOpExternalAddress:
+			return natpmpResponse(req, 0, external.To4()...)
+		case natpmpOpMapTCP:
+			payload := make([]byte, 8)
+			internal := binary.BigEndian.Uint16(req[4:6])
+			binary.BigEndian.PutUint16(payload[0:2], internal)
+			binary.BigEndian.PutUint16(payload[2:4], internal+offset)
+			copy(payload[4:8], req[8:12])
+			return natpmpResponse(req, 0, payload...)
+		}
+		return natpmpResponse(req, 5)
+	}
+}
+
+// TestNATPMP ensures the NAT-PMP client sends requests as described by RFC 6886
+// and interprets the responses of the gateway.
+func TestNATPMP(t *testing.T) {
+	external := net.ParseIP("1.2.3.4")
+	g := newMockNATPMPGateway(t, natpmpGatewayHandler(external, 10, 0))
+	defer g.conn.Close()
+	nat := g.client()
+
+	ip, err := nat.GetExternalAddress()
+	if err != nil {
+		t.Fatalf("GetExternalAddress: unexpected error %v", err)
+	}
+	if !ip.Equal(external) {
+		t.Fatalf("GetExternalAddress: got %v, want %v", ip, external)
+	}
+	if req := <-g.requests; !bytes.Equal(req, []byte{0, 0}) {
+		t.Fatalf("external address request: got %x", req)
+	}
+
+	mapped, err := nat.AddPortMapping("tcp", 18333, 18333, "", 1200)
+	if err != nil {
+		t.Fatalf("AddPortMapping: unexpected error %v", err)
+	}
+	if mapped != 18343 {
+		t.Fatalf("AddPortMapping: got port %d, want %d", mapped, 18343)
+	}
+	want := []byte{0, 2, 0, 0, 0x47, 0x9d, 0x47, 0x9d, 0, 0, 0x04, 0xb0}
+	if req := <-g.requests; !bytes.Equal(req, want) {
+		t.Fatalf("map request: got %x, want %x", req, want)
+	}
+
+	// Mappings are removed by requesting a zero lifetime and external
+	// port for the internal port.
+	if err := nat.DeletePortMapping("tcp", 18343, 18333); err != nil {
+		t.Fatalf("DeletePortMapping: unexpected error %v", err)
+	}
+	want = []byte{0, 2, 0, 0, 0x47, 0x9d, 0, 0, 0, 0, 0, 0}
+	if req := <-g.requests; !bytes.Equal(req, want) {
+		t.Fatalf("delete request: got %x, want %x", req, want)
+	}
+
+	if _, err := nat.AddPortMapping("sctp", 1, 1, "", 1); err == nil {
+		t.Fatalf("AddPortMapping: unsupported protocol accepted")
+	}
+}
+
+// TestNATPMPRetransmit ensures requests are retransmitted until the gateway
+// answers and fail once the gateway never answers.
+func TestNATPMPRetransmit(t *testing.T) {
+	external := net.ParseIP("1.2.3.4")
+	g := newMockNATPMPGateway(t, natpmpGatewayHandler(external, 0, 2))
+	defer g.conn.Close()
+
+	if _, err := g.client().GetExternalAddress(); err != nil {
+		t.Fatalf("GetExternalAddress: unexpected error %v", err)
+	}
+	if len(g.requests) != 3 {
+		t.Fatalf("got %d requests, want 3", len(g.requests))
+	}
+
+	silent := newMockNATPMPGateway(t, func([]byte) []byte { return nil })
+	defer silent.conn.Close()
+	_, err := silent.client().GetExternalAddress()
+	if err == nil || !strings.Contains(err.Error(), "no response") {
+		t.Fatalf("GetExternalAddress: got error %v, want no response",
+			err)
+	}
+	if len(silent.requests) != natpmpTries {
+		t.Fatalf("got %d requests, want %d", len(silent.requests),
+			natpmpTries)
+	}
+}
+
+// TestNATPMPErrors ensures failed and malformed responses are reported and
+// responses to other requests are ignored.
+func TestNATPMPErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler func(req []byte) []byte
+		err     string
+	}{
+		{
+			name: "refused",
+			handler: func(req []byte) []byte {
+				return natpmpResponse(req, 2)
+			},
+			err: "not authorized or refused",
+		},
+		{
+			name: "unknown result code",
+			handler: func(req []byte) []byte {
+				return natpmpResponse(req, 42)
+			},
+			err: "result code 42",
+		},
+		{
+			name: "short response",
+			handler: func(req []byte) []byte {
+				return natpmpResponse(req, 0, 1, 2)
+			},
+			err: "short NAT-PMP response",
+		},
+		{
+			name: "wrong internal port",
+			handler: func(req []byte) []byte {
+				return natpmpResponse(req, 0, 0, 1, 0, 1, 0, 0,
+					0, 1)
+			},
+			err: "wrong internal port",
+		},
+		{
+			name: "wrong opcode",
+			handler: func(req []byte) []byte {
+				resp := natpmpResponse(req, 0, make([]byte, 8)...)
+				resp[1]++
+				return resp
+			},
+			err: "no response",
+		},
+	}
+
+	for _, test := range tests {
+		g := newMockNATPMPGateway(t, test.handler)
+		_, err := g.client().AddPortMapping("tcp", 18333, 18333, "",
+			1200)
+		g.conn.Close()
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: got error %v, want %q", test.name, err,
+				test.err)
+		}
+	}
+}
+
+// TestParseRouteTable ensures the default gateway is read from the routing
+// table.
+func TestParseRouteTable(t *testing.T) {
+	const header = "Iface\tDestination\tGateway \tFlags\tRefCnt\tUse\t" +
+		"Metric\tMask\t\tMTU\tWindow\tIRTT\n"
+	tests := []struct {
+		name  string
+		table string
+		want  net.IP
+	}{
+		{
+			name: "default route",
+			table: header +
+				"eth0\t0000A8C0\t00000000\t0001\t0\t0\t0\t00FFFFFF\t0\t0\t0\n" +
+				"eth0\t00000000\t0100A8C0\t0003\t0\t0\t0\t00000000\t0\t0\t0\n",
+			want: net.IPv4(192, 168, 0, 1),
+		},
+		{
+			name: "no default route",
+			table: header +
+				"eth0\t0000A8C0\t00000000\t0001\t0\t0\t0\t00FFFFFF\t0\t0\t0\n",
+		},
+		{
+			name:  "empty",
+			table: "",
+		},
+	}
+
+	for _, test := range tests {
+		ip, err := parseRouteTable(strings.NewReader(test.table))
+		if test.want == nil {
+			if err == nil {
+				t.Errorf("%s: got gateway %v, want error",
+					test.name, ip)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+		if !ip.Equal(test.want) {
+			t.Errorf("%s: got gateway %v, want %v", test.name, ip,
+				test.want)
+		}
+	}
+}
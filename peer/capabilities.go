@@ -0,0 +1,112 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/bitgo/prova/wire"
+)
+
+// Capabilities is a bitset of the optional protocol features a remote peer
+// negotiated with messages after its version message.
+type Capabilities uint32
+
+const (
+	// CapSendHeaders indicates the peer sent a sendheaders message, so new
+	// blocks are announced to it with headers messages instead of
+	// inventory vectors.
+	CapSendHeaders Capabilities = 1 << iota
+
+	// CapCmpctBlocks indicates the peer sent a sendcmpct message for the
+	// supported compact block version, so blocks may be requested from it
+	// as compact blocks.
+	CapCmpctBlocks
+
+	// CapFeeFilter indicates the peer sent a feefilter message, so
+	// transactions below its minimum fee rate are not announced to it.
+	CapFeeFilter
+
+	// CapAddrV2 indicates the peer sent a sendaddrv2 message before its
+	// verack message, so addresses are relayed to it with addrv2 messages.
+	CapAddrV2
+)
+
+// capNames maps the capabilities to the names they are displayed with, such as
+// by getpeerinfo.  The names are the commands of the messages which negotiate
+// them.
+var capNames = map[Capabilities]string{
+	CapSendHeaders: wire.CmdSendHeaders,
+	CapCmpctBlocks: wire.CmdSendCmpct,
+	CapFeeFilter:   wire.CmdFeeFilter,
+	CapAddrV2:      wire.CmdSendAddrV2,
+}
+
+// orderedCaps is an ordered list of the capabilities from lowest to highest
+// bit.
+var orderedCaps = []Capabilities{
+	CapSendHeaders,
+	CapCmpctBlocks,
+	CapFeeFilter,
+	CapAddrV2,
+}
+
+// negotiatedCapability returns the capability the passed message received from
+// the peer negotiates, and whether it negotiates one at all.  It is the hook to
+// extend when adding a capability.
+func (p *Peer) negotiatedCapability(msg wire.Message) (Capabilities, bool) {
+	switch msg := msg.(type) {
+	case *wire.MsgSendHeaders:
+		return CapSendHeaders, true
+
+	case *wire.MsgSendCmpct:
+		// Versions of the compact block protocol other than the
+		// supported one are ignored.
+		return CapCmpctBlocks, msg.CmpctBlockVersion == wire.CmpctBlockVersion
+
+	case *wire.MsgFeeFilter:
+		return CapFeeFilter, true
+
+	case *wire.MsgSendAddrV2:
+		// The sendaddrv2 message is only valid before the verack
+		// message.
+		return CapAddrV2, !p.VerAckReceived()
+	}
+	return 0, false
+}
+
+// Names returns the names of the capabilities in the set ordered from lowest to
+// highest bit.  Unknown capabilities are omitted.
+func (c Capabilities) Names() []string {
+	names := make([]string, 0, len(orderedCaps))
+	for _, capability := range orderedCaps {
+		if c&capability == capability {
+			names = append(names, capNames[capability])
+		}
+	}
+	return names
+}
+
+// String returns the Capabilities in human-readable form.
+func (c Capabilities) String() string {
+	// No capabilities are set.
+	if c == 0 {
+		return "0x0"
+	}
+
+	// Add the known capabilities followed by any remaining bits as hex.
+	s := strings.Join(c.Names(), "|")
+	for _, capability := range orderedCaps {
+		c &^= capability
+	}
+	if c != 0 {
+		if s != "" {
+			s += "|"
+		}
+		s += "0x" + strconv.FormatUint(uint64(c), 16)
+	}
+	return s
+}
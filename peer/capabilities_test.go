@@ -0,0 +1,185 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer_test
+
+import (
+	"io"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/peer"
+	"github.com/bitgo/prova/wire"
+)
+
+// TestCapabilitiesString ensures the capabilities are named after the commands
+// which negotiate them and unknown bits are displayed as hex.
+func TestCapabilitiesString(t *testing.T) {
+	tests := []struct {
+		in    peer.Capabilities
+		names []string
+		want  string
+	}{
+		{0, []string{}, "0x0"},
+		{peer.CapSendHeaders, []string{"sendheaders"}, "sendheaders"},
+		{peer.CapCmpctBlocks | peer.CapAddrV2,
+			[]string{"sendcmpct", "sendaddrv2"}, "sendcmpct|sendaddrv2"},
+		{peer.CapSendHeaders | peer.CapCmpctBlocks | peer.CapFeeFilter |
+			peer.CapAddrV2, []string{"sendheaders", "sendcmpct",
+			"feefilter", "sendaddrv2"},
+			"sendheaders|sendcmpct|feefilter|sendaddrv2"},
+		{peer.CapFeeFilter | 0x100, []string{"feefilter"},
+			"feefilter|0x100"},
+		{0x100, []string{}, "0x100"},
+	}
+	for _, test := range tests {
+		if names := test.in.Names(); !reflect.DeepEqual(names, test.names) {
+			t.Errorf("Names(%d): got %v, want %v", uint32(test.in),
+				names, test.names)
+		}
+		if s := test.in.String(); s != test.want {
+			t.Errorf("String(%d): got %v, want %v", uint32(test.in),
+				s, test.want)
+		}
+	}
+}
+
+// capabilityMsgs returns the messages which negotiate the passed capabilities
+// after the verack message.
+func capabilityMsgs(caps peer.Capabilities) []wire.Message {
+	var msgs []wire.Message
+	if caps&peer.CapSendHeaders != 0 {
+		msgs = append(msgs, wire.NewMsgSendHeaders())
+	}
+	if caps&peer.CapCmpctBlocks != 0 {
+		msgs = append(msgs, wire.NewMsgSendCmpct(false,
+			wire.CmpctBlockVersion))
+	}
+	if caps&peer.CapFeeFilter != 0 {
+		msgs = append(msgs, wire.NewMsgFeeFilter(1000))
+	}
+	return msgs
+}
+
+// TestPeerCapabilities ensures the capabilities a remote peer negotiates are
+// tracked for every combination of them, that messages which do not negotiate
+// a capability are ignored, and that addresses are relayed with addrv2 messages
+// only to peers which negotiated them.
+func TestPeerCapabilities(t *testing.T) {
+	all := peer.CapSendHeaders | peer.CapCmpctBlocks | peer.CapFeeFilter |
+		peer.CapAddrV2
+	for caps := peer.Capabilities(0); caps <= all; caps++ {
+		// Negotiate the capabilities from a mock remote peer followed by
+		// an unsupported compact block version, which does not negotiate
+		// a capability.
+		inConn, remoteConn := pipe(
+			&conn{raddr: "10.0.0.1:8333"},
+			&conn{raddr: "10.0.0.2:8333"},
+		)
+		inPeer := peer.NewInboundPeer(&peer.Config{
+			ChainParams: &chaincfg.MainNetParams,
+		})
+		inPeer.AssociateConnection(inConn)
+		received := make(chan wire.Message, 10)
+		go func() {
+			for {
+				msg, _, err := wire.ReadMessage(remoteConn,
+					wire.ProtocolVersion, wire.MainNet)
+				if err != nil {
+					return
+				}
+				received <- msg
+			}
+		}()
+
+		me := wire.NewNetAddressIPPort(net.ParseIP("10.0.0.2"), 8333, 0)
+		you := wire.NewNetAddressIPPort(net.ParseIP("10.0.0.1"), 8333, 0)
+		msgs := []wire.Message{wire.NewMsgVersion(me, you, 1, 0)}
+		if caps&peer.CapAddrV2 != 0 {
+			msgs = append(msgs, wire.NewMsgSendAddrV2())
+		}
+		msgs = append(msgs, wire.NewMsgVerAck())
+		msgs = append(msgs, capabilityMsgs(caps)...)
+		msgs = append(msgs, wire.NewMsgSendCmpct(true,
+			wire.CmpctBlockVersion+1))
+		msgs = append(msgs, wire.NewMsgPing(7))
+		for _, msg := range msgs {
+			err := wire.WriteMessage(remoteConn, msg,
+				wire.ProtocolVersion, wire.MainNet)
+			if err != nil {
+				t.Fatalf("%v: WriteMessage: unexpected err %v",
+					caps, err)
+			}
+		}
+
+		// The pong is sent after all of the previous messages were
+		// handled.
+	waitPong:
+		for {
+			select {
+			case msg := <-received:
+				if _, ok := msg.(*wire.MsgPong); ok {
+					break waitPong
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("%v: pong timeout", caps)
+			}
+		}
+
+		if got := inPeer.Capabilities(); got != caps {
+			t.Errorf("%v: got capabilities %v", caps, got)
+		}
+		if got := inPeer.StatsSnapshot().Capabilities; got != caps {
+			t.Errorf("%v: got snapshot capabilities %v", caps, got)
+		}
+		for _, c := range []peer.Capabilities{peer.CapSendHeaders,
+			peer.CapCmpctBlocks, peer.CapFeeFilter, peer.CapAddrV2} {
+
+			if inPeer.HasCapability(c) != (caps&c != 0) {
+				t.Errorf("%v: HasCapability(%v) = %v", caps, c,
+					inPeer.HasCapability(c))
+			}
+		}
+		if inPeer.WantsHeaders() != (caps&peer.CapSendHeaders != 0) {
+			t.Errorf("%v: WantsHeaders = %v", caps,
+				inPeer.WantsHeaders())
+		}
+
+		// Ensure addresses are relayed with the negotiated message.
+		na := wire.NewNetAddressIPPort(net.ParseIP("10.0.0.3"), 8333,
+			wire.SFNodeNetwork)
+		if _, err := inPeer.PushAddrMsg([]*wire.NetAddress{na}); err != nil {
+			t.Fatalf("%v: PushAddrMsg: unexpected err %v", caps, err)
+		}
+	waitAddr:
+		for {
+			select {
+			case msg := <-received:
+				switch msg.(type) {
+				case *wire.MsgAddr:
+					if caps&peer.CapAddrV2 != 0 {
+						t.Errorf("%v: got addr message",
+							caps)
+					}
+					break waitAddr
+				case *wire.MsgAddrV2:
+					if caps&peer.CapAddrV2 == 0 {
+						t.Errorf("%v: got addrv2 message",
+							caps)
+					}
+					break waitAddr
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("%v: address timeout", caps)
+			}
+		}
+
+		inPeer.Disconnect()
+		inPeer.WaitForDisconnect()
+		remoteConn.Reader.(*io.PipeReader).Close()
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer
+
+import (
+	"sync/atomic"
+
+	"github.com/bitgo/prova/wire"
+)
+
+// OtherMsgCommand is the command the traffic of messages with unknown commands,
+// along with the bytes of messages which failed to be read, is tallied under.
+const OtherMsgCommand = "*other*"
+
+// msgCommands are the commands whose traffic is tallied separately.
+var msgCommands = [...]string{
+	wire.CmdVersion,
+	wire.CmdVerAck,
+	wire.CmdGetAddr,
+	wire.CmdAddr,
+	wire.CmdGetBlocks,
+	wire.CmdInv,
+	wire.CmdGetData,
+	wire.CmdNotFound,
+	wire.CmdBlock,
+	wire.CmdTx,
+	wire.CmdGetHeaders,
+	wire.CmdHeaders,
+	wire.CmdPing,
+	wire.CmdPong,
+	wire.CmdAlert,
+	wire.CmdMemPool,
+	wire.CmdFilterAdd,
+	wire.CmdFilterClear,
+	wire.CmdFilterLoad,
+	wire.CmdMerkleBlock,
+	wire.CmdReject,
+	wire.CmdSendHeaders,
+	wire.CmdFeeFilter,
+	wire.CmdSendCmpct,
+	wire.CmdCmpctBlock,
+	wire.CmdGetBlockTxn,
+	wire.CmdBlockTxn,
+	wire.CmdSendAddrV2,
+	wire.CmdAddrV2,
+	wire.CmdValidatorKey,
+	OtherMsgCommand,
+}
+
+// msgCommandIndex maps the commands whose traffic is tallied separately to
+// their index in msgCommands.  It is never modified after initialization, so
+// it is safe to read from concurrently.
+var msgCommandIndex = func() map[string]int {
+	index := make(map[string]int, len(msgCommands))
+	for i, command := range msgCommands {
+		index[command] = i
+	}
+	return index
+}()
+
+// MsgStats is the number of messages of a command and their total size in
+// bytes, including the message headers.
+type MsgStats struct {
+	Count uint64
+	Bytes uint64
+}
+
+// MsgTally tallies the number of messages and bytes per message command.  The
+// counters are only updated with atomic adds, so tallying is cheap enough to
+// always be enabled.  The zero value is ready to use.
+type MsgTally struct {
+	// The following variables must only be used atomically.
+	stats [len(msgCommands)]MsgStats
+}
+
+// Add tallies a message of the passed command and size.  Messages with unknown
+// commands are tallied under OtherMsgCommand.
+//
+// This function is safe for concurrent access.
+func (t *MsgTally) Add(command string, bytes int) {
+	i, ok := msgCommandIndex[command]
+	if !ok {
+		i = msgCommandIndex[OtherMsgCommand]
+	}
+	atomic.AddUint64(&t.stats[i].Count, 1)
+	atomic.AddUint64(&t.stats[i].Bytes, uint64(bytes))
+}
+
+// Snapshot returns the tallies of the commands of which messages were tallied
+// keyed by their command.
+//
+// This function is safe for concurrent access.
+func (t *MsgTally) Snapshot() map[string]MsgStats {
+	snapshot := make(map[string]MsgStats)
+	for i := range t.stats {
+		count := atomic.LoadUint64(&t.stats[i].Count)
+		if count == 0 {
+			continue
+		}
+		snapshot[msgCommands[i]] = MsgStats{
+			Count: count,
+			Bytes: atomic.LoadUint64(&t.stats[i].Bytes),
+		}
+	}
+	return snapshot
+}
@@ -0,0 +1,168 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package peer_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/peer"
+	"github.com/bitgo/prova/wire"
+)
+
+// TestMsgTally ensures messages are tallied per command and messages with
+// unknown commands are tallied together.
+func TestMsgTally(t *testing.T) {
+	var tally peer.MsgTally
+	if snapshot := tally.Snapshot(); len(snapshot) != 0 {
+		t.Fatalf("unexpected tallies %v", snapshot)
+	}
+	tally.Add(wire.CmdBlock, 1000)
+	tally.Add(wire.CmdBlock, 500)
+	tally.Add(wire.CmdPing, 32)
+	tally.Add("unknown", 30)
+	tally.Add("other", 40)
+	want := map[string]peer.MsgStats{
+		wire.CmdBlock:        {Count: 2, Bytes: 1500},
+		wire.CmdPing:         {Count: 1, Bytes: 32},
+		peer.OtherMsgCommand: {Count: 2, Bytes: 70},
+	}
+	if snapshot := tally.Snapshot(); !reflect.DeepEqual(snapshot, want) {
+		t.Fatalf("got tallies %v, want %v", snapshot, want)
+	}
+}
+
+// TestPeerMsgStats ensures the per command message tallies and the ping
+// statistics of two connected peers advance as they exchange messages.
+func TestPeerMsgStats(t *testing.T) {
+	verack := make(chan struct{}, 4)
+	pong := make(chan struct{}, 3)
+	newConfig := func() *peer.Config {
+		return &peer.Config{
+			Listeners: peer.MessageListeners{
+				OnVerAck: func(*peer.Peer, *wire.MsgVerAck) {
+					verack <- struct{}{}
+				},
+				OnWrite: func(_ *peer.Peer, _ int, msg wire.Message, _ error) {
+					switch msg.(type) {
+					case *wire.MsgVerAck:
+						verack <- struct{}{}
+					case *wire.MsgPing, *wire.MsgPong:
+						pong <- struct{}{}
+					}
+				},
+				OnPong: func(*peer.Peer, *wire.MsgPong) {
+					pong <- struct{}{}
+				},
+			},
+			ChainParams: &chaincfg.MainNetParams,
+		}
+	}
+	inConn, outConn := pipe(
+		&conn{raddr: "10.0.0.1:8333"},
+		&conn{raddr: "10.0.0.2:8333"},
+	)
+	inPeer := peer.NewInboundPeer(newConfig())
+	inPeer.AssociateConnection(inConn)
+	outPeer, err := peer.NewOutboundPeer(newConfig(), "10.0.0.2:8333")
+	if err != nil {
+		t.Fatalf("NewOutboundPeer: unexpected err %v", err)
+	}
+	outPeer.AssociateConnection(outConn)
+	defer func() {
+		inPeer.Disconnect()
+		outPeer.Disconnect()
+		inPeer.WaitForDisconnect()
+		outPeer.WaitForDisconnect()
+	}()
+	for i := 0; i < 4; i++ {
+		select {
+		case <-verack:
+		case <-time.After(time.Second):
+			t.Fatal("verack timeout")
+		}
+	}
+
+	// The handshake is tallied by both peers, and the messages sent by one
+	// of them are the ones received by the other.
+	for _, p := range []*peer.Peer{inPeer, outPeer} {
+		stats := p.StatsSnapshot()
+		for _, cmd := range []string{wire.CmdVersion, wire.CmdSendAddrV2,
+			wire.CmdVerAck} {
+
+			if stats.MsgsSent[cmd].Count != 1 ||
+				stats.MsgsRecv[cmd].Count != 1 {
+
+				t.Fatalf("%v: got sent messages %v and received "+
+					"messages %v, want one %s message", p,
+					stats.MsgsSent, stats.MsgsRecv, cmd)
+			}
+		}
+		if len(stats.MsgsSent) != 3 || len(stats.MsgsRecv) != 3 {
+			t.Fatalf("%v: got sent messages %v and received messages "+
+				"%v, want the handshake", p, stats.MsgsSent,
+				stats.MsgsRecv)
+		}
+	}
+	if !reflect.DeepEqual(outPeer.MsgsSent(), inPeer.MsgsReceived()) ||
+		!reflect.DeepEqual(inPeer.MsgsSent(), outPeer.MsgsReceived()) {
+
+		t.Fatal("messages sent by one peer differ from the ones " +
+			"received by the other")
+	}
+
+	// Ping the inbound peer twice and ensure the ping and pong messages
+	// and the round-trip times are tallied once the ping was sent and the
+	// pong was both sent and received.
+	for i := uint64(1); i <= 2; i++ {
+		outPeer.QueueMessage(wire.NewMsgPing(i), nil)
+		for j := 0; j < 3; j++ {
+			select {
+			case <-pong:
+			case <-time.After(time.Second):
+				t.Fatal("pong timeout")
+			}
+		}
+		if outPeer.LastPingNonce() != 0 {
+			t.Fatalf("ping %d was not answered", i)
+		}
+		want := peer.MsgStats{Count: i, Bytes: 32 * i}
+		if got := outPeer.MsgsSent()[wire.CmdPing]; got != want {
+			t.Fatalf("got sent pings %+v, want %+v", got, want)
+		}
+		if got := outPeer.MsgsReceived()[wire.CmdPong]; got != want {
+			t.Fatalf("got received pongs %+v, want %+v", got, want)
+		}
+		if got := inPeer.MsgsReceived()[wire.CmdPing]; got != want {
+			t.Fatalf("got received pings %+v, want %+v", got, want)
+		}
+		if got := inPeer.MsgsSent()[wire.CmdPong]; got != want {
+			t.Fatalf("got sent pongs %+v, want %+v", got, want)
+		}
+	}
+	stats := outPeer.StatsSnapshot()
+	if stats.MinPingMicros > stats.LastPingMicros ||
+		stats.MinPingMicros > stats.AvgPingMicros {
+
+		t.Fatalf("minimum ping time %d exceeds last %d or average %d",
+			stats.MinPingMicros, stats.LastPingMicros,
+			stats.AvgPingMicros)
+	}
+
+	// The tallies account for all bytes sent and received.
+	var sent, recv uint64
+	for _, s := range stats.MsgsSent {
+		sent += s.Bytes
+	}
+	for _, s := range stats.MsgsRecv {
+		recv += s.Bytes
+	}
+	if sent != stats.BytesSent || recv != stats.BytesRecv {
+		t.Fatalf("tallied %d bytes sent and %d received, want %d and %d",
+			sent, recv, stats.BytesSent, stats.BytesRecv)
+	}
+}
@@ -28,7 +28,7 @@ import (
 
 const (
 	// MaxProtocolVersion is the max protocol version the peer supports.
-	MaxProtocolVersion = wire.FeeFilterVersion
+	MaxProtocolVersion = wire.AddrV2Version
 
 	// outputBufferSize is the number of elements the output channels use.
 	outputBufferSize = 50
@@ -62,9 +62,14 @@ const (
 	// only checked on each stall tick interval.
 	stallResponseTimeout = 30 * time.Second
 
-	// trickleTimeout is the duration of the ticker which trickles down the
-	// inventory to a peer.
-	trickleTimeout = 8 * time.Second
+	// trickleTimeout is the average duration of the ticker which trickles
+	// down the inventory to a peer.  The duration of each peer is picked at
+	// random between half and one and a half times it.
+	trickleTimeout = 5 * time.Second
+
+	// pingAvgWeight is the weight of the latest ping round-trip time in the
+	// moving average of the ping times of a peer.
+	pingAvgWeight = 0.2
 )
 
 var (
@@ -102,6 +107,9 @@ type MessageListeners struct {
 	// OnAddr is invoked when a peer receives an addr bitcoin message.
 	OnAddr func(p *Peer, msg *wire.MsgAddr)
 
+	// OnAddrV2 is invoked when a peer receives an addrv2 bitcoin message.
+	OnAddrV2 func(p *Peer, msg *wire.MsgAddrV2)
+
 	// OnPing is invoked when a peer receives a ping bitcoin message.
 	OnPing func(p *Peer, msg *wire.MsgPing)
 
@@ -172,6 +180,30 @@ type MessageListeners struct {
 	// message.
 	OnSendHeaders func(p *Peer, msg *wire.MsgSendHeaders)
 
+	// OnSendCmpct is invoked when a peer receives a sendcmpct bitcoin
+	// message.
+	OnSendCmpct func(p *Peer, msg *wire.MsgSendCmpct)
+
+	// OnCmpctBlock is invoked when a peer receives a cmpctblock bitcoin
+	// message.
+	OnCmpctBlock func(p *Peer, msg *wire.MsgCmpctBlock)
+
+	// OnGetBlockTxn is invoked when a peer receives a getblocktxn bitcoin
+	// message.
+	OnGetBlockTxn func(p *Peer, msg *wire.MsgGetBlockTxn)
+
+	// OnBlockTxn is invoked when a peer receives a blocktxn bitcoin
+	// message.
+	OnBlockTxn func(p *Peer, msg *wire.MsgBlockTxn)
+
+	// OnSendAddrV2 is invoked when a peer receives a sendaddrv2 bitcoin
+	// message.
+	OnSendAddrV2 func(p *Peer, msg *wire.MsgSendAddrV2)
+
+	// OnValidatorKey is invoked when a peer receives a validatorkey bitcoin
+	// message.
+	OnValidatorKey func(p *Peer, msg *wire.MsgValidatorKey)
+
 	// OnRead is invoked when a peer receives a bitcoin message.  It
 	// consists of the number of bytes read, the message, and whether or not
 	// an error in the read occurred.  Typically, callers will opt to use
@@ -215,6 +247,12 @@ type Config struct {
 	// form "major.minor.revision" e.g. "2.6.41".
 	UserAgentVersion string
 
+	// UserAgentComments specifies any additional comments to include in
+	// the user agent to advertise.  This is optional, so it may be nil.
+	// The comments must not include characters reserved by BIP0014 and must
+	// not make the user agent exceed wire.MaxUserAgentLen.
+	UserAgentComments []string
+
 	// ChainParams identifies which chain parameters the peer is associated
 	// with.  It is highly recommended to specify this field, however it can
 	// be omitted in which case the test network will be used.
@@ -340,6 +378,25 @@ type StatsSnap struct {
 	LastPingNonce  uint64
 	LastPingTime   time.Time
 	LastPingMicros int64
+	MinPingMicros  int64
+	AvgPingMicros  int64
+	Capabilities   Capabilities
+	MsgsSent       map[string]MsgStats
+	MsgsRecv       map[string]MsgStats
+	Relay          RelayStats
+}
+
+// RelayStats houses the number of inventory announcements relayed to a peer.
+type RelayStats struct {
+	// BlocksAnnounced is the number of blocks announced to the peer.
+	BlocksAnnounced uint64
+
+	// TxsAnnounced is the number of transactions announced to the peer.
+	TxsAnnounced uint64
+
+	// KnownSkipped is the number of announcements which were skipped
+	// because the peer was already known to have the inventory.
+	KnownSkipped uint64
 }
 
 // HashFunc is a function which returns a block hash, height and error
@@ -382,12 +439,17 @@ type HostToNetAddrFunc func(host string, port uint16,
 // provided as a convenience.
 type Peer struct {
 	// The following variables must only be used atomically.
-	bytesReceived uint64
-	bytesSent     uint64
-	lastRecv      int64
-	lastSend      int64
-	connected     int32
-	disconnect    int32
+	bytesReceived   uint64
+	bytesSent       uint64
+	blocksAnnounced uint64
+	txsAnnounced    uint64
+	knownSkipped    uint64
+	msgsReceived    MsgTally
+	msgsSent        MsgTally
+	lastRecv        int64
+	lastSend        int64
+	connected       int32
+	disconnect      int32
 
 	conn net.Conn
 
@@ -397,17 +459,17 @@ type Peer struct {
 	cfg     Config
 	inbound bool
 
-	flagsMtx             sync.Mutex // protects the peer flags below
-	na                   *wire.NetAddress
-	id                   int32
-	userAgent            string
-	services             wire.ServiceFlag
-	versionKnown         bool
-	advertisedProtoVer   uint32 // protocol version advertised by remote
-	protocolVersion      uint32 // negotiated protocol version
-	sendHeadersPreferred bool   // peer sent a sendheaders message
-	versionSent          bool
-	verAckReceived       bool
+	flagsMtx           sync.Mutex // protects the peer flags below
+	na                 *wire.NetAddress
+	id                 int32
+	userAgent          string
+	services           wire.ServiceFlag
+	versionKnown       bool
+	advertisedProtoVer uint32       // protocol version advertised by remote
+	protocolVersion    uint32       // negotiated protocol version
+	capabilities       Capabilities // optional features negotiated by remote
+	versionSent        bool
+	verAckReceived     bool
 
 	knownInventory     *mruInventoryMap
 	prevGetBlocksMtx   sync.Mutex
@@ -428,6 +490,8 @@ type Peer struct {
 	lastPingNonce      uint64    // Set to nonce if we have a pending ping.
 	lastPingTime       time.Time // Time we sent last ping.
 	lastPingMicros     int64     // Time for last ping to return.
+	minPingMicros      int64     // Lowest time for a ping to return.
+	avgPingMicros      int64     // Moving average time for pings to return.
 
 	stallControl  chan stallControlMsg
 	outputQueue   chan outMsg
@@ -479,6 +543,31 @@ func (p *Peer) AddKnownInventory(invVect *wire.InvVect) {
 	p.knownInventory.Add(invVect)
 }
 
+// isKnownInventory returns whether the peer is known to have the passed
+// inventory, in which case the skipped announcement is counted.
+//
+// This function is safe for concurrent access.
+func (p *Peer) isKnownInventory(invVect *wire.InvVect) bool {
+	if !p.knownInventory.Exists(invVect) {
+		return false
+	}
+	atomic.AddUint64(&p.knownSkipped, 1)
+	return true
+}
+
+// countAnnouncement counts the announcement of the passed inventory to the
+// peer in its relay statistics.
+//
+// This function is safe for concurrent access.
+func (p *Peer) countAnnouncement(invVect *wire.InvVect) {
+	switch invVect.Type {
+	case wire.InvTypeBlock:
+		atomic.AddUint64(&p.blocksAnnounced, 1)
+	case wire.InvTypeTx:
+		atomic.AddUint64(&p.txsAnnounced, 1)
+	}
+}
+
 // StatsSnapshot returns a snapshot of the current peer flags and statistics.
 //
 // This function is safe for concurrent access.
@@ -491,6 +580,7 @@ func (p *Peer) StatsSnapshot() *StatsSnap {
 	userAgent := p.userAgent
 	services := p.services
 	protocolVersion := p.advertisedProtoVer
+	capabilities := p.capabilities
 	p.flagsMtx.Unlock()
 
 	// Get a copy of all relevant flags and stats.
@@ -512,6 +602,16 @@ func (p *Peer) StatsSnapshot() *StatsSnap {
 		LastPingNonce:  p.lastPingNonce,
 		LastPingMicros: p.lastPingMicros,
 		LastPingTime:   p.lastPingTime,
+		MinPingMicros:  p.minPingMicros,
+		AvgPingMicros:  p.avgPingMicros,
+		Capabilities:   capabilities,
+		MsgsSent:       p.msgsSent.Snapshot(),
+		MsgsRecv:       p.msgsReceived.Snapshot(),
+		Relay: RelayStats{
+			BlocksAnnounced: atomic.LoadUint64(&p.blocksAnnounced),
+			TxsAnnounced:    atomic.LoadUint64(&p.txsAnnounced),
+			KnownSkipped:    atomic.LoadUint64(&p.knownSkipped),
+		},
 	}
 
 	p.statsMtx.RUnlock()
@@ -622,6 +722,29 @@ func (p *Peer) LastPingMicros() int64 {
 	return lastPingMicros
 }
 
+// MinPingMicros returns the lowest ping round-trip time of the remote peer.
+//
+// This function is safe for concurrent access.
+func (p *Peer) MinPingMicros() int64 {
+	p.statsMtx.RLock()
+	minPingMicros := p.minPingMicros
+	p.statsMtx.RUnlock()
+
+	return minPingMicros
+}
+
+// AvgPingMicros returns the moving average of the ping round-trip times of the
+// remote peer.
+//
+// This function is safe for concurrent access.
+func (p *Peer) AvgPingMicros() int64 {
+	p.statsMtx.RLock()
+	avgPingMicros := p.avgPingMicros
+	p.statsMtx.RUnlock()
+
+	return avgPingMicros
+}
+
 // VersionKnown returns the whether or not the version of a peer is known
 // locally.
 //
@@ -707,6 +830,22 @@ func (p *Peer) BytesReceived() uint64 {
 	return atomic.LoadUint64(&p.bytesReceived)
 }
 
+// MsgsSent returns the number of messages and bytes sent to the peer per
+// message command.
+//
+// This function is safe for concurrent access.
+func (p *Peer) MsgsSent() map[string]MsgStats {
+	return p.msgsSent.Snapshot()
+}
+
+// MsgsReceived returns the number of messages and bytes received from the peer
+// per message command.
+//
+// This function is safe for concurrent access.
+func (p *Peer) MsgsReceived() map[string]MsgStats {
+	return p.msgsReceived.Snapshot()
+}
+
 // TimeConnected returns the time at which the peer connected.
 //
 // This function is safe for concurrent access.
@@ -743,16 +882,40 @@ func (p *Peer) StartingHeight() uint32 {
 	return startingHeight
 }
 
+// Capabilities returns the optional protocol features the remote peer
+// negotiated so far.
+//
+// This function is safe for concurrent access.
+func (p *Peer) Capabilities() Capabilities {
+	p.flagsMtx.Lock()
+	capabilities := p.capabilities
+	p.flagsMtx.Unlock()
+
+	return capabilities
+}
+
+// HasCapability returns whether the remote peer negotiated all of the passed
+// capabilities.
+//
+// This function is safe for concurrent access.
+func (p *Peer) HasCapability(c Capabilities) bool {
+	return p.Capabilities()&c == c
+}
+
 // WantsHeaders returns if the peer wants header messages instead of
 // inventory vectors for blocks.
 //
 // This function is safe for concurrent access.
 func (p *Peer) WantsHeaders() bool {
-	p.flagsMtx.Lock()
-	sendHeadersPreferred := p.sendHeadersPreferred
-	p.flagsMtx.Unlock()
+	return p.HasCapability(CapSendHeaders)
+}
 
-	return sendHeadersPreferred
+// WantsAddrV2 returns if the peer wants addresses to be relayed with addrv2
+// messages instead of addr messages.
+//
+// This function is safe for concurrent access.
+func (p *Peer) WantsAddrV2() bool {
+	return p.HasCapability(CapAddrV2)
 }
 
 // localVersionMsg creates a version message that can be used to send to the
@@ -804,7 +967,11 @@ func (p *Peer) localVersionMsg() (*wire.MsgVersion, error) {
 
 	// Version message.
 	msg := wire.NewMsgVersion(ourNA, theirNA, nonce, blockNum)
-	msg.AddUserAgent(p.cfg.UserAgentName, p.cfg.UserAgentVersion)
+	err = msg.AddUserAgent(p.cfg.UserAgentName, p.cfg.UserAgentVersion,
+		p.cfg.UserAgentComments...)
+	if err != nil {
+		return nil, err
+	}
 
 	// XXX: bitcoind appears to always enable the full node services flag
 	// of the remote peer netaddress field in the version message regardless
@@ -837,38 +1004,52 @@ func (p *Peer) localVersionMsg() (*wire.MsgVersion, error) {
 }
 
 // PushAddrMsg sends an addr message to the connected peer using the provided
-// addresses.  This function is useful over manually sending the message via
-// QueueMessage since it automatically limits the addresses to the maximum
-// number allowed by the message and randomizes the chosen addresses when there
-// are too many.  It returns the addresses that were actually sent and no
-// message will be sent if there are no entries in the provided addresses slice.
+// addresses, or an addrv2 message when the peer sent a sendaddrv2 message.
+// Addresses which can only be represented in the addrv2 format are not sent to
+// peers which did not.  This function is useful over manually sending the
+// message via QueueMessage since it automatically limits the addresses to the
+// maximum number allowed by the message and randomizes the chosen addresses
+// when there are too many.  It returns the addresses that were actually sent
+// and no message will be sent if there are no entries in the provided
+// addresses slice.
 //
 // This function is safe for concurrent access.
 func (p *Peer) PushAddrMsg(addresses []*wire.NetAddress) ([]*wire.NetAddress, error) {
+	wantsAddrV2 := p.WantsAddrV2()
+	addrList := make([]*wire.NetAddress, 0, len(addresses))
+	for _, na := range addresses {
+		if wantsAddrV2 || na.IsLegacy() {
+			addrList = append(addrList, na)
+		}
+	}
 
 	// Nothing to send.
-	if len(addresses) == 0 {
+	if len(addrList) == 0 {
 		return nil, nil
 	}
 
-	msg := wire.NewMsgAddr()
-	msg.AddrList = make([]*wire.NetAddress, len(addresses))
-	copy(msg.AddrList, addresses)
-
 	// Randomize the addresses sent if there are more than the maximum allowed.
-	if len(msg.AddrList) > wire.MaxAddrPerMsg {
+	if len(addrList) > wire.MaxAddrPerMsg {
 		// Shuffle the address list.
-		for i := range msg.AddrList {
+		for i := range addrList {
 			j := rand.Intn(i + 1)
-			msg.AddrList[i], msg.AddrList[j] = msg.AddrList[j], msg.AddrList[i]
+			addrList[i], addrList[j] = addrList[j], addrList[i]
 		}
 
 		// Truncate it to the maximum size.
-		msg.AddrList = msg.AddrList[:wire.MaxAddrPerMsg]
+		addrList = addrList[:wire.MaxAddrPerMsg]
 	}
 
-	p.QueueMessage(msg, nil)
-	return msg.AddrList, nil
+	if wantsAddrV2 {
+		msg := wire.NewMsgAddrV2()
+		msg.AddrList = addrList
+		p.QueueMessage(msg, nil)
+	} else {
+		msg := wire.NewMsgAddr()
+		msg.AddrList = addrList
+		p.QueueMessage(msg, nil)
+	}
+	return addrList, nil
 }
 
 // PushGetBlocksMsg sends a getblocks message for the provided block locator
@@ -1031,8 +1212,8 @@ func (p *Peer) handleRemoteVersionMsg(msg *wire.MsgVersion) error {
 	p.advertisedProtoVer = uint32(msg.ProtocolVersion)
 	p.protocolVersion = minUint32(p.protocolVersion, p.advertisedProtoVer)
 	p.versionKnown = true
-	log.Debugf("Negotiated protocol version %d for peer %s",
-		p.protocolVersion, p)
+	log.Debugf("Negotiated protocol version %d for peer %s on %v",
+		p.protocolVersion, p, p.cfg.ChainParams.Net)
 	// Set the peer's ID.
 	p.id = atomic.AddInt32(&nodeCount, 1)
 	// Set the supported services for the peer to what the remote peer
@@ -1074,6 +1255,16 @@ func (p *Peer) handlePongMsg(msg *wire.MsgPong) {
 			p.lastPingMicros = time.Since(p.lastPingTime).Nanoseconds()
 			p.lastPingMicros /= 1000 // convert to usec.
 			p.lastPingNonce = 0
+			if p.minPingMicros == 0 || p.lastPingMicros < p.minPingMicros {
+				p.minPingMicros = p.lastPingMicros
+			}
+			if p.avgPingMicros == 0 {
+				p.avgPingMicros = p.lastPingMicros
+			} else {
+				p.avgPingMicros = int64(pingAvgWeight*
+					float64(p.lastPingMicros) +
+					(1-pingAvgWeight)*float64(p.avgPingMicros))
+			}
 		}
 		p.statsMtx.Unlock()
 	}
@@ -1084,6 +1275,11 @@ func (p *Peer) readMessage() (wire.Message, []byte, error) {
 	n, msg, buf, err := wire.ReadMessageN(p.conn, p.ProtocolVersion(),
 		p.cfg.ChainParams.Net)
 	atomic.AddUint64(&p.bytesReceived, uint64(n))
+	if msg != nil {
+		p.msgsReceived.Add(msg.Command(), n)
+	} else if n > 0 {
+		p.msgsReceived.Add(OtherMsgCommand, n)
+	}
 	if p.cfg.Listeners.OnRead != nil {
 		p.cfg.Listeners.OnRead(p, n, msg, err)
 	}
@@ -1147,6 +1343,7 @@ func (p *Peer) writeMessage(msg wire.Message) error {
 	n, err := wire.WriteMessageN(p.conn, msg, p.ProtocolVersion(),
 		p.cfg.ChainParams.Net)
 	atomic.AddUint64(&p.bytesSent, uint64(n))
+	p.msgsSent.Add(msg.Command(), n)
 	if p.cfg.Listeners.OnWrite != nil {
 		p.cfg.Listeners.OnWrite(p, n, msg, err)
 	}
@@ -1228,10 +1425,13 @@ func (p *Peer) maybeAddDeadline(pendingResponses map[string]time.Time, msgCmd st
 		pendingResponses[wire.CmdInv] = deadline
 
 	case wire.CmdGetData:
-		// Expects a block, merkleblock, tx, or notfound message.
+		// Expects a block, merkleblock, cmpctblock, tx, validatorkey,
+		// or notfound message.
 		pendingResponses[wire.CmdBlock] = deadline
 		pendingResponses[wire.CmdMerkleBlock] = deadline
+		pendingResponses[wire.CmdCmpctBlock] = deadline
 		pendingResponses[wire.CmdTx] = deadline
+		pendingResponses[wire.CmdValidatorKey] = deadline
 		pendingResponses[wire.CmdNotFound] = deadline
 
 	case wire.CmdGetHeaders:
@@ -1240,6 +1440,10 @@ func (p *Peer) maybeAddDeadline(pendingResponses map[string]time.Time, msgCmd st
 		// headers.
 		deadline = time.Now().Add(stallResponseTimeout * 3)
 		pendingResponses[wire.CmdHeaders] = deadline
+
+	case wire.CmdGetBlockTxn:
+		// Expects a blocktxn message.
+		pendingResponses[wire.CmdBlockTxn] = deadline
 	}
 }
 
@@ -1289,12 +1493,18 @@ out:
 					fallthrough
 				case wire.CmdMerkleBlock:
 					fallthrough
+				case wire.CmdCmpctBlock:
+					fallthrough
 				case wire.CmdTx:
 					fallthrough
+				case wire.CmdValidatorKey:
+					fallthrough
 				case wire.CmdNotFound:
 					delete(pendingResponses, wire.CmdBlock)
 					delete(pendingResponses, wire.CmdMerkleBlock)
+					delete(pendingResponses, wire.CmdCmpctBlock)
 					delete(pendingResponses, wire.CmdTx)
+					delete(pendingResponses, wire.CmdValidatorKey)
 					delete(pendingResponses, wire.CmdNotFound)
 
 				default:
@@ -1443,6 +1653,14 @@ out:
 		atomic.StoreInt64(&p.lastRecv, time.Now().Unix())
 		p.stallControl <- stallControlMsg{sccReceiveMessage, rmsg}
 
+		// Record any capability the message negotiates before it is
+		// handled.
+		if capability, ok := p.negotiatedCapability(rmsg); ok {
+			p.flagsMtx.Lock()
+			p.capabilities |= capability
+			p.flagsMtx.Unlock()
+		}
+
 		// Handle each supported message type.
 		p.stallControl <- stallControlMsg{sccHandlerStart, rmsg}
 		switch msg := rmsg.(type) {
@@ -1478,6 +1696,11 @@ out:
 				p.cfg.Listeners.OnAddr(p, msg)
 			}
 
+		case *wire.MsgAddrV2:
+			if p.cfg.Listeners.OnAddrV2 != nil {
+				p.cfg.Listeners.OnAddrV2(p, msg)
+			}
+
 		case *wire.MsgPing:
 			p.handlePingMsg(msg)
 			if p.cfg.Listeners.OnPing != nil {
@@ -1571,14 +1794,47 @@ out:
 			}
 
 		case *wire.MsgSendHeaders:
-			p.flagsMtx.Lock()
-			p.sendHeadersPreferred = true
-			p.flagsMtx.Unlock()
-
 			if p.cfg.Listeners.OnSendHeaders != nil {
 				p.cfg.Listeners.OnSendHeaders(p, msg)
 			}
 
+		case *wire.MsgSendCmpct:
+			if p.cfg.Listeners.OnSendCmpct != nil {
+				p.cfg.Listeners.OnSendCmpct(p, msg)
+			}
+
+		case *wire.MsgCmpctBlock:
+			if p.cfg.Listeners.OnCmpctBlock != nil {
+				p.cfg.Listeners.OnCmpctBlock(p, msg)
+			}
+
+		case *wire.MsgGetBlockTxn:
+			if p.cfg.Listeners.OnGetBlockTxn != nil {
+				p.cfg.Listeners.OnGetBlockTxn(p, msg)
+			}
+
+		case *wire.MsgBlockTxn:
+			if p.cfg.Listeners.OnBlockTxn != nil {
+				p.cfg.Listeners.OnBlockTxn(p, msg)
+			}
+
+		case *wire.MsgSendAddrV2:
+			// The sendaddrv2 message is only valid before the verack
+			// message.
+			if p.VerAckReceived() {
+				log.Infof("Received 'sendaddrv2' after 'verack' from "+
+					"peer %v -- disconnecting", p)
+				break out
+			}
+			if p.cfg.Listeners.OnSendAddrV2 != nil {
+				p.cfg.Listeners.OnSendAddrV2(p, msg)
+			}
+
+		case *wire.MsgValidatorKey:
+			if p.cfg.Listeners.OnValidatorKey != nil {
+				p.cfg.Listeners.OnValidatorKey(p, msg)
+			}
+
 		default:
 			log.Debugf("Received unhandled message of type %v "+
 				"from %v", rmsg.Command(), p)
@@ -1606,7 +1862,9 @@ out:
 func (p *Peer) queueHandler() {
 	pendingMsgs := list.New()
 	invSendQueue := list.New()
-	trickleTicker := time.NewTicker(trickleTimeout)
+	trickleInterval := trickleTimeout/2 +
+		time.Duration(rand.Int63n(int64(trickleTimeout)))
+	trickleTicker := time.NewTicker(trickleInterval)
 	defer trickleTicker.Stop()
 
 	// We keep the waiting flag so that we know if we have a message queued
@@ -1673,11 +1931,12 @@ out:
 
 				// Don't send inventory that became known after
 				// the initial check.
-				if p.knownInventory.Exists(iv) {
+				if p.isKnownInventory(iv) {
 					continue
 				}
 
 				invMsg.AddInvVect(iv)
+				p.countAnnouncement(iv)
 				if len(invMsg.InvList) >= maxInvTrickleSize {
 					waiting = queuePacket(
 						outMsg{msg: invMsg},
@@ -1865,7 +2124,7 @@ func (p *Peer) QueueMessage(msg wire.Message, doneChan chan<- struct{}) {
 func (p *Peer) QueueInventory(invVect *wire.InvVect) {
 	// Don't add the inventory to the send queue if the peer is already
 	// known to have it.
-	if p.knownInventory.Exists(invVect) {
+	if p.isKnownInventory(invVect) {
 		return
 	}
 
@@ -1879,6 +2138,50 @@ func (p *Peer) QueueInventory(invVect *wire.InvVect) {
 	p.outputInvChan <- invVect
 }
 
+// QueueInventoryImmediate sends the passed inventory to the peer right away
+// with an inventory message of its own rather than trickling it with the next
+// batch.  Inventory that the peer is already known to have is ignored.
+//
+// This function is safe for concurrent access.
+func (p *Peer) QueueInventoryImmediate(invVect *wire.InvVect) {
+	// Don't send the inventory if the peer is already known to have it.
+	if p.isKnownInventory(invVect) {
+		return
+	}
+	p.knownInventory.Add(invVect)
+	p.countAnnouncement(invVect)
+
+	invMsg := wire.NewMsgInvSizeHint(1)
+	invMsg.AddInvVect(invVect)
+	p.QueueMessage(invMsg, nil)
+}
+
+// QueueBlockAnnouncement announces the block identified by the passed inventory
+// to the peer right away.  The block is announced with a headers message with
+// the passed headers, which must end with the header of the block, when there
+// are any, or with an inventory message otherwise.  It returns whether the
+// block was announced, which is not the case when the peer is already known to
+// have it.
+//
+// This function is safe for concurrent access.
+func (p *Peer) QueueBlockAnnouncement(invVect *wire.InvVect, headers []*wire.BlockHeader) bool {
+	// Don't announce the block if the peer is already known to have it.
+	if p.isKnownInventory(invVect) {
+		return false
+	}
+	p.knownInventory.Add(invVect)
+	p.countAnnouncement(invVect)
+
+	if len(headers) > 0 {
+		p.QueueMessage(&wire.MsgHeaders{Headers: headers}, nil)
+		return true
+	}
+	invMsg := wire.NewMsgInvSizeHint(1)
+	invMsg.AddInvVect(invVect)
+	p.QueueMessage(invMsg, nil)
+	return true
+}
+
 // AssociateConnection associates the given conn to the peer.   Calling this
 // function when the peer is already connected will have no effect.
 func (p *Peer) AssociateConnection(conn net.Conn) {
@@ -1958,7 +2261,7 @@ func (p *Peer) start() error {
 	case <-time.After(negotiateTimeout):
 		return errors.New("protocol negotiation timeout")
 	}
-	log.Debugf("Connected to %s", p.Addr())
+	log.Debugf("Connected to %s on %v", p.Addr(), p.cfg.ChainParams.Net)
 
 	// The protocol has been negotiated successfully so start processing input
 	// and output messages.
@@ -1968,6 +2271,12 @@ func (p *Peer) start() error {
 	go p.outHandler()
 	go p.pingHandler()
 
+	// Signal support for addrv2 messages, which must happen before the
+	// verack message.
+	if p.ProtocolVersion() >= wire.AddrV2Version {
+		p.QueueMessage(wire.NewMsgSendAddrV2(), nil)
+	}
+
 	// Send our verack message now that the IO processing machinery has started.
 	p.QueueMessage(wire.NewMsgVerAck(), nil)
 	return nil
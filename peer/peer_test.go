@@ -10,6 +10,7 @@ import (
 	"io"
 	"net"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -235,8 +236,8 @@ func TestPeerConnection(t *testing.T) {
 		wantLastPingNonce:   uint64(0),
 		wantLastPingMicros:  int64(0),
 		wantTimeOffset:      int64(0),
-		wantBytesSent:       158, // 134 version + 24 verack
-		wantBytesReceived:   158,
+		wantBytesSent:       182, // 134 version + 24 sendaddrv2 + 24 verack
+		wantBytesReceived:   182,
 	}
 	tests := []struct {
 		name  string
@@ -312,9 +313,88 @@ func TestPeerConnection(t *testing.T) {
 	}
 }
 
+// TestPeerUserAgentComments ensures the user agent comments are included in
+// the advertised user agent, and that the version handshake fails when the
+// comments make the user agent too long.
+func TestPeerUserAgentComments(t *testing.T) {
+	verack := make(chan struct{}, 2)
+	peerCfg := &peer.Config{
+		Listeners: peer.MessageListeners{
+			OnVerAck: func(p *peer.Peer, msg *wire.MsgVerAck) {
+				verack <- struct{}{}
+			},
+		},
+		UserAgentName:     "peer",
+		UserAgentVersion:  "1.0",
+		UserAgentComments: []string{"comment one", "test-2"},
+		ChainParams:       &chaincfg.MainNetParams,
+	}
+	inConn, outConn := pipe(
+		&conn{raddr: "10.0.0.1:8333"},
+		&conn{raddr: "10.0.0.2:8333"},
+	)
+	inPeer := peer.NewInboundPeer(peerCfg)
+	inPeer.AssociateConnection(inConn)
+	outPeer, err := peer.NewOutboundPeer(peerCfg, "10.0.0.2:8333")
+	if err != nil {
+		t.Fatalf("NewOutboundPeer: unexpected err %v", err)
+	}
+	outPeer.AssociateConnection(outConn)
+	for i := 0; i < 2; i++ {
+		select {
+		case <-verack:
+		case <-time.After(time.Second):
+			t.Fatal("verack timeout")
+		}
+	}
+
+	want := wire.DefaultUserAgent + "peer:1.0(comment one; test-2)/"
+	if ua := inPeer.UserAgent(); ua != want {
+		t.Errorf("inbound peer: wrong UserAgent - got %v, want %v", ua,
+			want)
+	}
+	if ua := outPeer.UserAgent(); ua != want {
+		t.Errorf("outbound peer: wrong UserAgent - got %v, want %v", ua,
+			want)
+	}
+	inPeer.Disconnect()
+	outPeer.Disconnect()
+	inPeer.WaitForDisconnect()
+	outPeer.WaitForDisconnect()
+
+	// Ensure an outbound peer with a user agent which exceeds the maximum
+	// length disconnects instead of sending its version.
+	longCfg := *peerCfg
+	longCfg.UserAgentComments = []string{strings.Repeat("a",
+		wire.MaxUserAgentLen)}
+	inConn, outConn = pipe(
+		&conn{raddr: "10.0.0.1:8333"},
+		&conn{raddr: "10.0.0.2:8333"},
+	)
+	outPeer, err = peer.NewOutboundPeer(&longCfg, "10.0.0.2:8333")
+	if err != nil {
+		t.Fatalf("NewOutboundPeer: unexpected err %v", err)
+	}
+	outPeer.AssociateConnection(outConn)
+	disconnected := make(chan struct{})
+	go func() {
+		outPeer.WaitForDisconnect()
+		close(disconnected)
+	}()
+	select {
+	case <-disconnected:
+	case <-time.After(time.Second):
+		t.Fatal("peer with an overlong user agent was not disconnected")
+	}
+	if outPeer.VersionKnown() {
+		t.Fatal("peer with an overlong user agent negotiated a version")
+	}
+}
+
 // TestPeerListeners tests that the peer listeners are called as expected.
 func TestPeerListeners(t *testing.T) {
 	verack := make(chan struct{}, 1)
+	sendAddrV2 := make(chan struct{}, 1)
 	ok := make(chan wire.Message, 20)
 	peerCfg := &peer.Config{
 		Listeners: peer.MessageListeners{
@@ -324,6 +404,9 @@ func TestPeerListeners(t *testing.T) {
 			OnAddr: func(p *peer.Peer, msg *wire.MsgAddr) {
 				ok <- msg
 			},
+			OnAddrV2: func(p *peer.Peer, msg *wire.MsgAddrV2) {
+				ok <- msg
+			},
 			OnPing: func(p *peer.Peer, msg *wire.MsgPing) {
 				ok <- msg
 			},
@@ -387,6 +470,24 @@ func TestPeerListeners(t *testing.T) {
 			OnSendHeaders: func(p *peer.Peer, msg *wire.MsgSendHeaders) {
 				ok <- msg
 			},
+			OnSendCmpct: func(p *peer.Peer, msg *wire.MsgSendCmpct) {
+				ok <- msg
+			},
+			OnCmpctBlock: func(p *peer.Peer, msg *wire.MsgCmpctBlock) {
+				ok <- msg
+			},
+			OnGetBlockTxn: func(p *peer.Peer, msg *wire.MsgGetBlockTxn) {
+				ok <- msg
+			},
+			OnBlockTxn: func(p *peer.Peer, msg *wire.MsgBlockTxn) {
+				ok <- msg
+			},
+			OnSendAddrV2: func(p *peer.Peer, msg *wire.MsgSendAddrV2) {
+				sendAddrV2 <- struct{}{}
+			},
+			OnValidatorKey: func(p *peer.Peer, msg *wire.MsgValidatorKey) {
+				ok <- msg
+			},
 		},
 		UserAgentName:    "peer",
 		UserAgentVersion: "1.0",
@@ -421,6 +522,19 @@ func TestPeerListeners(t *testing.T) {
 		}
 	}
 
+	// The sendaddrv2 message is sent during the handshake.
+	select {
+	case <-sendAddrV2:
+	default:
+		t.Errorf("TestPeerListeners: OnSendAddrV2 not called before " +
+			"verack")
+		return
+	}
+	if !inPeer.WantsAddrV2() {
+		t.Errorf("TestPeerListeners: peer does not want addrv2 messages")
+		return
+	}
+
 	tests := []struct {
 		listener string
 		msg      wire.Message
@@ -433,6 +547,10 @@ func TestPeerListeners(t *testing.T) {
 			"OnAddr",
 			wire.NewMsgAddr(),
 		},
+		{
+			"OnAddrV2",
+			wire.NewMsgAddrV2(),
+		},
 		{
 			"OnPing",
 			wire.NewMsgPing(42),
@@ -511,6 +629,27 @@ func TestPeerListeners(t *testing.T) {
 			"OnSendHeaders",
 			wire.NewMsgSendHeaders(),
 		},
+		{
+			"OnSendCmpct",
+			wire.NewMsgSendCmpct(false, wire.CmpctBlockVersion),
+		},
+		{
+			"OnCmpctBlock",
+			wire.NewMsgCmpctBlock(wire.NewBlockHeader(&chainhash.Hash{}, &chainhash.Hash{}, 1, 1), 1),
+		},
+		{
+			"OnGetBlockTxn",
+			wire.NewMsgGetBlockTxn(&chainhash.Hash{}),
+		},
+		{
+			"OnBlockTxn",
+			wire.NewMsgBlockTxn(&chainhash.Hash{}),
+		},
+		{
+			"OnValidatorKey",
+			wire.NewMsgValidatorKey(1, [33]byte{0x02},
+				wire.ValidatorKeyProvision, &chainhash.Hash{}),
+		},
 	}
 	t.Logf("Running %d tests", len(tests))
 	for _, test := range tests {
@@ -523,6 +662,19 @@ func TestPeerListeners(t *testing.T) {
 			return
 		}
 	}
+
+	// A sendaddrv2 message after the verack message disconnects the peer.
+	outPeer.QueueMessage(wire.NewMsgSendAddrV2(), nil)
+	disconnected := make(chan struct{})
+	go func() {
+		inPeer.WaitForDisconnect()
+		close(disconnected)
+	}()
+	select {
+	case <-disconnected:
+	case <-time.After(time.Second * 1):
+		t.Errorf("TestPeerListeners: late sendaddrv2 did not disconnect")
+	}
 	inPeer.Disconnect()
 	outPeer.Disconnect()
 }
@@ -669,6 +821,104 @@ func TestOutboundPeer(t *testing.T) {
 	p2.Disconnect()
 }
 
+// TestBlockAnnouncement ensures blocks are announced right away with headers
+// or inventory messages, blocks the remote peer is known to have are not
+// announced, and the announcements are counted in the relay statistics.
+func TestBlockAnnouncement(t *testing.T) {
+	verack := make(chan struct{}, 2)
+	announced := make(chan wire.Message, 10)
+	peerCfg := &peer.Config{
+		Listeners: peer.MessageListeners{
+			OnVerAck: func(p *peer.Peer, msg *wire.MsgVerAck) {
+				verack <- struct{}{}
+			},
+			OnInv: func(p *peer.Peer, msg *wire.MsgInv) {
+				announced <- msg
+			},
+			OnHeaders: func(p *peer.Peer, msg *wire.MsgHeaders) {
+				announced <- msg
+			},
+		},
+		UserAgentName:    "peer",
+		UserAgentVersion: "1.0",
+		ChainParams:      &chaincfg.MainNetParams,
+	}
+	inConn, outConn := pipe(
+		&conn{raddr: "10.0.0.1:8333"},
+		&conn{raddr: "10.0.0.2:8333"},
+	)
+	inPeer := peer.NewInboundPeer(peerCfg)
+	inPeer.AssociateConnection(inConn)
+	outPeer, err := peer.NewOutboundPeer(peerCfg, "10.0.0.2:8333")
+	if err != nil {
+		t.Fatalf("NewOutboundPeer: unexpected err %v", err)
+	}
+	outPeer.AssociateConnection(outConn)
+	defer func() {
+		inPeer.Disconnect()
+		outPeer.Disconnect()
+		inPeer.WaitForDisconnect()
+		outPeer.WaitForDisconnect()
+	}()
+	for i := 0; i < 2; i++ {
+		select {
+		case <-verack:
+		case <-time.After(time.Second):
+			t.Fatal("verack timeout")
+		}
+	}
+
+	headers := make([]*wire.BlockHeader, 3)
+	invVects := make([]*wire.InvVect, len(headers))
+	for i := range headers {
+		headers[i] = &wire.BlockHeader{Nonce: uint64(i)}
+		hash := headers[i].BlockHash()
+		invVects[i] = wire.NewInvVect(wire.InvTypeBlock, &hash)
+	}
+	outPeer.AddKnownInventory(invVects[1])
+
+	tests := []struct {
+		name    string
+		invVect *wire.InvVect
+		headers []*wire.BlockHeader
+		want    wire.Message
+	}{
+		{"inventory", invVects[0], nil, &wire.MsgInv{}},
+		{"known inventory", invVects[0], nil, nil},
+		{"known headers", invVects[1], headers[1:2], nil},
+		{"headers", invVects[2], headers[1:], &wire.MsgHeaders{}},
+	}
+	for _, test := range tests {
+		got := outPeer.QueueBlockAnnouncement(test.invVect, test.headers)
+		if got != (test.want != nil) {
+			t.Fatalf("%s: got announced %v, want %v", test.name, got,
+				test.want != nil)
+		}
+		if test.want == nil {
+			continue
+		}
+		select {
+		case msg := <-announced:
+			if msg.Command() != test.want.Command() {
+				t.Fatalf("%s: got %s message, want %s", test.name,
+					msg.Command(), test.want.Command())
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s: announcement timeout", test.name)
+		}
+	}
+
+	want := peer.RelayStats{BlocksAnnounced: 2, KnownSkipped: 2}
+	if got := outPeer.StatsSnapshot().Relay; got != want {
+		t.Fatalf("got relay stats %+v, want %+v", got, want)
+	}
+	select {
+	case msg := <-announced:
+		t.Fatalf("unexpected %s message", msg.Command())
+	default:
+	}
+}
+
 func init() {
 	// Allow self connection when running the tests.
 	peer.TstAllowSelfConns()
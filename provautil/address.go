@@ -12,6 +12,7 @@ import (
 
 	"github.com/bitgo/prova/btcec"
 	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
 	"github.com/bitgo/prova/provautil/base58"
 	"github.com/btcsuite/golangcrypto/ripemd160"
 )
@@ -37,9 +38,9 @@ var (
 )
 
 func encodeProvaAddress(keyIDs []btcec.KeyID, hash160 []byte, netID byte) string {
-	data := make([]byte, len(keyIDs)*btcec.KeyIDSize+ripemd160.Size)
+	data := make([]byte, len(keyIDs)*btcec.KeyIDSize+chainhash.Hash160Size)
 	copy(data[0:], hash160)
-	offset := ripemd160.Size
+	offset := chainhash.Hash160Size
 	for _, keyID := range keyIDs {
 		binary.LittleEndian.PutUint32(data[offset:], uint32(keyID))
 		offset += btcec.KeyIDSize
@@ -87,12 +88,23 @@ type Address interface {
 // DecodeAddress decodes the string encoding of an address and returns
 // the Address if addr is a valid encoding for a known address type.
 //
+// The address type is determined by the leading identifier byte, which may
+// belong to any default or registered (via chaincfg.Register) network, so
+// addresses for networks other than defaultNet are decoded as well and the
+// caller should use IsForNet to check the network.  Several networks may use
+// the same identifier, in which case IsForNet reports true for each of them.
+// ErrUnknownAddressType is returned when the identifier is not known to any
+// network.
+//
 // The bitcoin network the address is associated with is extracted if possible.
 // When the address does not encode the network, such as in the case of a raw
 // public key, the address will be associated with the passed defaultNet.
 func DecodeAddress(addr string, defaultNet *chaincfg.Params) (Address, error) {
-	// Switch on decoded length to determine the type.
-	decoded, netID, err := base58.CheckDecode(addr)
+	// Addresses have a single identifier byte followed by the payload, so
+	// the payload is every decoded byte other than the identifier and the
+	// checksum.
+	raw := base58.Decode(addr)
+	version, decoded, err := base58.DecodeVersionedBytes(raw, len(raw)-1-4)
 	if err != nil {
 		if err == base58.ErrChecksum {
 			return nil, ErrChecksumMismatch
@@ -100,38 +112,67 @@ func DecodeAddress(addr string, defaultNet *chaincfg.Params) (Address, error) {
 		return nil, errors.New("decoded address is of unknown format")
 	}
 
-	if chaincfg.IsProvaAddrID(netID) {
+	// Switch on decoded length to determine the type.
+	if netID := version[0]; chaincfg.IsProvaAddrID(netID) {
 		decodedLen := len(decoded)
 		mininumKeyIdsCount := 2
 		maximumKeyIdsCount := 19
-		if decodedLen < ripemd160.Size+(mininumKeyIdsCount*btcec.KeyIDSize) {
+		if decodedLen < chainhash.Hash160Size+(mininumKeyIdsCount*btcec.KeyIDSize) {
 			return nil, errors.New("decoded address is of unknown size")
 		}
-		if decodedLen > ripemd160.Size+(maximumKeyIdsCount*btcec.KeyIDSize) {
+		if decodedLen > chainhash.Hash160Size+(maximumKeyIdsCount*btcec.KeyIDSize) {
 			return nil, errors.New("decoded address exceeds maximum size")
 		}
-		if (decodedLen-ripemd160.Size)%btcec.KeyIDSize != 0 {
+		if (decodedLen-chainhash.Hash160Size)%btcec.KeyIDSize != 0 {
 			return nil, errors.New("decoded address has invalid size")
 		}
 		return newAddressProvaFromBytes(decoded, netID)
 	}
 
-	return nil, errors.New("decoded address is of unknown size")
+	return nil, ErrUnknownAddressType
 }
 
 // AddressProva is a standard n-1 of n Prova address with n-1 keyids
 type AddressProva struct {
 	keyIDs []btcec.KeyID
-	hash   [ripemd160.Size]byte
+	hash   chainhash.Hash160
 	netID  byte
 }
 
 // NewAddressProva returns a new AddressProva.  pkHash mustbe 20
-// bytes.
+// bytes.  Callers which have a chainhash.Hash160 should use
+// NewAddressProvaFromHash160 instead.
 func NewAddressProva(pkHash []byte, keyIDs []btcec.KeyID, net *chaincfg.Params) (*AddressProva, error) {
 	return newAddressProva(pkHash, keyIDs, net.ProvaAddrID)
 }
 
+// NewAddressProvaFromHash160 returns a new AddressProva paying to the passed
+// pubkey hash along with the passed key ids.
+func NewAddressProvaFromHash160(pkHash *chainhash.Hash160, keyIDs []btcec.KeyID, net *chaincfg.Params) (*AddressProva, error) {
+	return newAddressProva(pkHash[:], keyIDs, net.ProvaAddrID)
+}
+
+// NewAddressProvaFromPubKey returns a new standard AddressProva paying to the
+// hash of the compressed serialization of the passed public key along with
+// the passed key ids.  A standard address has exactly two key ids which must
+// be valid.
+func NewAddressProvaFromPubKey(pubKey *btcec.PublicKey, keyIDs []btcec.KeyID, net *chaincfg.Params) (*AddressProva, error) {
+	if pubKey == nil {
+		return nil, errors.New("pubKey must not be nil")
+	}
+	if len(keyIDs) != 2 {
+		return nil, errors.New("keyIDs must have length 2")
+	}
+	for _, keyID := range keyIDs {
+		if !keyID.IsValid() {
+			return nil, errors.New("keyIDs must not contain " +
+				"reserved key ids")
+		}
+	}
+	pkHash := chainhash.Hash160Sum(pubKey.SerializeCompressed())
+	return newAddressProva(pkHash[:], keyIDs, net.ProvaAddrID)
+}
+
 // newAddressProva is the internal API to create an Prova address
 // with a known leading identifier byte for a network, rather than looking
 // it up through its parameters.  This is useful when creating a new address
@@ -139,7 +180,7 @@ func NewAddressProva(pkHash []byte, keyIDs []btcec.KeyID, net *chaincfg.Params)
 // known.
 func newAddressProva(pkHash []byte, keyIDs []btcec.KeyID, netID byte) (*AddressProva, error) {
 	// Check for a valid pubkey hash length.
-	if len(pkHash) != ripemd160.Size {
+	if len(pkHash) != chainhash.Hash160Size {
 		return nil, errors.New("pkHash must be 20 bytes")
 	}
 	// Check for the allowable range of keyid counts.
@@ -165,7 +206,7 @@ func newAddressProva(pkHash []byte, keyIDs []btcec.KeyID, netID byte) (*AddressP
 func newAddressProvaFromBytes(data []byte, netID byte) (*AddressProva, error) {
 	keyIDs := []btcec.KeyID{}
 	keyIDSize := btcec.KeyIDSize
-	offset := ripemd160.Size
+	offset := chainhash.Hash160Size
 
 	for i := offset; i <= len(data)-keyIDSize; i += keyIDSize {
 		id := btcec.KeyIDFromAddressBuffer(data[i : i+keyIDSize])
@@ -191,6 +232,18 @@ func (a *AddressProva) ScriptKeyIDs() []btcec.KeyID {
 	return a.keyIDs[:]
 }
 
+// Hash160 returns the underlying array of the pubkey hash.  This can be useful
+// when an array is more appropiate than a slice (for example, when used as map
+// keys).
+func (a *AddressProva) Hash160() *[ripemd160.Size]byte {
+	return (*[ripemd160.Size]byte)(&a.hash)
+}
+
+// TypedHash160 returns the pubkey hash as a chainhash.Hash160.
+func (a *AddressProva) TypedHash160() *chainhash.Hash160 {
+	return &a.hash
+}
+
 // IsForNet returns whether or not the Prova address is associated
 // with the passed bitcoin network.
 func (a *AddressProva) IsForNet(net *chaincfg.Params) bool {
@@ -207,7 +260,7 @@ func (a *AddressProva) String() string {
 // AddressPubKeyHash is an Address for a pay-to-pubkey-hash (P2PKH)
 // transaction.
 type AddressPubKeyHash struct {
-	hash  [ripemd160.Size]byte
+	hash  chainhash.Hash160
 	netID byte
 }
 
@@ -218,7 +271,7 @@ type AddressPubKeyHash struct {
 // known.
 func newAddressPubKeyHash(pkHash []byte, netID byte) (*AddressPubKeyHash, error) {
 	// Check for a valid pubkey hash length.
-	if len(pkHash) != ripemd160.Size {
+	if len(pkHash) != chainhash.Hash160Size {
 		return nil, errors.New("pkHash must be 20 bytes")
 	}
 
@@ -243,13 +296,18 @@ func (a *AddressPubKeyHash) ScriptKeyIDs() []btcec.KeyID {
 // when an array is more appropiate than a slice (for example, when used as map
 // keys).
 func (a *AddressPubKeyHash) Hash160() *[ripemd160.Size]byte {
+	return (*[ripemd160.Size]byte)(&a.hash)
+}
+
+// TypedHash160 returns the pubkey hash as a chainhash.Hash160.
+func (a *AddressPubKeyHash) TypedHash160() *chainhash.Hash160 {
 	return &a.hash
 }
 
 // AddressScriptHash is an Address for a pay-to-script-hash (P2SH)
 // transaction.
 type AddressScriptHash struct {
-	hash  [ripemd160.Size]byte
+	hash  chainhash.Hash160
 	netID byte
 }
 
@@ -260,7 +318,7 @@ type AddressScriptHash struct {
 // known.
 func newAddressScriptHashFromHash(scriptHash []byte, netID byte) (*AddressScriptHash, error) {
 	// Check for a valid script hash length.
-	if len(scriptHash) != ripemd160.Size {
+	if len(scriptHash) != chainhash.Hash160Size {
 		return nil, errors.New("scriptHash must be 20 bytes")
 	}
 
@@ -285,6 +343,11 @@ func (a *AddressScriptHash) ScriptKeyIDs() []btcec.KeyID {
 // when an array is more appropiate than a slice (for example, when used as map
 // keys).
 func (a *AddressScriptHash) Hash160() *[ripemd160.Size]byte {
+	return (*[ripemd160.Size]byte)(&a.hash)
+}
+
+// TypedHash160 returns the script hash as a chainhash.Hash160.
+func (a *AddressScriptHash) TypedHash160() *chainhash.Hash160 {
 	return &a.hash
 }
 
@@ -394,8 +457,10 @@ func (a *AddressPubKey) SetFormat(pkFormat PubKeyFormat) {
 // differs with the format.  At the time of this writing, most Bitcoin addresses
 // are pay-to-pubkey-hash constructed from the uncompressed public key.
 func (a *AddressPubKey) AddressPubKeyHash() *AddressPubKeyHash {
-	addr := &AddressPubKeyHash{netID: a.pubKeyHashID}
-	copy(addr.hash[:], Hash160(a.serialize()))
+	addr := &AddressPubKeyHash{
+		hash:  chainhash.Hash160Sum(a.serialize()),
+		netID: a.pubKeyHashID,
+	}
 	return addr
 }
 
@@ -6,10 +6,12 @@
 package provautil_test
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/bitgo/prova/btcec"
 	"github.com/bitgo/prova/chaincfg"
 	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/provautil/base58"
 	"github.com/btcsuite/golangcrypto/ripemd160"
 	"testing"
 )
@@ -47,6 +49,22 @@ func TestAddresses(t *testing.T) {
 			pkHash: []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20},
 			valid:  true,
 		},
+		{
+			addr:   "T9GooXEi927U4tuUkHsyfxtuDwAGFP2RaDXNGVNchBSz3",
+			keyIDs: []btcec.KeyID{1, 2},
+			name:   "regtest standard address",
+			net:    &chaincfg.RegressionNetParams,
+			pkHash: []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20},
+			valid:  true,
+		},
+		{
+			addr:   "sCsTpj8bjKwCK6auah6MgdmsUBAPRit9EPedcCzDL5QUX",
+			keyIDs: []btcec.KeyID{1, 2},
+			name:   "simnet standard address",
+			net:    &chaincfg.SimNetParams,
+			pkHash: []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20},
+			valid:  true,
+		},
 		{
 			addr:   "9kT6DCNXS7BcCexSzVMXJ8aZXYxjB4ZGhBqGEU4DKm3vdyZDPbFDPV32np61p76X2Hjepz412YLpoNzwyBuWAWTqsq75ApLf6VaM8zApsumNDXnLLBqR9ZoYDYJgqQU4w2kFMP1e1A",
 			keyIDs: []btcec.KeyID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19},
@@ -130,6 +148,26 @@ func TestAddresses(t *testing.T) {
 			}
 		}
 
+		// Ensure the pkhash array matches the script address.
+		if h := decoded.(*provautil.AddressProva).Hash160(); !bytes.Equal(h[:], test.pkHash) {
+			t.Errorf("%v: hash160 does not match: got %x expected %x", test.name, h[:], test.pkHash)
+			return
+		}
+
+		// Ensure an address created from the typed pkhash is the same.
+		fromHash, err := provautil.NewAddressProvaFromHash160(
+			decoded.(*provautil.AddressProva).TypedHash160(),
+			test.keyIDs, test.net)
+		if err != nil {
+			t.Errorf("%v: NewAddressProvaFromHash160: unexpected error: %v", test.name, err)
+			return
+		}
+		if fromHash.EncodeAddress() != test.addr {
+			t.Errorf("%v: NewAddressProvaFromHash160 produced a different address: %v != %v",
+				test.name, fromHash.EncodeAddress(), test.addr)
+			return
+		}
+
 		// Ensure the stringer returns the same address as the
 		// original.
 		if decodedStringer, ok := decoded.(fmt.Stringer); ok {
@@ -156,3 +194,186 @@ func TestAddresses(t *testing.T) {
 		}
 	}
 }
+
+// TestDecodeAddressErrors ensures decoding Prova addresses with malformed
+// payloads, bad checksums, and unknown network identifiers fails.
+func TestDecodeAddressErrors(t *testing.T) {
+	pkHash := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20}
+	keyIDs := []byte{1, 0, 0, 0, 2, 0, 0, 0}
+	payload := append(append([]byte{}, pkHash...), keyIDs...)
+	valid := base58.CheckEncode(payload, chaincfg.MainNetParams.ProvaAddrID)
+
+	// Flip a character of a valid address to corrupt its checksum.
+	badChecksum := []byte(valid)
+	if badChecksum[10] == 'a' {
+		badChecksum[10] = 'b'
+	} else {
+		badChecksum[10] = 'a'
+	}
+
+	tests := []struct {
+		name string
+		addr string
+		err  error
+	}{
+		{
+			name: "wrong checksum",
+			addr: string(badChecksum),
+			err:  provautil.ErrChecksumMismatch,
+		},
+		{
+			name: "truncated key id",
+			addr: base58.CheckEncode(payload[:len(payload)-1],
+				chaincfg.MainNetParams.ProvaAddrID),
+		},
+		{
+			name: "single key id",
+			addr: base58.CheckEncode(payload[:len(payload)-4],
+				chaincfg.MainNetParams.ProvaAddrID),
+		},
+		{
+			name: "pubkey hash only",
+			addr: base58.CheckEncode(pkHash, chaincfg.MainNetParams.ProvaAddrID),
+		},
+		{
+			name: "truncated pubkey hash",
+			addr: base58.CheckEncode(pkHash[:19], chaincfg.MainNetParams.ProvaAddrID),
+		},
+		{
+			name: "unknown network identifier",
+			addr: base58.CheckEncode(payload, 0x01),
+			err:  provautil.ErrUnknownAddressType,
+		},
+		{
+			name: "too short for a checksum",
+			addr: "G9n6",
+		},
+	}
+
+	if _, err := provautil.DecodeAddress(valid, &chaincfg.MainNetParams); err != nil {
+		t.Fatalf("unable to decode valid address %v: %v", valid, err)
+	}
+	for _, test := range tests {
+		_, err := provautil.DecodeAddress(test.addr, &chaincfg.MainNetParams)
+		if err == nil {
+			t.Errorf("%v: decoding %v did not fail", test.name,
+				test.addr)
+			continue
+		}
+		if test.err != nil && err != test.err {
+			t.Errorf("%v: unexpected error - got %v, want %v",
+				test.name, err, test.err)
+		}
+	}
+}
+
+// TestDecodeAddressRegisteredNets ensures addresses are decoded based on the
+// identifiers of all default and registered networks regardless of the
+// default network passed to DecodeAddress, and that the decoded addresses
+// report the networks they belong to.
+func TestDecodeAddressRegisteredNets(t *testing.T) {
+	// Register a network with its own identifier and one which shares the
+	// identifier of mainnet.
+	customNet := chaincfg.Params{
+		Name:        "customnet",
+		Net:         1<<32 - 2,
+		ProvaAddrID: 0x42,
+	}
+	sharedNet := chaincfg.Params{
+		Name:        "sharednet",
+		Net:         1<<32 - 3,
+		ProvaAddrID: chaincfg.MainNetParams.ProvaAddrID,
+	}
+	unregisteredNet := chaincfg.Params{
+		Name:        "unregisterednet",
+		Net:         1<<32 - 4,
+		ProvaAddrID: 0x43,
+	}
+	for _, net := range []*chaincfg.Params{&customNet, &sharedNet} {
+		if err := chaincfg.Register(net); err != nil {
+			t.Fatalf("unable to register %s: %v", net.Name, err)
+		}
+	}
+
+	pkHash := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20}
+	keyIDs := []btcec.KeyID{1, 2}
+	nets := []*chaincfg.Params{&chaincfg.MainNetParams,
+		&chaincfg.TestNetParams, &customNet, &sharedNet}
+	tests := []struct {
+		name   string
+		net    *chaincfg.Params
+		forNet map[string]bool
+	}{
+		{
+			name: "mainnet",
+			net:  &chaincfg.MainNetParams,
+			forNet: map[string]bool{
+				chaincfg.MainNetParams.Name: true,
+				sharedNet.Name:              true,
+			},
+		},
+		{
+			name: "testnet",
+			net:  &chaincfg.TestNetParams,
+			forNet: map[string]bool{
+				chaincfg.TestNetParams.Name: true,
+			},
+		},
+		{
+			name: "custom network",
+			net:  &customNet,
+			forNet: map[string]bool{
+				customNet.Name: true,
+			},
+		},
+		{
+			name: "network sharing the mainnet identifier",
+			net:  &sharedNet,
+			forNet: map[string]bool{
+				chaincfg.MainNetParams.Name: true,
+				sharedNet.Name:              true,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		addr, err := provautil.NewAddressProva(pkHash, keyIDs, test.net)
+		if err != nil {
+			t.Fatalf("%s: unable to create address: %v", test.name, err)
+		}
+
+		// Decode the address with every network as the default.
+		for _, defaultNet := range nets {
+			decoded, err := provautil.DecodeAddress(addr.EncodeAddress(),
+				defaultNet)
+			if err != nil {
+				t.Errorf("%s: unable to decode with default net "+
+					"%s: %v", test.name, defaultNet.Name, err)
+				continue
+			}
+			if decoded.EncodeAddress() != addr.EncodeAddress() {
+				t.Errorf("%s: decoded address %v does not "+
+					"match %v", test.name, decoded, addr)
+			}
+			for _, net := range nets {
+				if got := decoded.IsForNet(net); got != test.forNet[net.Name] {
+					t.Errorf("%s: IsForNet(%s) is %v, want "+
+						"%v", test.name, net.Name, got,
+						test.forNet[net.Name])
+				}
+			}
+		}
+	}
+
+	// Ensure an address for a network which is not registered is rejected.
+	addr, err := provautil.NewAddressProva(pkHash, keyIDs, &unregisteredNet)
+	if err != nil {
+		t.Fatalf("unable to create address: %v", err)
+	}
+	_, err = provautil.DecodeAddress(addr.EncodeAddress(),
+		&unregisteredNet)
+	if err != provautil.ErrUnknownAddressType {
+		t.Fatalf("unexpected error for unregistered network - got %v, "+
+			"want %v", err, provautil.ErrUnknownAddressType)
+	}
+}
@@ -9,6 +9,17 @@ import (
 	"errors"
 	"math"
 	"strconv"
+	"strings"
+)
+
+var (
+	// ErrAmountOverflow describes an error where the result of an
+	// arithmetic operation on amounts can not be represented by an Amount.
+	ErrAmountOverflow = errors.New("amount overflow")
+
+	// ErrInvalidAmount describes an error where a value or string can not
+	// be converted to an Amount.
+	ErrInvalidAmount = errors.New("invalid amount")
 )
 
 // AmountUnit describes a method of converting an Amount to something
@@ -63,9 +74,15 @@ func round(f float64) Amount {
 }
 
 // NewAmount creates an Amount from a floating point value representing
-// some value in grams.  NewAmount errors if f is NaN or +-Infinity, but
-// does not check that the amount is within the total amount of grams
-// producible as f may not refer to an amount at a single moment in time.
+// some value in grams.  NewAmount errors if f is NaN or +-Infinity or too
+// large to be represented as an Amount, but does not check that the amount is
+// within the total amount of grams producible as f may not refer to an amount
+// at a single moment in time.
+//
+// The conversion is performed on the shortest decimal representation of f,
+// so values such as 0.1 convert to the exact number of Atoms rather than
+// suffering from the binary representation error of the float.  Fractions of
+// an Atom are rounded to the nearest Atom with ties rounded to even.
 //
 // NewAmount is for specifically for converting RMG to Atoms.
 // For creating a new Amount with an int64 value which denotes a quantity of
@@ -80,10 +97,123 @@ func NewAmount(f float64) (Amount, error) {
 	case math.IsInf(f, 1):
 		fallthrough
 	case math.IsInf(f, -1):
-		return 0, errors.New("invalid amount")
+		return 0, ErrInvalidAmount
+	}
+
+	return parseAtoms(strconv.FormatFloat(f, 'f', -1, 64), AmountRMG, true)
+}
+
+// ParseAmount parses a decimal string representing an amount, optionally
+// followed by a unit as returned by AmountUnit.String, such as "1.5", "1.5 RMG",
+// "250 mRMG" or "10 Atom".  Amounts without a unit are in grams.  Unlike
+// NewAmount, the string is converted exactly and ParseAmount errors if it
+// specifies a fraction of an Atom.
+func ParseAmount(s string) (Amount, error) {
+	s = strings.TrimSpace(s)
+	unit := AmountRMG
+	if i := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.' && r != '-' && r != '+'
+	}); i >= 0 {
+		var ok bool
+		unit, ok = parseAmountUnit(strings.TrimSpace(s[i:]))
+		if !ok {
+			return 0, ErrInvalidAmount
+		}
+		s = strings.TrimSpace(s[:i])
+	}
+	return parseAtoms(s, unit, false)
+}
+
+// parseAmountUnit returns the unit for the passed unit label.  The labels of
+// the known units are accepted along with plural forms of the base unit.
+func parseAmountUnit(label string) (AmountUnit, bool) {
+	switch label {
+	case "Atoms", "atom", "atoms":
+		return AmountAtoms, true
 	}
+	for _, u := range []AmountUnit{AmountMegaRMG, AmountKiloRMG, AmountRMG,
+		AmountMilliRMG, AmountAtoms} {
 
-	return round(f * AtomsPerGram), nil
+		if label == u.String() {
+			return u, true
+		}
+	}
+	return 0, false
+}
+
+// parseAtoms converts a plain decimal string representing an amount in the
+// passed unit to an Amount.  Digits representing fractions of an Atom are
+// rounded half to even when round is set and must be zero otherwise.
+func parseAtoms(s string, u AmountUnit, round bool) (Amount, error) {
+	neg := false
+	switch {
+	case strings.HasPrefix(s, "-"):
+		neg = true
+		s = s[1:]
+	case strings.HasPrefix(s, "+"):
+		s = s[1:]
+	}
+	intPart, fracPart := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		intPart, fracPart = s[:i], s[i+1:]
+	}
+	if intPart == "" && fracPart == "" {
+		return 0, ErrInvalidAmount
+	}
+	for _, part := range []string{intPart, fracPart} {
+		for _, c := range part {
+			if c < '0' || c > '9' {
+				return 0, ErrInvalidAmount
+			}
+		}
+	}
+
+	// Shift the decimal point so the integer part is in Atoms and the
+	// fraction part is the sub-Atom remainder.
+	shift := int(u) + 6
+	if shift < 0 {
+		if len(intPart) < -shift {
+			intPart = strings.Repeat("0", -shift-len(intPart)) + intPart
+		}
+		fracPart = intPart[len(intPart)+shift:] + fracPart
+		intPart = intPart[:len(intPart)+shift]
+	} else {
+		if len(fracPart) < shift {
+			fracPart += strings.Repeat("0", shift-len(fracPart))
+		}
+		intPart += fracPart[:shift]
+		fracPart = fracPart[shift:]
+	}
+
+	var atoms uint64
+	for _, c := range intPart {
+		d := uint64(c - '0')
+		if atoms > (math.MaxInt64-d)/10 {
+			return 0, ErrInvalidAmount
+		}
+		atoms = atoms*10 + d
+	}
+
+	// Round the remainder half to even or ensure there is none.
+	fracPart = strings.TrimRight(fracPart, "0")
+	if fracPart != "" {
+		if !round {
+			return 0, ErrInvalidAmount
+		}
+		if fracPart[0] > '5' || (fracPart[0] == '5' &&
+			(len(fracPart) > 1 || atoms%2 == 1)) {
+
+			if atoms == math.MaxInt64 {
+				return 0, ErrInvalidAmount
+			}
+			atoms++
+		}
+	}
+
+	if neg {
+		return -Amount(atoms), nil
+	}
+	return Amount(atoms), nil
 }
 
 // ToUnit converts a monetary amount counted in gram base units to a
@@ -118,3 +248,36 @@ func (a Amount) String() string {
 func (a Amount) MulF64(f float64) Amount {
 	return round(float64(a) * f)
 }
+
+// Add returns the sum of the amounts and errors with ErrAmountOverflow when
+// the sum can not be represented as an Amount.
+func (a Amount) Add(b Amount) (Amount, error) {
+	if (b > 0 && a > math.MaxInt64-b) || (b < 0 && a < math.MinInt64-b) {
+		return 0, ErrAmountOverflow
+	}
+	return a + b, nil
+}
+
+// Sub returns the difference of the amounts and errors with ErrAmountOverflow
+// when the difference can not be represented as an Amount.
+func (a Amount) Sub(b Amount) (Amount, error) {
+	if (b < 0 && a > math.MaxInt64+b) || (b > 0 && a < math.MinInt64+b) {
+		return 0, ErrAmountOverflow
+	}
+	return a - b, nil
+}
+
+// MulInt returns the amount multiplied by n and errors with ErrAmountOverflow
+// when the product can not be represented as an Amount.
+func (a Amount) MulInt(n int64) (Amount, error) {
+	if a == 0 || n == 0 {
+		return 0, nil
+	}
+	product := a * Amount(n)
+	if product/Amount(n) != a || (a == -1 && n == math.MinInt64) ||
+		(n == -1 && a == math.MinInt64) {
+
+		return 0, ErrAmountOverflow
+	}
+	return product, nil
+}
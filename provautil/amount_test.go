@@ -300,3 +300,232 @@ func TestAmountMulF64(t *testing.T) {
 		}
 	}
 }
+
+func TestAmountRounding(t *testing.T) {
+	tests := []struct {
+		name   string
+		amount float64
+		res    Amount
+	}{
+		{name: "0.1 RMG", amount: 0.1, res: 100000},
+		{name: "0.3 RMG", amount: 0.3, res: 300000},
+		{name: "0.7 RMG", amount: 0.7, res: 700000},
+		{name: "1.005 RMG", amount: 1.005, res: 1005000},
+		{name: "tie rounds down to even", amount: 0.0000005, res: 0},
+		{name: "tie rounds up to even", amount: 0.0000015, res: 2},
+		{name: "tie rounds down to even 2", amount: 0.0000025, res: 2},
+		{name: "negative tie rounds to even", amount: -0.0000015, res: -2},
+		{name: "above tie rounds up", amount: 0.00000050001, res: 1},
+		{name: "below tie rounds down", amount: 0.00000049999, res: 0},
+		{name: "smallest denormal", amount: math.SmallestNonzeroFloat64, res: 0},
+		{name: "max producible less one atom", amount: 2099999999.999999, res: MaxAtoms - 1},
+		{name: "max producible plus one atom", amount: 2100000000.000001, res: MaxAtoms + 1},
+		{name: "exact atoms limit", amount: 4294967295.999999, res: 4294967295999999},
+		{name: "large whole amount", amount: 9e12, res: 9e18},
+	}
+
+	for _, test := range tests {
+		a, err := NewAmount(test.amount)
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", test.name, err)
+			continue
+		}
+		if a != test.res {
+			t.Errorf("%v: expected %d got %d", test.name, test.res, a)
+		}
+	}
+
+	// Ensure amounts too large to represent are rejected.
+	for _, f := range []float64{9.3e12, -9.3e12, math.MaxFloat64} {
+		if _, err := NewAmount(f); err != ErrInvalidAmount {
+			t.Errorf("NewAmount(%v): unexpected error - got %v, want %v",
+				f, err, ErrInvalidAmount)
+		}
+	}
+
+	// Ensure converting atoms to grams and back is exact at every
+	// magnitude up to 2^32 grams, which is the float64 precision limit for
+	// distinguishing single atoms, and around the max producible amount.
+	bases := []int64{MaxAtoms, 1 << 32 * AtomsPerGram}
+	for shift := uint(0); shift < 52; shift++ {
+		bases = append(bases, 1<<shift)
+	}
+	for _, base := range bases {
+		for delta := int64(-3); delta <= 3; delta++ {
+			atoms := Amount(base + delta)
+			if atoms < 0 || atoms >= 1<<32*AtomsPerGram {
+				continue
+			}
+			a, err := NewAmount(atoms.ToRMG())
+			if err != nil {
+				t.Errorf("%d atoms: unexpected error: %v", atoms, err)
+				continue
+			}
+			if a != atoms {
+				t.Errorf("%d atoms: round trip produced %d", atoms, a)
+			}
+		}
+	}
+}
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		s     string
+		valid bool
+		res   Amount
+	}{
+		{s: "0", valid: true, res: 0},
+		{s: "1", valid: true, res: 1e6},
+		{s: ".5", valid: true, res: 5e5},
+		{s: "1.", valid: true, res: 1e6},
+		{s: "0.1", valid: true, res: 1e5},
+		{s: "+0.000001", valid: true, res: 1},
+		{s: "-12.345678", valid: true, res: -12345678},
+		{s: "1.500000000", valid: true, res: 15e5},
+		{s: "1.5 RMG", valid: true, res: 15e5},
+		{s: "1.5RMG", valid: true, res: 15e5},
+		{s: " 2 kRMG ", valid: true, res: 2e9},
+		{s: "0.000001 MRMG", valid: true, res: 1e6},
+		{s: "250 mRMG", valid: true, res: 25e4},
+		{s: "0.001 mRMG", valid: true, res: 1},
+		{s: "10 Atom", valid: true, res: 10},
+		{s: "10 Atoms", valid: true, res: 10},
+		{s: "9223372036854.775807", valid: true, res: math.MaxInt64},
+		{s: "-9223372036854.775807", valid: true, res: -math.MaxInt64},
+		{s: "", valid: false},
+		{s: ".", valid: false},
+		{s: "-", valid: false},
+		{s: "0.0000001", valid: false},
+		{s: "0.5 Atom", valid: false},
+		{s: "1.2.3", valid: false},
+		{s: "1-2", valid: false},
+		{s: "1e6", valid: false},
+		{s: "0x10", valid: false},
+		{s: "1 BTC", valid: false},
+		{s: "9223372036854.775808", valid: false},
+	}
+
+	for _, test := range tests {
+		a, err := ParseAmount(test.s)
+		if (err == nil) != test.valid {
+			t.Errorf("%q: unexpected error result: %v", test.s, err)
+			continue
+		}
+		if err == nil && a != test.res {
+			t.Errorf("%q: expected %d got %d", test.s, test.res, a)
+		}
+	}
+
+	// Ensure formatted amounts parse back to the same amount.
+	for _, u := range []AmountUnit{AmountMegaRMG, AmountKiloRMG, AmountRMG,
+		AmountMilliRMG, AmountAtoms} {
+
+		for _, amt := range []Amount{0, 1, 123456789, -MaxAtoms} {
+			a, err := ParseAmount(amt.Format(u))
+			if err != nil {
+				t.Errorf("%q: unexpected error: %v", amt.Format(u), err)
+				continue
+			}
+			if a != amt {
+				t.Errorf("%q: expected %d got %d", amt.Format(u), amt, a)
+			}
+		}
+	}
+}
+
+func TestAmountArithmetic(t *testing.T) {
+	tests := []struct {
+		name string
+		op   func() (Amount, error)
+		res  Amount
+		err  error
+	}{
+		{
+			name: "add",
+			op:   func() (Amount, error) { return Amount(1).Add(2) },
+			res:  3,
+		},
+		{
+			name: "add negative",
+			op:   func() (Amount, error) { return Amount(1).Add(-2) },
+			res:  -1,
+		},
+		{
+			name: "add to max",
+			op:   func() (Amount, error) { return Amount(math.MaxInt64 - 1).Add(1) },
+			res:  math.MaxInt64,
+		},
+		{
+			name: "add overflow",
+			op:   func() (Amount, error) { return Amount(math.MaxInt64).Add(1) },
+			err:  ErrAmountOverflow,
+		},
+		{
+			name: "add underflow",
+			op:   func() (Amount, error) { return Amount(math.MinInt64).Add(-1) },
+			err:  ErrAmountOverflow,
+		},
+		{
+			name: "sub",
+			op:   func() (Amount, error) { return Amount(1).Sub(2) },
+			res:  -1,
+		},
+		{
+			name: "sub to min",
+			op:   func() (Amount, error) { return Amount(math.MinInt64 + 1).Sub(1) },
+			res:  math.MinInt64,
+		},
+		{
+			name: "sub underflow",
+			op:   func() (Amount, error) { return Amount(math.MinInt64).Sub(1) },
+			err:  ErrAmountOverflow,
+		},
+		{
+			name: "sub overflow",
+			op:   func() (Amount, error) { return Amount(0).Sub(math.MinInt64) },
+			err:  ErrAmountOverflow,
+		},
+		{
+			name: "mul",
+			op:   func() (Amount, error) { return Amount(-3).MulInt(4) },
+			res:  -12,
+		},
+		{
+			name: "mul by zero",
+			op:   func() (Amount, error) { return Amount(math.MaxInt64).MulInt(0) },
+			res:  0,
+		},
+		{
+			name: "mul max producible",
+			op:   func() (Amount, error) { return Amount(MaxAtoms).MulInt(4000) },
+			res:  4000 * MaxAtoms,
+		},
+		{
+			name: "mul overflow",
+			op:   func() (Amount, error) { return Amount(MaxAtoms).MulInt(5000) },
+			err:  ErrAmountOverflow,
+		},
+		{
+			name: "mul negative overflow",
+			op:   func() (Amount, error) { return Amount(math.MinInt64).MulInt(-1) },
+			err:  ErrAmountOverflow,
+		},
+		{
+			name: "mul min by negative one",
+			op:   func() (Amount, error) { return Amount(-1).MulInt(math.MinInt64) },
+			err:  ErrAmountOverflow,
+		},
+	}
+
+	for _, test := range tests {
+		res, err := test.op()
+		if err != test.err {
+			t.Errorf("%v: unexpected error - got %v, want %v", test.name,
+				err, test.err)
+			continue
+		}
+		if err == nil && res != test.res {
+			t.Errorf("%v: expected %d got %d", test.name, test.res, res)
+		}
+	}
+}
@@ -6,12 +6,15 @@
 package provautil
 
 import (
+	"fmt"
 	"os"
 	"os/user"
 	"path/filepath"
 	"runtime"
 	"strings"
 	"unicode"
+
+	"github.com/bitgo/prova/chaincfg"
 )
 
 // appDataDir returns an operating system specific directory to be used for
@@ -106,3 +109,37 @@ func appDataDir(goos, appName string, roaming bool) string {
 func AppDataDir(appName string, roaming bool) string {
 	return appDataDir(runtime.GOOS, appName, roaming)
 }
+
+// networkDirName returns the name of the data subdirectory for the passed
+// network.  It is the name of the network with any characters which are not
+// safe to use in a path replaced, or a name derived from the network magic
+// when the network has no name.
+func networkDirName(params *chaincfg.Params) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z',
+			r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		}
+		return '_'
+	}, params.Name)
+	if strings.Trim(name, ".") == "" {
+		return fmt.Sprintf("net-%08x", uint32(params.Net))
+	}
+	return name
+}
+
+// NetworkDataDir returns the directory under the passed base directory to be
+// used for storing the data of the passed network.  Each of the default
+// networks uses a subdirectory named after it, for example mainnet, testnet,
+// regtest or simnet, and custom networks use their names as well.  Characters
+// in the name which are not safe to use in a path are replaced and a network
+// without a name uses one derived from its network magic.  No directories are
+// created.
+//
+// Example results:
+//  dir := NetworkDataDir(AppDataDir("myapp", false), &chaincfg.TestNetParams)
+//   POSIX (Linux/BSD): ~/.myapp/testnet
+func NetworkDataDir(base string, params *chaincfg.Params) string {
+	return filepath.Join(base, networkDirName(params))
+}
@@ -13,6 +13,7 @@ import (
 	"testing"
 	"unicode"
 
+	"github.com/bitgo/prova/chaincfg"
 	"github.com/bitgo/prova/provautil"
 )
 
@@ -132,3 +133,86 @@ func TestAppDataDir(t *testing.T) {
 		}
 	}
 }
+
+// TestAppDataDirEnv ensures the Windows application data directories are
+// taken from the environment and that the returned directories have the
+// expected shape on the major platforms.
+func TestAppDataDirEnv(t *testing.T) {
+	// Override the Windows environment variables and restore them when
+	// the test is done.
+	for _, name := range []string{"LOCALAPPDATA", "APPDATA"} {
+		if old, ok := os.LookupEnv(name); ok {
+			defer os.Setenv(name, old)
+		} else {
+			defer os.Unsetenv(name)
+		}
+	}
+	local := filepath.Join("C:", "Users", "user", "AppData", "Local")
+	roaming := filepath.Join("C:", "Users", "user", "AppData", "Roaming")
+	os.Setenv("LOCALAPPDATA", local)
+	os.Setenv("APPDATA", roaming)
+
+	usr, err := user.Current()
+	if err != nil {
+		t.Fatalf("user.Current: %v", err)
+	}
+	homeDir := usr.HomeDir
+
+	tests := []struct {
+		name    string
+		goos    string
+		roaming bool
+		want    string
+	}{
+		{"windows local", "windows", false, filepath.Join(local, "Prova")},
+		{"windows roaming", "windows", true, filepath.Join(roaming, "Prova")},
+		{"mac", "darwin", false, filepath.Join(homeDir, "Library",
+			"Application Support", "Prova")},
+		{"linux", "linux", false, filepath.Join(homeDir, ".prova")},
+	}
+	for _, test := range tests {
+		got := provautil.TstAppDataDir(test.goos, "prova", test.roaming)
+		if got != test.want {
+			t.Errorf("%s: unexpected directory - got %s, want %s",
+				test.name, got, test.want)
+		}
+	}
+
+	// Windows falls back to the roaming directory when there is no local
+	// one.
+	os.Unsetenv("LOCALAPPDATA")
+	got := provautil.TstAppDataDir("windows", "prova", false)
+	if want := filepath.Join(roaming, "Prova"); got != want {
+		t.Errorf("windows without local directory: unexpected directory "+
+			"- got %s, want %s", got, want)
+	}
+}
+
+// TestNetworkDataDir ensures each network maps to a stable subdirectory of the
+// base directory.
+func TestNetworkDataDir(t *testing.T) {
+	base := filepath.Join("base", "data")
+	tests := []struct {
+		name   string
+		params *chaincfg.Params
+		want   string
+	}{
+		{"mainnet", &chaincfg.MainNetParams, "mainnet"},
+		{"testnet", &chaincfg.TestNetParams, "testnet"},
+		{"regtest", &chaincfg.RegressionNetParams, "regtest"},
+		{"simnet", &chaincfg.SimNetParams, "simnet"},
+		{"custom", &chaincfg.Params{Name: "customnet"}, "customnet"},
+		{"unsafe name", &chaincfg.Params{Name: "../custom net"},
+			".._custom_net"},
+		{"dots only", &chaincfg.Params{Name: "..", Net: 0x1234},
+			"net-00001234"},
+		{"no name", &chaincfg.Params{Net: 0xfabfb5da}, "net-fabfb5da"},
+	}
+	for _, test := range tests {
+		got := provautil.NetworkDataDir(base, test.params)
+		if want := filepath.Join(base, test.want); got != want {
+			t.Errorf("%s: unexpected directory - got %s, want %s",
+				test.name, got, want)
+		}
+	}
+}
@@ -27,27 +27,64 @@ func checksum(input []byte) (cksum [4]byte) {
 
 // CheckEncode prepends a version byte and appends a four byte checksum.
 func CheckEncode(input []byte, version byte) string {
-	b := make([]byte, 0, 1+len(input)+4)
-	b = append(b, version)
+	return CheckEncodeVersioned(input, []byte{version})
+}
+
+// CheckEncodeVersioned prepends a version prefix of arbitrary length and
+// appends a four byte checksum.  Leading zero bytes of the version, or of the
+// input when there is no version, are preserved as leading '1' characters.
+func CheckEncodeVersioned(input []byte, version []byte) string {
+	b := make([]byte, 0, len(version)+len(input)+4)
+	b = append(b, version...)
 	b = append(b, input[:]...)
 	cksum := checksum(b)
 	b = append(b, cksum[:]...)
 	return Encode(b)
 }
 
-// CheckDecode decodes a string that was encoded with CheckEncode and verifies the checksum.
-func CheckDecode(input string) (result []byte, version byte, err error) {
-	decoded := Decode(input)
-	if len(decoded) < 5 {
-		return nil, 0, ErrInvalidFormat
+// checkDecode decodes a check-encoded string with a version prefix of the
+// passed length and verifies the checksum.  The version prefix must be at
+// least one byte long.
+func checkDecode(decoded []byte, versionLen int) (version, payload []byte, err error) {
+	if versionLen < 1 || len(decoded) < versionLen+4 {
+		return nil, nil, ErrInvalidFormat
 	}
-	version = decoded[0]
 	var cksum [4]byte
 	copy(cksum[:], decoded[len(decoded)-4:])
 	if checksum(decoded[:len(decoded)-4]) != cksum {
-		return nil, 0, ErrChecksum
+		return nil, nil, ErrChecksum
 	}
-	payload := decoded[1 : len(decoded)-4]
-	result = append(result, payload...)
-	return
+	version = append([]byte(nil), decoded[:versionLen]...)
+	payload = append([]byte{}, decoded[versionLen:len(decoded)-4]...)
+	return version, payload, nil
+}
+
+// CheckDecode decodes a string that was encoded with CheckEncode and verifies the checksum.
+func CheckDecode(input string) (result []byte, version byte, err error) {
+	ver, payload, err := checkDecode(Decode(input), 1)
+	if err != nil {
+		return nil, 0, err
+	}
+	return payload, ver[0], nil
+}
+
+// DecodeVersioned decodes a string that was encoded with CheckEncodeVersioned
+// and verifies the checksum.  The expectedLen parameter is the length of the
+// payload and every byte preceding it is returned as the version prefix, which
+// must be at least one byte long.  ErrInvalidFormat is returned when the
+// decoded string is too short to hold the payload, a version, and the
+// checksum.
+func DecodeVersioned(s string, expectedLen int) (version, payload []byte, err error) {
+	return DecodeVersionedBytes(Decode(s), expectedLen)
+}
+
+// DecodeVersionedBytes is like DecodeVersioned but operates on a string which
+// has already been base58-decoded.  It allows callers which need to inspect
+// the decoded length, such as to determine the payload length, to decode the
+// string only once.
+func DecodeVersionedBytes(decoded []byte, expectedLen int) (version, payload []byte, err error) {
+	if expectedLen < 0 {
+		return nil, nil, ErrInvalidFormat
+	}
+	return checkDecode(decoded, len(decoded)-4-expectedLen)
 }
@@ -6,6 +6,8 @@
 package base58_test
 
 import (
+	"bytes"
+	"math/rand"
 	"testing"
 
 	"github.com/bitgo/prova/provautil/base58"
@@ -29,6 +31,9 @@ var checkEncodingStringTests = []struct {
 	{20, "00000000000000000000000000000000000000000000000000000000000000", "bi1EWXwJay2udZVxLJozuTb8Meg4W9c6xnmJaRDjg6pri5MBAxb9XwrpQXbtnqEoRV5U2pixnFfwyXC8tRAVC8XxnjK"},
 }
 
+// alphabet is the base58 alphabet used to create corrupted encodings.
+const alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
 func TestBase58Check(t *testing.T) {
 	for x, test := range checkEncodingStringTests {
 		// test encoding
@@ -65,3 +70,87 @@ func TestBase58Check(t *testing.T) {
 	}
 
 }
+
+// TestBase58CheckVersioned ensures payloads with random version prefixes of
+// various lengths, including leading zero bytes, round trip through the
+// versioned encoding and that corrupting the encoded string is detected.
+func TestBase58CheckVersioned(t *testing.T) {
+	rng := rand.New(rand.NewSource(0x5eed))
+	for i := 0; i < 1000; i++ {
+		version := make([]byte, 1+rng.Intn(4))
+		rng.Read(version)
+		payload := make([]byte, rng.Intn(64))
+		rng.Read(payload)
+
+		// Force leading zeros in some of the cases.
+		if i%4 == 0 {
+			for j := 0; j < len(version) && j <= i%3; j++ {
+				version[j] = 0
+			}
+		}
+
+		encoded := base58.CheckEncodeVersioned(payload, version)
+		gotVersion, gotPayload, err := base58.DecodeVersioned(encoded,
+			len(payload))
+		if err != nil {
+			t.Fatalf("#%d: DecodeVersioned(%s) failed: %v", i, encoded,
+				err)
+		}
+		if !bytes.Equal(gotVersion, version) ||
+			!bytes.Equal(gotPayload, payload) {
+
+			t.Fatalf("#%d: DecodeVersioned(%s) got version %x "+
+				"payload %x, want version %x payload %x", i,
+				encoded, gotVersion, gotPayload, version,
+				payload)
+		}
+
+		// Decoding the already decoded string must yield the same
+		// version and payload.
+		gotVersion, gotPayload, err = base58.DecodeVersionedBytes(
+			base58.Decode(encoded), len(payload))
+		if err != nil || !bytes.Equal(gotVersion, version) ||
+			!bytes.Equal(gotPayload, payload) {
+
+			t.Fatalf("#%d: DecodeVersionedBytes got version %x "+
+				"payload %x err %v, want version %x payload %x",
+				i, gotVersion, gotPayload, err, version, payload)
+		}
+
+		// Single byte versions must match the original encoding.
+		if len(version) == 1 {
+			if s := base58.CheckEncode(payload, version[0]); s != encoded {
+				t.Fatalf("#%d: CheckEncode got %s, want %s", i, s,
+					encoded)
+			}
+		}
+
+		// Replace a random character of the encoded string with a
+		// different one and ensure decoding fails.
+		corrupted := []byte(encoded)
+		pos := rng.Intn(len(corrupted))
+		for {
+			c := alphabet[rng.Intn(len(alphabet))]
+			if c != corrupted[pos] {
+				corrupted[pos] = c
+				break
+			}
+		}
+		_, p, err := base58.DecodeVersioned(string(corrupted), len(payload))
+		if err == nil {
+			t.Fatalf("#%d: corrupted string %s decoded to %x", i,
+				corrupted, p)
+		}
+	}
+
+	// Ensure the payload length must leave room for a version.
+	encoded := base58.CheckEncodeVersioned([]byte{1, 2, 3}, []byte{4})
+	for _, expectedLen := range []int{-1, 4, 100} {
+		_, _, err := base58.DecodeVersioned(encoded, expectedLen)
+		if err != base58.ErrInvalidFormat {
+			t.Errorf("DecodeVersioned with payload length %d: got "+
+				"%v, want %v", expectedLen, err,
+				base58.ErrInvalidFormat)
+		}
+	}
+}
@@ -7,6 +7,7 @@ package provautil
 
 import (
 	"bytes"
+	"encoding/hex"
 	"fmt"
 	"io"
 
@@ -96,7 +97,7 @@ func (b *Block) Hash() *chainhash.Hash {
 func (b *Block) Tx(txNum int) (*Tx, error) {
 	// Ensure the requested transaction is in range.
 	numTx := uint64(len(b.msgBlock.Transactions))
-	if txNum < 0 || uint64(txNum) > numTx {
+	if txNum < 0 || uint64(txNum) >= numTx {
 		str := fmt.Sprintf("transaction index %d is out of range - max %d",
 			txNum, numTx-1)
 		return nil, OutOfRangeError(str)
@@ -207,14 +208,22 @@ func (b *Block) TxLoc() ([]wire.TxLoc, error) {
 	return txLocs, err
 }
 
-// Height returns the saved height of the block in the block chain.
+// Height returns the height of the block in the block chain.  Since the height
+// is committed to by the block header, it is always known.
 func (b *Block) Height() uint32 {
 	return b.blockHeight()
 }
 
-// SetHeight sets the height of the block in the block chain.
+// SetHeight sets the height of the block in the block chain.  The height is
+// part of the block header, so changing it changes the block hash and the
+// serialized bytes, and any cached values of them are discarded.
 func (b *Block) SetHeight(height uint32) {
+	if b.msgBlock.Header.Height == height {
+		return
+	}
 	b.msgBlock.Header.Height = height
+	b.blockHash = nil
+	b.serializedBlock = nil
 }
 
 // NewBlock returns a new instance of a bitcoin block given an underlying
@@ -226,19 +235,36 @@ func NewBlock(msgBlock *wire.MsgBlock) *Block {
 }
 
 // NewBlockFromBytes returns a new instance of a bitcoin block given the
-// serialized bytes.  See Block.
+// serialized bytes.  ErrTrailingData is returned when the bytes continue
+// beyond the end of the block.  See Block.
 func NewBlockFromBytes(serializedBlock []byte) (*Block, error) {
 	br := bytes.NewReader(serializedBlock)
 	b, err := NewBlockFromReader(br)
 	if err != nil {
 		return nil, err
 	}
+	if br.Len() != 0 {
+		return nil, ErrTrailingData
+	}
 	b.serializedBlock = serializedBlock
 	return b, nil
 }
 
+// NewBlockFromHex returns a new instance of a bitcoin block given the
+// hex-encoded serialized bytes.  ErrTrailingData is returned when the bytes
+// continue beyond the end of the block.  See Block.
+func NewBlockFromHex(serializedBlockHex string) (*Block, error) {
+	serializedBlock, err := hex.DecodeString(serializedBlockHex)
+	if err != nil {
+		return nil, err
+	}
+	return NewBlockFromBytes(serializedBlock)
+}
+
 // NewBlockFromReader returns a new instance of a bitcoin block given a
-// Reader to deserialize the block.  See Block.
+// Reader to deserialize the block.  The block is deserialized directly from
+// the reader, which is left positioned after it, so it can be used to read
+// consecutive blocks from a stream.  See Block.
 func NewBlockFromReader(r io.Reader) (*Block, error) {
 	// Deserialize the bytes into a MsgBlock.
 	var msgBlock wire.MsgBlock
@@ -7,6 +7,7 @@ package provautil_test
 
 import (
 	"bytes"
+	"encoding/hex"
 	"io"
 	"reflect"
 	"testing"
@@ -315,6 +316,167 @@ func TestBlockErrors(t *testing.T) {
 	}
 }
 
+// TestBlockMetadata ensures the transactions of a block know their index in it
+// regardless of whether they were generated lazily one at a time or all at
+// once, that copies of the transactions preserve it, and that changing the
+// height of a block discards its cached hash and serialized bytes.
+func TestBlockMetadata(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Block100000.Serialize(&buf); err != nil {
+		t.Fatalf("Serialize: %v", err)
+	}
+	numTx := len(Block100000.Transactions)
+
+	// Ensure a transaction not obtained from a block has an unknown index.
+	if idx := provautil.NewTx(Block100000.Transactions[0]).Index(); idx != provautil.TxIndexUnknown {
+		t.Fatalf("NewTx: index is %d, want %d", idx,
+			provautil.TxIndexUnknown)
+	}
+
+	// Generate a transaction lazily before all of them are generated.
+	b, err := provautil.NewBlockFromBytes(buf.Bytes())
+	if err != nil {
+		t.Fatalf("NewBlockFromBytes: %v", err)
+	}
+	lazyTx, err := b.Tx(numTx - 2)
+	if err != nil {
+		t.Fatalf("Tx: %v", err)
+	}
+	if lazyTx.Index() != numTx-2 {
+		t.Fatalf("Tx: index is %d, want %d", lazyTx.Index(), numTx-2)
+	}
+	if _, err := b.Tx(numTx); err == nil {
+		t.Fatalf("Tx: did not receive expected error for index %d",
+			numTx)
+	}
+	for i, tx := range b.Transactions() {
+		if tx.Index() != i {
+			t.Fatalf("Transactions: index of transaction %d is %d",
+				i, tx.Index())
+		}
+		if txCopy := tx.Copy(); txCopy.Index() != i {
+			t.Fatalf("Copy: index of transaction %d is %d", i,
+				txCopy.Index())
+		}
+	}
+	if b.Transactions()[numTx-2] != lazyTx {
+		t.Fatalf("Transactions: lazily generated transaction was " +
+			"not reused")
+	}
+
+	// Ensure setting the same height keeps the cached values while setting
+	// a different height discards them.
+	hash := *b.Hash()
+	height := b.Height()
+	b.SetHeight(height)
+	if !b.Hash().IsEqual(&hash) {
+		t.Fatalf("SetHeight: hash changed to %v for the same height",
+			b.Hash())
+	}
+	b.SetHeight(height + 1)
+	if b.Height() != height+1 {
+		t.Fatalf("SetHeight: height is %d, want %d", b.Height(),
+			height+1)
+	}
+	if b.Hash().IsEqual(&hash) {
+		t.Fatalf("SetHeight: stale hash %v after changing the height",
+			hash)
+	}
+	serialized, err := b.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes: %v", err)
+	}
+	b2, err := provautil.NewBlockFromBytes(serialized)
+	if err != nil {
+		t.Fatalf("NewBlockFromBytes: %v", err)
+	}
+	if b2.Height() != height+1 || !b2.Hash().IsEqual(b.Hash()) {
+		t.Fatalf("Bytes: stale serialized bytes after changing the " +
+			"height")
+	}
+}
+
+// TestBlockStreamingAndHex ensures blocks are read consecutively from a stream,
+// that truncated input and trailing data are rejected, and that blocks close to
+// the maximum size round trip through the hex encoding.
+func TestBlockStreamingAndHex(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Block100000.Serialize(&buf); err != nil {
+		t.Fatalf("Serialize: %v", err)
+	}
+	blockBytes := buf.Bytes()
+	wantHash := Block100000.BlockHash()
+
+	// Read several blocks from a single stream.
+	stream := bytes.NewReader(bytes.Repeat(blockBytes, 3))
+	for i := 0; i < 3; i++ {
+		b, err := provautil.NewBlockFromReader(stream)
+		if err != nil {
+			t.Fatalf("NewBlockFromReader #%d: %v", i, err)
+		}
+		if !b.Hash().IsEqual(&wantHash) {
+			t.Fatalf("NewBlockFromReader #%d: mismatched hash - "+
+				"got %v, want %v", i, b.Hash(), wantHash)
+		}
+	}
+	if _, err := provautil.NewBlockFromReader(stream); err != io.EOF {
+		t.Fatalf("NewBlockFromReader: did not get expected error at "+
+			"the end of the stream - got %v, want %v", err, io.EOF)
+	}
+
+	// Ensure every truncation of the block is rejected.
+	for n := 0; n < len(blockBytes); n++ {
+		_, err := provautil.NewBlockFromReader(bytes.NewReader(blockBytes[:n]))
+		if err == nil {
+			t.Fatalf("NewBlockFromReader: truncated block of %d "+
+				"bytes did not fail", n)
+		}
+	}
+
+	// Ensure trailing data is rejected.
+	trailing := append(append([]byte{}, blockBytes...), 0x00)
+	if _, err := provautil.NewBlockFromBytes(trailing); err != provautil.ErrTrailingData {
+		t.Fatalf("NewBlockFromBytes: did not get expected error - got "+
+			"%v, want %v", err, provautil.ErrTrailingData)
+	}
+	_, err := provautil.NewBlockFromHex(hex.EncodeToString(trailing))
+	if err != provautil.ErrTrailingData {
+		t.Fatalf("NewBlockFromHex: did not get expected error - got "+
+			"%v, want %v", err, provautil.ErrTrailingData)
+	}
+	if _, err := provautil.NewBlockFromHex("zz"); err == nil {
+		t.Fatalf("NewBlockFromHex: invalid hex did not fail")
+	}
+
+	// Create a block close to the maximum block size and ensure it round
+	// trips through the hex encoding and a stream.
+	large := wire.MsgBlock{Header: Block100000.Header}
+	large.AddTransaction(Block100000.Transactions[0])
+	tx := Block100000.Transactions[1]
+	for large.SerializeSize()+tx.SerializeSize() < wire.MaxBlockPayload-16 {
+		large.AddTransaction(tx)
+	}
+	buf.Reset()
+	if err := large.Serialize(&buf); err != nil {
+		t.Fatalf("Serialize: %v", err)
+	}
+	b, err := provautil.NewBlockFromHex(hex.EncodeToString(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("NewBlockFromHex: large block: %v", err)
+	}
+	if !reflect.DeepEqual(b.MsgBlock(), &large) {
+		t.Fatalf("NewBlockFromHex: large block does not match")
+	}
+	b, err = provautil.NewBlockFromReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("NewBlockFromReader: large block: %v", err)
+	}
+	if len(b.Transactions()) != len(large.Transactions) {
+		t.Fatalf("NewBlockFromReader: large block has %d transactions, "+
+			"want %d", len(b.Transactions()), len(large.Transactions))
+	}
+}
+
 // Block100000 defines block 100,000 of the block chain.  It is used to
 // test Block operations.
 var Block100000 = wire.MsgBlock{
@@ -257,8 +257,14 @@ func (bf *Filter) maybeAddOutpoint(pkScript []byte, outHash *chainhash.Hash, out
 		outpoint := wire.NewOutPoint(outHash, outIdx)
 		bf.addOutPoint(outpoint)
 	case wire.BloomUpdateP2PubkeyOnly:
+		// Prova outputs are included since spending them only
+		// requires signatures from two of the three keys, so the
+		// spending transaction does not necessarily reveal the data
+		// which matched the output.
 		class := txscript.GetScriptClass(pkScript)
-		if class == txscript.PubKeyTy || class == txscript.MultiSigTy {
+		if class == txscript.PubKeyTy || class == txscript.MultiSigTy ||
+			class == txscript.ProvaTy || class == txscript.GeneralProvaTy ||
+			class == txscript.ProvaTimeLockTy {
 			outpoint := wire.NewOutPoint(outHash, outIdx)
 			bf.addOutPoint(outpoint)
 		}
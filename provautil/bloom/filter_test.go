@@ -10,9 +10,12 @@ import (
 	"encoding/hex"
 	"testing"
 
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/chaincfg"
 	"github.com/bitgo/prova/chaincfg/chainhash"
 	"github.com/bitgo/prova/provautil"
 	"github.com/bitgo/prova/provautil/bloom"
+	"github.com/bitgo/prova/txscript"
 	"github.com/bitgo/prova/wire"
 )
 
@@ -659,3 +662,174 @@ func TestFilterReload(t *testing.T) {
 		t.Errorf("TestFilterReload Reload test failed")
 	}
 }
+
+// TestFilterMatchProvaScripts ensures transactions are matched by the data in
+// the public key scripts of each supported script type, by the data in their
+// signature scripts, and by the outpoints they spend, and that the outpoints of
+// matched outputs are added according to the update flags.
+func TestFilterMatchProvaScripts(t *testing.T) {
+	privKey, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		t.Fatalf("NewPrivateKey: unexpected error: %v", err)
+	}
+	pubKey := privKey.PubKey().SerializeCompressed()
+	pkHash := provautil.Hash160(pubKey)
+	keyIDs := []btcec.KeyID{100000, 100001}
+	addr, err := provautil.NewAddressProva(pkHash, keyIDs,
+		&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("NewAddressProva: unexpected error: %v", err)
+	}
+	provaScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		t.Fatalf("PayToAddrScript: unexpected error: %v", err)
+	}
+	generalScript, err := txscript.NewScriptBuilder().AddOp(txscript.OP_3).
+		AddData(pkHash).AddInt64(100000).AddInt64(100001).
+		AddInt64(100002).AddInt64(100003).AddOp(txscript.OP_5).
+		AddOp(txscript.OP_CHECKSAFEMULTISIG).Script()
+	if err != nil {
+		t.Fatalf("general Prova script: unexpected error: %v", err)
+	}
+	threadScript, err := txscript.ProvaThreadScript(provautil.ProvisionThread)
+	if err != nil {
+		t.Fatalf("ProvaThreadScript: unexpected error: %v", err)
+	}
+	adminData := append([]byte{txscript.AdminOpValidateKeyAdd}, pubKey...)
+	adminScript, err := txscript.NullDataScript(adminData)
+	if err != nil {
+		t.Fatalf("admin op script: unexpected error: %v", err)
+	}
+	nullData := []byte("prova bloom filter test")
+	nullDataScript, err := txscript.NullDataScript(nullData)
+	if err != nil {
+		t.Fatalf("NullDataScript: unexpected error: %v", err)
+	}
+	keyIDData, err := txscript.NewScriptBuilder().AddInt64(100001).Script()
+	if err != nil {
+		t.Fatalf("key id data: unexpected error: %v", err)
+	}
+
+	// newTx returns a transaction spending the passed outpoint with the
+	// passed signature script to the passed public key scripts.
+	newTx := func(prevOut *wire.OutPoint, sigScript []byte, pkScripts ...[]byte) *provautil.Tx {
+		msgTx := wire.NewMsgTx(1)
+		msgTx.AddTxIn(wire.NewTxIn(prevOut, sigScript))
+		for _, pkScript := range pkScripts {
+			msgTx.AddTxOut(wire.NewTxOut(0, pkScript))
+		}
+		return provautil.NewTx(msgTx)
+	}
+	otherOut := wire.NewOutPoint(&chainhash.Hash{0x01}, 0)
+
+	tests := []struct {
+		name        string
+		pkScript    []byte
+		class       txscript.ScriptClass
+		data        []byte
+		p2PubKeyAdd bool
+	}{
+		{
+			name:        "prova pubkey hash",
+			pkScript:    provaScript,
+			class:       txscript.ProvaTy,
+			data:        pkHash,
+			p2PubKeyAdd: true,
+		},
+		{
+			name:        "prova key id",
+			pkScript:    provaScript,
+			class:       txscript.ProvaTy,
+			data:        keyIDData[1:],
+			p2PubKeyAdd: true,
+		},
+		{
+			name:        "general prova pubkey hash",
+			pkScript:    generalScript,
+			class:       txscript.GeneralProvaTy,
+			data:        pkHash,
+			p2PubKeyAdd: true,
+		},
+		{
+			// Admin operations are null data scripts, so like
+			// other null data outputs, the filter matches their
+			// data without adding their outpoints for the public
+			// key only update flag.
+			name:     "admin op",
+			pkScript: adminScript,
+			class:    txscript.ProvaAdminOpTy,
+			data:     adminData,
+		},
+		{
+			name:     "null data",
+			pkScript: nullDataScript,
+			class:    txscript.NullDataTy,
+			data:     nullData,
+		},
+	}
+
+	for _, test := range tests {
+		if class := txscript.GetScriptClass(test.pkScript); class != test.class {
+			t.Fatalf("%s: script class is %v, want %v", test.name,
+				class, test.class)
+		}
+
+		flags := []wire.BloomUpdateType{wire.BloomUpdateNone,
+			wire.BloomUpdateAll, wire.BloomUpdateP2PubkeyOnly}
+		for _, flag := range flags {
+			f := bloom.NewFilter(10, 0, 0.000001, flag)
+			f.Add(test.data)
+
+			tx := newTx(otherOut, nil, threadScript, test.pkScript)
+			if !f.MatchTxAndUpdate(tx) {
+				t.Fatalf("%s: flags %v: output did not match",
+					test.name, flag)
+			}
+			spent := wire.NewOutPoint(tx.Hash(), 1)
+			wantAdded := flag == wire.BloomUpdateAll ||
+				(flag == wire.BloomUpdateP2PubkeyOnly && test.p2PubKeyAdd)
+			if f.MatchesOutPoint(spent) != wantAdded {
+				t.Fatalf("%s: flags %v: outpoint added is %v, "+
+					"want %v", test.name, flag, !wantAdded,
+					wantAdded)
+			}
+
+			// A transaction spending the matched output is only
+			// matched when its outpoint was added.
+			spendTx := newTx(spent, nil, threadScript)
+			f2 := bloom.LoadFilter(f.MsgFilterLoad())
+			if f2.MatchTxAndUpdate(spendTx) != wantAdded {
+				t.Fatalf("%s: flags %v: spending transaction "+
+					"matched is %v, want %v", test.name, flag,
+					!wantAdded, wantAdded)
+			}
+		}
+	}
+
+	// Ensure transactions are matched by the public keys in their
+	// signature scripts and by their hash, but not by unrelated data.
+	sigScript, err := txscript.NewScriptBuilder().AddData(pubKey).
+		AddData(bytes.Repeat([]byte{0x30}, 71)).Script()
+	if err != nil {
+		t.Fatalf("signature script: unexpected error: %v", err)
+	}
+	tx := newTx(otherOut, sigScript, threadScript)
+	f := bloom.NewFilter(10, 0, 0.000001, wire.BloomUpdateAll)
+	if f.MatchTxAndUpdate(tx) {
+		t.Fatalf("empty filter matched transaction")
+	}
+	f.Add(pubKey)
+	if !f.MatchTxAndUpdate(tx) {
+		t.Fatalf("signature script public key did not match")
+	}
+	f = bloom.NewFilter(10, 0, 0.000001, wire.BloomUpdateAll)
+	f.AddHash(tx.Hash())
+	if !f.MatchTxAndUpdate(tx) {
+		t.Fatalf("transaction hash did not match")
+	}
+	f = bloom.NewFilter(10, 0, 0.000001, wire.BloomUpdateAll)
+	f.AddOutPoint(otherOut)
+	if !f.MatchTxAndUpdate(tx) {
+		t.Fatalf("spent outpoint did not match")
+	}
+}
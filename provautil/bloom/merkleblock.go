@@ -6,6 +6,9 @@
 package bloom
 
 import (
+	"errors"
+	"fmt"
+
 	"github.com/bitgo/prova/blockchain"
 	"github.com/bitgo/prova/chaincfg/chainhash"
 	"github.com/bitgo/prova/provautil"
@@ -80,34 +83,83 @@ func (m *merkleBlock) traverseAndBuild(height, pos uint32) {
 
 // NewMerkleBlock returns a new *wire.MsgMerkleBlock and an array of the matched
 // transaction index numbers based on the passed block and filter.
+//
+// The merkle root of a Prova block commits to the transaction hashes as well as
+// the transaction hashes including signatures.  The root of a tree is the hash
+// of the root of a sub-tree of the transaction hashes and of the root of a
+// sub-tree of the transaction hashes including signatures.  The partial merkle
+// tree is built over the former sub-tree, while the root of the latter is
+// always included as the final hash, so the merkle root in the header can be
+// verified.
 func NewMerkleBlock(block *provautil.Block, filter *Filter) (*wire.MsgMerkleBlock, []uint32) {
+	return newMerkleBlock(block, filter.MatchTxAndUpdate)
+}
+
+// NewMerkleBlockWithTxs returns a new *wire.MsgMerkleBlock and an array of the
+// matched transaction index numbers based on the passed block and transaction
+// hashes.  Unlike NewMerkleBlock, exactly the transactions with the passed
+// hashes are matched, which makes it suitable for proving the inclusion of
+// specific transactions in a block.
+func NewMerkleBlockWithTxs(block *provautil.Block, txHashes []*chainhash.Hash) (*wire.MsgMerkleBlock, []uint32) {
+	wanted := make(map[chainhash.Hash]struct{}, len(txHashes))
+	for _, hash := range txHashes {
+		wanted[*hash] = struct{}{}
+	}
+	return newMerkleBlock(block, func(tx *provautil.Tx) bool {
+		_, ok := wanted[*tx.Hash()]
+		return ok
+	})
+}
+
+// newMerkleBlock returns a new *wire.MsgMerkleBlock and an array of the matched
+// transaction index numbers based on the passed block and function which
+// determines whether a transaction is matched.
+func newMerkleBlock(block *provautil.Block, match func(tx *provautil.Tx) bool) (*wire.MsgMerkleBlock, []uint32) {
 	numTx := uint32(len(block.Transactions()))
 	mBlock := merkleBlock{
 		numTx:       numTx,
 		allHashes:   make([]*chainhash.Hash, 0, numTx),
 		matchedBits: make([]byte, 0, numTx),
 	}
+	sigBlock := merkleBlock{
+		numTx:     numTx,
+		allHashes: make([]*chainhash.Hash, 0, numTx),
+	}
 
-	// Find and keep track of any transactions that match the filter.
+	// Find and keep track of any matched transactions.
 	var matchedIndices []uint32
 	for txIndex, tx := range block.Transactions() {
-		if filter.MatchTxAndUpdate(tx) {
+		if match(tx) {
 			mBlock.matchedBits = append(mBlock.matchedBits, 0x01)
 			matchedIndices = append(matchedIndices, uint32(txIndex))
 		} else {
 			mBlock.matchedBits = append(mBlock.matchedBits, 0x00)
 		}
 		mBlock.allHashes = append(mBlock.allHashes, tx.Hash())
+		sigBlock.allHashes = append(sigBlock.allHashes, tx.HashWithSig())
 	}
 
-	// Calculate the number of merkle branches (height) in the tree.
+	// Calculate the number of merkle branches (height) in the sub-trees.
 	height := uint32(0)
 	for mBlock.calcTreeWidth(height) > 1 {
 		height++
 	}
 
-	// Build the depth-first partial merkle tree.
-	mBlock.traverseAndBuild(height, 0)
+	// Build the depth-first partial merkle tree.  The root is only a
+	// parent node when any transactions matched.  Otherwise, it is the
+	// only hash of the merkle block.
+	if len(matchedIndices) == 0 {
+		mBlock.bits = append(mBlock.bits, 0x00)
+		mBlock.finalHashes = append(mBlock.finalHashes,
+			blockchain.HashMerkleBranches(mBlock.calcHash(height, 0),
+				sigBlock.calcHash(height, 0)))
+	} else {
+		mBlock.bits = append(mBlock.bits, 0x01)
+		mBlock.traverseAndBuild(height, 0)
+		mBlock.bits = append(mBlock.bits, 0x00)
+		mBlock.finalHashes = append(mBlock.finalHashes,
+			sigBlock.calcHash(height, 0))
+	}
 
 	// Create and return the merkle block.
 	msgMerkleBlock := wire.MsgMerkleBlock{
@@ -124,3 +176,161 @@ func NewMerkleBlock(block *provautil.Block, filter *Filter) (*wire.MsgMerkleBloc
 	}
 	return &msgMerkleBlock, matchedIndices
 }
+
+// partialMerkleTree is used to house intermediate information needed to
+// extract the matched transactions from a wire.MsgMerkleBlock.
+type partialMerkleTree struct {
+	numTx      uint32
+	hashes     []*chainhash.Hash
+	flags      []byte
+	bitsUsed   uint32
+	hashesUsed uint32
+	matches    []*chainhash.Hash
+}
+
+// calcTreeWidth calculates and returns the number of nodes (width) of a merkle
+// tree at the given depth-first height.
+func (p *partialMerkleTree) calcTreeWidth(height uint32) uint32 {
+	return (p.numTx + (1 << height) - 1) >> height
+}
+
+// nextBit returns the next flag bit of the partial merkle tree.
+func (p *partialMerkleTree) nextBit() (bool, error) {
+	if p.bitsUsed >= uint32(len(p.flags))*8 {
+		return false, errors.New("merkle block does not have enough " +
+			"flag bits")
+	}
+	bit := p.flags[p.bitsUsed/8]&(1<<(p.bitsUsed%8)) != 0
+	p.bitsUsed++
+	return bit, nil
+}
+
+// nextHash returns the next hash of the partial merkle tree.
+func (p *partialMerkleTree) nextHash() (*chainhash.Hash, error) {
+	if p.hashesUsed >= uint32(len(p.hashes)) {
+		return nil, errors.New("merkle block does not have enough hashes")
+	}
+	hash := p.hashes[p.hashesUsed]
+	p.hashesUsed++
+	return hash, nil
+}
+
+// traverseAndExtract calculates the hash of a sub-tree given a depth-first
+// height and node position using a recursive depth-first approach.  Along the
+// way, it saves the hashes of the matched leaf nodes.
+func (p *partialMerkleTree) traverseAndExtract(height, pos uint32) (*chainhash.Hash, error) {
+	isParent, err := p.nextBit()
+	if err != nil {
+		return nil, err
+	}
+
+	// The hash of a leaf node or of a node which is not a parent of a
+	// matched node is included in the merkle block.
+	if height == 0 || !isParent {
+		hash, err := p.nextHash()
+		if err != nil {
+			return nil, err
+		}
+		if height == 0 && isParent {
+			p.matches = append(p.matches, hash)
+		}
+		return hash, nil
+	}
+
+	// Descend into the left child and the right child if there is one.
+	left, err := p.traverseAndExtract(height-1, pos*2)
+	if err != nil {
+		return nil, err
+	}
+	right := left
+	if pos*2+1 < p.calcTreeWidth(height-1) {
+		right, err = p.traverseAndExtract(height-1, pos*2+1)
+		if err != nil {
+			return nil, err
+		}
+
+		// Identical children are only valid when the right child is
+		// the duplicated left child, which is never encoded, so reject
+		// them to prevent the same transaction from being included
+		// multiple times.
+		if right.IsEqual(left) {
+			return nil, errors.New("merkle block has identical " +
+				"left and right children")
+		}
+	}
+	return blockchain.HashMerkleBranches(left, right), nil
+}
+
+// VerifyMerkleBlock verifies the partial merkle tree of the passed merkle block
+// as created by NewMerkleBlock against the merkle root of its header and
+// returns the hashes of the matched transactions in the order they appear in
+// the block.  An error is returned when the partial merkle tree is malformed or
+// does not commit to the merkle root of the header.
+func VerifyMerkleBlock(msg *wire.MsgMerkleBlock) ([]*chainhash.Hash, error) {
+	if msg.Transactions == 0 {
+		return nil, errors.New("merkle block does not have any " +
+			"transactions")
+	}
+
+	// There can never be more hashes than transactions in addition to the
+	// root of the sub-tree of the transaction hashes including signatures.
+	if uint32(len(msg.Hashes)) > msg.Transactions+1 {
+		return nil, fmt.Errorf("merkle block has %d hashes for %d "+
+			"transactions", len(msg.Hashes), msg.Transactions)
+	}
+
+	p := partialMerkleTree{
+		numTx:  msg.Transactions,
+		hashes: msg.Hashes,
+		flags:  msg.Flags,
+	}
+	height := uint32(0)
+	for p.calcTreeWidth(height) > 1 {
+		height++
+	}
+
+	isParent, err := p.nextBit()
+	if err != nil {
+		return nil, err
+	}
+	var root *chainhash.Hash
+	if !isParent {
+		root, err = p.nextHash()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		left, err := p.traverseAndExtract(height, 0)
+		if err != nil {
+			return nil, err
+		}
+		isParent, err = p.nextBit()
+		if err != nil {
+			return nil, err
+		}
+		if isParent {
+			return nil, errors.New("merkle block descends into the " +
+				"transaction hashes including signatures")
+		}
+		right, err := p.nextHash()
+		if err != nil {
+			return nil, err
+		}
+		root = blockchain.HashMerkleBranches(left, right)
+	}
+
+	// Ensure all hashes and flag bytes were used.
+	if p.hashesUsed != uint32(len(p.hashes)) {
+		return nil, fmt.Errorf("merkle block has %d unused hashes",
+			uint32(len(p.hashes))-p.hashesUsed)
+	}
+	if (p.bitsUsed+7)/8 != uint32(len(p.flags)) {
+		return nil, errors.New("merkle block has unused flag bytes")
+	}
+
+	if !root.IsEqual(&msg.Header.MerkleRoot) {
+		return nil, fmt.Errorf("merkle block root %v does not match "+
+			"the header merkle root %v", root, msg.Header.MerkleRoot)
+	}
+	return p.matches, nil
+}
@@ -10,6 +10,7 @@ import (
 	"encoding/hex"
 	"testing"
 
+	"github.com/bitgo/prova/blockchain"
 	"github.com/bitgo/prova/chaincfg/chainhash"
 	"github.com/bitgo/prova/provautil"
 	"github.com/bitgo/prova/provautil/bloom"
@@ -73,3 +74,195 @@ func TestMerkleBlock3(t *testing.T) {
 		return
 	}
 }
+
+// newMerkleTestBlock returns a block with the passed number of transactions
+// which have distinct hashes and hashes including signatures, along with a
+// valid merkle root.
+func newMerkleTestBlock(numTx int) *provautil.Block {
+	msgBlock := wire.MsgBlock{}
+	for i := 0; i < numTx; i++ {
+		tx := wire.NewMsgTx(1)
+		prevOut := wire.NewOutPoint(&chainhash.Hash{byte(i), 0x01}, 0)
+		tx.AddTxIn(wire.NewTxIn(prevOut, []byte{0x01, byte(i)}))
+		tx.AddTxOut(wire.NewTxOut(int64(i), nil))
+		msgBlock.AddTransaction(tx)
+	}
+	block := provautil.NewBlock(&msgBlock)
+	merkles := blockchain.BuildMerkleTreeStore(block.Transactions())
+	msgBlock.Header.MerkleRoot = *merkles[len(merkles)-1]
+	return provautil.NewBlock(&msgBlock)
+}
+
+// TestMerkleBlockRoundTrip ensures the merkle blocks created for every subset
+// of matched transactions in blocks of various sizes verify against the merkle
+// root of the header and yield the matched transactions.
+func TestMerkleBlockRoundTrip(t *testing.T) {
+	for numTx := 1; numTx <= 9; numTx++ {
+		block := newMerkleTestBlock(numTx)
+		txns := block.Transactions()
+		for subset := 0; subset < 1<<uint(numTx); subset++ {
+			f := bloom.NewFilter(uint32(numTx), 0, 0.000001,
+				wire.BloomUpdateNone)
+			var want []*chainhash.Hash
+			for i, tx := range txns {
+				if subset&(1<<uint(i)) != 0 {
+					f.AddHash(tx.Hash())
+					want = append(want, tx.Hash())
+				}
+			}
+
+			mBlock, matched := bloom.NewMerkleBlock(block, f)
+			if len(matched) < len(want) {
+				t.Fatalf("%d txns, subset %b: got %d matches, want "+
+					"at least %d", numTx, subset, len(matched),
+					len(want))
+			}
+			got, err := bloom.VerifyMerkleBlock(mBlock)
+			if err != nil {
+				t.Fatalf("%d txns, subset %b: unexpected error: %v",
+					numTx, subset, err)
+			}
+			if len(got) != len(matched) {
+				t.Fatalf("%d txns, subset %b: got %d hashes, want "+
+					"%d", numTx, subset, len(got), len(matched))
+			}
+			for i, idx := range matched {
+				if !got[i].IsEqual(txns[idx].Hash()) {
+					t.Fatalf("%d txns, subset %b: hash %d is %v, "+
+						"want %v", numTx, subset, i, got[i],
+						txns[idx].Hash())
+				}
+			}
+		}
+	}
+}
+
+// TestNewMerkleBlockWithTxs ensures the merkle blocks created for every subset
+// of transaction hashes match exactly those transactions and verify against the
+// merkle root of the header.
+func TestNewMerkleBlockWithTxs(t *testing.T) {
+	for numTx := 1; numTx <= 9; numTx++ {
+		block := newMerkleTestBlock(numTx)
+		txns := block.Transactions()
+		for subset := 0; subset < 1<<uint(numTx); subset++ {
+			var want []*chainhash.Hash
+			for i, tx := range txns {
+				if subset&(1<<uint(i)) != 0 {
+					want = append(want, tx.Hash())
+				}
+			}
+
+			mBlock, matched := bloom.NewMerkleBlockWithTxs(block, want)
+			if len(matched) != len(want) {
+				t.Fatalf("%d txns, subset %b: got %d matches, want "+
+					"%d", numTx, subset, len(matched), len(want))
+			}
+			got, err := bloom.VerifyMerkleBlock(mBlock)
+			if err != nil {
+				t.Fatalf("%d txns, subset %b: unexpected error: %v",
+					numTx, subset, err)
+			}
+			if len(got) != len(want) {
+				t.Fatalf("%d txns, subset %b: got %d hashes, want "+
+					"%d", numTx, subset, len(got), len(want))
+			}
+			for i := range want {
+				if !got[i].IsEqual(want[i]) {
+					t.Fatalf("%d txns, subset %b: hash %d is %v, "+
+						"want %v", numTx, subset, i, got[i],
+						want[i])
+				}
+			}
+		}
+	}
+}
+
+// TestVerifyMerkleBlockErrors ensures malformed merkle blocks and merkle blocks
+// which do not commit to the merkle root of the header are rejected.
+func TestVerifyMerkleBlockErrors(t *testing.T) {
+	block := newMerkleTestBlock(5)
+	f := bloom.NewFilter(1, 0, 0.000001, wire.BloomUpdateNone)
+	f.AddHash(block.Transactions()[2].Hash())
+	valid, _ := bloom.NewMerkleBlock(block, f)
+
+	// copyBlock returns a deep copy of the valid merkle block.
+	copyBlock := func() *wire.MsgMerkleBlock {
+		mBlock := *valid
+		mBlock.Hashes = make([]*chainhash.Hash, len(valid.Hashes))
+		for i, hash := range valid.Hashes {
+			h := *hash
+			mBlock.Hashes[i] = &h
+		}
+		mBlock.Flags = append([]byte(nil), valid.Flags...)
+		return &mBlock
+	}
+
+	tests := []struct {
+		name   string
+		modify func(mBlock *wire.MsgMerkleBlock)
+	}{
+		{
+			name: "no transactions",
+			modify: func(mBlock *wire.MsgMerkleBlock) {
+				mBlock.Transactions = 0
+			},
+		},
+		{
+			name: "too many hashes",
+			modify: func(mBlock *wire.MsgMerkleBlock) {
+				for len(mBlock.Hashes) <= 6 {
+					mBlock.Hashes = append(mBlock.Hashes,
+						&chainhash.Hash{})
+				}
+			},
+		},
+		{
+			name: "missing hash",
+			modify: func(mBlock *wire.MsgMerkleBlock) {
+				mBlock.Hashes = mBlock.Hashes[:len(mBlock.Hashes)-1]
+			},
+		},
+		{
+			name: "unused hash",
+			modify: func(mBlock *wire.MsgMerkleBlock) {
+				mBlock.Hashes = append(mBlock.Hashes,
+					&chainhash.Hash{})
+			},
+		},
+		{
+			name: "missing flags",
+			modify: func(mBlock *wire.MsgMerkleBlock) {
+				mBlock.Flags = nil
+			},
+		},
+		{
+			name: "unused flags",
+			modify: func(mBlock *wire.MsgMerkleBlock) {
+				mBlock.Flags = append(mBlock.Flags, 0x00)
+			},
+		},
+		{
+			name: "wrong hash",
+			modify: func(mBlock *wire.MsgMerkleBlock) {
+				mBlock.Hashes[0][0] ^= 0x01
+			},
+		},
+		{
+			name: "wrong header merkle root",
+			modify: func(mBlock *wire.MsgMerkleBlock) {
+				mBlock.Header.MerkleRoot[0] ^= 0x01
+			},
+		},
+	}
+
+	if _, err := bloom.VerifyMerkleBlock(copyBlock()); err != nil {
+		t.Fatalf("unexpected error for valid merkle block: %v", err)
+	}
+	for _, test := range tests {
+		mBlock := copyBlock()
+		test.modify(mBlock)
+		if _, err := bloom.VerifyMerkleBlock(mBlock); err == nil {
+			t.Errorf("%s: did not receive expected error", test.name)
+		}
+	}
+}
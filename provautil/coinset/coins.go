@@ -18,7 +18,6 @@ import (
 // Coin represents a spendable transaction outpoint
 type Coin interface {
 	Hash() *chainhash.Hash
-	HashWithSig() *chainhash.Hash
 	Index() uint32
 	Value() provautil.Amount
 	PkScript() []byte
@@ -127,7 +126,7 @@ func (cs *CoinSet) removeElement(e *list.Element) Coin {
 // NewMsgTxWithInputCoins takes the coins in the CoinSet and makes them
 // the inputs to a new wire.MsgTx which is returned.
 func NewMsgTxWithInputCoins(inputCoins Coins) *wire.MsgTx {
-	msgTx := wire.NewMsgTx()
+	msgTx := wire.NewMsgTx(wire.TxVersion)
 	coins := inputCoins.Coins()
 	msgTx.TxIn = make([]*wire.TxIn, len(coins))
 	for i, coin := range coins {
@@ -361,6 +360,12 @@ type SimpleCoin struct {
 var _ Coin = &SimpleCoin{}
 
 // Hash returns the hash value of the transaction on which the Coin is an output
+func (c *SimpleCoin) Hash() *chainhash.Hash {
+	return c.Tx.Hash()
+}
+
+// HashWithSig returns the hash value, including the signatures, of the
+// transaction on which the Coin is an output
 func (c *SimpleCoin) HashWithSig() *chainhash.Hash {
 	return c.Tx.HashWithSig()
 }
@@ -0,0 +1,286 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package coinset
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/txscript"
+	"github.com/bitgo/prova/wire"
+)
+
+// provaSigSize is the largest size of the data pushed by each signer of an
+// input which spends a Prova script:
+// OP_DATA_73 <sig> OP_DATA_33 <pubkey>
+const provaSigSize = 1 + 73 + 1 + 33
+
+// SpendSize returns the largest serialized size of an input spending the
+// passed script, whose signature script holds a signature and public key pair
+// for each of the signatures the script requires.  The 2-of-3 Aztec scripts of
+// standard Prova addresses are signed by the owner key and one of their two
+// key ids, so they require two pairs.
+func SpendSize(pkScript []byte, params *chaincfg.Params) (int, error) {
+	class, _, requiredSigs, err := txscript.ExtractPkScriptAddrs(pkScript,
+		params)
+	if err != nil {
+		return 0, err
+	}
+	if requiredSigs == 0 {
+		return 0, fmt.Errorf("%v scripts can not be spent", class)
+	}
+	scriptLen := requiredSigs * provaSigSize
+	emptyIn := wire.NewTxIn(&wire.OutPoint{}, nil)
+	return emptyIn.SerializeSize() - 1 +
+		wire.VarIntSerializeSize(uint64(scriptLen)) + scriptLen, nil
+}
+
+// FeeTarget describes the outputs of a transaction which a selection of coins
+// funds, along with the fee rate the transaction pays for its size.
+type FeeTarget struct {
+	// Value is the total value of the outputs of the transaction.
+	Value provautil.Amount
+
+	// BaseSize is the serialized size of the transaction without any inputs
+	// and without the change output.
+	BaseSize int
+
+	// ChangeSize is the serialized size of the change output.
+	ChangeSize int
+
+	// FeeRate is the fee rate in atoms/kB the transaction pays.
+	FeeRate provautil.Amount
+
+	// MinChange is the smallest change worth a change output, such as the
+	// dust limit of the change script.  Smaller change is left to the fee.
+	MinChange provautil.Amount
+
+	// Params defines the network the spent scripts belong to.
+	Params *chaincfg.Params
+}
+
+// FeeForSize returns the fee of a transaction with the passed serialized size
+// at the fee rate of the target.
+func (t *FeeTarget) FeeForSize(size int) provautil.Amount {
+	return t.FeeRate * provautil.Amount(size) / 1000
+}
+
+// size returns the serialized size of the transaction when it spends the
+// passed coins, without the change output.
+func (t *FeeTarget) size(coins []Coin) (int, error) {
+	size := t.BaseSize
+	for _, coin := range coins {
+		spendSize, err := SpendSize(coin.PkScript(), t.Params)
+		if err != nil {
+			return 0, err
+		}
+		size += spendSize
+	}
+	return size, nil
+}
+
+// Fee returns the fee of the transaction when it spends the passed coins,
+// including the change output when change is true.
+func (t *FeeTarget) Fee(coins []Coin, change bool) (provautil.Amount, error) {
+	size, err := t.size(coins)
+	if err != nil {
+		return 0, err
+	}
+	if change {
+		size += t.ChangeSize
+	}
+	return t.FeeForSize(size), nil
+}
+
+// TargetValue returns the total value the passed coins must have to fund the
+// outputs and the fee of the transaction without a change output.
+func (t *FeeTarget) TargetValue(coins []Coin) (provautil.Amount, error) {
+	fee, err := t.Fee(coins, false)
+	if err != nil {
+		return 0, err
+	}
+	return t.Value + fee, nil
+}
+
+// change returns the change of a transaction with the passed serialized size
+// without the change output, whose inputs have the passed total value, after
+// the fee of the change output.  It returns zero when the change is smaller
+// than the minimum change.
+func (t *FeeTarget) change(inValue provautil.Amount, size int) provautil.Amount {
+	change := inValue - t.Value - t.FeeForSize(size+t.ChangeSize)
+	if change < t.MinChange {
+		return 0
+	}
+	return change
+}
+
+// FeeCoinSelector is an interface that wraps the FeeCoinSelect method.
+//
+// FeeCoinSelect will attempt to select a subset of the coins which funds the
+// value of the target along with the fee of the transaction spending them.  It
+// returns the selected coins and the change of the transaction, which is zero
+// when the remainder is not worth a change output and is left to the fee.
+// Coins whose scripts can not be spent are never selected.
+type FeeCoinSelector interface {
+	FeeCoinSelect(target *FeeTarget, coins []Coin) (Coins, provautil.Amount, error)
+}
+
+// selectInOrder selects the passed coins in order until they fund the passed
+// target, spending at most maxInputs of them.
+func selectInOrder(target *FeeTarget, coins []Coin, maxInputs int) (Coins, provautil.Amount, error) {
+	cs := NewCoinSet(nil)
+	size := target.BaseSize
+	for _, coin := range coins {
+		if cs.Num() >= maxInputs {
+			break
+		}
+		spendSize, err := SpendSize(coin.PkScript(), target.Params)
+		if err != nil {
+			continue
+		}
+		cs.PushCoin(coin)
+		size += spendSize
+		if cs.TotalValue() >= target.Value+target.FeeForSize(size) {
+			return cs, target.change(cs.TotalValue(), size), nil
+		}
+	}
+	return nil, 0, ErrCoinsNoSelectionAvailable
+}
+
+// LargestFirstCoinSelector is a FeeCoinSelector that selects the coins with
+// the largest values first, which funds the target with as few inputs as
+// possible.
+type LargestFirstCoinSelector struct {
+	MaxInputs int
+}
+
+// FeeCoinSelect will attempt to select coins using the algorithm described
+// in the LargestFirstCoinSelector struct.
+func (s LargestFirstCoinSelector) FeeCoinSelect(target *FeeTarget, coins []Coin) (Coins, provautil.Amount, error) {
+	sortedCoins := make([]Coin, 0, len(coins))
+	sortedCoins = append(sortedCoins, coins...)
+	sort.Stable(sort.Reverse(byAmount(sortedCoins)))
+	return selectInOrder(target, sortedCoins, s.MaxInputs)
+}
+
+// RandomCoinSelector is a FeeCoinSelector that selects the coins in a random
+// order, which avoids linking the outputs of a wallet by the order they are
+// spent in.  The order is drawn from Rand, so a source with a fixed seed
+// makes the selection reproducible.  When Rand is nil, a source seeded with
+// the current time is used.
+type RandomCoinSelector struct {
+	MaxInputs int
+	Rand      *rand.Rand
+}
+
+// FeeCoinSelect will attempt to select coins using the algorithm described
+// in the RandomCoinSelector struct.
+func (s RandomCoinSelector) FeeCoinSelect(target *FeeTarget, coins []Coin) (Coins, provautil.Amount, error) {
+	r := s.Rand
+	if r == nil {
+		r = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	shuffledCoins := make([]Coin, len(coins))
+	for i, j := range r.Perm(len(coins)) {
+		shuffledCoins[i] = coins[j]
+	}
+	return selectInOrder(target, shuffledCoins, s.MaxInputs)
+}
+
+// bnbCandidate is a coin the BranchAndBoundCoinSelector may select along with
+// the size of the input spending it and its value after the fee of that input.
+type bnbCandidate struct {
+	coin      Coin
+	spendSize int
+	effValue  provautil.Amount
+}
+
+// BranchAndBoundCoinSelector is a FeeCoinSelector that searches for a
+// selection of coins which funds the target without any change worth a
+// change output, so the transaction has no change output and leaves nothing
+// to link to its inputs.  The search explores the selections of the coins
+// with the largest values after the fee of their inputs first, and gives up
+// once it visited MaxTries selections.
+//
+// It returns ErrCoinsNoSelectionAvailable when it finds no such selection, in
+// which case callers usually fall back to another FeeCoinSelector.
+type BranchAndBoundCoinSelector struct {
+	MaxInputs int
+	MaxTries  int
+}
+
+// FeeCoinSelect will attempt to select coins using the algorithm described
+// in the BranchAndBoundCoinSelector struct.
+func (s BranchAndBoundCoinSelector) FeeCoinSelect(target *FeeTarget, coins []Coin) (Coins, provautil.Amount, error) {
+	// Coins which don't pay for their own inputs never help funding the
+	// target.
+	candidates := make([]bnbCandidate, 0, len(coins))
+	for _, coin := range coins {
+		spendSize, err := SpendSize(coin.PkScript(), target.Params)
+		if err != nil {
+			continue
+		}
+		effValue := coin.Value() - target.FeeForSize(spendSize)
+		if effValue <= 0 {
+			continue
+		}
+		candidates = append(candidates, bnbCandidate{coin, spendSize,
+			effValue})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].effValue > candidates[j].effValue
+	})
+
+	// The fee of a transaction is at least the sum of the fees of its
+	// parts, so the value after the fees of the inputs of the remaining
+	// candidates bounds what they can add.
+	remaining := make([]provautil.Amount, len(candidates)+1)
+	for i := len(candidates) - 1; i >= 0; i-- {
+		remaining[i] = remaining[i+1] + candidates[i].effValue
+	}
+	minEffValue := target.Value + target.FeeForSize(target.BaseSize)
+
+	var selected []Coin
+	var tries int
+	var search func(i int, value provautil.Amount, size int, effValue provautil.Amount) bool
+	search = func(i int, value provautil.Amount, size int, effValue provautil.Amount) bool {
+		tries++
+		if tries > s.MaxTries {
+			return false
+		}
+
+		// Once the selection funds the target, adding candidates only
+		// adds change, so the selection either matches or is a dead
+		// end.
+		if value >= target.Value+target.FeeForSize(size) {
+			return target.change(value, size) == 0
+		}
+		if i == len(candidates) || len(selected) >= s.MaxInputs ||
+			effValue+remaining[i] < minEffValue {
+
+			return false
+		}
+
+		// Explore the selections including the candidate before the
+		// ones omitting it.
+		c := &candidates[i]
+		selected = append(selected, c.coin)
+		if search(i+1, value+c.coin.Value(), size+c.spendSize,
+			effValue+c.effValue) {
+
+			return true
+		}
+		selected = selected[:len(selected)-1]
+		return search(i+1, value, size, effValue)
+	}
+	if !search(0, 0, target.BaseSize, 0) {
+		return nil, 0, ErrCoinsNoSelectionAvailable
+	}
+	return NewCoinSet(selected), 0, nil
+}
@@ -0,0 +1,394 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package coinset_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/provautil/coinset"
+	"github.com/bitgo/prova/txscript"
+	"github.com/bitgo/prova/wire"
+)
+
+// Ensure that the entries of a utxo view are UtxoEntries
+var _ coinset.UtxoEntry = (*blockchain.UtxoEntry)(nil)
+
+// aztecSpendSize is the size of an input spending a 2-of-3 Aztec script: the
+// outpoint, the sequence and a signature script with two signature and public
+// key pairs.
+const aztecSpendSize = 36 + 4 + 1 + 2*(1+73+1+33)
+
+// aztecScript returns the script paying to the regression test network Aztec
+// address with the passed key hash byte.
+func aztecScript(t *testing.T, b byte) []byte {
+	pkHash := make([]byte, chainhash.Hash160Size)
+	pkHash[0] = b
+	addr, err := provautil.NewAddressProva(pkHash, []btcec.KeyID{1, 2},
+		&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("NewAddressProva: unexpected error: %v", err)
+	}
+	pkScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		t.Fatalf("PayToAddrScript: unexpected error: %v", err)
+	}
+	return pkScript
+}
+
+// utxoCoins returns the coins of the outputs of a transaction mined at the
+// passed height, which pay the passed values to the passed script.  The best
+// chain has the passed height as well.
+func utxoCoins(t *testing.T, pkScript []byte, height uint32, coinBase bool,
+	values ...int64) []*coinset.UtxoCoin {
+
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	prevOut := wire.OutPoint{Index: 1}
+	if coinBase {
+		prevOut = wire.OutPoint{Index: wire.MaxPrevOutIndex}
+	}
+	msgTx.AddTxIn(wire.NewTxIn(&prevOut, nil))
+	for _, value := range values {
+		msgTx.AddTxOut(wire.NewTxOut(value, pkScript))
+	}
+	tx := provautil.NewTx(msgTx)
+	view := blockchain.NewUtxoViewpoint()
+	view.AddTxOuts(tx, height)
+
+	utxoCoins := make([]*coinset.UtxoCoin, 0, len(values))
+	for i := range values {
+		outPoint := wire.NewOutPoint(tx.Hash(), uint32(i))
+		utxoCoins = append(utxoCoins, coinset.NewUtxoCoin(outPoint,
+			view.LookupEntry(tx.Hash()), height))
+	}
+	return utxoCoins
+}
+
+// feeTestCoins returns spendable coins of the passed values paying to an
+// Aztec script.
+func feeTestCoins(t *testing.T, values ...int64) []coinset.Coin {
+	utxoCoins := utxoCoins(t, aztecScript(t, 1), 1000, false, values...)
+	return coinset.SpendableCoins(utxoCoins, 1, &chaincfg.RegressionNetParams)
+}
+
+func TestSpendSize(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	size, err := coinset.SpendSize(aztecScript(t, 1), params)
+	if err != nil || size != aztecSpendSize {
+		t.Errorf("SpendSize: got %d (err %v) for an Aztec script, want %d",
+			size, err, aztecSpendSize)
+	}
+	threadScript, err := txscript.ProvaThreadScript(provautil.RootThread)
+	if err != nil {
+		t.Fatalf("ProvaThreadScript: unexpected error: %v", err)
+	}
+	size, err = coinset.SpendSize(threadScript, params)
+	if err != nil || size != aztecSpendSize {
+		t.Errorf("SpendSize: got %d (err %v) for an admin thread "+
+			"script, want %d", size, err, aztecSpendSize)
+	}
+	nullData, err := txscript.NullDataScript([]byte{1})
+	if err != nil {
+		t.Fatalf("NullDataScript: unexpected error: %v", err)
+	}
+	if _, err := coinset.SpendSize(nullData, params); err == nil {
+		t.Error("SpendSize: no error for a null data script")
+	}
+}
+
+// newFeeTarget returns a target of the passed value at a fee rate of 1000
+// atoms/kB.
+func newFeeTarget(value provautil.Amount) *coinset.FeeTarget {
+	return &coinset.FeeTarget{
+		Value:      value,
+		BaseSize:   60,
+		ChangeSize: 40,
+		FeeRate:    1000,
+		MinChange:  1000,
+		Params:     &chaincfg.RegressionNetParams,
+	}
+}
+
+func TestFeeTarget(t *testing.T) {
+	coins := feeTestCoins(t, 1e8, 5e7)
+	target := newFeeTarget(1e8)
+	fee, err := target.Fee(coins, false)
+	if err != nil || fee != 60+2*aztecSpendSize {
+		t.Errorf("Fee: got %v (err %v), want %d", fee, err,
+			60+2*aztecSpendSize)
+	}
+	fee, err = target.Fee(coins, true)
+	if err != nil || fee != 100+2*aztecSpendSize {
+		t.Errorf("Fee: got %v (err %v) with change, want %d", fee, err,
+			100+2*aztecSpendSize)
+	}
+	value, err := target.TargetValue(coins[:1])
+	if err != nil || value != 1e8+60+aztecSpendSize {
+		t.Errorf("TargetValue: got %v (err %v), want %v", value, err,
+			1e8+60+aztecSpendSize)
+	}
+	if _, err := target.Fee([]coinset.Coin{&TestCoin{}}, false); err == nil {
+		t.Error("Fee: no error for a coin which can not be spent")
+	}
+}
+
+type feeCoinSelectTest struct {
+	name          string
+	selector      coinset.FeeCoinSelector
+	inputCoins    []coinset.Coin
+	targetValue   provautil.Amount
+	expectedCoins []coinset.Coin
+	change        provautil.Amount
+	expectedError error
+}
+
+func testFeeCoinSelector(tests []feeCoinSelectTest, t *testing.T) {
+	for _, test := range tests {
+		target := newFeeTarget(test.targetValue)
+		cs, change, err := test.selector.FeeCoinSelect(target,
+			test.inputCoins)
+		if err != test.expectedError {
+			t.Errorf("%s: expected a different error: got=%v, "+
+				"expected=%v", test.name, err, test.expectedError)
+			continue
+		}
+		if test.expectedError != nil {
+			continue
+		}
+		coins := cs.Coins()
+		if len(coins) != len(test.expectedCoins) {
+			t.Errorf("%s: expected different number of coins: got=%d, "+
+				"expected=%d", test.name, len(coins),
+				len(test.expectedCoins))
+			continue
+		}
+		for n := range test.expectedCoins {
+			if coins[n] != test.expectedCoins[n] {
+				t.Errorf("%s: expected different coins at coin "+
+					"index %d", test.name, n)
+			}
+		}
+		if change != test.change {
+			t.Errorf("%s: got change %v, want %v", test.name, change,
+				test.change)
+		}
+
+		// The selected coins fund the outputs and the fee, with the
+		// change output when there is change.
+		fee, err := target.Fee(coins, change != 0)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		totalValue := coinset.NewCoinSet(coins).TotalValue()
+		if totalValue < test.targetValue+fee+change ||
+			change != 0 && totalValue != test.targetValue+fee+change {
+
+			t.Errorf("%s: coins of %v do not fund the target of %v "+
+				"with fee %v and change %v", test.name, totalValue,
+				test.targetValue, fee, change)
+		}
+	}
+}
+
+func TestLargestFirstSelector(t *testing.T) {
+	coins := feeTestCoins(t, 1e5, 3e8, 2e8, 200)
+	selector := coinset.LargestFirstCoinSelector{MaxInputs: 10}
+	oneInputFee := provautil.Amount(60 + aztecSpendSize)
+	tests := []feeCoinSelectTest{
+		{
+			name:          "largest coin",
+			selector:      selector,
+			inputCoins:    coins,
+			targetValue:   1e8,
+			expectedCoins: []coinset.Coin{coins[1]},
+			change:        2e8 - oneInputFee - 40,
+		},
+		{
+			name:          "several coins",
+			selector:      selector,
+			inputCoins:    coins,
+			targetValue:   4e8,
+			expectedCoins: []coinset.Coin{coins[1], coins[2]},
+			change:        1e8 - oneInputFee - aztecSpendSize - 40,
+		},
+		{
+			name:          "exact match",
+			selector:      selector,
+			inputCoins:    coins,
+			targetValue:   3e8 - oneInputFee,
+			expectedCoins: []coinset.Coin{coins[1]},
+		},
+		{
+			name:          "dust change",
+			selector:      selector,
+			inputCoins:    coins,
+			targetValue:   3e8 - oneInputFee - 1039,
+			expectedCoins: []coinset.Coin{coins[1]},
+		},
+		{
+			name:          "smallest change",
+			selector:      selector,
+			inputCoins:    coins,
+			targetValue:   3e8 - oneInputFee - 1040,
+			expectedCoins: []coinset.Coin{coins[1]},
+			change:        1000,
+		},
+		{
+			name:          "insufficient funds",
+			selector:      selector,
+			inputCoins:    coins,
+			targetValue:   6e8,
+			expectedError: coinset.ErrCoinsNoSelectionAvailable,
+		},
+		{
+			name:          "too many inputs",
+			selector:      coinset.LargestFirstCoinSelector{MaxInputs: 1},
+			inputCoins:    coins,
+			targetValue:   4e8,
+			expectedError: coinset.ErrCoinsNoSelectionAvailable,
+		},
+		{
+			name:          "no coins",
+			selector:      selector,
+			targetValue:   1,
+			expectedError: coinset.ErrCoinsNoSelectionAvailable,
+		},
+	}
+	testFeeCoinSelector(tests, t)
+}
+
+func TestBranchAndBoundSelector(t *testing.T) {
+	coins := feeTestCoins(t, 1e8, 5e7, 3e7, 2e7, 200)
+	selector := coinset.BranchAndBoundCoinSelector{
+		MaxInputs: 10,
+		MaxTries:  1000,
+	}
+	twoInputsFee := provautil.Amount(60 + 2*aztecSpendSize)
+	tests := []feeCoinSelectTest{
+		{
+			name:          "changeless match",
+			selector:      selector,
+			inputCoins:    coins,
+			targetValue:   7e7 - twoInputsFee,
+			expectedCoins: []coinset.Coin{coins[1], coins[3]},
+		},
+		{
+			name:          "match with dust excess",
+			selector:      selector,
+			inputCoins:    coins,
+			targetValue:   7e7 - twoInputsFee - 1039,
+			expectedCoins: []coinset.Coin{coins[1], coins[3]},
+		},
+		{
+			name:          "excess worth change",
+			selector:      selector,
+			inputCoins:    coins,
+			targetValue:   7e7 - twoInputsFee - 1040,
+			expectedError: coinset.ErrCoinsNoSelectionAvailable,
+		},
+		{
+			name:          "no match",
+			selector:      selector,
+			inputCoins:    coins,
+			targetValue:   6e7,
+			expectedError: coinset.ErrCoinsNoSelectionAvailable,
+		},
+		{
+			name:          "insufficient funds",
+			selector:      selector,
+			inputCoins:    coins,
+			targetValue:   3e8,
+			expectedError: coinset.ErrCoinsNoSelectionAvailable,
+		},
+		{
+			name: "too many tries",
+			selector: coinset.BranchAndBoundCoinSelector{
+				MaxInputs: 10,
+				MaxTries:  3,
+			},
+			inputCoins:    coins,
+			targetValue:   7e7 - twoInputsFee,
+			expectedError: coinset.ErrCoinsNoSelectionAvailable,
+		},
+		{
+			name: "too many inputs",
+			selector: coinset.BranchAndBoundCoinSelector{
+				MaxInputs: 1,
+				MaxTries:  1000,
+			},
+			inputCoins:    coins,
+			targetValue:   7e7 - twoInputsFee,
+			expectedError: coinset.ErrCoinsNoSelectionAvailable,
+		},
+	}
+	testFeeCoinSelector(tests, t)
+}
+
+func TestRandomSelector(t *testing.T) {
+	coins := feeTestCoins(t, 1e8, 5e7, 3e7, 2e7, 1e7)
+	target := newFeeTarget(1.5e8)
+
+	// Selectors drawing from sources with the same seed select the same
+	// coins.
+	var selections [2][]coinset.Coin
+	for i := range selections {
+		selector := coinset.RandomCoinSelector{
+			MaxInputs: 10,
+			Rand:      rand.New(rand.NewSource(1)),
+		}
+		cs, _, err := selector.FeeCoinSelect(target, coins)
+		if err != nil {
+			t.Fatalf("FeeCoinSelect: unexpected error: %v", err)
+		}
+		selections[i] = cs.Coins()
+	}
+	if len(selections[0]) != len(selections[1]) {
+		t.Fatalf("FeeCoinSelect: selected %d and %d coins with the same "+
+			"seed", len(selections[0]), len(selections[1]))
+	}
+	for i := range selections[0] {
+		if selections[0][i] != selections[1][i] {
+			t.Fatal("FeeCoinSelect: selected different coins with " +
+				"the same seed")
+		}
+	}
+
+	tests := []feeCoinSelectTest{
+		{
+			name: "seeded selection",
+			selector: coinset.RandomCoinSelector{
+				MaxInputs: 10,
+				Rand:      rand.New(rand.NewSource(1)),
+			},
+			inputCoins:    coins,
+			targetValue:   1.5e8,
+			expectedCoins: selections[0],
+			change: coinset.NewCoinSet(selections[0]).TotalValue() -
+				1.5e8 - provautil.Amount(100+len(selections[0])*
+				aztecSpendSize),
+		},
+		{
+			name:          "exact match",
+			selector:      coinset.RandomCoinSelector{MaxInputs: 10},
+			inputCoins:    coins[:1],
+			targetValue:   1e8 - 60 - aztecSpendSize,
+			expectedCoins: coins[:1],
+		},
+		{
+			name:          "insufficient funds",
+			selector:      coinset.RandomCoinSelector{MaxInputs: 10},
+			inputCoins:    coins,
+			targetValue:   3e8,
+			expectedError: coinset.ErrCoinsNoSelectionAvailable,
+		},
+	}
+	testFeeCoinSelector(tests, t)
+}
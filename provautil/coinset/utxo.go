@@ -0,0 +1,109 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package coinset
+
+import (
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/wire"
+)
+
+// UtxoEntry is the interface of the entries of a utxo view which a UtxoCoin
+// reads its output from.  It is satisfied by the entries of a
+// blockchain.UtxoViewpoint.
+type UtxoEntry interface {
+	IsCoinBase() bool
+	BlockHeight() uint32
+	IsOutputSpent(outputIndex uint32) bool
+	AmountByIndex(outputIndex uint32) int64
+	PkScriptByIndex(outputIndex uint32) []byte
+}
+
+// UtxoCoin defines a concrete instance of Coin that is backed by an unspent
+// output of a utxo entry, and the number of confirmations the transaction of
+// the entry has had.
+type UtxoCoin struct {
+	OutPoint   wire.OutPoint
+	Entry      UtxoEntry
+	TxNumConfs int64
+}
+
+// Ensure that UtxoCoin is a Coin
+var _ Coin = &UtxoCoin{}
+
+// NewUtxoCoin returns the coin of the passed output of a utxo entry, with the
+// number of confirmations the entry has had when the best chain has the passed
+// height.  Entries of transactions which are not mined have no confirmations.
+// It returns nil when the output is spent or does not exist.
+func NewUtxoCoin(outPoint *wire.OutPoint, entry UtxoEntry, bestHeight uint32) *UtxoCoin {
+	if entry == nil || entry.IsOutputSpent(outPoint.Index) {
+		return nil
+	}
+	var numConfs int64
+	if blockHeight := entry.BlockHeight(); blockHeight <= bestHeight {
+		numConfs = int64(bestHeight-blockHeight) + 1
+	}
+	return &UtxoCoin{
+		OutPoint:   *outPoint,
+		Entry:      entry,
+		TxNumConfs: numConfs,
+	}
+}
+
+// Hash returns the hash value of the transaction on which the Coin is an output
+func (c *UtxoCoin) Hash() *chainhash.Hash {
+	return &c.OutPoint.Hash
+}
+
+// Index returns the index of the output on the transaction which the Coin represents
+func (c *UtxoCoin) Index() uint32 {
+	return c.OutPoint.Index
+}
+
+// Value returns the value of the Coin
+func (c *UtxoCoin) Value() provautil.Amount {
+	return provautil.Amount(c.Entry.AmountByIndex(c.OutPoint.Index))
+}
+
+// PkScript returns the outpoint script of the Coin.
+func (c *UtxoCoin) PkScript() []byte {
+	return c.Entry.PkScriptByIndex(c.OutPoint.Index)
+}
+
+// NumConfs returns the number of confirmations that the transaction the Coin references
+// has had.
+func (c *UtxoCoin) NumConfs() int64 {
+	return c.TxNumConfs
+}
+
+// ValueAge returns the product of the value and the number of confirmations.  This is
+// used as an input to calculate the priority of the transaction.
+func (c *UtxoCoin) ValueAge() int64 {
+	return c.TxNumConfs * int64(c.Value())
+}
+
+// IsSpendable returns whether the Coin can be spent by a transaction of the
+// next block with at least minConf confirmations.  Coinbase outputs also need
+// the coinbase maturity of the passed network.
+func (c *UtxoCoin) IsSpendable(minConf int64, params *chaincfg.Params) bool {
+	if c.TxNumConfs < minConf {
+		return false
+	}
+	return !c.Entry.IsCoinBase() ||
+		c.TxNumConfs >= int64(params.CoinbaseMaturity)
+}
+
+// SpendableCoins returns the coins of the passed UtxoCoins which can be spent
+// by a transaction of the next block with at least minConf confirmations.
+func SpendableCoins(utxoCoins []*UtxoCoin, minConf int64, params *chaincfg.Params) []Coin {
+	coins := make([]Coin, 0, len(utxoCoins))
+	for _, c := range utxoCoins {
+		if c != nil && c.IsSpendable(minConf, params) {
+			coins = append(coins, c)
+		}
+	}
+	return coins
+}
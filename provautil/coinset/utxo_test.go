@@ -0,0 +1,107 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package coinset_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/provautil/coinset"
+	"github.com/bitgo/prova/wire"
+)
+
+func TestUtxoCoin(t *testing.T) {
+	pkScript := aztecScript(t, 1)
+	utxoCoins := utxoCoins(t, pkScript, 100, false, 1e8, 5e7)
+	c := utxoCoins[1]
+	if c.Index() != 1 || c.Value() != 5e7 || c.NumConfs() != 1 ||
+		c.ValueAge() != 5e7 || !bytes.Equal(c.PkScript(), pkScript) {
+
+		t.Errorf("unexpected coin %+v", c)
+	}
+	if !c.Hash().IsEqual(utxoCoins[0].Hash()) {
+		t.Errorf("coins of the same transaction have different hashes")
+	}
+
+	// Spent outputs, outputs which don't exist and missing entries have no
+	// coins.
+	entry := c.Entry.(*blockchain.UtxoEntry)
+	entry.SpendOutput(1)
+	if coinset.NewUtxoCoin(&c.OutPoint, entry, 100) != nil {
+		t.Errorf("NewUtxoCoin: coin of a spent output")
+	}
+	outPoint := wire.NewOutPoint(c.Hash(), 2)
+	if coinset.NewUtxoCoin(outPoint, entry, 100) != nil {
+		t.Errorf("NewUtxoCoin: coin of an output which doesn't exist")
+	}
+	if coinset.NewUtxoCoin(outPoint, nil, 100) != nil {
+		t.Errorf("NewUtxoCoin: coin of a missing entry")
+	}
+
+	// Transactions which are not mined have no confirmations.
+	unmined := coinset.NewUtxoCoin(&utxoCoins[0].OutPoint, entry, 99)
+	if unmined == nil || unmined.NumConfs() != 0 {
+		t.Errorf("NewUtxoCoin: unexpected coin of an unmined "+
+			"transaction %+v", unmined)
+	}
+}
+
+func TestSpendableCoins(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	maturity := int64(params.CoinbaseMaturity)
+	pkScript := aztecScript(t, 1)
+	coinbase := utxoCoins(t, pkScript, 100, true, 1e8)[0]
+	regular := utxoCoins(t, pkScript, 100, false, 1e8)[0]
+
+	tests := []struct {
+		name      string
+		coin      *coinset.UtxoCoin
+		numConfs  int64
+		minConf   int64
+		spendable bool
+	}{
+		{"unconfirmed", regular, 0, 0, true},
+		{"unconfirmed with min conf", regular, 0, 1, false},
+		{"confirmed", regular, 6, 6, true},
+		{"confirmed below min conf", regular, 5, 6, false},
+		{"immature coinbase", coinbase, maturity - 1, 1, false},
+		{"mature coinbase", coinbase, maturity, 1, true},
+		{"mature coinbase below min conf", coinbase, maturity,
+			maturity + 1, false},
+	}
+	for _, test := range tests {
+		test.coin.TxNumConfs = test.numConfs
+		if got := test.coin.IsSpendable(test.minConf, params); got != test.spendable {
+			t.Errorf("%s: got spendable %v, want %v", test.name, got,
+				test.spendable)
+		}
+		coins := coinset.SpendableCoins([]*coinset.UtxoCoin{test.coin, nil},
+			test.minConf, params)
+		if len(coins) != 0 != test.spendable {
+			t.Errorf("%s: SpendableCoins returned %d coins", test.name,
+				len(coins))
+		}
+	}
+
+	// Selecting from the spendable coins never spends immature coinbase
+	// outputs.
+	coinbase.TxNumConfs = maturity - 1
+	regular.TxNumConfs = 1
+	coins := coinset.SpendableCoins([]*coinset.UtxoCoin{coinbase, regular},
+		1, params)
+	target := newFeeTarget(provautil.Amount(5e7))
+	cs, _, err := coinset.LargestFirstCoinSelector{MaxInputs: 10}.
+		FeeCoinSelect(target, coins)
+	if err != nil {
+		t.Fatalf("FeeCoinSelect: unexpected error: %v", err)
+	}
+	if selected := cs.Coins(); len(selected) != 1 || selected[0] != regular {
+		t.Errorf("FeeCoinSelect: selected %v, want the mature coin",
+			selected)
+	}
+}
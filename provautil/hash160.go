@@ -6,19 +6,14 @@
 package provautil
 
 import (
-	"hash"
-
-	"github.com/btcsuite/fastsha256"
-	"github.com/btcsuite/golangcrypto/ripemd160"
+	"github.com/bitgo/prova/chaincfg/chainhash"
 )
 
-// Calculate the hash of hasher over buf.
-func calcHash(buf []byte, hasher hash.Hash) []byte {
-	hasher.Write(buf)
-	return hasher.Sum(nil)
-}
-
 // Hash160 calculates the hash ripemd160(sha256(b)).
+//
+// The hash is returned as a byte slice for existing callers.  New code should
+// use chainhash.Hash160Sum instead, which returns a chainhash.Hash160.
 func Hash160(buf []byte) []byte {
-	return calcHash(calcHash(buf, fastsha256.New()), ripemd160.New())
+	hash := chainhash.Hash160Sum(buf)
+	return hash[:]
 }
@@ -0,0 +1,120 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package hdkeychain
+
+// References:
+//   [BIP44]: BIP0044 - Multi-Account Hierarchy for Deterministic Wallets
+//   https://github.com/bitcoin/bips/blob/master/bip-0044.mediawiki
+
+import (
+	"errors"
+
+	"github.com/bitgo/prova/chaincfg"
+)
+
+const (
+	// BIP44Purpose is the purpose level index of the [BIP44] layout.  It
+	// is derived hardened.
+	BIP44Purpose = 44
+
+	// ExternalBranch is the change level index of the [BIP44] layout for
+	// the addresses which are handed out to receive payments.
+	ExternalBranch = 0
+
+	// InternalBranch is the change level index of the [BIP44] layout for
+	// the addresses which receive change.
+	InternalBranch = 1
+
+	// bip44AccountDepth is the depth of the account extended keys in the
+	// [BIP44] layout m/purpose'/coin_type'/account'.
+	bip44AccountDepth = 3
+)
+
+var (
+	// ErrWrongNetwork describes an error in which the caller attempted to
+	// derive keys for a network other than the one the extended key is
+	// associated with.
+	ErrWrongNetwork = errors.New("the extended key is not associated " +
+		"with the passed network")
+
+	// ErrNotMasterKey describes an error in which the caller attempted to
+	// derive a [BIP44] account from an extended key which is not a master
+	// node.
+	ErrNotMasterKey = errors.New("the extended key is not a master node")
+
+	// ErrNotAccountKey describes an error in which the caller attempted to
+	// derive a [BIP44] address key from an extended key which is not an
+	// account extended key.
+	ErrNotAccountKey = errors.New("the extended key is not a BIP0044 " +
+		"account extended key")
+
+	// ErrInvalidPathIndex describes an error in which an index passed for
+	// a level of the [BIP44] layout is out of range, such as a change
+	// index other than ExternalBranch and InternalBranch or an account or
+	// address index at or above HardenedKeyStart.
+	ErrInvalidPathIndex = errors.New("index out of range for the BIP0044 " +
+		"path level")
+)
+
+// DeriveBIP44Account returns the private account extended key at the path
+// m/44'/coin_type'/account' of the [BIP44] layout, where the coin type is the
+// HDCoinType of the passed network.  The passed account index is derived
+// hardened, so it must be less than HardenedKeyStart.
+//
+// The master node must be a private extended key associated with the passed
+// network, or ErrWrongNetwork is returned.  The returned key carries the
+// extended key version bytes of the passed network.
+func DeriveBIP44Account(master *ExtendedKey, params *chaincfg.Params, account uint32) (*ExtendedKey, error) {
+	if !master.IsPrivate() {
+		return nil, ErrNotPrivExtKey
+	}
+	if master.depth != 0 {
+		return nil, ErrNotMasterKey
+	}
+	if !master.IsForNet(params) {
+		return nil, ErrWrongNetwork
+	}
+	if account >= HardenedKeyStart {
+		return nil, ErrInvalidPathIndex
+	}
+
+	key := master
+	for _, i := range []uint32{BIP44Purpose, params.HDCoinType, account} {
+		var err error
+		key, err = key.Child(HardenedKeyStart + i)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+// DeriveAddressKey returns the extended key at the path change/index below the
+// passed [BIP44] account extended key.  The change index must be either
+// ExternalBranch or InternalBranch, and the address index must be less than
+// HardenedKeyStart since both levels are derived non-hardened.
+//
+// The account key may be a private or a public extended key, in which case the
+// returned key is a private or a public extended key respectively.  The
+// returned key carries the version bytes of the account key.
+func DeriveAddressKey(acctKey *ExtendedKey, change, index uint32) (*ExtendedKey, error) {
+	if acctKey.depth != bip44AccountDepth ||
+		acctKey.childNum < HardenedKeyStart {
+
+		return nil, ErrNotAccountKey
+	}
+	if change != ExternalBranch && change != InternalBranch {
+		return nil, ErrInvalidPathIndex
+	}
+	if index >= HardenedKeyStart {
+		return nil, ErrInvalidPathIndex
+	}
+
+	branchKey, err := acctKey.Child(change)
+	if err != nil {
+		return nil, err
+	}
+	return branchKey.Child(index)
+}
@@ -0,0 +1,232 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package hdkeychain_test
+
+// References:
+//   [BIP44]: BIP0044 - Multi-Account Hierarchy for Deterministic Wallets
+//   https://github.com/bitcoin/bips/blob/master/bip-0044.mediawiki
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/provautil/base58"
+	"github.com/bitgo/prova/provautil/hdkeychain"
+)
+
+// bip44SeedHex is the seed of the mnemonic "abandon abandon abandon abandon
+// abandon abandon abandon abandon abandon abandon abandon about" without a
+// passphrase, which the published [BIP44] wallet vectors are derived from.
+const bip44SeedHex = "5eb00bbddcf069084889a8ab9155568165f5c453ccb85e70811aaed6f6da5fc19a5ac40b389cd370d086206dec8aa6c43daea6690f20ad3d8d48b2d2ce9e38e4"
+
+// TestBIP0044Vectors ensures the account and address keys derived for mainnet
+// match the published vectors of the path m/44'/0'/0'/0/0.
+func TestBIP0044Vectors(t *testing.T) {
+	seed, _ := hex.DecodeString(bip44SeedHex)
+	master, err := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("NewMaster: unexpected error: %v", err)
+	}
+	wantMaster := "xprv9s21ZrQH143K3GJpoapnV8SFfukcVBSfeCficPSGfubmSFDxo1kuHnLisriDvSnRRuL2Qrg5ggqHKNVpxR86QEC8w35uxmGoggxtQTPvfUu"
+	if master.String() != wantMaster {
+		t.Fatalf("NewMaster: got %v, want %v", master, wantMaster)
+	}
+
+	acctKey, err := hdkeychain.DeriveBIP44Account(master,
+		&chaincfg.MainNetParams, 0)
+	if err != nil {
+		t.Fatalf("DeriveBIP44Account: unexpected error: %v", err)
+	}
+	wantPriv := "xprv9xpXFhFpqdQK3TmytPBqXtGSwS3DLjojFhTGht8gwAAii8py5X6pxeBnQ6ehJiyJ6nDjWGJfZ95WxByFXVkDxHXrqu53WCRGypk2ttuqncb"
+	wantPub := "xpub6BosfCnifzxcFwrSzQiqu2DBVTshkCXacvNsWGYJVVhhawA7d4R5WSWGFNbi8Aw6ZRc1brxMyWMzG3DSSSSoekkudhUd9yLb6qx39T9nMdj"
+	if acctKey.String() != wantPriv {
+		t.Fatalf("DeriveBIP44Account: got %v, want %v", acctKey,
+			wantPriv)
+	}
+	acctPub, err := acctKey.Neuter()
+	if err != nil {
+		t.Fatalf("Neuter: unexpected error: %v", err)
+	}
+	if acctPub.String() != wantPub {
+		t.Fatalf("Neuter: got %v, want %v", acctPub, wantPub)
+	}
+
+	// The first receiving address pays to 1LqBGSKuX5yYUonjxT5qGfpUsXKYYWeabA
+	// and derives to the same key from the private and the public account
+	// key.
+	wantHash, _, err := base58.CheckDecode("1LqBGSKuX5yYUonjxT5qGfpUsXKYYWeabA")
+	if err != nil {
+		t.Fatalf("CheckDecode: unexpected error: %v", err)
+	}
+	for _, key := range []*hdkeychain.ExtendedKey{acctKey, acctPub} {
+		addrKey, err := hdkeychain.DeriveAddressKey(key,
+			hdkeychain.ExternalBranch, 0)
+		if err != nil {
+			t.Fatalf("DeriveAddressKey: unexpected error: %v", err)
+		}
+		if addrKey.IsPrivate() != key.IsPrivate() {
+			t.Fatalf("DeriveAddressKey: private %v, want %v",
+				addrKey.IsPrivate(), key.IsPrivate())
+		}
+		pubKey, err := addrKey.ECPubKey()
+		if err != nil {
+			t.Fatalf("ECPubKey: unexpected error: %v", err)
+		}
+		pkHash := provautil.Hash160(pubKey.SerializeCompressed())
+		if !bytes.Equal(pkHash, wantHash) {
+			t.Fatalf("DeriveAddressKey: got pubkey hash %x, want %x",
+				pkHash, wantHash)
+		}
+	}
+}
+
+// TestBIP0044CoinType ensures the accounts are derived with the HD coin type of
+// the passed network and keep its extended key version bytes.
+func TestBIP0044CoinType(t *testing.T) {
+	seed, _ := hex.DecodeString(bip44SeedHex)
+	hkStart := uint32(hdkeychain.HardenedKeyStart)
+
+	tests := []struct {
+		name   string
+		net    *chaincfg.Params
+		prefix string
+	}{
+		{"mainnet", &chaincfg.MainNetParams, "xprv"},
+		{"testnet", &chaincfg.TestNetParams, "tprv"},
+		{"regtest", &chaincfg.RegressionNetParams, "tprv"},
+		{"simnet", &chaincfg.SimNetParams, "sprv"},
+	}
+	for _, test := range tests {
+		master, err := hdkeychain.NewMaster(seed, test.net)
+		if err != nil {
+			t.Fatalf("%s: NewMaster: unexpected error: %v", test.name,
+				err)
+		}
+		acctKey, err := hdkeychain.DeriveBIP44Account(master, test.net, 2)
+		if err != nil {
+			t.Fatalf("%s: DeriveBIP44Account: unexpected error: %v",
+				test.name, err)
+		}
+
+		// Derive the path m/44'/coin_type'/2' by hand.
+		want := master
+		for _, i := range []uint32{44, test.net.HDCoinType, 2} {
+			want, err = want.Child(hkStart + i)
+			if err != nil {
+				t.Fatalf("%s: Child: unexpected error: %v",
+					test.name, err)
+			}
+		}
+		if acctKey.String() != want.String() {
+			t.Errorf("%s: DeriveBIP44Account: got %v, want %v",
+				test.name, acctKey, want)
+		}
+		if !acctKey.IsForNet(test.net) ||
+			!strings.HasPrefix(acctKey.String(), test.prefix) {
+
+			t.Errorf("%s: DeriveBIP44Account: key %v not for the "+
+				"network", test.name, acctKey)
+		}
+
+		addrKey, err := hdkeychain.DeriveAddressKey(acctKey,
+			hdkeychain.InternalBranch, 7)
+		if err != nil {
+			t.Fatalf("%s: DeriveAddressKey: unexpected error: %v",
+				test.name, err)
+		}
+		for _, i := range []uint32{1, 7} {
+			want, err = want.Child(i)
+			if err != nil {
+				t.Fatalf("%s: Child: unexpected error: %v",
+					test.name, err)
+			}
+		}
+		if addrKey.String() != want.String() {
+			t.Errorf("%s: DeriveAddressKey: got %v, want %v",
+				test.name, addrKey, want)
+		}
+	}
+}
+
+// TestBIP0044Errors ensures keys of another network and paths which do not
+// follow the [BIP44] layout are rejected.
+func TestBIP0044Errors(t *testing.T) {
+	seed, _ := hex.DecodeString(bip44SeedHex)
+	hkStart := uint32(hdkeychain.HardenedKeyStart)
+	master, err := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("NewMaster: unexpected error: %v", err)
+	}
+	masterPub, err := master.Neuter()
+	if err != nil {
+		t.Fatalf("Neuter: unexpected error: %v", err)
+	}
+	child, err := master.Child(hkStart)
+	if err != nil {
+		t.Fatalf("Child: unexpected error: %v", err)
+	}
+	acctKey, err := hdkeychain.DeriveBIP44Account(master,
+		&chaincfg.MainNetParams, 0)
+	if err != nil {
+		t.Fatalf("DeriveBIP44Account: unexpected error: %v", err)
+	}
+	branchKey, err := acctKey.Child(0)
+	if err != nil {
+		t.Fatalf("Child: unexpected error: %v", err)
+	}
+
+	accountTests := []struct {
+		name    string
+		master  *hdkeychain.ExtendedKey
+		net     *chaincfg.Params
+		account uint32
+		err     error
+	}{
+		{"mainnet key for testnet", master, &chaincfg.TestNetParams, 0,
+			hdkeychain.ErrWrongNetwork},
+		{"mainnet key for simnet", master, &chaincfg.SimNetParams, 0,
+			hdkeychain.ErrWrongNetwork},
+		{"public master", masterPub, &chaincfg.MainNetParams, 0,
+			hdkeychain.ErrNotPrivExtKey},
+		{"child key", child, &chaincfg.MainNetParams, 0,
+			hdkeychain.ErrNotMasterKey},
+		{"hardened account", master, &chaincfg.MainNetParams, hkStart,
+			hdkeychain.ErrInvalidPathIndex},
+	}
+	for _, test := range accountTests {
+		_, err := hdkeychain.DeriveBIP44Account(test.master, test.net,
+			test.account)
+		if err != test.err {
+			t.Errorf("%s: DeriveBIP44Account: got error %v, want %v",
+				test.name, err, test.err)
+		}
+	}
+
+	addressTests := []struct {
+		name    string
+		acctKey *hdkeychain.ExtendedKey
+		change  uint32
+		index   uint32
+		err     error
+	}{
+		{"master key", master, 0, 0, hdkeychain.ErrNotAccountKey},
+		{"branch key", branchKey, 0, 0, hdkeychain.ErrNotAccountKey},
+		{"invalid change", acctKey, 2, 0, hdkeychain.ErrInvalidPathIndex},
+		{"hardened index", acctKey, 0, hkStart,
+			hdkeychain.ErrInvalidPathIndex},
+	}
+	for _, test := range addressTests {
+		_, err := hdkeychain.DeriveAddressKey(test.acctKey, test.change,
+			test.index)
+		if err != test.err {
+			t.Errorf("%s: DeriveAddressKey: got error %v, want %v",
+				test.name, err, test.err)
+		}
+	}
+}
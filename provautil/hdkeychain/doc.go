@@ -27,7 +27,8 @@ Transaction Signing Keys and Payment Addresses
 In order to create and sign transactions, or provide others with addresses to
 send funds to, the underlying key and address material must be accessible.  This
 package provides the ECPubKey, ECPrivKey, and Address functions for this
-purpose.
+purpose.  Since Prova addresses also commit to the key ids of the keys which
+cosign spends, Address requires them along with the network.
 
 The Master Node
 
@@ -75,11 +76,23 @@ looks like the following:
 	public key:   xpub68Gmy5EdvgibQVfPdqkBBCHxA5htiqg55crXYuXoQRKfDBFA1WEjWgP6LHhwBZeNK1VTsfTFUHCdrfp1bgwQ9xv5ski8PX9rL2dZXvgGDnw
 	private key:  xprv9uHRZZhk6KAJC1avXpDAp4MDc3sQKNxDiPvvkX8Br5ngLNv1TxvUxt4cV1rGL5hj6KCesnDYUhd7oWgT11eZG7XnxHrnYeSvkzY7d2bhkJ7
 
+BIP0044 Accounts
+
+The DeriveBIP44Account and DeriveAddressKey functions derive the account and
+address keys of the multi-account layout described by BIP0044,
+m/44'/coin_type'/account'/change/address_index, with the coin type of the
+network.  They enforce the hardened and non-hardened derivation of the levels
+and refuse master nodes associated with another network.
+
 Network
 
 Extended keys are much like normal Bitcoin addresses in that they have version
 bytes which tie them to a specific network.  The SetNet and IsForNet functions
 are provided to set and determinine which network an extended key is associated
 with.
+
+The ParseExtendedKey function identifies the network of a serialized extended
+key from its version bytes, and the CloneWithVersion function returns a copy of
+an extended key deliberately associated with another network.
 */
 package hdkeychain
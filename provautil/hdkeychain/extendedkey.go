@@ -89,6 +89,24 @@ var (
 	// key is not the expected length.
 	ErrInvalidKeyLen = errors.New("the provided serialized extended key " +
 		"length is invalid")
+
+	// ErrVersionMismatch describes an error in which the version bytes of
+	// an extended key identify a private extended key while the key is a
+	// public extended key or vice versa.
+	ErrVersionMismatch = errors.New("the extended key version does not " +
+		"match the type of the key")
+
+	// ErrInvalidMasterFingerprint describes an error in which a serialized
+	// extended key with a depth of zero, which must be a master node, has
+	// a non-zero parent fingerprint.
+	ErrInvalidMasterFingerprint = errors.New("zero depth extended key " +
+		"with a non-zero parent fingerprint")
+
+	// ErrInvalidMasterChildNum describes an error in which a serialized
+	// extended key with a depth of zero, which must be a master node, has
+	// a non-zero child number.
+	ErrInvalidMasterChildNum = errors.New("zero depth extended key with " +
+		"a non-zero child number")
 )
 
 // masterKey is the master key used along with a random seed used to generate
@@ -353,11 +371,15 @@ func (k *ExtendedKey) ECPrivKey() (*btcec.PrivateKey, error) {
 	return privKey, nil
 }
 
-// Address converts the extended key to a standard bitcoin pay-to-pubkey-hash
-// address for the passed network.
-func (k *ExtendedKey) Address(net *chaincfg.Params) (*provautil.AddressPubKeyHash, error) {
-	pkHash := provautil.Hash160(k.pubKeyBytes())
-	return provautil.NewAddressPubKeyHash(pkHash, net)
+// Address converts the extended key to a standard Prova address for the passed
+// network which pays to the public key of the extended key along with the
+// passed key ids.
+func (k *ExtendedKey) Address(keyIDs []btcec.KeyID, net *chaincfg.Params) (*provautil.AddressProva, error) {
+	pubKey, err := k.ECPubKey()
+	if err != nil {
+		return nil, err
+	}
+	return provautil.NewAddressProvaFromPubKey(pubKey, keyIDs, net)
 }
 
 // paddedAppend appends the src byte slice to dst, returning the new slice.
@@ -418,6 +440,29 @@ func (k *ExtendedKey) SetNet(net *chaincfg.Params) {
 	}
 }
 
+// CloneWithVersion returns a copy of the extended key with the passed version
+// bytes, which deliberately associates the key with another network.  The
+// version must be registered with chaincfg as a private extended key id for
+// private extended keys and as a public extended key id for public extended
+// keys, otherwise chaincfg.ErrUnknownHDKeyID or ErrVersionMismatch is returned.
+func (k *ExtendedKey) CloneWithVersion(newVersion [4]byte) (*ExtendedKey, error) {
+	_, privErr := chaincfg.HDPrivateKeyToPublicKeyID(newVersion[:])
+	_, pubErr := chaincfg.HDPublicKeyToPrivateKeyID(newVersion[:])
+	if privErr != nil && pubErr != nil {
+		return nil, chaincfg.ErrUnknownHDKeyID
+	}
+	if (k.isPrivate && privErr != nil) || (!k.isPrivate && pubErr != nil) {
+		return nil, ErrVersionMismatch
+	}
+
+	clone := newExtendedKey(append([]byte(nil), newVersion[:]...),
+		append([]byte(nil), k.key...),
+		append([]byte(nil), k.chainCode...),
+		append([]byte(nil), k.parentFP...), k.depth, k.childNum,
+		k.isPrivate)
+	return clone, nil
+}
+
 // zero sets all bytes in the passed slice to zero.  This is used to
 // explicitly clear private key material from memory.
 func zero(b []byte) {
@@ -534,6 +579,46 @@ func NewKeyFromString(key string) (*ExtendedKey, error) {
 		childNum, isPrivate), nil
 }
 
+// ParseExtendedKey returns a new extended key instance from a base58-encoded
+// extended key along with the parameters of the network its version bytes are
+// registered for with chaincfg.  Networks may share their version bytes, such
+// as testnet and regtest, in which case the network registered first is
+// returned.
+//
+// Besides the checks performed by NewKeyFromString, the version bytes must be
+// registered (chaincfg.ErrUnknownHDKeyID), match the type of the key
+// (ErrVersionMismatch), and master nodes must have a zero parent fingerprint
+// (ErrInvalidMasterFingerprint) and child number (ErrInvalidMasterChildNum).
+func ParseExtendedKey(key string) (*ExtendedKey, *chaincfg.Params, error) {
+	k, err := NewKeyFromString(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if k.depth == 0 {
+		if binary.BigEndian.Uint32(k.parentFP) != 0 {
+			return nil, nil, ErrInvalidMasterFingerprint
+		}
+		if k.childNum != 0 {
+			return nil, nil, ErrInvalidMasterChildNum
+		}
+	}
+
+	params, err := chaincfg.HDKeyIDToParams(k.version)
+	if err != nil {
+		return nil, nil, err
+	}
+	version := params.HDPublicKeyID[:]
+	if k.isPrivate {
+		version = params.HDPrivateKeyID[:]
+	}
+	if !bytes.Equal(k.version, version) {
+		return nil, nil, ErrVersionMismatch
+	}
+
+	return k, params, nil
+}
+
 // GenerateSeed returns a cryptographically secure random seed that can be used
 // as the input for the NewMaster function to generate a new master node.
 //
@@ -16,7 +16,10 @@ import (
 	"reflect"
 	"testing"
 
+	"github.com/bitgo/prova/btcec"
 	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/provautil/base58"
 	"github.com/bitgo/prova/provautil/hdkeychain"
 )
 
@@ -533,6 +536,7 @@ func TestGenenerateSeed(t *testing.T) {
 
 // TestExtendedKeyAPI ensures the API on the ExtendedKey type works as intended.
 func TestExtendedKeyAPI(t *testing.T) {
+	keyIDs := []btcec.KeyID{1, 2}
 	tests := []struct {
 		name       string
 		extKey     string
@@ -624,16 +628,27 @@ func TestExtendedKeyAPI(t *testing.T) {
 			continue
 		}
 
-		addr, err := key.Address(&chaincfg.MainNetParams)
+		// The vectors are bitcoin pay-to-pubkey-hash addresses, so
+		// ensure the Prova address pays to the same pubkey hash.
+		addr, err := key.Address(keyIDs, &chaincfg.MainNetParams)
 		if err != nil {
 			t.Errorf("Address #%d (%s): unexpected error: %v", i,
 				test.name, err)
 			continue
 		}
-		if addr.EncodeAddress() != test.address {
+		wantHash, _, err := base58.CheckDecode(test.address)
+		if err != nil {
+			t.Errorf("CheckDecode #%d (%s): unexpected error: %v",
+				i, test.name, err)
+			continue
+		}
+		if !bytes.Equal(addr.ScriptAddress(), wantHash) ||
+			!reflect.DeepEqual(addr.ScriptKeyIDs(), keyIDs) ||
+			!addr.IsForNet(&chaincfg.MainNetParams) {
+
 			t.Errorf("Address #%d (%s): mismatched address -- want "+
-				"%s, got %s", i, test.name, test.address,
-				addr.EncodeAddress())
+				"hash %x and key ids %v, got %v", i, test.name,
+				wantHash, keyIDs, addr)
 			continue
 		}
 	}
@@ -938,17 +953,10 @@ func TestZero(t *testing.T) {
 			return false
 		}
 
-		wantAddr := "1HT7xU2Ngenf7D4yocz2SAcnNLW7rK8d4E"
-		addr, err := key.Address(&chaincfg.MainNetParams)
-		if err != nil {
-			t.Errorf("Addres s #%d (%s): unexpected error: %v", i,
-				testName, err)
-			return false
-		}
-		if addr.EncodeAddress() != wantAddr {
-			t.Errorf("Address #%d (%s): mismatched address -- want "+
-				"%s, got %s", i, testName, wantAddr,
-				addr.EncodeAddress())
+		_, err = key.Address([]btcec.KeyID{1, 2}, &chaincfg.MainNetParams)
+		if !reflect.DeepEqual(err, wantErr) {
+			t.Errorf("Address #%d (%s): mismatched error: want "+
+				"%v, got %v", i, testName, wantErr, err)
 			return false
 		}
 
@@ -1014,3 +1022,182 @@ func TestZero(t *testing.T) {
 		}
 	}
 }
+
+// reserialize returns the passed base58-encoded extended key after applying
+// the passed function to its serialized payload, with the checksum updated.
+func reserialize(t *testing.T, key string, modify func(payload []byte)) string {
+	decoded := base58.Decode(key)
+	if len(decoded) != 82 {
+		t.Fatalf("reserialize: invalid key %s", key)
+	}
+	payload := decoded[:78]
+	modify(payload)
+	checkSum := chainhash.DoubleHashB(payload)[:4]
+	return base58.Encode(append(payload, checkSum...))
+}
+
+// TestParseExtendedKey ensures extended keys of every registered network are
+// parsed along with their network, and keys with inconsistent fields are
+// rejected with specific errors.
+func TestParseExtendedKey(t *testing.T) {
+	seed := bytes.Repeat([]byte{0x2a}, hdkeychain.RecommendedSeedLen)
+	nets := []*chaincfg.Params{&chaincfg.MainNetParams,
+		&chaincfg.TestNetParams, &chaincfg.RegressionNetParams,
+		&chaincfg.SimNetParams}
+
+	for _, net := range nets {
+		master, err := hdkeychain.NewMaster(seed, net)
+		if err != nil {
+			t.Fatalf("%s: NewMaster: unexpected error: %v", net.Name,
+				err)
+		}
+		child, err := master.Child(hdkeychain.HardenedKeyStart + 1)
+		if err != nil {
+			t.Fatalf("%s: Child: unexpected error: %v", net.Name, err)
+		}
+		childPub, err := child.Neuter()
+		if err != nil {
+			t.Fatalf("%s: Neuter: unexpected error: %v", net.Name, err)
+		}
+
+		for _, key := range []*hdkeychain.ExtendedKey{master, child,
+			childPub} {
+
+			parsed, params, err := hdkeychain.ParseExtendedKey(key.String())
+			if err != nil {
+				t.Errorf("%s: ParseExtendedKey(%v): unexpected "+
+					"error: %v", net.Name, key, err)
+				continue
+			}
+			if parsed.String() != key.String() {
+				t.Errorf("%s: ParseExtendedKey: got key %v, want %v",
+					net.Name, parsed, key)
+			}
+
+			// Testnet and regtest share their version bytes, so
+			// only the version bytes of the network can be
+			// compared.
+			if params.HDPrivateKeyID != net.HDPrivateKeyID ||
+				params.HDPublicKeyID != net.HDPublicKeyID ||
+				!parsed.IsForNet(net) {
+
+				t.Errorf("%s: ParseExtendedKey(%v): got network %v",
+					net.Name, key, params.Name)
+			}
+		}
+	}
+
+	master, err := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("NewMaster: unexpected error: %v", err)
+	}
+	xprv := master.String()
+
+	tests := []struct {
+		name string
+		key  string
+		err  error
+	}{
+		{
+			name: "corrupted serialization",
+			key:  xprv[:40] + string(xprv[41]) + string(xprv[40]) + xprv[42:],
+			err:  hdkeychain.ErrBadChecksum,
+		},
+		{
+			name: "truncated serialization",
+			key:  xprv[:len(xprv)-1],
+			err:  hdkeychain.ErrInvalidKeyLen,
+		},
+		{
+			name: "zero depth with parent fingerprint",
+			key: reserialize(t, xprv, func(payload []byte) {
+				payload[8] = 0x01
+			}),
+			err: hdkeychain.ErrInvalidMasterFingerprint,
+		},
+		{
+			name: "zero depth with child number",
+			key: reserialize(t, xprv, func(payload []byte) {
+				payload[12] = 0x01
+			}),
+			err: hdkeychain.ErrInvalidMasterChildNum,
+		},
+		{
+			name: "unknown version",
+			key: reserialize(t, xprv, func(payload []byte) {
+				copy(payload, []byte{0xff, 0xff, 0xff, 0xff})
+			}),
+			err: chaincfg.ErrUnknownHDKeyID,
+		},
+		{
+			name: "private key with public version",
+			key: reserialize(t, xprv, func(payload []byte) {
+				copy(payload, chaincfg.MainNetParams.HDPublicKeyID[:])
+			}),
+			err: hdkeychain.ErrVersionMismatch,
+		},
+	}
+	for _, test := range tests {
+		_, _, err := hdkeychain.ParseExtendedKey(test.key)
+		if err != test.err {
+			t.Errorf("%s: ParseExtendedKey: got error %v, want %v",
+				test.name, err, test.err)
+		}
+	}
+}
+
+// TestCloneWithVersion ensures extended keys are re-tagged with registered
+// version bytes of the matching type without modifying the original key.
+func TestCloneWithVersion(t *testing.T) {
+	// The private and public extended keys of test vector 1 chain m of
+	// [BIP32] on mainnet and regtest.
+	xprv := "xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiChkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi"
+	tprv := "tprv8ZgxMBicQKsPeDgjzdC36fs6bMjGApWDNLR9erAXMs5skhMv36j9MV5ecvfavji5khqjWaWSFhN3YcCUUdiKH6isR4Pwy3U5y5egddBr16m"
+	xpub := "xpub661MyMwAqRbcFtXgS5sYJABqqG9YLmC4Q1Rdap9gSE8NqtwybGhePY2gZ29ESFjqJoCu1Rupje8YtGqsefD265TMg7usUDFdp6W1EGMcet8"
+	tpub := "tpubD6NzVbkrYhZ4XgiXtGrdW5XDAPFCL9h7we1vwNCpn8tGbBcgfVYjXyhWo4E1xkh56hjod1RhGjxbaTLV3X4FyWuejifB9jusQ46QzG87VKp"
+	regtest := &chaincfg.RegressionNetParams
+
+	tests := []struct {
+		name    string
+		key     string
+		version [4]byte
+		want    string
+		err     error
+	}{
+		{"private", xprv, regtest.HDPrivateKeyID, tprv, nil},
+		{"public", xpub, regtest.HDPublicKeyID, tpub, nil},
+		{"private with public version", xprv, regtest.HDPublicKeyID, "",
+			hdkeychain.ErrVersionMismatch},
+		{"public with private version", xpub, regtest.HDPrivateKeyID, "",
+			hdkeychain.ErrVersionMismatch},
+		{"unknown version", xprv, [4]byte{0xff, 0xff, 0xff, 0xff}, "",
+			chaincfg.ErrUnknownHDKeyID},
+	}
+	for _, test := range tests {
+		key, err := hdkeychain.NewKeyFromString(test.key)
+		if err != nil {
+			t.Fatalf("%s: NewKeyFromString: unexpected error: %v",
+				test.name, err)
+		}
+		clone, err := key.CloneWithVersion(test.version)
+		if err != test.err {
+			t.Errorf("%s: CloneWithVersion: got error %v, want %v",
+				test.name, err, test.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if clone.String() != test.want {
+			t.Errorf("%s: CloneWithVersion: got %v, want %v",
+				test.name, clone, test.want)
+		}
+
+		// Zeroing the clone must leave the original key intact.
+		clone.Zero()
+		if key.String() != test.key {
+			t.Errorf("%s: CloneWithVersion: original key modified",
+				test.name)
+		}
+	}
+}
@@ -7,26 +7,44 @@ package provautil
 
 import (
 	"bytes"
+	"encoding/hex"
+	"errors"
 	"io"
+	"sync"
 
 	"github.com/bitgo/prova/chaincfg/chainhash"
 	"github.com/bitgo/prova/wire"
 )
 
+// ErrTrailingData describes an error where a transaction or block can not be
+// created from serialized bytes since they contain data beyond the end of the
+// serialized structure.
+var ErrTrailingData = errors.New("trailing data after the serialized structure")
+
 // TxIndexUnknown is the value returned for a transaction index that is unknown.
 // This is typically because the transaction has not been inserted into a block
 // yet.
 const TxIndexUnknown = -1
 
 // Tx defines a bitcoin transaction that provides easier and more efficient
-// manipulation of raw transactions.  It also memoizes the hash for the
-// transaction on its first access so subsequent accesses don't have to repeat
-// the relatively expensive hashing operations.
+// manipulation of raw transactions.  It also memoizes the hashes and the
+// serialized size of the transaction on their first access so subsequent
+// accesses don't have to repeat the relatively expensive hashing and
+// serialization operations.  The memoized values are safe for concurrent
+// access.
+//
+// The underlying wire.MsgTx is treated as immutable once it is wrapped, so
+// the memoized values are never invalidated.  Callers which need to modify
+// the transaction must work on a Copy instead.
 type Tx struct {
-	msgTx         *wire.MsgTx     // Underlying MsgTx
-	txHash        *chainhash.Hash // Cached transaction hash
-	TxHashWithSig *chainhash.Hash // Cached tx-over-sig hash
-	txIndex       int             // Position within a block or TxIndexUnknown
+	msgTx             *wire.MsgTx    // Underlying MsgTx
+	txHash            chainhash.Hash // Cached transaction hash
+	txHashOnce        sync.Once      // Guards txHash
+	txHashWithSig     chainhash.Hash // Cached tx-over-sig hash
+	txHashWithSigOnce sync.Once      // Guards txHashWithSig
+	serializeSize     int            // Cached serialized size
+	serializeOnce     sync.Once      // Guards serializeSize
+	txIndex           int            // Position within a block or TxIndexUnknown
 }
 
 // IsCoinbase returns whether the transaction is a coinbase transaction.
@@ -35,37 +53,63 @@ func (t *Tx) IsCoinbase() bool {
 }
 
 // MsgTx returns the underlying wire.MsgTx for the transaction.
+//
+// The returned transaction MUST NOT be modified since the hashes and size
+// of the transaction are memoized.  Use Copy to obtain a transaction which
+// can be modified.
 func (t *Tx) MsgTx() *wire.MsgTx {
 	// Return the cached transaction.
 	return t.msgTx
 }
 
-// Hash returns the hash of the transaction.  This is equivalent to
-// calling TxHash on the underlying wire.MsgTx, however it caches the
-// result so subsequent calls are more efficient.
+// HashWithSig returns the hash of the transaction including its scriptSigs.
+// This is equivalent to calling TxHashWithSig on the underlying wire.MsgTx,
+// however it caches the result so subsequent calls are more efficient.
 func (t *Tx) HashWithSig() *chainhash.Hash {
-	// Return the cached hash if it has already been generated.
-	if t.TxHashWithSig != nil {
-		return t.TxHashWithSig
-	}
-
-	// Cache the hash and return it.
-	hash := t.msgTx.TxHashWithSig()
-	t.TxHashWithSig = &hash
-	return &hash
+	t.txHashWithSigOnce.Do(func() {
+		t.txHashWithSig = t.msgTx.TxHashWithSig()
+	})
+	return &t.txHashWithSig
 }
 
-// Hash returns the hash of a transaction without scriptSigs.
+// Hash returns the hash of a transaction without scriptSigs.  This is
+// equivalent to calling TxHash on the underlying wire.MsgTx, however it caches
+// the result so subsequent calls are more efficient.
 func (t *Tx) Hash() *chainhash.Hash {
-	// Return the cached hash if it has already been generated.
-	if t.txHash != nil {
-		return t.txHash
-	}
+	t.txHashOnce.Do(func() {
+		t.txHash = t.msgTx.TxHash()
+	})
+	return &t.txHash
+}
 
-	// Cache the hash and return it.
-	hash := t.msgTx.TxHash()
-	t.txHash = &hash
-	return &hash
+// SerializeSize returns the number of bytes it would take to serialize the
+// transaction.  This is equivalent to calling SerializeSize on the underlying
+// wire.MsgTx, however it caches the result so subsequent calls are more
+// efficient.
+func (t *Tx) SerializeSize() int {
+	t.serializeOnce.Do(func() {
+		t.serializeSize = t.msgTx.SerializeSize()
+	})
+	return t.serializeSize
+}
+
+// Copy returns a new transaction wrapping a deep copy of the underlying
+// wire.MsgTx, which may be modified by the caller, along with the same index
+// within a block.  None of the memoized values are carried over.
+func (t *Tx) Copy() *Tx {
+	tx := NewTx(t.msgTx.Copy())
+	tx.txIndex = t.txIndex
+	return tx
+}
+
+// SerializeHex returns the hex encoding of the serialized transaction.
+func (t *Tx) SerializeHex() (string, error) {
+	var buf bytes.Buffer
+	buf.Grow(t.SerializeSize())
+	if err := t.msgTx.Serialize(&buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf.Bytes()), nil
 }
 
 // Index returns the saved index of the transaction within a block.  This value
@@ -89,14 +133,35 @@ func NewTx(msgTx *wire.MsgTx) *Tx {
 }
 
 // NewTxFromBytes returns a new instance of a bitcoin transaction given the
-// serialized bytes.  See Tx.
+// serialized bytes.  ErrTrailingData is returned when the bytes continue
+// beyond the end of the transaction.  See Tx.
 func NewTxFromBytes(serializedTx []byte) (*Tx, error) {
 	br := bytes.NewReader(serializedTx)
-	return NewTxFromReader(br)
+	tx, err := NewTxFromReader(br)
+	if err != nil {
+		return nil, err
+	}
+	if br.Len() != 0 {
+		return nil, ErrTrailingData
+	}
+	return tx, nil
+}
+
+// NewTxFromHex returns a new instance of a bitcoin transaction given the
+// hex-encoded serialized bytes.  ErrTrailingData is returned when the bytes
+// continue beyond the end of the transaction.  See Tx.
+func NewTxFromHex(serializedTxHex string) (*Tx, error) {
+	serializedTx, err := hex.DecodeString(serializedTxHex)
+	if err != nil {
+		return nil, err
+	}
+	return NewTxFromBytes(serializedTx)
 }
 
 // NewTxFromReader returns a new instance of a bitcoin transaction given a
-// Reader to deserialize the transaction.  See Tx.
+// Reader to deserialize the transaction.  The transaction is deserialized
+// directly from the reader, which is left positioned after it, so it can be
+// used to read consecutive transactions from a stream.  See Tx.
 func NewTxFromReader(r io.Reader) (*Tx, error) {
 	// Deserialize the bytes into a MsgTx.
 	var msgTx wire.MsgTx
@@ -7,8 +7,10 @@ package provautil_test
 
 import (
 	"bytes"
+	"encoding/hex"
 	"io"
 	"reflect"
+	"sync"
 	"testing"
 
 	"github.com/bitgo/prova/chaincfg/chainhash"
@@ -52,6 +54,155 @@ func TestTx(t *testing.T) {
 	}
 }
 
+// TestTxCaching ensures the memoized hashes and serialized size match the
+// values calculated from the underlying transaction, including when they are
+// requested concurrently, and that copies of the transaction can be modified
+// without affecting the original.
+func TestTxCaching(t *testing.T) {
+	testTx := Block100000.Transactions[1]
+	wantHash := testTx.TxHash()
+	wantHashWithSig := testTx.TxHashWithSig()
+	wantSize := testTx.SerializeSize()
+
+	// Request the values from many goroutines at once.  This is primarily
+	// intended to be run with the race detector.
+	tx := provautil.NewTx(testTx)
+	var wg sync.WaitGroup
+	errs := make(chan string, 64)
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if !tx.Hash().IsEqual(&wantHash) {
+				errs <- "mismatched hash"
+			}
+			if !tx.HashWithSig().IsEqual(&wantHashWithSig) {
+				errs <- "mismatched hash with sig"
+			}
+			if tx.SerializeSize() != wantSize {
+				errs <- "mismatched serialize size"
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	// Ensure modifying a copy leaves the original untouched and the copy
+	// reports the values of the modified transaction.
+	tx.SetIndex(1)
+	txCopy := tx.Copy()
+	if txCopy.Index() != 1 {
+		t.Fatalf("Copy: mismatched index - got %d, want 1", txCopy.Index())
+	}
+	txCopy.MsgTx().TxOut[0].Value++
+	txCopy.MsgTx().TxIn[0].SignatureScript = append(
+		txCopy.MsgTx().TxIn[0].SignatureScript, 0x00)
+	if !tx.Hash().IsEqual(&wantHash) || tx.SerializeSize() != wantSize ||
+		!reflect.DeepEqual(tx.MsgTx(), testTx) {
+
+		t.Fatalf("Copy: modifying the copy changed the original")
+	}
+	if wantCopyHash := txCopy.MsgTx().TxHash(); !txCopy.Hash().IsEqual(&wantCopyHash) {
+		t.Fatalf("Copy: mismatched hash - got %v, want %v",
+			txCopy.Hash(), wantCopyHash)
+	}
+	if txCopy.SerializeSize() != wantSize+1 {
+		t.Fatalf("Copy: mismatched serialize size - got %d, want %d",
+			txCopy.SerializeSize(), wantSize+1)
+	}
+}
+
+// TestTxStreamingAndHex ensures transactions are read consecutively from a
+// stream, round trip through the hex encoding, and that truncated input and
+// trailing data are rejected.
+func TestTxStreamingAndHex(t *testing.T) {
+	testTx := Block100000.Transactions[1]
+	var buf bytes.Buffer
+	if err := testTx.Serialize(&buf); err != nil {
+		t.Fatalf("Serialize: %v", err)
+	}
+	txBytes := buf.Bytes()
+	wantHash := testTx.TxHash()
+
+	// Read several transactions from a single stream.
+	stream := bytes.NewReader(bytes.Repeat(txBytes, 3))
+	for i := 0; i < 3; i++ {
+		tx, err := provautil.NewTxFromReader(stream)
+		if err != nil {
+			t.Fatalf("NewTxFromReader #%d: %v", i, err)
+		}
+		if !tx.Hash().IsEqual(&wantHash) {
+			t.Fatalf("NewTxFromReader #%d: mismatched hash - got %v, "+
+				"want %v", i, tx.Hash(), wantHash)
+		}
+	}
+	if _, err := provautil.NewTxFromReader(stream); err != io.EOF {
+		t.Fatalf("NewTxFromReader: did not get expected error at the "+
+			"end of the stream - got %v, want %v", err, io.EOF)
+	}
+
+	// Round trip through the hex encoding.
+	txHex, err := provautil.NewTx(testTx).SerializeHex()
+	if err != nil {
+		t.Fatalf("SerializeHex: %v", err)
+	}
+	if txHex != hex.EncodeToString(txBytes) {
+		t.Fatalf("SerializeHex: mismatched encoding - got %s, want %x",
+			txHex, txBytes)
+	}
+	tx, err := provautil.NewTxFromHex(txHex)
+	if err != nil {
+		t.Fatalf("NewTxFromHex: %v", err)
+	}
+	if !reflect.DeepEqual(tx.MsgTx(), testTx) {
+		t.Fatalf("NewTxFromHex: mismatched transaction - got %v, want %v",
+			spew.Sdump(tx.MsgTx()), spew.Sdump(testTx))
+	}
+
+	// Ensure every truncation of the transaction is rejected.
+	for n := 0; n < len(txBytes); n++ {
+		if _, err := provautil.NewTxFromBytes(txBytes[:n]); err == nil {
+			t.Fatalf("NewTxFromBytes: truncated transaction of %d "+
+				"bytes did not fail", n)
+		}
+	}
+
+	// Ensure trailing data and invalid hex are rejected.
+	_, err = provautil.NewTxFromHex(txHex + "00")
+	if err != provautil.ErrTrailingData {
+		t.Fatalf("NewTxFromHex: did not get expected error - got %v, "+
+			"want %v", err, provautil.ErrTrailingData)
+	}
+	_, err = provautil.NewTxFromBytes(append(txBytes, txBytes...))
+	if err != provautil.ErrTrailingData {
+		t.Fatalf("NewTxFromBytes: did not get expected error - got %v, "+
+			"want %v", err, provautil.ErrTrailingData)
+	}
+	if _, err := provautil.NewTxFromHex(txHex[1:]); err == nil {
+		t.Fatalf("NewTxFromHex: odd length hex did not fail")
+	}
+}
+
+// BenchmarkTxHash benchmarks requesting the hash of a transaction which is
+// memoized after the first request compared to calculating it every time.
+func BenchmarkTxHash(b *testing.B) {
+	testTx := Block100000.Transactions[1]
+	b.Run("memoized", func(b *testing.B) {
+		tx := provautil.NewTx(testTx)
+		for i := 0; i < b.N; i++ {
+			tx.Hash()
+		}
+	})
+	b.Run("calculated", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			testTx.TxHash()
+		}
+	})
+}
+
 // TestNewTxFromBytes tests creation of a Tx from serialized bytes.
 func TestNewTxFromBytes(t *testing.T) {
 	// Serialize the test transaction.
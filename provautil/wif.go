@@ -6,7 +6,6 @@
 package provautil
 
 import (
-	"bytes"
 	"errors"
 
 	"github.com/bitgo/prova/btcec"
@@ -69,8 +68,8 @@ func (w *WIF) IsForNet(net *chaincfg.Params) bool {
 // The WIF string must be a base58-encoded string of the following byte
 // sequence:
 //
-//  * 1 byte to identify the network, must be 0x80 for mainnet or 0xef for
-//    either testnet or the regression test network
+//  * 1 byte to identify the network, must be 0x80 for mainnet, 0xef for
+//    either testnet or the regression test network, or 0x64 for simnet
 //  * 32 bytes of a binary-encoded, big-endian, zero-padded private key
 //  * Optional 1 byte (equal to 0x01) if the address being imported or exported
 //    was created by taking the RIPEMD160 after SHA256 hash of a serialized
@@ -84,40 +83,35 @@ func (w *WIF) IsForNet(net *chaincfg.Params) bool {
 // does not equal the expected value of 0x01.  ErrChecksumMismatch is returned
 // if the expected WIF checksum does not match the calculated checksum.
 func DecodeWIF(wif string) (*WIF, error) {
-	decoded := base58.Decode(wif)
-	decodedLen := len(decoded)
-	var compress bool
-
 	// Length of base58 decoded WIF must be 32 bytes + an optional 1 byte
 	// (0x01) if compressed, plus 1 byte for netID + 4 bytes of checksum.
-	switch decodedLen {
+	decoded := base58.Decode(wif)
+	var payloadLen int
+	switch len(decoded) {
 	case 1 + btcec.PrivKeyBytesLen + 1 + 4:
-		if decoded[33] != compressMagic {
-			return nil, ErrMalformedPrivateKey
-		}
-		compress = true
+		payloadLen = btcec.PrivKeyBytesLen + 1
 	case 1 + btcec.PrivKeyBytesLen + 4:
-		compress = false
+		payloadLen = btcec.PrivKeyBytesLen
 	default:
 		return nil, ErrMalformedPrivateKey
 	}
 
 	// Checksum is first four bytes of double SHA256 of the identifier byte
-	// and privKey.  Verify this matches the final 4 bytes of the decoded
-	// private key.
-	var tosum []byte
-	if compress {
-		tosum = decoded[:1+btcec.PrivKeyBytesLen+1]
-	} else {
-		tosum = decoded[:1+btcec.PrivKeyBytesLen]
-	}
-	cksum := chainhash.DoubleHashB(tosum)[:4]
-	if !bytes.Equal(cksum, decoded[decodedLen-4:]) {
+	// and privKey.  It is verified while decoding.
+	version, payload, err := base58.DecodeVersionedBytes(decoded, payloadLen)
+	switch {
+	case err == base58.ErrChecksum:
 		return nil, ErrChecksumMismatch
+	case err != nil:
+		return nil, ErrMalformedPrivateKey
+	}
+	compress := payloadLen == btcec.PrivKeyBytesLen+1
+	if compress && payload[btcec.PrivKeyBytesLen] != compressMagic {
+		return nil, ErrMalformedPrivateKey
 	}
 
-	netID := decoded[0]
-	privKeyBytes := decoded[1 : 1+btcec.PrivKeyBytesLen]
+	netID := version[0]
+	privKeyBytes := payload[:btcec.PrivKeyBytesLen]
 	privKey, _ := btcec.PrivKeyFromBytes(btcec.S256(), privKeyBytes)
 	return &WIF{privKey, compress, netID}, nil
 }
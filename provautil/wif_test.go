@@ -6,6 +6,7 @@
 package provautil_test
 
 import (
+	"bytes"
 	"testing"
 
 	"github.com/bitgo/prova/btcec"
@@ -70,3 +71,101 @@ func TestEncodeDecodeWIF(t *testing.T) {
 		}
 	}
 }
+
+func TestWIFNetworks(t *testing.T) {
+	priv, _ := btcec.PrivKeyFromBytes(btcec.S256(), []byte{
+		0x0c, 0x28, 0xfc, 0xa3, 0x86, 0xc7, 0xa2, 0x27,
+		0x60, 0x0b, 0x2f, 0xe5, 0x0b, 0x7c, 0xae, 0x11,
+		0xec, 0x86, 0xd3, 0xbf, 0x1f, 0xbe, 0x47, 0x1b,
+		0xe8, 0x98, 0x27, 0xe1, 0x9d, 0x72, 0xaa, 0x1d})
+
+	nets := []*chaincfg.Params{
+		&chaincfg.MainNetParams,
+		&chaincfg.TestNetParams,
+		&chaincfg.RegressionNetParams,
+		&chaincfg.SimNetParams,
+	}
+	for _, net := range nets {
+		for _, compress := range []bool{false, true} {
+			wif, err := NewWIF(priv, net, compress)
+			if err != nil {
+				t.Fatalf("%s: NewWIF failed: %v", net.Name, err)
+			}
+			w, err := DecodeWIF(wif.String())
+			if err != nil {
+				t.Errorf("%s compress=%v: DecodeWIF failed: %v",
+					net.Name, compress, err)
+				continue
+			}
+			if w.CompressPubKey != compress {
+				t.Errorf("%s compress=%v: decoded compression "+
+					"flag is %v", net.Name, compress,
+					w.CompressPubKey)
+			}
+			if !bytes.Equal(w.PrivKey.Serialize(), priv.Serialize()) {
+				t.Errorf("%s compress=%v: decoded private key "+
+					"does not match", net.Name, compress)
+			}
+			if !bytes.Equal(w.SerializePubKey(), wif.SerializePubKey()) {
+				t.Errorf("%s compress=%v: decoded public key "+
+					"does not match", net.Name, compress)
+			}
+
+			// The WIF is only for the networks which share its
+			// private key identifier.
+			for _, other := range nets {
+				want := other.PrivateKeyID == net.PrivateKeyID
+				if got := w.IsForNet(other); got != want {
+					t.Errorf("%s compress=%v: IsForNet(%s) "+
+						"is %v, want %v", net.Name,
+						compress, other.Name, got, want)
+				}
+			}
+		}
+	}
+
+	// Ensure a mainnet WIF is rejected for testnet.
+	w, err := DecodeWIF("5HueCGU8rMjxEXxiPuD5BDku4MkFqeZyd4dZ1jvhTVqvbTLvyTJ")
+	if err != nil {
+		t.Fatalf("DecodeWIF failed: %v", err)
+	}
+	if !w.IsForNet(&chaincfg.MainNetParams) || w.IsForNet(&chaincfg.TestNetParams) {
+		t.Errorf("mainnet WIF network mismatch")
+	}
+}
+
+func TestDecodeWIFErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		wif  string
+		err  error
+	}{
+		{
+			name: "bad checksum",
+			wif:  "5HueCGU8rMjxEXxiPuD5BDku4MkFqeZyd4dZ1jvhTVqvbTLvyTK",
+			err:  ErrChecksumMismatch,
+		},
+		{
+			name: "bad compression marker",
+			wif:  "KwdMAjGmerYanjeui5SHS7JkmpZvVipYvB2LJGU1ZxJwYvWxyf5d",
+			err:  ErrMalformedPrivateKey,
+		},
+		{
+			name: "truncated",
+			wif:  "5HueCGU8rMjxEXxiPuD5BDku4MkFqeZyd4dZ1jvhTVqvbTLvy",
+			err:  ErrMalformedPrivateKey,
+		},
+		{
+			name: "empty",
+			wif:  "",
+			err:  ErrMalformedPrivateKey,
+		},
+	}
+
+	for _, test := range tests {
+		if _, err := DecodeWIF(test.wif); err != test.err {
+			t.Errorf("%s: unexpected error - got %v, want %v",
+				test.name, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,535 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/bitgo/prova/btcjson"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/database"
+	"github.com/bitgo/prova/mempool"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/provautil/coinset"
+	"github.com/bitgo/prova/txscript"
+	"github.com/bitgo/prova/wire"
+)
+
+// defaultFundConfTarget is the confirmation target the fee rate of
+// fundrawtransaction is estimated for when neither a fee rate nor a
+// confirmation target is passed.
+const defaultFundConfTarget = 6
+
+// fundingOutput is an unspent transaction output which is spent by, or may be
+// spent to fund, a raw transaction.  It is a coinset.Coin, so the candidates to
+// fund a transaction with can be selected by the coin selectors of the
+// coinset package.
+type fundingOutput struct {
+	outPoint wire.OutPoint
+	amount   int64
+	pkScript []byte
+}
+
+// Ensure that fundingOutput is a coinset.Coin.
+var _ coinset.Coin = (*fundingOutput)(nil)
+
+// Hash returns the hash of the transaction which created the output.
+func (out *fundingOutput) Hash() *chainhash.Hash {
+	return &out.outPoint.Hash
+}
+
+// Index returns the index of the output in the transaction which created it.
+func (out *fundingOutput) Index() uint32 {
+	return out.outPoint.Index
+}
+
+// Value returns the amount of the output.
+func (out *fundingOutput) Value() provautil.Amount {
+	return provautil.Amount(out.amount)
+}
+
+// PkScript returns the script of the output.
+func (out *fundingOutput) PkScript() []byte {
+	return out.pkScript
+}
+
+// NumConfs returns zero since the confirmations of the output do not matter to
+// fundrawtransaction.
+func (out *fundingOutput) NumConfs() int64 {
+	return 0
+}
+
+// ValueAge returns zero since the confirmations of the output do not matter to
+// fundrawtransaction.
+func (out *fundingOutput) ValueAge() int64 {
+	return 0
+}
+
+// sigScriptSize returns the number of bytes the signature script of an input
+// spending the passed Prova script adds to the serialized size of an unsigned
+// input.  Admin thread outputs can not fund transactions, so any other script
+// results in an error.
+func sigScriptSize(pkScript []byte, params *chaincfg.Params) (int, error) {
+	class := txscript.GetScriptClass(pkScript)
+	if class != txscript.ProvaTy && class != txscript.GeneralProvaTy {
+		return 0, fmt.Errorf("%v scripts do not fund transactions", class)
+	}
+	spendSize, err := coinset.SpendSize(pkScript, params)
+	if err != nil {
+		return 0, err
+	}
+	emptyIn := wire.NewTxIn(&wire.OutPoint{}, nil)
+	return spendSize - emptyIn.SerializeSize(), nil
+}
+
+// feeForSize returns the fee in atoms of a transaction with the passed
+// serialized size at the passed fee rate in atoms/kB.  Like the relay policy of
+// the memory pool, a non-zero fee rate results in a fee of at least one atom.
+func feeForSize(size int, feeRate int64) int64 {
+	fee := int64(size) * feeRate / 1000
+	if fee == 0 && feeRate > 0 {
+		fee = feeRate
+	}
+	return fee
+}
+
+// isDustChange returns whether a change output with the passed script and
+// amount costs more than a third of its amount to spend at the passed fee rate
+// in atoms/kB, in which case it is left to the fee instead.
+func isDustChange(pkScript []byte, amount int64, feeRate int64,
+	params *chaincfg.Params) bool {
+
+	spendSize, err := coinset.SpendSize(pkScript, params)
+	if err != nil {
+		return true
+	}
+	txOut := wire.NewTxOut(amount, pkScript)
+	size := txOut.SerializeSize() + spendSize
+	return amount*1000/(3*int64(size)) < feeRate
+}
+
+// fundRawTx adds inputs spending the passed candidates to the passed
+// transaction until they cover its outputs and the fee at the passed fee rate
+// in atoms/kB, and pays the remainder to the passed change script unless it is
+// dust.  The inputs of the transaction spend the passed outputs, in order.
+// Inputs which are not signed yet are accounted for with the size of their
+// future signature scripts.
+//
+// The candidates are selected by a coinset.LargestFirstCoinSelector, so the
+// largest ones are spent first.  It returns the fee the transaction pays and
+// the index of the change output, which is -1 when no change output was added.
+func fundRawTx(mtx *wire.MsgTx, spent []fundingOutput, candidates []fundingOutput,
+	changeScript []byte, feeRate int64, params *chaincfg.Params) (int64, int, error) {
+
+	var inAmt, outAmt int64
+	var sigSize int
+	for i, out := range spent {
+		inAmt += out.amount
+		if len(mtx.TxIn[i].SignatureScript) != 0 {
+			continue
+		}
+		size, err := sigScriptSize(out.pkScript, params)
+		if err != nil {
+			return 0, 0, &btcjson.RPCError{
+				Code: btcjson.ErrRPCInvalidParameter,
+				Message: fmt.Sprintf("Input %d does not spend a "+
+					"Prova output", i),
+			}
+		}
+		sigSize += size
+	}
+	for _, txOut := range mtx.TxOut {
+		outAmt += txOut.Value
+	}
+
+	// Select candidates to fund the remainder of the outputs and the fee
+	// unless the inputs of the transaction already cover them.
+	baseSize := mtx.SerializeSize() + sigSize
+	if inAmt < outAmt+feeForSize(baseSize, feeRate) {
+		coins := make([]coinset.Coin, 0, len(candidates))
+		for i := range candidates {
+			coins = append(coins, &candidates[i])
+		}
+		target := &coinset.FeeTarget{
+			Value:    provautil.Amount(outAmt - inAmt),
+			BaseSize: baseSize,
+			FeeRate:  provautil.Amount(feeRate),
+			Params:   params,
+		}
+		selector := coinset.LargestFirstCoinSelector{
+			MaxInputs: len(coins),
+		}
+		selected, _, err := selector.FeeCoinSelect(target, coins)
+		if err != nil && err != coinset.ErrCoinsNoSelectionAvailable {
+			return 0, 0, err
+		}
+		if selected != nil {
+			for _, coin := range selected.Coins() {
+				size, _ := sigScriptSize(coin.PkScript(), params)
+				outPoint := wire.NewOutPoint(coin.Hash(),
+					coin.Index())
+				mtx.AddTxIn(wire.NewTxIn(outPoint, nil))
+				inAmt += int64(coin.Value())
+				sigSize += size
+			}
+		}
+
+		// Report the fee of the transaction spending all of the
+		// candidates when even they do not cover the outputs.
+		fee := feeForSize(mtx.SerializeSize()+sigSize, feeRate)
+		if selected == nil || inAmt < outAmt+fee {
+			availAmt, size := inAmt, baseSize
+			for _, coin := range coins {
+				spendSize, err := coinset.SpendSize(
+					coin.PkScript(), params)
+				if err != nil {
+					continue
+				}
+				availAmt += int64(coin.Value())
+				size += spendSize
+			}
+			return 0, 0, &btcjson.RPCError{
+				Code: btcjson.ErrRPCWalletInsufficientFunds,
+				Message: fmt.Sprintf("Insufficient funds: %v "+
+					"available, %v required",
+					provautil.Amount(availAmt),
+					provautil.Amount(outAmt+
+						feeForSize(size, feeRate))),
+			}
+		}
+	}
+
+	// Pay the remainder to the change script unless it is not worth
+	// spending.
+	changeOut := wire.NewTxOut(0, changeScript)
+	fee := feeForSize(mtx.SerializeSize()+changeOut.SerializeSize()+sigSize,
+		feeRate)
+	changeOut.Value = inAmt - outAmt - fee
+	if changeOut.Value <= 0 ||
+		isDustChange(changeScript, changeOut.Value, feeRate, params) {
+
+		return inAmt - outAmt, -1, nil
+	}
+	mtx.AddTxOut(changeOut)
+	return fee, len(mtx.TxOut) - 1, nil
+}
+
+// decodeProvaAddress decodes the passed Prova address and ensures it belongs
+// to the network of the server.
+func decodeProvaAddress(encodedAddr string, params *chaincfg.Params) (*provautil.AddressProva, error) {
+	addr, err := provautil.DecodeAddress(encodedAddr, params)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidAddressOrKey,
+			Message: "Invalid address or key: " + err.Error(),
+		}
+	}
+	provaAddr, ok := addr.(*provautil.AddressProva)
+	if !ok {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidAddressOrKey,
+			Message: "Invalid address or key",
+		}
+	}
+	if !provaAddr.IsForNet(params) {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCInvalidAddressOrKey,
+			Message: "Invalid address: " + encodedAddr +
+				" is for the wrong network",
+		}
+	}
+	return provaAddr, nil
+}
+
+// fetchFundingOutput returns the unspent transaction output with the passed
+// outpoint, which is either created by a transaction of the memory pool or
+// part of the utxo set of the main chain.  Coinbase outputs which are not
+// mature as of the next block are treated as spent.
+func fetchFundingOutput(s *rpcServer, outPoint *wire.OutPoint) (*fundingOutput, error) {
+	notFound := &btcjson.RPCError{
+		Code:    btcjson.ErrRPCNoTxInfo,
+		Message: fmt.Sprintf("No unspent output %v", outPoint),
+	}
+
+	// TODO: This is racy like handleGetTxOut.  It should attempt to fetch
+	// it directly and check the error.
+	if s.server.txMemPool.HaveTransaction(&outPoint.Hash) {
+		tx, err := s.server.txMemPool.FetchTransaction(&outPoint.Hash)
+		if err != nil {
+			return nil, notFound
+		}
+		txOuts := tx.MsgTx().TxOut
+		if outPoint.Index >= uint32(len(txOuts)) {
+			return nil, notFound
+		}
+		return &fundingOutput{
+			outPoint: *outPoint,
+			amount:   txOuts[outPoint.Index].Value,
+			pkScript: txOuts[outPoint.Index].PkScript,
+		}, nil
+	}
+
+	entry, err := s.chain.FetchUtxoEntry(&outPoint.Hash)
+	if err != nil || entry == nil || entry.IsOutputSpent(outPoint.Index) {
+		return nil, notFound
+	}
+	if entry.IsCoinBase() {
+		nextHeight := s.chain.BestSnapshot().Height + 1
+		maturity := uint32(s.server.chainParams.CoinbaseMaturity)
+		if nextHeight-entry.BlockHeight() < maturity {
+			return nil, notFound
+		}
+	}
+	return &fundingOutput{
+		outPoint: *outPoint,
+		amount:   entry.AmountByIndex(outPoint.Index),
+		pkScript: entry.PkScriptByIndex(outPoint.Index),
+	}, nil
+}
+
+// fetchAddressOutputs returns the unspent transaction outputs of the main
+// chain which pay to the passed address using the address index.
+func fetchAddressOutputs(s *rpcServer, addr provautil.Address) ([]fundingOutput, error) {
+	addrIndex := s.server.addrIndex
+	if addrIndex == nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCMisc,
+			Message: "Address index must be enabled (--addrindex)",
+		}
+	}
+	pkScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		context := "Failed to generate pay-to-address script"
+		return nil, internalRPCError(err.Error(), context)
+	}
+
+	var serializedTxns [][]byte
+	err = s.server.db.View(func(dbTx database.Tx) error {
+		regions, err := addrIndex.BoundedTxRegionsForAddress(dbTx, addr,
+			0, 1<<32-1)
+		if err != nil {
+			return err
+		}
+		serializedTxns, err = dbTx.FetchBlockRegions(regions)
+		return err
+	})
+	if err != nil {
+		context := "Failed to load address index entries"
+		return nil, internalRPCError(err.Error(), context)
+	}
+
+	var outputs []fundingOutput
+	seen := make(map[chainhash.Hash]struct{}, len(serializedTxns))
+	for _, serializedTx := range serializedTxns {
+		var mtx wire.MsgTx
+		err := mtx.Deserialize(bytes.NewReader(serializedTx))
+		if err != nil {
+			context := "Failed to deserialize transaction"
+			return nil, internalRPCError(err.Error(), context)
+		}
+		txHash := mtx.TxHash()
+		if _, ok := seen[txHash]; ok {
+			continue
+		}
+		seen[txHash] = struct{}{}
+		for i, txOut := range mtx.TxOut {
+			if !bytes.Equal(txOut.PkScript, pkScript) {
+				continue
+			}
+			out, err := fetchFundingOutput(s,
+				wire.NewOutPoint(&txHash, uint32(i)))
+			if err != nil {
+				continue
+			}
+			outputs = append(outputs, *out)
+		}
+	}
+	return outputs, nil
+}
+
+// fundingFeeRate returns the fee rate in atoms/kB fundrawtransaction funds a
+// transaction with.  It is the passed fee rate in RMG/kB, or else the fee rate
+// estimated for the passed confirmation target, but never less than the
+// minimum relay fee rate of the memory pool.
+func fundingFeeRate(s *rpcServer, feeRate *float64, confTarget *int64) (int64, error) {
+	minFeeRate := s.server.txMemPool.MinRelayFeeRate()
+	if feeRate != nil {
+		rate, err := provautil.NewAmount(*feeRate)
+		if err != nil || rate < 0 {
+			return 0, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCInvalidParameter,
+				Message: "Invalid fee rate",
+			}
+		}
+		if int64(rate) < minFeeRate {
+			return 0, &btcjson.RPCError{
+				Code: btcjson.ErrRPCInvalidParameter,
+				Message: fmt.Sprintf("Fee rate %v/kB is below the "+
+					"minimum relay fee rate %v/kB", rate,
+					provautil.Amount(minFeeRate)),
+			}
+		}
+		return int64(rate), nil
+	}
+
+	target := int64(defaultFundConfTarget)
+	if confTarget != nil {
+		target = *confTarget
+	}
+	numBlocks, err := estimateConfTarget(target)
+	if err != nil {
+		return 0, err
+	}
+	estimate, _, err := s.server.feeEstimator.EstimateFee(numBlocks, false)
+	if err == mempool.ErrInsufficientFeeData {
+		return minFeeRate, nil
+	}
+	if err != nil {
+		return 0, internalRPCError(err.Error(), "Unable to estimate fee")
+	}
+	if int64(estimate) < minFeeRate {
+		return minFeeRate, nil
+	}
+	return int64(estimate), nil
+}
+
+// handleFundRawTransaction implements the fundrawtransaction command.
+func handleFundRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.FundRawTransactionCmd)
+	params := s.server.chainParams
+
+	// Deserialize the transaction.
+	hexStr := c.HexTx
+	if len(hexStr)%2 != 0 {
+		hexStr = "0" + hexStr
+	}
+	serializedTx, err := hex.DecodeString(hexStr)
+	if err != nil {
+		return nil, rpcDecodeHexError(hexStr)
+	}
+	var mtx wire.MsgTx
+	err = mtx.Deserialize(bytes.NewReader(serializedTx))
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCDeserialization,
+			Message: "TX decode failed: " + err.Error(),
+		}
+	}
+	if len(mtx.TxOut) == 0 {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Transaction has no outputs",
+		}
+	}
+
+	// Every address must belong to the network of the server.
+	changeAddr, err := decodeProvaAddress(c.Options.ChangeAddress, params)
+	if err != nil {
+		return nil, err
+	}
+	changeScript, err := txscript.PayToAddrScript(changeAddr)
+	if err != nil {
+		context := "Failed to generate pay-to-address script"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	addrs := make([]*provautil.AddressProva, 0, len(c.Options.Addresses))
+	for _, encodedAddr := range c.Options.Addresses {
+		addr, err := decodeProvaAddress(encodedAddr, params)
+		if err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, addr)
+	}
+	if len(c.Options.Utxos) == 0 && len(addrs) == 0 {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "No unspent outputs or addresses to fund from",
+		}
+	}
+
+	feeRate, err := fundingFeeRate(s, c.Options.FeeRate,
+		c.Options.ConfTarget)
+	if err != nil {
+		return nil, err
+	}
+
+	// Look up the outputs spent by the inputs of the transaction.
+	used := make(map[wire.OutPoint]struct{})
+	spent := make([]fundingOutput, 0, len(mtx.TxIn))
+	for _, txIn := range mtx.TxIn {
+		out, err := fetchFundingOutput(s, &txIn.PreviousOutPoint)
+		if err != nil {
+			return nil, err
+		}
+		spent = append(spent, *out)
+		used[txIn.PreviousOutPoint] = struct{}{}
+	}
+
+	// Outputs already spent by transactions of the memory pool are not
+	// candidates.
+	for _, txDesc := range s.server.txMemPool.TxDescs() {
+		for _, txIn := range txDesc.Tx.MsgTx().TxIn {
+			used[txIn.PreviousOutPoint] = struct{}{}
+		}
+	}
+
+	// Gather the candidates, which are the passed unspent outputs followed
+	// by the unspent outputs paying to the passed addresses.
+	var candidates []fundingOutput
+	addCandidate := func(out *fundingOutput) {
+		if _, ok := used[out.outPoint]; ok {
+			return
+		}
+		used[out.outPoint] = struct{}{}
+		candidates = append(candidates, *out)
+	}
+	for _, utxo := range c.Options.Utxos {
+		txHash, err := chainhash.NewHashFromStr(utxo.Txid)
+		if err != nil {
+			return nil, rpcDecodeHexError(utxo.Txid)
+		}
+		out, err := fetchFundingOutput(s, wire.NewOutPoint(txHash,
+			utxo.Vout))
+		if err != nil {
+			return nil, err
+		}
+		if _, err := sigScriptSize(out.pkScript, params); err != nil {
+			return nil, &btcjson.RPCError{
+				Code: btcjson.ErrRPCInvalidParameter,
+				Message: fmt.Sprintf("Output %v is not a Prova "+
+					"output", out.outPoint),
+			}
+		}
+		addCandidate(out)
+	}
+	for _, addr := range addrs {
+		outputs, err := fetchAddressOutputs(s, addr)
+		if err != nil {
+			return nil, err
+		}
+		for i := range outputs {
+			addCandidate(&outputs[i])
+		}
+	}
+
+	fee, changePos, err := fundRawTx(&mtx, spent, candidates, changeScript,
+		feeRate, params)
+	if err != nil {
+		return nil, err
+	}
+	mtxHex, err := messageToHex(&mtx)
+	if err != nil {
+		return nil, err
+	}
+	return &btcjson.FundRawTransactionResult{
+		Hex:       mtxHex,
+		Fee:       provautil.Amount(fee).ToRMG(),
+		FeeRate:   provautil.Amount(feeRate).ToRMG(),
+		ChangePos: changePos,
+	}, nil
+}
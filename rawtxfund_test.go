@@ -0,0 +1,225 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/btcjson"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/txscript"
+	"github.com/bitgo/prova/wire"
+)
+
+// fundTestScript returns the script paying to the regression test network
+// Prova address with the passed key hash byte.
+func fundTestScript(t *testing.T, b byte) []byte {
+	pkHash := make([]byte, chainhash.Hash160Size)
+	pkHash[0] = b
+	addr, err := provautil.NewAddressProva(pkHash, []btcec.KeyID{1, 2},
+		&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("NewAddressProva: unexpected error: %v", err)
+	}
+	pkScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		t.Fatalf("PayToAddrScript: unexpected error: %v", err)
+	}
+	return pkScript
+}
+
+// TestFundRawTx ensures transactions are funded with the largest candidates
+// first, pay the fee of their signed size and only get change worth spending.
+func TestFundRawTx(t *testing.T) {
+	pkScript := fundTestScript(t, 1)
+	changeScript := fundTestScript(t, 2)
+	params := &chaincfg.RegressionNetParams
+	spendSize, err := sigScriptSize(pkScript, params)
+	if err != nil {
+		t.Fatalf("sigScriptSize: unexpected error: %v", err)
+	}
+	candidate := func(index uint32, amount int64) fundingOutput {
+		return fundingOutput{
+			outPoint: wire.OutPoint{Index: index},
+			amount:   amount,
+			pkScript: pkScript,
+		}
+	}
+	candidates := []fundingOutput{
+		candidate(0, 1e5),
+		candidate(1, 3e8),
+		candidate(2, 2e8),
+	}
+	const feeRate = 1000
+
+	tests := []struct {
+		name      string
+		spent     []fundingOutput
+		send      int64
+		numInputs int
+		change    bool
+		errCode   btcjson.RPCErrorCode
+	}{
+		{
+			name:      "largest candidate",
+			send:      1e8,
+			numInputs: 1,
+			change:    true,
+		},
+		{
+			name:      "several candidates",
+			send:      4e8,
+			numInputs: 2,
+			change:    true,
+		},
+		{
+			name:      "existing input",
+			spent:     []fundingOutput{candidate(3, 5e7)},
+			send:      3e8,
+			numInputs: 2,
+			change:    true,
+		},
+		{
+			name:      "existing input suffices",
+			spent:     []fundingOutput{candidate(3, 5e7)},
+			send:      4e7,
+			numInputs: 1,
+			change:    true,
+		},
+		{
+			name:      "dust change",
+			send:      3e8 - 500,
+			numInputs: 1,
+		},
+		{
+			name:    "insufficient funds",
+			send:    6e8,
+			errCode: btcjson.ErrRPCWalletInsufficientFunds,
+		},
+	}
+
+	for _, test := range tests {
+		mtx := wire.NewMsgTx(wire.TxVersion)
+		var inAmt int64
+		for _, out := range test.spent {
+			outPoint := out.outPoint
+			mtx.AddTxIn(wire.NewTxIn(&outPoint, nil))
+			inAmt += out.amount
+		}
+		mtx.AddTxOut(wire.NewTxOut(test.send, fundTestScript(t, 3)))
+
+		fee, changePos, err := fundRawTx(mtx, test.spent, candidates,
+			changeScript, feeRate, params)
+		if test.errCode != 0 {
+			rpcErr, ok := err.(*btcjson.RPCError)
+			if !ok || rpcErr.Code != test.errCode {
+				t.Errorf("%s: unexpected error - got %v, want "+
+					"code %d", test.name, err, test.errCode)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+
+		if len(mtx.TxIn) != test.numInputs {
+			t.Errorf("%s: got %d inputs, want %d", test.name,
+				len(mtx.TxIn), test.numInputs)
+			continue
+		}
+		for i, txIn := range mtx.TxIn[len(test.spent):] {
+			if txIn.PreviousOutPoint.Index != uint32(i+1) {
+				t.Errorf("%s: input %d spends %v, want the "+
+					"largest candidates first", test.name, i,
+					txIn.PreviousOutPoint)
+			}
+			inAmt += candidates[i+1].amount
+		}
+		var outAmt int64
+		for _, txOut := range mtx.TxOut {
+			outAmt += txOut.Value
+		}
+		if inAmt-outAmt != fee {
+			t.Errorf("%s: got fee %d, want %d", test.name, fee,
+				inAmt-outAmt)
+		}
+		signedSize := mtx.SerializeSize() + len(mtx.TxIn)*spendSize
+		if minFee := feeForSize(signedSize, feeRate); fee < minFee {
+			t.Errorf("%s: got fee %d, want at least %d", test.name,
+				fee, minFee)
+		}
+		if !test.change {
+			if changePos != -1 || len(mtx.TxOut) != 1 {
+				t.Errorf("%s: unexpected change output %d",
+					test.name, changePos)
+			}
+			continue
+		}
+		if changePos != 1 || len(mtx.TxOut) != 2 {
+			t.Errorf("%s: got change output %d of %d outputs, want "+
+				"1 of 2", test.name, changePos, len(mtx.TxOut))
+			continue
+		}
+		if fee != feeForSize(signedSize, feeRate) {
+			t.Errorf("%s: got fee %d, want %d", test.name, fee,
+				feeForSize(signedSize, feeRate))
+		}
+	}
+}
+
+// TestSigScriptSize ensures the signature scripts of Prova outputs hold a
+// signature and public key pair per required signature and that admin thread
+// outputs are refused.
+func TestSigScriptSize(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	size, err := sigScriptSize(fundTestScript(t, 1), params)
+	if want := 2 * (1 + 73 + 1 + 33); err != nil || size != want {
+		t.Errorf("sigScriptSize: got %d (err %v) for a Prova script, "+
+			"want %d", size, err, want)
+	}
+
+	threadScript, err := txscript.ProvaThreadScript(provautil.RootThread)
+	if err != nil {
+		t.Fatalf("ProvaThreadScript: unexpected error: %v", err)
+	}
+	if _, err := sigScriptSize(threadScript, params); err == nil {
+		t.Error("sigScriptSize: no error for an admin thread script")
+	}
+}
+
+// TestDecodeProvaAddress ensures only Prova addresses of the network of the
+// server are accepted.
+func TestDecodeProvaAddress(t *testing.T) {
+	pkHash := make([]byte, chainhash.Hash160Size)
+	keyIDs := []btcec.KeyID{1, 2}
+	regAddr, err := provautil.NewAddressProva(pkHash, keyIDs,
+		&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("NewAddressProva: unexpected error: %v", err)
+	}
+	mainAddr, err := provautil.NewAddressProva(pkHash, keyIDs,
+		&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("NewAddressProva: unexpected error: %v", err)
+	}
+
+	params := &chaincfg.RegressionNetParams
+	if _, err := decodeProvaAddress(regAddr.EncodeAddress(), params); err != nil {
+		t.Errorf("decodeProvaAddress: unexpected error: %v", err)
+	}
+	for _, encodedAddr := range []string{mainAddr.EncodeAddress(), "bogus"} {
+		_, err := decodeProvaAddress(encodedAddr, params)
+		rpcErr, ok := err.(*btcjson.RPCError)
+		if !ok || rpcErr.Code != btcjson.ErrRPCInvalidAddressOrKey {
+			t.Errorf("decodeProvaAddress(%q): unexpected error - got "+
+				"%v, want code %d", encodedAddr, err,
+				btcjson.ErrRPCInvalidAddressOrKey)
+		}
+	}
+}
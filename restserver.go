@@ -0,0 +1,418 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bitgo/prova/btcjson"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+)
+
+const (
+	// restMaxHeaders is the maximum number of headers which are returned
+	// by a single headers request.
+	restMaxHeaders = 2000
+
+	// restMaxPathLen is the maximum length of the path of a request.  It
+	// comfortably fits the longest valid path, which is a headers request.
+	restMaxPathLen = 128
+
+	// restTimeoutSeconds is the number of seconds a connection to the REST
+	// server is allowed to take to read a request or write a response.
+	restTimeoutSeconds = 30
+)
+
+// restFormat describes the format of a REST response as specified by the
+// extension of the requested resource.
+type restFormat string
+
+// These constants define the formats of REST responses.
+const (
+	restFormatBinary restFormat = "bin"
+	restFormatHex    restFormat = "hex"
+	restFormatJSON   restFormat = "json"
+)
+
+// restExecFunc describes a function which executes the passed RPC command and
+// returns its result the same way the RPC server does.
+type restExecFunc func(cmd interface{}) (interface{}, error)
+
+// restError is an error which is reported to REST clients with an HTTP status
+// code.
+type restError struct {
+	code    int
+	message string
+}
+
+// Error satisfies the error interface and prints human-readable errors.
+func (e *restError) Error() string {
+	return e.message
+}
+
+// restBadRequest returns a restError which reports the passed message with a
+// 400 Bad Request status code.
+func restBadRequest(format string, args ...interface{}) *restError {
+	return &restError{
+		code:    http.StatusBadRequest,
+		message: fmt.Sprintf(format, args...),
+	}
+}
+
+// restServer serves read-only block, transaction and mempool data over
+// unauthenticated HTTP GET requests.  The requests are served by executing the
+// same handlers as the equivalent RPC commands, so the results are identical.
+type restServer struct {
+	started   int32
+	shutdown  int32
+	execute   restExecFunc
+	listeners []net.Listener
+	wg        sync.WaitGroup
+}
+
+// Start begins serving REST requests on all of the listeners.
+func (s *restServer) Start() {
+	if atomic.AddInt32(&s.started, 1) != 1 {
+		return
+	}
+
+	rpcsLog.Trace("Starting REST server")
+	restServeMux := http.NewServeMux()
+	restServeMux.HandleFunc("/rest/", s.handleRequest)
+	httpServer := &http.Server{
+		Handler:        restServeMux,
+		ReadTimeout:    time.Second * restTimeoutSeconds,
+		WriteTimeout:   time.Second * restTimeoutSeconds,
+		MaxHeaderBytes: 1 << 12,
+	}
+	for _, listener := range s.listeners {
+		s.wg.Add(1)
+		go func(listener net.Listener) {
+			rpcsLog.Infof("REST server listening on %s", listener.Addr())
+			httpServer.Serve(listener)
+			rpcsLog.Tracef("REST listener done for %s", listener.Addr())
+			s.wg.Done()
+		}(listener)
+	}
+}
+
+// Stop shuts down the REST server by closing all of the listeners.
+func (s *restServer) Stop() error {
+	if atomic.AddInt32(&s.shutdown, 1) != 1 {
+		rpcsLog.Infof("REST server is already in the process of shutting down")
+		return nil
+	}
+	rpcsLog.Warnf("REST server shutting down")
+	for _, listener := range s.listeners {
+		err := listener.Close()
+		if err != nil {
+			rpcsLog.Errorf("Problem shutting down REST server: %v", err)
+			return err
+		}
+	}
+	s.wg.Wait()
+	rpcsLog.Infof("REST server shutdown complete")
+	return nil
+}
+
+// handleRequest validates the passed REST request and responds to it with the
+// requested resource in the requested format.
+func (s *restServer) handleRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "405 Method not allowed.",
+			http.StatusMethodNotAllowed)
+		return
+	}
+
+	err := s.serveResource(w, r.URL.Path)
+	if err == nil {
+		return
+	}
+
+	// Errors of the RPC handlers which report unknown blocks and
+	// transactions share the same code, so they are all reported as not
+	// found, while malformed hashes are bad requests.
+	code := http.StatusInternalServerError
+	message := err.Error()
+	switch e := err.(type) {
+	case *restError:
+		code = e.code
+	case *btcjson.RPCError:
+		switch e.Code {
+		case btcjson.ErrRPCBlockNotFound:
+			code = http.StatusNotFound
+		case btcjson.ErrRPCDecodeHexString, btcjson.ErrRPCInvalidParameter:
+			code = http.StatusBadRequest
+		default:
+			rpcsLog.Errorf("Unable to serve REST request %s: %v",
+				r.URL.Path, err)
+		}
+		message = e.Message
+	}
+	http.Error(w, fmt.Sprintf("%d %s", code, message), code)
+}
+
+// serveResource writes the resource at the passed path of a REST request in
+// the requested format.
+func (s *restServer) serveResource(w http.ResponseWriter, path string) error {
+	if len(path) > restMaxPathLen {
+		return restBadRequest("Path exceeds the maximum length of %d",
+			restMaxPathLen)
+	}
+
+	// Every resource is requested with an extension which specifies the
+	// format of the response.
+	resource := strings.TrimPrefix(path, "/rest/")
+	dot := strings.LastIndex(resource, ".")
+	if dot == -1 {
+		return restBadRequest("Missing format extension (available: " +
+			".bin, .hex, .json)")
+	}
+	format := restFormat(resource[dot+1:])
+	switch format {
+	case restFormatBinary, restFormatHex, restFormatJSON:
+	default:
+		return restBadRequest("Unknown format extension .%s "+
+			"(available: .bin, .hex, .json)", format)
+	}
+	parts := strings.Split(resource[:dot], "/")
+
+	var serialized []byte
+	var result interface{}
+	var err error
+	switch {
+	case len(parts) == 2 && parts[0] == "block":
+		serialized, result, err = s.block(parts[1], format)
+
+	case len(parts) == 3 && parts[0] == "headers":
+		serialized, result, err = s.headers(parts[1], parts[2], format)
+
+	case len(parts) == 2 && parts[0] == "tx":
+		serialized, result, err = s.tx(parts[1], format)
+
+	case len(parts) == 1 && parts[0] == "chaininfo":
+		result, err = s.jsonOnly(&btcjson.GetBlockChainInfoCmd{},
+			format)
+
+	case len(parts) == 2 && parts[0] == "mempool" && parts[1] == "info":
+		result, err = s.jsonOnly(&btcjson.GetMempoolInfoCmd{}, format)
+
+	default:
+		return &restError{
+			code:    http.StatusNotFound,
+			message: "Unknown resource",
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case restFormatBinary:
+		w.Header().Set("Content-Type", "application/octet-stream")
+		_, err = w.Write(serialized)
+	case restFormatHex:
+		w.Header().Set("Content-Type", "text/plain")
+		_, err = fmt.Fprintln(w, hex.EncodeToString(serialized))
+	case restFormatJSON:
+		var marshalled []byte
+		marshalled, err = json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, err = w.Write(append(marshalled, '\n'))
+	}
+	if err != nil {
+		rpcsLog.Debugf("Unable to write REST response: %v", err)
+	}
+	return nil
+}
+
+// parseHash validates the passed hash of a REST request.  Only the exact
+// big-endian hex encoding of a hash is accepted.
+func parseHash(str string) (*chainhash.Hash, error) {
+	hash, err := chainhash.NewHashFromStrBE(str)
+	if err != nil {
+		return nil, restBadRequest("Invalid hash %q", str)
+	}
+	return hash, nil
+}
+
+// executeHex executes the passed RPC command, which returns a hex-encoded
+// serialization, and returns the decoded serialization.
+func (s *restServer) executeHex(cmd interface{}) ([]byte, error) {
+	result, err := s.execute(cmd)
+	if err != nil {
+		return nil, err
+	}
+	hexStr, ok := result.(string)
+	if !ok {
+		return nil, errors.New("unexpected result type")
+	}
+	return hex.DecodeString(hexStr)
+}
+
+// block returns the block with the passed hash either serialized or as the
+// result of the getblock RPC including the details of its transactions.
+func (s *restServer) block(hashStr string, format restFormat) ([]byte, interface{}, error) {
+	hash, err := parseHash(hashStr)
+	if err != nil {
+		return nil, nil, err
+	}
+	if format == restFormatJSON {
+		verbosity := btcjson.GetBlockVerbosityTxs
+		result, err := s.execute(&btcjson.GetBlockCmd{
+			Hash:      hash.StringBE(),
+			Verbosity: &verbosity,
+		})
+		return nil, result, err
+	}
+	verbosity := btcjson.GetBlockVerbosityHex
+	serialized, err := s.executeHex(&btcjson.GetBlockCmd{
+		Hash:      hash.StringBE(),
+		Verbosity: &verbosity,
+	})
+	return serialized, nil, err
+}
+
+// headers returns up to the passed number of headers of the main chain starting
+// with the header of the block with the passed hash either serialized or as the
+// results of the getblockheader RPC.
+func (s *restServer) headers(countStr, hashStr string, format restFormat) ([]byte, interface{}, error) {
+	count, err := strconv.ParseUint(countStr, 10, 32)
+	if err != nil || count == 0 || count > restMaxHeaders {
+		return nil, nil, restBadRequest("Header count must be between "+
+			"1 and %d", restMaxHeaders)
+	}
+	hash, err := parseHash(hashStr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	verbose := true
+	var serialized []byte
+	results := make([]*btcjson.GetBlockHeaderVerboseResult, 0, count)
+	for next := hash.StringBE(); next != "" && uint64(len(results)) < count; {
+		result, err := s.execute(&btcjson.GetBlockHeaderCmd{
+			Hash:    next,
+			Verbose: &verbose,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		header, ok := result.(*btcjson.GetBlockHeaderVerboseResult)
+		if !ok {
+			return nil, nil, errors.New("unexpected result type")
+		}
+
+		if format != restFormatJSON {
+			notVerbose := false
+			headerBytes, err := s.executeHex(&btcjson.GetBlockHeaderCmd{
+				Hash:    next,
+				Verbose: &notVerbose,
+			})
+			if err != nil {
+				return nil, nil, err
+			}
+			serialized = append(serialized, headerBytes...)
+		}
+		results = append(results, header)
+		next = header.NextHash
+	}
+	return serialized, results, nil
+}
+
+// tx returns the transaction with the passed hash either serialized or as the
+// result of the getrawtransaction RPC.
+func (s *restServer) tx(hashStr string, format restFormat) ([]byte, interface{}, error) {
+	hash, err := parseHash(hashStr)
+	if err != nil {
+		return nil, nil, err
+	}
+	if format == restFormatJSON {
+		verbose := 1
+		result, err := s.execute(&btcjson.GetRawTransactionCmd{
+			Txid:    hash.StringBE(),
+			Verbose: &verbose,
+		})
+		return nil, result, err
+	}
+	verbose := 0
+	serialized, err := s.executeHex(&btcjson.GetRawTransactionCmd{
+		Txid:    hash.StringBE(),
+		Verbose: &verbose,
+	})
+	return serialized, nil, err
+}
+
+// jsonOnly returns the result of the passed RPC command for resources which
+// are only available in the JSON format.
+func (s *restServer) jsonOnly(cmd interface{}, format restFormat) (interface{}, error) {
+	if format != restFormatJSON {
+		return nil, restBadRequest("Resource is only available as .json")
+	}
+	return s.execute(cmd)
+}
+
+// newRESTServer returns a new instance of the restServer struct which listens
+// on the passed addresses.
+func newRESTServer(listenAddrs []string, s *server) (*restServer, error) {
+	// The handlers of the RPC commands served over REST only access the
+	// server and the chain.
+	rpc := &rpcServer{
+		server: s,
+		chain:  s.blockManager.chain,
+	}
+	rest := restServer{
+		execute: func(cmd interface{}) (interface{}, error) {
+			method, err := btcjson.CmdMethod(cmd)
+			if err != nil {
+				return nil, err
+			}
+			return rpcHandlers[method](rpc, cmd, nil)
+		},
+	}
+
+	ipv4ListenAddrs, ipv6ListenAddrs, _, err := parseListeners(listenAddrs)
+	if err != nil {
+		return nil, err
+	}
+	listeners := make([]net.Listener, 0,
+		len(ipv6ListenAddrs)+len(ipv4ListenAddrs))
+	for _, addr := range ipv4ListenAddrs {
+		listener, err := net.Listen("tcp4", addr)
+		if err != nil {
+			rpcsLog.Warnf("Can't listen on %s: %v", addr, err)
+			continue
+		}
+		listeners = append(listeners, listener)
+	}
+	for _, addr := range ipv6ListenAddrs {
+		listener, err := net.Listen("tcp6", addr)
+		if err != nil {
+			rpcsLog.Warnf("Can't listen on %s: %v", addr, err)
+			continue
+		}
+		listeners = append(listeners, listener)
+	}
+	if len(listeners) == 0 {
+		return nil, errors.New("REST: No valid listen address")
+	}
+	rest.listeners = listeners
+
+	return &rest, nil
+}
@@ -0,0 +1,301 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bitgo/prova/btcjson"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/wire"
+)
+
+// TestRESTServer ensures the REST server serves blocks, headers, transactions
+// and the chain and mempool info in all of the supported formats from the
+// results of the RPC handlers, and rejects invalid and unknown resources.
+func TestRESTServer(t *testing.T) {
+	// The chain consists of the genesis block and a header which follows
+	// it.
+	genesis := chaincfg.SimNetParams.GenesisBlock
+	var blockBuf bytes.Buffer
+	if err := genesis.Serialize(&blockBuf); err != nil {
+		t.Fatalf("unable to serialize block: %v", err)
+	}
+	next := wire.BlockHeader{PrevBlock: genesis.BlockHash(), Height: 1}
+	headers := []*wire.BlockHeader{&genesis.Header, &next}
+	var headersBuf bytes.Buffer
+	headerResults := make(map[chainhash.Hash]*btcjson.GetBlockHeaderVerboseResult)
+	for i, header := range headers {
+		if err := header.Serialize(&headersBuf); err != nil {
+			t.Fatalf("unable to serialize header: %v", err)
+		}
+		result := &btcjson.GetBlockHeaderVerboseResult{
+			Hash:   header.BlockHash().String(),
+			Height: int32(header.Height),
+		}
+		if i+1 < len(headers) {
+			result.NextHash = headers[i+1].BlockHash().String()
+		}
+		headerResults[header.BlockHash()] = result
+	}
+	blockHash := genesis.BlockHash()
+	blockResult := &btcjson.GetBlockVerboseTxResult{Hash: blockHash.String()}
+	tx := genesis.Transactions[0]
+	var txBuf bytes.Buffer
+	if err := tx.Serialize(&txBuf); err != nil {
+		t.Fatalf("unable to serialize transaction: %v", err)
+	}
+	txHash := tx.TxHash()
+	txResult := &btcjson.TxRawResult{Txid: txHash.String()}
+	chainInfo := &btcjson.GetBlockChainInfoResult{Chain: "simnet", Blocks: 1}
+	mempoolInfo := &btcjson.GetMempoolInfoResult{Size: 2, Bytes: 500}
+
+	// execute mimics the RPC handlers for the chain above.
+	blockNotFound := &btcjson.RPCError{
+		Code:    btcjson.ErrRPCBlockNotFound,
+		Message: "Block not found",
+	}
+	execute := func(cmd interface{}) (interface{}, error) {
+		switch c := cmd.(type) {
+		case *btcjson.GetBlockCmd:
+			if c.Hash != blockHash.String() {
+				return nil, blockNotFound
+			}
+			if *c.Verbosity == btcjson.GetBlockVerbosityHex {
+				return hex.EncodeToString(blockBuf.Bytes()), nil
+			}
+			return blockResult, nil
+
+		case *btcjson.GetBlockHeaderCmd:
+			hash, err := chainhash.NewHashFromStr(c.Hash)
+			if err != nil {
+				return nil, rpcDecodeHexError(c.Hash)
+			}
+			for _, header := range headers {
+				if header.BlockHash() != *hash {
+					continue
+				}
+				if *c.Verbose {
+					return headerResults[*hash], nil
+				}
+				var buf bytes.Buffer
+				header.Serialize(&buf)
+				return hex.EncodeToString(buf.Bytes()), nil
+			}
+			return nil, blockNotFound
+
+		case *btcjson.GetRawTransactionCmd:
+			if c.Txid != txHash.String() {
+				hash, _ := chainhash.NewHashFromStr(c.Txid)
+				return nil, rpcNoTxInfoError(hash)
+			}
+			if *c.Verbose == 0 {
+				return hex.EncodeToString(txBuf.Bytes()), nil
+			}
+			return txResult, nil
+
+		case *btcjson.GetBlockChainInfoCmd:
+			return chainInfo, nil
+
+		case *btcjson.GetMempoolInfoCmd:
+			return mempoolInfo, nil
+		}
+		t.Fatalf("unexpected command %T", cmd)
+		return nil, nil
+	}
+	server := httptest.NewServer(http.HandlerFunc(
+		(&restServer{execute: execute}).handleRequest))
+	defer server.Close()
+
+	// marshal returns the JSON response for the passed result.
+	marshal := func(result interface{}) []byte {
+		marshalled, err := json.Marshal(result)
+		if err != nil {
+			t.Fatalf("unable to marshal result: %v", err)
+		}
+		return append(marshalled, '\n')
+	}
+	// hexResponse returns the hex response for the passed serialization.
+	hexResponse := func(serialized []byte) []byte {
+		return []byte(hex.EncodeToString(serialized) + "\n")
+	}
+
+	unknownHash := chainhash.Hash{0x01}
+	tests := []struct {
+		name   string
+		path   string
+		status int
+		body   []byte
+	}{
+		{
+			name:   "block bin",
+			path:   "/rest/block/" + blockHash.String() + ".bin",
+			status: http.StatusOK,
+			body:   blockBuf.Bytes(),
+		},
+		{
+			name:   "block hex",
+			path:   "/rest/block/" + blockHash.String() + ".hex",
+			status: http.StatusOK,
+			body:   hexResponse(blockBuf.Bytes()),
+		},
+		{
+			name:   "block json",
+			path:   "/rest/block/" + blockHash.String() + ".json",
+			status: http.StatusOK,
+			body:   marshal(blockResult),
+		},
+		{
+			name:   "unknown block",
+			path:   "/rest/block/" + unknownHash.String() + ".bin",
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "headers bin",
+			path:   "/rest/headers/5/" + blockHash.String() + ".bin",
+			status: http.StatusOK,
+			body:   headersBuf.Bytes(),
+		},
+		{
+			name:   "headers hex",
+			path:   "/rest/headers/2/" + blockHash.String() + ".hex",
+			status: http.StatusOK,
+			body:   hexResponse(headersBuf.Bytes()),
+		},
+		{
+			name:   "headers json",
+			path:   "/rest/headers/1/" + blockHash.String() + ".json",
+			status: http.StatusOK,
+			body: marshal([]*btcjson.GetBlockHeaderVerboseResult{
+				headerResults[blockHash],
+			}),
+		},
+		{
+			name:   "unknown headers",
+			path:   "/rest/headers/1/" + unknownHash.String() + ".json",
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "zero headers",
+			path:   "/rest/headers/0/" + blockHash.String() + ".json",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "too many headers",
+			path:   "/rest/headers/2001/" + blockHash.String() + ".json",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "tx bin",
+			path:   "/rest/tx/" + txHash.String() + ".bin",
+			status: http.StatusOK,
+			body:   txBuf.Bytes(),
+		},
+		{
+			name:   "tx hex",
+			path:   "/rest/tx/" + txHash.String() + ".hex",
+			status: http.StatusOK,
+			body:   hexResponse(txBuf.Bytes()),
+		},
+		{
+			name:   "tx json",
+			path:   "/rest/tx/" + txHash.String() + ".json",
+			status: http.StatusOK,
+			body:   marshal(txResult),
+		},
+		{
+			name:   "unknown tx",
+			path:   "/rest/tx/" + unknownHash.String() + ".json",
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "chaininfo",
+			path:   "/rest/chaininfo.json",
+			status: http.StatusOK,
+			body:   marshal(chainInfo),
+		},
+		{
+			name:   "chaininfo bin",
+			path:   "/rest/chaininfo.bin",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "mempool info",
+			path:   "/rest/mempool/info.json",
+			status: http.StatusOK,
+			body:   marshal(mempoolInfo),
+		},
+		{
+			name:   "short hash",
+			path:   "/rest/block/1234.bin",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "invalid hash",
+			path:   "/rest/tx/" + strings.Repeat("zz", 32) + ".bin",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "missing format",
+			path:   "/rest/block/" + blockHash.String(),
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "unknown format",
+			path:   "/rest/block/" + blockHash.String() + ".xml",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "unknown resource",
+			path:   "/rest/mempool/contents.json",
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "long path",
+			path:   "/rest/block/" + strings.Repeat("0", 200) + ".bin",
+			status: http.StatusBadRequest,
+		},
+	}
+	for _, test := range tests {
+		resp, err := http.Get(server.URL + test.path)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("%s: unable to read body: %v", test.name, err)
+		}
+		if resp.StatusCode != test.status {
+			t.Errorf("%s: got status %d, want %d (%s)", test.name,
+				resp.StatusCode, test.status, body)
+			continue
+		}
+		if test.status == http.StatusOK && !bytes.Equal(body, test.body) {
+			t.Errorf("%s: mismatched body - got %s, want %s",
+				test.name, body, test.body)
+		}
+	}
+
+	// Only GET requests are served.
+	resp, err := http.Post(server.URL+"/rest/chaininfo.json",
+		"application/json", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST: got status %d, want %d", resp.StatusCode,
+			http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,335 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bitgo/prova/btcjson"
+)
+
+// The categories of RPC commands which may be granted to the users added with
+// --rpcauth.  Commands which are not in any of the read, wallet or mining
+// categories are admin commands, which are only available to users they are
+// granted to explicitly.
+const (
+	rpcCategoryRead   = "read"
+	rpcCategoryWallet = "wallet"
+	rpcCategoryMining = "mining"
+	rpcCategoryAdmin  = "admin"
+)
+
+// Commands which only query the state of the server.
+var rpcReadCommands = map[string]struct{}{
+	"decoderawtransaction":   {},
+	"decodescript":           {},
+	"estimatefee":            {},
+	"estimatesmartfee":       {},
+	"getaddednodeinfo":       {},
+	"getaddresstxids":        {},
+	"getadmininfo":           {},
+	"getbestblock":           {},
+	"getbestblockhash":       {},
+	"getblock":               {},
+	"getblockchaininfo":      {},
+	"getblockcount":          {},
+	"getblockhash":           {},
+	"getblockheader":         {},
+	"getblockstats":          {},
+	"getchaintips":           {},
+	"getconnectioncount":     {},
+	"getcurrentnet":          {},
+	"getdbstats":             {},
+	"getdifficulty":          {},
+	"getfinalizedheight":     {},
+	"getheaders":             {},
+	"getinfo":                {},
+	"getmemoryinfo":          {},
+	"getmempoolentry":        {},
+	"getmempoolinfo":         {},
+	"getmetrics":             {},
+	"getnettotals":           {},
+	"getnetworkinfo":         {},
+	"getpeerinfo":            {},
+	"getrawmempool":          {},
+	"getrawtransaction":      {},
+	"getrpcinfo":             {},
+	"gettxout":               {},
+	"gettxoutproof":          {},
+	"gettxoutsetinfo":        {},
+	"getvalidatorinfo":       {},
+	"help":                   {},
+	"listbanned":             {},
+	"notifyadminthreads":     {},
+	"notifyblocks":           {},
+	"notifyvalidatorset":     {},
+	"searchrawtransactions":  {},
+	"session":                {},
+	"stopnotifyadminthreads": {},
+	"stopnotifyblocks":       {},
+	"stopnotifyvalidatorset": {},
+	"uptime":                 {},
+	"validateaddress":        {},
+	"verifymessage":          {},
+	"verifytxoutproof":       {},
+}
+
+// Commands which create, relay and watch transactions.  The commands which
+// need a wallet are included as well.
+var rpcWalletCommands = map[string]struct{}{
+	"createrawtransaction":      {},
+	"fundrawtransaction":        {},
+	"loadtxfilter":              {},
+	"notifynewtransactions":     {},
+	"notifyreceived":            {},
+	"notifyspent":               {},
+	"rescan":                    {},
+	"rescanblocks":              {},
+	"sendrawtransaction":        {},
+	"stopnotifynewtransactions": {},
+	"stopnotifyreceived":        {},
+	"stopnotifyspent":           {},
+}
+
+// Commands which are used to create and submit blocks.
+var rpcMiningCommands = map[string]struct{}{
+	"estimatepriority":      {},
+	"generate":              {},
+	"generateblock":         {},
+	"generatetoaddress":     {},
+	"getblocktemplate":      {},
+	"getgenerate":           {},
+	"gethashespersec":       {},
+	"getmininginfo":         {},
+	"getnetworkhashps":      {},
+	"getwork":               {},
+	"prioritisetransaction": {},
+	"setgenerate":           {},
+	"submitblock":           {},
+}
+
+// rpcCommandCategory returns the category of the command with the passed
+// method.
+func rpcCommandCategory(method string) string {
+	if _, ok := rpcReadCommands[method]; ok {
+		return rpcCategoryRead
+	}
+	if _, ok := rpcWalletCommands[method]; ok {
+		return rpcCategoryWallet
+	}
+	if _, ok := rpcAskWallet[method]; ok {
+		return rpcCategoryWallet
+	}
+	if _, ok := rpcMiningCommands[method]; ok {
+		return rpcCategoryMining
+	}
+	return rpcCategoryAdmin
+}
+
+// isRPCCommand returns whether the passed method is a command known to the RPC
+// server.
+func isRPCCommand(method string) bool {
+	if _, ok := rpcHandlers[method]; ok {
+		return true
+	}
+	if _, ok := wsHandlers[method]; ok {
+		return true
+	}
+	if _, ok := rpcAskWallet[method]; ok {
+		return true
+	}
+	_, ok := rpcUnimplemented[method]
+	return ok
+}
+
+// rpcUser is a set of credentials for the RPC server along with the commands
+// it may execute.
+type rpcUser struct {
+	name    string
+	authsha [sha256.Size]byte
+
+	// commands is the set of commands the user may execute.  The user may
+	// execute all commands when it is nil.
+	commands map[string]struct{}
+
+	// categories is the set of command categories the user may execute
+	// all commands of.
+	categories map[string]struct{}
+
+	// limiter limits how often the user may execute commands.  It is nil
+	// when the user is not rate limited.
+	limiter *rpcRateLimiter
+}
+
+// rpcAuthSha returns the hash of the HTTP basic access authorization header
+// for the passed credentials, which is how credentials are stored and compared.
+func rpcAuthSha(user, pass string) [sha256.Size]byte {
+	login := user + ":" + pass
+	auth := "Basic " + base64.StdEncoding.EncodeToString([]byte(login))
+	return sha256.Sum256([]byte(auth))
+}
+
+// parseRPCAuth parses an RPC user of the form
+// <user>:<password>:<commands>[:<rate>], where commands is a comma separated
+// list of command categories and commands the user may execute, and rate is the
+// maximum number of commands the user may execute per second.  The password may
+// contain colons.
+func parseRPCAuth(value string) (*rpcUser, error) {
+	fields := strings.Split(value, ":")
+	if len(fields) < 3 {
+		return nil, errors.New("format must be " +
+			"<user>:<password>:<commands>[:<rate>]")
+	}
+	name, fields := fields[0], fields[1:]
+	if name == "" {
+		return nil, errors.New("empty user name")
+	}
+
+	// The rate is only present when the last field is a number, since
+	// commands never are.
+	var rate float64
+	if len(fields) > 2 {
+		r, err := strconv.ParseFloat(fields[len(fields)-1], 64)
+		if err == nil {
+			if r <= 0 {
+				return nil, fmt.Errorf("rate %v must be "+
+					"positive", fields[len(fields)-1])
+			}
+			rate = r
+			fields = fields[:len(fields)-1]
+		}
+	}
+	pass := strings.Join(fields[:len(fields)-1], ":")
+	if pass == "" {
+		return nil, errors.New("empty password")
+	}
+
+	user := &rpcUser{
+		name:       name,
+		authsha:    rpcAuthSha(name, pass),
+		commands:   make(map[string]struct{}),
+		categories: make(map[string]struct{}),
+	}
+	for _, command := range strings.Split(fields[len(fields)-1], ",") {
+		command = strings.ToLower(strings.TrimSpace(command))
+		switch {
+		case command == rpcCategoryRead || command == rpcCategoryWallet ||
+			command == rpcCategoryMining || command == rpcCategoryAdmin:
+			user.categories[command] = struct{}{}
+		case isRPCCommand(command):
+			user.commands[command] = struct{}{}
+		default:
+			return nil, fmt.Errorf("unknown command or category %q",
+				command)
+		}
+	}
+	if rate != 0 {
+		user.limiter = newRPCRateLimiter(rate)
+	}
+	return user, nil
+}
+
+// permits returns whether the user may execute the command with the passed
+// method.
+func (u *rpcUser) permits(method string) bool {
+	if u.commands == nil {
+		return true
+	}
+	if _, ok := u.commands[method]; ok {
+		return true
+	}
+	_, ok := u.categories[rpcCommandCategory(method)]
+	return ok
+}
+
+// rpcRateLimiter is a token bucket which limits how often a user may execute
+// commands.  The bucket holds up to a second worth of commands, and at least
+// one.
+type rpcRateLimiter struct {
+	mtx    sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newRPCRateLimiter returns a full rate limiter which allows rate commands per
+// second.
+func newRPCRateLimiter(rate float64) *rpcRateLimiter {
+	burst := rate
+	if burst < 1 {
+		burst = 1
+	}
+	return &rpcRateLimiter{rate: rate, burst: burst, tokens: burst}
+}
+
+// allow returns whether a command may be executed at the passed time, taking
+// a token from the bucket when it may.
+//
+// This function is safe for concurrent access.
+func (l *rpcRateLimiter) allow(now time.Time) bool {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	if !l.last.IsZero() && now.After(l.last) {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	if now.After(l.last) {
+		l.last = now
+	}
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// authenticate returns the user the passed HTTP basic access authorization
+// header belongs to, or nil when it does not belong to any user.  The header is
+// compared with the credentials of every user in constant time, so neither the
+// result nor the time it takes reveals whether a user name exists.
+//
+// This function is safe for concurrent access.
+func (s *rpcServer) authenticate(auth string) *rpcUser {
+	authsha := sha256.Sum256([]byte(auth))
+	var match *rpcUser
+	for _, user := range s.users {
+		if subtle.ConstantTimeCompare(authsha[:], user.authsha[:]) == 1 {
+			match = user
+		}
+	}
+	return match
+}
+
+// authorize returns an error suitable for replies when the passed user may not
+// execute the command with the passed method or has exceeded its rate limit.
+//
+// This function is safe for concurrent access.
+func (s *rpcServer) authorize(user *rpcUser, method string) error {
+	if !user.permits(method) {
+		return &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParams.Code,
+			Message: "user not authorized for this method",
+		}
+	}
+	if user.limiter != nil && !user.limiter.allow(time.Now()) {
+		return &btcjson.RPCError{
+			Code:    btcjson.ErrRPCRateLimited,
+			Message: "rate limit exceeded",
+		}
+	}
+	return nil
+}
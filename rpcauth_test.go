@@ -0,0 +1,200 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/bitgo/prova/btcjson"
+)
+
+// basicAuth returns the HTTP basic access authorization header for the passed
+// credentials.
+func basicAuth(user, pass string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+pass))
+}
+
+// TestParseRPCAuth ensures RPC users are parsed along with their granted
+// commands and rate, and invalid values are rejected.
+func TestParseRPCAuth(t *testing.T) {
+	tests := []struct {
+		value      string
+		name       string
+		pass       string
+		commands   int
+		categories int
+		rate       float64
+		err        bool
+	}{
+		{value: "dash:secret:read", name: "dash", pass: "secret",
+			categories: 1},
+		{value: "pool:secret:mining,getblockcount:10", name: "pool",
+			pass: "secret", commands: 1, categories: 1, rate: 10},
+		{value: "ops:se:cr:et:Admin, setban:0.5", name: "ops",
+			pass: "se:cr:et", commands: 1, categories: 1, rate: 0.5},
+		{value: "dash:secret", err: true},
+		{value: ":secret:read", err: true},
+		{value: "dash::read", err: true},
+		{value: "dash:secret:", err: true},
+		{value: "dash:secret:10", err: true},
+		{value: "dash:secret:read:-1", err: true},
+		{value: "dash:secret:read,unknowncommand", err: true},
+	}
+	for _, test := range tests {
+		user, err := parseRPCAuth(test.value)
+		if test.err {
+			if err == nil {
+				t.Errorf("parseRPCAuth(%q): no error", test.value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseRPCAuth(%q): unexpected error: %v",
+				test.value, err)
+			continue
+		}
+		var rate float64
+		if user.limiter != nil {
+			rate = user.limiter.rate
+		}
+		if user.name != test.name ||
+			user.authsha != rpcAuthSha(test.name, test.pass) ||
+			len(user.commands) != test.commands ||
+			len(user.categories) != test.categories ||
+			rate != test.rate {
+
+			t.Errorf("parseRPCAuth(%q): unexpected user %+v",
+				test.value, user)
+		}
+	}
+}
+
+// TestRPCAuthorization ensures users are authenticated without revealing
+// whether a user name exists and may only execute the commands they were
+// granted, with the admin commands only available when granted explicitly.
+func TestRPCAuthorization(t *testing.T) {
+	s := &rpcServer{users: []*rpcUser{
+		{name: "admin", authsha: rpcAuthSha("admin", "adminpass")},
+		{name: "limited", authsha: rpcAuthSha("limited", "limitpass"),
+			commands: rpcLimited},
+	}}
+	for _, value := range []string{"dash:dashpass:read",
+		"pool:poolpass:mining", "all:allpass:read,wallet,mining",
+		"banner:bannerpass:read,setban", "ops:opspass:admin"} {
+
+		user, err := parseRPCAuth(value)
+		if err != nil {
+			t.Fatalf("parseRPCAuth(%q): unexpected error: %v", value,
+				err)
+		}
+		s.users = append(s.users, user)
+	}
+
+	// Unknown users and wrong passwords are treated the same.
+	for _, auth := range []string{basicAuth("dash", "wrong"),
+		basicAuth("nobody", "dashpass"), basicAuth("", ""), ""} {
+
+		if user := s.authenticate(auth); user != nil {
+			t.Errorf("authenticate(%q): got user %v", auth, user.name)
+		}
+	}
+
+	tests := []struct {
+		user    string
+		method  string
+		allowed bool
+	}{
+		{"dash", "getblockcount", true},
+		{"dash", "submitblock", false},
+		{"dash", "getblocktemplate", false},
+		{"dash", "sendrawtransaction", false},
+		{"dash", "notifyblocks", true},
+		{"dash", "getmetrics", true},
+		{"pool", "getmetrics", false},
+		{"pool", "submitblock", true},
+		{"pool", "getblocktemplate", true},
+		{"pool", "getblockcount", false},
+		{"dash", "fundrawtransaction", false},
+		{"all", "sendrawtransaction", true},
+		{"all", "fundrawtransaction", true},
+		{"all", "getblockcount", true},
+		{"all", "provisionvalidator", false},
+		{"all", "invalidateblock", false},
+		{"all", "setban", false},
+		{"banner", "setban", true},
+		{"banner", "provisionvalidator", false},
+		{"ops", "provisionvalidator", true},
+		{"ops", "invalidateblock", true},
+		{"ops", "getblockcount", false},
+		{"limited", "getblockcount", true},
+		{"limited", "submitblock", true},
+		{"limited", "setban", false},
+		{"admin", "provisionvalidator", true},
+		{"admin", "getblockcount", true},
+	}
+	passes := map[string]string{"admin": "adminpass",
+		"limited": "limitpass", "dash": "dashpass", "pool": "poolpass",
+		"all": "allpass", "banner": "bannerpass", "ops": "opspass"}
+	for _, test := range tests {
+		user := s.authenticate(basicAuth(test.user, passes[test.user]))
+		if user == nil || user.name != test.user {
+			t.Errorf("authenticate(%s): got user %v", test.user, user)
+			continue
+		}
+		err := s.authorize(user, test.method)
+		if test.allowed != (err == nil) {
+			t.Errorf("authorize(%s, %s): unexpected error %v",
+				test.user, test.method, err)
+		}
+	}
+}
+
+// TestRPCRateLimiter ensures users are limited to their rate of commands per
+// second with bursts of up to a second worth of commands.
+func TestRPCRateLimiter(t *testing.T) {
+	now := time.Unix(1502385451, 0)
+	l := newRPCRateLimiter(2)
+	if !l.allow(now) || !l.allow(now) || l.allow(now) {
+		t.Fatalf("allow: burst of two commands not enforced")
+	}
+	if !l.allow(now.Add(500*time.Millisecond)) ||
+		l.allow(now.Add(500*time.Millisecond)) {
+
+		t.Fatalf("allow: rate of two commands per second not enforced")
+	}
+
+	// Idle time does not accumulate beyond the burst.
+	now = now.Add(time.Hour)
+	if !l.allow(now) || !l.allow(now) || l.allow(now) {
+		t.Fatalf("allow: burst exceeded after idling")
+	}
+
+	// Slow rates allow a single command.
+	l = newRPCRateLimiter(0.5)
+	if !l.allow(now) || l.allow(now.Add(time.Second)) ||
+		!l.allow(now.Add(2*time.Second)) {
+
+		t.Fatalf("allow: rate of one command every two seconds not " +
+			"enforced")
+	}
+
+	// Users which exceed their rate are refused.
+	user, err := parseRPCAuth("dash:dashpass:read:1")
+	if err != nil {
+		t.Fatalf("parseRPCAuth: unexpected error: %v", err)
+	}
+	s := &rpcServer{users: []*rpcUser{user}}
+	if err := s.authorize(user, "getblockcount"); err != nil {
+		t.Fatalf("authorize: unexpected error: %v", err)
+	}
+	err = s.authorize(user, "getblockcount")
+	if rpcErr, ok := err.(*btcjson.RPCError); !ok ||
+		rpcErr.Code != btcjson.ErrRPCRateLimited {
+
+		t.Fatalf("authorize: got error %v, want rate limit", err)
+	}
+}
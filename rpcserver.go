@@ -8,33 +8,39 @@ package main
 
 import (
 	"bytes"
-	"crypto/sha256"
-	"crypto/subtle"
 	"crypto/tls"
-	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/bitgo/prova/addrmgr"
 	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/blockchain/indexers"
 	"github.com/bitgo/prova/btcec"
 	"github.com/bitgo/prova/btcjson"
 	"github.com/bitgo/prova/chaincfg"
 	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/connmgr"
 	"github.com/bitgo/prova/database"
 	"github.com/bitgo/prova/mempool"
+	"github.com/bitgo/prova/metrics"
 	"github.com/bitgo/prova/mining"
+	"github.com/bitgo/prova/peer"
 	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/provautil/bloom"
 	"github.com/bitgo/prova/txscript"
 	"github.com/bitgo/prova/wire"
 	"github.com/btcsuite/websocket"
 	"io"
 	"io/ioutil"
+	"math"
 	"math/big"
 	"math/rand"
 	"net"
 	"net/http"
 	"os"
+	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -48,6 +54,11 @@ const (
 	// is closed.
 	rpcAuthTimeoutSeconds = 10
 
+	// rpcMaxRequestSize is the maximum number of bytes of the body of an
+	// HTTP POST JSON-RPC request.  It leaves room for a hex encoded block
+	// of the maximum message size passed to submitblock.
+	rpcMaxRequestSize = 2*wire.MaxMessagePayload + 1024
+
 	// uint256Size is the number of bytes needed to represent an unsigned
 	// 256-bit integer.
 	uint256Size = 32
@@ -68,13 +79,11 @@ const (
 )
 
 var (
-	// gbtMutableFields are the manipulations the server allows to be made
-	// to block templates generated by the getblocktemplate RPC.  It is
-	// declared here to avoid the overhead of creating the slice on every
-	// invocation for constant data.
-	gbtMutableFields = []string{
-		"time", "transactions/add", "prevblock", "coinbase/append",
-	}
+	// gbtMutableFields are the manipulations the server always allows to be
+	// made to block templates generated by the getblocktemplate RPC.  The
+	// remaining manipulations depend on the mining policy and the requested
+	// coinbase and are added by gbtMutations.
+	gbtMutableFields = []string{"time", "prevblock"}
 
 	// gbtCoinbaseAux describes additional data that miners should include
 	// in the coinbase signature script.  It is declared here to avoid the
@@ -90,7 +99,7 @@ var (
 	// block template generated by the getblocktemplate RPC.    It is
 	// declared here to avoid the overhead of creating the slice on every
 	// invocation for constant data.
-	gbtCapabilities = []string{"proposal"}
+	gbtCapabilities = []string{"longpoll", "proposal"}
 )
 
 // Errors
@@ -118,46 +127,75 @@ type commandHandler func(*rpcServer, interface{}, <-chan struct{}) (interface{},
 var rpcHandlers map[string]commandHandler
 var rpcHandlersBeforeInit = map[string]commandHandler{
 	"addnode":               handleAddNode,
+	"clearbanned":           handleClearBanned,
+	"compactdb":             handleCompactDB,
 	"createrawtransaction":  handleCreateRawTransaction,
 	"debuglevel":            handleDebugLevel,
 	"decoderawtransaction":  handleDecodeRawTransaction,
+	"decodescript":          handleDecodeScript,
+	"estimatefee":           handleEstimateFee,
+	"estimatesmartfee":      handleEstimateSmartFee,
+	"fundrawtransaction":    handleFundRawTransaction,
 	"generate":              handleGenerate,
+	"generateblock":         handleGenerateBlock,
+	"generatetoaddress":     handleGenerateToAddress,
 	"getaddednodeinfo":      handleGetAddedNodeInfo,
 	"getaddresstxids":       handleGetAddressTxIds,
 	"getadmininfo":          handleGetAdminInfo,
 	"getbestblock":          handleGetBestBlock,
 	"getbestblockhash":      handleGetBestBlockHash,
 	"getblock":              handleGetBlock,
+	"getblockchaininfo":     handleGetBlockChainInfo,
 	"getblockcount":         handleGetBlockCount,
 	"getblockhash":          handleGetBlockHash,
 	"getblockheader":        handleGetBlockHeader,
+	"getblockstats":         handleGetBlockStats,
 	"getblocktemplate":      handleGetBlockTemplate,
+	"getchaintips":          handleGetChainTips,
 	"getconnectioncount":    handleGetConnectionCount,
 	"getcurrentnet":         handleGetCurrentNet,
+	"getdbstats":            handleGetDBStats,
 	"getdifficulty":         handleGetDifficulty,
+	"getfinalizedheight":    handleGetFinalizedHeight,
 	"getgenerate":           handleGetGenerate,
 	"gethashespersec":       handleGetHashesPerSec,
 	"getheaders":            handleGetHeaders,
 	"getinfo":               handleGetInfo,
+	"getmemoryinfo":         handleGetMemoryInfo,
+	"getmempoolentry":       handleGetMempoolEntry,
 	"getmempoolinfo":        handleGetMempoolInfo,
+	"getmetrics":            handleGetMetrics,
 	"getmininginfo":         handleGetMiningInfo,
 	"getnettotals":          handleGetNetTotals,
 	"getnetworkhashps":      handleGetNetworkHashPS,
 	"getpeerinfo":           handleGetPeerInfo,
+	"getpendingbroadcasts":  handleGetPendingBroadcasts,
 	"getrawmempool":         handleGetRawMempool,
 	"getrawtransaction":     handleGetRawTransaction,
+	"getrpcinfo":            handleGetRPCInfo,
 	"gettxout":              handleGetTxOut,
+	"gettxoutproof":         handleGetTxOutProof,
+	"gettxoutsetinfo":       handleGetTxOutSetInfo,
+	"getvalidatorinfo":      handleGetValidatorInfo,
 	"help":                  handleHelp,
+	"invalidateblock":       handleInvalidateBlock,
+	"listbanned":            handleListBanned,
 	"node":                  handleNode,
 	"ping":                  handlePing,
+	"prioritisetransaction": handlePrioritiseTransaction,
+	"provisionvalidator":    handleProvisionValidator,
+	"revokevalidator":       handleRevokeValidator,
 	"searchrawtransactions": handleSearchRawTransactions,
 	"sendrawtransaction":    handleSendRawTransaction,
+	"setban":                handleSetBan,
 	"setgenerate":           handleSetGenerate,
 	"setvalidatekeys":       handleSetValidateKeys,
 	"stop":                  handleStop,
 	"submitblock":           handleSubmitBlock,
+	"uptime":                handleUptime,
 	"validateaddress":       handleValidateAddress,
 	"verifychain":           handleVerifyChain,
+	"verifytxoutproof":      handleVerifyTxOutProof,
 }
 
 // list of commands that we recognize, but for which there is no support because
@@ -179,7 +217,6 @@ var rpcAskWallet = map[string]struct{}{
 	"getreceivedbyaccount":   {},
 	"getreceivedbyaddress":   {},
 	"gettransaction":         {},
-	"gettxoutsetinfo":        {},
 	"getunconfirmedbalance":  {},
 	"getwalletinfo":          {},
 	"importprivkey":          {},
@@ -209,29 +246,28 @@ var rpcAskWallet = map[string]struct{}{
 
 // Commands that are currently unimplemented, but should ultimately be.
 var rpcUnimplemented = map[string]struct{}{
-	"estimatefee":       {},
-	"estimatepriority":  {},
-	"getblockchaininfo": {},
-	"getchaintips":      {},
-	"getmempoolentry":   {},
-	"getnetworkinfo":    {},
-	"getwork":           {},
-	"invalidateblock":   {},
-	"preciousblock":     {},
-	"reconsiderblock":   {},
+	"estimatepriority": {},
+	"getnetworkinfo":   {},
+	"getwork":          {},
+	"preciousblock":    {},
+	"reconsiderblock":  {},
 }
 
 // Commands that are available to a limited user
 var rpcLimited = map[string]struct{}{
 	// Websockets commands
-	"loadtxfilter":          {},
-	"notifyblocks":          {},
-	"notifynewtransactions": {},
-	"notifyreceived":        {},
-	"notifyspent":           {},
-	"rescan":                {},
-	"rescanblocks":          {},
-	"session":               {},
+	"loadtxfilter":           {},
+	"notifyadminthreads":     {},
+	"notifyblocks":           {},
+	"notifynewtransactions":  {},
+	"notifyreceived":         {},
+	"notifyspent":            {},
+	"notifyvalidatorset":     {},
+	"rescan":                 {},
+	"rescanblocks":           {},
+	"session":                {},
+	"stopnotifyadminthreads": {},
+	"stopnotifyvalidatorset": {},
 
 	// Websockets AND HTTP/S commands
 	"help": {},
@@ -240,27 +276,51 @@ var rpcLimited = map[string]struct{}{
 	"createrawtransaction":  {},
 	"decoderawtransaction":  {},
 	"decodescript":          {},
+	"estimatefee":           {},
+	"estimatesmartfee":      {},
+	"fundrawtransaction":    {},
 	"getaddresstxids":       {},
 	"getadmininfo":          {},
 	"getbestblock":          {},
 	"getbestblockhash":      {},
 	"getblock":              {},
+	"getblockchaininfo":     {},
 	"getblockcount":         {},
 	"getblockhash":          {},
+	"getblockstats":         {},
+	"getchaintips":          {},
 	"getcurrentnet":         {},
+	"getdbstats":            {},
 	"getdifficulty":         {},
+	"getfinalizedheight":    {},
 	"getheaders":            {},
 	"getinfo":               {},
+	"getmemoryinfo":         {},
+	"getmempoolentry":       {},
+	"getmetrics":            {},
 	"getnettotals":          {},
 	"getnetworkhashps":      {},
 	"getrawmempool":         {},
 	"getrawtransaction":     {},
 	"gettxout":              {},
+	"gettxoutproof":         {},
+	"gettxoutsetinfo":       {},
+	"getvalidatorinfo":      {},
 	"searchrawtransactions": {},
 	"sendrawtransaction":    {},
 	"submitblock":           {},
+	"uptime":                {},
 	"validateaddress":       {},
 	"verifymessage":         {},
+	"verifytxoutproof":      {},
+}
+
+// Commands that are exempt from the limits on the number of RPC clients and
+// concurrent websocket requests, so the server can be inspected under load.
+var rpcUnlimited = map[string]struct{}{
+	"getmemoryinfo": {},
+	"getrpcinfo":    {},
+	"uptime":        {},
 }
 
 // builderScript is a convenience function which is used for hard-coded scripts
@@ -312,19 +372,24 @@ type gbtWorkState struct {
 	sync.Mutex
 	lastTxUpdate  time.Time
 	lastGenerated time.Time
+	generation    uint64
+	newFees       provautil.Amount
 	prevHash      *chainhash.Hash
 	minTimestamp  time.Time
 	template      *mining.BlockTemplate
-	notifyMap     map[chainhash.Hash]map[int64]chan struct{}
+	validateKey   *btcec.PrivateKey
+	notifyMap     map[chainhash.Hash]map[uint64]chan struct{}
 	timeSource    blockchain.MedianTimeSource
+	policy        *mining.Policy
 }
 
 // newGbtWorkState returns a new instance of a gbtWorkState with all internal
 // fields initialized and ready to use.
-func newGbtWorkState(timeSource blockchain.MedianTimeSource) *gbtWorkState {
+func newGbtWorkState(timeSource blockchain.MedianTimeSource, policy *mining.Policy) *gbtWorkState {
 	return &gbtWorkState{
-		notifyMap:  make(map[chainhash.Hash]map[int64]chan struct{}),
+		notifyMap:  make(map[chainhash.Hash]map[uint64]chan struct{}),
 		timeSource: timeSource,
+		policy:     policy,
 	}
 }
 
@@ -486,6 +551,87 @@ func messageToHex(msg wire.Message) (string, error) {
 	return hex.EncodeToString(buf.Bytes()), nil
 }
 
+// handleClearBanned implements the clearbanned command.
+func handleClearBanned(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	s.server.banManager.ClearBans()
+	return nil, nil
+}
+
+// handleCompactDB implements the compactdb command.
+func handleCompactDB(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.CompactDBCmd)
+
+	var bucket []byte
+	if c.Bucket != nil {
+		bucket = []byte(*c.Bucket)
+	}
+
+	// Write the utxo set modifications of the connected blocks which are
+	// still pending first, so the data they delete and overwrite is
+	// reclaimed by the compaction as well.
+	if err := s.chain.FlushUtxoBatch(); err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCDatabase,
+			Message: "Failed to write utxo set: " + err.Error(),
+		}
+	}
+
+	before, err := s.server.db.Stats()
+	if err != nil {
+		return nil, internalRPCError(err.Error(), "Failed to fetch "+
+			"database stats")
+	}
+
+	// Abort the compaction when the RPC server is shutting down.
+	interrupt := make(chan struct{})
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-s.quit:
+			close(interrupt)
+		case <-done:
+		}
+	}()
+
+	rpcsLog.Infof("Compacting database")
+	start := time.Now()
+	err = s.server.db.Compact(bucket, interrupt)
+	if err != nil {
+		if dbErr, ok := err.(database.Error); ok &&
+			dbErr.ErrorCode == database.ErrBucketNotFound {
+
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCInvalidParameter,
+				Message: dbErr.Description,
+			}
+		}
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCDatabase,
+			Message: "Failed to compact database: " + err.Error(),
+		}
+	}
+	elapsed := time.Since(start)
+
+	after, err := s.server.db.Stats()
+	if err != nil {
+		return nil, internalRPCError(err.Error(), "Failed to fetch "+
+			"database stats")
+	}
+	rpcsLog.Infof("Compacted database in %v, metadata size %d -> %d "+
+		"bytes", elapsed, before.MetadataSize, after.MetadataSize)
+
+	result := &btcjson.CompactDBResult{
+		SizeBefore: before.MetadataSize,
+		SizeAfter:  after.MetadataSize,
+		Seconds:    elapsed.Seconds(),
+	}
+	if c.Bucket != nil {
+		result.Bucket = *c.Bucket
+	}
+	return result, nil
+}
+
 // handleCreateRawTransaction handles createrawtransaction commands.
 func handleCreateRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*btcjson.CreateRawTransactionCmd)
@@ -527,32 +673,12 @@ func handleCreateRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan
 			}
 		}
 
-		// Decode the provided address.
-		addr, err := provautil.DecodeAddress(encodedAddr,
-			activeNetParams.Params)
+		// Decode the provided address and ensure it is a Prova address
+		// for the network the server is currently on.
+		addr, err := decodeProvaAddress(encodedAddr,
+			s.server.chainParams)
 		if err != nil {
-			return nil, &btcjson.RPCError{
-				Code:    btcjson.ErrRPCInvalidAddressOrKey,
-				Message: "Invalid address or key: " + err.Error(),
-			}
-		}
-
-		// Ensure the address is one of the supported types and that
-		// the network encoded with the address matches the network the
-		// server is currently on.
-		switch addr.(type) {
-		default:
-			return nil, &btcjson.RPCError{
-				Code:    btcjson.ErrRPCInvalidAddressOrKey,
-				Message: "Invalid address or key",
-			}
-		}
-		if !addr.IsForNet(s.server.chainParams) {
-			return nil, &btcjson.RPCError{
-				Code: btcjson.ErrRPCInvalidAddressOrKey,
-				Message: "Invalid address: " + encodedAddr +
-					" is for the wrong network",
-			}
+			return nil, err
 		}
 
 		// Create a new script which pays to the provided address.
@@ -586,7 +712,33 @@ func handleCreateRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan
 	if err != nil {
 		return nil, err
 	}
-	return mtxHex, nil
+	if c.Verbose == nil || !*c.Verbose {
+		return mtxHex, nil
+	}
+
+	// Compute the fee from the outputs spent by the inputs, which must be
+	// known to the server.
+	var fee int64
+	for _, txIn := range mtx.TxIn {
+		out, err := fetchFundingOutput(s, &txIn.PreviousOutPoint)
+		if err != nil {
+			return nil, err
+		}
+		fee += out.amount
+	}
+	for _, txOut := range mtx.TxOut {
+		fee -= txOut.Value
+	}
+	if fee < 0 {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Outputs exceed the amount of the inputs",
+		}
+	}
+	return &btcjson.CreateRawTransactionResult{
+		Hex: mtxHex,
+		Fee: provautil.Amount(fee).ToRMG(),
+	}, nil
 }
 
 type addressToKey struct {
@@ -598,10 +750,11 @@ type addressToKey struct {
 func handleDebugLevel(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*btcjson.DebugLevelCmd)
 
-	// Special show command to list supported subsystems.
+	// Special show command to list supported subsystems along with their
+	// current levels.
 	if c.LevelSpec == "show" {
 		return fmt.Sprintf("Supported subsystems %v",
-			supportedSubsystems()), nil
+			subsystemLogLevels()), nil
 	}
 
 	err := parseAndSetDebugLevels(c.LevelSpec)
@@ -653,28 +806,15 @@ func createVoutList(mtx *wire.MsgTx, chainParams *chaincfg.Params, filterAddrMap
 	threadInt, _ := txscript.GetAdminDetailsMsgTx(mtx)
 	isAdmin := provautil.ThreadID(threadInt) == provautil.RootThread || provautil.ThreadID(threadInt) == provautil.ProvisionThread
 	for i, v := range mtx.TxOut {
-		// The disassembled string will contain [error] inline if the
-		// script doesn't fully parse, so ignore the error here.
-		disbuf, _ := txscript.DisasmString(v.PkScript)
-
-		// Ignore the error here since an error means the script
-		// couldn't parse and there is no additional information about
-		// it anyways.
-		scriptClass, addrs, reqSigs, _ := txscript.ExtractPkScriptAddrs(
-			v.PkScript, chainParams)
+		scriptPubKey := scriptPubKeyResult(v.PkScript, chainParams, isAdmin)
 
-		// Encode the addresses while checking if the address passes the
-		// filter when needed.
+		// Check if any of the addresses passes the filter when needed.
 		passesFilter := len(filterAddrMap) == 0
-		encodedAddrs := make([]string, len(addrs))
-		for j, addr := range addrs {
-			encodedAddr := addr.EncodeAddress()
-			encodedAddrs[j] = encodedAddr
-
+		for _, encodedAddr := range scriptPubKey.Addresses {
 			// No need to check the map again if the filter already
 			// passes.
 			if passesFilter {
-				continue
+				break
 			}
 			if _, exists := filterAddrMap[encodedAddr]; exists {
 				passesFilter = true
@@ -688,22 +828,67 @@ func createVoutList(mtx *wire.MsgTx, chainParams *chaincfg.Params, filterAddrMap
 		var vout btcjson.Vout
 		vout.N = uint32(i)
 		vout.Value = provautil.Amount(v.Value).ToRMG()
-		vout.ScriptPubKey.Addresses = encodedAddrs
-		vout.ScriptPubKey.Asm = disbuf
-		vout.ScriptPubKey.Hex = hex.EncodeToString(v.PkScript)
-		vout.ScriptPubKey.Type = scriptClass.String()
-		vout.ScriptPubKey.ReqSigs = int32(reqSigs)
-
-		if isAdmin && scriptClass == txscript.NullDataTy {
-			vout.ScriptPubKey.AdminOp = txscript.AdminOpString(v.PkScript)
-		}
-
+		vout.ScriptPubKey = scriptPubKey
 		voutList = append(voutList, vout)
 	}
 
 	return voutList
 }
 
+// scriptPubKeyResult describes the passed public key script along with the key
+// ids of Prova scripts and the thread of admin thread scripts.  Admin
+// operations are only interpreted when describeAdminOp is set, since they only
+// take effect in the transactions of the admin threads which may carry them.
+func scriptPubKeyResult(pkScript []byte, chainParams *chaincfg.Params, describeAdminOp bool) btcjson.ScriptPubKeyResult {
+	// The disassembled string will contain [error] inline if the script
+	// doesn't fully parse, so ignore the error here.
+	disbuf, _ := txscript.DisasmString(pkScript)
+
+	// Ignore the error here since an error means the script couldn't parse
+	// and there is no additional information about it anyways.
+	scriptClass, addrs, reqSigs, _ := txscript.ExtractPkScriptAddrs(
+		pkScript, chainParams)
+
+	result := btcjson.ScriptPubKeyResult{
+		Asm:     disbuf,
+		Hex:     hex.EncodeToString(pkScript),
+		ReqSigs: int32(reqSigs),
+		Type:    scriptClass.String(),
+	}
+	result.Addresses = make([]string, len(addrs))
+	for i, addr := range addrs {
+		result.Addresses[i] = addr.EncodeAddress()
+	}
+
+	pops, err := txscript.ParseScript(pkScript)
+	if err != nil {
+		return result
+	}
+	switch scriptClass {
+	case txscript.ProvaTy, txscript.GeneralProvaTy, txscript.ProvaTimeLockTy:
+		keyIDs, err := txscript.ExtractKeyIDs(pops)
+		if err != nil {
+			break
+		}
+		result.KeyIDs = make([]uint32, len(keyIDs))
+		for i, keyID := range keyIDs {
+			result.KeyIDs[i] = uint32(keyID)
+		}
+
+	case txscript.ProvaAdminTy:
+		threadID, err := txscript.ExtractThreadID(pops)
+		if err == nil {
+			result.Thread = adminThreadNames[threadID]
+		}
+
+	case txscript.ProvaAdminOpTy:
+		if describeAdminOp {
+			result.AdminOp = txscript.AdminOpString(pkScript)
+		}
+	}
+	return result
+}
+
 // createTxRawResult converts the passed transaction and associated parameters
 // to a raw transaction JSON object.
 func createTxRawResult(chainParams *chaincfg.Params, mtx *wire.MsgTx,
@@ -768,6 +953,114 @@ func handleDecodeRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan
 	return txReply, nil
 }
 
+// handleDecodeScript handles decodescript commands.
+func handleDecodeScript(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.DecodeScriptCmd)
+
+	// Convert the hex script to bytes.
+	hexStr := c.HexScript
+	if len(hexStr)%2 != 0 {
+		hexStr = "0" + hexStr
+	}
+	script, err := hex.DecodeString(hexStr)
+	if err != nil {
+		return nil, rpcDecodeHexError(hexStr)
+	}
+
+	// Admin operations are interpreted since there is no transaction to
+	// tell whether they belong to an admin thread.
+	scriptPubKey := scriptPubKeyResult(script, s.server.chainParams, true)
+	reply := btcjson.DecodeScriptResult{
+		Asm:       scriptPubKey.Asm,
+		ReqSigs:   scriptPubKey.ReqSigs,
+		Type:      scriptPubKey.Type,
+		KeyIDs:    scriptPubKey.KeyIDs,
+		Thread:    scriptPubKey.Thread,
+		AdminOp:   scriptPubKey.AdminOp,
+		Addresses: scriptPubKey.Addresses,
+	}
+	return reply, nil
+}
+
+// estimateConfTarget validates the passed confirmation target of a fee
+// estimation command.
+func estimateConfTarget(confTarget int64) (uint32, error) {
+	if confTarget < 1 || confTarget > mempool.MaxEstimateFeeTarget {
+		return 0, &btcjson.RPCError{
+			Code: btcjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("Confirmation target must be between "+
+				"1 and %d", mempool.MaxEstimateFeeTarget),
+		}
+	}
+	return uint32(confTarget), nil
+}
+
+// estimateSmartFee returns the estimatesmartfee result for the passed
+// confirmation target and estimate mode.  The passed minimum fee rate of the
+// memory pool in atoms/kB is reported alongside the estimate so callers can
+// pay the higher of the two.
+func estimateSmartFee(estimator *mempool.FeeEstimator, confTarget int64, estimateMode string, minFeeRate int64) (*btcjson.EstimateSmartFeeResult, error) {
+	numBlocks, err := estimateConfTarget(confTarget)
+	if err != nil {
+		return nil, err
+	}
+
+	var conservative bool
+	switch btcjson.EstimateSmartFeeMode(strings.ToUpper(estimateMode)) {
+	case btcjson.EstimateModeConservative:
+		conservative = true
+	case btcjson.EstimateModeEconomical:
+	default:
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Invalid estimate mode: " + estimateMode,
+		}
+	}
+
+	result := &btcjson.EstimateSmartFeeResult{
+		MempoolMinFee: provautil.Amount(minFeeRate).ToRMG(),
+	}
+	feeRate, blocks, err := estimator.EstimateFee(numBlocks, conservative)
+	if err == mempool.ErrInsufficientFeeData {
+		result.Errors = []string{"Insufficient data or no fee rate found"}
+		return result, nil
+	}
+	if err != nil {
+		return nil, internalRPCError(err.Error(), "Unable to estimate fee")
+	}
+	rate := feeRate.ToRMG()
+	result.FeeRate = &rate
+	result.Blocks = int64(blocks)
+	return result, nil
+}
+
+// handleEstimateFee implements the estimatefee command.  It returns the
+// economical fee rate estimate in RMG/kB, or -1 when there is not enough data
+// to produce one.
+func handleEstimateFee(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.EstimateFeeCmd)
+	numBlocks, err := estimateConfTarget(c.NumBlocks)
+	if err != nil {
+		return nil, err
+	}
+
+	feeRate, _, err := s.server.feeEstimator.EstimateFee(numBlocks, false)
+	if err == mempool.ErrInsufficientFeeData {
+		return -1.0, nil
+	}
+	if err != nil {
+		return nil, internalRPCError(err.Error(), "Unable to estimate fee")
+	}
+	return feeRate.ToRMG(), nil
+}
+
+// handleEstimateSmartFee implements the estimatesmartfee command.
+func handleEstimateSmartFee(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.EstimateSmartFeeCmd)
+	return estimateSmartFee(s.server.feeEstimator, c.ConfTarget,
+		*c.EstimateMode, s.server.txMemPool.MinRelayFeeRate())
+}
+
 // handleGenerate handles generate commands.
 func handleGenerate(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	// Respond with an error if there are no addresses to pay the
@@ -831,20 +1124,213 @@ func handleGenerate(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (i
 	return reply, nil
 }
 
+// generateAddress decodes the passed address generated blocks are paid to and
+// ensures it is usable on the active network.
+func generateAddress(addrStr string, params *chaincfg.Params) (provautil.Address, error) {
+	addr, err := provautil.DecodeAddress(addrStr, params)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidAddressOrKey,
+			Message: "Invalid address or key: " + err.Error(),
+		}
+	}
+	if !addr.IsForNet(params) {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCInvalidAddressOrKey,
+			Message: "Address " + addrStr + " is not for the active " +
+				"network " + params.Name,
+		}
+	}
+	return addr, nil
+}
+
+// checkGenerate returns an error if blocks can't be generated by the CPU miner
+// on the active network, either because the network doesn't support it or
+// because there are no validate keys to sign the blocks with.
+func checkGenerate(s *rpcServer) error {
+	params := s.server.chainParams
+	if !params.GenerateSupported {
+		return &btcjson.RPCError{
+			Code: btcjson.ErrRPCDifficulty,
+			Message: fmt.Sprintf("No support for block generation "+
+				"on the current network, %s, as it's unlikely to "+
+				"be possible to mine a block with the CPU.",
+				params.Net),
+		}
+	}
+	if len(s.server.cpuMiner.ValidateKeys()) == 0 {
+		return &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInternal.Code,
+			Message: "No validate keys provided via setvalidatekeys",
+		}
+	}
+	return nil
+}
+
+// handleGenerateToAddress implements the generatetoaddress command.
+func handleGenerateToAddress(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GenerateToAddressCmd)
+	if err := checkGenerate(s); err != nil {
+		return nil, err
+	}
+	if c.NumBlocks == 0 {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Please request a nonzero number of blocks to generate.",
+		}
+	}
+	addr, err := generateAddress(c.Address, s.server.chainParams)
+	if err != nil {
+		return nil, err
+	}
+
+	var maxTries uint64
+	if c.MaxTries != nil {
+		maxTries = *c.MaxTries
+	}
+	blockHashes, err := s.server.cpuMiner.GenerateNBlocksToAddress(
+		c.NumBlocks, addr, maxTries)
+	reply := make([]string, len(blockHashes))
+	for i, hash := range blockHashes {
+		reply[i] = hash.String()
+	}
+
+	// The blocks generated before the error stay in the chain, so they
+	// are reported along with it.
+	if err != nil {
+		return reply, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInternal.Code,
+			Message: err.Error(),
+		}
+	}
+	return reply, nil
+}
+
+// txListSource is a mining.TxSource which only provides a fixed list of
+// transactions.  It is used to generate blocks containing exactly the
+// transactions requested via generateblock.
+type txListSource struct {
+	lastUpdated time.Time
+	descs       []*mining.TxDesc
+	hashes      map[chainhash.Hash]struct{}
+}
+
+// Ensure txListSource implements the mining.TxSource interface.
+var _ mining.TxSource = (*txListSource)(nil)
+
+// newTxListSource returns a transaction source providing the passed mining
+// descriptors.
+func newTxListSource(descs []*mining.TxDesc, lastUpdated time.Time) *txListSource {
+	hashes := make(map[chainhash.Hash]struct{}, len(descs))
+	for _, desc := range descs {
+		hashes[*desc.Tx.Hash()] = struct{}{}
+	}
+	return &txListSource{
+		lastUpdated: lastUpdated,
+		descs:       descs,
+		hashes:      hashes,
+	}
+}
+
+// LastUpdated returns the last time the source memory pool was updated.
+//
+// This is part of the mining.TxSource interface implementation.
+func (s *txListSource) LastUpdated() time.Time {
+	return s.lastUpdated
+}
+
+// MiningDescs returns the mining descriptors of the listed transactions.
+//
+// This is part of the mining.TxSource interface implementation.
+func (s *txListSource) MiningDescs() []*mining.TxDesc {
+	return s.descs
+}
+
+// HaveTransaction returns whether or not the passed transaction hash is among
+// the listed transactions.
+//
+// This is part of the mining.TxSource interface implementation.
+func (s *txListSource) HaveTransaction(hash *chainhash.Hash) bool {
+	_, ok := s.hashes[*hash]
+	return ok
+}
+
+// generateBlockTxSource returns a transaction source providing the memory pool
+// transactions with the passed ids in order.  An error is returned when an id
+// is malformed, listed twice or not in the memory pool.
+func generateBlockTxSource(txPool mining.TxSource, txids []string) (*txListSource, error) {
+	poolDescs := make(map[chainhash.Hash]*mining.TxDesc)
+	for _, desc := range txPool.MiningDescs() {
+		poolDescs[*desc.Tx.Hash()] = desc
+	}
+
+	descs := make([]*mining.TxDesc, 0, len(txids))
+	seen := make(map[chainhash.Hash]struct{}, len(txids))
+	for _, txid := range txids {
+		hash, err := chainhash.NewHashFromStr(txid)
+		if err != nil {
+			return nil, rpcDecodeHexError(txid)
+		}
+		if _, ok := seen[*hash]; ok {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCInvalidParameter,
+				Message: "Transaction " + txid + " is listed twice",
+			}
+		}
+		seen[*hash] = struct{}{}
+
+		desc, ok := poolDescs[*hash]
+		if !ok {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCNoTxInfo,
+				Message: "Transaction " + txid + " not in mempool",
+			}
+		}
+		descs = append(descs, desc)
+	}
+	return newTxListSource(descs, txPool.LastUpdated()), nil
+}
+
+// handleGenerateBlock implements the generateblock command.
+func handleGenerateBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GenerateBlockCmd)
+	if err := checkGenerate(s); err != nil {
+		return nil, err
+	}
+	addr, err := generateAddress(c.Address, s.server.chainParams)
+	if err != nil {
+		return nil, err
+	}
+	txSource, err := generateBlockTxSource(s.server.txMemPool,
+		c.Transactions)
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := s.server.cpuMiner.GenerateBlock(addr, txSource, 0)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInternal.Code,
+			Message: err.Error(),
+		}
+	}
+	return &btcjson.GenerateBlockResult{Hash: hash.String()}, nil
+}
+
 // handleGetAddedNodeInfo handles getaddednodeinfo commands.
 func handleGetAddedNodeInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*btcjson.GetAddedNodeInfoCmd)
 
-	// Retrieve a list of persistent (added) peers from the bitcoin server
-	// and filter the list of peers per the specified address (if any).
-	peers := s.server.AddedNodeInfo()
+	// Retrieve a list of added nodes from the server and filter the list
+	// of nodes per the specified address (if any).
+	nodes := s.server.AddedNodeInfo()
 	if c.Node != nil {
-		node := *c.Node
 		found := false
-		for i, peer := range peers {
-			if peer.Addr() == node {
-				peers = peers[i : i+1]
+		for i, node := range nodes {
+			if node.addr == *c.Node {
+				nodes = nodes[i : i+1]
 				found = true
+				break
 			}
 		}
 		if !found {
@@ -858,29 +1344,34 @@ func handleGetAddedNodeInfo(s *rpcServer, cmd interface{}, closeChan <-chan stru
 	// Without the dns flag, the result is just a slice of the addresses as
 	// strings.
 	if !c.DNS {
-		results := make([]string, 0, len(peers))
-		for _, peer := range peers {
-			results = append(results, peer.Addr())
+		results := make([]string, 0, len(nodes))
+		for _, node := range nodes {
+			results = append(results, node.addr)
 		}
 		return results, nil
 	}
 
 	// With the dns flag, the result is an array of JSON objects which
 	// include the result of DNS lookups for each peer.
-	results := make([]*btcjson.GetAddedNodeInfoResult, 0, len(peers))
-	for _, peer := range peers {
-		// Set the "address" of the peer which could be an ip address
-		// or a domain name.
+	results := make([]*btcjson.GetAddedNodeInfoResult, 0, len(nodes))
+	for _, node := range nodes {
+		// Set the "address" of the node which could be an ip address
+		// or a domain name along with the state of the connection to
+		// it.
+		peer := node.peer
+		connected := peer != nil && peer.Connected()
 		var result btcjson.GetAddedNodeInfoResult
-		result.AddedNode = peer.Addr()
-		result.Connected = btcjson.Bool(peer.Connected())
+		result.AddedNode = node.addr
+		result.Connected = btcjson.Bool(connected)
+		result.ConnState = node.state.String()
+		result.Retries = node.retries
 
 		// Split the address into host and port portions so we can do
 		// a DNS lookup against the host.  When no port is specified in
 		// the address, just use the address as the host.
-		host, _, err := net.SplitHostPort(peer.Addr())
+		host, _, err := net.SplitHostPort(node.addr)
 		if err != nil {
-			host = peer.Addr()
+			host = node.addr
 		}
 
 		var ipList []string
@@ -909,7 +1400,7 @@ func handleGetAddedNodeInfo(s *rpcServer, cmd interface{}, closeChan <-chan stru
 			var addr btcjson.GetAddedNodeInfoResultAddr
 			addr.Address = ip
 			addr.Connected = "false"
-			if ip == host && peer.Connected() {
+			if ip == host && connected {
 				addr.Connected = directionString(peer.Inbound())
 			}
 			addrs = append(addrs, addr)
@@ -1090,12 +1581,14 @@ func handleGetBestBlockHash(s *rpcServer, cmd interface{}, closeChan <-chan stru
 
 // getDifficultyRatio returns the proof-of-work difficulty as a multiple of the
 // minimum difficulty using the passed bits field from the header of a block.
-func getDifficultyRatio(bits uint32) float64 {
+// The minimum difficulty is the proof-of-work limit of the passed network, so
+// a block at the limit has a difficulty of 1 regardless of the network.
+func getDifficultyRatio(bits uint32, params *chaincfg.Params) float64 {
 	// The minimum difficulty is the max possible proof-of-work limit bits
 	// converted back to a number.  Note this is not the same as the proof of
 	// work limit directly because the block difficulty is encoded in a block
 	// with the compact form which loses precision.
-	max := blockchain.CompactToBig(activeNetParams.PowLimitBits)
+	max := blockchain.CompactToBig(params.PowLimitBits)
 	target := blockchain.CompactToBig(bits)
 
 	difficulty := new(big.Rat).SetFrac(max, target)
@@ -1108,10 +1601,226 @@ func getDifficultyRatio(bits uint32) float64 {
 	return diff
 }
 
+// difficultyWindowResult returns the averaging window of the difficulty
+// adjustment for the block after the end of the current best chain, including
+// the required difficulty of that block, ready to be returned to the caller.
+func difficultyWindowResult(s *rpcServer) (*btcjson.DifficultyWindowResult, error) {
+	window, err := s.chain.CalcDifficultyWindow()
+	if err != nil {
+		context := "Failed to calculate the difficulty window"
+		return nil, internalRPCError(err.Error(), context)
+	}
+
+	return &btcjson.DifficultyWindowResult{
+		Blocks:         int32(window.Blocks),
+		ActualTimespan: int64(window.ActualTimespan / time.Second),
+		TargetTimespan: int64(window.TargetTimespan / time.Second),
+		NextBits:       strconv.FormatInt(int64(window.NextBits), 16),
+		NextDifficulty: getDifficultyRatio(window.NextBits, s.server.chainParams),
+	}, nil
+}
+
+// sigKeyID returns the identifier of the validate key which signed a block,
+// which is the hex-encoded hash160 of its compressed public key.
+func sigKeyID(pubKey wire.BlockValidatingPubKey) string {
+	return hex.EncodeToString(provautil.Hash160(pubKey[:]))
+}
+
+// blockChainContext houses the information about the position of a block in
+// the block chain which is returned along with the verbose block and block
+// header.
+type blockChainContext struct {
+	mainChain  bool
+	bestHeight uint32
+	medianTime time.Time
+	chainWork  *big.Int
+	nextHash   *chainhash.Hash
+}
+
+// confirmations returns the number of confirmations of the block at the passed
+// height, which is -1 when the block is not part of the main chain.
+func (c *blockChainContext) confirmations(height uint32) int64 {
+	if !c.mainChain {
+		return -1
+	}
+	return int64(1 + c.bestHeight - height)
+}
+
+// fetchBlockChainContext returns the position in the block chain of the block
+// with the passed hash and height.
+func fetchBlockChainContext(s *rpcServer, hash *chainhash.Hash, height uint32) (*blockChainContext, error) {
+	mainChain, err := s.chain.MainChainHasBlock(hash)
+	if err != nil {
+		context := "Failed to check the main chain for the block"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	medianTime, err := s.chain.BlockMedianTime(hash)
+	if err != nil {
+		context := "Failed to obtain block median time"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	chainWork, err := s.chain.ChainWork(hash)
+	if err != nil {
+		context := "Failed to obtain chain work"
+		return nil, internalRPCError(err.Error(), context)
+	}
+
+	best := s.chain.BestSnapshot()
+	ctx := &blockChainContext{
+		mainChain:  mainChain,
+		bestHeight: best.Height,
+		medianTime: medianTime,
+		chainWork:  chainWork,
+	}
+
+	// Get next block hash unless there are none.
+	if mainChain && height < best.Height {
+		ctx.nextHash, err = s.chain.BlockHashByHeight(height + 1)
+		if err != nil {
+			context := "No next block"
+			return nil, internalRPCError(err.Error(), context)
+		}
+	}
+	return ctx, nil
+}
+
+// blockHeaderVerboseResult returns the verbose getblockheader result for the
+// passed header at the passed position in the block chain.
+func blockHeaderVerboseResult(header *wire.BlockHeader, params *chaincfg.Params, ctx *blockChainContext) *btcjson.GetBlockHeaderVerboseResult {
+	var nextHashString string
+	if ctx.nextHash != nil {
+		nextHashString = ctx.nextHash.String()
+	}
+	return &btcjson.GetBlockHeaderVerboseResult{
+		Hash:             header.BlockHash().String(),
+		Confirmations:    ctx.confirmations(header.Height),
+		Height:           int32(header.Height),
+		Version:          header.Version,
+		MerkleRoot:       header.MerkleRoot.String(),
+		NextHash:         nextHashString,
+		PreviousHash:     header.PrevBlock.String(),
+		Nonce:            header.Nonce,
+		Time:             header.Timestamp.Unix(),
+		MedianTime:       ctx.medianTime.Unix(),
+		Bits:             strconv.FormatInt(int64(header.Bits), 16),
+		Difficulty:       getDifficultyRatio(header.Bits, params),
+		ChainWork:        fmt.Sprintf("%064x", ctx.chainWork),
+		Signature:        header.Signature.String(),
+		ValidatingPubKey: header.ValidatingPubKey.String(),
+		SigKeyID:         sigKeyID(header.ValidatingPubKey),
+	}
+}
+
+// blockVerboseResult returns the verbose getblock result for the passed block
+// at the passed position in the block chain.  A GetBlockVerboseTxResult is
+// returned for verbosity level 2 and a GetBlockVerboseResult otherwise, which
+// holds the decoded transactions in place of their ids when verboseTx is set.
+func blockVerboseResult(blk *provautil.Block, params *chaincfg.Params, ctx *blockChainContext, verbosity btcjson.GetBlockVerbosity, verboseTx bool) (interface{}, error) {
+	header := &blk.MsgBlock().Header
+	hdrResult := blockHeaderVerboseResult(header, params, ctx)
+
+	rawTxns := func() ([]btcjson.TxRawResult, error) {
+		txns := blk.Transactions()
+		rawTxns := make([]btcjson.TxRawResult, len(txns))
+		for i, tx := range txns {
+			rawTxn, err := createTxRawResult(params, tx.MsgTx(),
+				tx.Hash().String(), header, hdrResult.Hash,
+				header.Height, ctx.bestHeight)
+			if err != nil {
+				return nil, err
+			}
+
+			// Transactions of side chain blocks are unconfirmed.
+			if !ctx.mainChain {
+				rawTxn.Confirmations = 0
+			}
+			rawTxns[i] = *rawTxn
+		}
+		return rawTxns, nil
+	}
+
+	if verbosity == btcjson.GetBlockVerbosityTxs {
+		txns, err := rawTxns()
+		if err != nil {
+			return nil, err
+		}
+		return &btcjson.GetBlockVerboseTxResult{
+			Hash:             hdrResult.Hash,
+			Confirmations:    hdrResult.Confirmations,
+			Size:             int32(header.Size),
+			Height:           int64(header.Height),
+			Version:          hdrResult.Version,
+			MerkleRoot:       hdrResult.MerkleRoot,
+			Tx:               txns,
+			Time:             hdrResult.Time,
+			MedianTime:       hdrResult.MedianTime,
+			Nonce:            hdrResult.Nonce,
+			Bits:             hdrResult.Bits,
+			Difficulty:       hdrResult.Difficulty,
+			ChainWork:        hdrResult.ChainWork,
+			PreviousHash:     hdrResult.PreviousHash,
+			NextHash:         hdrResult.NextHash,
+			ValidatingPubKey: hdrResult.ValidatingPubKey,
+			SigKeyID:         hdrResult.SigKeyID,
+			Signature:        hdrResult.Signature,
+		}, nil
+	}
+
+	blockReply := &btcjson.GetBlockVerboseResult{
+		Hash:             hdrResult.Hash,
+		Confirmations:    hdrResult.Confirmations,
+		Size:             int32(header.Size),
+		Height:           int64(header.Height),
+		Version:          hdrResult.Version,
+		MerkleRoot:       hdrResult.MerkleRoot,
+		Time:             hdrResult.Time,
+		MedianTime:       hdrResult.MedianTime,
+		Nonce:            hdrResult.Nonce,
+		Bits:             hdrResult.Bits,
+		Difficulty:       hdrResult.Difficulty,
+		ChainWork:        hdrResult.ChainWork,
+		PreviousHash:     hdrResult.PreviousHash,
+		NextHash:         hdrResult.NextHash,
+		ValidatingPubKey: hdrResult.ValidatingPubKey,
+		SigKeyID:         hdrResult.SigKeyID,
+		Signature:        hdrResult.Signature,
+	}
+	if verboseTx {
+		txns, err := rawTxns()
+		if err != nil {
+			return nil, err
+		}
+		blockReply.RawTx = txns
+		return blockReply, nil
+	}
+
+	transactions := blk.Transactions()
+	txNames := make([]string, len(transactions))
+	for i, tx := range transactions {
+		txNames[i] = tx.Hash().String()
+	}
+	blockReply.Tx = txNames
+	return blockReply, nil
+}
+
 // handleGetBlock implements the getblock command.
 func handleGetBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*btcjson.GetBlockCmd)
 
+	verbosity := btcjson.GetBlockVerbosityTxIDs
+	if c.Verbosity != nil {
+		verbosity = *c.Verbosity
+	}
+	if verbosity < btcjson.GetBlockVerbosityHex ||
+		verbosity > btcjson.GetBlockVerbosityTxs {
+
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCInvalidParameter,
+			Message: fmt.Sprintf("Verbosity level %d is not one of "+
+				"0, 1 or 2", verbosity),
+		}
+	}
+
 	// Load the raw block bytes from the database.
 	hash, err := chainhash.NewHashFromStr(c.Hash)
 	if err != nil {
@@ -1130,13 +1839,13 @@ func handleGetBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (i
 		}
 	}
 
-	// When the verbose flag isn't set, simply return the serialized block
+	// When the verbosity level is 0, simply return the serialized block
 	// as a hex-encoded string.
-	if c.Verbose != nil && !*c.Verbose {
+	if verbosity == btcjson.GetBlockVerbosityHex {
 		return hex.EncodeToString(blkBytes), nil
 	}
 
-	// The verbose flag is set, so generate the JSON object and return it.
+	// Otherwise generate the JSON object and return it.
 
 	// Deserialize the block.
 	blk, err := provautil.NewBlockFromBytes(blkBytes)
@@ -1145,67 +1854,86 @@ func handleGetBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (i
 		return nil, internalRPCError(err.Error(), context)
 	}
 
-	// Get the block height from chain.
-	blockHeight, err := s.chain.BlockHeightByHash(hash)
+	ctx, err := fetchBlockChainContext(s, hash, blk.MsgBlock().Header.Height)
 	if err != nil {
-		context := "Failed to obtain block height"
-		return nil, internalRPCError(err.Error(), context)
+		return nil, err
 	}
+	verboseTx := c.VerboseTx != nil && *c.VerboseTx
+	return blockVerboseResult(blk, s.server.chainParams, ctx, verbosity,
+		verboseTx)
+}
+
+// handleGetBlockChainInfo implements the getblockchaininfo command.
+func handleGetBlockChainInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	best := s.chain.BestSnapshot()
+	chainWork, err := s.chain.ChainWork(best.Hash)
+	if err != nil {
+		context := "Failed to obtain chain work"
+		return nil, internalRPCError(err.Error(), context)
+	}
 
-	// Get next block hash unless there are none.
-	var nextHashString string
-	if blockHeight < best.Height {
-		nextHash, err := s.chain.BlockHashByHeight(blockHeight + 1)
-		if err != nil {
-			context := "No next block"
-			return nil, internalRPCError(err.Error(), context)
-		}
-		nextHashString = nextHash.String()
-	}
-
-	blockHeader := &blk.MsgBlock().Header
-	blockReply := btcjson.GetBlockVerboseResult{
-		Hash:             c.Hash,
-		Version:          blockHeader.Version,
-		MerkleRoot:       blockHeader.MerkleRoot.String(),
-		PreviousHash:     blockHeader.PrevBlock.String(),
-		Nonce:            blockHeader.Nonce,
-		Time:             blockHeader.Timestamp.Unix(),
-		Confirmations:    uint64(1 + best.Height - blockHeight),
-		Height:           int64(blockHeader.Height),
-		Size:             int32(blockHeader.Size),
-		Bits:             strconv.FormatInt(int64(blockHeader.Bits), 16),
-		Difficulty:       getDifficultyRatio(blockHeader.Bits),
-		NextHash:         nextHashString,
-		ValidatingPubKey: blockHeader.ValidatingPubKey.String(),
-		Signature:        blockHeader.Signature.String(),
+	syncStatus := s.chain.SyncStatus()
+	window, err := difficultyWindowResult(s)
+	if err != nil {
+		return nil, err
 	}
 
-	if c.VerboseTx == nil || !*c.VerboseTx {
-		transactions := blk.Transactions()
-		txNames := make([]string, len(transactions))
-		for i, tx := range transactions {
-			txNames[i] = tx.Hash().String()
-		}
+	upgradeStatus, err := s.chain.UpgradeStatus()
+	if err != nil {
+		context := "Failed to obtain upgrade status"
+		return nil, internalRPCError(err.Error(), context)
+	}
 
-		blockReply.Tx = txNames
-	} else {
-		txns := blk.Transactions()
-		rawTxns := make([]btcjson.TxRawResult, len(txns))
-		for i, tx := range txns {
-			rawTxn, err := createTxRawResult(s.server.chainParams,
-				tx.MsgTx(), tx.Hash().String(), blockHeader,
-				hash.String(), blockHeight, best.Height)
-			if err != nil {
-				return nil, err
-			}
-			rawTxns[i] = *rawTxn
-		}
-		blockReply.RawTx = rawTxns
+	// The timestamps are reported as zero when the block they refer to is
+	// not part of the main chain yet.
+	unixTime := func(t time.Time) int64 {
+		if t.IsZero() {
+			return 0
+		}
+		return t.Unix()
+	}
+	deployments := make([]btcjson.DeploymentResult, 0,
+		len(upgradeStatus.Deployments))
+	for _, d := range upgradeStatus.Deployments {
+		result := btcjson.DeploymentResult{
+			ID:             d.Name,
+			Active:         d.Active,
+			ActivationTime: unixTime(d.ActivationTime),
+		}
+		if d.ActivationHeight != math.MaxUint32 {
+			activationHeight := d.ActivationHeight
+			result.ActivationHeight = &activationHeight
+		}
+		deployments = append(deployments, result)
+	}
+	rollouts := make([]btcjson.VersionRolloutResult, 0,
+		len(upgradeStatus.VersionRollouts))
+	for _, r := range upgradeStatus.VersionRollouts {
+		rollouts = append(rollouts, btcjson.VersionRolloutResult{
+			ID:               r.Name,
+			Version:          r.Version,
+			Status:           r.State.String(),
+			Since:            r.Since,
+			SinceTime:        unixTime(r.SinceTime),
+			Signaling:        r.Signaling,
+			Window:           r.Window,
+			EnforceThreshold: r.EnforceThreshold,
+			RejectThreshold:  r.RejectThreshold,
+		})
 	}
 
-	return blockReply, nil
+	return &btcjson.GetBlockChainInfoResult{
+		Chain:                activeNetParams.Name,
+		Blocks:               int32(best.Height),
+		Headers:              int32(syncStatus.HeadersHeight),
+		BestBlockHash:        best.Hash.String(),
+		Difficulty:           getDifficultyRatio(best.Bits, s.server.chainParams),
+		VerificationProgress: syncStatus.VerificationProgress,
+		ChainWork:            fmt.Sprintf("%064x", chainWork),
+		Window:               *window,
+		Deployments:          deployments,
+		VersionRollouts:      rollouts,
+	}, nil
 }
 
 // handleGetBlockCount implements the getblockcount command.
@@ -1251,85 +1979,134 @@ func handleGetBlockHeader(s *rpcServer, cmd interface{}, closeChan <-chan struct
 		var headerBuf bytes.Buffer
 		err := blockHeader.Serialize(&headerBuf)
 		if err != nil {
-			context := "Failed to serialize block header"
+			context := "Failed to serialize block header"
+			return nil, internalRPCError(err.Error(), context)
+		}
+		return hex.EncodeToString(headerBuf.Bytes()), nil
+	}
+
+	// The verbose flag is set, so generate the JSON object and return it.
+	ctx, err := fetchBlockChainContext(s, hash, blockHeader.Height)
+	if err != nil {
+		return nil, err
+	}
+	return blockHeaderVerboseResult(&blockHeader, s.server.chainParams,
+		ctx), nil
+}
+
+// handleGetBlockStats implements the getblockstats command.
+func handleGetBlockStats(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetBlockStatsCmd)
+
+	hash, err := chainhash.NewHashFromStr(c.Hash)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.Hash)
+	}
+
+	// Load the statistics from the block statistics index when it is
+	// enabled and fall back to calculating them from the spend journal
+	// when it is not or the index has not caught up to the block yet.
+	var stats *blockchain.BlockStats
+	if s.server.blockStatsIndex != nil {
+		stats, err = s.server.blockStatsIndex.BlockStats(hash)
+		if err != nil {
+			context := "Failed to retrieve block statistics"
 			return nil, internalRPCError(err.Error(), context)
 		}
-		return hex.EncodeToString(headerBuf.Bytes()), nil
+	}
+	if stats == nil {
+		stats, err = s.chain.BlockStats(hash)
+		if err != nil {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCBlockNotFound,
+				Message: "Block not found",
+			}
+		}
 	}
 
-	// The verbose flag is set, so generate the JSON object and return it.
+	height := int32(stats.Height)
+	hashStr := stats.Hash.String()
+	result := &btcjson.GetBlockStatsResult{}
+	fields := map[string]func(){
+		"blockhash":     func() { result.Hash = &hashStr },
+		"height":        func() { result.Height = &height },
+		"totalfee":      func() { result.TotalFee = &stats.TotalFee },
+		"feeperkb":      func() { result.FeePerKB = &stats.FeePerKB },
+		"minfeerate":    func() { result.MinFeeRate = &stats.MinFeeRate },
+		"medianfeerate": func() { result.MedianFeeRate = &stats.MedianFeeRate },
+		"maxfeerate":    func() { result.MaxFeeRate = &stats.MaxFeeRate },
+		"txs":           func() { result.Txs = &stats.NumTxns },
+		"ins":           func() { result.Ins = &stats.NumInputs },
+		"outs":          func() { result.Outs = &stats.NumOutputs },
+		"totalsize":     func() { result.TotalSize = &stats.TotalSize },
+	}
 
-	// Get the block height from chain.
-	blockHeight, err := s.chain.BlockHeightByHash(hash)
-	if err != nil {
-		context := "Failed to obtain block height"
-		return nil, internalRPCError(err.Error(), context)
+	// Return all of the statistics when no specific ones were selected.
+	if c.Stats == nil || len(*c.Stats) == 0 {
+		for _, setField := range fields {
+			setField()
+		}
+		return result, nil
 	}
-	best := s.chain.BestSnapshot()
 
-	// Get next block hash unless there are none.
-	var nextHashString string
-	if blockHeight < best.Height {
-		nextHash, err := s.chain.BlockHashByHeight(blockHeight + 1)
-		if err != nil {
-			context := "No next block"
-			return nil, internalRPCError(err.Error(), context)
+	for _, name := range *c.Stats {
+		setField, ok := fields[name]
+		if !ok {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCInvalidParameter,
+				Message: fmt.Sprintf("Invalid selected statistic %q", name),
+			}
 		}
-		nextHashString = nextHash.String()
+		setField()
 	}
+	return result, nil
+}
 
-	blockHeaderReply := btcjson.GetBlockHeaderVerboseResult{
-		Hash:             c.Hash,
-		Confirmations:    uint64(1 + best.Height - blockHeight),
-		Height:           int32(blockHeader.Height),
-		Version:          blockHeader.Version,
-		MerkleRoot:       blockHeader.MerkleRoot.String(),
-		NextHash:         nextHashString,
-		PreviousHash:     blockHeader.PrevBlock.String(),
-		Nonce:            uint64(blockHeader.Nonce),
-		Time:             blockHeader.Timestamp.Unix(),
-		Bits:             strconv.FormatInt(int64(blockHeader.Bits), 16),
-		Difficulty:       getDifficultyRatio(blockHeader.Bits),
-		Signature:        blockHeader.Signature.String(),
-		ValidatingPubKey: blockHeader.ValidatingPubKey.String(),
+// gbtTarget returns the target difficulty for the passed compact bits as the
+// big-endian hex string used by the target field of getblocktemplate.
+func gbtTarget(bits uint32) string {
+	var target chainhash.Hash
+	b := blockchain.CompactToBig(bits).Bytes()
+	for i := 0; i < len(b) && i < chainhash.HashSize; i++ {
+		target[i] = b[len(b)-1-i]
 	}
-	return blockHeaderReply, nil
+	return target.StringBE()
 }
 
 // encodeTemplateID encodes the passed details into an ID that can be used to
 // uniquely identify a block template.
-func encodeTemplateID(prevHash *chainhash.Hash, lastGenerated time.Time) string {
-	return fmt.Sprintf("%s-%d", prevHash.String(), lastGenerated.Unix())
+func encodeTemplateID(prevHash *chainhash.Hash, generation uint64) string {
+	return fmt.Sprintf("%s-%d", prevHash.StringBE(), generation)
 }
 
 // decodeTemplateID decodes an ID that is used to uniquely identify a block
 // template.  This is mainly used as a mechanism to track when to update clients
 // that are using long polling for block templates.  The ID consists of the
-// previous block hash for the associated template and the time the associated
-// template was generated.
-func decodeTemplateID(templateID string) (*chainhash.Hash, int64, error) {
+// previous block hash for the associated template and the generation counter
+// of the work state at the time the associated template was generated.
+func decodeTemplateID(templateID string) (*chainhash.Hash, uint64, error) {
 	fields := strings.Split(templateID, "-")
 	if len(fields) != 2 {
 		return nil, 0, errors.New("invalid longpollid format")
 	}
 
-	prevHash, err := chainhash.NewHashFromStr(fields[0])
+	prevHash, err := chainhash.NewHashFromStrBE(fields[0])
 	if err != nil {
 		return nil, 0, errors.New("invalid longpollid format")
 	}
-	lastGenerated, err := strconv.ParseInt(fields[1], 10, 64)
+	generation, err := strconv.ParseUint(fields[1], 10, 64)
 	if err != nil {
 		return nil, 0, errors.New("invalid longpollid format")
 	}
 
-	return prevHash, lastGenerated, nil
+	return prevHash, generation, nil
 }
 
 // notifyLongPollers notifies any channels that have been registered to be
 // notified when block templates are stale.
 //
 // This function MUST be called with the state locked.
-func (state *gbtWorkState) notifyLongPollers(latestHash *chainhash.Hash, lastGenerated time.Time) {
+func (state *gbtWorkState) notifyLongPollers(latestHash *chainhash.Hash, generation uint64) {
 	// Notify anything that is waiting for a block template update from a
 	// hash which is not the hash of the tip of the best chain since their
 	// work is now invalid.
@@ -1342,12 +2119,6 @@ func (state *gbtWorkState) notifyLongPollers(latestHash *chainhash.Hash, lastGen
 		}
 	}
 
-	// Return now if the provided last generated timestamp has not been
-	// initialized.
-	if lastGenerated.IsZero() {
-		return
-	}
-
 	// Return now if there is nothing registered for updates to the current
 	// best block hash.
 	channels, ok := state.notifyMap[*latestHash]
@@ -1356,13 +2127,11 @@ func (state *gbtWorkState) notifyLongPollers(latestHash *chainhash.Hash, lastGen
 	}
 
 	// Notify anything that is waiting for a block template update from a
-	// block template generated before the most recently generated block
-	// template.
-	lastGeneratedUnix := lastGenerated.Unix()
-	for lastGen, c := range channels {
-		if lastGen < lastGeneratedUnix {
+	// block template generated before the passed generation.
+	for gen, c := range channels {
+		if gen < generation {
 			close(c)
-			delete(channels, lastGen)
+			delete(channels, gen)
 		}
 	}
 
@@ -1381,56 +2150,69 @@ func (state *gbtWorkState) NotifyBlockConnected(blockHash *chainhash.Hash) {
 		state.Lock()
 		defer state.Unlock()
 
-		state.notifyLongPollers(blockHash, state.lastTxUpdate)
+		state.notifyLongPollers(blockHash, state.generation)
 	}()
 }
 
-// NotifyMempoolTx uses the new last updated time for the transaction memory
-// pool to notify any long poll clients with a new block template when their
-// existing block template is stale due to enough time passing and the contents
-// of the memory pool changing.
-func (state *gbtWorkState) NotifyMempoolTx(lastUpdated time.Time) {
+// NotifyMempoolTx uses the fee of a transaction newly added to the memory pool
+// to notify any long poll clients with a new block template when their existing
+// block template is stale due to enough time passing and the contents of the
+// memory pool changing, or due to the fees of the transactions added since the
+// template was generated reaching the template fee delta of the mining policy.
+func (state *gbtWorkState) NotifyMempoolTx(fee int64) {
 	go func() {
 		state.Lock()
 		defer state.Unlock()
 
+		state.newFees += provautil.Amount(fee)
+
 		// No need to notify anything if no block templates have been generated
 		// yet.
 		if state.prevHash == nil || state.lastGenerated.IsZero() {
 			return
 		}
 
-		if time.Now().After(state.lastGenerated.Add(time.Second *
-			gbtRegenerateSeconds)) {
+		if state.feeDeltaReached() || time.Now().After(
+			state.lastGenerated.Add(time.Second*gbtRegenerateSeconds)) {
 
-			state.notifyLongPollers(state.prevHash, lastUpdated)
+			state.notifyLongPollers(state.prevHash, state.generation+1)
 		}
 	}()
 }
 
+// feeDeltaReached returns whether the fees of the transactions added to the
+// memory pool since the current block template was generated reached the
+// template fee delta of the mining policy.
+//
+// This function MUST be called with the state locked.
+func (state *gbtWorkState) feeDeltaReached() bool {
+	feeDelta := state.policy.TemplateFeeDelta
+	return feeDelta > 0 && state.newFees >= feeDelta
+}
+
 // templateUpdateChan returns a channel that will be closed once the block
-// template associated with the passed previous hash and last generated time
-// is stale.  The function will return existing channels for duplicate
-// parameters which allows multiple clients to wait for the same block template
-// without requiring a different channel for each client.
+// template associated with the passed previous hash and generation is stale.
+// The function will return existing channels for duplicate parameters which
+// allows multiple clients to wait for the same block template without
+// requiring a different channel for each client.
 //
 // This function MUST be called with the state locked.
-func (state *gbtWorkState) templateUpdateChan(prevHash *chainhash.Hash, lastGenerated int64) chan struct{} {
+func (state *gbtWorkState) templateUpdateChan(prevHash *chainhash.Hash, generation uint64) chan struct{} {
 	// Either get the current list of channels waiting for updates about
 	// changes to block template for the previous hash or create a new one.
 	channels, ok := state.notifyMap[*prevHash]
 	if !ok {
-		m := make(map[int64]chan struct{})
+		m := make(map[uint64]chan struct{})
 		state.notifyMap[*prevHash] = m
 		channels = m
 	}
 
-	// Get the current channel associated with the time the block template
-	// was last generated or create a new one.
-	c, ok := channels[lastGenerated]
+	// Get the current channel associated with the generation of the block
+	// template or create a new one.
+	c, ok := channels[generation]
 	if !ok {
 		c = make(chan struct{})
-		channels[lastGenerated] = c
+		channels[generation] = c
 	}
 
 	return c
@@ -1438,8 +2220,9 @@ func (state *gbtWorkState) templateUpdateChan(prevHash *chainhash.Hash, lastGene
 
 // updateBlockTemplate creates or updates a block template for the work state.
 // A new block template will be generated when the current best block has
-// changed or the transactions in the memory pool have been updated and it has
-// been long enough since the last template was generated.  Otherwise, the
+// changed, the transactions in the memory pool have been updated and it has
+// been long enough since the last template was generated, or the fees of the
+// transactions added since then reached the template fee delta.  Otherwise, the
 // timestamp for the existing block template is updated (and possibly the
 // difficulty on testnet per the consesus rules).  Finally, if the
 // useCoinbaseValue flag is false and the existing block template does not
@@ -1456,8 +2239,8 @@ func (state *gbtWorkState) updateBlockTemplate(s *rpcServer, useCoinbaseValue bo
 
 	// Generate a new block template when the current best block has
 	// changed or the transactions in the memory pool have been updated and
-	// it has been at least gbtRegenerateSecond since the last template was
-	// generated.
+	// either it has been at least gbtRegenerateSeconds since the last
+	// template was generated or their fees reached the template fee delta.
 	var msgBlock *wire.MsgBlock
 	var targetDifficulty string
 	latestHash := s.server.blockManager.chain.BestSnapshot().Hash
@@ -1465,8 +2248,9 @@ func (state *gbtWorkState) updateBlockTemplate(s *rpcServer, useCoinbaseValue bo
 	if template == nil || state.prevHash == nil ||
 		!state.prevHash.IsEqual(latestHash) ||
 		(state.lastTxUpdate != lastTxUpdate &&
-			time.Now().After(state.lastGenerated.Add(time.Second*
-				gbtRegenerateSeconds))) {
+			(state.feeDeltaReached() ||
+				time.Now().After(state.lastGenerated.Add(time.Second*
+					gbtRegenerateSeconds)))) {
 
 		// Reset the previous best hash the block template was generated
 		// against so any errors below cause the next invocation to try
@@ -1486,15 +2270,31 @@ func (state *gbtWorkState) updateBlockTemplate(s *rpcServer, useCoinbaseValue bo
 		// block template doesn't include the coinbase, so the caller
 		// will ultimately create their own coinbase which pays to the
 		// appropriate address(es).
-		blkTemplate, err := s.generator.NewBlockTemplate(payAddr, nil)
+		//
+		// The template is signed with one of the validate keys set via
+		// setvalidatekeys, since the external miner only solves the
+		// header.
+		if len(s.server.cpuMiner.ValidateKeys()) == 0 {
+			return &btcjson.RPCError{
+				Code:    btcjson.ErrRPCInternal.Code,
+				Message: "No validate keys provided via setvalidatekeys",
+			}
+		}
+		validateKey, err := s.server.cpuMiner.PickValidateKey()
+		if err != nil {
+			return internalRPCError("Failed to pick a validate key: "+
+				err.Error(), "")
+		}
+		blkTemplate, err := s.generator.NewBlockTemplate(payAddr,
+			validateKey)
 		if err != nil {
 			return internalRPCError("Failed to create new block "+
 				"template: "+err.Error(), "")
 		}
 		template = blkTemplate
+		state.validateKey = validateKey
 		msgBlock = template.Block
-		targetDifficulty = fmt.Sprintf("%064x",
-			blockchain.CompactToBig(msgBlock.Header.Bits))
+		targetDifficulty = gbtTarget(msgBlock.Header.Bits)
 
 		// Get the minimum allowed timestamp for the block based on the
 		// median timestamp of the last several blocks per the chain
@@ -1506,6 +2306,8 @@ func (state *gbtWorkState) updateBlockTemplate(s *rpcServer, useCoinbaseValue bo
 		// generated until needed.
 		state.template = template
 		state.lastGenerated = time.Now()
+		state.generation++
+		state.newFees = 0
 		state.lastTxUpdate = lastTxUpdate
 		state.prevHash = latestHash
 		state.minTimestamp = minTimestamp
@@ -1517,7 +2319,7 @@ func (state *gbtWorkState) updateBlockTemplate(s *rpcServer, useCoinbaseValue bo
 
 		// Notify any clients that are long polling about the new
 		// template.
-		state.notifyLongPollers(latestHash, lastTxUpdate)
+		state.notifyLongPollers(latestHash, state.generation)
 	} else {
 		// At this point, there is a saved block template and another
 		// request for a template was made, but either the available
@@ -1553,13 +2355,12 @@ func (state *gbtWorkState) updateBlockTemplate(s *rpcServer, useCoinbaseValue bo
 
 		// Set locals for convenience.
 		msgBlock = template.Block
-		targetDifficulty = fmt.Sprintf("%064x",
-			blockchain.CompactToBig(msgBlock.Header.Bits))
+		targetDifficulty = gbtTarget(msgBlock.Header.Bits)
 
 		// Update the time of the block template to the current time
 		// while accounting for the median time of the past several
 		// blocks per the chain consensus rules.
-		s.generator.UpdateBlockTime(msgBlock, nil)
+		s.generator.UpdateBlockTime(msgBlock, state.validateKey)
 		msgBlock.Header.Nonce = 0
 
 		rpcsLog.Debugf("Updated block template (timestamp %v, "+
@@ -1570,6 +2371,26 @@ func (state *gbtWorkState) updateBlockTemplate(s *rpcServer, useCoinbaseValue bo
 	return nil
 }
 
+// gbtMutations returns the manipulations the server allows to be made to the
+// current block template.  Transactions may only be added while the template is
+// smaller than the maximum block size of the mining policy.  The coinbase may
+// only be appended to when it is part of the template since callers which
+// requested a coinbase value create their own coinbase.
+//
+// This function MUST be called with the state locked.
+func (state *gbtWorkState) gbtMutations(useCoinbaseValue bool) []string {
+	mutable := make([]string, len(gbtMutableFields), len(gbtMutableFields)+2)
+	copy(mutable, gbtMutableFields)
+	blockSize := state.template.Block.SerializeSize()
+	if uint32(blockSize) < state.policy.BlockMaxSize {
+		mutable = append(mutable, "transactions/add")
+	}
+	if !useCoinbaseValue {
+		mutable = append(mutable, "coinbase/append")
+	}
+	return mutable
+}
+
 // blockTemplateResult returns the current block template associated with the
 // state as a btcjson.GetBlockTemplateResult that is ready to be encoded to JSON
 // and returned to the caller.
@@ -1648,13 +2469,13 @@ func (state *gbtWorkState) blockTemplateResult(useCoinbaseValue bool, submitOld
 	// implied by the included or omission of fields:
 	//  Including MinTime -> time/decrement
 	//  Omitting CoinbaseTxn -> coinbase, generation
-	targetDifficulty := fmt.Sprintf("%064x", blockchain.CompactToBig(header.Bits))
-	templateID := encodeTemplateID(state.prevHash, state.lastGenerated)
+	targetDifficulty := gbtTarget(header.Bits)
+	templateID := encodeTemplateID(state.prevHash, state.generation)
 	reply := btcjson.GetBlockTemplateResult{
 		Bits:         strconv.FormatInt(int64(header.Bits), 16),
 		CurTime:      header.Timestamp.Unix(),
 		Height:       int64(template.Height),
-		PreviousHash: header.PrevBlock.String(),
+		PreviousHash: header.PrevBlock.StringBE(),
 		SigOpLimit:   blockchain.MaxSigOpsPerBlock,
 		SizeLimit:    wire.MaxBlockPayload,
 		Transactions: transactions,
@@ -1664,7 +2485,7 @@ func (state *gbtWorkState) blockTemplateResult(useCoinbaseValue bool, submitOld
 		Target:       targetDifficulty,
 		MinTime:      state.minTimestamp.Unix(),
 		MaxTime:      maxTime.Unix(),
-		Mutable:      gbtMutableFields,
+		Mutable:      state.gbtMutations(useCoinbaseValue),
 		NonceRange:   gbtNonceRange,
 		Capabilities: gbtCapabilities,
 	}
@@ -1730,7 +2551,7 @@ func handleGetBlockTemplateLongPoll(s *rpcServer, longPollID string, useCoinbase
 
 	// Just return the current block template if the long poll ID provided by
 	// the caller is invalid.
-	prevHash, lastGenerated, err := decodeTemplateID(longPollID)
+	prevHash, generation, err := decodeTemplateID(longPollID)
 	if err != nil {
 		result, err := state.blockTemplateResult(useCoinbaseValue, nil)
 		if err != nil {
@@ -1747,7 +2568,7 @@ func handleGetBlockTemplateLongPoll(s *rpcServer, longPollID string, useCoinbase
 	// template as this means the provided template is stale.
 	prevTemplateHash := &state.template.Block.Header.PrevBlock
 	if !prevHash.IsEqual(prevTemplateHash) ||
-		lastGenerated != state.lastGenerated.Unix() {
+		generation != state.generation {
 
 		// Include whether or not it is valid to submit work against the
 		// old block template depending on whether or not a solution has
@@ -1764,11 +2585,11 @@ func handleGetBlockTemplateLongPoll(s *rpcServer, longPollID string, useCoinbase
 		return result, nil
 	}
 
-	// Register the previous hash and last generated time for notifications
-	// Get a channel that will be notified when the template associated with
-	// the provided ID is stale and a new block template should be returned to
+	// Register the previous hash and generation for notifications.  Get a
+	// channel that will be notified when the template associated with the
+	// provided ID is stale and a new block template should be returned to
 	// the caller.
-	longPollChan := state.templateUpdateChan(prevHash, lastGenerated)
+	longPollChan := state.templateUpdateChan(prevHash, generation)
 	state.Unlock()
 
 	select {
@@ -1975,13 +2796,15 @@ func chainErrToGBTErrString(err error) string {
 	case blockchain.ErrScriptValidation:
 		return "bad-script-validate"
 	case blockchain.ErrExcessiveChainShare:
-		return "excessive-chain-share"
+		return "bad-sig-key-share"
 	case blockchain.ErrInconsistentBlkSize:
 		return "bad-size-value"
 	case blockchain.ErrInvalidValidateKey:
 		return "invalid-validate-key"
 	case blockchain.ErrFeeTooHigh:
 		return "bad-txns-highfee"
+	case blockchain.ErrPrevBlockNotBest:
+		return "bad-prevblk"
 	}
 
 	return "rejected: " + err.Error()
@@ -2023,15 +2846,10 @@ func handleGetBlockTemplateProposal(s *rpcServer, request *btcjson.TemplateReque
 	}
 	block := provautil.NewBlock(&msgBlock)
 
-	// Ensure the block is building from the expected previous block.
-	expectedPrevHash := s.server.blockManager.chain.BestSnapshot().Hash
-	prevHash := &block.MsgBlock().Header.PrevBlock
-	if expectedPrevHash == nil || !expectedPrevHash.IsEqual(prevHash) {
-		return "bad-prevblk", nil
-	}
-
-	flags := blockchain.BFDryRun | blockchain.BFNoPoWCheck
-	isOrphan, err := s.server.blockManager.ProcessBlock(block, flags)
+	// Ensure the block builds on the current tip of the main chain and
+	// passes all consensus rules aside from the proof of work.  The block
+	// is never stored, so rejected proposals leave no trace in the chain.
+	err = s.chain.CheckConnectBlockTemplate(block)
 	if err != nil {
 		if _, ok := err.(blockchain.RuleError); !ok {
 			err := rpcsLog.Errorf("Failed to process block "+
@@ -2045,9 +2863,6 @@ func handleGetBlockTemplateProposal(s *rpcServer, request *btcjson.TemplateReque
 		rpcsLog.Infof("Rejected block proposal: %v", err)
 		return chainErrToGBTErrString(err), nil
 	}
-	if isOrphan {
-		return "orphan", nil
-	}
 
 	return nil, nil
 }
@@ -2079,6 +2894,26 @@ func handleGetBlockTemplate(s *rpcServer, cmd interface{}, closeChan <-chan stru
 	}
 }
 
+// handleGetChainTips implements the getchaintips command.
+func handleGetChainTips(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	tips, err := s.chain.ChainTips()
+	if err != nil {
+		context := "Failed to fetch chain tips"
+		return nil, internalRPCError(err.Error(), context)
+	}
+
+	results := make([]btcjson.GetChainTipsResult, 0, len(tips))
+	for _, tip := range tips {
+		results = append(results, btcjson.GetChainTipsResult{
+			Height:    tip.Height,
+			Hash:      tip.Hash.String(),
+			BranchLen: tip.BranchLen,
+			Status:    tip.Status.String(),
+		})
+	}
+	return results, nil
+}
+
 // handleGetConnectionCount implements the getconnectioncount command.
 func handleGetConnectionCount(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	return s.server.ConnectedCount(), nil
@@ -2089,10 +2924,55 @@ func handleGetCurrentNet(s *rpcServer, cmd interface{}, closeChan <-chan struct{
 	return s.server.chainParams.Net, nil
 }
 
+// handleGetDBStats implements the getdbstats command.
+func handleGetDBStats(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	stats, err := s.server.db.Stats()
+	if err != nil {
+		return nil, internalRPCError(err.Error(), "Failed to fetch "+
+			"database stats")
+	}
+
+	buckets := make([]btcjson.DBBucketStatsResult, 0, len(stats.Buckets))
+	for _, bucket := range stats.Buckets {
+		buckets = append(buckets, btcjson.DBBucketStatsResult{
+			Name: string(bucket.Name),
+			Size: bucket.Size,
+		})
+	}
+	return &btcjson.GetDBStatsResult{
+		Buckets:        buckets,
+		MetadataFiles:  stats.MetadataFiles,
+		MetadataSize:   stats.MetadataSize,
+		LevelFiles:     stats.LevelFiles,
+		ObsoleteFiles:  stats.ObsoleteFiles,
+		ObsoleteSize:   stats.ObsoleteSize,
+		BlockFiles:     stats.BlockFiles,
+		BlockFilesSize: stats.BlockFilesSize,
+	}, nil
+}
+
 // handleGetDifficulty implements the getdifficulty command.
 func handleGetDifficulty(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	best := s.chain.BestSnapshot()
-	return getDifficultyRatio(best.Bits), nil
+	return getDifficultyRatio(best.Bits, s.server.chainParams), nil
+}
+
+// handleGetFinalizedHeight implements the getfinalizedheight command.
+func handleGetFinalizedHeight(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	height, err := s.chain.FinalizedHeight()
+	if err != nil {
+		context := "Failed to determine finalized height"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	hash, err := s.chain.BlockHashByHeight(height)
+	if err != nil {
+		context := "Failed to fetch finalized block hash"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	return &btcjson.GetFinalizedHeightResult{
+		Height: int32(height),
+		Hash:   hash.String(),
+	}, nil
 }
 
 // handleGetGenerate implements the getgenerate command.
@@ -2175,7 +3055,7 @@ func handleGetInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (in
 		TimeOffset:      int64(s.server.timeSource.Offset().Seconds()),
 		Connections:     s.server.ConnectedCount(),
 		Proxy:           cfg.Proxy,
-		Difficulty:      getDifficultyRatio(best.Bits),
+		Difficulty:      getDifficultyRatio(best.Bits, s.server.chainParams),
 		TestNet:         cfg.TestNet,
 		RelayFee:        cfg.minRelayTxFee.ToRMG(),
 	}
@@ -2183,23 +3063,109 @@ func handleGetInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (in
 	return ret, nil
 }
 
+// handleGetMemoryInfo implements the getmemoryinfo command.
+func handleGetMemoryInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+
+	// The pause times of the most recent garbage collections are kept in a
+	// circular buffer.
+	var lastPause uint64
+	if stats.NumGC > 0 {
+		lastPause = stats.PauseNs[(stats.NumGC+255)%256]
+	}
+	var lastGC int64
+	if stats.LastGC != 0 {
+		lastGC = int64(stats.LastGC / uint64(time.Second))
+	}
+
+	return &btcjson.GetMemoryInfoResult{
+		HeapAlloc:    stats.HeapAlloc,
+		HeapInUse:    stats.HeapInuse,
+		HeapIdle:     stats.HeapIdle,
+		HeapReleased: stats.HeapReleased,
+		HeapObjects:  stats.HeapObjects,
+		Sys:          stats.Sys,
+		NumGC:        stats.NumGC,
+		GCPauseTotal: int64(stats.PauseTotalNs / uint64(time.Microsecond)),
+		GCPauseLast:  int64(lastPause / uint64(time.Microsecond)),
+		LastGC:       lastGC,
+		Goroutines:   runtime.NumGoroutine(),
+	}, nil
+}
+
+// handleGetMempoolEntry implements the getmempoolentry command.
+func handleGetMempoolEntry(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetMempoolEntryCmd)
+	txHash, err := chainhash.NewHashFromStr(c.TxID)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.TxID)
+	}
+
+	// The transaction may have been mined or evicted since it was listed,
+	// so report it the same way as any other unknown transaction.
+	entry, err := s.server.txMemPool.MempoolEntry(txHash)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCNoTxInfo,
+			Message: "Transaction not in mempool",
+		}
+	}
+	return entry, nil
+}
+
 // handleGetMempoolInfo implements the getmempoolinfo command.
 func handleGetMempoolInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	mempoolTxns := s.server.txMemPool.TxDescs()
 
 	var numBytes int64
 	for _, txD := range mempoolTxns {
-		numBytes += int64(txD.Tx.MsgTx().SerializeSize())
+		numBytes += int64(txD.Tx.SerializeSize())
 	}
 
+	minFeeRate := s.server.txMemPool.MinRelayFeeRate()
 	ret := &btcjson.GetMempoolInfoResult{
-		Size:  int64(len(mempoolTxns)),
-		Bytes: numBytes,
+		Size:          int64(len(mempoolTxns)),
+		Bytes:         numBytes,
+		MempoolMinFee: provautil.Amount(minFeeRate).ToRMG(),
+		MinRelayTxFee: cfg.minRelayTxFee.ToRMG(),
 	}
 
 	return ret, nil
 }
 
+// handleGetMetrics implements the getmetrics command.
+func handleGetMetrics(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	samples := s.server.metrics.Snapshot()
+	results := make([]btcjson.GetMetricsResult, 0, len(samples))
+	for i := range samples {
+		sample := &samples[i]
+		result := btcjson.GetMetricsResult{
+			Name: sample.Name,
+			Type: string(sample.Type),
+			Help: sample.Help,
+		}
+		if sample.Type != metrics.TypeHistogram {
+			result.Value = &sample.Value
+			results = append(results, result)
+			continue
+		}
+		result.Count = &sample.Count
+		result.Sum = &sample.Sum
+		result.Buckets = make([]btcjson.MetricBucketResult, 0,
+			len(sample.Buckets))
+		for _, bucket := range sample.Buckets {
+			result.Buckets = append(result.Buckets,
+				btcjson.MetricBucketResult{
+					UpperBound: metrics.FormatFloat(bucket.UpperBound),
+					Count:      bucket.Count,
+				})
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
 // handleGetMiningInfo implements the getmininginfo command. We only return the
 // fields that are not related to wallet functionality.
 func handleGetMiningInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
@@ -2219,18 +3185,24 @@ func handleGetMiningInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{
 		}
 	}
 
+	window, err := difficultyWindowResult(s)
+	if err != nil {
+		return nil, err
+	}
+
 	best := s.chain.BestSnapshot()
 	result := btcjson.GetMiningInfoResult{
 		Blocks:           int64(best.Height),
 		CurrentBlockSize: best.BlockSize,
 		CurrentBlockTx:   best.NumTxns,
-		Difficulty:       getDifficultyRatio(best.Bits),
+		Difficulty:       getDifficultyRatio(best.Bits, s.server.chainParams),
 		Generate:         s.server.cpuMiner.IsMining(),
 		GenProcLimit:     s.server.cpuMiner.NumWorkers(),
 		HashesPerSec:     int64(s.server.cpuMiner.HashesPerSecond()),
 		NetworkHashPS:    networkHashesPerSec,
 		PooledTx:         uint64(s.server.txMemPool.Count()),
 		TestNet:          cfg.TestNet,
+		Window:           *window,
 	}
 	return &result, nil
 }
@@ -2239,105 +3211,132 @@ func handleGetMiningInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{
 func handleGetNetTotals(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	totalBytesRecv, totalBytesSent := s.server.NetTotals()
 	reply := &btcjson.GetNetTotalsResult{
-		TotalBytesRecv: totalBytesRecv,
-		TotalBytesSent: totalBytesSent,
-		TimeMillis:     time.Now().UTC().UnixNano() / int64(time.Millisecond),
-	}
+		TotalBytesRecv:   totalBytesRecv,
+		TotalBytesSent:   totalBytesSent,
+		TimeMillis:       time.Now().UTC().UnixNano() / int64(time.Millisecond),
+		InboundEvictions: s.server.InboundEvictions(),
+	}
+	msgsRecv, msgsSent := s.server.MsgTotals()
+	reply.SentPerMsg = msgTrafficResults(msgsSent)
+	reply.RecvPerMsg = msgTrafficResults(msgsRecv)
 	return reply, nil
 }
 
-// handleGetNetworkHashPS implements the getnetworkhashps command.
-func handleGetNetworkHashPS(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
-	// Note: All valid error return paths should return an int64.
-	// Literal zeros are inferred as int, and won't coerce to int64
-	// because the return value is an interface{}.
+// networkHashPSSpan returns the heights of the first and last block of the
+// span getnetworkhashps estimates the hash rate over.  The span ends at the
+// passed height, or the best block when it is negative, and covers the passed
+// number of blocks, or the difficulty averaging window when it is not
+// positive.  False is returned when no estimate can be made, such as for a
+// height beyond the best block or a span without any blocks.
+func networkHashPSSpan(blocks, height, bestHeight int32, window int) (int32, int32, bool) {
+	endHeight := height
+	if endHeight > bestHeight || endHeight == 0 {
+		return 0, 0, false
+	}
+	if endHeight < 0 {
+		endHeight = bestHeight
+	}
 
-	c := cmd.(*btcjson.GetNetworkHashPSCmd)
+	// The difficulty is recalculated every block from the averaging
+	// window, so the blocks since the last difficulty change are the
+	// blocks of the window.
+	if blocks <= 0 {
+		blocks = int32(window)
+	}
+	startHeight := endHeight - blocks
+	if startHeight < 0 {
+		startHeight = 0
+	}
+	if startHeight == endHeight {
+		return 0, 0, false
+	}
+	return startHeight, endHeight, true
+}
 
-	// When the passed height is too high or zero, just return 0 now
-	// since we can't reasonably calculate the number of network hashes
-	// per second from invalid values.  When it's negative, use the current
-	// best block height.
-	best := s.chain.BestSnapshot()
-	endHeight := int32(-1)
-	if c.Height != nil {
-		endHeight = int32(*c.Height)
+// calcNetworkHashPS returns the estimated network hashes per second from the
+// total chain work and timestamps of the first and last block of a span.  The
+// work of the first block is not part of the span since it was done before
+// its timestamp.  Zero is returned when the timestamps do not advance across
+// the span, which can happen due to clock skew between miners.
+func calcNetworkHashPS(startWork, endWork *big.Int, startTime, endTime time.Time) int64 {
+	timeDiff := int64(endTime.Sub(startTime) / time.Second)
+	if timeDiff <= 0 {
+		return 0
 	}
-	if endHeight > int32(best.Height) || endHeight == 0 {
-		return int64(0), nil
+	work := new(big.Int).Sub(endWork, startWork)
+	if work.Sign() <= 0 {
+		return 0
 	}
-	if endHeight < 0 {
-		endHeight = int32(best.Height)
+	hashesPerSec := work.Div(work, big.NewInt(timeDiff))
+	if hashesPerSec.BitLen() > 63 {
+		return math.MaxInt64
 	}
+	return hashesPerSec.Int64()
+}
 
-	// Calculate the number of blocks per retarget interval based on the
-	// chain parameters.
-	blocksPerRetarget := int32(s.server.chainParams.PowAveragingWindow)
+// handleGetNetworkHashPS implements the getnetworkhashps command.
+func handleGetNetworkHashPS(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	// Note: All valid error return paths should return an int64.
+	// Literal zeros are inferred as int, and won't coerce to int64
+	// because the return value is an interface{}.
 
-	// Calculate the starting block height based on the passed number of
-	// blocks.  When the passed value is negative, use the last block the
-	// difficulty changed as the starting height.  Also make sure the
-	// starting height is not before the beginning of the chain.
-	// TODO(prova): adjust this calculation for the rolling difficulty avg.
-	numBlocks := int32(120)
+	c := cmd.(*btcjson.GetNetworkHashPSCmd)
+	blocks, height := int32(-1), int32(-1)
 	if c.Blocks != nil {
-		numBlocks = int32(*c.Blocks)
+		blocks = int32(*c.Blocks)
 	}
-	var startHeight int32
-	if numBlocks <= 0 {
-		startHeight = endHeight - ((endHeight % blocksPerRetarget) + 1)
-	} else {
-		startHeight = endHeight - numBlocks
+	if c.Height != nil {
+		height = int32(*c.Height)
 	}
-	if startHeight < 0 {
-		startHeight = 0
+
+	// Return 0 when no estimate can be made from the passed values.
+	best := s.chain.BestSnapshot()
+	startHeight, endHeight, ok := networkHashPSSpan(blocks, height,
+		int32(best.Height), s.server.chainParams.PowAveragingWindow)
+	if !ok {
+		return int64(0), nil
 	}
 	rpcsLog.Debugf("Calculating network hashes per second from %d to %d",
 		startHeight, endHeight)
 
-	// Find the min and max block timestamps as well as calculate the total
-	// amount of work that happened between the start and end blocks.
-	var minTimestamp, maxTimestamp time.Time
-	totalWork := big.NewInt(0)
-	for curHeight := startHeight; curHeight <= endHeight; curHeight++ {
-		hash, err := s.chain.BlockHashByHeight(uint32(curHeight))
+	// Fetch the total chain work and the timestamp of the blocks at both
+	// ends of the span.
+	var works [2]*big.Int
+	var timestamps [2]time.Time
+	for i, blockHeight := range []int32{startHeight, endHeight} {
+		hash, err := s.chain.BlockHashByHeight(uint32(blockHeight))
 		if err != nil {
 			context := "Failed to fetch block hash"
 			return nil, internalRPCError(err.Error(), context)
 		}
-
-		// Fetch the header from chain.
 		header, err := s.chain.FetchHeader(hash)
 		if err != nil {
 			context := "Failed to fetch block header"
 			return nil, internalRPCError(err.Error(), context)
 		}
-
-		if curHeight == startHeight {
-			minTimestamp = header.Timestamp
-			maxTimestamp = minTimestamp
-		} else {
-			totalWork.Add(totalWork, blockchain.CalcWork(header.Bits))
-
-			if minTimestamp.After(header.Timestamp) {
-				minTimestamp = header.Timestamp
-			}
-			if maxTimestamp.Before(header.Timestamp) {
-				maxTimestamp = header.Timestamp
-			}
+		works[i], err = s.chain.ChainWork(hash)
+		if err != nil {
+			context := "Failed to fetch chain work"
+			return nil, internalRPCError(err.Error(), context)
 		}
+		timestamps[i] = header.Timestamp
 	}
 
-	// Calculate the difference in seconds between the min and max block
-	// timestamps and avoid division by zero in the case where there is no
-	// time difference.
-	timeDiff := int64(maxTimestamp.Sub(minTimestamp) / time.Second)
-	if timeDiff == 0 {
-		return int64(0), nil
-	}
+	return calcNetworkHashPS(works[0], works[1], timestamps[0],
+		timestamps[1]), nil
+}
 
-	hashesPerSec := new(big.Int).Div(totalWork, big.NewInt(timeDiff))
-	return hashesPerSec.Int64(), nil
+// msgTrafficResults converts the passed per command message tallies to the
+// form returned by the getpeerinfo and getnettotals commands.
+func msgTrafficResults(msgs map[string]peer.MsgStats) map[string]btcjson.MsgTrafficResult {
+	results := make(map[string]btcjson.MsgTrafficResult, len(msgs))
+	for command, stats := range msgs {
+		results[command] = btcjson.MsgTrafficResult{
+			Count: stats.Count,
+			Bytes: stats.Bytes,
+		}
+	}
+	return results
 }
 
 // handleGetPeerInfo implements the getpeerinfo command.
@@ -2359,15 +3358,27 @@ func handleGetPeerInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 			BytesRecv:      statsSnap.BytesRecv,
 			ConnTime:       statsSnap.ConnTime.Unix(),
 			PingTime:       float64(statsSnap.LastPingMicros),
+			MinPing:        float64(statsSnap.MinPingMicros),
+			AvgPing:        float64(statsSnap.AvgPingMicros),
 			TimeOffset:     statsSnap.TimeOffset,
 			Version:        statsSnap.Version,
 			SubVer:         statsSnap.UserAgent,
 			Inbound:        statsSnap.Inbound,
+			NetworkGroup:   addrmgr.GroupKey(p.NA()),
 			StartingHeight: statsSnap.StartingHeight,
 			CurrentHeight:  statsSnap.LastBlock,
-			BanScore:       int32(p.banScore.Int()),
+			BanScore:       int32(s.server.banManager.Score(p.host())),
 			FeeFilter:      atomic.LoadInt64(&p.feeFilter),
+			Capabilities:   statsSnap.Capabilities.Names(),
 			SyncNode:       p == syncPeer,
+			LastBlock:      atomic.LoadInt64(&p.lastBlockTime),
+			LastTx:         atomic.LoadInt64(&p.lastTxTime),
+			SentPerMsg:     msgTrafficResults(statsSnap.MsgsSent),
+			RecvPerMsg:     msgTrafficResults(statsSnap.MsgsRecv),
+
+			BlocksAnnounced: statsSnap.Relay.BlocksAnnounced,
+			TxsAnnounced:    statsSnap.Relay.TxsAnnounced,
+			KnownInvSkipped: statsSnap.Relay.KnownSkipped,
 		}
 		if p.LastPingNonce() != 0 {
 			wait := float64(time.Since(statsSnap.LastPingTime).Nanoseconds())
@@ -2379,6 +3390,22 @@ func handleGetPeerInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 	return infos, nil
 }
 
+// handleGetPendingBroadcasts implements the getpendingbroadcasts command.
+func handleGetPendingBroadcasts(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	pending := s.server.broadcastManager.Pending()
+	results := make([]btcjson.GetPendingBroadcastsResult, 0, len(pending))
+	for _, p := range pending {
+		results = append(results, btcjson.GetPendingBroadcastsResult{
+			TxID:          p.txDesc.Tx.Hash().String(),
+			Added:         p.added.Unix(),
+			LastAnnounced: p.lastAnnounced.Unix(),
+			NextAnnounce:  p.nextAnnounce.Unix(),
+			Announcements: p.announcements,
+		})
+	}
+	return results, nil
+}
+
 // handleGetRawMempool implements the getrawmempool command.
 func handleGetRawMempool(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*btcjson.GetRawMempoolCmd)
@@ -2519,6 +3546,13 @@ func handleGetRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan str
 	return *rawTxn, nil
 }
 
+// handleGetRPCInfo implements the getrpcinfo command.
+func handleGetRPCInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	return &btcjson.GetRPCInfoResult{
+		ActiveCommands: s.activeCommands.snapshot(time.Now()),
+	}, nil
+}
+
 // handleGetTxOut handles gettxout commands.
 func handleGetTxOut(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*btcjson.GetTxOutCmd)
@@ -2625,7 +3659,269 @@ func handleGetTxOut(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (i
 		},
 		Coinbase: isCoinbase,
 	}
-	return txOutReply, nil
+	return txOutReply, nil
+}
+
+// txOutProof returns a hex-encoded merkle block which proves the inclusion of
+// the transactions with the passed hashes in the passed block.  An error is
+// returned when any of the transactions is not part of the block.
+func txOutProof(block *provautil.Block, txHashes []*chainhash.Hash) (string, error) {
+	mBlock, matched := bloom.NewMerkleBlockWithTxs(block, txHashes)
+	if len(matched) != len(txHashes) {
+		return "", &btcjson.RPCError{
+			Code: btcjson.ErrRPCInvalidAddressOrKey,
+			Message: fmt.Sprintf("Not all transactions found in "+
+				"block %v", block.Hash()),
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := mBlock.BtcEncode(&buf, wire.ProtocolVersion); err != nil {
+		context := "Failed to encode proof"
+		return "", internalRPCError(err.Error(), context)
+	}
+	return hex.EncodeToString(buf.Bytes()), nil
+}
+
+// handleGetTxOutProof implements the gettxoutproof command.
+func handleGetTxOutProof(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetTxOutProofCmd)
+
+	if len(c.TxIDs) == 0 {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "At least one transaction id must be specified",
+		}
+	}
+	txHashes := make([]*chainhash.Hash, 0, len(c.TxIDs))
+	seen := make(map[chainhash.Hash]struct{}, len(c.TxIDs))
+	for _, txID := range c.TxIDs {
+		txHash, err := chainhash.NewHashFromStr(txID)
+		if err != nil {
+			return nil, rpcDecodeHexError(txID)
+		}
+		if _, ok := seen[*txHash]; ok {
+			return nil, &btcjson.RPCError{
+				Code: btcjson.ErrRPCInvalidParameter,
+				Message: fmt.Sprintf("Duplicate transaction id "+
+					"%v", txHash),
+			}
+		}
+		seen[*txHash] = struct{}{}
+		txHashes = append(txHashes, txHash)
+	}
+
+	// Locate the block which contains the transactions via the transaction
+	// index unless it is specified.  All of the transactions must be in the
+	// same block since a proof only covers a single block.
+	var blockHash *chainhash.Hash
+	if c.BlockHash != nil {
+		hash, err := chainhash.NewHashFromStr(*c.BlockHash)
+		if err != nil {
+			return nil, rpcDecodeHexError(*c.BlockHash)
+		}
+		blockHash = hash
+	} else {
+		txIndex := s.server.txIndex
+		if txIndex == nil {
+			return nil, &btcjson.RPCError{
+				Code: btcjson.ErrRPCNoTxInfo,
+				Message: "The transaction index must be " +
+					"enabled to locate the block " +
+					"(specify --txindex or a block hash)",
+			}
+		}
+		for _, txHash := range txHashes {
+			blockRegion, err := txIndex.TxBlockRegion(txHash)
+			if err != nil {
+				context := "Failed to retrieve transaction location"
+				return nil, internalRPCError(err.Error(), context)
+			}
+			if blockRegion == nil {
+				return nil, rpcNoTxInfoError(txHash)
+			}
+			if blockHash == nil {
+				blockHash = blockRegion.Hash
+				continue
+			}
+			if !blockRegion.Hash.IsEqual(blockHash) {
+				return nil, &btcjson.RPCError{
+					Code: btcjson.ErrRPCInvalidParameter,
+					Message: fmt.Sprintf("Transactions %v and "+
+						"%v are in different blocks",
+						txHashes[0], txHash),
+				}
+			}
+		}
+	}
+
+	// Only proofs for blocks in the main chain can be verified, so refuse
+	// to create proofs for stale blocks.
+	mainChain, err := s.chain.MainChainHasBlock(blockHash)
+	if err != nil {
+		context := "Failed to check main chain for block"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	if !mainChain {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCBlockNotFound,
+			Message: fmt.Sprintf("Block %v is not in the main "+
+				"chain", blockHash),
+		}
+	}
+
+	block, err := s.chain.BlockByHash(blockHash)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCBlockNotFound,
+			Message: "Block not found",
+		}
+	}
+	return txOutProof(block, txHashes)
+}
+
+// handleGetTxOutSetInfo implements the gettxoutsetinfo command.
+func handleGetTxOutSetInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	stats := s.chain.UtxoSetStats()
+	return &btcjson.GetTxOutSetInfoResult{
+		Height:          int32(stats.Height),
+		BestBlock:       stats.Hash.String(),
+		TxOuts:          stats.NumUtxos,
+		BytesSerialized: stats.SerializedSize,
+		HashSerialized:  stats.Commitment.String(),
+		TotalAmount:     provautil.Amount(stats.TotalAmount).ToRMG(),
+	}, nil
+}
+
+// validatorInfo summarizes the blocks signed by each of the passed active
+// validate keys given the keys which signed the most recent blocks of the best
+// chain, newest first, ending at the block of the passed height.
+//
+// The window counts cover all of the passed keys, while the trailing counts
+// only cover the most recent maxBlocks of them, which is the number of blocks
+// a single key is permitted to sign within the window.
+func validatorInfo(validateKeys btcec.PublicKeySet, recentKeys []wire.BlockValidatingPubKey, height uint32, maxBlocks int) []btcjson.ValidatorInfoResult {
+	validators := make([]btcjson.ValidatorInfoResult, 0, len(validateKeys))
+	for i := range validateKeys {
+		var pubKey wire.BlockValidatingPubKey
+		copy(pubKey[:], validateKeys[i].SerializeCompressed())
+
+		info := btcjson.ValidatorInfoResult{
+			PubKey:        pubKey.String(),
+			CanSign:       true,
+			RecentHeights: make([]uint32, 0, maxBlocks),
+		}
+		for age, key := range recentKeys {
+			if key != pubKey {
+				continue
+			}
+			info.WindowBlocks++
+			if age < maxBlocks {
+				info.TrailingBlocks++
+			}
+			info.RecentHeights = append(info.RecentHeights,
+				height-uint32(age))
+		}
+
+		// The key may sign the next block unless that would exceed its
+		// share of the window, which is checked with the same rule the
+		// chain enforces on connected blocks.
+		if maxBlocks > 0 && len(recentKeys) > 0 {
+			info.CanSign = !blockchain.IsGenerationShareRateLimited(
+				pubKey, recentKeys[1:], maxBlocks, true,
+				recentKeys[0])
+		}
+		validators = append(validators, info)
+	}
+	return validators
+}
+
+// validatorLookbackHeights sets the heights of the blocks each of the passed
+// validate keys signed within the lookback most recent blocks ending at the
+// passed height, newest first, from the sig key id index.  The validators must
+// be in the same order as the keys.
+func validatorLookbackHeights(idx *indexers.SigKeyIDIndex, validateKeys btcec.PublicKeySet, validators []btcjson.ValidatorInfoResult, height uint32, lookback int) error {
+	var startHeight uint32
+	if uint32(lookback) <= height {
+		startHeight = height - uint32(lookback) + 1
+	}
+	for i := range validateKeys {
+		var pubKey wire.BlockValidatingPubKey
+		copy(pubKey[:], validateKeys[i].SerializeCompressed())
+		keyID := indexers.SigKeyID(pubKey)
+		blocks, err := idx.BlocksBySigKeyID(keyID[:], startHeight,
+			lookback)
+		if err != nil {
+			return err
+		}
+
+		// Ignore any blocks the index already includes which were
+		// connected after the passed height.
+		heights := make([]uint32, 0, len(blocks))
+		for j := len(blocks) - 1; j >= 0; j-- {
+			if blocks[j].Height <= height {
+				heights = append(heights, blocks[j].Height)
+			}
+		}
+		validators[i].LookbackHeights = heights
+	}
+	return nil
+}
+
+// handleGetValidatorInfo implements the getvalidatorinfo command.
+func handleGetValidatorInfo(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.GetValidatorInfoCmd)
+	var lookback int
+	if c.Lookback != nil {
+		lookback = *c.Lookback
+	}
+	if lookback < 0 {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "Lookback must not be negative",
+		}
+	}
+	if lookback > 0 && s.server.sigKeyIDIndex == nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCMisc,
+			Message: "Sig key id index must be enabled (--sigkeyidindex)",
+		}
+	}
+
+	params := s.server.chainParams
+	best := s.chain.BestSnapshot()
+	validateKeys := s.chain.AdminKeySets()[btcec.ValidateKeySet]
+
+	// Fetch the keys of the averaging window from the window index of the
+	// best chain rather than loading the block headers.
+	recentKeys, err := s.chain.RecentValidateKeys(best.Hash,
+		params.PowAveragingWindow)
+	if err != nil {
+		context := "Failed to fetch recent validate keys"
+		return nil, internalRPCError(err.Error(), context)
+	}
+
+	result := &btcjson.GetValidatorInfoResult{
+		Hash:       best.Hash.String(),
+		Height:     best.Height,
+		WindowSize: params.PowAveragingWindow,
+		MaxBlocks:  params.ChainWindowMaxBlocks,
+		Validators: validatorInfo(validateKeys, recentKeys, best.Height,
+			params.ChainWindowMaxBlocks),
+	}
+
+	// Look up the blocks each key signed beyond the averaging window from
+	// the sig key id index when requested.
+	if lookback > 0 {
+		result.Lookback = lookback
+		err := validatorLookbackHeights(s.server.sigKeyIDIndex,
+			validateKeys, result.Validators, best.Height, lookback)
+		if err != nil {
+			context := "Failed to fetch blocks by sig key id"
+			return nil, internalRPCError(err.Error(), context)
+		}
+	}
+	return result, nil
 }
 
 // handleHelp implements the help command.
@@ -2667,6 +3963,44 @@ func handleHelp(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (inter
 	return help, nil
 }
 
+// handleInvalidateBlock implements the invalidateblock command.
+func handleInvalidateBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.InvalidateBlockCmd)
+
+	hash, err := chainhash.NewHashFromStr(c.BlockHash)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.BlockHash)
+	}
+	if exists, err := s.chain.HaveBlock(hash); err != nil || !exists {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCBlockNotFound,
+			Message: "Block not found",
+		}
+	}
+	if err := s.chain.InvalidateBlock(hash); err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCMisc,
+			Message: "Failed to invalidate block: " + err.Error(),
+		}
+	}
+	return nil, nil
+}
+
+// handleListBanned implements the listbanned command.
+func handleListBanned(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	bans := s.server.banManager.Bans()
+	results := make([]btcjson.ListBannedResult, 0, len(bans))
+	for _, ban := range bans {
+		results = append(results, btcjson.ListBannedResult{
+			Address:     ban.Subnet.String(),
+			BannedUntil: ban.Until.Unix(),
+			BanCreated:  ban.Created.Unix(),
+			BanReason:   ban.Reason,
+		})
+	}
+	return results, nil
+}
+
 // handlePing implements the ping command.
 func handlePing(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	// Ask server to ping \o_
@@ -2680,6 +4014,26 @@ func handlePing(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (inter
 	return nil, nil
 }
 
+// handlePrioritiseTransaction implements the prioritisetransaction command.
+func handlePrioritiseTransaction(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.PrioritiseTransactionCmd)
+	txHash, err := chainhash.NewHashFromStr(c.TxID)
+	if err != nil {
+		return nil, rpcDecodeHexError(c.TxID)
+	}
+
+	// The fee delta only lives as long as the transaction is in the pool,
+	// so it can't be applied to transactions which are not.
+	err = s.server.txMemPool.PrioritiseTransaction(txHash, c.FeeDelta)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCNoTxInfo,
+			Message: "Transaction not in mempool",
+		}
+	}
+	return true, nil
+}
+
 // retrievedTx represents a transaction that was either loaded from the
 // transaction memory pool or from the database.  When a transaction is loaded
 // from the database, it is loaded with the raw serialized bytes while the
@@ -2965,16 +4319,23 @@ func handleSearchRawTransactions(s *rpcServer, cmd interface{}, closeChan <-chan
 		reverse = *c.Reverse
 	}
 
+	// Override the flag for including unconfirmed transactions from the
+	// mempool if needed.
+	includeMempool := true
+	if c.IncludeMempool != nil {
+		includeMempool = *c.IncludeMempool
+	}
+
 	// Add transactions from mempool first if client asked for reverse
-	// order.  Otherwise, they will be added last (as needed depending on
-	// the requested counts).
+	// order and did not exclude them.  Otherwise, they will be added last
+	// (as needed depending on the requested counts).
 	//
 	// NOTE: This code doesn't sort by dependency.  This might be something
 	// to do in the future for the client's convenience, or leave it to the
 	// client.
 	numSkipped := uint32(0)
 	addressTxns := make([]retrievedTx, 0, numRequested)
-	if reverse {
+	if reverse && includeMempool {
 		// Transactions in the mempool are not in a block header yet,
 		// so the block header field in the retieved transaction struct
 		// is left nil.
@@ -3028,7 +4389,7 @@ func handleSearchRawTransactions(s *rpcServer, cmd interface{}, closeChan <-chan
 
 	// Add transactions from mempool last if client did not request reverse
 	// order and the number of results is still under the number requested.
-	if !reverse && len(addressTxns) < numRequested {
+	if !reverse && includeMempool && len(addressTxns) < numRequested {
 		// Transactions in the mempool are not in a block header yet,
 		// so the block header field in the retieved transaction struct
 		// is left nil.
@@ -3161,30 +4522,11 @@ func handleSearchRawTransactions(s *rpcServer, cmd interface{}, closeChan <-chan
 	return srtList, nil
 }
 
-// handleSendRawTransaction implements the sendrawtransaction command.
-func handleSendRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
-	c := cmd.(*btcjson.SendRawTransactionCmd)
-	// Deserialize and send off to tx relay
-	hexStr := c.HexTx
-	if len(hexStr)%2 != 0 {
-		hexStr = "0" + hexStr
-	}
-	serializedTx, err := hex.DecodeString(hexStr)
-	if err != nil {
-		return nil, rpcDecodeHexError(hexStr)
-	}
-	var msgTx wire.MsgTx
-	err = msgTx.Deserialize(bytes.NewReader(serializedTx))
-	if err != nil {
-		return nil, &btcjson.RPCError{
-			Code:    btcjson.ErrRPCDeserialization,
-			Message: "TX decode failed: " + err.Error(),
-		}
-	}
-
+// submitTransaction processes the passed locally submitted transaction through
+// the memory pool, announces it to peers and tracks it for rebroadcast.
+func submitTransaction(s *rpcServer, tx *provautil.Tx) error {
 	// User 0 for the tag to represent local node
-	tx := provautil.NewTx(&msgTx)
-	acceptedTxs, err := s.server.txMemPool.ProcessTransaction(tx, false, false, 0)
+	acceptedTxs, err := s.server.txMemPool.ProcessTransaction(tx, false, false, 0, 0)
 	if err != nil {
 		// When the error is a rule error, it means the transaction was
 		// simply rejected as opposed to something actually going wrong,
@@ -3199,7 +4541,7 @@ func handleSendRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan st
 			rpcsLog.Errorf("Failed to process transaction %v: %v",
 				tx.Hash(), err)
 		}
-		return nil, &btcjson.RPCError{
+		return &btcjson.RPCError{
 			Code:    btcjson.ErrRPCDeserialization,
 			Message: "TX rejected: " + err.Error(),
 		}
@@ -3217,20 +4559,116 @@ func handleSendRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan st
 
 		errStr := fmt.Sprintf("transaction %v is not in accepted list",
 			tx.Hash())
-		return nil, internalRPCError(errStr, "")
+		return internalRPCError(errStr, "")
 	}
 
 	s.server.AnnounceNewTransactions(acceptedTxs)
 
-	// Keep track of all the sendrawtransaction request txns so that they
+	// Keep track of all the transactions submitted via RPC so that they
 	// can be rebroadcast if they don't make their way into a block.
-	txD := acceptedTxs[0]
-	iv := wire.NewInvVect(wire.InvTypeTx, txD.Tx.Hash())
-	s.server.AddRebroadcastInventory(iv, txD)
+	s.server.broadcastManager.Add(acceptedTxs[0])
+
+	return nil
+}
+
+// handleSendRawTransaction implements the sendrawtransaction command.
+func handleSendRawTransaction(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.SendRawTransactionCmd)
+	// Deserialize and send off to tx relay
+	hexStr := c.HexTx
+	if len(hexStr)%2 != 0 {
+		hexStr = "0" + hexStr
+	}
+	serializedTx, err := hex.DecodeString(hexStr)
+	if err != nil {
+		return nil, rpcDecodeHexError(hexStr)
+	}
+	var msgTx wire.MsgTx
+	err = msgTx.Deserialize(bytes.NewReader(serializedTx))
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCDeserialization,
+			Message: "TX decode failed: " + err.Error(),
+		}
+	}
+
+	tx := provautil.NewTx(&msgTx)
+	if err := submitTransaction(s, tx); err != nil {
+		return nil, err
+	}
 
 	return tx.Hash().String(), nil
 }
 
+// handleSetBan implements the setban command.
+func handleSetBan(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.SetBanCmd)
+
+	subnet, err := connmgr.ParseSubnet(c.SubNet)
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCClientInvalidIPOrSubnet,
+			Message: "Invalid IP/Subnet: " + err.Error(),
+		}
+	}
+
+	switch c.SubCmd {
+	case btcjson.SBAdd:
+		// Ban for the configured ban duration unless a ban time in
+		// seconds, or the time the ban ends at when it is absolute, is
+		// specified.
+		now := time.Now()
+		until := now.Add(cfg.BanDuration)
+		if c.BanTime != nil && *c.BanTime > 0 {
+			if c.Absolute != nil && *c.Absolute {
+				until = time.Unix(*c.BanTime, 0)
+			} else {
+				until = now.Add(time.Duration(*c.BanTime) *
+					time.Second)
+			}
+		}
+		if !until.After(now) {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCInvalidParameter,
+				Message: "Ban time is in the past",
+			}
+		}
+
+		err := s.server.banManager.Ban(subnet, until, "manually added")
+		if err == connmgr.ErrAlreadyBanned {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCClientNodeAlreadyAdded,
+				Message: "IP/Subnet already banned",
+			}
+		}
+		if err != nil {
+			context := "Failed to ban IP/Subnet"
+			return nil, internalRPCError(err.Error(), context)
+		}
+
+		// Disconnect the peers which are connected from and to the
+		// banned addresses.
+		s.server.DisconnectBanned()
+
+	case btcjson.SBRemove:
+		if err := s.server.banManager.Unban(subnet); err != nil {
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCClientInvalidIPOrSubnet,
+				Message: "IP/Subnet is not banned",
+			}
+		}
+
+	default:
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidParameter,
+			Message: "invalid subcommand for setban",
+		}
+	}
+
+	// no data returned unless an error.
+	return nil, nil
+}
+
 // handleSetGenerate implements the setgenerate command.
 func handleSetGenerate(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*btcjson.SetGenerateCmd)
@@ -3340,15 +4778,82 @@ func handleSubmitBlock(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 		}
 	}
 
-	_, err = s.server.blockManager.ProcessBlock(block, blockchain.BFNone)
+	// Report blocks which are already known as duplicates instead of
+	// processing them again, so they are not mistaken for rejected blocks.
+	// Known blocks which are not part of the main chain are inconclusive
+	// since they might still become part of it, unless they are known to
+	// be invalid.
+	blockHash := block.Hash()
+	exists, err := s.chain.HaveBlock(blockHash)
+	if err != nil {
+		context := "Failed to check for existing block"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	if exists {
+		invalid, err := s.chain.IsKnownInvalid(blockHash)
+		if err != nil {
+			context := "Failed to check block validity"
+			return nil, internalRPCError(err.Error(), context)
+		}
+		if invalid {
+			return "duplicate-invalid", nil
+		}
+		mainChain, err := s.chain.MainChainHasBlock(blockHash)
+		if err != nil {
+			context := "Failed to check main chain for block"
+			return nil, internalRPCError(err.Error(), context)
+		}
+		if !mainChain {
+			return "duplicate-inconclusive", nil
+		}
+		return "duplicate", nil
+	}
+
+	isOrphan, err := s.server.blockManager.ProcessBlock(block,
+		blockchain.BFNone)
+	if err != nil {
+		if _, ok := err.(blockchain.RuleError); !ok {
+			err := rpcsLog.Errorf("Failed to process block %s: %v",
+				blockHash, err)
+			return nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCVerify,
+				Message: err.Error(),
+			}
+		}
+
+		rpcsLog.Infof("Rejected block %s via submitblock: %v",
+			blockHash, err)
+		return chainErrToGBTErrString(err), nil
+	}
+
+	// Blocks which were accepted as orphans or extend a side chain do not
+	// become part of the main chain yet, which is the case for stale blocks
+	// in particular.
+	if isOrphan {
+		rpcsLog.Infof("Accepted orphan block %s via submitblock",
+			blockHash)
+		return "inconclusive", nil
+	}
+	mainChain, err := s.chain.MainChainHasBlock(blockHash)
 	if err != nil {
-		return fmt.Sprintf("rejected: %s", err.Error()), nil
+		context := "Failed to check main chain for block"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	if !mainChain {
+		rpcsLog.Infof("Accepted side chain block %s via submitblock",
+			blockHash)
+		return "inconclusive", nil
 	}
 
-	rpcsLog.Infof("Accepted block %s via submitblock", block.Hash())
+	rpcsLog.Infof("Accepted block %s via submitblock", blockHash)
 	return nil, nil
 }
 
+// handleUptime implements the uptime command.
+func handleUptime(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	return time.Now().Unix() - s.server.startupTime, nil
+}
+
 // handleValidateAddress implements the validateaddress command.
 func handleValidateAddress(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
 	c := cmd.(*btcjson.ValidateAddressCmd)
@@ -3360,45 +4865,29 @@ func handleValidateAddress(s *rpcServer, cmd interface{}, closeChan <-chan struc
 		return result, nil
 	}
 
-	result.Address = addr.EncodeAddress()
-	result.IsValid = true
-
-	return result, nil
-}
-
-func verifyChain(s *rpcServer, level int32, depth uint32) error {
-	best := s.chain.BestSnapshot()
-	finishHeight := best.Height - depth
-	if finishHeight < 0 {
-		finishHeight = 0
+	if _, ok := addr.(*provautil.AddressProva); ok {
+		result.Type = "aztec"
 	}
-	rpcsLog.Infof("Verifying chain for %d blocks at level %d",
-		best.Height-finishHeight, level)
 
-	for height := best.Height; height > finishHeight; height-- {
-		// Level 0 just looks up the block.
-		block, err := s.chain.BlockByHeight(height)
-		if err != nil {
-			rpcsLog.Errorf("Verify is unable to fetch block at "+
-				"height %d: %v", height, err)
-			return err
-		}
+	keyIDs := addr.ScriptKeyIDs()
+	result.KeyIDs = make([]uint32, 0, len(keyIDs))
+	for _, keyID := range keyIDs {
+		result.KeyIDs = append(result.KeyIDs, uint32(keyID))
+	}
 
-		// Level 1 does basic chain sanity checks.
-		if level > 0 {
-			err := blockchain.CheckBlockSanity(block,
-				activeNetParams.PowLimit, s.server.timeSource)
-			if err != nil {
-				rpcsLog.Errorf("Verify is unable to validate "+
-					"block at hash %v height %d: %v",
-					block.Hash(), height, err)
-				return err
-			}
-		}
+	// Not every address type can be paid to, so the script is only
+	// reported when there is one.
+	if pkScript, err := txscript.PayToAddrScript(addr); err == nil {
+		result.ScriptPubKey = hex.EncodeToString(pkScript)
 	}
-	rpcsLog.Infof("Chain verify completed successfully")
 
-	return nil
+	// Addresses of the other registered networks decode as well, but they
+	// must not be paid to on the active network.
+	result.Address = addr.EncodeAddress()
+	result.IsValid = addr.IsForNet(activeNetParams.Params)
+	result.IsForOtherNet = !result.IsValid
+
+	return result, nil
 }
 
 // handleVerifyChain implements the verifychain command.
@@ -3413,10 +4902,142 @@ func handleVerifyChain(s *rpcServer, cmd interface{}, closeChan <-chan struct{})
 		checkDepth = *c.CheckDepth
 	}
 
-	err := verifyChain(s, checkLevel, uint32(checkDepth))
+	// The chain logs the progress of the verification as it goes.
+	err := s.chain.VerifyChain(int(checkLevel), int(checkDepth))
+	if err != nil {
+		rpcsLog.Errorf("Chain verification failed: %v", err)
+	}
 	return err == nil, nil
 }
 
+// decodeTxOutProof decodes the passed hex-encoded merkle block and verifies its
+// partial merkle tree against the merkle root of its header.  It returns the
+// merkle block along with the hashes of the proven transactions.
+func decodeTxOutProof(proof string) (*wire.MsgMerkleBlock, []*chainhash.Hash, error) {
+	if len(proof)%2 != 0 {
+		proof = "0" + proof
+	}
+	serializedProof, err := hex.DecodeString(proof)
+	if err != nil {
+		return nil, nil, rpcDecodeHexError(proof)
+	}
+	var mBlock wire.MsgMerkleBlock
+	err = mBlock.BtcDecode(bytes.NewReader(serializedProof),
+		wire.ProtocolVersion)
+	if err != nil {
+		return nil, nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCDeserialization,
+			Message: "Proof decode failed: " + err.Error(),
+		}
+	}
+
+	txHashes, err := bloom.VerifyMerkleBlock(&mBlock)
+	if err != nil {
+		return nil, nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCVerify,
+			Message: "Proof verification failed: " + err.Error(),
+		}
+	}
+	return &mBlock, txHashes, nil
+}
+
+// handleVerifyTxOutProof implements the verifytxoutproof command.
+func handleVerifyTxOutProof(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.VerifyTxOutProofCmd)
+
+	mBlock, txHashes, err := decodeTxOutProof(c.Proof)
+	if err != nil {
+		return nil, err
+	}
+
+	// The proof only attests to the inclusion of the transactions when the
+	// header it commits to is part of the main chain.
+	blockHash := mBlock.Header.BlockHash()
+	mainChain, err := s.chain.MainChainHasBlock(&blockHash)
+	if err != nil {
+		context := "Failed to check main chain for block"
+		return nil, internalRPCError(err.Error(), context)
+	}
+	if !mainChain {
+		return nil, &btcjson.RPCError{
+			Code: btcjson.ErrRPCBlockNotFound,
+			Message: fmt.Sprintf("Block %v is not in the main "+
+				"chain", blockHash),
+		}
+	}
+
+	txIDs := make([]string, 0, len(txHashes))
+	for _, txHash := range txHashes {
+		txIDs = append(txIDs, txHash.String())
+	}
+	return txIDs, nil
+}
+
+// activeCommand is a command which is being executed by the RPC server.
+type activeCommand struct {
+	method  string
+	started time.Time
+}
+
+// activeCommands tracks the commands which are being executed by the RPC
+// server so they can be reported by getrpcinfo.
+type activeCommands struct {
+	mtx      sync.Mutex
+	nextID   uint64
+	commands map[uint64]activeCommand
+}
+
+// newActiveCommands returns a new empty set of active commands.
+func newActiveCommands() *activeCommands {
+	return &activeCommands{commands: make(map[uint64]activeCommand)}
+}
+
+// add records that a command with the passed method started executing and
+// returns the id to remove it with once it finishes.
+//
+// This function is safe for concurrent access.
+func (a *activeCommands) add(method string) uint64 {
+	a.mtx.Lock()
+	id := a.nextID
+	a.nextID++
+	a.commands[id] = activeCommand{method: method, started: time.Now()}
+	a.mtx.Unlock()
+	return id
+}
+
+// remove records that the command with the passed id finished executing.
+//
+// This function is safe for concurrent access.
+func (a *activeCommands) remove(id uint64) {
+	a.mtx.Lock()
+	delete(a.commands, id)
+	a.mtx.Unlock()
+}
+
+// snapshot returns the active commands along with the number of microseconds
+// they have been executing for at the passed time, ordered from the oldest.
+//
+// This function is safe for concurrent access.
+func (a *activeCommands) snapshot(now time.Time) []btcjson.RPCCommandResult {
+	a.mtx.Lock()
+	ids := make([]uint64, 0, len(a.commands))
+	for id := range a.commands {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	results := make([]btcjson.RPCCommandResult, 0, len(ids))
+	for _, id := range ids {
+		command := a.commands[id]
+		results = append(results, btcjson.RPCCommandResult{
+			Method: command.method,
+			Duration: int64(now.Sub(command.started) /
+				time.Microsecond),
+		})
+	}
+	a.mtx.Unlock()
+	return results
+}
+
 // rpcServer holds the items the rpc server may need to access (config,
 // shutdown, main server, etc.)
 type rpcServer struct {
@@ -3425,8 +5046,7 @@ type rpcServer struct {
 	generator              *mining.BlkTmplGenerator
 	server                 *server
 	chain                  *blockchain.BlockChain
-	authsha                [sha256.Size]byte
-	limitauthsha           [sha256.Size]byte
+	users                  []*rpcUser
 	ntfnMgr                *wsNotificationManager
 	numClients             int32
 	statusLines            map[int]string
@@ -3435,6 +5055,7 @@ type rpcServer struct {
 	listeners              []net.Listener
 	gbtWorkState           *gbtWorkState
 	helpCacher             *helpCacher
+	activeCommands         *activeCommands
 	requestProcessShutdown chan struct{}
 	quit                   chan int
 }
@@ -3559,45 +5180,32 @@ func (s *rpcServer) decrementClients() {
 
 // checkAuth checks the HTTP Basic authentication supplied by a wallet
 // or RPC client in the HTTP request r.  If the supplied authentication
-// does not match the username and password expected, a non-nil error is
-// returned.
+// does not match any user, a non-nil error is returned.  The error is the same
+// whether or not the user name exists.
 //
 // This check is time-constant.
 //
-// The first bool return value signifies auth success (true if successful) and
-// the second bool return value specifies whether the user can change the state
-// of the server (true) or whether the user is limited (false). The second is
-// always false if the first is.
-func (s *rpcServer) checkAuth(r *http.Request, require bool) (bool, bool, error) {
+// The returned user is the user the request authenticated as, which determines
+// the commands it may execute.  It is nil when authentication is not required
+// and the request has none.
+func (s *rpcServer) checkAuth(r *http.Request, require bool) (*rpcUser, error) {
 	authhdr := r.Header["Authorization"]
 	if len(authhdr) <= 0 {
 		if require {
 			rpcsLog.Warnf("RPC authentication failure from %s",
 				r.RemoteAddr)
-			return false, false, errors.New("auth failure")
+			return nil, errors.New("auth failure")
 		}
 
-		return false, false, nil
-	}
-
-	authsha := sha256.Sum256([]byte(authhdr[0]))
-
-	// Check for limited auth first as in environments with limited users, those
-	// are probably expected to have a higher volume of calls
-	limitcmp := subtle.ConstantTimeCompare(authsha[:], s.limitauthsha[:])
-	if limitcmp == 1 {
-		return true, false, nil
+		return nil, nil
 	}
 
-	// Check for admin-level auth
-	cmp := subtle.ConstantTimeCompare(authsha[:], s.authsha[:])
-	if cmp == 1 {
-		return true, true, nil
+	user := s.authenticate(authhdr[0])
+	if user == nil {
+		rpcsLog.Warnf("RPC authentication failure from %s", r.RemoteAddr)
+		return nil, errors.New("auth failure")
 	}
-
-	// Request's auth doesn't match either user
-	rpcsLog.Warnf("RPC authentication failure from %s", r.RemoteAddr)
-	return false, false, errors.New("auth failure")
+	return user, nil
 }
 
 // parsedRPCCmd represents a JSON-RPC request object that has been parsed into
@@ -3632,9 +5240,24 @@ func (s *rpcServer) standardCmdResult(cmd *parsedRPCCmd, closeChan <-chan struct
 	return nil, btcjson.ErrRPCMethodNotFound
 handled:
 
+	id := s.activeCommands.add(cmd.method)
+	defer s.activeCommands.remove(id)
 	return handler(s, cmd.cmd, closeChan)
 }
 
+// isUnlimitedRequest returns whether the passed raw JSON-RPC request is for a
+// command which is exempt from the limit on the number of RPC clients.
+func isUnlimitedRequest(body []byte) bool {
+	var request struct {
+		Method string `json:"method"`
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		return false
+	}
+	_, ok := rpcUnlimited[request.Method]
+	return ok
+}
+
 // parseCmd parses a JSON-RPC request object into known concrete command.  The
 // err field of the returned parsedRPCCmd struct will contain an RPC error that
 // is suitable for use in replies if the command is invalid in some way such as
@@ -3682,22 +5305,12 @@ func createMarshalledReply(id, result interface{}, replyErr error) ([]byte, erro
 	return btcjson.MarshalResponse(id, result, jsonErr)
 }
 
-// jsonRPCRead handles reading and responding to RPC messages.
-func (s *rpcServer) jsonRPCRead(w http.ResponseWriter, r *http.Request, isAdmin bool) {
+// jsonRPCRead handles responding to the RPC message read from the request.
+func (s *rpcServer) jsonRPCRead(w http.ResponseWriter, r *http.Request, body []byte, user *rpcUser) {
 	if atomic.LoadInt32(&s.shutdown) != 0 {
 		return
 	}
 
-	// Read and close the JSON-RPC request body from the caller.
-	body, err := ioutil.ReadAll(r.Body)
-	r.Body.Close()
-	if err != nil {
-		errCode := http.StatusBadRequest
-		http.Error(w, fmt.Sprintf("%d error reading JSON message: %v",
-			errCode, err), errCode)
-		return
-	}
-
 	// Unfortunately, the http server doesn't provide the ability to
 	// change the read deadline for the new connection and having one breaks
 	// long polling.  However, not having a read deadline on the initial
@@ -3771,15 +5384,9 @@ func (s *rpcServer) jsonRPCRead(w http.ResponseWriter, r *http.Request, isAdmin
 			}
 		}()
 
-		// Check if the user is limited and set error if method unauthorized
-		if !isAdmin {
-			if _, ok := rpcLimited[request.Method]; !ok {
-				jsonErr = &btcjson.RPCError{
-					Code:    btcjson.ErrRPCInvalidParams.Code,
-					Message: "limited user not authorized for this method",
-				}
-			}
-		}
+		// Set an error if the user may not execute the method or
+		// exceeded its rate limit.
+		jsonErr = s.authorize(user, request.Method)
 
 		if jsonErr == nil {
 			// Attempt to parse the JSON-RPC request into a known concrete
@@ -3842,27 +5449,43 @@ func (s *rpcServer) Start() {
 		w.Header().Set("Content-Type", "application/json")
 		r.Close = true
 
-		// Limit the number of connections to max allowed.
-		if s.limitConnections(w, r.RemoteAddr) {
+		user, err := s.checkAuth(r, true)
+		if err != nil {
+			jsonAuthFail(w)
 			return
 		}
 
-		// Keep track of the number of connected clients.
-		s.incrementClients()
-		defer s.decrementClients()
-		_, isAdmin, err := s.checkAuth(r, true)
+		// Read and close the JSON-RPC request body from the caller.  The
+		// body is read before the connection limit is checked, so its
+		// size is limited.
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body,
+			rpcMaxRequestSize))
+		r.Body.Close()
 		if err != nil {
-			jsonAuthFail(w)
+			errCode := http.StatusBadRequest
+			http.Error(w, fmt.Sprintf("%d error reading JSON "+
+				"message: %v", errCode, err), errCode)
 			return
 		}
 
-		// Read and respond to the request.
-		s.jsonRPCRead(w, r, isAdmin)
+		// Limit the number of connections to max allowed and keep track
+		// of the number of connected clients.  The commands which are
+		// used to inspect the server are exempt.
+		if !isUnlimitedRequest(body) {
+			if s.limitConnections(w, r.RemoteAddr) {
+				return
+			}
+			s.incrementClients()
+			defer s.decrementClients()
+		}
+
+		// Respond to the request.
+		s.jsonRPCRead(w, r, body, user)
 	})
 
 	// Websocket endpoint.
 	rpcServeMux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
-		authenticated, isAdmin, err := s.checkAuth(r, false)
+		user, err := s.checkAuth(r, false)
 		if err != nil {
 			jsonAuthFail(w)
 			return
@@ -3879,7 +5502,7 @@ func (s *rpcServer) Start() {
 			http.Error(w, "400 Bad Request.", http.StatusBadRequest)
 			return
 		}
-		s.WebsocketHandler(ws, r.RemoteAddr, authenticated, isAdmin)
+		s.WebsocketHandler(ws, r.RemoteAddr, user)
 	})
 
 	for _, listener := range s.listeners {
@@ -3926,13 +5549,15 @@ func newRPCServer(listenAddrs []string, generator *mining.BlkTmplGenerator, s *s
 		generator:              generator,
 		chain:                  s.blockManager.chain,
 		statusLines:            make(map[int]string),
-		gbtWorkState:           newGbtWorkState(s.timeSource),
+		gbtWorkState:           newGbtWorkState(s.timeSource, generator.Policy()),
 		helpCacher:             newHelpCacher(),
+		activeCommands:         newActiveCommands(),
 		requestProcessShutdown: make(chan struct{}),
 		quit: make(chan int),
 	}
 
-	// (Admin RPC User) First check for hash, then for user/password
+	// (Admin RPC User) First check for hash, then for user/password.  The
+	// admin user may execute all commands.
 	if cfg.RPCHash != "" {
 		if len(cfg.RPCHash) != 64 {
 			return nil, errors.New("RPCS: Invalid RPCHash length")
@@ -3941,14 +5566,18 @@ func newRPCServer(listenAddrs []string, generator *mining.BlkTmplGenerator, s *s
 		if err != nil {
 			return nil, err
 		}
-		copy(rpc.authsha[:], authsha[0:32])
+		user := &rpcUser{name: cfg.RPCUser}
+		copy(user.authsha[:], authsha[0:32])
+		rpc.users = append(rpc.users, user)
 	} else if cfg.RPCUser != "" && cfg.RPCPass != "" {
-		login := cfg.RPCUser + ":" + cfg.RPCPass
-		auth := "Basic " + base64.StdEncoding.EncodeToString([]byte(login))
-		rpc.authsha = sha256.Sum256([]byte(auth))
+		rpc.users = append(rpc.users, &rpcUser{
+			name:    cfg.RPCUser,
+			authsha: rpcAuthSha(cfg.RPCUser, cfg.RPCPass),
+		})
 	}
 
-	// (Limited RPC User) First check for hash, then for user/password
+	// (Limited RPC User) First check for hash, then for user/password.  The
+	// limited user may only execute the commands in rpcLimited.
 	if cfg.RPCLimitHash != "" {
 		if len(cfg.RPCLimitHash) != 64 {
 			return nil, errors.New("RPCS: Invalid RPCLimitHash length")
@@ -3957,13 +5586,21 @@ func newRPCServer(listenAddrs []string, generator *mining.BlkTmplGenerator, s *s
 		if err != nil {
 			return nil, err
 		}
-		copy(rpc.limitauthsha[:], limitauthsha[0:32])
+		user := &rpcUser{name: cfg.RPCLimitUser, commands: rpcLimited}
+		copy(user.authsha[:], limitauthsha[0:32])
+		rpc.users = append(rpc.users, user)
 	} else if cfg.RPCLimitUser != "" && cfg.RPCLimitPass != "" {
-		login := cfg.RPCLimitUser + ":" + cfg.RPCLimitPass
-		auth := "Basic " + base64.StdEncoding.EncodeToString([]byte(login))
-		rpc.limitauthsha = sha256.Sum256([]byte(auth))
+		rpc.users = append(rpc.users, &rpcUser{
+			name:     cfg.RPCLimitUser,
+			authsha:  rpcAuthSha(cfg.RPCLimitUser, cfg.RPCLimitPass),
+			commands: rpcLimited,
+		})
 	}
-	rpc.ntfnMgr = newWsNotificationManager(&rpc)
+
+	// Users added with --rpcauth may execute the commands they were
+	// granted.
+	rpc.users = append(rpc.users, cfg.rpcUsers...)
+	rpc.ntfnMgr = newWsNotificationManager(&rpc, s.notifier)
 
 	// Setup TLS if not disabled.
 	listenFunc := net.Listen
@@ -0,0 +1,1149 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/btcjson"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/mempool"
+	"github.com/bitgo/prova/mining"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/txscript"
+	"github.com/bitgo/prova/wire"
+)
+
+// TestHandleValidateAddress ensures the validateaddress handler describes
+// Aztec addresses of the active network and rejects addresses of other
+// networks as well as malformed addresses.
+func TestHandleValidateAddress(t *testing.T) {
+	pkHash := bytes.Repeat([]byte{0x01}, 20)
+	keyIDs := []btcec.KeyID{1, 2}
+	mainAddr, err := provautil.NewAddressProva(pkHash, keyIDs,
+		&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("NewAddressProva: unexpected error: %v", err)
+	}
+	simAddr, err := provautil.NewAddressProva(pkHash, keyIDs,
+		&chaincfg.SimNetParams)
+	if err != nil {
+		t.Fatalf("NewAddressProva: unexpected error: %v", err)
+	}
+	pkScript, err := txscript.PayToAddrScript(mainAddr)
+	if err != nil {
+		t.Fatalf("PayToAddrScript: unexpected error: %v", err)
+	}
+
+	// Corrupt the checksum by replacing the last character of the encoded
+	// address.
+	encoded := mainAddr.EncodeAddress()
+	lastChar := "1"
+	if encoded[len(encoded)-1] == '1' {
+		lastChar = "2"
+	}
+	badChecksum := encoded[:len(encoded)-1] + lastChar
+
+	tests := []struct {
+		name    string
+		address string
+		want    btcjson.ValidateAddressChainResult
+	}{
+		{
+			name:    "active network",
+			address: mainAddr.EncodeAddress(),
+			want: btcjson.ValidateAddressChainResult{
+				IsValid:      true,
+				Address:      mainAddr.EncodeAddress(),
+				Type:         "aztec",
+				KeyIDs:       []uint32{1, 2},
+				ScriptPubKey: hex.EncodeToString(pkScript),
+			},
+		},
+		{
+			name:    "other network",
+			address: simAddr.EncodeAddress(),
+			want: btcjson.ValidateAddressChainResult{
+				IsValid:       false,
+				Address:       simAddr.EncodeAddress(),
+				Type:          "aztec",
+				KeyIDs:        []uint32{1, 2},
+				ScriptPubKey:  hex.EncodeToString(pkScript),
+				IsForOtherNet: true,
+			},
+		},
+		{
+			name:    "bad checksum",
+			address: badChecksum,
+			want:    btcjson.ValidateAddressChainResult{},
+		},
+		{
+			name:    "not base58",
+			address: "0OIl",
+			want:    btcjson.ValidateAddressChainResult{},
+		},
+	}
+
+	for _, test := range tests {
+		cmd := btcjson.NewValidateAddressCmd(test.address)
+		result, err := handleValidateAddress(nil, cmd, nil)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(result, test.want) {
+			t.Errorf("%s: mismatched result - got %+v, want %+v",
+				test.name, result, test.want)
+		}
+	}
+}
+
+// TestValidatorInfo ensures the getvalidatorinfo summary counts the blocks
+// signed by each active validate key within the averaging window and the
+// trailing span and applies the share limit to the next block.
+func TestValidatorInfo(t *testing.T) {
+	var validateKeys btcec.PublicKeySet
+	blockKeys := make([]wire.BlockValidatingPubKey, 4)
+	for i := range blockKeys {
+		privKey, _ := btcec.PrivKeyFromBytes(btcec.S256(),
+			[]byte{byte(i + 1)})
+		validateKeys = validateKeys.Add(privKey.PubKey())
+		copy(blockKeys[i][:], privKey.PubKey().SerializeCompressed())
+	}
+	a, b, c := blockKeys[0], blockKeys[1], blockKeys[2]
+
+	// The keys which signed the blocks at heights 10 down to 5.
+	recentKeys := []wire.BlockValidatingPubKey{a, b, a, c, a, b}
+	want := []btcjson.ValidatorInfoResult{
+		{
+			PubKey:         a.String(),
+			WindowBlocks:   3,
+			TrailingBlocks: 2,
+			CanSign:        false,
+			RecentHeights:  []uint32{10, 8, 6},
+		},
+		{
+			PubKey:         b.String(),
+			WindowBlocks:   2,
+			TrailingBlocks: 1,
+			CanSign:        true,
+			RecentHeights:  []uint32{9, 5},
+		},
+		{
+			PubKey:         c.String(),
+			WindowBlocks:   1,
+			TrailingBlocks: 0,
+			CanSign:        true,
+			RecentHeights:  []uint32{7},
+		},
+		{
+			PubKey:        blockKeys[3].String(),
+			CanSign:       true,
+			RecentHeights: []uint32{},
+		},
+	}
+
+	got := validatorInfo(validateKeys, recentKeys, 10, 3)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("mismatched result - got %+v, want %+v", got, want)
+	}
+
+	// Every key may sign when the share limit is disabled.
+	for _, info := range validatorInfo(validateKeys, recentKeys, 10, 0) {
+		if !info.CanSign {
+			t.Fatalf("key %s may not sign without a share limit",
+				info.PubKey)
+		}
+	}
+}
+
+// replayFeeEstimatorHistory registers blocks at heights 1 through numBlocks
+// with the passed fee estimator.  At every height three transactions paying
+// 10000, 5000 and 1000 atoms/kB are observed, which are confirmed 1, 3 and 10
+// blocks later respectively.
+func replayFeeEstimatorHistory(ef *mempool.FeeEstimator, numBlocks uint32) {
+	confirmDelays := map[uint32]int64{1: 10000, 3: 5000, 10: 1000}
+	pending := make(map[uint32][]*wire.MsgTx)
+	var lockTime uint32
+	for height := uint32(1); height <= numBlocks; height++ {
+		block := provautil.NewBlock(&wire.MsgBlock{
+			Transactions: pending[height],
+		})
+		block.SetHeight(height)
+		ef.RegisterBlock(block)
+
+		for delay, feePerKB := range confirmDelays {
+			lockTime++
+			msgTx := wire.NewMsgTx(wire.TxVersion)
+			msgTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{}, nil))
+			msgTx.LockTime = lockTime
+			ef.ObserveTransaction(&mempool.TxDesc{
+				TxDesc: mining.TxDesc{
+					Tx:       provautil.NewTx(msgTx),
+					Height:   height,
+					FeePerKB: feePerKB,
+				},
+			})
+			pending[height+delay] = append(pending[height+delay],
+				msgTx)
+		}
+	}
+}
+
+// TestEstimateSmartFee ensures the estimatesmartfee result reports the
+// estimates for multiple targets and modes of a replayed history along with
+// the minimum fee rate of the memory pool, and an error object when there is
+// not enough data.
+func TestEstimateSmartFee(t *testing.T) {
+	const minFeeRate = 2000
+	ef := mempool.NewFeeEstimator(mempool.DefaultEstimateFeeMaxRollback,
+		mempool.DefaultEstimateFeeMinRegisteredBlocks)
+
+	// Without any registered blocks only the errors are reported.
+	result, err := estimateSmartFee(ef, 2, "CONSERVATIVE", minFeeRate)
+	if err != nil {
+		t.Fatalf("estimateSmartFee: unexpected error: %v", err)
+	}
+	if result.FeeRate != nil || len(result.Errors) == 0 ||
+		result.MempoolMinFee != 0.002 {
+		t.Fatalf("estimateSmartFee: unexpected result without data "+
+			"%+v", result)
+	}
+
+	replayFeeEstimatorHistory(ef, 30)
+	tests := []struct {
+		confTarget int64
+		mode       string
+		feeRate    float64
+	}{
+		{confTarget: 1, mode: "CONSERVATIVE", feeRate: 0.01},
+		{confTarget: 3, mode: "CONSERVATIVE", feeRate: 0.005},
+		{confTarget: 3, mode: "economical", feeRate: 0.001},
+		{confTarget: 12, mode: "ECONOMICAL", feeRate: 0.001},
+	}
+	for _, test := range tests {
+		result, err := estimateSmartFee(ef, test.confTarget, test.mode,
+			minFeeRate)
+		if err != nil {
+			t.Errorf("estimateSmartFee(%d, %s): unexpected error: %v",
+				test.confTarget, test.mode, err)
+			continue
+		}
+		want := &btcjson.EstimateSmartFeeResult{
+			FeeRate:       &test.feeRate,
+			MempoolMinFee: 0.002,
+			Blocks:        29,
+		}
+		if !reflect.DeepEqual(result, want) {
+			t.Errorf("estimateSmartFee(%d, %s): mismatched result - "+
+				"got %+v, want %+v", test.confTarget, test.mode,
+				result, want)
+		}
+	}
+
+	// Invalid targets and modes are rejected.
+	invalid := []struct {
+		confTarget int64
+		mode       string
+	}{
+		{confTarget: 0, mode: "CONSERVATIVE"},
+		{confTarget: mempool.MaxEstimateFeeTarget + 1, mode: "CONSERVATIVE"},
+		{confTarget: 2, mode: "UNSET"},
+	}
+	for _, test := range invalid {
+		_, err := estimateSmartFee(ef, test.confTarget, test.mode,
+			minFeeRate)
+		rpcErr, ok := err.(*btcjson.RPCError)
+		if !ok || rpcErr.Code != btcjson.ErrRPCInvalidParameter {
+			t.Errorf("estimateSmartFee(%d, %s): unexpected error %v",
+				test.confTarget, test.mode, err)
+		}
+	}
+}
+
+// Golden verbose results of the simnet genesis block at height 0 of a main
+// chain with a best height of 2.  The field names must stay stable since block
+// explorers depend on them.
+const (
+	genesisHeaderVerboseJSON = `{
+	"hash": "1384af5112c728f0ab56c027930e3a8ebc03aed360a5167e09d3ad8f89c571d0",
+	"confirmations": 3,
+	"height": 0,
+	"version": 4,
+	"merkleroot": "fe7d12ffe9b26cd2f720a5d2c6240a0ed37d865d79fc47771df47fb06ed5866d",
+	"time": 1502385451,
+	"mediantime": 1502385451,
+	"nonce": 2,
+	"bits": "207fffff",
+	"difficulty": 1,
+	"chainwork": "0000000000000000000000000000000000000000000000000000000000020002",
+	"previousblockhash": "0000000000000000000000000000000000000000000000000000000000000000",
+	"nextblockhash": "0000000000000000000000000000000000000000000000000000000000000001",
+	"validatingpubkey": "000000000000000000000000000000000000000000000000000000000000000000",
+	"sigkeyid": "29cfc6376255a78451eeb4b129ed8eacffa2feef",
+	"signature": "0000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000"
+}`
+
+	genesisBlockVerboseJSON = `{
+	"hash": "1384af5112c728f0ab56c027930e3a8ebc03aed360a5167e09d3ad8f89c571d0",
+	"confirmations": 3,
+	"size": 326,
+	"height": 0,
+	"version": 4,
+	"merkleroot": "fe7d12ffe9b26cd2f720a5d2c6240a0ed37d865d79fc47771df47fb06ed5866d",
+	"tx": [
+		"0f9116ac9980fc6bdcf7875457c203e86ef17ac5f593ca7fecc6c462fa52e7a5"
+	],
+	"time": 1502385451,
+	"mediantime": 1502385451,
+	"nonce": 2,
+	"bits": "207fffff",
+	"difficulty": 1,
+	"chainwork": "0000000000000000000000000000000000000000000000000000000000020002",
+	"previousblockhash": "0000000000000000000000000000000000000000000000000000000000000000",
+	"nextblockhash": "0000000000000000000000000000000000000000000000000000000000000001",
+	"validatingpubkey": "000000000000000000000000000000000000000000000000000000000000000000",
+	"sigkeyid": "29cfc6376255a78451eeb4b129ed8eacffa2feef",
+	"signature": "0000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000"
+}`
+
+	genesisBlockVerboseTxJSON = `{
+	"hash": "1384af5112c728f0ab56c027930e3a8ebc03aed360a5167e09d3ad8f89c571d0",
+	"confirmations": 3,
+	"size": 326,
+	"height": 0,
+	"version": 4,
+	"merkleroot": "fe7d12ffe9b26cd2f720a5d2c6240a0ed37d865d79fc47771df47fb06ed5866d",
+	"tx": [
+		{
+			"hex": "01000000010000000000000000000000000000000000000000000000000000000000000000ffffffff200e3d72142983b10f99f97b965695d390852b685597a1f5292aae4f1d45d156d3ffffffff0300000000000000000200bb00000000000000000251bb00000000000000000252bb00000000",
+			"txid": "0f9116ac9980fc6bdcf7875457c203e86ef17ac5f593ca7fecc6c462fa52e7a5",
+			"version": 1,
+			"locktime": 0,
+			"vin": [
+				{
+					"coinbase": "0e3d72142983b10f99f97b965695d390852b685597a1f5292aae4f1d45d156d3",
+					"sequence": 4294967295
+				}
+			],
+			"vout": [
+				{
+					"value": 0,
+					"n": 0,
+					"scriptPubKey": {
+						"asm": "0 OP_CHECKTHREAD",
+						"hex": "00bb",
+						"reqSigs": 2,
+						"type": "admin",
+						"thread": "root"
+					}
+				},
+				{
+					"value": 0,
+					"n": 1,
+					"scriptPubKey": {
+						"asm": "1 OP_CHECKTHREAD",
+						"hex": "51bb",
+						"reqSigs": 2,
+						"type": "admin",
+						"thread": "provision"
+					}
+				},
+				{
+					"value": 0,
+					"n": 2,
+					"scriptPubKey": {
+						"asm": "2 OP_CHECKTHREAD",
+						"hex": "52bb",
+						"reqSigs": 2,
+						"type": "admin",
+						"thread": "issue"
+					}
+				}
+			],
+			"blockhash": "1384af5112c728f0ab56c027930e3a8ebc03aed360a5167e09d3ad8f89c571d0",
+			"confirmations": 3,
+			"time": 1502385451,
+			"blocktime": 1502385451
+		}
+	],
+	"time": 1502385451,
+	"mediantime": 1502385451,
+	"nonce": 2,
+	"bits": "207fffff",
+	"difficulty": 1,
+	"chainwork": "0000000000000000000000000000000000000000000000000000000000020002",
+	"previousblockhash": "0000000000000000000000000000000000000000000000000000000000000000",
+	"nextblockhash": "0000000000000000000000000000000000000000000000000000000000000001",
+	"validatingpubkey": "000000000000000000000000000000000000000000000000000000000000000000",
+	"sigkeyid": "29cfc6376255a78451eeb4b129ed8eacffa2feef",
+	"signature": "0000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000"
+}`
+)
+
+// TestBlockVerboseResults ensures the verbose getblockheader and getblock
+// results of a fixed simnet block match their golden JSON encodings and that
+// blocks which are not part of the main chain are reported as such.
+func TestBlockVerboseResults(t *testing.T) {
+	params := &chaincfg.SimNetParams
+	blk := provautil.NewBlock(params.GenesisBlock)
+	header := &blk.MsgBlock().Header
+	nextHash := chainhash.Hash{0x01}
+	ctx := &blockChainContext{
+		mainChain:  true,
+		bestHeight: 2,
+		medianTime: header.Timestamp,
+		chainWork:  big.NewInt(0x20002),
+		nextHash:   &nextHash,
+	}
+
+	blockResult := func(verbosity btcjson.GetBlockVerbosity) interface{} {
+		result, err := blockVerboseResult(blk, params, ctx, verbosity,
+			false)
+		if err != nil {
+			t.Fatalf("blockVerboseResult(%d): unexpected error: %v",
+				verbosity, err)
+		}
+		return result
+	}
+	tests := []struct {
+		name   string
+		result interface{}
+		want   string
+	}{
+		{
+			name:   "getblockheader",
+			result: blockHeaderVerboseResult(header, params, ctx),
+			want:   genesisHeaderVerboseJSON,
+		},
+		{
+			name:   "getblock verbosity 1",
+			result: blockResult(btcjson.GetBlockVerbosityTxIDs),
+			want:   genesisBlockVerboseJSON,
+		},
+		{
+			name:   "getblock verbosity 2",
+			result: blockResult(btcjson.GetBlockVerbosityTxs),
+			want:   genesisBlockVerboseTxJSON,
+		},
+	}
+	for _, test := range tests {
+		got, err := json.MarshalIndent(test.result, "", "\t")
+		if err != nil {
+			t.Errorf("%s: unexpected marshal error: %v", test.name, err)
+			continue
+		}
+		if string(got) != test.want {
+			t.Errorf("%s: mismatched result - got %s, want %s",
+				test.name, got, test.want)
+		}
+	}
+
+	// Blocks of side chains have no confirmations and no next block, and
+	// neither do their transactions.
+	ctx = &blockChainContext{
+		bestHeight: 2,
+		medianTime: header.Timestamp,
+		chainWork:  big.NewInt(0x20002),
+	}
+	result := blockResult(btcjson.GetBlockVerbosityTxs)
+	txResult := result.(*btcjson.GetBlockVerboseTxResult)
+	if txResult.Confirmations != -1 || txResult.NextHash != "" ||
+		txResult.Tx[0].Confirmations != 0 {
+
+		t.Errorf("side chain: unexpected result %+v", txResult)
+	}
+}
+
+// decodeTestScripts returns one script of each script class, keyed by the
+// class name.
+func decodeTestScripts(t *testing.T) map[string][]byte {
+	pkHash := bytes.Repeat([]byte{0x11}, chainhash.Hash160Size)
+	addr, err := provautil.NewAddressProva(pkHash, []btcec.KeyID{1, 2},
+		&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatalf("NewAddressProva: unexpected error: %v", err)
+	}
+	provaScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		t.Fatalf("PayToAddrScript: unexpected error: %v", err)
+	}
+	threadScript, err := txscript.ProvaThreadScript(provautil.ProvisionThread)
+	if err != nil {
+		t.Fatalf("ProvaThreadScript: unexpected error: %v", err)
+	}
+	privKey, _ := btcec.PrivKeyFromBytes(btcec.S256(),
+		bytes.Repeat([]byte{0x22}, 32))
+	adminOp := append([]byte{txscript.AdminOpValidateKeyAdd},
+		privKey.PubKey().SerializeCompressed()...)
+
+	scripts := make(map[string][]byte)
+	build := func(name string, builder *txscript.ScriptBuilder) {
+		script, err := builder.Script()
+		if err != nil {
+			t.Fatalf("%s: unexpected script error: %v", name, err)
+		}
+		scripts[name] = script
+	}
+	scripts["safe_multisig"] = provaScript
+	build("general_safe_multisig", txscript.NewScriptBuilder().
+		AddOp(txscript.OP_2).AddData(pkHash).AddInt64(1).AddInt64(2).
+		AddInt64(3).AddOp(txscript.OP_4).
+		AddOp(txscript.OP_CHECKSAFEMULTISIG))
+	build("timelock_safe_multisig", txscript.NewScriptBuilder().
+		AddInt64(500000).AddOp(txscript.OP_CHECKLOCKTIMEVERIFY).
+		AddOp(txscript.OP_DROP).AddOps(provaScript))
+	scripts["admin"] = threadScript
+	build("admin_op", txscript.NewScriptBuilder().
+		AddOp(txscript.OP_RETURN).AddData(adminOp))
+	build("nulldata", txscript.NewScriptBuilder().
+		AddOp(txscript.OP_RETURN).AddData([]byte("prova")))
+	build("nonstandard", txscript.NewScriptBuilder().
+		AddOp(txscript.OP_TRUE))
+	return scripts
+}
+
+// Golden decodescript results of the scripts returned by decodeTestScripts.
+var decodeScriptJSON = map[string]string{
+	"safe_multisig": `{
+	"asm": "2 1111111111111111111111111111111111111111 1 2 3 OP_CHECKSAFEMULTISIG",
+	"reqSigs": 2,
+	"type": "safe_multisig",
+	"keyIDs": [
+		1,
+		2
+	],
+	"addresses": [
+		"TAMVe7Y4xvDwUZoAPQXAhyJhs9ACrhowtqwmBD13Rg1mE"
+	]
+}`,
+	"general_safe_multisig": `{
+	"asm": "2 1111111111111111111111111111111111111111 1 2 3 4 OP_CHECKSAFEMULTISIG",
+	"reqSigs": 2,
+	"type": "safe_multisig",
+	"keyIDs": [
+		1,
+		2,
+		3
+	]
+}`,
+	"timelock_safe_multisig": `{
+	"asm": "20a107 OP_CHECKLOCKTIMEVERIFY OP_DROP 2 1111111111111111111111111111111111111111 1 2 3 OP_CHECKSAFEMULTISIG",
+	"reqSigs": 2,
+	"type": "timelock_safe_multisig",
+	"keyIDs": [
+		1,
+		2
+	],
+	"addresses": [
+		"TAMVe7Y4xvDwUZoAPQXAhyJhs9ACrhowtqwmBD13Rg1mE"
+	]
+}`,
+	"admin": `{
+	"asm": "1 OP_CHECKTHREAD",
+	"reqSigs": 2,
+	"type": "admin",
+	"thread": "provision"
+}`,
+	"admin_op": `{
+	"asm": "OP_RETURN 1102466d7fcae563e5cb09a0d1870bb580344804617879a14949cf22285f1bae3f27",
+	"type": "admin_op",
+	"adminOp": "ADD_KEY VALIDATE 02466d7fcae563e5cb09a0d1870bb580344804617879a14949cf22285f1bae3f27"
+}`,
+	"nulldata": `{
+	"asm": "OP_RETURN 70726f7661",
+	"type": "nulldata"
+}`,
+	"nonstandard": `{
+	"asm": "1",
+	"type": "nonstandard"
+}`,
+}
+
+// Golden decoderawtransaction results of a payment transaction and of a
+// provision thread admin transaction.
+const (
+	paymentTxDecodeJSON = `{
+	"txid": "33f990fdaf6c579f83d1cd9219769d239eccd6ce05e78e4ab1c7f25034ccfbc5",
+	"version": 1,
+	"locktime": 0,
+	"vin": [
+		{
+			"txid": "0000000000000000000000000000000000000000000000000000000000000033",
+			"vout": 1,
+			"scriptSig": {
+				"asm": "1",
+				"hex": "51"
+			},
+			"sequence": 4294967295
+		}
+	],
+	"vout": [
+		{
+			"value": 0,
+			"n": 0,
+			"scriptPubKey": {
+				"asm": "2 1111111111111111111111111111111111111111 1 2 3 OP_CHECKSAFEMULTISIG",
+				"hex": "52141111111111111111111111111111111111111111515253ba",
+				"reqSigs": 2,
+				"type": "safe_multisig",
+				"keyIDs": [
+					1,
+					2
+				],
+				"addresses": [
+					"TAMVe7Y4xvDwUZoAPQXAhyJhs9ACrhowtqwmBD13Rg1mE"
+				]
+			}
+		},
+		{
+			"value": 1,
+			"n": 1,
+			"scriptPubKey": {
+				"asm": "2 1111111111111111111111111111111111111111 1 2 3 4 OP_CHECKSAFEMULTISIG",
+				"hex": "5214111111111111111111111111111111111111111151525354ba",
+				"reqSigs": 2,
+				"type": "safe_multisig",
+				"keyIDs": [
+					1,
+					2,
+					3
+				]
+			}
+		},
+		{
+			"value": 2,
+			"n": 2,
+			"scriptPubKey": {
+				"asm": "20a107 OP_CHECKLOCKTIMEVERIFY OP_DROP 2 1111111111111111111111111111111111111111 1 2 3 OP_CHECKSAFEMULTISIG",
+				"hex": "0320a107b17552141111111111111111111111111111111111111111515253ba",
+				"reqSigs": 2,
+				"type": "timelock_safe_multisig",
+				"keyIDs": [
+					1,
+					2
+				],
+				"addresses": [
+					"TAMVe7Y4xvDwUZoAPQXAhyJhs9ACrhowtqwmBD13Rg1mE"
+				]
+			}
+		},
+		{
+			"value": 3,
+			"n": 3,
+			"scriptPubKey": {
+				"asm": "OP_RETURN 70726f7661",
+				"hex": "6a0570726f7661",
+				"type": "nulldata"
+			}
+		},
+		{
+			"value": 4,
+			"n": 4,
+			"scriptPubKey": {
+				"asm": "1",
+				"hex": "51",
+				"type": "nonstandard"
+			}
+		}
+	]
+}`
+
+	adminTxDecodeJSON = `{
+	"txid": "c8a6cab830d61c3fbdf96aa483cea44a5220045e42280cdbb5154d244567f70c",
+	"version": 1,
+	"locktime": 0,
+	"vin": [
+		{
+			"txid": "0000000000000000000000000000000000000000000000000000000000000033",
+			"vout": 1,
+			"scriptSig": {
+				"asm": "1",
+				"hex": "51"
+			},
+			"sequence": 4294967295
+		}
+	],
+	"vout": [
+		{
+			"value": 0,
+			"n": 0,
+			"scriptPubKey": {
+				"asm": "1 OP_CHECKTHREAD",
+				"hex": "51bb",
+				"reqSigs": 2,
+				"type": "admin",
+				"thread": "provision"
+			}
+		},
+		{
+			"value": 1,
+			"n": 1,
+			"scriptPubKey": {
+				"asm": "OP_RETURN 1102466d7fcae563e5cb09a0d1870bb580344804617879a14949cf22285f1bae3f27",
+				"hex": "6a221102466d7fcae563e5cb09a0d1870bb580344804617879a14949cf22285f1bae3f27",
+				"type": "admin_op",
+				"adminOp": "ADD_KEY VALIDATE 02466d7fcae563e5cb09a0d1870bb580344804617879a14949cf22285f1bae3f27"
+			}
+		}
+	]
+}`
+)
+
+// TestDecodeScript ensures decodescript describes the scripts of every script
+// class along with their key ids, thread and admin operation, and that their
+// golden JSON encodings stay stable.
+func TestDecodeScript(t *testing.T) {
+	s := &rpcServer{server: &server{
+		chainParams: &chaincfg.RegressionNetParams,
+	}}
+	for name, script := range decodeTestScripts(t) {
+		want, ok := decodeScriptJSON[name]
+		if !ok {
+			t.Errorf("%s: no golden result", name)
+			continue
+		}
+		cmd := btcjson.NewDecodeScriptCmd(hex.EncodeToString(script))
+		result, err := handleDecodeScript(s, cmd, nil)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+			continue
+		}
+		got, err := json.MarshalIndent(result, "", "\t")
+		if err != nil {
+			t.Errorf("%s: unexpected marshal error: %v", name, err)
+			continue
+		}
+		if string(got) != want {
+			t.Errorf("%s: mismatched result - got %s, want %s", name,
+				got, want)
+		}
+	}
+
+	cmd := btcjson.NewDecodeScriptCmd("zz")
+	_, err := handleDecodeScript(s, cmd, nil)
+	rpcErr, ok := err.(*btcjson.RPCError)
+	if !ok || rpcErr.Code != btcjson.ErrRPCDecodeHexString {
+		t.Errorf("invalid hex: unexpected error %v", err)
+	}
+}
+
+// TestDecodeRawTransaction ensures decoderawtransaction describes the outputs
+// of a payment transaction paying to every spendable script class and of an
+// admin transaction, and that their golden JSON encodings stay stable.
+func TestDecodeRawTransaction(t *testing.T) {
+	s := &rpcServer{server: &server{
+		chainParams: &chaincfg.RegressionNetParams,
+	}}
+	scripts := decodeTestScripts(t)
+	prevOut := wire.NewOutPoint(&chainhash.Hash{0x33}, 1)
+	newTx := func(names ...string) *wire.MsgTx {
+		mtx := wire.NewMsgTx(wire.TxVersion)
+		mtx.AddTxIn(wire.NewTxIn(prevOut, []byte{txscript.OP_TRUE}))
+		for i, name := range names {
+			mtx.AddTxOut(wire.NewTxOut(int64(i)*1e6, scripts[name]))
+		}
+		return mtx
+	}
+
+	tests := []struct {
+		name string
+		tx   *wire.MsgTx
+		want string
+	}{
+		{
+			name: "payment",
+			tx: newTx("safe_multisig", "general_safe_multisig",
+				"timelock_safe_multisig", "nulldata",
+				"nonstandard"),
+			want: paymentTxDecodeJSON,
+		},
+		{
+			name: "admin",
+			tx:   newTx("admin", "admin_op"),
+			want: adminTxDecodeJSON,
+		},
+	}
+	for _, test := range tests {
+		txHex, err := messageToHex(test.tx)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+		cmd := btcjson.NewDecodeRawTransactionCmd(txHex)
+		result, err := handleDecodeRawTransaction(s, cmd, nil)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		got, err := json.MarshalIndent(result, "", "\t")
+		if err != nil {
+			t.Errorf("%s: unexpected marshal error: %v", test.name, err)
+			continue
+		}
+		if string(got) != test.want {
+			t.Errorf("%s: mismatched result - got %s, want %s",
+				test.name, got, test.want)
+		}
+	}
+}
+
+// TestTxOutProof ensures the proofs created for transactions in a block verify
+// and yield the proven transactions, and that proofs for transactions which are
+// not in the block, as well as malformed and tampered proofs, are rejected.
+func TestTxOutProof(t *testing.T) {
+	msgBlock := wire.MsgBlock{}
+	for i := 0; i < 5; i++ {
+		tx := wire.NewMsgTx(1)
+		prevOut := wire.NewOutPoint(&chainhash.Hash{byte(i), 0x01}, 0)
+		tx.AddTxIn(wire.NewTxIn(prevOut, []byte{0x01, byte(i)}))
+		tx.AddTxOut(wire.NewTxOut(int64(i), nil))
+		msgBlock.AddTransaction(tx)
+	}
+	merkles := blockchain.BuildMerkleTreeStore(
+		provautil.NewBlock(&msgBlock).Transactions())
+	msgBlock.Header.MerkleRoot = *merkles[len(merkles)-1]
+	block := provautil.NewBlock(&msgBlock)
+	txns := block.Transactions()
+
+	// rpcErrorCode returns the code of the passed RPC error.
+	rpcErrorCode := func(err error) btcjson.RPCErrorCode {
+		if rpcErr, ok := err.(*btcjson.RPCError); ok {
+			return rpcErr.Code
+		}
+		return 0
+	}
+
+	subsets := [][]int{{0}, {4}, {1, 3}, {0, 1, 2, 3, 4}}
+	for _, subset := range subsets {
+		var txHashes []*chainhash.Hash
+		for _, i := range subset {
+			txHashes = append(txHashes, txns[i].Hash())
+		}
+		proof, err := txOutProof(block, txHashes)
+		if err != nil {
+			t.Fatalf("subset %v: unexpected error: %v", subset, err)
+		}
+		mBlock, got, err := decodeTxOutProof(proof)
+		if err != nil {
+			t.Fatalf("subset %v: unexpected error: %v", subset, err)
+		}
+		if mBlock.Header.BlockHash() != *block.Hash() {
+			t.Fatalf("subset %v: proof is for block %v, want %v",
+				subset, mBlock.Header.BlockHash(), block.Hash())
+		}
+		if !reflect.DeepEqual(got, txHashes) {
+			t.Fatalf("subset %v: got hashes %v, want %v", subset,
+				got, txHashes)
+		}
+	}
+
+	// Transactions which are not in the block can't be proven.
+	_, err := txOutProof(block, []*chainhash.Hash{txns[0].Hash(),
+		{0x01}})
+	if rpcErrorCode(err) != btcjson.ErrRPCInvalidAddressOrKey {
+		t.Fatalf("missing transaction: unexpected error: %v", err)
+	}
+
+	proof, err := txOutProof(block, []*chainhash.Hash{txns[2].Hash()})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tamperedProof := func(modify func(mBlock *wire.MsgMerkleBlock)) string {
+		mBlock, _, err := decodeTxOutProof(proof)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		modify(mBlock)
+		var buf bytes.Buffer
+		if err := mBlock.BtcEncode(&buf, wire.ProtocolVersion); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return hex.EncodeToString(buf.Bytes())
+	}
+	tests := []struct {
+		name  string
+		proof string
+		code  btcjson.RPCErrorCode
+	}{
+		{
+			name:  "not hex",
+			proof: "zz",
+			code:  btcjson.ErrRPCDecodeHexString,
+		},
+		{
+			name:  "truncated",
+			proof: proof[:len(proof)-2],
+			code:  btcjson.ErrRPCDeserialization,
+		},
+		{
+			name: "tampered hash",
+			proof: tamperedProof(func(mBlock *wire.MsgMerkleBlock) {
+				mBlock.Hashes[0][0] ^= 0x01
+			}),
+			code: btcjson.ErrRPCVerify,
+		},
+		{
+			name: "tampered header merkle root",
+			proof: tamperedProof(func(mBlock *wire.MsgMerkleBlock) {
+				mBlock.Header.MerkleRoot[0] ^= 0x01
+			}),
+			code: btcjson.ErrRPCVerify,
+		},
+		{
+			name: "tampered flags",
+			proof: tamperedProof(func(mBlock *wire.MsgMerkleBlock) {
+				mBlock.Flags[0] ^= 0x02
+			}),
+			code: btcjson.ErrRPCVerify,
+		},
+	}
+	for _, test := range tests {
+		_, _, err := decodeTxOutProof(test.proof)
+		if rpcErrorCode(err) != test.code {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		}
+	}
+}
+
+// TestGbtTargetAndTemplateID ensures the getblocktemplate target and long poll
+// id use the big-endian representation of the target and previous block hash.
+func TestGbtTargetAndTemplateID(t *testing.T) {
+	tests := []struct {
+		bits uint32
+		want string
+	}{
+		{0x1d00ffff, "00000000ffff0000000000000000000000000000000000000000000000000000"},
+		{0x1b0404cb, "00000000000404cb000000000000000000000000000000000000000000000000"},
+		{0x207fffff, "7fffff0000000000000000000000000000000000000000000000000000000000"},
+	}
+	for _, test := range tests {
+		if got := gbtTarget(test.bits); got != test.want {
+			t.Errorf("gbtTarget(%08x): got %v, want %v", test.bits,
+				got, test.want)
+		}
+	}
+
+	prevHash := chaincfg.MainNetParams.GenesisHash
+	templateID := encodeTemplateID(prevHash, 7)
+	if want := prevHash.StringBE() + "-7"; templateID != want {
+		t.Fatalf("encodeTemplateID: got %v, want %v", templateID, want)
+	}
+	gotHash, generation, err := decodeTemplateID(templateID)
+	if err != nil {
+		t.Fatalf("decodeTemplateID: unexpected error: %v", err)
+	}
+	if *gotHash != *prevHash || generation != 7 {
+		t.Fatalf("decodeTemplateID: got %v-%d, want %v-7", gotHash,
+			generation, prevHash)
+	}
+}
+
+// TestNetworkHashPS ensures the getnetworkhashps span defaults to the
+// difficulty averaging window ending at the best block, and the estimate is the
+// chain work done over the span divided by its timespan on a synthetic header
+// chain of known work.
+func TestNetworkHashPS(t *testing.T) {
+	// The first ten blocks have a difficulty of 1 and the rest a difficulty
+	// of 256, mined a minute apart.  The timestamp of the last block is
+	// skewed before its predecessors.
+	const window = 5
+	var headers []wire.BlockHeader
+	genesisTime := time.Unix(1502385451, 0)
+	for height := 0; height <= 20; height++ {
+		bits := uint32(0x1d00ffff)
+		if height >= 10 {
+			bits = 0x1c00ffff
+		}
+		headers = append(headers, wire.BlockHeader{
+			Bits: bits,
+			Timestamp: genesisTime.Add(time.Duration(height) *
+				time.Minute),
+		})
+	}
+	headers[20].Timestamp = headers[15].Timestamp
+	chainWork := make([]*big.Int, len(headers))
+	chainWork[0] = blockchain.CalcWork(headers[0].Bits)
+	for i := 1; i < len(headers); i++ {
+		chainWork[i] = new(big.Int).Add(chainWork[i-1],
+			blockchain.CalcWork(headers[i].Bits))
+	}
+	easyWork := blockchain.CalcWork(0x1d00ffff).Int64()
+	hardWork := blockchain.CalcWork(0x1c00ffff).Int64()
+
+	tests := []struct {
+		name       string
+		blocks     int32
+		height     int32
+		bestHeight int32
+		start      int32
+		end        int32
+		want       int64
+	}{
+		{
+			name:       "defaults",
+			blocks:     -1,
+			height:     -1,
+			bestHeight: 19,
+			start:      14,
+			end:        19,
+			want:       5 * hardWork / 300,
+		},
+		{
+			name:       "zero blocks",
+			blocks:     0,
+			height:     8,
+			bestHeight: 19,
+			start:      3,
+			end:        8,
+			want:       5 * easyWork / 300,
+		},
+		{
+			name:       "difficulty change",
+			blocks:     4,
+			height:     11,
+			bestHeight: 19,
+			start:      7,
+			end:        11,
+			want:       (2*easyWork + 2*hardWork) / 240,
+		},
+		{
+			name:       "clamped to genesis",
+			blocks:     100,
+			height:     -1,
+			bestHeight: 9,
+			start:      0,
+			end:        9,
+			want:       9 * easyWork / 540,
+		},
+		{
+			name:       "skewed timestamp",
+			blocks:     -1,
+			height:     -1,
+			bestHeight: 20,
+			start:      15,
+			end:        20,
+			want:       0,
+		},
+	}
+	for _, test := range tests {
+		start, end, ok := networkHashPSSpan(test.blocks, test.height,
+			test.bestHeight, window)
+		if !ok || start != test.start || end != test.end {
+			t.Errorf("%s: got span %d-%d (%v), want %d-%d", test.name,
+				start, end, ok, test.start, test.end)
+			continue
+		}
+		got := calcNetworkHashPS(chainWork[start], chainWork[end],
+			headers[start].Timestamp, headers[end].Timestamp)
+		if got != test.want {
+			t.Errorf("%s: got %d hashes per second, want %d",
+				test.name, got, test.want)
+		}
+	}
+
+	// No estimate is made for heights beyond the best block, the genesis
+	// block or spans without any blocks.
+	invalid := []struct {
+		blocks     int32
+		height     int32
+		bestHeight int32
+	}{
+		{blocks: -1, height: 20, bestHeight: 19},
+		{blocks: -1, height: 0, bestHeight: 19},
+		{blocks: -1, height: -1, bestHeight: 0},
+	}
+	for _, test := range invalid {
+		start, end, ok := networkHashPSSpan(test.blocks, test.height,
+			test.bestHeight, window)
+		if ok {
+			t.Errorf("networkHashPSSpan(%d, %d, %d): got span %d-%d, "+
+				"want none", test.blocks, test.height,
+				test.bestHeight, start, end)
+		}
+	}
+}
+
+// TestActiveCommands ensures getrpcinfo reports a command while its handler is
+// executing along with how long it has been executing for, and no longer
+// reports it once the handler finished.
+func TestActiveCommands(t *testing.T) {
+	started := make(chan struct{})
+	finish := make(chan struct{})
+	rpcHandlers["slowtest"] = func(*rpcServer, interface{}, <-chan struct{}) (interface{}, error) {
+		close(started)
+		<-finish
+		return nil, nil
+	}
+	defer delete(rpcHandlers, "slowtest")
+
+	s := &rpcServer{activeCommands: newActiveCommands()}
+	done := make(chan error)
+	go func() {
+		_, err := s.standardCmdResult(&parsedRPCCmd{method: "slowtest"},
+			nil)
+		done <- err
+	}()
+	<-started
+	time.Sleep(10 * time.Millisecond)
+
+	// The slow command is reported along with getrpcinfo itself, which
+	// started executing after it.
+	result, err := s.standardCmdResult(&parsedRPCCmd{method: "getrpcinfo",
+		cmd: &btcjson.GetRPCInfoCmd{}}, nil)
+	if err != nil {
+		t.Fatalf("getrpcinfo: unexpected error: %v", err)
+	}
+	active := result.(*btcjson.GetRPCInfoResult).ActiveCommands
+	if len(active) != 2 || active[0].Method != "slowtest" ||
+		active[1].Method != "getrpcinfo" {
+		t.Fatalf("getrpcinfo: unexpected active commands %+v", active)
+	}
+	if active[0].Duration < 10000 || active[1].Duration > active[0].Duration {
+		t.Fatalf("getrpcinfo: unexpected durations %+v", active)
+	}
+
+	close(finish)
+	if err := <-done; err != nil {
+		t.Fatalf("slowtest: unexpected error: %v", err)
+	}
+	result, err = handleGetRPCInfo(s, &btcjson.GetRPCInfoCmd{}, nil)
+	if err != nil {
+		t.Fatalf("getrpcinfo: unexpected error: %v", err)
+	}
+	if active := result.(*btcjson.GetRPCInfoResult).ActiveCommands; len(active) != 0 {
+		t.Fatalf("getrpcinfo: unexpected active commands after the "+
+			"command finished %+v", active)
+	}
+}
+
+// TestUnlimitedRequest ensures only requests for the commands which are used
+// to inspect the server are exempt from the limit on the number of clients.
+func TestUnlimitedRequest(t *testing.T) {
+	tests := []struct {
+		body string
+		want bool
+	}{
+		{`{"jsonrpc":"1.0","method":"getrpcinfo","params":[],"id":1}`, true},
+		{`{"jsonrpc":"1.0","method":"getmemoryinfo","params":[],"id":1}`, true},
+		{`{"jsonrpc":"1.0","method":"uptime","params":[],"id":1}`, true},
+		{`{"jsonrpc":"1.0","method":"getblock","params":[],"id":1}`, false},
+		{`{"method":`, false},
+	}
+	for _, test := range tests {
+		if got := isUnlimitedRequest([]byte(test.body)); got != test.want {
+			t.Errorf("isUnlimitedRequest(%s): got %v, want %v",
+				test.body, got, test.want)
+		}
+	}
+}
@@ -22,19 +22,23 @@ var helpDescsEnUS = map[string]string{
 		"The levelspec can either a debug level or of the form:\n" +
 		"<subsystem>=<level>,<subsystem2>=<level2>,...\n" +
 		"The valid debug levels are trace, debug, info, warn, error, and critical.\n" +
-		"The valid subsystems are AMGR, ADXR, BCDB, BMGR, CHAN, DISC, PEER, PRVA, RPCS, SCRP, SRVR, and TXMP.\n" +
-		"Finally the keyword 'show' will return a list of the available subsystems.",
+		"The valid subsystems are AMGR, ADXR, BCDB, BMGR, CHAN, CMGR, DISC, INDX, MINR, PEER, PRVA, RPCS, SCRP, SRVR, and TXMP.\n" +
+		"The levels are changed together, so none of them are changed when any part of the levelspec is invalid.\n" +
+		"Finally the keyword 'show' will return a list of the available subsystems along with their current levels.",
 	"debuglevel-levelspec":   "The debug level(s) to use or the keyword 'show'",
 	"debuglevel--condition0": "levelspec!=show",
 	"debuglevel--condition1": "levelspec=show",
 	"debuglevel--result0":    "The string 'Done.'",
-	"debuglevel--result1":    "The list of subsystems",
+	"debuglevel--result1":    "The list of subsystems and their current levels",
 
 	// AddNodeCmd help.
 	"addnode--synopsis": "Attempts to add or remove a persistent peer.",
 	"addnode-addr":      "IP address and port of the peer to operate on",
 	"addnode-subcmd":    "'add' to add a persistent peer, 'remove' to remove a persistent peer, or 'onetry' to try a single connection to a peer",
 
+	// ClearBannedCmd help.
+	"clearbanned--synopsis": "Lifts the bans of all banned IP addresses and subnets.",
+
 	// NodeCmd help.
 	"node--synopsis":     "Attempts to add or remove a peer.",
 	"node-subcmd":        "'disconnect' to remove all matching non-persistent peers, 'remove' to remove a persistent peer, or 'connect' to connect to a peer",
@@ -45,6 +49,17 @@ var helpDescsEnUS = map[string]string{
 	"transactioninput-txid": "The hash of the input transaction",
 	"transactioninput-vout": "The specific output of the input transaction to redeem",
 
+	// CompactDBCmd help.
+	"compactdb--synopsis": "Compacts the database to reclaim the space used by deleted and overwritten data.\n" +
+		"The node keeps running while the database is compacted and the compaction is aborted when the server shuts down.",
+	"compactdb-bucket": "Only compact the top-level database bucket with this name, such as txbyhashidx, along with its nested buckets (default: the entire database)",
+
+	// CompactDBResult help.
+	"compactdbresult-bucket":     "The compacted bucket (omitted when the entire database is compacted)",
+	"compactdbresult-sizebefore": "The size of the database metadata files before the compaction in bytes",
+	"compactdbresult-sizeafter":  "The size of the database metadata files after the compaction in bytes",
+	"compactdbresult-seconds":    "The time the compaction took in seconds",
+
 	// CreateRawTransactionCmd help.
 	"createrawtransaction--synopsis": "Returns a new transaction spending the provided inputs and sending to the provided addresses.\n" +
 		"The transaction inputs are not signed in the created transaction.\n" +
@@ -55,8 +70,15 @@ var helpDescsEnUS = map[string]string{
 	"createrawtransaction-amounts--value": "n.nnn",
 	"createrawtransaction-amounts--desc":  "The destination address as the key and the amount in RMG as the value",
 	"createrawtransaction-locktime":       "Locktime value; a non-zero value will also locktime-activate the inputs",
+	"createrawtransaction-verbose":        "Specifies the transaction is returned along with its fee, which requires the outputs spent by the inputs to be known",
+	"createrawtransaction--condition0":    "verbose=false",
+	"createrawtransaction--condition1":    "verbose=true",
 	"createrawtransaction--result0":       "Hex-encoded bytes of the serialized transaction",
 
+	// CreateRawTransactionResult help.
+	"createrawtransactionresult-hex": "Hex-encoded bytes of the serialized transaction",
+	"createrawtransactionresult-fee": "The fee the transaction pays in RMG",
+
 	// ScriptSig help.
 	"scriptsig-asm": "Disassembly of the script",
 	"scriptsig-hex": "Hex-encoded bytes of the script",
@@ -84,8 +106,10 @@ var helpDescsEnUS = map[string]string{
 	"scriptpubkeyresult-asm":       "Disassembly of the script",
 	"scriptpubkeyresult-hex":       "Hex-encoded bytes of the script",
 	"scriptpubkeyresult-reqSigs":   "The number of required signatures",
-	"scriptpubkeyresult-type":      "The type of the script (e.g. 'pubkeyhash')",
-	"scriptpubkeyresult-adminOp":   "A human readable interpretation of an admin thread op",
+	"scriptpubkeyresult-type":      "The type of the script (safe_multisig, timelock_safe_multisig, admin, admin_op, nulldata, or nonstandard)",
+	"scriptpubkeyresult-keyIDs":    "The key ids of the ASP keys which cosign Prova scripts",
+	"scriptpubkeyresult-thread":    "The admin thread of admin scripts (root, provision or issue)",
+	"scriptpubkeyresult-adminOp":   "A human readable interpretation of an admin thread op (only for admin_op scripts of admin transactions)",
 	"scriptpubkeyresult-addresses": "The bitcoin addresses associated with this script",
 
 	// Vout help.
@@ -108,17 +132,96 @@ var helpDescsEnUS = map[string]string{
 	"setvalidatekeys--synopsis": "Sets the private keys to use to sign generated blocks",
 	"setvalidatekeys-privkeys":  "Hex-encoded 32 byte private keys",
 
+	// ValidatorInfoResult help.
+	"validatorinforesult-pubkey":          "The hex-encoded validate public key",
+	"validatorinforesult-windowblocks":    "Number of blocks in the averaging window signed by the key",
+	"validatorinforesult-trailingblocks":  "Number of the most recent maxblocks blocks signed by the key",
+	"validatorinforesult-cansign":         "Whether the key may sign the next block without exceeding its share of the window",
+	"validatorinforesult-recentheights":   "Heights of the blocks in the averaging window signed by the key, newest first",
+	"validatorinforesult-lookbackheights": "Heights of the blocks within the lookback signed by the key, newest first (only when lookback is specified and the key signed any)",
+
+	// GetValidatorInfoResult help.
+	"getvalidatorinforesult-hash":       "Hash of the best block the returned data is valid for",
+	"getvalidatorinforesult-height":     "Height of the best block the returned data is valid for",
+	"getvalidatorinforesult-windowsize": "Number of blocks in the averaging window",
+	"getvalidatorinforesult-maxblocks":  "Maximum number of blocks a single key may sign within the averaging window",
+	"getvalidatorinforesult-lookback":   "Number of most recent blocks the lookback heights cover (only when lookback is specified)",
+	"getvalidatorinforesult-validators": "The active validate keys",
+
+	// GetValidatorInfoCmd help.
+	"getvalidatorinfo--synopsis": "Returns the active validate keys along with the blocks each of them signed in the averaging window of the best chain.",
+	"getvalidatorinfo-lookback":  "Also return the heights of the blocks each key signed within this number of most recent blocks, which requires the sig key id index (--sigkeyidindex)",
+
+	// ValidatorAdminResult help.
+	"validatoradminresult-txid":         "The hash of the admin transaction",
+	"validatoradminresult-hex":          "The serialized, hex-encoded admin transaction, only present when it is not fully signed",
+	"validatoradminresult-complete":     "Whether the admin transaction is fully signed and was submitted to the memory pool",
+	"validatoradminresult-validatekeys": "The validate pubKeys once the admin transaction is connected",
+
+	// ProvisionValidatorCmd help.
+	"provisionvalidator--synopsis": "Builds, signs with the configured admin keys and submits a provision thread transaction which adds a validate key.\n" +
+		"The unsigned transaction is returned when no admin keys are configured.",
+	"provisionvalidator-pubkey": "Hex-encoded validate public key to add",
+
+	// RevokeValidatorCmd help.
+	"revokevalidator--synopsis": "Builds, signs with the configured admin keys and submits a provision thread transaction which revokes a validate key.\n" +
+		"The unsigned transaction is returned when no admin keys are configured.",
+	"revokevalidator-pubkey": "Hex-encoded validate public key to revoke",
+
 	// DecodeScriptResult help.
 	"decodescriptresult-asm":       "Disassembly of the script",
 	"decodescriptresult-reqSigs":   "The number of required signatures",
-	"decodescriptresult-type":      "The type of the script (e.g. 'pubkeyhash')",
-	"decodescriptresult-addresses": "The bitcoin addresses associated with this script",
-	"decodescriptresult-p2sh":      "The script hash for use in pay-to-script-hash transactions",
+	"decodescriptresult-type":      "The type of the script (safe_multisig, timelock_safe_multisig, admin, admin_op, nulldata, or nonstandard)",
+	"decodescriptresult-keyIDs":    "The key ids of the ASP keys which cosign Prova scripts",
+	"decodescriptresult-thread":    "The admin thread of admin scripts (root, provision or issue)",
+	"decodescriptresult-adminOp":   "A human readable interpretation of admin_op scripts",
+	"decodescriptresult-addresses": "The Prova addresses associated with this script",
+	"decodescriptresult-p2sh":      "The script hash for use in pay-to-script-hash transactions (omitted since Prova has no pay-to-script-hash addresses)",
 
 	// DecodeScriptCmd help.
 	"decodescript--synopsis": "Returns a JSON object with information about the provided hex-encoded script.",
 	"decodescript-hexscript": "Hex-encoded script",
 
+	// EstimateFeeCmd help.
+	"estimatefee--synopsis": "Estimates the fee rate in RMG/kB a transaction needs to pay to be confirmed within the passed number of blocks.",
+	"estimatefee-numblocks": "The number of blocks the transaction should be confirmed within",
+	"estimatefee--result0":  "The estimated fee rate in RMG/kB, or -1 when there is not enough data",
+
+	// EstimateSmartFeeCmd help.
+	"estimatesmartfee--synopsis":    "Estimates the fee rate in RMG/kB a transaction needs to pay to be confirmed within the passed number of blocks and reports the minimum fee rate of the memory pool.",
+	"estimatesmartfee-conftarget":   "The number of blocks the transaction should be confirmed within",
+	"estimatesmartfee-estimatemode": "The estimate mode, either CONSERVATIVE or ECONOMICAL",
+
+	// EstimateSmartFeeResult help.
+	"estimatesmartfeeresult-feerate":       "The estimated fee rate in RMG/kB, omitted when there is not enough data",
+	"estimatesmartfeeresult-mempoolminfee": "The minimum fee rate in RMG/kB transactions need to pay to be accepted to the memory pool",
+	"estimatesmartfeeresult-errors":        "Errors encountered while estimating the fee rate",
+	"estimatesmartfeeresult-blocks":        "The number of blocks spanned by the transactions the estimate is based on",
+
+	// FundRawTransactionUtxo help.
+	"fundrawtransactionutxo-txid": "The hash of the transaction of the output",
+	"fundrawtransactionutxo-vout": "The index of the output",
+
+	// FundRawTransactionOpts help.
+	"fundrawtransactionopts-changeaddress": "The address the change is paid to",
+	"fundrawtransactionopts-utxos":         "Unspent outputs which may be spent to fund the transaction",
+	"fundrawtransactionopts-addresses":     "Addresses whose confirmed unspent outputs may be spent to fund the transaction (requires --addrindex)",
+	"fundrawtransactionopts-feerate":       "The fee rate in RMG/kB, at least the minimum relay fee rate (default: estimated for the confirmation target)",
+	"fundrawtransactionopts-conftarget":    "The number of blocks the transaction should be confirmed within, used when no fee rate is passed (default: 6)",
+
+	// FundRawTransactionCmd help.
+	"fundrawtransaction--synopsis": "Adds inputs to a transaction until they pay for its outputs and the fee, and pays the remainder to a change address.\n" +
+		"The largest outputs are spent first and the existing inputs of the transaction are kept.\n" +
+		"All addresses must belong to the network of the server.  The added inputs are not signed.",
+	"fundrawtransaction-hextx":   "Hex-encoded bytes of the serialized transaction to fund",
+	"fundrawtransaction-options": "The funding options",
+
+	// FundRawTransactionResult help.
+	"fundrawtransactionresult-hex":       "Hex-encoded bytes of the serialized funded transaction",
+	"fundrawtransactionresult-fee":       "The fee the funded transaction pays in RMG",
+	"fundrawtransactionresult-feerate":   "The fee rate the transaction was funded with in RMG/kB",
+	"fundrawtransactionresult-changepos": "The index of the change output, or -1 when no change output was added",
+
 	// GenerateCmd help
 	"generate--synopsis": "Generates a set number of blocks (simnet or regtest only) and returns a JSON\n" +
 		" array of their hashes.",
@@ -126,6 +229,22 @@ var helpDescsEnUS = map[string]string{
 	"generate-validatekeys": "Hex-encoded private keys to use for block signing",
 	"generate--result0":     "The hashes, in order, of blocks generated by the call",
 
+	// GenerateBlockCmd help.
+	"generateblock--synopsis":    "Generates a block paying the passed address which contains exactly the listed memory pool transactions (simnet or regtest only).",
+	"generateblock-address":      "The address the coinbase of the block pays",
+	"generateblock-transactions": "The ids of the memory pool transactions to include in the block, in order",
+
+	// GenerateBlockResult help.
+	"generateblockresult-hash": "The hash of the generated block",
+
+	// GenerateToAddressCmd help.
+	"generatetoaddress--synopsis": "Generates a set number of blocks paying the passed address (simnet or regtest only) and returns a JSON\n" +
+		" array of their hashes.",
+	"generatetoaddress-numblocks": "Number of blocks to generate",
+	"generatetoaddress-address":   "The address the coinbase of each block pays",
+	"generatetoaddress-maxtries":  "The maximum number of nonces to try overall before giving up, 0 for no limit",
+	"generatetoaddress--result0":  "The hashes, in order, of blocks generated by the call",
+
 	// GetAddedNodeInfoResultAddr help.
 	"getaddednodeinforesultaddr-address":   "The ip address for this DNS entry",
 	"getaddednodeinforesultaddr-connected": "The connection 'direction' (inbound/outbound/false)",
@@ -133,6 +252,8 @@ var helpDescsEnUS = map[string]string{
 	// GetAddedNodeInfoResult help.
 	"getaddednodeinforesult-addednode": "The ip address or domain of the added peer",
 	"getaddednodeinforesult-connected": "Whether or not the peer is currently connected",
+	"getaddednodeinforesult-connstate": "The state of the connection to the peer (pending/established/disconnected/failed/canceled)",
+	"getaddednodeinforesult-retries":   "The number of failed attempts to reconnect to the peer since it was last connected",
 	"getaddednodeinforesult-addresses": "DNS lookup and connection information about the peer",
 
 	// GetAddedNodeInfo help.
@@ -194,10 +315,11 @@ var helpDescsEnUS = map[string]string{
 	// GetBlockCmd help.
 	"getblock--synopsis":   "Returns information about a block given its hash.",
 	"getblock-hash":        "The hash of the block",
-	"getblock-verbose":     "Specifies the block is returned as a JSON object instead of hex-encoded string",
-	"getblock-verbosetx":   "Specifies that each transaction is returned as a JSON object and only applies if the verbose flag is true (btcd extension)",
-	"getblock--condition0": "verbose=false",
-	"getblock--condition1": "verbose=true",
+	"getblock-verbosity":   "0 returns the block as a hex-encoded string, 1 as a JSON object listing the transaction ids and 2 as a JSON object with the decoded transactions (false and true are accepted as 0 and 1)",
+	"getblock-verbosetx":   "Specifies that each transaction is returned as a JSON object and only applies if the verbosity level is 1 (btcd extension)",
+	"getblock--condition0": "verbosity=0",
+	"getblock--condition1": "verbosity=1",
+	"getblock--condition2": "verbosity=2",
 	"getblock--result0":    "Hex-encoded bytes of the serialized block",
 
 	// TxRawResult help.
@@ -226,7 +348,7 @@ var helpDescsEnUS = map[string]string{
 
 	// GetBlockVerboseResult help.
 	"getblockverboseresult-hash":              "The hash of the block (same as provided)",
-	"getblockverboseresult-confirmations":     "The number of confirmations",
+	"getblockverboseresult-confirmations":     "The number of confirmations, or -1 if the block is not in the main chain",
 	"getblockverboseresult-size":              "The size of the block",
 	"getblockverboseresult-height":            "The height of the block in the block chain",
 	"getblockverboseresult-version":           "The block version",
@@ -234,14 +356,76 @@ var helpDescsEnUS = map[string]string{
 	"getblockverboseresult-tx":                "The transaction hashes (only when verbosetx=false)",
 	"getblockverboseresult-rawtx":             "The transactions as JSON objects (only when verbosetx=true)",
 	"getblockverboseresult-time":              "The block time in seconds since 1 Jan 1970 GMT",
+	"getblockverboseresult-mediantime":        "The median time of the past few blocks up to and including this one in seconds since 1 Jan 1970 GMT",
 	"getblockverboseresult-nonce":             "The block nonce",
 	"getblockverboseresult-bits":              "The bits which represent the block difficulty",
 	"getblockverboseresult-difficulty":        "The proof-of-work difficulty as a multiple of the minimum difficulty",
+	"getblockverboseresult-chainwork":         "The total cumulative work in the chain up to and including the block as a hex-encoded 256-bit number",
 	"getblockverboseresult-previousblockhash": "The hash of the previous block",
-	"getblockverboseresult-nextblockhash":     "The hash of the next block (only if there is one)",
+	"getblockverboseresult-nextblockhash":     "The hash of the next block in the main chain (only if there is one)",
 	"getblockverboseresult-validatingpubkey":  "The validating public key signing the block",
+	"getblockverboseresult-sigkeyid":          "The hex-encoded hash160 of the validating public key which identifies the validator",
 	"getblockverboseresult-signature":         "The signature of the block generator",
 
+	// GetBlockVerboseTxResult help.
+	"getblockverbosetxresult-hash":              "The hash of the block (same as provided)",
+	"getblockverbosetxresult-confirmations":     "The number of confirmations, or -1 if the block is not in the main chain",
+	"getblockverbosetxresult-size":              "The size of the block",
+	"getblockverbosetxresult-height":            "The height of the block in the block chain",
+	"getblockverbosetxresult-version":           "The block version",
+	"getblockverbosetxresult-merkleroot":        "Root hash of the merkle tree",
+	"getblockverbosetxresult-tx":                "The transactions as JSON objects",
+	"getblockverbosetxresult-time":              "The block time in seconds since 1 Jan 1970 GMT",
+	"getblockverbosetxresult-mediantime":        "The median time of the past few blocks up to and including this one in seconds since 1 Jan 1970 GMT",
+	"getblockverbosetxresult-nonce":             "The block nonce",
+	"getblockverbosetxresult-bits":              "The bits which represent the block difficulty",
+	"getblockverbosetxresult-difficulty":        "The proof-of-work difficulty as a multiple of the minimum difficulty",
+	"getblockverbosetxresult-chainwork":         "The total cumulative work in the chain up to and including the block as a hex-encoded 256-bit number",
+	"getblockverbosetxresult-previousblockhash": "The hash of the previous block",
+	"getblockverbosetxresult-nextblockhash":     "The hash of the next block in the main chain (only if there is one)",
+	"getblockverbosetxresult-validatingpubkey":  "The validating public key signing the block",
+	"getblockverbosetxresult-sigkeyid":          "The hex-encoded hash160 of the validating public key which identifies the validator",
+	"getblockverbosetxresult-signature":         "The signature of the block generator",
+
+	// GetBlockChainInfoCmd help.
+	"getblockchaininfo--synopsis": "Returns information about the current state of the block chain.",
+
+	// GetBlockChainInfoResult help.
+	"getblockchaininforesult-chain":                "The name of the chain the server is on",
+	"getblockchaininforesult-blocks":               "The number of blocks in the best known chain",
+	"getblockchaininforesult-headers":              "The number of headers in the best known chain",
+	"getblockchaininforesult-bestblockhash":        "The hash of the best block in the chain",
+	"getblockchaininforesult-difficulty":           "The current proof-of-work difficulty as a multiple of the minimum difficulty",
+	"getblockchaininforesult-verificationprogress": "An estimate of the fraction of the chain which has been verified",
+	"getblockchaininforesult-chainwork":            "The total cumulative work in the best chain as a hex-encoded 256-bit number",
+	"getblockchaininforesult-window":               "The averaging window of the difficulty adjustment for the next block",
+	"getblockchaininforesult-deployments":          "The state of the consensus rule changes activated by height for the next block",
+	"getblockchaininforesult-versionrollouts":      "The state of the rule changes rolled out by block version for the next block",
+
+	// DeploymentResult help.
+	"deploymentresult-id":               "The name of the rule change",
+	"deploymentresult-active":           "Whether the rule change is enforced for the next block",
+	"deploymentresult-activationheight": "The height of the first block the rule change is enforced for (omitted when not scheduled)",
+	"deploymentresult-activationtime":   "The timestamp of the block at the activation height in seconds since 1 Jan 1970 GMT (0 until the block is in the chain)",
+
+	// VersionRolloutResult help.
+	"versionrolloutresult-id":               "The name of the rule change",
+	"versionrolloutresult-version":          "The block version which signals the rule change",
+	"versionrolloutresult-status":           "The state of the rule change (defined, enforced or active)",
+	"versionrolloutresult-since":            "The height of the first block of the current state",
+	"versionrolloutresult-sincetime":        "The timestamp of the first block of the current state in seconds since 1 Jan 1970 GMT (0 until the block is in the chain)",
+	"versionrolloutresult-signaling":        "The number of blocks with at least the version in the window ending at the best block",
+	"versionrolloutresult-window":           "The number of most recent blocks the signaling blocks are counted in",
+	"versionrolloutresult-enforcethreshold": "The number of signaling blocks required to enforce the rule change for blocks with the version",
+	"versionrolloutresult-rejectthreshold":  "The number of signaling blocks required to reject blocks with older versions",
+
+	// DifficultyWindowResult help.
+	"difficultywindowresult-blocks":         "The number of blocks the difficulty is averaged over",
+	"difficultywindowresult-actualtimespan": "The seconds between the past median times of the first and last blocks of the window (0 until the window is filled)",
+	"difficultywindowresult-targettimespan": "The seconds the blocks of the window are expected to take",
+	"difficultywindowresult-nextbits":       "The required difficulty of the next block in compact form",
+	"difficultywindowresult-nextdifficulty": "The required difficulty of the next block as a multiple of the minimum difficulty",
+
 	// GetBlockCountCmd help.
 	"getblockcount--synopsis": "Returns the number of blocks in the longest block chain.",
 	"getblockcount--result0":  "The current block count",
@@ -261,18 +445,39 @@ var helpDescsEnUS = map[string]string{
 
 	// GetBlockHeaderVerboseResult help.
 	"getblockheaderverboseresult-hash":              "The hash of the block (same as provided)",
-	"getblockheaderverboseresult-confirmations":     "The number of confirmations",
+	"getblockheaderverboseresult-confirmations":     "The number of confirmations, or -1 if the block is not in the main chain",
 	"getblockheaderverboseresult-height":            "The height of the block in the block chain",
 	"getblockheaderverboseresult-version":           "The block version",
 	"getblockheaderverboseresult-merkleroot":        "Root hash of the merkle tree",
 	"getblockheaderverboseresult-time":              "The block time in seconds since 1 Jan 1970 GMT",
+	"getblockheaderverboseresult-mediantime":        "The median time of the past few blocks up to and including this one in seconds since 1 Jan 1970 GMT",
 	"getblockheaderverboseresult-nonce":             "The block nonce",
 	"getblockheaderverboseresult-bits":              "The bits which represent the block difficulty",
 	"getblockheaderverboseresult-difficulty":        "The proof-of-work difficulty as a multiple of the minimum difficulty",
+	"getblockheaderverboseresult-chainwork":         "The total cumulative work in the chain up to and including the block as a hex-encoded 256-bit number",
 	"getblockheaderverboseresult-previousblockhash": "The hash of the previous block",
-	"getblockheaderverboseresult-nextblockhash":     "The hash of the next block (only if there is one)",
+	"getblockheaderverboseresult-nextblockhash":     "The hash of the next block in the main chain (only if there is one)",
 	"getblockheaderverboseresult-signature":         "The signature of this block by the validator who created it",
 	"getblockheaderverboseresult-validatingpubkey":  "The validating public key of the block",
+	"getblockheaderverboseresult-sigkeyid":          "The hex-encoded hash160 of the validating public key which identifies the validator",
+
+	// GetBlockStatsCmd help.
+	"getblockstats--synopsis": "Returns fee and size statistics about a block given its hash.  Fee rates are expressed in atoms per kilobyte.",
+	"getblockstats-hash":      "The hash of the block",
+	"getblockstats-stats":     "The names of the statistics to return (default: all of them)",
+
+	// GetBlockStatsResult help.
+	"getblockstatsresult-blockhash":     "The hash of the block",
+	"getblockstatsresult-height":        "The height of the block in the block chain",
+	"getblockstatsresult-totalfee":      "The total fees paid by the transactions in the block",
+	"getblockstatsresult-feeperkb":      "The total fees divided by the total size of the non-coinbase transactions",
+	"getblockstatsresult-minfeerate":    "The lowest fee rate of the non-coinbase transactions",
+	"getblockstatsresult-medianfeerate": "The median fee rate of the non-coinbase transactions",
+	"getblockstatsresult-maxfeerate":    "The highest fee rate of the non-coinbase transactions",
+	"getblockstatsresult-txs":           "The number of transactions in the block, including the coinbase",
+	"getblockstatsresult-ins":           "The number of inputs, excluding the coinbase",
+	"getblockstatsresult-outs":          "The number of outputs, including the coinbase",
+	"getblockstatsresult-totalsize":     "The serialized size of the block in bytes",
 
 	// TemplateRequest help.
 	"templaterequest-mode":         "This is 'template', 'proposal', or omitted",
@@ -322,13 +527,23 @@ var helpDescsEnUS = map[string]string{
 
 	// GetBlockTemplateCmd help.
 	"getblocktemplate--synopsis": "Returns a JSON object with information necessary to construct a block to mine or accepts a proposal to validate.\n" +
-		"See BIP0022 and BIP0023 for the full specification.",
+		"See BIP0022 and BIP0023 for the full specification.\n" +
+		"Templates are signed with one of the validate keys provided via setvalidatekeys.",
 	"getblocktemplate-request":     "Request object which controls the mode and several parameters",
 	"getblocktemplate--condition0": "mode=template",
 	"getblocktemplate--condition1": "mode=proposal, rejected",
 	"getblocktemplate--condition2": "mode=proposal, accepted",
 	"getblocktemplate--result1":    "An error string which represents why the proposal was rejected or nothing if accepted",
 
+	// GetChainTipsResult help.
+	"getchaintipsresult-height":    "The height of the tip",
+	"getchaintipsresult-hash":      "The hash of the tip",
+	"getchaintipsresult-branchlen": "The number of blocks since the branch forked from the main chain, 0 for the main chain",
+	"getchaintipsresult-status":    "The status of the branch (active, valid-fork, valid-headers or invalid)",
+
+	// GetChainTipsCmd help.
+	"getchaintips--synopsis": "Returns information about the tips of all branches of the block chain known to the block index, including the main chain.",
+
 	// GetConnectionCountCmd help.
 	"getconnectioncount--synopsis": "Returns the number of active connections to other peers.",
 	"getconnectioncount--result0":  "The number of connections",
@@ -337,10 +552,34 @@ var helpDescsEnUS = map[string]string{
 	"getcurrentnet--synopsis": "Get bitcoin network the server is running on.",
 	"getcurrentnet--result0":  "The network identifer",
 
+	// GetDBStatsCmd help.
+	"getdbstats--synopsis": "Returns statistics about the storage used by the database.",
+
+	// DBBucketStatsResult help.
+	"dbbucketstatsresult-name": "The name of the bucket",
+	"dbbucketstatsresult-size": "The approximate size of the bucket and its nested buckets in bytes",
+
+	// GetDBStatsResult help.
+	"getdbstatsresult-buckets":        "The approximate storage used by each top-level bucket",
+	"getdbstatsresult-metadatafiles":  "The number of database metadata files",
+	"getdbstatsresult-metadatasize":   "The total size of the database metadata files in bytes",
+	"getdbstatsresult-levelfiles":     "The number of database metadata files at each level",
+	"getdbstatsresult-obsoletefiles":  "The number of database metadata files which are no longer referenced and are waiting to be removed",
+	"getdbstatsresult-obsoletesize":   "The total size of the obsolete database metadata files in bytes",
+	"getdbstatsresult-blockfiles":     "The number of block files",
+	"getdbstatsresult-blockfilessize": "The total size of the block files in bytes",
+
 	// GetDifficultyCmd help.
-	"getdifficulty--synopsis": "Returns the proof-of-work difficulty as a multiple of the minimum difficulty.",
+	"getdifficulty--synopsis": "Returns the proof-of-work difficulty as a multiple of the minimum difficulty, which is the proof-of-work limit of the active network.",
 	"getdifficulty--result0":  "The difficulty",
 
+	// GetFinalizedHeightCmd help.
+	"getfinalizedheight--synopsis": "Returns the most recent block of the main chain which can no longer be disconnected by a reorganization.  It is the latest checkpoint or the block buried under the maximum reorganization depth, whichever is higher.",
+
+	// GetFinalizedHeightResult help.
+	"getfinalizedheightresult-height": "The height of the finalized block",
+	"getfinalizedheightresult-hash":   "The hash of the finalized block",
+
 	// GetGenerateCmd help.
 	"getgenerate--synopsis": "Returns if the server is set to generate coins (mine) or not.",
 	"getgenerate--result0":  "True if mining, false if not",
@@ -388,18 +627,75 @@ var helpDescsEnUS = map[string]string{
 	// GetInfoCmd help.
 	"getinfo--synopsis": "Returns a JSON object containing various state info.",
 
+	// GetMemoryInfoCmd help.
+	"getmemoryinfo--synopsis": "Returns statistics about the memory used by the Go runtime.",
+
+	// GetMemoryInfoResult help.
+	"getmemoryinforesult-heapalloc":    "Bytes of allocated heap objects",
+	"getmemoryinforesult-heapinuse":    "Bytes in heap spans which contain at least one object",
+	"getmemoryinforesult-heapidle":     "Bytes in heap spans which do not contain any objects",
+	"getmemoryinforesult-heapreleased": "Bytes of idle heap spans which were returned to the operating system",
+	"getmemoryinforesult-heapobjects":  "The number of allocated heap objects",
+	"getmemoryinforesult-sys":          "Total bytes of memory obtained from the operating system",
+	"getmemoryinforesult-numgc":        "The number of completed garbage collections",
+	"getmemoryinforesult-gcpausetotal": "Total number of microseconds the program was paused by garbage collections",
+	"getmemoryinforesult-gcpauselast":  "Number of microseconds the program was paused by the last garbage collection",
+	"getmemoryinforesult-lastgc":       "Time the last garbage collection finished in seconds since 1 Jan 1970 GMT, or 0 if there was none",
+	"getmemoryinforesult-goroutines":   "The number of goroutines",
+
+	// GetMempoolEntryCmd help.
+	"getmempoolentry--synopsis": "Returns information about a transaction in the memory pool.",
+	"getmempoolentry-txid":      "The hash of the transaction",
+
+	// GetMempoolEntryResult help.
+	"getmempoolentryresult-size":               "Transaction size in bytes",
+	"getmempoolentryresult-fee":                "Transaction fee in RMG",
+	"getmempoolentryresult-modifiedfee":        "Transaction fee in RMG used for mining priority, which includes the fee delta set with prioritisetransaction",
+	"getmempoolentryresult-feerate":            "Transaction fee rate in RMG/KB",
+	"getmempoolentryresult-time":               "Local time transaction entered pool in seconds since 1 Jan 1970 GMT",
+	"getmempoolentryresult-height":             "Block height when transaction entered the pool",
+	"getmempoolentryresult-startingpriority":   "Priority when transaction entered the pool",
+	"getmempoolentryresult-currentpriority":    "Current priority",
+	"getmempoolentryresult-descendantcount":    "Number of in-pool descendant transactions, including this one",
+	"getmempoolentryresult-descendantsize":     "Size in bytes of the in-pool descendants, including this one",
+	"getmempoolentryresult-descendantfees":     "Fees in RMG of the in-pool descendants, including this one",
+	"getmempoolentryresult-ancestorcount":      "Number of in-pool ancestor transactions, including this one",
+	"getmempoolentryresult-ancestorsize":       "Size in bytes of the in-pool ancestors, including this one",
+	"getmempoolentryresult-ancestorfees":       "Fees in RMG of the in-pool ancestors, including this one",
+	"getmempoolentryresult-depends":            "Unconfirmed transactions used as inputs for this transaction",
+	"getmempoolentryresult-spentby":            "Unconfirmed transactions spending outputs of this transaction",
+	"getmempoolentryresult-bip125-replaceable": "Whether this transaction or any of its unconfirmed ancestors signals opt-in replacement",
+
 	// GetMempoolInfoCmd help.
 	"getmempoolinfo--synopsis": "Returns memory pool information",
 
 	// GetMempoolInfoResult help.
-	"getmempoolinforesult-bytes": "Size in bytes of the mempool",
-	"getmempoolinforesult-size":  "Number of transactions in the mempool",
+	"getmempoolinforesult-bytes":         "Size in bytes of the mempool",
+	"getmempoolinforesult-size":          "Number of transactions in the mempool",
+	"getmempoolinforesult-mempoolminfee": "Minimum fee rate in RMG/kB for a transaction to be accepted, which rises above the minimum relay fee while the mempool is full",
+	"getmempoolinforesult-minrelaytxfee": "Minimum relay fee rate in RMG/kB configured for the mempool",
+
+	// GetMetricsCmd help.
+	"getmetrics--synopsis": "Returns the current values of the metrics of the server, such as the size of the memory pool, the number of peers and the time taken to validate blocks, sorted by name.",
+
+	// GetMetricsResult help.
+	"getmetricsresult-name":    "The name of the metric",
+	"getmetricsresult-type":    "The type of the metric (counter, gauge or histogram)",
+	"getmetricsresult-help":    "A description of the metric",
+	"getmetricsresult-value":   "The value of a counter or gauge",
+	"getmetricsresult-count":   "The number of values observed by a histogram",
+	"getmetricsresult-sum":     "The sum of the values observed by a histogram",
+	"getmetricsresult-buckets": "The buckets of a histogram, each of which counts the observed values up to its upper bound",
+
+	// MetricBucketResult help.
+	"metricbucketresult-le":    "The upper bound of the bucket, or +Inf for the last bucket",
+	"metricbucketresult-count": "The number of observed values less than or equal to the upper bound",
 
 	// GetMiningInfoResult help.
 	"getmininginforesult-blocks":           "Height of the latest best block",
 	"getmininginforesult-currentblocksize": "Size of the latest best block",
 	"getmininginforesult-currentblocktx":   "Number of transactions in the latest best block",
-	"getmininginforesult-difficulty":       "Current target difficulty",
+	"getmininginforesult-difficulty":       "Current target difficulty as a multiple of the minimum difficulty",
 	"getmininginforesult-errors":           "Any current errors",
 	"getmininginforesult-generate":         "Whether or not server is set to generate coins",
 	"getmininginforesult-genproclimit":     "Number of processors to use for coin generation (-1 when disabled)",
@@ -407,13 +703,14 @@ var helpDescsEnUS = map[string]string{
 	"getmininginforesult-networkhashps":    "Estimated network hashes per second for the most recent blocks",
 	"getmininginforesult-pooledtx":         "Number of transactions in the memory pool",
 	"getmininginforesult-testnet":          "Whether or not server is using testnet",
+	"getmininginforesult-window":           "The averaging window of the difficulty adjustment for the next block",
 
 	// GetMiningInfoCmd help.
 	"getmininginfo--synopsis": "Returns a JSON object containing mining-related information.",
 
 	// GetNetworkHashPSCmd help.
-	"getnetworkhashps--synopsis": "Returns the estimated network hashes per second for the block heights provided by the parameters.",
-	"getnetworkhashps-blocks":    "The number of blocks, or -1 for blocks since last difficulty change",
+	"getnetworkhashps--synopsis": "Returns the estimated network hashes per second for the block heights provided by the parameters, from the chain work done and the time elapsed between the first and last block.",
+	"getnetworkhashps-blocks":    "The number of blocks, or -1 for the difficulty averaging window",
 	"getnetworkhashps-height":    "Perform estimate ending with this height or -1 for current best chain block height",
 	"getnetworkhashps--result0":  "Estimated hashes per second",
 
@@ -421,44 +718,90 @@ var helpDescsEnUS = map[string]string{
 	"getnettotals--synopsis": "Returns a JSON object containing network traffic statistics.",
 
 	// GetNetTotalsResult help.
-	"getnettotalsresult-totalbytesrecv": "Total bytes received",
-	"getnettotalsresult-totalbytessent": "Total bytes sent",
-	"getnettotalsresult-timemillis":     "Number of milliseconds since 1 Jan 1970 GMT",
+	"getnettotalsresult-totalbytesrecv":    "Total bytes received",
+	"getnettotalsresult-totalbytessent":    "Total bytes sent",
+	"getnettotalsresult-timemillis":        "Number of milliseconds since 1 Jan 1970 GMT",
+	"getnettotalsresult-inboundevictions":  "Number of inbound peers evicted to make room for new inbound peers since the server started",
+	"getnettotalsresult-sentpermsg":        "Messages sent to all peers since the server started per message command",
+	"getnettotalsresult-sentpermsg--key":   "command",
+	"getnettotalsresult-sentpermsg--value": `{"count": n, "bytes": n}`,
+	"getnettotalsresult-sentpermsg--desc":  "The message command as the key and the number of messages and their total size in bytes as the value",
+	"getnettotalsresult-recvpermsg":        "Messages received from all peers since the server started per message command",
+	"getnettotalsresult-recvpermsg--key":   "command",
+	"getnettotalsresult-recvpermsg--value": `{"count": n, "bytes": n}`,
+	"getnettotalsresult-recvpermsg--desc":  "The message command as the key and the number of messages and their total size in bytes as the value",
 
 	// GetPeerInfoResult help.
-	"getpeerinforesult-id":             "A unique node ID",
-	"getpeerinforesult-addr":           "The ip address and port of the peer",
-	"getpeerinforesult-addrlocal":      "Local address",
-	"getpeerinforesult-services":       "Services bitmask which represents the services supported by the peer",
-	"getpeerinforesult-relaytxes":      "Peer has requested transactions be relayed to it",
-	"getpeerinforesult-lastsend":       "Time the last message was received in seconds since 1 Jan 1970 GMT",
-	"getpeerinforesult-lastrecv":       "Time the last message was sent in seconds since 1 Jan 1970 GMT",
-	"getpeerinforesult-bytessent":      "Total bytes sent",
-	"getpeerinforesult-bytesrecv":      "Total bytes received",
-	"getpeerinforesult-conntime":       "Time the connection was made in seconds since 1 Jan 1970 GMT",
-	"getpeerinforesult-timeoffset":     "The time offset of the peer",
-	"getpeerinforesult-pingtime":       "Number of microseconds the last ping took",
-	"getpeerinforesult-pingwait":       "Number of microseconds a queued ping has been waiting for a response",
-	"getpeerinforesult-version":        "The protocol version of the peer",
-	"getpeerinforesult-subver":         "The user agent of the peer",
-	"getpeerinforesult-inbound":        "Whether or not the peer is an inbound connection",
-	"getpeerinforesult-startingheight": "The latest block height the peer knew about when the connection was established",
-	"getpeerinforesult-currentheight":  "The current height of the peer",
-	"getpeerinforesult-banscore":       "The ban score",
-	"getpeerinforesult-feefilter":      "The requested minimum fee a transaction must have to be announced to the peer",
-	"getpeerinforesult-syncnode":       "Whether or not the peer is the sync peer",
+	"getpeerinforesult-id":                "A unique node ID",
+	"getpeerinforesult-addr":              "The ip address and port of the peer",
+	"getpeerinforesult-addrlocal":         "Local address",
+	"getpeerinforesult-services":          "Services bitmask which represents the services supported by the peer",
+	"getpeerinforesult-relaytxes":         "Peer has requested transactions be relayed to it",
+	"getpeerinforesult-lastsend":          "Time the last message was received in seconds since 1 Jan 1970 GMT",
+	"getpeerinforesult-lastrecv":          "Time the last message was sent in seconds since 1 Jan 1970 GMT",
+	"getpeerinforesult-bytessent":         "Total bytes sent",
+	"getpeerinforesult-bytesrecv":         "Total bytes received",
+	"getpeerinforesult-conntime":          "Time the connection was made in seconds since 1 Jan 1970 GMT",
+	"getpeerinforesult-timeoffset":        "The time offset of the peer",
+	"getpeerinforesult-pingtime":          "Number of microseconds the last ping took",
+	"getpeerinforesult-pingwait":          "Number of microseconds a queued ping has been waiting for a response",
+	"getpeerinforesult-minping":           "Lowest number of microseconds a ping took",
+	"getpeerinforesult-avgping":           "Moving average of the number of microseconds the pings took",
+	"getpeerinforesult-version":           "The protocol version of the peer",
+	"getpeerinforesult-subver":            "The user agent of the peer",
+	"getpeerinforesult-inbound":           "Whether or not the peer is an inbound connection",
+	"getpeerinforesult-networkgroup":      "The network group of the peer, which is the /16 for IPv4, the /32 for IPv6 and a group of onion keys for Tor, used to diversify the outbound connections",
+	"getpeerinforesult-startingheight":    "The latest block height the peer knew about when the connection was established",
+	"getpeerinforesult-currentheight":     "The current height of the peer",
+	"getpeerinforesult-banscore":          "The ban score",
+	"getpeerinforesult-feefilter":         "The requested minimum fee a transaction must have to be announced to the peer",
+	"getpeerinforesult-capabilities":      "The optional protocol features negotiated by the peer (sendheaders, sendcmpct, feefilter, sendaddrv2)",
+	"getpeerinforesult-syncnode":          "Whether or not the peer is the sync peer",
+	"getpeerinforesult-lastblock":         "Time the peer last relayed a new block in seconds since 1 Jan 1970 GMT, or 0 if it never did",
+	"getpeerinforesult-lasttransaction":   "Time the peer last relayed a new transaction in seconds since 1 Jan 1970 GMT, or 0 if it never did",
+	"getpeerinforesult-blocksannounced":   "Number of blocks announced to the peer",
+	"getpeerinforesult-txsannounced":      "Number of transactions announced to the peer",
+	"getpeerinforesult-knowninvskipped":   "Number of block and transaction announcements skipped because the peer was already known to have them, such as the ones it relayed itself",
+	"getpeerinforesult-sentpermsg":        "Messages sent to the peer per message command",
+	"getpeerinforesult-sentpermsg--key":   "command",
+	"getpeerinforesult-sentpermsg--value": `{"count": n, "bytes": n}`,
+	"getpeerinforesult-sentpermsg--desc":  "The message command as the key and the number of messages and their total size in bytes as the value",
+	"getpeerinforesult-recvpermsg":        "Messages received from the peer per message command",
+	"getpeerinforesult-recvpermsg--key":   "command",
+	"getpeerinforesult-recvpermsg--value": `{"count": n, "bytes": n}`,
+	"getpeerinforesult-recvpermsg--desc":  "The message command as the key and the number of messages and their total size in bytes as the value",
 
 	// GetPeerInfoCmd help.
 	"getpeerinfo--synopsis": "Returns data about each connected network peer as an array of json objects.",
 
+	// GetPendingBroadcastsCmd help.
+	"getpendingbroadcasts--synopsis": "Returns the transactions submitted to this node which are announced to peers until they are mined, ordered by the time they were submitted.",
+
+	// GetPendingBroadcastsResult help.
+	"getpendingbroadcastsresult-txid":          "The hash of the transaction",
+	"getpendingbroadcastsresult-added":         "Time the transaction was submitted in seconds since 1 Jan 1970 GMT",
+	"getpendingbroadcastsresult-lastannounced": "Time the transaction was last announced to all peers in seconds since 1 Jan 1970 GMT",
+	"getpendingbroadcastsresult-nextannounce":  "Time the transaction will be announced to all peers again in seconds since 1 Jan 1970 GMT",
+	"getpendingbroadcastsresult-announcements": "Number of times the transaction was announced to all peers, not counting the announcements to newly connected peers",
+
 	// GetRawMempoolVerboseResult help.
-	"getrawmempoolverboseresult-size":             "Transaction size in bytes",
-	"getrawmempoolverboseresult-fee":              "Transaction fee in grams",
-	"getrawmempoolverboseresult-time":             "Local time transaction entered pool in seconds since 1 Jan 1970 GMT",
-	"getrawmempoolverboseresult-height":           "Block height when transaction entered the pool",
-	"getrawmempoolverboseresult-startingpriority": "Priority when transaction entered the pool",
-	"getrawmempoolverboseresult-currentpriority":  "Current priority",
-	"getrawmempoolverboseresult-depends":          "Unconfirmed transactions used as inputs for this transaction",
+	"getrawmempoolverboseresult-size":               "Transaction size in bytes",
+	"getrawmempoolverboseresult-fee":                "Transaction fee in RMG",
+	"getrawmempoolverboseresult-modifiedfee":        "Transaction fee in RMG used for mining priority, which includes the fee delta set with prioritisetransaction",
+	"getrawmempoolverboseresult-feerate":            "Transaction fee rate in RMG/KB",
+	"getrawmempoolverboseresult-time":               "Local time transaction entered pool in seconds since 1 Jan 1970 GMT",
+	"getrawmempoolverboseresult-height":             "Block height when transaction entered the pool",
+	"getrawmempoolverboseresult-startingpriority":   "Priority when transaction entered the pool",
+	"getrawmempoolverboseresult-currentpriority":    "Current priority",
+	"getrawmempoolverboseresult-descendantcount":    "Number of in-pool descendant transactions, including this one",
+	"getrawmempoolverboseresult-descendantsize":     "Size in bytes of the in-pool descendants, including this one",
+	"getrawmempoolverboseresult-descendantfees":     "Fees in RMG of the in-pool descendants, including this one",
+	"getrawmempoolverboseresult-ancestorcount":      "Number of in-pool ancestor transactions, including this one",
+	"getrawmempoolverboseresult-ancestorsize":       "Size in bytes of the in-pool ancestors, including this one",
+	"getrawmempoolverboseresult-ancestorfees":       "Fees in RMG of the in-pool ancestors, including this one",
+	"getrawmempoolverboseresult-depends":            "Unconfirmed transactions used as inputs for this transaction",
+	"getrawmempoolverboseresult-spentby":            "Unconfirmed transactions spending outputs of this transaction",
+	"getrawmempoolverboseresult-bip125-replaceable": "Whether this transaction or any of its unconfirmed ancestors signals opt-in replacement",
 
 	// GetRawMempoolCmd help.
 	"getrawmempool--synopsis":   "Returns information about all of the transactions currently in the memory pool.",
@@ -483,12 +826,40 @@ var helpDescsEnUS = map[string]string{
 	"gettxoutresult-version":       "The transaction version",
 	"gettxoutresult-coinbase":      "Whether or not the transaction is a coinbase",
 
+	// GetRPCInfoCmd help.
+	"getrpcinfo--synopsis": "Returns the commands which are being executed by the RPC server.",
+
+	// RPCCommandResult help.
+	"rpccommandresult-method":   "The method of the command",
+	"rpccommandresult-duration": "Number of microseconds the command has been executing for",
+
+	// GetRPCInfoResult help.
+	"getrpcinforesult-active_commands": "The commands which are being executed, from the oldest",
+
 	// GetTxOutCmd help.
 	"gettxout--synopsis":      "Returns information about an unspent transaction output..",
 	"gettxout-txid":           "The hash of the transaction",
 	"gettxout-vout":           "The index of the output",
 	"gettxout-includemempool": "Include the mempool when true",
 
+	// GetTxOutProofCmd help.
+	"gettxoutproof--synopsis": "Returns a hex-encoded proof that the transactions are included in a block.\n" +
+		"The block is located using the transaction index unless it is specified, which requires all of the transactions to be in the same block.",
+	"gettxoutproof-txids":     "The hashes of the transactions to prove",
+	"gettxoutproof-blockhash": "The hash of the block which includes the transactions",
+	"gettxoutproof--result0":  "The hex-encoded merkle block which proves the inclusion of the transactions",
+
+	// GetTxOutSetInfoCmd help.
+	"gettxoutsetinfo--synopsis": "Returns statistics about the unspent transaction output set.",
+
+	// GetTxOutSetInfoResult help.
+	"gettxoutsetinforesult-height":           "The height of the best block",
+	"gettxoutsetinforesult-bestblock":        "The hash of the best block",
+	"gettxoutsetinforesult-txouts":           "The number of unspent transaction outputs",
+	"gettxoutsetinforesult-bytes_serialized": "The size of the compressed unspent transaction outputs",
+	"gettxoutsetinforesult-hash_serialized":  "A rolling hash over the outpoint, amount and public key script of every unspent transaction output",
+	"gettxoutsetinforesult-total_amount":     "The total amount of all unspent transaction outputs in RMG",
+
 	// HelpCmd help.
 	"help--synopsis":   "Returns a list of all commands or help for a specified command.",
 	"help-command":     "The command to retrieve help for",
@@ -497,26 +868,51 @@ var helpDescsEnUS = map[string]string{
 	"help--result0":    "List of commands",
 	"help--result1":    "Help for specified command",
 
+	// InvalidateBlockCmd help.
+	"invalidateblock--synopsis": "Marks a block, along with all of the blocks which extend it, as invalid.\n" +
+		"When the block is part of the main chain, it is disconnected along with the blocks which follow it and the chain switches to the valid branch with the most work.\n" +
+		"Neither may disconnect more blocks than the maximum reorganization depth allows.\n" +
+		"The block remains invalid when the node is restarted.",
+	"invalidateblock-blockhash": "The hash of the block to mark invalid",
+
+	// ListBannedCmd help.
+	"listbanned--synopsis": "Returns the banned IP addresses and subnets.",
+
+	// ListBannedResult help.
+	"listbannedresult-address":      "The banned IP address or subnet in CIDR notation",
+	"listbannedresult-banned_until": "The time the ban ends in seconds since 1 Jan 1970 GMT",
+	"listbannedresult-ban_created":  "The time the ban was created in seconds since 1 Jan 1970 GMT",
+	"listbannedresult-ban_reason":   "The reason for the ban",
+
 	// PingCmd help.
 	"ping--synopsis": "Queues a ping to be sent to each connected peer.\n" +
 		"Ping times are provided by getpeerinfo via the pingtime and pingwait fields.",
 
+	// PrioritiseTransactionCmd help.
+	"prioritisetransaction--synopsis": "Adds a fee delta to a transaction in the memory pool which is only used to select transactions for new blocks.\n" +
+		"Repeated calls add up the fee deltas.  A negative fee delta which exceeds the fee of the transaction excludes it, along with the transactions depending on it, from new blocks.\n" +
+		"The fee delta does not change the fee reported for the transaction and is discarded once the transaction leaves the memory pool.",
+	"prioritisetransaction-txid":     "The hash of the transaction",
+	"prioritisetransaction-feedelta": "The fee delta in atoms to add to the fee of the transaction when selecting transactions for new blocks",
+	"prioritisetransaction--result0": "Always true",
+
 	// SearchRawTransactionsCmd help.
 	"searchrawtransactions--synopsis": "Returns raw data for transactions involving the passed address.\n" +
 		"Returned transactions are pulled from both the database, and transactions currently in the mempool.\n" +
 		"Transactions pulled from the mempool will have the 'confirmations' field set to 0.\n" +
 		"Usage of this RPC requires the optional --addrindex flag to be activated, otherwise all responses will simply return with an error stating the address index has not yet been built.\n" +
 		"Similarly, until the address index has caught up with the current best height, all requests will return an error response in order to avoid serving stale data.",
-	"searchrawtransactions-address":     "The Bitcoin address to search for",
-	"searchrawtransactions-verbose":     "Specifies the transaction is returned as a JSON object instead of hex-encoded string",
-	"searchrawtransactions--condition0": "verbose=0",
-	"searchrawtransactions--condition1": "verbose=1",
-	"searchrawtransactions-skip":        "The number of leading transactions to leave out of the final response",
-	"searchrawtransactions-count":       "The maximum number of transactions to return",
-	"searchrawtransactions-vinextra":    "Specify that extra data from previous output will be returned in vin",
-	"searchrawtransactions-reverse":     "Specifies that the transactions should be returned in reverse chronological order",
-	"searchrawtransactions-filteraddrs": "Address list.  Only inputs or outputs with matching address will be returned",
-	"searchrawtransactions--result0":    "Hex-encoded serialized transaction",
+	"searchrawtransactions-address":        "The Bitcoin address to search for",
+	"searchrawtransactions-verbose":        "Specifies the transaction is returned as a JSON object instead of hex-encoded string",
+	"searchrawtransactions--condition0":    "verbose=0",
+	"searchrawtransactions--condition1":    "verbose=1",
+	"searchrawtransactions-skip":           "The number of leading transactions to leave out of the final response",
+	"searchrawtransactions-count":          "The maximum number of transactions to return",
+	"searchrawtransactions-vinextra":       "Specify that extra data from previous output will be returned in vin",
+	"searchrawtransactions-reverse":        "Specifies that the transactions should be returned in reverse chronological order",
+	"searchrawtransactions-filteraddrs":    "Address list.  Only inputs or outputs with matching address will be returned",
+	"searchrawtransactions-includemempool": "Specifies that unconfirmed transactions in the memory pool are included in the results",
+	"searchrawtransactions--result0":       "Hex-encoded serialized transaction",
 
 	// SendRawTransactionCmd help.
 	"sendrawtransaction--synopsis":     "Submits the serialized, hex-encoded transaction to the local peer and relays it to the network.",
@@ -524,6 +920,14 @@ var helpDescsEnUS = map[string]string{
 	"sendrawtransaction-allowhighfees": "Whether or not to allow insanely high fees (btcd does not yet implement this parameter, so it has no effect)",
 	"sendrawtransaction--result0":      "The hash of the transaction",
 
+	// SetBanCmd help.
+	"setban--synopsis": "Bans an IP address or subnet, or lifts its ban.\n" +
+		"Connected peers which are part of a newly banned IP address or subnet are disconnected.",
+	"setban-subnet":   "The IP address or subnet in CIDR notation, such as 10.0.0.0/24, to operate on",
+	"setban-subcmd":   "'add' to ban the IP address or subnet, 'remove' to lift its ban",
+	"setban-bantime":  "The number of seconds the ban lasts, or the time the ban ends at in seconds since 1 Jan 1970 GMT when absolute is true (0 or omitted: the --banduration option)",
+	"setban-absolute": "Whether bantime is the time the ban ends at instead of its duration",
+
 	// SetGenerateCmd help.
 	"setgenerate--synopsis":    "Set the server to generate coins (mine) or not.",
 	"setgenerate-generate":     "Use true to enable generation, false to disable it",
@@ -541,12 +945,20 @@ var helpDescsEnUS = map[string]string{
 	"submitblock-hexblock":    "Serialized, hex-encoded block",
 	"submitblock-options":     "This parameter is currently ignored",
 	"submitblock--condition0": "Block successfully submitted",
-	"submitblock--condition1": "Block rejected",
-	"submitblock--result1":    "The reason the block was rejected",
+	"submitblock--condition1": "Block already known, rejected, or not connected to the main chain",
+	"submitblock--result1":    "duplicate, duplicate-invalid or duplicate-inconclusive for known blocks, inconclusive for orphan and side chain blocks, or the reason the block was rejected",
 
 	// ValidateAddressResult help.
-	"validateaddresschainresult-isvalid": "Whether or not the address is valid",
-	"validateaddresschainresult-address": "The bitcoin address (only when isvalid is true)",
+	"validateaddresschainresult-isvalid":       "Whether or not the address is valid for the active network",
+	"validateaddresschainresult-address":       "The address (only when it could be decoded)",
+	"validateaddresschainresult-type":          "The address type, aztec for standard Prova addresses (only when it could be decoded)",
+	"validateaddresschainresult-keyids":        "The key ids embedded in the address (only when it could be decoded)",
+	"validateaddresschainresult-scriptpubkey":  "The hex-encoded script paying to the address (only when it could be decoded)",
+	"validateaddresschainresult-isforothernet": "Whether or not the address belongs to another registered network than the active one",
+
+	// UptimeCmd help.
+	"uptime--synopsis": "Returns the number of seconds the server has been running for.",
+	"uptime--result0":  "The number of seconds since the server was started",
 
 	// ValidateAddressCmd help.
 	"validateaddress--synopsis": "Verify an address is valid.",
@@ -557,9 +969,13 @@ var helpDescsEnUS = map[string]string{
 		"The actual checks performed by the checklevel parameter are implementation specific.\n" +
 		"For Prova this is:\n" +
 		"checklevel=0 - Look up each block and ensure it can be loaded from the database.\n" +
-		"checklevel=1 - Perform basic context-free sanity checks on each block.",
+		"checklevel=1 - Perform basic context-free sanity checks on each block and ensure the blocks link to each other.\n" +
+		"checklevel=2 - Disconnect each block from a throwaway utxo view using its spend journal entry.\n" +
+		"checklevel=3 - Reconnect the blocks while checking the transaction inputs and outputs and ensure the result matches the chain state.\n" +
+		"checklevel=4 - Additionally run the transaction scripts of each block.\n" +
+		"Block processing is paused while the verification runs.",
 	"verifychain-checklevel": "How thorough the block verification is",
-	"verifychain-checkdepth": "The number of blocks to check",
+	"verifychain-checkdepth": "The number of blocks to check (0 = all)",
 	"verifychain--result0":   "Whether or not the chain verified",
 
 	// VerifyMessageCmd help.
@@ -569,6 +985,12 @@ var helpDescsEnUS = map[string]string{
 	"verifymessage-message":   "The signed message",
 	"verifymessage--result0":  "Whether or not the signature verified",
 
+	// VerifyTxOutProofCmd help.
+	"verifytxoutproof--synopsis": "Verifies a proof created by gettxoutproof and returns the hashes of the transactions it proves.\n" +
+		"The proof is rejected when it is malformed or its block is not in the main chain.",
+	"verifytxoutproof-proof":    "The hex-encoded proof as returned by gettxoutproof",
+	"verifytxoutproof--result0": "The hashes of the proven transactions",
+
 	// -------- Websocket-specific help --------
 
 	// Session help.
@@ -576,13 +998,25 @@ var helpDescsEnUS = map[string]string{
 	"sessionresult-sessionid": "The unique session ID for a client's websocket connection.",
 
 	// NotifyBlocksCmd help.
-	"notifyblocks--synopsis": "Request notifications for whenever a block is connected or disconnected from the main (best) chain.",
+	"notifyblocks--synopsis": "Request notifications for whenever a block is connected or disconnected from the main (best) chain and whenever the main chain is reorganized.",
 
 	// StopNotifyBlocksCmd help.
 	"stopnotifyblocks--synopsis": "Cancel registered notifications for whenever a block is connected or disconnected from the main (best) chain.",
 
+	// NotifyValidatorSetCmd help.
+	"notifyvalidatorset--synopsis": "Send a validatorsetchanged notification for each validate key added or revoked by a block connected to or disconnected from the main (best) chain.",
+
+	// StopNotifyValidatorSetCmd help.
+	"stopnotifyvalidatorset--synopsis": "Cancel registered notifications for validate keys added or revoked by blocks connected to or disconnected from the main (best) chain.",
+
+	// NotifyAdminThreadsCmd help.
+	"notifyadminthreads--synopsis": "Send an adminthreadtip notification for each admin transaction of a block connected to or disconnected from the main (best) chain.",
+
+	// StopNotifyAdminThreadsCmd help.
+	"stopnotifyadminthreads--synopsis": "Cancel registered notifications for admin transactions of blocks connected to or disconnected from the main (best) chain.",
+
 	// NotifyNewTransactionsCmd help.
-	"notifynewtransactions--synopsis": "Send either a txaccepted or a txacceptedverbose notification when a new transaction is accepted into the mempool.",
+	"notifynewtransactions--synopsis": "Send either a txaccepted or a txacceptedverbose notification when a new transaction is accepted into the mempool, and a reorgtx notification for each transaction of the blocks disconnected by a reorganization which is added back to the mempool or conflicts with the new main chain.",
 	"notifynewtransactions-verbose":   "Specifies which type of notification to receive. If verbose is true, then the caller receives txacceptedverbose, otherwise the caller receives txaccepted",
 
 	// StopNotifyNewTransactionsCmd help.
@@ -640,48 +1074,76 @@ var helpDescsEnUS = map[string]string{
 // pointer to the type (or nil to indicate no return value).
 var rpcResultTypes = map[string][]interface{}{
 	"addnode":               nil,
-	"createrawtransaction":  {(*string)(nil)},
+	"clearbanned":           nil,
+	"compactdb":             {(*btcjson.CompactDBResult)(nil)},
+	"createrawtransaction":  {(*string)(nil), (*btcjson.CreateRawTransactionResult)(nil)},
 	"debuglevel":            {(*string)(nil), (*string)(nil)},
 	"decoderawtransaction":  {(*btcjson.TxRawDecodeResult)(nil)},
 	"decodescript":          {(*btcjson.DecodeScriptResult)(nil)},
+	"estimatefee":           {(*float64)(nil)},
+	"estimatesmartfee":      {(*btcjson.EstimateSmartFeeResult)(nil)},
+	"fundrawtransaction":    {(*btcjson.FundRawTransactionResult)(nil)},
 	"generate":              {(*[]string)(nil)},
+	"generateblock":         {(*btcjson.GenerateBlockResult)(nil)},
+	"generatetoaddress":     {(*[]string)(nil)},
 	"getaddednodeinfo":      {(*[]string)(nil), (*[]btcjson.GetAddedNodeInfoResult)(nil)},
 	"getaddresstxids":       {(*[]string)(nil)},
 	"getadmininfo":          {(*btcjson.GetAdminInfoResult)(nil)},
 	"getbestblock":          {(*btcjson.GetBestBlockResult)(nil)},
 	"getbestblockhash":      {(*string)(nil)},
-	"getblock":              {(*string)(nil), (*btcjson.GetBlockVerboseResult)(nil)},
+	"getblock":              {(*string)(nil), (*btcjson.GetBlockVerboseResult)(nil), (*btcjson.GetBlockVerboseTxResult)(nil)},
+	"getblockchaininfo":     {(*btcjson.GetBlockChainInfoResult)(nil)},
 	"getblockcount":         {(*int64)(nil)},
 	"getblockhash":          {(*string)(nil)},
 	"getblockheader":        {(*string)(nil), (*btcjson.GetBlockHeaderVerboseResult)(nil)},
+	"getblockstats":         {(*btcjson.GetBlockStatsResult)(nil)},
 	"getblocktemplate":      {(*btcjson.GetBlockTemplateResult)(nil), (*string)(nil), nil},
+	"getchaintips":          {(*[]btcjson.GetChainTipsResult)(nil)},
 	"getconnectioncount":    {(*int32)(nil)},
 	"getcurrentnet":         {(*uint32)(nil)},
+	"getdbstats":            {(*btcjson.GetDBStatsResult)(nil)},
 	"getdifficulty":         {(*float64)(nil)},
+	"getfinalizedheight":    {(*btcjson.GetFinalizedHeightResult)(nil)},
 	"getgenerate":           {(*bool)(nil)},
 	"gethashespersec":       {(*float64)(nil)},
 	"getheaders":            {(*[]string)(nil)},
 	"getinfo":               {(*btcjson.InfoChainResult)(nil)},
+	"getmemoryinfo":         {(*btcjson.GetMemoryInfoResult)(nil)},
+	"getmempoolentry":       {(*btcjson.GetMempoolEntryResult)(nil)},
 	"getmempoolinfo":        {(*btcjson.GetMempoolInfoResult)(nil)},
+	"getmetrics":            {(*[]btcjson.GetMetricsResult)(nil)},
 	"getmininginfo":         {(*btcjson.GetMiningInfoResult)(nil)},
 	"getnettotals":          {(*btcjson.GetNetTotalsResult)(nil)},
 	"getnetworkhashps":      {(*int64)(nil)},
 	"getpeerinfo":           {(*[]btcjson.GetPeerInfoResult)(nil)},
+	"getpendingbroadcasts":  {(*[]btcjson.GetPendingBroadcastsResult)(nil)},
 	"getrawmempool":         {(*[]string)(nil), (*btcjson.GetRawMempoolVerboseResult)(nil)},
 	"getrawtransaction":     {(*string)(nil), (*btcjson.TxRawResult)(nil)},
+	"getrpcinfo":            {(*btcjson.GetRPCInfoResult)(nil)},
 	"gettxout":              {(*btcjson.GetTxOutResult)(nil)},
+	"gettxoutproof":         {(*string)(nil)},
+	"gettxoutsetinfo":       {(*btcjson.GetTxOutSetInfoResult)(nil)},
+	"getvalidatorinfo":      {(*btcjson.GetValidatorInfoResult)(nil)},
 	"node":                  nil,
 	"help":                  {(*string)(nil), (*string)(nil)},
+	"invalidateblock":       nil,
+	"listbanned":            {(*[]btcjson.ListBannedResult)(nil)},
 	"ping":                  nil,
+	"prioritisetransaction": {(*bool)(nil)},
+	"provisionvalidator":    {(*btcjson.ValidatorAdminResult)(nil)},
+	"revokevalidator":       {(*btcjson.ValidatorAdminResult)(nil)},
 	"searchrawtransactions": {(*string)(nil), (*[]btcjson.SearchRawTransactionsResult)(nil)},
 	"sendrawtransaction":    {(*string)(nil)},
+	"setban":                nil,
 	"setgenerate":           nil,
 	"setvalidatekeys":       nil,
 	"stop":                  {(*string)(nil)},
 	"submitblock":           {nil, (*string)(nil)},
+	"uptime":                {(*int64)(nil)},
 	"validateaddress":       {(*btcjson.ValidateAddressChainResult)(nil)},
 	"verifychain":           {(*bool)(nil)},
 	"verifymessage":         {(*bool)(nil)},
+	"verifytxoutproof":      {(*[]string)(nil)},
 
 	// Websocket commands.
 	"loadtxfilter":              nil,
@@ -694,6 +1156,10 @@ var rpcResultTypes = map[string][]interface{}{
 	"stopnotifyreceived":        nil,
 	"notifyspent":               nil,
 	"stopnotifyspent":           nil,
+	"notifyvalidatorset":        nil,
+	"stopnotifyvalidatorset":    nil,
+	"notifyadminthreads":        nil,
+	"stopnotifyadminthreads":    nil,
 	"rescan":                    nil,
 	"rescanblocks":              {(*[]btcjson.RescannedBlock)(nil)},
 }
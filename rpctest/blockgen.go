@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/btcec"
 	"github.com/bitgo/prova/chaincfg"
 	"github.com/bitgo/prova/chaincfg/chainhash"
 	"github.com/bitgo/prova/provautil"
@@ -81,14 +82,16 @@ func solveBlock(header *wire.BlockHeader, targetDifficulty *big.Int) bool {
 // standardCoinbaseScript returns a standard script suitable for use as the
 // signature script of the coinbase transaction of a new block. In particular,
 // it starts with the block height that is required by version 2 blocks.
-func standardCoinbaseScript(nextBlockHeight int32) ([]byte, error) {
+func standardCoinbaseScript(nextBlockHeight uint32) ([]byte, error) {
 	return txscript.NewScriptBuilder().AddInt64(int64(nextBlockHeight)).Script()
 }
 
 // createCoinbaseTx returns a coinbase transaction paying an appropriate
-// subsidy based on the passed block height to the provided address.
-func createCoinbaseTx(coinbaseScript []byte, nextBlockHeight int32,
-	addr provautil.Address, net *chaincfg.Params) (*provautil.Tx, error) {
+// subsidy based on the passed block height, plus the passed fees of the
+// transactions of the block, to the provided address.
+func createCoinbaseTx(coinbaseScript []byte, nextBlockHeight uint32,
+	fees int64, addr provautil.Address,
+	net *chaincfg.Params) (*provautil.Tx, error) {
 
 	// Create the script to pay to the provided payment address.
 	pkScript, err := txscript.PayToAddrScript(addr)
@@ -106,23 +109,31 @@ func createCoinbaseTx(coinbaseScript []byte, nextBlockHeight int32,
 		Sequence:        wire.MaxTxInSequenceNum,
 	})
 	tx.AddTxOut(&wire.TxOut{
-		Value:    blockchain.CalcBlockSubsidy(nextBlockHeight, net),
+		Value:    blockchain.CalcBlockSubsidy(nextBlockHeight, net) + fees,
 		PkScript: pkScript,
 	})
+
+	// The signature script is not part of the transaction hash, so the
+	// height is also used as the lock time to make the hash unique.
+	tx.LockTime = nextBlockHeight
 	return provautil.NewTx(tx), nil
 }
 
-// createBlock creates a new block building from the previous block.
+// createBlock creates a new block building from the previous block.  The block
+// is signed with the passed validate key and solved for the passed difficulty,
+// which must be the one required by the block after the previous block.  The
+// coinbase collects the passed fees, which must be the total fees paid by the
+// included transactions.
 func createBlock(prevBlock *provautil.Block, inclusionTxs []*provautil.Tx,
-	blockVersion int32, blockTime time.Time,
-	miningAddr provautil.Address, net *chaincfg.Params) (*provautil.Block, error) {
+	fees int64, blockVersion int32, blockTime time.Time, bits uint32,
+	validateKey *btcec.PrivateKey, miningAddr provautil.Address,
+	net *chaincfg.Params) (*provautil.Block, error) {
 
 	prevHash := prevBlock.Hash()
-	blockHeight := prevBlock.Height() + 1
+	blockHeight := prevBlock.MsgBlock().Header.Height + 1
 
 	// If a target block time was specified, then use that as the header's
-	// timestamp. Otherwise, add one second to the previous block unless
-	// it's the genesis block in which case use the current time.
+	// timestamp. Otherwise, add one second to the previous block.
 	var ts time.Time
 	switch {
 	case !blockTime.IsZero():
@@ -135,13 +146,13 @@ func createBlock(prevBlock *provautil.Block, inclusionTxs []*provautil.Tx,
 	if err != nil {
 		return nil, err
 	}
-	coinbaseTx, err := createCoinbaseTx(coinbaseScript, blockHeight,
+	coinbaseTx, err := createCoinbaseTx(coinbaseScript, blockHeight, fees,
 		miningAddr, net)
 	if err != nil {
 		return nil, err
 	}
 
-	// Create a new block ready to be solved.
+	// Create a new block ready to be signed and solved.
 	blockTxns := []*provautil.Tx{coinbaseTx}
 	if inclusionTxs != nil {
 		blockTxns = append(blockTxns, inclusionTxs...)
@@ -149,11 +160,11 @@ func createBlock(prevBlock *provautil.Block, inclusionTxs []*provautil.Tx,
 	merkles := blockchain.BuildMerkleTreeStore(blockTxns)
 	var block wire.MsgBlock
 	block.Header = wire.BlockHeader{
-		Version:    blockVersion,
+		Version:    uint32(blockVersion),
 		PrevBlock:  *prevHash,
 		MerkleRoot: *merkles[len(merkles)-1],
 		Timestamp:  ts,
-		Bits:       net.PowLimitBits,
+		Bits:       bits,
 		Height:     blockHeight,
 	}
 	for _, tx := range blockTxns {
@@ -161,9 +172,12 @@ func createBlock(prevBlock *provautil.Block, inclusionTxs []*provautil.Tx,
 			return nil, err
 		}
 	}
-	block.Header.Size = block.SerializeSize()
+	block.Header.Size = uint32(block.SerializeSize())
+	if err := block.Header.Sign(validateKey); err != nil {
+		return nil, err
+	}
 
-	found := solveBlock(&block.Header, net.PowLimit)
+	found := solveBlock(&block.Header, blockchain.CompactToBig(bits))
 	if !found {
 		return nil, errors.New("Unable to solve block")
 	}
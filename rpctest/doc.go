@@ -1,12 +1,18 @@
-// Package rpctest provides a btcd-specific RPC testing harness crafting and
-// executing integration tests by driving a `btcd` instance via the `RPC`
+// Package rpctest provides a prova-specific RPC testing harness crafting and
+// executing integration tests by driving a `prova` instance via the `RPC`
 // interface. Each instance of an active harness comes equipped with a simple
-// in-memory HD wallet capable of properly syncing to the generated chain,
+// in-memory wallet capable of properly syncing to the generated chain,
 // creating new addresses, and crafting fully signed transactions paying to an
 // arbitrary set of outputs.
 //
+// Harnesses are created with NewHarness, typically for the regression test
+// network whose admin keys are known to the harness, so blocks can be
+// generated and the wallet funded with outputs of the issue thread.  Each
+// harness runs its node in its own temporary directory and on its own ports,
+// so tests using several harnesses, or running in parallel, don't collide.
+//
 // This package was designed specifically to act as an RPC testing harness for
-// `btcd`. However, the constructs presented are general enough to be adapted to
-// any project wishing to programmatically drive a `btcd` instance of its
+// `prova`. However, the constructs presented are general enough to be adapted
+// to any project wishing to programmatically drive a `prova` instance of its
 // systems/integration tests.
 package rpctest
@@ -0,0 +1,67 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package rpctest
+
+import (
+	"encoding/hex"
+
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/wire"
+)
+
+// netKeys houses the private keys of the initial admin and ASP keys of a
+// network which are known to the harness.  Blocks are signed with the validate
+// keys, new coins are issued with the issue keys and the outputs of the wallet
+// are cosigned with the ASP keys.
+type netKeys struct {
+	validateKeys []*btcec.PrivateKey
+	issueKeys    []*btcec.PrivateKey
+	aspKeys      map[btcec.KeyID]*btcec.PrivateKey
+}
+
+// privKeyFromHex returns the private key of the passed hex-encoded scalar.  It
+// panics on invalid input since it is only used for the hard-coded keys below.
+func privKeyFromHex(s string) *btcec.PrivateKey {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	privKey, _ := btcec.PrivKeyFromBytes(btcec.S256(), b)
+	return privKey
+}
+
+// regNetKeys are the private keys of the initial admin and ASP keys of the
+// regression test network whose private keys are published along with its
+// parameters.
+var regNetKeys = &netKeys{
+	validateKeys: []*btcec.PrivateKey{
+		privKeyFromHex("d36c82406d3c77ebc342aaa16f24a985fbfe63c75e6fd2afeffa1ba69632d252"),
+		privKeyFromHex("05fa7a36092cc7accc8008365fd8d07229c794be2a4e9361c662b5cae9492fa3"),
+		privKeyFromHex("a3262a6f506e4bfd4bc5b0708b2162e755410c8670e38c53928eb093ece2d37e"),
+		privKeyFromHex("041bf76c17185bcddbbb5d40122d04528fbe6c68f488c16a4e85711410134b5e"),
+		privKeyFromHex("224688827325203eb53d0ec0f044b72312c8e11fc4fdada7b91416e7b54939d5"),
+		privKeyFromHex("c37e338bebe77d1ca77438ad7a382dc97c28703d793c732d88348eb5f26f9732"),
+		privKeyFromHex("6d4a926fec187ee0a0b0395cadb39360687b8416809c21ab32490e944784d6a3"),
+	},
+	issueKeys: []*btcec.PrivateKey{
+		privKeyFromHex("3f9222ab4d30b1795941d9815e5833a4da70cb04bff59a5fd2ddc4641e58607e"),
+		privKeyFromHex("0a40defde0e49e1f78edb9cea5c499f704fabc140d6fd1a4df8405365e2e4f0f"),
+	},
+	aspKeys: map[btcec.KeyID]*btcec.PrivateKey{
+		1: privKeyFromHex("eaf02ca348c524e6392655ba4d29603cd1a7347d9d65cfe93ce1ebffdca22694"),
+		2: privKeyFromHex("2b8c52b77b327c755b9b375500d3f4b2da9b0a1ff65f6891d311fe94295bc26a"),
+	},
+}
+
+// knownNetKeys returns the private keys of the initial admin and ASP keys of
+// the passed network which are known to the harness.  An empty set is returned
+// for networks whose private keys are not published.
+func knownNetKeys(params *chaincfg.Params) *netKeys {
+	if params.Net == wire.RegNet {
+		return regNetKeys
+	}
+	return &netKeys{}
+}
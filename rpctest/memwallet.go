@@ -8,7 +8,9 @@ package rpctest
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"sort"
 	"sync"
 
 	"github.com/bitgo/prova/blockchain"
@@ -16,15 +18,13 @@ import (
 	"github.com/bitgo/prova/chaincfg"
 	"github.com/bitgo/prova/chaincfg/chainhash"
 	"github.com/bitgo/prova/provautil"
-	"github.com/bitgo/prova/provautil/hdkeychain"
 	"github.com/bitgo/prova/txscript"
 	"github.com/bitgo/prova/wire"
-	"github.com/btcsuite/btcrpcclient"
 )
 
 var (
-	// hdSeed is the BIP 32 seed used by the memWallet to initialize it's
-	// HD root key. This value is hard coded in order to ensure
+	// hdSeed is the seed used by the memWallet to derive its
+	// keys. This value is hard coded in order to ensure
 	// deterministic behavior across test runs.
 	hdSeed = [chainhash.HashSize]byte{
 		0x79, 0xa6, 0x1a, 0xdb, 0xc6, 0xe5, 0xa2, 0xe1,
@@ -51,41 +51,44 @@ func (u *utxo) isMature(height int32) bool {
 	return height >= u.maturityHeight
 }
 
-// chainUpdate encapsulates an update to the current main chain. This struct is
-// used to sync up the memWallet each time a new block is connected to the main
-// chain.
-type chainUpdate struct {
-	blockHeight  int32
-	filteredTxns []*btcutil.Tx
-}
-
-// undoEntry is functionally the opposite of a chainUpdate. An undoEntry is
-// created for each new block received, then stored in a log in order to
-// properly handle block re-orgs.
+// undoEntry is created for each new block ingested by the wallet, then stored
+// in a log in order to properly handle block re-orgs.
 type undoEntry struct {
+	blockHash      chainhash.Hash
 	utxosDestroyed map[wire.OutPoint]*utxo
 	utxosCreated   []wire.OutPoint
 }
 
 // memWallet is a simple in-memory wallet whose purpose is to provide basic
-// wallet functionality to the harness. The wallet uses a hard-coded HD key
-// hierarchy which promotes reproducibility between harness test runs.
+// wallet functionality to the harness. The wallet derives its keys from a
+// hard-coded seed which promotes reproducibility between harness test runs.
+//
+// The outputs of the wallet pay to Prova addresses which are cosigned by one
+// of the ASP keys known to the harness.  The wallet syncs to the main chain of
+// the node by polling it whenever its state is accessed, so it never lags
+// behind blocks generated or submitted before the access.
 type memWallet struct {
 	coinbaseKey  *btcec.PrivateKey
 	coinbaseAddr provautil.Address
 
-	// hdRoot is the root master private key for the wallet.
-	hdRoot *hdkeychain.ExtendedKey
+	// seed is the seed all keys of the wallet are derived from.
+	seed []byte
 
-	// hdIndex is the next available key index offset from the hdRoot.
-	hdIndex uint32
+	// keyIndex is the index of the next key to derive from the seed.
+	keyIndex uint32
+
+	// keyIDs are the ids of the ASP keys the addresses of the wallet are
+	// cosigned by, and aspKey is the private key of the first one which
+	// is used to cosign the transactions of the wallet.
+	keyIDs []btcec.KeyID
+	aspKey *btcec.PrivateKey
 
 	// currentHeight is the latest height the wallet is known to be synced
 	// to.
 	currentHeight int32
 
 	// addrs tracks all addresses belonging to the wallet. The addresses
-	// are indexed by their keypath from the hdRoot.
+	// are indexed by the index of their key.
 	addrs map[uint32]provautil.Address
 
 	// utxos is the set of utxos spendable by the wallet.
@@ -97,141 +100,154 @@ type memWallet struct {
 	// disconnected block on the wallet's set of spendable utxos.
 	reorgJournal map[int32]*undoEntry
 
-	chainUpdates      []*chainUpdate
-	chainUpdateSignal chan struct{}
-	chainMtx          sync.Mutex
-
 	net *chaincfg.Params
 
-	rpc *btcrpcclient.Client
+	rpc *Client
 
-	sync.RWMutex
+	sync.Mutex
 }
 
 // newMemWallet creates and returns a fully initialized instance of the
-// memWallet given a particular blockchain's parameters.
-func newMemWallet(net *chaincfg.Params, harnessID uint32) (*memWallet, error) {
-	// The wallet's final HD seed is: hdSeed || harnessID. This method
-	// ensures that each harness instance uses a deterministic root seed
-	// based on its harness ID.
-	var harnessHDSeed [chainhash.HashSize + 4]byte
-	copy(harnessHDSeed[:], hdSeed[:])
-	binary.BigEndian.PutUint32(harnessHDSeed[:chainhash.HashSize], harnessID)
-
-	hdRoot, err := hdkeychain.NewMaster(harnessHDSeed[:], net)
-	if err != nil {
-		return nil, nil
+// memWallet given a particular blockchain's parameters and the ASP keys known
+// for it.
+func newMemWallet(net *chaincfg.Params, harnessID uint32,
+	aspKeys map[btcec.KeyID]*btcec.PrivateKey) (*memWallet, error) {
+
+	// The wallet's final seed is: hdSeed || harnessID. This method
+	// ensures that each harness instance uses a deterministic seed based
+	// on its harness ID.
+	harnessSeed := make([]byte, chainhash.HashSize+4)
+	copy(harnessSeed, hdSeed[:])
+	binary.BigEndian.PutUint32(harnessSeed[chainhash.HashSize:], harnessID)
+
+	// The addresses of the wallet are cosigned by the two known ASP keys
+	// with the lowest ids.  Its outputs can't be spent on networks with
+	// fewer known ASP keys, but the ids are still needed for addresses.
+	keyIDs := make([]btcec.KeyID, 0, len(aspKeys))
+	for keyID := range aspKeys {
+		keyIDs = append(keyIDs, keyID)
+	}
+	sort.Slice(keyIDs, func(i, j int) bool { return keyIDs[i] < keyIDs[j] })
+	var aspKey *btcec.PrivateKey
+	if len(keyIDs) >= 2 {
+		keyIDs = keyIDs[:2]
+		aspKey = aspKeys[keyIDs[0]]
+	} else {
+		keyIDs = []btcec.KeyID{1, 2}
 	}
 
-	// The first child key from the hd root is reserved as the coinbase
+	// The first key derived from the seed is reserved as the coinbase
 	// generation address.
-	coinbaseChild, err := hdRoot.Child(0)
-	if err != nil {
-		return nil, err
-	}
-	coinbaseKey, err := coinbaseChild.ECPrivKey()
-	if err != nil {
-		return nil, err
-	}
-	coinbaseAddr, err := keyToAddr(coinbaseKey, net)
+	coinbaseKey := deriveKey(harnessSeed, 0)
+	coinbaseAddr, err := keyToAddr(coinbaseKey, keyIDs, net)
 	if err != nil {
 		return nil, err
 	}
 
 	// Track the coinbase generation address to ensure we properly track
-	// newly generated bitcoin we can spend.
+	// newly generated coins we can spend.
 	addrs := make(map[uint32]provautil.Address)
 	addrs[0] = coinbaseAddr
 
 	return &memWallet{
-		net:               net,
-		coinbaseKey:       coinbaseKey,
-		coinbaseAddr:      coinbaseAddr,
-		hdIndex:           1,
-		hdRoot:            hdRoot,
-		addrs:             addrs,
-		utxos:             make(map[wire.OutPoint]*utxo),
-		chainUpdateSignal: make(chan struct{}),
-		reorgJournal:      make(map[int32]*undoEntry),
+		net:          net,
+		coinbaseKey:  coinbaseKey,
+		coinbaseAddr: coinbaseAddr,
+		keyIndex:     1,
+		seed:         harnessSeed,
+		keyIDs:       keyIDs,
+		aspKey:       aspKey,
+		addrs:        addrs,
+		utxos:        make(map[wire.OutPoint]*utxo),
+		reorgJournal: make(map[int32]*undoEntry),
 	}, nil
 }
 
-// Start launches all goroutines required for the wallet to function properly.
-func (m *memWallet) Start() {
-	go m.chainSyncer()
-}
-
 // SyncedHeight returns the height the wallet is known to be synced to.
 //
 // This function is safe for concurrent access.
 func (m *memWallet) SyncedHeight() int32 {
-	m.RLock()
-	defer m.RUnlock()
+	m.Lock()
+	defer m.Unlock()
 	return m.currentHeight
 }
 
-// SetRPCClient saves the passed rpc connection to btcd as the wallet's
+// SetRPCClient saves the passed rpc connection to prova as the wallet's
 // personal rpc connection.
-func (m *memWallet) SetRPCClient(rpcClient *btcrpcclient.Client) {
+func (m *memWallet) SetRPCClient(rpcClient *Client) {
 	m.rpc = rpcClient
 }
 
-// IngestBlock is a call-back which is to be triggered each time a new block is
-// connected to the main chain. Ingesting a block updates the wallet's internal
-// utxo state based on the outputs created and destroyed within each block.
-func (m *memWallet) IngestBlock(height int32, header *wire.BlockHeader, filteredTxns []*btcutil.Tx) {
-	// Append this new chain update to the end of the queue of new chain
-	// updates.
-	m.chainMtx.Lock()
-	m.chainUpdates = append(m.chainUpdates, &chainUpdate{height, filteredTxns})
-	m.chainMtx.Unlock()
-
-	// Launch a goroutine to signal the chainSyncer that a new update is
-	// available. We do this in a new goroutine in order to avoid blocking
-	// the main loop of the rpc client.
-	go func() {
-		m.chainUpdateSignal <- struct{}{}
-	}()
+// Sync brings the wallet up to date with the main chain of the node.
+//
+// This function is safe for concurrent access.
+func (m *memWallet) Sync() error {
+	m.Lock()
+	defer m.Unlock()
+	return m.sync()
 }
 
-// chainSyncer is a goroutine dedicated to processing new blocks in order to
-// keep the wallet's utxo state up to date.
+// sync unwinds the blocks the wallet ingested which are no longer part of the
+// main chain of the node, then ingests the blocks of the main chain it did not
+// ingest yet.
 //
-// NOTE: This MUST be run as a goroutine.
-func (m *memWallet) chainSyncer() {
-	var update *chainUpdate
-
-	for range m.chainUpdateSignal {
-		// A new update is available, so pop the new chain update from
-		// the front of the update queue.
-		m.chainMtx.Lock()
-		update = m.chainUpdates[0]
-		m.chainUpdates[0] = nil // Set to nil to prevent GC leak.
-		m.chainUpdates = m.chainUpdates[1:]
-		m.chainMtx.Unlock()
-
-		// Update the latest synced height, then process each filtered
-		// transaction in the block creating and destroying utxos within
-		// the wallet as a result.
-		m.Lock()
-		m.currentHeight = update.blockHeight
-		undo := &undoEntry{
-			utxosDestroyed: make(map[wire.OutPoint]*utxo),
+// NOTE: The memWallet's mutex must be held when this function is called.
+func (m *memWallet) sync() error {
+	_, bestHeight, err := m.rpc.GetBestBlock()
+	if err != nil {
+		return err
+	}
+	for m.currentHeight > 0 {
+		if m.currentHeight <= int32(bestHeight) {
+			hash, err := m.rpc.GetBlockHash(int64(m.currentHeight))
+			if err != nil {
+				return err
+			}
+			if *hash == m.reorgJournal[m.currentHeight].blockHash {
+				break
+			}
 		}
-		for _, tx := range update.filteredTxns {
-			mtx := tx.MsgTx()
-			isCoinbase := blockchain.IsCoinBaseTx(mtx)
-			txHash := mtx.TxHash()
-			m.evalOutputs(mtx.TxOut, &txHash, isCoinbase, undo)
-			m.evalInputs(mtx.TxIn, undo)
+		m.unwindBlock(m.currentHeight)
+	}
+	for m.currentHeight < int32(bestHeight) {
+		hash, err := m.rpc.GetBlockHash(int64(m.currentHeight + 1))
+		if err != nil {
+			return err
+		}
+		block, err := m.rpc.GetBlock(hash)
+		if err != nil {
+			return err
 		}
+		m.ingestBlock(block)
+	}
+	return nil
+}
 
-		// Finally, record the undo entry for this block so we can
-		// properly update our internal state in response to the block
-		// being re-org'd from the main chain.
-		m.reorgJournal[update.blockHeight] = undo
-		m.Unlock()
+// ingestBlock updates the wallet's internal utxo state based on the outputs
+// created and destroyed within the passed block, which must connect to the
+// block the wallet is synced to.
+//
+// NOTE: The memWallet's mutex must be held when this function is called.
+func (m *memWallet) ingestBlock(block *wire.MsgBlock) {
+	// Update the latest synced height, then process each transaction in
+	// the block creating and destroying utxos within the wallet as a
+	// result.
+	m.currentHeight = int32(block.Header.Height)
+	undo := &undoEntry{
+		blockHash:      block.BlockHash(),
+		utxosDestroyed: make(map[wire.OutPoint]*utxo),
 	}
+	for _, mtx := range block.Transactions {
+		isCoinbase := blockchain.IsCoinBaseTx(mtx)
+		txHash := mtx.TxHash()
+		m.evalOutputs(mtx.TxOut, &txHash, isCoinbase, undo)
+		m.evalInputs(mtx.TxIn, undo)
+	}
+
+	// Finally, record the undo entry for this block so we can properly
+	// update our internal state in response to the block being re-org'd
+	// from the main chain.
+	m.reorgJournal[m.currentHeight] = undo
 }
 
 // evalOutputs evaluates each of the passed outputs, creating a new matching
@@ -285,13 +301,12 @@ func (m *memWallet) evalInputs(inputs []*wire.TxIn, undo *undoEntry) {
 	}
 }
 
-// UnwindBlock is a call-back which is to be executed each time a block is
-// disconnected from the main chain. Unwinding a block undoes the effect that a
-// particular block had on the wallet's internal utxo state.
-func (m *memWallet) UnwindBlock(height int32, header *wire.BlockHeader) {
-	m.Lock()
-	defer m.Unlock()
-
+// unwindBlock undoes the effect that the block at the passed height, which
+// must be the block the wallet is synced to, had on the wallet's internal utxo
+// state.
+//
+// NOTE: The memWallet's mutex must be held when this function is called.
+func (m *memWallet) unwindBlock(height int32) {
 	undo := m.reorgJournal[height]
 
 	for _, utxo := range undo.utxosCreated {
@@ -303,36 +318,35 @@ func (m *memWallet) UnwindBlock(height int32, header *wire.BlockHeader) {
 	}
 
 	delete(m.reorgJournal, height)
+	m.currentHeight = height - 1
 }
 
-// newAddress returns a new address from the wallet's hd key chain.  It also
-// loads the address into the RPC client's transaction filter to ensure any
-// transactions that involve it are delivered via the notifications.
-func (m *memWallet) newAddress() (provautil.Address, error) {
-	index := m.hdIndex
-
-	childKey, err := m.hdRoot.Child(index)
-	if err != nil {
-		return nil, err
-	}
-	privKey, err := childKey.ECPrivKey()
-	if err != nil {
-		return nil, err
-	}
+// deriveKey returns the private key with the passed index derived from the
+// passed seed, which is the double sha256 of the seed and the index.
+func deriveKey(seed []byte, index uint32) *btcec.PrivateKey {
+	var indexBytes [4]byte
+	binary.BigEndian.PutUint32(indexBytes[:], index)
+	keyBytes := chainhash.DoubleHashB(append(append([]byte(nil), seed...),
+		indexBytes[:]...))
+	privKey, _ := btcec.PrivKeyFromBytes(btcec.S256(), keyBytes)
+	return privKey
+}
 
-	addr, err := keyToAddr(privKey, m.net)
-	if err != nil {
-		return nil, err
-	}
+// newAddress returns a new address derived from the wallet's seed.
+//
+// NOTE: The memWallet's mutex must be held when this function is called.
+func (m *memWallet) newAddress() (provautil.Address, error) {
+	index := m.keyIndex
 
-	err = m.rpc.LoadTxFilter(false, []btcutil.Address{addr}, nil)
+	privKey := deriveKey(m.seed, index)
+	addr, err := keyToAddr(privKey, m.keyIDs, m.net)
 	if err != nil {
 		return nil, err
 	}
 
 	m.addrs[index] = addr
 
-	m.hdIndex++
+	m.keyIndex++
 
 	return addr, nil
 }
@@ -347,7 +361,7 @@ func (m *memWallet) NewAddress() (provautil.Address, error) {
 	return m.newAddress()
 }
 
-// fundTx attempts to fund a transaction sending amt bitcoin. The coins are
+// fundTx attempts to fund a transaction sending amt coins. The coins are
 // selected such that the final amount spent pays enough fees as dictated by
 // the passed fee rate. The passed fee rate should be expressed in
 // atoms-per-byte.
@@ -356,8 +370,10 @@ func (m *memWallet) NewAddress() (provautil.Address, error) {
 func (m *memWallet) fundTx(tx *wire.MsgTx, amt provautil.Amount, feeRate provautil.Amount) error {
 	const (
 		// spendSize is the largest number of bytes of a sigScript
-		// which spends a p2pkh output: OP_DATA_73 <sig> OP_DATA_33 <pubkey>
-		spendSize = 1 + 73 + 1 + 33
+		// which spends a Prova output, which holds the signature
+		// and public key of the owner and of the cosigning ASP key:
+		// 2 * (OP_DATA_73 <sig> OP_DATA_33 <pubkey>)
+		spendSize = 2 * (1 + 73 + 1 + 33)
 	)
 
 	var (
@@ -377,6 +393,7 @@ func (m *memWallet) fundTx(tx *wire.MsgTx, amt provautil.Amount, feeRate provaut
 		// Add the selected output to the transaction, updating the
 		// current tx size while accounting for the size of the future
 		// sigScript.
+		outPoint := outPoint
 		tx.AddTxIn(wire.NewTxIn(&outPoint, nil))
 		txSize = tx.SerializeSize() + spendSize*len(tx.TxIn)
 
@@ -439,6 +456,14 @@ func (m *memWallet) CreateTransaction(outputs []*wire.TxOut, feeRate provautil.A
 	m.Lock()
 	defer m.Unlock()
 
+	if m.aspKey == nil {
+		return nil, errors.New("no ASP keys are known for network " +
+			m.net.Name)
+	}
+	if err := m.sync(); err != nil {
+		return nil, err
+	}
+
 	tx := wire.NewMsgTx(wire.TxVersion)
 
 	// Tally up the total amount to be sent in order to perform coin
@@ -458,22 +483,24 @@ func (m *memWallet) CreateTransaction(outputs []*wire.TxOut, feeRate provautil.A
 	// Along the way record all outputs being spent in order to avoid a
 	// potential double spend.
 	spentOutputs := make([]*utxo, 0, len(tx.TxIn))
+	sigHashes := txscript.NewTxSigHashes(tx)
 	for i, txIn := range tx.TxIn {
 		outPoint := txIn.PreviousOutPoint
 		utxo := m.utxos[outPoint]
 
-		extendedKey, err := m.hdRoot.Child(utxo.keyIndex)
-		if err != nil {
-			return nil, err
-		}
+		privKey := deriveKey(m.seed, utxo.keyIndex)
 
-		privKey, err := extendedKey.ECPrivKey()
-		if err != nil {
-			return nil, err
+		// The output is spent with the signatures of its owner and of
+		// the cosigning ASP key.
+		lookupKey := func(provautil.Address) ([]txscript.PrivateKey, error) {
+			return []txscript.PrivateKey{
+				{Key: privKey, Compressed: true},
+				{Key: m.aspKey, Compressed: true},
+			}, nil
 		}
-
-		sigScript, err := txscript.SignatureScript(tx, i, utxo.pkScript,
-			txscript.SigHashAll, privKey, true)
+		sigScript, err := txscript.SignTxOutputWithSigHashes(m.net, tx,
+			i, int64(utxo.value), utxo.pkScript, txscript.SigHashAll,
+			txscript.KeyClosure(lookupKey), nil, sigHashes)
 		if err != nil {
 			return nil, err
 		}
@@ -512,12 +539,16 @@ func (m *memWallet) UnlockOutputs(inputs []*wire.TxIn) {
 	}
 }
 
-// ConfirmedBalance returns the confirmed balance of the wallet.
+// ConfirmedBalance returns the confirmed balance of the wallet.  The balance
+// is the one as of the last successful sync when the wallet fails to sync to
+// the node.
 //
 // This function is safe for concurrent access.
 func (m *memWallet) ConfirmedBalance() provautil.Amount {
-	m.RLock()
-	defer m.RUnlock()
+	m.Lock()
+	defer m.Unlock()
+
+	m.sync()
 
 	var balance provautil.Amount
 	for _, utxo := range m.utxos {
@@ -533,12 +564,10 @@ func (m *memWallet) ConfirmedBalance() provautil.Amount {
 	return balance
 }
 
-// keyToAddr maps the passed private to corresponding p2pkh address.
-func keyToAddr(key *btcec.PrivateKey, net *chaincfg.Params) (provautil.Address, error) {
-	serializedKey := key.PubKey().SerializeCompressed()
-	pubKeyAddr, err := provautil.NewAddressPubKey(serializedKey, net)
-	if err != nil {
-		return nil, err
-	}
-	return pubKeyAddr.AddressPubKeyHash(), nil
+// keyToAddr maps the passed private key to the corresponding Prova address
+// cosigned by the passed ASP keys.
+func keyToAddr(key *btcec.PrivateKey, keyIDs []btcec.KeyID,
+	net *chaincfg.Params) (provautil.Address, error) {
+
+	return provautil.NewAddressProvaFromPubKey(key.PubKey(), keyIDs, net)
 }
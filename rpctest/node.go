@@ -13,17 +13,51 @@ import (
 	"os/exec"
 	"path/filepath"
 	"runtime"
-	"strings"
+	"sync"
 	"time"
 
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/provautil"
 	"github.com/bitgo/prova/wire"
+)
 
-	"github.com/bitgo/prova/provautil"
-	rpc "github.com/btcsuite/btcrpcclient"
+var (
+	// provaExe is the path of the prova executable which was built from
+	// the source tree of the harness, or the error which prevented it from
+	// being built.  It is built once for all harnesses of the process.
+	provaExe     string
+	provaExeErr  error
+	provaExeOnce sync.Once
 )
 
-// nodeConfig contains all the args, and data required to launch a btcd process
-// and connect the rpc client to it.
+// provaExecutablePath returns the path of a prova executable built from the
+// source tree the harness is compiled from, so the tests always exercise the
+// current code rather than whichever prova happens to be installed.
+func provaExecutablePath() (string, error) {
+	provaExeOnce.Do(func() {
+		dir, err := ioutil.TempDir("", "rpctest-exe")
+		if err != nil {
+			provaExeErr = err
+			return
+		}
+		exe := filepath.Join(dir, "prova")
+		if runtime.GOOS == "windows" {
+			exe += ".exe"
+		}
+		cmd := exec.Command("go", "build", "-o", exe,
+			"github.com/bitgo/prova")
+		if output, err := cmd.CombinedOutput(); err != nil {
+			provaExeErr = fmt.Errorf("failed to build prova: %v: %s",
+				err, output)
+			return
+		}
+		provaExe = exe
+	})
+	return provaExe, provaExeErr
+}
+
+// nodeConfig contains all the args, and data required to launch a prova
+// process and connect the rpc client to it.
 type nodeConfig struct {
 	rpcUser    string
 	rpcPass    string
@@ -36,49 +70,51 @@ type nodeConfig struct {
 	debugLevel string
 	extra      []string
 	prefix     string
+	net        wire.BitcoinNet
 
 	exe          string
-	endpoint     string
 	certFile     string
 	keyFile      string
 	certificates []byte
 }
 
-// newConfig returns a newConfig with all default values.
-func newConfig(prefix, certFile, keyFile string, extra []string) (*nodeConfig, error) {
+// newConfig returns a newConfig with all default values.  The data and log
+// directories of the node are created within the passed directory.
+func newConfig(prefix, exe, dir string, params *chaincfg.Params,
+	extra []string) (*nodeConfig, error) {
+
 	a := &nodeConfig{
-		listen:    "127.0.0.1:18555",
-		rpcListen: "127.0.0.1:18556",
-		rpcUser:   "user",
-		rpcPass:   "pass",
-		extra:     extra,
-		prefix:    prefix,
-
-		exe:      "prova",
-		endpoint: "ws",
-		certFile: certFile,
-		keyFile:  keyFile,
-	}
-	if err := a.setDefaults(); err != nil {
+		rpcUser: "user",
+		rpcPass: "pass",
+		extra:   extra,
+		prefix:  prefix,
+		net:     params.Net,
+
+		exe:      exe,
+		certFile: filepath.Join(dir, "rpc.cert"),
+		keyFile:  filepath.Join(dir, "rpc.key"),
+	}
+	if err := a.setDefaults(dir); err != nil {
 		return nil, err
 	}
 	return a, nil
 }
 
-// setDefaults sets the default values of the config. It also creates the
-// temporary data, and log directories which must be cleaned up with a call to
-// cleanup().
-func (n *nodeConfig) setDefaults() error {
-	datadir, err := ioutil.TempDir("", n.prefix+"-data")
-	if err != nil {
+// setDefaults sets the default values of the config.  It creates the data and
+// log directories within the passed directory, along with the certificate and
+// key of the RPC server, all of which are removed along with the directory.
+func (n *nodeConfig) setDefaults(dir string) error {
+	n.dataDir = filepath.Join(dir, "data")
+	if err := os.Mkdir(n.dataDir, 0700); err != nil {
 		return err
 	}
-	n.dataDir = datadir
-	logdir, err := ioutil.TempDir("", n.prefix+"-logs")
-	if err != nil {
+	n.logDir = filepath.Join(dir, "logs")
+	if err := os.Mkdir(n.logDir, 0700); err != nil {
+		return err
+	}
+	if err := genCertPair(n.certFile, n.keyFile); err != nil {
 		return err
 	}
-	n.logDir = logdir
 	cert, err := ioutil.ReadFile(n.certFile)
 	if err != nil {
 		return err
@@ -87,12 +123,21 @@ func (n *nodeConfig) setDefaults() error {
 	return nil
 }
 
-// arguments returns an array of arguments that be used to launch the btcd
+// arguments returns an array of arguments that be used to launch the prova
 // process.
 func (n *nodeConfig) arguments() []string {
 	args := []string{}
-	// --simnet
-	args = append(args, fmt.Sprintf("--%s", strings.ToLower(wire.SimNet.String())))
+	switch n.net {
+	case wire.TestNet:
+		// --testnet
+		args = append(args, "--testnet")
+	case wire.RegNet:
+		// --regtest
+		args = append(args, "--regtest")
+	case wire.SimNet:
+		// --simnet
+		args = append(args, "--simnet")
+	}
 	if n.rpcUser != "" {
 		// --rpcuser
 		args = append(args, fmt.Sprintf("--rpcuser=%s", n.rpcUser))
@@ -121,6 +166,8 @@ func (n *nodeConfig) arguments() []string {
 	args = append(args, "--txindex")
 	// --addrindex
 	args = append(args, "--addrindex")
+	// --sigkeyidindex
+	args = append(args, "--sigkeyidindex")
 	if n.dataDir != "" {
 		// --datadir
 		args = append(args, fmt.Sprintf("--datadir=%s", n.dataDir))
@@ -141,22 +188,15 @@ func (n *nodeConfig) arguments() []string {
 	return args
 }
 
-// command returns the exec.Cmd which will be used to start the btcd process.
+// command returns the exec.Cmd which will be used to start the prova process.
 func (n *nodeConfig) command() *exec.Cmd {
 	return exec.Command(n.exe, n.arguments()...)
 }
 
-// rpcConnConfig returns the rpc connection config that can be used to connect
-// to the btcd process that is launched via Start().
-func (n *nodeConfig) rpcConnConfig() rpc.ConnConfig {
-	return rpc.ConnConfig{
-		Host:                 n.rpcListen,
-		Endpoint:             n.endpoint,
-		User:                 n.rpcUser,
-		Pass:                 n.rpcPass,
-		Certificates:         n.certificates,
-		DisableAutoReconnect: true,
-	}
+// rpcClient returns a new client for the RPC server of the prova process that
+// is launched via start().
+func (n *nodeConfig) rpcClient() *Client {
+	return newClient(n.rpcListen, n.rpcUser, n.rpcPass, n.certificates)
 }
 
 // String returns the string representation of this nodeConfig.
@@ -245,6 +285,25 @@ func (n *node) stop() error {
 	return n.cmd.Process.Signal(os.Interrupt)
 }
 
+// restart interrupts the running prova process and launches a new one with
+// the same configuration once it exited, so the new process starts from the
+// data directory left behind by the previous one.  The regression test
+// database is kept, which is otherwise removed on start up.  An error is
+// returned when the previous process did not exit cleanly, which means its
+// shutdown failed.
+func (n *node) restart() error {
+	if err := n.stop(); err != nil {
+		return err
+	}
+	if runtime.GOOS != "windows" && !n.cmd.ProcessState.Success() {
+		return fmt.Errorf("prova process did not shut down cleanly: %v",
+			n.cmd.ProcessState)
+	}
+	args := append(n.config.arguments(), "--keepregtestdb")
+	n.cmd = exec.Command(n.config.exe, args...)
+	return n.start()
+}
+
 // cleanup cleanups process and args files. The file housing the pid of the
 // created process will be deleted, as well as any directories created by the
 // process.
@@ -0,0 +1,461 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package rpctest
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/btcjson"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/wire"
+	"github.com/btcsuite/websocket"
+)
+
+// Client is a JSON-RPC client which issues commands to the RPC server of a
+// node launched by a Harness over HTTP POST.  It implements the commands used
+// by the harness itself along with the ones commonly needed by tests, and any
+// other command can be issued with RawRequest.
+type Client struct {
+	// id is the id of the last request.  It must only be used atomically.
+	id uint64
+
+	addr       string
+	user       string
+	pass       string
+	tlsConfig  *tls.Config
+	httpClient *http.Client
+}
+
+// newClient returns a new client for the RPC server listening on the passed
+// address which authenticates with the passed credentials and trusts the
+// passed PEM-encoded certificates.
+func newClient(addr, user, pass string, certificates []byte) *Client {
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(certificates)
+	tlsConfig := &tls.Config{RootCAs: pool}
+	return &Client{
+		addr:      addr,
+		user:      user,
+		pass:      pass,
+		tlsConfig: tlsConfig,
+		httpClient: &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: tlsConfig,
+			},
+			Timeout: 5 * time.Minute,
+		},
+	}
+}
+
+// RawRequest issues the passed method with the passed marshalled parameters
+// and returns the marshalled result.  A JSON-RPC error returned by the server
+// is returned as a *btcjson.RPCError.
+func (c *Client) RawRequest(method string, params []json.RawMessage) (json.RawMessage, error) {
+	marshalledJSON, err := c.marshalRequest(method, params)
+	if err != nil {
+		return nil, err
+	}
+	return c.sendPostRequest(marshalledJSON)
+}
+
+// WebsocketRequest issues the passed method with the passed marshalled
+// parameters over a new websocket connection, which is required for the
+// commands which are limited to websocket clients, and returns the marshalled
+// result.  The connection is closed once the reply arrived, so the command
+// can't register for notifications which outlive the call.
+func (c *Client) WebsocketRequest(method string, params []json.RawMessage) (json.RawMessage, error) {
+	marshalledJSON, err := c.marshalRequest(method, params)
+	if err != nil {
+		return nil, err
+	}
+	dialer := websocket.Dialer{TLSClientConfig: c.tlsConfig}
+	header := make(http.Header)
+	header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString(
+		[]byte(c.user+":"+c.pass)))
+	conn, _, err := dialer.Dial("wss://"+c.addr+"/ws", header)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err := conn.WriteMessage(websocket.TextMessage, marshalledJSON); err != nil {
+		return nil, err
+	}
+
+	// Skip any notifications, which have no id, until the reply arrives.
+	for {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			return nil, err
+		}
+		var resp btcjson.Response
+		if err := json.Unmarshal(msg, &resp); err != nil {
+			return nil, err
+		}
+		if resp.ID == nil {
+			continue
+		}
+		if resp.Error != nil {
+			return nil, resp.Error
+		}
+		return resp.Result, nil
+	}
+}
+
+// marshalRequest returns the marshalled JSON-RPC request of the passed method
+// with the passed marshalled parameters.
+func (c *Client) marshalRequest(method string, params []json.RawMessage) ([]byte, error) {
+	if params == nil {
+		params = []json.RawMessage{}
+	}
+	return json.Marshal(&btcjson.Request{
+		Jsonrpc: "1.0",
+		Method:  method,
+		Params:  params,
+		ID:      atomic.AddUint64(&c.id, 1),
+	})
+}
+
+// sendCmd issues the passed command, which must be one of the command types
+// registered with the btcjson package, and unmarshals the result into the
+// passed result unless it is nil.
+func (c *Client) sendCmd(cmd interface{}, result interface{}) error {
+	marshalledJSON, err := btcjson.MarshalCmd(atomic.AddUint64(&c.id, 1), cmd)
+	if err != nil {
+		return err
+	}
+	reply, err := c.sendPostRequest(marshalledJSON)
+	if err != nil || result == nil {
+		return err
+	}
+	return json.Unmarshal(reply, result)
+}
+
+// sendPostRequest sends the marshalled JSON-RPC request to the server using
+// HTTP-POST mode and returns either the result field or the error field of the
+// response depending on whether or not there is an error.
+func (c *Client) sendPostRequest(marshalledJSON []byte) (json.RawMessage, error) {
+	httpRequest, err := http.NewRequest("POST", "https://"+c.addr,
+		bytes.NewReader(marshalledJSON))
+	if err != nil {
+		return nil, err
+	}
+	httpRequest.Close = true
+	httpRequest.Header.Set("Content-Type", "application/json")
+	httpRequest.SetBasicAuth(c.user, c.pass)
+	httpResponse, err := c.httpClient.Do(httpRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	// Read the raw bytes and close the response.
+	respBytes, err := ioutil.ReadAll(httpResponse.Body)
+	httpResponse.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("error reading json reply: %v", err)
+	}
+
+	// The server replies to requests which fail with a JSON-RPC error
+	// with an unsuccessful status code too, so only give up on the body
+	// when it isn't a JSON-RPC response.
+	var resp btcjson.Response
+	if err := json.Unmarshal(respBytes, &resp); err != nil {
+		if httpResponse.StatusCode < 200 || httpResponse.StatusCode >= 300 {
+			return nil, fmt.Errorf("%d %s: %s", httpResponse.StatusCode,
+				http.StatusText(httpResponse.StatusCode), respBytes)
+		}
+		return nil, err
+	}
+	if resp.Error != nil {
+		return nil, resp.Error
+	}
+	return resp.Result, nil
+}
+
+// hashes decodes the passed hex-encoded hashes.
+func hashes(hashStrs []string) ([]*chainhash.Hash, error) {
+	result := make([]*chainhash.Hash, 0, len(hashStrs))
+	for _, hashStr := range hashStrs {
+		hash, err := chainhash.NewHashFromStr(hashStr)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, hash)
+	}
+	return result, nil
+}
+
+// GetBestBlock returns the hash and height of the tip of the main chain.
+func (c *Client) GetBestBlock() (*chainhash.Hash, uint32, error) {
+	var result btcjson.GetBestBlockResult
+	if err := c.sendCmd(btcjson.NewGetBestBlockCmd(), &result); err != nil {
+		return nil, 0, err
+	}
+	hash, err := chainhash.NewHashFromStr(result.Hash)
+	if err != nil {
+		return nil, 0, err
+	}
+	return hash, result.Height, nil
+}
+
+// GetBlockCount returns the height of the tip of the main chain.
+func (c *Client) GetBlockCount() (int64, error) {
+	var count int64
+	err := c.sendCmd(btcjson.NewGetBlockCountCmd(), &count)
+	return count, err
+}
+
+// GetBlockHash returns the hash of the block of the main chain at the passed
+// height.
+func (c *Client) GetBlockHash(height int64) (*chainhash.Hash, error) {
+	var hashStr string
+	if err := c.sendCmd(btcjson.NewGetBlockHashCmd(height), &hashStr); err != nil {
+		return nil, err
+	}
+	return chainhash.NewHashFromStr(hashStr)
+}
+
+// GetBlock returns the block with the passed hash.
+func (c *Client) GetBlock(hash *chainhash.Hash) (*wire.MsgBlock, error) {
+	verbosity := btcjson.GetBlockVerbosityHex
+	cmd := btcjson.NewGetBlockVerbosityCmd(hash.String(), &verbosity, nil)
+	var blockHex string
+	if err := c.sendCmd(cmd, &blockHex); err != nil {
+		return nil, err
+	}
+	serializedBlock, err := hex.DecodeString(blockHex)
+	if err != nil {
+		return nil, err
+	}
+	var msgBlock wire.MsgBlock
+	err = msgBlock.Deserialize(bytes.NewReader(serializedBlock))
+	if err != nil {
+		return nil, err
+	}
+	return &msgBlock, nil
+}
+
+// GetInfo returns miscellaneous information about the node.
+func (c *Client) GetInfo() (*btcjson.InfoChainResult, error) {
+	var result btcjson.InfoChainResult
+	if err := c.sendCmd(btcjson.NewGetInfoCmd(), &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetBlockChainInfo returns information about the state of the block chain,
+// including the difficulty of the next block.
+func (c *Client) GetBlockChainInfo() (*btcjson.GetBlockChainInfoResult, error) {
+	var result btcjson.GetBlockChainInfoResult
+	if err := c.sendCmd(btcjson.NewGetBlockChainInfoCmd(), &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetAdminInfo returns the admin state of the tip of the main chain, including
+// the tips of the admin threads.
+func (c *Client) GetAdminInfo() (*btcjson.GetAdminInfoResult, error) {
+	var result btcjson.GetAdminInfoResult
+	if err := c.sendCmd(btcjson.NewGetAdminInfoCmd(), &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetValidatorInfo returns the share of the recent blocks each active validate
+// key signed and whether it may sign the next block.
+func (c *Client) GetValidatorInfo() (*btcjson.GetValidatorInfoResult, error) {
+	var result btcjson.GetValidatorInfoResult
+	cmd := btcjson.NewGetValidatorInfoCmd(nil)
+	if err := c.sendCmd(cmd, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// SetValidateKeys sets the validate keys the node signs the blocks it
+// generates with.
+func (c *Client) SetValidateKeys(keys []*btcec.PrivateKey) error {
+	privKeys := make([]string, 0, len(keys))
+	for _, key := range keys {
+		privKeys = append(privKeys, hex.EncodeToString(key.Serialize()))
+	}
+	return c.sendCmd(btcjson.NewSetValidateKeysCmd(privKeys), nil)
+}
+
+// Generate generates the passed number of blocks on top of the main chain and
+// returns their hashes.
+func (c *Client) Generate(numBlocks uint32) ([]*chainhash.Hash, error) {
+	var hashStrs []string
+	if err := c.sendCmd(btcjson.NewGenerateCmd(numBlocks), &hashStrs); err != nil {
+		return nil, err
+	}
+	return hashes(hashStrs)
+}
+
+// SubmitBlock submits the passed block to the node.  An error is returned
+// when the node did not accept the block to the main chain, along with the
+// reason the node reported.
+func (c *Client) SubmitBlock(block *provautil.Block) error {
+	blockBytes, err := block.Bytes()
+	if err != nil {
+		return err
+	}
+	cmd := btcjson.NewSubmitBlockCmd(hex.EncodeToString(blockBytes), nil)
+	var reason *string
+	if err := c.sendCmd(cmd, &reason); err != nil {
+		return err
+	}
+	if reason != nil {
+		return fmt.Errorf("block %v rejected: %s", block.Hash(), *reason)
+	}
+	return nil
+}
+
+// GetRawMempool returns the hashes of the transactions in the memory pool.
+func (c *Client) GetRawMempool() ([]*chainhash.Hash, error) {
+	var hashStrs []string
+	cmd := btcjson.NewGetRawMempoolCmd(btcjson.Bool(false))
+	if err := c.sendCmd(cmd, &hashStrs); err != nil {
+		return nil, err
+	}
+	return hashes(hashStrs)
+}
+
+// SendRawTransaction submits the passed transaction to the memory pool of the
+// node and returns its hash.
+func (c *Client) SendRawTransaction(tx *wire.MsgTx, allowHighFees bool) (*chainhash.Hash, error) {
+	var buf bytes.Buffer
+	buf.Grow(tx.SerializeSize())
+	if err := tx.Serialize(&buf); err != nil {
+		return nil, err
+	}
+	cmd := btcjson.NewSendRawTransactionCmd(hex.EncodeToString(buf.Bytes()),
+		&allowHighFees)
+	var hashStr string
+	if err := c.sendCmd(cmd, &hashStr); err != nil {
+		return nil, err
+	}
+	return chainhash.NewHashFromStr(hashStr)
+}
+
+// CreateRawTransaction returns an unsigned transaction spending the passed
+// outpoints and paying the passed amounts in RMG to the passed addresses, along
+// with the fee it pays.  The outputs spent by the inputs must be known to the
+// node.
+func (c *Client) CreateRawTransaction(inputs []*wire.OutPoint, amounts map[string]float64) (*btcjson.CreateRawTransactionResult, error) {
+	txInputs := make([]btcjson.TransactionInput, 0, len(inputs))
+	for _, outPoint := range inputs {
+		txInputs = append(txInputs, btcjson.TransactionInput{
+			Txid: outPoint.Hash.String(),
+			Vout: outPoint.Index,
+		})
+	}
+	cmd := btcjson.NewCreateRawTransactionCmd(txInputs, amounts,
+		btcjson.Int64(0), btcjson.Bool(true))
+	var result btcjson.CreateRawTransactionResult
+	if err := c.sendCmd(cmd, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// FundRawTransaction adds inputs and a change output to the passed transaction
+// according to the passed options and returns the funded transaction along
+// with the fee it pays and the position of its change output.
+func (c *Client) FundRawTransaction(tx *wire.MsgTx, options btcjson.FundRawTransactionOpts) (*wire.MsgTx, *btcjson.FundRawTransactionResult, error) {
+	var buf bytes.Buffer
+	buf.Grow(tx.SerializeSize())
+	if err := tx.Serialize(&buf); err != nil {
+		return nil, nil, err
+	}
+	cmd := btcjson.NewFundRawTransactionCmd(hex.EncodeToString(buf.Bytes()),
+		options)
+	var result btcjson.FundRawTransactionResult
+	if err := c.sendCmd(cmd, &result); err != nil {
+		return nil, nil, err
+	}
+	serializedTx, err := hex.DecodeString(result.Hex)
+	if err != nil {
+		return nil, nil, err
+	}
+	var funded wire.MsgTx
+	if err := funded.Deserialize(bytes.NewReader(serializedTx)); err != nil {
+		return nil, nil, err
+	}
+	return &funded, &result, nil
+}
+
+// GetTxOut returns the unspent transaction output with the passed outpoint,
+// which may be created by a transaction of the memory pool when includeMempool
+// is set.  Nil is returned when there is no such unspent output.
+func (c *Client) GetTxOut(outPoint *wire.OutPoint, includeMempool bool) (*btcjson.GetTxOutResult, error) {
+	cmd := btcjson.NewGetTxOutCmd(outPoint.Hash.String(), outPoint.Index,
+		&includeMempool)
+	var result *btcjson.GetTxOutResult
+	if err := c.sendCmd(cmd, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetPeerInfo returns information about the peers of the node.
+func (c *Client) GetPeerInfo() ([]btcjson.GetPeerInfoResult, error) {
+	var result []btcjson.GetPeerInfoResult
+	err := c.sendCmd(btcjson.NewGetPeerInfoCmd(), &result)
+	return result, err
+}
+
+// GetMetrics returns the current values of the metrics of the node.
+func (c *Client) GetMetrics() ([]btcjson.GetMetricsResult, error) {
+	var result []btcjson.GetMetricsResult
+	err := c.sendCmd(btcjson.NewGetMetricsCmd(), &result)
+	return result, err
+}
+
+// GetPendingBroadcasts returns the transactions submitted to the node which are
+// announced to peers until they are mined.
+func (c *Client) GetPendingBroadcasts() ([]btcjson.GetPendingBroadcastsResult, error) {
+	var result []btcjson.GetPendingBroadcastsResult
+	err := c.sendCmd(btcjson.NewGetPendingBroadcastsCmd(), &result)
+	return result, err
+}
+
+// AddNode adds or removes the passed persistent peer, or tries a connection to
+// it once, depending on the passed command.
+func (c *Client) AddNode(host string, command btcjson.AddNodeSubCmd) error {
+	return c.sendCmd(btcjson.NewAddNodeCmd(host, command), nil)
+}
+
+// GetAddedNodeInfoNoDNS returns the addresses of the persistent peers added
+// with AddNode, limited to the passed peer unless it is empty.  An error is
+// returned when the passed peer was not added.
+func (c *Client) GetAddedNodeInfoNoDNS(peer string) ([]string, error) {
+	var node *string
+	if peer != "" {
+		node = &peer
+	}
+	var result []string
+	err := c.sendCmd(btcjson.NewGetAddedNodeInfoCmd(false, node), &result)
+	return result, err
+}
+
+// Stop requests the node to shut down.
+func (c *Client) Stop() error {
+	return c.sendCmd(btcjson.NewStopCmd(), nil)
+}
@@ -6,46 +6,35 @@
 package rpctest
 
 import (
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net"
 	"os"
-	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/bitgo/prova/btcec"
 	"github.com/bitgo/prova/chaincfg"
 	"github.com/bitgo/prova/chaincfg/chainhash"
 	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/txscript"
 	"github.com/bitgo/prova/wire"
-	"github.com/btcsuite/btcrpcclient"
-)
-
-const (
-	// These constants define the minimum and maximum p2p and rpc port
-	// numbers used by a test harness.  The min port is inclusive while the
-	// max port is exclusive.
-	minPeerPort = 10000
-	maxPeerPort = 35000
-	minRPCPort  = maxPeerPort
-	maxRPCPort  = 60000
 )
 
 var (
 	// current number of active test nodes.
 	numTestInstances = 0
 
-	// processID is the process ID of the current running process.  It is
-	// used to calculate ports based upon it when launching an rpc
-	// harnesses.  The intent is to allow multiple process to run in
-	// parallel without port collisions.
-	//
-	// It should be noted however that there is still some small probability
-	// that there will be port collisions either due to other processes
-	// running or simply due to the stars aligning on the process IDs.
-	processID = os.Getpid()
+	// usedPorts is the set of ports which were handed out to the
+	// harnesses of the current process.  A port is never handed out
+	// twice, so a harness can't end up listening on the port of a harness
+	// which was torn down while connections to it linger.
+	usedPorts = make(map[int]struct{})
 
 	// testInstances is a private package-level slice used to keep track of
 	// all active test harnesses. This global can be used to perform
@@ -61,10 +50,47 @@ var (
 // Harness to exercise functionality.
 type HarnessTestCase func(r *Harness, t *testing.T)
 
-// Harness fully encapsulates an active btcd process to provide a unified
-// platform for creating rpc driven integration tests involving btcd. The
-// active btcd node will typically be run in simnet mode in order to allow for
-// easy generation of test blockchains.  The active btcd process is fully
+// HarnessOption customizes a Harness created by NewHarness.
+type HarnessOption func(*harnessOptions)
+
+// harnessOptions houses the settings of a Harness which may be customized with
+// the options passed to NewHarness.
+type harnessOptions struct {
+	extraArgs    []string
+	validateKeys []*btcec.PrivateKey
+	exe          string
+}
+
+// WithExtraArgs passes the passed additional command line arguments to the
+// prova process of the harness.
+func WithExtraArgs(args ...string) HarnessOption {
+	return func(o *harnessOptions) {
+		o.extraArgs = append(o.extraArgs, args...)
+	}
+}
+
+// WithValidateKeys makes the node of the harness sign the blocks it generates,
+// and the harness sign the blocks it submits, with the passed validate keys
+// instead of the known validate keys of the network.
+func WithValidateKeys(keys ...*btcec.PrivateKey) HarnessOption {
+	return func(o *harnessOptions) {
+		o.validateKeys = keys
+	}
+}
+
+// WithExecutable launches the prova executable at the passed path instead of
+// one built from the source tree of the harness.
+func WithExecutable(path string) HarnessOption {
+	return func(o *harnessOptions) {
+		o.exe = path
+	}
+}
+
+// Harness fully encapsulates an active prova process to provide a unified
+// platform for creating rpc driven integration tests involving prova. The
+// active prova node will typically be run in regtest mode, whose admin keys
+// are known to the harness, in order to allow for easy generation of test
+// blockchains and issuance of coins.  The active prova process is fully
 // managed by Harness, which handles the necessary initialization, and teardown
 // of the process along with any temporary directories created as a result.
 // Multiple Harness instances may be run concurrently, in order to allow for
@@ -75,12 +101,16 @@ type Harness struct {
 	// to.
 	ActiveNet *chaincfg.Params
 
-	Node     *btcrpcclient.Client
-	node     *node
-	handlers *btcrpcclient.NotificationHandlers
+	// Node is the client of the RPC server of the node.  It is available
+	// once the harness is set up.
+	Node *Client
+	node *node
 
 	wallet *memWallet
 
+	validateKeys []*btcec.PrivateKey
+	issueKeys    []*btcec.PrivateKey
+
 	testNodeDir    string
 	maxConnRetries int
 	nodeNum        int
@@ -88,91 +118,87 @@ type Harness struct {
 	sync.Mutex
 }
 
-// New creates and initializes new instance of the rpc test harness.
-// Optionally, websocket handlers and a specified configuration may be passed.
-// In the case that a nil config is passed, a default configuration will be
-// used.
+// NewHarness creates and initializes new instance of the rpc test harness for
+// the passed network.  The node of the harness signs blocks with the known
+// validate keys of the network unless other keys are passed with the
+// WithValidateKeys option, so there must be validate keys for the network.
+// Every harness gets its own temporary directory and listening ports, so
+// harnesses may be used by tests which run in parallel.
 //
 // NOTE: This function is safe for concurrent access.
-func New(activeNet *chaincfg.Params, handlers *btcrpcclient.NotificationHandlers,
-	extraArgs []string) (*Harness, error) {
+func NewHarness(params *chaincfg.Params, opts ...HarnessOption) (*Harness, error) {
+	var options harnessOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	keys := knownNetKeys(params)
+	if len(options.validateKeys) == 0 {
+		options.validateKeys = keys.validateKeys
+	}
+	if len(options.validateKeys) == 0 {
+		return nil, fmt.Errorf("no validate keys are known for network "+
+			"%s", params.Name)
+	}
+	if options.exe == "" {
+		exe, err := provaExecutablePath()
+		if err != nil {
+			return nil, err
+		}
+		options.exe = exe
+	}
 
 	harnessStateMtx.Lock()
 	defer harnessStateMtx.Unlock()
 
 	harnessID := strconv.Itoa(numTestInstances)
-	nodeTestData, err := ioutil.TempDir("", "rpctest-"+harnessID)
+	nodeTestData, err := ioutil.TempDir("", "rpctest-"+harnessID+"-")
 	if err != nil {
 		return nil, err
 	}
 
-	certFile := filepath.Join(nodeTestData, "rpc.cert")
-	keyFile := filepath.Join(nodeTestData, "rpc.key")
-	if err := genCertPair(certFile, keyFile); err != nil {
-		return nil, err
-	}
-
-	wallet, err := newMemWallet(activeNet, uint32(numTestInstances))
+	wallet, err := newMemWallet(params, uint32(numTestInstances),
+		keys.aspKeys)
 	if err != nil {
+		os.RemoveAll(nodeTestData)
 		return nil, err
 	}
 
 	miningAddr := fmt.Sprintf("--miningaddr=%s", wallet.coinbaseAddr)
-	extraArgs = append(extraArgs, miningAddr)
+	extraArgs := append(options.extraArgs, miningAddr)
 
-	config, err := newConfig("rpctest", certFile, keyFile, extraArgs)
+	config, err := newConfig("rpctest", options.exe, nodeTestData, params,
+		extraArgs)
 	if err != nil {
+		os.RemoveAll(nodeTestData)
 		return nil, err
 	}
 
 	// Generate p2p+rpc listening addresses.
-	config.listen, config.rpcListen = generateListeningAddresses()
+	config.listen, config.rpcListen, err = generateListeningAddresses()
+	if err != nil {
+		os.RemoveAll(nodeTestData)
+		return nil, err
+	}
 
-	// Create the testing node bounded to the simnet.
+	// Create the testing node bounded to the network.
 	node, err := newNode(config, nodeTestData)
 	if err != nil {
+		os.RemoveAll(nodeTestData)
 		return nil, err
 	}
 
 	nodeNum := numTestInstances
 	numTestInstances++
 
-	if handlers == nil {
-		handlers = &btcrpcclient.NotificationHandlers{}
-	}
-
-	// If a handler for the OnFilteredBlock{Connected,Disconnected} callback
-	// callback has already been set, then create a wrapper callback which
-	// executes both the currently registered callback and the mem wallet's
-	// callback.
-	if handlers.OnFilteredBlockConnected != nil {
-		obc := handlers.OnFilteredBlockConnected
-		handlers.OnFilteredBlockConnected = func(height int32, header *wire.BlockHeader, filteredTxns []*btcutil.Tx) {
-			wallet.IngestBlock(height, header, filteredTxns)
-			obc(height, header, filteredTxns)
-		}
-	} else {
-		// Otherwise, we can claim the callback ourselves.
-		handlers.OnFilteredBlockConnected = wallet.IngestBlock
-	}
-	if handlers.OnFilteredBlockDisconnected != nil {
-		obd := handlers.OnFilteredBlockDisconnected
-		handlers.OnFilteredBlockDisconnected = func(height int32, header *wire.BlockHeader) {
-			wallet.UnwindBlock(height, header)
-			obd(height, header)
-		}
-	} else {
-		handlers.OnFilteredBlockDisconnected = wallet.UnwindBlock
-	}
-
 	h := &Harness{
-		handlers:       handlers,
 		node:           node,
 		maxConnRetries: 20,
 		testNodeDir:    nodeTestData,
-		ActiveNet:      activeNet,
+		ActiveNet:      params,
 		nodeNum:        nodeNum,
 		wallet:         wallet,
+		validateKeys:   options.validateKeys,
+		issueKeys:      keys.issueKeys,
 	}
 
 	// Track this newly created test instance within the package level
@@ -182,15 +208,17 @@ func New(activeNet *chaincfg.Params, handlers *btcrpcclient.NotificationHandlers
 	return h, nil
 }
 
-// SetUp initializes the rpc test state. Initialization includes: starting up a
-// simnet node, creating a websockets client and connecting to the started
-// node, and finally: optionally generating and submitting a testchain with a
-// configurable number of mature coinbase outputs coinbase outputs.
+// SetUp initializes the rpc test state. Initialization includes: starting up
+// the node, connecting to its RPC server and setting its validate keys, and
+// finally: optionally generating a testchain funding the wallet of the harness
+// with a configurable number of mature outputs.  The outputs are issued once
+// enough blocks were generated for the outputs of the genesis block, which
+// include the issue thread, to mature.
 //
 // NOTE: This method and TearDown should always be called from the same
 // goroutine as they are not concurrent safe.
 func (h *Harness) SetUp(createTestChain bool, numMatureOutputs uint32) error {
-	// Start the btcd node itself. This spawns a new process which will be
+	// Start the prova node itself. This spawns a new process which will be
 	// managed
 	if err := h.node.start(); err != nil {
 		return err
@@ -198,49 +226,37 @@ func (h *Harness) SetUp(createTestChain bool, numMatureOutputs uint32) error {
 	if err := h.connectRPCClient(); err != nil {
 		return err
 	}
-
-	h.wallet.Start()
-
-	// Filter transactions that pay to the coinbase associated with the
-	// wallet.
-	filterAddrs := []btcutil.Address{h.wallet.coinbaseAddr}
-	if err := h.Node.LoadTxFilter(true, filterAddrs, nil); err != nil {
-		return err
-	}
-
-	// Ensure btcd properly dispatches our registered call-back for each new
-	// block. Otherwise, the memWallet won't function properly.
-	if err := h.Node.NotifyBlocks(); err != nil {
+	if err := h.Node.SetValidateKeys(h.validateKeys); err != nil {
 		return err
 	}
 
-	// Create a test chain with the desired number of mature coinbase
-	// outputs.
+	// Create a test chain with the desired number of mature outputs.
 	if createTestChain && numMatureOutputs != 0 {
-		numToGenerate := (uint32(h.ActiveNet.CoinbaseMaturity) +
-			numMatureOutputs)
-		_, err := h.Node.Generate(numToGenerate)
-		if err != nil {
+		numToGenerate := uint32(h.ActiveNet.CoinbaseMaturity)
+		if _, err := h.Node.Generate(numToGenerate); err != nil {
+			return err
+		}
+		outputs := make([]*wire.TxOut, 0, numMatureOutputs)
+		for i := uint32(0); i < numMatureOutputs; i++ {
+			addr, err := h.NewAddress()
+			if err != nil {
+				return err
+			}
+			pkScript, err := txscript.PayToAddrScript(addr)
+			if err != nil {
+				return err
+			}
+			outputs = append(outputs, wire.NewTxOut(
+				50*provautil.AtomsPerGram, pkScript))
+		}
+		if _, err := h.IssueOutputs(outputs); err != nil {
 			return err
 		}
 	}
 
 	// Block until the wallet has fully synced up to the tip of the main
 	// chain.
-	_, height, err := h.Node.GetBestBlock()
-	if err != nil {
-		return err
-	}
-	ticker := time.NewTicker(time.Millisecond * 100)
-	for range ticker.C {
-		walletHeight := h.wallet.SyncedHeight()
-		if walletHeight == height {
-			break
-		}
-	}
-	ticker.Stop()
-
-	return nil
+	return h.wallet.Sync()
 }
 
 // tearDown stops the running rpc test instance.  All created processes are
@@ -248,10 +264,6 @@ func (h *Harness) SetUp(createTestChain bool, numMatureOutputs uint32) error {
 //
 // This function MUST be called with the harness state mutex held (for writes).
 func (h *Harness) tearDown() error {
-	if h.Node != nil {
-		h.Node.Shutdown()
-	}
-
 	if err := h.node.shutdown(); err != nil {
 		return err
 	}
@@ -277,27 +289,40 @@ func (h *Harness) TearDown() error {
 	return h.tearDown()
 }
 
-// connectRPCClient attempts to establish an RPC connection to the created btcd
-// process belonging to this Harness instance. If the initial connection
+// Restart gracefully shuts down the node of the harness and starts it again
+// with the same data directory, then reconnects the RPC client and sets the
+// validate keys again.  It allows testing the state the node restores on start
+// up.
+//
+// NOTE: This method is not concurrent safe, like SetUp and TearDown.
+func (h *Harness) Restart() error {
+	if err := h.node.restart(); err != nil {
+		return err
+	}
+	if err := h.connectRPCClient(); err != nil {
+		return err
+	}
+	return h.Node.SetValidateKeys(h.validateKeys)
+}
+
+// connectRPCClient attempts to establish an RPC connection to the created
+// prova process belonging to this Harness instance. If the initial connection
 // attempt fails, this function will retry h.maxConnRetries times, backing off
 // the time between subsequent attempts. If after h.maxConnRetries attempts,
 // we're not able to establish a connection, this function returns with an
 // error.
 func (h *Harness) connectRPCClient() error {
-	var client *btcrpcclient.Client
+	client := h.node.config.rpcClient()
 	var err error
-
-	rpcConf := h.node.config.rpcConnConfig()
 	for i := 0; i < h.maxConnRetries; i++ {
-		if client, err = btcrpcclient.New(&rpcConf, h.handlers); err != nil {
+		if _, _, err = client.GetBestBlock(); err != nil {
 			time.Sleep(time.Duration(i) * 50 * time.Millisecond)
 			continue
 		}
 		break
 	}
-
-	if client == nil {
-		return fmt.Errorf("connection timeout")
+	if err != nil {
+		return fmt.Errorf("connection timeout: %v", err)
 	}
 
 	h.Node = client
@@ -305,6 +330,12 @@ func (h *Harness) connectRPCClient() error {
 	return nil
 }
 
+// P2PAddress returns the address the node of the harness listens on for peer
+// connections.
+func (h *Harness) P2PAddress() string {
+	return h.node.config.listen
+}
+
 // NewAddress returns a fresh address spendable by the Harness' internal
 // wallet.
 //
@@ -322,8 +353,8 @@ func (h *Harness) ConfirmedBalance() provautil.Amount {
 }
 
 // SendOutputs creates, signs, and finally broadcasts a transaction spending
-// the harness' available mature coinbase outputs creating new outputs
-// according to targetOutputs.
+// the harness' available mature outputs creating new outputs according to
+// targetOutputs.
 //
 // This function is safe for concurrent access.
 func (h *Harness) SendOutputs(targetOutputs []*wire.TxOut,
@@ -357,20 +388,163 @@ func (h *Harness) UnlockOutputs(inputs []*wire.TxIn) {
 	h.wallet.UnlockOutputs(inputs)
 }
 
-// RPCConfig returns the harnesses current rpc configuration. This allows other
-// potential RPC clients created within tests to connect to a given test
-// harness instance.
-func (h *Harness) RPCConfig() btcrpcclient.ConnConfig {
-	return h.node.config.rpcConnConfig()
+// parseOutPoint decodes an outpoint in the hash:index form.
+func parseOutPoint(s string) (*wire.OutPoint, error) {
+	sep := strings.LastIndex(s, ":")
+	if sep < 0 {
+		return nil, fmt.Errorf("malformed outpoint %q", s)
+	}
+	hash, err := chainhash.NewHashFromStr(s[:sep])
+	if err != nil {
+		return nil, err
+	}
+	index, err := strconv.ParseUint(s[sep+1:], 10, 32)
+	if err != nil {
+		return nil, err
+	}
+	return wire.NewOutPoint(hash, uint32(index)), nil
+}
+
+// IssueOutputs creates new coins paying to the passed outputs with a
+// transaction of the issue thread, which is signed with the known issue keys
+// of the network, and mines it into a block on top of the main chain.  The
+// outputs may pay to addresses of the wallet of any harness to fund it, and
+// are spendable right away since they are not coinbase outputs.
+//
+// This function is safe for concurrent access.
+func (h *Harness) IssueOutputs(outputs []*wire.TxOut) (*wire.MsgTx, error) {
+	h.Lock()
+	defer h.Unlock()
+
+	if len(h.issueKeys) == 0 {
+		return nil, errors.New("no issue keys are known for network " +
+			h.ActiveNet.Name)
+	}
+
+	// Extend the issue thread from its tip at the main chain.
+	adminInfo, err := h.Node.GetAdminInfo()
+	if err != nil {
+		return nil, err
+	}
+	var threadTip *wire.OutPoint
+	for _, tip := range adminInfo.ThreadTips {
+		if tip.ID != uint32(provautil.IssueThread) {
+			continue
+		}
+		threadTip, err = parseOutPoint(tip.OutPoint)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if threadTip == nil {
+		return nil, errors.New("issue thread tip is unknown")
+	}
+	threadScript, err := txscript.ProvaThreadScript(provautil.IssueThread)
+	if err != nil {
+		return nil, err
+	}
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(threadTip, nil))
+	tx.AddTxOut(wire.NewTxOut(0, threadScript))
+	for _, output := range outputs {
+		tx.AddTxOut(output)
+	}
+	lookupKey := func(provautil.Address) ([]txscript.PrivateKey, error) {
+		signKeys := make([]txscript.PrivateKey, 0, len(h.issueKeys))
+		for _, key := range h.issueKeys {
+			signKeys = append(signKeys, txscript.PrivateKey{
+				Key:        key,
+				Compressed: true,
+			})
+		}
+		return signKeys, nil
+	}
+	sigScript, err := txscript.SignTxOutput(h.ActiveNet, tx, 0, 0,
+		threadScript, txscript.SigHashAll, txscript.KeyClosure(lookupKey),
+		nil)
+	if err != nil {
+		return nil, err
+	}
+	tx.TxIn[0].SignatureScript = sigScript
+
+	_, err = h.generateAndSubmitBlock([]*provautil.Tx{provautil.NewTx(tx)},
+		-1, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// validateKey returns a validate key of the harness which may sign the block
+// after the tip of the main chain without exceeding its share of the blocks
+// of the averaging window.
+func (h *Harness) validateKey() (*btcec.PrivateKey, error) {
+	info, err := h.Node.GetValidatorInfo()
+	if err != nil {
+		return nil, err
+	}
+	canSign := make(map[string]bool, len(info.Validators))
+	for _, validator := range info.Validators {
+		canSign[validator.PubKey] = validator.CanSign
+	}
+	for _, key := range h.validateKeys {
+		pubKey := hex.EncodeToString(key.PubKey().SerializeCompressed())
+		if signer, ok := canSign[pubKey]; !ok || signer {
+			return key, nil
+		}
+	}
+	return nil, errors.New("all validate keys are rate limited")
+}
+
+// blockFees returns the total fees paid by the passed transactions when they
+// are mined in the passed order on top of the main chain, so they may spend
+// the outputs of the transactions before them.
+func (h *Harness) blockFees(txns []*provautil.Tx) (int64, error) {
+	blockOutputs := make(map[wire.OutPoint]int64)
+	var totalFees int64
+	for _, tx := range txns {
+		var totalIn, totalOut int64
+		for _, txIn := range tx.MsgTx().TxIn {
+			prevOut := txIn.PreviousOutPoint
+			if value, ok := blockOutputs[prevOut]; ok {
+				totalIn += value
+				continue
+			}
+			txOut, err := h.Node.GetTxOut(&prevOut, false)
+			if err != nil {
+				return 0, err
+			}
+			if txOut == nil {
+				return 0, fmt.Errorf("output %v spent by transaction "+
+					"%v is not unspent", prevOut, tx.Hash())
+			}
+			value, err := provautil.NewAmount(txOut.Value)
+			if err != nil {
+				return 0, err
+			}
+			totalIn += int64(value)
+		}
+		for i, txOut := range tx.MsgTx().TxOut {
+			totalOut += txOut.Value
+			outPoint := wire.OutPoint{Hash: *tx.Hash(), Index: uint32(i)}
+			blockOutputs[outPoint] = txOut.Value
+		}
+
+		// Issuing coins does not pay a negative fee.
+		if totalIn > totalOut {
+			totalFees += totalIn - totalOut
+		}
+	}
+	return totalFees, nil
 }
 
 // GenerateAndSubmitBlock creates a block whose contents include the passed
-// transactions and submits it to the running simnet node. For generating
-// blocks with only a coinbase tx, callers can simply pass nil instead of
-// transactions to be mined. Additionally, a custom block version can be set by
-// the caller. A blockVersion of -1 indicates that the current default block
-// version should be used. An uninitialized time.Time should be used for the
-// blockTime parameter if one doesn't wish to set a custom time.
+// transactions and submits it to the running node. For generating blocks with
+// only a coinbase tx, callers can simply pass nil instead of transactions to
+// be mined. Additionally, a custom block version can be set by the caller. A
+// blockVersion of -1 indicates that the current default block version should
+// be used. An uninitialized time.Time should be used for the blockTime
+// parameter if one doesn't wish to set a custom time.
 //
 // This function is safe for concurrent access.
 func (h *Harness) GenerateAndSubmitBlock(txns []*provautil.Tx, blockVersion int32,
@@ -379,11 +553,22 @@ func (h *Harness) GenerateAndSubmitBlock(txns []*provautil.Tx, blockVersion int3
 	h.Lock()
 	defer h.Unlock()
 
+	return h.generateAndSubmitBlock(txns, blockVersion, blockTime)
+}
+
+// generateAndSubmitBlock creates a block whose contents include the passed
+// transactions and submits it to the running node.  See GenerateAndSubmitBlock
+// for details.
+//
+// This function MUST be called with the harness mutex held.
+func (h *Harness) generateAndSubmitBlock(txns []*provautil.Tx, blockVersion int32,
+	blockTime time.Time) (*provautil.Block, error) {
+
 	if blockVersion == -1 {
 		blockVersion = wire.BlockVersion
 	}
 
-	prevBlockHash, prevBlockHeight, err := h.Node.GetBestBlock()
+	prevBlockHash, _, err := h.Node.GetBestBlock()
 	if err != nil {
 		return nil, err
 	}
@@ -393,36 +578,82 @@ func (h *Harness) GenerateAndSubmitBlock(txns []*provautil.Tx, blockVersion int3
 	}
 	prevBlock := provautil.NewBlock(mBlock)
 
+	// The difficulty of the next block only depends on the blocks before
+	// it, so the one the node reports applies to any time stamp.
+	chainInfo, err := h.Node.GetBlockChainInfo()
+	if err != nil {
+		return nil, err
+	}
+	bits, err := strconv.ParseUint(chainInfo.Window.NextBits, 16, 32)
+	if err != nil {
+		return nil, err
+	}
+	validateKey, err := h.validateKey()
+	if err != nil {
+		return nil, err
+	}
+	fees, err := h.blockFees(txns)
+	if err != nil {
+		return nil, err
+	}
+
 	// Create a new block including the specified transactions
-	newBlock, err := createBlock(prevBlock, txns, blockVersion,
-		blockTime, h.wallet.coinbaseAddr, h.ActiveNet)
+	newBlock, err := createBlock(prevBlock, txns, fees, blockVersion,
+		blockTime, uint32(bits), validateKey, h.wallet.coinbaseAddr,
+		h.ActiveNet)
 	if err != nil {
 		return nil, err
 	}
 
-	// Submit the block to the simnet node.
-	if err := h.Node.SubmitBlock(newBlock, nil); err != nil {
+	// Submit the block to the node.
+	if err := h.Node.SubmitBlock(newBlock); err != nil {
 		return nil, err
 	}
 
 	return newBlock, nil
 }
 
+// nextAvailablePort returns a port of the loopback interface which is not in
+// use and which was not handed out to another harness of the current process.
+// Letting the kernel pick the port, rather than deriving it from the process
+// id, avoids collisions with the ports of other processes, including the
+// harnesses of test binaries which run in parallel.
+//
+// This function MUST be called with the harness state mutex held (for writes).
+func nextAvailablePort() (int, error) {
+	for {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return 0, err
+		}
+		port := listener.Addr().(*net.TCPAddr).Port
+		listener.Close()
+		if _, ok := usedPorts[port]; ok {
+			continue
+		}
+		usedPorts[port] = struct{}{}
+		return port, nil
+	}
+}
+
 // generateListeningAddresses returns two strings representing listening
-// addresses designated for the current rpc test. If there haven't been any
-// test instances created, the default ports are used. Otherwise, in order to
-// support multiple test nodes running at once, the p2p and rpc port are
-// incremented after each initialization.
-func generateListeningAddresses() (string, string) {
+// addresses designated for the current rpc test, on ports which are available
+// and were not handed out to other harnesses.
+//
+// This function MUST be called with the harness state mutex held (for writes).
+func generateListeningAddresses() (string, string, error) {
 	localhost := "127.0.0.1"
 
-	portString := func(minPort, maxPort int) string {
-		port := minPort + numTestInstances + ((20 * processID) %
-			(maxPort - minPort))
-		return strconv.Itoa(port)
+	p2pPort, err := nextAvailablePort()
+	if err != nil {
+		return "", "", err
+	}
+	rpcPort, err := nextAvailablePort()
+	if err != nil {
+		return "", "", err
 	}
 
-	p2p := net.JoinHostPort(localhost, portString(minPeerPort, maxPeerPort))
-	rpc := net.JoinHostPort(localhost, portString(minRPCPort, maxRPCPort))
-	return p2p, rpc
+	p2p := net.JoinHostPort(localhost, strconv.Itoa(p2pPort))
+	rpc := net.JoinHostPort(localhost, strconv.Itoa(rpcPort))
+	return p2p, rpc, nil
 }
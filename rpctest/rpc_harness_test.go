@@ -9,11 +9,18 @@
 package rpctest
 
 import (
+	"bufio"
 	"fmt"
+	"net"
+	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/btcjson"
 	"github.com/bitgo/prova/chaincfg"
 	"github.com/bitgo/prova/chaincfg/chainhash"
 	"github.com/bitgo/prova/provautil"
@@ -29,8 +36,8 @@ func testSendOutputs(r *Harness, t *testing.T) {
 			t.Fatalf("unable to get new address: %v", err)
 		}
 
-		// Next, send amt RMG to this address, spending from one of our mature
-		// coinbase outputs.
+		// Next, send amt RMG to this address, spending from one of our
+		// issued outputs.
 		addrScript, err := txscript.PayToAddrScript(addr)
 		if err != nil {
 			t.Fatalf("unable to generate pkscript to addr: %v", err)
@@ -38,7 +45,7 @@ func testSendOutputs(r *Harness, t *testing.T) {
 		output := wire.NewTxOut(int64(amt), addrScript)
 		txid, err := r.SendOutputs([]*wire.TxOut{output}, 10)
 		if err != nil {
-			t.Fatalf("coinbase spend failed: %v", err)
+			t.Fatalf("spend failed: %v", err)
 		}
 		return txid
 	}
@@ -74,8 +81,8 @@ func testSendOutputs(r *Harness, t *testing.T) {
 	}
 	assertTxMined(txid, blockHashes[0])
 
-	// Next, generate a spend much greater than the block reward. This
-	// transaction should also have been mined properly.
+	// Next, generate a spend much greater than a single issued output.
+	// This transaction should also have been mined properly.
 	txid = genSpend(provautil.Amount(500 * provautil.AtomsPerGram))
 	blockHashes, err = r.Node.Generate(1)
 	if err != nil {
@@ -90,7 +97,7 @@ func assertConnectedTo(t *testing.T, nodeA *Harness, nodeB *Harness) {
 		t.Fatalf("unable to get nodeA's peer info")
 	}
 
-	nodeAddr := nodeB.node.config.listen
+	nodeAddr := nodeB.P2PAddress()
 	addrFound := false
 	for _, peerInfo := range nodeAPeers {
 		if peerInfo.Addr == nodeAddr {
@@ -106,7 +113,7 @@ func assertConnectedTo(t *testing.T, nodeA *Harness, nodeB *Harness) {
 
 func testConnectNode(r *Harness, t *testing.T) {
 	// Create a fresh test harness.
-	harness, err := New(&chaincfg.SimNetParams, nil, nil)
+	harness, err := NewHarness(&chaincfg.RegressionNetParams)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -126,6 +133,65 @@ func testConnectNode(r *Harness, t *testing.T) {
 	assertConnectedTo(t, harness, r)
 }
 
+// waitConnectedTo polls the peers of nodeA until it is connected to nodeB or
+// the passed timeout expires.
+func waitConnectedTo(t *testing.T, nodeA *Harness, nodeB *Harness, timeout time.Duration) {
+	nodeAddr := nodeB.P2PAddress()
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		nodeAPeers, err := nodeA.Node.GetPeerInfo()
+		if err != nil {
+			t.Fatalf("unable to get nodeA's peer info: %v", err)
+		}
+		for _, peerInfo := range nodeAPeers {
+			if peerInfo.Addr == nodeAddr {
+				return
+			}
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Fatalf("nodeA not connected to nodeB after %v", timeout)
+}
+
+func testAddNodeReconnect(r *Harness, t *testing.T) {
+	// Create a fresh test harness.
+	harness, err := NewHarness(&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := harness.SetUp(false, 0); err != nil {
+		t.Fatalf("unable to complete rpctest setup: %v", err)
+	}
+	defer harness.TearDown()
+
+	// Add the new harness to the main harness at runtime and wait for the
+	// connection.
+	targetAddr := harness.P2PAddress()
+	if err := r.Node.AddNode(targetAddr, btcjson.ANAdd); err != nil {
+		t.Fatalf("unable to add node: %v", err)
+	}
+	waitConnectedTo(t, r, harness, 10*time.Second)
+
+	// Kill the added node and start it again.  The main harness should
+	// reconnect to it on its own.
+	if err := harness.node.stop(); err != nil {
+		t.Fatalf("unable to stop added node: %v", err)
+	}
+	harness.node.cmd = harness.node.config.command()
+	if err := harness.node.start(); err != nil {
+		t.Fatalf("unable to restart added node: %v", err)
+	}
+	waitConnectedTo(t, r, harness, time.Minute)
+
+	// Remove the node and ensure it is no longer listed as an added node.
+	if err := r.Node.AddNode(targetAddr, btcjson.ANRemove); err != nil {
+		t.Fatalf("unable to remove node: %v", err)
+	}
+	if _, err := r.Node.GetAddedNodeInfoNoDNS(targetAddr); err == nil {
+		t.Fatalf("removed node %v still listed", targetAddr)
+	}
+}
+
 func testTearDownAll(t *testing.T) {
 	// Grab a local copy of the currently active harnesses before
 	// attempting to tear them all down.
@@ -154,7 +220,7 @@ func testActiveHarnesses(r *Harness, t *testing.T) {
 	numInitialHarnesses := len(ActiveHarnesses())
 
 	// Create a single test harness.
-	harness1, err := New(&chaincfg.SimNetParams, nil, nil)
+	harness1, err := NewHarness(&chaincfg.RegressionNetParams)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -182,7 +248,7 @@ func testJoinMempools(r *Harness, t *testing.T) {
 	// Create a local test harness with only the genesis block.  The nodes
 	// will be synced below so the same transaction can be sent to both
 	// nodes without it being an orphan.
-	harness, err := New(&chaincfg.SimNetParams, nil, nil)
+	harness, err := NewHarness(&chaincfg.RegressionNetParams)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -199,8 +265,7 @@ func testJoinMempools(r *Harness, t *testing.T) {
 		t.Fatalf("unable to join node on mempools: %v", err)
 	}
 
-	// Generate a coinbase spend to a new address within the main harness'
-	// mempool.
+	// Generate a spend to a new address within the main harness' mempool.
 	addr, err := r.NewAddress()
 	addrScript, err := txscript.PayToAddrScript(addr)
 	if err != nil {
@@ -209,7 +274,7 @@ func testJoinMempools(r *Harness, t *testing.T) {
 	output := wire.NewTxOut(5e8, addrScript)
 	testTx, err := r.CreateTransaction([]*wire.TxOut{output}, 10)
 	if err != nil {
-		t.Fatalf("coinbase spend failed: %v", err)
+		t.Fatalf("spend failed: %v", err)
 	}
 	if _, err := r.Node.SendRawTransaction(testTx, true); err != nil {
 		t.Fatalf("send transaction failed: %v", err)
@@ -282,7 +347,7 @@ func testJoinMempools(r *Harness, t *testing.T) {
 func testJoinBlocks(r *Harness, t *testing.T) {
 	// Create a second harness with only the genesis block so it is behind
 	// the main harness.
-	harness, err := New(&chaincfg.SimNetParams, nil, nil)
+	harness, err := NewHarness(&chaincfg.RegressionNetParams)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -372,8 +437,9 @@ func testGenerateAndSubmitBlock(r *Harness, t *testing.T) {
 	// Next generate a block with a "non-standard" block version along with
 	// time stamp a minute after the previous block's timestamp.
 	timestamp := block.MsgBlock().Header.Timestamp.Add(time.Minute)
-	targetBlockVersion := int32(1337)
-	block, err = r.GenerateAndSubmitBlock(nil, targetBlockVersion, timestamp)
+	targetBlockVersion := uint32(1337)
+	block, err = r.GenerateAndSubmitBlock(nil, int32(targetBlockVersion),
+		timestamp)
 	if err != nil {
 		t.Fatalf("unable to generate block: %v", err)
 	}
@@ -392,10 +458,471 @@ func testGenerateAndSubmitBlock(r *Harness, t *testing.T) {
 	}
 }
 
+func testOrphanBlocks(r *Harness, t *testing.T) {
+	// Create a second harness with only the genesis block which is not
+	// connected to any peers, so it can only learn about blocks submitted
+	// to it.
+	harness, err := NewHarness(&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := harness.SetUp(false, 0); err != nil {
+		t.Fatalf("unable to complete rpctest setup: %v", err)
+	}
+	defer harness.TearDown()
+
+	// Fetch the first two blocks of the main harness.
+	var blocks [2]*provautil.Block
+	for i := range blocks {
+		hash, err := r.Node.GetBlockHash(int64(i + 1))
+		if err != nil {
+			t.Fatalf("unable to get block hash: %v", err)
+		}
+		msgBlock, err := r.Node.GetBlock(hash)
+		if err != nil {
+			t.Fatalf("unable to get block: %v", err)
+		}
+		blocks[i] = provautil.NewBlock(msgBlock)
+	}
+
+	// Submit the child before its parent.  It is kept as an orphan instead
+	// of being connected.
+	err = harness.Node.SubmitBlock(blocks[1])
+	if err == nil || !strings.Contains(err.Error(), "inconclusive") {
+		t.Fatalf("orphan block not reported as inconclusive: %v", err)
+	}
+	_, height, err := harness.Node.GetBestBlock()
+	if err != nil {
+		t.Fatalf("unable to get best block: %v", err)
+	}
+	if height != 0 {
+		t.Fatalf("orphan block connected at height %d", height)
+	}
+
+	// Submit the parent, which connects both blocks without the child
+	// being downloaded again, since the harness has no peers to download
+	// it from.
+	if err := harness.Node.SubmitBlock(blocks[0]); err != nil {
+		t.Fatalf("unable to submit parent block: %v", err)
+	}
+	hash, height, err := harness.Node.GetBestBlock()
+	if err != nil {
+		t.Fatalf("unable to get best block: %v", err)
+	}
+	if height != 2 || !hash.IsEqual(blocks[1].Hash()) {
+		t.Fatalf("best block is %v at height %d, want %v at height 2",
+			hash, height, blocks[1].Hash())
+	}
+	peers, err := harness.Node.GetPeerInfo()
+	if err != nil {
+		t.Fatalf("unable to get peer info: %v", err)
+	}
+	if len(peers) != 0 {
+		t.Fatalf("harness unexpectedly has %d peers", len(peers))
+	}
+}
+
+// peerInfoByAddr returns the peer info of the passed harness for the peer with
+// the passed address, or nil when it is not connected to such a peer.
+func peerInfoByAddr(t *testing.T, h *Harness, addr string) *btcjson.GetPeerInfoResult {
+	peers, err := h.Node.GetPeerInfo()
+	if err != nil {
+		t.Fatalf("unable to get peer info: %v", err)
+	}
+	for i := range peers {
+		if peers[i].Addr == addr {
+			return &peers[i]
+		}
+	}
+	return nil
+}
+
+func testRelayNoEcho(r *Harness, t *testing.T) {
+	// Create a chain of three nodes, where the main harness only relays
+	// blocks to the middle node, which relays them to the last node.
+	var harnesses [2]*Harness
+	for i := range harnesses {
+		harness, err := NewHarness(&chaincfg.RegressionNetParams)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := harness.SetUp(false, 0); err != nil {
+			t.Fatalf("unable to complete rpctest setup: %v", err)
+		}
+		defer harness.TearDown()
+		harnesses[i] = harness
+	}
+	middle, last := harnesses[0], harnesses[1]
+	if err := ConnectNode(middle, r); err != nil {
+		t.Fatalf("unable to connect harnesses: %v", err)
+	}
+	if err := ConnectNode(last, middle); err != nil {
+		t.Fatalf("unable to connect harnesses: %v", err)
+	}
+	nodes := []*Harness{r, middle, last}
+	if err := JoinNodes(nodes, Blocks); err != nil {
+		t.Fatalf("unable to join node on blocks: %v", err)
+	}
+
+	// Mine a block on the main harness and wait for it to reach the last
+	// node.
+	origin := peerInfoByAddr(t, middle, r.P2PAddress())
+	if origin == nil {
+		t.Fatal("middle node not connected to the main harness")
+	}
+	if _, err := r.Node.Generate(1); err != nil {
+		t.Fatalf("unable to generate block: %v", err)
+	}
+	if err := JoinNodes(nodes, Blocks); err != nil {
+		t.Fatalf("unable to join node on blocks: %v", err)
+	}
+
+	// The middle node skips announcing the block back to the main harness
+	// it came from.
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		info := peerInfoByAddr(t, middle, r.P2PAddress())
+		if info == nil {
+			t.Fatal("middle node disconnected from the main harness")
+		}
+		if info.BlocksAnnounced != origin.BlocksAnnounced {
+			t.Fatalf("middle node announced %d blocks back to the "+
+				"main harness", info.BlocksAnnounced-
+				origin.BlocksAnnounced)
+		}
+		if info.KnownInvSkipped > origin.KnownInvSkipped {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("middle node never relayed the block")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	// The last node got the block from the middle node, which it does not
+	// announce back either.
+	info := peerInfoByAddr(t, last, middle.P2PAddress())
+	if info == nil {
+		t.Fatal("last node not connected to the middle node")
+	}
+	if info.BlocksAnnounced != 0 {
+		t.Fatalf("last node announced %d blocks back to the middle "+
+			"node", info.BlocksAnnounced)
+	}
+	peers, err := middle.Node.GetPeerInfo()
+	if err != nil {
+		t.Fatalf("unable to get peer info: %v", err)
+	}
+	for _, peer := range peers {
+		if peer.Addr != r.P2PAddress() && peer.BlocksAnnounced == 0 {
+			t.Fatalf("middle node did not announce the block to %v",
+				peer.Addr)
+		}
+	}
+}
+
+// signOwnerInputs signs every input of the passed transaction, which spend
+// outputs of the passed amounts paying pkScript, with the owner key and the
+// first ASP key of the wallet of the harness.
+func signOwnerInputs(r *Harness, t *testing.T, tx *wire.MsgTx, amts []int64,
+	pkScript []byte, ownerKey *btcec.PrivateKey) {
+
+	sigHashes := txscript.NewTxSigHashes(tx)
+	for i, txIn := range tx.TxIn {
+		var sigs []txscript.PartialSig
+		signers := []struct {
+			keyID btcec.KeyID
+			key   *btcec.PrivateKey
+		}{
+			{btcec.ReservedKeyID, ownerKey},
+			{r.wallet.keyIDs[0], r.wallet.aspKey},
+		}
+		for _, signer := range signers {
+			sig, err := txscript.SignInputPartial(tx, i, amts[i],
+				pkScript, txscript.SigHashAll, signer.keyID,
+				signer.key, sigHashes)
+			if err != nil {
+				t.Fatalf("unable to sign input %d: %v", i, err)
+			}
+			sigs = append(sigs, *sig)
+		}
+		var err error
+		txIn.SignatureScript, err = txscript.CombinePartialSigs(tx, i,
+			amts[i], pkScript, sigs, sigHashes)
+		if err != nil {
+			t.Fatalf("unable to combine signatures: %v", err)
+		}
+	}
+}
+
+func testFundRawTransaction(r *Harness, t *testing.T) {
+	// Pay two outputs to a Prova address owned by a key of the test which
+	// is cosigned by the ASP keys of the harness wallet.
+	ownerKey, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+	addr, err := keyToAddr(ownerKey, r.wallet.keyIDs, r.ActiveNet)
+	if err != nil {
+		t.Fatalf("unable to create address: %v", err)
+	}
+	pkScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		t.Fatalf("unable to generate pkscript to addr: %v", err)
+	}
+	outputs := []*wire.TxOut{
+		wire.NewTxOut(5*provautil.AtomsPerGram, pkScript),
+		wire.NewTxOut(3*provautil.AtomsPerGram, pkScript),
+	}
+	if _, err := r.SendOutputs(outputs, 10); err != nil {
+		t.Fatalf("unable to send outputs: %v", err)
+	}
+	if _, err := r.Node.Generate(1); err != nil {
+		t.Fatalf("unable to generate block: %v", err)
+	}
+
+	// Addresses of another network are rejected.
+	mainAddr, err := keyToAddr(ownerKey, r.wallet.keyIDs,
+		&chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unable to create address: %v", err)
+	}
+	_, err = r.Node.CreateRawTransaction(nil,
+		map[string]float64{mainAddr.EncodeAddress(): 1})
+	if rpcErr, ok := err.(*btcjson.RPCError); !ok ||
+		rpcErr.Code != btcjson.ErrRPCInvalidAddressOrKey {
+
+		t.Fatalf("createrawtransaction with an address of another "+
+			"network: unexpected error %v", err)
+	}
+
+	// Fund a payment of 6 RMG from the outputs of the address, which
+	// takes both of them.  The fee rate is passed since the node has no
+	// minimum relay fee rate and no data to estimate one.
+	destAddr, err := r.NewAddress()
+	if err != nil {
+		t.Fatalf("unable to get new address: %v", err)
+	}
+	destScript, err := txscript.PayToAddrScript(destAddr)
+	if err != nil {
+		t.Fatalf("unable to generate pkscript to addr: %v", err)
+	}
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxOut(wire.NewTxOut(6*provautil.AtomsPerGram, destScript))
+	options := btcjson.FundRawTransactionOpts{
+		ChangeAddress: mainAddr.EncodeAddress(),
+		Addresses:     []string{addr.EncodeAddress()},
+		FeeRate:       btcjson.Float64(0.001),
+	}
+	_, _, err = r.Node.FundRawTransaction(tx, options)
+	if rpcErr, ok := err.(*btcjson.RPCError); !ok ||
+		rpcErr.Code != btcjson.ErrRPCInvalidAddressOrKey {
+
+		t.Fatalf("fundrawtransaction with a change address of "+
+			"another network: unexpected error %v", err)
+	}
+	options.ChangeAddress = addr.EncodeAddress()
+	funded, result, err := r.Node.FundRawTransaction(tx, options)
+	if err != nil {
+		t.Fatalf("unable to fund transaction: %v", err)
+	}
+	if len(funded.TxIn) != 2 || len(funded.TxOut) != 2 ||
+		result.ChangePos != 1 {
+
+		t.Fatalf("funded transaction has %d inputs and %d outputs "+
+			"with change at %d, want 2 inputs and change at 1",
+			len(funded.TxIn), len(funded.TxOut), result.ChangePos)
+	}
+	fee, err := provautil.NewAmount(result.Fee)
+	if err != nil || fee <= 0 {
+		t.Fatalf("unexpected fee %v", result.Fee)
+	}
+	if funded.TxOut[1].Value != 2*provautil.AtomsPerGram-int64(fee) {
+		t.Fatalf("got change %d, want %d", funded.TxOut[1].Value,
+			2*provautil.AtomsPerGram-int64(fee))
+	}
+
+	// Creating the funded transaction reports the same fee.
+	inputs := make([]*wire.OutPoint, 0, len(funded.TxIn))
+	for _, txIn := range funded.TxIn {
+		inputs = append(inputs, &txIn.PreviousOutPoint)
+	}
+	created, err := r.Node.CreateRawTransaction(inputs, map[string]float64{
+		destAddr.EncodeAddress(): 6,
+		addr.EncodeAddress():     provautil.Amount(funded.TxOut[1].Value).ToRMG(),
+	})
+	if err != nil {
+		t.Fatalf("unable to create transaction: %v", err)
+	}
+	if created.Fee != result.Fee {
+		t.Fatalf("createrawtransaction reported fee %v, want %v",
+			created.Fee, result.Fee)
+	}
+
+	// Sign the transaction, then submit it and mine it.
+	amts := make([]int64, 0, len(funded.TxIn))
+	for _, txIn := range funded.TxIn {
+		txOut, err := r.Node.GetTxOut(&txIn.PreviousOutPoint, false)
+		if err != nil || txOut == nil {
+			t.Fatalf("unable to get spent output: %v", err)
+		}
+		amt, err := provautil.NewAmount(txOut.Value)
+		if err != nil {
+			t.Fatalf("invalid amount: %v", err)
+		}
+		amts = append(amts, int64(amt))
+	}
+	signOwnerInputs(r, t, funded, amts, pkScript, ownerKey)
+	txHash, err := r.Node.SendRawTransaction(funded, false)
+	if err != nil {
+		t.Fatalf("unable to submit funded transaction: %v", err)
+	}
+	if _, err := r.Node.Generate(1); err != nil {
+		t.Fatalf("unable to generate block: %v", err)
+	}
+	change, err := r.Node.GetTxOut(wire.NewOutPoint(txHash, 1), false)
+	if err != nil || change == nil || change.Confirmations != 1 {
+		t.Fatalf("change output not confirmed: %v", err)
+	}
+}
+
+// testReorgResurrection ensures the transactions of the blocks disconnected
+// by a reorganization are added back to the mempool, except for the ones
+// which conflict with the new main chain.
+func testReorgResurrection(r *Harness, t *testing.T) {
+	// Use a local harness so the reorganization does not disturb the main
+	// harness.
+	harness, err := NewHarness(&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := harness.SetUp(true, 1); err != nil {
+		t.Fatalf("unable to complete rpctest setup: %v", err)
+	}
+	defer harness.TearDown()
+
+	// Pay two outputs to a Prova address owned by a key of the test and
+	// mine them.
+	ownerKey, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+	addr, err := keyToAddr(ownerKey, harness.wallet.keyIDs,
+		harness.ActiveNet)
+	if err != nil {
+		t.Fatalf("unable to create address: %v", err)
+	}
+	pkScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		t.Fatalf("unable to generate pkscript to addr: %v", err)
+	}
+	const amt = 5 * provautil.AtomsPerGram
+	outputs := []*wire.TxOut{
+		wire.NewTxOut(amt, pkScript),
+		wire.NewTxOut(amt, pkScript),
+	}
+	fundHash, err := harness.SendOutputs(outputs, 10)
+	if err != nil {
+		t.Fatalf("unable to send outputs: %v", err)
+	}
+	forkHashes, err := harness.Node.Generate(1)
+	if err != nil {
+		t.Fatalf("unable to generate block: %v", err)
+	}
+	forkBlock, err := harness.Node.GetBlock(forkHashes[0])
+	if err != nil {
+		t.Fatalf("unable to get block: %v", err)
+	}
+
+	// Create a transaction spending each output, and another one which
+	// double spends the first output.
+	spend := func(index uint32, fee int64) *provautil.Tx {
+		tx := wire.NewMsgTx(wire.TxVersion)
+		tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(fundHash, index), nil))
+		tx.AddTxOut(wire.NewTxOut(amt-fee, pkScript))
+		signOwnerInputs(harness, t, tx, []int64{amt}, pkScript, ownerKey)
+		return provautil.NewTx(tx)
+	}
+	txA := spend(0, 1e5)
+	txB := spend(0, 2e5)
+	txC := spend(1, 1e5)
+
+	// Mine the first and the last transactions, then mine the double spend
+	// on a longer side chain forking off the block before them.  The side
+	// chain blocks get the same time stamps as the main chain blocks at
+	// their heights, so they require the same difficulty.
+	nextBits := func() uint32 {
+		chainInfo, err := harness.Node.GetBlockChainInfo()
+		if err != nil {
+			t.Fatalf("unable to get chain info: %v", err)
+		}
+		bits, err := strconv.ParseUint(chainInfo.Window.NextBits, 16, 32)
+		if err != nil {
+			t.Fatalf("unable to parse bits: %v", err)
+		}
+		return uint32(bits)
+	}
+	sideBits := []uint32{nextBits()}
+	if _, err := harness.GenerateAndSubmitBlock([]*provautil.Tx{txA, txC},
+		-1, time.Time{}); err != nil {
+
+		t.Fatalf("unable to generate block: %v", err)
+	}
+	sideBits = append(sideBits, nextBits())
+	validateKey, err := harness.validateKey()
+	if err != nil {
+		t.Fatalf("unable to get validate key: %v", err)
+	}
+	prevBlock := provautil.NewBlock(forkBlock)
+	for i, txns := range [][]*provautil.Tx{{txB}, nil} {
+		var fees int64
+		if len(txns) != 0 {
+			fees = 2e5
+		}
+		block, err := createBlock(prevBlock, txns, fees, wire.BlockVersion,
+			time.Time{}, sideBits[i], validateKey,
+			harness.wallet.coinbaseAddr, harness.ActiveNet)
+		if err != nil {
+			t.Fatalf("unable to create block: %v", err)
+		}
+		// The first side chain block does not make the side chain
+		// longer, so it is reported as inconclusive.
+		err = harness.Node.SubmitBlock(block)
+		if i == 0 && err != nil && strings.Contains(err.Error(),
+			"inconclusive") {
+
+			err = nil
+		}
+		if err != nil {
+			t.Fatalf("unable to submit block: %v", err)
+		}
+		prevBlock = block
+	}
+	bestHash, _, err := harness.Node.GetBestBlock()
+	if err != nil {
+		t.Fatalf("unable to get best block: %v", err)
+	}
+	if *bestHash != *prevBlock.Hash() {
+		t.Fatalf("best block is %v, want the side chain tip %v",
+			bestHash, prevBlock.Hash())
+	}
+
+	// Only the transaction which does not conflict with the new main chain
+	// is back in the mempool.
+	poolHashes, err := harness.Node.GetRawMempool()
+	if err != nil {
+		t.Fatalf("unable to get mempool: %v", err)
+	}
+	if len(poolHashes) != 1 || *poolHashes[0] != *txC.Hash() {
+		t.Fatalf("mempool after reorganization is %v, want [%v]",
+			poolHashes, txC.Hash())
+	}
+}
+
 func testMemWalletReorg(r *Harness, t *testing.T) {
 	// Create a fresh harness, we'll be using the main harness to force a
 	// re-org on this local harness.
-	harness, err := New(&chaincfg.SimNetParams, nil, nil)
+	harness, err := NewHarness(&chaincfg.RegressionNetParams)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -472,15 +999,543 @@ func testMemWalletLockedOutputs(r *Harness, t *testing.T) {
 	}
 }
 
+// testRestart ensures a node which is shut down gracefully restores its chain
+// state and mempool when it is started again.
+// scrapeMetrics fetches the metrics served at the passed address and returns
+// the values of their series keyed by the series, including the labels of
+// histogram buckets.
+func scrapeMetrics(t *testing.T, addr string) map[string]float64 {
+	resp, err := http.Get("http://" + addr + "/metrics")
+	if err != nil {
+		t.Fatalf("unable to scrape metrics: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK ||
+		!strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain") {
+
+		t.Fatalf("unexpected metrics response: status %d, content "+
+			"type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	series := make(map[string]float64)
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.LastIndex(line, " ")
+		value, err := strconv.ParseFloat(line[i+1:], 64)
+		if i == -1 || err != nil {
+			t.Fatalf("malformed metrics line %q", line)
+		}
+		series[line[:i]] = value
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("unable to read metrics: %v", err)
+	}
+	return series
+}
+
+// waitForMetric scrapes the metrics served at the passed address until the
+// passed series has the passed value, which happens asynchronously for the
+// peer counts.
+func waitForMetric(t *testing.T, addr, name string, want float64) {
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		got, ok := scrapeMetrics(t, addr)[name]
+		if ok && got == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("metric %s is %v, want %v", name, got, want)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func testMetrics(r *Harness, t *testing.T) {
+	harnessStateMtx.Lock()
+	port, err := nextAvailablePort()
+	harnessStateMtx.Unlock()
+	if err != nil {
+		t.Fatalf("unable to get metrics port: %v", err)
+	}
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	harness, err := NewHarness(&chaincfg.RegressionNetParams,
+		WithExtraArgs("--metricslisten="+addr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := harness.SetUp(true, 1); err != nil {
+		t.Fatalf("unable to complete rpctest setup: %v", err)
+	}
+	defer harness.TearDown()
+
+	// The key series of all instrumented subsystems exist, and the ones
+	// of the blocks generated by the setup advanced.
+	before := scrapeMetrics(t, addr)
+	for _, name := range []string{
+		"prova_mempool_transactions",
+		"prova_mempool_bytes",
+		"prova_mempool_evicted_total",
+		"prova_mining_template_build_seconds_count",
+		"prova_chain_block_validation_seconds_count",
+		"prova_chain_reorg_depth_count",
+		`prova_chain_reorg_depth_bucket{le="+Inf"}`,
+		"prova_peers_inbound",
+		"prova_peers_outbound",
+		"prova_peers_persistent",
+	} {
+		if _, ok := before[name]; !ok {
+			t.Fatalf("metric %s is missing", name)
+		}
+	}
+	_, bestHeight, err := harness.Node.GetBestBlock()
+	if err != nil {
+		t.Fatalf("unable to get best block: %v", err)
+	}
+	if before["prova_chain_height"] != float64(bestHeight) ||
+		before["prova_mining_template_build_seconds_count"] == 0 ||
+		before["prova_chain_block_validation_seconds_count"] == 0 {
+
+		t.Fatalf("metrics did not track the generated blocks: %v", before)
+	}
+
+	// The mempool metrics track a new transaction.
+	addr2, err := harness.NewAddress()
+	if err != nil {
+		t.Fatalf("unable to get new address: %v", err)
+	}
+	addrScript, err := txscript.PayToAddrScript(addr2)
+	if err != nil {
+		t.Fatalf("unable to generate pkscript to addr: %v", err)
+	}
+	output := wire.NewTxOut(1e7, addrScript)
+	if _, err := harness.SendOutputs([]*wire.TxOut{output}, 10); err != nil {
+		t.Fatalf("spend failed: %v", err)
+	}
+	pooled := scrapeMetrics(t, addr)
+	if pooled["prova_mempool_transactions"] != 1 ||
+		pooled["prova_mempool_bytes"] == 0 ||
+		pooled["prova_mempool_added_total"] != before["prova_mempool_added_total"]+1 {
+
+		t.Fatalf("mempool metrics did not track the transaction: %v",
+			pooled)
+	}
+
+	// Mining the transaction advances the template, validation and height
+	// series and empties the mempool.
+	if _, err := harness.Node.Generate(1); err != nil {
+		t.Fatalf("unable to generate block: %v", err)
+	}
+	after := scrapeMetrics(t, addr)
+	for _, name := range []string{
+		"prova_chain_height",
+		"prova_chain_blocks_connected_total",
+		"prova_mining_template_build_seconds_count",
+		"prova_chain_block_validation_seconds_count",
+	} {
+		if after[name] != pooled[name]+1 {
+			t.Fatalf("metric %s is %v, want %v", name, after[name],
+				pooled[name]+1)
+		}
+	}
+	if after["prova_mempool_transactions"] != 0 {
+		t.Fatalf("mempool metrics still track %v mined transactions",
+			after["prova_mempool_transactions"])
+	}
+
+	// The peer gauges follow peers connecting and disconnecting.
+	peer, err := NewHarness(&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := peer.SetUp(false, 0); err != nil {
+		t.Fatalf("unable to complete rpctest setup: %v", err)
+	}
+	if err := ConnectNode(peer, harness); err != nil {
+		peer.TearDown()
+		t.Fatalf("unable to connect harnesses: %v", err)
+	}
+	waitForMetric(t, addr, "prova_peers_inbound", 1)
+	if err := peer.TearDown(); err != nil {
+		t.Fatalf("unable to tear down peer: %v", err)
+	}
+	waitForMetric(t, addr, "prova_peers_inbound", 0)
+
+	// The getmetrics RPC returns the same metrics.
+	results, err := harness.Node.GetMetrics()
+	if err != nil {
+		t.Fatalf("getmetrics: unexpected error: %v", err)
+	}
+	found := 0
+	for _, result := range results {
+		switch result.Name {
+		case "prova_chain_height":
+			if result.Value == nil ||
+				*result.Value != after["prova_chain_height"] {
+
+				t.Fatalf("getmetrics: unexpected chain height %+v",
+					result)
+			}
+			found++
+
+		case "prova_chain_block_validation_seconds":
+			last := len(result.Buckets) - 1
+			if result.Count == nil || last < 0 ||
+				result.Buckets[last].UpperBound != "+Inf" ||
+				result.Buckets[last].Count != *result.Count {
+
+				t.Fatalf("getmetrics: unexpected histogram %+v",
+					result)
+			}
+			found++
+		}
+	}
+	if found != 2 {
+		t.Fatalf("getmetrics: key metrics missing from %+v", results)
+	}
+}
+
+func testRebroadcastNewPeer(r *Harness, t *testing.T) {
+	// Submit a transaction to a node without peers, so announcing it right
+	// away reaches nobody.
+	harness, err := NewHarness(&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := harness.SetUp(true, 1); err != nil {
+		t.Fatalf("unable to complete rpctest setup: %v", err)
+	}
+	defer harness.TearDown()
+	addr, err := harness.NewAddress()
+	if err != nil {
+		t.Fatalf("unable to get new address: %v", err)
+	}
+	addrScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		t.Fatalf("unable to generate pkscript to addr: %v", err)
+	}
+	output := wire.NewTxOut(1e7, addrScript)
+	txid, err := harness.SendOutputs([]*wire.TxOut{output}, 10)
+	if err != nil {
+		t.Fatalf("spend failed: %v", err)
+	}
+	pending, err := harness.Node.GetPendingBroadcasts()
+	if err != nil {
+		t.Fatalf("getpendingbroadcasts: unexpected error: %v", err)
+	}
+	if len(pending) != 1 || pending[0].TxID != txid.String() {
+		t.Fatalf("getpendingbroadcasts: got %+v, want %v", pending, txid)
+	}
+
+	// Connect a peer and wait for the node to announce the pending
+	// transaction to it, which the peer then requests and adds to its
+	// mempool.
+	peer, err := NewHarness(&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := peer.SetUp(false, 0); err != nil {
+		t.Fatalf("unable to complete rpctest setup: %v", err)
+	}
+	defer peer.TearDown()
+	if err := ConnectNode(peer, harness); err != nil {
+		t.Fatalf("unable to connect harnesses: %v", err)
+	}
+	if err := JoinNodes([]*Harness{harness, peer}, Blocks); err != nil {
+		t.Fatalf("unable to join node on blocks: %v", err)
+	}
+	deadline := time.Now().Add(20 * time.Second)
+	for {
+		peers, err := harness.Node.GetPeerInfo()
+		if err != nil {
+			t.Fatalf("unable to get peer info: %v", err)
+		}
+		if len(peers) == 1 && peers[0].TxsAnnounced == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("pending transaction was not announced to the "+
+				"new peer: %+v", peers)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	for {
+		pool, err := peer.Node.GetRawMempool()
+		if err != nil {
+			t.Fatalf("unable to get mempool: %v", err)
+		}
+		if len(pool) == 1 && pool[0].IsEqual(txid) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("peer mempool is %v, want %v", pool, txid)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	// Mining the transaction stops announcing it.
+	if _, err := harness.Node.Generate(1); err != nil {
+		t.Fatalf("unable to generate block: %v", err)
+	}
+	deadline = time.Now().Add(10 * time.Second)
+	for {
+		pending, err := harness.Node.GetPendingBroadcasts()
+		if err != nil {
+			t.Fatalf("getpendingbroadcasts: unexpected error: %v",
+				err)
+		}
+		if len(pending) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("mined transaction is still pending: %+v",
+				pending)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func testRestart(r *Harness, t *testing.T) {
+	// Use a local harness so restarting it does not disturb the
+	// connections to the main harness.
+	harness, err := NewHarness(&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := harness.SetUp(true, 1); err != nil {
+		t.Fatalf("unable to complete rpctest setup: %v", err)
+	}
+	defer harness.TearDown()
+
+	addr, err := harness.NewAddress()
+	if err != nil {
+		t.Fatalf("unable to get new address: %v", err)
+	}
+	addrScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		t.Fatalf("unable to generate pkscript to addr: %v", err)
+	}
+	output := wire.NewTxOut(1e7, addrScript)
+	txid, err := harness.SendOutputs([]*wire.TxOut{output}, 10)
+	if err != nil {
+		t.Fatalf("spend failed: %v", err)
+	}
+	bestHash, bestHeight, err := harness.Node.GetBestBlock()
+	if err != nil {
+		t.Fatalf("unable to get best block: %v", err)
+	}
+
+	if err := harness.Restart(); err != nil {
+		t.Fatalf("unable to restart node: %v", err)
+	}
+
+	hash, height, err := harness.Node.GetBestBlock()
+	if err != nil {
+		t.Fatalf("unable to get best block: %v", err)
+	}
+	if *hash != *bestHash || height != bestHeight {
+		t.Fatalf("best block after restart is %v (height %d), want %v "+
+			"(height %d)", hash, height, bestHash, bestHeight)
+	}
+	poolHashes, err := harness.Node.GetRawMempool()
+	if err != nil {
+		t.Fatalf("unable to get mempool: %v", err)
+	}
+	if len(poolHashes) != 1 || *poolHashes[0] != *txid {
+		t.Fatalf("mempool after restart is %v, want [%v]", poolHashes,
+			txid)
+	}
+
+	// The restored chain state must be able to confirm the restored
+	// transaction.
+	blockHashes, err := harness.Node.Generate(1)
+	if err != nil {
+		t.Fatalf("unable to generate block: %v", err)
+	}
+	block, err := harness.Node.GetBlock(blockHashes[0])
+	if err != nil {
+		t.Fatalf("unable to get block: %v", err)
+	}
+	for _, tx := range block.Transactions {
+		if tx.TxHash() == *txid {
+			return
+		}
+	}
+	t.Fatalf("restored transaction %v not mined in block %v", txid,
+		blockHashes[0])
+}
+
+// testTimeLockOutputs ensures outputs locked by a lock time are accepted once
+// the CLTV deployment which enforces OP_CHECKLOCKTIMEVERIFY is active, which it
+// always is on the regression test network, and can then be mined and spent by
+// transactions which are final past the lock height.  A separate harness is
+// used so the other tests are not affected by the blocks it generates.
+func testTimeLockOutputs(r *Harness, t *testing.T) {
+	harness, err := NewHarness(&chaincfg.RegressionNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := harness.SetUp(true, 1); err != nil {
+		t.Fatalf("unable to complete rpctest setup: %v", err)
+	}
+	defer harness.TearDown()
+
+	ownerKey, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+	addr, err := keyToAddr(ownerKey, harness.wallet.keyIDs,
+		harness.ActiveNet)
+	if err != nil {
+		t.Fatalf("unable to create address: %v", err)
+	}
+	provaScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		t.Fatalf("unable to generate pkscript to addr: %v", err)
+	}
+	info, err := harness.Node.GetBlockChainInfo()
+	if err != nil {
+		t.Fatalf("unable to get blockchain info: %v", err)
+	}
+	cltvActive := false
+	for _, deployment := range info.Deployments {
+		if deployment.ID == "cltv" {
+			cltvActive = deployment.Active
+		}
+	}
+	if !cltvActive {
+		t.Fatal("getblockchaininfo does not report the cltv deployment " +
+			"as active")
+	}
+	_, bestHeight, err := harness.Node.GetBestBlock()
+	if err != nil {
+		t.Fatalf("unable to get best block: %v", err)
+	}
+
+	// Mine an output which can only be spent in a block after the one
+	// following the next one.
+	lockHeight := bestHeight + 2
+	lockScript, err := txscript.NewScriptBuilder().
+		AddInt64(int64(lockHeight)).
+		AddOp(txscript.OP_CHECKLOCKTIMEVERIFY).
+		AddOp(txscript.OP_DROP).AddOps(provaScript).Script()
+	if err != nil {
+		t.Fatalf("unable to create time lock script: %v", err)
+	}
+	output := wire.NewTxOut(5*provautil.AtomsPerGram, lockScript)
+	lockTxHash, err := harness.SendOutputs([]*wire.TxOut{output}, 10)
+	if err != nil {
+		t.Fatalf("unable to send time-locked output: %v", err)
+	}
+	if _, err := harness.Node.Generate(1); err != nil {
+		t.Fatalf("unable to generate block: %v", err)
+	}
+	lockOutPoint := wire.NewOutPoint(lockTxHash, 0)
+	lockOut, err := harness.Node.GetTxOut(lockOutPoint, false)
+	if err != nil {
+		t.Fatalf("unable to get time-locked output: %v", err)
+	}
+	if lockOut == nil || lockOut.Confirmations != 1 {
+		t.Fatalf("time-locked output %v not mined", lockOutPoint)
+	}
+
+	// spendLockTx returns a transaction with the passed lock time which
+	// spends the time-locked output.
+	destAddr, err := harness.NewAddress()
+	if err != nil {
+		t.Fatalf("unable to get new address: %v", err)
+	}
+	destScript, err := txscript.PayToAddrScript(destAddr)
+	if err != nil {
+		t.Fatalf("unable to generate pkscript to addr: %v", err)
+	}
+	spendLockTx := func(lockTime uint32) *wire.MsgTx {
+		tx := wire.NewMsgTx(wire.TxVersion)
+		tx.LockTime = lockTime
+		tx.AddTxIn(&wire.TxIn{
+			PreviousOutPoint: *lockOutPoint,
+			Sequence:         wire.MaxTxInSequenceNum - 1,
+		})
+		tx.AddTxOut(wire.NewTxOut(4*provautil.AtomsPerGram, destScript))
+		lookupKey := func(provautil.Address) ([]txscript.PrivateKey, error) {
+			return []txscript.PrivateKey{
+				{Key: ownerKey, Compressed: true},
+				{Key: harness.wallet.aspKey, Compressed: true},
+			}, nil
+		}
+		sigScript, err := txscript.SignTxOutput(harness.ActiveNet, tx,
+			0, 5*provautil.AtomsPerGram, lockScript,
+			txscript.SigHashAll, txscript.KeyClosure(lookupKey), nil)
+		if err != nil {
+			t.Fatalf("unable to sign transaction: %v", err)
+		}
+		tx.TxIn[0].SignatureScript = sigScript
+		return tx
+	}
+
+	// A spend which is not final in the next block is rejected.
+	if _, err := harness.Node.SendRawTransaction(spendLockTx(lockHeight),
+		true); err == nil {
+
+		t.Fatal("spend of time-locked output accepted before the " +
+			"lock height")
+	}
+
+	// Once the next block is past the lock height, a spend whose lock time
+	// is before the lock height is still rejected, while one whose lock
+	// time is the lock height is accepted and mined.
+	if _, err := harness.Node.Generate(1); err != nil {
+		t.Fatalf("unable to generate block: %v", err)
+	}
+	if _, err := harness.Node.SendRawTransaction(
+		spendLockTx(lockHeight-1), true); err == nil {
+
+		t.Fatal("spend of time-locked output with a lock time before " +
+			"the lock height accepted")
+	}
+	spendTxHash, err := harness.Node.SendRawTransaction(
+		spendLockTx(lockHeight), true)
+	if err != nil {
+		t.Fatalf("unable to spend time-locked output: %v", err)
+	}
+	blockHashes, err := harness.Node.Generate(1)
+	if err != nil {
+		t.Fatalf("unable to generate block: %v", err)
+	}
+	block, err := harness.Node.GetBlock(blockHashes[0])
+	if err != nil {
+		t.Fatalf("unable to get block: %v", err)
+	}
+	for _, tx := range block.Transactions {
+		if tx.TxHash() == *spendTxHash {
+			return
+		}
+	}
+	t.Fatalf("spend of time-locked output %v not mined in block %v",
+		spendTxHash, blockHashes[0])
+}
+
 var harnessTestCases = []HarnessTestCase{
 	testSendOutputs,
 	testConnectNode,
+	testAddNodeReconnect,
 	testActiveHarnesses,
 	testJoinBlocks,
 	testJoinMempools, // Depends on results of testJoinBlocks
 	testGenerateAndSubmitBlock,
+	testOrphanBlocks,
+	testRelayNoEcho,
+	testFundRawTransaction,
+	testTimeLockOutputs,
+	testReorgResurrection,
 	testMemWalletReorg,
 	testMemWalletLockedOutputs,
+	testMetrics,
+	testRebroadcastNewPeer,
+	testRestart,
 }
 
 var mainHarness *Harness
@@ -491,14 +1546,14 @@ const (
 
 func TestMain(m *testing.M) {
 	var err error
-	mainHarness, err = New(&chaincfg.SimNetParams, nil, nil)
+	mainHarness, err = NewHarness(&chaincfg.RegressionNetParams)
 	if err != nil {
 		fmt.Println("unable to create main harness: ", err)
 		os.Exit(1)
 	}
 
-	// Initialize the main mining node with a chain of length 125,
-	// providing 25 mature coinbases to allow spending from for testing
+	// Initialize the main mining node with a chain of length 101, whose
+	// last block issues 25 outputs to allow spending from for testing
 	// purposes.
 	if err = mainHarness.SetUp(true, numMatureOutputs); err != nil {
 		fmt.Println("unable to setup test chain: ", err)
@@ -526,8 +1581,7 @@ func TestMain(m *testing.M) {
 }
 
 func TestHarness(t *testing.T) {
-	// We should have (numMatureOutputs * 50 RMG) of mature unspendable
-	// outputs.
+	// We should have (numMatureOutputs * 50 RMG) of spendable outputs.
 	expectedBalance := provautil.Amount(numMatureOutputs * 50 * provautil.AtomsPerGram)
 	harnessBalance := mainHarness.ConfirmedBalance()
 	if harnessBalance != expectedBalance {
@@ -535,13 +1589,13 @@ func TestHarness(t *testing.T) {
 			expectedBalance, harnessBalance)
 	}
 
-	// Current tip should be at a height of numMatureOutputs plus the
-	// required number of blocks for coinbase maturity.
+	// Current tip should be at a height of the required number of blocks
+	// for coinbase maturity plus the block issuing the outputs.
 	nodeInfo, err := mainHarness.Node.GetInfo()
 	if err != nil {
 		t.Fatalf("unable to execute getinfo on node: %v", err)
 	}
-	expectedChainHeight := numMatureOutputs + uint32(mainHarness.ActiveNet.CoinbaseMaturity)
+	expectedChainHeight := uint32(mainHarness.ActiveNet.CoinbaseMaturity) + 1
 	if uint32(nodeInfo.Blocks) != expectedChainHeight {
 		t.Errorf("Chain height is %v, should be %v",
 			nodeInfo.Blocks, expectedChainHeight)
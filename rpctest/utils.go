@@ -6,11 +6,10 @@
 package rpctest
 
 import (
-	"reflect"
 	"time"
 
+	"github.com/bitgo/prova/btcjson"
 	"github.com/bitgo/prova/chaincfg/chainhash"
-	"github.com/btcsuite/btcrpcclient"
 )
 
 // JoinType is an enum representing a particular type of "node join". A node
@@ -44,6 +43,24 @@ func JoinNodes(nodes []*Harness, joinType JoinType) error {
 	return nil
 }
 
+// sameHashes returns whether the passed slices hold the same hashes, in any
+// order.
+func sameHashes(a, b []*chainhash.Hash) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	set := make(map[chainhash.Hash]struct{}, len(a))
+	for _, hash := range a {
+		set[*hash] = struct{}{}
+	}
+	for _, hash := range b {
+		if _, ok := set[*hash]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
 // syncMempools blocks until all nodes have identical mempools.
 func syncMempools(nodes []*Harness) error {
 	poolsMatch := false
@@ -64,7 +81,7 @@ retry:
 				return err
 			}
 
-			if !reflect.DeepEqual(firstPool, nodePool) {
+			if !sameHashes(firstPool, nodePool) {
 				time.Sleep(time.Millisecond * 100)
 				continue retry
 			}
@@ -83,7 +100,7 @@ func syncBlocks(nodes []*Harness) error {
 retry:
 	for !blocksMatch {
 		var prevHash *chainhash.Hash
-		var prevHeight int32
+		var prevHeight uint32
 		for _, node := range nodes {
 			blockHash, blockHeight, err := node.Node.GetBestBlock()
 			if err != nil {
@@ -116,7 +133,7 @@ func ConnectNode(from *Harness, to *Harness) error {
 	numPeers := len(peerInfo)
 
 	targetAddr := to.node.config.listen
-	if err := from.Node.AddNode(targetAddr, btcrpcclient.ANAdd); err != nil {
+	if err := from.Node.AddNode(targetAddr, btcjson.ANAdd); err != nil {
 		return err
 	}
 
@@ -126,6 +143,7 @@ func ConnectNode(from *Harness, to *Harness) error {
 		return err
 	}
 	for len(peerInfo) <= numPeers {
+		time.Sleep(time.Millisecond * 50)
 		peerInfo, err = from.Node.GetPeerInfo()
 		if err != nil {
 			return err
@@ -9,8 +9,6 @@ package main
 import (
 	"bytes"
 	"container/list"
-	"crypto/sha256"
-	"crypto/subtle"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
@@ -22,6 +20,7 @@ import (
 	"time"
 
 	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/btcec"
 	"github.com/bitgo/prova/btcjson"
 	"github.com/bitgo/prova/chaincfg/chainhash"
 	"github.com/bitgo/prova/database"
@@ -65,15 +64,19 @@ var wsHandlers map[string]wsCommandHandler
 var wsHandlersBeforeInit = map[string]wsCommandHandler{
 	"loadtxfilter":              handleLoadTxFilter,
 	"help":                      handleWebsocketHelp,
+	"notifyadminthreads":        handleNotifyAdminThreads,
 	"notifyblocks":              handleNotifyBlocks,
 	"notifynewtransactions":     handleNotifyNewTransactions,
 	"notifyreceived":            handleNotifyReceived,
 	"notifyspent":               handleNotifySpent,
+	"notifyvalidatorset":        handleNotifyValidatorSet,
 	"session":                   handleSession,
+	"stopnotifyadminthreads":    handleStopNotifyAdminThreads,
 	"stopnotifyblocks":          handleStopNotifyBlocks,
 	"stopnotifynewtransactions": handleStopNotifyNewTransactions,
 	"stopnotifyspent":           handleStopNotifySpent,
 	"stopnotifyreceived":        handleStopNotifyReceived,
+	"stopnotifyvalidatorset":    handleStopNotifyValidatorSet,
 	"rescan":                    handleRescan,
 	"rescanblocks":              handleRescanBlocks,
 }
@@ -84,7 +87,7 @@ var wsHandlersBeforeInit = map[string]wsCommandHandler{
 // server handler which runs each new connection in a new goroutine thereby
 // satisfying the requirement.
 func (s *rpcServer) WebsocketHandler(conn *websocket.Conn, remoteAddr string,
-	authenticated bool, isAdmin bool) {
+	user *rpcUser) {
 
 	// Clear the read deadline that was set before the websocket hijacked
 	// the connection.
@@ -103,7 +106,7 @@ func (s *rpcServer) WebsocketHandler(conn *websocket.Conn, remoteAddr string,
 	// Create a new websocket client to handle the new websocket connection
 	// and wait for it to shutdown.  Once it has shutdown (and hence
 	// disconnected), remove it and any notifications it registered for.
-	client, err := newWebsocketClient(s, conn, remoteAddr, authenticated, isAdmin)
+	client, err := newWebsocketClient(s, conn, remoteAddr, user)
 	if err != nil {
 		rpcsLog.Errorf("Failed to serve client %s: %v", remoteAddr, err)
 		conn.Close()
@@ -128,6 +131,11 @@ type wsNotificationManager struct {
 	// server is the RPC server the notification manager is associated with.
 	server *rpcServer
 
+	// notifier delivers the chain and mempool notifications which are
+	// relayed to the clients.  It may be nil, in which case notifications
+	// are only queued through the Notify methods.
+	notifier *blockchain.Notifier
+
 	// queueNotification queues a notification for handling.
 	queueNotification chan interface{}
 
@@ -199,11 +207,58 @@ func (m *wsNotificationManager) queueHandler() {
 	m.wg.Done()
 }
 
+// subscriptionHandler relays the chain and mempool notifications delivered by
+// the notifier to the notification queue.  A subscription which is dropped for
+// not keeping up is renewed, although the clients miss the notifications which
+// were dropped in the meantime.  It must be run as a goroutine.
+func (m *wsNotificationManager) subscriptionHandler() {
+	defer m.wg.Done()
+
+	for {
+		ntfns, cancel := m.notifier.Subscribe(blockchain.NTBlockConnected,
+			blockchain.NTBlockDisconnected, blockchain.NTReorganization,
+			blockchain.NTTxAcceptedVerbose, blockchain.NTTxResurrected,
+			blockchain.NTTxReorgConflicted)
+	out:
+		for {
+			select {
+			case n, ok := <-ntfns:
+				if !ok {
+					rpcsLog.Warnf("Websocket notifications were " +
+						"dropped -- resubscribing")
+					break out
+				}
+				switch n.Type {
+				case blockchain.NTBlockConnected:
+					m.NotifyBlockConnected(n.Block)
+				case blockchain.NTBlockDisconnected:
+					m.NotifyBlockDisconnected(n.Block)
+				case blockchain.NTReorganization:
+					m.NotifyReorganization(n.Reorganization)
+				case blockchain.NTTxAcceptedVerbose:
+					m.NotifyMempoolTx(n.Tx, true)
+				case blockchain.NTTxResurrected:
+					m.NotifyMempoolTx(n.Tx, false)
+					m.NotifyReorgTx(n.Tx,
+						btcjson.ReorgTxResurrected)
+				case blockchain.NTTxReorgConflicted:
+					m.NotifyReorgTx(n.Tx,
+						btcjson.ReorgTxConflicted)
+				}
+
+			case <-m.quit:
+				cancel()
+				return
+			}
+		}
+	}
+}
+
 // NotifyBlockConnected passes a block newly-connected to the best chain
 // to the notification manager for block and transaction notification
 // processing.
 func (m *wsNotificationManager) NotifyBlockConnected(block *provautil.Block) {
-	// As NotifyBlockConnected will be called by the block manager
+	// As NotifyBlockConnected will be called by the subscription handler
 	// and the RPC server may no longer be running, use a select
 	// statement to unblock enqueuing the notification once the RPC
 	// server has begun shutting down.
@@ -216,7 +271,7 @@ func (m *wsNotificationManager) NotifyBlockConnected(block *provautil.Block) {
 // NotifyBlockDisconnected passes a block disconnected from the best chain
 // to the notification manager for block notification processing.
 func (m *wsNotificationManager) NotifyBlockDisconnected(block *provautil.Block) {
-	// As NotifyBlockDisconnected will be called by the block manager
+	// As NotifyBlockDisconnected will be called by the subscription handler
 	// and the RPC server may no longer be running, use a select
 	// statement to unblock enqueuing the notification once the RPC
 	// server has begun shutting down.
@@ -226,6 +281,19 @@ func (m *wsNotificationManager) NotifyBlockDisconnected(block *provautil.Block)
 	}
 }
 
+// NotifyReorganization passes the details of a main chain reorganization to
+// the notification manager for block notification processing.
+func (m *wsNotificationManager) NotifyReorganization(data *blockchain.ReorganizationData) {
+	// As NotifyReorganization will be called by the subscription handler
+	// and the RPC server may no longer be running, use a select
+	// statement to unblock enqueuing the notification once the RPC
+	// server has begun shutting down.
+	select {
+	case m.queueNotification <- (*notificationReorganization)(data):
+	case <-m.quit:
+	}
+}
+
 // NotifyMempoolTx passes a transaction accepted by mempool to the
 // notification manager for transaction notification processing.  If
 // isNew is true, the tx is is a new transaction, rather than one
@@ -236,9 +304,28 @@ func (m *wsNotificationManager) NotifyMempoolTx(tx *provautil.Tx, isNew bool) {
 		tx:    tx,
 	}
 
-	// As NotifyMempoolTx will be called by mempool and the RPC server
-	// may no longer be running, use a select statement to unblock
-	// enqueuing the notification once the RPC server has begun
+	// As NotifyMempoolTx will be called by the subscription handler
+	// and the RPC server may no longer be running, use a select
+	// statement to unblock enqueuing the notification once the RPC
+	// server has begun shutting down.
+	select {
+	case m.queueNotification <- n:
+	case <-m.quit:
+	}
+}
+
+// NotifyReorgTx passes a transaction of a block disconnected during a
+// reorganization along with the reason the reorgtx notification is sent for
+// to the notification manager for transaction notification processing.
+func (m *wsNotificationManager) NotifyReorgTx(tx *provautil.Tx, reason string) {
+	n := &notificationReorgTx{
+		tx:     tx,
+		reason: reason,
+	}
+
+	// As NotifyReorgTx will be called by the subscription handler and the
+	// RPC server may no longer be running, use a select statement to
+	// unblock enqueuing the notification once the RPC server has begun
 	// shutting down.
 	select {
 	case m.queueNotification <- n:
@@ -249,10 +336,15 @@ func (m *wsNotificationManager) NotifyMempoolTx(tx *provautil.Tx, isNew bool) {
 // Notification types
 type notificationBlockConnected provautil.Block
 type notificationBlockDisconnected provautil.Block
+type notificationReorganization blockchain.ReorganizationData
 type notificationTxAcceptedByMempool struct {
 	isNew bool
 	tx    *provautil.Tx
 }
+type notificationReorgTx struct {
+	tx     *provautil.Tx
+	reason string
+}
 
 // Notification control requests
 type notificationRegisterClient wsClient
@@ -261,6 +353,10 @@ type notificationRegisterBlocks wsClient
 type notificationUnregisterBlocks wsClient
 type notificationRegisterNewMempoolTxs wsClient
 type notificationUnregisterNewMempoolTxs wsClient
+type notificationRegisterValidatorSet wsClient
+type notificationUnregisterValidatorSet wsClient
+type notificationRegisterAdminThreads wsClient
+type notificationUnregisterAdminThreads wsClient
 type notificationRegisterSpent struct {
 	wsc *wsClient
 	ops []*wire.OutPoint
@@ -293,6 +389,8 @@ func (m *wsNotificationManager) notificationHandler() {
 	// since it is quite a bit more efficient than using the entire struct.
 	blockNotifications := make(map[chan struct{}]*wsClient)
 	txNotifications := make(map[chan struct{}]*wsClient)
+	validatorSetNotifications := make(map[chan struct{}]*wsClient)
+	adminThreadNotifications := make(map[chan struct{}]*wsClient)
 	watchedOutPoints := make(map[wire.OutPoint]map[chan struct{}]*wsClient)
 	watchedAddrs := make(map[string]map[chan struct{}]*wsClient)
 
@@ -324,6 +422,15 @@ out:
 						block)
 				}
 
+				if len(validatorSetNotifications) != 0 {
+					m.notifyValidatorSetChanged(validatorSetNotifications,
+						block, true)
+				}
+				if len(adminThreadNotifications) != 0 {
+					m.notifyAdminThreadTips(adminThreadNotifications,
+						block, true)
+				}
+
 			case *notificationBlockDisconnected:
 				block := (*provautil.Block)(n)
 
@@ -334,6 +441,23 @@ out:
 						block)
 				}
 
+				if len(validatorSetNotifications) != 0 {
+					m.notifyValidatorSetChanged(validatorSetNotifications,
+						block, false)
+				}
+				if len(adminThreadNotifications) != 0 {
+					m.notifyAdminThreadTips(adminThreadNotifications,
+						block, false)
+				}
+
+			case *notificationReorganization:
+				data := (*blockchain.ReorganizationData)(n)
+
+				if len(blockNotifications) != 0 {
+					m.notifyReorganization(blockNotifications,
+						data)
+				}
+
 			case *notificationTxAcceptedByMempool:
 				if n.isNew && len(txNotifications) != 0 {
 					m.notifyForNewTx(txNotifications, n.tx)
@@ -341,6 +465,12 @@ out:
 				m.notifyForTx(watchedOutPoints, watchedAddrs, n.tx, nil)
 				m.notifyRelevantTxAccepted(n.tx, clients)
 
+			case *notificationReorgTx:
+				if len(txNotifications) != 0 {
+					m.notifyReorgTx(txNotifications, n.tx,
+						n.reason)
+				}
+
 			case *notificationRegisterBlocks:
 				wsc := (*wsClient)(n)
 				blockNotifications[wsc.quit] = wsc
@@ -359,6 +489,8 @@ out:
 				// the client itself.
 				delete(blockNotifications, wsc.quit)
 				delete(txNotifications, wsc.quit)
+				delete(validatorSetNotifications, wsc.quit)
+				delete(adminThreadNotifications, wsc.quit)
 				for k := range wsc.spentRequests {
 					op := k
 					m.removeSpentRequest(watchedOutPoints, wsc, &op)
@@ -388,6 +520,22 @@ out:
 				wsc := (*wsClient)(n)
 				delete(txNotifications, wsc.quit)
 
+			case *notificationRegisterValidatorSet:
+				wsc := (*wsClient)(n)
+				validatorSetNotifications[wsc.quit] = wsc
+
+			case *notificationUnregisterValidatorSet:
+				wsc := (*wsClient)(n)
+				delete(validatorSetNotifications, wsc.quit)
+
+			case *notificationRegisterAdminThreads:
+				wsc := (*wsClient)(n)
+				adminThreadNotifications[wsc.quit] = wsc
+
+			case *notificationUnregisterAdminThreads:
+				wsc := (*wsClient)(n)
+				delete(adminThreadNotifications, wsc.quit)
+
 			default:
 				rpcsLog.Warn("Unhandled notification type")
 			}
@@ -655,6 +803,34 @@ func (*wsNotificationManager) notifyBlockDisconnected(clients map[chan struct{}]
 	}
 }
 
+// notifyReorganization notifies websocket clients that have registered for
+// block updates when the main chain is reorganized.
+func (*wsNotificationManager) notifyReorganization(clients map[chan struct{}]*wsClient,
+	data *blockchain.ReorganizationData) {
+
+	detached := make([]string, 0, len(data.DetachedHashes))
+	for i := range data.DetachedHashes {
+		detached = append(detached, data.DetachedHashes[i].String())
+	}
+	attached := make([]string, 0, len(data.AttachedHashes))
+	for i := range data.AttachedHashes {
+		attached = append(attached, data.AttachedHashes[i].String())
+	}
+
+	// Notify interested websocket clients about the reorganization.
+	ntfn := btcjson.NewReorganizationNtfn(data.ForkHash.String(),
+		int32(data.ForkHeight), detached, attached)
+	marshalledJSON, err := btcjson.MarshalCmd(nil, ntfn)
+	if err != nil {
+		rpcsLog.Errorf("Failed to marshal reorganization notification: "+
+			"%v", err)
+		return
+	}
+	for _, wsc := range clients {
+		wsc.QueueNotification(marshalledJSON)
+	}
+}
+
 // notifyFilteredBlockConnected notifies websocket clients that have registered for
 // block updates when a block is connected to the main chain.
 func (m *wsNotificationManager) notifyFilteredBlockConnected(clients map[chan struct{}]*wsClient,
@@ -744,6 +920,178 @@ func (m *wsNotificationManager) UnregisterNewMempoolTxsUpdates(wsc *wsClient) {
 	m.queueNotification <- (*notificationUnregisterNewMempoolTxs)(wsc)
 }
 
+// RegisterValidatorSetUpdates requests validator set change notifications to
+// the passed websocket client.
+func (m *wsNotificationManager) RegisterValidatorSetUpdates(wsc *wsClient) {
+	m.queueNotification <- (*notificationRegisterValidatorSet)(wsc)
+}
+
+// UnregisterValidatorSetUpdates removes validator set change notifications for
+// the passed websocket client.
+func (m *wsNotificationManager) UnregisterValidatorSetUpdates(wsc *wsClient) {
+	m.queueNotification <- (*notificationUnregisterValidatorSet)(wsc)
+}
+
+// RegisterAdminThreadUpdates requests admin thread tip notifications to the
+// passed websocket client.
+func (m *wsNotificationManager) RegisterAdminThreadUpdates(wsc *wsClient) {
+	m.queueNotification <- (*notificationRegisterAdminThreads)(wsc)
+}
+
+// UnregisterAdminThreadUpdates removes admin thread tip notifications for the
+// passed websocket client.
+func (m *wsNotificationManager) UnregisterAdminThreadUpdates(wsc *wsClient) {
+	m.queueNotification <- (*notificationUnregisterAdminThreads)(wsc)
+}
+
+// adminThreadNames maps the admin threads to the names they are reported with.
+var adminThreadNames = map[provautil.ThreadID]string{
+	provautil.RootThread:      "root",
+	provautil.ProvisionThread: "provision",
+	provautil.IssueThread:     "issue",
+}
+
+// adminKeyOpString returns the name of an admin key operation.
+func adminKeyOpString(isAddOp bool) string {
+	if isAddOp {
+		return "ADD_KEY"
+	}
+	return "REVOKE_KEY"
+}
+
+// blockAdminTxs returns the admin transactions of the passed block along with
+// their threads in the order the thread tips move, which is the reverse of the
+// block order when the block is disconnected.
+func blockAdminTxs(block *provautil.Block, connected bool) ([]*provautil.Tx, []provautil.ThreadID) {
+	var txns []*provautil.Tx
+	var threads []provautil.ThreadID
+	for _, tx := range block.Transactions() {
+		threadInt, _ := txscript.GetAdminDetails(tx)
+		if threadInt < 0 {
+			continue
+		}
+		txns = append(txns, tx)
+		threads = append(threads, provautil.ThreadID(threadInt))
+	}
+	if !connected {
+		for i, j := 0, len(txns)-1; i < j; i, j = i+1, j-1 {
+			txns[i], txns[j] = txns[j], txns[i]
+			threads[i], threads[j] = threads[j], threads[i]
+		}
+	}
+	return txns, threads
+}
+
+// adminThreadTipNtfns returns the adminthreadtip notifications for the admin
+// transactions of the passed block, which was either connected to or
+// disconnected from the main chain.
+func adminThreadTipNtfns(block *provautil.Block, connected bool) []*btcjson.AdminThreadTipNtfn {
+	blockHash := block.Hash().String()
+	height := int32(block.Height())
+	txns, threads := blockAdminTxs(block, connected)
+	ntfns := make([]*btcjson.AdminThreadTipNtfn, 0, len(txns))
+	for i, tx := range txns {
+		threadID := threads[i]
+
+		// The issue thread does not carry key operations.
+		ops := make([]btcjson.AdminKeyOp, 0)
+		if threadID != provautil.IssueThread {
+			_, adminOutputs := txscript.GetAdminDetails(tx)
+			for _, adminOutput := range adminOutputs {
+				isAddOp, keySetType, pubKey, keyID :=
+					txscript.ExtractAdminOpData(adminOutput)
+				ops = append(ops, btcjson.AdminKeyOp{
+					Operation: adminKeyOpString(isAddOp),
+					KeySet:    keySetType.String(),
+					PubKey: hex.EncodeToString(
+						pubKey.SerializeCompressed()),
+					KeyID: uint32(keyID),
+				})
+			}
+		}
+
+		// A disconnected admin transaction moves the tip back to the
+		// outpoint it spent.
+		tip := wire.NewOutPoint(tx.Hash(), 0)
+		if !connected {
+			tip = &tx.MsgTx().TxIn[0].PreviousOutPoint
+		}
+		ntfns = append(ntfns, btcjson.NewAdminThreadTipNtfn(
+			uint32(threadID), adminThreadNames[threadID],
+			tip.String(), tx.Hash().String(), ops, blockHash, height,
+			connected))
+	}
+	return ntfns
+}
+
+// validatorSetChangedNtfns returns the validatorsetchanged notifications for
+// the validate key operations of the passed block, which was either connected
+// to or disconnected from the main chain.
+func validatorSetChangedNtfns(block *provautil.Block, connected bool) []*btcjson.ValidatorSetChangedNtfn {
+	blockHash := block.Hash().String()
+	height := int32(block.Height())
+	txns, threads := blockAdminTxs(block, connected)
+	var ntfns []*btcjson.ValidatorSetChangedNtfn
+	for i, tx := range txns {
+		if threads[i] != provautil.ProvisionThread {
+			continue
+		}
+		_, adminOutputs := txscript.GetAdminDetails(tx)
+		for _, adminOutput := range adminOutputs {
+			isAddOp, keySetType, pubKey, _ :=
+				txscript.ExtractAdminOpData(adminOutput)
+			if keySetType != btcec.ValidateKeySet {
+				continue
+			}
+			var validatingPubKey wire.BlockValidatingPubKey
+			copy(validatingPubKey[:], pubKey.SerializeCompressed())
+			ntfns = append(ntfns, btcjson.NewValidatorSetChangedNtfn(
+				adminKeyOpString(isAddOp), sigKeyID(validatingPubKey),
+				validatingPubKey.String(), tx.Hash().String(),
+				blockHash, height, connected))
+		}
+	}
+	return ntfns
+}
+
+// notifyValidatorSetChanged notifies websocket clients that have registered
+// for validator set updates when a block which adds or revokes validate keys
+// is connected to or disconnected from the main chain.
+func (*wsNotificationManager) notifyValidatorSetChanged(clients map[chan struct{}]*wsClient,
+	block *provautil.Block, connected bool) {
+
+	for _, ntfn := range validatorSetChangedNtfns(block, connected) {
+		marshalledJSON, err := btcjson.MarshalCmd(nil, ntfn)
+		if err != nil {
+			rpcsLog.Errorf("Failed to marshal validator set changed "+
+				"notification: %v", err)
+			return
+		}
+		for _, wsc := range clients {
+			wsc.QueueNotification(marshalledJSON)
+		}
+	}
+}
+
+// notifyAdminThreadTips notifies websocket clients that have registered for
+// admin thread updates when a block which moves the tips of admin threads is
+// connected to or disconnected from the main chain.
+func (*wsNotificationManager) notifyAdminThreadTips(clients map[chan struct{}]*wsClient,
+	block *provautil.Block, connected bool) {
+
+	for _, ntfn := range adminThreadTipNtfns(block, connected) {
+		marshalledJSON, err := btcjson.MarshalCmd(nil, ntfn)
+		if err != nil {
+			rpcsLog.Errorf("Failed to marshal admin thread tip "+
+				"notification: %v", err)
+			return
+		}
+		for _, wsc := range clients {
+			wsc.QueueNotification(marshalledJSON)
+		}
+	}
+}
+
 // notifyForNewTx notifies websocket clients that have registered for updates
 // when a new transaction is added to the memory pool.
 func (m *wsNotificationManager) notifyForNewTx(clients map[chan struct{}]*wsClient, tx *provautil.Tx) {
@@ -793,6 +1141,24 @@ func (m *wsNotificationManager) notifyForNewTx(clients map[chan struct{}]*wsClie
 	}
 }
 
+// notifyReorgTx notifies websocket clients that have registered for new
+// mempool transactions what happened to a transaction of a block disconnected
+// during a reorganization.
+func (*wsNotificationManager) notifyReorgTx(clients map[chan struct{}]*wsClient,
+	tx *provautil.Tx, reason string) {
+
+	ntfn := btcjson.NewReorgTxNtfn(tx.Hash().String(), reason)
+	marshalledJSON, err := btcjson.MarshalCmd(nil, ntfn)
+	if err != nil {
+		rpcsLog.Errorf("Failed to marshal reorg tx notification: %v",
+			err)
+		return
+	}
+	for _, wsc := range clients {
+		wsc.QueueNotification(marshalledJSON)
+	}
+}
+
 // RegisterSpentRequests requests a notification when each of the passed
 // outpoints is confirmed spent (contained in a block connected to the main
 // chain) for the passed websocket client.  The request is automatically
@@ -872,24 +1238,25 @@ func txHexString(tx *wire.MsgTx) string {
 }
 
 // blockDetails creates a BlockDetails struct to include in btcws notifications
-// from a block and a transaction's block index.
-func blockDetails(block *provautil.Block, txIndex int) *btcjson.BlockDetails {
+// from a block and one of its transactions.  The index of the transaction is
+// the one saved when it was obtained from the block.
+func blockDetails(block *provautil.Block, tx *provautil.Tx) *btcjson.BlockDetails {
 	if block == nil {
 		return nil
 	}
 	return &btcjson.BlockDetails{
 		Height: int32(block.Height()),
 		Hash:   block.Hash().String(),
-		Index:  txIndex,
+		Index:  tx.Index(),
 		Time:   block.MsgBlock().Header.Timestamp.Unix(),
 	}
 }
 
 // newRedeemingTxNotification returns a new marshalled redeemingtx notification
 // with the passed parameters.
-func newRedeemingTxNotification(txHex string, index int, block *provautil.Block) ([]byte, error) {
+func newRedeemingTxNotification(txHex string, tx *provautil.Tx, block *provautil.Block) ([]byte, error) {
 	// Create and marshal the notification.
-	ntfn := btcjson.NewRedeemingTxNtfn(txHex, blockDetails(block, index))
+	ntfn := btcjson.NewRedeemingTxNtfn(txHex, blockDetails(block, tx))
 	return btcjson.MarshalCmd(nil, ntfn)
 }
 
@@ -923,8 +1290,7 @@ func (m *wsNotificationManager) notifyForTxOuts(ops map[wire.OutPoint]map[chan s
 			if txHex == "" {
 				txHex = txHexString(tx.MsgTx())
 			}
-			ntfn := btcjson.NewRecvTxNtfn(txHex, blockDetails(block,
-				tx.Index()))
+			ntfn := btcjson.NewRecvTxNtfn(txHex, blockDetails(block, tx))
 
 			marshalledJSON, err := btcjson.MarshalCmd(nil, ntfn)
 			if err != nil {
@@ -1002,7 +1368,7 @@ func (m *wsNotificationManager) notifyForTxIns(ops map[wire.OutPoint]map[chan st
 			if txHex == "" {
 				txHex = txHexString(tx.MsgTx())
 			}
-			marshalledJSON, err := newRedeemingTxNotification(txHex, tx.Index(), block)
+			marshalledJSON, err := newRedeemingTxNotification(txHex, tx, block)
 			if err != nil {
 				rpcsLog.Warnf("Failed to marshal redeemingtx notification: %v", err)
 				continue
@@ -1106,6 +1472,10 @@ func (m *wsNotificationManager) Start() {
 	m.wg.Add(2)
 	go m.queueHandler()
 	go m.notificationHandler()
+	if m.notifier != nil {
+		m.wg.Add(1)
+		go m.subscriptionHandler()
+	}
 }
 
 // WaitForShutdown blocks until all notification manager goroutines have
@@ -1120,11 +1490,13 @@ func (m *wsNotificationManager) Shutdown() {
 	close(m.quit)
 }
 
-// newWsNotificationManager returns a new notification manager ready for use.
-// See wsNotificationManager for more details.
-func newWsNotificationManager(server *rpcServer) *wsNotificationManager {
+// newWsNotificationManager returns a new notification manager ready for use
+// which relays the notifications delivered by the passed notifier.  See
+// wsNotificationManager for more details.
+func newWsNotificationManager(server *rpcServer, notifier *blockchain.Notifier) *wsNotificationManager {
 	return &wsNotificationManager{
 		server:            server,
+		notifier:          notifier,
 		queueNotification: make(chan interface{}),
 		notificationMsgs:  make(chan interface{}),
 		numClients:        make(chan int),
@@ -1174,9 +1546,9 @@ type wsClient struct {
 	// and therefore is allowed to communicated over the websocket.
 	authenticated bool
 
-	// isAdmin specifies whether a client may change the state of the server;
-	// false means its access is only to the limited set of RPC calls.
-	isAdmin bool
+	// user is the RPC user the client authenticated as, which determines
+	// the commands it may execute.
+	user *rpcUser
 
 	// sessionID is a random ID generated for each client when connected.
 	// These IDs may be queried by a client using the session RPC.  A change
@@ -1314,15 +1686,13 @@ out:
 			// Check credentials.
 			login := authCmd.Username + ":" + authCmd.Passphrase
 			auth := "Basic " + base64.StdEncoding.EncodeToString([]byte(login))
-			authSha := sha256.Sum256([]byte(auth))
-			cmp := subtle.ConstantTimeCompare(authSha[:], c.server.authsha[:])
-			limitcmp := subtle.ConstantTimeCompare(authSha[:], c.server.limitauthsha[:])
-			if cmp != 1 && limitcmp != 1 {
+			user := c.server.authenticate(auth)
+			if user == nil {
 				rpcsLog.Warnf("Auth failure.")
 				break out
 			}
 			c.authenticated = true
-			c.isAdmin = cmp == 1
+			c.user = user
 
 			// Marshal and send response.
 			reply, err := createMarshalledReply(cmd.id, nil, nil)
@@ -1335,24 +1705,18 @@ out:
 			continue
 		}
 
-		// Check if the client is using limited RPC credentials and
-		// error when not authorized to call this RPC.
-		if !c.isAdmin {
-			if _, ok := rpcLimited[request.Method]; !ok {
-				jsonErr := &btcjson.RPCError{
-					Code:    btcjson.ErrRPCInvalidParams.Code,
-					Message: "limited user not authorized for this method",
-				}
-				// Marshal and send response.
-				reply, err := createMarshalledReply(request.ID, nil, jsonErr)
-				if err != nil {
-					rpcsLog.Errorf("Failed to marshal parse failure "+
-						"reply: %v", err)
-					continue
-				}
-				c.SendMessage(reply, nil)
+		// Error when the user of the client may not call this RPC or
+		// exceeded its rate limit.
+		if jsonErr := c.server.authorize(c.user, request.Method); jsonErr != nil {
+			// Marshal and send response.
+			reply, err := createMarshalledReply(request.ID, nil, jsonErr)
+			if err != nil {
+				rpcsLog.Errorf("Failed to marshal parse failure "+
+					"reply: %v", err)
 				continue
 			}
+			c.SendMessage(reply, nil)
+			continue
 		}
 
 		// Asynchronously handle the request.  A semaphore is used to
@@ -1375,6 +1739,13 @@ out:
 		// that also reads a time.After channel.  This will unblock the
 		// read of the next request from the websocket client and allow
 		// many requests to be waited on concurrently.
+		//
+		// The commands which are used to inspect the server are exempt
+		// from the limit.
+		if _, ok := rpcUnlimited[cmd.method]; ok {
+			go c.serviceRequest(cmd)
+			continue
+		}
 		c.serviceRequestSem.acquire()
 		go func() {
 			c.serviceRequest(cmd)
@@ -1401,7 +1772,9 @@ func (c *wsClient) serviceRequest(r *parsedRPCCmd) {
 	// exist fallback to handling the command as a standard command.
 	wsHandler, ok := wsHandlers[r.method]
 	if ok {
+		id := c.server.activeCommands.add(r.method)
 		result, err = wsHandler(c, r.cmd)
+		c.server.activeCommands.remove(id)
 	} else {
 		result, err = c.server.standardCmdResult(r, nil)
 	}
@@ -1619,7 +1992,7 @@ func (c *wsClient) WaitForShutdown() {
 // incoming and outgoing messages in separate goroutines complete with queuing
 // and asynchrous handling for long-running operations.
 func newWebsocketClient(server *rpcServer, conn *websocket.Conn,
-	remoteAddr string, authenticated bool, isAdmin bool) (*wsClient, error) {
+	remoteAddr string, user *rpcUser) (*wsClient, error) {
 
 	sessionID, err := wire.RandomUint64()
 	if err != nil {
@@ -1629,8 +2002,8 @@ func newWebsocketClient(server *rpcServer, conn *websocket.Conn,
 	client := &wsClient{
 		conn:              conn,
 		addr:              remoteAddr,
-		authenticated:     authenticated,
-		isAdmin:           isAdmin,
+		authenticated:     user != nil,
+		user:              user,
 		sessionID:         sessionID,
 		server:            server,
 		addrRequests:      make(map[string]struct{}),
@@ -1752,6 +2125,34 @@ func handleStopNotifyBlocks(wsc *wsClient, icmd interface{}) (interface{}, error
 	return nil, nil
 }
 
+// handleNotifyValidatorSet implements the notifyvalidatorset command
+// extension for websocket connections.
+func handleNotifyValidatorSet(wsc *wsClient, icmd interface{}) (interface{}, error) {
+	wsc.server.ntfnMgr.RegisterValidatorSetUpdates(wsc)
+	return nil, nil
+}
+
+// handleStopNotifyValidatorSet implements the stopnotifyvalidatorset command
+// extension for websocket connections.
+func handleStopNotifyValidatorSet(wsc *wsClient, icmd interface{}) (interface{}, error) {
+	wsc.server.ntfnMgr.UnregisterValidatorSetUpdates(wsc)
+	return nil, nil
+}
+
+// handleNotifyAdminThreads implements the notifyadminthreads command extension
+// for websocket connections.
+func handleNotifyAdminThreads(wsc *wsClient, icmd interface{}) (interface{}, error) {
+	wsc.server.ntfnMgr.RegisterAdminThreadUpdates(wsc)
+	return nil, nil
+}
+
+// handleStopNotifyAdminThreads implements the stopnotifyadminthreads command
+// extension for websocket connections.
+func handleStopNotifyAdminThreads(wsc *wsClient, icmd interface{}) (interface{}, error) {
+	wsc.server.ntfnMgr.UnregisterAdminThreadUpdates(wsc)
+	return nil, nil
+}
+
 // handleNotifySpent implements the notifyspent command extension for
 // websocket connections.
 func handleNotifySpent(wsc *wsClient, icmd interface{}) (interface{}, error) {
@@ -1937,7 +2338,7 @@ func rescanBlock(wsc *wsClient, lookups *rescanKeys, blk *provautil.Block) {
 				if txHex == "" {
 					txHex = txHexString(tx.MsgTx())
 				}
-				marshalledJSON, err := newRedeemingTxNotification(txHex, tx.Index(), blk)
+				marshalledJSON, err := newRedeemingTxNotification(txHex, tx, blk)
 				if err != nil {
 					rpcsLog.Errorf("Failed to marshal redeemingtx notification: %v", err)
 					continue
@@ -1980,7 +2381,7 @@ func rescanBlock(wsc *wsClient, lookups *rescanKeys, blk *provautil.Block) {
 					txHex = txHexString(tx.MsgTx())
 				}
 				ntfn := btcjson.NewRecvTxNtfn(txHex,
-					blockDetails(blk, tx.Index()))
+					blockDetails(blk, tx))
 
 				marshalledJSON, err := btcjson.MarshalCmd(nil, ntfn)
 				if err != nil {
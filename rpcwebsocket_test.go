@@ -0,0 +1,156 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/btcjson"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/txscript"
+	"github.com/bitgo/prova/wire"
+)
+
+// receiveNtfn waits for the next notification queued to the passed websocket
+// client and unmarshals it.
+func receiveNtfn(t *testing.T, wsc *wsClient) interface{} {
+	select {
+	case marshalled := <-wsc.ntfnChan:
+		var request btcjson.Request
+		if err := json.Unmarshal(marshalled, &request); err != nil {
+			t.Fatalf("unable to unmarshal notification %s: %v",
+				marshalled, err)
+		}
+		ntfn, err := btcjson.UnmarshalCmd(&request)
+		if err != nil {
+			t.Fatalf("unable to unmarshal notification %s: %v",
+				marshalled, err)
+		}
+		return ntfn
+
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for notification")
+	}
+	return nil
+}
+
+// handleWsCmd runs the websocket handler of the passed command for the passed
+// client and ensures it succeeds without a result.
+func handleWsCmd(t *testing.T, wsc *wsClient, cmd interface{}) {
+	method, err := btcjson.CmdMethod(cmd)
+	if err != nil {
+		t.Fatalf("unable to look up method of %T: %v", cmd, err)
+	}
+	result, err := wsHandlers[method](wsc, cmd)
+	if result != nil || err != nil {
+		t.Fatalf("%s: unexpected result %v (err %v)", method, result,
+			err)
+	}
+}
+
+// TestAdminNotifications drives a block with a provisioning transaction
+// through the websocket notification manager and ensures a client which
+// registered through the notifyvalidatorset and notifyadminthreads commands
+// receives the validatorsetchanged and adminthreadtip notifications when it is
+// connected and disconnected, until it stops them again.
+func TestAdminNotifications(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	threadTip := wire.NewOutPoint(validatorKeyThreadTip.Hash(), 0)
+	newKey := validatorKeyPrivKey("1337000000000000000000000000000000000000000000000000000000000003").PubKey()
+	provisionKeys := []*btcec.PrivateKey{
+		validatorKeyProvisionKeys[0].Key,
+		validatorKeyProvisionKeys[1].Key,
+	}
+	msgTx, complete, _, err := validatorAdminTx(params,
+		txscript.AdminOpValidateKeyAdd, newKey, params.AdminKeySets,
+		threadTip, provisionKeys)
+	if err != nil || !complete {
+		t.Fatalf("validatorAdminTx: unexpected result (complete %v, "+
+			"err %v)", complete, err)
+	}
+	block := provautil.NewBlock(&wire.MsgBlock{
+		Header:       wire.BlockHeader{Height: 5},
+		Transactions: []*wire.MsgTx{msgTx},
+	})
+	block.SetHeight(5)
+
+	s := &rpcServer{}
+	m := newWsNotificationManager(s, nil)
+	s.ntfnMgr = m
+	m.Start()
+	wsc := &wsClient{
+		server:   s,
+		ntfnChan: make(chan []byte, 4),
+		quit:     make(chan struct{}),
+	}
+	m.AddClient(wsc)
+	handleWsCmd(t, wsc, btcjson.NewNotifyValidatorSetCmd())
+	handleWsCmd(t, wsc, btcjson.NewNotifyAdminThreadsCmd())
+
+	pubKey := hex.EncodeToString(newKey.SerializeCompressed())
+	keyID := hex.EncodeToString(provautil.Hash160(newKey.SerializeCompressed()))
+	txID := msgTx.TxHash().String()
+	blockHash := block.Hash().String()
+	ops := []btcjson.AdminKeyOp{{
+		Operation: "ADD_KEY",
+		KeySet:    "VALIDATE",
+		PubKey:    pubKey,
+	}}
+
+	m.NotifyBlockConnected(block)
+	want := []interface{}{
+		btcjson.NewValidatorSetChangedNtfn("ADD_KEY", keyID, pubKey, txID,
+			blockHash, 5, true),
+		btcjson.NewAdminThreadTipNtfn(1, "provision", txID+":0", txID,
+			ops, blockHash, 5, true),
+	}
+	for i, wantNtfn := range want {
+		if ntfn := receiveNtfn(t, wsc); !reflect.DeepEqual(ntfn, wantNtfn) {
+			t.Fatalf("connected #%d: mismatched notification - got "+
+				"%+v, want %+v", i, ntfn, wantNtfn)
+		}
+	}
+
+	// Once the client stopped the validator set notifications, only the
+	// admin thread tip moving back is reported for the disconnected block.
+	handleWsCmd(t, wsc, btcjson.NewStopNotifyValidatorSetCmd())
+	m.NotifyBlockDisconnected(block)
+	wantNtfn := interface{}(btcjson.NewAdminThreadTipNtfn(1, "provision",
+		threadTip.String(), txID, ops, blockHash, 5, false))
+	if ntfn := receiveNtfn(t, wsc); !reflect.DeepEqual(ntfn, wantNtfn) {
+		t.Fatalf("disconnected: mismatched notification - got %+v, "+
+			"want %+v", ntfn, wantNtfn)
+	}
+
+	// Once the client stopped the admin thread notifications as well,
+	// connecting the block is not reported at all.  The notifications are
+	// delivered in order, so the next one received is the validator set
+	// change of the block being disconnected again after the client
+	// registered for validator set updates once more.
+	handleWsCmd(t, wsc, btcjson.NewStopNotifyAdminThreadsCmd())
+	m.NotifyBlockConnected(block)
+	handleWsCmd(t, wsc, btcjson.NewNotifyValidatorSetCmd())
+	m.NotifyBlockDisconnected(block)
+	wantNtfn = btcjson.NewValidatorSetChangedNtfn("ADD_KEY", keyID,
+		pubKey, txID, blockHash, 5, false)
+	if ntfn := receiveNtfn(t, wsc); !reflect.DeepEqual(ntfn, wantNtfn) {
+		t.Fatalf("stopped: mismatched notification - got %+v, want "+
+			"%+v", ntfn, wantNtfn)
+	}
+
+	// Mark the client disconnected since it has no connection to close
+	// when the manager shuts down.
+	wsc.Lock()
+	wsc.disconnected = true
+	wsc.Unlock()
+	m.Shutdown()
+	m.WaitForShutdown()
+}
@@ -14,7 +14,9 @@ import (
 	"fmt"
 	"math"
 	"net"
+	"path/filepath"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -29,6 +31,7 @@ import (
 	"github.com/bitgo/prova/connmgr"
 	"github.com/bitgo/prova/database"
 	"github.com/bitgo/prova/mempool"
+	"github.com/bitgo/prova/metrics"
 	"github.com/bitgo/prova/mining"
 	"github.com/bitgo/prova/mining/cpuminer"
 	"github.com/bitgo/prova/peer"
@@ -41,7 +44,8 @@ import (
 const (
 	// defaultServices describes the default services that are supported by
 	// the server.
-	defaultServices = wire.SFNodeNetwork | wire.SFNodeBloom
+	defaultServices = wire.SFNodeNetwork | wire.SFNodeBloom |
+		wire.SFNodeValidatorKey
 
 	// defaultRequiredServices describes the default services that are
 	// required to be supported by outbound peers.
@@ -54,6 +58,26 @@ const (
 	// retries when connecting to persistent peers.  It is adjusted by the
 	// number of retries such that there is a retry backoff.
 	connectionRetryInterval = time.Second * 5
+
+	// feeFilterUpdateInterval is the interval at which the minimum fee rate
+	// of the mempool is checked and announced to peers when it changed.
+	feeFilterUpdateInterval = time.Minute * 10
+
+	// feeFilterChangeDivisor is used to determine whether the minimum fee
+	// rate of the mempool changed meaningfully since it was last announced
+	// to a peer.  It is reannounced when it changed by more than the
+	// announced rate divided by this value, which is 10%.
+	feeFilterChangeDivisor = 10
+
+	// maxAnnouncementHeaders is the maximum number of headers sent to a peer
+	// which prefers headers announcements to announce a new block.  Blocks
+	// which require more headers to connect to a block the peer is known to
+	// have are announced with an inv instead.
+	maxAnnouncementHeaders = 8
+
+	// banListFilename is the name of the file in the data directory the
+	// bans of peer addresses are persisted to.
+	banListFilename = "banlist.json"
 )
 
 var (
@@ -95,14 +119,6 @@ type broadcastMsg struct {
 	excludePeers []*serverPeer
 }
 
-// broadcastInventoryAdd is a type used to declare that the InvVect it contains
-// needs to be added to the rebroadcast map
-type broadcastInventoryAdd relayMsg
-
-// broadcastInventoryDel is a type used to declare that the InvVect it contains
-// needs to be removed from the rebroadcast map
-type broadcastInventoryDel *wire.InvVect
-
 // relayMsg packages an inventory vector along with the newly discovered
 // inventory so the relay has access to that information.
 type relayMsg struct {
@@ -123,12 +139,11 @@ type updatePeerHeightsMsg struct {
 }
 
 // peerState maintains state of inbound, persistent, outbound peers as well
-// as banned peers and outbound groups.
+// as outbound groups.
 type peerState struct {
 	inboundPeers    map[int32]*serverPeer
 	outboundPeers   map[int32]*serverPeer
 	persistentPeers map[int32]*serverPeer
-	banned          map[string]time.Time
 	outboundGroups  map[string]int
 }
 
@@ -158,70 +173,148 @@ func (ps *peerState) forAllPeers(closure func(sp *serverPeer)) {
 	ps.forAllOutboundPeers(closure)
 }
 
+// peerMetrics houses the metrics of the peers of the server.
+type peerMetrics struct {
+	inbound    *metrics.Gauge
+	outbound   *metrics.Gauge
+	persistent *metrics.Gauge
+}
+
+// newPeerMetrics registers the metrics of the peers of the server with the
+// passed registry.
+func newPeerMetrics(registry *metrics.Registry) peerMetrics {
+	return peerMetrics{
+		inbound: registry.NewGauge("prova_peers_inbound",
+			"Number of connected inbound peers."),
+		outbound: registry.NewGauge("prova_peers_outbound",
+			"Number of connected outbound peers which are not "+
+				"persistent."),
+		persistent: registry.NewGauge("prova_peers_persistent",
+			"Number of connected persistent peers."),
+	}
+}
+
+// update sets the peer metrics to the number of peers known to the passed
+// peerState.  It is invoked from the peerHandler goroutine.
+func (m *peerMetrics) update(state *peerState) {
+	m.inbound.Set(int64(len(state.inboundPeers)))
+	m.outbound.Set(int64(len(state.outboundPeers)))
+	m.persistent.Set(int64(len(state.persistentPeers)))
+}
+
 // server provides a bitcoin server for handling communications to and from
 // bitcoin peers.
 type server struct {
 	// The following variables must only be used atomically.
 	// Putting the uint64s first makes them 64-bit aligned for 32-bit systems.
-	bytesReceived uint64 // Total bytes received from all peers since start.
-	bytesSent     uint64 // Total bytes sent by all peers since start.
+	bytesReceived uint64        // Total bytes received from all peers since start.
+	bytesSent     uint64        // Total bytes sent by all peers since start.
+	evictedPeers  uint64        // Total inbound peers evicted since start.
+	msgsReceived  peer.MsgTally // Messages received from all peers per command.
+	msgsSent      peer.MsgTally // Messages sent to all peers per command.
 	started       int32
 	shutdown      int32
 	shutdownSched int32
 
-	chainParams          *chaincfg.Params
-	addrManager          *addrmgr.AddrManager
-	connManager          *connmgr.ConnManager
-	sigCache             *txscript.SigCache
-	hashCache            *txscript.HashCache
-	rpcServer            *rpcServer
-	blockManager         *blockManager
-	txMemPool            *mempool.TxPool
-	cpuMiner             *cpuminer.CPUMiner
-	modifyRebroadcastInv chan interface{}
-	newPeers             chan *serverPeer
-	donePeers            chan *serverPeer
-	banPeers             chan *serverPeer
-	query                chan interface{}
-	relayInv             chan relayMsg
-	broadcast            chan broadcastMsg
-	peerHeightsUpdate    chan updatePeerHeightsMsg
-	wg                   sync.WaitGroup
-	quit                 chan struct{}
-	nat                  NAT
-	db                   database.DB
-	timeSource           blockchain.MedianTimeSource
-	services             wire.ServiceFlag
+	// startupTime is the unix time the server was started at.  It is set
+	// before the RPC server is started and is not modified afterwards.
+	startupTime int64
+
+	chainParams       *chaincfg.Params
+	addrManager       *addrmgr.AddrManager
+	connManager       *connmgr.ConnManager
+	banManager        *connmgr.BanManager
+	sigCache          *txscript.SigCache
+	hashCache         *txscript.HashCache
+	rpcServer         *rpcServer
+	restServer        *restServer
+	metricsServer     *metricsServer
+	broadcastManager  *broadcastManager
+	blockManager      *blockManager
+	txMemPool         *mempool.TxPool
+	feeEstimator      *mempool.FeeEstimator
+	notifier          *blockchain.Notifier
+	cpuMiner          *cpuminer.CPUMiner
+	newPeers          chan *serverPeer
+	donePeers         chan *serverPeer
+	banPeers          chan *serverPeer
+	query             chan interface{}
+	relayInv          chan relayMsg
+	broadcast         chan broadcastMsg
+	peerHeightsUpdate chan updatePeerHeightsMsg
+	wg                sync.WaitGroup
+	quit              chan struct{}
+	nat               NAT
+	natPort           uint16
+	db                database.DB
+	timeSource        blockchain.MedianTimeSource
+	services          wire.ServiceFlag
+	validatorKeys     *validatorKeyCache
+
+	// metrics houses the metrics of the subsystems of the server, which
+	// are served by the getmetrics RPC and the optional metrics server.
+	metrics     *metrics.Registry
+	peerMetrics peerMetrics
+
+	// evictionSalt keys the hashes of the network groups which decide the
+	// inbound peers protected from eviction.
+	evictionSalt uint64
+
+	// addedNodes houses the permanent connection requests of the nodes
+	// added via the --addpeer and --connect options or the addnode RPC
+	// keyed by their address.  It is only accessed by the peer handler once
+	// the server is started.
+	addedNodes map[string]*connmgr.ConnReq
+
+	// dialGroups houses the network groups of the automatic outbound
+	// connections which are being established keyed by their address.
+	// They are excluded along with the groups of the connected outbound
+	// peers when picking new addresses, so connections dialed at the same
+	// time are diversified as well.
+	dialGroupsMtx sync.Mutex
+	dialGroups    map[string]string
 
 	// The following fields are used for optional indexes.  They will be nil
 	// if the associated index is not enabled.  These fields are set during
 	// initial creation of the server and never changed afterwards, so they
 	// do not need to be protected for concurrent access.
-	txIndex   *indexers.TxIndex
-	addrIndex *indexers.AddrIndex
+	txIndex         *indexers.TxIndex
+	addrIndex       *indexers.AddrIndex
+	blockStatsIndex *indexers.BlockStatsIndex
+	sigKeyIDIndex   *indexers.SigKeyIDIndex
 }
 
 // serverPeer extends the peer to maintain state shared by the server and
 // the blockmanager.
 type serverPeer struct {
 	// The following variables must only be used atomically
-	feeFilter int64
+	feeFilter     int64
+	sentFeeFilter int64
+	lastBlockTime int64 // Unix time the peer last relayed a new block.
+	lastTxTime    int64 // Unix time the peer last relayed a new transaction.
 
 	*peer.Peer
 
 	connReq         *connmgr.ConnReq
 	server          *server
 	persistent      bool
+	isWhitelisted   bool
+	exemptions      mempool.PolicyExemptions
 	continueHash    *chainhash.Hash
 	relayMtx        sync.Mutex
 	disableRelayTx  bool
 	sentAddrs       bool
 	requestQueue    []*wire.InvVect
 	requestedTxns   map[chainhash.Hash]struct{}
-	requestedBlocks map[chainhash.Hash]struct{}
+	requestedBlocks map[chainhash.Hash]time.Time
+	stalledBlocks   map[chainhash.Hash]struct{}
+	syncStalls      int
+	throughput      blockThroughput
 	filter          *bloom.Filter
 	knownAddresses  map[string]struct{}
-	banScore        connmgr.DynamicBanScore
+	knownBlockMtx   sync.Mutex
+	knownBlock      *chainhash.Hash
+	partialBlock    *partialBlock
 	quit            chan struct{}
 	// The following chans are used to sync blockmanager and server.
 	txProcessed    chan struct{}
@@ -235,7 +328,9 @@ func newServerPeer(s *server, isPersistent bool) *serverPeer {
 		server:          s,
 		persistent:      isPersistent,
 		requestedTxns:   make(map[chainhash.Hash]struct{}),
-		requestedBlocks: make(map[chainhash.Hash]struct{}),
+		requestedBlocks: make(map[chainhash.Hash]time.Time),
+		stalledBlocks:   make(map[chainhash.Hash]struct{}),
+		sentFeeFilter:   -1,
 		filter:          bloom.LoadFilter(nil),
 		knownAddresses:  make(map[string]struct{}),
 		quit:            make(chan struct{}),
@@ -303,28 +398,113 @@ func (sp *serverPeer) pushAddrMsg(addresses []*wire.NetAddress) {
 	sp.addKnownAddresses(known)
 }
 
-// addBanScore increases the persistent and decaying ban score fields by the
-// values passed as parameters. If the resulting score exceeds half of the ban
-// threshold, a warning is logged including the reason provided. Further, if
-// the score is above the ban threshold, the peer will be banned and
-// disconnected.
+// The offenses are the kinds of misbehavior peers are penalized for with a ban
+// score.  Their names are used to override the default scores with the
+// --banscore option.
+const (
+	// offenseProtocol is the persistent score of knowingly violating the
+	// protocol, such as by sending malformed requests.
+	offenseProtocol = "protocol"
+
+	// offenseMalformedMsg is the persistent score of sending a message
+	// which can't be decoded.
+	offenseMalformedMsg = "malformedmsg"
+
+	// offenseInvalidBlock is the persistent score of sending a block which
+	// violates the consensus rules.
+	offenseInvalidBlock = "invalidblock"
+
+	// offenseUserAgent is the persistent score of connecting with a user
+	// agent which matches the --agentblacklist option.
+	offenseUserAgent = "useragent"
+
+	// offenseMempool is the decaying score of requesting the contents of
+	// the memory pool.
+	offenseMempool = "mempool"
+
+	// offenseGetData is the decaying score of requesting the maximum
+	// number of inventory vectors.  Smaller requests are penalized in
+	// proportion to their size.
+	offenseGetData = "getdata"
+
+	// offenseInv is the decaying score of announcing the maximum number of
+	// inventory vectors.  Smaller announcements are penalized in proportion
+	// to their size.
+	offenseInv = "inv"
+
+	// offenseValidatorKey is the decaying score of relaying a validator key
+	// announcement which is not authorized by the current admin keys.  It
+	// is small since the peer may not have seen a recent change of the
+	// admin keys yet.
+	offenseValidatorKey = "validatorkey"
+)
+
+// defaultBanScores houses the default ban scores of the offenses.
+var defaultBanScores = map[string]uint32{
+	offenseProtocol:     100,
+	offenseMalformedMsg: 10,
+	offenseInvalidBlock: 100,
+	offenseUserAgent:    100,
+	offenseMempool:      33,
+	offenseGetData:      99,
+	offenseInv:          50,
+	offenseValidatorKey: 10,
+}
+
+// banScore returns the ban score of the passed offense, which is the default
+// score unless it was overridden with the --banscore option.
+func banScore(offense string) uint32 {
+	if score, ok := cfg.banScores[offense]; ok {
+		return score
+	}
+	return defaultBanScores[offense]
+}
+
+// proportionalBanScore returns the ban score of the passed offense in proportion
+// to the passed number of inventory vectors relative to the maximum number of
+// inventory vectors per message.
+func proportionalBanScore(offense string, numInvVects int) uint32 {
+	return uint32(uint64(numInvVects) * uint64(banScore(offense)) /
+		wire.MaxInvPerMsg)
+}
+
+// host returns the host of the peer address, which is the address itself when
+// it has no port.
+func (sp *serverPeer) host() string {
+	host, _, err := net.SplitHostPort(sp.Addr())
+	if err != nil {
+		return sp.Addr()
+	}
+	return host
+}
+
+// addBanScore increases the persistent and decaying ban score of the peer
+// address by the values passed as parameters.  The score accumulates across
+// all connections from and to the address. If the resulting score exceeds half
+// of the ban threshold, a warning is logged including the reason provided.
+// Further, if the score is above the ban threshold, the peer will be banned and
+// disconnected.  Whitelisted peers are never banned.
 func (sp *serverPeer) addBanScore(persistent, transient uint32, reason string) {
 	// No warning is logged and no score is calculated if banning is disabled.
 	if cfg.DisableBanning {
 		return
 	}
+	if sp.isWhitelisted {
+		peerLog.Debugf("Misbehaving whitelisted peer %s: %s", sp, reason)
+		return
+	}
 	warnThreshold := cfg.BanThreshold >> 1
 	if transient == 0 && persistent == 0 {
 		// The score is not being increased, but a warning message is still
 		// logged if the score is above the warn threshold.
-		score := sp.banScore.Int()
+		score := sp.server.banManager.Score(sp.host())
 		if score > warnThreshold {
 			peerLog.Warnf("Misbehaving peer %s: %s -- ban score is %d, "+
 				"it was not increased this time", sp, reason, score)
 		}
 		return
 	}
-	score := sp.banScore.Increase(persistent, transient)
+	score := sp.server.banManager.AddScore(sp.host(), persistent, transient)
 	if score > warnThreshold {
 		peerLog.Warnf("Misbehaving peer %s: %s -- ban score increased to %d",
 			sp, reason, score)
@@ -337,10 +517,32 @@ func (sp *serverPeer) addBanScore(persistent, transient uint32, reason string) {
 	}
 }
 
+// blacklistedUserAgent returns the first pattern of the --agentblacklist option
+// which the passed user agent contains, and whether there is any.
+func blacklistedUserAgent(userAgent string) (string, bool) {
+	for _, pattern := range cfg.AgentBlacklist {
+		if strings.Contains(userAgent, pattern) {
+			return pattern, true
+		}
+	}
+	return "", false
+}
+
 // OnVersion is invoked when a peer receives a version bitcoin message
 // and is used to negotiate the protocol version details as well as kick start
 // the communications.
 func (sp *serverPeer) OnVersion(_ *peer.Peer, msg *wire.MsgVersion) {
+	// Disconnect peers with a blacklisted user agent before they are added
+	// to the server.
+	if pattern, ok := blacklistedUserAgent(msg.UserAgent); ok {
+		peerLog.Infof("Disconnecting peer %s with blacklisted user "+
+			"agent %q (matches %q)", sp, msg.UserAgent, pattern)
+		sp.addBanScore(banScore(offenseUserAgent), 0, "blacklisted "+
+			"user agent")
+		sp.Disconnect()
+		return
+	}
+
 	// Add the remote peer time as a sample for creating an offset against
 	// the local clock to keep the network time in sync.
 	sp.server.timeSource.AddTimeSample(sp.Addr(), msg.Timestamp)
@@ -409,7 +611,7 @@ func (sp *serverPeer) OnMemPool(_ *peer.Peer, msg *wire.MsgMemPool) {
 	// The ban score accumulates and passes the ban threshold if a burst of
 	// mempool messages comes from a peer. The score decays each minute to
 	// half of its value.
-	sp.addBanScore(0, 33, "mempool")
+	sp.addBanScore(0, banScore(offenseMempool), "mempool")
 
 	// Generate inventory message with the available transactions in the
 	// transaction memory pool.  Limit it to the max allowed inventory
@@ -497,6 +699,13 @@ func (sp *serverPeer) OnBlock(_ *peer.Peer, msg *wire.MsgBlock, buf []byte) {
 // accordingly.  We pass the message down to blockmanager which will call
 // QueueMessage with any appropriate responses.
 func (sp *serverPeer) OnInv(_ *peer.Peer, msg *wire.MsgInv) {
+	// A decaying ban score increase is applied to prevent flooding with
+	// unusually large announcements in the same way as for getdata.
+	sp.addBanScore(0, proportionalBanScore(offenseInv, len(msg.InvList)),
+		"inv")
+
+	msg = sp.requestValidatorKeys(msg)
+
 	if !cfg.BlocksOnly {
 		if len(msg.InvList) > 0 {
 			sp.server.blockManager.QueueInv(msg, sp)
@@ -529,6 +738,39 @@ func (sp *serverPeer) OnInv(_ *peer.Peer, msg *wire.MsgInv) {
 	}
 }
 
+// requestValidatorKeys requests the validator key announcements advertised by
+// the passed inventory message which are not known yet and returns the message
+// without them, since they are not handled by the block manager.
+func (sp *serverPeer) requestValidatorKeys(msg *wire.MsgInv) *wire.MsgInv {
+	numValidatorKeys := 0
+	for _, iv := range msg.InvList {
+		if iv.Type == wire.InvTypeValidatorKey {
+			numValidatorKeys++
+		}
+	}
+	if numValidatorKeys == 0 {
+		return msg
+	}
+
+	filtered := wire.NewMsgInvSizeHint(uint(len(msg.InvList) - numValidatorKeys))
+	gdmsg := wire.NewMsgGetDataSizeHint(uint(numValidatorKeys))
+	for _, iv := range msg.InvList {
+		if iv.Type != wire.InvTypeValidatorKey {
+			filtered.AddInvVect(iv)
+			continue
+		}
+
+		sp.AddKnownInventory(iv)
+		if sp.server.validatorKeys.Lookup(&iv.Hash) == nil {
+			gdmsg.AddInvVect(iv)
+		}
+	}
+	if len(gdmsg.InvList) > 0 {
+		sp.QueueMessage(gdmsg, nil)
+	}
+	return filtered
+}
+
 // handleGetData is invoked when a peer receives a getdata bitcoin message and
 // is used to deliver block and transaction information.
 func (sp *serverPeer) OnGetData(_ *peer.Peer, msg *wire.MsgGetData) {
@@ -543,7 +785,7 @@ func (sp *serverPeer) OnGetData(_ *peer.Peer, msg *wire.MsgGetData) {
 	// bursts of small requests are not penalized as that would potentially ban
 	// peers performing IBD.
 	// This incremental score decays each minute to half of its value.
-	sp.addBanScore(0, uint32(length)*99/wire.MaxInvPerMsg, "getdata")
+	sp.addBanScore(0, proportionalBanScore(offenseGetData, length), "getdata")
 
 	// We wait on this wait channel periodically to prevent queuing
 	// far more data than we can send in a reasonable time, wasting memory.
@@ -569,6 +811,10 @@ func (sp *serverPeer) OnGetData(_ *peer.Peer, msg *wire.MsgGetData) {
 			err = sp.server.pushBlockMsg(sp, &iv.Hash, c, waitChan)
 		case wire.InvTypeFilteredBlock:
 			err = sp.server.pushMerkleBlockMsg(sp, &iv.Hash, c, waitChan)
+		case wire.InvTypeCmpctBlock:
+			err = sp.server.pushCmpctBlockMsg(sp, &iv.Hash, c, waitChan)
+		case wire.InvTypeValidatorKey:
+			err = sp.server.pushValidatorKeyMsg(sp, &iv.Hash, c, waitChan)
 		default:
 			peerLog.Warnf("Unknown type in inventory request %d",
 				iv.Type)
@@ -735,6 +981,87 @@ func fetchHeaders(chain *blockchain.BlockChain, blockHashes []chainhash.Hash) ([
 	return headers, nil
 }
 
+// setKnownBlock records the passed block as the most recent block the peer is
+// known to have because it announced the block or it was sent the header.
+//
+// This function is safe for concurrent access.
+func (sp *serverPeer) setKnownBlock(hash *chainhash.Hash) {
+	sp.knownBlockMtx.Lock()
+	sp.knownBlock = hash
+	sp.knownBlockMtx.Unlock()
+}
+
+// getKnownBlock returns the most recent block the peer is known to have.  It
+// returns nil when no block is known.
+//
+// This function is safe for concurrent access.
+func (sp *serverPeer) getKnownBlock() *chainhash.Hash {
+	sp.knownBlockMtx.Lock()
+	hash := sp.knownBlock
+	sp.knownBlockMtx.Unlock()
+	return hash
+}
+
+// announcementChain provides the chain information needed to create headers
+// announcements.  It is implemented by blockchain.BlockChain.
+type announcementChain interface {
+	FetchHeader(hash *chainhash.Hash) (wire.BlockHeader, error)
+	MainChainHasBlock(hash *chainhash.Hash) (bool, error)
+	BlockHeightByHash(hash *chainhash.Hash) (uint32, error)
+}
+
+// announcementHeaders returns the headers which announce the passed block to a
+// peer which is known to have the passed block, in order from the oldest to
+// the passed block.  The oldest header connects to the known block or one of
+// its ancestors.  It returns nil when the block must be announced with an inv
+// instead, which is the case when the block or the known block is not in the
+// main chain, such as after a reorganize, or when more than
+// maxAnnouncementHeaders headers are needed to connect to the known block.
+func announcementHeaders(chain announcementChain, known *chainhash.Hash, header *wire.BlockHeader) []*wire.BlockHeader {
+	if known == nil {
+		return nil
+	}
+	hash := header.BlockHash()
+	if onMain, err := chain.MainChainHasBlock(&hash); err != nil || !onMain {
+		return nil
+	}
+	if onMain, err := chain.MainChainHasBlock(known); err != nil || !onMain {
+		return nil
+	}
+	knownHeight, err := chain.BlockHeightByHash(known)
+	if err != nil || knownHeight >= header.Height {
+		return nil
+	}
+
+	// Walk backwards from the block until reaching a header whose parent
+	// is the known block or one of its ancestors, which are all in the main
+	// chain along with the ancestors of the block.
+	headers := make([]*wire.BlockHeader, 0, maxAnnouncementHeaders)
+	for len(headers) < maxAnnouncementHeaders {
+		h := *header
+		headers = append(headers, &h)
+		if header.Height-1 <= knownHeight {
+			for i, j := 0, len(headers)-1; i < j; i, j = i+1, j-1 {
+				headers[i], headers[j] = headers[j], headers[i]
+			}
+			return headers
+		}
+		parent, err := chain.FetchHeader(&header.PrevBlock)
+		if err != nil {
+			return nil
+		}
+		header = &parent
+	}
+	return nil
+}
+
+// OnHeaders is invoked when a peer receives a headers bitcoin message.  The
+// message is passed down to the block manager which uses the headers to find
+// the assumed valid block or requests the blocks they announce.
+func (sp *serverPeer) OnHeaders(_ *peer.Peer, msg *wire.MsgHeaders) {
+	sp.server.blockManager.QueueHeaders(msg, sp)
+}
+
 // OnGetHeaders is invoked when a peer receives a getheaders bitcoin
 // message.
 func (sp *serverPeer) OnGetHeaders(_ *peer.Peer, msg *wire.MsgGetHeaders) {
@@ -765,7 +1092,11 @@ func (sp *serverPeer) OnGetHeaders(_ *peer.Peer, msg *wire.MsgGetHeaders) {
 			"allowed per message")
 		// Can still recover from this error, just slice off the extra
 		// headers and continue queing the message.
-		blockHeaders = blockHeaders[:wire.MaxBlockHeaderPayload]
+		blockHeaders = blockHeaders[:wire.MaxBlockHeadersPerMsg]
+	}
+	if len(blockHeaders) > 0 {
+		lastHash := blockHeaders[len(blockHeaders)-1].BlockHash()
+		sp.setKnownBlock(&lastHash)
 	}
 	sp.QueueMessage(&wire.MsgHeaders{Headers: blockHeaders}, nil)
 }
@@ -789,7 +1120,7 @@ func (sp *serverPeer) enforceNodeBloomFlag(cmd string) bool {
 
 			// Disonnect the peer regardless of whether it was
 			// banned.
-			sp.addBanScore(100, 0, cmd)
+			sp.addBanScore(banScore(offenseProtocol), 0, cmd)
 			sp.Disconnect()
 			return false
 		}
@@ -821,6 +1152,144 @@ func (sp *serverPeer) OnFeeFilter(p *peer.Peer, msg *wire.MsgFeeFilter) {
 	atomic.StoreInt64(&sp.feeFilter, msg.MinFee)
 }
 
+// feeFilterAllows returns whether a transaction with the passed fee rate in
+// atoms/kB may be announced to the peer, which is the case unless the peer
+// negotiated a fee filter with a higher minimum fee rate.
+func (sp *serverPeer) feeFilterAllows(feePerKB int64) bool {
+	if !sp.HasCapability(peer.CapFeeFilter) {
+		return true
+	}
+	return feePerKB >= atomic.LoadInt64(&sp.feeFilter)
+}
+
+// feeFilterChanged returns whether the passed minimum fee rate changed
+// meaningfully from the passed fee rate which was last announced to a peer.  A
+// negative announced rate means none was announced yet.
+func feeFilterChanged(sent, minFee int64) bool {
+	if sent < 0 {
+		return true
+	}
+	diff := minFee - sent
+	if diff < 0 {
+		diff = -diff
+	}
+	return diff > 0 && diff >= sent/feeFilterChangeDivisor
+}
+
+// pushFeeFilter announces the passed minimum fee rate in atoms/kB to the peer
+// with a feefilter message when the peer supports it and the rate changed
+// meaningfully since it was last announced.
+func (sp *serverPeer) pushFeeFilter(minFee int64) {
+	if sp.ProtocolVersion() < wire.FeeFilterVersion {
+		return
+	}
+	if !feeFilterChanged(atomic.LoadInt64(&sp.sentFeeFilter), minFee) {
+		return
+	}
+	atomic.StoreInt64(&sp.sentFeeFilter, minFee)
+	sp.QueueMessage(wire.NewMsgFeeFilter(minFee), nil)
+}
+
+// OnVerAck is invoked when a peer receives a verack bitcoin message and is
+// used to request headers announcements and compact block relay from the peer
+// and to announce the minimum fee rate of the mempool to the peer once the
+// connection is fully established.  Compact blocks are requested in
+// low-bandwidth mode, so blocks are still announced first and only requested
+// as compact blocks when needed.  The pending local transactions are announced
+// to the peer as well.
+func (sp *serverPeer) OnVerAck(_ *peer.Peer, _ *wire.MsgVerAck) {
+	if sp.ProtocolVersion() >= wire.SendHeadersVersion {
+		sp.QueueMessage(wire.NewMsgSendHeaders(), nil)
+	}
+	if sp.ProtocolVersion() >= wire.SendCmpctVersion {
+		sp.QueueMessage(wire.NewMsgSendCmpct(false,
+			wire.CmpctBlockVersion), nil)
+	}
+	sp.pushFeeFilter(sp.server.txMemPool.MinRelayFeeRate())
+
+	// Announce the local transactions which are not mined yet, since the
+	// peer may not have been connected when they were submitted.
+	sp.server.broadcastManager.PeerConnected(sp)
+}
+
+// blockRequestType returns the inventory type to request a new block from the
+// peer with.  Once the chain is current, blocks are requested as compact blocks
+// from peers which negotiated them.
+func (sp *serverPeer) blockRequestType(current bool) wire.InvType {
+	if current && sp.HasCapability(peer.CapCmpctBlocks) {
+		return wire.InvTypeCmpctBlock
+	}
+	return wire.InvTypeBlock
+}
+
+// OnCmpctBlock is invoked when a peer receives a cmpctblock bitcoin message.
+// It blocks until the compact block has been reconstructed and processed or
+// the missing transactions have been requested.
+func (sp *serverPeer) OnCmpctBlock(_ *peer.Peer, msg *wire.MsgCmpctBlock) {
+	hash := msg.Header.BlockHash()
+	sp.AddKnownInventory(wire.NewInvVect(wire.InvTypeBlock, &hash))
+
+	sp.server.blockManager.QueueCmpctBlock(msg, sp)
+	<-sp.blockProcessed
+}
+
+// OnBlockTxn is invoked when a peer receives a blocktxn bitcoin message.  It
+// blocks until the block it completes has been processed.
+func (sp *serverPeer) OnBlockTxn(_ *peer.Peer, msg *wire.MsgBlockTxn) {
+	sp.server.blockManager.QueueBlockTxn(msg, sp)
+	<-sp.blockProcessed
+}
+
+// OnGetBlockTxn is invoked when a peer receives a getblocktxn bitcoin message
+// and is used to deliver the transactions of a block the peer could not
+// reconstruct from a compact block.  Requesting transactions beyond the end of
+// the block is treated as misbehavior.
+func (sp *serverPeer) OnGetBlockTxn(_ *peer.Peer, msg *wire.MsgGetBlockTxn) {
+	block, err := sp.server.blockManager.chain.BlockByHash(&msg.BlockHash)
+	if err != nil {
+		peerLog.Debugf("Unable to fetch block %v requested by "+
+			"getblocktxn from %v: %v", msg.BlockHash, sp, err)
+		return
+	}
+	resp, err := blockTxnResponse(block, msg)
+	if err != nil {
+		sp.addBanScore(banScore(offenseProtocol), 0,
+			fmt.Sprintf("invalid getblocktxn: %v", err))
+		return
+	}
+	sp.QueueMessage(resp, nil)
+}
+
+// OnValidatorKey is invoked when a peer receives a validatorkey bitcoin
+// message.  Announcements are only relayed when the transaction they
+// reference is in the memory pool or the chain and is signed by the admin keys
+// of the provision thread in the current admin state of the chain.
+// Announcements failing these rules are treated as minor misbehavior, while
+// announcements of unknown transactions are ignored.
+func (sp *serverPeer) OnValidatorKey(_ *peer.Peer, msg *wire.MsgValidatorKey) {
+	hash := msg.AnnouncementHash()
+	sp.AddKnownInventory(wire.NewInvVect(wire.InvTypeValidatorKey, &hash))
+	if sp.server.validatorKeys.Lookup(&hash) != nil {
+		return
+	}
+
+	tx, err := sp.server.fetchTransaction(&msg.TxHash)
+	if err != nil {
+		peerLog.Debugf("Ignoring validator key announcement from %v: %v",
+			sp, err)
+		return
+	}
+	err = checkValidatorKey(msg, tx,
+		sp.server.blockManager.chain.AdminKeySets(), sp.server.sigCache)
+	if err != nil {
+		sp.addBanScore(0, banScore(offenseValidatorKey),
+			fmt.Sprintf("invalid validatorkey: %v", err))
+		return
+	}
+
+	sp.server.announceValidatorKey(msg)
+}
+
 // OnFilterAdd is invoked when a peer receives a filteradd bitcoin
 // message and is used by remote peers to add data to an already loaded bloom
 // filter.  The peer will be disconnected if a filter is not loaded when this
@@ -832,7 +1301,7 @@ func (sp *serverPeer) OnFilterAdd(_ *peer.Peer, msg *wire.MsgFilterAdd) {
 		return
 	}
 
-	if sp.filter.IsLoaded() {
+	if !sp.filter.IsLoaded() {
 		peerLog.Debugf("%s sent a filteradd request with no filter "+
 			"loaded -- disconnecting", sp)
 		sp.Disconnect()
@@ -940,7 +1409,28 @@ func (sp *serverPeer) OnAddr(_ *peer.Peer, msg *wire.MsgAddr) {
 		return
 	}
 
-	for _, na := range msg.AddrList {
+	sp.addAddresses(msg.AddrList)
+}
+
+// OnAddrV2 is invoked when a peer receives an addrv2 bitcoin message and is
+// used to notify the server about advertised addresses the same way addr
+// messages are.
+func (sp *serverPeer) OnAddrV2(_ *peer.Peer, msg *wire.MsgAddrV2) {
+	// Ignore addresses when running on the simulation test network.
+	if cfg.SimNet {
+		return
+	}
+
+	// Unlike addr messages, a message without addresses is not invalid
+	// since the addresses of networks which are not known about are
+	// skipped when decoding.
+	sp.addAddresses(msg.AddrList)
+}
+
+// addAddresses adds the passed addresses advertised by the peer to its known
+// addresses and the address manager of the server.
+func (sp *serverPeer) addAddresses(addrList []*wire.NetAddress) {
+	for _, na := range addrList {
 		// Don't add more address if we're disconnecting.
 		if !sp.Connected() {
 			return
@@ -963,19 +1453,32 @@ func (sp *serverPeer) OnAddr(_ *peer.Peer, msg *wire.MsgAddr) {
 	// addresses, and last seen updates.
 	// XXX bitcoind gives a 2 hour time penalty here, do we want to do the
 	// same?
-	sp.server.addrManager.AddAddresses(msg.AddrList, sp.NA())
+	sp.server.addrManager.AddAddresses(addrList, sp.NA())
 }
 
 // OnRead is invoked when a peer receives a message and it is used to update
-// the bytes received by the server.
+// the bytes and messages received by the server and to penalize malformed
+// messages.
 func (sp *serverPeer) OnRead(_ *peer.Peer, bytesRead int, msg wire.Message, err error) {
 	sp.server.AddBytesReceived(uint64(bytesRead))
+	if msg != nil {
+		sp.server.msgsReceived.Add(msg.Command(), bytesRead)
+	} else if bytesRead > 0 {
+		sp.server.msgsReceived.Add(peer.OtherMsgCommand, bytesRead)
+	}
+
+	// The regression test intentionally sends malformed messages.
+	if msgErr, ok := err.(*wire.MessageError); ok && !cfg.RegressionTest {
+		sp.addBanScore(banScore(offenseMalformedMsg), 0,
+			fmt.Sprintf("malformed message: %v", msgErr))
+	}
 }
 
 // OnWrite is invoked when a peer sends a message and it is used to update
-// the bytes sent by the server.
+// the bytes and messages sent by the server.
 func (sp *serverPeer) OnWrite(_ *peer.Peer, bytesWritten int, msg wire.Message, err error) {
 	sp.server.AddBytesSent(uint64(bytesWritten))
+	sp.server.msgsSent.Add(msg.Command(), bytesWritten)
 }
 
 // randomUint16Number returns a random uint16 in a specified input range.  Note
@@ -996,28 +1499,6 @@ func randomUint16Number(max uint16) uint16 {
 	}
 }
 
-// AddRebroadcastInventory adds 'iv' to the list of inventories to be
-// rebroadcasted at random intervals until they show up in a block.
-func (s *server) AddRebroadcastInventory(iv *wire.InvVect, data interface{}) {
-	// Ignore if shutting down.
-	if atomic.LoadInt32(&s.shutdown) != 0 {
-		return
-	}
-
-	s.modifyRebroadcastInv <- broadcastInventoryAdd{invVect: iv, data: data}
-}
-
-// RemoveRebroadcastInventory removes 'iv' from the list of items to be
-// rebroadcasted if present.
-func (s *server) RemoveRebroadcastInventory(iv *wire.InvVect) {
-	// Ignore if shutting down.
-	if atomic.LoadInt32(&s.shutdown) != 0 {
-		return
-	}
-
-	s.modifyRebroadcastInv <- broadcastInventoryDel(iv)
-}
-
 // AnnounceNewTransactions generates and relays inventory vectors and notifies
 // both websocket and getblocktemplate long poll clients of the passed
 // transactions.  This function should be called whenever new transactions
@@ -1031,16 +1512,109 @@ func (s *server) AnnounceNewTransactions(newTxs []*mempool.TxDesc) {
 		iv := wire.NewInvVect(wire.InvTypeTx, txD.Tx.Hash())
 		s.RelayInventory(iv, txD)
 
-		if s.rpcServer != nil {
-			// Notify websocket clients about mempool transactions.
-			s.rpcServer.ntfnMgr.NotifyMempoolTx(txD.Tx, true)
+		// Announce the keys provisioned or revoked by the
+		// transaction.
+		s.announceValidatorKeys(txD.Tx)
+
+		// Notify the subscribers, such as the websocket clients, about
+		// mempool transactions.
+		s.notifier.Notify(&blockchain.Notification{
+			Type: blockchain.NTTxAcceptedVerbose,
+			Tx:   txD.Tx,
+		})
 
+		if s.rpcServer != nil {
 			// Potentially notify any getblocktemplate long poll clients
 			// about stale block templates due to the new transaction.
-			s.rpcServer.gbtWorkState.NotifyMempoolTx(
-				s.txMemPool.LastUpdated())
+			s.rpcServer.gbtWorkState.NotifyMempoolTx(txD.Fee)
+		}
+	}
+}
+
+// announceValidatorKeys announces the validator keys provisioned or revoked by
+// the passed transaction which is known to the memory pool or the chain.
+func (s *server) announceValidatorKeys(tx *provautil.Tx) {
+	for _, msg := range validatorKeyAnnouncements(tx) {
+		err := checkValidatorKey(msg, tx,
+			s.blockManager.chain.AdminKeySets(), s.sigCache)
+		if err != nil {
+			srvrLog.Debugf("Not announcing validator key: %v", err)
+			continue
+		}
+		s.announceValidatorKey(msg)
+	}
+}
+
+// announceValidatorKey relays the passed validator key announcement to all
+// peers which support validator key announcements unless it is already known.
+// The announcement is logged so unexpected provisioning attempts can be
+// noticed.
+func (s *server) announceValidatorKey(msg *wire.MsgValidatorKey) {
+	if !s.validatorKeys.Add(msg) {
+		return
+	}
+
+	srvrLog.Infof("Validator key announcement: %v of key %x (key id %d) "+
+		"by transaction %v", msg.Op, msg.PubKey, msg.KeyID, msg.TxHash)
+	hash := msg.AnnouncementHash()
+	s.RelayInventory(wire.NewInvVect(wire.InvTypeValidatorKey, &hash), msg)
+}
+
+// fetchTransaction returns the transaction with the provided hash from the
+// memory pool or, when the transaction index is enabled, from the chain.  An
+// error is returned if the transaction is not known.
+func (s *server) fetchTransaction(hash *chainhash.Hash) (*provautil.Tx, error) {
+	if tx, err := s.txMemPool.FetchTransaction(hash); err == nil {
+		return tx, nil
+	}
+	if s.txIndex == nil {
+		return nil, fmt.Errorf("transaction %v is not in the memory "+
+			"pool", hash)
+	}
+
+	blockRegion, err := s.txIndex.TxBlockRegion(hash)
+	if err != nil {
+		return nil, err
+	}
+	if blockRegion == nil {
+		return nil, fmt.Errorf("transaction %v is not known", hash)
+	}
+	var txBytes []byte
+	err = s.db.View(func(dbTx database.Tx) error {
+		var err error
+		txBytes, err = dbTx.FetchBlockRegion(blockRegion)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return provautil.NewTxFromBytes(txBytes)
+}
+
+// pushValidatorKeyMsg sends a validatorkey message for the provided
+// announcement hash to the connected peer.  An error is returned if the
+// announcement is not known.
+func (s *server) pushValidatorKeyMsg(sp *serverPeer, hash *chainhash.Hash, doneChan chan<- struct{}, waitChan <-chan struct{}) error {
+	msg := s.validatorKeys.Lookup(hash)
+	if msg == nil {
+		peerLog.Tracef("Unable to fetch validator key announcement %v",
+			hash)
+
+		if doneChan != nil {
+			doneChan <- struct{}{}
 		}
+		return fmt.Errorf("validator key announcement %v is not known",
+			hash)
+	}
+
+	// Once we have fetched data wait for any previous operation to finish.
+	if waitChan != nil {
+		<-waitChan
 	}
+
+	sp.QueueMessage(msg, doneChan)
+
+	return nil
 }
 
 // pushTxMsg sends a tx message for the provided transaction hash to the
@@ -1192,6 +1766,36 @@ func (s *server) pushMerkleBlockMsg(sp *serverPeer, hash *chainhash.Hash, doneCh
 	return nil
 }
 
+// pushCmpctBlockMsg sends a cmpctblock message for the provided block hash to
+// the connected peer.  An error is returned if the block hash is not known.
+func (s *server) pushCmpctBlockMsg(sp *serverPeer, hash *chainhash.Hash, doneChan chan<- struct{}, waitChan <-chan struct{}) error {
+	blk, err := sp.server.blockManager.chain.BlockByHash(hash)
+	if err != nil {
+		peerLog.Tracef("Unable to fetch requested block hash %v: %v",
+			hash, err)
+
+		if doneChan != nil {
+			doneChan <- struct{}{}
+		}
+		return err
+	}
+	nonce, err := wire.RandomUint64()
+	if err != nil {
+		if doneChan != nil {
+			doneChan <- struct{}{}
+		}
+		return err
+	}
+	msg := newCmpctBlock(blk, nonce)
+
+	// Once we have fetched data wait for any previous operation to finish.
+	if waitChan != nil {
+		<-waitChan
+	}
+	sp.QueueMessage(msg, doneChan)
+	return nil
+}
+
 // handleUpdatePeerHeight updates the heights of all peers who were known to
 // announce a block we recently accepted.
 func (s *server) handleUpdatePeerHeights(state *peerState, umsg updatePeerHeightsMsg) {
@@ -1227,6 +1831,12 @@ func (s *server) handleAddPeerMsg(state *peerState, sp *serverPeer) bool {
 		return false
 	}
 
+	// The network group of an outbound peer is counted below once it is
+	// added, so the group reserved while it was dialed is not needed.
+	if !sp.Inbound() {
+		s.releaseDialGroup(sp.Addr())
+	}
+
 	// Ignore new peers if we're shutting down.
 	if atomic.LoadInt32(&s.shutdown) != 0 {
 		srvrLog.Infof("New peer %s ignored - server is shutting down", sp)
@@ -1234,27 +1844,30 @@ func (s *server) handleAddPeerMsg(state *peerState, sp *serverPeer) bool {
 		return false
 	}
 
-	// Disconnect banned peers.
+	// Disconnect banned peers unless they are whitelisted.
 	host, _, err := net.SplitHostPort(sp.Addr())
 	if err != nil {
 		srvrLog.Debugf("can't split hostport %v", err)
 		sp.Disconnect()
 		return false
 	}
-	if banEnd, ok := state.banned[host]; ok {
-		if time.Now().Before(banEnd) {
+	if ip := net.ParseIP(host); ip != nil && !sp.isWhitelisted {
+		if banEnd, banned := s.banManager.IsBanned(ip); banned {
 			srvrLog.Debugf("Peer %s is banned for another %v - disconnecting",
 				host, banEnd.Sub(time.Now()))
 			sp.Disconnect()
 			return false
 		}
-
-		srvrLog.Infof("Peer %s is no longer banned", host)
-		delete(state.banned, host)
 	}
 
 	// TODO: Check for max peers from a single IP.
 
+	// Evict an inbound peer to make room for a new inbound peer when all
+	// slots are taken so idle peers can't occupy them.
+	if sp.Inbound() && state.Count() >= cfg.MaxPeers {
+		s.evictInboundPeer(state)
+	}
+
 	// Limit max number of total peers.
 	if state.Count() >= cfg.MaxPeers {
 		srvrLog.Infof("Max peers reached [%d] - disconnecting peer %s",
@@ -1296,7 +1909,10 @@ func (s *server) handleDonePeerMsg(state *peerState, sp *serverPeer) {
 		if !sp.Inbound() && sp.VersionKnown() {
 			state.outboundGroups[addrmgr.GroupKey(sp.NA())]--
 		}
-		if !sp.Inbound() && sp.connReq != nil {
+		// The connection of a removed node is already gone.
+		if !sp.Inbound() && sp.connReq != nil &&
+			sp.connReq.State() == connmgr.ConnEstablished {
+
 			s.connManager.Disconnect(sp.connReq.ID())
 		}
 		delete(list, sp.ID())
@@ -1321,15 +1937,44 @@ func (s *server) handleDonePeerMsg(state *peerState, sp *serverPeer) {
 // handleBanPeerMsg deals with banning peers.  It is invoked from the
 // peerHandler goroutine.
 func (s *server) handleBanPeerMsg(state *peerState, sp *serverPeer) {
-	host, _, err := net.SplitHostPort(sp.Addr())
+	// The score starts over once the ban expires.
+	host := sp.host()
+	s.banManager.ResetScore(host)
+
+	// Peers without an IP address, such as onion peers, can't be banned
+	// and are only disconnected.
+	subnet, err := connmgr.ParseSubnet(host)
 	if err != nil {
-		srvrLog.Debugf("can't split ban peer %s %v", sp.Addr(), err)
+		srvrLog.Debugf("can't ban peer %s: %v", sp.Addr(), err)
+		return
+	}
+	err = s.banManager.Ban(subnet, time.Now().Add(cfg.BanDuration),
+		"misbehaving")
+	if err != nil {
+		// The address is already banned.
 		return
 	}
 	direction := directionString(sp.Inbound())
 	srvrLog.Infof("Banned peer %s (%s) for %v", host, direction,
 		cfg.BanDuration)
-	state.banned[host] = time.Now().Add(cfg.BanDuration)
+
+	// Disconnect the other peers connected from and to the address.
+	s.disconnectBanned(state)
+}
+
+// disconnectBanned disconnects all peers whose addresses are banned unless they
+// are whitelisted.  It is invoked from the peerHandler goroutine.
+func (s *server) disconnectBanned(state *peerState) {
+	state.forAllPeers(func(sp *serverPeer) {
+		ip := net.ParseIP(sp.host())
+		if ip == nil || sp.isWhitelisted {
+			return
+		}
+		if _, banned := s.banManager.IsBanned(ip); banned {
+			srvrLog.Infof("Disconnecting banned peer %s", sp)
+			sp.Disconnect()
+		}
+	})
 }
 
 // handleRelayInvMsg deals with relaying inventory to peers that are not already
@@ -1340,62 +1985,88 @@ func (s *server) handleRelayInvMsg(state *peerState, msg relayMsg) {
 			return
 		}
 
-		// If the inventory is a block and the peer prefers headers,
-		// generate and send a headers message instead of an inventory
-		// message.
-		if msg.invVect.Type == wire.InvTypeBlock && sp.WantsHeaders() {
+		sp.relayInventory(msg)
+	})
+}
+
+// relayInventory relays the passed inventory to the peer unless the peer does
+// not want it or is already known to have it.  Transactions are trickled with
+// the next batch and not relayed when the peer disabled relaying them, when
+// their fee rate is below the fee filter of the peer, or when they do not
+// match the bloom filter loaded by the peer.
+// Validator key announcements are only relayed to peers which advertise
+// support for them and are sent right away.
+func (sp *serverPeer) relayInventory(msg relayMsg) {
+	// Blocks are announced right away, but only to peers which are not
+	// already known to have them, such as the peer the block came from.
+	// If the peer prefers headers, generate and send a headers message
+	// instead of an inventory message.  The headers connect the block to
+	// the most recent block the peer is known to have.  When that is not
+	// possible, the block is announced with an inventory message instead.
+	if msg.invVect.Type == wire.InvTypeBlock {
+		var headers []*wire.BlockHeader
+		if sp.HasCapability(peer.CapSendHeaders) {
 			blockHeader, ok := msg.data.(wire.BlockHeader)
 			if !ok {
 				peerLog.Warnf("Underlying data for headers" +
 					" is not a block header")
 				return
 			}
-			msgHeaders := wire.NewMsgHeaders()
-			if err := msgHeaders.AddBlockHeader(&blockHeader); err != nil {
-				peerLog.Errorf("Failed to add block"+
-					" header: %v", err)
-				return
-			}
-			sp.QueueMessage(msgHeaders, nil)
+			headers = announcementHeaders(sp.server.blockManager.chain,
+				sp.getKnownBlock(), &blockHeader)
+		}
+		if sp.QueueBlockAnnouncement(msg.invVect, headers) &&
+			headers != nil {
+
+			sp.setKnownBlock(&msg.invVect.Hash)
+		}
+		return
+	}
+
+	// Validator key announcements are only relayed to peers which support
+	// them.  They are rare and meant to be noticed quickly, so they are
+	// not trickled.
+	if msg.invVect.Type == wire.InvTypeValidatorKey {
+		if sp.Services()&wire.SFNodeValidatorKey == wire.SFNodeValidatorKey {
+			sp.QueueInventoryImmediate(msg.invVect)
+		}
+		return
+	}
+
+	if msg.invVect.Type == wire.InvTypeTx {
+		// Don't relay the transaction to the peer when it has
+		// transaction relaying disabled.
+		if sp.relayTxDisabled() {
 			return
 		}
 
-		if msg.invVect.Type == wire.InvTypeTx {
-			// Don't relay the transaction to the peer when it has
-			// transaction relaying disabled.
-			if sp.relayTxDisabled() {
-				return
-			}
+		txD, ok := msg.data.(*mempool.TxDesc)
+		if !ok {
+			peerLog.Warnf("Underlying data for tx inv "+
+				"relay is not a *mempool.TxDesc: %T",
+				msg.data)
+			return
+		}
 
-			txD, ok := msg.data.(*mempool.TxDesc)
-			if !ok {
-				peerLog.Warnf("Underlying data for tx inv "+
-					"relay is not a *mempool.TxDesc: %T",
-					msg.data)
-				return
-			}
+		// Don't relay the transaction if the transaction fee-per-kb
+		// is less than the peer's feefilter.
+		if !sp.feeFilterAllows(txD.FeePerKB) {
+			return
+		}
 
-			// Don't relay the transaction if the transaction fee-per-kb
-			// is less than the peer's feefilter.
-			feeFilter := atomic.LoadInt64(&sp.feeFilter)
-			if feeFilter > 0 && txD.FeePerKB < feeFilter {
+		// Don't relay the transaction if there is a bloom
+		// filter loaded and the transaction doesn't match it.
+		if sp.filter.IsLoaded() {
+			if !sp.filter.MatchTxAndUpdate(txD.Tx) {
 				return
 			}
-
-			// Don't relay the transaction if there is a bloom
-			// filter loaded and the transaction doesn't match it.
-			if sp.filter.IsLoaded() {
-				if !sp.filter.MatchTxAndUpdate(txD.Tx) {
-					return
-				}
-			}
 		}
+	}
 
-		// Queue the inventory to be relayed with the next batch.
-		// It will be ignored if the peer is already known to
-		// have the inventory.
-		sp.QueueInventory(msg.invVect)
-	})
+	// Queue the inventory to be relayed with the next batch.
+	// It will be ignored if the peer is already known to
+	// have the inventory.
+	sp.QueueInventory(msg.invVect)
 }
 
 // handleBroadcastMsg deals with broadcasting messages to peers.  It is invoked
@@ -1424,13 +2095,12 @@ type getPeersMsg struct {
 	reply chan []*serverPeer
 }
 
-type getOutboundGroup struct {
-	key   string
-	reply chan int
+type getOutboundGroupsMsg struct {
+	reply chan map[string]struct{}
 }
 
 type getAddedNodesMsg struct {
-	reply chan []*serverPeer
+	reply chan []*addedNode
 }
 
 type disconnectNodeMsg struct {
@@ -1438,6 +2108,10 @@ type disconnectNodeMsg struct {
 	reply chan error
 }
 
+type disconnectBannedMsg struct {
+	reply chan struct{}
+}
+
 type connectNodeMsg struct {
 	addr      string
 	permanent bool
@@ -1445,7 +2119,7 @@ type connectNodeMsg struct {
 }
 
 type removeNodeMsg struct {
-	cmp   func(*serverPeer) bool
+	cmp   func(addr string, sp *serverPeer) bool
 	reply chan error
 }
 
@@ -1472,20 +2146,32 @@ func (s *server) handleQuery(state *peerState, querymsg interface{}) {
 		})
 		msg.reply <- peers
 
+	case disconnectBannedMsg:
+		s.disconnectBanned(state)
+		msg.reply <- struct{}{}
 	case connectNodeMsg:
-		// TODO: duplicate oneshots?
 		// Limit max number of total peers.
 		if state.Count() >= cfg.MaxPeers {
 			msg.reply <- errors.New("max peers reached")
 			return
 		}
-		for _, peer := range state.persistentPeers {
-			if peer.Addr() == msg.addr {
-				if msg.permanent {
-					msg.reply <- errors.New("peer already connected")
-				} else {
-					msg.reply <- errors.New("peer exists as a permanent peer")
+		if _, ok := s.addedNodes[msg.addr]; ok {
+			if msg.permanent {
+				msg.reply <- errors.New("node already added")
+			} else {
+				msg.reply <- errors.New("peer exists as a permanent peer")
+			}
+			return
+		}
+		if !msg.permanent {
+			var connected bool
+			state.forAllOutboundPeers(func(sp *serverPeer) {
+				if sp.Addr() == msg.addr {
+					connected = true
 				}
+			})
+			if connected {
+				msg.reply <- errors.New("peer already connected")
 				return
 			}
 		}
@@ -1496,39 +2182,64 @@ func (s *server) handleQuery(state *peerState, querymsg interface{}) {
 			return
 		}
 
-		// TODO: if too many, nuke a non-perm peer.
-		go s.connManager.Connect(&connmgr.ConnReq{
+		// Permanent nodes are tracked so they can be listed and removed
+		// while they are reconnected.  Neither permanent nor one time
+		// connections count toward the target number of outbound peers.
+		connReq := &connmgr.ConnReq{
 			Addr:      netAddr,
 			Permanent: msg.permanent,
-		})
+		}
+		if msg.permanent {
+			s.addedNodes[msg.addr] = connReq
+		}
+		go s.connManager.Connect(connReq)
 		msg.reply <- nil
 	case removeNodeMsg:
-		found := disconnectPeer(state.persistentPeers, msg.cmp, func(sp *serverPeer) {
-			// Keep group counts ok since we remove from
-			// the list now.
-			state.outboundGroups[addrmgr.GroupKey(sp.NA())]--
-		})
+		// Remove the connection request of the added node so it is no
+		// longer retried.  This also disconnects the peer connected to
+		// it, if any, which is then removed from the persistent peers
+		// once it is done.
+		found := false
+		for addr, connReq := range s.addedNodes {
+			if !msg.cmp(addr, addedNodePeer(state, connReq)) {
+				continue
+			}
+			delete(s.addedNodes, addr)
+			s.connManager.RemoveReq(connReq)
+			found = true
+			break
+		}
 
 		if found {
 			msg.reply <- nil
 		} else {
 			msg.reply <- errors.New("peer not found")
 		}
-	case getOutboundGroup:
-		count, ok := state.outboundGroups[msg.key]
-		if ok {
-			msg.reply <- count
-		} else {
-			msg.reply <- 0
+	case getOutboundGroupsMsg:
+		groups := make(map[string]struct{}, len(state.outboundGroups))
+		for key, count := range state.outboundGroups {
+			if count > 0 {
+				groups[key] = struct{}{}
+			}
 		}
-	// Request a list of the persistent (added) peers.
+		msg.reply <- groups
+	// Request a list of the added nodes.
 	case getAddedNodesMsg:
-		// Respond with a slice of the relavent peers.
-		peers := make([]*serverPeer, 0, len(state.persistentPeers))
-		for _, sp := range state.persistentPeers {
-			peers = append(peers, sp)
+		// Respond with the added nodes sorted by their address along
+		// with the peers connected to them.
+		nodes := make([]*addedNode, 0, len(s.addedNodes))
+		for addr, connReq := range s.addedNodes {
+			nodes = append(nodes, &addedNode{
+				addr:    addr,
+				state:   connReq.State(),
+				retries: connReq.RetryCount(),
+				peer:    addedNodePeer(state, connReq),
+			})
 		}
-		msg.reply <- peers
+		sort.Slice(nodes, func(i, j int) bool {
+			return nodes[i].addr < nodes[j].addr
+		})
+		msg.reply <- nodes
 	case disconnectNodeMsg:
 		// Check inbound peers. We pass a nil callback since we don't
 		// require any additional actions on disconnect for inbound peers.
@@ -1561,6 +2272,63 @@ func (s *server) handleQuery(state *peerState, querymsg interface{}) {
 	}
 }
 
+// addedNode describes a node added via the --addpeer and --connect options or
+// the addnode RPC.
+type addedNode struct {
+	// addr is the address the node was added with.
+	addr string
+
+	// state is the state of the connection to the node and retries is the
+	// number of failed attempts to reconnect to it since it was last
+	// connected.
+	state   connmgr.ConnState
+	retries uint32
+
+	// peer is the peer connected to the node or nil when there is none.
+	peer *serverPeer
+}
+
+// addedNodePeer returns the persistent peer connected via the passed
+// connection request of an added node or nil when there is none.
+func addedNodePeer(state *peerState, connReq *connmgr.ConnReq) *serverPeer {
+	for _, sp := range state.persistentPeers {
+		if sp.connReq == connReq {
+			return sp
+		}
+	}
+	return nil
+}
+
+// isWhitelisted returns whether the IP address is included in the whitelisted
+// networks and IPs, along with the relay policy exemptions of all of the
+// whitelists which include it.
+func isWhitelisted(addr net.Addr) (bool, mempool.PolicyExemptions) {
+	if len(cfg.whitelists) == 0 {
+		return false, 0
+	}
+
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		srvrLog.Warnf("Unable to SplitHostPort on '%s': %v", addr, err)
+		return false, 0
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		srvrLog.Warnf("Unable to parse IP '%s'", addr)
+		return false, 0
+	}
+
+	whitelisted := false
+	var exemptions mempool.PolicyExemptions
+	for _, wl := range cfg.whitelists {
+		if wl.ipnet.Contains(ip) {
+			whitelisted = true
+			exemptions |= wl.exemptions
+		}
+	}
+	return whitelisted, exemptions
+}
+
 // disconnectPeer attempts to drop the connection of a tageted peer in the
 // passed peer list. Targets are identified via usage of the passed
 // `compareFunc`, which should return `true` if the passed peer is the target
@@ -1589,22 +2357,29 @@ func disconnectPeer(peerList map[int32]*serverPeer, compareFunc func(*serverPeer
 func newPeerConfig(sp *serverPeer) *peer.Config {
 	return &peer.Config{
 		Listeners: peer.MessageListeners{
-			OnVersion:     sp.OnVersion,
-			OnMemPool:     sp.OnMemPool,
-			OnTx:          sp.OnTx,
-			OnBlock:       sp.OnBlock,
-			OnInv:         sp.OnInv,
-			OnGetData:     sp.OnGetData,
-			OnGetBlocks:   sp.OnGetBlocks,
-			OnGetHeaders:  sp.OnGetHeaders,
-			OnFeeFilter:   sp.OnFeeFilter,
-			OnFilterAdd:   sp.OnFilterAdd,
-			OnFilterClear: sp.OnFilterClear,
-			OnFilterLoad:  sp.OnFilterLoad,
-			OnGetAddr:     sp.OnGetAddr,
-			OnAddr:        sp.OnAddr,
-			OnRead:        sp.OnRead,
-			OnWrite:       sp.OnWrite,
+			OnVersion:      sp.OnVersion,
+			OnVerAck:       sp.OnVerAck,
+			OnMemPool:      sp.OnMemPool,
+			OnTx:           sp.OnTx,
+			OnBlock:        sp.OnBlock,
+			OnInv:          sp.OnInv,
+			OnGetData:      sp.OnGetData,
+			OnGetBlocks:    sp.OnGetBlocks,
+			OnGetHeaders:   sp.OnGetHeaders,
+			OnHeaders:      sp.OnHeaders,
+			OnFeeFilter:    sp.OnFeeFilter,
+			OnCmpctBlock:   sp.OnCmpctBlock,
+			OnGetBlockTxn:  sp.OnGetBlockTxn,
+			OnBlockTxn:     sp.OnBlockTxn,
+			OnFilterAdd:    sp.OnFilterAdd,
+			OnFilterClear:  sp.OnFilterClear,
+			OnFilterLoad:   sp.OnFilterLoad,
+			OnGetAddr:      sp.OnGetAddr,
+			OnAddr:         sp.OnAddr,
+			OnAddrV2:       sp.OnAddrV2,
+			OnValidatorKey: sp.OnValidatorKey,
+			OnRead:         sp.OnRead,
+			OnWrite:        sp.OnWrite,
 
 			// Note: The reference client currently bans peers that send alerts
 			// not signed with its key.  We could verify against their key, but
@@ -1612,15 +2387,16 @@ func newPeerConfig(sp *serverPeer) *peer.Config {
 			// other implementations' alert messages, we will not relay theirs.
 			OnAlert: nil,
 		},
-		NewestBlock:      sp.newestBlock,
-		HostToNetAddress: sp.server.addrManager.HostToNetAddress,
-		Proxy:            cfg.Proxy,
-		UserAgentName:    userAgentName,
-		UserAgentVersion: userAgentVersion,
-		ChainParams:      sp.server.chainParams,
-		Services:         sp.server.services,
-		DisableRelayTx:   cfg.BlocksOnly,
-		ProtocolVersion:  wire.FeeFilterVersion,
+		NewestBlock:       sp.newestBlock,
+		HostToNetAddress:  sp.server.addrManager.HostToNetAddress,
+		Proxy:             cfg.Proxy,
+		UserAgentName:     userAgentName,
+		UserAgentVersion:  userAgentVersion,
+		UserAgentComments: cfg.UserAgentComments,
+		ChainParams:       sp.server.chainParams,
+		Services:          sp.server.services,
+		DisableRelayTx:    cfg.BlocksOnly,
+		ProtocolVersion:   wire.AddrV2Version,
 	}
 }
 
@@ -1630,11 +2406,118 @@ func newPeerConfig(sp *serverPeer) *peer.Config {
 // for disconnection.
 func (s *server) inboundPeerConnected(conn net.Conn) {
 	sp := newServerPeer(s, false)
+	sp.isWhitelisted, sp.exemptions = isWhitelisted(conn.RemoteAddr())
 	sp.Peer = peer.NewInboundPeer(newPeerConfig(sp))
 	sp.AssociateConnection(conn)
 	go s.peerDoneHandler(sp)
 }
 
+// relaxGroupsTries is the number of tries after which newOutboundAddress also
+// picks addresses from the network groups which already have outbound
+// connections, since the addresses outside of them were all skipped.
+const relaxGroupsTries = 75
+
+// newOutboundAddress returns the address of a new automatic outbound
+// connection.  It is only picked from the network groups which are not yet
+// represented among the outbound peers and the connections being dialed, so a
+// single network segment, such as a hosting provider, can not take over all of
+// the outbound connections.  The constraint is only relaxed once there are no
+// other candidates.
+func (s *server) newOutboundAddress() (net.Addr, error) {
+	excluded := s.OutboundGroups()
+	s.dialGroupsMtx.Lock()
+	for _, group := range s.dialGroups {
+		excluded[group] = struct{}{}
+	}
+	s.dialGroupsMtx.Unlock()
+
+	// The candidates are only selected once instead of scanning all of the
+	// known addresses on every try.
+	var candidates *addrmgr.AddressCandidates
+	if len(excluded) != 0 {
+		candidates = s.addrManager.CandidatesExcluding(excluded)
+	}
+	for tries := 0; tries < 100; tries++ {
+		// Relax the constraint once there are no addresses outside of
+		// the excluded network groups or all of them were skipped.
+		var addr *addrmgr.KnownAddress
+		if candidates != nil {
+			addr = candidates.GetAddress()
+			if addr == nil || tries >= relaxGroupsTries {
+				srvrLog.Debugf("No usable addresses outside of "+
+					"the %d outbound network groups -- "+
+					"allowing the same groups", len(excluded))
+				candidates = nil
+			}
+		}
+		if candidates == nil {
+			addr = s.addrManager.GetAddress()
+		}
+		if addr == nil {
+			break
+		}
+
+		// Address will not be invalid, local or unroutable
+		// because addrmanager rejects those on addition.
+
+		// Skip the addresses which can't be dialed with the
+		// configured proxies.
+		if !btcdCanDial(addr.NetAddress()) {
+			continue
+		}
+
+		// Don't connect to banned addresses.
+		_, banned := s.banManager.IsBanned(addr.NetAddress().IP)
+		if banned {
+			continue
+		}
+
+		// only allow recent nodes (10mins) after we failed 30
+		// times
+		if tries < 30 && time.Since(addr.LastAttempt()) < 10*time.Minute {
+			continue
+		}
+
+		// allow nondefault ports after 50 failed tries.
+		if tries < 50 && fmt.Sprintf("%d", addr.NetAddress().Port) !=
+			activeNetParams.DefaultPort {
+			continue
+		}
+
+		addrString := addrmgr.NetAddressKey(addr.NetAddress())
+		netAddr, err := addrStringToNetAddr(addrString)
+		if err != nil {
+			return nil, err
+		}
+		s.dialGroupsMtx.Lock()
+		s.dialGroups[netAddr.String()] = addrmgr.GroupKey(addr.NetAddress())
+		s.dialGroupsMtx.Unlock()
+		return netAddr, nil
+	}
+
+	return nil, errors.New("no valid connect address")
+}
+
+// releaseDialGroup releases the network group reserved by newOutboundAddress
+// for the connection to the passed address.  It is invoked once the
+// connection failed or the peer was added to or rejected by the peer handler,
+// which counts the groups of the connected outbound peers itself.
+func (s *server) releaseDialGroup(addr string) {
+	s.dialGroupsMtx.Lock()
+	delete(s.dialGroups, addr)
+	s.dialGroupsMtx.Unlock()
+}
+
+// dialOutbound dials the address of an outbound connection and releases its
+// reserved network group when the dial fails.
+func (s *server) dialOutbound(addr net.Addr) (net.Conn, error) {
+	conn, err := btcdDial(addr)
+	if err != nil {
+		s.releaseDialGroup(addr.String())
+	}
+	return conn, err
+}
+
 // outboundPeerConnected is invoked by the connection manager when a new
 // outbound connection is established.  It initializes a new outbound server
 // peer instance, associates it with the relevant state such as the connection
@@ -1642,6 +2525,7 @@ func (s *server) inboundPeerConnected(conn net.Conn) {
 // manager of the attempt.
 func (s *server) outboundPeerConnected(c *connmgr.ConnReq, conn net.Conn) {
 	sp := newServerPeer(s, c.Permanent)
+	sp.isWhitelisted, sp.exemptions = isWhitelisted(conn.RemoteAddr())
 	p, err := peer.NewOutboundPeer(newPeerConfig(sp), c.Addr.String())
 	if err != nil {
 		srvrLog.Debugf("Cannot create outbound peer %s: %v", c.Addr, err)
@@ -1658,6 +2542,9 @@ func (s *server) outboundPeerConnected(c *connmgr.ConnReq, conn net.Conn) {
 // done along with other performing other desirable cleanup.
 func (s *server) peerDoneHandler(sp *serverPeer) {
 	sp.WaitForDisconnect()
+	if !sp.Inbound() {
+		s.releaseDialGroup(sp.Addr())
+	}
 	s.donePeers <- sp
 
 	// Only tell block manager we are gone if we ever told it we existed.
@@ -1693,7 +2580,6 @@ func (s *server) peerHandler() {
 		inboundPeers:    make(map[int32]*serverPeer),
 		persistentPeers: make(map[int32]*serverPeer),
 		outboundPeers:   make(map[int32]*serverPeer),
-		banned:          make(map[string]time.Time),
 		outboundGroups:  make(map[string]int),
 	}
 
@@ -1711,16 +2597,21 @@ func (s *server) peerHandler() {
 	}
 	go s.connManager.Start()
 
+	feeFilterTicker := time.NewTicker(feeFilterUpdateInterval)
+	defer feeFilterTicker.Stop()
+
 out:
 	for {
 		select {
 		// New peers connected to the server.
 		case p := <-s.newPeers:
 			s.handleAddPeerMsg(state, p)
+			s.peerMetrics.update(state)
 
 		// Disconnected peers.
 		case p := <-s.donePeers:
 			s.handleDonePeerMsg(state, p)
+			s.peerMetrics.update(state)
 
 		// Block accepted in mainchain or orphan, update peer height.
 		case umsg := <-s.peerHeightsUpdate:
@@ -1742,7 +2633,21 @@ out:
 		case qmsg := <-s.query:
 			s.handleQuery(state, qmsg)
 
+		// Announce changes to the minimum fee rate of the mempool.
+		case <-feeFilterTicker.C:
+			minFee := s.txMemPool.MinRelayFeeRate()
+			state.forAllPeers(func(sp *serverPeer) {
+				if sp.Connected() {
+					sp.pushFeeFilter(minFee)
+				}
+			})
+
 		case <-s.quit:
+			// Persist the long-lived outbound peers before they
+			// are disconnected so they are connected first on the
+			// next startup.
+			s.saveAnchors(state)
+
 			// Disconnect all peers on server shutdown.
 			state.forAllPeers(func(sp *serverPeer) {
 				srvrLog.Tracef("Shutdown peer %s", sp)
@@ -1752,8 +2657,10 @@ out:
 		}
 	}
 
+	// The block manager is stopped separately by the shutdown sequence
+	// once the peers are disconnected so it can finish processing the
+	// blocks in flight.
 	s.connManager.Stop()
-	s.blockManager.Stop()
 	s.addrManager.Stop()
 
 	// Drain channels before exiting so nothing is left waiting around
@@ -1788,7 +2695,12 @@ func (s *server) BanPeer(sp *serverPeer) {
 // RelayInventory relays the passed inventory vector to all connected peers
 // that are not already known to have it.
 func (s *server) RelayInventory(invVect *wire.InvVect, data interface{}) {
-	s.relayInv <- relayMsg{invVect: invVect, data: data}
+	// The block manager may still relay the blocks and transactions it
+	// processes after the peer handler stopped during shutdown.
+	select {
+	case s.relayInv <- relayMsg{invVect: invVect, data: data}:
+	case <-s.quit:
+	}
 }
 
 // BroadcastMessage sends msg to all peers currently connected to the server
@@ -1797,7 +2709,10 @@ func (s *server) BroadcastMessage(msg wire.Message, exclPeers ...*serverPeer) {
 	// XXX: Need to determine if this is an alert that has already been
 	// broadcast and refrain from broadcasting again.
 	bmsg := broadcastMsg{message: msg, excludePeers: exclPeers}
-	s.broadcast <- bmsg
+	select {
+	case s.broadcast <- bmsg:
+	case <-s.quit:
+	}
 }
 
 // ConnectedCount returns the number of currently connected peers.
@@ -1809,18 +2724,17 @@ func (s *server) ConnectedCount() int32 {
 	return <-replyChan
 }
 
-// OutboundGroupCount returns the number of peers connected to the given
-// outbound group key.
-func (s *server) OutboundGroupCount(key string) int {
-	replyChan := make(chan int)
-	s.query <- getOutboundGroup{key: key, reply: replyChan}
+// OutboundGroups returns the network groups of the connected outbound peers.
+func (s *server) OutboundGroups() map[string]struct{} {
+	replyChan := make(chan map[string]struct{})
+	s.query <- getOutboundGroupsMsg{reply: replyChan}
 	return <-replyChan
 }
 
-// AddedNodeInfo returns an array of btcjson.GetAddedNodeInfoResult structures
-// describing the persistent (added) nodes.
-func (s *server) AddedNodeInfo() []*serverPeer {
-	replyChan := make(chan []*serverPeer)
+// AddedNodeInfo returns the nodes added via the --addpeer and --connect options
+// or the addnode RPC along with the state of their connections.
+func (s *server) AddedNodeInfo() []*addedNode {
+	replyChan := make(chan []*addedNode)
 	s.query <- getAddedNodesMsg{reply: replyChan}
 	return <-replyChan
 }
@@ -1848,6 +2762,16 @@ func (s *server) DisconnectNodeByAddr(addr string) error {
 	return <-replyChan
 }
 
+// DisconnectBanned disconnects all peers whose addresses are banned unless they
+// are whitelisted.  It is used to enforce bans which were added manually.
+func (s *server) DisconnectBanned() {
+	replyChan := make(chan struct{})
+
+	s.query <- disconnectBannedMsg{reply: replyChan}
+
+	<-replyChan
+}
+
 // DisconnectNodeByID disconnects a peer by target node id. Both outbound and
 // inbound nodes will be searched for the target node. An error message will be
 // returned if the peer was not found.
@@ -1862,26 +2786,30 @@ func (s *server) DisconnectNodeByID(id int32) error {
 	return <-replyChan
 }
 
-// RemoveNodeByAddr removes a peer from the list of persistent peers if
-// present. An error will be returned if the peer was not found.
+// RemoveNodeByAddr removes a node from the added nodes if present, so it is
+// disconnected and no longer reconnected. An error will be returned if the node
+// was not found.
 func (s *server) RemoveNodeByAddr(addr string) error {
 	replyChan := make(chan error)
 
 	s.query <- removeNodeMsg{
-		cmp:   func(sp *serverPeer) bool { return sp.Addr() == addr },
+		cmp:   func(a string, sp *serverPeer) bool { return a == addr },
 		reply: replyChan,
 	}
 
 	return <-replyChan
 }
 
-// RemoveNodeByID removes a peer by node ID from the list of persistent peers
-// if present. An error will be returned if the peer was not found.
+// RemoveNodeByID removes the added node connected to the peer with the passed
+// node ID if present, so it is disconnected and no longer reconnected. An error
+// will be returned if the peer was not found.
 func (s *server) RemoveNodeByID(id int32) error {
 	replyChan := make(chan error)
 
 	s.query <- removeNodeMsg{
-		cmp:   func(sp *serverPeer) bool { return sp.ID() == id },
+		cmp: func(a string, sp *serverPeer) bool {
+			return sp != nil && sp.ID() == id
+		},
 		reply: replyChan,
 	}
 
@@ -1889,8 +2817,11 @@ func (s *server) RemoveNodeByID(id int32) error {
 }
 
 // ConnectNode adds `addr' as a new outbound peer. If permanent is true then the
-// peer will be persistent and reconnect if the connection is lost.
-// It is an error to call this with an already existing peer.
+// node is added and the peer will be persistent and reconnect with an
+// increasing backoff if the connection is lost or can't be established,
+// otherwise a single connection attempt is made.  Neither counts toward the
+// target number of outbound peers.  It is an error to call this with an already
+// added node.
 func (s *server) ConnectNode(addr string, permanent bool) error {
 	replyChan := make(chan error)
 
@@ -1918,76 +2849,27 @@ func (s *server) NetTotals() (uint64, uint64) {
 		atomic.LoadUint64(&s.bytesSent)
 }
 
+// MsgTotals returns the number of messages and bytes received from and sent to
+// all peers per message command.  It is safe for concurrent access.
+func (s *server) MsgTotals() (map[string]peer.MsgStats, map[string]peer.MsgStats) {
+	return s.msgsReceived.Snapshot(), s.msgsSent.Snapshot()
+}
+
 // UpdatePeerHeights updates the heights of all peers who have have announced
 // the latest connected main chain block, or a recognized orphan. These height
 // updates allow us to dynamically refresh peer heights, ensuring sync peer
 // selection has access to the latest block heights for each peer.
 func (s *server) UpdatePeerHeights(latestBlkHash *chainhash.Hash, latestHeight uint32, updateSource *serverPeer) {
-	s.peerHeightsUpdate <- updatePeerHeightsMsg{
+	select {
+	case s.peerHeightsUpdate <- updatePeerHeightsMsg{
 		newHash:    latestBlkHash,
 		newHeight:  latestHeight,
 		originPeer: updateSource,
+	}:
+	case <-s.quit:
 	}
 }
 
-// rebroadcastHandler keeps track of user submitted inventories that we have
-// sent out but have not yet made it into a block. We periodically rebroadcast
-// them in case our peers restarted or otherwise lost track of them.
-func (s *server) rebroadcastHandler() {
-	// Wait 5 min before first tx rebroadcast.
-	timer := time.NewTimer(5 * time.Minute)
-	pendingInvs := make(map[wire.InvVect]interface{})
-
-out:
-	for {
-		select {
-		case riv := <-s.modifyRebroadcastInv:
-			switch msg := riv.(type) {
-			// Incoming InvVects are added to our map of RPC txs.
-			case broadcastInventoryAdd:
-				pendingInvs[*msg.invVect] = msg.data
-
-			// When an InvVect has been added to a block, we can
-			// now remove it, if it was present.
-			case broadcastInventoryDel:
-				if _, ok := pendingInvs[*msg]; ok {
-					delete(pendingInvs, *msg)
-				}
-			}
-
-		case <-timer.C:
-			// Any inventory we have has not made it into a block
-			// yet. We periodically resubmit them until they have.
-			for iv, data := range pendingInvs {
-				ivCopy := iv
-				s.RelayInventory(&ivCopy, data)
-			}
-
-			// Process at a random time up to 30mins (in seconds)
-			// in the future.
-			timer.Reset(time.Second *
-				time.Duration(randomUint16Number(1800)))
-
-		case <-s.quit:
-			break out
-		}
-	}
-
-	timer.Stop()
-
-	// Drain channels before exiting so nothing is left waiting around
-	// to send.
-cleanup:
-	for {
-		select {
-		case <-s.modifyRebroadcastInv:
-		default:
-			break cleanup
-		}
-	}
-	s.wg.Done()
-}
-
 // Start begins accepting connections from peers.
 func (s *server) Start() {
 	// Already started?
@@ -1996,6 +2878,7 @@ func (s *server) Start() {
 	}
 
 	srvrLog.Trace("Starting server")
+	s.startupTime = time.Now().Unix()
 
 	// Start the peer handler which in turn starts the address and block
 	// managers.
@@ -2004,17 +2887,25 @@ func (s *server) Start() {
 
 	if s.nat != nil {
 		s.wg.Add(1)
-		go s.upnpUpdateThread()
+		go s.natUpdateThread()
 	}
 
+	// Start the broadcast manager, which ensures the transactions
+	// submitted locally are announced until they are included in a block.
+	s.broadcastManager.Start()
+
 	if !cfg.DisableRPC {
-		s.wg.Add(1)
+		s.rpcServer.Start()
+	}
 
-		// Start the rebroadcastHandler, which ensures user tx received by
-		// the RPC server are rebroadcast until being included in a block.
-		go s.rebroadcastHandler()
+	// Start the REST server if it's enabled.
+	if s.restServer != nil {
+		s.restServer.Start()
+	}
 
-		s.rpcServer.Start()
+	// Start the metrics server if it's enabled.
+	if s.metricsServer != nil {
+		s.metricsServer.Start()
 	}
 
 	// Start the CPU miner if generation is enabled.
@@ -2042,6 +2933,18 @@ func (s *server) Stop() error {
 		s.rpcServer.Stop()
 	}
 
+	// Shutdown the REST server if it's enabled.
+	if s.restServer != nil {
+		s.restServer.Stop()
+	}
+
+	// Shutdown the metrics server if it's enabled.
+	if s.metricsServer != nil {
+		s.metricsServer.Stop()
+	}
+
+	s.broadcastManager.Stop()
+
 	// Signal the remaining goroutines to quit.
 	close(s.quit)
 	return nil
@@ -2052,6 +2955,36 @@ func (s *server) WaitForShutdown() {
 	s.wg.Wait()
 }
 
+// registerShutdown registers the steps which shut down the server and its
+// subsystems with the passed shutdown coordinator.  The RPC server, CPU miner
+// and peers are stopped first so no new work arrives, then the block manager
+// finishes the blocks in flight, the utxo set is written and finally the
+// mempool and fee estimator are saved to the data directory.
+func (s *server) registerShutdown(c *shutdownCoordinator) {
+	c.Register("server", shutdownStopIntake, func() error {
+		btcdLog.Infof("Gracefully shutting down the server...")
+		s.Stop()
+		s.WaitForShutdown()
+		srvrLog.Infof("Server shutdown complete")
+		return nil
+	})
+	c.Register("block manager", shutdownDrainBlocks, s.blockManager.Stop)
+
+	// Write the utxo set changes of the most recently connected blocks so
+	// they don't have to be connected again on the next start.
+	c.Register("utxo set", shutdownFlushChain,
+		s.blockManager.chain.FlushUtxoBatch)
+
+	c.Register("mempool", shutdownPersistState, func() error {
+		return saveMempool(s.txMemPool, filepath.Join(cfg.DataDir,
+			mempoolFilename))
+	})
+	c.Register("fee estimator", shutdownPersistState, func() error {
+		return saveFeeEstimator(s.feeEstimator, filepath.Join(cfg.DataDir,
+			feeEstimatesFilename))
+	})
+}
+
 // ScheduleShutdown schedules a server shutdown after the specified duration.
 // It also dynamically adjusts how often to warn the server is going down based
 // on remaining duration.
@@ -2142,44 +3075,152 @@ func parseListeners(addrs []string) ([]string, []string, bool, error) {
 	return ipv4ListenAddrs, ipv6ListenAddrs, haveWildcard, nil
 }
 
-func (s *server) upnpUpdateThread() {
+const (
+	// natLeaseDuration is the lifetime in seconds of the port mapping
+	// requested from the NAT gateway.
+	natLeaseDuration = 20 * 60
+
+	// natRefreshInterval is the interval at which the port mapping is
+	// renewed, which is well within its lease duration.
+	natRefreshInterval = 15 * time.Minute
+)
+
+// discoverNAT searches the local network for a gateway which supports the
+// enabled port mapping protocols, preferring UPnP over NAT-PMP.  A single
+// warning is logged and nil is returned when no gateway is found, in which case
+// the server only accepts inbound connections which were forwarded manually.
+func discoverNAT(upnp, natpmp bool) NAT {
+	var errs []string
+	if upnp {
+		nat, err := Discover()
+		if err == nil {
+			srvrLog.Infof("Discovered UPnP gateway")
+			return nat
+		}
+		errs = append(errs, fmt.Sprintf("UPnP: %v", err))
+	}
+	if natpmp {
+		nat, err := DiscoverNATPMP()
+		if err == nil {
+			srvrLog.Infof("Discovered NAT-PMP gateway")
+			return nat
+		}
+		errs = append(errs, fmt.Sprintf("NAT-PMP: %v", err))
+	}
+	srvrLog.Warnf("Can't discover a gateway to map the listening port "+
+		"(%s), inbound connections require manual port forwarding",
+		strings.Join(errs, ", "))
+	return nil
+}
+
+// natListenPort returns the port to map on the NAT gateway, which is the port
+// of the first listen address or the default port of the network when it can
+// not be determined.
+func natListenPort(listenAddrs []string) uint16 {
+	for _, addr := range listenAddrs {
+		_, portStr, err := net.SplitHostPort(addr)
+		if err != nil {
+			continue
+		}
+		port, err := strconv.ParseUint(portStr, 10, 16)
+		if err == nil && port != 0 {
+			return uint16(port)
+		}
+	}
+	port, _ := strconv.ParseUint(activeNetParams.DefaultPort, 10, 16)
+	return uint16(port)
+}
+
+// natMapping houses the state of the port mapping maintained on the NAT
+// gateway by natUpdateThread.
+type natMapping struct {
+	internalPort int
+
+	// externalPort is the external port granted by the gateway, or zero
+	// when the port is not mapped.
+	externalPort int
+
+	// advertised is the external address added to the address manager,
+	// which is replaced when the gateway reports a different one.
+	advertised *wire.NetAddress
+
+	// warned is set once a failure was logged as a warning so further
+	// failures do not flood the log every refresh.
+	warned bool
+}
+
+// fail logs a failure to maintain the port mapping.  Only the first failure is
+// logged as a warning.
+func (m *natMapping) fail(format string, params ...interface{}) {
+	if m.warned {
+		srvrLog.Debugf(format, params...)
+		return
+	}
+	m.warned = true
+	srvrLog.Warnf(format+" -- inbound connections require manual port "+
+		"forwarding", params...)
+}
+
+// refreshNATMapping adds or renews the port mapping on the NAT gateway and
+// advertises the external address through the address manager whenever it
+// changes.
+func (s *server) refreshNATMapping(m *natMapping) {
+	// Renew the port which was granted before, if any.
+	requestPort := m.externalPort
+	if requestPort == 0 {
+		requestPort = m.internalPort
+	}
+	mappedPort, err := s.nat.AddPortMapping("tcp", requestPort,
+		m.internalPort, "Prova listen port", natLeaseDuration)
+	if err != nil {
+		m.fail("Can't add port mapping: %v", err)
+		return
+	}
+	m.externalPort = mappedPort
+
+	externalIP, err := s.nat.GetExternalAddress()
+	if err != nil {
+		m.fail("Can't get external address from the gateway: %v", err)
+		return
+	}
+	na := wire.NewNetAddressIPPort(externalIP, uint16(mappedPort),
+		s.services)
+	if m.advertised != nil && m.advertised.IP.Equal(na.IP) &&
+		m.advertised.Port == na.Port {
+
+		return
+	}
+	if m.advertised != nil {
+		s.addrManager.RemoveLocalAddress(m.advertised)
+		m.advertised = nil
+	}
+	err = s.addrManager.AddLocalAddress(na, addrmgr.UpnpPrio)
+	if err != nil {
+		m.fail("Not advertising mapped address %s: %v",
+			addrmgr.NetAddressKey(na), err)
+		return
+	}
+	m.advertised = na
+	srvrLog.Infof("Successfully mapped listening port to %s",
+		addrmgr.NetAddressKey(na))
+}
+
+// natUpdateThread maps the listening port on the NAT gateway, renews the
+// mapping periodically and removes it when the server shuts down.
+//
+// It MUST be run as a goroutine.
+func (s *server) natUpdateThread() {
+	m := &natMapping{internalPort: int(s.natPort)}
+
 	// Go off immediately to prevent code duplication, thereafter we renew
-	// lease every 15 minutes.
-	timer := time.NewTimer(0 * time.Second)
-	lport, _ := strconv.ParseInt(activeNetParams.DefaultPort, 10, 16)
-	first := true
+	// the lease periodically.
+	timer := time.NewTimer(0)
 out:
 	for {
 		select {
 		case <-timer.C:
-			// TODO: pick external port  more cleverly
-			// TODO: know which ports we are listening to on an external net.
-			// TODO: if specific listen port doesn't work then ask for wildcard
-			// listen port?
-			// XXX this assumes timeout is in seconds.
-			listenPort, err := s.nat.AddPortMapping("tcp", int(lport), int(lport),
-				"Prova listen port", 20*60)
-			if err != nil {
-				srvrLog.Warnf("can't add UPnP port mapping: %v", err)
-			}
-			if first && err == nil {
-				// TODO: look this up periodically to see if upnp domain changed
-				// and so did ip.
-				externalip, err := s.nat.GetExternalAddress()
-				if err != nil {
-					srvrLog.Warnf("UPnP can't get external address: %v", err)
-					continue out
-				}
-				na := wire.NewNetAddressIPPort(externalip, uint16(listenPort),
-					s.services)
-				err = s.addrManager.AddLocalAddress(na, addrmgr.UpnpPrio)
-				if err != nil {
-					// XXX DeletePortMapping?
-				}
-				srvrLog.Warnf("Successfully bound via UPnP to %s", addrmgr.NetAddressKey(na))
-				first = false
-			}
-			timer.Reset(time.Minute * 15)
+			s.refreshNATMapping(m)
+			timer.Reset(natRefreshInterval)
 		case <-s.quit:
 			break out
 		}
@@ -2187,10 +3228,14 @@ out:
 
 	timer.Stop()
 
-	if err := s.nat.DeletePortMapping("tcp", int(lport), int(lport)); err != nil {
-		srvrLog.Warnf("unable to remove UPnP port mapping: %v", err)
-	} else {
-		srvrLog.Debugf("successfully disestablished UPnP port mapping")
+	if m.externalPort != 0 {
+		err := s.nat.DeletePortMapping("tcp", m.externalPort,
+			m.internalPort)
+		if err != nil {
+			srvrLog.Warnf("Unable to remove port mapping: %v", err)
+		} else {
+			srvrLog.Debugf("Successfully removed port mapping")
+		}
 	}
 
 	s.wg.Done()
@@ -2216,7 +3261,10 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 			return nil, err
 		}
 		listeners = make([]net.Listener, 0, len(ipv4Addrs)+len(ipv6Addrs))
-		discover := true
+		// Local addresses are not discovered in proxy-only mode so
+		// only the specified external addresses, such as an onion
+		// address, are advertised.
+		discover := !cfg.ProxyOnly
 		if len(cfg.ExternalIPs) != 0 {
 			discover = false
 			// if this fails we have real issues.
@@ -2254,12 +3302,10 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 					amgrLog.Warnf("Skipping specified external IP: %v", err)
 				}
 			}
-		} else if discover && cfg.Upnp {
-			nat, err = Discover()
-			if err != nil {
-				srvrLog.Warnf("Can't discover upnp: %v", err)
-			}
-			// nil nat here is fine, just means no upnp on network.
+		} else if discover && (cfg.Upnp || cfg.NATPMP) {
+			// nil nat here is fine, just means no gateway which
+			// supports port mapping on the network.
+			nat = discoverNAT(cfg.Upnp, cfg.NATPMP)
 		}
 
 		// TODO: nonstandard port...
@@ -2332,24 +3378,35 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 	}
 
 	s := server{
-		chainParams:          chainParams,
-		addrManager:          amgr,
-		newPeers:             make(chan *serverPeer, cfg.MaxPeers),
-		donePeers:            make(chan *serverPeer, cfg.MaxPeers),
-		banPeers:             make(chan *serverPeer, cfg.MaxPeers),
-		query:                make(chan interface{}),
-		relayInv:             make(chan relayMsg, cfg.MaxPeers),
-		broadcast:            make(chan broadcastMsg, cfg.MaxPeers),
-		quit:                 make(chan struct{}),
-		modifyRebroadcastInv: make(chan interface{}),
-		peerHeightsUpdate:    make(chan updatePeerHeightsMsg),
-		nat:                  nat,
-		db:                   db,
-		timeSource:           blockchain.NewMedianTime(),
-		services:             services,
-		sigCache:             txscript.NewSigCache(cfg.SigCacheMaxSize),
-		hashCache:            txscript.NewHashCache(cfg.SigCacheMaxSize),
+		chainParams:       chainParams,
+		addrManager:       amgr,
+		banManager:        connmgr.NewBanManager(filepath.Join(cfg.DataDir, banListFilename)),
+		newPeers:          make(chan *serverPeer, cfg.MaxPeers),
+		donePeers:         make(chan *serverPeer, cfg.MaxPeers),
+		banPeers:          make(chan *serverPeer, cfg.MaxPeers),
+		query:             make(chan interface{}),
+		relayInv:          make(chan relayMsg, cfg.MaxPeers),
+		broadcast:         make(chan broadcastMsg, cfg.MaxPeers),
+		quit:              make(chan struct{}),
+		peerHeightsUpdate: make(chan updatePeerHeightsMsg),
+		nat:               nat,
+		natPort:           natListenPort(listenAddrs),
+		db:                db,
+		timeSource:        blockchain.NewMedianTimeSource(chainParams.MaxTimeOffset, time.Now),
+		services:          services,
+		sigCache:          txscript.NewSigCache(cfg.SigCacheMaxSize),
+		hashCache:         txscript.NewHashCache(cfg.SigCacheMaxSize),
+		validatorKeys:     newValidatorKeyCache(),
+		notifier:          blockchain.NewNotifier(blockchain.DefaultNotificationQueueSize),
+		dialGroups:        make(map[string]string),
+		metrics:           metrics.NewRegistry(),
+	}
+	s.peerMetrics = newPeerMetrics(s.metrics)
+	evictionSalt, err := wire.RandomUint64()
+	if err != nil {
+		return nil, err
 	}
+	s.evictionSalt = evictionSalt
 
 	// Create the transaction and address indexes if needed.
 	//
@@ -2377,6 +3434,16 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 		s.addrIndex = indexers.NewAddrIndex(db, chainParams)
 		indexes = append(indexes, s.addrIndex)
 	}
+	if cfg.BlockStatsIndex {
+		indxLog.Info("Block statistics index is enabled")
+		s.blockStatsIndex = indexers.NewBlockStatsIndex(db)
+		indexes = append(indexes, s.blockStatsIndex)
+	}
+	if cfg.SigKeyIDIndex {
+		indxLog.Info("Sig key id index is enabled")
+		s.sigKeyIDIndex = indexers.NewSigKeyIDIndex(db)
+		indexes = append(indexes, s.sigKeyIDIndex)
+	}
 
 	// Create an index manager if any of the optional indexes are enabled.
 	var indexManager blockchain.IndexManager
@@ -2389,16 +3456,24 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 	}
 	s.blockManager = bm
 
+	// Restore the fee estimator saved on the last shutdown unless it was
+	// saved at a height the chain no longer reaches, which happens when
+	// the chain state was reset.
+	s.feeEstimator = loadFeeEstimator(filepath.Join(cfg.DataDir,
+		feeEstimatesFilename), bm.chain.BestSnapshot().Height)
+
 	txC := mempool.Config{
 		Policy: mempool.Policy{
-			DisableRelayPriority: !cfg.RelayPriority,
-			AcceptNonStd:         cfg.RelayNonStd,
-			FreeTxRelayLimit:     cfg.FreeTxRelayLimit,
-			MaxOrphanTxs:         cfg.MaxOrphanTxs,
-			MaxOrphanTxSize:      defaultMaxOrphanTxSize,
-			MaxSigOpsPerTx:       blockchain.MaxSigOpsPerBlock / 5,
-			MinRelayTxFee:        cfg.minRelayTxFee,
-			MaxTxVersion:         2,
+			DisableRelayPriority:  !cfg.RelayPriority,
+			DisableStrictEncoding: cfg.NoStrictEncoding,
+			AcceptNonStd:          cfg.RelayNonStd,
+			FreeTxRelayLimit:      cfg.FreeTxRelayLimit,
+			MaxOrphanTxs:          cfg.MaxOrphanTxs,
+			MaxOrphanTxSize:       defaultMaxOrphanTxSize,
+			MaxSigOpsPerTx:        blockchain.MaxSigOpsPerBlock / 5,
+			MinRelayTxFee:         cfg.minRelayTxFee,
+			MaxTxVersion:          2,
+			MaxPoolSize:           int64(cfg.MaxMempool) * 1000000,
 		},
 		ChainParams:     chainParams,
 		FetchUtxoView:   s.blockManager.chain.FetchUtxoView,
@@ -2409,15 +3484,29 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 		GetAdminKeySets: bm.chain.AdminKeySets,
 		BestHeight:      func() uint32 { return bm.chain.BestSnapshot().Height },
 		MedianTimePast:  func() time.Time { return bm.chain.BestSnapshot().MedianTime },
-		SigCache:        s.sigCache,
-		HashCache:       s.hashCache,
-		TimeSource:      s.timeSource,
-		AddrIndex:       s.addrIndex,
+		LockTimeEvalTime: func() time.Time {
+			return bm.chain.LockTimeEvalTime(s.timeSource.AdjustedTime())
+		},
+		TimeLockFlags:     bm.chain.TimeLockFlags,
+		VerificationFlags: bm.chain.NextBlockVerificationFlags,
+		SigCache:          s.sigCache,
+		HashCache:         s.hashCache,
+		TimeSource:        s.timeSource,
+		AddrIndex:         s.addrIndex,
+		FeeEstimator:      s.feeEstimator,
 		CalcSequenceLock: func(tx *provautil.Tx, view *blockchain.UtxoViewpoint) (*blockchain.SequenceLock, error) {
 			return bm.chain.CalcSequenceLock(tx, view, true)
 		},
+		Metrics: s.metrics,
 	}
 	s.txMemPool = mempool.New(&txC)
+	loadMempool(s.txMemPool, filepath.Join(cfg.DataDir, mempoolFilename))
+	s.broadcastManager = newBroadcastManager(&broadcastManagerConfig{
+		RelayInventory:      s.RelayInventory,
+		IsTransactionInPool: s.txMemPool.IsTransactionInPool,
+		Notifier:            s.notifier,
+		Metrics:             s.metrics,
+	})
 
 	// Create the mining policy and block template generator based on the
 	// configuration options.
@@ -2425,14 +3514,17 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 	// NOTE: The CPU miner relies on the mempool, so the mempool has to be
 	// created before calling the function to create the CPU miner.
 	policy := mining.Policy{
-		BlockMinSize:      cfg.BlockMinSize,
-		BlockMaxSize:      cfg.BlockMaxSize,
-		BlockPrioritySize: cfg.BlockPrioritySize,
-		TxMinFreeFee:      cfg.minRelayTxFee,
+		BlockMinSize:          cfg.BlockMinSize,
+		BlockMaxSize:          cfg.BlockMaxSize,
+		BlockPrioritySize:     cfg.BlockPrioritySize,
+		TxMinFreeFee:          cfg.minRelayTxFee,
+		DisableStrictEncoding: cfg.NoStrictEncoding,
+		TemplateFeeDelta:      cfg.templateFeeDelta,
 	}
 
 	blockTemplateGenerator := mining.NewBlkTmplGenerator(&policy, s.chainParams,
-		s.txMemPool, s.blockManager.chain, s.timeSource, s.sigCache, s.hashCache)
+		s.txMemPool, s.blockManager.chain, s.timeSource, s.sigCache,
+		s.hashCache).WithMetrics(s.metrics)
 	s.cpuMiner = cpuminer.New(&cpuminer.Config{
 		ChainParams:              chainParams,
 		BlockTemplateGenerator:   blockTemplateGenerator,
@@ -2452,42 +3544,20 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 	// network.
 	var newAddressFunc func() (net.Addr, error)
 	if !cfg.SimNet && len(cfg.ConnectPeers) == 0 {
-		newAddressFunc = func() (net.Addr, error) {
-			for tries := 0; tries < 100; tries++ {
-				addr := s.addrManager.GetAddress()
-				if addr == nil {
-					break
-				}
-
-				// Address will not be invalid, local or unroutable
-				// because addrmanager rejects those on addition.
-				// Just check that we don't already have an address
-				// in the same group so that we are not connecting
-				// to the same network segment at the expense of
-				// others.
-				key := addrmgr.GroupKey(addr.NetAddress())
-				if s.OutboundGroupCount(key) != 0 {
-					continue
-				}
-
-				// only allow recent nodes (10mins) after we failed 30
-				// times
-				if tries < 30 && time.Since(addr.LastAttempt()) < 10*time.Minute {
-					continue
-				}
-
-				// allow nondefault ports after 50 failed tries.
-				if tries < 50 && fmt.Sprintf("%d", addr.NetAddress().Port) !=
-					activeNetParams.DefaultPort {
-					continue
-				}
-
-				addrString := addrmgr.NetAddressKey(addr.NetAddress())
-				return addrStringToNetAddr(addrString)
-			}
+		newAddressFunc = s.newOutboundAddress
+	}
 
-			return nil, errors.New("no valid connect address")
-		}
+	// Load the anchors persisted on the last shutdown.  The file is
+	// removed even when the anchors are not used so they are never used
+	// after a later unclean shutdown.
+	var anchors []net.Addr
+	savedAnchors, err := loadAnchors(filepath.Join(cfg.DataDir,
+		anchorsFilename))
+	if err != nil {
+		srvrLog.Errorf("Failed to load anchors: %v", err)
+	}
+	if newAddressFunc != nil {
+		anchors = s.anchorAddrs(savedAnchors)
 	}
 
 	// Create a connection manager.
@@ -2500,9 +3570,10 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 		OnAccept:       s.inboundPeerConnected,
 		RetryDuration:  connectionRetryInterval,
 		TargetOutbound: uint32(targetOutbound),
-		Dial:           btcdDial,
+		Dial:           s.dialOutbound,
 		OnConnection:   s.outboundPeerConnected,
 		GetNewAddress:  newAddressFunc,
+		Anchors:        anchors,
 	})
 	if err != nil {
 		return nil, err
@@ -2514,16 +3585,19 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 	if len(permanentPeers) == 0 {
 		permanentPeers = cfg.AddPeers
 	}
+	s.addedNodes = make(map[string]*connmgr.ConnReq, len(permanentPeers))
 	for _, addr := range permanentPeers {
 		netAddr, err := addrStringToNetAddr(addr)
 		if err != nil {
 			return nil, err
 		}
 
-		go s.connManager.Connect(&connmgr.ConnReq{
+		connReq := &connmgr.ConnReq{
 			Addr:      netAddr,
 			Permanent: true,
-		})
+		}
+		s.addedNodes[addr] = connReq
+		go s.connManager.Connect(connReq)
 	}
 
 	if !cfg.DisableRPC {
@@ -2540,6 +3614,25 @@ func newServer(listenAddrs []string, db database.DB, chainParams *chaincfg.Param
 		}()
 	}
 
+	// The REST server is only enabled when it is explicitly bound to an
+	// interface since it does not require authentication.
+	if len(cfg.RESTListeners) > 0 {
+		s.restServer, err = newRESTServer(cfg.RESTListeners, &s)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The metrics server is only enabled when it is explicitly bound to an
+	// interface since it does not require authentication either.
+	if len(cfg.MetricsListeners) > 0 {
+		s.metricsServer, err = newMetricsServer(cfg.MetricsListeners,
+			s.metrics)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &s, nil
 }
 
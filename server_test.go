@@ -0,0 +1,1235 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bitgo/prova/addrmgr"
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/btcjson"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/connmgr"
+	"github.com/bitgo/prova/mempool"
+	"github.com/bitgo/prova/mining"
+	"github.com/bitgo/prova/peer"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/wire"
+)
+
+// pipeConn mocks a network connection by implementing the net.Conn interface
+// on top of in-memory pipes so peers can be connected without opening a
+// network connection.
+type pipeConn struct {
+	io.Reader
+	io.Writer
+	laddr, raddr string
+}
+
+// pipeAddr mocks a network address.
+type pipeAddr string
+
+func (a pipeAddr) Network() string { return "tcp" }
+func (a pipeAddr) String() string  { return string(a) }
+
+func (c *pipeConn) LocalAddr() net.Addr                { return pipeAddr(c.laddr) }
+func (c *pipeConn) RemoteAddr() net.Addr               { return pipeAddr(c.raddr) }
+func (c *pipeConn) Close() error                       { return nil }
+func (c *pipeConn) SetDeadline(t time.Time) error      { return nil }
+func (c *pipeConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *pipeConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// newPipeConns returns two mock connections which are connected to each other.
+func newPipeConns() (*pipeConn, *pipeConn) {
+	r1, w1 := io.Pipe()
+	r2, w2 := io.Pipe()
+	c1 := &pipeConn{Reader: r2, Writer: w1, laddr: "10.0.0.1:18333",
+		raddr: "10.0.0.2:18333"}
+	c2 := &pipeConn{Reader: r1, Writer: w2, laddr: "10.0.0.2:18333",
+		raddr: "10.0.0.1:18333"}
+	return c1, c2
+}
+
+// feeFilterHarness houses a server peer which is connected to a mock remote
+// peer along with the messages the remote peer received.
+type feeFilterHarness struct {
+	sp          *serverPeer
+	conn        *pipeConn
+	pver        uint32
+	preVerAck   []wire.Message
+	writeMtx    sync.Mutex
+	verAck      chan struct{}
+	feeFilters  chan *wire.MsgFeeFilter
+	invMessages chan *wire.MsgInv
+	addrMsgs    chan wire.Message
+}
+
+// newFeeFilterHarness returns a harness with a server peer which uses a mempool
+// with the passed minimum relay fee rate and is connected to a mock remote peer
+// with the passed protocol version.  The remote peer sends any passed preVerAck
+// messages right before its verack message.
+func newFeeFilterHarness(minRelayFee provautil.Amount, remotePver uint32, preVerAck ...wire.Message) (*feeFilterHarness, error) {
+	s := &server{
+		txMemPool: mempool.New(&mempool.Config{
+			Policy: mempool.Policy{MinRelayTxFee: minRelayFee},
+		}),
+	}
+	s.broadcastManager = newBroadcastManager(&broadcastManagerConfig{
+		RelayInventory:      func(*wire.InvVect, interface{}) {},
+		IsTransactionInPool: s.txMemPool.IsTransactionInPool,
+		Notifier:            blockchain.NewNotifier(1),
+	})
+	s.broadcastManager.Start()
+	return connectFeeFilterHarness(s, remotePver, preVerAck...)
+}
+
+// connectFeeFilterHarness returns a harness with a server peer of the passed
+// server, which must have a running broadcast manager, connected to a mock
+// remote peer like newFeeFilterHarness.
+func connectFeeFilterHarness(s *server, remotePver uint32, preVerAck ...wire.Message) (*feeFilterHarness, error) {
+	h := &feeFilterHarness{
+		sp:          newServerPeer(s, false),
+		pver:        remotePver,
+		preVerAck:   preVerAck,
+		verAck:      make(chan struct{}, 1),
+		feeFilters:  make(chan *wire.MsgFeeFilter, 10),
+		invMessages: make(chan *wire.MsgInv, 10),
+		addrMsgs:    make(chan wire.Message, 10),
+	}
+	h.sp.Peer = peer.NewInboundPeer(&peer.Config{
+		Listeners: peer.MessageListeners{
+			OnVerAck:    h.sp.OnVerAck,
+			OnFeeFilter: h.sp.OnFeeFilter,
+		},
+		ChainParams:     &chaincfg.RegressionNetParams,
+		ProtocolVersion: peer.MaxProtocolVersion,
+	})
+
+	inConn, remoteConn := newPipeConns()
+	h.conn = remoteConn
+	h.sp.AssociateConnection(inConn)
+
+	// The remote peer initiates the connection by sending its version.
+	nonce, err := wire.RandomUint64()
+	if err != nil {
+		return nil, err
+	}
+	me := wire.NewNetAddressIPPort(net.ParseIP("10.0.0.2"), 18333, 0)
+	you := wire.NewNetAddressIPPort(net.ParseIP("10.0.0.1"), 18333, 0)
+	msgVersion := wire.NewMsgVersion(me, you, nonce, 0)
+	msgVersion.ProtocolVersion = int32(remotePver)
+	if err := h.send(msgVersion); err != nil {
+		return nil, err
+	}
+	go h.readHandler()
+	return h, nil
+}
+
+// send sends the passed message from the remote peer to the server peer.
+func (h *feeFilterHarness) send(msg wire.Message) error {
+	h.writeMtx.Lock()
+	defer h.writeMtx.Unlock()
+	return wire.WriteMessage(h.conn, msg, h.pver,
+		chaincfg.RegressionNetParams.Net)
+}
+
+// readHandler reads the messages the remote peer receives from the server
+// peer until the connection is closed.  It acknowledges the version of the
+// server peer and passes the other relevant messages to the harness channels.
+func (h *feeFilterHarness) readHandler() {
+	for {
+		msg, _, err := wire.ReadMessage(h.conn, h.pver,
+			chaincfg.RegressionNetParams.Net)
+		if err != nil {
+			return
+		}
+		switch msg := msg.(type) {
+		case *wire.MsgVersion:
+			for _, msg := range h.preVerAck {
+				if err := h.send(msg); err != nil {
+					return
+				}
+			}
+			if err := h.send(wire.NewMsgVerAck()); err != nil {
+				return
+			}
+		case *wire.MsgVerAck:
+			h.verAck <- struct{}{}
+		case *wire.MsgFeeFilter:
+			h.feeFilters <- msg
+		case *wire.MsgInv:
+			h.invMessages <- msg
+		case *wire.MsgAddr, *wire.MsgAddrV2:
+			h.addrMsgs <- msg
+		}
+	}
+}
+
+// disconnect disconnects the peers of the harness and stops the broadcast
+// manager of its server.
+func (h *feeFilterHarness) disconnect() {
+	h.sp.Disconnect()
+	h.conn.Reader.(*io.PipeReader).Close()
+	h.sp.server.broadcastManager.Stop()
+}
+
+// newFeeFilterTxDesc returns a mempool transaction descriptor for a unique
+// transaction with the passed fee rate.
+func newFeeFilterTxDesc(feePerKB int64) *mempool.TxDesc {
+	msgTx := wire.NewMsgTx(1)
+	msgTx.AddTxOut(wire.NewTxOut(feePerKB, nil))
+	return &mempool.TxDesc{
+		TxDesc: mining.TxDesc{
+			Tx:       provautil.NewTx(msgTx),
+			FeePerKB: feePerKB,
+		},
+	}
+}
+
+// TestFeeFilterRelay ensures the server announces the minimum relay fee rate of
+// its mempool to peers once connected and does not announce transactions with
+// fee rates below the fee filter a peer sent.
+func TestFeeFilterRelay(t *testing.T) {
+	h, err := newFeeFilterHarness(2000, wire.FeeFilterVersion)
+	if err != nil {
+		t.Fatalf("unable to create harness: %v", err)
+	}
+	defer h.disconnect()
+
+	// Ensure the remote peer receives the minimum relay fee rate.
+	select {
+	case msg := <-h.feeFilters:
+		if msg.MinFee != 2000 {
+			t.Fatalf("announced fee filter is %d, want 2000",
+				msg.MinFee)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("fee filter was not announced")
+	}
+
+	// Ensure announcing a rate which did not change meaningfully does not
+	// send another fee filter.
+	h.sp.pushFeeFilter(2100)
+	if sent := atomic.LoadInt64(&h.sp.sentFeeFilter); sent != 2000 {
+		t.Fatalf("announced fee filter is %d after a small change, "+
+			"want 2000", sent)
+	}
+
+	// Set a high fee filter from the remote peer and wait for the server
+	// peer to honor it.
+	if err := h.send(wire.NewMsgFeeFilter(10000)); err != nil {
+		t.Fatalf("unable to send fee filter: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt64(&h.sp.feeFilter) != 10000 {
+		if time.Now().After(deadline) {
+			t.Fatalf("fee filter of the remote peer was not honored")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Relay transactions below, at, and above the fee filter and ensure
+	// only the latter two are announced to the remote peer.
+	lowTx := newFeeFilterTxDesc(9999)
+	atTx := newFeeFilterTxDesc(10000)
+	highTx := newFeeFilterTxDesc(50000)
+	for _, txD := range []*mempool.TxDesc{lowTx, atTx, highTx} {
+		h.sp.relayInventory(relayMsg{
+			invVect: wire.NewInvVect(wire.InvTypeTx, txD.Tx.Hash()),
+			data:    txD,
+		})
+	}
+	announced := make(map[string]struct{})
+	deadline = time.Now().Add(20 * time.Second)
+	for len(announced) < 2 {
+		select {
+		case msg := <-h.invMessages:
+			for _, iv := range msg.InvList {
+				if iv.Hash.IsEqual(lowTx.Tx.Hash()) {
+					t.Fatalf("low fee transaction was announced")
+				}
+				announced[iv.Hash.String()] = struct{}{}
+			}
+		case <-time.After(time.Until(deadline)):
+			t.Fatalf("transactions were not announced")
+		}
+	}
+	for _, txD := range []*mempool.TxDesc{atTx, highTx} {
+		if _, ok := announced[txD.Tx.Hash().String()]; !ok {
+			t.Fatalf("transaction %v was not announced", txD.Tx.Hash())
+		}
+	}
+}
+
+// TestFeeFilterProtocolVersion ensures the minimum relay fee rate is not
+// announced to peers which do not support fee filters.
+func TestFeeFilterProtocolVersion(t *testing.T) {
+	h, err := newFeeFilterHarness(2000, wire.FeeFilterVersion-1)
+	if err != nil {
+		t.Fatalf("unable to create harness: %v", err)
+	}
+	defer h.disconnect()
+
+	select {
+	case <-h.verAck:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("peers did not negotiate the connection")
+	}
+	select {
+	case msg := <-h.feeFilters:
+		t.Fatalf("fee filter %d announced to an old peer", msg.MinFee)
+	case <-time.After(500 * time.Millisecond):
+	}
+}
+
+// TestCapabilityRelay ensures the announcement and relay decisions of a server
+// peer follow the capabilities the remote peer negotiated for every combination
+// of them.
+func TestCapabilityRelay(t *testing.T) {
+	all := peer.CapSendHeaders | peer.CapCmpctBlocks | peer.CapFeeFilter |
+		peer.CapAddrV2
+	for caps := peer.Capabilities(0); caps <= all; caps++ {
+		var preVerAck []wire.Message
+		if caps&peer.CapAddrV2 != 0 {
+			preVerAck = append(preVerAck, wire.NewMsgSendAddrV2())
+		}
+		h, err := newFeeFilterHarness(1000, wire.AddrV2Version,
+			preVerAck...)
+		if err != nil {
+			t.Fatalf("%v: unable to create harness: %v", caps, err)
+		}
+		select {
+		case <-h.verAck:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%v: peers did not negotiate the connection", caps)
+		}
+
+		// Negotiate the remaining capabilities and wait for the server
+		// peer to track them.
+		var msgs []wire.Message
+		if caps&peer.CapSendHeaders != 0 {
+			msgs = append(msgs, wire.NewMsgSendHeaders())
+		}
+		if caps&peer.CapCmpctBlocks != 0 {
+			msgs = append(msgs, wire.NewMsgSendCmpct(false,
+				wire.CmpctBlockVersion))
+		}
+		if caps&peer.CapFeeFilter != 0 {
+			msgs = append(msgs, wire.NewMsgFeeFilter(10000))
+		}
+		for _, msg := range msgs {
+			if err := h.send(msg); err != nil {
+				t.Fatalf("%v: unable to send %s: %v", caps,
+					msg.Command(), err)
+			}
+		}
+		deadline := time.Now().Add(5 * time.Second)
+		for h.sp.Capabilities() != caps ||
+			(caps&peer.CapFeeFilter != 0 &&
+				atomic.LoadInt64(&h.sp.feeFilter) != 10000) {
+
+			if time.Now().After(deadline) {
+				t.Fatalf("%v: got capabilities %v", caps,
+					h.sp.Capabilities())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		// Ensure low fee transactions are only announced to peers
+		// without a fee filter.
+		wantLowFee := caps&peer.CapFeeFilter == 0
+		if got := h.sp.feeFilterAllows(5000); got != wantLowFee {
+			t.Errorf("%v: feeFilterAllows(5000) = %v, want %v", caps,
+				got, wantLowFee)
+		}
+		if !h.sp.feeFilterAllows(10000) {
+			t.Errorf("%v: feeFilterAllows(10000) = false", caps)
+		}
+
+		// Ensure blocks are only requested as compact blocks from
+		// peers which negotiated them once the chain is current.
+		wantType := wire.InvTypeBlock
+		if caps&peer.CapCmpctBlocks != 0 {
+			wantType = wire.InvTypeCmpctBlock
+		}
+		if got := h.sp.blockRequestType(true); got != wantType {
+			t.Errorf("%v: blockRequestType(true) = %v, want %v",
+				caps, got, wantType)
+		}
+		if got := h.sp.blockRequestType(false); got != wire.InvTypeBlock {
+			t.Errorf("%v: blockRequestType(false) = %v", caps, got)
+		}
+
+		// Ensure blocks are announced with headers only to peers which
+		// negotiated them.
+		if h.sp.WantsHeaders() != (caps&peer.CapSendHeaders != 0) {
+			t.Errorf("%v: WantsHeaders = %v", caps,
+				h.sp.WantsHeaders())
+		}
+
+		// Ensure addresses are relayed with the negotiated message.
+		na := wire.NewNetAddressIPPort(net.ParseIP("10.0.0.3"), 7979,
+			wire.SFNodeNetwork)
+		h.sp.pushAddrMsg([]*wire.NetAddress{na})
+		select {
+		case msg := <-h.addrMsgs:
+			_, isAddrV2 := msg.(*wire.MsgAddrV2)
+			if isAddrV2 != (caps&peer.CapAddrV2 != 0) {
+				t.Errorf("%v: addresses relayed with %s", caps,
+					msg.Command())
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%v: addresses were not relayed", caps)
+		}
+
+		h.disconnect()
+	}
+}
+
+// TestFeeFilterChanged ensures meaningful changes to the minimum fee rate are
+// detected.
+func TestFeeFilterChanged(t *testing.T) {
+	tests := []struct {
+		sent, minFee int64
+		want         bool
+	}{
+		{-1, 0, true},
+		{-1, 1000, true},
+		{0, 0, false},
+		{0, 1, true},
+		{1000, 1000, false},
+		{1000, 1099, false},
+		{1000, 1100, true},
+		{1000, 901, false},
+		{1000, 900, true},
+		{5, 6, true},
+	}
+	for i, test := range tests {
+		if got := feeFilterChanged(test.sent, test.minFee); got != test.want {
+			t.Errorf("#%d: feeFilterChanged(%d, %d) = %v, want %v", i,
+				test.sent, test.minFee, got, test.want)
+		}
+	}
+}
+
+// fakeAnnouncementChain provides a fake implementation of the chain information
+// needed to create headers announcements.
+type fakeAnnouncementChain struct {
+	headers map[chainhash.Hash]wire.BlockHeader
+	main    map[chainhash.Hash]bool
+}
+
+// FetchHeader returns the header of the block with the passed hash.
+func (c *fakeAnnouncementChain) FetchHeader(hash *chainhash.Hash) (wire.BlockHeader, error) {
+	header, ok := c.headers[*hash]
+	if !ok {
+		return wire.BlockHeader{}, fmt.Errorf("block %v not found", hash)
+	}
+	return header, nil
+}
+
+// MainChainHasBlock returns whether the block with the passed hash is in the
+// main chain.
+func (c *fakeAnnouncementChain) MainChainHasBlock(hash *chainhash.Hash) (bool, error) {
+	return c.main[*hash], nil
+}
+
+// BlockHeightByHash returns the height of the main chain block with the passed
+// hash.
+func (c *fakeAnnouncementChain) BlockHeightByHash(hash *chainhash.Hash) (uint32, error) {
+	if !c.main[*hash] {
+		return 0, fmt.Errorf("block %v is not in the main chain", hash)
+	}
+	return c.headers[*hash].Height, nil
+}
+
+// extend adds the passed number of headers which extend the passed header to
+// the chain and returns the hashes of them.  The passed tag distinguishes the
+// headers of different branches.
+func (c *fakeAnnouncementChain) extend(parent *wire.BlockHeader, n int, tag byte, main bool) []chainhash.Hash {
+	hashes := make([]chainhash.Hash, 0, n)
+	for i := 0; i < n; i++ {
+		header := wire.BlockHeader{
+			PrevBlock:  parent.BlockHash(),
+			MerkleRoot: chainhash.Hash{tag},
+			Height:     parent.Height + 1,
+		}
+		hash := header.BlockHash()
+		c.headers[hash] = header
+		c.main[hash] = main
+		hashes = append(hashes, hash)
+		parent = &header
+	}
+	return hashes
+}
+
+// TestAnnouncementHeaders ensures the headers announcing a new block connect it
+// to the block the peer is known to have, and that announcing falls back to an
+// inv when the peer is too far behind or after a reorganize to a chain the
+// peer does not know.
+func TestAnnouncementHeaders(t *testing.T) {
+	chain := &fakeAnnouncementChain{
+		headers: make(map[chainhash.Hash]wire.BlockHeader),
+		main:    make(map[chainhash.Hash]bool),
+	}
+	genesis := wire.BlockHeader{}
+	genesisHash := genesis.BlockHash()
+	chain.headers[genesisHash] = genesis
+	chain.main[genesisHash] = true
+
+	// Create a main chain of 30 blocks along with a stale side chain of 15
+	// blocks which forks from the main chain after block 10 and was the
+	// best chain before a large reorganize.
+	mainChain := append([]chainhash.Hash{genesisHash},
+		chain.extend(&genesis, 30, 0x01, true)...)
+	fork := chain.headers[mainChain[10]]
+	sideChain := chain.extend(&fork, 15, 0x02, false)
+	tipHash := mainChain[30]
+	tip := chain.headers[tipHash]
+	sideTip := chain.headers[sideChain[len(sideChain)-1]]
+
+	tests := []struct {
+		name   string
+		known  *chainhash.Hash
+		header *wire.BlockHeader
+		want   []chainhash.Hash
+	}{
+		{
+			name:   "no known block",
+			known:  nil,
+			header: &tip,
+		},
+		{
+			name:   "known parent",
+			known:  &mainChain[29],
+			header: &tip,
+			want:   mainChain[30:],
+		},
+		{
+			name:   "several blocks behind",
+			known:  &mainChain[25],
+			header: &tip,
+			want:   mainChain[26:],
+		},
+		{
+			name:   "maximum headers",
+			known:  &mainChain[30-maxAnnouncementHeaders],
+			header: &tip,
+			want:   mainChain[30-maxAnnouncementHeaders+1:],
+		},
+		{
+			name:   "too far behind",
+			known:  &mainChain[30-maxAnnouncementHeaders-1],
+			header: &tip,
+		},
+		{
+			name:   "block already known",
+			known:  &tipHash,
+			header: &tip,
+		},
+		{
+			name:   "known block on stale side chain after reorganize",
+			known:  &sideChain[len(sideChain)-1],
+			header: &tip,
+		},
+		{
+			name:   "side chain block",
+			known:  &mainChain[10],
+			header: &sideTip,
+		},
+		{
+			name:   "unknown block",
+			known:  &chainhash.Hash{0xff},
+			header: &tip,
+		},
+	}
+
+	for _, test := range tests {
+		headers := announcementHeaders(chain, test.known, test.header)
+		if test.want == nil {
+			if headers != nil {
+				t.Errorf("%s: got %d headers, want an inv fallback",
+					test.name, len(headers))
+			}
+			continue
+		}
+		if len(headers) != len(test.want) {
+			t.Errorf("%s: got %d headers, want %d", test.name,
+				len(headers), len(test.want))
+			continue
+		}
+		for i, header := range headers {
+			if hash := header.BlockHash(); hash != test.want[i] {
+				t.Errorf("%s: header %d is %v, want %v",
+					test.name, i, hash, test.want[i])
+			}
+		}
+	}
+}
+
+// banTestHarness houses a server with a ban manager along with the state of its
+// peers.
+type banTestHarness struct {
+	s      *server
+	state  *peerState
+	nextID int32
+}
+
+// newPeer returns a server peer of the harness server which is connected to the
+// passed address.
+func (h *banTestHarness) newPeer(t *testing.T, addr string, whitelisted bool) *serverPeer {
+	sp := newServerPeer(h.s, false)
+	p, err := peer.NewOutboundPeer(&peer.Config{
+		ChainParams: &chaincfg.RegressionNetParams,
+	}, addr)
+	if err != nil {
+		t.Fatalf("NewOutboundPeer: unexpected error: %v", err)
+	}
+	sp.Peer = p
+	sp.isWhitelisted = whitelisted
+	return sp
+}
+
+// addPeer passes the passed server peer to the server and returns whether or
+// not it was accepted.  The peers never negotiate a version, which assigns their
+// ids, so accepted peers are keyed by the order they were added in instead.
+func (h *banTestHarness) addPeer(sp *serverPeer) bool {
+	if !h.s.handleAddPeerMsg(h.state, sp) {
+		return false
+	}
+	delete(h.state.outboundPeers, sp.ID())
+	h.nextID++
+	h.state.outboundPeers[h.nextID] = sp
+	return true
+}
+
+// waitForDisconnect ensures the passed server peer is disconnected.
+func waitForDisconnect(t *testing.T, sp *serverPeer) {
+	disconnected := make(chan struct{})
+	go func() {
+		sp.WaitForDisconnect()
+		close(disconnected)
+	}()
+	select {
+	case <-disconnected:
+	case <-time.After(time.Second):
+		t.Fatalf("peer %s was not disconnected", sp.Addr())
+	}
+}
+
+// checkRPCErrorCode ensures the passed error is an RPC error with the passed
+// code.
+func checkRPCErrorCode(t *testing.T, name string, err error, code btcjson.RPCErrorCode) {
+	rpcErr, ok := err.(*btcjson.RPCError)
+	if !ok || rpcErr.Code != code {
+		t.Fatalf("%s: got error %v, want code %d", name, err, code)
+	}
+}
+
+// TestPeerBans ensures the ban score of an address accumulates across its
+// connections until it is banned, that banned addresses are refused unless they
+// are whitelisted, and that the ban RPCs manage the bans.
+func TestPeerBans(t *testing.T) {
+	origCfg := cfg
+	cfg = &config{
+		MaxPeers:     defaultMaxPeers,
+		BanDuration:  defaultBanDuration,
+		BanThreshold: defaultBanThreshold,
+	}
+	defer func() { cfg = origCfg }()
+
+	h := &banTestHarness{
+		s: &server{
+			banManager: connmgr.NewBanManager(""),
+			banPeers:   make(chan *serverPeer, 10),
+			query:      make(chan interface{}),
+		},
+		state: &peerState{
+			inboundPeers:    make(map[int32]*serverPeer),
+			outboundPeers:   make(map[int32]*serverPeer),
+			persistentPeers: make(map[int32]*serverPeer),
+			outboundGroups:  make(map[string]int),
+		},
+	}
+	s := h.s
+
+	// The score accumulates across the connections to the same address
+	// until it exceeds the threshold.
+	sp1 := h.newPeer(t, "10.0.0.5:18333", false)
+	sp2 := h.newPeer(t, "10.0.0.5:18334", false)
+	for _, sp := range []*serverPeer{sp1, sp2} {
+		if !h.addPeer(sp) {
+			t.Fatalf("peer %s was refused", sp.Addr())
+		}
+	}
+	sp1.addBanScore(60, 0, "test")
+	if score := s.banManager.Score("10.0.0.5"); score != 60 {
+		t.Fatalf("ban score is %d, want 60", score)
+	}
+	sp2.addBanScore(50, 0, "test")
+	var banned *serverPeer
+	select {
+	case banned = <-s.banPeers:
+	default:
+		t.Fatal("peer exceeding the ban threshold was not banned")
+	}
+	s.handleBanPeerMsg(h.state, banned)
+	waitForDisconnect(t, sp1)
+	waitForDisconnect(t, sp2)
+	if score := s.banManager.Score("10.0.0.5"); score != 0 {
+		t.Fatalf("ban score after the ban is %d, want 0", score)
+	}
+
+	// New connections to the banned address are refused unless the address
+	// is whitelisted, and whitelisted peers are never scored.
+	sp3 := h.newPeer(t, "10.0.0.5:18335", false)
+	if h.addPeer(sp3) {
+		t.Fatal("banned peer was not refused")
+	}
+	whitelisted := h.newPeer(t, "10.0.0.5:18336", true)
+	if !h.addPeer(whitelisted) {
+		t.Fatal("whitelisted peer was refused")
+	}
+	whitelisted.addBanScore(200, 0, "test")
+	if score := s.banManager.Score("10.0.0.5"); score != 0 {
+		t.Fatalf("ban score of whitelisted peer is %d, want 0", score)
+	}
+
+	// Handle the queries of the RPC handlers.
+	go func() {
+		for msg := range s.query {
+			s.handleQuery(h.state, msg)
+		}
+	}()
+	defer close(s.query)
+
+	// Banning a subnet disconnects the connected peers which are part of
+	// it.
+	r := &rpcServer{server: s}
+	sp4 := h.newPeer(t, "10.1.2.3:18333", false)
+	if !h.addPeer(sp4) {
+		t.Fatalf("peer %s was refused", sp4.Addr())
+	}
+	setBan := func(subnet string, subCmd btcjson.SetBanSubCmd, banTime int64, absolute bool) error {
+		cmd := btcjson.NewSetBanCmd(subnet, subCmd, &banTime, &absolute)
+		_, err := handleSetBan(r, cmd, nil)
+		return err
+	}
+	if err := setBan("10.1.0.0/16", btcjson.SBAdd, 3600, false); err != nil {
+		t.Fatalf("setban add: unexpected error: %v", err)
+	}
+	waitForDisconnect(t, sp4)
+
+	err := setBan("10.1.0.0/16", btcjson.SBAdd, 0, false)
+	checkRPCErrorCode(t, "setban add banned", err,
+		btcjson.ErrRPCClientNodeAlreadyAdded)
+	err = setBan("10.2.0.0/33", btcjson.SBAdd, 0, false)
+	checkRPCErrorCode(t, "setban invalid subnet", err,
+		btcjson.ErrRPCClientInvalidIPOrSubnet)
+	err = setBan("10.2.0.1", btcjson.SBAdd, time.Now().Unix()-60, true)
+	checkRPCErrorCode(t, "setban past time", err,
+		btcjson.ErrRPCInvalidParameter)
+
+	result, err := handleListBanned(r, &btcjson.ListBannedCmd{}, nil)
+	if err != nil {
+		t.Fatalf("listbanned: unexpected error: %v", err)
+	}
+	bans := result.([]btcjson.ListBannedResult)
+	if len(bans) != 2 || bans[0].Address != "10.0.0.5/32" ||
+		bans[0].BanReason != "misbehaving" ||
+		bans[1].Address != "10.1.0.0/16" ||
+		bans[1].BanReason != "manually added" {
+
+		t.Fatalf("listbanned: unexpected bans %+v", bans)
+	}
+	if until := bans[1].BannedUntil - bans[1].BanCreated; until != 3600 {
+		t.Fatalf("listbanned: ban lasts %d seconds, want 3600", until)
+	}
+
+	if err := setBan("10.1.0.0/16", btcjson.SBRemove, 0, false); err != nil {
+		t.Fatalf("setban remove: unexpected error: %v", err)
+	}
+	err = setBan("10.1.0.0/16", btcjson.SBRemove, 0, false)
+	checkRPCErrorCode(t, "setban remove unbanned", err,
+		btcjson.ErrRPCClientInvalidIPOrSubnet)
+
+	// Clearing the bans lets the address connect again.
+	if _, err := handleClearBanned(r, &btcjson.ClearBannedCmd{}, nil); err != nil {
+		t.Fatalf("clearbanned: unexpected error: %v", err)
+	}
+	result, err = handleListBanned(r, &btcjson.ListBannedCmd{}, nil)
+	if err != nil {
+		t.Fatalf("listbanned: unexpected error: %v", err)
+	}
+	if bans := result.([]btcjson.ListBannedResult); len(bans) != 0 {
+		t.Fatalf("listbanned: unexpected bans after clearbanned %+v",
+			bans)
+	}
+	sp5 := h.newPeer(t, "10.0.0.5:18337", false)
+	if !h.addPeer(sp5) {
+		t.Fatal("peer of a cleared ban was refused")
+	}
+}
+
+// TestInvalidBlockErr ensures only the rule errors which prove a block is
+// invalid get the peer which sent it penalized.
+func TestInvalidBlockErr(t *testing.T) {
+	tests := []struct {
+		code blockchain.ErrorCode
+		want bool
+	}{
+		{blockchain.ErrDuplicateBlock, false},
+		{blockchain.ErrTimeTooNew, false},
+		{blockchain.ErrReorgTooDeep, false},
+		{blockchain.ErrPrevBlockNotBest, false},
+		{blockchain.ErrInvalidAncestorBlock, false},
+		{blockchain.ErrTimeTooOld, true},
+		{blockchain.ErrBadMerkleRoot, true},
+		{blockchain.ErrBadBlockSignature, true},
+		{blockchain.ErrScriptValidation, true},
+		{blockchain.ErrExcessiveChainShare, true},
+	}
+
+	for _, test := range tests {
+		ruleErr := blockchain.RuleError{ErrorCode: test.code}
+		if got := isInvalidBlockErr(ruleErr); got != test.want {
+			t.Errorf("isInvalidBlockErr(%v): got %v, want %v",
+				test.code, got, test.want)
+		}
+	}
+}
+
+// TestAgentBlacklist ensures a server peer whose remote user agent matches the
+// agent blacklist is disconnected with a ban score before it is added to the
+// server.
+func TestAgentBlacklist(t *testing.T) {
+	origCfg := cfg
+	cfg = &config{
+		BanDuration:    defaultBanDuration,
+		BanThreshold:   defaultBanThreshold,
+		AgentBlacklist: []string{"/Prova:0.0.9", "/Prova:0.1.0"},
+	}
+	defer func() { cfg = origCfg }()
+
+	tests := []struct {
+		userAgent string
+		pattern   string
+		blocked   bool
+	}{
+		{"/btcwire:0.5.0/Prova:0.1.0/", "/Prova:0.1.0", true},
+		{"/btcwire:0.5.0/Prova:0.0.9(old)/", "/Prova:0.0.9", true},
+		{"/btcwire:0.5.0/Prova:0.1.1/", "", false},
+		{"", "", false},
+	}
+	for _, test := range tests {
+		pattern, blocked := blacklistedUserAgent(test.userAgent)
+		if pattern != test.pattern || blocked != test.blocked {
+			t.Errorf("blacklistedUserAgent(%q): got %q, %v, want "+
+				"%q, %v", test.userAgent, pattern, blocked,
+				test.pattern, test.blocked)
+		}
+	}
+
+	// Send the version of a blacklisted release with a comment from a mock
+	// remote peer to a server peer.
+	s := &server{
+		banManager: connmgr.NewBanManager(""),
+		banPeers:   make(chan *serverPeer, 1),
+		newPeers:   make(chan *serverPeer, 1),
+	}
+	sp := newServerPeer(s, false)
+	sp.Peer = peer.NewInboundPeer(&peer.Config{
+		Listeners:   peer.MessageListeners{OnVersion: sp.OnVersion},
+		ChainParams: &chaincfg.RegressionNetParams,
+	})
+	inConn, remoteConn := newPipeConns()
+	sp.AssociateConnection(inConn)
+	defer remoteConn.Reader.(*io.PipeReader).Close()
+	go func() {
+		for {
+			_, _, err := wire.ReadMessage(remoteConn,
+				wire.ProtocolVersion, chaincfg.RegressionNetParams.Net)
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	me := wire.NewNetAddressIPPort(net.ParseIP("10.0.0.2"), 18333, 0)
+	you := wire.NewNetAddressIPPort(net.ParseIP("10.0.0.1"), 18333, 0)
+	msgVersion := wire.NewMsgVersion(me, you, 1, 0)
+	if err := msgVersion.AddUserAgent("Prova", "0.1.0", "old node"); err != nil {
+		t.Fatalf("AddUserAgent: unexpected error: %v", err)
+	}
+	err := wire.WriteMessage(remoteConn, msgVersion, wire.ProtocolVersion,
+		chaincfg.RegressionNetParams.Net)
+	if err != nil {
+		t.Fatalf("WriteMessage: unexpected error: %v", err)
+	}
+
+	waitForDisconnect(t, sp)
+	wantUA := wire.DefaultUserAgent + "Prova:0.1.0(old node)/"
+	if ua := sp.UserAgent(); ua != wantUA {
+		t.Fatalf("got user agent %q, want %q", ua, wantUA)
+	}
+	if score := s.banManager.Score(sp.host()); score != 100 {
+		t.Fatalf("got ban score %d, want 100", score)
+	}
+	select {
+	case <-s.newPeers:
+		t.Fatal("peer with a blacklisted user agent was added")
+	default:
+	}
+}
+
+// TestNetMsgTotals ensures the messages read and written by the peers of the
+// server are tallied per command and returned by getnettotals.
+func TestNetMsgTotals(t *testing.T) {
+	s := &server{banManager: connmgr.NewBanManager("")}
+	sp := newServerPeer(s, false)
+	sp.OnRead(nil, 32, wire.NewMsgPing(1), nil)
+	sp.OnRead(nil, 32, wire.NewMsgPing(2), nil)
+	sp.OnRead(nil, 10, nil, io.ErrUnexpectedEOF)
+	sp.OnWrite(nil, 32, wire.NewMsgPong(1), nil)
+
+	result, err := handleGetNetTotals(&rpcServer{server: s}, nil, nil)
+	if err != nil {
+		t.Fatalf("handleGetNetTotals: unexpected error: %v", err)
+	}
+	totals := result.(*btcjson.GetNetTotalsResult)
+	if totals.TotalBytesRecv != 74 || totals.TotalBytesSent != 32 {
+		t.Fatalf("got %d bytes received and %d sent, want 74 and 32",
+			totals.TotalBytesRecv, totals.TotalBytesSent)
+	}
+	wantRecv := map[string]btcjson.MsgTrafficResult{
+		wire.CmdPing:         {Count: 2, Bytes: 64},
+		peer.OtherMsgCommand: {Count: 1, Bytes: 10},
+	}
+	if !reflect.DeepEqual(totals.RecvPerMsg, wantRecv) {
+		t.Fatalf("got received messages %v, want %v", totals.RecvPerMsg,
+			wantRecv)
+	}
+	wantSent := map[string]btcjson.MsgTrafficResult{
+		wire.CmdPong: {Count: 1, Bytes: 32},
+	}
+	if !reflect.DeepEqual(totals.SentPerMsg, wantSent) {
+		t.Fatalf("got sent messages %v, want %v", totals.SentPerMsg,
+			wantSent)
+	}
+}
+
+// TestWhitelistExemptions ensures peers are whitelisted by the networks which
+// include their address, and that they are exempt from the relay policy checks
+// of all of those networks.
+func TestWhitelistExemptions(t *testing.T) {
+	_, internal, _ := net.ParseCIDR("10.0.0.0/8")
+	_, subnet, _ := net.ParseCIDR("10.1.0.0/16")
+	_, other, _ := net.ParseCIDR("192.168.0.0/24")
+	origCfg := cfg
+	cfg = &config{whitelists: []whitelist{
+		{ipnet: internal, exemptions: mempool.ExemptRelayFee},
+		{ipnet: subnet, exemptions: mempool.ExemptStandardness},
+		{ipnet: other},
+	}}
+	defer func() { cfg = origCfg }()
+
+	tests := []struct {
+		addr        string
+		whitelisted bool
+		exemptions  mempool.PolicyExemptions
+	}{
+		{"10.2.0.1:7979", true, mempool.ExemptRelayFee},
+		{"10.1.0.1:7979", true, mempool.ExemptRelayFee |
+			mempool.ExemptStandardness},
+		{"192.168.0.1:7979", true, 0},
+		{"12.0.0.1:7979", false, 0},
+	}
+	for _, test := range tests {
+		whitelisted, exemptions := isWhitelisted(pipeAddr(test.addr))
+		if whitelisted != test.whitelisted ||
+			exemptions != test.exemptions {
+
+			t.Errorf("isWhitelisted(%s): got %v with exemptions %d, "+
+				"want %v with exemptions %d", test.addr,
+				whitelisted, exemptions, test.whitelisted,
+				test.exemptions)
+		}
+	}
+}
+
+// mockNAT is a NAT gateway which records the port mappings requested from it.
+type mockNAT struct {
+	mtx        sync.Mutex
+	externalIP net.IP
+	offset     int
+	err        error
+	mappings   map[int]int
+	requests   []int
+	deleted    []int
+}
+
+// GetExternalAddress returns the external address of the mock gateway.
+func (n *mockNAT) GetExternalAddress() (net.IP, error) {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	if n.err != nil {
+		return nil, n.err
+	}
+	return n.externalIP, nil
+}
+
+// AddPortMapping maps the internal port to the internal port plus the offset
+// of the mock gateway.
+func (n *mockNAT) AddPortMapping(protocol string, externalPort, internalPort int, description string, timeout int) (int, error) {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	n.requests = append(n.requests, externalPort)
+	if n.err != nil {
+		return 0, n.err
+	}
+	n.mappings[internalPort] = internalPort + n.offset
+	return internalPort + n.offset, nil
+}
+
+// DeletePortMapping removes the mapping of the internal port.
+func (n *mockNAT) DeletePortMapping(protocol string, externalPort, internalPort int) error {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	n.deleted = append(n.deleted, externalPort)
+	delete(n.mappings, internalPort)
+	return n.err
+}
+
+// TestNATMapping ensures the listening port is mapped on the gateway, renewed
+// with the granted external port, advertised through the address manager
+// whenever the external address changes and removed on shutdown, and that
+// gateway failures leave the server running without a mapping.
+func TestNATMapping(t *testing.T) {
+	dir, err := ioutil.TempDir("", "natmapping")
+	if err != nil {
+		t.Fatalf("TempDir: unexpected error %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	nat := &mockNAT{externalIP: net.ParseIP("1.2.3.4"), offset: 10,
+		mappings: make(map[int]int)}
+	s := &server{
+		addrManager: addrmgr.New(dir, nil),
+		nat:         nat,
+		natPort:     18333,
+		quit:        make(chan struct{}),
+		services:    wire.SFNodeNetwork,
+	}
+	remote := wire.NewNetAddressIPPort(net.ParseIP("5.6.7.8"), 18333, 0)
+	advertised := func() string {
+		return addrmgr.NetAddressKey(s.addrManager.GetBestLocalAddress(
+			remote))
+	}
+
+	m := &natMapping{internalPort: 18333}
+	s.refreshNATMapping(m)
+	if got := advertised(); got != "1.2.3.4:18343" {
+		t.Fatalf("advertised %s, want 1.2.3.4:18343", got)
+	}
+
+	// Renewals request the granted port and a changed external address is
+	// advertised.
+	nat.externalIP = net.ParseIP("1.2.3.5")
+	s.refreshNATMapping(m)
+	if got := advertised(); got != "1.2.3.5:18343" {
+		t.Fatalf("advertised %s, want 1.2.3.5:18343", got)
+	}
+	if want := []int{18333, 18343}; !reflect.DeepEqual(nat.requests, want) {
+		t.Fatalf("requested ports %v, want %v", nat.requests, want)
+	}
+
+	// A failing gateway keeps the last mapping state and only warns once.
+	nat.err = fmt.Errorf("gateway failure")
+	s.refreshNATMapping(m)
+	s.refreshNATMapping(m)
+	if !m.warned || m.externalPort != 18343 {
+		t.Fatalf("unexpected mapping state after failure: %+v", m)
+	}
+
+	// The update thread maps the port immediately and removes the mapping
+	// on shutdown.
+	nat = &mockNAT{externalIP: net.ParseIP("1.2.3.4"), offset: 10,
+		mappings: make(map[int]int)}
+	s.nat = nat
+	s.wg.Add(1)
+	go s.natUpdateThread()
+	for i := 0; ; i++ {
+		nat.mtx.Lock()
+		_, ok := nat.mappings[18333]
+		nat.mtx.Unlock()
+		if ok {
+			break
+		}
+		if i == 100 {
+			t.Fatalf("port was not mapped")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(s.quit)
+	s.wg.Wait()
+	if len(nat.mappings) != 0 || !reflect.DeepEqual(nat.deleted,
+		[]int{18343}) {
+
+		t.Fatalf("mapping not removed: %v, deleted %v", nat.mappings,
+			nat.deleted)
+	}
+
+	// A gateway which never maps the port is not asked to remove it.
+	nat = &mockNAT{err: fmt.Errorf("gateway failure"),
+		mappings: make(map[int]int)}
+	s.nat = nat
+	s.quit = make(chan struct{})
+	s.wg.Add(1)
+	go s.natUpdateThread()
+	close(s.quit)
+	s.wg.Wait()
+	if len(nat.deleted) != 0 {
+		t.Fatalf("unmapped port removed: %v", nat.deleted)
+	}
+}
+
+// TestNATListenPort ensures the port of the first listen address is mapped and
+// the default port of the network is used when there is none.
+func TestNATListenPort(t *testing.T) {
+	tests := []struct {
+		addrs []string
+		want  uint16
+	}{
+		{[]string{":18444"}, 18444},
+		{[]string{"127.0.0.1:1234", "[::1]:5678"}, 1234},
+		{[]string{"invalid", "[::1]:5678"}, 5678},
+		{nil, 0},
+	}
+	defaultPort, _ := strconv.ParseUint(activeNetParams.DefaultPort, 10, 16)
+	tests[len(tests)-1].want = uint16(defaultPort)
+
+	for _, test := range tests {
+		if got := natListenPort(test.addrs); got != test.want {
+			t.Errorf("natListenPort(%v): got %d, want %d",
+				test.addrs, got, test.want)
+		}
+	}
+}
+
+// TestOutboundAddressDiversity ensures the addresses of new outbound
+// connections are picked from distinct network groups which are not already
+// represented among the outbound peers and the connections being dialed, and
+// that the constraint is only relaxed once the groups are exhausted.
+func TestOutboundAddressDiversity(t *testing.T) {
+	origCfg := cfg
+	cfg = &config{}
+	defer func() { cfg = origCfg }()
+
+	dir, err := ioutil.TempDir("", "outbounddiversity")
+	if err != nil {
+		t.Fatalf("TempDir: unexpected error %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Seed the address manager with a large cluster of addresses from a
+	// single /16, such as a hosting provider, along with a few addresses
+	// from other IPv4 and IPv6 network groups.
+	port, _ := strconv.ParseUint(activeNetParams.DefaultPort, 10, 16)
+	var addrs []*wire.NetAddress
+	for i := 0; i < 200; i++ {
+		ip := net.IPv4(54, 1, byte(i/16), byte(i%16+1))
+		addrs = append(addrs, wire.NewNetAddressIPPort(ip, uint16(port),
+			wire.SFNodeNetwork))
+	}
+	for _, ip := range []string{"60.1.1.1", "61.1.1.1", "62.1.1.1",
+		"70.1.1.1", "2600:1000::1", "2600:1001::1"} {
+
+		addrs = append(addrs, wire.NewNetAddressIPPort(net.ParseIP(ip),
+			uint16(port), wire.SFNodeNetwork))
+	}
+	s := &server{
+		addrManager: addrmgr.New(dir, nil),
+		banManager:  connmgr.NewBanManager(""),
+		query:       make(chan interface{}),
+		quit:        make(chan struct{}),
+		dialGroups:  make(map[string]string),
+	}
+	s.addrManager.AddAddresses(addrs, wire.NewNetAddressIPPort(
+		net.ParseIP("173.144.173.111"), uint16(port), 0))
+
+	// An outbound peer is already connected to one of the groups.
+	state := &peerState{outboundGroups: map[string]int{
+		"70.1.0.0": 1, "80.1.0.0": 0,
+	}}
+	go func() {
+		for {
+			select {
+			case msg := <-s.query:
+				s.handleQuery(state, msg)
+			case <-s.quit:
+				return
+			}
+		}
+	}()
+	defer close(s.quit)
+
+	groupOf := func(addr net.Addr) string {
+		host, _, _ := net.SplitHostPort(addr.String())
+		return addrmgr.GroupKey(wire.NewNetAddressIPPort(
+			net.ParseIP(host), 0, 0))
+	}
+	seen := map[string]struct{}{"70.1.0.0": {}}
+	var picked []net.Addr
+	for i := 0; i < 6; i++ {
+		addr, err := s.newOutboundAddress()
+		if err != nil {
+			t.Fatalf("newOutboundAddress #%d: unexpected error %v", i,
+				err)
+		}
+		group := groupOf(addr)
+		if _, ok := seen[group]; ok {
+			t.Fatalf("newOutboundAddress #%d: got %v from represented "+
+				"group %s", i, addr, group)
+		}
+		seen[group] = struct{}{}
+		picked = append(picked, addr)
+	}
+	want := map[string]struct{}{"54.1.0.0": {}, "60.1.0.0": {},
+		"61.1.0.0": {}, "62.1.0.0": {}, "70.1.0.0": {},
+		"2600:1000::": {}, "2600:1001::": {}}
+	if !reflect.DeepEqual(seen, want) {
+		t.Fatalf("got groups %v, want %v", seen, want)
+	}
+
+	// Every group is represented now, so the constraint is relaxed.
+	if _, err := s.newOutboundAddress(); err != nil {
+		t.Fatalf("newOutboundAddress: unexpected error %v", err)
+	}
+
+	// Releasing the group of a failed connection makes it available
+	// again while the others remain reserved.
+	s.dialGroupsMtx.Lock()
+	s.dialGroups = make(map[string]string)
+	for _, addr := range picked {
+		s.dialGroups[addr.String()] = groupOf(addr)
+	}
+	s.dialGroupsMtx.Unlock()
+	s.releaseDialGroup(picked[0].String())
+	addr, err := s.newOutboundAddress()
+	if err != nil {
+		t.Fatalf("newOutboundAddress: unexpected error %v", err)
+	}
+	if got := groupOf(addr); got != groupOf(picked[0]) {
+		t.Fatalf("got group %s after release, want %s", got,
+			groupOf(picked[0]))
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The priorities of the shutdown steps.  Steps are run in ascending order of
+// their priority, and steps with the same priority in the order they were
+// registered.
+const (
+	// shutdownStopIntake stops accepting new work from RPC clients, the
+	// CPU miner and peers.
+	shutdownStopIntake = iota
+
+	// shutdownDrainBlocks finishes processing the blocks in flight.
+	shutdownDrainBlocks
+
+	// shutdownFlushChain writes the chain state kept in memory, such as
+	// the utxo set changes of the most recently connected blocks, to the
+	// database.  The indexes are updated along with every block, so they
+	// are consistent with the chain state once it is written.
+	shutdownFlushChain
+
+	// shutdownPersistState saves the state which is not kept in the
+	// database, such as the mempool and the fee estimator.
+	shutdownPersistState
+
+	// shutdownCloseDB closes the database.
+	shutdownCloseDB
+)
+
+// shutdownStep is a step of the shutdown sequence registered with a
+// shutdownCoordinator.
+type shutdownStep struct {
+	name     string
+	priority int
+	stop     func() error
+}
+
+// shutdownCoordinator runs the registered shutdown steps of the subsystems in
+// the order of their priorities, so for example the database is only closed
+// once nothing writes to it anymore.  The whole sequence must complete within
+// a deadline, after which the remaining steps are skipped so a hanging
+// subsystem can not keep the process from exiting.
+type shutdownCoordinator struct {
+	mtx      sync.Mutex
+	steps    []shutdownStep
+	deadline time.Duration
+	done     bool
+}
+
+// newShutdownCoordinator returns a shutdown coordinator which gives the
+// registered steps the passed duration to complete.
+func newShutdownCoordinator(deadline time.Duration) *shutdownCoordinator {
+	return &shutdownCoordinator{deadline: deadline}
+}
+
+// Register adds a step with the passed name and priority which runs the passed
+// stop function to the shutdown sequence.
+//
+// This function is safe for concurrent access.
+func (c *shutdownCoordinator) Register(name string, priority int, stop func() error) {
+	c.mtx.Lock()
+	c.steps = append(c.steps, shutdownStep{
+		name:     name,
+		priority: priority,
+		stop:     stop,
+	})
+	c.mtx.Unlock()
+}
+
+// Shutdown runs the registered steps in the order of their priorities.  Steps
+// which fail are logged and do not keep the later steps from running.  An
+// error is returned when the deadline expires, in which case the step which
+// did not complete is left running and the remaining steps are skipped.  The
+// steps are only run once, later invocations return immediately.
+//
+// This function is safe for concurrent access.
+func (c *shutdownCoordinator) Shutdown() error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if c.done {
+		return nil
+	}
+	c.done = true
+
+	sort.SliceStable(c.steps, func(i, j int) bool {
+		return c.steps[i].priority < c.steps[j].priority
+	})
+	deadline := time.NewTimer(c.deadline)
+	defer deadline.Stop()
+	start := time.Now()
+	for i, step := range c.steps {
+		btcdLog.Infof("Shutdown step %d of %d: stopping %s", i+1,
+			len(c.steps), step.name)
+		stepStart := time.Now()
+
+		done := make(chan error, 1)
+		go func(stop func() error) {
+			done <- stop()
+		}(step.stop)
+		select {
+		case err := <-done:
+			if err != nil {
+				btcdLog.Errorf("Unable to stop %s: %v", step.name,
+					err)
+			}
+			btcdLog.Debugf("Stopped %s in %v", step.name,
+				time.Since(stepStart))
+
+		case <-deadline.C:
+			return fmt.Errorf("shutdown did not complete within %v "+
+				"while stopping %s -- skipped %d remaining steps",
+				c.deadline, step.name, len(c.steps)-i-1)
+		}
+	}
+	btcdLog.Debugf("Shutdown steps completed in %v", time.Since(start))
+	return nil
+}
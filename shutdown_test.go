@@ -0,0 +1,74 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestShutdownCoordinator ensures the shutdown steps run once in the order of
+// their priorities and failing steps don't keep the later ones from running.
+func TestShutdownCoordinator(t *testing.T) {
+	c := newShutdownCoordinator(time.Minute)
+	var order []string
+	step := func(name string, err error) func() error {
+		return func() error {
+			order = append(order, name)
+			return err
+		}
+	}
+	c.Register("database", shutdownCloseDB, step("database", nil))
+	c.Register("mempool", shutdownPersistState, step("mempool", nil))
+	c.Register("rpc", shutdownStopIntake, step("rpc", nil))
+	c.Register("utxo set", shutdownFlushChain,
+		step("utxo set", errors.New("write failed")))
+	c.Register("fee estimator", shutdownPersistState,
+		step("fee estimator", nil))
+	c.Register("block manager", shutdownDrainBlocks,
+		step("block manager", nil))
+	c.Register("peers", shutdownStopIntake, step("peers", nil))
+
+	if err := c.Shutdown(); err != nil {
+		t.Fatalf("Shutdown: unexpected error: %v", err)
+	}
+	want := []string{"rpc", "peers", "block manager", "utxo set",
+		"mempool", "fee estimator", "database"}
+	if !reflect.DeepEqual(order, want) {
+		t.Fatalf("Shutdown: got order %v, want %v", order, want)
+	}
+
+	if err := c.Shutdown(); err != nil || len(order) != len(want) {
+		t.Fatalf("Shutdown: steps run again (err %v)", err)
+	}
+}
+
+// TestShutdownDeadline ensures the remaining steps are skipped once a step
+// exceeds the deadline.
+func TestShutdownDeadline(t *testing.T) {
+	c := newShutdownCoordinator(50 * time.Millisecond)
+	hang := make(chan struct{})
+	defer close(hang)
+	closed := false
+	c.Register("block manager", shutdownDrainBlocks, func() error {
+		<-hang
+		return nil
+	})
+	c.Register("database", shutdownCloseDB, func() error {
+		closed = true
+		return nil
+	})
+
+	err := c.Shutdown()
+	if err == nil || !strings.Contains(err.Error(), "block manager") {
+		t.Fatalf("Shutdown: got error %v, want deadline exceeded", err)
+	}
+	if closed {
+		t.Fatal("Shutdown: ran step after the deadline")
+	}
+}
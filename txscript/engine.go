@@ -85,9 +85,6 @@ const (
 	MaxScriptSize = 10000
 )
 
-// halforder is used to tame ECDSA malleability (see BIP0062).
-var halfOrder = new(big.Int).Rsh(btcec.S256().N, 1)
-
 // Engine is the virtual machine that executes scripts.
 type Engine struct {
 	scripts         [][]parsedOpcode
@@ -571,8 +568,11 @@ func (vm *Engine) checkSignatureEncoding(sig []byte) error {
 	// signature that verifies.  This would result in changing the
 	// transaction hash and thus is source of malleability.
 	if vm.hasFlag(ScriptVerifyLowS) {
-		sValue := new(big.Int).SetBytes(sig[rLen+6 : rLen+6+sLen])
-		if sValue.Cmp(halfOrder) > 0 {
+		signature := btcec.Signature{
+			R: new(big.Int).SetBytes(sig[4 : 4+rLen]),
+			S: new(big.Int).SetBytes(sig[rLen+6 : rLen+6+sLen]),
+		}
+		if !signature.IsCanonical() {
 			return scriptError(ErrSigHighS,
 				"signature is not canonical due to "+
 					"unnecessarily high S value")
@@ -629,7 +629,10 @@ func (vm *Engine) SetAltStack(data [][]byte) {
 
 // NewEngine returns a new script engine for the provided public key script,
 // transaction, and input index.  The flags modify the behavior of the script
-// engine according to the description provided by each flag.
+// engine according to the description provided by each flag.  The sighash
+// midstate of the transaction in hashCache should be computed once and shared
+// by the engines for all inputs of the transaction.  When it is nil, the
+// midstate is computed on first use.
 func NewEngine(scriptPubKey []byte, tx *wire.MsgTx, txIdx int, flags ScriptFlags,
 	sigCache *SigCache, hashCache *TxSigHashes, inputAmount int64) (*Engine, error) {
 	// The provided transaction input index must refer to a valid input.
@@ -6,6 +6,7 @@
 package txscript
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/bitgo/prova/chaincfg/chainhash"
@@ -433,3 +434,219 @@ func TestCheckSignatureEncoding(t *testing.T) {
 		}
 	}
 }
+
+// TestLockTimeOpcodes ensures OP_CHECKLOCKTIMEVERIFY and OP_CHECKSEQUENCEVERIFY
+// compare their operand against the lock time and sequence of the transaction
+// as expected, including the edge cases of the lock types, disabled sequences
+// and negative operands, and only when their script flags are set.
+func TestLockTimeOpcodes(t *testing.T) {
+	t.Parallel()
+
+	const (
+		cltv        = ScriptVerifyCheckLockTimeVerify
+		csv         = ScriptVerifyCheckSequenceVerify
+		discourage  = ScriptDiscourageUpgradableNops
+		seqSeconds  = int64(wire.SequenceLockTimeIsSeconds)
+		seqDisabled = int64(wire.SequenceLockTimeDisabled)
+	)
+	tests := []struct {
+		name     string
+		pkScript string
+		version  int32
+		lockTime uint32
+		sequence uint32
+		flags    ScriptFlags
+		err      error
+	}{
+		{
+			name:     "cltv height satisfied",
+			pkScript: "500000 CHECKLOCKTIMEVERIFY",
+			lockTime: 500000,
+			flags:    cltv,
+		},
+		{
+			name:     "cltv height not satisfied",
+			pkScript: "500000 CHECKLOCKTIMEVERIFY",
+			lockTime: 499999,
+			flags:    cltv,
+			err:      scriptError(ErrUnsatisfiedLockTime, ""),
+		},
+		{
+			name:     "cltv time satisfied",
+			pkScript: "1500000000 CHECKLOCKTIMEVERIFY",
+			lockTime: 1500000001,
+			flags:    cltv,
+		},
+		{
+			name:     "cltv height against time lock time",
+			pkScript: "500000 CHECKLOCKTIMEVERIFY",
+			lockTime: 1500000000,
+			flags:    cltv,
+			err:      scriptError(ErrUnsatisfiedLockTime, ""),
+		},
+		{
+			name:     "cltv time against height lock time",
+			pkScript: "1500000000 CHECKLOCKTIMEVERIFY",
+			lockTime: 499999999,
+			flags:    cltv,
+			err:      scriptError(ErrUnsatisfiedLockTime, ""),
+		},
+		{
+			name:     "cltv max lock time",
+			pkScript: "4294967295 CHECKLOCKTIMEVERIFY",
+			lockTime: 4294967295,
+			flags:    cltv,
+		},
+		{
+			name:     "cltv negative",
+			pkScript: "0 1 SUB CHECKLOCKTIMEVERIFY",
+			flags:    cltv,
+			err:      scriptError(ErrNegativeLockTime, ""),
+		},
+		{
+			name:     "cltv negative made non-negative",
+			pkScript: "0 1 SUB 0 MAX CHECKLOCKTIMEVERIFY 1",
+			flags:    cltv,
+		},
+		{
+			name:     "cltv operand too big",
+			pkScript: "DATA_6 0x000000000001 CHECKLOCKTIMEVERIFY",
+			lockTime: 4294967295,
+			flags:    cltv,
+			err:      scriptError(ErrNumberTooBig, ""),
+		},
+		{
+			name:     "cltv empty stack",
+			pkScript: "CHECKLOCKTIMEVERIFY",
+			flags:    cltv,
+			err:      scriptError(ErrInvalidStackOperation, ""),
+		},
+		{
+			name:     "cltv finalized input",
+			pkScript: "500000 CHECKLOCKTIMEVERIFY",
+			lockTime: 500000,
+			sequence: wire.MaxTxInSequenceNum,
+			flags:    cltv,
+			err:      scriptError(ErrUnsatisfiedLockTime, ""),
+		},
+		{
+			name:     "cltv disabled",
+			pkScript: "500000 CHECKLOCKTIMEVERIFY",
+		},
+		{
+			name:     "cltv disabled and discouraged",
+			pkScript: "500000 CHECKLOCKTIMEVERIFY",
+			flags:    discourage,
+			err:      scriptError(ErrDiscourageUpgradableNOPs, ""),
+		},
+		{
+			name:     "csv height satisfied",
+			pkScript: "144 CHECKSEQUENCEVERIFY",
+			version:  2,
+			sequence: 144,
+			flags:    csv,
+		},
+		{
+			name:     "csv height not satisfied",
+			pkScript: "144 CHECKSEQUENCEVERIFY",
+			version:  2,
+			sequence: 143,
+			flags:    csv,
+			err:      scriptError(ErrUnsatisfiedLockTime, ""),
+		},
+		{
+			name:     "csv time satisfied",
+			pkScript: fmt.Sprintf("%d CHECKSEQUENCEVERIFY", seqSeconds|10),
+			version:  2,
+			sequence: uint32(seqSeconds | 10),
+			flags:    csv,
+		},
+		{
+			name:     "csv time against height sequence",
+			pkScript: fmt.Sprintf("%d CHECKSEQUENCEVERIFY", seqSeconds|10),
+			version:  2,
+			sequence: 20,
+			flags:    csv,
+			err:      scriptError(ErrUnsatisfiedLockTime, ""),
+		},
+		{
+			name:     "csv height against time sequence",
+			pkScript: "10 CHECKSEQUENCEVERIFY",
+			version:  2,
+			sequence: uint32(seqSeconds | 20),
+			flags:    csv,
+			err:      scriptError(ErrUnsatisfiedLockTime, ""),
+		},
+		{
+			name:     "csv ignores non-consensus sequence bits",
+			pkScript: "10 CHECKSEQUENCEVERIFY",
+			version:  2,
+			sequence: 1<<16 | 10,
+			flags:    csv,
+		},
+		{
+			name:     "csv negative",
+			pkScript: "1NEGATE CHECKSEQUENCEVERIFY",
+			version:  2,
+			flags:    csv,
+			err:      scriptError(ErrNegativeLockTime, ""),
+		},
+		{
+			name:     "csv disabled operand",
+			pkScript: fmt.Sprintf("%d CHECKSEQUENCEVERIFY", seqDisabled),
+			version:  1,
+			sequence: wire.MaxTxInSequenceNum,
+			flags:    csv,
+		},
+		{
+			name:     "csv disabled sequence",
+			pkScript: "10 CHECKSEQUENCEVERIFY",
+			version:  2,
+			sequence: uint32(seqDisabled | 10),
+			flags:    csv,
+			err:      scriptError(ErrUnsatisfiedLockTime, ""),
+		},
+		{
+			name:     "csv transaction version 1",
+			pkScript: "10 CHECKSEQUENCEVERIFY",
+			version:  1,
+			sequence: 10,
+			flags:    csv,
+			err:      scriptError(ErrUnsatisfiedLockTime, ""),
+		},
+		{
+			name:     "csv disabled",
+			pkScript: "144 CHECKSEQUENCEVERIFY",
+			version:  2,
+		},
+		{
+			name:     "csv disabled and discouraged",
+			pkScript: "144 CHECKSEQUENCEVERIFY",
+			version:  2,
+			flags:    discourage,
+			err:      scriptError(ErrDiscourageUpgradableNOPs, ""),
+		},
+	}
+
+	for _, test := range tests {
+		tx := &wire.MsgTx{
+			Version: test.version,
+			TxIn: []*wire.TxIn{{
+				PreviousOutPoint: wire.OutPoint{Index: 0},
+				Sequence:         test.sequence,
+			}},
+			TxOut:    []*wire.TxOut{{Value: 1}},
+			LockTime: test.lockTime,
+		}
+		vm, err := NewEngine(mustParseShortForm(test.pkScript), tx, 0,
+			test.flags, nil, nil, 0)
+		if err != nil {
+			t.Errorf("%s: failed to create engine: %v", test.name, err)
+			continue
+		}
+		err = vm.Execute()
+		if e := tstCheckScriptError(err, test.err); e != nil {
+			t.Errorf("%s: %v", test.name, e)
+		}
+	}
+}
@@ -39,6 +39,12 @@ const (
 	// ErrInvalidNumberOfKeyIds is returned when passing a wrong numbers
 	// of keyids for creation of a Prova script
 	ErrInvalidNumberOfKeyIds
+	// ErrInvalidKeyID is returned when a key id can not be part of a
+	// standard Prova script since it is out of range or a duplicate.
+	ErrInvalidKeyID
+	// ErrNotProvaScript is returned from ExtractProvaScriptData when the
+	// provided script is not a standard Prova script in canonical form.
+	ErrNotProvaScript
 	// ErrTooMuchNullData is returned from NullDataScript when the length of
 	// the provided data exceeds MaxDataCarrierSize.
 	ErrTooMuchNullData
@@ -222,6 +228,8 @@ var errorCodeStrings = map[ErrorCode]string{
 	ErrNotMultisigScript:        "ErrNotMultisigScript",
 	ErrTooManyRequiredSigs:      "ErrTooManyRequiredSigs",
 	ErrInvalidNumberOfKeyIds:    "ErrInvalidNumberOfKeyIds",
+	ErrInvalidKeyID:             "ErrInvalidKeyID",
+	ErrNotProvaScript:           "ErrNotProvaScript",
 	ErrTooMuchNullData:          "ErrTooMuchNullData",
 	ErrEarlyReturn:              "ErrEarlyReturn",
 	ErrEmptyStack:               "ErrEmptyStack",
@@ -22,6 +22,8 @@ func TestErrorCodeStringer(t *testing.T) {
 		{ErrUnsupportedAddress, "ErrUnsupportedAddress"},
 		{ErrTooManyRequiredSigs, "ErrTooManyRequiredSigs"},
 		{ErrInvalidNumberOfKeyIds, "ErrInvalidNumberOfKeyIds"},
+		{ErrInvalidKeyID, "ErrInvalidKeyID"},
+		{ErrNotProvaScript, "ErrNotProvaScript"},
 		{ErrTooMuchNullData, "ErrTooMuchNullData"},
 		{ErrNotMultisigScript, "ErrNotMultisigScript"},
 		{ErrEarlyReturn, "ErrEarlyReturn"},
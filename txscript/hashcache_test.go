@@ -6,10 +6,17 @@
 package txscript
 
 import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
 	"math/rand"
 	"testing"
 	"time"
 
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/provautil"
 	"github.com/bitgo/prova/wire"
 	"github.com/davecgh/go-spew/spew"
 )
@@ -182,3 +189,216 @@ func TestHashCachePurge(t *testing.T) {
 		}
 	}
 }
+
+// manyInputsAmount returns the amount of the output spent by input idx of the
+// transaction returned by manyInputsTx.
+func manyInputsAmount(idx int) int64 {
+	return int64(idx+1) * 100000
+}
+
+// manyInputsTx returns an unsigned transaction which spends the passed number
+// of Prova outputs paying to the same address, along with the script of the
+// spent outputs, the same script with its key IDs replaced by the key hashes
+// as done by the chain before executing it, and the keys for signing it.
+func manyInputsTx(tb testing.TB, numInputs int) (*wire.MsgTx, []byte, []byte, KeyDB) {
+	ownerKey, _ := btcec.PrivKeyFromBytes(btcec.S256(), hexToBytes("b0f3e1a3c7c5a4f6b1d5e0c7a9f2d3e4c5b6a7f8e9d0c1b2a3f4e5d6c7b8a9f0"))
+	aspKey, aspPubKey := btcec.PrivKeyFromBytes(btcec.S256(), hexToBytes("eaf02ca348c524e6392655ba4d29603cd1a7347d9d65cfe93ce1ebffdca22694"))
+	_, otherASPPubKey := btcec.PrivKeyFromBytes(btcec.S256(), hexToBytes("2b8c52b77b327c755b9b375500d3f4b2da9b0a1ff65f6891d311fe94295bc26a"))
+
+	keyIDs := []btcec.KeyID{1, 2}
+	_, pkScript, err := PayToProvaPubKeyScript(
+		(*btcec.PublicKey)(&ownerKey.PublicKey), keyIDs,
+		&chaincfg.SimNetParams)
+	if err != nil {
+		tb.Fatalf("failed to make pkScript: %v", err)
+	}
+	pops, err := ParseScript(pkScript)
+	if err != nil {
+		tb.Fatalf("failed to parse pkScript: %v", err)
+	}
+	err = ReplaceKeyIDs(pops, map[btcec.KeyID][]byte{
+		1: provautil.Hash160(aspPubKey.SerializeCompressed()),
+		2: provautil.Hash160(otherASPPubKey.SerializeCompressed()),
+	})
+	if err != nil {
+		tb.Fatalf("failed to replace key ids: %v", err)
+	}
+	vmScript, err := UnparseScript(pops)
+	if err != nil {
+		tb.Fatalf("failed to unparse pkScript: %v", err)
+	}
+
+	tx := wire.NewMsgTx(1)
+	for i := 0; i < numInputs; i++ {
+		var hash chainhash.Hash
+		binary.LittleEndian.PutUint32(hash[:], uint32(i))
+		tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&hash, uint32(i)), nil))
+	}
+	tx.AddTxOut(wire.NewTxOut(manyInputsAmount(numInputs), pkScript))
+
+	kdb := KeyClosure(func(provautil.Address) ([]PrivateKey, error) {
+		return []PrivateKey{
+			{Key: ownerKey, Compressed: true},
+			{Key: aspKey, Compressed: true},
+		}, nil
+	})
+	return tx, pkScript, vmScript, kdb
+}
+
+// calcSignatureHashFromScratch computes the signature hash of input idx of the
+// passed transaction without any precomputed midstate.
+func calcSignatureHashFromScratch(tx *wire.MsgTx, idx int, amt int64, hashType SigHashType) []byte {
+	var prevOuts, sequences, outputs, sigHash bytes.Buffer
+	for _, txIn := range tx.TxIn {
+		prevOuts.Write(txIn.PreviousOutPoint.Hash[:])
+		binary.Write(&prevOuts, binary.LittleEndian,
+			txIn.PreviousOutPoint.Index)
+		binary.Write(&sequences, binary.LittleEndian, txIn.Sequence)
+	}
+	for _, txOut := range tx.TxOut {
+		wire.WriteTxOut(&outputs, 0, 0, txOut)
+	}
+
+	txIn := tx.TxIn[idx]
+	binary.Write(&sigHash, binary.LittleEndian, uint32(tx.Version))
+	sigHash.Write(chainhash.DoubleHashB(prevOuts.Bytes()))
+	sigHash.Write(chainhash.DoubleHashB(sequences.Bytes()))
+	sigHash.Write(txIn.PreviousOutPoint.Hash[:])
+	binary.Write(&sigHash, binary.LittleEndian, txIn.PreviousOutPoint.Index)
+	binary.Write(&sigHash, binary.LittleEndian, uint64(amt))
+	binary.Write(&sigHash, binary.LittleEndian, txIn.Sequence)
+	sigHash.Write(chainhash.DoubleHashB(outputs.Bytes()))
+	binary.Write(&sigHash, binary.LittleEndian, tx.LockTime)
+	binary.Write(&sigHash, binary.LittleEndian, uint32(hashType))
+	return chainhash.DoubleHashB(sigHash.Bytes())
+}
+
+// TestSigHashMidstate ensures signing and verifying the inputs of a transaction
+// with a shared sighash midstate produces the same signature hashes and
+// signatures as computing everything from scratch for every input.
+func TestSigHashMidstate(t *testing.T) {
+	t.Parallel()
+
+	const numInputs = 100
+	tx, pkScript, vmScript, kdb := manyInputsTx(t, numInputs)
+	pops, err := ParseScript(pkScript)
+	if err != nil {
+		t.Fatalf("failed to parse pkScript: %v", err)
+	}
+
+	sigHashes := NewTxSigHashes(tx)
+	sigScripts := make([][]byte, numInputs)
+	for i := range tx.TxIn {
+		amt := manyInputsAmount(i)
+		got := calcSignatureHashNew(pops, sigHashes, SigHashAll, tx, i,
+			amt)
+		want := calcSignatureHashFromScratch(tx, i, amt, SigHashAll)
+		if !bytes.Equal(got, want) {
+			t.Fatalf("input %d: mismatched signature hash - got %x, "+
+				"want %x", i, got, want)
+		}
+
+		// Signatures are deterministic, so signing with and without
+		// the midstate must produce the same signature script.
+		sigScript, err := SignTxOutputWithSigHashes(&chaincfg.SimNetParams,
+			tx, i, amt, pkScript, SigHashAll, kdb, nil, sigHashes)
+		if err != nil {
+			t.Fatalf("input %d: failed to sign: %v", i, err)
+		}
+		noMidstate, err := SignTxOutput(&chaincfg.SimNetParams, tx, i,
+			amt, pkScript, SigHashAll, kdb, nil)
+		if err != nil {
+			t.Fatalf("input %d: failed to sign: %v", i, err)
+		}
+		if !bytes.Equal(sigScript, noMidstate) {
+			t.Fatalf("input %d: mismatched signature script - got "+
+				"%x, want %x", i, sigScript, noMidstate)
+		}
+		sigScripts[i] = sigScript
+	}
+	for i, txIn := range tx.TxIn {
+		txIn.SignatureScript = sigScripts[i]
+	}
+
+	// Ensure every input verifies with the shared midstate, which does not
+	// commit to the signature scripts, as well as without it.
+	for i := range tx.TxIn {
+		for _, hashCache := range []*TxSigHashes{sigHashes, nil} {
+			vm, err := NewEngine(vmScript, tx, i,
+				StandardVerifyFlags, nil, hashCache,
+				manyInputsAmount(i))
+			if err != nil {
+				t.Fatalf("input %d: failed to create engine: %v",
+					i, err)
+			}
+			if err := vm.Execute(); err != nil {
+				t.Fatalf("input %d (midstate %v): failed to "+
+					"verify: %v", i, hashCache != nil, err)
+			}
+		}
+	}
+}
+
+// BenchmarkSignManyInputs benchmarks signing all inputs of a transaction with
+// many inputs with and without sharing the sighash midstate among them.
+func BenchmarkSignManyInputs(b *testing.B) {
+	tx, pkScript, _, kdb := manyInputsTx(b, 100)
+	for _, shared := range []bool{false, true} {
+		b.Run(fmt.Sprintf("shared midstate %v", shared), func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				var sigHashes *TxSigHashes
+				if shared {
+					sigHashes = NewTxSigHashes(tx)
+				}
+				for i := range tx.TxIn {
+					_, err := SignTxOutputWithSigHashes(
+						&chaincfg.SimNetParams, tx, i,
+						manyInputsAmount(i), pkScript,
+						SigHashAll, kdb, nil, sigHashes)
+					if err != nil {
+						b.Fatalf("failed to sign: %v", err)
+					}
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkVerifyManyInputs benchmarks verifying all inputs of a transaction
+// with many inputs with and without sharing the sighash midstate among them.
+func BenchmarkVerifyManyInputs(b *testing.B) {
+	tx, pkScript, vmScript, kdb := manyInputsTx(b, 100)
+	sigHashes := NewTxSigHashes(tx)
+	for i, txIn := range tx.TxIn {
+		sigScript, err := SignTxOutputWithSigHashes(&chaincfg.SimNetParams,
+			tx, i, manyInputsAmount(i), pkScript, SigHashAll, kdb, nil,
+			sigHashes)
+		if err != nil {
+			b.Fatalf("failed to sign: %v", err)
+		}
+		txIn.SignatureScript = sigScript
+	}
+
+	for _, shared := range []bool{false, true} {
+		b.Run(fmt.Sprintf("shared midstate %v", shared), func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				var sigHashes *TxSigHashes
+				if shared {
+					sigHashes = NewTxSigHashes(tx)
+				}
+				for i := range tx.TxIn {
+					vm, err := NewEngine(vmScript, tx, i,
+						StandardVerifyFlags, nil, sigHashes,
+						manyInputsAmount(i))
+					if err != nil {
+						b.Fatalf("failed to create engine: %v",
+							err)
+					}
+					if err := vm.Execute(); err != nil {
+						b.Fatalf("failed to verify: %v", err)
+					}
+				}
+			}
+		})
+	}
+}
@@ -2322,14 +2322,13 @@ func opcodeCheckSafeMultiSig(op *parsedOpcode, vm *Engine) error {
 			return err
 		}
 
-		// Create a new HashCache adding the intermediate sigHashes of this
-		// tx to it.
-		sigHashes := vm.hashCache
-		if sigHashes == nil {
-			sigHashes = NewTxSigHashes(&vm.tx)
+		// Compute the sighash midstate of the transaction on first use
+		// when it was not provided, so it is shared by all signatures.
+		if vm.hashCache == nil {
+			vm.hashCache = NewTxSigHashes(&vm.tx)
 		}
 		// Generate the signature hash based on the signature hash type.
-		hash := calcSignatureHashNew(script, sigHashes, hashType, &vm.tx, vm.txIdx, vm.inputAmount)
+		hash := calcSignatureHashNew(script, vm.hashCache, hashType, &vm.tx, vm.txIdx, vm.inputAmount)
 		var valid bool
 		if vm.sigCache != nil {
 			var sigHash chainhash.Hash
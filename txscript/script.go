@@ -263,11 +263,30 @@ func asInt32(pop parsedOpcode) (int32, error) {
 	return result.Int32(), err
 }
 
+// asKeyID will convert an opcode to a key id.  Key ids are pushed as script
+// numbers, so make sure to use isUint32 before, to check that the opcode can
+// be converted.  An error is returned for negative numbers since they do not
+// represent a key id.
+func asKeyID(pop parsedOpcode) (btcec.KeyID, error) {
+	keyID, err := asInt32(pop)
+	if err != nil {
+		return 0, err
+	}
+	if keyID < 0 {
+		return 0, fmt.Errorf("negative key id %d", keyID)
+	}
+	return btcec.KeyID(keyID), nil
+}
+
 // ExtractKeyIDs takes an Prova pkScript and extracts the keyIDs from it.
 // We assume a Prova address structure like this:
 // basic: <2 hash keyID1 keyID2 3 OP_CHECKSAFEMULTISIG>
 // general: <x hash/keyID hash/keyID y OP_CHECKSAFEMULTISIG>
+// time-locked: <lock OP_CHECKLOCKTIMEVERIFY/OP_CHECKSEQUENCEVERIFY OP_DROP basic>
 func ExtractKeyIDs(pkScript []parsedOpcode) ([]btcec.KeyID, error) {
+	if isProvaTimeLock(pkScript) {
+		pkScript = pkScript[provaTimeLockPrefixLen:]
+	}
 	// the basic structure has 6 elements, as described above
 	if len(pkScript) < 6 || !isSmallInt(pkScript[len(pkScript)-2].opcode) {
 		return nil, fmt.Errorf("unable to extract keyIDs from script, "+
@@ -280,11 +299,11 @@ func ExtractKeyIDs(pkScript []parsedOpcode) ([]btcec.KeyID, error) {
 		if !isUint32(pkScript[i].opcode) {
 			continue
 		}
-		keyID, err := asInt32(pkScript[i])
+		keyID, err := asKeyID(pkScript[i])
 		if err != nil {
 			return nil, err
 		}
-		keyIDs = append(keyIDs, btcec.KeyID(keyID))
+		keyIDs = append(keyIDs, keyID)
 	}
 	return keyIDs, nil
 }
@@ -293,7 +312,11 @@ func ExtractKeyIDs(pkScript []parsedOpcode) ([]btcec.KeyID, error) {
 // We assume a Prova address structure like this:
 // basic: <2 hash keyID1 keyID2 3 OP_CHECKSAFEMULTISIG>
 // general: <x hash/keyID hash/keyID y OP_CHECKSAFEMULTISIG>
+// time-locked: <lock OP_CHECKLOCKTIMEVERIFY/OP_CHECKSEQUENCEVERIFY OP_DROP basic>
 func ReplaceKeyIDs(pkScript []parsedOpcode, keyIdMap map[btcec.KeyID][]byte) error {
+	if isProvaTimeLock(pkScript) {
+		pkScript = pkScript[provaTimeLockPrefixLen:]
+	}
 	// the basic structure has 6 elements, as described above
 	if len(pkScript) < 6 || !isSmallInt(pkScript[len(pkScript)-2].opcode) {
 		return fmt.Errorf("unable to extract keyIDs from script, "+
@@ -310,12 +333,12 @@ func ReplaceKeyIDs(pkScript []parsedOpcode, keyIdMap map[btcec.KeyID][]byte) err
 		if !isUint32(pop.opcode) {
 			continue
 		}
-		keyID, err := asInt32(*pop)
+		keyID, err := asKeyID(*pop)
 		if err != nil {
 			return fmt.Errorf("unable to parse keyIDs from opcode %v",
 				pkScript[i])
 		}
-		if val, ok := keyIdMap[btcec.KeyID(keyID)]; ok {
+		if val, ok := keyIdMap[keyID]; ok {
 			pop.data = val
 			pop.opcode = &opcodeArray[OP_DATA_20]
 		}
@@ -384,7 +407,7 @@ func ExtractASPData(pkScript []parsedOpcode) (byte, *btcec.PublicKey, btcec.KeyI
 func ExtractAdminOpData(pkScript []parsedOpcode) (bool, btcec.KeySetType, *btcec.PublicKey, btcec.KeyID) {
 	pubKey, _ := btcec.ParsePubKey(pkScript[1].data[1:1+btcec.PubKeyBytesLenCompressed], btcec.S256())
 	dataLen := len(pkScript[1].data)
-	keyID := btcec.KeyID(0)
+	keyID := btcec.ReservedKeyID
 	if dataLen > 1+btcec.PubKeyBytesLenCompressed {
 		keyID = btcec.KeyIDFromAddressBuffer(pkScript[1].data[dataLen-btcec.KeyIDSize : dataLen])
 	}
@@ -8,6 +8,8 @@ package txscript
 import (
 	"encoding/binary"
 	"fmt"
+
+	"github.com/bitgo/prova/btcec"
 )
 
 const (
@@ -252,6 +254,26 @@ func (b *ScriptBuilder) AddInt64(val int64) *ScriptBuilder {
 	return b.AddData(scriptNum(val).Bytes())
 }
 
+// AddKeyID pushes the passed key id to the end of the script.  Key ids are
+// pushed as script numbers, which is how Prova scripts embed them.  The script
+// will not be modified if the key id is reserved or pushing it would cause the
+// script to exceed the maximum allowed script engine size.
+func (b *ScriptBuilder) AddKeyID(keyID btcec.KeyID) *ScriptBuilder {
+	if b.err != nil {
+		return b
+	}
+
+	// Reserved key ids are either not representable by a script number or
+	// do not refer to any key.
+	if !keyID.IsValid() {
+		str := fmt.Sprintf("key id %d is reserved", keyID)
+		b.err = ErrScriptNotCanonical(str)
+		return b
+	}
+
+	return b.AddInt64(int64(keyID))
+}
+
 // Reset resets the script so it has no content.
 func (b *ScriptBuilder) Reset() *ScriptBuilder {
 	b.script = b.script[0:0]
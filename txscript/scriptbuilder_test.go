@@ -8,6 +8,8 @@ package txscript
 import (
 	"bytes"
 	"testing"
+
+	"github.com/bitgo/prova/btcec"
 )
 
 // TestScriptBuilderAddOp tests that pushing opcodes to a script via the
@@ -148,6 +150,59 @@ func TestScriptBuilderAddInt64(t *testing.T) {
 	}
 }
 
+// TestScriptBuilderAddKeyID tests that pushing key ids to a script via the
+// ScriptBuilder API pushes them as script numbers and rejects reserved key ids.
+func TestScriptBuilderAddKeyID(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		keyID    btcec.KeyID
+		expected []byte
+		valid    bool
+	}{
+		{name: "push reserved 0", keyID: 0, valid: false},
+		{name: "push 1", keyID: 1, expected: []byte{OP_1}, valid: true},
+		{name: "push 16", keyID: 16, expected: []byte{OP_16}, valid: true},
+		{name: "push 17", keyID: 17, expected: []byte{OP_DATA_1, 0x11}, valid: true},
+		{name: "push 65536", keyID: 65536, expected: []byte{OP_DATA_3, 0, 0, 0x01}, valid: true},
+		{name: "push max", keyID: btcec.MaxKeyID, expected: []byte{OP_DATA_4, 0xff, 0xff, 0xff, 0x7f}, valid: true},
+		{name: "push reserved max+1", keyID: btcec.MaxKeyID + 1, valid: false},
+		{name: "push reserved 0xffffffff", keyID: 0xffffffff, valid: false},
+	}
+
+	builder := NewScriptBuilder()
+	t.Logf("Running %d tests", len(tests))
+	for i, test := range tests {
+		builder.Reset().AddKeyID(test.keyID)
+		result, err := builder.Script()
+		if !test.valid {
+			if _, ok := err.(ErrScriptNotCanonical); !ok {
+				t.Errorf("ScriptBuilder.AddKeyID #%d (%s) "+
+					"unexpected error: %v", i, test.name, err)
+				continue
+			}
+			if len(result) != 0 {
+				t.Errorf("ScriptBuilder.AddKeyID #%d (%s) "+
+					"modified the script: %x", i, test.name,
+					result)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ScriptBuilder.AddKeyID #%d (%s) unexpected "+
+				"error: %v", i, test.name, err)
+			continue
+		}
+		if !bytes.Equal(result, test.expected) {
+			t.Errorf("ScriptBuilder.AddKeyID #%d (%s) wrong result\n"+
+				"got: %x\nwant: %x", i, test.name, result,
+				test.expected)
+			continue
+		}
+	}
+}
+
 // TestScriptBuilderAddData tests that pushing data to a script via the
 // ScriptBuilder API works as expected and conforms to BIP0062.
 func TestScriptBuilderAddData(t *testing.T) {
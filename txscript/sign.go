@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"github.com/bitgo/prova/btcec"
 	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
 	"github.com/bitgo/prova/provautil"
 	"github.com/bitgo/prova/wire"
 	"sort"
@@ -112,7 +113,7 @@ func signSafeMultiSig(tx *wire.MsgTx, idx int, txSigHashes *TxSigHashes, amt int
 }
 
 func sign(chainParams *chaincfg.Params, tx *wire.MsgTx, idx int, inputAmt int64,
-	subScript []byte, hashType SigHashType, kdb KeyDB) (
+	subScript []byte, hashType SigHashType, kdb KeyDB, txSigHashes *TxSigHashes) (
 	[]byte, ScriptClass, []provautil.Address, int, error) {
 
 	class, addresses, nrequired, err := ExtractPkScriptAddrs(subScript,
@@ -121,19 +122,12 @@ func sign(chainParams *chaincfg.Params, tx *wire.MsgTx, idx int, inputAmt int64,
 		return nil, NonStandardTy, nil, 0, err
 	}
 
-	// Create a new HashCache adding the intermediate sigHashes of this tx to it.
-	// The size of the HashCache is chosen big enough for any transaction.
-	// TODO(prova) find a better way to set size of HashCache
-	hashCache := NewHashCache(90)
-	hashCache.AddSigHashes(tx)
-	txHash := tx.TxHash()
-	txSigHashes, found := hashCache.GetSigHashes(&txHash)
-	if !found {
-		return nil, class, nil, 0, errors.New("unable to find sighashes")
+	if txSigHashes == nil {
+		txSigHashes = NewTxSigHashes(tx)
 	}
 
 	switch class {
-	case ProvaTy:
+	case ProvaTy, ProvaTimeLockTy:
 		// We use the keysDb lookup to get a list of privKeys
 		// that are needed for signing.
 		keys, err := kdb.GetKey(addresses[0])
@@ -175,7 +169,7 @@ func mergeScripts(chainParams *chaincfg.Params, tx *wire.MsgTx, idx int,
 	nRequired int, sigScript, prevScript []byte) []byte {
 
 	switch class {
-	case ProvaTy:
+	case ProvaTy, ProvaTimeLockTy:
 		return mergeProvaSig(tx, idx, addresses, nRequired, pkScript,
 			sigScript, prevScript)
 	case ProvaAdminTy:
@@ -282,8 +276,20 @@ func SignTxOutput(chainParams *chaincfg.Params, tx *wire.MsgTx, idx int, inputAm
 	pkScript []byte, hashType SigHashType, kdb KeyDB,
 	previousScript []byte) ([]byte, error) {
 
+	return SignTxOutputWithSigHashes(chainParams, tx, idx, inputAmt,
+		pkScript, hashType, kdb, previousScript, nil)
+}
+
+// SignTxOutputWithSigHashes is the same as SignTxOutput, but reuses the passed
+// sighash midstate of tx instead of computing it.  When signing several inputs
+// of a transaction, the midstate should be computed once with NewTxSigHashes
+// and shared by all inputs.  A nil midstate is computed on demand.
+func SignTxOutputWithSigHashes(chainParams *chaincfg.Params, tx *wire.MsgTx,
+	idx int, inputAmt int64, pkScript []byte, hashType SigHashType, kdb KeyDB,
+	previousScript []byte, txSigHashes *TxSigHashes) ([]byte, error) {
+
 	sigScript, class, addresses, nrequired, err := sign(chainParams, tx,
-		idx, inputAmt, pkScript, hashType, kdb)
+		idx, inputAmt, pkScript, hashType, kdb, txSigHashes)
 	if err != nil {
 		return nil, err
 	}
@@ -293,3 +299,173 @@ func SignTxOutput(chainParams *chaincfg.Params, tx *wire.MsgTx, idx int, inputAm
 		addresses, nrequired, sigScript, previousScript)
 	return mergedScript, nil
 }
+
+// PartialSig is the signature of a single key holder for an input which spends
+// a Prova 2-of-3 output.  The key holders usually sign on different machines,
+// so the partial signatures are exchanged and then combined into the final
+// signature script with CombinePartialSigs.
+type PartialSig struct {
+	// InputIndex is the index of the signed input.
+	InputIndex int
+
+	// KeyID is the key ID of the signing key as it appears in the script,
+	// or btcec.ReservedKeyID when the signing key is the one whose hash is
+	// committed to by the script.
+	KeyID btcec.KeyID
+
+	// PubKey is the serialized compressed public key of the signing key.
+	PubKey []byte
+
+	// Signature is the serialized signature with the hash type appended.
+	Signature []byte
+}
+
+// provaSigPosition returns the position of the key which created the passed
+// partial signature within the Prova script with the passed key hash and key
+// IDs.  The key hash is at position zero, followed by the key IDs.
+func provaSigPosition(sig *PartialSig, pubKeyHash *chainhash.Hash160, keyIDs []btcec.KeyID) (int, error) {
+	if sig.KeyID == btcec.ReservedKeyID {
+		if chainhash.Hash160Sum(sig.PubKey) != *pubKeyHash {
+			return 0, fmt.Errorf("public key %x does not match the "+
+				"key hash of the script", sig.PubKey)
+		}
+		return 0, nil
+	}
+	for i, keyID := range keyIDs {
+		if sig.KeyID == keyID {
+			return i + 1, nil
+		}
+	}
+	return 0, fmt.Errorf("key id %d is not part of the script", sig.KeyID)
+}
+
+// SignInputPartial signs input idx of the passed transaction, which spends
+// the Prova 2-of-3 output prevScript with the passed amount, with the passed
+// private key.  keyID is the key ID of the private key as it appears in
+// prevScript, or zero when the private key is the one whose hash is committed
+// to by prevScript.  The returned partial signature must be combined with the
+// partial signature of another key holder using CombinePartialSigs.
+//
+// The passed sighash midstate of tx is reused when it is not nil, see
+// SignTxOutputWithSigHashes.
+func SignInputPartial(tx *wire.MsgTx, idx int, inputAmt int64, prevScript []byte,
+	hashType SigHashType, keyID btcec.KeyID, key *btcec.PrivateKey,
+	txSigHashes *TxSigHashes) (*PartialSig, error) {
+
+	if idx < 0 || idx >= len(tx.TxIn) {
+		return nil, fmt.Errorf("transaction input index %d is negative "+
+			"or >= %d", idx, len(tx.TxIn))
+	}
+	pubKeyHash, keyIDs, err := ExtractProvaScriptHash160(prevScript)
+	if err != nil {
+		return nil, err
+	}
+	pk := (*btcec.PublicKey)(&key.PublicKey)
+	sig := &PartialSig{
+		InputIndex: idx,
+		KeyID:      keyID,
+		PubKey:     pk.SerializeCompressed(),
+	}
+	if _, err := provaSigPosition(sig, pubKeyHash, keyIDs); err != nil {
+		return nil, err
+	}
+
+	if txSigHashes == nil {
+		txSigHashes = NewTxSigHashes(tx)
+	}
+	sig.Signature, err = RawTxInSignatureNew(tx, idx, txSigHashes, inputAmt,
+		prevScript, hashType, key)
+	if err != nil {
+		return nil, err
+	}
+	return sig, nil
+}
+
+// CombinePartialSigs combines the partial signatures of two different key
+// holders for input idx of the passed transaction, which spends the Prova 2-of-3
+// output prevScript with the passed amount, into the final signature script.
+// Every partial signature is verified against the transaction and prevScript,
+// and the signatures are ordered by the position of their keys within
+// prevScript, so the result does not depend on the order of the passed
+// signatures.
+//
+// The key of a key ID is not known without the chain state, so it is up to
+// the consensus rules to reject a signature created by a key other than the
+// one registered for its key ID.  The passed sighash midstate of tx is reused
+// when it is not nil, see SignTxOutputWithSigHashes.
+func CombinePartialSigs(tx *wire.MsgTx, idx int, inputAmt int64, prevScript []byte,
+	sigs []PartialSig, txSigHashes *TxSigHashes) ([]byte, error) {
+
+	if idx < 0 || idx >= len(tx.TxIn) {
+		return nil, fmt.Errorf("transaction input index %d is negative "+
+			"or >= %d", idx, len(tx.TxIn))
+	}
+	pubKeyHash, keyIDs, err := ExtractProvaScriptHash160(prevScript)
+	if err != nil {
+		return nil, err
+	}
+	if len(sigs) != len(keyIDs) {
+		return nil, fmt.Errorf("%d partial signatures provided, but %d "+
+			"are required", len(sigs), len(keyIDs))
+	}
+	pops, err := ParseScript(prevScript)
+	if err != nil {
+		return nil, err
+	}
+
+	if txSigHashes == nil {
+		txSigHashes = NewTxSigHashes(tx)
+	}
+	ordered := make([]*PartialSig, len(keyIDs)+1)
+	for i := range sigs {
+		sig := &sigs[i]
+		if sig.InputIndex != idx {
+			return nil, fmt.Errorf("partial signature for input %d "+
+				"provided for input %d", sig.InputIndex, idx)
+		}
+		pos, err := provaSigPosition(sig, pubKeyHash, keyIDs)
+		if err != nil {
+			return nil, err
+		}
+		if ordered[pos] != nil {
+			return nil, fmt.Errorf("duplicate partial signature for "+
+				"key id %d", sig.KeyID)
+		}
+
+		// Verify the signature with its public key.
+		if len(sig.PubKey) != btcec.PubKeyBytesLenCompressed {
+			return nil, fmt.Errorf("public key %x is not compressed",
+				sig.PubKey)
+		}
+		pubKey, err := btcec.ParsePubKey(sig.PubKey, btcec.S256())
+		if err != nil {
+			return nil, err
+		}
+		if len(sig.Signature) == 0 {
+			return nil, fmt.Errorf("empty partial signature for key "+
+				"id %d", sig.KeyID)
+		}
+		hashType := SigHashType(sig.Signature[len(sig.Signature)-1])
+		signature, err := btcec.ParseDERSignature(
+			sig.Signature[:len(sig.Signature)-1], btcec.S256())
+		if err != nil {
+			return nil, err
+		}
+		hash := calcSignatureHashNew(pops, txSigHashes, hashType, tx, idx,
+			inputAmt)
+		if !signature.Verify(hash, pubKey) {
+			return nil, fmt.Errorf("partial signature for key id %d "+
+				"failed verification", sig.KeyID)
+		}
+		ordered[pos] = sig
+	}
+
+	builder := NewScriptBuilder()
+	for _, sig := range ordered {
+		if sig == nil {
+			continue
+		}
+		builder.AddData(sig.PubKey).AddData(sig.Signature)
+	}
+	return builder.Script()
+}
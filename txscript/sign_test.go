@@ -6,6 +6,7 @@
 package txscript
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"github.com/bitgo/prova/btcec"
@@ -13,6 +14,7 @@ import (
 	"github.com/bitgo/prova/chaincfg/chainhash"
 	"github.com/bitgo/prova/provautil"
 	"github.com/bitgo/prova/wire"
+	"reflect"
 	"testing"
 )
 
@@ -778,3 +780,353 @@ nexttest:
 		}
 	}
 }
+
+// TestPartialSigs ensures partial signatures produced separately by two key
+// holders of a Prova output combine into a valid signature script regardless
+// of their order, and that invalid partial signatures are rejected.
+func TestPartialSigs(t *testing.T) {
+	t.Parallel()
+
+	hash, _ := chainhash.NewHashFromStr("08886fe11cc704bc617ebaf50f8bed16a66da84141d26d786a054f2c361c905a")
+	tx := &wire.MsgTx{
+		Version: 1,
+		TxIn: []*wire.TxIn{
+			{
+				PreviousOutPoint: wire.OutPoint{Hash: *hash, Index: 0},
+				Sequence:         4294967295,
+			},
+			{
+				PreviousOutPoint: wire.OutPoint{Hash: *hash, Index: 1},
+				Sequence:         4294967295,
+			},
+		},
+		TxOut: []*wire.TxOut{
+			{
+				Value: int64(4000000000),
+			},
+		},
+		LockTime: 0,
+	}
+	inputAmt := int64(5000000000)
+
+	// The ASP keys are registered with these key IDs in the key view used
+	// by checkScripts.
+	keyID1 := btcec.KeyIDFromAddressBuffer([]byte{0, 0, 1, 0})
+	key1, _ := btcec.PrivKeyFromBytes(btcec.S256(), hexToBytes("eaf02ca348c524e6392655ba4d29603cd1a7347d9d65cfe93ce1ebffdca22694"))
+	keyID2 := btcec.KeyIDFromAddressBuffer([]byte{1, 0, 0, 0})
+	key2, _ := btcec.PrivKeyFromBytes(btcec.S256(), hexToBytes("2b8c52b77b327c755b9b375500d3f4b2da9b0a1ff65f6891d311fe94295bc26a"))
+
+	// The key committed to by the key hash of the script.
+	key0, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		t.Fatalf("failed to make privKey: %v", err)
+	}
+	pubKey0 := (*btcec.PublicKey)(&key0.PublicKey)
+	_, pkScript, err := PayToProvaPubKeyScript(pubKey0,
+		[]btcec.KeyID{keyID1, keyID2}, &chaincfg.SimNetParams)
+	if err != nil {
+		t.Fatalf("failed to make pkScript: %v", err)
+	}
+
+	signPartial := func(idx int, keyID btcec.KeyID, key *btcec.PrivateKey) PartialSig {
+		sig, err := SignInputPartial(tx, idx, inputAmt, pkScript,
+			SigHashAll, keyID, key, nil)
+		if err != nil {
+			t.Fatalf("SignInputPartial: unexpected error: %v", err)
+		}
+		return *sig
+	}
+	sig0 := signPartial(0, 0, key0)
+	sig1 := signPartial(0, keyID1, key1)
+	sig2 := signPartial(0, keyID2, key2)
+
+	// Ensure any two different key holders can spend the output and the
+	// signature script does not depend on the order of the signatures.
+	pairs := [][2]PartialSig{{sig0, sig1}, {sig0, sig2}, {sig1, sig2}}
+	for i, pair := range pairs {
+		msg := fmt.Sprintf("pair #%d", i)
+		sigScript, err := CombinePartialSigs(tx, 0, inputAmt, pkScript,
+			[]PartialSig{pair[0], pair[1]}, nil)
+		if err != nil {
+			t.Fatalf("%s: CombinePartialSigs: unexpected error: %v",
+				msg, err)
+		}
+		reversed, err := CombinePartialSigs(tx, 0, inputAmt, pkScript,
+			[]PartialSig{pair[1], pair[0]}, nil)
+		if err != nil {
+			t.Fatalf("%s: CombinePartialSigs: unexpected error: %v",
+				msg, err)
+		}
+		if !bytes.Equal(sigScript, reversed) {
+			t.Fatalf("%s: signature script depends on the order of "+
+				"the partial signatures", msg)
+		}
+		err = checkScripts(msg, tx, 0, inputAmt, sigScript, pkScript)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Ensure signing is rejected for keys which are not part of the script.
+	_, err = SignInputPartial(tx, 0, inputAmt, pkScript, SigHashAll, 0, key1,
+		nil)
+	if err == nil {
+		t.Fatalf("SignInputPartial: did not receive expected error for " +
+			"a key not matching the key hash")
+	}
+	_, err = SignInputPartial(tx, 0, inputAmt, pkScript, SigHashAll,
+		keyID1+keyID2, key1, nil)
+	if err == nil {
+		t.Fatalf("SignInputPartial: did not receive expected error for " +
+			"a key id which is not part of the script")
+	}
+
+	// Ensure invalid partial signatures are rejected.
+	tampered := sig1
+	tampered.Signature = append([]byte(nil), sig1.Signature...)
+	tampered.Signature[len(tampered.Signature)-2] ^= 0x01
+	wrongKey := sig1
+	wrongKey.PubKey = sig2.PubKey
+	wrongInput := signPartial(1, keyID1, key1)
+	wrongInput.InputIndex = 0
+	wrongAmount, err := SignInputPartial(tx, 0, inputAmt+1, pkScript,
+		SigHashAll, keyID1, key1, nil)
+	if err != nil {
+		t.Fatalf("SignInputPartial: unexpected error: %v", err)
+	}
+	otherIndex := sig1
+	otherIndex.InputIndex = 1
+	tests := []struct {
+		name     string
+		pkScript []byte
+		sigs     []PartialSig
+	}{
+		{
+			name:     "same key id",
+			pkScript: pkScript,
+			sigs:     []PartialSig{sig1, signPartial(0, keyID1, key1)},
+		},
+		{
+			name:     "same key hash",
+			pkScript: pkScript,
+			sigs:     []PartialSig{sig0, sig0},
+		},
+		{
+			name:     "single signature",
+			pkScript: pkScript,
+			sigs:     []PartialSig{sig1},
+		},
+		{
+			name:     "three signatures",
+			pkScript: pkScript,
+			sigs:     []PartialSig{sig0, sig1, sig2},
+		},
+		{
+			name:     "tampered signature",
+			pkScript: pkScript,
+			sigs:     []PartialSig{sig0, tampered},
+		},
+		{
+			name:     "signature of another key",
+			pkScript: pkScript,
+			sigs:     []PartialSig{sig0, wrongKey},
+		},
+		{
+			name:     "signature of another input",
+			pkScript: pkScript,
+			sigs:     []PartialSig{sig0, wrongInput},
+		},
+		{
+			name:     "signature of another amount",
+			pkScript: pkScript,
+			sigs:     []PartialSig{sig0, *wrongAmount},
+		},
+		{
+			name:     "mismatched input index",
+			pkScript: pkScript,
+			sigs:     []PartialSig{sig0, otherIndex},
+		},
+		{
+			name:     "not a prova script",
+			pkScript: mustParseShortForm("1 CHECKTHREAD"),
+			sigs:     []PartialSig{sig0, sig1},
+		},
+	}
+	for _, test := range tests {
+		_, err := CombinePartialSigs(tx, 0, inputAmt, test.pkScript,
+			test.sigs, nil)
+		if err == nil {
+			t.Errorf("%s: did not receive expected error", test.name)
+		}
+	}
+}
+
+// TestSignTimeLockedProva ensures time-locked Prova outputs are signed like
+// Prova outputs and that the lock is only enforced by the script engine when
+// the script flag of its opcode is set.
+func TestSignTimeLockedProva(t *testing.T) {
+	t.Parallel()
+
+	keyID1 := btcec.KeyID(1)
+	key1, pubKey1 := btcec.PrivKeyFromBytes(btcec.S256(), hexToBytes("eaf02ca348c524e6392655ba4d29603cd1a7347d9d65cfe93ce1ebffdca22694"))
+	keyID2 := btcec.KeyID(2)
+	_, pubKey2 := btcec.PrivKeyFromBytes(btcec.S256(), hexToBytes("2b8c52b77b327c755b9b375500d3f4b2da9b0a1ff65f6891d311fe94295bc26a"))
+	key0, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		t.Fatalf("failed to make privKey: %v", err)
+	}
+	addr, err := provautil.NewAddressProva(
+		provautil.Hash160((*btcec.PublicKey)(&key0.PublicKey).SerializeCompressed()),
+		[]btcec.KeyID{keyID1, keyID2}, &chaincfg.SimNetParams)
+	if err != nil {
+		t.Fatalf("failed to make Prova address: %v", err)
+	}
+	provaScript, err := PayToAddrScript(addr)
+	if err != nil {
+		t.Fatalf("failed to make pkScript: %v", err)
+	}
+	lookupKey := KeyClosure(func(provautil.Address) ([]PrivateKey, error) {
+		return []PrivateKey{{key0, true}, {key1, true}}, nil
+	})
+	keyIdMap := map[btcec.KeyID][]byte{
+		keyID1: provautil.Hash160(pubKey1.SerializeCompressed()),
+		keyID2: provautil.Hash160(pubKey2.SerializeCompressed()),
+	}
+
+	// Flags enforcing only one of the opcodes, as the consensus rules do
+	// before the other one is deployed.
+	const (
+		cltvFlags = ScriptBip16 | ScriptVerifyCheckLockTimeVerify
+		csvFlags  = ScriptBip16 | ScriptVerifyCheckSequenceVerify
+	)
+	tests := []struct {
+		name     string
+		lock     string
+		version  int32
+		lockTime uint32
+		sequence uint32
+		flags    ScriptFlags
+		valid    bool
+	}{
+		{
+			name:     "lock time satisfied",
+			lock:     "500000 CHECKLOCKTIMEVERIFY",
+			version:  1,
+			lockTime: 500000,
+			flags:    StandardVerifyFlags,
+			valid:    true,
+		},
+		{
+			name:     "lock time not satisfied",
+			lock:     "500000 CHECKLOCKTIMEVERIFY",
+			version:  1,
+			lockTime: 499999,
+			flags:    StandardVerifyFlags,
+			valid:    false,
+		},
+		{
+			name:     "lock time of mismatched type",
+			lock:     "500000 CHECKLOCKTIMEVERIFY",
+			version:  1,
+			lockTime: 1500000000,
+			flags:    StandardVerifyFlags,
+			valid:    false,
+		},
+		{
+			name:     "lock time not enforced",
+			lock:     "500000 CHECKLOCKTIMEVERIFY",
+			version:  1,
+			lockTime: 499999,
+			flags:    csvFlags,
+			valid:    true,
+		},
+		{
+			name:     "relative lock time satisfied",
+			lock:     "144 CHECKSEQUENCEVERIFY",
+			version:  2,
+			sequence: 144,
+			flags:    StandardVerifyFlags,
+			valid:    true,
+		},
+		{
+			name:     "relative lock time not satisfied",
+			lock:     "144 CHECKSEQUENCEVERIFY",
+			version:  2,
+			sequence: 143,
+			flags:    StandardVerifyFlags,
+			valid:    false,
+		},
+		{
+			name:     "relative lock time not enforced",
+			lock:     "144 CHECKSEQUENCEVERIFY",
+			version:  2,
+			sequence: 143,
+			flags:    cltvFlags,
+			valid:    true,
+		},
+	}
+
+	for _, test := range tests {
+		lockScript := mustParseShortForm(test.lock + " DROP")
+		pkScript := append(lockScript, provaScript...)
+		if class := GetScriptClass(pkScript); class != ProvaTimeLockTy {
+			t.Errorf("%s: unexpected script class %v", test.name, class)
+			continue
+		}
+
+		tx := &wire.MsgTx{
+			Version: test.version,
+			TxIn: []*wire.TxIn{{
+				PreviousOutPoint: wire.OutPoint{Index: 0},
+				Sequence:         test.sequence,
+			}},
+			TxOut:    []*wire.TxOut{{Value: 1000}},
+			LockTime: test.lockTime,
+		}
+		sigScript, err := SignTxOutput(&chaincfg.SimNetParams, tx, 0, 2000,
+			pkScript, SigHashAll, lookupKey, nil)
+		if err != nil {
+			t.Errorf("%s: failed to sign: %v", test.name, err)
+			continue
+		}
+		tx.TxIn[0].SignatureScript = sigScript
+
+		// Replace the key IDs of the script as done by the chain.
+		pops, err := ParseScript(pkScript)
+		if err != nil {
+			t.Errorf("%s: failed to parse script: %v", test.name, err)
+			continue
+		}
+		keyIDs, err := ExtractKeyIDs(pops)
+		if err != nil {
+			t.Errorf("%s: failed to extract key ids: %v", test.name,
+				err)
+			continue
+		}
+		if !reflect.DeepEqual(keyIDs, []btcec.KeyID{keyID1, keyID2}) {
+			t.Errorf("%s: unexpected key ids %v", test.name, keyIDs)
+			continue
+		}
+		if err := ReplaceKeyIDs(pops, keyIdMap); err != nil {
+			t.Errorf("%s: failed to replace key ids: %v", test.name,
+				err)
+			continue
+		}
+		vmScript, err := UnparseScript(pops)
+		if err != nil {
+			t.Errorf("%s: failed to unparse script: %v", test.name, err)
+			continue
+		}
+
+		vm, err := NewEngine(vmScript, tx, 0, test.flags, nil, nil, 2000)
+		if err != nil {
+			t.Errorf("%s: failed to create engine: %v", test.name, err)
+			continue
+		}
+		err = vm.Execute()
+		if (err == nil) != test.valid {
+			t.Errorf("%s: unexpected validation result - got %v, "+
+				"want valid %v", test.name, err, test.valid)
+		}
+	}
+}
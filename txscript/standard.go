@@ -6,10 +6,13 @@
 package txscript
 
 import (
+	"bytes"
 	"fmt"
+	"math"
 
 	"github.com/bitgo/prova/btcec"
 	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
 	"github.com/bitgo/prova/provautil"
 	"github.com/bitgo/prova/wire"
 )
@@ -19,6 +22,16 @@ const (
 	// data to be considered a nulldata transaction
 	MaxDataCarrierSize = 80
 
+	// StrictEncodingVerifyFlags are the script flags which require the
+	// signatures and public keys of scripts to use their canonical
+	// encodings, which are strict DER signatures with low S values and
+	// strictly encoded public keys.  They are part of StandardVerifyFlags
+	// and become consensus rules once the strict encoding deployment of the
+	// chain parameters is active.
+	StrictEncodingVerifyFlags = ScriptVerifyDERSignatures |
+		ScriptVerifyStrictEncoding |
+		ScriptVerifyLowS
+
 	// StandardVerifyFlags are the script flags which are used when
 	// executing transaction scripts to enforce additional checks which
 	// are required for the script to be considered standard.  These checks
@@ -47,33 +60,51 @@ type ScriptClass byte
 
 // Classes of script payment known about in the blockchain.
 const (
-	NonStandardTy  ScriptClass = iota // None of the recognized forms.
-	PubKeyTy                          // Pay pubkey.
-	PubKeyHashTy                      // Pay pubkey hash.
-	ScriptHashTy                      // Pay to script hash.
-	MultiSigTy                        // Multi signature.
-	NullDataTy                        // Empty data-only (provably prunable).
-	ProvaTy                           // Prova standard 2-of-3 type (subset of GeneralProvaTy)
-	GeneralProvaTy                    // Prova (generalized m-of-n) script
-	ProvaAdminTy                      // Prova Admin Operations
+	NonStandardTy   ScriptClass = iota // None of the recognized forms.
+	PubKeyTy                           // Pay pubkey.
+	PubKeyHashTy                       // Pay pubkey hash.
+	ScriptHashTy                       // Pay to script hash.
+	MultiSigTy                         // Multi signature.
+	NullDataTy                         // Empty data-only (provably prunable).
+	ProvaTy                            // Prova standard 2-of-3 type (subset of GeneralProvaTy)
+	GeneralProvaTy                     // Prova (generalized m-of-n) script
+	ProvaAdminTy                       // Prova admin thread script.
+	ProvaAdminOpTy                     // Prova admin operation (subset of null data).
+	ProvaTimeLockTy                    // Prova standard 2-of-3 type behind a time lock.
+)
+
+const (
+	// provaAdminRequiredSigs is the number of signatures required to spend
+	// a Prova admin thread script.
+	provaAdminRequiredSigs = 2
+
+	// provaTimeLockPrefixLen is the number of opcodes of a time-locked
+	// Prova script which precede its Prova script.
+	provaTimeLockPrefixLen = 3
 )
 
 // scriptClassToName houses the human-readable strings which describe each
-// script class.
+// script class.  General Prova scripts share the name of the standard ones
+// they are a superset of, which the RPC server has always reported for both.
 var scriptClassToName = []string{
-	// TODO(prova): clean up non-used types
-	NonStandardTy:  "nonstandard",
-	NullDataTy:     "nulldata",
-	ProvaTy:        "safe_multisig",
-	GeneralProvaTy: "safe_multisig",
-	ProvaAdminTy:   "admin",
+	NonStandardTy:   "nonstandard",
+	PubKeyTy:        "pubkey",
+	PubKeyHashTy:    "pubkeyhash",
+	ScriptHashTy:    "scripthash",
+	MultiSigTy:      "multisig",
+	NullDataTy:      "nulldata",
+	ProvaTy:         "safe_multisig",
+	GeneralProvaTy:  "safe_multisig",
+	ProvaAdminTy:    "admin",
+	ProvaAdminOpTy:  "admin_op",
+	ProvaTimeLockTy: "timelock_safe_multisig",
 }
 
 // String implements the Stringer interface by returning the name of
 // the enum script class. If the enum is invalid then "Invalid" will be
 // returned.
 func (t ScriptClass) String() string {
-	if int(t) > len(scriptClassToName) || int(t) < 0 {
+	if int(t) >= len(scriptClassToName) || int(t) < 0 {
 		return "Invalid"
 	}
 	return scriptClassToName[t]
@@ -164,11 +195,12 @@ func isProva(pops []parsedOpcode) bool {
 		return false
 	}
 
-	// Handle standard common case
+	// Handle standard common case, which must be in canonical form.
 	if len(pops) == 6 &&
 		pops[0].opcode.value == OP_2 &&
 		pops[4].opcode.value == OP_3 {
-		return true
+		_, _, ok := extractProvaScriptData(pops)
+		return ok
 	}
 
 	// Handle less common case of n-1 of n (with n-1 keyids)
@@ -178,9 +210,76 @@ func isProva(pops []parsedOpcode) bool {
 	return m == n-1
 }
 
+// isProvaTimeLock returns true if the passed script is a standard Prova 2-of-3
+// script which can only be spent once a lock time or a relative lock time is
+// satisfied.  It is of the form:
+//  <lock time> OP_CHECKLOCKTIMEVERIFY OP_DROP <prova script>
+// or:
+//  <relative lock time> OP_CHECKSEQUENCEVERIFY OP_DROP <prova script>
+// The lock must be a minimally encoded number which fits the unsigned 32-bit
+// field of the transaction it is compared to.  A relative lock time must not
+// have the disable flag set, since the opcode would not lock anything.
+func isProvaTimeLock(pops []parsedOpcode) bool {
+	if len(pops) <= provaTimeLockPrefixLen {
+		return false
+	}
+	lockOp := pops[1].opcode.value
+	if lockOp != OP_CHECKLOCKTIMEVERIFY && lockOp != OP_CHECKSEQUENCEVERIFY {
+		return false
+	}
+	if pops[2].opcode.value != OP_DROP {
+		return false
+	}
+
+	// The lock is either a small integer or a minimal data push of a
+	// number of up to 5 bytes, which the opcodes accept.
+	var lock int64
+	if isSmallInt(pops[0].opcode) {
+		lock = int64(asSmallInt(pops[0].opcode))
+	} else {
+		if pops[0].opcode.value > OP_PUSHDATA4 ||
+			pops[0].checkMinimalDataPush() != nil {
+			return false
+		}
+		num, err := makeScriptNum(pops[0].data, true, 5)
+		if err != nil {
+			return false
+		}
+		lock = int64(num)
+	}
+	if lock < 0 || lock > math.MaxUint32 {
+		return false
+	}
+	if lockOp == OP_CHECKSEQUENCEVERIFY &&
+		lock&int64(wire.SequenceLockTimeDisabled) != 0 {
+		return false
+	}
+
+	_, _, ok := extractProvaScriptData(pops[provaTimeLockPrefixLen:])
+	return ok
+}
+
+// TimeLockScriptFlag returns the script flag which makes the opcode checking
+// the lock of the passed time-locked Prova script enforce it, which is either
+// ScriptVerifyCheckLockTimeVerify or ScriptVerifyCheckSequenceVerify.  Zero is
+// returned when the script is not a time-locked Prova script.
+func TimeLockScriptFlag(script []byte) ScriptFlags {
+	pops, err := ParseScript(script)
+	if err != nil || !isProvaTimeLock(pops) {
+		return 0
+	}
+	if pops[1].opcode.value == OP_CHECKSEQUENCEVERIFY {
+		return ScriptVerifyCheckSequenceVerify
+	}
+	return ScriptVerifyCheckLockTimeVerify
+}
+
 // IsProvaTx determines if a transaction is a standard prova transaction
-// consisting of only outputs to standard prova scripts and 0-value nulldata
-// scripts.
+// consisting of only outputs to standard prova scripts, which may be
+// time-locked, and 0-value nulldata scripts.  Time-locked outputs are only
+// valid once the consensus deployment which enforces the script flag of their
+// lock opcode, as returned by TimeLockScriptFlag, is active, which depends on
+// the chain and is not checked here.
 func IsProvaTx(tx *provautil.Tx) bool {
 	msgTx := tx.MsgTx()
 
@@ -205,7 +304,7 @@ func IsProvaTx(tx *provautil.Tx) bool {
 			if atoms != 0 {
 				return false
 			}
-		} else if !isGeneralProva(pops) {
+		} else if !isGeneralProva(pops) && !isProvaTimeLock(pops) {
 			return false
 		}
 	}
@@ -255,6 +354,9 @@ func isProvaAdmin(pops []parsedOpcode) bool {
 	if pops[sLen-1].opcode.value != OP_CHECKTHREAD {
 		return false
 	}
+	if !isSmallInt(pops[0].opcode) {
+		return false
+	}
 	threadID := provautil.ThreadID(asSmallInt(pops[0].opcode))
 	if threadID < provautil.RootThread || threadID > provautil.IssueThread {
 		return false
@@ -262,6 +364,40 @@ func isProvaAdmin(pops []parsedOpcode) bool {
 	return true
 }
 
+// isProvaAdminOp returns true if the passed script is a well-formed admin
+// operation, which adds a key to or revokes a key from one of the key sets.
+// An admin operation is of the form:
+//  OP_RETURN <op type><compressed pubkey>
+// or, for the ASP key set operations only:
+//  OP_RETURN <op type><compressed pubkey><keyid>
+// Whether the operation is allowed depends on the admin thread of the
+// transaction carrying it, see IsValidAdminOp.
+func isProvaAdminOp(pops []parsedOpcode) bool {
+	if len(pops) != 2 || pops[0].opcode.value != OP_RETURN {
+		return false
+	}
+	data := pops[1].data
+	switch pops[1].opcode.value {
+	case OP_DATA_34:
+		switch data[0] {
+		case AdminOpIssueKeyAdd, AdminOpIssueKeyRevoke,
+			AdminOpProvisionKeyAdd, AdminOpProvisionKeyRevoke,
+			AdminOpValidateKeyAdd, AdminOpValidateKeyRevoke:
+		default:
+			return false
+		}
+	case OP_DATA_38:
+		if data[0] != AdminOpASPKeyAdd && data[0] != AdminOpASPKeyRevoke {
+			return false
+		}
+	default:
+		return false
+	}
+	pubKey := data[1 : 1+btcec.PubKeyBytesLenCompressed]
+	_, err := btcec.ParsePubKey(pubKey, btcec.S256())
+	return err == nil
+}
+
 // IsValidAdminOp returns true if the passed script is a valid admin
 // operation at the given thread.
 func IsValidAdminOp(pops []parsedOpcode, threadID provautil.ThreadID) bool {
@@ -336,12 +472,16 @@ func TypeOfScript(pops []parsedOpcode) ScriptClass {
 // typeOfScript returns the type of the script being inspected from the known
 // standard types.
 func typeOfScript(pops []parsedOpcode) ScriptClass {
-	if isNullData(pops) {
+	if isProvaAdminOp(pops) {
+		return ProvaAdminOpTy
+	} else if isNullData(pops) {
 		return NullDataTy
 	} else if isProva(pops) {
 		return ProvaTy
 	} else if isGeneralProva(pops) {
 		return GeneralProvaTy
+	} else if isProvaTimeLock(pops) {
+		return ProvaTimeLockTy
 	} else if isProvaAdmin(pops) {
 		return ProvaAdminTy
 	}
@@ -378,6 +518,66 @@ type ScriptInfo struct {
 	SigOps int
 }
 
+// expectedInputs returns the number of arguments required by a script.
+// If the script is of unknown type such that the number can not be determined
+// then -1 will be returned.  We are an internal function and thus assume that
+// class is the real class of pops (and we can thus assume things that were
+// determined while finding out the type).
+func expectedInputs(pops []parsedOpcode, class ScriptClass) int {
+	switch class {
+	case ProvaTy, GeneralProvaTy:
+		// Prova scripts are spent with a public key and signature pair
+		// for each of the required signatures, whose number is the
+		// first opcode:
+		//  <pubkey> <sig> <pubkey> <sig> ...
+		return 2 * asSmallInt(pops[0].opcode)
+
+	case ProvaTimeLockTy:
+		// Time-locked Prova scripts are spent like the Prova script
+		// following the lock.
+		return 2 * asSmallInt(pops[provaTimeLockPrefixLen].opcode)
+
+	case ProvaAdminTy:
+		// Admin thread scripts are spent with a public key and
+		// signature pair for each of the required signatures by the
+		// keys of the thread's key set.
+		return 2 * provaAdminRequiredSigs
+
+	default:
+		// Null data and admin operation scripts can not be spent and
+		// the inputs of non-standard scripts are unknown.
+		return -1
+	}
+}
+
+// CalcScriptInfo returns a structure providing data about the provided script
+// pair.  It will error if the pair is in someway invalid such that they can not
+// be analysed, i.e. if they do not parse or the signature script is not a
+// push-only script.
+func CalcScriptInfo(sigScript, pkScript []byte) (*ScriptInfo, error) {
+	sigPops, err := ParseScript(sigScript)
+	if err != nil {
+		return nil, err
+	}
+	pkPops, err := ParseScript(pkScript)
+	if err != nil {
+		return nil, err
+	}
+
+	// Can't have a signature script that doesn't just push data.
+	if !isPushOnly(sigPops) {
+		return nil, scriptError(ErrNotPushOnly,
+			"signature script is not push only")
+	}
+
+	si := new(ScriptInfo)
+	si.PkScriptClass = typeOfScript(pkPops)
+	si.ExpectedInputs = expectedInputs(pkPops, si.PkScriptClass)
+	si.NumInputs = len(sigPops)
+	si.SigOps = getSigOpCount(pkPops, true)
+	return si, nil
+}
+
 // CalcMultiSigStats returns the number of public keys and signatures from
 // a multi-signature transaction script.  The passed script MUST already be
 // known to be a multi-signature script.
@@ -404,17 +604,105 @@ func CalcMultiSigStats(script []byte) (int, int, error) {
 	return numPubKeys, numSigs, nil
 }
 
+// extractProvaScriptData returns the public key hash and key ids of the passed
+// parsed script along with whether it is a standard Prova 2-of-3 script in
+// the canonical form created by payToProvaScript.
+func extractProvaScriptData(pops []parsedOpcode) ([]byte, []btcec.KeyID, bool) {
+	// A standard Prova script is of the form:
+	//  OP_2 <20-byte pubkey hash> <keyid> <keyid> OP_3 OP_CHECKSAFEMULTISIG
+	if len(pops) != 6 ||
+		pops[0].opcode.value != OP_2 ||
+		pops[1].opcode.value != OP_DATA_20 ||
+		pops[4].opcode.value != OP_3 ||
+		pops[5].opcode.value != OP_CHECKSAFEMULTISIG {
+		return nil, nil, false
+	}
+	keyIDs := make([]btcec.KeyID, 0, 2)
+	for _, pop := range pops[2:4] {
+		if !isUint32(pop.opcode) {
+			return nil, nil, false
+		}
+		keyID, err := asKeyID(pop)
+		if err != nil {
+			return nil, nil, false
+		}
+		keyIDs = append(keyIDs, keyID)
+	}
+
+	// The key ids must be pushed exactly the way payToProvaScript pushes
+	// them, which rules out non-minimal pushes such as a data push of a
+	// small integer.
+	script, err := payToProvaScript(pops[1].data, keyIDs)
+	if err != nil {
+		return nil, nil, false
+	}
+	canonical, err := ParseScript(script)
+	if err != nil {
+		return nil, nil, false
+	}
+	for i := range canonical {
+		if canonical[i].opcode.value != pops[i].opcode.value ||
+			!bytes.Equal(canonical[i].data, pops[i].data) {
+			return nil, nil, false
+		}
+	}
+	return pops[1].data, keyIDs, true
+}
+
+// ExtractProvaScriptData returns the public key hash and key ids of the passed
+// standard Prova 2-of-3 script.  Only scripts in the canonical form created by
+// PayToProvaAddrScript are accepted, so an Error with the error code
+// ErrNotProvaScript is returned for scripts which merely resemble it, such as
+// ones with additional pushes or non-minimal key id pushes.
+func ExtractProvaScriptData(script []byte) ([]byte, []btcec.KeyID, error) {
+	pops, err := ParseScript(script)
+	if err != nil {
+		return nil, nil, err
+	}
+	pubKeyHash, keyIDs, ok := extractProvaScriptData(pops)
+	if !ok {
+		str := fmt.Sprintf("script %x is not a standard prova script",
+			script)
+		return nil, nil, scriptError(ErrNotProvaScript, str)
+	}
+	return pubKeyHash, keyIDs, nil
+}
+
+// ExtractProvaScriptHash160 is the same as ExtractProvaScriptData, except the
+// public key hash is returned as a chainhash.Hash160.
+func ExtractProvaScriptHash160(script []byte) (*chainhash.Hash160, []btcec.KeyID, error) {
+	pubKeyHash, keyIDs, err := ExtractProvaScriptData(script)
+	if err != nil {
+		return nil, nil, err
+	}
+	hash, err := chainhash.NewHash160FromBytes(pubKeyHash)
+	if err != nil {
+		return nil, nil, err
+	}
+	return hash, keyIDs, nil
+}
+
 // payToProvaScript creates a new script to pay a transaction output to an
-// Prova 2-of-3 address.
+// Prova 2-of-3 address.  The key ids must be distinct and valid.
 func payToProvaScript(pubKeyHash []byte, keyIDs []btcec.KeyID) ([]byte, error) {
 	if len(keyIDs) != 2 {
 		return nil, scriptError(ErrInvalidNumberOfKeyIds, "prova script must have 2 key ids")
 	}
+	for _, keyID := range keyIDs {
+		if !keyID.IsValid() {
+			str := fmt.Sprintf("key id %d is reserved", keyID)
+			return nil, scriptError(ErrInvalidKeyID, str)
+		}
+	}
+	if keyIDs[0] == keyIDs[1] {
+		str := fmt.Sprintf("duplicate key id %d", keyIDs[0])
+		return nil, scriptError(ErrInvalidKeyID, str)
+	}
 	return NewScriptBuilder().
 		AddInt64(int64(len(keyIDs))).
 		AddData(pubKeyHash).
-		AddInt64(int64(keyIDs[0])).
-		AddInt64(int64(keyIDs[1])).
+		AddKeyID(keyIDs[0]).
+		AddKeyID(keyIDs[1]).
 		AddInt64(int64(len(keyIDs) + 1)).
 		AddOp(OP_CHECKSAFEMULTISIG).
 		Script()
@@ -425,15 +713,39 @@ func payToProvaScript(pubKeyHash []byte, keyIDs []btcec.KeyID) ([]byte, error) {
 func PayToAddrScript(addr provautil.Address) ([]byte, error) {
 	switch addr := addr.(type) {
 	case *provautil.AddressProva:
-		if addr == nil {
-			return nil, scriptError(ErrUnsupportedAddress, "address is nil")
-		}
-		return payToProvaScript(addr.ScriptAddress(), addr.ScriptKeyIDs())
+		return PayToProvaAddrScript(addr)
 	}
 
 	return nil, scriptError(ErrUnsupportedAddress, "unsupported address type")
 }
 
+// PayToProvaAddrScript creates a new standard Prova 2-of-3 script to pay a
+// transaction output to the passed address.  The address must have exactly two
+// key ids, which must be distinct and valid.
+func PayToProvaAddrScript(addr *provautil.AddressProva) ([]byte, error) {
+	if addr == nil {
+		return nil, scriptError(ErrUnsupportedAddress, "address is nil")
+	}
+	return payToProvaScript(addr.ScriptAddress(), addr.ScriptKeyIDs())
+}
+
+// PayToProvaPubKeyScript creates a new standard Prova address for the passed
+// public key and key ids along with the script to pay a transaction output to
+// it.  See provautil.NewAddressProvaFromPubKey for the requirements of the
+// key ids.
+func PayToProvaPubKeyScript(pubKey *btcec.PublicKey, keyIDs []btcec.KeyID, chainParams *chaincfg.Params) (*provautil.AddressProva, []byte, error) {
+	addr, err := provautil.NewAddressProvaFromPubKey(pubKey, keyIDs,
+		chainParams)
+	if err != nil {
+		return nil, nil, err
+	}
+	script, err := payToProvaScript(addr.ScriptAddress(), addr.ScriptKeyIDs())
+	if err != nil {
+		return nil, nil, err
+	}
+	return addr, script, nil
+}
+
 // ProvaThreadScript creates a new script to pay a transaction output to an
 // Prova Admin Thread.
 func ProvaThreadScript(threadID provautil.ThreadID) ([]byte, error) {
@@ -514,17 +826,22 @@ func ExtractPkScriptAddrs(pkScript []byte, chainParams *chaincfg.Params) (Script
 	scriptClass := typeOfScript(pops)
 	switch scriptClass {
 
-	case ProvaTy:
+	case ProvaTy, ProvaTimeLockTy:
+		// Time-locked Prova scripts pay to the address of the Prova
+		// script following the lock.
+		if scriptClass == ProvaTimeLockTy {
+			pops = pops[provaTimeLockPrefixLen:]
+		}
 		numKeyIDs := len(pops) - 4
 		requiredSigs = numKeyIDs
 		keyIDError := false
 		keyIDs := []btcec.KeyID{}
 		for i := 0; i < numKeyIDs; i++ {
-			keyID, err := asInt32(pops[2+i])
+			keyID, err := asKeyID(pops[2+i])
 			if err != nil {
 				keyIDError = true
 			}
-			keyIDs = append(keyIDs, btcec.KeyID(keyID))
+			keyIDs = append(keyIDs, keyID)
 		}
 		addr, err := provautil.NewAddressProva(pops[1].data, keyIDs, chainParams)
 		if err == nil && !keyIDError {
@@ -532,10 +849,16 @@ func ExtractPkScriptAddrs(pkScript []byte, chainParams *chaincfg.Params) (Script
 		}
 
 	case GeneralProvaTy:
-		// TODO(prova): define what to do for generalized prova scripts
+		// Generalized Prova scripts don't have an address type, but the
+		// number of required signatures is the first opcode.
+		requiredSigs = asSmallInt(pops[0].opcode)
 
 	case ProvaAdminTy:
-		requiredSigs = 2
+		requiredSigs = provaAdminRequiredSigs
+
+	case ProvaAdminOpTy:
+		// Admin operations have no addresses or required signatures
+		// since they can not be spent.
 
 	case NullDataTy:
 		// Null data transactions have no addresses or required
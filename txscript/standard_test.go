@@ -13,6 +13,7 @@ import (
 	"github.com/bitgo/prova/provautil"
 	"github.com/bitgo/prova/wire"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -75,6 +76,40 @@ func TestExtractPkScriptAddrs(t *testing.T) {
 			reqSigs: 2,
 			class:   ProvaTy,
 		},
+		{
+			name: "general prova",
+			script: mustParseShortForm("2 DATA_20 0x433ec2ac1ffa1b7b7d" +
+				"027f564529c57197f9ae88 1 2 3 4 5 CHECKSAFEMULTISIG"),
+			addrs:   nil,
+			reqSigs: 2,
+			class:   GeneralProvaTy,
+		},
+		{
+			name: "time-locked prova",
+			script: mustParseShortForm("500000 CHECKLOCKTIMEVERIFY DROP " +
+				"2 DATA_20 0x35dbbf04bca061e49dace08f858d8775c0a57c8e " +
+				"65536 1 3 CHECKSAFEMULTISIG"),
+			addrs: []provautil.Address{
+				newAddressProva(decodeHex("35dbbf04bca061e49dace08f858d8775c0a57c8e"),
+					[]btcec.KeyID{0x10000, 1}),
+			},
+			reqSigs: 2,
+			class:   ProvaTimeLockTy,
+		},
+		{
+			name:    "prova admin thread",
+			script:  mustParseShortForm("1 CHECKTHREAD"),
+			addrs:   nil,
+			reqSigs: 2,
+			class:   ProvaAdminTy,
+		},
+		{
+			name:    "prova admin op",
+			script:  mustParseShortForm("RETURN DATA_34 0x010232abdc893e7f0631364d7fd01cb33d24da45329a00357b3a7886211ab414d55a"),
+			addrs:   nil,
+			reqSigs: 0,
+			class:   ProvaAdminOpTy,
+		},
 		{
 			name:    "empty script",
 			script:  []byte{},
@@ -297,6 +332,312 @@ func TestPayToAddrScript(t *testing.T) {
 	}
 }
 
+// TestPayToProvaPubKeyScript ensures addresses and scripts created from a
+// public key and key ids round trip through extracting the address from the
+// script and decoding the encoded address, and that invalid key ids are
+// rejected.
+func TestPayToProvaPubKeyScript(t *testing.T) {
+	t.Parallel()
+
+	privKey, _ := btcec.PrivKeyFromBytes(btcec.S256(), decodeHex(
+		"0c28fca386c7a227600b2fe50b7cae11ec86d3bf1fbe471be89827e19d72aa1d"))
+	pubKey := privKey.PubKey()
+	pkHash := provautil.Hash160(pubKey.SerializeCompressed())
+
+	nets := []*chaincfg.Params{&chaincfg.MainNetParams,
+		&chaincfg.TestNetParams, &chaincfg.RegressionNetParams,
+		&chaincfg.SimNetParams}
+	keyIDSets := [][]btcec.KeyID{{1, 2}, {0x10000, 1}, {1, 0x7fffffff}}
+	for _, net := range nets {
+		for _, keyIDs := range keyIDSets {
+			addr, script, err := PayToProvaPubKeyScript(pubKey, keyIDs,
+				net)
+			if err != nil {
+				t.Fatalf("%s %v: unexpected error: %v", net.Name,
+					keyIDs, err)
+			}
+			if !bytes.Equal(addr.ScriptAddress(), pkHash) ||
+				!reflect.DeepEqual(addr.ScriptKeyIDs(), keyIDs) ||
+				!addr.IsForNet(net) {
+
+				t.Fatalf("%s %v: unexpected address %v", net.Name,
+					keyIDs, addr)
+			}
+
+			// The script must be the same as the one created for
+			// the address and be a standard Prova script.
+			addrScript, err := PayToAddrScript(addr)
+			if err != nil {
+				t.Fatalf("%s %v: PayToAddrScript: %v", net.Name,
+					keyIDs, err)
+			}
+			if !bytes.Equal(script, addrScript) {
+				t.Fatalf("%s %v: mismatched script - got %x, "+
+					"want %x", net.Name, keyIDs, script,
+					addrScript)
+			}
+			if class := GetScriptClass(script); class != ProvaTy {
+				t.Fatalf("%s %v: unexpected script class %v",
+					net.Name, keyIDs, class)
+			}
+
+			// Extracting the address from the script and decoding
+			// the encoded address must result in the same address.
+			_, addrs, _, err := ExtractPkScriptAddrs(script, net)
+			if err != nil || len(addrs) != 1 {
+				t.Fatalf("%s %v: unable to extract address: %v",
+					net.Name, keyIDs, err)
+			}
+			if addrs[0].EncodeAddress() != addr.EncodeAddress() {
+				t.Fatalf("%s %v: extracted address %v, want %v",
+					net.Name, keyIDs, addrs[0], addr)
+			}
+			decoded, err := provautil.DecodeAddress(
+				addr.EncodeAddress(), net)
+			if err != nil {
+				t.Fatalf("%s %v: unable to decode address: %v",
+					net.Name, keyIDs, err)
+			}
+			decodedScript, err := PayToAddrScript(decoded)
+			if err != nil || !bytes.Equal(decodedScript, script) {
+				t.Fatalf("%s %v: decoded address script %x, "+
+					"want %x (err %v)", net.Name, keyIDs,
+					decodedScript, script, err)
+			}
+		}
+	}
+
+	// Ensure invalid key ids and a missing public key are rejected.
+	invalid := []struct {
+		name   string
+		pubKey *btcec.PublicKey
+		keyIDs []btcec.KeyID
+	}{
+		{"no public key", nil, []btcec.KeyID{1, 2}},
+		{"no key ids", pubKey, nil},
+		{"one key id", pubKey, []btcec.KeyID{1}},
+		{"three key ids", pubKey, []btcec.KeyID{1, 2, 3}},
+		{"key id out of range", pubKey, []btcec.KeyID{1, 0x80000000}},
+		{"reserved key id", pubKey, []btcec.KeyID{0, 1}},
+	}
+	for _, test := range invalid {
+		_, _, err := PayToProvaPubKeyScript(test.pubKey, test.keyIDs,
+			&chaincfg.MainNetParams)
+		if err == nil {
+			t.Fatalf("%s: did not receive expected error", test.name)
+		}
+	}
+}
+
+// TestProvaScriptData ensures standard Prova scripts created by
+// PayToProvaAddrScript round trip through ExtractProvaScriptData, and that
+// scripts which only resemble the canonical form are neither accepted by
+// ExtractProvaScriptData nor classified as standard Prova scripts.
+func TestProvaScriptData(t *testing.T) {
+	t.Parallel()
+
+	pkHash := decodeHex("433ec2ac1ffa1b7b7d027f564529c57197f9ae88")
+	keyIDSets := [][]btcec.KeyID{{1, 2}, {2, 1}, {0x10000, 1},
+		{1, 0x7fffffff}, {16, 17}, {0x80, 0x8000}}
+	for _, keyIDs := range keyIDSets {
+		addr, err := provautil.NewAddressProva(pkHash, keyIDs,
+			&chaincfg.MainNetParams)
+		if err != nil {
+			t.Fatalf("%v: unable to create address: %v", keyIDs, err)
+		}
+		script, err := PayToProvaAddrScript(addr)
+		if err != nil {
+			t.Fatalf("%v: PayToProvaAddrScript: unexpected error: %v",
+				keyIDs, err)
+		}
+		gotHash, gotKeyIDs, err := ExtractProvaScriptData(script)
+		if err != nil {
+			t.Fatalf("%v: ExtractProvaScriptData: unexpected error: "+
+				"%v", keyIDs, err)
+		}
+		if !bytes.Equal(gotHash, pkHash) ||
+			!reflect.DeepEqual(gotKeyIDs, keyIDs) {
+
+			t.Fatalf("%v: mismatched script data - got %x %v", keyIDs,
+				gotHash, gotKeyIDs)
+		}
+		typedHash, typedKeyIDs, err := ExtractProvaScriptHash160(script)
+		if err != nil {
+			t.Fatalf("%v: ExtractProvaScriptHash160: unexpected "+
+				"error: %v", keyIDs, err)
+		}
+		if !bytes.Equal(typedHash[:], pkHash) ||
+			!reflect.DeepEqual(typedKeyIDs, keyIDs) {
+
+			t.Fatalf("%v: mismatched typed script data - got %v %v",
+				keyIDs, typedHash, typedKeyIDs)
+		}
+		if class := GetScriptClass(script); class != ProvaTy {
+			t.Fatalf("%v: unexpected script class %v", keyIDs, class)
+		}
+	}
+
+	// Ensure addresses which can not be paid to by a standard Prova script
+	// are rejected.
+	errUnsupportedAddress := scriptError(ErrUnsupportedAddress, "")
+	errInvalidNumberOfKeyIds := scriptError(ErrInvalidNumberOfKeyIds, "")
+	errInvalidKeyID := scriptError(ErrInvalidKeyID, "")
+	invalidAddrs := []struct {
+		name   string
+		keyIDs []btcec.KeyID
+		err    error
+	}{
+		{"nil address", nil, errUnsupportedAddress},
+		{"three key ids", []btcec.KeyID{1, 2, 3}, errInvalidNumberOfKeyIds},
+		{"key id out of range", []btcec.KeyID{1, 0x80000000}, errInvalidKeyID},
+		{"reserved key id", []btcec.KeyID{0, 1}, errInvalidKeyID},
+		{"duplicate key ids", []btcec.KeyID{7, 7}, errInvalidKeyID},
+	}
+	for _, test := range invalidAddrs {
+		var addr *provautil.AddressProva
+		if test.keyIDs != nil {
+			var err error
+			addr, err = provautil.NewAddressProva(pkHash,
+				test.keyIDs, &chaincfg.MainNetParams)
+			if err != nil {
+				t.Fatalf("%s: unable to create address: %v",
+					test.name, err)
+			}
+		}
+		_, err := PayToProvaAddrScript(addr)
+		if e := tstCheckScriptError(err, test.err); e != nil {
+			t.Fatalf("%s: %v", test.name, e)
+		}
+	}
+
+	// Ensure scripts which are not in the canonical form are rejected.
+	const hash = "DATA_20 0x433ec2ac1ffa1b7b7d027f564529c57197f9ae88"
+	errNotProvaScript := scriptError(ErrNotProvaScript, "")
+	tests := []struct {
+		name   string
+		script string
+		err    error
+	}{
+		{
+			name:   "empty script",
+			script: "",
+			err:    errNotProvaScript,
+		},
+		{
+			name:   "extra push before the opcode",
+			script: "2 " + hash + " 1 2 DATA_1 0x07 3 CHECKSAFEMULTISIG",
+			err:    errNotProvaScript,
+		},
+		{
+			name:   "extra push after the opcode",
+			script: "2 " + hash + " 1 2 3 CHECKSAFEMULTISIG 1",
+			err:    errNotProvaScript,
+		},
+		{
+			name:   "one key id",
+			script: "2 " + hash + " 1 3 CHECKSAFEMULTISIG",
+			err:    errNotProvaScript,
+		},
+		{
+			name:   "three key ids",
+			script: "2 " + hash + " 1 2 3 4 CHECKSAFEMULTISIG",
+			err:    errNotProvaScript,
+		},
+		{
+			name:   "two key hashes",
+			script: "2 " + hash + " " + hash + " 1 3 CHECKSAFEMULTISIG",
+			err:    errNotProvaScript,
+		},
+		{
+			name:   "key id before key hash",
+			script: "2 1 " + hash + " 2 3 CHECKSAFEMULTISIG",
+			err:    errNotProvaScript,
+		},
+		{
+			name:   "small int key id pushed as data",
+			script: "2 " + hash + " DATA_1 0x01 2 3 CHECKSAFEMULTISIG",
+			err:    errNotProvaScript,
+		},
+		{
+			name:   "key id pushed with PUSHDATA1",
+			script: "2 " + hash + " 1 PUSHDATA1 0x03 0x000001 3 CHECKSAFEMULTISIG",
+			err:    errNotProvaScript,
+		},
+		{
+			name:   "key id with zero padding",
+			script: "2 " + hash + " 1 DATA_4 0x00000100 3 CHECKSAFEMULTISIG",
+			err:    errNotProvaScript,
+		},
+		{
+			name:   "negative key id",
+			script: "2 " + hash + " 1 DATA_1 0x81 3 CHECKSAFEMULTISIG",
+			err:    errNotProvaScript,
+		},
+		{
+			name:   "five byte key id",
+			script: "2 " + hash + " 1 DATA_5 0xffffffff00 3 CHECKSAFEMULTISIG",
+			err:    errNotProvaScript,
+		},
+		{
+			name:   "duplicate key ids",
+			script: "2 " + hash + " 1 1 3 CHECKSAFEMULTISIG",
+			err:    errNotProvaScript,
+		},
+		{
+			name:   "key hash pushed with PUSHDATA1",
+			script: "2 PUSHDATA1 0x14 0x433ec2ac1ffa1b7b7d027f564529c57197f9ae88 1 2 3 CHECKSAFEMULTISIG",
+			err:    errNotProvaScript,
+		},
+		{
+			name:   "short key hash",
+			script: "2 DATA_19 0x433ec2ac1ffa1b7b7d027f564529c57197f9ae 1 2 3 CHECKSAFEMULTISIG",
+			err:    errNotProvaScript,
+		},
+		{
+			name:   "long key hash",
+			script: "2 DATA_21 0x433ec2ac1ffa1b7b7d027f564529c57197f9ae8800 1 2 3 CHECKSAFEMULTISIG",
+			err:    errNotProvaScript,
+		},
+		{
+			name:   "three required signatures",
+			script: "3 " + hash + " 1 2 3 CHECKSAFEMULTISIG",
+			err:    errNotProvaScript,
+		},
+		{
+			name:   "required signatures pushed as data",
+			script: "DATA_1 0x02 " + hash + " 1 2 3 CHECKSAFEMULTISIG",
+			err:    errNotProvaScript,
+		},
+		{
+			name:   "four keys",
+			script: "2 " + hash + " 1 2 4 CHECKSAFEMULTISIG",
+			err:    errNotProvaScript,
+		},
+		{
+			name:   "checkmultisig",
+			script: "2 " + hash + " 1 2 3 CHECKMULTISIG",
+			err:    errNotProvaScript,
+		},
+		{
+			name:   "truncated push",
+			script: "2 " + hash + " 1 DATA_2 0x01",
+			err:    scriptError(ErrMalformedPush, ""),
+		},
+	}
+	for _, test := range tests {
+		script := mustParseShortForm(test.script)
+		_, _, err := ExtractProvaScriptData(script)
+		if e := tstCheckScriptError(err, test.err); e != nil {
+			t.Errorf("%s: %v", test.name, e)
+			continue
+		}
+		if class := GetScriptClass(script); class == ProvaTy {
+			t.Errorf("%s: script %x classified as %v", test.name,
+				script, class)
+		}
+	}
+}
+
 // TestMultiSigScript ensures the MultiSigScript function returns the expected
 // scripts and errors.
 func TestMultiSigScript(t *testing.T) {
@@ -622,17 +963,229 @@ var scriptClassTests = []struct {
 			"9ae88 1 2 3 CHECKSAFEMULTISIG",
 		class: ProvaTy,
 	},
+	{
+		name: "non-canonical prova script",
+		script: "2 DATA_20 0x433ec2ac1ffa1b7b7d027f564529c57197f" +
+			"9ae88 DATA_1 0x01 2 3 CHECKSAFEMULTISIG",
+		class: GeneralProvaTy,
+	},
 	{
 		name: "prova script with additional key ids",
 		script: "2 DATA_20 0x433ec2ac1ffa1b7b7d027f564529c57197f" +
 			"9ae88 1 2 3 4 5 CHECKSAFEMULTISIG",
 		class: GeneralProvaTy,
 	},
+	{
+		name: "general prova script with key hashes",
+		script: "3 DATA_20 0x433ec2ac1ffa1b7b7d027f564529c57197f" +
+			"9ae88 DATA_20 0x35dbbf04bca061e49dace08f858d8775c0a5" +
+			"7c8e 1 2 3 5 CHECKSAFEMULTISIG",
+		class: GeneralProvaTy,
+	},
+	{
+		name: "prova script with duplicate key ids",
+		script: "2 DATA_20 0x433ec2ac1ffa1b7b7d027f564529c57197f" +
+			"9ae88 1 1 3 CHECKSAFEMULTISIG",
+		class: NonStandardTy,
+	},
+	{
+		name: "prova script with single signature",
+		script: "1 DATA_20 0x433ec2ac1ffa1b7b7d027f564529c57197f" +
+			"9ae88 1 2 CHECKSAFEMULTISIG",
+		class: NonStandardTy,
+	},
 	{
 		name:   "prova admin script",
 		script: "0 CHECKTHREAD",
 		class:  ProvaAdminTy,
 	},
+	{
+		name:   "prova provision thread script",
+		script: "1 CHECKTHREAD",
+		class:  ProvaAdminTy,
+	},
+	{
+		name:   "prova issue thread script",
+		script: "2 CHECKTHREAD",
+		class:  ProvaAdminTy,
+	},
+	{
+		name:   "prova admin script with unknown thread",
+		script: "3 CHECKTHREAD",
+		class:  NonStandardTy,
+	},
+	{
+		name:   "prova admin script with thread pushed as data",
+		script: "DATA_1 0x01 CHECKTHREAD",
+		class:  NonStandardTy,
+	},
+	{
+		name:   "prova admin script with reserved opcode thread",
+		script: "RESERVED CHECKTHREAD",
+		class:  NonStandardTy,
+	},
+	{
+		name:   "prova admin script with trailing opcode",
+		script: "0 CHECKTHREAD 1",
+		class:  NonStandardTy,
+	},
+	{
+		name:   "prova admin op issue key add",
+		script: "RETURN DATA_34 0x010232abdc893e7f0631364d7fd01cb33d24da45329a00357b3a7886211ab414d55a",
+		class:  ProvaAdminOpTy,
+	},
+	{
+		name:   "prova admin op validate key revoke",
+		script: "RETURN DATA_34 0x120232abdc893e7f0631364d7fd01cb33d24da45329a00357b3a7886211ab414d55a",
+		class:  ProvaAdminOpTy,
+	},
+	{
+		name:   "prova admin op asp key add",
+		script: "RETURN DATA_38 0x130232abdc893e7f0631364d7fd01cb33d24da45329a00357b3a7886211ab414d55a00000100",
+		class:  ProvaAdminOpTy,
+	},
+	{
+		name:   "prova admin op with unknown op type",
+		script: "RETURN DATA_34 0x050232abdc893e7f0631364d7fd01cb33d24da45329a00357b3a7886211ab414d55a",
+		class:  NullDataTy,
+	},
+	{
+		name:   "prova admin op asp key add without key id",
+		script: "RETURN DATA_34 0x130232abdc893e7f0631364d7fd01cb33d24da45329a00357b3a7886211ab414d55a",
+		class:  NullDataTy,
+	},
+	{
+		name:   "prova admin op issue key add with key id",
+		script: "RETURN DATA_38 0x010232abdc893e7f0631364d7fd01cb33d24da45329a00357b3a7886211ab414d55a00000100",
+		class:  NullDataTy,
+	},
+	{
+		name:   "prova admin op with invalid pubkey",
+		script: "RETURN DATA_34 0x010532abdc893e7f0631364d7fd01cb33d24da45329a00357b3a7886211ab414d55a",
+		class:  NullDataTy,
+	},
+	{
+		name:   "prova admin op with non-canonical push",
+		script: "RETURN PUSHDATA1 0x22 0x010232abdc893e7f0631364d7fd01cb33d24da45329a00357b3a7886211ab414d55a",
+		class:  NullDataTy,
+	},
+	{
+		name:   "prova admin op with trailing opcode",
+		script: "RETURN DATA_34 0x010232abdc893e7f0631364d7fd01cb33d24da45329a00357b3a7886211ab414d55a 1",
+		class:  NonStandardTy,
+	},
+	{
+		name: "prova script locked by height",
+		script: "500000 CHECKLOCKTIMEVERIFY DROP " +
+			"2 DATA_20 0x433ec2ac1ffa1b7b7d027f564529c57197f" +
+			"9ae88 1 2 3 CHECKSAFEMULTISIG",
+		class: ProvaTimeLockTy,
+	},
+	{
+		name: "prova script locked by time",
+		script: "1500000000 CHECKLOCKTIMEVERIFY DROP " +
+			"2 DATA_20 0x433ec2ac1ffa1b7b7d027f564529c57197f" +
+			"9ae88 1 2 3 CHECKSAFEMULTISIG",
+		class: ProvaTimeLockTy,
+	},
+	{
+		name: "prova script locked by small int",
+		script: "0 CHECKLOCKTIMEVERIFY DROP " +
+			"2 DATA_20 0x433ec2ac1ffa1b7b7d027f564529c57197f" +
+			"9ae88 1 2 3 CHECKSAFEMULTISIG",
+		class: ProvaTimeLockTy,
+	},
+	{
+		name: "prova script locked by max lock time",
+		script: "4294967295 CHECKLOCKTIMEVERIFY DROP " +
+			"2 DATA_20 0x433ec2ac1ffa1b7b7d027f564529c57197f" +
+			"9ae88 1 2 3 CHECKSAFEMULTISIG",
+		class: ProvaTimeLockTy,
+	},
+	{
+		name: "prova script locked by relative height",
+		script: "144 CHECKSEQUENCEVERIFY DROP " +
+			"2 DATA_20 0x433ec2ac1ffa1b7b7d027f564529c57197f" +
+			"9ae88 1 2 3 CHECKSAFEMULTISIG",
+		class: ProvaTimeLockTy,
+	},
+	{
+		name: "prova script locked by relative time",
+		script: "4194432 CHECKSEQUENCEVERIFY DROP " +
+			"2 DATA_20 0x433ec2ac1ffa1b7b7d027f564529c57197f" +
+			"9ae88 1 2 3 CHECKSAFEMULTISIG",
+		class: ProvaTimeLockTy,
+	},
+	{
+		name: "prova script with negative lock time",
+		script: "1NEGATE CHECKLOCKTIMEVERIFY DROP " +
+			"2 DATA_20 0x433ec2ac1ffa1b7b7d027f564529c57197f" +
+			"9ae88 1 2 3 CHECKSAFEMULTISIG",
+		class: NonStandardTy,
+	},
+	{
+		name: "prova script with lock time above max",
+		script: "4294967296 CHECKLOCKTIMEVERIFY DROP " +
+			"2 DATA_20 0x433ec2ac1ffa1b7b7d027f564529c57197f" +
+			"9ae88 1 2 3 CHECKSAFEMULTISIG",
+		class: NonStandardTy,
+	},
+	{
+		name: "prova script with non-minimal lock time",
+		script: "DATA_2 0x0500 CHECKLOCKTIMEVERIFY DROP " +
+			"2 DATA_20 0x433ec2ac1ffa1b7b7d027f564529c57197f" +
+			"9ae88 1 2 3 CHECKSAFEMULTISIG",
+		class: NonStandardTy,
+	},
+	{
+		name: "prova script with lock time as small int data",
+		script: "DATA_1 0x05 CHECKLOCKTIMEVERIFY DROP " +
+			"2 DATA_20 0x433ec2ac1ffa1b7b7d027f564529c57197f" +
+			"9ae88 1 2 3 CHECKSAFEMULTISIG",
+		class: NonStandardTy,
+	},
+	{
+		name: "prova script with oversized lock time",
+		script: "DATA_6 0x000000000001 CHECKLOCKTIMEVERIFY " +
+			"DROP " + "2 DATA_20 0x433ec2ac1ffa1b7b7d027f564529c57197f" +
+			"9ae88 1 2 3 CHECKSAFEMULTISIG",
+		class: NonStandardTy,
+	},
+	{
+		name: "prova script with disabled relative lock time",
+		script: "2147483648 CHECKSEQUENCEVERIFY DROP " +
+			"2 DATA_20 0x433ec2ac1ffa1b7b7d027f564529c57197f" +
+			"9ae88 1 2 3 CHECKSAFEMULTISIG",
+		class: NonStandardTy,
+	},
+	{
+		name: "prova script with lock time without drop",
+		script: "500000 CHECKLOCKTIMEVERIFY " +
+			"2 DATA_20 0x433ec2ac1ffa1b7b7d027f564529c57197f" +
+			"9ae88 1 2 3 CHECKSAFEMULTISIG",
+		class: NonStandardTy,
+	},
+	{
+		name: "prova script with lock time verified by nop",
+		script: "500000 NOP DROP " +
+			"2 DATA_20 0x433ec2ac1ffa1b7b7d027f564529c57197f" +
+			"9ae88 1 2 3 CHECKSAFEMULTISIG",
+		class: NonStandardTy,
+	},
+	{
+		name: "general prova script with lock time",
+		script: "500000 CHECKLOCKTIMEVERIFY DROP " +
+			"2 DATA_20 0x433ec2ac1ffa1b7b7d027f564529c57197f" +
+			"9ae88 1 2 3 4 5 CHECKSAFEMULTISIG",
+		class: NonStandardTy,
+	},
+	{
+		name: "prova script with lock time after the script",
+		script: "2 DATA_20 0x433ec2ac1ffa1b7b7d027f564529c57197f" +
+			"9ae88 1 2 3 CHECKSAFEMULTISIG " +
+			"500000 CHECKLOCKTIMEVERIFY DROP",
+		class: NonStandardTy,
+	},
 }
 
 // TestScriptClass ensures all the scripts in scriptClassTests have the expected
@@ -651,6 +1204,141 @@ func TestScriptClass(t *testing.T) {
 	}
 }
 
+// TestTimeLockScriptFlag ensures the TimeLockScriptFlag function returns the
+// script flag of the lock opcode for all the time-locked Prova scripts in
+// scriptClassTests and no flag for the other scripts.
+func TestTimeLockScriptFlag(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range scriptClassTests {
+		var want ScriptFlags
+		if test.class == ProvaTimeLockTy {
+			want = ScriptVerifyCheckLockTimeVerify
+			if strings.Contains(test.script, "CHECKSEQUENCEVERIFY") {
+				want = ScriptVerifyCheckSequenceVerify
+			}
+		}
+		script := mustParseShortForm(test.script)
+		if got := TimeLockScriptFlag(script); got != want {
+			t.Errorf("%s: got flag %#x, want %#x", test.name, got,
+				want)
+		}
+	}
+}
+
+// TestCalcScriptInfo ensures the CalcScriptInfo function returns the expected
+// script class and number of provided and expected inputs for the various
+// script classes, and rejects invalid script pairs.
+func TestCalcScriptInfo(t *testing.T) {
+	t.Parallel()
+
+	const (
+		pubKey = "DATA_33 0x0232abdc893e7f0631364d7fd01cb33d24da45329a00357b3a7886211ab414d55a"
+		sig    = "DATA_4 0x30010203"
+	)
+	tests := []struct {
+		name       string
+		sigScript  string
+		pkScript   string
+		scriptInfo ScriptInfo
+		err        error
+	}{
+		{
+			name:      "prova",
+			sigScript: pubKey + " " + sig + " " + pubKey + " " + sig,
+			pkScript: "2 DATA_20 0x433ec2ac1ffa1b7b7d027f564529c57197f" +
+				"9ae88 1 2 3 CHECKSAFEMULTISIG",
+			scriptInfo: ScriptInfo{
+				PkScriptClass:  ProvaTy,
+				NumInputs:      4,
+				ExpectedInputs: 4,
+			},
+		},
+		{
+			name:      "general prova with three signatures",
+			sigScript: pubKey + " " + sig,
+			pkScript: "3 DATA_20 0x433ec2ac1ffa1b7b7d027f564529c57197f" +
+				"9ae88 1 2 3 4 5 CHECKSAFEMULTISIG",
+			scriptInfo: ScriptInfo{
+				PkScriptClass:  GeneralProvaTy,
+				NumInputs:      2,
+				ExpectedInputs: 6,
+			},
+		},
+		{
+			name:      "time-locked prova",
+			sigScript: pubKey + " " + sig + " " + pubKey + " " + sig,
+			pkScript: "144 CHECKSEQUENCEVERIFY DROP 2 DATA_20 0x433ec2ac" +
+				"1ffa1b7b7d027f564529c57197f9ae88 1 2 3 " +
+				"CHECKSAFEMULTISIG",
+			scriptInfo: ScriptInfo{
+				PkScriptClass:  ProvaTimeLockTy,
+				NumInputs:      4,
+				ExpectedInputs: 4,
+			},
+		},
+		{
+			name:      "prova admin thread",
+			sigScript: pubKey + " " + sig,
+			pkScript:  "0 CHECKTHREAD",
+			scriptInfo: ScriptInfo{
+				PkScriptClass:  ProvaAdminTy,
+				NumInputs:      2,
+				ExpectedInputs: 4,
+			},
+		},
+		{
+			name:      "prova admin op",
+			sigScript: "",
+			pkScript:  "RETURN DATA_34 0x010232abdc893e7f0631364d7fd01cb33d24da45329a00357b3a7886211ab414d55a",
+			scriptInfo: ScriptInfo{
+				PkScriptClass:  ProvaAdminOpTy,
+				NumInputs:      0,
+				ExpectedInputs: -1,
+			},
+		},
+		{
+			name:      "nonstandard",
+			sigScript: "1",
+			pkScript:  "1 DROP",
+			scriptInfo: ScriptInfo{
+				PkScriptClass:  NonStandardTy,
+				NumInputs:      1,
+				ExpectedInputs: -1,
+			},
+		},
+		{
+			name:      "signature script not push only",
+			sigScript: pubKey + " DUP",
+			pkScript:  "0 CHECKTHREAD",
+			err:       scriptError(ErrNotPushOnly, ""),
+		},
+		{
+			name:      "signature script does not parse",
+			sigScript: "DATA_2 0x01",
+			pkScript:  "0 CHECKTHREAD",
+			err:       scriptError(ErrMalformedPush, ""),
+		},
+	}
+
+	for _, test := range tests {
+		sigScript := mustParseShortForm(test.sigScript)
+		pkScript := mustParseShortForm(test.pkScript)
+		si, err := CalcScriptInfo(sigScript, pkScript)
+		if e := tstCheckScriptError(err, test.err); e != nil {
+			t.Errorf("%s: %v", test.name, e)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if *si != test.scriptInfo {
+			t.Errorf("%s: unexpected script info - got %+v, want "+
+				"%+v", test.name, *si, test.scriptInfo)
+		}
+	}
+}
+
 // TestStringifyClass ensures the script class string returns the expected
 // string for each script class.
 func TestStringifyClass(t *testing.T) {
@@ -671,6 +1359,36 @@ func TestStringifyClass(t *testing.T) {
 			class:    NullDataTy,
 			stringed: "nulldata",
 		},
+		{
+			name:     "provaty",
+			class:    ProvaTy,
+			stringed: "safe_multisig",
+		},
+		{
+			name:     "generalprovaty",
+			class:    GeneralProvaTy,
+			stringed: "safe_multisig",
+		},
+		{
+			name:     "provaadminty",
+			class:    ProvaAdminTy,
+			stringed: "admin",
+		},
+		{
+			name:     "provaadminopty",
+			class:    ProvaAdminOpTy,
+			stringed: "admin_op",
+		},
+		{
+			name:     "provatimelockty",
+			class:    ProvaTimeLockTy,
+			stringed: "timelock_safe_multisig",
+		},
+		{
+			name:     "first invalid",
+			class:    ProvaTimeLockTy + 1,
+			stringed: "Invalid",
+		},
 		{
 			name:     "broken",
 			class:    ScriptClass(255),
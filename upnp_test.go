@@ -0,0 +1,150 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// mockIGDDescription is the device description of a mock internet gateway
+// device with its WANIPConnection control URL at /ctl/IPConn.
+const mockIGDDescription = `<?xml version="1.0"?>
+<root xmlns="urn:schemas-upnp-org:device-1-0">
+<specVersion><major>1</major><minor>0</minor></specVersion>
+<device>
+<deviceType>urn:schemas-upnp-org:device:InternetGatewayDevice:1</deviceType>
+<deviceList><device>
+<deviceType>urn:schemas-upnp-org:device:WANDevice:1</deviceType>
+<deviceList><device>
+<deviceType>urn:schemas-upnp-org:device:WANConnectionDevice:1</deviceType>
+<serviceList><service>
+<serviceType>urn:schemas-upnp-org:service:WANIPConnection:1</serviceType>
+<controlURL>/ctl/IPConn</controlURL>
+</service></serviceList>
+</device></deviceList>
+</device></deviceList>
+</device>
+</root>`
+
+// mockSOAPResponse wraps the passed body in a SOAP envelope.
+func mockSOAPResponse(body string) string {
+	return `<?xml version="1.0"?>` +
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/">` +
+		`<s:Body>` + body + `</s:Body></s:Envelope>`
+}
+
+// soapCall is a SOAP request received by the mock gateway.
+type soapCall struct {
+	action string
+	body   string
+}
+
+// newMockIGD starts a mock UPnP internet gateway device which serves its
+// device description and answers SOAP requests.  The SOAP requests are sent on
+// the returned channel.
+func newMockIGD(t *testing.T, external string) (*httptest.Server, chan soapCall) {
+	calls := make(chan soapCall, 10)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rootDesc.xml", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(mockIGDDescription))
+	})
+	mux.HandleFunc("/ctl/IPConn", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		action := r.Header.Get("SOAPAction")
+		action = action[strings.LastIndex(action, "#")+1:]
+		action = strings.TrimSuffix(action, `"`)
+		calls <- soapCall{action: action, body: string(body)}
+
+		var resp string
+		switch action {
+		case "GetExternalIPAddress":
+			resp = `<u:GetExternalIPAddressResponse xmlns:u="urn:` +
+				`schemas-upnp-org:service:WANIPConnection:1">` +
+				`<NewExternalIPAddress>` + external +
+				`</NewExternalIPAddress>` +
+				`</u:GetExternalIPAddressResponse>`
+		case "AddPortMapping", "DeletePortMapping":
+			resp = `<u:` + action + `Response xmlns:u="urn:` +
+				`schemas-upnp-org:service:WANIPConnection:1"/>`
+		default:
+			http.Error(w, "invalid action", http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(mockSOAPResponse(resp)))
+	})
+	return httptest.NewServer(mux), calls
+}
+
+// TestUPnP ensures the WANIPConnection service is found in the description of
+// a gateway and the port mapping SOAP requests are sent to it.
+func TestUPnP(t *testing.T) {
+	igd, calls := newMockIGD(t, "1.2.3.4")
+	defer igd.Close()
+
+	serviceURL, err := getServiceURL(igd.URL + "/rootDesc.xml")
+	if err != nil {
+		t.Fatalf("getServiceURL: unexpected error %v", err)
+	}
+	if want := igd.URL + "/ctl/IPConn"; serviceURL != want {
+		t.Fatalf("getServiceURL: got %q, want %q", serviceURL, want)
+	}
+	nat := &upnpNAT{serviceURL: serviceURL, ourIP: "192.168.0.2"}
+
+	ip, err := nat.GetExternalAddress()
+	if err != nil {
+		t.Fatalf("GetExternalAddress: unexpected error %v", err)
+	}
+	if !ip.Equal(net.ParseIP("1.2.3.4")) {
+		t.Fatalf("GetExternalAddress: got %v, want 1.2.3.4", ip)
+	}
+	if call := <-calls; call.action != "GetExternalIPAddress" {
+		t.Fatalf("got action %q, want GetExternalIPAddress",
+			call.action)
+	}
+
+	mapped, err := nat.AddPortMapping("tcp", 18333, 18334, "Prova", 1200)
+	if err != nil {
+		t.Fatalf("AddPortMapping: unexpected error %v", err)
+	}
+	if mapped != 18333 {
+		t.Fatalf("AddPortMapping: got port %d, want 18333", mapped)
+	}
+	call := <-calls
+	for _, want := range []string{"<NewExternalPort>18333<",
+		"<NewProtocol>TCP<", "<NewInternalPort>18334<",
+		"<NewInternalClient>192.168.0.2<",
+		"<NewLeaseDuration>1200<"} {
+
+		if !strings.Contains(call.body, want) {
+			t.Errorf("AddPortMapping: request does not contain %q: "+
+				"%s", want, call.body)
+		}
+	}
+
+	if err := nat.DeletePortMapping("tcp", 18333, 18334); err != nil {
+		t.Fatalf("DeletePortMapping: unexpected error %v", err)
+	}
+	call = <-calls
+	if call.action != "DeletePortMapping" ||
+		!strings.Contains(call.body, "<NewExternalPort>18333<") {
+
+		t.Fatalf("DeletePortMapping: unexpected request %v", call)
+	}
+
+	// Ensure descriptions without the required devices and failing
+	// requests are rejected.
+	if _, err := getServiceURL(igd.URL + "/missing"); err == nil {
+		t.Fatalf("getServiceURL: missing description accepted")
+	}
+	nat.serviceURL = igd.URL + "/missing"
+	if _, err := nat.GetExternalAddress(); err == nil {
+		t.Fatalf("GetExternalAddress: failed request accepted")
+	}
+}
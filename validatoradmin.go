@@ -0,0 +1,187 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/btcjson"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/txscript"
+	"github.com/bitgo/prova/wire"
+)
+
+// validatorAdminTx builds the provision thread transaction which applies the
+// passed validate key admin operation, either txscript.AdminOpValidateKeyAdd
+// or txscript.AdminOpValidateKeyRevoke, on top of the passed thread tip.
+//
+// The transaction is signed with those of the passed admin keys which belong
+// to the provision key set.  It is left unsigned when no admin keys are
+// passed, so the caller can have it signed elsewhere.  The returned flag
+// reports whether enough signatures were added for the transaction to be
+// valid, and the returned key set is the validate key set which results from
+// the transaction being connected.
+func validatorAdminTx(params *chaincfg.Params, adminOp byte, pubKey *btcec.PublicKey,
+	keySets map[btcec.KeySetType]btcec.PublicKeySet, threadTip *wire.OutPoint,
+	adminKeys []*btcec.PrivateKey) (*wire.MsgTx, bool, btcec.PublicKeySet, error) {
+
+	// Predict the validate key set on a copy, since removing keys from a
+	// key set reorders the backing array.
+	validateKeys := append(btcec.PublicKeySet(nil),
+		keySets[btcec.ValidateKeySet]...)
+	pos := validateKeys.Pos(pubKey)
+	switch adminOp {
+	case txscript.AdminOpValidateKeyAdd:
+		if pos >= 0 {
+			return nil, false, nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCValidatorKeyActive,
+				Message: "Validate key is already active",
+			}
+		}
+		validateKeys = validateKeys.Add(pubKey)
+
+	case txscript.AdminOpValidateKeyRevoke:
+		if pos < 0 {
+			return nil, false, nil, &btcjson.RPCError{
+				Code:    btcjson.ErrRPCValidatorKeyInactive,
+				Message: "Validate key is not active",
+			}
+		}
+		validateKeys = validateKeys.Remove(pos)
+
+	default:
+		return nil, false, nil, internalRPCError(fmt.Sprintf(
+			"unsupported admin op %#x", adminOp), "validatorAdminTx")
+	}
+
+	if threadTip == nil {
+		return nil, false, nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCThreadTipUnknown,
+			Message: "Provision thread tip is unknown",
+		}
+	}
+
+	// Only the configured admin keys which are part of the provision key
+	// set can contribute a valid signature.
+	var signKeys []txscript.PrivateKey
+	provisionKeys := keySets[btcec.ProvisionKeySet]
+	for _, adminKey := range adminKeys {
+		if provisionKeys.Pos(adminKey.PubKey()) < 0 {
+			continue
+		}
+		signKeys = append(signKeys, txscript.PrivateKey{
+			Key:        adminKey,
+			Compressed: true,
+		})
+	}
+	if len(adminKeys) > 0 && len(signKeys) == 0 {
+		return nil, false, nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCNotAdminKeyHolder,
+			Message: "None of the configured admin keys is a provision key",
+		}
+	}
+
+	threadScript, err := txscript.ProvaThreadScript(provautil.ProvisionThread)
+	if err != nil {
+		return nil, false, nil, internalRPCError(err.Error(),
+			"Failed to create thread script")
+	}
+	data := append([]byte{adminOp}, pubKey.SerializeCompressed()...)
+	adminScript, err := txscript.NullDataScript(data)
+	if err != nil {
+		return nil, false, nil, internalRPCError(err.Error(),
+			"Failed to create admin op script")
+	}
+
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	msgTx.AddTxIn(wire.NewTxIn(threadTip, nil))
+	msgTx.AddTxOut(wire.NewTxOut(0, threadScript))
+	msgTx.AddTxOut(wire.NewTxOut(0, adminScript))
+	if len(signKeys) == 0 {
+		return msgTx, false, validateKeys, nil
+	}
+
+	_, _, requiredSigs, err := txscript.ExtractPkScriptAddrs(threadScript,
+		params)
+	if err != nil {
+		return nil, false, nil, internalRPCError(err.Error(),
+			"Failed to parse thread script")
+	}
+	lookupKey := func(provautil.Address) ([]txscript.PrivateKey, error) {
+		return signKeys, nil
+	}
+	sigScript, err := txscript.SignTxOutput(params, msgTx, 0, 0,
+		threadScript, txscript.SigHashAll, txscript.KeyClosure(lookupKey),
+		nil)
+	if err != nil {
+		return nil, false, nil, internalRPCError(err.Error(),
+			"Failed to sign admin transaction")
+	}
+	msgTx.TxIn[0].SignatureScript = sigScript
+
+	return msgTx, len(signKeys) >= requiredSigs, validateKeys, nil
+}
+
+// handleValidatorAdmin builds the provision thread transaction for the passed
+// validate key admin operation, submits it to the memory pool when it is
+// fully signed, and reports it along with the predicted validate key set.
+func handleValidatorAdmin(s *rpcServer, adminOp byte, pubKeyStr string) (interface{}, error) {
+	pubKeyBytes, err := hex.DecodeString(pubKeyStr)
+	if err != nil {
+		return nil, rpcDecodeHexError(pubKeyStr)
+	}
+	pubKey, err := btcec.ParsePubKey(pubKeyBytes, btcec.S256())
+	if err != nil {
+		return nil, &btcjson.RPCError{
+			Code:    btcjson.ErrRPCInvalidAddressOrKey,
+			Message: "Invalid public key: " + err.Error(),
+		}
+	}
+
+	threadTip := s.chain.ThreadTips()[provautil.ProvisionThread]
+	msgTx, complete, validateKeys, err := validatorAdminTx(
+		activeNetParams.Params, adminOp, pubKey, s.chain.AdminKeySets(),
+		threadTip, cfg.adminKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &btcjson.ValidatorAdminResult{
+		TxID:         msgTx.TxHash().String(),
+		Complete:     complete,
+		ValidateKeys: validateKeys.ToStringArray(),
+	}
+	if !complete {
+		var buf bytes.Buffer
+		buf.Grow(msgTx.SerializeSize())
+		if err := msgTx.Serialize(&buf); err != nil {
+			context := "Failed to serialize admin transaction"
+			return nil, internalRPCError(err.Error(), context)
+		}
+		result.Hex = hex.EncodeToString(buf.Bytes())
+		return result, nil
+	}
+
+	if err := submitTransaction(s, provautil.NewTx(msgTx)); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// handleProvisionValidator implements the provisionvalidator command.
+func handleProvisionValidator(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.ProvisionValidatorCmd)
+	return handleValidatorAdmin(s, txscript.AdminOpValidateKeyAdd, c.PubKey)
+}
+
+// handleRevokeValidator implements the revokevalidator command.
+func handleRevokeValidator(s *rpcServer, cmd interface{}, closeChan <-chan struct{}) (interface{}, error) {
+	c := cmd.(*btcjson.RevokeValidatorCmd)
+	return handleValidatorAdmin(s, txscript.AdminOpValidateKeyRevoke, c.PubKey)
+}
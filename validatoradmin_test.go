@@ -0,0 +1,179 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/btcjson"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/txscript"
+	"github.com/bitgo/prova/wire"
+)
+
+// TestValidatorAdminTx ensures the provisionvalidator and revokevalidator
+// transactions are built and signed according to the configured admin keys
+// and that the distinct failure conditions are reported.
+func TestValidatorAdminTx(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	keySets := params.AdminKeySets
+	threadTip := wire.NewOutPoint(validatorKeyThreadTip.Hash(), 0)
+	newKey := validatorKeyPrivKey("1337000000000000000000000000000000000000000000000000000000000003").PubKey()
+	activeKey := keySets[btcec.ValidateKeySet][0]
+	provisionKeys := []*btcec.PrivateKey{
+		validatorKeyProvisionKeys[0].Key,
+		validatorKeyProvisionKeys[1].Key,
+	}
+	otherKey := validatorKeyPrivKey("1337000000000000000000000000000000000000000000000000000000000004")
+
+	tests := []struct {
+		name      string
+		adminOp   byte
+		pubKey    *btcec.PublicKey
+		threadTip *wire.OutPoint
+		adminKeys []*btcec.PrivateKey
+		signed    bool
+		complete  bool
+		numKeys   int
+		errCode   btcjson.RPCErrorCode
+	}{
+		{
+			name:      "provision fully signed",
+			adminOp:   txscript.AdminOpValidateKeyAdd,
+			pubKey:    newKey,
+			threadTip: threadTip,
+			adminKeys: provisionKeys,
+			signed:    true,
+			complete:  true,
+			numKeys:   len(keySets[btcec.ValidateKeySet]) + 1,
+		},
+		{
+			name:      "provision partially signed",
+			adminOp:   txscript.AdminOpValidateKeyAdd,
+			pubKey:    newKey,
+			threadTip: threadTip,
+			adminKeys: []*btcec.PrivateKey{otherKey, provisionKeys[0]},
+			signed:    true,
+			numKeys:   len(keySets[btcec.ValidateKeySet]) + 1,
+		},
+		{
+			name:      "provision unsigned",
+			adminOp:   txscript.AdminOpValidateKeyAdd,
+			pubKey:    newKey,
+			threadTip: threadTip,
+			numKeys:   len(keySets[btcec.ValidateKeySet]) + 1,
+		},
+		{
+			name:      "revoke fully signed",
+			adminOp:   txscript.AdminOpValidateKeyRevoke,
+			pubKey:    &activeKey,
+			threadTip: threadTip,
+			adminKeys: provisionKeys,
+			signed:    true,
+			complete:  true,
+			numKeys:   len(keySets[btcec.ValidateKeySet]) - 1,
+		},
+		{
+			name:      "not an admin key holder",
+			adminOp:   txscript.AdminOpValidateKeyAdd,
+			pubKey:    newKey,
+			threadTip: threadTip,
+			adminKeys: []*btcec.PrivateKey{otherKey},
+			errCode:   btcjson.ErrRPCNotAdminKeyHolder,
+		},
+		{
+			name:      "thread tip unknown",
+			adminOp:   txscript.AdminOpValidateKeyAdd,
+			pubKey:    newKey,
+			adminKeys: provisionKeys,
+			errCode:   btcjson.ErrRPCThreadTipUnknown,
+		},
+		{
+			name:      "key already active",
+			adminOp:   txscript.AdminOpValidateKeyAdd,
+			pubKey:    &activeKey,
+			threadTip: threadTip,
+			adminKeys: provisionKeys,
+			errCode:   btcjson.ErrRPCValidatorKeyActive,
+		},
+		{
+			name:      "key not active",
+			adminOp:   txscript.AdminOpValidateKeyRevoke,
+			pubKey:    newKey,
+			threadTip: threadTip,
+			adminKeys: provisionKeys,
+			errCode:   btcjson.ErrRPCValidatorKeyInactive,
+		},
+	}
+
+	for _, test := range tests {
+		numValidateKeys := len(keySets[btcec.ValidateKeySet])
+		msgTx, complete, validateKeys, err := validatorAdminTx(params,
+			test.adminOp, test.pubKey, keySets, test.threadTip,
+			test.adminKeys)
+		if test.errCode != 0 {
+			rpcErr, ok := err.(*btcjson.RPCError)
+			if !ok || rpcErr.Code != test.errCode {
+				t.Errorf("%s: unexpected error - got %v, want "+
+					"code %d", test.name, err, test.errCode)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+
+		// The key set of the chain parameters must not be modified.
+		if len(keySets[btcec.ValidateKeySet]) != numValidateKeys {
+			t.Fatalf("%s: validate key set of the chain was modified",
+				test.name)
+		}
+		if len(validateKeys) != test.numKeys {
+			t.Errorf("%s: got %d predicted validate keys, want %d",
+				test.name, len(validateKeys), test.numKeys)
+		}
+		wantPos := -1
+		if test.adminOp == txscript.AdminOpValidateKeyAdd {
+			wantPos = len(validateKeys) - 1
+		}
+		if pos := validateKeys.Pos(test.pubKey); pos != wantPos {
+			t.Errorf("%s: predicted key position %d, want %d",
+				test.name, pos, wantPos)
+		}
+
+		if complete != test.complete {
+			t.Errorf("%s: complete %v, want %v", test.name,
+				complete, test.complete)
+		}
+		signed := len(msgTx.TxIn[0].SignatureScript) != 0
+		if signed != test.signed {
+			t.Errorf("%s: signed %v, want %v", test.name, signed,
+				test.signed)
+		}
+		if msgTx.TxIn[0].PreviousOutPoint != *threadTip {
+			t.Errorf("%s: transaction does not spend the thread tip",
+				test.name)
+		}
+
+		// Fully signed transactions must be accepted by the memory
+		// pool, partially signed ones rejected.
+		if !test.signed {
+			continue
+		}
+		txPool := newValidatorKeyMempool()
+		_, err = txPool.ProcessTransaction(provautil.NewTx(msgTx),
+			false, false, 0, 0)
+		if test.complete && err != nil {
+			t.Errorf("%s: transaction rejected: %v", test.name, err)
+		}
+		if !test.complete && err == nil {
+			t.Errorf("%s: partially signed transaction accepted",
+				test.name)
+		}
+	}
+}
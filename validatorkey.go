@@ -0,0 +1,130 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/txscript"
+	"github.com/bitgo/prova/wire"
+)
+
+// maxValidatorKeyAnnouncements is the maximum number of validator key
+// announcements which are kept around to be served to peers requesting them.
+const maxValidatorKeyAnnouncements = 1000
+
+// validatorKeyAnnouncements returns the validator key announcements describing
+// the admin operations of the passed transaction.  Only transactions on the
+// provision thread add or revoke validate and ASP keys, so no announcements
+// are returned for any other transaction.
+func validatorKeyAnnouncements(tx *provautil.Tx) []*wire.MsgValidatorKey {
+	threadInt, adminOutputs := txscript.GetAdminDetails(tx)
+	if threadInt < 0 || provautil.ThreadID(threadInt) != provautil.ProvisionThread {
+		return nil
+	}
+
+	var msgs []*wire.MsgValidatorKey
+	for _, adminOutput := range adminOutputs {
+		isAddOp, keySetType, pubKey, keyID := txscript.ExtractAdminOpData(adminOutput)
+		if pubKey == nil {
+			continue
+		}
+		switch keySetType {
+		case btcec.ValidateKeySet:
+			// Validate keys are not assigned key IDs.
+			keyID = 0
+		case btcec.ASPKeySet:
+		default:
+			continue
+		}
+
+		op := wire.ValidatorKeyRevoke
+		if isAddOp {
+			op = wire.ValidatorKeyProvision
+		}
+		var serializedKey [wire.ValidatorKeyPubKeySize]byte
+		copy(serializedKey[:], pubKey.SerializeCompressed())
+		msgs = append(msgs, wire.NewMsgValidatorKey(uint32(keyID),
+			serializedKey, op, tx.Hash()))
+	}
+	return msgs
+}
+
+// checkValidatorKey ensures the passed validator key announcement describes an
+// admin operation of the passed transaction, which it references, and that the
+// transaction is signed by the admin keys of the provision thread in the passed
+// admin key sets, which are the current ones of the chain.
+func checkValidatorKey(msg *wire.MsgValidatorKey, tx *provautil.Tx, adminKeySets map[btcec.KeySetType]btcec.PublicKeySet, sigCache *txscript.SigCache) error {
+	if !msg.TxHash.IsEqual(tx.Hash()) {
+		return fmt.Errorf("validator key announcement references "+
+			"transaction %v, not %v", msg.TxHash, tx.Hash())
+	}
+
+	found := false
+	for _, announced := range validatorKeyAnnouncements(tx) {
+		if *announced == *msg {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("transaction %v does not %v key %x with key "+
+			"id %d", tx.Hash(), msg.Op, msg.PubKey, msg.KeyID)
+	}
+
+	return blockchain.ValidateThreadSignatures(tx, provautil.ProvisionThread,
+		adminKeySets, txscript.StandardVerifyFlags, sigCache)
+}
+
+// validatorKeyCache houses the most recent validator key announcements which
+// passed the relay rules, keyed by their announcement hash, so they can be
+// served to peers requesting them and are only relayed once.  It is safe for
+// concurrent access.
+type validatorKeyCache struct {
+	mtx           sync.Mutex
+	announcements map[chainhash.Hash]*wire.MsgValidatorKey
+	order         []chainhash.Hash
+}
+
+// newValidatorKeyCache returns a new empty validator key announcement cache.
+func newValidatorKeyCache() *validatorKeyCache {
+	return &validatorKeyCache{
+		announcements: make(map[chainhash.Hash]*wire.MsgValidatorKey),
+	}
+}
+
+// Add adds the passed announcement to the cache, evicting the oldest one when
+// the cache is full.  It returns false when the announcement is already known.
+func (c *validatorKeyCache) Add(msg *wire.MsgValidatorKey) bool {
+	hash := msg.AnnouncementHash()
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if _, exists := c.announcements[hash]; exists {
+		return false
+	}
+	if len(c.order) >= maxValidatorKeyAnnouncements {
+		delete(c.announcements, c.order[0])
+		c.order = c.order[1:]
+	}
+	c.announcements[hash] = msg
+	c.order = append(c.order, hash)
+	return true
+}
+
+// Lookup returns the announcement with the passed announcement hash, or nil
+// when it is not known.
+func (c *validatorKeyCache) Lookup(hash *chainhash.Hash) *wire.MsgValidatorKey {
+	c.mtx.Lock()
+	msg := c.announcements[*hash]
+	c.mtx.Unlock()
+	return msg
+}
@@ -0,0 +1,446 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/bitgo/prova/blockchain"
+	"github.com/bitgo/prova/btcec"
+	"github.com/bitgo/prova/chaincfg"
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/bitgo/prova/connmgr"
+	"github.com/bitgo/prova/database"
+	_ "github.com/bitgo/prova/database/ffldb"
+	"github.com/bitgo/prova/mempool"
+	"github.com/bitgo/prova/peer"
+	"github.com/bitgo/prova/provautil"
+	"github.com/bitgo/prova/txscript"
+	"github.com/bitgo/prova/wire"
+)
+
+// validatorKeyPrivKey returns the private key of the passed hex encoding for
+// use in the validator key tests.
+func validatorKeyPrivKey(s string) *btcec.PrivateKey {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic("invalid hex in source file: " + s)
+	}
+	privKey, _ := btcec.PrivKeyFromBytes(btcec.S256(), b)
+	return privKey
+}
+
+var (
+	// validatorKeyProvisionKeys are the private keys of the provision key
+	// set of the regression test network.
+	validatorKeyProvisionKeys = []txscript.PrivateKey{
+		{Key: validatorKeyPrivKey("f954b388f5db3a1d2915cda434206d791b47cf3d4e78cc32fbeb77ea25d20d7d"), Compressed: true},
+		{Key: validatorKeyPrivKey("627f6f1d5d8f38bd60b6aaea2f74c72917deffcc2a5a64f67d3e0a28a2d711c1"), Compressed: true},
+	}
+
+	// validatorKeyThreadTip is the tip of the provision thread the test
+	// admin transactions spend.
+	validatorKeyThreadTip = func() *provautil.Tx {
+		threadScript, _ := txscript.ProvaThreadScript(provautil.ProvisionThread)
+		msgTx := wire.NewMsgTx(1)
+		msgTx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{0x01},
+			0), nil))
+		msgTx.AddTxOut(wire.NewTxOut(0, threadScript))
+		return provautil.NewTx(msgTx)
+	}()
+)
+
+// newValidatorKeyTx returns an admin transaction which adds the passed
+// validate key on the provision thread, signed with the passed keys.
+func newValidatorKeyTx(t *testing.T, pubKey *btcec.PublicKey, signKeys []txscript.PrivateKey) *provautil.Tx {
+	threadScript, err := txscript.ProvaThreadScript(provautil.ProvisionThread)
+	if err != nil {
+		t.Fatalf("unable to create thread script: %v", err)
+	}
+	data := append([]byte{txscript.AdminOpValidateKeyAdd},
+		pubKey.SerializeCompressed()...)
+	adminScript, err := txscript.NullDataScript(data)
+	if err != nil {
+		t.Fatalf("unable to create admin script: %v", err)
+	}
+
+	msgTx := wire.NewMsgTx(1)
+	msgTx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(validatorKeyThreadTip.Hash(),
+		0), nil))
+	msgTx.AddTxOut(wire.NewTxOut(0, threadScript))
+	msgTx.AddTxOut(wire.NewTxOut(0, adminScript))
+
+	lookupKey := func(provautil.Address) ([]txscript.PrivateKey, error) {
+		return signKeys, nil
+	}
+	sigScript, err := txscript.SignTxOutput(&chaincfg.RegressionNetParams,
+		msgTx, 0, 0, threadScript, txscript.SigHashAll,
+		txscript.KeyClosure(lookupKey), nil)
+	if err != nil {
+		t.Fatalf("unable to sign admin transaction: %v", err)
+	}
+	msgTx.TxIn[0].SignatureScript = sigScript
+	return provautil.NewTx(msgTx)
+}
+
+// newValidatorKeyMempool returns a memory pool on top of a fake chain whose
+// provision thread tip is validatorKeyThreadTip.
+func newValidatorKeyMempool() *mempool.TxPool {
+	params := &chaincfg.RegressionNetParams
+	return mempool.New(&mempool.Config{
+		Policy: mempool.Policy{
+			DisableRelayPriority: true,
+			MaxSigOpsPerTx:       blockchain.MaxSigOpsPerBlock / 5,
+			MinRelayTxFee:        1000,
+			MaxTxVersion:         1,
+		},
+		ChainParams: params,
+		FetchUtxoView: func(*provautil.Tx) (*blockchain.UtxoViewpoint, error) {
+			view := blockchain.NewUtxoViewpoint()
+			view.AddTxOuts(validatorKeyThreadTip, 1)
+			return view, nil
+		},
+		ThreadTips: func() map[provautil.ThreadID]*wire.OutPoint {
+			return map[provautil.ThreadID]*wire.OutPoint{
+				provautil.ProvisionThread: wire.NewOutPoint(
+					validatorKeyThreadTip.Hash(), 0),
+			}
+		},
+		LastKeyID:   func() btcec.KeyID { return 0 },
+		TotalSupply: func() uint64 { return 0 },
+		GetKeyIDs:   func() btcec.KeyIdMap { return make(btcec.KeyIdMap) },
+		GetAdminKeySets: func() map[btcec.KeySetType]btcec.PublicKeySet {
+			return params.AdminKeySets
+		},
+		BestHeight:        func() uint32 { return 1 },
+		MedianTimePast:    time.Now,
+		LockTimeEvalTime:  time.Now,
+		TimeLockFlags:     func() txscript.ScriptFlags { return 0 },
+		VerificationFlags: func() txscript.ScriptFlags { return 0 },
+		CalcSequenceLock: func(*provautil.Tx, *blockchain.UtxoViewpoint) (*blockchain.SequenceLock, error) {
+			return &blockchain.SequenceLock{Seconds: -1, BlockHeight: -1}, nil
+		},
+		HashCache:  txscript.NewHashCache(10),
+		TimeSource: blockchain.NewMedianTime(),
+	})
+}
+
+// newValidatorKeyChain returns a chain instance of the regression test network
+// whose admin state the validator key announcements are checked against, along
+// with a function which removes it.
+func newValidatorKeyChain(t *testing.T) (*blockchain.BlockChain, func()) {
+	dir, err := ioutil.TempDir("", "validatorkey")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v", err)
+	}
+	db, err := database.Create("ffldb", dir, wire.RegNet)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("unable to create database: %v", err)
+	}
+	teardown := func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+	chain, err := blockchain.New(&blockchain.Config{
+		DB:          db,
+		ChainParams: &chaincfg.RegressionNetParams,
+		TimeSource:  blockchain.NewMedianTime(),
+		SigCache:    txscript.NewSigCache(1000),
+	})
+	if err != nil {
+		teardown()
+		t.Fatalf("failed to create chain instance: %v", err)
+	}
+	return chain, teardown
+}
+
+// validatorKeyNode houses a server of the validator key relay harness along
+// with the peers it is connected to.
+type validatorKeyNode struct {
+	s     *server
+	state *peerState
+	peers []*serverPeer
+	quit  chan struct{}
+}
+
+// newValidatorKeyNode returns a node of the validator key relay harness which
+// advertises the passed services and follows the passed chain.
+func newValidatorKeyNode(services wire.ServiceFlag, chain *blockchain.BlockChain) *validatorKeyNode {
+	return &validatorKeyNode{
+		s: &server{
+			chainParams:   &chaincfg.RegressionNetParams,
+			blockManager:  &blockManager{chain: chain},
+			txMemPool:     newValidatorKeyMempool(),
+			relayInv:      make(chan relayMsg, 10),
+			banPeers:      make(chan *serverPeer, 10),
+			services:      services,
+			validatorKeys: newValidatorKeyCache(),
+			banManager:    connmgr.NewBanManager(""),
+		},
+		state: &peerState{
+			inboundPeers:    make(map[int32]*serverPeer),
+			outboundPeers:   make(map[int32]*serverPeer),
+			persistentPeers: make(map[int32]*serverPeer),
+		},
+		quit: make(chan struct{}),
+	}
+}
+
+// newPeer returns a server peer of the node which handles the messages
+// involved in validator key relay.
+func (n *validatorKeyNode) newPeer() (*serverPeer, *peer.Config) {
+	sp := newServerPeer(n.s, false)
+	return sp, &peer.Config{
+		Listeners: peer.MessageListeners{
+			OnInv:          sp.OnInv,
+			OnGetData:      sp.OnGetData,
+			OnValidatorKey: sp.OnValidatorKey,
+		},
+		ChainParams: n.s.chainParams,
+		Services:    n.s.services,
+	}
+}
+
+// connect connects the node to the passed node and returns the server peer of
+// each node for the other one.
+func (n *validatorKeyNode) connect(t *testing.T, other *validatorKeyNode) (*serverPeer, *serverPeer) {
+	out, outCfg := n.newPeer()
+	in, inCfg := other.newPeer()
+	var err error
+	out.Peer, err = peer.NewOutboundPeer(outCfg, "10.0.0.2:18444")
+	if err != nil {
+		t.Fatalf("unable to create outbound peer: %v", err)
+	}
+	in.Peer = peer.NewInboundPeer(inCfg)
+
+	// The peers are connected through a link which alters the nonce of
+	// their version messages, since they would otherwise detect a
+	// connection to themselves.
+	outConn, outLink := newPipeConns()
+	inLink, inConn := newPipeConns()
+	go forwardMessages(outLink, inLink)
+	go forwardMessages(inLink, outLink)
+	out.AssociateConnection(outConn)
+	in.AssociateConnection(inConn)
+
+	// Wait for the handshake so the services of the peers are known.
+	deadline := time.Now().Add(5 * time.Second)
+	for !out.VerAckReceived() || !in.VerAckReceived() {
+		if time.Now().After(deadline) {
+			t.Fatalf("handshake between the nodes timed out")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	n.state.outboundPeers[out.ID()] = out
+	other.state.inboundPeers[in.ID()] = in
+	n.peers = append(n.peers, out)
+	other.peers = append(other.peers, in)
+	return out, in
+}
+
+// forwardMessages forwards the messages read from src to dst until either
+// connection is closed.  The nonce of version messages is changed on the way.
+func forwardMessages(src, dst *pipeConn) {
+	net := chaincfg.RegressionNetParams.Net
+	for {
+		msg, _, err := wire.ReadMessage(src, wire.ProtocolVersion, net)
+		if err != nil {
+			return
+		}
+		if msgVersion, ok := msg.(*wire.MsgVersion); ok {
+			msgVersion.Nonce++
+		}
+		err = wire.WriteMessage(dst, msg, wire.ProtocolVersion, net)
+		if err != nil {
+			return
+		}
+	}
+}
+
+// start starts relaying the inventory of the node to its peers.
+func (n *validatorKeyNode) start() {
+	go func() {
+		for {
+			select {
+			case msg := <-n.s.relayInv:
+				n.s.handleRelayInvMsg(n.state, msg)
+			case <-n.quit:
+				return
+			}
+		}
+	}()
+}
+
+// stop disconnects the peers of the node and stops relaying inventory.
+func (n *validatorKeyNode) stop() {
+	close(n.quit)
+	for _, sp := range n.peers {
+		sp.Disconnect()
+	}
+}
+
+// waitValidatorKey waits for the passed announcement to be known to the node.
+func (n *validatorKeyNode) waitValidatorKey(hash *chainhash.Hash) bool {
+	deadline := time.Now().Add(5 * time.Second)
+	for n.s.validatorKeys.Lookup(hash) == nil {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return true
+}
+
+// TestValidatorKeyRelay ensures validator key announcements are relayed across
+// a chain of three nodes when the referenced transaction is known and signed
+// by the provision keys, and that invalid announcements are not relayed.
+func TestValidatorKeyRelay(t *testing.T) {
+	// The server peers read the ban settings from the configuration.  It is
+	// left in place since the peers may still be shutting down once the test
+	// returns.
+	if cfg == nil {
+		cfg = &config{BanThreshold: defaultBanThreshold}
+	}
+
+	// Connect the nodes as a -> b -> c.  They share the chain since they
+	// only read its admin state.
+	chain, teardown := newValidatorKeyChain(t)
+	defer teardown()
+	a := newValidatorKeyNode(defaultServices, chain)
+	b := newValidatorKeyNode(defaultServices, chain)
+	c := newValidatorKeyNode(defaultServices, chain)
+	aToB, bFromA := a.connect(t, b)
+	b.connect(t, c)
+	for _, n := range []*validatorKeyNode{a, b, c} {
+		n.start()
+		defer n.stop()
+	}
+
+	// The provisioning transaction is known to all nodes.
+	validateKey := validatorKeyPrivKey("1337000000000000000000000000000000000000000000000000000000000001")
+	tx := newValidatorKeyTx(t, validateKey.PubKey(), validatorKeyProvisionKeys)
+	for _, n := range []*validatorKeyNode{a, b, c} {
+		_, _, err := n.s.txMemPool.MaybeAcceptTransaction(tx, true, false)
+		if err != nil {
+			t.Fatalf("unable to accept provisioning transaction: %v",
+				err)
+		}
+	}
+
+	// Node a announces the key it has seen being provisioned.
+	msgs := validatorKeyAnnouncements(tx)
+	if len(msgs) != 1 {
+		t.Fatalf("got %d announcements for the provisioning "+
+			"transaction, want 1", len(msgs))
+	}
+	msg := msgs[0]
+	if msg.Op != wire.ValidatorKeyProvision || msg.KeyID != 0 ||
+		!msg.TxHash.IsEqual(tx.Hash()) {
+
+		t.Fatalf("unexpected announcement %v of key %x with key id %d "+
+			"by %v", msg.Op, msg.PubKey, msg.KeyID, msg.TxHash)
+	}
+	a.s.announceValidatorKeys(tx)
+
+	hash := msg.AnnouncementHash()
+	if !b.waitValidatorKey(&hash) {
+		t.Fatalf("announcement was not relayed to the second node")
+	}
+	if !c.waitValidatorKey(&hash) {
+		t.Fatalf("announcement was not relayed to the third node")
+	}
+
+	// An announcement of a transaction no node knows about is ignored.
+	unknown := *msg
+	unknown.TxHash = chainhash.Hash{0x02}
+	aToB.QueueMessage(&unknown, nil)
+
+	// An announcement which does not match the referenced transaction is
+	// not relayed and is treated as minor misbehavior which does not get
+	// the peer banned.
+	mismatched := *msg
+	mismatched.Op = wire.ValidatorKeyRevoke
+	aToB.QueueMessage(&mismatched, nil)
+	deadline := time.Now().Add(5 * time.Second)
+	for b.s.banManager.Score(bFromA.host()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("ban score of the peer announcing a mismatched " +
+				"key was not increased")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if score := b.s.banManager.Score(bFromA.host()); score > banScore(offenseValidatorKey) {
+		t.Fatalf("ban score of the peer announcing a mismatched key "+
+			"is %d, want at most %d", score,
+			banScore(offenseValidatorKey))
+	}
+	if !bFromA.Connected() {
+		t.Fatalf("peer announcing a mismatched key was disconnected")
+	}
+	for _, invalid := range []wire.MsgValidatorKey{unknown, mismatched} {
+		hash := invalid.AnnouncementHash()
+		if b.s.validatorKeys.Lookup(&hash) != nil ||
+			c.s.validatorKeys.Lookup(&hash) != nil {
+
+			t.Fatalf("invalid announcement %v of transaction %v was "+
+				"relayed", invalid.Op, invalid.TxHash)
+		}
+	}
+}
+
+// TestValidatorKeySignatures ensures announcements are only accepted when the
+// referenced transaction is signed by the provision keys of the chain
+// parameters.
+func TestValidatorKeySignatures(t *testing.T) {
+	params := &chaincfg.RegressionNetParams
+	validateKey := validatorKeyPrivKey("1337000000000000000000000000000000000000000000000000000000000002")
+
+	tx := newValidatorKeyTx(t, validateKey.PubKey(), validatorKeyProvisionKeys)
+	msg := validatorKeyAnnouncements(tx)[0]
+	if err := checkValidatorKey(msg, tx, params.AdminKeySets, nil); err != nil {
+		t.Fatalf("checkValidatorKey: unexpected error %v", err)
+	}
+
+	// A transaction signed by keys which are not provision keys is
+	// rejected.
+	otherKeys := []txscript.PrivateKey{
+		{Key: validateKey, Compressed: true},
+		validatorKeyProvisionKeys[0],
+	}
+	forged := newValidatorKeyTx(t, validateKey.PubKey(), otherKeys)
+	msg = validatorKeyAnnouncements(forged)[0]
+	if err := checkValidatorKey(msg, forged, params.AdminKeySets, nil); err == nil {
+		t.Fatalf("checkValidatorKey: forged transaction accepted")
+	}
+
+	// A transaction signed by provision keys which the chain no longer has
+	// in its admin state is rejected.
+	adminKeySets := make(map[btcec.KeySetType]btcec.PublicKeySet)
+	for keySetType, keySet := range params.AdminKeySets {
+		adminKeySets[keySetType] = keySet
+	}
+	adminKeySets[btcec.ProvisionKeySet] = btcec.PublicKeySet{
+		*validateKey.PubKey(),
+		*validatorKeyProvisionKeys[1].Key.PubKey(),
+	}
+	msg = validatorKeyAnnouncements(tx)[0]
+	if err := checkValidatorKey(msg, tx, adminKeySets, nil); err == nil {
+		t.Fatalf("checkValidatorKey: transaction signed by revoked " +
+			"provision keys accepted")
+	}
+
+	// Transactions which are not on the provision thread do not announce
+	// any keys.
+	if msgs := validatorKeyAnnouncements(validatorKeyThreadTip); len(msgs) != 0 {
+		t.Fatalf("got %d announcements for a transaction without "+
+			"admin operations", len(msgs))
+	}
+}
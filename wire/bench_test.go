@@ -338,12 +338,35 @@ func BenchmarkDeserializeTxLarge(b *testing.B) {
 // a transaction.
 func BenchmarkSerializeTx(b *testing.B) {
 	tx := blockOne.Transactions[0]
+	b.ReportAllocs()
 	for i := 0; i < b.N; i++ {
 		tx.Serialize(ioutil.Discard)
 
 	}
 }
 
+// BenchmarkSerializeTxBuf performs a benchmark on how long it takes to
+// serialize a transaction into a reused buffer.
+func BenchmarkSerializeTxBuf(b *testing.B) {
+	tx := blockOne.Transactions[0]
+	buf := make([]byte, 0, tx.SerializeSize())
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf = tx.SerializeBuf(buf[:0])
+	}
+}
+
+// BenchmarkWriteMessageTx performs a benchmark on how long it takes to write a
+// tx message including its header.
+func BenchmarkWriteMessageTx(b *testing.B) {
+	tx := blockOne.Transactions[0]
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		WriteMessageN(ioutil.Discard, tx, ProtocolVersion, MainNet)
+	}
+}
+
 // BenchmarkReadBlockHeader performs a benchmark on how long it takes to
 // deserialize a block header.
 func BenchmarkReadBlockHeader(b *testing.B) {
@@ -374,11 +397,24 @@ func BenchmarkReadBlockHeader(b *testing.B) {
 // serialize a block header.
 func BenchmarkWriteBlockHeader(b *testing.B) {
 	header := blockOne.Header
+	b.ReportAllocs()
 	for i := 0; i < b.N; i++ {
 		writeBlockHeader(ioutil.Discard, 0, &header)
 	}
 }
 
+// BenchmarkWriteBlockHeaderBuf performs a benchmark on how long it takes to
+// serialize a block header into a reused buffer.
+func BenchmarkWriteBlockHeaderBuf(b *testing.B) {
+	header := blockOne.Header
+	buf := make([]byte, 0, MaxBlockHeaderPayload)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf = header.SerializeBuf(buf[:0])
+	}
+}
+
 // BenchmarkDecodeGetHeaders performs a benchmark on how long it takes to
 // decode a getheaders message with the maximum number of block locator hashes.
 func BenchmarkDecodeGetHeaders(b *testing.B) {
@@ -597,6 +633,7 @@ func BenchmarkDecodeMerkleBlock(b *testing.B) {
 // BenchmarkTxHash performs a benchmark on how long it takes to hash a
 // transaction.
 func BenchmarkTxHash(b *testing.B) {
+	b.ReportAllocs()
 	for i := 0; i < b.N; i++ {
 		genesisCoinbaseTx.TxHash()
 	}
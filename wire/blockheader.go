@@ -90,10 +90,11 @@ func (h *BlockHeader) BlockHash() chainhash.Hash {
 	// transactions.  Ignore the error returns since there is no way the
 	// encode could fail except being out of memory which would cause a
 	// run-time panic.
-	buf := bytes.NewBuffer(make([]byte, 0, MaxBlockHeaderPayload))
-	_ = writeBlockHeader(buf, 0, h)
-
-	return chainhash.PowHashH(buf.Bytes())
+	buf := borrowEncodeBuf()
+	*buf = h.SerializeBuf(*buf)
+	hash := chainhash.PowHashH(*buf)
+	returnEncodeBuf(buf)
+	return hash
 }
 
 // BtcDecode decodes r using the bitcoin protocol encoding into the receiver.
@@ -112,6 +113,14 @@ func (h *BlockHeader) BtcEncode(w io.Writer, pver uint32) error {
 	return writeBlockHeader(w, pver, h)
 }
 
+// BtcEncodeBuf appends the bitcoin protocol encoding of the block header to buf
+// and returns the extended buffer, in the same way as the built-in append.  It
+// produces the same bytes as BtcEncode, but does not allocate when buf has
+// room for MaxBlockHeaderPayload more bytes.
+func (h *BlockHeader) BtcEncodeBuf(buf []byte, pver uint32) []byte {
+	return appendBlockHeader(buf, pver, h)
+}
+
 // Deserialize decodes a block header from r into the receiver using a format
 // that is suitable for long-term storage such as a database while respecting
 // the Version field.
@@ -132,6 +141,13 @@ func (h *BlockHeader) Serialize(w io.Writer) error {
 	return writeBlockHeader(w, 0, h)
 }
 
+// SerializeBuf appends the serialized block header to buf and returns the
+// extended buffer.  It produces the same bytes as Serialize.  See BtcEncodeBuf
+// for details.
+func (h *BlockHeader) SerializeBuf(buf []byte) []byte {
+	return appendBlockHeader(buf, 0, h)
+}
+
 // hashForSigning gets the double SHA256 hash of (Version|Timestamp|PrevBlock|MerkleRoot)
 // which is used for the validator's signature.
 func (h *BlockHeader) hashForSigning() []byte {
@@ -219,3 +235,19 @@ func writeBlockHeader(w io.Writer, pver uint32, bh *BlockHeader) error {
 	return writeElements(w, bh.Version, &bh.PrevBlock, &bh.MerkleRoot,
 		bh.Timestamp.Unix(), bh.Bits, bh.Height, bh.Size, bh.Nonce, bh.ValidatingPubKey, bh.Signature)
 }
+
+// appendBlockHeader appends the encoding of a bitcoin block header to buf and
+// returns the extended buffer.  The encoding is the same as the one of
+// writeBlockHeader.
+func appendBlockHeader(buf []byte, pver uint32, bh *BlockHeader) []byte {
+	buf = appendUint32(buf, bh.Version)
+	buf = append(buf, bh.PrevBlock[:]...)
+	buf = append(buf, bh.MerkleRoot[:]...)
+	buf = appendUint64(buf, uint64(bh.Timestamp.Unix()))
+	buf = appendUint32(buf, bh.Bits)
+	buf = appendUint32(buf, bh.Height)
+	buf = appendUint32(buf, bh.Size)
+	buf = appendUint64(buf, bh.Nonce)
+	buf = append(buf, bh.ValidatingPubKey[:]...)
+	return append(buf, bh.Signature[:]...)
+}
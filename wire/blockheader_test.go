@@ -287,3 +287,38 @@ func TestBlockHeaderSerialize(t *testing.T) {
 		}
 	}
 }
+
+// TestBlockHeaderSerializeBuf ensures the buffer based encoding of block
+// headers produces the same bytes as the writer based encoding and appends to
+// the passed buffer without allocating.
+func TestBlockHeaderSerializeBuf(t *testing.T) {
+	headers := []*BlockHeader{&blockOne.Header, &BlockHeader{}}
+
+	t.Logf("Running %d tests", len(headers))
+	for i, header := range headers {
+		var want bytes.Buffer
+		if err := header.Serialize(&want); err != nil {
+			t.Errorf("Serialize #%d error %v", i, err)
+			continue
+		}
+
+		got := header.SerializeBuf([]byte{0x01})
+		if got[0] != 0x01 || !bytes.Equal(got[1:], want.Bytes()) {
+			t.Errorf("SerializeBuf #%d\n got: %s want: %s", i,
+				spew.Sdump(got), spew.Sdump(want.Bytes()))
+		}
+		got = header.BtcEncodeBuf(nil, ProtocolVersion)
+		if !bytes.Equal(got, want.Bytes()) {
+			t.Errorf("BtcEncodeBuf #%d\n got: %s want: %s", i,
+				spew.Sdump(got), spew.Sdump(want.Bytes()))
+		}
+	}
+
+	buf := make([]byte, 0, MaxBlockHeaderPayload)
+	allocs := testing.AllocsPerRun(100, func() {
+		buf = blockOne.Header.SerializeBuf(buf[:0])
+	})
+	if allocs != 0 {
+		t.Errorf("SerializeBuf: got %v allocations, want 0", allocs)
+	}
+}
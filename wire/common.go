@@ -11,6 +11,7 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"sync"
 	"time"
 
 	"github.com/bitgo/prova/chaincfg/chainhash"
@@ -23,6 +24,15 @@ const (
 	// binaryFreeListMaxItems is the number of buffers to keep in the free
 	// list to use for binary serialization and deserialization.
 	binaryFreeListMaxItems = 1024
+
+	// defaultEncodeBufSize is the initial capacity of the buffers in the
+	// encode buffer pool.  It is large enough for typical transactions.
+	defaultEncodeBufSize = 1024
+
+	// maxEncodeBufSize is the maximum capacity of a buffer which is returned
+	// to the encode buffer pool, so the occasional large transaction does
+	// not keep a large buffer around.
+	maxEncodeBufSize = 1 << 20
 )
 
 var (
@@ -172,6 +182,49 @@ func (l binaryFreeList) PutUint64(w io.Writer, byteOrder binary.ByteOrder, val u
 // deserializing primitive integer values to and from io.Readers and io.Writers.
 var binarySerializer binaryFreeList = make(chan []byte, binaryFreeListMaxItems)
 
+// encodeBufPool houses buffers to append the encodings of transactions and
+// messages to when they are only needed temporarily, such as for hashing or
+// writing them to a connection, in order to avoid allocating a new buffer for
+// every encoding.
+var encodeBufPool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, 0, defaultEncodeBufSize)
+		return &buf
+	},
+}
+
+// borrowEncodeBuf returns an empty buffer from the encode buffer pool.  It must
+// be returned with returnEncodeBuf once it is no longer used.
+func borrowEncodeBuf() *[]byte {
+	buf := encodeBufPool.Get().(*[]byte)
+	*buf = (*buf)[:0]
+	return buf
+}
+
+// returnEncodeBuf returns the passed buffer, which might have been grown while
+// it was used, to the encode buffer pool.
+func returnEncodeBuf(buf *[]byte) {
+	if cap(*buf) > maxEncodeBufSize {
+		return
+	}
+	encodeBufPool.Put(buf)
+}
+
+// appendUint32 appends the little endian encoding of val to buf and returns
+// the extended buffer.
+func appendUint32(buf []byte, val uint32) []byte {
+	return append(buf, byte(val), byte(val>>8), byte(val>>16),
+		byte(val>>24))
+}
+
+// appendUint64 appends the little endian encoding of val to buf and returns
+// the extended buffer.
+func appendUint64(buf []byte, val uint64) []byte {
+	return append(buf, byte(val), byte(val>>8), byte(val>>16),
+		byte(val>>24), byte(val>>32), byte(val>>40), byte(val>>48),
+		byte(val>>56))
+}
+
 // errNonCanonicalVarInt is the common format string used for non-canonically
 // encoded variable length integer errors.
 var errNonCanonicalVarInt = "non-canonical varint %x - discriminant %x must " +
@@ -488,6 +541,9 @@ func writeElements(w io.Writer, elements ...interface{}) error {
 }
 
 // ReadVarInt reads a variable length integer from r and returns it as a uint64.
+// Encodings which are not canonical, meaning the value could have been
+// encoded with fewer bytes, are always rejected so the serialization of
+// transactions and blocks can not be malleated.
 func ReadVarInt(r io.Reader, pver uint32) (uint64, error) {
 	discriminant, err := binarySerializer.Uint8(r)
 	if err != nil {
@@ -578,6 +634,23 @@ func WriteVarInt(w io.Writer, pver uint32, val uint64) error {
 	return binarySerializer.PutUint64(w, littleEndian, val)
 }
 
+// appendVarInt appends val to buf using the same variable length encoding as
+// WriteVarInt and returns the extended buffer.
+func appendVarInt(buf []byte, val uint64) []byte {
+	switch {
+	case val < 0xfd:
+		return append(buf, uint8(val))
+
+	case val <= math.MaxUint16:
+		return append(buf, 0xfd, byte(val), byte(val>>8))
+
+	case val <= math.MaxUint32:
+		return appendUint32(append(buf, 0xfe), uint32(val))
+	}
+
+	return appendUint64(append(buf, 0xff), val)
+}
+
 // VarIntSerializeSize returns the number of bytes it would take to serialize
 // val as a variable length integer.
 func VarIntSerializeSize(val uint64) int {
@@ -687,6 +760,13 @@ func WriteVarBytes(w io.Writer, pver uint32, bytes []byte) error {
 	return err
 }
 
+// appendVarBytes appends bytes to buf using the same encoding as WriteVarBytes
+// and returns the extended buffer.
+func appendVarBytes(buf []byte, bytes []byte) []byte {
+	buf = appendVarInt(buf, uint64(len(bytes)))
+	return append(buf, bytes...)
+}
+
 // randomUint64 returns a cryptographically random uint64 value.  This
 // unexported version takes a reader primarily to ensure the error paths
 // can be properly tested by passing a fake reader in the tests.
@@ -146,7 +146,17 @@ Errors returned by this package are either the raw errors provided by underlying
 calls to read/write from streams such as io.EOF, io.ErrUnexpectedEOF, and
 io.ErrShortWrite, or of type wire.MessageError.  This allows the caller to
 differentiate between general IO errors and malformed messages through type
-assertions.
+assertions.  Messages which exceed one of the configurable message limits are
+reported with the Limit field of the MessageError set to the exceeded limit.
+
+Message Limits
+
+The maximum number of block headers, inventory vectors and addresses per
+message, as well as the maximum block size, default to the limits of the
+reference implementation.  Private networks with larger blocks can raise them
+with SetMessageLimits before connecting to any peers.  The element counts of
+all messages are checked against the current limits before any memory is
+allocated for the elements.
 
 Bitcoin Improvement Proposals
 
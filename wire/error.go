@@ -15,10 +15,12 @@ import (
 //
 // This provides a mechanism for the caller to type assert the error to
 // differentiate between general io errors such as io.EOF and issues that
-// resulted from malformed messages.
+// resulted from malformed messages.  Errors caused by exceeding one of the
+// MessageLimits identify the limit with the Limit field.
 type MessageError struct {
-	Func        string // Function name
-	Description string // Human readable description of the issue
+	Func        string       // Function name
+	Description string       // Human readable description of the issue
+	Limit       MessageLimit // Exceeded limit, LimitNone if not applicable
 }
 
 // Error satisfies the error interface and prints human-readable errors.
@@ -0,0 +1,85 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// This file is ignored by Go versions without native fuzzing due to the
+// following build tag.
+// +build go1.18
+
+package wire
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/bitgo/prova/chaincfg/chainhash"
+)
+
+// fuzzMessage decodes the fuzzed payloads into messages created by newMsg.
+// Payloads which decode without error must encode again, and decoding must
+// never panic nor allocate more elements than the message limits allow.  The
+// encodings of the passed seed messages are added to the corpus.
+func fuzzMessage(f *testing.F, newMsg func() Message, seeds ...Message) {
+	pver := ProtocolVersion
+	for _, seed := range seeds {
+		var buf bytes.Buffer
+		if err := seed.BtcEncode(&buf, pver); err != nil {
+			f.Fatalf("BtcEncode: unexpected error %v", err)
+		}
+		f.Add(buf.Bytes())
+	}
+
+	f.Fuzz(func(t *testing.T, payload []byte) {
+		if uint32(len(payload)) > newMsg().MaxPayloadLength(pver) {
+			return
+		}
+
+		msg := newMsg()
+		if err := msg.BtcDecode(bytes.NewReader(payload), pver); err != nil {
+			return
+		}
+		var buf bytes.Buffer
+		if err := msg.BtcEncode(&buf, pver); err != nil {
+			t.Fatalf("BtcEncode: decoded message failed to encode: %v",
+				err)
+		}
+	})
+}
+
+// FuzzMsgHeaders fuzzes the MsgHeaders decoder.
+func FuzzMsgHeaders(f *testing.F) {
+	seed := NewMsgHeaders()
+	seed.AddBlockHeader(&blockOne.Header)
+	fuzzMessage(f, func() Message { return &MsgHeaders{} }, NewMsgHeaders(),
+		seed)
+}
+
+// FuzzMsgInv fuzzes the MsgInv decoder.
+func FuzzMsgInv(f *testing.F) {
+	seed := NewMsgInv()
+	seed.AddInvVect(NewInvVect(InvTypeBlock, &chainhash.Hash{0x01}))
+	seed.AddInvVect(NewInvVect(InvTypeTx, &chainhash.Hash{0x02}))
+	fuzzMessage(f, func() Message { return &MsgInv{} }, NewMsgInv(), seed)
+}
+
+// FuzzMsgGetData fuzzes the MsgGetData decoder.
+func FuzzMsgGetData(f *testing.F) {
+	seed := NewMsgGetData()
+	seed.AddInvVect(NewInvVect(InvTypeBlock, &chainhash.Hash{0x01}))
+	fuzzMessage(f, func() Message { return &MsgGetData{} }, NewMsgGetData(),
+		seed)
+}
+
+// FuzzMsgAddr fuzzes the MsgAddr decoder.
+func FuzzMsgAddr(f *testing.F) {
+	seed := NewMsgAddr()
+	seed.AddAddress(NewNetAddressIPPort(net.ParseIP("127.0.0.1"), 8333,
+		SFNodeNetwork))
+	fuzzMessage(f, func() Message { return &MsgAddr{} }, NewMsgAddr(), seed)
+}
+
+// FuzzMsgBlock fuzzes the MsgBlock decoder.
+func FuzzMsgBlock(f *testing.F) {
+	fuzzMessage(f, func() Message { return &MsgBlock{} }, &blockOne)
+}
@@ -30,6 +30,8 @@ const (
 	InvTypeTx            InvType = 1
 	InvTypeBlock         InvType = 2
 	InvTypeFilteredBlock InvType = 3
+	InvTypeCmpctBlock    InvType = 4
+	InvTypeValidatorKey  InvType = 5
 )
 
 // Map of service flags back to their constant names for pretty printing.
@@ -38,6 +40,8 @@ var ivStrings = map[InvType]string{
 	InvTypeTx:            "MSG_TX",
 	InvTypeBlock:         "MSG_BLOCK",
 	InvTypeFilteredBlock: "MSG_FILTERED_BLOCK",
+	InvTypeCmpctBlock:    "MSG_CMPCT_BLOCK",
+	InvTypeValidatorKey:  "MSG_VALIDATOR_KEY",
 }
 
 // String returns the InvType in human-readable form.
@@ -23,6 +23,8 @@ func TestInvTypeStringer(t *testing.T) {
 		{InvTypeError, "ERROR"},
 		{InvTypeTx, "MSG_TX"},
 		{InvTypeBlock, "MSG_BLOCK"},
+		{InvTypeCmpctBlock, "MSG_CMPCT_BLOCK"},
+		{InvTypeValidatorKey, "MSG_VALIDATOR_KEY"},
 		{0xffffffff, "Unknown InvType (4294967295)"},
 	}
 
@@ -0,0 +1,172 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"fmt"
+)
+
+// MessageLimit identifies the limit of MessageLimits a message exceeded.
+type MessageLimit uint8
+
+// These constants define the limits a message can exceed.  See MessageLimits
+// for details.
+const (
+	// LimitNone indicates an error was not caused by exceeding a limit.
+	LimitNone MessageLimit = iota
+
+	// LimitBlockHeadersPerMsg indicates a headers message had more block
+	// headers than MessageLimits.MaxBlockHeadersPerMsg.
+	LimitBlockHeadersPerMsg
+
+	// LimitInvPerMsg indicates an inv, getdata or notfound message had more
+	// inventory vectors than MessageLimits.MaxInvPerMsg.
+	LimitInvPerMsg
+
+	// LimitAddrPerMsg indicates an addr or addrv2 message had more
+	// addresses than MessageLimits.MaxAddrPerMsg.
+	LimitAddrPerMsg
+
+	// LimitTxPerBlock indicates a message had more transactions than could
+	// possibly fit into a block of MessageLimits.MaxBlockPayload bytes.
+	LimitTxPerBlock
+
+	// LimitBlockPayload indicates a block message, or a message which is
+	// bounded by the size of a block, was larger than
+	// MessageLimits.MaxBlockPayload bytes.
+	LimitBlockPayload
+)
+
+// Map of message limits back to their constant names for pretty printing.
+var messageLimitStrings = map[MessageLimit]string{
+	LimitNone:               "LimitNone",
+	LimitBlockHeadersPerMsg: "LimitBlockHeadersPerMsg",
+	LimitInvPerMsg:          "LimitInvPerMsg",
+	LimitAddrPerMsg:         "LimitAddrPerMsg",
+	LimitTxPerBlock:         "LimitTxPerBlock",
+	LimitBlockPayload:       "LimitBlockPayload",
+}
+
+// String returns the MessageLimit in human-readable form.
+func (l MessageLimit) String() string {
+	if s, ok := messageLimitStrings[l]; ok {
+		return s
+	}
+	return fmt.Sprintf("Unknown MessageLimit (%d)", uint8(l))
+}
+
+// MessageLimits houses the maximum element counts and sizes which are enforced
+// when encoding and decoding messages.  The counts are checked before any
+// memory is allocated for the elements, so a peer can not force large
+// allocations by announcing more elements than it sends.
+//
+// The defaults match the limits of the reference implementation.  Private
+// networks can raise the element counts with SetMessageLimits, although every
+// message must still fit into MaxMessagePayload bytes.  MaxBlockPayload must
+// match the block size limit of the consensus rules the messages are relayed
+// under, since valid blocks could not be relayed otherwise.
+type MessageLimits struct {
+	// MaxBlockHeadersPerMsg is the maximum number of block headers in a
+	// headers message.
+	MaxBlockHeadersPerMsg uint32
+
+	// MaxInvPerMsg is the maximum number of inventory vectors in an inv,
+	// getdata or notfound message.
+	MaxInvPerMsg uint32
+
+	// MaxAddrPerMsg is the maximum number of addresses in an addr or
+	// addrv2 message.
+	MaxAddrPerMsg uint32
+
+	// MaxBlockPayload is the maximum size of a block message in bytes.  It
+	// also bounds the number of transactions of messages which describe
+	// the transactions of a block.
+	MaxBlockPayload uint32
+}
+
+// DefaultMessageLimits returns the default limits which are enforced unless
+// SetMessageLimits is called.
+func DefaultMessageLimits() MessageLimits {
+	return MessageLimits{
+		MaxBlockHeadersPerMsg: MaxBlockHeadersPerMsg,
+		MaxInvPerMsg:          MaxInvPerMsg,
+		MaxAddrPerMsg:         MaxAddrPerMsg,
+		MaxBlockPayload:       MaxBlockPayload,
+	}
+}
+
+// messageLimits houses the limits which are currently enforced.
+var messageLimits = DefaultMessageLimits()
+
+// CurrentMessageLimits returns the limits which are currently enforced.
+func CurrentMessageLimits() MessageLimits {
+	return messageLimits
+}
+
+// SetMessageLimits sets the limits which are enforced when encoding and
+// decoding messages.  An error is returned when a limit is zero or would allow
+// messages larger than MaxMessagePayload bytes, in which case the current
+// limits are left unchanged.
+//
+// This function is NOT safe for concurrent access with the encoding and
+// decoding of messages, so it must be called before any peers are connected.
+func SetMessageLimits(limits MessageLimits) error {
+	maxAddrPayload := maxNetAddressPayload(ProtocolVersion)
+	if maxNetAddressV2Payload > maxAddrPayload {
+		maxAddrPayload = maxNetAddressV2Payload
+	}
+	checks := []struct {
+		name       string
+		count      uint32
+		maxPayload uint64
+	}{
+		{"MaxBlockHeadersPerMsg", limits.MaxBlockHeadersPerMsg,
+			uint64(limits.MaxBlockHeadersPerMsg) *
+				(MaxBlockHeaderPayload + 1)},
+		{"MaxInvPerMsg", limits.MaxInvPerMsg,
+			uint64(limits.MaxInvPerMsg) * maxInvVectPayload},
+		{"MaxAddrPerMsg", limits.MaxAddrPerMsg,
+			uint64(limits.MaxAddrPerMsg) * uint64(maxAddrPayload)},
+		{"MaxBlockPayload", limits.MaxBlockPayload,
+			uint64(limits.MaxBlockPayload)},
+	}
+	for _, check := range checks {
+		if check.count == 0 {
+			str := fmt.Sprintf("%s must not be zero", check.name)
+			return messageError("SetMessageLimits", str)
+		}
+		if check.maxPayload+MaxVarIntPayload > MaxMessagePayload {
+			str := fmt.Sprintf("%s of %d allows messages larger than "+
+				"the max message payload of %d bytes", check.name,
+				check.count, MaxMessagePayload)
+			return messageError("SetMessageLimits", str)
+		}
+	}
+
+	messageLimits = limits
+	return nil
+}
+
+// maxTxPerBlock returns the maximum number of transactions that could possibly
+// fit into a block of the maximum block payload.
+func (l *MessageLimits) maxTxPerBlock() uint64 {
+	return uint64(l.MaxBlockPayload)/minTxPayload + 1
+}
+
+// payloadLimit returns the limit which bounds the payload of messages of the
+// passed command, or LimitNone when their payload is not configurable.
+func payloadLimit(command string) MessageLimit {
+	switch command {
+	case CmdBlock, CmdTx, CmdMerkleBlock, CmdCmpctBlock, CmdBlockTxn:
+		return LimitBlockPayload
+	}
+	return LimitNone
+}
+
+// limitError creates an error for the given function and description which
+// identifies the exceeded limit.
+func limitError(f string, limit MessageLimit, desc string) *MessageError {
+	return &MessageError{Func: f, Description: desc, Limit: limit}
+}
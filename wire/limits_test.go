@@ -0,0 +1,275 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/bitgo/prova/chaincfg/chainhash"
+)
+
+// TestMessageLimitStringer tests the stringized output for the MessageLimit
+// type.
+func TestMessageLimitStringer(t *testing.T) {
+	tests := []struct {
+		in   MessageLimit
+		want string
+	}{
+		{LimitNone, "LimitNone"},
+		{LimitBlockHeadersPerMsg, "LimitBlockHeadersPerMsg"},
+		{LimitInvPerMsg, "LimitInvPerMsg"},
+		{LimitAddrPerMsg, "LimitAddrPerMsg"},
+		{LimitTxPerBlock, "LimitTxPerBlock"},
+		{LimitBlockPayload, "LimitBlockPayload"},
+		{0xff, "Unknown MessageLimit (255)"},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for i, test := range tests {
+		result := test.in.String()
+		if result != test.want {
+			t.Errorf("String #%d\n got: %s want: %s", i, result,
+				test.want)
+			continue
+		}
+	}
+}
+
+// TestSetMessageLimits ensures invalid limits are rejected without changing
+// the current limits and valid limits are applied.
+func TestSetMessageLimits(t *testing.T) {
+	defer SetMessageLimits(DefaultMessageLimits())
+
+	if got := CurrentMessageLimits(); got != DefaultMessageLimits() {
+		t.Fatalf("CurrentMessageLimits: got %v, want defaults %v", got,
+			DefaultMessageLimits())
+	}
+
+	valid := DefaultMessageLimits()
+	tests := []struct {
+		name   string
+		modify func(*MessageLimits)
+	}{
+		{"zero headers", func(l *MessageLimits) {
+			l.MaxBlockHeadersPerMsg = 0
+		}},
+		{"zero inv", func(l *MessageLimits) { l.MaxInvPerMsg = 0 }},
+		{"zero addr", func(l *MessageLimits) { l.MaxAddrPerMsg = 0 }},
+		{"zero block payload", func(l *MessageLimits) {
+			l.MaxBlockPayload = 0
+		}},
+		{"oversized headers", func(l *MessageLimits) {
+			l.MaxBlockHeadersPerMsg = MaxMessagePayload
+		}},
+		{"oversized inv", func(l *MessageLimits) {
+			l.MaxInvPerMsg = MaxMessagePayload/maxInvVectPayload + 1
+		}},
+		{"oversized addr", func(l *MessageLimits) {
+			l.MaxAddrPerMsg = MaxMessagePayload / MaxNetAddressV2Size
+		}},
+		{"oversized block payload", func(l *MessageLimits) {
+			l.MaxBlockPayload = MaxMessagePayload
+		}},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for _, test := range tests {
+		limits := valid
+		test.modify(&limits)
+		err := SetMessageLimits(limits)
+		if _, ok := err.(*MessageError); !ok {
+			t.Errorf("%s: wrong error - got %v, want MessageError",
+				test.name, err)
+		}
+		if got := CurrentMessageLimits(); got != valid {
+			t.Errorf("%s: limits changed by invalid limits - got %v, "+
+				"want %v", test.name, got, valid)
+		}
+	}
+
+	// Raised limits which still fit into a message must be applied and
+	// reflected by the max payload lengths.
+	raised := MessageLimits{
+		MaxBlockHeadersPerMsg: 4000,
+		MaxInvPerMsg:          100000,
+		MaxAddrPerMsg:         2000,
+		MaxBlockPayload:       8000000,
+	}
+	if err := SetMessageLimits(raised); err != nil {
+		t.Fatalf("SetMessageLimits: unexpected error %v", err)
+	}
+	if got := CurrentMessageLimits(); got != raised {
+		t.Fatalf("CurrentMessageLimits: got %v, want %v", got, raised)
+	}
+	pver := ProtocolVersion
+	payloads := []struct {
+		msg  Message
+		want uint32
+	}{
+		{NewMsgHeaders(), MaxVarIntPayload + 4000*(MaxBlockHeaderPayload+1)},
+		{NewMsgInv(), MaxVarIntPayload + 100000*maxInvVectPayload},
+		{NewMsgGetData(), MaxVarIntPayload + 100000*maxInvVectPayload},
+		{NewMsgAddr(), MaxVarIntPayload + 2000*maxNetAddressPayload(pver)},
+		{&MsgBlock{}, 8000000},
+	}
+	for _, test := range payloads {
+		got := test.msg.MaxPayloadLength(pver)
+		if got != test.want {
+			t.Errorf("MaxPayloadLength: wrong max payload length for "+
+				"%s - got %v, want %v", test.msg.Command(), got,
+				test.want)
+		}
+	}
+
+	// An inv message larger than the default limit must round trip.
+	msg := NewMsgInv()
+	for i := 0; i < MaxInvPerMsg+1; i++ {
+		iv := NewInvVect(InvTypeTx, &chainhash.Hash{byte(i), byte(i >> 8)})
+		if err := msg.AddInvVect(iv); err != nil {
+			t.Fatalf("AddInvVect: unexpected error %v", err)
+		}
+	}
+	var buf bytes.Buffer
+	if err := msg.BtcEncode(&buf, pver); err != nil {
+		t.Fatalf("BtcEncode: unexpected error %v", err)
+	}
+	var readmsg MsgInv
+	if err := readmsg.BtcDecode(&buf, pver); err != nil {
+		t.Fatalf("BtcDecode: unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(&readmsg, msg) {
+		t.Errorf("BtcDecode: decoded message does not match")
+	}
+}
+
+// TestMessageLimitsExceeded ensures crafted payloads which announce more
+// elements than allowed are rejected before the elements are allocated with
+// errors identifying the exceeded limit, both for the default limits and for
+// lowered limits.
+func TestMessageLimitsExceeded(t *testing.T) {
+	defer SetMessageLimits(DefaultMessageLimits())
+
+	pver := ProtocolVersion
+
+	// withCount returns the passed prefix followed by the passed element
+	// count.  No elements follow, so decoding would fail with an EOF if the
+	// count was not checked first.
+	withCount := func(prefix []byte, count uint64) []byte {
+		var buf bytes.Buffer
+		buf.Write(prefix)
+		WriteVarInt(&buf, pver, count)
+		return buf.Bytes()
+	}
+	var header bytes.Buffer
+	if err := writeBlockHeader(&header, pver, &blockOne.Header); err != nil {
+		t.Fatalf("writeBlockHeader: unexpected error %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		msg   Message
+		buf   []byte
+		limit MessageLimit
+	}{
+		{"headers", &MsgHeaders{}, withCount(nil,
+			MaxBlockHeadersPerMsg+1), LimitBlockHeadersPerMsg},
+		{"inv", &MsgInv{}, withCount(nil, MaxInvPerMsg+1),
+			LimitInvPerMsg},
+		{"getdata", &MsgGetData{}, withCount(nil, MaxInvPerMsg+1),
+			LimitInvPerMsg},
+		{"notfound", &MsgNotFound{}, withCount(nil, MaxInvPerMsg+1),
+			LimitInvPerMsg},
+		{"addr", &MsgAddr{}, withCount(nil, MaxAddrPerMsg+1),
+			LimitAddrPerMsg},
+		{"addrv2", &MsgAddrV2{}, withCount(nil, MaxAddrPerMsg+1),
+			LimitAddrPerMsg},
+		{"block", &MsgBlock{}, withCount(header.Bytes(), 1<<63),
+			LimitTxPerBlock},
+		{"merkleblock", &MsgMerkleBlock{}, withCount(append(
+			header.Bytes(), 0x01, 0x00, 0x00, 0x00), 1<<32),
+			LimitTxPerBlock},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for _, test := range tests {
+		err := test.msg.BtcDecode(bytes.NewReader(test.buf), pver)
+		msgErr, ok := err.(*MessageError)
+		if !ok {
+			t.Errorf("%s: wrong error - got %v <%T>, want MessageError",
+				test.name, err, err)
+			continue
+		}
+		if msgErr.Limit != test.limit {
+			t.Errorf("%s: wrong limit - got %v, want %v", test.name,
+				msgErr.Limit, test.limit)
+		}
+	}
+
+	// Lower the limits so small messages exceed them.
+	err := SetMessageLimits(MessageLimits{
+		MaxBlockHeadersPerMsg: 1,
+		MaxInvPerMsg:          1,
+		MaxAddrPerMsg:         1,
+		MaxBlockPayload:       100,
+	})
+	if err != nil {
+		t.Fatalf("SetMessageLimits: unexpected error %v", err)
+	}
+
+	lowered := []struct {
+		name  string
+		msg   Message
+		buf   []byte
+		limit MessageLimit
+	}{
+		{"headers", &MsgHeaders{}, withCount(nil, 2),
+			LimitBlockHeadersPerMsg},
+		{"inv", &MsgInv{}, withCount(nil, 2), LimitInvPerMsg},
+		{"getdata", &MsgGetData{}, withCount(nil, 2), LimitInvPerMsg},
+		{"addr", &MsgAddr{}, withCount(nil, 2), LimitAddrPerMsg},
+		{"block", &MsgBlock{}, withCount(header.Bytes(), 100/minTxPayload+2),
+			LimitTxPerBlock},
+	}
+	t.Logf("Running %d tests", len(lowered))
+	for _, test := range lowered {
+		err := test.msg.BtcDecode(bytes.NewReader(test.buf), pver)
+		msgErr, ok := err.(*MessageError)
+		if !ok || msgErr.Limit != test.limit {
+			t.Errorf("%s: wrong error - got %v, want MessageError "+
+				"with limit %v", test.name, err, test.limit)
+		}
+	}
+
+	// Adding more elements than allowed must fail as well.
+	iv := NewInvVect(InvTypeTx, &chainhash.Hash{})
+	inv := NewMsgInv()
+	inv.AddInvVect(iv)
+	err = inv.AddInvVect(iv)
+	if msgErr, ok := err.(*MessageError); !ok || msgErr.Limit != LimitInvPerMsg {
+		t.Errorf("AddInvVect: wrong error - got %v, want MessageError "+
+			"with limit %v", err, LimitInvPerMsg)
+	}
+
+	// Block messages larger than the max block payload must be rejected
+	// based on the message header, before the payload is read.
+	buf := makeHeader(MainNet, CmdBlock, 101, 0)
+	_, _, err = ReadMessage(bytes.NewReader(buf), pver, MainNet)
+	if msgErr, ok := err.(*MessageError); !ok ||
+		msgErr.Limit != LimitBlockPayload {
+
+		t.Errorf("ReadMessage: wrong error - got %v, want "+
+			"MessageError with limit %v", err, LimitBlockPayload)
+	}
+	var w bytes.Buffer
+	_, err = WriteMessageN(&w, &blockOne, pver, MainNet)
+	if msgErr, ok := err.(*MessageError); !ok ||
+		msgErr.Limit != LimitBlockPayload {
+
+		t.Errorf("WriteMessageN: wrong error - got %v, want "+
+			"MessageError with limit %v", err, LimitBlockPayload)
+	}
+}
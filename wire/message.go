@@ -29,29 +29,36 @@ const MaxMessagePayload = (1024 * 1024 * 32) // 32MB
 
 // Commands used in bitcoin message headers which describe the type of message.
 const (
-	CmdVersion     = "version"
-	CmdVerAck      = "verack"
-	CmdGetAddr     = "getaddr"
-	CmdAddr        = "addr"
-	CmdGetBlocks   = "getblocks"
-	CmdInv         = "inv"
-	CmdGetData     = "getdata"
-	CmdNotFound    = "notfound"
-	CmdBlock       = "block"
-	CmdTx          = "tx"
-	CmdGetHeaders  = "getheaders"
-	CmdHeaders     = "headers"
-	CmdPing        = "ping"
-	CmdPong        = "pong"
-	CmdAlert       = "alert"
-	CmdMemPool     = "mempool"
-	CmdFilterAdd   = "filteradd"
-	CmdFilterClear = "filterclear"
-	CmdFilterLoad  = "filterload"
-	CmdMerkleBlock = "merkleblock"
-	CmdReject      = "reject"
-	CmdSendHeaders = "sendheaders"
-	CmdFeeFilter   = "feefilter"
+	CmdVersion      = "version"
+	CmdVerAck       = "verack"
+	CmdGetAddr      = "getaddr"
+	CmdAddr         = "addr"
+	CmdGetBlocks    = "getblocks"
+	CmdInv          = "inv"
+	CmdGetData      = "getdata"
+	CmdNotFound     = "notfound"
+	CmdBlock        = "block"
+	CmdTx           = "tx"
+	CmdGetHeaders   = "getheaders"
+	CmdHeaders      = "headers"
+	CmdPing         = "ping"
+	CmdPong         = "pong"
+	CmdAlert        = "alert"
+	CmdMemPool      = "mempool"
+	CmdFilterAdd    = "filteradd"
+	CmdFilterClear  = "filterclear"
+	CmdFilterLoad   = "filterload"
+	CmdMerkleBlock  = "merkleblock"
+	CmdReject       = "reject"
+	CmdSendHeaders  = "sendheaders"
+	CmdFeeFilter    = "feefilter"
+	CmdSendCmpct    = "sendcmpct"
+	CmdCmpctBlock   = "cmpctblock"
+	CmdGetBlockTxn  = "getblocktxn"
+	CmdBlockTxn     = "blocktxn"
+	CmdSendAddrV2   = "sendaddrv2"
+	CmdAddrV2       = "addrv2"
+	CmdValidatorKey = "validatorkey"
 )
 
 // Message is an interface that describes a bitcoin message.  A type that
@@ -139,6 +146,27 @@ func makeEmptyMessage(command string) (Message, error) {
 	case CmdFeeFilter:
 		msg = &MsgFeeFilter{}
 
+	case CmdSendCmpct:
+		msg = &MsgSendCmpct{}
+
+	case CmdCmpctBlock:
+		msg = &MsgCmpctBlock{}
+
+	case CmdGetBlockTxn:
+		msg = &MsgGetBlockTxn{}
+
+	case CmdBlockTxn:
+		msg = &MsgBlockTxn{}
+
+	case CmdSendAddrV2:
+		msg = &MsgSendAddrV2{}
+
+	case CmdAddrV2:
+		msg = &MsgAddrV2{}
+
+	case CmdValidatorKey:
+		msg = &MsgValidatorKey{}
+
 	default:
 		return nil, fmt.Errorf("unhandled command [%s]", command)
 	}
@@ -197,6 +225,13 @@ func discardInput(r io.Reader, n uint32) {
 	}
 }
 
+// bufEncoder is implemented by messages which can append their bitcoin protocol
+// encoding to a caller-provided buffer.  WriteMessageN encodes such messages
+// into pooled buffers rather than allocating new ones.
+type bufEncoder interface {
+	BtcEncodeBuf(buf []byte, pver uint32) []byte
+}
+
 // WriteMessageN writes a bitcoin Message to w including the necessary header
 // information and returns the number of bytes written.    This function is the
 // same as WriteMessage except it also returns the number of bytes written.
@@ -213,13 +248,24 @@ func WriteMessageN(w io.Writer, msg Message, pver uint32, btcnet BitcoinNet) (in
 	}
 	copy(command[:], []byte(cmd))
 
-	// Encode the message payload.
-	var bw bytes.Buffer
-	err := msg.BtcEncode(&bw, pver)
-	if err != nil {
-		return totalBytes, err
+	// Encode the message payload.  Messages which can append their
+	// encoding to a buffer are encoded into a pooled buffer, after room for
+	// the message header, so they are written without any allocations.
+	var hw, payload []byte
+	if e, ok := msg.(bufEncoder); ok {
+		buf := borrowEncodeBuf()
+		defer returnEncodeBuf(buf)
+		*buf = append(*buf, make([]byte, MessageHeaderSize)...)
+		*buf = e.BtcEncodeBuf(*buf, pver)
+		hw, payload = (*buf)[:MessageHeaderSize], (*buf)[MessageHeaderSize:]
+	} else {
+		var bw bytes.Buffer
+		err := msg.BtcEncode(&bw, pver)
+		if err != nil {
+			return totalBytes, err
+		}
+		hw, payload = make([]byte, MessageHeaderSize), bw.Bytes()
 	}
-	payload := bw.Bytes()
 	lenp := len(payload)
 
 	// Enforce maximum overall message payload.
@@ -236,7 +282,8 @@ func WriteMessageN(w io.Writer, msg Message, pver uint32, btcnet BitcoinNet) (in
 		str := fmt.Sprintf("message payload is too large - encoded "+
 			"%d bytes, but maximum message payload size for "+
 			"messages of type [%s] is %d.", lenp, cmd, mpl)
-		return totalBytes, messageError("WriteMessage", str)
+		return totalBytes, limitError("WriteMessage",
+			payloadLimit(cmd), str)
 	}
 
 	// Create header for the message.
@@ -244,16 +291,19 @@ func WriteMessageN(w io.Writer, msg Message, pver uint32, btcnet BitcoinNet) (in
 	hdr.magic = btcnet
 	hdr.command = cmd
 	hdr.length = uint32(lenp)
-	copy(hdr.checksum[:], chainhash.DoubleHashB(payload)[0:4])
+	checksum := chainhash.DoubleHashH(payload)
+	copy(hdr.checksum[:], checksum[0:4])
 
-	// Encode the header for the message.  This is done to a buffer
-	// rather than directly to the writer since writeElements doesn't
-	// return the number of bytes written.
-	hw := bytes.NewBuffer(make([]byte, 0, MessageHeaderSize))
-	writeElements(hw, hdr.magic, command, hdr.length, hdr.checksum)
+	// Encode the header for the message into the space reserved for it.
+	// This is done to a buffer rather than directly to the writer in order
+	// to know the number of bytes written.
+	littleEndian.PutUint32(hw[0:4], uint32(hdr.magic))
+	copy(hw[4:4+CommandSize], command[:])
+	littleEndian.PutUint32(hw[16:20], hdr.length)
+	copy(hw[20:24], hdr.checksum[:])
 
 	// Write header.
-	n, err := w.Write(hw.Bytes())
+	n, err := w.Write(hw)
 	totalBytes += n
 	if err != nil {
 		return totalBytes, err
@@ -300,7 +350,8 @@ func ReadMessageN(r io.Reader, pver uint32, btcnet BitcoinNet) (int, Message, []
 	// Check for messages from the wrong bitcoin network.
 	if hdr.magic != btcnet {
 		discardInput(r, hdr.length)
-		str := fmt.Sprintf("message from other network [%v]", hdr.magic)
+		str := fmt.Sprintf("message from other network [%v], "+
+			"expected [%v]", hdr.magic, btcnet)
 		return totalBytes, nil, nil, messageError("ReadMessage", str)
 	}
 
@@ -329,7 +380,8 @@ func ReadMessageN(r io.Reader, pver uint32, btcnet BitcoinNet) (int, Message, []
 		str := fmt.Sprintf("payload exceeds max length - header "+
 			"indicates %v bytes, but max payload size for "+
 			"messages of type [%v] is %v.", hdr.length, command, mpl)
-		return totalBytes, nil, nil, messageError("ReadMessage", str)
+		return totalBytes, nil, nil, limitError("ReadMessage",
+			payloadLimit(command), str)
 	}
 
 	// Read payload.
@@ -70,6 +70,14 @@ func TestMessage(t *testing.T) {
 	bh := NewBlockHeader(&chainhash.Hash{}, &chainhash.Hash{}, 0, 0)
 	msgMerkleBlock := NewMsgMerkleBlock(bh)
 	msgReject := NewMsgReject("block", RejectDuplicate, "duplicate block")
+	msgSendCmpct := NewMsgSendCmpct(false, CmpctBlockVersion)
+	msgCmpctBlock := NewMsgCmpctBlock(bh, 123123)
+	msgGetBlockTxn := NewMsgGetBlockTxn(&chainhash.Hash{})
+	msgBlockTxn := NewMsgBlockTxn(&chainhash.Hash{})
+	msgSendAddrV2 := NewMsgSendAddrV2()
+	msgAddrV2 := NewMsgAddrV2()
+	msgValidatorKey := NewMsgValidatorKey(0, [33]byte{0x02},
+		ValidatorKeyProvision, &chainhash.Hash{})
 
 	tests := []struct {
 		in     Message    // Value to encode
@@ -99,6 +107,13 @@ func TestMessage(t *testing.T) {
 		{msgFilterLoad, msgFilterLoad, pver, MainNet, 35},
 		{msgMerkleBlock, msgMerkleBlock, pver, MainNet, 239},
 		{msgReject, msgReject, pver, MainNet, 79},
+		{msgSendCmpct, msgSendCmpct, pver, MainNet, 33},
+		{msgCmpctBlock, msgCmpctBlock, pver, MainNet, 243},
+		{msgGetBlockTxn, msgGetBlockTxn, pver, MainNet, 57},
+		{msgBlockTxn, msgBlockTxn, pver, MainNet, 57},
+		{msgSendAddrV2, msgSendAddrV2, pver, MainNet, 24},
+		{msgAddrV2, msgAddrV2, pver, MainNet, 25},
+		{msgValidatorKey, msgValidatorKey, pver, MainNet, 94},
 	}
 
 	t.Logf("Running %d tests", len(tests))
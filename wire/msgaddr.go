@@ -30,10 +30,10 @@ type MsgAddr struct {
 
 // AddAddress adds a known active peer to the message.
 func (msg *MsgAddr) AddAddress(na *NetAddress) error {
-	if len(msg.AddrList)+1 > MaxAddrPerMsg {
+	if len(msg.AddrList)+1 > int(messageLimits.MaxAddrPerMsg) {
 		str := fmt.Sprintf("too many addresses in message [max %v]",
-			MaxAddrPerMsg)
-		return messageError("MsgAddr.AddAddress", str)
+			messageLimits.MaxAddrPerMsg)
+		return limitError("MsgAddr.AddAddress", LimitAddrPerMsg, str)
 	}
 
 	msg.AddrList = append(msg.AddrList, na)
@@ -65,10 +65,11 @@ func (msg *MsgAddr) BtcDecode(r io.Reader, pver uint32) error {
 	}
 
 	// Limit to max addresses per message.
-	if count > MaxAddrPerMsg {
+	if count > uint64(messageLimits.MaxAddrPerMsg) {
 		str := fmt.Sprintf("too many addresses for message "+
-			"[count %v, max %v]", count, MaxAddrPerMsg)
-		return messageError("MsgAddr.BtcDecode", str)
+			"[count %v, max %v]", count,
+			messageLimits.MaxAddrPerMsg)
+		return limitError("MsgAddr.BtcDecode", LimitAddrPerMsg, str)
 	}
 
 	addrList := make([]NetAddress, count)
@@ -96,10 +97,11 @@ func (msg *MsgAddr) BtcEncode(w io.Writer, pver uint32) error {
 		return messageError("MsgAddr.BtcEncode", str)
 
 	}
-	if count > MaxAddrPerMsg {
+	if count > int(messageLimits.MaxAddrPerMsg) {
 		str := fmt.Sprintf("too many addresses for message "+
-			"[count %v, max %v]", count, MaxAddrPerMsg)
-		return messageError("MsgAddr.BtcEncode", str)
+			"[count %v, max %v]", count,
+			messageLimits.MaxAddrPerMsg)
+		return limitError("MsgAddr.BtcEncode", LimitAddrPerMsg, str)
 	}
 
 	err := WriteVarInt(w, pver, uint64(count))
@@ -132,7 +134,8 @@ func (msg *MsgAddr) MaxPayloadLength(pver uint32) uint32 {
 	}
 
 	// Num addresses (varInt) + max allowed addresses.
-	return MaxVarIntPayload + (MaxAddrPerMsg * maxNetAddressPayload(pver))
+	return MaxVarIntPayload + (messageLimits.MaxAddrPerMsg *
+		maxNetAddressPayload(pver))
 }
 
 // NewMsgAddr returns a new bitcoin addr message that conforms to the
@@ -0,0 +1,149 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"fmt"
+	"io"
+)
+
+// maxNetAddressV2Payload is the max payload size for a NetAddress in the
+// addrv2 format.
+const maxNetAddressV2Payload = 4 + MaxVarIntPayload + 1 + MaxVarIntPayload +
+	MaxNetAddressV2Size + 2
+
+// MsgAddrV2 implements the Message interface and represents a bitcoin
+// addrv2 message.  It is the counterpart of the addr message (MsgAddr) which
+// is sent to peers which signaled support with a sendaddrv2 message.  Unlike
+// addr messages, it can represent addresses of networks other than IPv4 and
+// IPv6, such as Tor v3 and I2P, by prefixing each address with the ID of its
+// network and its length.
+//
+// Addresses of unknown networks are skipped when decoding, so they are not in
+// the address list of a decoded message.
+//
+// This message was not added until protocol versions starting with
+// AddrV2Version.
+type MsgAddrV2 struct {
+	AddrList []*NetAddress
+}
+
+// AddAddress adds a known active peer to the message.
+func (msg *MsgAddrV2) AddAddress(na *NetAddress) error {
+	if len(msg.AddrList)+1 > int(messageLimits.MaxAddrPerMsg) {
+		str := fmt.Sprintf("too many addresses in message [max %v]",
+			messageLimits.MaxAddrPerMsg)
+		return limitError("MsgAddrV2.AddAddress", LimitAddrPerMsg, str)
+	}
+
+	msg.AddrList = append(msg.AddrList, na)
+	return nil
+}
+
+// AddAddresses adds multiple known active peers to the message.
+func (msg *MsgAddrV2) AddAddresses(netAddrs ...*NetAddress) error {
+	for _, na := range netAddrs {
+		err := msg.AddAddress(na)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ClearAddresses removes all addresses from the message.
+func (msg *MsgAddrV2) ClearAddresses() {
+	msg.AddrList = []*NetAddress{}
+}
+
+// BtcDecode decodes r using the bitcoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgAddrV2) BtcDecode(r io.Reader, pver uint32) error {
+	if pver < AddrV2Version {
+		str := fmt.Sprintf("addrv2 message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgAddrV2.BtcDecode", str)
+	}
+
+	count, err := ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+
+	// Limit to max addresses per message.
+	if count > uint64(messageLimits.MaxAddrPerMsg) {
+		str := fmt.Sprintf("too many addresses for message "+
+			"[count %v, max %v]", count,
+			messageLimits.MaxAddrPerMsg)
+		return limitError("MsgAddrV2.BtcDecode", LimitAddrPerMsg, str)
+	}
+
+	msg.AddrList = make([]*NetAddress, 0, count)
+	for i := uint64(0); i < count; i++ {
+		na := &NetAddress{}
+		known, err := readNetAddressV2(r, pver, na)
+		if err != nil {
+			return err
+		}
+		if known {
+			msg.AddAddress(na)
+		}
+	}
+	return nil
+}
+
+// BtcEncode encodes the receiver to w using the bitcoin protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgAddrV2) BtcEncode(w io.Writer, pver uint32) error {
+	if pver < AddrV2Version {
+		str := fmt.Sprintf("addrv2 message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgAddrV2.BtcEncode", str)
+	}
+
+	count := len(msg.AddrList)
+	if count > int(messageLimits.MaxAddrPerMsg) {
+		str := fmt.Sprintf("too many addresses for message "+
+			"[count %v, max %v]", count,
+			messageLimits.MaxAddrPerMsg)
+		return limitError("MsgAddrV2.BtcEncode", LimitAddrPerMsg, str)
+	}
+
+	err := WriteVarInt(w, pver, uint64(count))
+	if err != nil {
+		return err
+	}
+
+	for _, na := range msg.AddrList {
+		err = writeNetAddressV2(w, pver, na)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgAddrV2) Command() string {
+	return CmdAddrV2
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgAddrV2) MaxPayloadLength(pver uint32) uint32 {
+	// Num addresses (varInt) + max allowed addresses.
+	return MaxVarIntPayload + (messageLimits.MaxAddrPerMsg *
+		maxNetAddressV2Payload)
+}
+
+// NewMsgAddrV2 returns a new bitcoin addrv2 message that conforms to the
+// Message interface.  See MsgAddrV2 for details.
+func NewMsgAddrV2() *MsgAddrV2 {
+	return &MsgAddrV2{
+		AddrList: make([]*NetAddress, 0, MaxAddrPerMsg),
+	}
+}
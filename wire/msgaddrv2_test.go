@@ -0,0 +1,281 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/davecgh/go-spew/spew"
+)
+
+// TestAddrV2 tests the MsgAddrV2 API.
+func TestAddrV2(t *testing.T) {
+	pver := ProtocolVersion
+
+	// Ensure the command is expected value.
+	wantCmd := "addrv2"
+	msg := NewMsgAddrV2()
+	if cmd := msg.Command(); cmd != wantCmd {
+		t.Errorf("NewMsgAddrV2: wrong command - got %v want %v",
+			cmd, wantCmd)
+	}
+
+	// Ensure max payload is expected value for latest protocol version.
+	// Num addresses (varInt) + max allowed addresses.
+	wantPayload := uint32(9 + 1000*(4+9+1+9+512+2))
+	maxPayload := msg.MaxPayloadLength(pver)
+	if maxPayload != wantPayload {
+		t.Errorf("MaxPayloadLength: wrong max payload length for "+
+			"protocol version %d - got %v, want %v", pver,
+			maxPayload, wantPayload)
+	}
+
+	// Ensure adding more than the max allowed addresses per message
+	// returns an error.
+	na := NewNetAddressIPPort(net.ParseIP("127.0.0.1"), 8333, SFNodeNetwork)
+	for i := 0; i < MaxAddrPerMsg+1; i++ {
+		err := msg.AddAddress(na)
+		if i < MaxAddrPerMsg && err != nil {
+			t.Fatalf("AddAddress: unexpected error %v", err)
+		}
+		if i == MaxAddrPerMsg && err == nil {
+			t.Errorf("AddAddress: expected error on too many " +
+				"addresses not received")
+		}
+	}
+	msg.ClearAddresses()
+	if len(msg.AddrList) != 0 {
+		t.Errorf("ClearAddresses: address list is not empty - "+
+			"got %v [%v], want %v", len(msg.AddrList),
+			spew.Sdump(msg.AddrList[0]), 0)
+	}
+
+	// Older protocol versions should fail encode and decode since the
+	// message didn't exist yet.
+	var buf bytes.Buffer
+	oldPver := AddrV2Version - 1
+	if err := msg.BtcEncode(&buf, oldPver); err == nil {
+		t.Errorf("encode of MsgAddrV2 passed for old protocol "+
+			"version %v", oldPver)
+	}
+	if err := msg.BtcDecode(&buf, oldPver); err == nil {
+		t.Errorf("decode of MsgAddrV2 passed for old protocol "+
+			"version %v", oldPver)
+	}
+}
+
+// TestAddrV2Wire tests the MsgAddrV2 wire encode and decode for each known
+// address type.
+func TestAddrV2Wire(t *testing.T) {
+	timestamp := time.Unix(0x495fab29, 0) // 2009-01-03 12:15:05 -0600 CST
+	torV3Key := bytes.Repeat([]byte{0xab}, 32)
+	i2pHash := bytes.Repeat([]byte{0xcd}, 32)
+	newAddr := func(netID NetworkID, addr []byte) *NetAddress {
+		na, err := NewNetAddressV2(netID, addr, 8333, SFNodeNetwork)
+		if err != nil {
+			t.Fatalf("NewNetAddressV2: unexpected error %v", err)
+		}
+		na.Timestamp = timestamp
+		return na
+	}
+
+	// The encoded address always starts with the timestamp and services.
+	prefix := []byte{
+		0x29, 0xab, 0x5f, 0x49, // Timestamp
+		0x01, // Services (varint)
+	}
+	port := []byte{0x20, 0x8d} // Port 8333 in big-endian
+
+	tests := []struct {
+		name   string
+		na     *NetAddress
+		netID  NetworkID
+		legacy bool
+		buf    []byte
+	}{
+		{
+			name:   "IPv4",
+			na:     newAddr(NetIDIPv4, []byte{127, 0, 0, 1}),
+			netID:  NetIDIPv4,
+			legacy: true,
+			buf:    []byte{0x01, 0x04, 0x7f, 0x00, 0x00, 0x01},
+		},
+		{
+			name: "IPv6",
+			na: newAddr(NetIDIPv6, net.ParseIP(
+				"2001:db8::1")),
+			netID:  NetIDIPv6,
+			legacy: true,
+			buf: []byte{
+				0x02, 0x10,
+				0x20, 0x01, 0x0d, 0xb8, 0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01,
+			},
+		},
+		{
+			name: "Tor v2",
+			na: newAddr(NetIDTorV2, []byte{
+				0x01, 0x02, 0x03, 0x04, 0x05,
+				0x06, 0x07, 0x08, 0x09, 0x0a,
+			}),
+			netID:  NetIDTorV2,
+			legacy: true,
+			buf: []byte{
+				0x03, 0x0a,
+				0x01, 0x02, 0x03, 0x04, 0x05,
+				0x06, 0x07, 0x08, 0x09, 0x0a,
+			},
+		},
+		{
+			name:  "Tor v3",
+			na:    newAddr(NetIDTorV3, torV3Key),
+			netID: NetIDTorV3,
+			buf:   append([]byte{0x04, 0x20}, torV3Key...),
+		},
+		{
+			name:  "I2P",
+			na:    newAddr(NetIDI2P, i2pHash),
+			netID: NetIDI2P,
+			buf:   append([]byte{0x05, 0x20}, i2pHash...),
+		},
+		{
+			name: "CJDNS",
+			na: newAddr(NetIDCJDNS, net.ParseIP(
+				"fc00::1")),
+			// CJDNS addresses are IPv6 addresses once decoded.
+			netID:  NetIDIPv6,
+			legacy: true,
+			buf: []byte{
+				0x02, 0x10,
+				0xfc, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01,
+			},
+		},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for _, test := range tests {
+		if got := test.na.NetworkID(); got != test.netID {
+			t.Errorf("%s: wrong network id - got %v, want %v",
+				test.name, got, test.netID)
+		}
+		if got := test.na.IsLegacy(); got != test.legacy {
+			t.Errorf("%s: wrong legacy flag - got %v, want %v",
+				test.name, got, test.legacy)
+		}
+
+		var want []byte
+		want = append(want, 0x01) // Address count
+		want = append(want, prefix...)
+		want = append(want, test.buf...)
+		want = append(want, port...)
+
+		// Encode the message to wire format.
+		msg := NewMsgAddrV2()
+		msg.AddAddress(test.na)
+		var buf bytes.Buffer
+		err := msg.BtcEncode(&buf, ProtocolVersion)
+		if err != nil {
+			t.Errorf("%s: BtcEncode error %v", test.name, err)
+			continue
+		}
+		if !bytes.Equal(buf.Bytes(), want) {
+			t.Errorf("%s: BtcEncode\n got: %s want: %s", test.name,
+				spew.Sdump(buf.Bytes()), spew.Sdump(want))
+			continue
+		}
+
+		// Decode the message from wire format.
+		var readmsg MsgAddrV2
+		err = readmsg.BtcDecode(&buf, ProtocolVersion)
+		if err != nil {
+			t.Errorf("%s: BtcDecode error %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(readmsg.AddrList, msg.AddrList) {
+			t.Errorf("%s: BtcDecode\n got: %s want: %s", test.name,
+				spew.Sdump(readmsg.AddrList),
+				spew.Sdump(msg.AddrList))
+		}
+	}
+}
+
+// TestAddrV2Unknown ensures addresses of unknown networks are skipped without
+// failing to decode the remaining addresses of the message, while known
+// addresses of the wrong size and oversized addresses fail the message.
+func TestAddrV2Unknown(t *testing.T) {
+	buf := []byte{
+		0x02,                   // Address count
+		0x29, 0xab, 0x5f, 0x49, // Timestamp
+		0x01,                   // Services
+		0x2a,                   // Unknown network id
+		0x03, 0x01, 0x02, 0x03, // Address
+		0x20, 0x8d, // Port
+		0x29, 0xab, 0x5f, 0x49, // Timestamp
+		0x01,                         // Services
+		0x01,                         // IPv4
+		0x04, 0x7f, 0x00, 0x00, 0x01, // Address
+		0x20, 0x8d, // Port
+	}
+	var msg MsgAddrV2
+	err := msg.BtcDecode(bytes.NewReader(buf), ProtocolVersion)
+	if err != nil {
+		t.Fatalf("BtcDecode: unexpected error %v", err)
+	}
+	if len(msg.AddrList) != 1 {
+		t.Fatalf("BtcDecode: wrong number of addresses - got %d, "+
+			"want 1", len(msg.AddrList))
+	}
+	if !msg.AddrList[0].IP.Equal(net.ParseIP("127.0.0.1")) {
+		t.Errorf("BtcDecode: wrong address - got %v, want 127.0.0.1",
+			msg.AddrList[0].IP)
+	}
+
+	// A Tor v3 address must be 32 bytes.
+	buf = []byte{
+		0x01,                   // Address count
+		0x29, 0xab, 0x5f, 0x49, // Timestamp
+		0x01,                   // Services
+		0x04,                   // Tor v3
+		0x03, 0x01, 0x02, 0x03, // Address
+		0x20, 0x8d, // Port
+	}
+	err = msg.BtcDecode(bytes.NewReader(buf), ProtocolVersion)
+	if _, ok := err.(*MessageError); !ok {
+		t.Errorf("BtcDecode: wrong error for invalid address size - "+
+			"got %v, want MessageError", err)
+	}
+
+	// Addresses can not exceed MaxNetAddressV2Size bytes, even of unknown
+	// networks.
+	buf = []byte{
+		0x01,                   // Address count
+		0x29, 0xab, 0x5f, 0x49, // Timestamp
+		0x01,             // Services
+		0x2a,             // Unknown network id
+		0xfd, 0x01, 0x02, // Address size 513
+	}
+	err = msg.BtcDecode(bytes.NewReader(buf), ProtocolVersion)
+	if _, ok := err.(*MessageError); !ok {
+		t.Errorf("BtcDecode: wrong error for oversized address - "+
+			"got %v, want MessageError", err)
+	}
+
+	// Addresses of unknown networks can not be created or encoded.
+	_, err = NewNetAddressV2(0x2a, []byte{0x01}, 8333, SFNodeNetwork)
+	if err == nil {
+		t.Errorf("NewNetAddressV2: unknown network id accepted")
+	}
+	msg.ClearAddresses()
+	msg.AddAddress(&NetAddress{NetID: 0x2a, Addr: []byte{0x01}})
+	var w bytes.Buffer
+	if err := msg.BtcEncode(&w, ProtocolVersion); err == nil {
+		t.Errorf("BtcEncode: address of unknown network encoded")
+	}
+}
@@ -26,10 +26,6 @@ const MaxBlocksPerMsg = 500
 // MaxBlockPayload is the maximum bytes a block message can be in bytes.
 const MaxBlockPayload = 2500000 // 2.5 Megabytes (not Mebibytes).
 
-// maxTxPerBlock is the maximum number of transactions that could
-// possibly fit into a block.
-const maxTxPerBlock = (MaxBlockPayload / minTxPayload) + 1
-
 // TxLoc holds locator data for the offset and length of where a transaction is
 // located within a MsgBlock data buffer.
 type TxLoc struct {
@@ -75,10 +71,11 @@ func (msg *MsgBlock) BtcDecode(r io.Reader, pver uint32) error {
 	// Prevent more transactions than could possibly fit into a block.
 	// It would be possible to cause memory exhaustion and panics without
 	// a sane upper bound on this count.
-	if txCount > maxTxPerBlock {
+	if txCount > messageLimits.maxTxPerBlock() {
 		str := fmt.Sprintf("too many transactions to fit into a block "+
-			"[count %d, max %d]", txCount, maxTxPerBlock)
-		return messageError("MsgBlock.BtcDecode", str)
+			"[count %d, max %d]", txCount,
+			messageLimits.maxTxPerBlock())
+		return limitError("MsgBlock.BtcDecode", LimitTxPerBlock, str)
 	}
 
 	msg.Transactions = make([]*MsgTx, 0, txCount)
@@ -133,10 +130,12 @@ func (msg *MsgBlock) DeserializeTxLoc(r *bytes.Buffer) ([]TxLoc, error) {
 	// Prevent more transactions than could possibly fit into a block.
 	// It would be possible to cause memory exhaustion and panics without
 	// a sane upper bound on this count.
-	if txCount > maxTxPerBlock {
+	if txCount > messageLimits.maxTxPerBlock() {
 		str := fmt.Sprintf("too many transactions to fit into a block "+
-			"[count %d, max %d]", txCount, maxTxPerBlock)
-		return nil, messageError("MsgBlock.DeserializeTxLoc", str)
+			"[count %d, max %d]", txCount,
+			messageLimits.maxTxPerBlock())
+		return nil, limitError("MsgBlock.DeserializeTxLoc",
+			LimitTxPerBlock, str)
 	}
 
 	// Deserialize each transaction while keeping track of its location
@@ -224,7 +223,7 @@ func (msg *MsgBlock) MaxPayloadLength(pver uint32) uint32 {
 	// Block header at 80 bytes + transaction count + max transactions
 	// which can vary up to the MaxBlockPayload (including the block header
 	// and transaction count).
-	return MaxBlockPayload
+	return messageLimits.MaxBlockPayload
 }
 
 // BlockHash computes the block identifier hash for this block.
@@ -494,6 +494,71 @@ func TestBlockOverflowErrors(t *testing.T) {
 	}
 }
 
+// TestBlockNonCanonicalVarInt ensures blocks which encode their transaction
+// count, or any of the counts or script lengths of their transactions, with a
+// non-canonical varint are rejected.  Like transactions, blocks have no lenient
+// decoding mode since the consensus rules never accepted such encodings.
+func TestBlockNonCanonicalVarInt(t *testing.T) {
+	pver := ProtocolVersion
+
+	// The transaction count follows the header and the signature script
+	// length of the coinbase follows its previous outpoint.
+	txCountOffset := len(blockOneBytes) -
+		blockOne.Transactions[0].SerializeSize() - 1
+	sigScriptLenOffset := txCountOffset + 1 + 4 + 1 + 32 + 4
+
+	// replace returns the encoded block one with the canonical varint at
+	// the passed offset replaced by the passed encoding.
+	replace := func(offset int, encoding ...byte) []byte {
+		var buf []byte
+		buf = append(buf, blockOneBytes[:offset]...)
+		buf = append(buf, encoding...)
+		return append(buf, blockOneBytes[offset+1:]...)
+	}
+
+	tests := []struct {
+		name string
+		buf  []byte
+	}{
+		{"transaction count", replace(txCountOffset, 0xfd, 0x01, 0x00)},
+		{"transaction count 32-bit", replace(txCountOffset, 0xfe, 0x01,
+			0x00, 0x00, 0x00)},
+		{"signature script length", replace(sigScriptLenOffset, 0xfd,
+			0x07, 0x00)},
+	}
+
+	// The canonical encoding must decode.
+	var msg MsgBlock
+	if err := msg.BtcDecode(bytes.NewReader(blockOneBytes), pver); err != nil {
+		t.Fatalf("BtcDecode: unexpected error for canonical encoding: %v",
+			err)
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for _, test := range tests {
+		var msg MsgBlock
+		err := msg.BtcDecode(bytes.NewReader(test.buf), pver)
+		if _, ok := err.(*MessageError); !ok {
+			t.Errorf("BtcDecode %s: wrong error - got %v <%T>, want "+
+				"MessageError", test.name, err, err)
+			continue
+		}
+
+		err = msg.Deserialize(bytes.NewReader(test.buf))
+		if _, ok := err.(*MessageError); !ok {
+			t.Errorf("Deserialize %s: wrong error - got %v <%T>, want "+
+				"MessageError", test.name, err, err)
+			continue
+		}
+
+		_, err = msg.DeserializeTxLoc(bytes.NewBuffer(test.buf))
+		if _, ok := err.(*MessageError); !ok {
+			t.Errorf("DeserializeTxLoc %s: wrong error - got %v <%T>, "+
+				"want MessageError", test.name, err, err)
+		}
+	}
+}
+
 // TestBlockSerializeSize performs tests to ensure the serialize size for
 // various blocks is accurate.
 func TestBlockSerializeSize(t *testing.T) {
@@ -0,0 +1,91 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/davecgh/go-spew/spew"
+)
+
+// TestBlockTxn tests the MsgBlockTxn API.
+func TestBlockTxn(t *testing.T) {
+	pver := ProtocolVersion
+	hash := blockOne.BlockHash()
+
+	msg := NewMsgBlockTxn(&hash)
+	if !msg.BlockHash.IsEqual(&hash) {
+		t.Errorf("NewMsgBlockTxn: wrong hash - got %v, want %v",
+			msg.BlockHash, hash)
+	}
+
+	// Ensure the command is expected value.
+	wantCmd := "blocktxn"
+	if cmd := msg.Command(); cmd != wantCmd {
+		t.Errorf("NewMsgBlockTxn: wrong command - got %v want %v",
+			cmd, wantCmd)
+	}
+
+	// Ensure max payload is expected value.
+	wantPayload := uint32(MaxBlockPayload)
+	maxPayload := msg.MaxPayloadLength(pver)
+	if maxPayload != wantPayload {
+		t.Errorf("MaxPayloadLength: wrong max payload length for "+
+			"protocol version %d - got %v, want %v", pver,
+			maxPayload, wantPayload)
+	}
+}
+
+// TestBlockTxnWire tests the MsgBlockTxn wire encode and decode.
+func TestBlockTxnWire(t *testing.T) {
+	hash := blockOne.BlockHash()
+	msg := NewMsgBlockTxn(&hash)
+	msg.AddTransaction(blockOne.Transactions[0])
+	msg.AddTransaction(multiTx)
+
+	var want bytes.Buffer
+	want.Write(hash[:])
+	want.WriteByte(0x02)
+	blockOne.Transactions[0].BtcEncode(&want, ProtocolVersion)
+	multiTx.BtcEncode(&want, ProtocolVersion)
+	encoded := want.Bytes()
+
+	var buf bytes.Buffer
+	if err := msg.BtcEncode(&buf, ProtocolVersion); err != nil {
+		t.Fatalf("BtcEncode error %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), encoded) {
+		t.Fatalf("BtcEncode\n got: %s want: %s",
+			spew.Sdump(buf.Bytes()), spew.Sdump(encoded))
+	}
+
+	var readMsg MsgBlockTxn
+	if err := readMsg.BtcDecode(&buf, ProtocolVersion); err != nil {
+		t.Fatalf("BtcDecode error %v", err)
+	}
+	if !reflect.DeepEqual(&readMsg, msg) {
+		t.Fatalf("BtcDecode\n got: %s want: %s", spew.Sdump(&readMsg),
+			spew.Sdump(msg))
+	}
+
+	// Ensure the message is rejected by older protocol versions.
+	err := readMsg.BtcDecode(bytes.NewReader(encoded), SendCmpctVersion-1)
+	if _, ok := err.(*MessageError); !ok {
+		t.Errorf("BtcDecode: wrong error for protocol version %d - "+
+			"got %v", SendCmpctVersion-1, err)
+	}
+
+	// Ensure every truncation of the encoding fails to decode.
+	for i := 0; i < len(encoded); i++ {
+		err := readMsg.BtcDecode(bytes.NewReader(encoded[:i]),
+			ProtocolVersion)
+		if err == nil {
+			t.Errorf("BtcDecode: truncated encoding of %d bytes "+
+				"accepted", i)
+		}
+	}
+}
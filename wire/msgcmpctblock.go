@@ -0,0 +1,292 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/bitgo/prova/chaincfg/chainhash"
+)
+
+const (
+	// ShortIDSize is the number of bytes a short transaction ID of a
+	// compact block is encoded with.
+	ShortIDSize = 6
+
+	// shortIDMask is the mask which truncates a SipHash output to the size
+	// of a short transaction ID.
+	shortIDMask = (1 << (8 * ShortIDSize)) - 1
+)
+
+// PrefilledTx defines a transaction which is sent in full as part of a
+// compact block along with its index in the block.
+type PrefilledTx struct {
+	Index uint32
+	Tx    *MsgTx
+}
+
+// MsgCmpctBlock implements the Message interface and represents a bitcoin
+// cmpctblock message.  It is used to relay a block as its header along with
+// a short ID for each transaction the receiver is expected to already know
+// about and the remaining transactions in full.  The short IDs and prefilled
+// transactions together describe all transactions of the block in order, the
+// prefilled transactions taking up their indexes and the short IDs filling
+// up the remaining ones.
+//
+// The short IDs are calculated with SipHash-2-4 over the hash of the
+// transaction including its signatures, so a transaction which only differs
+// in its signatures is never mistaken for the one in the block.  See
+// ShortIDKeys and ShortTxID.
+//
+// This message was not added until protocol versions starting with
+// SendCmpctVersion.
+type MsgCmpctBlock struct {
+	Header        BlockHeader
+	Nonce         uint64
+	ShortIDs      []uint64
+	PrefilledTxns []PrefilledTx
+}
+
+// AddShortID adds the short ID of a transaction to the message.
+func (msg *MsgCmpctBlock) AddShortID(id uint64) error {
+	maxTxPerBlock := messageLimits.maxTxPerBlock()
+	if uint64(len(msg.ShortIDs)+len(msg.PrefilledTxns)+1) > maxTxPerBlock {
+		str := fmt.Sprintf("too many transactions for message [max %v]",
+			maxTxPerBlock)
+		return limitError("MsgCmpctBlock.AddShortID",
+			LimitTxPerBlock, str)
+	}
+
+	msg.ShortIDs = append(msg.ShortIDs, id&shortIDMask)
+	return nil
+}
+
+// AddPrefilledTx adds a transaction which is sent in full to the message.
+// The transactions must be added in increasing order of their indexes.
+func (msg *MsgCmpctBlock) AddPrefilledTx(index uint32, tx *MsgTx) error {
+	maxTxPerBlock := messageLimits.maxTxPerBlock()
+	if uint64(len(msg.ShortIDs)+len(msg.PrefilledTxns)+1) > maxTxPerBlock {
+		str := fmt.Sprintf("too many transactions for message [max %v]",
+			maxTxPerBlock)
+		return limitError("MsgCmpctBlock.AddPrefilledTx",
+			LimitTxPerBlock, str)
+	}
+	if n := len(msg.PrefilledTxns); n > 0 &&
+		index <= msg.PrefilledTxns[n-1].Index {
+
+		str := fmt.Sprintf("prefilled transaction index %d does not "+
+			"follow index %d", index, msg.PrefilledTxns[n-1].Index)
+		return messageError("MsgCmpctBlock.AddPrefilledTx", str)
+	}
+
+	msg.PrefilledTxns = append(msg.PrefilledTxns, PrefilledTx{
+		Index: index,
+		Tx:    tx,
+	})
+	return nil
+}
+
+// TxCount returns the total number of transactions of the block described by
+// the message.
+func (msg *MsgCmpctBlock) TxCount() int {
+	return len(msg.ShortIDs) + len(msg.PrefilledTxns)
+}
+
+// ShortIDKeys returns the SipHash keys the short transaction IDs of the
+// message are calculated with.  They are derived from the single SHA256 of
+// the serialized header followed by the nonce, so they differ per block and
+// per nonce chosen by the sender.
+func (msg *MsgCmpctBlock) ShortIDKeys() (uint64, uint64) {
+	var buf bytes.Buffer
+	buf.Grow(MaxBlockHeaderPayload + 8)
+	_ = writeBlockHeader(&buf, 0, &msg.Header)
+	_ = writeElement(&buf, msg.Nonce)
+	key := chainhash.HashB(buf.Bytes())
+	return littleEndian.Uint64(key[0:8]), littleEndian.Uint64(key[8:16])
+}
+
+// ShortTxID returns the short ID for the passed hash of a transaction
+// including its signatures using the keys returned by ShortIDKeys.
+func ShortTxID(k0, k1 uint64, txHashWithSig *chainhash.Hash) uint64 {
+	return sipHash24(k0, k1, txHashWithSig) & shortIDMask
+}
+
+// BtcDecode decodes r using the bitcoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgCmpctBlock) BtcDecode(r io.Reader, pver uint32) error {
+	if pver < SendCmpctVersion {
+		str := fmt.Sprintf("cmpctblock message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgCmpctBlock.BtcDecode", str)
+	}
+
+	err := readBlockHeader(r, pver, &msg.Header)
+	if err != nil {
+		return err
+	}
+	err = readElement(r, &msg.Nonce)
+	if err != nil {
+		return err
+	}
+
+	// Limit to max transactions per block since the short IDs and the
+	// prefilled transactions together make up the transactions of a
+	// block.
+	count, err := ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+	if count > messageLimits.maxTxPerBlock() {
+		str := fmt.Sprintf("too many short ids for message "+
+			"[count %v, max %v]", count,
+			messageLimits.maxTxPerBlock())
+		return limitError("MsgCmpctBlock.BtcDecode",
+			LimitTxPerBlock, str)
+	}
+
+	var idBuf [8]byte
+	msg.ShortIDs = make([]uint64, 0, count)
+	for i := uint64(0); i < count; i++ {
+		_, err := io.ReadFull(r, idBuf[:ShortIDSize])
+		if err != nil {
+			return err
+		}
+		msg.ShortIDs = append(msg.ShortIDs, littleEndian.Uint64(idBuf[:]))
+	}
+
+	count, err = ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+	if count+uint64(len(msg.ShortIDs)) > messageLimits.maxTxPerBlock() {
+		str := fmt.Sprintf("too many transactions for message "+
+			"[count %v, max %v]", count+uint64(len(msg.ShortIDs)),
+			messageLimits.maxTxPerBlock())
+		return limitError("MsgCmpctBlock.BtcDecode",
+			LimitTxPerBlock, str)
+	}
+
+	// The indexes are differentially encoded, each one being the
+	// distance to the previous index minus one.
+	msg.PrefilledTxns = make([]PrefilledTx, 0, count)
+	nextIndex := uint64(0)
+	maxTxPerBlock := messageLimits.maxTxPerBlock()
+	for i := uint64(0); i < count; i++ {
+		diff, err := ReadVarInt(r, pver)
+		if err != nil {
+			return err
+		}
+		index := nextIndex + diff
+		if diff >= maxTxPerBlock || index >= maxTxPerBlock {
+			str := fmt.Sprintf("prefilled transaction index too "+
+				"large [index %v, max %v]", index, maxTxPerBlock)
+			return limitError("MsgCmpctBlock.BtcDecode",
+				LimitTxPerBlock, str)
+		}
+
+		tx := MsgTx{}
+		err = tx.BtcDecode(r, pver)
+		if err != nil {
+			return err
+		}
+		msg.PrefilledTxns = append(msg.PrefilledTxns, PrefilledTx{
+			Index: uint32(index),
+			Tx:    &tx,
+		})
+		nextIndex = index + 1
+	}
+
+	return nil
+}
+
+// BtcEncode encodes the receiver to w using the bitcoin protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgCmpctBlock) BtcEncode(w io.Writer, pver uint32) error {
+	if pver < SendCmpctVersion {
+		str := fmt.Sprintf("cmpctblock message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgCmpctBlock.BtcEncode", str)
+	}
+
+	if msg.TxCount() > int(messageLimits.maxTxPerBlock()) {
+		str := fmt.Sprintf("too many transactions for message "+
+			"[count %v, max %v]", msg.TxCount(),
+			messageLimits.maxTxPerBlock())
+		return limitError("MsgCmpctBlock.BtcEncode",
+			LimitTxPerBlock, str)
+	}
+
+	err := writeBlockHeader(w, pver, &msg.Header)
+	if err != nil {
+		return err
+	}
+	err = writeElement(w, msg.Nonce)
+	if err != nil {
+		return err
+	}
+
+	err = WriteVarInt(w, pver, uint64(len(msg.ShortIDs)))
+	if err != nil {
+		return err
+	}
+	var idBuf [8]byte
+	for _, id := range msg.ShortIDs {
+		littleEndian.PutUint64(idBuf[:], id)
+		_, err := w.Write(idBuf[:ShortIDSize])
+		if err != nil {
+			return err
+		}
+	}
+
+	err = WriteVarInt(w, pver, uint64(len(msg.PrefilledTxns)))
+	if err != nil {
+		return err
+	}
+	nextIndex := uint32(0)
+	for i := range msg.PrefilledTxns {
+		ptx := &msg.PrefilledTxns[i]
+		if ptx.Index < nextIndex {
+			str := fmt.Sprintf("prefilled transaction index %d is "+
+				"out of order", ptx.Index)
+			return messageError("MsgCmpctBlock.BtcEncode", str)
+		}
+		err := WriteVarInt(w, pver, uint64(ptx.Index-nextIndex))
+		if err != nil {
+			return err
+		}
+		err = ptx.Tx.BtcEncode(w, pver)
+		if err != nil {
+			return err
+		}
+		nextIndex = ptx.Index + 1
+	}
+
+	return nil
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgCmpctBlock) Command() string {
+	return CmdCmpctBlock
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgCmpctBlock) MaxPayloadLength(pver uint32) uint32 {
+	return messageLimits.MaxBlockPayload
+}
+
+// NewMsgCmpctBlock returns a new bitcoin cmpctblock message that conforms to
+// the Message interface.  See MsgCmpctBlock for details.
+func NewMsgCmpctBlock(header *BlockHeader, nonce uint64) *MsgCmpctBlock {
+	return &MsgCmpctBlock{
+		Header:        *header,
+		Nonce:         nonce,
+		ShortIDs:      make([]uint64, 0),
+		PrefilledTxns: make([]PrefilledTx, 0),
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/davecgh/go-spew/spew"
+)
+
+// TestSipHash24 ensures the SipHash-2-4 implementation matches the 32 byte
+// test vector of the reference implementation.
+func TestSipHash24(t *testing.T) {
+	var hash chainhash.Hash
+	for i := range hash {
+		hash[i] = byte(i)
+	}
+	k0 := uint64(0x0706050403020100)
+	k1 := uint64(0x0f0e0d0c0b0a0908)
+	if got, want := sipHash24(k0, k1, &hash), uint64(0x7127512f72f27cce); got != want {
+		t.Fatalf("sipHash24: got %x, want %x", got, want)
+	}
+	if got, want := ShortTxID(k0, k1, &hash), uint64(0x512f72f27cce); got != want {
+		t.Fatalf("ShortTxID: got %x, want %x", got, want)
+	}
+}
+
+// TestCmpctBlock tests the MsgCmpctBlock API.
+func TestCmpctBlock(t *testing.T) {
+	pver := ProtocolVersion
+
+	bh := &blockOne.Header
+	msg := NewMsgCmpctBlock(bh, 0x1122334455667788)
+	if !reflect.DeepEqual(&msg.Header, bh) || msg.Nonce != 0x1122334455667788 {
+		t.Errorf("NewMsgCmpctBlock: wrong fields - got %v",
+			spew.Sdump(msg))
+	}
+
+	// Ensure the command is expected value.
+	wantCmd := "cmpctblock"
+	if cmd := msg.Command(); cmd != wantCmd {
+		t.Errorf("NewMsgCmpctBlock: wrong command - got %v want %v",
+			cmd, wantCmd)
+	}
+
+	// Ensure max payload is expected value.
+	wantPayload := uint32(MaxBlockPayload)
+	maxPayload := msg.MaxPayloadLength(pver)
+	if maxPayload != wantPayload {
+		t.Errorf("MaxPayloadLength: wrong max payload length for "+
+			"protocol version %d - got %v, want %v", pver,
+			maxPayload, wantPayload)
+	}
+
+	// Ensure short IDs are truncated to their size.
+	if err := msg.AddShortID(0xffffffffffffffff); err != nil {
+		t.Fatalf("AddShortID: unexpected error %v", err)
+	}
+	if msg.ShortIDs[0] != 0xffffffffffff {
+		t.Errorf("AddShortID: short id not truncated - got %x",
+			msg.ShortIDs[0])
+	}
+
+	// Ensure prefilled transactions must be added in order.
+	tx := blockOne.Transactions[0]
+	if err := msg.AddPrefilledTx(2, tx); err != nil {
+		t.Fatalf("AddPrefilledTx: unexpected error %v", err)
+	}
+	if err := msg.AddPrefilledTx(2, tx); err == nil {
+		t.Errorf("AddPrefilledTx: duplicate index accepted")
+	}
+	if msg.TxCount() != 2 {
+		t.Errorf("TxCount: got %d, want 2", msg.TxCount())
+	}
+
+	// Ensure the short ID keys depend on the nonce.
+	k0, k1 := msg.ShortIDKeys()
+	msg.Nonce++
+	if k0b, k1b := msg.ShortIDKeys(); k0 == k0b && k1 == k1b {
+		t.Errorf("ShortIDKeys: keys do not depend on the nonce")
+	}
+}
+
+// TestCmpctBlockWire tests the MsgCmpctBlock wire encode and decode, in
+// particular the encoding of the short IDs and the differentially encoded
+// prefilled transaction indexes.
+func TestCmpctBlockWire(t *testing.T) {
+	pver := ProtocolVersion
+	tx := blockOne.Transactions[0]
+
+	msg := NewMsgCmpctBlock(&blockOne.Header, 0x0102030405060708)
+	msg.AddPrefilledTx(0, tx)
+	msg.AddShortID(0x060504030201)
+	msg.AddShortID(0x0c0b0a090807)
+	msg.AddPrefilledTx(3, tx)
+
+	var want bytes.Buffer
+	writeBlockHeader(&want, pver, &blockOne.Header)
+	want.Write([]byte{0x08, 0x07, 0x06, 0x05, 0x04, 0x03, 0x02, 0x01})
+	want.Write([]byte{
+		0x02, // Number of short ids
+		0x01, 0x02, 0x03, 0x04, 0x05, 0x06,
+		0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c,
+		0x02, // Number of prefilled transactions
+		0x00, // Index 0
+	})
+	tx.BtcEncode(&want, pver)
+	want.WriteByte(0x02) // Index 3 following index 0
+	tx.BtcEncode(&want, pver)
+
+	var buf bytes.Buffer
+	if err := msg.BtcEncode(&buf, pver); err != nil {
+		t.Fatalf("BtcEncode error %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), want.Bytes()) {
+		t.Fatalf("BtcEncode\n got: %s want: %s",
+			spew.Sdump(buf.Bytes()), spew.Sdump(want.Bytes()))
+	}
+
+	var readMsg MsgCmpctBlock
+	if err := readMsg.BtcDecode(&buf, pver); err != nil {
+		t.Fatalf("BtcDecode error %v", err)
+	}
+	if !reflect.DeepEqual(&readMsg, msg) {
+		t.Fatalf("BtcDecode\n got: %s want: %s", spew.Sdump(&readMsg),
+			spew.Sdump(msg))
+	}
+}
+
+// TestCmpctBlockWireErrors performs negative tests against wire encode and
+// decode of MsgCmpctBlock to confirm error paths work correctly.
+func TestCmpctBlockWireErrors(t *testing.T) {
+	pver := ProtocolVersion
+	msg := NewMsgCmpctBlock(&blockOne.Header, 0)
+	msg.AddShortID(1)
+
+	// Ensure the message is rejected by older protocol versions.
+	var buf bytes.Buffer
+	if err := msg.BtcEncode(&buf, SendCmpctVersion-1); err == nil {
+		t.Errorf("BtcEncode: accepted protocol version %d",
+			SendCmpctVersion-1)
+	}
+	if err := msg.BtcEncode(&buf, pver); err != nil {
+		t.Fatalf("BtcEncode error %v", err)
+	}
+	encoded := buf.Bytes()
+	var readMsg MsgCmpctBlock
+	err := readMsg.BtcDecode(bytes.NewReader(encoded), SendCmpctVersion-1)
+	if _, ok := err.(*MessageError); !ok {
+		t.Errorf("BtcDecode: wrong error for protocol version %d - "+
+			"got %v", SendCmpctVersion-1, err)
+	}
+
+	// Ensure every truncation of the encoding fails to decode.
+	for i := 0; i < len(encoded); i++ {
+		err := readMsg.BtcDecode(bytes.NewReader(encoded[:i]), pver)
+		if err == nil {
+			t.Errorf("BtcDecode: truncated encoding of %d bytes "+
+				"accepted", i)
+		}
+	}
+
+	// Ensure too many short ids and out of range prefilled indexes are
+	// rejected.
+	prefix := encoded[:MaxBlockHeaderPayload+8]
+	tests := [][]byte{
+		append(append([]byte{}, prefix...), 0xfe, 0xff, 0xff, 0xff, 0xff),
+		append(append([]byte{}, prefix...), 0x00, 0x01, 0xfe, 0xff,
+			0xff, 0xff, 0xff),
+	}
+	for i, test := range tests {
+		err := readMsg.BtcDecode(bytes.NewReader(test), pver)
+		if _, ok := err.(*MessageError); !ok {
+			t.Errorf("BtcDecode #%d: wrong error - got %v", i, err)
+		}
+	}
+}
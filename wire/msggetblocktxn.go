@@ -0,0 +1,160 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/bitgo/prova/chaincfg/chainhash"
+)
+
+// MsgGetBlockTxn implements the Message interface and represents a bitcoin
+// getblocktxn message.  It is used to request the transactions at the given
+// indexes of a block which was received as a compact block and could not be
+// reconstructed from the transactions already known about.  The transactions
+// are sent back with a blocktxn message.
+//
+// This message was not added until protocol versions starting with
+// SendCmpctVersion.
+type MsgGetBlockTxn struct {
+	BlockHash chainhash.Hash
+	Indexes   []uint32
+}
+
+// AddIndex adds the index of a requested transaction to the message.  The
+// indexes must be added in increasing order.
+func (msg *MsgGetBlockTxn) AddIndex(index uint32) error {
+	if len(msg.Indexes)+1 > int(messageLimits.maxTxPerBlock()) {
+		str := fmt.Sprintf("too many indexes for message [max %v]",
+			messageLimits.maxTxPerBlock())
+		return limitError("MsgGetBlockTxn.AddIndex",
+			LimitTxPerBlock, str)
+	}
+	if n := len(msg.Indexes); n > 0 && index <= msg.Indexes[n-1] {
+		str := fmt.Sprintf("index %d does not follow index %d", index,
+			msg.Indexes[n-1])
+		return messageError("MsgGetBlockTxn.AddIndex", str)
+	}
+
+	msg.Indexes = append(msg.Indexes, index)
+	return nil
+}
+
+// BtcDecode decodes r using the bitcoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgGetBlockTxn) BtcDecode(r io.Reader, pver uint32) error {
+	if pver < SendCmpctVersion {
+		str := fmt.Sprintf("getblocktxn message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgGetBlockTxn.BtcDecode", str)
+	}
+
+	err := readElement(r, &msg.BlockHash)
+	if err != nil {
+		return err
+	}
+
+	count, err := ReadVarInt(r, pver)
+	if err != nil {
+		return err
+	}
+	if count > messageLimits.maxTxPerBlock() {
+		str := fmt.Sprintf("too many indexes for message "+
+			"[count %v, max %v]", count,
+			messageLimits.maxTxPerBlock())
+		return limitError("MsgGetBlockTxn.BtcDecode",
+			LimitTxPerBlock, str)
+	}
+
+	// The indexes are differentially encoded, each one being the
+	// distance to the previous index minus one.
+	msg.Indexes = make([]uint32, 0, count)
+	nextIndex := uint64(0)
+	maxTxPerBlock := messageLimits.maxTxPerBlock()
+	for i := uint64(0); i < count; i++ {
+		diff, err := ReadVarInt(r, pver)
+		if err != nil {
+			return err
+		}
+		index := nextIndex + diff
+		if diff >= maxTxPerBlock || index >= maxTxPerBlock {
+			str := fmt.Sprintf("transaction index too large "+
+				"[index %v, max %v]", index, maxTxPerBlock)
+			return limitError("MsgGetBlockTxn.BtcDecode",
+				LimitTxPerBlock, str)
+		}
+		msg.Indexes = append(msg.Indexes, uint32(index))
+		nextIndex = index + 1
+	}
+
+	return nil
+}
+
+// BtcEncode encodes the receiver to w using the bitcoin protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgGetBlockTxn) BtcEncode(w io.Writer, pver uint32) error {
+	if pver < SendCmpctVersion {
+		str := fmt.Sprintf("getblocktxn message invalid for protocol "+
+			"version %d", pver)
+		return messageError("MsgGetBlockTxn.BtcEncode", str)
+	}
+
+	count := len(msg.Indexes)
+	if count > int(messageLimits.maxTxPerBlock()) {
+		str := fmt.Sprintf("too many indexes for message "+
+			"[count %v, max %v]", count,
+			messageLimits.maxTxPerBlock())
+		return limitError("MsgGetBlockTxn.BtcEncode",
+			LimitTxPerBlock, str)
+	}
+
+	err := writeElement(w, &msg.BlockHash)
+	if err != nil {
+		return err
+	}
+	err = WriteVarInt(w, pver, uint64(count))
+	if err != nil {
+		return err
+	}
+	nextIndex := uint32(0)
+	for _, index := range msg.Indexes {
+		if index < nextIndex {
+			str := fmt.Sprintf("transaction index %d is out of "+
+				"order", index)
+			return messageError("MsgGetBlockTxn.BtcEncode", str)
+		}
+		err := WriteVarInt(w, pver, uint64(index-nextIndex))
+		if err != nil {
+			return err
+		}
+		nextIndex = index + 1
+	}
+
+	return nil
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgGetBlockTxn) Command() string {
+	return CmdGetBlockTxn
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgGetBlockTxn) MaxPayloadLength(pver uint32) uint32 {
+	// Block hash + num indexes (varInt) + max allowed indexes, each of
+	// which takes at most 3 bytes as a varint.
+	return chainhash.HashSize + MaxVarIntPayload + (uint32(messageLimits.maxTxPerBlock()) * 3)
+}
+
+// NewMsgGetBlockTxn returns a new bitcoin getblocktxn message that conforms to
+// the Message interface.  See MsgGetBlockTxn for details.
+func NewMsgGetBlockTxn(blockHash *chainhash.Hash) *MsgGetBlockTxn {
+	return &MsgGetBlockTxn{
+		BlockHash: *blockHash,
+		Indexes:   make([]uint32, 0),
+	}
+}
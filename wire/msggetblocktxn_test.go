@@ -0,0 +1,109 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/davecgh/go-spew/spew"
+)
+
+// TestGetBlockTxn tests the MsgGetBlockTxn API.
+func TestGetBlockTxn(t *testing.T) {
+	pver := ProtocolVersion
+	hash := blockOne.BlockHash()
+
+	msg := NewMsgGetBlockTxn(&hash)
+	if !msg.BlockHash.IsEqual(&hash) {
+		t.Errorf("NewMsgGetBlockTxn: wrong hash - got %v, want %v",
+			msg.BlockHash, hash)
+	}
+
+	// Ensure the command is expected value.
+	wantCmd := "getblocktxn"
+	if cmd := msg.Command(); cmd != wantCmd {
+		t.Errorf("NewMsgGetBlockTxn: wrong command - got %v want %v",
+			cmd, wantCmd)
+	}
+
+	// Ensure max payload is expected value.
+	wantPayload := uint32(chainhash.HashSize + 9 + messageLimits.maxTxPerBlock()*3)
+	maxPayload := msg.MaxPayloadLength(pver)
+	if maxPayload != wantPayload {
+		t.Errorf("MaxPayloadLength: wrong max payload length for "+
+			"protocol version %d - got %v, want %v", pver,
+			maxPayload, wantPayload)
+	}
+
+	// Ensure indexes must be added in order.
+	if err := msg.AddIndex(1); err != nil {
+		t.Fatalf("AddIndex: unexpected error %v", err)
+	}
+	if err := msg.AddIndex(1); err == nil {
+		t.Errorf("AddIndex: duplicate index accepted")
+	}
+}
+
+// TestGetBlockTxnWire tests the MsgGetBlockTxn wire encode and decode.
+func TestGetBlockTxnWire(t *testing.T) {
+	hash := chainhash.Hash{0x01, 0x02}
+	msg := NewMsgGetBlockTxn(&hash)
+	for _, index := range []uint32{0, 1, 5, 300} {
+		msg.AddIndex(index)
+	}
+	encoded := append(hash[:],
+		0x04,             // Number of indexes
+		0x00,             // Index 0
+		0x00,             // Index 1
+		0x03,             // Index 5
+		0xfd, 0x26, 0x01, // Index 300
+	)
+
+	var buf bytes.Buffer
+	if err := msg.BtcEncode(&buf, ProtocolVersion); err != nil {
+		t.Fatalf("BtcEncode error %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), encoded) {
+		t.Fatalf("BtcEncode\n got: %s want: %s",
+			spew.Sdump(buf.Bytes()), spew.Sdump(encoded))
+	}
+
+	var readMsg MsgGetBlockTxn
+	if err := readMsg.BtcDecode(&buf, ProtocolVersion); err != nil {
+		t.Fatalf("BtcDecode error %v", err)
+	}
+	if !reflect.DeepEqual(&readMsg, msg) {
+		t.Fatalf("BtcDecode\n got: %s want: %s", spew.Sdump(&readMsg),
+			spew.Sdump(msg))
+	}
+
+	// Ensure the message is rejected by older protocol versions.
+	err := readMsg.BtcDecode(bytes.NewReader(encoded), SendCmpctVersion-1)
+	if _, ok := err.(*MessageError); !ok {
+		t.Errorf("BtcDecode: wrong error for protocol version %d - "+
+			"got %v", SendCmpctVersion-1, err)
+	}
+
+	// Ensure every truncation of the encoding fails to decode.
+	for i := 0; i < len(encoded); i++ {
+		err := readMsg.BtcDecode(bytes.NewReader(encoded[:i]),
+			ProtocolVersion)
+		if err == nil {
+			t.Errorf("BtcDecode: truncated encoding of %d bytes "+
+				"accepted", i)
+		}
+	}
+
+	// Ensure an index beyond the max transactions per block is rejected.
+	tooLarge := append(hash[:], 0x01, 0xfe, 0xff, 0xff, 0xff, 0x00)
+	err = readMsg.BtcDecode(bytes.NewReader(tooLarge), ProtocolVersion)
+	if _, ok := err.(*MessageError); !ok {
+		t.Errorf("BtcDecode: wrong error for index too large - got %v",
+			err)
+	}
+}
@@ -26,10 +26,10 @@ type MsgGetData struct {
 
 // AddInvVect adds an inventory vector to the message.
 func (msg *MsgGetData) AddInvVect(iv *InvVect) error {
-	if len(msg.InvList)+1 > MaxInvPerMsg {
+	if len(msg.InvList)+1 > int(messageLimits.MaxInvPerMsg) {
 		str := fmt.Sprintf("too many invvect in message [max %v]",
-			MaxInvPerMsg)
-		return messageError("MsgGetData.AddInvVect", str)
+			messageLimits.MaxInvPerMsg)
+		return limitError("MsgGetData.AddInvVect", LimitInvPerMsg, str)
 	}
 
 	msg.InvList = append(msg.InvList, iv)
@@ -45,9 +45,9 @@ func (msg *MsgGetData) BtcDecode(r io.Reader, pver uint32) error {
 	}
 
 	// Limit to max inventory vectors per message.
-	if count > MaxInvPerMsg {
+	if count > uint64(messageLimits.MaxInvPerMsg) {
 		str := fmt.Sprintf("too many invvect in message [%v]", count)
-		return messageError("MsgGetData.BtcDecode", str)
+		return limitError("MsgGetData.BtcDecode", LimitInvPerMsg, str)
 	}
 
 	// Create a contiguous slice of inventory vectors to deserialize into in
@@ -71,9 +71,9 @@ func (msg *MsgGetData) BtcDecode(r io.Reader, pver uint32) error {
 func (msg *MsgGetData) BtcEncode(w io.Writer, pver uint32) error {
 	// Limit to max inventory vectors per message.
 	count := len(msg.InvList)
-	if count > MaxInvPerMsg {
+	if count > int(messageLimits.MaxInvPerMsg) {
 		str := fmt.Sprintf("too many invvect in message [%v]", count)
-		return messageError("MsgGetData.BtcEncode", str)
+		return limitError("MsgGetData.BtcEncode", LimitInvPerMsg, str)
 	}
 
 	err := WriteVarInt(w, pver, uint64(count))
@@ -101,7 +101,7 @@ func (msg *MsgGetData) Command() string {
 // receiver.  This is part of the Message interface implementation.
 func (msg *MsgGetData) MaxPayloadLength(pver uint32) uint32 {
 	// Num inventory vectors (varInt) + max allowed inventory vectors.
-	return MaxVarIntPayload + (MaxInvPerMsg * maxInvVectPayload)
+	return MaxVarIntPayload + (messageLimits.MaxInvPerMsg * maxInvVectPayload)
 }
 
 // NewMsgGetData returns a new bitcoin getdata message that conforms to the
@@ -124,8 +124,8 @@ func NewMsgGetData() *MsgGetData {
 // hint is limited to MaxInvPerMsg.
 func NewMsgGetDataSizeHint(sizeHint uint) *MsgGetData {
 	// Limit the specified hint to the maximum allow per message.
-	if sizeHint > MaxInvPerMsg {
-		sizeHint = MaxInvPerMsg
+	if sizeHint > uint(messageLimits.MaxInvPerMsg) {
+		sizeHint = uint(messageLimits.MaxInvPerMsg)
 	}
 
 	return &MsgGetData{
@@ -25,10 +25,11 @@ type MsgHeaders struct {
 
 // AddBlockHeader adds a new block header to the message.
 func (msg *MsgHeaders) AddBlockHeader(bh *BlockHeader) error {
-	if len(msg.Headers)+1 > MaxBlockHeadersPerMsg {
+	if len(msg.Headers)+1 > int(messageLimits.MaxBlockHeadersPerMsg) {
 		str := fmt.Sprintf("too many block headers in message [max %v]",
-			MaxBlockHeadersPerMsg)
-		return messageError("MsgHeaders.AddBlockHeader", str)
+			messageLimits.MaxBlockHeadersPerMsg)
+		return limitError("MsgHeaders.AddBlockHeader",
+			LimitBlockHeadersPerMsg, str)
 	}
 
 	msg.Headers = append(msg.Headers, bh)
@@ -44,10 +45,12 @@ func (msg *MsgHeaders) BtcDecode(r io.Reader, pver uint32) error {
 	}
 
 	// Limit to max block headers per message.
-	if count > MaxBlockHeadersPerMsg {
+	if count > uint64(messageLimits.MaxBlockHeadersPerMsg) {
 		str := fmt.Sprintf("too many block headers for message "+
-			"[count %v, max %v]", count, MaxBlockHeadersPerMsg)
-		return messageError("MsgHeaders.BtcDecode", str)
+			"[count %v, max %v]", count,
+			messageLimits.MaxBlockHeadersPerMsg)
+		return limitError("MsgHeaders.BtcDecode",
+			LimitBlockHeadersPerMsg, str)
 	}
 
 	// Create a contiguous slice of headers to deserialize into in order to
@@ -83,10 +86,12 @@ func (msg *MsgHeaders) BtcDecode(r io.Reader, pver uint32) error {
 func (msg *MsgHeaders) BtcEncode(w io.Writer, pver uint32) error {
 	// Limit to max block headers per message.
 	count := len(msg.Headers)
-	if count > MaxBlockHeadersPerMsg {
+	if count > int(messageLimits.MaxBlockHeadersPerMsg) {
 		str := fmt.Sprintf("too many block headers for message "+
-			"[count %v, max %v]", count, MaxBlockHeadersPerMsg)
-		return messageError("MsgHeaders.BtcEncode", str)
+			"[count %v, max %v]", count,
+			messageLimits.MaxBlockHeadersPerMsg)
+		return limitError("MsgHeaders.BtcEncode",
+			LimitBlockHeadersPerMsg, str)
 	}
 
 	err := WriteVarInt(w, pver, uint64(count))
@@ -125,7 +130,7 @@ func (msg *MsgHeaders) MaxPayloadLength(pver uint32) uint32 {
 	// Num headers (varInt) + max allowed headers (header length + 1 byte
 	// for the number of transactions which is always 0).
 	return MaxVarIntPayload + ((MaxBlockHeaderPayload + 1) *
-		MaxBlockHeadersPerMsg)
+		messageLimits.MaxBlockHeadersPerMsg)
 }
 
 // NewMsgHeaders returns a new bitcoin headers message that conforms to the
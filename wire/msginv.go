@@ -34,10 +34,10 @@ type MsgInv struct {
 
 // AddInvVect adds an inventory vector to the message.
 func (msg *MsgInv) AddInvVect(iv *InvVect) error {
-	if len(msg.InvList)+1 > MaxInvPerMsg {
+	if len(msg.InvList)+1 > int(messageLimits.MaxInvPerMsg) {
 		str := fmt.Sprintf("too many invvect in message [max %v]",
-			MaxInvPerMsg)
-		return messageError("MsgInv.AddInvVect", str)
+			messageLimits.MaxInvPerMsg)
+		return limitError("MsgInv.AddInvVect", LimitInvPerMsg, str)
 	}
 
 	msg.InvList = append(msg.InvList, iv)
@@ -53,9 +53,9 @@ func (msg *MsgInv) BtcDecode(r io.Reader, pver uint32) error {
 	}
 
 	// Limit to max inventory vectors per message.
-	if count > MaxInvPerMsg {
+	if count > uint64(messageLimits.MaxInvPerMsg) {
 		str := fmt.Sprintf("too many invvect in message [%v]", count)
-		return messageError("MsgInv.BtcDecode", str)
+		return limitError("MsgInv.BtcDecode", LimitInvPerMsg, str)
 	}
 
 	// Create a contiguous slice of inventory vectors to deserialize into in
@@ -79,9 +79,9 @@ func (msg *MsgInv) BtcDecode(r io.Reader, pver uint32) error {
 func (msg *MsgInv) BtcEncode(w io.Writer, pver uint32) error {
 	// Limit to max inventory vectors per message.
 	count := len(msg.InvList)
-	if count > MaxInvPerMsg {
+	if count > int(messageLimits.MaxInvPerMsg) {
 		str := fmt.Sprintf("too many invvect in message [%v]", count)
-		return messageError("MsgInv.BtcEncode", str)
+		return limitError("MsgInv.BtcEncode", LimitInvPerMsg, str)
 	}
 
 	err := WriteVarInt(w, pver, uint64(count))
@@ -109,7 +109,7 @@ func (msg *MsgInv) Command() string {
 // receiver.  This is part of the Message interface implementation.
 func (msg *MsgInv) MaxPayloadLength(pver uint32) uint32 {
 	// Num inventory vectors (varInt) + max allowed inventory vectors.
-	return MaxVarIntPayload + (MaxInvPerMsg * maxInvVectPayload)
+	return MaxVarIntPayload + (messageLimits.MaxInvPerMsg * maxInvVectPayload)
 }
 
 // NewMsgInv returns a new bitcoin inv message that conforms to the Message
@@ -132,8 +132,8 @@ func NewMsgInv() *MsgInv {
 // limited to MaxInvPerMsg.
 func NewMsgInvSizeHint(sizeHint uint) *MsgInv {
 	// Limit the specified hint to the maximum allow per message.
-	if sizeHint > MaxInvPerMsg {
-		sizeHint = MaxInvPerMsg
+	if sizeHint > uint(messageLimits.MaxInvPerMsg) {
+		sizeHint = uint(messageLimits.MaxInvPerMsg)
 	}
 
 	return &MsgInv{
@@ -12,11 +12,13 @@ import (
 	"github.com/bitgo/prova/chaincfg/chainhash"
 )
 
-// maxFlagsPerMerkleBlock is the maximum number of flag bytes that could
+// maxFlagsPerMerkleBlock returns the maximum number of flag bytes that could
 // possibly fit into a merkle block.  Since each transaction is represented by
 // a single bit, this is the max number of transactions per block divided by
 // 8 bits per byte.  Then an extra one to cover partials.
-const maxFlagsPerMerkleBlock = maxTxPerBlock / 8
+func maxFlagsPerMerkleBlock() uint64 {
+	return messageLimits.maxTxPerBlock() / 8
+}
 
 // MsgMerkleBlock implements the Message interface and represents a bitcoin
 // merkleblock message which is used to reset a Bloom filter.
@@ -31,10 +33,11 @@ type MsgMerkleBlock struct {
 
 // AddTxHash adds a new transaction hash to the message.
 func (msg *MsgMerkleBlock) AddTxHash(hash *chainhash.Hash) error {
-	if len(msg.Hashes)+1 > maxTxPerBlock {
+	if len(msg.Hashes)+1 > int(messageLimits.maxTxPerBlock()) {
 		str := fmt.Sprintf("too many tx hashes for message [max %v]",
-			maxTxPerBlock)
-		return messageError("MsgMerkleBlock.AddTxHash", str)
+			messageLimits.maxTxPerBlock())
+		return limitError("MsgMerkleBlock.AddTxHash",
+			LimitTxPerBlock, str)
 	}
 
 	msg.Hashes = append(msg.Hashes, hash)
@@ -65,10 +68,12 @@ func (msg *MsgMerkleBlock) BtcDecode(r io.Reader, pver uint32) error {
 	if err != nil {
 		return err
 	}
-	if count > maxTxPerBlock {
+	if count > messageLimits.maxTxPerBlock() {
 		str := fmt.Sprintf("too many transaction hashes for message "+
-			"[count %v, max %v]", count, maxTxPerBlock)
-		return messageError("MsgMerkleBlock.BtcDecode", str)
+			"[count %v, max %v]", count,
+			messageLimits.maxTxPerBlock())
+		return limitError("MsgMerkleBlock.BtcDecode",
+			LimitTxPerBlock, str)
 	}
 
 	// Create a contiguous slice of hashes to deserialize into in order to
@@ -84,8 +89,8 @@ func (msg *MsgMerkleBlock) BtcDecode(r io.Reader, pver uint32) error {
 		msg.AddTxHash(hash)
 	}
 
-	msg.Flags, err = ReadVarBytes(r, pver, maxFlagsPerMerkleBlock,
-		"merkle block flags size")
+	msg.Flags, err = ReadVarBytes(r, pver,
+		uint32(maxFlagsPerMerkleBlock()), "merkle block flags size")
 	return err
 }
 
@@ -100,16 +105,19 @@ func (msg *MsgMerkleBlock) BtcEncode(w io.Writer, pver uint32) error {
 
 	// Read num transaction hashes and limit to max.
 	numHashes := len(msg.Hashes)
-	if numHashes > maxTxPerBlock {
+	if numHashes > int(messageLimits.maxTxPerBlock()) {
 		str := fmt.Sprintf("too many transaction hashes for message "+
-			"[count %v, max %v]", numHashes, maxTxPerBlock)
-		return messageError("MsgMerkleBlock.BtcDecode", str)
+			"[count %v, max %v]", numHashes,
+			messageLimits.maxTxPerBlock())
+		return limitError("MsgMerkleBlock.BtcDecode",
+			LimitTxPerBlock, str)
 	}
 	numFlagBytes := len(msg.Flags)
-	if numFlagBytes > maxFlagsPerMerkleBlock {
+	if uint64(numFlagBytes) > maxFlagsPerMerkleBlock() {
 		str := fmt.Sprintf("too many flag bytes for message [count %v, "+
-			"max %v]", numFlagBytes, maxFlagsPerMerkleBlock)
-		return messageError("MsgMerkleBlock.BtcDecode", str)
+			"max %v]", numFlagBytes, maxFlagsPerMerkleBlock())
+		return limitError("MsgMerkleBlock.BtcDecode",
+			LimitTxPerBlock, str)
 	}
 
 	err := writeBlockHeader(w, pver, &msg.Header)
@@ -145,7 +153,7 @@ func (msg *MsgMerkleBlock) Command() string {
 // MaxPayloadLength returns the maximum length the payload can be for the
 // receiver.  This is part of the Message interface implementation.
 func (msg *MsgMerkleBlock) MaxPayloadLength(pver uint32) uint32 {
-	return MaxBlockPayload
+	return messageLimits.MaxBlockPayload
 }
 
 // NewMsgMerkleBlock returns a new bitcoin merkleblock message that conforms to
@@ -23,10 +23,10 @@ type MsgNotFound struct {
 
 // AddInvVect adds an inventory vector to the message.
 func (msg *MsgNotFound) AddInvVect(iv *InvVect) error {
-	if len(msg.InvList)+1 > MaxInvPerMsg {
+	if len(msg.InvList)+1 > int(messageLimits.MaxInvPerMsg) {
 		str := fmt.Sprintf("too many invvect in message [max %v]",
-			MaxInvPerMsg)
-		return messageError("MsgNotFound.AddInvVect", str)
+			messageLimits.MaxInvPerMsg)
+		return limitError("MsgNotFound.AddInvVect", LimitInvPerMsg, str)
 	}
 
 	msg.InvList = append(msg.InvList, iv)
@@ -42,9 +42,9 @@ func (msg *MsgNotFound) BtcDecode(r io.Reader, pver uint32) error {
 	}
 
 	// Limit to max inventory vectors per message.
-	if count > MaxInvPerMsg {
+	if count > uint64(messageLimits.MaxInvPerMsg) {
 		str := fmt.Sprintf("too many invvect in message [%v]", count)
-		return messageError("MsgNotFound.BtcDecode", str)
+		return limitError("MsgNotFound.BtcDecode", LimitInvPerMsg, str)
 	}
 
 	// Create a contiguous slice of inventory vectors to deserialize into in
@@ -68,9 +68,9 @@ func (msg *MsgNotFound) BtcDecode(r io.Reader, pver uint32) error {
 func (msg *MsgNotFound) BtcEncode(w io.Writer, pver uint32) error {
 	// Limit to max inventory vectors per message.
 	count := len(msg.InvList)
-	if count > MaxInvPerMsg {
+	if count > int(messageLimits.MaxInvPerMsg) {
 		str := fmt.Sprintf("too many invvect in message [%v]", count)
-		return messageError("MsgNotFound.BtcEncode", str)
+		return limitError("MsgNotFound.BtcEncode", LimitInvPerMsg, str)
 	}
 
 	err := WriteVarInt(w, pver, uint64(count))
@@ -99,7 +99,7 @@ func (msg *MsgNotFound) Command() string {
 func (msg *MsgNotFound) MaxPayloadLength(pver uint32) uint32 {
 	// Max var int 9 bytes + max InvVects at 36 bytes each.
 	// Num inventory vectors (varInt) + max allowed inventory vectors.
-	return MaxVarIntPayload + (MaxInvPerMsg * maxInvVectPayload)
+	return MaxVarIntPayload + (messageLimits.MaxInvPerMsg * maxInvVectPayload)
 }
 
 // NewMsgNotFound returns a new bitcoin notfound message that conforms to the
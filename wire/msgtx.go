@@ -6,10 +6,10 @@
 package wire
 
 import (
-	"bytes"
 	"fmt"
 	"io"
 	"strconv"
+	"sync/atomic"
 
 	"github.com/bitgo/prova/chaincfg/chainhash"
 )
@@ -251,6 +251,13 @@ type MsgTx struct {
 	TxIn     []*TxIn
 	TxOut    []*TxOut
 	LockTime uint32
+
+	// cachedSize is the serialized size memoized by SerializeSizeCached,
+	// or zero when it has not been computed yet.  It is accessed
+	// atomically.  Since it is not part of the transaction, transactions
+	// which may have memoized their size must be compared through Copy,
+	// which resets it, when comparing them with reflect.DeepEqual.
+	cachedSize int64
 }
 
 // AddTxIn adds a transaction input to the message.
@@ -270,9 +277,11 @@ func (msg *MsgTx) TxHash() chainhash.Hash {
 	// Ignore the error returns since the only way the encode could fail
 	// is being out of memory or due to nil pointers, both of which would
 	// cause a run-time panic.
-	buf := bytes.NewBuffer(make([]byte, 0, msg.SerializeSize()))
-	_ = msg.SerializeStripped(buf)
-	return chainhash.DoubleHashH(buf.Bytes())
+	buf := borrowEncodeBuf()
+	*buf = msg.SerializeStrippedBuf(*buf)
+	hash := chainhash.DoubleHashH(*buf)
+	returnEncodeBuf(buf)
+	return hash
 }
 
 // TxHash generates the Hash for the transaction.
@@ -281,9 +290,11 @@ func (msg *MsgTx) TxHashWithSig() chainhash.Hash {
 	// Ignore the error returns since the only way the encode could fail
 	// is being out of memory or due to nil pointers, both of which would
 	// cause a run-time panic.
-	buf := bytes.NewBuffer(make([]byte, 0, msg.SerializeSize()))
-	_ = msg.Serialize(buf)
-	return chainhash.DoubleHashH(buf.Bytes())
+	buf := borrowEncodeBuf()
+	*buf = msg.SerializeBuf(*buf)
+	hash := chainhash.DoubleHashH(*buf)
+	returnEncodeBuf(buf)
+	return hash
 }
 
 // Copy creates a deep copy of a transaction so that the original does not get
@@ -353,6 +364,10 @@ func (msg *MsgTx) Copy() *MsgTx {
 // See Deserialize for decoding transactions stored to disk, such as in a
 // database, as opposed to decoding transactions from the wire.
 func (msg *MsgTx) BtcDecode(r io.Reader, pver uint32) error {
+	// The decoded transaction replaces any previous contents, so the
+	// memoized size no longer applies.
+	atomic.StoreInt64(&msg.cachedSize, 0)
+
 	version, err := binarySerializer.Uint32(r, littleEndian)
 	if err != nil {
 		return err
@@ -588,6 +603,54 @@ func (msg *MsgTx) SerializeStripped(w io.Writer) error {
 
 }
 
+// btcEncodeBuf appends the bitcoin protocol encoding of the transaction to buf
+// and returns the extended buffer.  The encoding is the same as the one of
+// btcEncode, including the optional stripping of the scriptSigs.
+func (msg *MsgTx) btcEncodeBuf(buf []byte, pver uint32, strip bool) []byte {
+	buf = appendUint32(buf, uint32(msg.Version))
+
+	buf = appendVarInt(buf, uint64(len(msg.TxIn)))
+	for _, ti := range msg.TxIn {
+		buf = append(buf, ti.PreviousOutPoint.Hash[:]...)
+		buf = appendUint32(buf, ti.PreviousOutPoint.Index)
+		if strip {
+			buf = appendVarInt(buf, 0)
+		} else {
+			buf = appendVarBytes(buf, ti.SignatureScript)
+		}
+		buf = appendUint32(buf, ti.Sequence)
+	}
+
+	buf = appendVarInt(buf, uint64(len(msg.TxOut)))
+	for _, to := range msg.TxOut {
+		buf = appendUint64(buf, uint64(to.Value))
+		buf = appendVarBytes(buf, to.PkScript)
+	}
+
+	return appendUint32(buf, msg.LockTime)
+}
+
+// BtcEncodeBuf appends the bitcoin protocol encoding of the transaction to buf
+// and returns the extended buffer, in the same way as the built-in append.  It
+// produces the same bytes as BtcEncode, but does not allocate when buf has
+// enough capacity for the encoded transaction, which SerializeSize reports.
+func (msg *MsgTx) BtcEncodeBuf(buf []byte, pver uint32) []byte {
+	return msg.btcEncodeBuf(buf, pver, false)
+}
+
+// SerializeBuf appends the serialized transaction to buf and returns the
+// extended buffer.  It produces the same bytes as Serialize.  See BtcEncodeBuf
+// for details.
+func (msg *MsgTx) SerializeBuf(buf []byte) []byte {
+	return msg.btcEncodeBuf(buf, 0, false)
+}
+
+// SerializeStrippedBuf is like SerializeBuf, except inputs have no
+// scriptSigs.  It produces the same bytes as SerializeStripped.
+func (msg *MsgTx) SerializeStrippedBuf(buf []byte) []byte {
+	return msg.btcEncodeBuf(buf, 0, true)
+}
+
 // serializeSize returns the number of bytes it would take to serialize the
 // transaction, excluding any scriptSigs in the inputs, if strip == true
 func (msg *MsgTx) serializeSize(strip bool) int {
@@ -621,6 +684,20 @@ func (msg *MsgTx) SerializeSize() int {
 	return msg.serializeSize(false)
 }
 
+// SerializeSizeCached returns the same value as SerializeSize, but memoizes it
+// on first use so later calls do not walk the inputs and outputs again.  The
+// transaction MUST NOT be modified once this function has been called, except
+// by decoding into it, since the memoized size is not invalidated otherwise.
+// Copy returns a transaction which does not carry the memoized size over.
+func (msg *MsgTx) SerializeSizeCached() int {
+	if size := atomic.LoadInt64(&msg.cachedSize); size != 0 {
+		return int(size)
+	}
+	size := msg.serializeSize(false)
+	atomic.StoreInt64(&msg.cachedSize, int64(size))
+	return size
+}
+
 // SerializeSizeStripped returns the number of bytes it would take to serialize the
 // transaction, excluding any scriptSigs in the inputs.
 func (msg *MsgTx) SerializeSizeStripped() int {
@@ -636,7 +713,7 @@ func (msg *MsgTx) Command() string {
 // MaxPayloadLength returns the maximum length the payload can be for the
 // receiver.  This is part of the Message interface implementation.
 func (msg *MsgTx) MaxPayloadLength(pver uint32) uint32 {
-	return MaxBlockPayload
+	return messageLimits.MaxBlockPayload
 }
 
 // PkScriptLocs returns a slice containing the start of each public key script
@@ -701,6 +701,74 @@ func TestTxOverflowErrors(t *testing.T) {
 	}
 }
 
+// TestTxNonCanonicalVarInt ensures transactions which encode any of their
+// counts or script lengths with a non-canonical varint are rejected.  There is
+// no lenient decoding mode since accepting such encodings would allow the
+// serialization, and therefore the hash, of a transaction to be malleated.
+func TestTxNonCanonicalVarInt(t *testing.T) {
+	pver := ProtocolVersion
+
+	// prevOut is the encoded previous outpoint of the transaction input.
+	prevOut := append(make([]byte, 32), 0xff, 0xff, 0xff, 0xff)
+
+	// encode returns a transaction with a single input with an empty
+	// signature script and a single output with a one byte public key
+	// script, where the passed varint encodings replace the canonical
+	// ones.
+	encode := func(inCount, sigScriptLen, outCount, pkScriptLen []byte) []byte {
+		var buf []byte
+		buf = append(buf, 0x01, 0x00, 0x00, 0x00) // Version
+		buf = append(buf, inCount...)
+		buf = append(buf, prevOut...)
+		buf = append(buf, sigScriptLen...)
+		buf = append(buf, 0xff, 0xff, 0xff, 0xff) // Sequence
+		buf = append(buf, outCount...)
+		buf = append(buf, make([]byte, 8)...) // Amount
+		buf = append(buf, pkScriptLen...)
+		buf = append(buf, 0x51)                   // Public key script
+		buf = append(buf, 0x00, 0x00, 0x00, 0x00) // Lock time
+		return buf
+	}
+	zero, one := []byte{0x00}, []byte{0x01}
+	zeroFD, oneFD := []byte{0xfd, 0x00, 0x00}, []byte{0xfd, 0x01, 0x00}
+	oneFE := []byte{0xfe, 0x01, 0x00, 0x00, 0x00}
+
+	// The canonical encoding must decode.
+	var msg MsgTx
+	err := msg.BtcDecode(bytes.NewReader(encode(one, zero, one, one)), pver)
+	if err != nil {
+		t.Fatalf("BtcDecode: unexpected error for canonical encoding: %v",
+			err)
+	}
+
+	tests := []struct {
+		name string
+		buf  []byte
+	}{
+		{"input count", encode(oneFD, zero, one, one)},
+		{"signature script length", encode(one, zeroFD, one, one)},
+		{"output count", encode(one, zero, oneFE, one)},
+		{"public key script length", encode(one, zero, one, oneFD)},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for _, test := range tests {
+		var msg MsgTx
+		err := msg.BtcDecode(bytes.NewReader(test.buf), pver)
+		if _, ok := err.(*MessageError); !ok {
+			t.Errorf("BtcDecode %s: wrong error - got %v <%T>, want "+
+				"MessageError", test.name, err, err)
+			continue
+		}
+
+		err = msg.Deserialize(bytes.NewReader(test.buf))
+		if _, ok := err.(*MessageError); !ok {
+			t.Errorf("Deserialize %s: wrong error - got %v <%T>, want "+
+				"MessageError", test.name, err, err)
+		}
+	}
+}
+
 // TestTxSerializeSize performs tests to ensure the serialize size for various
 // transactions is accurate.
 func TestTxSerializeSize(t *testing.T) {
@@ -765,6 +833,110 @@ func TestTxSerializeSizeStripped(t *testing.T) {
 	}
 }
 
+// TestTxSerializeBuf ensures the buffer based encoding of transactions
+// produces the same bytes as the writer based encoding and appends to the
+// passed buffer.
+func TestTxSerializeBuf(t *testing.T) {
+	noTx := NewMsgTx(1)
+	tests := []*MsgTx{noTx, multiTx, stripTx, &genesisCoinbaseTx,
+		blockOne.Transactions[0]}
+	prefix := []byte{0xde, 0xad, 0xbe, 0xef}
+
+	t.Logf("Running %d tests", len(tests))
+	for i, tx := range tests {
+		encoders := []struct {
+			name   string
+			encode func(io.Writer) error
+			buf    func([]byte) []byte
+		}{
+			{"BtcEncode", func(w io.Writer) error {
+				return tx.BtcEncode(w, ProtocolVersion)
+			}, func(b []byte) []byte {
+				return tx.BtcEncodeBuf(b, ProtocolVersion)
+			}},
+			{"Serialize", tx.Serialize, tx.SerializeBuf},
+			{"SerializeStripped", tx.SerializeStripped,
+				tx.SerializeStrippedBuf},
+		}
+		for _, enc := range encoders {
+			var want bytes.Buffer
+			if err := enc.encode(&want); err != nil {
+				t.Errorf("%s #%d error %v", enc.name, i, err)
+				continue
+			}
+
+			got := enc.buf(append([]byte(nil), prefix...))
+			if !bytes.Equal(got[:len(prefix)], prefix) {
+				t.Errorf("%sBuf #%d: buffer prefix was modified",
+					enc.name, i)
+				continue
+			}
+			if !bytes.Equal(got[len(prefix):], want.Bytes()) {
+				t.Errorf("%sBuf #%d\n got: %s want: %s", enc.name, i,
+					spew.Sdump(got[len(prefix):]),
+					spew.Sdump(want.Bytes()))
+			}
+		}
+	}
+
+	// Encoding into a buffer with enough capacity must not allocate.
+	buf := make([]byte, 0, multiTx.SerializeSize())
+	allocs := testing.AllocsPerRun(100, func() {
+		buf = multiTx.SerializeBuf(buf[:0])
+	})
+	if allocs != 0 {
+		t.Errorf("SerializeBuf: got %v allocations, want 0", allocs)
+	}
+}
+
+// TestTxSerializeSizeCached ensures the memoized serialize size matches the
+// computed one, is reset by decoding into the transaction and is not carried
+// over to copies.
+func TestTxSerializeSizeCached(t *testing.T) {
+	tx := multiTx.Copy()
+	want := multiTx.SerializeSize()
+	if got := tx.SerializeSizeCached(); got != want {
+		t.Fatalf("SerializeSizeCached: got %d, want %d", got, want)
+	}
+
+	// The memoized size is not invalidated by modifications, but copies
+	// compute their own.
+	tx.TxIn[0].SignatureScript = nil
+	if got := tx.SerializeSizeCached(); got != want {
+		t.Errorf("SerializeSizeCached: got %d, want memoized %d", got,
+			want)
+	}
+	want = tx.SerializeSize()
+	if got := tx.Copy().SerializeSizeCached(); got != want {
+		t.Errorf("SerializeSizeCached of copy: got %d, want %d", got,
+			want)
+	}
+
+	// Decoding replaces the transaction and thus the memoized size.
+	err := tx.Deserialize(bytes.NewReader(stripTxEncoded))
+	if err != nil {
+		t.Fatalf("Deserialize: unexpected error %v", err)
+	}
+	want = tx.SerializeSize()
+	if got := tx.SerializeSizeCached(); got != want {
+		t.Errorf("SerializeSizeCached after decode: got %d, want %d",
+			got, want)
+	}
+
+	// Copies reset the memoized size, so the copies of a transaction which
+	// memoized it and of one which did not compare equal.
+	var decoded MsgTx
+	err = decoded.Deserialize(bytes.NewReader(stripTxEncoded))
+	if err != nil {
+		t.Fatalf("Deserialize: unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(tx.Copy(), decoded.Copy()) {
+		t.Errorf("Copy: copy of the transaction with a memoized size "+
+			"differs - got %v, want %v", spew.Sdump(tx.Copy()),
+			spew.Sdump(decoded.Copy()))
+	}
+}
+
 // stripTx is a MsgTx with an input and empty output.
 var stripTx = &MsgTx{
 	Version: 1,
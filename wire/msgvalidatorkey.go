@@ -0,0 +1,128 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/bitgo/prova/chaincfg/chainhash"
+)
+
+// ValidatorKeyPubKeySize is the size of the compressed public key carried by a
+// validator key announcement.
+const ValidatorKeyPubKeySize = 33
+
+// ValidatorKeyOp identifies the admin operation a validator key announcement
+// describes.
+type ValidatorKeyOp uint8
+
+// These constants define the operations a validator key announcement can
+// describe.
+const (
+	ValidatorKeyProvision ValidatorKeyOp = 1
+	ValidatorKeyRevoke    ValidatorKeyOp = 2
+)
+
+// Map of validator key operations back to their constant names for pretty
+// printing.
+var vkoStrings = map[ValidatorKeyOp]string{
+	ValidatorKeyProvision: "ValidatorKeyProvision",
+	ValidatorKeyRevoke:    "ValidatorKeyRevoke",
+}
+
+// String returns the ValidatorKeyOp in human-readable form.
+func (op ValidatorKeyOp) String() string {
+	if s, ok := vkoStrings[op]; ok {
+		return s
+	}
+
+	return fmt.Sprintf("Unknown ValidatorKeyOp (%d)", uint8(op))
+}
+
+// MsgValidatorKey implements the Message interface and represents a bitcoin
+// validatorkey message.  It is used to announce an admin transaction which
+// provisions or revokes a key on the provision thread as soon as it is seen,
+// rather than only once it confirms, so that unexpected provisioning attempts
+// can be noticed early.  Announcements of ASP keys carry the key ID assigned
+// to the key, while validate keys are not assigned key IDs so their
+// announcements carry zero.
+//
+// Announcements are relayed with inventory vectors of type
+// InvTypeValidatorKey, identified by the hash returned by AnnouncementHash,
+// and only to peers which advertise SFNodeValidatorKey.
+type MsgValidatorKey struct {
+	KeyID  uint32
+	PubKey [ValidatorKeyPubKeySize]byte
+	Op     ValidatorKeyOp
+	TxHash chainhash.Hash
+}
+
+// AnnouncementHash returns the hash which identifies the announcement in
+// inventory vectors.  It is the double SHA256 of the serialized message.
+func (msg *MsgValidatorKey) AnnouncementHash() chainhash.Hash {
+	var buf bytes.Buffer
+	buf.Grow(int(msg.MaxPayloadLength(0)))
+	_ = msg.BtcEncode(&buf, 0)
+	return chainhash.DoubleHashH(buf.Bytes())
+}
+
+// BtcDecode decodes r using the bitcoin protocol encoding into the receiver.
+// This is part of the Message interface implementation.
+func (msg *MsgValidatorKey) BtcDecode(r io.Reader, pver uint32) error {
+	err := readElements(r, &msg.KeyID, &msg.PubKey, (*uint8)(&msg.Op),
+		&msg.TxHash)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := vkoStrings[msg.Op]; !ok {
+		str := fmt.Sprintf("unknown validator key operation %d",
+			uint8(msg.Op))
+		return messageError("MsgValidatorKey.BtcDecode", str)
+	}
+	if msg.PubKey[0] != 0x02 && msg.PubKey[0] != 0x03 {
+		str := fmt.Sprintf("public key is not compressed [format %#x]",
+			msg.PubKey[0])
+		return messageError("MsgValidatorKey.BtcDecode", str)
+	}
+
+	return nil
+}
+
+// BtcEncode encodes the receiver to w using the bitcoin protocol encoding.
+// This is part of the Message interface implementation.
+func (msg *MsgValidatorKey) BtcEncode(w io.Writer, pver uint32) error {
+	return writeElements(w, msg.KeyID, msg.PubKey, uint8(msg.Op),
+		&msg.TxHash)
+}
+
+// Command returns the protocol command string for the message.  This is part
+// of the Message interface implementation.
+func (msg *MsgValidatorKey) Command() string {
+	return CmdValidatorKey
+}
+
+// MaxPayloadLength returns the maximum length the payload can be for the
+// receiver.  This is part of the Message interface implementation.
+func (msg *MsgValidatorKey) MaxPayloadLength(pver uint32) uint32 {
+	// Key ID 4 bytes + public key + operation 1 byte + transaction hash.
+	return 4 + ValidatorKeyPubKeySize + 1 + chainhash.HashSize
+}
+
+// NewMsgValidatorKey returns a new bitcoin validatorkey message that conforms
+// to the Message interface using the passed parameters.  See MsgValidatorKey
+// for details.
+func NewMsgValidatorKey(keyID uint32, pubKey [ValidatorKeyPubKeySize]byte,
+	op ValidatorKeyOp, txHash *chainhash.Hash) *MsgValidatorKey {
+
+	return &MsgValidatorKey{
+		KeyID:  keyID,
+		PubKey: pubKey,
+		Op:     op,
+		TxHash: *txHash,
+	}
+}
@@ -0,0 +1,220 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/bitgo/prova/chaincfg/chainhash"
+	"github.com/davecgh/go-spew/spew"
+)
+
+// testValidatorKeyPubKey is the compressed public key used by the validator
+// key announcements of the tests.
+var testValidatorKeyPubKey = [ValidatorKeyPubKeySize]byte{
+	0x03, 0x5f, 0x51, 0x03, 0x85, 0x2b, 0xd7, 0xd9,
+	0xc9, 0xc2, 0x8e, 0x44, 0xca, 0xf1, 0xf7, 0x18,
+	0x89, 0x41, 0xe1, 0x62, 0x95, 0x06, 0x2c, 0xa4,
+	0xc8, 0x99, 0x28, 0xa8, 0xcc, 0xff, 0x99, 0x3c,
+	0xd3,
+}
+
+// TestValidatorKey tests the MsgValidatorKey API.
+func TestValidatorKey(t *testing.T) {
+	pver := ProtocolVersion
+
+	txHash := chainhash.Hash{0x01, 0x02}
+	msg := NewMsgValidatorKey(7, testValidatorKeyPubKey,
+		ValidatorKeyProvision, &txHash)
+	if msg.KeyID != 7 || msg.PubKey != testValidatorKeyPubKey ||
+		msg.Op != ValidatorKeyProvision || msg.TxHash != txHash {
+
+		t.Errorf("NewMsgValidatorKey: wrong fields - got %v",
+			spew.Sdump(msg))
+	}
+
+	// Ensure the command is expected value.
+	wantCmd := "validatorkey"
+	if cmd := msg.Command(); cmd != wantCmd {
+		t.Errorf("NewMsgValidatorKey: wrong command - got %v want %v",
+			cmd, wantCmd)
+	}
+
+	// Ensure max payload is expected value.
+	wantPayload := uint32(70)
+	maxPayload := msg.MaxPayloadLength(pver)
+	if maxPayload != wantPayload {
+		t.Errorf("MaxPayloadLength: wrong max payload length for "+
+			"protocol version %d - got %v, want %v", pver,
+			maxPayload, wantPayload)
+	}
+
+	// Ensure the announcement hash commits to every field.
+	hash := msg.AnnouncementHash()
+	revoke := *msg
+	revoke.Op = ValidatorKeyRevoke
+	if revoke.AnnouncementHash() == hash {
+		t.Errorf("AnnouncementHash: operation not committed to")
+	}
+	otherKeyID := *msg
+	otherKeyID.KeyID = 8
+	if otherKeyID.AnnouncementHash() == hash {
+		t.Errorf("AnnouncementHash: key id not committed to")
+	}
+
+	// Ensure the operations are stringized correctly.
+	opTests := []struct {
+		in   ValidatorKeyOp
+		want string
+	}{
+		{ValidatorKeyProvision, "ValidatorKeyProvision"},
+		{ValidatorKeyRevoke, "ValidatorKeyRevoke"},
+		{0xff, "Unknown ValidatorKeyOp (255)"},
+	}
+	for i, test := range opTests {
+		if result := test.in.String(); result != test.want {
+			t.Errorf("String #%d\n got: %s want: %s", i, result,
+				test.want)
+		}
+	}
+}
+
+// TestValidatorKeyWire tests the MsgValidatorKey wire encode and decode for
+// both operations.
+func TestValidatorKeyWire(t *testing.T) {
+	txHash := chainhash.Hash{
+		0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08,
+	}
+	encodedTxHash := []byte{
+		0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	}
+	encode := func(keyID []byte, op byte) []byte {
+		var b []byte
+		b = append(b, keyID...)
+		b = append(b, testValidatorKeyPubKey[:]...)
+		b = append(b, op)
+		return append(b, encodedTxHash...)
+	}
+
+	tests := []struct {
+		in  *MsgValidatorKey // Message to encode
+		buf []byte           // Wire encoding
+	}{
+		// Provisioning of a validate key.
+		{
+			NewMsgValidatorKey(0, testValidatorKeyPubKey,
+				ValidatorKeyProvision, &txHash),
+			encode([]byte{0x00, 0x00, 0x00, 0x00}, 0x01),
+		},
+
+		// Revocation of an ASP key.
+		{
+			NewMsgValidatorKey(0x01020304, testValidatorKeyPubKey,
+				ValidatorKeyRevoke, &txHash),
+			encode([]byte{0x04, 0x03, 0x02, 0x01}, 0x02),
+		},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for i, test := range tests {
+		// Encode the message to wire format.
+		var buf bytes.Buffer
+		err := test.in.BtcEncode(&buf, ProtocolVersion)
+		if err != nil {
+			t.Errorf("BtcEncode #%d error %v", i, err)
+			continue
+		}
+		if !bytes.Equal(buf.Bytes(), test.buf) {
+			t.Errorf("BtcEncode #%d\n got: %s want: %s", i,
+				spew.Sdump(buf.Bytes()), spew.Sdump(test.buf))
+			continue
+		}
+
+		// Decode the message from wire format.
+		var msg MsgValidatorKey
+		rbuf := bytes.NewReader(test.buf)
+		err = msg.BtcDecode(rbuf, ProtocolVersion)
+		if err != nil {
+			t.Errorf("BtcDecode #%d error %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(&msg, test.in) {
+			t.Errorf("BtcDecode #%d\n got: %s want: %s", i,
+				spew.Sdump(msg), spew.Sdump(test.in))
+			continue
+		}
+	}
+}
+
+// TestValidatorKeyWireErrors performs negative tests against wire encode and
+// decode of MsgValidatorKey to confirm error paths work correctly.
+func TestValidatorKeyWireErrors(t *testing.T) {
+	pver := ProtocolVersion
+	wireErr := &MessageError{}
+
+	txHash := chainhash.Hash{0x01}
+	baseMsg := NewMsgValidatorKey(1, testValidatorKeyPubKey,
+		ValidatorKeyProvision, &txHash)
+	var baseBuf bytes.Buffer
+	baseMsg.BtcEncode(&baseBuf, pver)
+	baseEncoded := baseBuf.Bytes()
+
+	// An unknown operation.
+	badOp := append([]byte{}, baseEncoded...)
+	badOp[4+ValidatorKeyPubKeySize] = 0x03
+
+	// An uncompressed public key format.
+	badPubKey := append([]byte{}, baseEncoded...)
+	badPubKey[4] = 0x04
+
+	tests := []struct {
+		in       *MsgValidatorKey // Value to encode
+		buf      []byte           // Wire encoding
+		max      int              // Max size of fixed buffer to induce errors
+		writeErr error            // Expected write error
+		readErr  error            // Expected read error
+	}{
+		// Force error in key id.
+		{baseMsg, baseEncoded, 0, io.ErrShortWrite, io.EOF},
+		// Force error in public key.
+		{baseMsg, baseEncoded, 4, io.ErrShortWrite, io.EOF},
+		// Force error in operation.
+		{baseMsg, baseEncoded, 37, io.ErrShortWrite, io.EOF},
+		// Force error in transaction hash.
+		{baseMsg, baseEncoded, 38, io.ErrShortWrite, io.EOF},
+		// Force error due to an unknown operation.
+		{baseMsg, badOp, 70, nil, wireErr},
+		// Force error due to an uncompressed public key.
+		{baseMsg, badPubKey, 70, nil, wireErr},
+	}
+
+	t.Logf("Running %d tests", len(tests))
+	for i, test := range tests {
+		// Encode to wire format.
+		w := newFixedWriter(test.max)
+		err := test.in.BtcEncode(w, pver)
+		if reflect.TypeOf(err) != reflect.TypeOf(test.writeErr) {
+			t.Errorf("BtcEncode #%d wrong error got: %v, want: %v",
+				i, err, test.writeErr)
+			continue
+		}
+
+		// Decode from wire format.
+		var msg MsgValidatorKey
+		r := newFixedReader(test.max, test.buf)
+		err = msg.BtcDecode(r, pver)
+		if reflect.TypeOf(err) != reflect.TypeOf(test.readErr) {
+			t.Errorf("BtcDecode #%d wrong error got: %v, want: %v",
+				i, err, test.readErr)
+			continue
+		}
+	}
+}
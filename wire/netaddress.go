@@ -45,6 +45,20 @@ type NetAddress struct {
 	// Port the peer is using.  This is encoded in big endian on the wire
 	// which differs from most everything else.
 	Port uint16
+
+	// NetID and Addr identify the address of a peer on a network whose
+	// addresses can not be represented as an IP address, such as Tor v3
+	// and I2P.  Such addresses can only be relayed with addrv2 messages.
+	// Addr is nil for IP addresses, which are identified by IP alone.
+	NetID NetworkID
+	Addr  []byte
+}
+
+// IsLegacy returns whether the address can be represented in the legacy
+// format of addr and version messages, which is the case for IP addresses
+// including Tor v2 addresses mapped into the onioncat range.
+func (na *NetAddress) IsLegacy() bool {
+	return na.Addr == nil
 }
 
 // HasService returns whether the specified service is supported by the address.
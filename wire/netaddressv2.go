@@ -0,0 +1,228 @@
+// Copyright (c) 2017 BitGo
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package wire
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// NetworkID identifies the network of an address in the addrv2 format.
+type NetworkID uint8
+
+// These constants define the networks addresses in the addrv2 format can
+// belong to.
+const (
+	NetIDIPv4  NetworkID = 1
+	NetIDIPv6  NetworkID = 2
+	NetIDTorV2 NetworkID = 3
+	NetIDTorV3 NetworkID = 4
+	NetIDI2P   NetworkID = 5
+	NetIDCJDNS NetworkID = 6
+)
+
+// MaxNetAddressV2Size is the maximum size of an address in the addrv2 format.
+// Messages containing larger addresses, even of unknown networks, are
+// invalid.
+const MaxNetAddressV2Size = 512
+
+// netIDStrings is a map of network IDs back to their constant names for pretty
+// printing.
+var netIDStrings = map[NetworkID]string{
+	NetIDIPv4:  "IPv4",
+	NetIDIPv6:  "IPv6",
+	NetIDTorV2: "TorV2",
+	NetIDTorV3: "TorV3",
+	NetIDI2P:   "I2P",
+	NetIDCJDNS: "CJDNS",
+}
+
+// netIDAddrSizes is a map of the known network IDs to the size of their
+// addresses.
+var netIDAddrSizes = map[NetworkID]int{
+	NetIDIPv4:  4,
+	NetIDIPv6:  16,
+	NetIDTorV2: 10,
+	NetIDTorV3: 32,
+	NetIDI2P:   32,
+	NetIDCJDNS: 16,
+}
+
+// onionCatPrefix is the IPv6 prefix Tor v2 addresses are mapped into so they
+// can be represented as an IP address.
+var onionCatPrefix = []byte{0xfd, 0x87, 0xd8, 0x7e, 0xeb, 0x43}
+
+// String returns the NetworkID in human-readable form.
+func (id NetworkID) String() string {
+	if s, ok := netIDStrings[id]; ok {
+		return s
+	}
+
+	return fmt.Sprintf("Unknown NetworkID (%d)", uint8(id))
+}
+
+// AddrSize returns the size of addresses of the network and whether the
+// network is known.
+func (id NetworkID) AddrSize() (int, bool) {
+	size, ok := netIDAddrSizes[id]
+	return size, ok
+}
+
+// NetworkID returns the network the address belongs to.  IP addresses are
+// IPv4 or IPv6 addresses, unless they are Tor v2 addresses mapped into the
+// onioncat range.
+func (na *NetAddress) NetworkID() NetworkID {
+	switch {
+	case na.Addr != nil:
+		return na.NetID
+	case na.IP.To4() != nil:
+		return NetIDIPv4
+	case bytes.HasPrefix(na.IP, onionCatPrefix):
+		return NetIDTorV2
+	default:
+		return NetIDIPv6
+	}
+}
+
+// NewNetAddressV2 returns a new NetAddress for the passed address of the
+// passed network, port and supported services with defaults for the
+// remaining fields.  Addresses which can be represented as an IP address are
+// stored as such, so only Tor v3 and I2P addresses make use of the NetID and
+// Addr fields.  An error is returned when the network is unknown or the
+// address does not have the size of addresses of the network.
+func NewNetAddressV2(netID NetworkID, addr []byte, port uint16,
+	services ServiceFlag) (*NetAddress, error) {
+
+	na := NewNetAddressTimestamp(time.Now(), services, nil, port)
+	if err := na.setAddrV2(netID, addr); err != nil {
+		return nil, err
+	}
+	return na, nil
+}
+
+// setAddrV2 sets the address of na to the passed address of the passed
+// network.
+func (na *NetAddress) setAddrV2(netID NetworkID, addr []byte) error {
+	size, ok := netID.AddrSize()
+	if !ok {
+		str := fmt.Sprintf("unknown network id %d", uint8(netID))
+		return messageError("NetAddress.setAddrV2", str)
+	}
+	if len(addr) != size {
+		str := fmt.Sprintf("%v address has size %d [want %d]", netID,
+			len(addr), size)
+		return messageError("NetAddress.setAddrV2", str)
+	}
+
+	na.IP, na.NetID, na.Addr = nil, 0, nil
+	switch netID {
+	case NetIDIPv4:
+		na.IP = net.IPv4(addr[0], addr[1], addr[2], addr[3])
+	case NetIDTorV2:
+		na.IP = make(net.IP, net.IPv6len)
+		copy(na.IP, onionCatPrefix)
+		copy(na.IP[len(onionCatPrefix):], addr)
+	case NetIDIPv6, NetIDCJDNS:
+		na.IP = make(net.IP, net.IPv6len)
+		copy(na.IP, addr)
+	default:
+		na.NetID = netID
+		na.Addr = make([]byte, size)
+		copy(na.Addr, addr)
+	}
+	return nil
+}
+
+// addrV2Bytes returns the address of na as it is encoded in the addrv2
+// format.
+func (na *NetAddress) addrV2Bytes() []byte {
+	switch netID := na.NetworkID(); netID {
+	case NetIDIPv4:
+		return na.IP.To4()
+	case NetIDTorV2:
+		return na.IP[len(onionCatPrefix):]
+	case NetIDIPv6:
+		// Ensure to always write 16 bytes even if the ip is nil.
+		var ip [16]byte
+		copy(ip[:], na.IP.To16())
+		return ip[:]
+	default:
+		return na.Addr
+	}
+}
+
+// readNetAddressV2 reads an encoded NetAddress in the addrv2 format from r.
+// Addresses of unknown networks are read in full so the remaining addresses of
+// a message can be decoded, but are reported as unknown by returning false.
+func readNetAddressV2(r io.Reader, pver uint32, na *NetAddress) (bool, error) {
+	err := readElement(r, (*uint32Time)(&na.Timestamp))
+	if err != nil {
+		return false, err
+	}
+
+	services, err := ReadVarInt(r, pver)
+	if err != nil {
+		return false, err
+	}
+	na.Services = ServiceFlag(services)
+
+	var netID NetworkID
+	err = readElement(r, (*uint8)(&netID))
+	if err != nil {
+		return false, err
+	}
+	addr, err := ReadVarBytes(r, pver, MaxNetAddressV2Size, "address")
+	if err != nil {
+		return false, err
+	}
+
+	// Sigh.  Bitcoin protocol mixes little and big endian.
+	na.Port, err = binarySerializer.Uint16(r, bigEndian)
+	if err != nil {
+		return false, err
+	}
+
+	if _, ok := netID.AddrSize(); !ok {
+		return false, nil
+	}
+	if err := na.setAddrV2(netID, addr); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// writeNetAddressV2 serializes a NetAddress to w in the addrv2 format.
+func writeNetAddressV2(w io.Writer, pver uint32, na *NetAddress) error {
+	netID := na.NetworkID()
+	addr := na.addrV2Bytes()
+	if size, ok := netID.AddrSize(); !ok || len(addr) != size {
+		str := fmt.Sprintf("invalid %v address %x", netID, addr)
+		return messageError("writeNetAddressV2", str)
+	}
+
+	err := writeElement(w, uint32(na.Timestamp.Unix()))
+	if err != nil {
+		return err
+	}
+	err = WriteVarInt(w, pver, uint64(na.Services))
+	if err != nil {
+		return err
+	}
+	err = writeElement(w, uint8(netID))
+	if err != nil {
+		return err
+	}
+	err = WriteVarBytes(w, pver, addr)
+	if err != nil {
+		return err
+	}
+
+	// Sigh.  Bitcoin protocol mixes little and big endian.
+	return binary.Write(w, bigEndian, na.Port)
+}
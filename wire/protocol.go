@@ -9,11 +9,12 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 const (
 	// ProtocolVersion is the latest protocol version this package supports.
-	ProtocolVersion uint32 = 70013
+	ProtocolVersion uint32 = 70015
 
 	// MultipleAddressVersion is the protocol version which added multiple
 	// addresses per message (pver >= MultipleAddressVersion).
@@ -51,6 +52,15 @@ const (
 	// FeeFilterVersion is the protocol version which added a new
 	// feefilter message.
 	FeeFilterVersion uint32 = 70013
+
+	// SendCmpctVersion is the protocol version which added the compact
+	// block relay messages sendcmpct, cmpctblock, getblocktxn and
+	// blocktxn.
+	SendCmpctVersion uint32 = 70014
+
+	// AddrV2Version is the protocol version which added the sendaddrv2
+	// and addrv2 messages.
+	AddrV2Version uint32 = 70015
 )
 
 // ServiceFlag identifies services supported by a bitcoin peer.
@@ -67,13 +77,18 @@ const (
 	// SFNodeBloom is a flag used to indiciate a peer supports bloom
 	// filtering.
 	SFNodeBloom
+
+	// SFNodeValidatorKey is a flag used to indicate a peer relays
+	// validator key announcements (MsgValidatorKey).
+	SFNodeValidatorKey
 )
 
 // Map of service flags back to their constant names for pretty printing.
 var sfStrings = map[ServiceFlag]string{
-	SFNodeNetwork: "SFNodeNetwork",
-	SFNodeGetUTXO: "SFNodeGetUTXO",
-	SFNodeBloom:   "SFNodeBloom",
+	SFNodeNetwork:      "SFNodeNetwork",
+	SFNodeGetUTXO:      "SFNodeGetUTXO",
+	SFNodeBloom:        "SFNodeBloom",
+	SFNodeValidatorKey: "SFNodeValidatorKey",
 }
 
 // orderedSFStrings is an ordered list of service flags from highest to
@@ -82,6 +97,7 @@ var orderedSFStrings = []ServiceFlag{
 	SFNodeNetwork,
 	SFNodeGetUTXO,
 	SFNodeBloom,
+	SFNodeValidatorKey,
 }
 
 // String returns the ServiceFlag in human-readable form.
@@ -131,19 +147,43 @@ const (
 )
 
 // bnStrings is a map of bitcoin networks back to their constant names for
-// pretty printing.
-var bnStrings = map[BitcoinNet]string{
-	MainNet: "MainNet",
-	RegNet:  "RegNet",
-	TestNet: "TestNet",
-	SimNet:  "SimNet",
+// pretty printing.  Names of custom networks are added to it at runtime by
+// RegisterNetName, so it is protected by bnStringsMtx.
+var (
+	bnStringsMtx sync.RWMutex
+	bnStrings    = map[BitcoinNet]string{
+		MainNet: "MainNet",
+		RegNet:  "RegNet",
+		TestNet: "TestNet",
+		SimNet:  "SimNet",
+	}
+)
+
+// RegisterNetName associates the passed name with the passed bitcoin network so
+// it is used when the network is printed.  This is intended for custom networks
+// which are registered at runtime.  The names of the built-in networks and of
+// networks which already have a name are not changed.
+//
+// This function is safe for concurrent access.
+func RegisterNetName(net BitcoinNet, name string) {
+	bnStringsMtx.Lock()
+	if _, ok := bnStrings[net]; !ok && name != "" {
+		bnStrings[net] = name
+	}
+	bnStringsMtx.Unlock()
 }
 
-// String returns the BitcoinNet in human-readable form.
+// String returns the BitcoinNet in human-readable form.  Networks without a
+// name are printed as their hex magic.
+//
+// This function is safe for concurrent access.
 func (n BitcoinNet) String() string {
-	if s, ok := bnStrings[n]; ok {
+	bnStringsMtx.RLock()
+	s, ok := bnStrings[n]
+	bnStringsMtx.RUnlock()
+	if ok {
 		return s
 	}
 
-	return fmt.Sprintf("Unknown BitcoinNet (%d)", uint32(n))
+	return fmt.Sprintf("Unknown BitcoinNet (0x%08x)", uint32(n))
 }
@@ -5,7 +5,11 @@
 
 package wire
 
-import "testing"
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
 
 // TestServiceFlagStringer tests the stringized output for service flag types.
 func TestServiceFlagStringer(t *testing.T) {
@@ -17,7 +21,9 @@ func TestServiceFlagStringer(t *testing.T) {
 		{SFNodeNetwork, "SFNodeNetwork"},
 		{SFNodeGetUTXO, "SFNodeGetUTXO"},
 		{SFNodeBloom, "SFNodeBloom"},
-		{0xffffffff, "SFNodeNetwork|SFNodeGetUTXO|SFNodeBloom|0xfffffff8"},
+		{SFNodeValidatorKey, "SFNodeValidatorKey"},
+		{0xffffffff, "SFNodeNetwork|SFNodeGetUTXO|SFNodeBloom|" +
+			"SFNodeValidatorKey|0xfffffff0"},
 	}
 
 	t.Logf("Running %d tests", len(tests))
@@ -41,7 +47,8 @@ func TestBitcoinNetStringer(t *testing.T) {
 		{RegNet, "RegNet"},
 		{TestNet, "TestNet"},
 		{SimNet, "SimNet"},
-		{0xffffffff, "Unknown BitcoinNet (4294967295)"},
+		{0xffffffff, "Unknown BitcoinNet (0xffffffff)"},
+		{0x0000abcd, "Unknown BitcoinNet (0x0000abcd)"},
 	}
 
 	t.Logf("Running %d tests", len(tests))
@@ -54,3 +61,53 @@ func TestBitcoinNetStringer(t *testing.T) {
 		}
 	}
 }
+
+// TestRegisterNetName ensures registered network names are used when printing
+// networks, that the names of the built-in networks and of networks which
+// already have a name are not replaced, and that names can be registered and
+// printed concurrently.
+func TestRegisterNetName(t *testing.T) {
+	customNet := BitcoinNet(0xfeedbeef)
+	if got, want := customNet.String(), "Unknown BitcoinNet (0xfeedbeef)"; got != want {
+		t.Fatalf("unregistered network printed as %q, want %q", got, want)
+	}
+
+	RegisterNetName(customNet, "customnet")
+	RegisterNetName(customNet, "othername")
+	RegisterNetName(MainNet, "mainnet")
+	RegisterNetName(BitcoinNet(0xfeedbeee), "")
+	tests := []struct {
+		in   BitcoinNet
+		want string
+	}{
+		{customNet, "customnet"},
+		{MainNet, "MainNet"},
+		{0xfeedbeee, "Unknown BitcoinNet (0xfeedbeee)"},
+	}
+	for i, test := range tests {
+		if result := test.in.String(); result != test.want {
+			t.Errorf("String #%d\n got: %s want: %s", i, result,
+				test.want)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			net := BitcoinNet(0xfeed0000 + uint32(i))
+			RegisterNetName(net, fmt.Sprintf("concurrentnet%d", i))
+			for j := 0; j < 100; j++ {
+				_ = MainNet.String()
+				_ = customNet.String()
+			}
+			want := fmt.Sprintf("concurrentnet%d", i)
+			if got := net.String(); got != want {
+				t.Errorf("concurrent network printed as %q, "+
+					"want %q", got, want)
+			}
+		}(i)
+	}
+	wg.Wait()
+}